@@ -0,0 +1,570 @@
+// Package arc implements the Authenticated Received Chain (ARC), RFC 8617.
+//
+// Intermediaries like mailing lists and forwarding services often modify
+// messages, breaking DKIM signatures, and deliver from their own IPs, breaking
+// SPF. With ARC, each intermediary records the authentication results it saw in
+// a new ARC set, and signs ("seals") the set along with all earlier sets. A
+// receiver that trusts an intermediary can use the recorded results, e.g. to not
+// reject a message that fails DMARC after modification.
+//
+// An ARC set consists of three headers with the same instance (i=), starting at
+// 1: ARC-Authentication-Results with the results seen by the intermediary,
+// ARC-Message-Signature, a DKIM signature of the message as sent by the
+// intermediary, and ARC-Seal, a signature over all ARC sets.
+package arc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var timeNow = time.Now // Replaced during tests.
+
+// Status is the result of verifying an ARC chain, and the chain validation
+// status (cv=) in an ARC-Seal header.
+type Status string
+
+const (
+	StatusNone Status = "none" // Message has no ARC sets. Or for cv=, the ARC set is the first.
+	StatusPass Status = "pass" // ARC chain is valid.
+	StatusFail Status = "fail" // ARC chain is invalid.
+)
+
+// Maximum number of ARC sets in a message. ../rfc/8617
+const maxInstances = 50
+
+var (
+	ErrStructure        = errors.New("arc: invalid arc chain structure")
+	ErrChainFailed      = errors.New("arc: arc chain marked as failed by sealer")
+	ErrMessageSignature = errors.New("arc: arc-message-signature not valid")
+	ErrSeal             = errors.New("arc: arc-seal not valid")
+	ErrSealSyntax       = errors.New("arc: arc-seal syntax error")
+	ErrTooManyInstances = errors.New("arc: too many arc sets")
+)
+
+// Seal is a parsed ARC-Seal header.
+type Seal struct {
+	Instance        int        // Field "i".
+	AlgorithmSign   string     // "rsa" or "ed25519". Field "a".
+	AlgorithmHash   string     // Always "sha256". Field "a".
+	Signature       []byte     // Field "b".
+	ChainValidation Status     // Field "cv".
+	Domain          dns.Domain // Field "d".
+	Selector        dns.Domain // Field "s".
+	Timestamp       int64      // Unix epoch. -1 if unset. Field "t".
+}
+
+// Header returns the ARC-Seal header in string form, including field name and
+// trailing crlf.
+func (s Seal) Header() string {
+	w := &message.HeaderWriter{}
+	w.Addf("", "ARC-Seal: i=%d;", s.Instance)
+	w.Addf(" ", "a=%s-%s;", s.AlgorithmSign, s.AlgorithmHash)
+	w.Addf(" ", "d=%s;", s.Domain.ASCII)
+	w.Addf(" ", "s=%s;", s.Selector.ASCII)
+	w.Addf(" ", "cv=%s;", s.ChainValidation)
+	if s.Timestamp >= 0 {
+		w.Addf(" ", "t=%d;", s.Timestamp)
+	}
+	w.Addf(" ", "b=")
+	if len(s.Signature) > 0 {
+		w.AddWrap([]byte(base64.StdEncoding.EncodeToString(s.Signature)))
+	}
+	return w.String()
+}
+
+// Set is an ARC set of a message. The headers are as they occur in the message,
+// including trailing crlf.
+type Set struct {
+	Instance int
+	AAR      []byte // ARC-Authentication-Results.
+	AMS      []byte // ARC-Message-Signature.
+	AS       []byte // ARC-Seal.
+	Seal     *Seal  // Parsed form of AS.
+}
+
+// AuthResults parses the ARC-Authentication-Results header of the set, with the
+// authentication results as seen by the sealer of the set.
+func (s Set) AuthResults() (message.AuthResults, error) {
+	_, v, ok := strings.Cut(string(s.AAR), ":")
+	if !ok {
+		return message.AuthResults{}, fmt.Errorf("missing colon in header")
+	}
+	_, v, ok = strings.Cut(v, ";") // Skip instance.
+	if !ok {
+		return message.AuthResults{}, fmt.Errorf("missing authserv-id")
+	}
+	return message.ParseAuthResults(v)
+}
+
+// Result is the result of verifying the ARC chain of a message.
+type Result struct {
+	Status Status
+	Sets   []Set // Ordered by instance. Only set if the chain has a valid structure.
+
+	// For status pass, the lowest instance for which the ARC-Message-Signature still
+	// verifies, or 0 if all verify. For the header.oldest-pass property in an
+	// Authentication-Results header.
+	OldestPass int
+
+	Err error // Details for status fail.
+}
+
+// Sealer returns the domain of the most recent ARC-Seal, or the zero value if
+// the message has no ARC sets.
+func (r Result) Sealer() dns.Domain {
+	if len(r.Sets) == 0 {
+		return dns.Domain{}
+	}
+	return r.Sets[len(r.Sets)-1].Seal.Domain
+}
+
+// Verify verifies the ARC chain of a message, with the DKIM public keys of the
+// sealers looked up through resolver.
+//
+// The result has status none if the message has no ARC headers. The caller
+// decides whether to trust the most recent sealer of a chain with status pass.
+func Verify(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, smtputf8 bool, msg io.ReaderAt) (result Result) {
+	log := mlog.New("arc", elog)
+	start := timeNow()
+	defer func() {
+		log.Debugx("arc verify result", result.Err,
+			slog.Any("status", result.Status),
+			slog.Int("sets", len(result.Sets)),
+			slog.Int("oldestpass", result.OldestPass),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	hdrs, err := dkim.ParseRawHeaders(msg)
+	if err != nil {
+		return Result{Status: StatusFail, Err: err}
+	}
+	sets, err := parseSets(hdrs)
+	if err != nil {
+		return Result{Status: StatusFail, Err: err}
+	} else if len(sets) == 0 {
+		return Result{Status: StatusNone}
+	}
+
+	r := Result{Sets: sets}
+	fail := func(err error) Result {
+		r.Status = StatusFail
+		r.Err = err
+		return r
+	}
+
+	// Chain validation statuses. ../rfc/8617
+	n := len(sets)
+	if sets[n-1].Seal.ChainValidation == StatusFail {
+		return fail(ErrChainFailed)
+	}
+	for i, s := range sets {
+		exp := StatusPass
+		if i == 0 {
+			exp = StatusNone
+		}
+		if s.Seal.ChainValidation != exp {
+			return fail(fmt.Errorf("%w: arc-seal instance %d has cv=%s, expected %s", ErrStructure, s.Instance, s.Seal.ChainValidation, exp))
+		}
+	}
+
+	// The most recent ARC-Message-Signature must verify.
+	amsResult := dkim.VerifyARCMessageSignature(ctx, log.Logger, resolver, smtputf8, sets[n-1].AMS, msg)
+	if amsResult.Status != dkim.StatusPass {
+		return fail(fmt.Errorf("%w: instance %d: %s: %v", ErrMessageSignature, n, amsResult.Status, amsResult.Err))
+	}
+
+	// All seals must verify, starting with the most recent.
+	for i := n; i >= 1; i-- {
+		if err := verifySeal(ctx, log, resolver, sets[:i]); err != nil {
+			return fail(err)
+		}
+	}
+
+	// Find the oldest ARC-Message-Signature that still verifies.
+	for i := n - 1; i >= 1; i-- {
+		res := dkim.VerifyARCMessageSignature(ctx, log.Logger, resolver, smtputf8, sets[i-1].AMS, msg)
+		if res.Status != dkim.StatusPass {
+			r.OldestPass = i + 1
+			break
+		}
+	}
+
+	r.Status = StatusPass
+	return r
+}
+
+// Sign returns headers for a new ARC set for msg, to be prepended to msg: an
+// ARC-Seal, ARC-Message-Signature and ARC-Authentication-Results, each ending
+// in crlf. The set is sealed for domain with the key from sel.
+//
+// cv must be the status of verifying the existing ARC chain of msg. It is
+// ignored for messages without ARC sets. A chain already marked as failed is not
+// extended. authResults typically holds the results of authentication checks
+// for the message, including of the ARC chain.
+func Sign(ctx context.Context, elog *slog.Logger, domain dns.Domain, sel dkim.Selector, smtputf8 bool, msg io.ReaderAt, cv Status, authResults message.AuthResults) (headers string, rerr error) {
+	log := mlog.New("arc", elog)
+	start := timeNow()
+	defer func() {
+		log.Debugx("arc sign result", rerr,
+			slog.Any("domain", domain),
+			slog.Any("cv", cv),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	hdrs, err := dkim.ParseRawHeaders(msg)
+	if err != nil {
+		return "", err
+	}
+	sets, err := parseSets(hdrs)
+	if err != nil {
+		return "", fmt.Errorf("parsing existing arc sets: %w", err)
+	}
+	if len(sets) == 0 {
+		cv = StatusNone
+	} else if sets[len(sets)-1].Seal.ChainValidation == StatusFail {
+		return "", ErrChainFailed
+	} else if cv != StatusPass && cv != StatusFail {
+		return "", fmt.Errorf("chain validation status must be pass or fail for message with arc sets, not %q", cv)
+	}
+	if len(sets) >= maxInstances {
+		return "", ErrTooManyInstances
+	}
+	instance := len(sets) + 1
+
+	aar := authResults.ARCHeader(instance)
+
+	// ARC only allows sha256. ../rfc/8617
+	sel.Hash = "sha256"
+	ams, err := dkim.SignARCMessageSignature(ctx, log.Logger, instance, domain, sel, smtputf8, msg)
+	if err != nil {
+		return "", fmt.Errorf("signing arc-message-signature: %w", err)
+	}
+
+	seal := Seal{
+		Instance:        instance,
+		AlgorithmHash:   "sha256",
+		ChainValidation: cv,
+		Domain:          domain,
+		Selector:        sel.Domain,
+		Timestamp:       timeNow().Unix(),
+	}
+	switch sel.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		seal.AlgorithmSign = "rsa"
+	case ed25519.PrivateKey:
+		seal.AlgorithmSign = "ed25519"
+	default:
+		return "", fmt.Errorf("internal error, unknown private key %T", sel.PrivateKey)
+	}
+
+	as := seal.Header()
+	sets = append(sets, Set{instance, []byte(aar), []byte(ams), []byte(as), &seal})
+	digest, err := sealHash(sets, []byte(as))
+	if err != nil {
+		return "", err
+	}
+	switch key := sel.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		seal.Signature, err = key.Sign(cryptorand.Reader, digest, crypto.SHA256)
+	case ed25519.PrivateKey:
+		// PureEdDSA over the sha256 hash, like DKIM. ../rfc/8463:123
+		seal.Signature, err = key.Sign(cryptorand.Reader, digest, crypto.Hash(0))
+	}
+	if err != nil {
+		return "", fmt.Errorf("signing arc-seal: %v", err)
+	}
+
+	return seal.Header() + ams + aar, nil
+}
+
+// verifySeal verifies the ARC-Seal of the last of sets.
+func verifySeal(ctx context.Context, log mlog.Log, resolver dns.Resolver, sets []Set) error {
+	s := sets[len(sets)-1]
+	seal := s.Seal
+
+	stripped, err := withoutSignature(s.AS)
+	if err != nil {
+		return fmt.Errorf("%w: instance %d: %v", ErrSeal, s.Instance, err)
+	}
+	digest, err := sealHash(sets, stripped)
+	if err != nil {
+		return fmt.Errorf("%w: instance %d: %v", ErrSeal, s.Instance, err)
+	}
+
+	_, record, _, _, err := dkim.Lookup(ctx, log.Logger, resolver, seal.Selector, seal.Domain)
+	if err != nil {
+		return fmt.Errorf("%w: instance %d: looking up key: %v", ErrSeal, s.Instance, err)
+	}
+	if !strings.EqualFold(record.Key, seal.AlgorithmSign) {
+		return fmt.Errorf("%w: instance %d: dns record has key type %q, seal has algorithm %q", ErrSeal, s.Instance, record.Key, seal.AlgorithmSign)
+	}
+	switch k := record.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, seal.Signature); err != nil {
+			return fmt.Errorf("%w: instance %d: rsa verification: %v", ErrSeal, s.Instance, err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest, seal.Signature) {
+			return fmt.Errorf("%w: instance %d: ed25519 verification failed", ErrSeal, s.Instance)
+		}
+	default:
+		return fmt.Errorf("%w: instance %d: no usable public key in dns record", ErrSeal, s.Instance)
+	}
+	return nil
+}
+
+// sealHash returns the hash that is signed in the ARC-Seal of the last of sets:
+// over the relaxed canonical headers of all sets, with lastSeal, the ARC-Seal
+// header of the last set without signature value, at the end without crlf.
+// ../rfc/8617
+func sealHash(sets []Set, lastSeal []byte) ([]byte, error) {
+	h := sha256.New()
+	for i, s := range sets {
+		for j, hdr := range [][]byte{s.AAR, s.AMS, s.AS} {
+			last := i == len(sets)-1 && j == 2
+			if last {
+				hdr = lastSeal
+			}
+			ch, err := dkim.RelaxedCanonicalHeader(string(hdr))
+			if err != nil {
+				return nil, err
+			}
+			h.Write([]byte(ch))
+			if !last {
+				h.Write([]byte("\r\n"))
+			}
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// withoutSignature returns the ARC-Seal header with the value of the b= tag
+// removed, for calculating the hash.
+func withoutSignature(raw []byte) ([]byte, error) {
+	s := string(raw)
+	colon := strings.Index(s, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("missing colon in header")
+	}
+	o := colon + 1
+	for o < len(s) {
+		end := strings.Index(s[o:], ";")
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += o
+		}
+		k, _, ok := strings.Cut(s[o:end], "=")
+		if ok && strings.TrimSpace(k) == "b" {
+			eq := o + strings.Index(s[o:end], "=") + 1
+			r := s[:eq] + s[end:]
+			if end == len(s) {
+				r += "\r\n"
+			}
+			return []byte(r), nil
+		}
+		o = end + 1
+	}
+	return nil, fmt.Errorf("missing b= tag")
+}
+
+// parseSets returns the ARC sets from the headers of a message, ordered by
+// instance. An error is returned if the sets are not complete and numbered from
+// 1, or if an ARC-Seal cannot be parsed.
+func parseSets(hdrs []dkim.RawHeader) ([]Set, error) {
+	m := map[int]*Set{}
+	for _, h := range hdrs {
+		var isAAR bool
+		switch h.LKey {
+		case "arc-authentication-results":
+			isAAR = true
+		case "arc-message-signature", "arc-seal":
+		default:
+			continue
+		}
+		i, err := headerInstance(h.Raw, isAAR)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrStructure, h.LKey, err)
+		}
+		s := m[i]
+		if s == nil {
+			if len(m) >= maxInstances {
+				return nil, ErrTooManyInstances
+			}
+			s = &Set{Instance: i}
+			m[i] = s
+		}
+		var p *[]byte
+		switch h.LKey {
+		case "arc-authentication-results":
+			p = &s.AAR
+		case "arc-message-signature":
+			p = &s.AMS
+		case "arc-seal":
+			p = &s.AS
+		}
+		if *p != nil {
+			return nil, fmt.Errorf("%w: multiple %s headers for instance %d", ErrStructure, h.LKey, i)
+		}
+		*p = h.Raw
+	}
+
+	sets := make([]Set, len(m))
+	for i := range sets {
+		s := m[i+1]
+		if s == nil {
+			return nil, fmt.Errorf("%w: missing arc set for instance %d", ErrStructure, i+1)
+		}
+		if s.AAR == nil || s.AMS == nil || s.AS == nil {
+			return nil, fmt.Errorf("%w: incomplete arc set for instance %d", ErrStructure, i+1)
+		}
+		seal, err := ParseSeal(s.AS)
+		if err != nil {
+			return nil, err
+		}
+		s.Seal = seal
+		sets[i] = *s
+	}
+	return sets, nil
+}
+
+// headerInstance returns the instance (i=) of an ARC header. For
+// ARC-Authentication-Results, the instance is the first field.
+func headerInstance(raw []byte, isAAR bool) (int, error) {
+	_, v, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, fmt.Errorf("missing colon in header")
+	}
+	var tags map[string]string
+	if isAAR {
+		first, _, _ := strings.Cut(v, ";")
+		k, v, _ := strings.Cut(first, "=")
+		tags = map[string]string{strings.TrimSpace(k): strings.TrimSpace(v)}
+	} else {
+		var err error
+		tags, err = tagList(v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	s, ok := tags["i"]
+	if !ok {
+		return 0, fmt.Errorf("missing instance")
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 || i > maxInstances {
+		return 0, fmt.Errorf("invalid instance %q", s)
+	}
+	return i, nil
+}
+
+// tagList parses a DKIM-style tag=value list, with folding whitespace removed
+// from around names and values.
+func tagList(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	s = strings.ReplaceAll(s, "\r\n", "")
+	for _, t := range strings.Split(s, ";") {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing = in tag %q", t)
+		}
+		k = strings.TrimSpace(k)
+		if _, ok := tags[k]; ok {
+			return nil, fmt.Errorf("duplicate tag %q", k)
+		}
+		tags[k] = strings.TrimSpace(v)
+	}
+	return tags, nil
+}
+
+// ParseSeal parses an ARC-Seal header.
+func ParseSeal(raw []byte) (*Seal, error) {
+	xerrorf := func(format string, args ...any) (*Seal, error) {
+		return nil, fmt.Errorf("%w: %s", ErrSealSyntax, fmt.Sprintf(format, args...))
+	}
+
+	k, v, ok := strings.Cut(string(raw), ":")
+	if !ok || !strings.EqualFold(strings.TrimSpace(k), "ARC-Seal") {
+		return xerrorf("not an arc-seal header")
+	}
+	tags, err := tagList(v)
+	if err != nil {
+		return xerrorf("%v", err)
+	}
+	for _, req := range []string{"i", "a", "b", "cv", "d", "s"} {
+		if _, ok := tags[req]; !ok {
+			return xerrorf("missing required tag %q", req)
+		}
+	}
+	// An ARC-Seal does not sign message headers. ../rfc/8617
+	if _, ok := tags["h"]; ok {
+		return xerrorf("h= tag not allowed")
+	}
+
+	seal := &Seal{Timestamp: -1}
+	seal.Instance, err = strconv.Atoi(tags["i"])
+	if err != nil || seal.Instance < 1 || seal.Instance > maxInstances {
+		return xerrorf("invalid instance %q", tags["i"])
+	}
+	alg := strings.ToLower(tags["a"])
+	switch alg {
+	case "rsa-sha256", "ed25519-sha256":
+		seal.AlgorithmSign, seal.AlgorithmHash, _ = strings.Cut(alg, "-")
+	default:
+		return xerrorf("unsupported algorithm %q", tags["a"])
+	}
+	b := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, tags["b"])
+	seal.Signature, err = base64.StdEncoding.DecodeString(b)
+	if err != nil {
+		return xerrorf("parsing signature: %v", err)
+	}
+	cv := Status(strings.ToLower(tags["cv"]))
+	switch cv {
+	case StatusNone, StatusPass, StatusFail:
+		seal.ChainValidation = cv
+	default:
+		return xerrorf("unknown chain validation status %q", tags["cv"])
+	}
+	seal.Domain, err = dns.ParseDomain(tags["d"])
+	if err != nil {
+		return xerrorf("parsing domain: %v", err)
+	}
+	seal.Selector, err = dns.ParseDomain(tags["s"])
+	if err != nil {
+		return xerrorf("parsing selector: %v", err)
+	}
+	if t, ok := tags["t"]; ok {
+		seal.Timestamp, err = strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			return xerrorf("parsing timestamp: %v", err)
+		}
+	}
+	return seal, nil
+}
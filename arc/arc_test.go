@@ -0,0 +1,159 @@
+package arc
+
+import (
+	"context"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var pkglog = mlog.New("arc", nil)
+
+func TestARC(t *testing.T) {
+	ctx := context.Background()
+
+	msg := strings.ReplaceAll(`From: <mjl@beacon.example>
+To: <list@list.example>
+Subject: test
+Message-Id: <test@beacon.example>
+Date: Fri, 10 Dec 2021 20:09:08 +0100
+
+test
+`, "\n", "\r\n")
+
+	ed25519Key := ed25519.NewKeyFromSeed(make([]byte, 32))
+	rsaKey, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key: %v", err)
+	}
+
+	makeRecord := func(k string, publicKey any) string {
+		t.Helper()
+		r := &dkim.Record{Version: "DKIM1", Key: k, PublicKey: publicKey}
+		txt, err := r.Record()
+		if err != nil {
+			t.Fatalf("making dns txt record: %v", err)
+		}
+		return txt
+	}
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"sel1._domainkey.forward.example.": {makeRecord("ed25519", ed25519Key.Public())},
+			"sel2._domainkey.list.example.":    {makeRecord("rsa", rsaKey.Public())},
+		},
+	}
+
+	headers := strings.Split("From,To,Subject,Message-Id,Date", ",")
+	sel1 := dkim.Selector{Hash: "sha256", HeaderRelaxed: true, BodyRelaxed: true, Headers: headers, SealHeaders: true, PrivateKey: ed25519Key, Domain: dns.Domain{ASCII: "sel1"}}
+	sel2 := dkim.Selector{Hash: "sha256", HeaderRelaxed: true, BodyRelaxed: true, Headers: headers, PrivateKey: rsaKey, Domain: dns.Domain{ASCII: "sel2"}}
+	forwardDom := dns.Domain{ASCII: "forward.example"}
+	listDom := dns.Domain{ASCII: "list.example"}
+
+	authRes := func(method, result string) message.AuthResults {
+		return message.AuthResults{
+			Hostname: "mx.example",
+			Methods:  []message.AuthMethod{{Method: method, Result: result}},
+		}
+	}
+
+	verify := func(msg string, expStatus Status, expErr error, expOldestPass int) Result {
+		t.Helper()
+		r := Verify(ctx, pkglog.Logger, resolver, false, strings.NewReader(msg))
+		if r.Status != expStatus || (expErr == nil) != (r.Err == nil) || expErr != nil && !errors.Is(r.Err, expErr) || r.OldestPass != expOldestPass {
+			t.Fatalf("verify: got status %s, err %v, oldest pass %d, expected %s, %v, %d", r.Status, r.Err, r.OldestPass, expStatus, expErr, expOldestPass)
+		}
+		return r
+	}
+
+	sign := func(msg string, dom dns.Domain, sel dkim.Selector, cv Status) string {
+		t.Helper()
+		h, err := Sign(ctx, pkglog.Logger, dom, sel, false, strings.NewReader(msg), cv, authRes("dkim", "pass"))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return h + msg
+	}
+
+	// No ARC headers.
+	verify(msg, StatusNone, nil, 0)
+
+	// Single set.
+	msg1 := sign(msg, forwardDom, sel1, StatusNone)
+	r := verify(msg1, StatusPass, nil, 0)
+	if r.Sealer() != forwardDom || len(r.Sets) != 1 || r.Sets[0].Seal.ChainValidation != StatusNone || r.Sets[0].Seal.AlgorithmSign != "ed25519" {
+		t.Fatalf("unexpected result %#v", r)
+	}
+	if !strings.Contains(msg1, "ARC-Authentication-Results: i=1; mx.example;\r\n\tdkim=pass\r\n") {
+		t.Fatalf("missing arc-authentication-results in message:\n%s", msg1)
+	}
+
+	// Second set, after the body was modified by the second intermediary, e.g. a
+	// mailing list adding a footer. The first message signature no longer verifies.
+	msg2 := sign(msg1+"footer\r\n", listDom, sel2, StatusPass)
+	r = verify(msg2, StatusPass, nil, 2)
+	if r.Sealer() != listDom || len(r.Sets) != 2 {
+		t.Fatalf("unexpected result %#v", r)
+	}
+
+	ar, err := r.Sets[1].AuthResults()
+	if err != nil || ar.Hostname != "mx.example" || len(ar.Methods) != 1 || ar.Methods[0].Method != "dkim" || ar.Methods[0].Result != "pass" {
+		t.Fatalf("parsing arc-authentication-results: got %#v, err %v", ar, err)
+	}
+
+	// Modified body, the most recent message signature fails.
+	verify(msg1+"footer\r\n", StatusFail, ErrMessageSignature, 0)
+
+	// Modified seal.
+	verify(strings.Replace(msg2, "cv=none", "cv=pass", 1), StatusFail, ErrStructure, 0)
+	verify(strings.Replace(msg2, "cv=pass", "cv=none", 1), StatusFail, ErrStructure, 0)
+	verify(strings.Replace(msg2, "t=", "t=1", 1), StatusFail, ErrSeal, 0)
+
+	// Modified arc-authentication-results, covered by the seal.
+	verify(strings.Replace(msg2, "dkim=pass", "dkim=fail", 1), StatusFail, ErrSeal, 0)
+
+	// Missing header of a set.
+	verify(strings.Replace(msg2, "ARC-Authentication-Results: i=1;", "X-Removed: i=1;", 1), StatusFail, ErrStructure, 0)
+
+	// Chain marked as failed by sealer cannot be extended and does not verify.
+	msg3 := sign(msg1+"footer\r\n", listDom, sel2, StatusFail)
+	verify(msg3, StatusFail, ErrChainFailed, 0)
+	_, err = Sign(ctx, pkglog.Logger, forwardDom, sel1, false, strings.NewReader(msg3), StatusPass, authRes("arc", "fail"))
+	if !errors.Is(err, ErrChainFailed) {
+		t.Fatalf("sign on failed chain: got err %v, expected ErrChainFailed", err)
+	}
+
+	// Unknown key.
+	verify(sign(msg, dns.Domain{ASCII: "unknown.example"}, sel1, StatusNone), StatusFail, ErrMessageSignature, 0)
+}
+
+func TestParseSeal(t *testing.T) {
+	test := func(s string, expErr bool) {
+		t.Helper()
+		_, err := ParseSeal([]byte(strings.ReplaceAll(s, "\n", "\r\n")))
+		if (err != nil) != expErr {
+			t.Fatalf("parse seal %q: got err %v, expected error %v", s, err, expErr)
+		}
+		if err != nil && !errors.Is(err, ErrSealSyntax) {
+			t.Fatalf("parse seal %q: got err %v, expected ErrSealSyntax", s, err)
+		}
+	}
+
+	test("ARC-Seal: i=1; a=rsa-sha256; t=1700000000; cv=none; d=example.org; s=sel;\n b=dGVzdA==\n", false)
+	test("ARC-Seal: i=2; a=ed25519-sha256; cv=pass; d=example.org; s=sel; b=dGVz\n dA==\n", false)
+	test("ARC-Seal: i=0; a=rsa-sha256; cv=none; d=example.org; s=sel; b=dGVzdA==\n", true)
+	test("ARC-Seal: i=51; a=rsa-sha256; cv=none; d=example.org; s=sel; b=dGVzdA==\n", true)
+	test("ARC-Seal: i=1; a=rsa-sha1; cv=none; d=example.org; s=sel; b=dGVzdA==\n", true)
+	test("ARC-Seal: i=1; a=rsa-sha256; cv=bogus; d=example.org; s=sel; b=dGVzdA==\n", true)
+	test("ARC-Seal: i=1; a=rsa-sha256; d=example.org; s=sel; b=dGVzdA==\n", true)
+	test("ARC-Seal: i=1; a=rsa-sha256; cv=none; d=example.org; s=sel; h=from; b=dGVzdA==\n", true)
+	test("ARC-Seal: i=1; i=1; a=rsa-sha256; cv=none; d=example.org; s=sel; b=dGVzdA==\n", true)
+	test("DKIM-Signature: i=1; a=rsa-sha256; cv=none; d=example.org; s=sel; b=dGVzdA==\n", true)
+}
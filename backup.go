@@ -16,10 +16,15 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dmarcdb"
+	"github.com/qompassai/beacon/dnsblserver"
+	"github.com/qompassai/beacon/greylist"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/beacon-"
 	"github.com/qompassai/beacon/beaconvar"
 	"github.com/qompassai/beacon/mtastsdb"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/queue"
 	"github.com/qompassai/beacon/store"
 	"github.com/qompassai/beacon/tlsrptdb"
@@ -288,6 +293,10 @@ func backupctl(ctx context.Context, ctl *ctl) {
 	backupDB(mtastsdb.DB, "mtasts.db")
 	backupDB(tlsrptdb.ReportDB, "tlsrpt.db")
 	backupDB(tlsrptdb.ResultDB, "tlsrptresult.db")
+	backupDB(loginattempt.DB, "loginattempt.db")
+	backupDB(greylist.DB, "greylist.db")
+	backupDB(dkimrotate.DB, "dkimrotate.db")
+	backupDB(dnsblserver.DB, "dnsblserver.db")
 	backupFile("receivedid.key")
 
 	// Acme directory is optional.
@@ -383,6 +392,53 @@ func backupctl(ctx context.Context, ctl *ctl) {
 	}
 	backupQueue(filepath.FromSlash("queue/index.db"))
 
+	// Copy the quarantine database and its message files. Messages may be added or
+	// removed while we are copying, so we only link/copy messages in the copied
+	// database.
+	backupQuarantine := func(path string) {
+		tmQuarantine := time.Now()
+
+		if err := backupDB(quarantine.DB, path); err != nil {
+			xerrx("quarantine not backed up", err, slog.String("path", path), slog.Duration("duration", time.Since(tmQuarantine)))
+			return
+		}
+
+		dstdbpath := filepath.Join(dstDataDir, path)
+		db, err := bstore.Open(ctx, dstdbpath, &bstore.Options{MustExist: true}, quarantine.DBTypes...)
+		if err != nil {
+			xerrx("open copied quarantine database", err, slog.String("dstpath", dstdbpath), slog.Duration("duration", time.Since(tmQuarantine)))
+			return
+		}
+		defer func() {
+			err := db.Close()
+			ctl.log.Check(err, "closing new quarantine db")
+		}()
+
+		var nlinked, ncopied int
+		err = bstore.QueryDB[quarantine.Message](ctx, db).ForEach(func(m quarantine.Message) error {
+			mp := store.MessagePath(m.ID)
+			srcpath := filepath.Join(srcDataDir, "quarantine", mp)
+			dstpath := filepath.Join(dstDataDir, "quarantine", mp)
+			if linked, err := linkOrCopy(srcpath, dstpath); err != nil {
+				xerrx("linking/copying quarantine message", err, slog.String("srcpath", srcpath), slog.String("dstpath", dstpath))
+			} else if linked {
+				nlinked++
+			} else {
+				ncopied++
+			}
+			return nil
+		})
+		if err != nil {
+			xerrx("processing quarantine messages (not backed up properly)", err, slog.Duration("duration", time.Since(tmQuarantine)))
+			return
+		}
+		xvlog("quarantine backup finished",
+			slog.Int("linked", nlinked),
+			slog.Int("copied", ncopied),
+			slog.Duration("duration", time.Since(tmQuarantine)))
+	}
+	backupQuarantine(filepath.FromSlash("quarantine/index.db"))
+
 	backupAccount := func(acc *store.Account) {
 		defer acc.Close()
 
@@ -524,7 +580,7 @@ func backupctl(ctx context.Context, ctl *ctl) {
 			return nil
 		}
 		p := srcpath[len(srcDataDir)+1:]
-		if p == "queue" || p == "acme" || p == "tmp" {
+		if p == "queue" || p == "quarantine" || p == "acme" || p == "tmp" {
 			return fs.SkipDir
 		}
 		l := strings.Split(p, string(filepath.Separator))
@@ -541,7 +597,7 @@ func backupctl(ctx context.Context, ctl *ctl) {
 		}
 
 		switch p {
-		case "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "receivedid.key", "ctl":
+		case "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "loginattempt.db", "greylist.db", "dkimrotate.db", "dnsblserver.db", "receivedid.key", "ctl":
 			// Already handled.
 			return nil
 		case "lastknownversion": // Optional file, not yet handled.
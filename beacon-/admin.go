@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
 
 	"github.com/mjl-/adns"
@@ -29,6 +30,7 @@ import (
 	"github.com/qompassai/beacon/dmarc"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/junk"
+	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/mtasts"
 	"github.com/qompassai/beacon/smtp"
 	"github.com/qompassai/beacon/tlsrpt"
@@ -151,6 +153,33 @@ func MakeAccountConfig(addr smtp.Address) config.Account {
 	return account
 }
 
+// writeFile writes a new file at path, which must not yet exist, creating the
+// parent directory if needed.
+func writeFile(log mlog.Log, path string, data []byte) error {
+	os.MkdirAll(filepath.Dir(path), 0770)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return fmt.Errorf("creating file %s: %s", path, err)
+	}
+	defer func() {
+		if f != nil {
+			err := f.Close()
+			log.Check(err, "closing file after error")
+			err = os.Remove(path)
+			log.Check(err, "removing file after error", slog.String("path", path))
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("writing file %s: %s", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close file: %v", err)
+	}
+	f = nil
+	return nil
+}
+
 // MakeDomainConfig makes a new config for a domain, creating DKIM keys, using
 // accountName for DMARC and TLS reports.
 func MakeDomainConfig(ctx context.Context, domain, hostname dns.Domain, accountName string, withMTASTS bool) (config.Domain, []string, error) {
@@ -168,31 +197,6 @@ func MakeDomainConfig(ctx context.Context, domain, hostname dns.Domain, accountN
 		}
 	}()
 
-	writeFile := func(path string, data []byte) error {
-		os.MkdirAll(filepath.Dir(path), 0770)
-
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
-		if err != nil {
-			return fmt.Errorf("creating file %s: %s", path, err)
-		}
-		defer func() {
-			if f != nil {
-				err := f.Close()
-				log.Check(err, "closing file after error")
-				err = os.Remove(path)
-				log.Check(err, "removing file after error", slog.String("path", path))
-			}
-		}()
-		if _, err := f.Write(data); err != nil {
-			return fmt.Errorf("writing file %s: %s", path, err)
-		}
-		if err := f.Close(); err != nil {
-			return fmt.Errorf("close file: %v", err)
-		}
-		f = nil
-		return nil
-	}
-
 	confDKIM := config.DKIM{
 		Selectors: map[string]config.Selector{},
 	}
@@ -201,7 +205,7 @@ func MakeDomainConfig(ctx context.Context, domain, hostname dns.Domain, accountN
 		record := fmt.Sprintf("%s._domainkey.%s", name, domain.ASCII)
 		keyPath := filepath.Join("dkim", fmt.Sprintf("%s.%s.%s.privatekey.pkcs8.pem", record, timestamp, kind))
 		p := configDirPath(ConfigDynamicPath, keyPath)
-		if err := writeFile(p, privKey); err != nil {
+		if err := writeFile(log, p, privKey); err != nil {
 			return err
 		}
 		paths = append(paths, p)
@@ -400,15 +404,22 @@ func DomainRemove(ctx context.Context, domain dns.Domain) (rerr error) {
 		return fmt.Errorf("writing domains.conf: %v", err)
 	}
 
-	// Move away any DKIM private keys to a subdirectory "old". But only if
-	// they are not in use by other domains.
+	moveOldDKIMKeys(log, nc, maps.Values(domConf.DKIM.Selectors))
+
+	log.Info("domain removed", slog.Any("domain", domain))
+	return nil
+}
+
+// moveOldDKIMKeys moves away the DKIM private keys of sels to a subdirectory
+// "old". But only if they are not in use by domains in config c.
+func moveOldDKIMKeys(log mlog.Log, c config.Dynamic, sels []config.Selector) {
 	usedKeyPaths := map[string]bool{}
-	for _, dc := range nc.Domains {
+	for _, dc := range c.Domains {
 		for _, sel := range dc.DKIM.Selectors {
 			usedKeyPaths[filepath.Clean(sel.PrivateKeyFile)] = true
 		}
 	}
-	for _, sel := range domConf.DKIM.Selectors {
+	for _, sel := range sels {
 		if sel.PrivateKeyFile == "" || usedKeyPaths[filepath.Clean(sel.PrivateKeyFile)] {
 			continue
 		}
@@ -422,11 +433,238 @@ func DomainRemove(ctx context.Context, domain dns.Domain) (rerr error) {
 			err = os.Rename(src, dst)
 		}
 		if err != nil {
-			log.Errorx("renaming dkim private key file for removed domain", err, slog.String("src", src), slog.String("dst", dst))
+			log.Errorx("renaming old dkim private key file", err, slog.String("src", src), slog.String("dst", dst))
 		}
 	}
+}
 
-	log.Info("domain removed", slog.Any("domain", domain))
+// DKIMRecord returns the value for the DNS TXT record of a DKIM selector.
+func DKIMRecord(sel config.Selector) (string, error) {
+	dkimr := dkim.Record{
+		Version:   "DKIM1",
+		Hashes:    []string{"sha256"},
+		PublicKey: sel.Key.Public(),
+	}
+	if _, ok := sel.Key.(ed25519.PrivateKey); ok {
+		dkimr.Key = "ed25519"
+	} else if _, ok := sel.Key.(*rsa.PrivateKey); !ok {
+		return "", fmt.Errorf("unrecognized private key: %T", sel.Key)
+	}
+	return dkimr.Record()
+}
+
+// DKIMSelectorsGenerate generates new DKIM keys for domain, one for each of the
+// selectors in like, with the same key type and signing parameters. The new
+// selectors are added to the configuration, but not used for signing. The names of
+// the new selectors are returned, in the order of like.
+func DKIMSelectorsGenerate(ctx context.Context, domain dns.Domain, like []string) (names []string, rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("generating dkim selectors", rerr, slog.Any("domain", domain))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	domConf, ok := c.Domains[domain.Name()]
+	if !ok {
+		return nil, fmt.Errorf("domain does not exist")
+	}
+
+	var paths []string
+	defer func() {
+		for _, p := range paths {
+			err := os.Remove(p)
+			log.Check(err, "removing dkim private key file after error", slog.String("path", p))
+		}
+	}()
+
+	// New selectors are named after the current day, with a letter to make them unique.
+	now := time.Now()
+	timestamp := now.Format("20060102T150405")
+	prefix := now.Format("20060102")
+	letter := 'a'
+	nextName := func() (string, error) {
+		for letter <= 'z' {
+			name := prefix + string(letter)
+			letter++
+			if _, ok := domConf.DKIM.Selectors[name]; !ok {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("no selector names left for today")
+	}
+
+	selectors := map[string]config.Selector{}
+	for name, sel := range domConf.DKIM.Selectors {
+		selectors[name] = sel
+	}
+	for _, old := range like {
+		osel, ok := domConf.DKIM.Selectors[old]
+		if !ok {
+			return nil, fmt.Errorf("selector %q does not exist", old)
+		}
+		name, err := nextName()
+		if err != nil {
+			return nil, err
+		}
+		var kind string
+		var privKey []byte
+		switch osel.Key.(type) {
+		case ed25519.PrivateKey:
+			kind = "ed25519"
+			privKey, err = MakeDKIMEd25519Key(dns.Domain{ASCII: name}, domain)
+		case *rsa.PrivateKey:
+			kind = "rsa2048"
+			privKey, err = MakeDKIMRSAKey(dns.Domain{ASCII: name}, domain)
+		default:
+			return nil, fmt.Errorf("unrecognized private key for selector %q: %T", old, osel.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("making dkim %s private key: %v", kind, err)
+		}
+
+		record := fmt.Sprintf("%s._domainkey.%s", name, domain.ASCII)
+		keyPath := filepath.Join("dkim", fmt.Sprintf("%s.%s.%s.privatekey.pkcs8.pem", record, timestamp, kind))
+		p := configDirPath(ConfigDynamicPath, keyPath)
+		if err := writeFile(log, p, privKey); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+
+		selectors[name] = config.Selector{
+			Hash:             osel.Hash,
+			Canonicalization: osel.Canonicalization,
+			Headers:          osel.Headers,
+			DontSealHeaders:  osel.DontSealHeaders,
+			Expiration:       osel.Expiration,
+			PrivateKeyFile:   keyPath,
+		}
+		names = append(names, name)
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace.
+	nc := c
+	nc.Domains = map[string]config.Domain{}
+	for name, d := range c.Domains {
+		nc.Domains[name] = d
+	}
+	domConf.DKIM.Selectors = selectors
+	nc.Domains[domain.Name()] = domConf
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return nil, fmt.Errorf("writing domains.conf: %v", err)
+	}
+	paths = nil
+
+	log.Info("dkim selectors generated", slog.Any("domain", domain), slog.Any("selectors", names))
+	return names, nil
+}
+
+// DKIMSignReplace changes the selectors used for DKIM signing and ARC sealing
+// for domain, replacing the keys in replace with their values.
+func DKIMSignReplace(ctx context.Context, domain dns.Domain, replace map[string]string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("replacing dkim signing selectors", rerr, slog.Any("domain", domain))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	domConf, ok := c.Domains[domain.Name()]
+	if !ok {
+		return fmt.Errorf("domain does not exist")
+	}
+
+	xreplace := func(name string) string {
+		if n, ok := replace[name]; ok {
+			return n
+		}
+		return name
+	}
+	var sign []string
+	for _, name := range domConf.DKIM.Sign {
+		sign = append(sign, xreplace(name))
+	}
+	domConf.DKIM.Sign = sign
+	if domConf.DKIM.ARCSeal != "" {
+		domConf.DKIM.ARCSeal = xreplace(domConf.DKIM.ARCSeal)
+	}
+
+	nc := c
+	nc.Domains = map[string]config.Domain{}
+	for name, d := range c.Domains {
+		nc.Domains[name] = d
+	}
+	nc.Domains[domain.Name()] = domConf
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %v", err)
+	}
+	log.Info("dkim signing selectors replaced", slog.Any("domain", domain), slog.Any("sign", sign), slog.String("arcseal", domConf.DKIM.ARCSeal))
+	return nil
+}
+
+// DKIMSelectorsRemove removes selectors from the configuration of domain. The
+// selectors must not be in use for signing. Their private key files are moved to
+// a subdirectory "old".
+func DKIMSelectorsRemove(ctx context.Context, domain dns.Domain, names []string) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("removing dkim selectors", rerr, slog.Any("domain", domain))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	domConf, ok := c.Domains[domain.Name()]
+	if !ok {
+		return fmt.Errorf("domain does not exist")
+	}
+
+	selectors := map[string]config.Selector{}
+	for name, sel := range domConf.DKIM.Selectors {
+		selectors[name] = sel
+	}
+	var removed []config.Selector
+	for _, name := range names {
+		sel, ok := selectors[name]
+		if !ok {
+			return fmt.Errorf("selector %q does not exist", name)
+		}
+		if slices.Contains(domConf.DKIM.Sign, name) || domConf.DKIM.ARCSeal == name {
+			return fmt.Errorf("selector %q is in use for signing", name)
+		}
+		delete(selectors, name)
+		removed = append(removed, sel)
+	}
+	domConf.DKIM.Selectors = selectors
+
+	nc := c
+	nc.Domains = map[string]config.Domain{}
+	for name, d := range c.Domains {
+		nc.Domains[name] = d
+	}
+	nc.Domains[domain.Name()] = domConf
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %v", err)
+	}
+
+	moveOldDKIMKeys(log, nc, removed)
+
+	log.Info("dkim selectors removed", slog.Any("domain", domain), slog.Any("selectors", names))
 	return nil
 }
 
@@ -571,20 +809,9 @@ func DomainRecords(domConf config.Domain, domain dns.Domain, hasDNSSEC bool, cer
 		return selectors[i] < selectors[j]
 	})
 	for _, name := range selectors {
-		sel := domConf.DKIM.Selectors[name]
-		dkimr := dkim.Record{
-			Version:   "DKIM1",
-			Hashes:    []string{"sha256"},
-			PublicKey: sel.Key.Public(),
-		}
-		if _, ok := sel.Key.(ed25519.PrivateKey); ok {
-			dkimr.Key = "ed25519"
-		} else if _, ok := sel.Key.(*rsa.PrivateKey); !ok {
-			return nil, fmt.Errorf("unrecognized private key for DKIM selector %q: %T", name, sel.Key)
-		}
-		txt, err := dkimr.Record()
+		txt, err := DKIMRecord(domConf.DKIM.Selectors[name])
 		if err != nil {
-			return nil, fmt.Errorf("making DKIM DNS TXT record: %v", err)
+			return nil, fmt.Errorf("making DKIM DNS TXT record for selector %q: %v", name, err)
 		}
 
 		if len(txt) > 100 {
@@ -1069,6 +1296,114 @@ func AccountLimitsSave(ctx context.Context, account string, maxOutgoingMessagesP
 	return nil
 }
 
+// AccountRequireTOTPSave saves whether two-factor authentication is required for
+// web logins for the account.
+func AccountRequireTOTPSave(ctx context.Context, account string, require bool) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("saving account two-factor authentication requirement", rerr, slog.String("account", account))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	acc, ok := c.Accounts[account]
+	if !ok {
+		return fmt.Errorf("account not present")
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace.
+	nc := c
+	nc.Accounts = map[string]config.Account{}
+	for name, a := range c.Accounts {
+		nc.Accounts[name] = a
+	}
+	acc.RequireTOTP = require
+	nc.Accounts[account] = acc
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %v", err)
+	}
+	log.Info("account two-factor authentication requirement saved", slog.String("account", account), slog.Bool("require", require))
+	return nil
+}
+
+// AccountTLSPublicKeysSave saves the TLS public keys for authenticating with
+// client certificates for the account.
+func AccountTLSPublicKeysSave(ctx context.Context, account string, keys []config.TLSPublicKey) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("saving account tls public keys", rerr, slog.String("account", account))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	acc, ok := c.Accounts[account]
+	if !ok {
+		return fmt.Errorf("account not present")
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace.
+	nc := c
+	nc.Accounts = map[string]config.Account{}
+	for name, a := range c.Accounts {
+		nc.Accounts[name] = a
+	}
+	acc.TLSPublicKeys = keys
+	nc.Accounts[account] = acc
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %v", err)
+	}
+	log.Info("account tls public keys saved", slog.String("account", account), slog.Int("count", len(keys)))
+	return nil
+}
+
+// AccountJunkFilterSave updates the junk filter configuration of an account and
+// reloads the configuration.
+func AccountJunkFilterSave(ctx context.Context, account string, jf *config.JunkFilter) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("saving account junk filter", rerr, slog.String("account", account))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	acc, ok := c.Accounts[account]
+	if !ok {
+		return fmt.Errorf("account not present")
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace.
+	nc := c
+	nc.Accounts = map[string]config.Account{}
+	for name, a := range c.Accounts {
+		nc.Accounts[name] = a
+	}
+	acc.JunkFilter = jf
+	nc.Accounts[account] = acc
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %v", err)
+	}
+	log.Info("account junk filter saved", slog.String("account", account))
+	return nil
+}
+
 type TLSMode uint8
 
 const (
@@ -1156,6 +1491,61 @@ func ClientConfigDomain(d dns.Domain) (rconfig ClientConfig, rerr error) {
 	return ClientConfig{}, fmt.Errorf("no listeners found for imap and/or submission")
 }
 
+// CardDAVConfig is the location of the CardDAV server for an account.
+type CardDAVConfig struct {
+	Host dns.Domain
+	Port int
+	TLS  bool
+	Path string // Absolute path of the CardDAV root, ending with a slash.
+}
+
+// CardDAVConfigDomain returns the CardDAV configuration for accounts of a domain.
+// CardDAV is served on the account web interface listeners, HTTPS is preferred.
+func CardDAVConfigDomain(d dns.Domain) (CardDAVConfig, error) {
+	domConf, ok := Conf.Domain(d)
+	if !ok {
+		return CardDAVConfig{}, fmt.Errorf("unknown domain")
+	}
+
+	find := func(l config.Listener) (CardDAVConfig, bool) {
+		host := Conf.Static.HostnameDomain
+		if l.Hostname != "" {
+			host = l.HostnameDomain
+		}
+		if domConf.ClientSettingsDomain != "" {
+			host = domConf.ClientSettingsDNSDomain
+		}
+		path := func(p string) string {
+			if p == "" {
+				p = "/"
+			}
+			return p + "dav/"
+		}
+		if l.AccountHTTPS.Enabled {
+			return CardDAVConfig{host, config.Port(l.AccountHTTPS.Port, 443), true, path(l.AccountHTTPS.Path)}, true
+		}
+		if l.AccountHTTP.Enabled {
+			return CardDAVConfig{host, config.Port(l.AccountHTTP.Port, 80), false, path(l.AccountHTTP.Path)}, true
+		}
+		return CardDAVConfig{}, false
+	}
+
+	// Same order as for ClientConfigDomain, public listener first.
+	if public, ok := Conf.Static.Listeners["public"]; ok {
+		if c, ok := find(public); ok {
+			return c, nil
+		}
+	}
+	names := maps.Keys(Conf.Static.Listeners)
+	sort.Strings(names)
+	for _, name := range names {
+		if c, ok := find(Conf.Static.Listeners[name]); ok {
+			return c, nil
+		}
+	}
+	return CardDAVConfig{}, fmt.Errorf("no listeners found with account web interface for carddav")
+}
+
 // ClientConfigs holds the client configuration for IMAP/Submission for a
 // domain.
 type ClientConfigs struct {
@@ -1302,3 +1692,44 @@ func IPs(ctx context.Context, receiveOnly bool) ([]net.IP, error) {
 
 	return ips, nil
 }
+
+// AccountLoginLockoutSave saves the threshold of consecutive failed
+// authentication attempts after which authentication for the account is blocked,
+// and for how long. A zero maxFailures removes the lockout configuration.
+func AccountLoginLockoutSave(ctx context.Context, account string, maxFailures int, period time.Duration) (rerr error) {
+	log := pkglog.WithContext(ctx)
+	defer func() {
+		if rerr != nil {
+			log.Errorx("saving account login lockout", rerr, slog.String("account", account))
+		}
+	}()
+
+	Conf.dynamicMutex.Lock()
+	defer Conf.dynamicMutex.Unlock()
+
+	c := Conf.Dynamic
+	acc, ok := c.Accounts[account]
+	if !ok {
+		return fmt.Errorf("account not present")
+	}
+
+	// Compose new config without modifying existing data structures. If we fail, we
+	// leave no trace.
+	nc := c
+	nc.Accounts = map[string]config.Account{}
+	for name, a := range c.Accounts {
+		nc.Accounts[name] = a
+	}
+	if maxFailures == 0 {
+		acc.LoginLockout = nil
+	} else {
+		acc.LoginLockout = &config.LoginLockout{MaxFailures: maxFailures, Period: period}
+	}
+	nc.Accounts[account] = acc
+
+	if err := writeDynamic(ctx, log, nc); err != nil {
+		return fmt.Errorf("writing domains.conf: %v", err)
+	}
+	log.Info("account login lockout saved", slog.String("account", account), slog.Int("maxfailures", maxFailures), slog.Duration("period", period))
+	return nil
+}
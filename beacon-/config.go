@@ -9,9 +9,11 @@ import (
 	"crypto/elliptic"
 	cryptorand "crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -38,8 +40,10 @@ import (
 
 	"github.com/qompassai/beacon/autotls"
 	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/contentscan"
 	"github.com/qompassai/beacon/dkim"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/dnssec"
 	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beaconio"
@@ -221,6 +225,22 @@ func (c *Config) AccountDestination(addr string) (accDests AccountDestination, o
 	return
 }
 
+// TLSPublicKey returns the account and key registered for a TLS public key
+// fingerprint, for authenticating with a TLS client certificate.
+func (c *Config) TLSPublicKey(fingerprint string) (accountName string, key config.TLSPublicKey, ok bool) {
+	c.withDynamicLock(func() {
+		for name, acc := range c.Dynamic.Accounts {
+			for _, k := range acc.TLSPublicKeys {
+				if k.Fingerprint == fingerprint {
+					accountName, key, ok = name, k, true
+					return
+				}
+			}
+		}
+	})
+	return
+}
+
 func (c *Config) WebServer() (r map[dns.Domain]dns.Domain, l []config.WebHandler) {
 	c.withDynamicLock(func() {
 		r = c.Dynamic.WebDNSDomainRedirects
@@ -407,6 +427,12 @@ func SetConfig(c *Config) {
 	}
 
 	SetPedantic(c.Static.Pedantic)
+
+	// Use upstream resolvers with DNSSEC verification for all lookups, if configured.
+	dns.DefaultResolver = nil
+	if r := c.Static.DNSResolver; r != nil && r.Resolver != nil {
+		dns.DefaultResolver = r.Resolver
+	}
 }
 
 // Set pedantic in all packages.
@@ -536,6 +562,119 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 		c.HostTLSRPT.ParsedLocalpart = tlsrptLocalpart
 	}
 
+	c.ARCTrustedSealerDomains = nil
+	for _, s := range c.ARCTrustedSealers {
+		d, err := dns.ParseDomain(s)
+		if err != nil {
+			addErrorf("parsing trusted arc sealer domain %q: %v", s, err)
+			continue
+		}
+		c.ARCTrustedSealerDomains = append(c.ARCTrustedSealerDomains, d)
+	}
+
+	if c.DMARCFailureReports != nil && c.DMARCFailureReports.MaxPerHour < 0 {
+		addErrorf("dmarc failure reports max per hour must be >= 0")
+	}
+
+	if s := c.DNSBLServer; s != nil {
+		if d, err := dns.ParseDomain(s.Zone); err != nil {
+			addErrorf("invalid dnsbl server zone %q: %v", s.Zone, err)
+		} else {
+			s.ZoneDomain = d
+		}
+		if len(s.IPs) == 0 {
+			addErrorf("dnsbl server must have at least one ip to listen on")
+		}
+		for _, ipstr := range s.IPs {
+			if net.ParseIP(ipstr) == nil {
+				addErrorf("dnsbl server has invalid ip %q", ipstr)
+			}
+		}
+		if s.Port < 0 || s.JunkThreshold < 0 || s.RejectThreshold < 0 || s.MaxHamFraction < 0 || s.HalfLife < 0 || s.RefreshInterval < 0 {
+			addErrorf("dnsbl server port, thresholds, ham fraction, half-life and refresh interval must be >= 0")
+		}
+		s.AllowNets = nil
+		for _, a := range s.Allow {
+			cidr := a
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				addErrorf("dnsbl server has invalid allowed ip or network %q", a)
+				continue
+			}
+			s.AllowNets = append(s.AllowNets, *ipnet)
+		}
+		if len(s.Explanation) > 255 {
+			addErrorf("dnsbl server explanation must be at most 255 bytes")
+		}
+	}
+
+	if q := c.Quarantine; q != nil {
+		for _, r := range q.Reasons {
+			switch r {
+			case "dnsbl", "junk", "contentscan", "hold":
+			default:
+				addErrorf("unknown quarantine reason %q, must be one of dnsbl, junk, contentscan, hold", r)
+			}
+		}
+		if q.Retention < 0 || q.DigestInterval < 0 {
+			addErrorf("quarantine retention and digest interval must be >= 0")
+		}
+		if q.AccountURL != "" {
+			if u, err := url.Parse(q.AccountURL); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+				addErrorf("invalid quarantine account url %q, must be an absolute http or https url", q.AccountURL)
+			}
+		}
+		for i, hr := range q.HoldRules {
+			n := 0
+			if hr.SMTPMailFromRegexp != "" {
+				n++
+				r, err := regexp.Compile(hr.SMTPMailFromRegexp)
+				if err != nil {
+					addErrorf("invalid SMTPMailFrom regular expression in quarantine hold rule %d: %v", i+1, err)
+				}
+				q.HoldRules[i].SMTPMailFromRegexpCompiled = r
+			}
+			if hr.RcptToRegexp != "" {
+				n++
+				r, err := regexp.Compile(hr.RcptToRegexp)
+				if err != nil {
+					addErrorf("invalid RcptTo regular expression in quarantine hold rule %d: %v", i+1, err)
+				}
+				q.HoldRules[i].RcptToRegexpCompiled = r
+			}
+			var hdr [][2]*regexp.Regexp
+			for k, v := range hr.HeadersRegexp {
+				n++
+				if strings.ToLower(k) != k {
+					addErrorf("header field %q must only have lower case characters", k)
+				}
+				if strings.ToLower(v) != v {
+					addErrorf("header value %q must only have lower case characters", v)
+				}
+				rk, err := regexp.Compile(k)
+				if err != nil {
+					addErrorf("invalid quarantine hold rule header regexp %q: %v", k, err)
+				}
+				rv, err := regexp.Compile(v)
+				if err != nil {
+					addErrorf("invalid quarantine hold rule header regexp %q: %v", v, err)
+				}
+				hdr = append(hdr, [...]*regexp.Regexp{rk, rv})
+			}
+			q.HoldRules[i].HeadersRegexpCompiled = hdr
+			if n == 0 {
+				addErrorf("quarantine hold rule %d must have at least one condition", i+1)
+			}
+		}
+	}
+
 	// Return private key for host name for use with an ACME. Used to return the same
 	// private key as pre-generated for use with DANE, with its public key in DNS.
 	// We only use this key for Listener's that have this ACME configured, and for
@@ -753,6 +892,12 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			if l.TLS.ACMEConfig != nil {
 				l.TLS.ACMEConfig.MinVersion = minVersion
 			}
+			if l.TLS.ClientAuth && l.TLS.Config != nil {
+				// Certificates are not verified against CAs, only their public keys are matched
+				// against keys registered with accounts during SASL EXTERNAL.
+				l.TLS.ClientAuthConfig = l.TLS.Config.Clone()
+				l.TLS.ClientAuthConfig.ClientAuth = tls.RequestClientCert
+			}
 		} else {
 			var needsTLS []string
 			needtls := func(s string, v bool) {
@@ -807,6 +952,81 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			}
 			l.SMTP.DNSBLZones = append(l.SMTP.DNSBLZones, d)
 		}
+		checkDomainBLs := func(kind string, bls []config.DomainBL, uribl bool) {
+			for i := range bls {
+				bl := &bls[i]
+				d, err := dns.ParseDomain(bl.Zone)
+				if err != nil {
+					addErrorf("listener %q has invalid %s zone %q", name, kind, bl.Zone)
+					continue
+				}
+				bl.ZoneDomain = d
+				if uribl && len(bl.Identities) > 0 {
+					addErrorf("listener %q %s %q: identities not used for uribls", name, kind, bl.Zone)
+				}
+				for _, id := range bl.Identities {
+					switch id {
+					case "ehlo", "mailfrom", "from", "dkim":
+					default:
+						addErrorf("listener %q %s %q: unknown identity %q, must be one of ehlo, mailfrom, from, dkim", name, kind, bl.Zone, id)
+					}
+				}
+				bl.ReturnNets = nil
+				for _, rc := range bl.ReturnCodes {
+					cidr := rc
+					if !strings.Contains(cidr, "/") {
+						cidr += "/32"
+					}
+					ip, ipnet, err := net.ParseCIDR(cidr)
+					if err != nil || ip.To4() == nil {
+						addErrorf("listener %q %s %q: invalid return code %q, must be ipv4 address or network", name, kind, bl.Zone, rc)
+						continue
+					}
+					bl.ReturnNets = append(bl.ReturnNets, *ipnet)
+				}
+				if bl.Weight < 0 {
+					addErrorf("listener %q %s %q: weight must not be negative", name, kind, bl.Zone)
+				} else if bl.Weight == 0 {
+					bl.Weight = 1
+				}
+			}
+		}
+		checkDomainBLs("domainbl", l.SMTP.DomainBLs, false)
+		checkDomainBLs("uribl", l.SMTP.URIBLs, true)
+		if g := l.SMTP.Greylisting; g != nil {
+			if g.Delay < 0 || g.Expiry < 0 {
+				addErrorf("listener %q has negative greylisting delay or expiry", name)
+			} else if g.Expiry > 0 && g.Delay >= g.Expiry {
+				addErrorf("listener %q has greylisting delay %v not shorter than expiry %v", name, g.Delay, g.Expiry)
+			}
+		}
+		for i, cs := range l.ContentScans {
+			var n int
+			if cs.Milter != "" {
+				n++
+				if _, _, err := contentscan.ParseMilterAddress(cs.Milter); err != nil {
+					addErrorf("listener %q content scan %d: %v", name, i, err)
+				}
+			}
+			if cs.HTTP != "" {
+				n++
+				if u, err := url.Parse(cs.HTTP); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					addErrorf("listener %q content scan %d: invalid http url %q", name, i, cs.HTTP)
+				}
+			}
+			if len(cs.Command) > 0 {
+				n++
+			}
+			if n != 1 {
+				addErrorf("listener %q content scan %d: exactly one of Milter, HTTP and Command must be set", name, i)
+			}
+			if cs.Timeout < 0 {
+				addErrorf("listener %q content scan %d: timeout cannot be negative", name, i)
+			}
+			if cs.NoIncoming && cs.NoSubmission {
+				addErrorf("listener %q content scan %d: both NoIncoming and NoSubmission set, scanner is never used", name, i)
+			}
+		}
 		if l.IPsNATed && len(l.NATIPs) > 0 {
 			addErrorf("listener %q has both IPsNATed and NATIPs (remove deprecated IPsNATed)", name)
 		}
@@ -967,6 +1187,26 @@ func PrepareStaticConfig(ctx context.Context, log mlog.Log, configFile string, c
 			}
 		}
 	}
+
+	if r := c.DNSResolver; r != nil {
+		var anchors []dnssec.DS
+		for _, s := range r.TrustAnchors {
+			ds, err := dnssec.ParseDS(s)
+			if err != nil {
+				addErrorf("invalid dns resolver trust anchor %q: %v", s, err)
+				continue
+			}
+			anchors = append(anchors, ds)
+		}
+		if r.CacheSize < 0 {
+			addErrorf("dns resolver cache size must be >= 0")
+		}
+		resolver, err := dnssec.New(r.Upstreams, anchors, dnssec.Opts{CacheSize: r.CacheSize, RootCAs: c.TLS.CertPool, Log: log.Logger})
+		if err != nil {
+			addErrorf("dns resolver: %v", err)
+		}
+		r.Resolver = resolver
+	}
 	return
 }
 
@@ -1103,6 +1343,11 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 				addErrorf("selector %s for signing is missing in domain %s", sign, d)
 			}
 		}
+		if domain.DKIM.ARCSeal != "" {
+			if _, ok := domain.DKIM.Selectors[domain.DKIM.ARCSeal]; !ok {
+				addErrorf("selector %s for arc sealing is missing in domain %s", domain.DKIM.ARCSeal, d)
+			}
+		}
 		for name, sel := range domain.DKIM.Selectors {
 			seld, err := dns.ParseDomain(name)
 			if err != nil {
@@ -1205,6 +1450,37 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			}
 		}
 
+		if du := domain.DNSUpdate; du != nil {
+			if du.Server == "" {
+				addErrorf("dns update for domain %s: missing server", d)
+			}
+			du.DNSZone = dnsdomain
+			if du.Zone != "" {
+				zone, err := dns.ParseDomain(du.Zone)
+				if err != nil {
+					addErrorf("dns update for domain %s: bad zone %q: %s", d, du.Zone, err)
+				} else if dnsdomain.ASCII != zone.ASCII && !strings.HasSuffix(dnsdomain.ASCII, "."+zone.ASCII) {
+					addErrorf("dns update for domain %s: domain is not in zone %s", d, zone)
+				}
+				du.DNSZone = zone
+			}
+			if du.TSIGKeyName == "" {
+				addErrorf("dns update for domain %s: missing tsig key name", d)
+			}
+			switch du.TSIGAlgorithm {
+			case "", "hmac-sha256", "hmac-sha384", "hmac-sha512":
+			default:
+				addErrorf("dns update for domain %s: unsupported tsig algorithm %q", d, du.TSIGAlgorithm)
+			}
+			du.Secret, err = base64.StdEncoding.DecodeString(du.TSIGSecret)
+			if err != nil || len(du.Secret) == 0 {
+				addErrorf("dns update for domain %s: tsig secret must be non-empty base64", d)
+			}
+			if du.TTL < 0 {
+				addErrorf("dns update for domain %s: ttl cannot be negative", d)
+			}
+		}
+
 		checkRoutes("routes for domain", domain.Routes)
 
 		c.Domains[d] = domain
@@ -1244,6 +1520,14 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 			}
 			acc.NotJunkMailbox = r
 		}
+		if acc.LoginLockout != nil {
+			if acc.LoginLockout.MaxFailures <= 0 {
+				addErrorf("account %q: LoginLockout MaxFailures must be larger than 0", accName)
+			}
+			if acc.LoginLockout.Period < 0 {
+				addErrorf("account %q: LoginLockout Period cannot be negative", accName)
+			}
+		}
 		c.Accounts[accName] = acc
 
 		// todo deprecated: only localpart as keys for Destinations, we are replacing them with full addresses. if domains.conf is written, we won't have to do this again.
@@ -1475,6 +1759,24 @@ func prepareDynamicConfig(ctx context.Context, log mlog.Log, dynamicPath string,
 		accDests[addrFull] = AccountDestination{false, lp, tlsrpt.Account, dest}
 	}
 
+	// Check TLS public keys for client certificate authentication. Fingerprints must
+	// be unique, so a certificate identifies a single account.
+	tlsPublicKeys := map[string]string{}
+	for accName, acc := range c.Accounts {
+		for _, k := range acc.TLSPublicKeys {
+			if buf, err := hex.DecodeString(k.Fingerprint); err != nil || len(buf) != sha256.Size || strings.ToLower(k.Fingerprint) != k.Fingerprint {
+				addErrorf("account %q: tls public key %q: fingerprint must be a sha-256 hash in lower case hex", accName, k.Name)
+			}
+			if other, ok := tlsPublicKeys[k.Fingerprint]; ok {
+				addErrorf("account %q: tls public key %q: fingerprint already registered with account %q", accName, k.Name, other)
+			}
+			tlsPublicKeys[k.Fingerprint] = accName
+			if _, ok := acc.Destinations[k.LoginAddress]; !ok || strings.HasPrefix(k.LoginAddress, "@") {
+				addErrorf("account %q: tls public key %q: login address %q is not a destination address of the account", accName, k.Name, k.LoginAddress)
+			}
+		}
+	}
+
 	// Check webserver configs.
 	if (len(c.WebDomainRedirects) > 0 || len(c.WebHandlers) > 0) && !haveWebserverListener {
 		addErrorf("WebDomainRedirects or WebHandlers configured but no listener with WebserverHTTP or WebserverHTTPS enabled")
@@ -18,22 +18,32 @@ import (
 func DKIMSelectors(dkimConf config.DKIM) []dkim.Selector {
 	var l []dkim.Selector
 	for _, sign := range dkimConf.Sign {
-		sel := dkimConf.Selectors[sign]
-		s := dkim.Selector{
-			Hash:          sel.HashEffective,
-			HeaderRelaxed: sel.Canonicalization.HeaderRelaxed,
-			BodyRelaxed:   sel.Canonicalization.BodyRelaxed,
-			Headers:       sel.HeadersEffective,
-			SealHeaders:   !sel.DontSealHeaders,
-			Expiration:    time.Duration(sel.ExpirationSeconds) * time.Second,
-			PrivateKey:    sel.Key,
-			Domain:        sel.Domain,
-		}
-		l = append(l, s)
+		l = append(l, dkimSelector(dkimConf.Selectors[sign]))
 	}
 	return l
 }
 
+// ARCSealSelector returns the selector to use for ARC sealing, if configured.
+func ARCSealSelector(dkimConf config.DKIM) (dkim.Selector, bool) {
+	if dkimConf.ARCSeal == "" {
+		return dkim.Selector{}, false
+	}
+	return dkimSelector(dkimConf.Selectors[dkimConf.ARCSeal]), true
+}
+
+func dkimSelector(sel config.Selector) dkim.Selector {
+	return dkim.Selector{
+		Hash:          sel.HashEffective,
+		HeaderRelaxed: sel.Canonicalization.HeaderRelaxed,
+		BodyRelaxed:   sel.Canonicalization.BodyRelaxed,
+		Headers:       sel.HeadersEffective,
+		SealHeaders:   !sel.DontSealHeaders,
+		Expiration:    time.Duration(sel.ExpirationSeconds) * time.Second,
+		PrivateKey:    sel.Key,
+		Domain:        sel.Domain,
+	}
+}
+
 // DKIMSign looks up the domain for "from", and uses its DKIM configuration to
 // generate DKIM-Signature headers, for inclusion in a message. The
 // DKIM-Signatur headers, are returned. If no domain was found an empty string and
@@ -19,7 +19,7 @@ import (
 // exec as unprivileged user. During startup as root, we gather the fd's for the
 // listen addresses in passedListeners and files in passedFiles, and pass their
 // addresses and paths in environment variables to the new process.
-var passedListeners = map[string]*os.File{} // Listen address to file descriptor.
+var passedListeners = map[string]*os.File{} // Listen address (prefixed with "udp:" for packet listeners) to file descriptor.
 var passedFiles = map[string][]*os.File{}   // Path to file descriptors.
 
 // RestorePassedFiles reads addresses from $BEACON_SOCKETS and paths from $BEACON_FILES
@@ -114,6 +114,45 @@ func Listen(network, addr string) (net.Listener, error) {
 	return ln, err
 }
 
+// ListenPacket is like Listen, but for packet-oriented networks, i.e. "udp",
+// "udp4" and "udp6".
+func ListenPacket(network, addr string) (net.PacketConn, error) {
+	// Packet and stream listeners can share an address, keep them apart.
+	key := "udp:" + addr
+	if os.Getuid() != 0 && !FilesImmediate {
+		f, ok := passedListeners[key]
+		if !ok {
+			return nil, fmt.Errorf("no file descriptor for packet listener %s", addr)
+		}
+		conn, err := net.FilePacketConn(f)
+		if err != nil {
+			return nil, fmt.Errorf("making packet listener from file descriptor for address %s: %v", addr, err)
+		}
+		return conn, nil
+	}
+
+	if _, ok := passedListeners[key]; ok {
+		return nil, fmt.Errorf("duplicate packet listener: %s", addr)
+	}
+
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !FilesImmediate {
+		udpconn, ok := conn.(*net.UDPConn)
+		if !ok {
+			return nil, fmt.Errorf("packet listener not a udp listener, but %T, for network %s, address %s", conn, network, addr)
+		}
+		f, err := udpconn.File()
+		if err != nil {
+			return nil, fmt.Errorf("dup packet listener: %v", err)
+		}
+		passedListeners[key] = f
+	}
+	return conn, err
+}
+
 // Open a privileged file, such as a TLS private key. When running as root
 // (during startup), the file is opened and the file descriptor is stored.
 // These file descriptors are passed to the unprivileged process. When in the
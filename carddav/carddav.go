@@ -0,0 +1,469 @@
+// Package carddav implements a CardDAV server (RFC 6352) for the address book of
+// an account, so contacts can be synchronized with phones and desktop clients.
+//
+// Each account has a single address book. Clients authenticate with HTTP basic
+// authentication, with an email address of the account and its password. Like for
+// IMAP and SMTP submission, accounts with two-factor authentication enabled or
+// required must use an app password instead of the account password.
+//
+// URLs below the CardDAV path:
+//
+//   - /: Root, with the current user principal.
+//   - principal/: Principal for the authenticated account.
+//   - addressbooks/: Home with the address book collections.
+//   - addressbooks/contacts/: The address book, with vCards as resources.
+//
+// Clients can find the root through /.well-known/carddav (RFC 6764).
+package carddav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/loginattempt"
+	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/store"
+	"github.com/qompassai/beacon/vcard"
+)
+
+var pkglog = mlog.New("carddav", nil)
+
+// XML namespaces.
+const (
+	nsDAV     = "DAV:"
+	nsCardDAV = "urn:ietf:params:xml:ns:carddav"
+	nsCS      = "http://calendarserver.org/ns/"
+)
+
+// Prefixes used in responses for the namespaces.
+var nsPrefixes = map[string]string{
+	nsDAV:     "D:",
+	nsCardDAV: "C:",
+	nsCS:      "CS:",
+}
+
+const addressBookName = "contacts"
+
+// Handler returns a handler for CardDAV requests. Request paths are relative to
+// davPath, which must end with a slash and is used for the hrefs in responses.
+func Handler(davPath string, isForwarded bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handle(davPath, isForwarded, w, r)
+	}
+}
+
+// kind of resource a request path refers to.
+type kind int
+
+const (
+	kindNone kind = iota
+	kindRoot
+	kindPrincipal
+	kindHome
+	kindAddressBook
+	kindContact
+)
+
+// parsePath returns the kind of resource for a path relative to the CardDAV root,
+// and for contacts the resource name.
+func parsePath(p string) (kind, string) {
+	p = strings.TrimPrefix(p, "/")
+	switch p {
+	case "":
+		return kindRoot, ""
+	case "principal", "principal/":
+		return kindPrincipal, ""
+	case "addressbooks", "addressbooks/":
+		return kindHome, ""
+	case "addressbooks/" + addressBookName, "addressbooks/" + addressBookName + "/":
+		return kindAddressBook, ""
+	}
+	if name, ok := strings.CutPrefix(p, "addressbooks/"+addressBookName+"/"); ok && name != "" && !strings.Contains(name, "/") {
+		return kindContact, name
+	}
+	return kindNone, ""
+}
+
+type request struct {
+	ctx     context.Context
+	log     mlog.Log
+	davPath string
+	acc     *store.Account
+}
+
+func (req request) href(k kind, name string) string {
+	switch k {
+	case kindRoot:
+		return req.davPath
+	case kindPrincipal:
+		return req.davPath + "principal/"
+	case kindHome:
+		return req.davPath + "addressbooks/"
+	case kindAddressBook:
+		return req.davPath + "addressbooks/" + addressBookName + "/"
+	case kindContact:
+		return req.davPath + "addressbooks/" + addressBookName + "/" + url.PathEscape(name)
+	}
+	panic("bad kind")
+}
+
+func handle(davPath string, isForwarded bool, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := pkglog.WithContext(ctx)
+
+	w.Header().Set("DAV", "1, 3, addressbook")
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	acc, ok := authenticate(ctx, log, isForwarded, w, r)
+	if !ok {
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	log = log.With(slog.String("account", acc.Name))
+
+	req := request{ctx, log, davPath, acc}
+	k, name := parsePath(r.URL.Path)
+	if k == kindNone {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		req.propfind(w, r, k, name)
+	case "REPORT":
+		req.report(w, r, k)
+	case "GET", "HEAD":
+		req.get(w, r, k, name)
+	case "PUT":
+		req.put(w, r, k, name)
+	case "DELETE":
+		req.delete(w, r, k, name)
+	default:
+		http.Error(w, "405 - method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Successful authentications are stored in the login attempt log at most once an
+// hour per account and remote IP: clients authenticate for each request.
+var recentAuth = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: map[string]time.Time{}}
+
+// recentlyAuthenticated returns whether a successful authentication was recorded
+// for the account and IP in the past hour, and if not, marks it as recorded now.
+func recentlyAuthenticated(accName string, ip net.IP, now time.Time) bool {
+	key := accName + " " + ip.String()
+	recentAuth.Lock()
+	defer recentAuth.Unlock()
+	if last, ok := recentAuth.last[key]; ok && now.Sub(last) < time.Hour {
+		return true
+	}
+	for k, last := range recentAuth.last {
+		if now.Sub(last) >= time.Hour {
+			delete(recentAuth.last, k)
+		}
+	}
+	recentAuth.last[key] = now
+	return false
+}
+
+// authenticate checks the HTTP basic authentication credentials, writing an error
+// response when authentication fails.
+func authenticate(ctx context.Context, log mlog.Log, isForwarded bool, w http.ResponseWriter, r *http.Request) (*store.Account, bool) {
+	unauthorized := func(msg string) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="CardDAV", charset="UTF-8"`)
+		http.Error(w, "401 - unauthorized - "+msg, http.StatusUnauthorized)
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		unauthorized("authentication required")
+		return nil, false
+	}
+
+	ip := remoteIP(isForwarded, r)
+	if ip == nil {
+		http.Error(w, "500 - internal server error - cannot find ip for rate limit check", http.StatusInternalServerError)
+		return nil, false
+	}
+	start := time.Now()
+	if !beacon.LimiterFailedAuth.CanAdd(ip, start, 1) {
+		metrics.AuthenticationRatelimitedInc("carddav")
+		http.Error(w, "429 - too many authentication attempts", http.StatusTooManyRequests)
+		return nil, false
+	}
+
+	var authResult string
+	var acc *store.Account
+	defer func() {
+		metrics.AuthenticationInc("carddav", "basic", authResult)
+		if authResult == "ok" && recentlyAuthenticated(acc.Name, ip, start) {
+			return
+		} else if authResult == "badcreds" {
+			beacon.LimiterFailedAuth.Add(ip, start, 1)
+		}
+		var localIP string
+		if a, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+			localIP = a.IP.String()
+		}
+		loginattempt.Record(ctx, log, loginattempt.LoginAttempt{
+			LoginAddress: username,
+			RemoteIP:     ip.String(),
+			LocalIP:      localIP,
+			TLS:          loginattempt.TLSInfo(r.TLS),
+			Protocol:     "carddav",
+			AuthMech:     "basic",
+			Result:       authResult,
+		})
+	}()
+
+	// Checked before verifying the password, with the same response as for bad
+	// credentials, so attempts during a lockout don't reveal whether a password is
+	// correct.
+	if locked, err := loginattempt.LockedLogin(ctx, "", username); err != nil {
+		authResult = "error"
+		log.Errorx("checking login lockout", err)
+		http.Error(w, "500 - internal server error - checking login lockout", http.StatusInternalServerError)
+		return nil, false
+	} else if locked {
+		authResult = "locked"
+		log.Info("failed authentication attempt, authentication for account blocked", slog.String("username", username), slog.Any("remote", ip))
+		unauthorized("invalid credentials")
+		return nil, false
+	}
+
+	acc, err := store.OpenEmailAuth(log, username, password, false)
+	if err != nil {
+		acc = nil
+		if errors.Is(err, store.ErrUnknownCredentials) || errors.Is(err, beacon.ErrAccountNotFound) || errors.Is(err, beacon.ErrDomainNotFound) {
+			authResult = "badcreds"
+			log.Info("failed authentication attempt", slog.String("username", username), slog.Any("remote", ip))
+			unauthorized("invalid credentials")
+		} else {
+			authResult = "error"
+			log.Errorx("authentication", err, slog.String("username", username))
+			http.Error(w, "500 - internal server error - "+err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	authResult = "ok"
+	beacon.LimiterFailedAuth.Reset(ip, start)
+	return acc, true
+}
+
+func remoteIP(isForwarded bool, r *http.Request) net.IP {
+	if isForwarded {
+		s := r.Header.Get("X-Forwarded-For")
+		ipstr := strings.TrimSpace(strings.Split(s, ",")[0])
+		return net.ParseIP(ipstr)
+	}
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return net.ParseIP(host)
+}
+
+// httpError logs an unexpected error and writes a 500 response.
+func (req request) httpError(w http.ResponseWriter, msg string, err error) {
+	req.log.Errorx(msg, err)
+	http.Error(w, "500 - internal server error - "+msg, http.StatusInternalServerError)
+}
+
+// writeError writes a DAV:error response body with a failed precondition.
+func writeError(w http.ResponseWriter, status int, precondition string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `%s<D:error xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">%s</D:error>`, xml.Header, precondition)
+}
+
+// lookup returns the contact for a resource name. The bool is false if the
+// contact does not exist.
+func (req request) lookup(tx *bstore.Tx, name string) (store.Contact, bool, error) {
+	c, err := bstore.QueryTx[store.Contact](tx).FilterNonzero(store.Contact{Resource: name}).Get()
+	if err == bstore.ErrAbsent {
+		return store.Contact{}, false, nil
+	} else if err != nil {
+		return store.Contact{}, false, fmt.Errorf("looking up contact: %v", err)
+	}
+	return c, true, nil
+}
+
+func (req request) get(w http.ResponseWriter, r *http.Request, k kind, name string) {
+	if k != kindContact {
+		http.Error(w, "405 - method not allowed - only contacts can be fetched", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var c store.Contact
+	var found bool
+	err := req.acc.DB.Read(req.ctx, func(tx *bstore.Tx) (err error) {
+		c, found, err = req.lookup(tx, name)
+		return err
+	})
+	if err != nil {
+		req.httpError(w, "looking up contact", err)
+		return
+	} else if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/vcard; charset=utf-8")
+	h.Set("ETag", c.ETag())
+	h.Set("Last-Modified", c.Updated.UTC().Format(http.TimeFormat))
+	h.Set("Content-Length", fmt.Sprintf("%d", len(c.VCard)))
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, c.ETag()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "GET" {
+		_, err := io.WriteString(w, c.VCard)
+		req.log.Check(err, "writing vcard")
+	}
+}
+
+// etagMatch returns whether an If-Match or If-None-Match header value matches
+// etag.
+func etagMatch(header, etag string) bool {
+	for _, s := range strings.Split(header, ",") {
+		s = strings.TrimSpace(s)
+		if s == "*" || strings.TrimPrefix(s, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (req request) put(w http.ResponseWriter, r *http.Request, k kind, name string) {
+	if k != kindContact {
+		http.Error(w, "405 - method not allowed - only contacts can be stored", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		ct = strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+		if ct != "text/vcard" && ct != "text/x-vcard" {
+			writeError(w, http.StatusUnsupportedMediaType, "<C:supported-address-data/>")
+			return
+		}
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, store.ContactMaxSize+1))
+	if err != nil {
+		http.Error(w, "400 - bad request - reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(buf) > store.ContactMaxSize {
+		writeError(w, http.StatusForbidden, "<C:max-resource-size/>")
+		return
+	}
+
+	var c store.Contact
+	var created, preconditionFailed bool
+	var conflict string
+	err = req.acc.DB.Write(req.ctx, func(tx *bstore.Tx) error {
+		old, found, err := req.lookup(tx, name)
+		if err != nil {
+			return err
+		}
+		if match := r.Header.Get("If-Match"); match != "" && (!found || !etagMatch(match, old.ETag())) {
+			preconditionFailed = true
+			return nil
+		}
+		if match := r.Header.Get("If-None-Match"); match != "" && found && etagMatch(match, old.ETag()) {
+			preconditionFailed = true
+			return nil
+		}
+
+		c, created, err = store.ContactPut(tx, name, string(buf))
+		if errors.Is(err, store.ErrContactUID) {
+			if card, perr := vcard.Parse(string(buf)); perr == nil {
+				if oc, oerr := bstore.QueryTx[store.Contact](tx).FilterNonzero(store.Contact{UID: card.Text("UID")}).Get(); oerr == nil {
+					conflict = oc.Resource
+				}
+			}
+		}
+		return err
+	})
+	if preconditionFailed {
+		http.Error(w, "412 - precondition failed", http.StatusPreconditionFailed)
+		return
+	} else if errors.Is(err, store.ErrContactUID) {
+		writeError(w, http.StatusForbidden, "<C:no-uid-conflict><D:href>"+xmlEscape(req.href(kindContact, conflict))+"</D:href></C:no-uid-conflict>")
+		return
+	} else if errors.Is(err, vcard.ErrSyntax) {
+		req.log.Debugx("storing invalid vcard", err)
+		writeError(w, http.StatusForbidden, "<C:valid-address-data/>")
+		return
+	} else if err != nil {
+		req.httpError(w, "storing contact", err)
+		return
+	}
+	req.log.Debug("contact stored", slog.String("resource", name), slog.Bool("created", created))
+
+	w.Header().Set("ETag", c.ETag())
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (req request) delete(w http.ResponseWriter, r *http.Request, k kind, name string) {
+	if k != kindContact {
+		http.Error(w, "405 - method not allowed - only contacts can be removed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var found, preconditionFailed bool
+	err := req.acc.DB.Write(req.ctx, func(tx *bstore.Tx) error {
+		c, ok, err := req.lookup(tx, name)
+		if err != nil || !ok {
+			return err
+		}
+		found = true
+		if match := r.Header.Get("If-Match"); match != "" && !etagMatch(match, c.ETag()) {
+			preconditionFailed = true
+			return nil
+		}
+		return store.ContactRemove(tx, c)
+	})
+	if err != nil {
+		req.httpError(w, "removing contact", err)
+	} else if !found {
+		http.NotFound(w, r)
+	} else if preconditionFailed {
+		http.Error(w, "412 - precondition failed", http.StatusPreconditionFailed)
+	} else {
+		req.log.Debug("contact removed", slog.String("resource", name))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package carddav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/store"
+)
+
+func init() {
+	beacon.LimitersInit()
+}
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+const card1 = "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:uid1\r\nFN:Jane Doe\r\nEMAIL:jane@example.org\r\nEND:VCARD\r\n"
+const card2 = "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:uid2\r\nN:Smith;John;;;\r\nFN:John Smith\r\nTEL:+1 555 0100\r\nEND:VCARD\r\n"
+
+func TestCardDAV(t *testing.T) {
+	os.RemoveAll("../testdata/carddav/data")
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/carddav/beacon.conf")
+	beacon.ConfigDynamicPath = filepath.Join(filepath.Dir(beacon.ConfigStaticPath), "domains.conf")
+	beacon.MustLoadConfig(true, false)
+	log := mlog.New("carddav", nil)
+	acc, err := store.OpenAccount(log, "mjl")
+	tcheck(t, err, "open account")
+	err = acc.SetPassword(log, "test1234")
+	tcheck(t, err, "set password")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+	}()
+	defer store.Switchboard()()
+
+	const davPath = "/dav/"
+	handler := http.StripPrefix(davPath[:len(davPath)-1], http.HandlerFunc(Handler(davPath, false)))
+
+	type response struct {
+		code int
+		body string
+		hdr  http.Header
+	}
+	request := func(method, path, password string, hdrs map[string]string, body string) response {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		if password != "" {
+			req.SetBasicAuth("mjl@beacon.example", password)
+		}
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		resp := rec.Result()
+		buf, err := io.ReadAll(resp.Body)
+		tcheck(t, err, "read body")
+		return response{resp.StatusCode, string(buf), resp.Header}
+	}
+	test := func(method, path string, hdrs map[string]string, body string, expCode int, expBody ...string) response {
+		t.Helper()
+		resp := request(method, path, "test1234", hdrs, body)
+		if resp.code != expCode {
+			t.Fatalf("%s %s: got status %d, expected %d, body %q", method, path, resp.code, expCode, resp.body)
+		}
+		for _, s := range expBody {
+			if !strings.Contains(resp.body, s) {
+				t.Fatalf("%s %s: body does not contain %q: %q", method, path, s, resp.body)
+			}
+		}
+		return resp
+	}
+
+	// Authentication.
+	if resp := request("PROPFIND", "/dav/", "", nil, ""); resp.code != http.StatusUnauthorized || resp.hdr.Get("WWW-Authenticate") == "" {
+		t.Fatalf("got status %d, expected 401 with WWW-Authenticate", resp.code)
+	}
+	if resp := request("PROPFIND", "/dav/", "badpassword", nil, ""); resp.code != http.StatusUnauthorized {
+		t.Fatalf("got status %d for bad password, expected 401", resp.code)
+	}
+	if resp := request("OPTIONS", "/dav/", "", nil, ""); resp.code != http.StatusOK || !strings.Contains(resp.hdr.Get("DAV"), "addressbook") {
+		t.Fatalf("options: got status %d, dav header %q", resp.code, resp.hdr.Get("DAV"))
+	}
+
+	// Discovery, from root through principal and home to address book.
+	const propfindPrincipal = `<?xml version="1.0"?><propfind xmlns="DAV:"><prop><current-user-principal/><resourcetype/></prop></propfind>`
+	test("PROPFIND", "/dav/", map[string]string{"Depth": "0"}, propfindPrincipal, http.StatusMultiStatus, "<D:current-user-principal><D:href>/dav/principal/</D:href>")
+	const propfindHome = `<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><D:prop><C:addressbook-home-set/><D:unknown/></D:prop></D:propfind>`
+	test("PROPFIND", "/dav/principal/", map[string]string{"Depth": "0"}, propfindHome, http.StatusMultiStatus, "<C:addressbook-home-set><D:href>/dav/addressbooks/</D:href>", "<D:unknown></D:unknown>", "HTTP/1.1 404 Not Found")
+	test("PROPFIND", "/dav/addressbooks/", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus, "<D:href>/dav/addressbooks/contacts/</D:href>", "<C:addressbook/>")
+
+	// Store contacts.
+	resp := test("PUT", "/dav/addressbooks/contacts/a.vcf", map[string]string{"Content-Type": "text/vcard", "If-None-Match": "*"}, card1, http.StatusCreated)
+	etag1 := resp.hdr.Get("ETag")
+	test("PUT", "/dav/addressbooks/contacts/a.vcf", map[string]string{"If-None-Match": "*"}, card1, http.StatusPreconditionFailed)
+	test("PUT", "/dav/addressbooks/contacts/a.vcf", map[string]string{"If-Match": `"bogus"`}, card1, http.StatusPreconditionFailed)
+	test("PUT", "/dav/addressbooks/contacts/a.vcf", map[string]string{"If-Match": etag1}, card1, http.StatusNoContent)
+	test("PUT", "/dav/addressbooks/contacts/b%20c.vcf", nil, card2, http.StatusCreated)
+	test("PUT", "/dav/addressbooks/contacts/d.vcf", nil, card1, http.StatusForbidden, "<C:no-uid-conflict><D:href>/dav/addressbooks/contacts/a.vcf</D:href>")
+	test("PUT", "/dav/addressbooks/contacts/d.vcf", nil, "bogus", http.StatusForbidden, "<C:valid-address-data/>")
+	test("PUT", "/dav/addressbooks/contacts/d.vcf", map[string]string{"Content-Type": "text/plain"}, card1, http.StatusUnsupportedMediaType)
+	test("PUT", "/dav/addressbooks/contacts/", nil, card1, http.StatusMethodNotAllowed)
+
+	// Fetch.
+	resp = test("GET", "/dav/addressbooks/contacts/a.vcf", nil, "", http.StatusOK, card1)
+	if resp.hdr.Get("ETag") != etag1 || !strings.HasPrefix(resp.hdr.Get("Content-Type"), "text/vcard") {
+		t.Fatalf("unexpected headers %v", resp.hdr)
+	}
+	test("GET", "/dav/addressbooks/contacts/a.vcf", map[string]string{"If-None-Match": etag1}, "", http.StatusNotModified)
+	test("GET", "/dav/addressbooks/contacts/missing.vcf", nil, "", http.StatusNotFound)
+
+	// Listing with etags and ctag.
+	const propfindList = `<?xml version="1.0"?><propfind xmlns="DAV:" xmlns:CS="http://calendarserver.org/ns/"><prop><getetag/><CS:getctag/></prop></propfind>`
+	test("PROPFIND", "/dav/addressbooks/contacts/", map[string]string{"Depth": "1"}, propfindList, http.StatusMultiStatus, "<CS:getctag>3</CS:getctag>", "<D:href>/dav/addressbooks/contacts/a.vcf</D:href>", "<D:href>/dav/addressbooks/contacts/b%20c.vcf</D:href>", "<D:getetag>&#34;")
+
+	// Multiget, including a missing contact.
+	const multiget = `<?xml version="1.0"?><C:addressbook-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><D:prop><D:getetag/><C:address-data/></D:prop><D:href>/dav/addressbooks/contacts/b%20c.vcf</D:href><D:href>/dav/addressbooks/contacts/missing.vcf</D:href></C:addressbook-multiget>`
+	resp = test("REPORT", "/dav/addressbooks/contacts/", map[string]string{"Depth": "1"}, multiget, http.StatusMultiStatus, "FN:John Smith", "<D:href>/dav/addressbooks/contacts/missing.vcf</D:href><D:status>HTTP/1.1 404 Not Found</D:status>")
+	if strings.Contains(resp.body, "Jane") {
+		t.Fatalf("multiget returned contact not asked for")
+	}
+
+	// Query.
+	const query = `<?xml version="1.0"?><C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><D:prop><D:getetag/></D:prop><C:filter><C:prop-filter name="EMAIL"><C:text-match collation="i;unicode-casemap" match-type="contains">EXAMPLE.ORG</C:text-match></C:prop-filter></C:filter></C:addressbook-query>`
+	resp = test("REPORT", "/dav/addressbooks/contacts/", map[string]string{"Depth": "1"}, query, http.StatusMultiStatus, "/dav/addressbooks/contacts/a.vcf")
+	if strings.Contains(resp.body, "b%20c.vcf") {
+		t.Fatalf("query returned non-matching contact")
+	}
+	const queryNotDefined = `<?xml version="1.0"?><C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><D:prop><D:getetag/></D:prop><C:filter><C:prop-filter name="EMAIL"><C:is-not-defined/></C:prop-filter></C:filter></C:addressbook-query>`
+	resp = test("REPORT", "/dav/addressbooks/contacts/", map[string]string{"Depth": "1"}, queryNotDefined, http.StatusMultiStatus, "/dav/addressbooks/contacts/b%20c.vcf")
+	if strings.Contains(resp.body, "a.vcf") {
+		t.Fatalf("query returned non-matching contact")
+	}
+	test("REPORT", "/dav/addressbooks/contacts/", nil, `<?xml version="1.0"?><sync-collection xmlns="DAV:"/>`, http.StatusForbidden, "<D:supported-report/>")
+
+	// Delete.
+	test("DELETE", "/dav/addressbooks/contacts/a.vcf", map[string]string{"If-Match": `"bogus"`}, "", http.StatusPreconditionFailed)
+	test("DELETE", "/dav/addressbooks/contacts/a.vcf", map[string]string{"If-Match": etag1}, "", http.StatusNoContent)
+	test("DELETE", "/dav/addressbooks/contacts/a.vcf", nil, "", http.StatusNotFound)
+	test("PROPFIND", "/dav/addressbooks/contacts/", map[string]string{"Depth": "0"}, propfindList, http.StatusMultiStatus, "<CS:getctag>4</CS:getctag>")
+
+	test("PROPFIND", "/dav/other/", nil, "", http.StatusNotFound)
+}
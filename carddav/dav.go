@@ -0,0 +1,545 @@
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/store"
+	"github.com/qompassai/beacon/vcard"
+)
+
+// Request bodies for PROPFIND and REPORT are small, except for multiget with many
+// hrefs.
+const maxRequestSize = 1024 * 1024
+
+// Names of properties.
+var (
+	propResourceType            = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName             = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentUserPrincipal    = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL            = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propCurrentUserPrivilegeSet = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propSupportedReportSet      = xml.Name{Space: nsDAV, Local: "supported-report-set"}
+	propGetETag                 = xml.Name{Space: nsDAV, Local: "getetag"}
+	propGetContentType          = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propGetContentLength        = xml.Name{Space: nsDAV, Local: "getcontentlength"}
+	propGetLastModified         = xml.Name{Space: nsDAV, Local: "getlastmodified"}
+	propAddressBookHomeSet      = xml.Name{Space: nsCardDAV, Local: "addressbook-home-set"}
+	propAddressBookDescription  = xml.Name{Space: nsCardDAV, Local: "addressbook-description"}
+	propSupportedAddressData    = xml.Name{Space: nsCardDAV, Local: "supported-address-data"}
+	propMaxResourceSize         = xml.Name{Space: nsCardDAV, Local: "max-resource-size"}
+	propAddressData             = xml.Name{Space: nsCardDAV, Local: "address-data"}
+	propGetCTag                 = xml.Name{Space: nsCS, Local: "getctag"}
+)
+
+// Inner XML of properties.
+var (
+	privileges           = "<D:privilege><D:read/></D:privilege><D:privilege><D:read-current-user-privilege-set/></D:privilege><D:privilege><D:write/></D:privilege><D:privilege><D:write-content/></D:privilege><D:privilege><D:bind/></D:privilege><D:privilege><D:unbind/></D:privilege>"
+	supportedReports     = "<D:supported-report><D:report><C:addressbook-multiget/></D:report></D:supported-report><D:supported-report><D:report><C:addressbook-query/></D:report></D:supported-report>"
+	supportedAddressData = `<C:address-data-type content-type="text/vcard" version="4.0"/><C:address-data-type content-type="text/vcard" version="3.0"/>`
+	collectionTypes      = map[kind]string{kindRoot: "<D:collection/>", kindPrincipal: "<D:principal/>", kindHome: "<D:collection/>", kindAddressBook: "<D:collection/><C:addressbook/>"}
+)
+
+// Elements in requests.
+
+type anyElem struct {
+	XMLName xml.Name
+}
+
+type propNames struct {
+	Names []anyElem `xml:",any"`
+}
+
+type propfindRequest struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+type multigetRequest struct {
+	XMLName xml.Name   `xml:"urn:ietf:params:xml:ns:carddav addressbook-multiget"`
+	AllProp *struct{}  `xml:"DAV: allprop"`
+	Prop    *propNames `xml:"DAV: prop"`
+	Hrefs   []string   `xml:"DAV: href"`
+}
+
+type queryRequest struct {
+	XMLName xml.Name   `xml:"urn:ietf:params:xml:ns:carddav addressbook-query"`
+	AllProp *struct{}  `xml:"DAV: allprop"`
+	Prop    *propNames `xml:"DAV: prop"`
+	Filter  filter     `xml:"urn:ietf:params:xml:ns:carddav filter"`
+	Limit   *struct {
+		NResults int `xml:"urn:ietf:params:xml:ns:carddav nresults"`
+	} `xml:"urn:ietf:params:xml:ns:carddav limit"`
+}
+
+type filter struct {
+	Test        string       `xml:"test,attr"` // "anyof" (default) or "allof".
+	PropFilters []propFilter `xml:"urn:ietf:params:xml:ns:carddav prop-filter"`
+}
+
+type propFilter struct {
+	Name         string      `xml:"name,attr"`
+	Test         string      `xml:"test,attr"`
+	IsNotDefined *struct{}   `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatches  []textMatch `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+	ParamFilters []anyElem   `xml:"urn:ietf:params:xml:ns:carddav param-filter"`
+}
+
+type textMatch struct {
+	Collation       string `xml:"collation,attr"`
+	NegateCondition string `xml:"negate-condition,attr"`
+	MatchType       string `xml:"match-type,attr"`
+	Value           string `xml:",chardata"`
+}
+
+// Elements in responses. Names are written with the prefixes from nsPrefixes,
+// declared on the multistatus element.
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"D:multistatus"`
+	NSDAV     string     `xml:"xmlns:D,attr"`
+	NSCardDAV string     `xml:"xmlns:C,attr"`
+	NSCS      string     `xml:"xmlns:CS,attr"`
+	Responses []response `xml:"D:response"`
+}
+
+type response struct {
+	Href      string     `xml:"D:href"`
+	Status    string     `xml:"D:status,omitempty"`
+	Propstats []propstat `xml:"D:propstat"`
+}
+
+type propstat struct {
+	Prop   propList `xml:"D:prop"`
+	Status string   `xml:"D:status"`
+}
+
+type propList struct {
+	Values []propValue `xml:",any"`
+}
+
+type propValue struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// prop is a property of a resource with its inner XML.
+type prop struct {
+	name  xml.Name
+	inner string
+}
+
+func elemName(name xml.Name) xml.Name {
+	if p, ok := nsPrefixes[name.Space]; ok {
+		return xml.Name{Local: p + name.Local}
+	}
+	return name
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+func writeMultistatus(w http.ResponseWriter, ms multistatus) error {
+	ms.NSDAV = nsDAV
+	ms.NSCardDAV = nsCardDAV
+	ms.NSCS = nsCS
+	buf, err := xml.Marshal(ms)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, err = w.Write(append([]byte(xml.Header), buf...))
+	return err
+}
+
+// props returns the properties of a resource, excluding address-data. For
+// collections, ctag is the number of changes to the address book.
+func (req request) props(k kind, c *store.Contact, ctag int64) []prop {
+	var l []prop
+	add := func(name xml.Name, inner string) {
+		l = append(l, prop{name, inner})
+	}
+	if k == kindContact {
+		add(propResourceType, "")
+		add(propGetETag, xmlEscape(c.ETag()))
+		add(propGetContentType, "text/vcard; charset=utf-8")
+		add(propGetContentLength, fmt.Sprintf("%d", len(c.VCard)))
+		add(propGetLastModified, c.Updated.UTC().Format(http.TimeFormat))
+		return l
+	}
+
+	principal := "<D:href>" + xmlEscape(req.href(kindPrincipal, "")) + "</D:href>"
+	add(propResourceType, collectionTypes[k])
+	add(propCurrentUserPrincipal, principal)
+	add(propCurrentUserPrivilegeSet, privileges)
+	switch k {
+	case kindPrincipal:
+		add(propDisplayName, xmlEscape(req.acc.Name))
+		add(propPrincipalURL, principal)
+		add(propAddressBookHomeSet, "<D:href>"+xmlEscape(req.href(kindHome, ""))+"</D:href>")
+	case kindHome:
+		add(propAddressBookHomeSet, "<D:href>"+xmlEscape(req.href(kindHome, ""))+"</D:href>")
+	case kindAddressBook:
+		add(propDisplayName, "Contacts")
+		add(propAddressBookDescription, "Contacts of account "+xmlEscape(req.acc.Name))
+		add(propSupportedAddressData, supportedAddressData)
+		add(propMaxResourceSize, fmt.Sprintf("%d", store.ContactMaxSize))
+		add(propSupportedReportSet, supportedReports)
+		add(propGetCTag, fmt.Sprintf("%d", ctag))
+		add(propGetETag, fmt.Sprintf(`"%d"`, ctag))
+	}
+	return l
+}
+
+// response returns a response for a resource with the requested properties,
+// with unknown properties in a separate propstat with status 404. If names is
+// nil, all properties are returned. If onlyNames is set, properties are
+// returned without values.
+func (req request) response(k kind, c *store.Contact, ctag int64, names []xml.Name, onlyNames bool) response {
+	var name string
+	if c != nil {
+		name = c.Resource
+	}
+	resp := response{Href: req.href(k, name)}
+	props := req.props(k, c, ctag)
+
+	var found, missing []propValue
+	if names == nil {
+		for _, p := range props {
+			inner := p.inner
+			if onlyNames {
+				inner = ""
+			}
+			found = append(found, propValue{elemName(p.name), inner})
+		}
+	} else {
+	Names:
+		for _, n := range names {
+			if n == propAddressData && c != nil {
+				found = append(found, propValue{elemName(n), xmlEscape(c.VCard)})
+				continue
+			}
+			for _, p := range props {
+				if p.name == n {
+					found = append(found, propValue{elemName(n), p.inner})
+					continue Names
+				}
+			}
+			missing = append(missing, propValue{elemName(n), ""})
+		}
+	}
+	if len(found) > 0 {
+		resp.Propstats = append(resp.Propstats, propstat{propList{found}, statusLine(http.StatusOK)})
+	}
+	if len(missing) > 0 {
+		resp.Propstats = append(resp.Propstats, propstat{propList{missing}, statusLine(http.StatusNotFound)})
+	}
+	return resp
+}
+
+// readXML reads the request body and parses it into v. An empty body is not an
+// error, the bool return value indicates if a body was present.
+func readXML(r *http.Request, v any) (bool, error) {
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		return false, fmt.Errorf("reading request body: %v", err)
+	} else if len(buf) > maxRequestSize {
+		return false, fmt.Errorf("request body too large")
+	} else if len(bytes.TrimSpace(buf)) == 0 {
+		return false, nil
+	}
+	if err := xml.Unmarshal(buf, v); err != nil {
+		return false, fmt.Errorf("parsing xml request body: %v", err)
+	}
+	return true, nil
+}
+
+func requestedNames(p *propNames) []xml.Name {
+	l := []xml.Name{}
+	if p != nil {
+		for _, e := range p.Names {
+			l = append(l, e.XMLName)
+		}
+	}
+	return l
+}
+
+func (req request) propfind(w http.ResponseWriter, r *http.Request, k kind, name string) {
+	depth := r.Header.Get("Depth")
+	if depth != "" && depth != "0" && depth != "1" && depth != "infinity" {
+		http.Error(w, "400 - bad request - invalid depth", http.StatusBadRequest)
+		return
+	}
+
+	var pf propfindRequest
+	present, err := readXML(r, &pf)
+	if err != nil {
+		http.Error(w, "400 - bad request - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Without body, or with allprop, all properties are returned.
+	var names []xml.Name
+	if present && pf.PropName == nil && pf.AllProp == nil {
+		names = requestedNames(pf.Prop)
+	}
+	onlyNames := pf.PropName != nil
+
+	var ms multistatus
+	var found bool
+	err = req.acc.DB.Read(req.ctx, func(tx *bstore.Tx) error {
+		ctag, err := store.AddressBookChanges(tx)
+		if err != nil {
+			return fmt.Errorf("get address book changes: %v", err)
+		}
+
+		if k == kindContact {
+			c, ok, err := req.lookup(tx, name)
+			if err != nil || !ok {
+				return err
+			}
+			found = true
+			ms.Responses = append(ms.Responses, req.response(k, &c, ctag, names, onlyNames))
+			return nil
+		}
+
+		found = true
+		ms.Responses = append(ms.Responses, req.response(k, nil, ctag, names, onlyNames))
+		// Depth infinity is treated as depth 1, the hierarchy is shallow.
+		if depth == "0" {
+			return nil
+		}
+		switch k {
+		case kindRoot:
+			ms.Responses = append(ms.Responses, req.response(kindPrincipal, nil, ctag, names, onlyNames))
+			ms.Responses = append(ms.Responses, req.response(kindHome, nil, ctag, names, onlyNames))
+		case kindHome:
+			ms.Responses = append(ms.Responses, req.response(kindAddressBook, nil, ctag, names, onlyNames))
+		case kindAddressBook:
+			return bstore.QueryTx[store.Contact](tx).ForEach(func(c store.Contact) error {
+				ms.Responses = append(ms.Responses, req.response(kindContact, &c, ctag, names, onlyNames))
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		req.httpError(w, "listing properties", err)
+		return
+	} else if !found {
+		http.NotFound(w, r)
+		return
+	}
+	err = writeMultistatus(w, ms)
+	req.log.Check(err, "writing propfind response")
+}
+
+func (req request) report(w http.ResponseWriter, r *http.Request, k kind) {
+	if k != kindAddressBook {
+		writeError(w, http.StatusForbidden, "<D:supported-report/>")
+		return
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		http.Error(w, "400 - bad request - reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(buf) > maxRequestSize {
+		http.Error(w, "400 - bad request - request body too large", http.StatusBadRequest)
+		return
+	}
+	var root anyElem
+	if err := xml.Unmarshal(buf, &root); err != nil {
+		http.Error(w, "400 - bad request - parsing xml request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+
+	switch root.XMLName {
+	case xml.Name{Space: nsCardDAV, Local: "addressbook-multiget"}:
+		req.multiget(w, r)
+	case xml.Name{Space: nsCardDAV, Local: "addressbook-query"}:
+		req.query(w, r)
+	default:
+		writeError(w, http.StatusForbidden, "<D:supported-report/>")
+	}
+}
+
+func (req request) multiget(w http.ResponseWriter, r *http.Request) {
+	var mg multigetRequest
+	if _, err := readXML(r, &mg); err != nil {
+		http.Error(w, "400 - bad request - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var names []xml.Name
+	if mg.AllProp == nil {
+		names = requestedNames(mg.Prop)
+	}
+
+	var ms multistatus
+	err := req.acc.DB.Read(req.ctx, func(tx *bstore.Tx) error {
+		for _, href := range mg.Hrefs {
+			var name string
+			k := kindNone
+			if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+				if p, ok := strings.CutPrefix(u.Path, req.davPath); ok {
+					k, name = parsePath(p)
+				}
+			}
+			var c store.Contact
+			var ok bool
+			if k == kindContact {
+				var err error
+				c, ok, err = req.lookup(tx, name)
+				if err != nil {
+					return err
+				}
+			}
+			if !ok {
+				ms.Responses = append(ms.Responses, response{Href: href, Status: statusLine(http.StatusNotFound)})
+				continue
+			}
+			ms.Responses = append(ms.Responses, req.response(kindContact, &c, 0, names, false))
+		}
+		return nil
+	})
+	if err != nil {
+		req.httpError(w, "fetching contacts", err)
+		return
+	}
+	err = writeMultistatus(w, ms)
+	req.log.Check(err, "writing multiget response")
+}
+
+func (req request) query(w http.ResponseWriter, r *http.Request) {
+	var q queryRequest
+	if _, err := readXML(r, &q); err != nil {
+		http.Error(w, "400 - bad request - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var names []xml.Name
+	if q.AllProp == nil {
+		names = requestedNames(q.Prop)
+	}
+	for _, pf := range q.Filter.PropFilters {
+		if len(pf.ParamFilters) > 0 {
+			writeError(w, http.StatusForbidden, "<C:supported-filter/>")
+			return
+		}
+		for _, tm := range pf.TextMatches {
+			if tm.Collation != "" && tm.Collation != "i;unicode-casemap" && tm.Collation != "i;octet" {
+				writeError(w, http.StatusForbidden, "<C:supported-collation/>")
+				return
+			}
+		}
+	}
+	limit := -1
+	if q.Limit != nil && q.Limit.NResults > 0 {
+		limit = q.Limit.NResults
+	}
+
+	var ms multistatus
+	var truncated bool
+	err := req.acc.DB.Read(req.ctx, func(tx *bstore.Tx) error {
+		return bstore.QueryTx[store.Contact](tx).ForEach(func(c store.Contact) error {
+			card, err := vcard.Parse(c.VCard)
+			if err != nil {
+				req.log.Errorx("parsing stored vcard", err)
+				return nil
+			}
+			if !q.Filter.match(card) {
+				return nil
+			}
+			if limit >= 0 && len(ms.Responses) >= limit {
+				truncated = true
+				return bstore.StopForEach
+			}
+			ms.Responses = append(ms.Responses, req.response(kindContact, &c, 0, names, false))
+			return nil
+		})
+	})
+	if err != nil {
+		req.httpError(w, "searching contacts", err)
+		return
+	}
+	if truncated {
+		ms.Responses = append(ms.Responses, response{Href: req.href(kindAddressBook, ""), Status: statusLine(http.StatusInsufficientStorage)})
+	}
+	err = writeMultistatus(w, ms)
+	req.log.Check(err, "writing query response")
+}
+
+// match returns whether a card matches the filter. A filter without prop-filters
+// matches all cards.
+func (f filter) match(card *vcard.Card) bool {
+	if len(f.PropFilters) == 0 {
+		return true
+	}
+	allof := f.Test == "allof"
+	for _, pf := range f.PropFilters {
+		m := pf.match(card)
+		if m && !allof {
+			return true
+		} else if !m && allof {
+			return false
+		}
+	}
+	return allof
+}
+
+func (pf propFilter) match(card *vcard.Card) bool {
+	values := card.Texts(strings.ToUpper(pf.Name))
+	if pf.IsNotDefined != nil {
+		return len(values) == 0
+	}
+	if len(pf.TextMatches) == 0 {
+		return len(values) > 0
+	}
+	allof := pf.Test == "allof"
+	for _, tm := range pf.TextMatches {
+		var m bool
+		for _, v := range values {
+			if tm.match(v) {
+				m = true
+				break
+			}
+		}
+		if tm.NegateCondition == "yes" {
+			m = !m
+		}
+		if m && !allof {
+			return true
+		} else if !m && allof {
+			return false
+		}
+	}
+	return allof
+}
+
+func (tm textMatch) match(s string) bool {
+	v := tm.Value
+	if tm.Collation != "i;octet" {
+		s = strings.ToLower(s)
+		v = strings.ToLower(v)
+	}
+	switch tm.MatchType {
+	case "equals":
+		return s == v
+	case "starts-with":
+		return strings.HasPrefix(s, v)
+	case "ends-with":
+		return strings.HasSuffix(s, v)
+	default:
+		return strings.Contains(s, v)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/qompassai/beacon/autotls"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/dnssec"
 	"github.com/qompassai/beacon/junk"
 	"github.com/qompassai/beacon/mtasts"
 	"github.com/qompassai/beacon/smtp"
@@ -73,6 +74,17 @@ type Static struct {
 	OutgoingTLSReportsForAllSuccess bool  `sconf:"optional" sconf-doc:"Also send TLS reports if there were no SMTP STARTTLS connection failures. By default, reports are only sent when at least one failure occurred. If a report is sent, it does always include the successful connection counts as well."`
 	QuotaMessageSize                int64 `sconf:"optional" sconf-doc:"Default maximum total message size for accounts, only applicable if greater than zero. Can be overridden per account. Attempting to add new messages beyond the maximum size will result in an error. Useful to prevent a single account from filling storage. The quota only applies to the email message files, not to any file system overhead and also not the message index database file (account for approximately 15% overhead)."`
 
+	ARCTrustedSealers       []string     `sconf:"optional" sconf-doc:"Domains of ARC sealers (RFC 8617) that are trusted, typically mailing lists and forwarding services. Intermediaries like these modify messages, which breaks DKIM signatures, and send from their own IPs, which breaks SPF. If an incoming message has a valid ARC chain with the most recent ARC-Seal from a trusted sealer, a failing DMARC policy is not enforced, and the IP, EHLO and MAIL FROM domain of the sealer are not used for reputation-based junk classification, as for forwarded messages through rulesets with IsForward. The ARC verification result is always added to the Authentication-Results header."`
+	ARCTrustedSealerDomains []dns.Domain `sconf:"-" json:"-"` // Parsed form of ARCTrustedSealers.
+
+	DMARCFailureReports *DMARCFailureReports `sconf:"optional" sconf-doc:"If set, DMARC failure reports (RFC 6591), also known as forensic reports, are sent for incoming messages that fail DMARC, to domains that request them with the ruf field in their DMARC record. The fo field of the DMARC record determines which failures are reported. Recipient addresses are redacted from reports. Reports are rate-limited, and are not sent if NoOutgoingDMARCReports is set. Reports are sent from the postmaster@<mailhostname> address."`
+
+	Quarantine *Quarantine `sconf:"optional" sconf-doc:"If set, suspicious incoming messages are kept in a central quarantine, instead of in the Rejects mailbox of the account or instead of being delivered. Admins can search, inspect, release or delete quarantined messages in the admin web interface, and users can do the same for their own messages in the account web interface. Users periodically receive a digest message listing their newly quarantined messages."`
+
+	DNSBLServer *DNSBLServer `sconf:"optional" sconf-doc:"If set, a built-in DNS server answers DNSBL queries (RFC 5782) for IPs of remote mail servers with a bad reputation in the accounts of this instance. Other mail servers, such as other beacon instances, can add the zone to the DNSBLs of their SMTP listeners. IPs are listed based on incoming messages that were marked as junk and that were rejected, across all accounts, with the weight of messages decaying over time."`
+
+	DNSResolver *DNSResolver `sconf:"optional" sconf-doc:"If set, DNS requests are sent to these upstream resolvers over DNS-over-TLS or DNS-over-HTTPS instead of to the system resolver configured in /etc/resolv.conf, and DNSSEC signatures are verified by beacon itself instead of trusting the 'authentic data' bit in responses from the resolver. DANE requires DNSSEC, and DNSSEC makes MTA-STS, SPF, DKIM and DMARC lookups more secure. Useful on systems without a local DNSSEC-verifying resolver."`
+
 	// All IPs that were explicitly listen on for external SMTP. Only set when there
 	// are no unspecified external SMTP listeners and there is at most one for IPv4 and
 	// at most one for IPv6. Used for setting the local address when making outgoing
@@ -152,8 +164,13 @@ type Listener struct {
 
 		DNSBLs []string `sconf:"optional" sconf-doc:"Addresses of DNS block lists for incoming messages. Block lists are only consulted for connections/messages without enough reputation to make an accept/reject decision. This prevents sending IPs of all communications to the block list provider. If any of the listed DNSBLs contains a requested IP address, the message is rejected as spam. The DNSBLs are checked for healthiness before use, at most once per 4 hours. Example DNSBLs: sbl.spamhaus.org, bl.spamcop.net. See https://www.spamhaus.org/sbl/ and https://www.spamcop.net/ for more information and terms of use."`
 
+		DomainBLs []DomainBL `sconf:"optional" sconf-doc:"Domain-based DNS block lists (RHSBLs) for incoming messages, e.g. dbl.spamhaus.org. The organizational domains of the EHLO hostname, SMTP MAIL FROM, message From header and DKIM signatures are looked up. Like DNSBLs, these lists are only consulted for messages without enough reputation, and are checked for healthiness before use. The weights of listings in DomainBLs and URIBLs are added up, and a message is rejected as spam if the sum is at least 1. Listings are recorded in the Authentication-Results header."`
+		URIBLs    []DomainBL `sconf:"optional" sconf-doc:"Domain-based DNS block lists for the domains of links in incoming messages (URIBLs), e.g. multi.surbl.org. The organizational domains of http and https links in the text and html parts of a message are looked up, at most 20. Otherwise like DomainBLs."`
+
 		FirstTimeSenderDelay *time.Duration `sconf:"optional" sconf-doc:"Delay before accepting a message from a first-time sender for the destination account. Default: 15s."`
 
+		Greylisting *Greylisting `sconf:"optional" sconf-doc:"If set, incoming messages from senders without reputation whose content the junk filter cannot classify as ham are greylisted: the first delivery attempt for a combination of remote IP network, SMTP MAIL FROM and RCPT TO is rejected with a temporary failure. Legitimate mail servers retry later, while many spam-sending botnets do not. Senders with an SPF- or DKIM-verified domain that has passed greylisting before or that has a good reputation are not greylisted."`
+
 		DNSBLZones []dns.Domain `sconf:"-"`
 	} `sconf:"optional"`
 	Submission struct {
@@ -165,6 +182,8 @@ type Listener struct {
 		Enabled bool
 		Port    int `sconf:"optional" sconf-doc:"Default 465."`
 	} `sconf:"optional" sconf-doc:"SMTP over TLS for submitting email, by email applications. Requires a TLS config."`
+	ContentScans []ContentScan `sconf:"optional" sconf-doc:"External content scanners, e.g. an antivirus scanner or data loss prevention check, called in order for each message received over SMTP on this listener, both for incoming deliveries and for submissions. Messages are scanned after the DATA command, before delivery or queueing. Scanners can accept, reject or temporarily fail a message, quarantine it to a mailbox, and add headers."`
+
 	IMAP struct {
 		Enabled           bool
 		Port              int  `sconf:"optional" sconf-doc:"Default 143."`
@@ -174,7 +193,7 @@ type Listener struct {
 		Enabled bool
 		Port    int `sconf:"optional" sconf-doc:"Default 993."`
 	} `sconf:"optional" sconf-doc:"IMAP over TLS for reading email, by email applications. Requires a TLS config."`
-	AccountHTTP  WebService `sconf:"optional" sconf-doc:"Account web interface, for email users wanting to change their accounts, e.g. set new password, set new delivery rulesets. Default path is /."`
+	AccountHTTP  WebService `sconf:"optional" sconf-doc:"Account web interface, for email users wanting to change their accounts, e.g. set new password, set new delivery rulesets. Default path is /. Contacts are served over CardDAV at dav/ below the path, with a redirect from /.well-known/carddav."`
 	AccountHTTPS WebService `sconf:"optional" sconf-doc:"Account web interface listener like AccountHTTP, but for HTTPS. Requires a TLS config."`
 	AdminHTTP    WebService `sconf:"optional" sconf-doc:"Admin web interface, for managing domains, accounts, etc. Default path is /admin/. Preferably only enable on non-public IPs. Hint: use 'ssh -L 8080:localhost:80 you@yourmachine' and open http://localhost:8080/admin/, or set up a tunnel (e.g. WireGuard) and add its IP to the beacon 'internal' listener."`
 	AdminHTTPS   WebService `sconf:"optional" sconf-doc:"Admin web interface listener like AdminHTTP, but for HTTPS. Requires a TLS config."`
@@ -261,20 +280,33 @@ type TransportSocks struct {
 }
 
 type Domain struct {
-	Description                string  `sconf:"optional" sconf-doc:"Free-form description of domain."`
-	ClientSettingsDomain       string  `sconf:"optional" sconf-doc:"Hostname for client settings instead of the mail server hostname. E.g. mail.<domain>. For future migration to another mail operator without requiring all clients to update their settings, it is convenient to have client settings that reference a subdomain of the hosted domain instead of the hostname of the server where the mail is currently hosted. If empty, the hostname of the mail server is used for client configurations."`
-	LocalpartCatchallSeparator string  `sconf:"optional" sconf-doc:"If not empty, only the string before the separator is used to for email delivery decisions. For example, if set to \"+\", you+anything@example.com will be delivered to you@example.com."`
-	LocalpartCaseSensitive     bool    `sconf:"optional" sconf-doc:"If set, upper/lower case is relevant for email delivery."`
-	DKIM                       DKIM    `sconf:"optional" sconf-doc:"With DKIM signing, a domain is taking responsibility for (content of) emails it sends, letting receiving mail servers build up a (hopefully positive) reputation of the domain, which can help with mail delivery."`
-	DMARC                      *DMARC  `sconf:"optional" sconf-doc:"With DMARC, a domain publishes, in DNS, a policy on how other mail servers should handle incoming messages with the From-header matching this domain and/or subdomain (depending on the configured alignment). Receiving mail servers use this to build up a reputation of this domain, which can help with mail delivery. A domain can also publish an email address to which reports about DMARC verification results can be sent by verifying mail servers, useful for monitoring. Incoming DMARC reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
-	MTASTS                     *MTASTS `sconf:"optional" sconf-doc:"With MTA-STS a domain publishes, in DNS, presence of a policy for using/requiring TLS for SMTP connections. The policy is served over HTTPS."`
-	TLSRPT                     *TLSRPT `sconf:"optional" sconf-doc:"With TLSRPT a domain specifies in DNS where reports about encountered SMTP TLS behaviour should be sent. Useful for monitoring. Incoming TLS reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
-	Routes                     []Route `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates account routes, these domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
+	Description                string     `sconf:"optional" sconf-doc:"Free-form description of domain."`
+	ClientSettingsDomain       string     `sconf:"optional" sconf-doc:"Hostname for client settings instead of the mail server hostname. E.g. mail.<domain>. For future migration to another mail operator without requiring all clients to update their settings, it is convenient to have client settings that reference a subdomain of the hosted domain instead of the hostname of the server where the mail is currently hosted. If empty, the hostname of the mail server is used for client configurations."`
+	LocalpartCatchallSeparator string     `sconf:"optional" sconf-doc:"If not empty, only the string before the separator is used to for email delivery decisions. For example, if set to \"+\", you+anything@example.com will be delivered to you@example.com."`
+	LocalpartCaseSensitive     bool       `sconf:"optional" sconf-doc:"If set, upper/lower case is relevant for email delivery."`
+	DKIM                       DKIM       `sconf:"optional" sconf-doc:"With DKIM signing, a domain is taking responsibility for (content of) emails it sends, letting receiving mail servers build up a (hopefully positive) reputation of the domain, which can help with mail delivery."`
+	DMARC                      *DMARC     `sconf:"optional" sconf-doc:"With DMARC, a domain publishes, in DNS, a policy on how other mail servers should handle incoming messages with the From-header matching this domain and/or subdomain (depending on the configured alignment). Receiving mail servers use this to build up a reputation of this domain, which can help with mail delivery. A domain can also publish an email address to which reports about DMARC verification results can be sent by verifying mail servers, useful for monitoring. Incoming DMARC reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
+	MTASTS                     *MTASTS    `sconf:"optional" sconf-doc:"With MTA-STS a domain publishes, in DNS, presence of a policy for using/requiring TLS for SMTP connections. The policy is served over HTTPS."`
+	TLSRPT                     *TLSRPT    `sconf:"optional" sconf-doc:"With TLSRPT a domain specifies in DNS where reports about encountered SMTP TLS behaviour should be sent. Useful for monitoring. Incoming TLS reports are automatically parsed, validated, added to metrics and stored in the reporting database for later display in the admin web pages."`
+	Routes                     []Route    `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates account routes, these domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
+	DNSUpdate                  *DNSUpdate `sconf:"optional" sconf-doc:"For updating the DNS records required for this domain on an authoritative name server with dynamic updates (RFC 2136), authenticated with TSIG. The records are only updated when explicitly requested, e.g. through the admin web interface or \"beacon config dnssync\"."`
 
 	Domain                  dns.Domain `sconf:"-" json:"-"`
 	ClientSettingsDNSDomain dns.Domain `sconf:"-" json:"-"`
 }
 
+type DNSUpdate struct {
+	Server        string `sconf-doc:"Address of the primary name server accepting dynamic updates for the zone, as host:port. If no port is specified, port 53 is used. Updates are sent over TCP."`
+	Zone          string `sconf:"optional" sconf-doc:"Name of the zone to update. Only records in this zone are updated, other records must be managed manually. If empty, the domain itself is used."`
+	TSIGKeyName   string `sconf-doc:"Name of the TSIG key as configured in the name server."`
+	TSIGAlgorithm string `sconf:"optional" sconf-doc:"TSIG algorithm: hmac-sha256 (default), hmac-sha384 or hmac-sha512."`
+	TSIGSecret    string `sconf-doc:"Base64-encoded shared secret of the TSIG key."`
+	TTL           int    `sconf:"optional" sconf-doc:"TTL in seconds for added records. Default 300."`
+
+	DNSZone dns.Domain `sconf:"-" json:"-"`
+	Secret  []byte     `sconf:"-" json:"-"`
+}
+
 type DMARC struct {
 	Localpart string `sconf-doc:"Address-part before the @ that accepts DMARC reports. Must be non-internationalized. Recommended value: dmarc-reports."`
 	Domain    string `sconf:"optional" sconf-doc:"Alternative domain for report recipient address. Can be used to receive reports for other domains. Unicode name."`
@@ -324,6 +356,7 @@ type Selector struct {
 type DKIM struct {
 	Selectors map[string]Selector `sconf-doc:"Emails can be DKIM signed. Config parameters are per selector. A DNS record must be created for each selector. Add the name to Sign to use the selector for signing messages."`
 	Sign      []string            `sconf:"optional" sconf-doc:"List of selectors that emails will be signed with."`
+	ARCSeal   string              `sconf:"optional" sconf-doc:"Selector to add ARC (RFC 8617) sets with when messages are relayed, e.g. a received message that is submitted again for forwarding. A message is considered relayed if it already has Authentication-Results or ARC headers. The ARC set is added for messages submitted by accounts with this domain as their configured domain, records the SPF, DKIM and DMARC results from when this server received the message and the status of the existing ARC chain, and lets receivers that trust this domain as sealer use the results. If empty, messages are not ARC-sealed."`
 }
 
 type Route struct {
@@ -358,10 +391,13 @@ type Account struct {
 		NeutralMailboxRegexp string `sconf:"optional" sconf-doc:"Example: ^(inbox|neutral|postmaster|dmarc|tlsrpt|rejects), and you may wish to add trash depending on how you use it, or leave this empty."`
 		NotJunkMailboxRegexp string `sconf:"optional" sconf-doc:"Example: .* or an empty string."`
 	} `sconf:"optional" sconf-doc:"Automatically set $Junk and $NotJunk flags based on mailbox messages are delivered/moved/copied to. Email clients typically have too limited functionality to conveniently set these flags, especially $NonJunk, but they can all move messages to a different mailbox, so this helps them."`
-	JunkFilter                   *JunkFilter `sconf:"optional" sconf-doc:"Content-based filtering, using the junk-status of individual messages to rank words in such messages as spam or ham. It is recommended you always set the applicable (non)-junk status on messages, and that you do not empty your Trash because those messages contain valuable ham/spam training information."` // todo: sane defaults for junkfilter
-	MaxOutgoingMessagesPerDay    int         `sconf:"optional" sconf-doc:"Maximum number of outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 1000."`
-	MaxFirstTimeRecipientsPerDay int         `sconf:"optional" sconf-doc:"Maximum number of first-time recipients in outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 200."`
-	Routes                       []Route     `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates these account routes, domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
+	JunkFilter                   *JunkFilter    `sconf:"optional" sconf-doc:"Content-based filtering, using the junk-status of individual messages to rank words in such messages as spam or ham. It is recommended you always set the applicable (non)-junk status on messages, and that you do not empty your Trash because those messages contain valuable ham/spam training information."` // todo: sane defaults for junkfilter
+	MaxOutgoingMessagesPerDay    int            `sconf:"optional" sconf-doc:"Maximum number of outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 1000."`
+	MaxFirstTimeRecipientsPerDay int            `sconf:"optional" sconf-doc:"Maximum number of first-time recipients in outgoing messages for this account in a 24 hour window. This limits the damage to recipients and the reputation of this mail server in case of account compromise. Default 200."`
+	RequireTOTP                  bool           `sconf:"optional" sconf-doc:"Require two-factor authentication with time-based one-time passwords (TOTP) from an authenticator app for logging in to the webmail and account web interfaces. Until the user has enrolled an authenticator app, only a login to the account web interface is allowed, for enrolling. IMAP, SMTP submission and CardDAV only accept app passwords, not the account password. App passwords are managed in the account web interface."`
+	TLSPublicKeys                []TLSPublicKey `sconf:"optional" sconf-doc:"Public keys of TLS client certificates that can authenticate as this account with SASL mechanism EXTERNAL, on IMAP and SMTP submission listeners with TLS ClientAuth enabled. Can be managed in the account web interface."`
+	LoginLockout                 *LoginLockout  `sconf:"optional" sconf-doc:"Block authentication for this account after too many consecutive failed authentication attempts, from any IP address. For IMAP, SMTP submission and the web interfaces. Failed attempts are always rate limited per IP address, this protects against attacks from many IP addresses. Blocks can be removed in the admin web interface."`
+	Routes                       []Route        `sconf:"optional" sconf-doc:"Routes for delivering outgoing messages through the queue. Each delivery attempt evaluates these account routes, domain routes and finally global routes. The transport of the first matching route is used in the delivery attempt. If no routes match, which is the default with no configured routes, messages are delivered directly from the queue."`
 
 	DNSDomain      dns.Domain     `sconf:"-"` // Parsed form of Domain.
 	JunkMailbox    *regexp.Regexp `sconf:"-" json:"-"`
@@ -369,6 +405,17 @@ type Account struct {
 	NotJunkMailbox *regexp.Regexp `sconf:"-" json:"-"`
 }
 
+type TLSPublicKey struct {
+	Name         string `sconf-doc:"Description of the key, e.g. the host or application using it."`
+	Fingerprint  string `sconf-doc:"SHA-256 hash of the DER-encoded SubjectPublicKeyInfo of the certificate, in lower case hex. For example the output of: openssl x509 -in cert.pem -noout -pubkey | openssl pkey -pubin -outform der | sha256sum"`
+	LoginAddress string `sconf-doc:"Email address of the account to use as login address, e.g. for checking message From addresses in SMTP submission. Must be a destination address of the account."`
+}
+
+type LoginLockout struct {
+	MaxFailures int           `sconf-doc:"Number of consecutive failed authentication attempts after which authentication is blocked. A successful login resets the count."`
+	Period      time.Duration `sconf:"optional" sconf-doc:"How long authentication is blocked. Default 1h."`
+}
+
 type JunkFilter struct {
 	Threshold float64 `sconf-doc:"Approximate spaminess score between 0 and 1 above which emails are rejected as spam. Each delivery attempt adds a little noise to make it slightly harder for spammers to identify words that strongly indicate non-spaminess and use it to bypass the filter. E.g. 0.95."`
 	junk.Params
@@ -432,14 +479,101 @@ type KeyCert struct {
 	KeyFile  string `sconf-doc:"Private key for certificate, in PEM format. PKCS8 is recommended, but PKCS1 and EC private keys are recognized as well."`
 }
 
+// DMARCFailureReports configures sending DMARC failure reports for incoming
+// messages.
+type DMARCFailureReports struct {
+	IncludeBody bool `sconf:"optional" sconf-doc:"Include the full message in failure reports. By default, only the message headers are included. Messages larger than 1MB, and messages that require SMTPUTF8, are always reported with headers only."`
+	MaxPerHour  int  `sconf:"optional" sconf-doc:"Maximum number of failure reports sent per hour per reporting address. Default 10."`
+}
+
+// Quarantine configures the central quarantine for incoming messages.
+type Quarantine struct {
+	Reasons        []string             `sconf:"optional" sconf-doc:"Reasons for quarantining messages. Messages rejected because the remote IP is on a DNS blocklist (dnsbl) or because the junk filter classified them as spam (junk) are still rejected during the SMTP transaction, but are kept in the quarantine instead of in the Rejects mailbox of the account. Messages quarantined by a content scanner (contentscan) or matching a hold rule (hold) are accepted, and kept in the quarantine instead of being delivered. Default: dnsbl, junk, contentscan and hold."`
+	HoldRules      []QuarantineHoldRule `sconf:"optional" sconf-doc:"Rules for holding incoming messages in the quarantine. A message that would otherwise be delivered is held if all conditions of a rule match."`
+	Retention      time.Duration        `sconf:"optional" sconf-doc:"How long messages are kept in the quarantine before they are removed. Default 720h (30 days)."`
+	DigestInterval time.Duration        `sconf:"optional" sconf-doc:"Minimum time between digest messages to an account, listing its newly quarantined messages. Default 24h."`
+	NoDigests      bool                 `sconf:"optional" sconf-doc:"Do not send digest messages to accounts."`
+	AccountURL     string               `sconf:"optional" sconf-doc:"URL of the account web interface, for links to quarantined messages in digests, e.g. https://mail.example.com/. If empty, the URL is composed of the host name and path of the first listener (by name) with the account web interface enabled over HTTPS. If no such listener exists, digests do not contain links."`
+}
+
+// DNSBLServer configures the built-in DNS server for a DNS block list with IPs of
+// remote mail servers with a bad reputation.
+type DNSBLServer struct {
+	Zone            string        `sconf-doc:"DNS zone of the block list, e.g. dnsbl.example.com. The zone must be delegated to this server with NS records in the parent zone, or be configured as forward zone in the resolvers of the mail servers using the block list."`
+	IPs             []string      `sconf-doc:"IPs to listen on for DNS requests, over UDP and TCP."`
+	Port            int           `sconf:"optional" sconf-doc:"Port to listen on. Default 53."`
+	JunkThreshold   float64       `sconf:"optional" sconf-doc:"Minimum weighted number of messages from an IP that were marked as junk, across all accounts, for the IP to be listed. Default 3."`
+	RejectThreshold float64       `sconf:"optional" sconf-doc:"Minimum weighted number of messages from an IP that were rejected as junk during SMTP, for the IP to be listed. Only rejects because of junk content are counted, and retried deliveries of the same message are counted once. Default 5."`
+	MaxHamFraction  float64       `sconf:"optional" sconf-doc:"IPs are not listed if the weighted number of messages from the IP that were marked as non-junk is more than this fraction of all marked and rejected messages from the IP. Default 0.1."`
+	HalfLife        time.Duration `sconf:"optional" sconf-doc:"Period after which the weight of a message is halved. Messages older than 8 half-lives are ignored. Default 168h (7 days)."`
+	Allow           []string      `sconf:"optional" sconf-doc:"IPs and networks in CIDR notation that are never listed, e.g. of mail servers of your organization."`
+	Explanation     string        `sconf:"optional" sconf-doc:"Explanation returned in the TXT record for a listed IP. Default: Listed for junk reputation at <hostname>."`
+	RefreshInterval time.Duration `sconf:"optional" sconf-doc:"Interval for recomputing the listed IPs from the account databases. Default 15m."`
+
+	ZoneDomain dns.Domain  `sconf:"-" json:"-"`
+	AllowNets  []net.IPNet `sconf:"-" json:"-"`
+}
+
+// DNSResolver configures upstream resolvers, with DNSSEC verification by beacon.
+type DNSResolver struct {
+	Upstreams    []string `sconf-doc:"Upstream recursive resolvers, tried in order. Either DNS-over-TLS (RFC 7858) as tls://host or tls://host:port (default port 853), or DNS-over-HTTPS (RFC 8484) as https URL, e.g. https://dns.example/dns-query. TLS certificates of the resolvers are verified. Host names of upstream resolvers are resolved with the system resolver, use IP addresses to prevent depending on it."`
+	TrustAnchors []string `sconf:"optional" sconf-doc:"DS records for the root zone to use as DNSSEC trust anchors, as key tag, algorithm, digest type and hexadecimal digest, e.g. '20326 8 2 E06D44B8...'. Default: the root zone key signing keys published by IANA, KSK-2017 (key tag 20326) and KSK-2024 (key tag 38696)."`
+	CacheSize    int      `sconf:"optional" sconf-doc:"Maximum number of DNS responses to cache. Default 10000."`
+
+	Resolver *dnssec.Resolver `sconf:"-" json:"-"`
+}
+
+// QuarantineHoldRule matches incoming messages to hold in the quarantine.
+type QuarantineHoldRule struct {
+	SMTPMailFromRegexp string            `sconf:"optional" sconf-doc:"Matches if this regular expression matches (a substring of) the SMTP MAIL FROM address. E.g. '@example\\.org$'."`
+	RcptToRegexp       string            `sconf:"optional" sconf-doc:"Matches if this regular expression matches (a substring of) the SMTP RCPT TO address. E.g. '^finance@'."`
+	HeadersRegexp      map[string]string `sconf:"optional" sconf-doc:"Matches if these header field/value regular expressions all match (substrings of) the message headers. Header fields and values are converted to lower case before matching, and whitespace is trimmed from values, as with rulesets."`
+
+	SMTPMailFromRegexpCompiled *regexp.Regexp      `sconf:"-" json:"-"`
+	RcptToRegexpCompiled       *regexp.Regexp      `sconf:"-" json:"-"`
+	HeadersRegexpCompiled      [][2]*regexp.Regexp `sconf:"-" json:"-"`
+}
+
+// ContentScan configures an external scanner for messages received over SMTP.
+type ContentScan struct {
+	Name              string        `sconf:"optional" sconf-doc:"Name of the scanner, for logging and metrics. Default is the kind of scanner: milter, http or command."`
+	Milter            string        `sconf:"optional" sconf-doc:"Address of a milter (mail filter, as used by sendmail and postfix), as inet:host:port for TCP or unix:/path/to/socket for a unix domain socket. The milter can add headers and quarantine messages. Exactly one of Milter, HTTP and Command must be set."`
+	HTTP              string        `sconf:"optional" sconf-doc:"URL to which the message is sent in a POST request with content-type message/rfc822. The envelope is in request headers X-Beacon-Mail-From, X-Beacon-Rcpt-To (once for each recipient), X-Beacon-Remote-IP, X-Beacon-Helo, X-Beacon-Submission (yes or no), X-Beacon-Account (for submissions) and X-Beacon-Queue-ID (as in the Received header). The response must have status 200 and a JSON verdict: an object with field Action (accept, reject, tempfail or quarantine), and optional fields Code (SMTP reply code, e.g. 550), EnhancedCode (e.g. 5.7.1), Message (SMTP reply text), Mailbox (for quarantine) and Headers (list of objects with fields Name and Value, added to the message)."`
+	Command           []string      `sconf:"optional" sconf-doc:"Command and arguments to execute, with the message on standard input. The envelope is in environment variables BEACON_MAIL_FROM, BEACON_RCPT_TO (space-separated), BEACON_REMOTE_IP, BEACON_HELO, BEACON_SUBMISSION (yes or no), BEACON_ACCOUNT and BEACON_QUEUE_ID. Exit status 0 accepts the message, 1 rejects it, 75 (EX_TEMPFAIL) fails it temporarily, any other status is a scanner failure. For exit status 1 and 75, the first line of standard output is used in the SMTP reply. For exit status 0, non-empty standard output must be a JSON verdict, as for HTTP."`
+	Timeout           time.Duration `sconf:"optional" sconf-doc:"Maximum duration of a scan. Default 1m."`
+	FailClosed        bool          `sconf:"optional" sconf-doc:"If the scanner fails or times out, temporarily reject the message. By default, a failure is logged and the message is handled as if the scanner accepted it (fail open)."`
+	QuarantineMailbox string        `sconf:"optional" sconf-doc:"Mailbox for quarantined messages, if the verdict does not specify a mailbox. For incoming messages, the mailbox is in the account of the recipient, for submissions in the account of the sender and the message is not sent. Incoming messages are kept in the central quarantine instead if it is configured with reason contentscan. Default Quarantine."`
+	NoIncoming        bool          `sconf:"optional" sconf-doc:"Do not scan incoming messages, only submissions."`
+	NoSubmission      bool          `sconf:"optional" sconf-doc:"Do not scan submissions, only incoming messages."`
+}
+
+// Greylisting configures temporary rejection of first delivery attempts for
+// incoming messages.
+type Greylisting struct {
+	Delay  time.Duration `sconf:"optional" sconf-doc:"Minimum time before a retried delivery attempt is accepted. Default 5m."`
+	Expiry time.Duration `sconf:"optional" sconf-doc:"How long a combination of remote IP network, MAIL FROM and RCPT TO is remembered after its last delivery attempt. Also the time within which a sender must retry before greylisting starts over, and how long sender domains that passed greylisting are remembered. Default 840h (35 days)."`
+}
+
+type DomainBL struct {
+	Zone        string   `sconf-doc:"Zone of the block list, e.g. dbl.spamhaus.org."`
+	Identities  []string `sconf:"optional" sconf-doc:"Domains of a message to look up: ehlo, mailfrom, from and/or dkim. Default all. Only for DomainBLs, not URIBLs."`
+	ReturnCodes []string `sconf:"optional" sconf-doc:"Addresses returned by the block list that indicate a listing, as IP addresses or networks in CIDR notation, e.g. 127.0.1.2 or 127.0.1.0/24. Block lists often return different addresses depending on the reason for a listing, see the documentation of the block list. Default: any address in 127.0.0.0/8, except 127.255.255.0/24, which block lists use to indicate errors such as refused queries."`
+	Weight      float64  `sconf:"optional" sconf-doc:"Weight of a listing. A message is rejected if the sum of the weights of its listings is at least 1. Default 1."`
+
+	ZoneDomain dns.Domain  `sconf:"-" json:"-"`
+	ReturnNets []net.IPNet `sconf:"-" json:"-"`
+}
+
 type TLS struct {
 	ACME                string    `sconf:"optional" sconf-doc:"Name of provider from top-level configuration to use for ACME, e.g. letsencrypt."`
 	KeyCerts            []KeyCert `sconf:"optional" sconf-doc:"Keys and certificates to use for this listener. The files are opened by the privileged root process and passed to the unprivileged beacon process, so no special permissions are required on the files. If the private key will not be replaced when refreshing certificates, also consider adding the private key to HostPrivateKeyFiles and configuring DANE TLSA DNS records."`
 	MinVersion          string    `sconf:"optional" sconf-doc:"Minimum TLS version. Default: TLSv1.2."`
+	ClientAuth          bool      `sconf:"optional" sconf-doc:"Request TLS client certificates on IMAP and SMTP submission connections. Certificates are not verified against a certificate authority. Instead, the SHA-256 fingerprint of the public key of the certificate is matched against the TLS public keys registered with accounts. A connection with a matching certificate can authenticate without password with SASL mechanism EXTERNAL."`
 	HostPrivateKeyFiles []string  `sconf:"optional" sconf-doc:"Private keys used for ACME certificates. Specified explicitly so DANE TLSA DNS records can be generated, even before the certificates are requested. DANE is a mechanism to authenticate remote TLS certificates based on a public key or certificate specified in DNS, protected with DNSSEC. DANE is opportunistic and attempted when delivering SMTP with STARTTLS. The private key files must be in PEM format. PKCS8 is recommended, but PKCS1 and EC private keys are recognized as well. Only RSA 2048 bit and ECDSA P-256 keys are currently used. The first of each is used when requesting new certificates through ACME."`
 
 	Config                   *tls.Config     `sconf:"-" json:"-"` // TLS config for non-ACME-verification connections, i.e. SMTP and IMAP, and not port 443.
 	ACMEConfig               *tls.Config     `sconf:"-" json:"-"` // TLS config that handles ACME verification, for serving on port 443.
+	ClientAuthConfig         *tls.Config     `sconf:"-" json:"-"` // Like Config, but requesting client certificates, for IMAP and SMTP submission. Only set if ClientAuth is enabled.
 	HostPrivateRSA2048Keys   []crypto.Signer `sconf:"-" json:"-"` // Private keys for new TLS certificates for listener host name, for new certificates with ACME, and for DANE records.
 	HostPrivateECDSAP256Keys []crypto.Signer `sconf:"-" json:"-"`
 }
@@ -175,6 +175,14 @@ describe-static" and "beacon config describe-domains":
 				# Minimum TLS version. Default: TLSv1.2. (optional)
 				MinVersion:
 
+				# Request TLS client certificates on IMAP and SMTP submission connections.
+				# Certificates are not verified against a certificate authority. Instead, the
+				# SHA-256 fingerprint of the public key of the certificate is matched against the
+				# TLS public keys registered with accounts. A connection with a matching
+				# certificate can authenticate without password with SASL mechanism EXTERNAL.
+				# (optional)
+				ClientAuth: false
+
 				# Private keys used for ACME certificates. Specified explicitly so DANE TLSA DNS
 				# records can be generated, even before the certificates are requested. DANE is a
 				# mechanism to authenticate remote TLS certificates based on a public key or
@@ -224,10 +232,87 @@ describe-static" and "beacon config describe-domains":
 				DNSBLs:
 					-
 
+				# Domain-based DNS block lists (RHSBLs) for incoming messages, e.g.
+				# dbl.spamhaus.org. The organizational domains of the EHLO hostname, SMTP MAIL
+				# FROM, message From header and DKIM signatures are looked up. Like DNSBLs, these
+				# lists are only consulted for messages without enough reputation, and are checked
+				# for healthiness before use. The weights of listings in DomainBLs and URIBLs are
+				# added up, and a message is rejected as spam if the sum is at least 1. Listings
+				# are recorded in the Authentication-Results header. (optional)
+				DomainBLs:
+					-
+
+						# Zone of the block list, e.g. dbl.spamhaus.org.
+						Zone:
+
+						# Domains of a message to look up: ehlo, mailfrom, from and/or dkim. Default all.
+						# Only for DomainBLs, not URIBLs. (optional)
+						Identities:
+							-
+
+						# Addresses returned by the block list that indicate a listing, as IP addresses or
+						# networks in CIDR notation, e.g. 127.0.1.2 or 127.0.1.0/24. Block lists often
+						# return different addresses depending on the reason for a listing, see the
+						# documentation of the block list. Default: any address in 127.0.0.0/8, except
+						# 127.255.255.0/24, which block lists use to indicate errors such as refused
+						# queries. (optional)
+						ReturnCodes:
+							-
+
+						# Weight of a listing. A message is rejected if the sum of the weights of its
+						# listings is at least 1. Default 1. (optional)
+						Weight: 0.000000
+
+				# Domain-based DNS block lists for the domains of links in incoming messages
+				# (URIBLs), e.g. multi.surbl.org. The organizational domains of http and https
+				# links in the text and html parts of a message are looked up, at most 20.
+				# Otherwise like DomainBLs. (optional)
+				URIBLs:
+					-
+
+						# Zone of the block list, e.g. dbl.spamhaus.org.
+						Zone:
+
+						# Domains of a message to look up: ehlo, mailfrom, from and/or dkim. Default all.
+						# Only for DomainBLs, not URIBLs. (optional)
+						Identities:
+							-
+
+						# Addresses returned by the block list that indicate a listing, as IP addresses or
+						# networks in CIDR notation, e.g. 127.0.1.2 or 127.0.1.0/24. Block lists often
+						# return different addresses depending on the reason for a listing, see the
+						# documentation of the block list. Default: any address in 127.0.0.0/8, except
+						# 127.255.255.0/24, which block lists use to indicate errors such as refused
+						# queries. (optional)
+						ReturnCodes:
+							-
+
+						# Weight of a listing. A message is rejected if the sum of the weights of its
+						# listings is at least 1. Default 1. (optional)
+						Weight: 0.000000
+
 				# Delay before accepting a message from a first-time sender for the destination
 				# account. Default: 15s. (optional)
 				FirstTimeSenderDelay: 0s
 
+				# If set, incoming messages from senders without reputation whose content the junk
+				# filter cannot classify as ham are greylisted: the first delivery attempt for a
+				# combination of remote IP network, SMTP MAIL FROM and RCPT TO is rejected with a
+				# temporary failure. Legitimate mail servers retry later, while many spam-sending
+				# botnets do not. Senders with an SPF- or DKIM-verified domain that has passed
+				# greylisting before or that has a good reputation are not greylisted. (optional)
+				Greylisting:
+
+					# Minimum time before a retried delivery attempt is accepted. Default 5m.
+					# (optional)
+					Delay: 0s
+
+					# How long a combination of remote IP network, MAIL FROM and RCPT TO is remembered
+					# after its last delivery attempt. Also the time within which a sender must retry
+					# before greylisting starts over, and how long sender domains that passed
+					# greylisting are remembered. Default 840h (35 days). (optional)
+					Expiry: 0s
+
 			# SMTP for submitting email, e.g. by email applications. Starts out in plain text,
 			# can be upgraded to TLS with the STARTTLS command. Prefer using Submissions which
 			# is always a TLS connection. (optional)
@@ -249,6 +334,68 @@ describe-static" and "beacon config describe-domains":
 				# Default 465. (optional)
 				Port: 0
 
+			# External content scanners, e.g. an antivirus scanner or data loss prevention
+			# check, called in order for each message received over SMTP on this listener,
+			# both for incoming deliveries and for submissions. Messages are scanned after the
+			# DATA command, before delivery or queueing. Scanners can accept, reject or
+			# temporarily fail a message, quarantine it to a mailbox, and add headers.
+			# (optional)
+			ContentScans:
+				-
+
+					# Name of the scanner, for logging and metrics. Default is the kind of scanner:
+					# milter, http or command. (optional)
+					Name:
+
+					# Address of a milter (mail filter, as used by sendmail and postfix), as
+					# inet:host:port for TCP or unix:/path/to/socket for a unix domain socket. The
+					# milter can add headers and quarantine messages. Exactly one of Milter, HTTP and
+					# Command must be set. (optional)
+					Milter:
+
+					# URL to which the message is sent in a POST request with content-type
+					# message/rfc822. The envelope is in request headers X-Beacon-Mail-From,
+					# X-Beacon-Rcpt-To (once for each recipient), X-Beacon-Remote-IP, X-Beacon-Helo,
+					# X-Beacon-Submission (yes or no), X-Beacon-Account (for submissions) and
+					# X-Beacon-Queue-ID (as in the Received header). The response must have status 200
+					# and a JSON verdict: an object with field Action (accept, reject, tempfail or
+					# quarantine), and optional fields Code (SMTP reply code, e.g. 550), EnhancedCode
+					# (e.g. 5.7.1), Message (SMTP reply text), Mailbox (for quarantine) and Headers
+					# (list of objects with fields Name and Value, added to the message). (optional)
+					HTTP:
+
+					# Command and arguments to execute, with the message on standard input. The
+					# envelope is in environment variables BEACON_MAIL_FROM, BEACON_RCPT_TO
+					# (space-separated), BEACON_REMOTE_IP, BEACON_HELO, BEACON_SUBMISSION (yes or no),
+					# BEACON_ACCOUNT and BEACON_QUEUE_ID. Exit status 0 accepts the message, 1 rejects
+					# it, 75 (EX_TEMPFAIL) fails it temporarily, any other status is a scanner
+					# failure. For exit status 1 and 75, the first line of standard output is used in
+					# the SMTP reply. For exit status 0, non-empty standard output must be a JSON
+					# verdict, as for HTTP. (optional)
+					Command:
+						-
+
+					# Maximum duration of a scan. Default 1m. (optional)
+					Timeout: 0s
+
+					# If the scanner fails or times out, temporarily reject the message. By default, a
+					# failure is logged and the message is handled as if the scanner accepted it (fail
+					# open). (optional)
+					FailClosed: false
+
+					# Mailbox for quarantined messages, if the verdict does not specify a mailbox. For
+					# incoming messages, the mailbox is in the account of the recipient, for
+					# submissions in the account of the sender and the message is not sent. Incoming
+					# messages are kept in the central quarantine instead if it is configured with
+					# reason contentscan. Default Quarantine. (optional)
+					QuarantineMailbox:
+
+					# Do not scan incoming messages, only submissions. (optional)
+					NoIncoming: false
+
+					# Do not scan submissions, only incoming messages. (optional)
+					NoSubmission: false
+
 			# IMAP for reading email, by email applications. Starts out in plain text, can be
 			# upgraded to TLS with the STARTTLS command. Prefer using IMAPS instead which is
 			# always a TLS connection. (optional)
@@ -271,7 +418,9 @@ describe-static" and "beacon config describe-domains":
 				Port: 0
 
 			# Account web interface, for email users wanting to change their accounts, e.g.
-			# set new password, set new delivery rulesets. Default path is /. (optional)
+			# set new password, set new delivery rulesets. Default path is /. Contacts are
+			# served over CardDAV at dav/ below the path, with a redirect from
+			# /.well-known/carddav. (optional)
 			AccountHTTP:
 				Enabled: false
 
@@ -644,6 +793,167 @@ describe-static" and "beacon config describe-domains":
 	# approximately 15% overhead). (optional)
 	QuotaMessageSize: 0
 
+	# Domains of ARC sealers (RFC 8617) that are trusted, typically mailing lists and
+	# forwarding services. Intermediaries like these modify messages, which breaks
+	# DKIM signatures, and send from their own IPs, which breaks SPF. If an incoming
+	# message has a valid ARC chain with the most recent ARC-Seal from a trusted
+	# sealer, a failing DMARC policy is not enforced, and the IP, EHLO and MAIL FROM
+	# domain of the sealer are not used for reputation-based junk classification, as
+	# for forwarded messages through rulesets with IsForward. The ARC verification
+	# result is always added to the Authentication-Results header. (optional)
+	ARCTrustedSealers:
+		-
+
+	# If set, DMARC failure reports (RFC 6591), also known as forensic reports, are
+	# sent for incoming messages that fail DMARC, to domains that request them with
+	# the ruf field in their DMARC record. The fo field of the DMARC record determines
+	# which failures are reported. Recipient addresses are redacted from reports.
+	# Reports are rate-limited, and are not sent if NoOutgoingDMARCReports is set.
+	# Reports are sent from the postmaster@<mailhostname> address. (optional)
+	DMARCFailureReports:
+
+		# Include the full message in failure reports. By default, only the message
+		# headers are included. Messages larger than 1MB, and messages that require
+		# SMTPUTF8, are always reported with headers only. (optional)
+		IncludeBody: false
+
+		# Maximum number of failure reports sent per hour per reporting address. Default
+		# 10. (optional)
+		MaxPerHour: 0
+
+	# If set, suspicious incoming messages are kept in a central quarantine, instead
+	# of in the Rejects mailbox of the account or instead of being delivered. Admins
+	# can search, inspect, release or delete quarantined messages in the admin web
+	# interface, and users can do the same for their own messages in the account web
+	# interface. Users periodically receive a digest message listing their newly
+	# quarantined messages. (optional)
+	Quarantine:
+
+		# Reasons for quarantining messages. Messages rejected because the remote IP is on
+		# a DNS blocklist (dnsbl) or because the junk filter classified them as spam
+		# (junk) are still rejected during the SMTP transaction, but are kept in the
+		# quarantine instead of in the Rejects mailbox of the account. Messages
+		# quarantined by a content scanner (contentscan) or matching a hold rule (hold)
+		# are accepted, and kept in the quarantine instead of being delivered. Default:
+		# dnsbl, junk, contentscan and hold. (optional)
+		Reasons:
+			-
+
+		# Rules for holding incoming messages in the quarantine. A message that would
+		# otherwise be delivered is held if all conditions of a rule match. (optional)
+		HoldRules:
+			-
+
+				# Matches if this regular expression matches (a substring of) the SMTP MAIL FROM
+				# address. E.g. '@example\.org$'. (optional)
+				SMTPMailFromRegexp:
+
+				# Matches if this regular expression matches (a substring of) the SMTP RCPT TO
+				# address. E.g. '^finance@'. (optional)
+				RcptToRegexp:
+
+				# Matches if these header field/value regular expressions all match (substrings
+				# of) the message headers. Header fields and values are converted to lower case
+				# before matching, and whitespace is trimmed from values, as with rulesets.
+				# (optional)
+				HeadersRegexp:
+					x:
+
+		# How long messages are kept in the quarantine before they are removed. Default
+		# 720h (30 days). (optional)
+		Retention: 0s
+
+		# Minimum time between digest messages to an account, listing its newly
+		# quarantined messages. Default 24h. (optional)
+		DigestInterval: 0s
+
+		# Do not send digest messages to accounts. (optional)
+		NoDigests: false
+
+		# URL of the account web interface, for links to quarantined messages in digests,
+		# e.g. https://mail.example.com/. If empty, the URL is composed of the host name
+		# and path of the first listener (by name) with the account web interface enabled
+		# over HTTPS. If no such listener exists, digests do not contain links. (optional)
+		AccountURL:
+
+	# If set, a built-in DNS server answers DNSBL queries (RFC 5782) for IPs of remote
+	# mail servers with a bad reputation in the accounts of this instance. Other mail
+	# servers, such as other beacon instances, can add the zone to the DNSBLs of their
+	# SMTP listeners. IPs are listed based on incoming messages that were marked as
+	# junk and that were rejected, across all accounts, with the weight of messages
+	# decaying over time. (optional)
+	DNSBLServer:
+
+		# DNS zone of the block list, e.g. dnsbl.example.com. The zone must be delegated
+		# to this server with NS records in the parent zone, or be configured as forward
+		# zone in the resolvers of the mail servers using the block list.
+		Zone:
+
+		# IPs to listen on for DNS requests, over UDP and TCP.
+		IPs:
+			-
+
+		# Port to listen on. Default 53. (optional)
+		Port: 0
+
+		# Minimum weighted number of messages from an IP that were marked as junk, across
+		# all accounts, for the IP to be listed. Default 3. (optional)
+		JunkThreshold: 0.000000
+
+		# Minimum weighted number of messages from an IP that were rejected as junk during
+		# SMTP, for the IP to be listed. Only rejects because of junk content are counted,
+		# and retried deliveries of the same message are counted once. Default 5.
+		# (optional)
+		RejectThreshold: 0.000000
+
+		# IPs are not listed if the weighted number of messages from the IP that were
+		# marked as non-junk is more than this fraction of all marked and rejected
+		# messages from the IP. Default 0.1. (optional)
+		MaxHamFraction: 0.000000
+
+		# Period after which the weight of a message is halved. Messages older than 8
+		# half-lives are ignored. Default 168h (7 days). (optional)
+		HalfLife: 0s
+
+		# IPs and networks in CIDR notation that are never listed, e.g. of mail servers of
+		# your organization. (optional)
+		Allow:
+			-
+
+		# Explanation returned in the TXT record for a listed IP. Default: Listed for junk
+		# reputation at <hostname>. (optional)
+		Explanation:
+
+		# Interval for recomputing the listed IPs from the account databases. Default 15m.
+		# (optional)
+		RefreshInterval: 0s
+
+	# If set, DNS requests are sent to these upstream resolvers over DNS-over-TLS or
+	# DNS-over-HTTPS instead of to the system resolver configured in /etc/resolv.conf,
+	# and DNSSEC signatures are verified by beacon itself instead of trusting the
+	# 'authentic data' bit in responses from the resolver. DANE requires DNSSEC, and
+	# DNSSEC makes MTA-STS, SPF, DKIM and DMARC lookups more secure. Useful on systems
+	# without a local DNSSEC-verifying resolver. (optional)
+	DNSResolver:
+
+		# Upstream recursive resolvers, tried in order. Either DNS-over-TLS (RFC 7858) as
+		# tls://host or tls://host:port (default port 853), or DNS-over-HTTPS (RFC 8484)
+		# as https URL, e.g. https://dns.example/dns-query. TLS certificates of the
+		# resolvers are verified. Host names of upstream resolvers are resolved with the
+		# system resolver, use IP addresses to prevent depending on it.
+		Upstreams:
+			-
+
+		# DS records for the root zone to use as DNSSEC trust anchors, as key tag,
+		# algorithm, digest type and hexadecimal digest, e.g. '20326 8 2 E06D44B8...'.
+		# Default: the root zone key signing keys published by IANA, KSK-2017 (key tag
+		# 20326) and KSK-2024 (key tag 38696). (optional)
+		TrustAnchors:
+			-
+
+		# Maximum number of DNS responses to cache. Default 10000. (optional)
+		CacheSize: 0
+
 # domains.conf
 
 	# NOTE: This config file is in 'sconf' format. Indent with tabs. Comments must be
@@ -719,6 +1029,16 @@ describe-static" and "beacon config describe-domains":
 				Sign:
 					-
 
+				# Selector to add ARC (RFC 8617) sets with when messages are relayed, e.g. a
+				# received message that is submitted again for forwarding. A message is considered
+				# relayed if it already has Authentication-Results or ARC headers. The ARC set is
+				# added for messages submitted by accounts with this domain as their configured
+				# domain, records the SPF, DKIM and DMARC results from when this server received
+				# the message and the status of the existing ARC chain, and lets receivers that
+				# trust this domain as sealer use the results. If empty, messages are not
+				# ARC-sealed. (optional)
+				ARCSeal:
+
 			# With DMARC, a domain publishes, in DNS, a policy on how other mail servers
 			# should handle incoming messages with the From-header matching this domain and/or
 			# subdomain (depending on the configured alignment). Receiving mail servers use
@@ -811,6 +1131,32 @@ describe-static" and "beacon config describe-domains":
 					MinimumAttempts: 0
 					Transport:
 
+			# For updating the DNS records required for this domain on an authoritative name
+			# server with dynamic updates (RFC 2136), authenticated with TSIG. The records are
+			# only updated when explicitly requested, e.g. through the admin web interface or
+			# "beacon config dnssync". (optional)
+			DNSUpdate:
+
+				# Address of the primary name server accepting dynamic updates for the zone, as
+				# host:port. If no port is specified, port 53 is used. Updates are sent over TCP.
+				Server:
+
+				# Name of the zone to update. Only records in this zone are updated, other records
+				# must be managed manually. If empty, the domain itself is used. (optional)
+				Zone:
+
+				# Name of the TSIG key as configured in the name server.
+				TSIGKeyName:
+
+				# TSIG algorithm: hmac-sha256 (default), hmac-sha384 or hmac-sha512. (optional)
+				TSIGAlgorithm:
+
+				# Base64-encoded shared secret of the TSIG key.
+				TSIGSecret:
+
+				# TTL in seconds for added records. Default 300. (optional)
+				TTL: 0
+
 	# Accounts to which email can be delivered. An account can accept email for
 	# multiple domains, for multiple localparts, and deliver to multiple mailboxes.
 	Accounts:
@@ -993,6 +1339,26 @@ describe-static" and "beacon config describe-domains":
 					# in calculating probability reduced. E.g. 1 or 2. (optional)
 					RareWords: 0
 
+					# Track ham/spam ranking for domains of http(s) links in text and html parts, and
+					# their organizational domains (based on the public suffix list). Links to IP
+					# addresses are tracked as a single feature. (optional)
+					Links: false
+
+					# Track ham/spam ranking for media types and file name extensions of attachments.
+					# (optional)
+					Attachments: false
+
+					# Track ham/spam ranking for the message structure: whether it has text and/or
+					# html parts, the ratio of text to markup in html parts, and header anomalies such
+					# as a missing Date or Message-ID header, or a Message-ID domain that doesn't
+					# match the From domain. (optional)
+					Structure: false
+
+					# Track ham/spam ranking for SPF, DKIM and DMARC verdicts in the
+					# Authentication-Results header added during delivery. Messages without the
+					# header, such as those sent by the account, are tracked as such. (optional)
+					AuthResults: false
+
 			# Maximum number of outgoing messages for this account in a 24 hour window. This
 			# limits the damage to recipients and the reputation of this mail server in case
 			# of account compromise. Default 1000. (optional)
@@ -1003,6 +1369,46 @@ describe-static" and "beacon config describe-domains":
 			# this mail server in case of account compromise. Default 200. (optional)
 			MaxFirstTimeRecipientsPerDay: 0
 
+			# Require two-factor authentication with time-based one-time passwords (TOTP) from
+			# an authenticator app for logging in to the webmail and account web interfaces.
+			# Until the user has enrolled an authenticator app, only a login to the account
+			# web interface is allowed, for enrolling. IMAP, SMTP submission and CardDAV only
+			# accept app passwords, not the account password. App passwords are managed in the
+			# account web interface. (optional)
+			RequireTOTP: false
+
+			# Public keys of TLS client certificates that can authenticate as this account
+			# with SASL mechanism EXTERNAL, on IMAP and SMTP submission listeners with TLS
+			# ClientAuth enabled. Can be managed in the account web interface. (optional)
+			TLSPublicKeys:
+				-
+
+					# Description of the key, e.g. the host or application using it.
+					Name:
+
+					# SHA-256 hash of the DER-encoded SubjectPublicKeyInfo of the certificate, in
+					# lower case hex. For example the output of: openssl x509 -in cert.pem -noout
+					# -pubkey | openssl pkey -pubin -outform der | sha256sum
+					Fingerprint:
+
+					# Email address of the account to use as login address, e.g. for checking message
+					# From addresses in SMTP submission. Must be a destination address of the account.
+					LoginAddress:
+
+			# Block authentication for this account after too many consecutive failed
+			# authentication attempts, from any IP address. For IMAP, SMTP submission and the
+			# web interfaces. Failed attempts are always rate limited per IP address, this
+			# protects against attacks from many IP addresses. Blocks can be removed in the
+			# admin web interface. (optional)
+			LoginLockout:
+
+				# Number of consecutive failed authentication attempts after which authentication
+				# is blocked. A successful login resets the count.
+				MaxFailures: 0
+
+				# How long authentication is blocked. Default 1h. (optional)
+				Period: 0s
+
 			# Routes for delivering outgoing messages through the queue. Each delivery attempt
 			# evaluates these account routes, domain routes and finally global routes. The
 			# transport of the first matching route is used in the delivery attempt. If no
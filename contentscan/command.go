@@ -0,0 +1,74 @@
+package contentscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/qompassai/beacon/mlog"
+)
+
+// Exit statuses of commands, following sysexits.h for tempfail.
+const (
+	exitAccept   = 0
+	exitReject   = 1
+	exitTempfail = 75 // EX_TEMPFAIL
+)
+
+// command executes a local command with the message on stdin.
+type command struct {
+	argv []string
+}
+
+func (s command) Scan(ctx context.Context, log mlog.Log, env Envelope, msg io.ReaderAt, size int64) (Verdict, error) {
+	cmd := exec.CommandContext(ctx, s.argv[0], s.argv[1:]...)
+	cmd.Stdin = io.NewSectionReader(msg, 0, size)
+	cmd.Env = append(os.Environ(),
+		"BEACON_MAIL_FROM="+env.MailFrom,
+		"BEACON_RCPT_TO="+strings.Join(env.RcptTo, " "),
+		"BEACON_REMOTE_IP="+env.RemoteIP.String(),
+		"BEACON_HELO="+env.Hostname,
+		"BEACON_SUBMISSION="+yesno(env.Submission),
+		"BEACON_ACCOUNT="+env.Account,
+		"BEACON_QUEUE_ID="+env.QueueID,
+	)
+	// Don't wait for child processes still holding stdout/stderr after the command
+	// is killed on timeout.
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return Verdict{}, fmt.Errorf("running command: %v", err)
+	}
+	if ctx.Err() != nil {
+		return Verdict{}, fmt.Errorf("running command: %w", ctx.Err())
+	}
+	code := exitAccept
+	if exitErr != nil {
+		code = exitErr.ExitCode()
+	}
+
+	line, _, _ := strings.Cut(string(stdout), "\n")
+	line = strings.TrimSpace(line)
+	switch code {
+	case exitAccept:
+		if len(bytes.TrimSpace(stdout)) == 0 {
+			return Verdict{Action: ActionAccept}, nil
+		}
+		return parseVerdict(stdout)
+	case exitReject:
+		return Verdict{Action: ActionReject, Message: line}, nil
+	case exitTempfail:
+		return Verdict{Action: ActionTempfail, Message: line}, nil
+	}
+	errmsg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+	return Verdict{}, fmt.Errorf("command failed with exit status %d: %s", code, errmsg)
+}
@@ -0,0 +1,306 @@
+// Package contentscan calls external content scanners, like antivirus scanners
+// and data loss prevention checks, for messages received over SMTP.
+//
+// Scanners are configured per listener, see config.ContentScan. Three kinds of
+// scanners are implemented: milters (the mail filter protocol of sendmail and
+// postfix), HTTP callouts and local commands. Each returns a verdict: accept,
+// reject or temporarily fail the message, or quarantine it to a mailbox.
+// Scanners can also add headers to the message.
+package contentscan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var (
+	metricScan = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "beacon_contentscan_scan_duration_seconds",
+			Help:    "Content scan duration and result.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+		},
+		[]string{
+			"scanner",
+			"result", // accept, reject, tempfail, quarantine, error
+		},
+	)
+)
+
+// ErrVerdict is returned when a scanner returns an invalid verdict.
+var ErrVerdict = errors.New("invalid verdict")
+
+// DefaultQuarantineMailbox is used for quarantined messages when neither verdict
+// nor configuration specify a mailbox.
+const DefaultQuarantineMailbox = "Quarantine"
+
+// Action is the decision of a scanner about a message.
+type Action string
+
+const (
+	ActionAccept     Action = "accept"
+	ActionReject     Action = "reject"     // Permanent failure, with 5xx code.
+	ActionTempfail   Action = "tempfail"   // Temporary failure, with 4xx code.
+	ActionQuarantine Action = "quarantine" // Accept, but deliver to a quarantine mailbox.
+)
+
+// Header is a message header to add to a message.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Verdict is the result of a scan.
+type Verdict struct {
+	Action       Action
+	Code         int    // SMTP reply code for reject and tempfail, e.g. 550.
+	EnhancedCode string // Enhanced status code for reject and tempfail, e.g. "5.7.1".
+	Message      string // For the SMTP reply for reject and tempfail.
+	Mailbox      string // Mailbox for quarantine. If empty, the configured mailbox is used.
+	Headers      []Header
+
+	Scanner string `json:"-"` // Name of scanner that determined the action, set by Scan.
+}
+
+// SecondaryCode returns the enhanced status code without class, as used in
+// smtp.Se* constants, e.g. "7.1".
+func (v Verdict) SecondaryCode() string {
+	_, s, _ := strings.Cut(v.EnhancedCode, ".")
+	return s
+}
+
+// Envelope describes the SMTP transaction of a message being scanned.
+type Envelope struct {
+	Submission bool   // Whether the message is submitted by an authenticated user.
+	Account    string // Account of the authenticated user, for submissions.
+	RemoteIP   net.IP
+	Hostname   string   // From EHLO/HELO.
+	MailFrom   string   // SMTP MAIL FROM address, empty for the null reverse path.
+	RcptTo     []string // SMTP RCPT TO addresses.
+	QueueID    string   // ID of message in Received header, for correlating logs.
+}
+
+// Scanner scans a message and returns a verdict.
+type Scanner interface {
+	Scan(ctx context.Context, log mlog.Log, env Envelope, msg io.ReaderAt, size int64) (Verdict, error)
+}
+
+// Name returns the name of the configured scanner, for logging and metrics.
+func Name(conf config.ContentScan) string {
+	switch {
+	case conf.Name != "":
+		return conf.Name
+	case conf.Milter != "":
+		return "milter"
+	case conf.HTTP != "":
+		return "http"
+	default:
+		return "command"
+	}
+}
+
+// New returns a scanner for the configuration.
+func New(conf config.ContentScan) (Scanner, error) {
+	switch {
+	case conf.Milter != "":
+		network, address, err := ParseMilterAddress(conf.Milter)
+		if err != nil {
+			return nil, err
+		}
+		return milter{network, address}, nil
+	case conf.HTTP != "":
+		return httpScanner{conf.HTTP}, nil
+	case len(conf.Command) > 0:
+		return command{conf.Command}, nil
+	}
+	return nil, errors.New("no scanner configured")
+}
+
+// Scan calls the scanners in order, and returns the combined verdict. A reject
+// or tempfail by a scanner is returned immediately. Otherwise, headers of all
+// scanners are combined, and the message is quarantined if any scanner
+// quarantines it.
+//
+// If a scanner fails, the message is temporarily rejected for scanners
+// configured with FailClosed, and otherwise handled as if the scanner accepted
+// the message.
+func Scan(ctx context.Context, log mlog.Log, scans []config.ContentScan, env Envelope, msg io.ReaderAt, size int64) Verdict {
+	result := Verdict{Action: ActionAccept}
+	for _, conf := range scans {
+		name := Name(conf)
+		v, err := scan1(ctx, log, conf, env, msg, size)
+		if err != nil {
+			log.Errorx("content scan failed", err, slog.String("scanner", name), slog.Bool("failclosed", conf.FailClosed))
+			if conf.FailClosed {
+				return Verdict{Action: ActionTempfail, Code: 451, EnhancedCode: "4.3.0", Message: "content scan failed, try again later", Scanner: name}
+			}
+			continue
+		}
+		log.Debug("content scan result", slog.String("scanner", name), slog.Any("action", v.Action), slog.Int("headers", len(v.Headers)))
+
+		switch v.Action {
+		case ActionReject, ActionTempfail:
+			v.Scanner = name
+			return v
+		case ActionQuarantine:
+			if result.Action != ActionQuarantine {
+				result.Action = ActionQuarantine
+				result.Scanner = name
+				result.Mailbox = v.Mailbox
+				if result.Mailbox == "" {
+					result.Mailbox = conf.QuarantineMailbox
+				}
+				if result.Mailbox == "" {
+					result.Mailbox = DefaultQuarantineMailbox
+				}
+				result.Message = v.Message
+			}
+		}
+		result.Headers = append(result.Headers, v.Headers...)
+	}
+	return result
+}
+
+func scan1(ctx context.Context, log mlog.Log, conf config.ContentScan, env Envelope, msg io.ReaderAt, size int64) (rv Verdict, rerr error) {
+	name := Name(conf)
+	start := time.Now()
+	defer func() {
+		result := string(rv.Action)
+		if rerr != nil {
+			result = "error"
+		}
+		metricScan.WithLabelValues(name, result).Observe(float64(time.Since(start)) / float64(time.Second))
+	}()
+
+	scanner, err := New(conf)
+	if err != nil {
+		return Verdict{}, err
+	}
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	v, err := scanner.Scan(ctx, log.With(slog.String("scanner", name)), env, msg, size)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return normalize(v)
+}
+
+var enhancedCodeRegexp = regexp.MustCompile(`^[245]\.[0-9]{1,3}\.[0-9]{1,3}$`)
+
+// normalize checks a verdict and fills in default codes.
+func normalize(v Verdict) (Verdict, error) {
+	switch v.Action {
+	case ActionAccept, ActionQuarantine:
+	case ActionReject:
+		if v.Code/100 != 5 {
+			v.Code = 554
+		}
+		if !enhancedCodeRegexp.MatchString(v.EnhancedCode) || v.EnhancedCode[0] != '5' {
+			v.EnhancedCode = "5.7.1"
+		}
+		if v.Message == "" {
+			v.Message = "message rejected by content scanner"
+		}
+	case ActionTempfail:
+		if v.Code/100 != 4 {
+			v.Code = 451
+		}
+		if !enhancedCodeRegexp.MatchString(v.EnhancedCode) || v.EnhancedCode[0] != '4' {
+			v.EnhancedCode = "4.7.1"
+		}
+		if v.Message == "" {
+			v.Message = "message temporarily rejected by content scanner"
+		}
+	default:
+		return Verdict{}, fmt.Errorf("%w: unknown action %q", ErrVerdict, v.Action)
+	}
+	if strings.ContainsAny(v.Message, "\r\n") {
+		return Verdict{}, fmt.Errorf("%w: message with newline", ErrVerdict)
+	}
+	for i, h := range v.Headers {
+		if h.Name == "" || strings.IndexFunc(h.Name, func(c rune) bool { return c <= ' ' || c >= 0x7f || c == ':' }) >= 0 {
+			return Verdict{}, fmt.Errorf("%w: invalid header name %q", ErrVerdict, h.Name)
+		}
+		// Header values can be folded over multiple lines, each continuation line must
+		// start with whitespace.
+		value := strings.ReplaceAll(h.Value, "\r\n", "\n")
+		lines := strings.Split(value, "\n")
+		for _, line := range lines[1:] {
+			if line == "" || (line[0] != ' ' && line[0] != '\t') || strings.Contains(line, "\r") {
+				return Verdict{}, fmt.Errorf("%w: invalid value for header %q", ErrVerdict, h.Name)
+			}
+		}
+		if strings.Contains(lines[0], "\r") {
+			return Verdict{}, fmt.Errorf("%w: invalid value for header %q", ErrVerdict, h.Name)
+		}
+		v.Headers[i].Value = strings.Join(lines, "\r\n")
+	}
+	return v, nil
+}
+
+// HeaderText returns the headers as text to prepend to a message.
+func (v Verdict) HeaderText() string {
+	var b strings.Builder
+	for _, h := range v.Headers {
+		b.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	return b.String()
+}
+
+// parseVerdict parses a JSON verdict, as returned by HTTP and command scanners.
+func parseVerdict(buf []byte) (Verdict, error) {
+	var v Verdict
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return Verdict{}, fmt.Errorf("%w: parsing json: %v", ErrVerdict, err)
+	}
+	return v, nil
+}
+
+// parseReply parses an SMTP reply line like "550 5.7.1 virus found" into a
+// verdict.
+func parseReply(s string) (Verdict, error) {
+	s, _, _ = strings.Cut(s, "\n")
+	s = strings.TrimRight(s, "\r")
+	if len(s) < 3 {
+		return Verdict{}, fmt.Errorf("%w: short reply %q", ErrVerdict, s)
+	}
+	code, err := strconv.Atoi(s[:3])
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%w: bad reply code in %q", ErrVerdict, s)
+	}
+	v := Verdict{Code: code}
+	switch code / 100 {
+	case 4:
+		v.Action = ActionTempfail
+	case 5:
+		v.Action = ActionReject
+	default:
+		return Verdict{}, fmt.Errorf("%w: reply code %d is not a failure", ErrVerdict, code)
+	}
+	rest := strings.TrimLeft(s[3:], " -")
+	if t, msg, _ := strings.Cut(rest, " "); enhancedCodeRegexp.MatchString(t) {
+		v.EnhancedCode = t
+		rest = msg
+	}
+	v.Message = strings.TrimSpace(rest)
+	return v, nil
+}
@@ -0,0 +1,300 @@
+package contentscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("contentscan", nil)
+
+var testMsg = strings.ReplaceAll(`From: <remote@example.org>
+To: <mjl@beacon.example>
+Subject: test
+ continued
+
+body
+`, "\n", "\r\n")
+
+var testEnv = Envelope{
+	RemoteIP: net.ParseIP("127.0.0.10"),
+	Hostname: "remote.example.org",
+	MailFrom: "remote@example.org",
+	RcptTo:   []string{"mjl@beacon.example"},
+	QueueID:  "test",
+}
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %#v, expected %#v", got, exp)
+	}
+}
+
+func scan(t *testing.T, conf config.ContentScan, msg string) Verdict {
+	t.Helper()
+	return Scan(ctxbg, pkglog, []config.ContentScan{conf}, testEnv, strings.NewReader(msg), int64(len(msg)))
+}
+
+func TestReadHeaders(t *testing.T) {
+	headers, offset, err := readHeaders(strings.NewReader(testMsg))
+	tcheck(t, err, "read headers")
+	tcompare(t, headers, []Header{
+		{"From", " <remote@example.org>"},
+		{"To", " <mjl@beacon.example>"},
+		{"Subject", " test\r\n continued"},
+	})
+	tcompare(t, testMsg[offset:], "body\r\n")
+
+	// Without body.
+	msg := "Subject: test\r\n"
+	headers, offset, err = readHeaders(strings.NewReader(msg))
+	tcheck(t, err, "read headers")
+	tcompare(t, headers, []Header{{"Subject", " test"}})
+	tcompare(t, offset, int64(len(msg)))
+}
+
+func TestParseReply(t *testing.T) {
+	v, err := parseReply("550 5.7.1 virus found")
+	tcheck(t, err, "parse reply")
+	tcompare(t, v, Verdict{Action: ActionReject, Code: 550, EnhancedCode: "5.7.1", Message: "virus found"})
+
+	v, err = parseReply("451 try later")
+	tcheck(t, err, "parse reply")
+	tcompare(t, v, Verdict{Action: ActionTempfail, Code: 451, Message: "try later"})
+
+	_, err = parseReply("250 ok")
+	if !errors.Is(err, ErrVerdict) {
+		t.Fatalf("got err %v, expected ErrVerdict", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	v, err := normalize(Verdict{Action: ActionReject, Code: 450, EnhancedCode: "4.7.1"})
+	tcheck(t, err, "normalize")
+	tcompare(t, v, Verdict{Action: ActionReject, Code: 554, EnhancedCode: "5.7.1", Message: "message rejected by content scanner"})
+	tcompare(t, v.SecondaryCode(), "7.1")
+
+	v, err = normalize(Verdict{Action: ActionAccept, Headers: []Header{{"X-Test", "a\n\tb"}}})
+	tcheck(t, err, "normalize")
+	tcompare(t, v.HeaderText(), "X-Test: a\r\n\tb\r\n")
+
+	bad := []Verdict{
+		{Action: "bogus"},
+		{Action: ActionAccept, Headers: []Header{{"X Test", "a"}}},
+		{Action: ActionAccept, Headers: []Header{{"X-Test", "a\r\nInjected: b"}}},
+		{Action: ActionReject, Message: "a\r\nb"},
+	}
+	for _, v := range bad {
+		if _, err := normalize(v); !errors.Is(err, ErrVerdict) {
+			t.Fatalf("normalize %#v: got err %v, expected ErrVerdict", v, err)
+		}
+	}
+}
+
+// fakeMilter handles a single milter session. It skips HELO and requests no
+// replies for headers, and returns a verdict based on the body.
+func fakeMilter(t *testing.T, conn net.Conn, gotHeaders *[]Header) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	read := func() (byte, []byte) {
+		var lenbuf [4]byte
+		if _, err := io.ReadFull(br, lenbuf[:]); err != nil {
+			return 0, nil
+		}
+		buf := make([]byte, binary.BigEndian.Uint32(lenbuf[:]))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return 0, nil
+		}
+		return buf[0], buf[1:]
+	}
+	write := func(cmd byte, data []byte) {
+		buf := binary.BigEndian.AppendUint32(nil, uint32(1+len(data)))
+		buf = append(buf, cmd)
+		buf = append(buf, data...)
+		conn.Write(buf)
+	}
+
+	var body []byte
+	for {
+		cmd, data := read()
+		switch cmd {
+		case 0, smficQuit:
+			return
+		case smficOptneg:
+			buf := make([]byte, 12)
+			binary.BigEndian.PutUint32(buf[0:], 6)
+			binary.BigEndian.PutUint32(buf[4:], smfifAddhdrs|smfifQuarantine)
+			binary.BigEndian.PutUint32(buf[8:], smfipNohelo|smfipNrHdr)
+			write(smficOptneg, buf)
+		case smficMacro:
+		case smficHelo:
+			t.Errorf("received helo, should have been skipped")
+			return
+		case smficHeader:
+			l := bytes.Split(data, []byte{0})
+			*gotHeaders = append(*gotHeaders, Header{string(l[0]), string(l[1])})
+		case smficBody:
+			body = append(body, data...)
+			write(smfirContinue, nil)
+		case smficEOB:
+			switch {
+			case bytes.Contains(body, []byte("EICAR")):
+				write(smfirReplycode, cstring("554 5.7.1 virus found"))
+			case bytes.Contains(body, []byte("quarantine")):
+				write(smfirQuarantine, cstring("suspicious"))
+				write(smfirContinue, nil)
+			default:
+				write(smfirProgress, nil)
+				write(smfirAddheader, append(cstring("X-Virus-Scanned"), cstring(" clean")...))
+				write(smfirAccept, nil)
+			}
+		default:
+			write(smfirContinue, nil)
+		}
+	}
+}
+
+func TestMilter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	defer ln.Close()
+
+	var gotHeaders []Header
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			fakeMilter(t, conn, &gotHeaders)
+		}
+	}()
+
+	conf := config.ContentScan{Milter: "inet:" + ln.Addr().String()}
+
+	v := scan(t, conf, testMsg)
+	tcompare(t, v, Verdict{Action: ActionAccept, Headers: []Header{{"X-Virus-Scanned", "clean"}}})
+	// Headers are sent without leading whitespace.
+	tcompare(t, gotHeaders, []Header{
+		{"From", "<remote@example.org>"},
+		{"To", "<mjl@beacon.example>"},
+		{"Subject", "test\r\n continued"},
+	})
+
+	v = scan(t, conf, strings.Replace(testMsg, "body", "EICAR", 1))
+	tcompare(t, v, Verdict{Action: ActionReject, Code: 554, EnhancedCode: "5.7.1", Message: "virus found", Scanner: "milter"})
+
+	conf.QuarantineMailbox = "Suspicious"
+	v = scan(t, conf, strings.Replace(testMsg, "body", "quarantine", 1))
+	tcompare(t, v, Verdict{Action: ActionQuarantine, Mailbox: "Suspicious", Message: "suspicious", Scanner: "milter"})
+
+	// Large body is sent in chunks.
+	large := testMsg + strings.Repeat("x", 3*milterChunkSize) + "EICAR\r\n"
+	v = scan(t, conf, large)
+	tcompare(t, v.Action, ActionReject)
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Beacon-Mail-From") != "remote@example.org" || r.Header.Get("X-Beacon-Rcpt-To") != "mjl@beacon.example" || r.Header.Get("Content-Type") != "message/rfc822" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case bytes.Contains(buf, []byte("EICAR")):
+			w.Write([]byte(`{"Action": "reject", "Code": 550, "Message": "virus found"}`))
+		case bytes.Contains(buf, []byte("later")):
+			w.Write([]byte(`{"Action": "tempfail"}`))
+		case bytes.Contains(buf, []byte("error")):
+			http.Error(w, "scanner error", http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"Action": "accept", "Headers": [{"Name": "X-Scanned", "Value": "yes"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	conf := config.ContentScan{HTTP: srv.URL}
+	v := scan(t, conf, testMsg)
+	tcompare(t, v, Verdict{Action: ActionAccept, Headers: []Header{{"X-Scanned", "yes"}}})
+
+	v = scan(t, conf, strings.Replace(testMsg, "body", "EICAR", 1))
+	tcompare(t, v, Verdict{Action: ActionReject, Code: 550, EnhancedCode: "5.7.1", Message: "virus found", Scanner: "http"})
+
+	v = scan(t, conf, strings.Replace(testMsg, "body", "later", 1))
+	tcompare(t, v, Verdict{Action: ActionTempfail, Code: 451, EnhancedCode: "4.7.1", Message: "message temporarily rejected by content scanner", Scanner: "http"})
+
+	// Fail open, then fail closed.
+	v = scan(t, conf, strings.Replace(testMsg, "body", "error", 1))
+	tcompare(t, v.Action, ActionAccept)
+	conf.FailClosed = true
+	v = scan(t, conf, strings.Replace(testMsg, "body", "error", 1))
+	tcompare(t, v.Action, ActionTempfail)
+}
+
+func TestCommand(t *testing.T) {
+	script := `test "$BEACON_RCPT_TO" = "mjl@beacon.example" || exit 2
+msg=$(cat)
+case "$msg" in
+*EICAR*) echo "virus found"; exit 1;;
+*later*) echo "busy"; exit 75;;
+*json*) echo '{"Action": "quarantine", "Mailbox": "Held"}';;
+*slow*) sleep 10;;
+esac
+`
+	conf := config.ContentScan{Name: "script", Command: []string{"sh", "-c", script}}
+
+	v := scan(t, conf, testMsg)
+	tcompare(t, v, Verdict{Action: ActionAccept})
+
+	v = scan(t, conf, strings.Replace(testMsg, "body", "EICAR", 1))
+	tcompare(t, v, Verdict{Action: ActionReject, Code: 554, EnhancedCode: "5.7.1", Message: "virus found", Scanner: "script"})
+
+	v = scan(t, conf, strings.Replace(testMsg, "body", "later", 1))
+	tcompare(t, v, Verdict{Action: ActionTempfail, Code: 451, EnhancedCode: "4.7.1", Message: "busy", Scanner: "script"})
+
+	v = scan(t, conf, strings.Replace(testMsg, "body", "json", 1))
+	tcompare(t, v, Verdict{Action: ActionQuarantine, Mailbox: "Held", Scanner: "script"})
+
+	// Timeout with fail closed.
+	conf.Timeout = 100 * time.Millisecond
+	conf.FailClosed = true
+	v = scan(t, conf, strings.Replace(testMsg, "body", "slow", 1))
+	tcompare(t, v.Action, ActionTempfail)
+}
+
+func TestScanCombined(t *testing.T) {
+	accept := config.ContentScan{Name: "a", Command: []string{"sh", "-c", `echo '{"Action": "accept", "Headers": [{"Name": "X-A", "Value": "1"}]}'`}}
+	quarantine := config.ContentScan{Name: "q", Command: []string{"sh", "-c", `echo '{"Action": "quarantine", "Headers": [{"Name": "X-Q", "Value": "1"}]}'`}}
+	reject := config.ContentScan{Name: "r", Command: []string{"sh", "-c", `exit 1`}}
+	broken := config.ContentScan{Name: "b", Milter: "unix:/nonexistent/milter.sock"}
+
+	v := Scan(ctxbg, pkglog, []config.ContentScan{accept, broken, quarantine, accept}, testEnv, strings.NewReader(testMsg), int64(len(testMsg)))
+	tcompare(t, v, Verdict{Action: ActionQuarantine, Mailbox: DefaultQuarantineMailbox, Scanner: "q", Headers: []Header{{"X-A", "1"}, {"X-Q", "1"}, {"X-A", "1"}}})
+
+	v = Scan(ctxbg, pkglog, []config.ContentScan{quarantine, reject, accept}, testEnv, strings.NewReader(testMsg), int64(len(testMsg)))
+	tcompare(t, v.Action, ActionReject)
+	tcompare(t, v.Scanner, "r")
+}
@@ -0,0 +1,62 @@
+package contentscan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beaconvar"
+)
+
+// httpScanner sends the message in a POST request, and reads the JSON verdict
+// from the response.
+type httpScanner struct {
+	url string
+}
+
+func (s httpScanner) Scan(ctx context.Context, log mlog.Log, env Envelope, msg io.ReaderAt, size int64) (Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, io.NewSectionReader(msg, 0, size))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("making http request: %v", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "message/rfc822")
+	req.Header.Set("User-Agent", "beacon/"+beaconvar.Version)
+	req.Header.Set("X-Beacon-Mail-From", env.MailFrom)
+	for _, rcpt := range env.RcptTo {
+		req.Header.Add("X-Beacon-Rcpt-To", rcpt)
+	}
+	req.Header.Set("X-Beacon-Remote-IP", env.RemoteIP.String())
+	req.Header.Set("X-Beacon-Helo", env.Hostname)
+	req.Header.Set("X-Beacon-Submission", yesno(env.Submission))
+	if env.Account != "" {
+		req.Header.Set("X-Beacon-Account", env.Account)
+	}
+	req.Header.Set("X-Beacon-Queue-ID", env.QueueID)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("http request: %w", err)
+	}
+	defer func() {
+		err := resp.Body.Close()
+		log.Check(err, "closing http response body")
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("http response status %s", resp.Status)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("reading http response: %w", err)
+	}
+	return parseVerdict(buf)
+}
+
+func yesno(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,470 @@
+package contentscan
+
+// Milter protocol, as implemented by sendmail's libmilter and postfix. There is
+// no formal specification, see the libmilter sources and postfix documentation
+// (MILTER_README).
+//
+// Each packet starts with a 4-byte big-endian length, followed by a command byte
+// and command-specific data. Strings are NUL-terminated. The MTA negotiates the
+// protocol version, the actions the milter may take and the protocol steps it
+// can skip, then sends the SMTP transaction step by step. After each step, the
+// milter responds whether to continue. After the end of the body, the milter
+// first sends modifications, then its final response.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/mlog"
+)
+
+// Commands from MTA to milter.
+const (
+	smficOptneg = 'O'
+	smficMacro  = 'D'
+	smficConn   = 'C'
+	smficHelo   = 'H'
+	smficMail   = 'M'
+	smficRcpt   = 'R'
+	smficData   = 'T'
+	smficHeader = 'L'
+	smficEOH    = 'N'
+	smficBody   = 'B'
+	smficEOB    = 'E'
+	smficQuit   = 'Q'
+)
+
+// Responses from milter to MTA.
+const (
+	smfirAccept     = 'a'
+	smfirContinue   = 'c'
+	smfirDiscard    = 'd'
+	smfirReject     = 'r'
+	smfirTempfail   = 't'
+	smfirReplycode  = 'y'
+	smfirProgress   = 'p'
+	smfirSkip       = 's'
+	smfirAddheader  = 'h'
+	smfirInsheader  = 'i'
+	smfirChgheader  = 'm'
+	smfirQuarantine = 'q'
+)
+
+// Actions a milter can take after the end of the body. We only allow adding
+// headers and quarantine.
+const (
+	smfifAddhdrs    = 0x01
+	smfifQuarantine = 0x20
+)
+
+// Protocol flags, steps the milter does not need, or that need no reply.
+const (
+	smfipNoconnect  = 0x01
+	smfipNohelo     = 0x02
+	smfipNomail     = 0x04
+	smfipNorcpt     = 0x08
+	smfipNobody     = 0x10
+	smfipNohdrs     = 0x20
+	smfipNoeoh      = 0x40
+	smfipNrHdr      = 0x80
+	smfipNounknown  = 0x100
+	smfipNodata     = 0x200
+	smfipSkip       = 0x400
+	smfipNrConn     = 0x1000
+	smfipNrHelo     = 0x2000
+	smfipNrMail     = 0x4000
+	smfipNrRcpt     = 0x8000
+	smfipNrData     = 0x10000
+	smfipNrUnkn     = 0x20000
+	smfipNrEOH      = 0x40000
+	smfipNrBody     = 0x80000
+	smfipHdrLeadspc = 0x100000
+
+	// All steps we can skip or handle without reply. We never send "unknown"
+	// commands, so we can offer to skip them too.
+	smfipOffered = smfipNoconnect | smfipNohelo | smfipNomail | smfipNorcpt | smfipNobody | smfipNohdrs | smfipNoeoh | smfipNrHdr | smfipNounknown | smfipNodata | smfipSkip | smfipNrConn | smfipNrHelo | smfipNrMail | smfipNrRcpt | smfipNrData | smfipNrUnkn | smfipNrEOH | smfipNrBody | smfipHdrLeadspc
+)
+
+const (
+	milterVersion   = 6
+	milterChunkSize = 65535            // Maximum size of body chunks.
+	milterMaxPacket = 64 * 1024 * 1024 // Sanity limit for responses.
+)
+
+// ParseMilterAddress parses a milter address, either inet:host:port (or
+// inet6:host:port) for TCP, or unix:/path for a unix domain socket.
+func ParseMilterAddress(s string) (network, address string, err error) {
+	kind, addr, ok := strings.Cut(s, ":")
+	if !ok || addr == "" {
+		return "", "", fmt.Errorf("invalid milter address %q, must be inet:host:port or unix:/path", s)
+	}
+	switch kind {
+	case "inet", "inet6", "tcp":
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return "", "", fmt.Errorf("invalid milter address %q: %v", s, err)
+		}
+		return "tcp", addr, nil
+	case "unix", "local":
+		return "unix", addr, nil
+	}
+	return "", "", fmt.Errorf("invalid milter address %q, must be inet:host:port or unix:/path", s)
+}
+
+type milter struct {
+	network string
+	address string
+}
+
+// errMilterDone is used internally to stop the protocol when the milter has made
+// a decision before the end of the message.
+var errMilterDone = errors.New("milter done")
+
+type milterConn struct {
+	log      mlog.Log
+	conn     net.Conn
+	br       *bufio.Reader
+	protocol uint32 // Negotiated protocol flags.
+	verdict  Verdict
+	skip     bool // Milter asked to skip remaining body chunks.
+}
+
+func (s milter) Scan(ctx context.Context, log mlog.Log, env Envelope, msg io.ReaderAt, size int64) (Verdict, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("connecting to milter: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		log.Check(err, "closing milter connection")
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		err := conn.SetDeadline(deadline)
+		log.Check(err, "setting deadline on milter connection")
+	}
+	mc := &milterConn{log: log, conn: conn, br: bufio.NewReader(conn), verdict: Verdict{Action: ActionAccept}}
+	err = mc.run(env, msg, size)
+	if err == errMilterDone {
+		err = nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w (%v)", ctx.Err(), err)
+		}
+		return Verdict{}, err
+	}
+	// Best effort, we have our verdict.
+	if err := mc.write(smficQuit, nil); err != nil {
+		log.Debugx("writing quit to milter", err)
+	}
+	return mc.verdict, nil
+}
+
+func (mc *milterConn) run(env Envelope, msg io.ReaderAt, size int64) error {
+	if err := mc.negotiate(); err != nil {
+		return err
+	}
+
+	// Connection.
+	mc.macros(smficConn, "{daemon_name}", "beacon", "{client_addr}", env.RemoteIP.String())
+	family := byte('4')
+	if env.RemoteIP.To4() == nil {
+		family = '6'
+	}
+	ipstr := env.RemoteIP.String()
+	conn := cstring("[" + ipstr + "]")
+	conn = append(conn, family, 0, 0) // Port is unknown.
+	conn = append(conn, cstring(ipstr)...)
+	if err := mc.step(smficConn, conn, smfipNoconnect, smfipNrConn); err != nil {
+		return err
+	}
+
+	if err := mc.step(smficHelo, cstring(env.Hostname), smfipNohelo, smfipNrHelo); err != nil {
+		return err
+	}
+
+	mailMacros := []string{"i", env.QueueID, "{mail_addr}", env.MailFrom}
+	if env.Submission {
+		mailMacros = append(mailMacros, "{auth_authen}", env.Account)
+	}
+	mc.macros(smficMail, mailMacros...)
+	if err := mc.step(smficMail, cstring("<"+env.MailFrom+">"), smfipNomail, smfipNrMail); err != nil {
+		return err
+	}
+	for _, rcpt := range env.RcptTo {
+		mc.macros(smficRcpt, "{rcpt_addr}", rcpt)
+		if err := mc.step(smficRcpt, cstring("<"+rcpt+">"), smfipNorcpt, smfipNrRcpt); err != nil {
+			return err
+		}
+	}
+	if err := mc.step(smficData, nil, smfipNodata, smfipNrData); err != nil {
+		return err
+	}
+
+	headers, bodyOffset, err := readHeaders(io.NewSectionReader(msg, 0, size))
+	if err != nil {
+		return fmt.Errorf("reading message headers: %v", err)
+	}
+	for _, h := range headers {
+		value := h.Value
+		if mc.protocol&smfipHdrLeadspc == 0 {
+			value = strings.TrimLeft(value, " \t")
+		}
+		buf := append(cstring(h.Name), cstring(value)...)
+		if err := mc.step(smficHeader, buf, smfipNohdrs, smfipNrHdr); err != nil {
+			return err
+		}
+	}
+	if err := mc.step(smficEOH, nil, smfipNoeoh, smfipNrEOH); err != nil {
+		return err
+	}
+
+	if mc.protocol&smfipNobody == 0 {
+		body := io.NewSectionReader(msg, bodyOffset, size-bodyOffset)
+		buf := make([]byte, milterChunkSize)
+		for !mc.skip {
+			n, err := io.ReadFull(body, buf)
+			if n > 0 {
+				if err := mc.step(smficBody, buf[:n], 0, smfipNrBody); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("reading message body: %v", err)
+			}
+		}
+	}
+
+	if err := mc.write(smficEOB, nil); err != nil {
+		return err
+	}
+	return mc.endOfMessage()
+}
+
+// negotiate sends our options and reads the options of the milter.
+func (mc *milterConn) negotiate() error {
+	buf := make([]byte, 12)
+	binary.BigEndian.PutUint32(buf[0:], milterVersion)
+	binary.BigEndian.PutUint32(buf[4:], smfifAddhdrs|smfifQuarantine)
+	binary.BigEndian.PutUint32(buf[8:], smfipOffered)
+	if err := mc.write(smficOptneg, buf); err != nil {
+		return err
+	}
+	cmd, data, err := mc.read()
+	if err != nil {
+		return err
+	}
+	if cmd != smficOptneg || len(data) < 12 {
+		return fmt.Errorf("milter: unexpected response %q with %d bytes to option negotiation", cmd, len(data))
+	}
+	version := binary.BigEndian.Uint32(data[0:])
+	if version < 2 {
+		return fmt.Errorf("milter: unsupported protocol version %d", version)
+	}
+	mc.protocol = binary.BigEndian.Uint32(data[8:]) & smfipOffered
+	mc.log.Debug("milter negotiated", slog.Any("version", version), slog.Any("protocol", mc.protocol))
+	return nil
+}
+
+// macros sends macros for the next command. Milters don't respond to macros.
+// Errors are ignored, they will be returned by the next step.
+func (mc *milterConn) macros(cmd byte, nameValues ...string) {
+	buf := []byte{cmd}
+	for _, s := range nameValues {
+		buf = append(buf, cstring(s)...)
+	}
+	err := mc.write(smficMacro, buf)
+	mc.log.Check(err, "writing macros to milter")
+}
+
+// step sends a command, unless the milter asked to skip it, and reads the
+// response, unless the milter does not send one for this step. If the milter
+// made a decision, errMilterDone is returned.
+func (mc *milterConn) step(cmd byte, data []byte, skipFlag, noReplyFlag uint32) error {
+	if mc.protocol&skipFlag != 0 {
+		return nil
+	}
+	if err := mc.write(cmd, data); err != nil {
+		return err
+	}
+	if mc.protocol&noReplyFlag != 0 {
+		return nil
+	}
+	for {
+		rcmd, rdata, err := mc.read()
+		if err != nil {
+			return err
+		}
+		switch rcmd {
+		case smfirProgress:
+			continue
+		case smfirContinue:
+			return nil
+		case smfirSkip:
+			if cmd != smficBody {
+				return fmt.Errorf("milter: unexpected skip response to command %q", cmd)
+			}
+			mc.skip = true
+			return nil
+		}
+		return mc.decision(rcmd, rdata)
+	}
+}
+
+// decision handles a final response of the milter.
+func (mc *milterConn) decision(cmd byte, data []byte) error {
+	switch cmd {
+	case smfirAccept:
+		// Accept without further milter processing. Any earlier quarantine remains.
+		return errMilterDone
+	case smfirReject:
+		mc.verdict = Verdict{Action: ActionReject}
+		return errMilterDone
+	case smfirTempfail:
+		mc.verdict = Verdict{Action: ActionTempfail}
+		return errMilterDone
+	case smfirDiscard:
+		// Discarding is accepting and silently dropping the message. We don't want to
+		// lose messages without notice, so we reject instead.
+		mc.verdict = Verdict{Action: ActionReject, Message: "message discarded by content scanner"}
+		return errMilterDone
+	case smfirReplycode:
+		v, err := parseReply(string(bytes.TrimRight(data, "\x00")))
+		if err != nil {
+			return fmt.Errorf("milter: %w", err)
+		}
+		mc.verdict = v
+		return errMilterDone
+	}
+	return fmt.Errorf("milter: unexpected response %q", cmd)
+}
+
+// endOfMessage reads the modifications and final response after the end of the
+// body.
+func (mc *milterConn) endOfMessage() error {
+	var headers []Header
+	var quarantine bool
+	var reason string
+	for {
+		cmd, data, err := mc.read()
+		if err != nil {
+			return err
+		}
+		switch cmd {
+		case smfirProgress:
+			continue
+		case smfirAddheader, smfirInsheader:
+			if cmd == smfirInsheader {
+				// Starts with the index, we always add headers at the top.
+				if len(data) < 4 {
+					return fmt.Errorf("milter: short insert header response")
+				}
+				data = data[4:]
+			}
+			l := bytes.Split(data, []byte{0})
+			if len(l) < 2 {
+				return fmt.Errorf("milter: malformed header response")
+			}
+			headers = append(headers, Header{string(l[0]), strings.TrimLeft(string(l[1]), " ")})
+			continue
+		case smfirQuarantine:
+			quarantine = true
+			reason = string(bytes.TrimRight(data, "\x00"))
+			continue
+		case smfirChgheader:
+			mc.log.Debug("ignoring change header request from milter")
+			continue
+		case smfirContinue, smfirAccept:
+			if quarantine {
+				mc.verdict = Verdict{Action: ActionQuarantine, Message: reason}
+			}
+			mc.verdict.Headers = headers
+			return nil
+		}
+		if strings.IndexByte("+-2be", cmd) >= 0 {
+			// Modifications we didn't offer in negotiation: changing recipients, the body or
+			// the sender.
+			mc.log.Info("ignoring unsupported modification by milter", slog.String("command", string(cmd)))
+			continue
+		}
+		return mc.decision(cmd, data)
+	}
+}
+
+func (mc *milterConn) write(cmd byte, data []byte) error {
+	buf := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(data)))
+	buf[4] = cmd
+	buf = append(buf, data...)
+	if _, err := mc.conn.Write(buf); err != nil {
+		return fmt.Errorf("writing to milter: %w", err)
+	}
+	return nil
+}
+
+func (mc *milterConn) read() (byte, []byte, error) {
+	var lenbuf [4]byte
+	if _, err := io.ReadFull(mc.br, lenbuf[:]); err != nil {
+		return 0, nil, fmt.Errorf("reading from milter: %w", err)
+	}
+	n := binary.BigEndian.Uint32(lenbuf[:])
+	if n == 0 || n > milterMaxPacket {
+		return 0, nil, fmt.Errorf("milter: invalid packet length %d", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(mc.br, buf); err != nil {
+		return 0, nil, fmt.Errorf("reading from milter: %w", err)
+	}
+	return buf[0], buf[1:], nil
+}
+
+func cstring(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// readHeaders reads the header section of a message. Values include the
+// whitespace after the colon, and continuation lines joined with CRLF. The
+// offset of the body is returned.
+func readHeaders(r io.Reader) ([]Header, int64, error) {
+	br := bufio.NewReader(r)
+	var headers []Header
+	var offset int64
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			// Message without body.
+			return headers, offset, nil
+		} else if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		offset += int64(len(line))
+		text := strings.TrimRight(line, "\r\n")
+		if text == "" {
+			return headers, offset, nil
+		}
+		if (text[0] == ' ' || text[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Value += "\r\n" + text
+			continue
+		}
+		name, value, ok := strings.Cut(text, ":")
+		if !ok {
+			// Not a header, treat as start of body.
+			return headers, offset - int64(len(line)), nil
+		}
+		headers = append(headers, Header{strings.TrimRight(name, " \t"), value})
+		if err == io.EOF {
+			return headers, offset, nil
+		}
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"log"
 	"net"
 	"os"
-	"path/filepath"
 	"runtime/debug"
 	"sort"
 	"strconv"
@@ -20,6 +19,7 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/metrics"
@@ -505,6 +505,98 @@ func servectlcmd(ctx context.Context, ctl *ctl, shutdown func()) {
 		ctl.xcheck(err, "removing domain")
 		ctl.xwriteok()
 
+	case "dkimrotatestart":
+		/* protocol:
+		> "dkimrotatestart"
+		> domain
+		> grace period, duration, empty for default
+		< "ok" or error
+		< stream
+		*/
+		domain := ctl.xread()
+		grace := ctl.xread()
+		d, err := dns.ParseDomain(domain)
+		ctl.xcheck(err, "parsing domain")
+		var gracePeriod time.Duration
+		if grace != "" {
+			gracePeriod, err = time.ParseDuration(grace)
+			ctl.xcheck(err, "parsing grace period")
+		}
+		r, err := dkimrotate.Begin(ctx, ctl.log, d, gracePeriod)
+		ctl.xcheck(err, "starting dkim key rotation")
+		ctl.xwriteok()
+		xw := ctl.writer()
+		writeDKIMRotation(xw, r)
+		xw.xclose()
+
+	case "dkimrotatestatus":
+		/* protocol:
+		> "dkimrotatestatus"
+		> domain, empty for all
+		< "ok" or error
+		< stream
+		*/
+		domain := ctl.xread()
+		var l []dkimrotate.Rotation
+		if domain == "" {
+			var err error
+			l, err = dkimrotate.List(ctx)
+			ctl.xcheck(err, "listing dkim key rotations")
+		} else {
+			d, err := dns.ParseDomain(domain)
+			ctl.xcheck(err, "parsing domain")
+			r, err := dkimrotate.Get(ctx, d)
+			ctl.xcheck(err, "get dkim key rotation")
+			l = append(l, r)
+		}
+		ctl.xwriteok()
+		xw := ctl.writer()
+		for i, r := range l {
+			if i > 0 {
+				fmt.Fprintln(xw)
+			}
+			writeDKIMRotation(xw, r)
+		}
+		if len(l) == 0 {
+			fmt.Fprint(xw, "(no dkim key rotations in progress)\n")
+		}
+		xw.xclose()
+
+	case "dkimrotatecheck":
+		/* protocol:
+		> "dkimrotatecheck"
+		> domain
+		< "ok" or error
+		< stream
+		*/
+		domain := ctl.xread()
+		d, err := dns.ParseDomain(domain)
+		ctl.xcheck(err, "parsing domain")
+		r, err := dkimrotate.Check(ctx, ctl.log, dns.StrictResolver{Pkg: "dkimrotate"}, d)
+		ctl.xcheck(err, "checking dkim key rotation")
+		ctl.xwriteok()
+		xw := ctl.writer()
+		writeDKIMRotation(xw, r)
+		xw.xclose()
+
+	case "dkimrotatefinish", "dkimrotatecancel":
+		/* protocol:
+		> "dkimrotatefinish" or "dkimrotatecancel"
+		> domain
+		< "ok" or error
+		*/
+		domain := ctl.xread()
+		d, err := dns.ParseDomain(domain)
+		ctl.xcheck(err, "parsing domain")
+		if cmd == "dkimrotatefinish" {
+			err = dkimrotate.Finish(ctx, ctl.log, d)
+			ctl.xcheck(err, "finishing dkim key rotation")
+		} else {
+			err = dkimrotate.Cancel(ctx, ctl.log, d)
+			ctl.xcheck(err, "canceling dkim key rotation")
+		}
+		ctl.xwriteok()
+
 	case "accountadd":
 		/* protocol:
 		> "accountadd"
@@ -615,51 +707,9 @@ func servectlcmd(ctx context.Context, ctl *ctl, shutdown func()) {
 		}()
 
 		acc.WithWLock(func() {
-			conf, _ := acc.Conf()
-			if conf.JunkFilter == nil {
-				ctl.xcheck(store.ErrNoJunkFilter, "looking for junk filter")
-			}
-
-			// Remove existing junk filter files.
-			basePath := beacon.DataDirPath("accounts")
-			dbPath := filepath.Join(basePath, acc.Name, "junkfilter.db")
-			bloomPath := filepath.Join(basePath, acc.Name, "junkfilter.bloom")
-			err := os.Remove(dbPath)
-			log.Check(err, "removing old junkfilter database file", slog.String("path", dbPath))
-			err = os.Remove(bloomPath)
-			log.Check(err, "removing old junkfilter bloom filter file", slog.String("path", bloomPath))
-
-			// Open junk filter, this creates new files.
-			jf, _, err := acc.OpenJunkFilter(ctx, ctl.log)
-			ctl.xcheck(err, "open new junk filter")
-			defer func() {
-				if jf == nil {
-					return
-				}
-				err := jf.Close()
-				log.Check(err, "closing junk filter during cleanup")
-			}()
-
-			// Read through messages with junk or nonjunk flag set, and train them.
-			var total, trained int
-			q := bstore.QueryDB[store.Message](ctx, acc.DB)
-			q.FilterEqual("Expunged", false)
-			err = q.ForEach(func(m store.Message) error {
-				total++
-				ok, err := acc.TrainMessage(ctx, ctl.log, jf, m)
-				if ok {
-					trained++
-				}
-				return err
-			})
-			ctl.xcheck(err, "training messages")
-			ctl.log.Info("retrained messages", slog.Int("total", total), slog.Int("trained", trained))
-
-			// Close junk filter, marking success.
-			err = jf.Close()
-			jf = nil
-			ctl.xcheck(err, "closing junk filter")
+			_, _, err = acc.RetrainJunkFilter(ctx, ctl.log, nil)
 		})
+		ctl.xcheck(err, "retraining junk filter")
 		ctl.xwriteok()
 
 	case "recalculatemailboxcounts":
@@ -1008,3 +1058,36 @@ func servectlcmd(ctx context.Context, ctl *ctl, shutdown func()) {
 		return
 	}
 }
+
+// writeDKIMRotation writes the state of a dkim key rotation, including the dns
+// records that must be published for the new selectors.
+func writeDKIMRotation(w io.Writer, r dkimrotate.Rotation) {
+	now := time.Now()
+	phase := r.Phase(now)
+	fmt.Fprintf(w, "domain: %s\n", r.Domain)
+	fmt.Fprintf(w, "started: %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(w, "phase: %s\n", phase)
+	fmt.Fprintf(w, "old selectors: %s\n", strings.Join(r.OldSelectors, ", "))
+	fmt.Fprintf(w, "new selectors: %s\n", strings.Join(r.NewSelectors, ", "))
+	switch phase {
+	case dkimrotate.PhasePublish:
+		if !r.LastCheck.IsZero() {
+			fmt.Fprintf(w, "last dns check: %s, error: %s\n", r.LastCheck.Format(time.RFC3339), r.LastCheckError)
+		}
+		fmt.Fprintf(w, "\nPublish the following dns records. Signing switches to the new selectors once\nthe records are found in dns.\n\n")
+		records, err := dkimrotate.Records(r)
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+		for _, s := range records {
+			fmt.Fprintln(w, s)
+		}
+	case dkimrotate.PhaseGrace:
+		end := r.Switched.Add(r.GracePeriod)
+		fmt.Fprintf(w, "switched: %s\n", r.Switched.Format(time.RFC3339))
+		fmt.Fprintf(w, "\nSigning with the new selectors. Keep the dns records for the old selectors\npublished until %s.\n", end.Format(time.RFC3339))
+	case dkimrotate.PhaseRemove:
+		fmt.Fprintf(w, "switched: %s\n", r.Switched.Format(time.RFC3339))
+		fmt.Fprintf(w, "\nThe grace period has passed. Finish the rotation to remove the old selectors\nfrom the configuration, then remove their dns records.\n")
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dmarcdb"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/mlog"
@@ -99,6 +101,25 @@ func TestCtl(t *testing.T) {
 		ctlcmdConfigDomainAdd(ctl, dns.Domain{ASCII: "beacon2.example"}, "mjl", "")
 	})
 
+	// "dkimrotatestart"
+	defer dkimrotate.Close()
+	testctl(func(ctl *ctl) {
+		ctlcmdDKIMRotateStart(ctl, dns.Domain{ASCII: "beacon2.example"}, time.Hour)
+	})
+
+	// "dkimrotatestatus"
+	testctl(func(ctl *ctl) {
+		ctlcmdDKIMRotateStatus(ctl, dns.Domain{ASCII: "beacon2.example"})
+	})
+	testctl(func(ctl *ctl) {
+		ctlcmdDKIMRotateStatus(ctl, dns.Domain{})
+	})
+
+	// "dkimrotatecancel"
+	testctl(func(ctl *ctl) {
+		ctlcmdDKIMRotateCancel(ctl, dns.Domain{ASCII: "beacon2.example"})
+	})
+
 	// "accountadd"
 	testctl(func(ctl *ctl) {
 		ctlcmdConfigAccountAdd(ctl, "mjl2", "mjl2@beacon2.example")
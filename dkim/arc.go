@@ -0,0 +1,127 @@
+package dkim
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beaconio"
+)
+
+// ARC, ../rfc/8617, uses the DKIM signature format for its
+// ARC-Message-Signature header, and DKIM header canonicalization for its
+// ARC-Seal header. The functions below are used by package arc.
+
+var errNotARC = errors.New("not an ARC-Message-Signature header")
+
+// RawHeader is a header as it occurs in a message.
+type RawHeader struct {
+	LKey string // Key in lower-case.
+	Raw  []byte // Including key, colon, possibly multiple lines and trailing crlf.
+}
+
+// ParseRawHeaders returns the headers of msg, in order of occurrence.
+func ParseRawHeaders(msg io.ReaderAt) ([]RawHeader, error) {
+	hdrs, _, err := parseHeaders(bufio.NewReader(&beaconio.AtReader{R: msg}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrHeaderMalformed, err)
+	}
+	l := make([]RawHeader, len(hdrs))
+	for i, h := range hdrs {
+		l[i] = RawHeader{h.lkey, h.raw}
+	}
+	return l, nil
+}
+
+// RelaxedCanonicalHeader returns header s, including key, in relaxed canonical
+// form, without trailing crlf.
+func RelaxedCanonicalHeader(s string) (string, error) {
+	return relaxedCanonicalHeaderWithoutCRLF(s)
+}
+
+// ParseARCMessageSignature parses an ARC-Message-Signature header, which must
+// end in crlf.
+func ParseARCMessageSignature(buf []byte, smtputf8 bool) (*Sig, error) {
+	sig, _, err := parseSignature(buf, smtputf8)
+	if err == nil && sig.Instance == 0 {
+		err = errNotARC
+	}
+	return sig, err
+}
+
+// SignARCMessageSignature returns an ARC-Message-Signature header for the ARC
+// instance, for msg, signed by domain with the key from sel. ARC headers
+// and Authentication-Results headers are never signed, they are added and
+// removed by intermediaries.
+func SignARCMessageSignature(ctx context.Context, elog *slog.Logger, instance int, domain dns.Domain, sel Selector, smtputf8 bool, msg io.ReaderAt) (header string, rerr error) {
+	log := mlog.New("dkim", elog)
+	start := timeNow()
+	defer func() {
+		log.Debugx("arc message signature sign result", rerr,
+			slog.Int("instance", instance),
+			slog.Any("domain", domain),
+			slog.Bool("smtputf8", smtputf8),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	hdrs, bodyOffset, err := parseHeaders(bufio.NewReader(&beaconio.AtReader{R: msg}))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrHeaderMalformed, err)
+	}
+
+	var headers []string
+	for _, h := range sel.Headers {
+		lh := strings.ToLower(h)
+		if !strings.HasPrefix(lh, "arc-") && lh != "authentication-results" {
+			headers = append(headers, h)
+		}
+	}
+	sel.Headers = headers
+
+	sig := newSigWithDefaults()
+	sig.Instance = instance
+	sig.AlgorithmHash = sel.Hash
+	sig.Domain = domain
+	sig.Selector = sel.Domain
+	sig.SignedHeaders = signedHeaders(sel, hdrs)
+	sig.SignTime = timeNow().Unix()
+	return sign(sig, sel, hdrs, msg, bodyOffset, map[hashKey][]byte{})
+}
+
+// VerifyARCMessageSignature verifies ARC-Message-Signature header amsHeader, as
+// it occurs in msg and ending in crlf, against msg. The DKIM DNS record for the
+// selector and domain of the signature is looked up.
+func VerifyARCMessageSignature(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, smtputf8 bool, amsHeader []byte, msg io.ReaderAt) Result {
+	log := mlog.New("dkim", elog)
+
+	sig, verifySig, err := parseSignature(amsHeader, smtputf8)
+	if err == nil && sig.Instance == 0 {
+		err = errNotARC
+	}
+	if err != nil {
+		err := fmt.Errorf("parsing ARC-Message-Signature header: %w", err)
+		return Result{StatusPermerror, nil, nil, false, err}
+	}
+
+	h, canonHeaderSimple, canonDataSimple, err := checkSignatureParams(ctx, log, sig)
+	if err != nil {
+		return Result{StatusPermerror, sig, nil, false, err}
+	}
+
+	hdrs, bodyOffset, err := parseHeaders(bufio.NewReader(&beaconio.AtReader{R: msg}))
+	if err != nil {
+		return Result{StatusPermerror, sig, nil, false, fmt.Errorf("%w: %s", ErrHeaderMalformed, err)}
+	}
+
+	br := bufio.NewReader(&beaconio.AtReader{R: msg, Offset: int64(bodyOffset)})
+	status, record, authentic, err := verifySignature(ctx, log.Logger, resolver, sig, h, canonHeaderSimple, canonDataSimple, hdrs, verifySig, br, true)
+	return Result{status, sig, record, authentic, err}
+}
@@ -147,123 +147,138 @@ func Sign(ctx context.Context, elog *slog.Logger, localpart smtp.Localpart, doma
 		return "", fmt.Errorf("%w: message has %d from headers, need exactly 1", ErrFrom, nfrom)
 	}
 
-	type hashKey struct {
-		simple bool   // Canonicalization.
-		hash   string // lower-case hash.
-	}
-
 	var bodyHashes = map[hashKey][]byte{}
 
 	for _, sel := range selectors {
 		sig := newSigWithDefaults()
 		sig.Version = 1
-		switch sel.PrivateKey.(type) {
-		case *rsa.PrivateKey:
-			sig.AlgorithmSign = "rsa"
-			MetricSign.IncLabels("rsa")
-		case ed25519.PrivateKey:
-			sig.AlgorithmSign = "ed25519"
-			MetricSign.IncLabels("ed25519")
-		default:
-			return "", fmt.Errorf("internal error, unknown pivate key %T", sel.PrivateKey)
-		}
 		sig.AlgorithmHash = sel.Hash
 		sig.Domain = domain
 		sig.Selector = sel.Domain
 		sig.Identity = &Identity{&localpart, domain}
-		sig.SignedHeaders = append([]string{}, sel.Headers...)
-		if sel.SealHeaders {
-			// ../rfc/6376:2156
-			// Each time a header name is added to the signature, the next unused value is
-			// signed (in reverse order as they occur in the message). So we can add each
-			// header name as often as it occurs. But now we'll add the header names one
-			// additional time, preventing someone from adding one more header later on.
-			counts := map[string]int{}
-			for _, h := range hdrs {
-				counts[h.lkey]++
-			}
-			for _, h := range sel.Headers {
-				for j := counts[strings.ToLower(h)]; j > 0; j-- {
-					sig.SignedHeaders = append(sig.SignedHeaders, h)
-				}
-			}
-		}
+		sig.SignedHeaders = signedHeaders(sel, hdrs)
 		sig.SignTime = timeNow().Unix()
 		if sel.Expiration > 0 {
 			sig.ExpireTime = sig.SignTime + int64(sel.Expiration/time.Second)
 		}
 
-		sig.Canonicalization = "simple"
-		if sel.HeaderRelaxed {
-			sig.Canonicalization = "relaxed"
-		}
-		sig.Canonicalization += "/"
-		if sel.BodyRelaxed {
-			sig.Canonicalization += "relaxed"
-		} else {
-			sig.Canonicalization += "simple"
+		sigh, err := sign(sig, sel, hdrs, msg, bodyOffset, bodyHashes)
+		if err != nil {
+			return "", err
 		}
+		headers += sigh
+	}
 
-		h, hok := algHash(sig.AlgorithmHash)
-		if !hok {
-			return "", fmt.Errorf("unrecognized hash algorithm %q", sig.AlgorithmHash)
-		}
+	return headers, nil
+}
 
-		// We must now first calculate the hash over the body. Then include that hash in a
-		// new DKIM-Signature header. Then hash that and the signed headers into a data
-		// hash. Then that hash is finally signed and the signature included in the new
-		// DKIM-Signature header.
-		// ../rfc/6376:1700
+// hashKey is used to reuse body hashes for multiple signatures.
+type hashKey struct {
+	simple bool   // Canonicalization.
+	hash   string // lower-case hash.
+}
 
-		hk := hashKey{!sel.BodyRelaxed, strings.ToLower(sig.AlgorithmHash)}
-		if bh, ok := bodyHashes[hk]; ok {
-			sig.BodyHash = bh
-		} else {
-			br := bufio.NewReader(&beaconio.AtReader{R: msg, Offset: int64(bodyOffset)})
-			bh, err = bodyHash(h.New(), !sel.BodyRelaxed, br)
-			if err != nil {
-				return "", err
+// signedHeaders returns the header names to sign for sel, with names added again
+// for sealing.
+func signedHeaders(sel Selector, hdrs []header) []string {
+	l := append([]string{}, sel.Headers...)
+	if sel.SealHeaders {
+		// ../rfc/6376:2156
+		// Each time a header name is added to the signature, the next unused value is
+		// signed (in reverse order as they occur in the message). So we can add each
+		// header name as often as it occurs. But now we'll add the header names one
+		// additional time, preventing someone from adding one more header later on.
+		counts := map[string]int{}
+		for _, h := range hdrs {
+			counts[h.lkey]++
+		}
+		for _, h := range sel.Headers {
+			for j := counts[strings.ToLower(h)]; j > 0; j-- {
+				l = append(l, h)
 			}
-			sig.BodyHash = bh
-			bodyHashes[hk] = bh
 		}
+	}
+	return l
+}
 
-		sigh, err := sig.Header()
-		if err != nil {
-			return "", err
-		}
-		verifySig := []byte(strings.TrimSuffix(sigh, "\r\n"))
+// sign sets the algorithm, canonicalization, body hash and signature of sig,
+// based on sel and the message, and returns the resulting header.
+func sign(sig *Sig, sel Selector, hdrs []header, msg io.ReaderAt, bodyOffset int, bodyHashes map[hashKey][]byte) (string, error) {
+	switch sel.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		sig.AlgorithmSign = "rsa"
+		MetricSign.IncLabels("rsa")
+	case ed25519.PrivateKey:
+		sig.AlgorithmSign = "ed25519"
+		MetricSign.IncLabels("ed25519")
+	default:
+		return "", fmt.Errorf("internal error, unknown pivate key %T", sel.PrivateKey)
+	}
+
+	sig.Canonicalization = "simple"
+	if sel.HeaderRelaxed {
+		sig.Canonicalization = "relaxed"
+	}
+	sig.Canonicalization += "/"
+	if sel.BodyRelaxed {
+		sig.Canonicalization += "relaxed"
+	} else {
+		sig.Canonicalization += "simple"
+	}
+
+	h, hok := algHash(sig.AlgorithmHash)
+	if !hok {
+		return "", fmt.Errorf("unrecognized hash algorithm %q", sig.AlgorithmHash)
+	}
 
-		dh, err := dataHash(h.New(), !sel.HeaderRelaxed, sig, hdrs, verifySig)
+	// We must now first calculate the hash over the body. Then include that hash in a
+	// new DKIM-Signature header. Then hash that and the signed headers into a data
+	// hash. Then that hash is finally signed and the signature included in the new
+	// DKIM-Signature header.
+	// ../rfc/6376:1700
+
+	hk := hashKey{!sel.BodyRelaxed, strings.ToLower(sig.AlgorithmHash)}
+	if bh, ok := bodyHashes[hk]; ok {
+		sig.BodyHash = bh
+	} else {
+		br := bufio.NewReader(&beaconio.AtReader{R: msg, Offset: int64(bodyOffset)})
+		bh, err := bodyHash(h.New(), !sel.BodyRelaxed, br)
 		if err != nil {
 			return "", err
 		}
+		sig.BodyHash = bh
+		bodyHashes[hk] = bh
+	}
 
-		switch key := sel.PrivateKey.(type) {
-		case *rsa.PrivateKey:
-			sig.Signature, err = key.Sign(cryptorand.Reader, dh, h)
-			if err != nil {
-				return "", fmt.Errorf("signing data: %v", err)
-			}
-		case ed25519.PrivateKey:
-			// crypto.Hash(0) indicates data isn't prehashed (ed25519ph). We are using
-			// PureEdDSA to sign the sha256 hash. ../rfc/8463:123 ../rfc/8032:427
-			sig.Signature, err = key.Sign(cryptorand.Reader, dh, crypto.Hash(0))
-			if err != nil {
-				return "", fmt.Errorf("signing data: %v", err)
-			}
-		default:
-			return "", fmt.Errorf("unsupported private key type: %s", err)
-		}
+	sigh, err := sig.Header()
+	if err != nil {
+		return "", err
+	}
+	verifySig := []byte(strings.TrimSuffix(sigh, "\r\n"))
+
+	dh, err := dataHash(h.New(), !sel.HeaderRelaxed, sig, hdrs, verifySig)
+	if err != nil {
+		return "", err
+	}
 
-		sigh, err = sig.Header()
+	switch key := sel.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		sig.Signature, err = key.Sign(cryptorand.Reader, dh, h)
 		if err != nil {
-			return "", err
+			return "", fmt.Errorf("signing data: %v", err)
 		}
-		headers += sigh
+	case ed25519.PrivateKey:
+		// crypto.Hash(0) indicates data isn't prehashed (ed25519ph). We are using
+		// PureEdDSA to sign the sha256 hash. ../rfc/8463:123 ../rfc/8032:427
+		sig.Signature, err = key.Sign(cryptorand.Reader, dh, crypto.Hash(0))
+		if err != nil {
+			return "", fmt.Errorf("signing data: %v", err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported private key type: %s", err)
 	}
 
-	return headers, nil
+	return sig.Header()
 }
 
 // Lookup looks up the DKIM TXT record and parses it.
@@ -39,6 +39,10 @@ type Sig struct {
 	SignTime         int64     // Unix epoch. -1 if unset. Field "t".
 	ExpireTime       int64     // Unix epoch. -1 if unset. Field "x".
 	CopiedHeaders    []string  // Copied header fields. Field "z".
+
+	// For ARC-Message-Signature headers only, the ARC instance, starting at 1. Field
+	// "i", instead of the identity. Zero for DKIM-Signature headers. ../rfc/8617
+	Instance int
 }
 
 // Identity is used for the optional i= field in a DKIM-Signature header. It uses
@@ -75,16 +79,22 @@ func (s Sig) Algorithm() string {
 }
 
 // Header returns the DKIM-Signature header in string form, to be prepended to a
-// message, including DKIM-Signature field name and trailing \r\n.
+// message, including DKIM-Signature field name and trailing \r\n. If Instance is
+// set, an ARC-Message-Signature header is returned instead.
 func (s *Sig) Header() (string, error) {
 	// ../rfc/6376:1021
 	// todo: make a higher-level writer that accepts pairs, and only folds to next line when needed.
 	w := &message.HeaderWriter{}
-	w.Addf("", "DKIM-Signature: v=%d;", s.Version)
+	if s.Instance > 0 {
+		// ARC-Message-Signature has no version field. ../rfc/8617
+		w.Addf("", "ARC-Message-Signature: i=%d;", s.Instance)
+	} else {
+		w.Addf("", "DKIM-Signature: v=%d;", s.Version)
+	}
 	// Domain names must always be in ASCII. ../rfc/6376:1115 ../rfc/6376:1187 ../rfc/6376:1303
 	w.Addf(" ", "d=%s;", s.Domain.ASCII)
 	w.Addf(" ", "s=%s;", s.Selector.ASCII)
-	if s.Identity != nil {
+	if s.Identity != nil && s.Instance == 0 {
 		w.Addf(" ", "i=%s;", s.Identity.String()) // todo: Is utf-8 ok here?
 	}
 	w.Addf(" ", "a=%s;", s.Algorithm())
@@ -180,9 +190,12 @@ var (
 	errSigMissingTag     = errors.New("missing required tag")
 	errSigUnknownVersion = errors.New("unknown version")
 	errSigBodyHash       = errors.New("bad body hash size given algorithm")
+	errSigInstance       = errors.New("arc instance (i=) must be between 1 and 50")
 )
 
-// parseSignatures returns the parsed form of a DKIM-Signature header.
+// parseSignatures returns the parsed form of a DKIM-Signature header, or of an
+// ARC-Message-Signature header, which has the same syntax, except that it has no
+// version and i= is the ARC instance.
 //
 // buf must end in crlf, as it should have occurred in the mail message.
 //
@@ -214,7 +227,8 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 	seen := map[string]struct{}{}
 	p := parser{s: string(buf), smtputf8: smtputf8}
 	name := p.xhdrName(false)
-	if !strings.EqualFold(name, "DKIM-Signature") {
+	arc := strings.EqualFold(name, "ARC-Message-Signature")
+	if !arc && !strings.EqualFold(name, "DKIM-Signature") {
 		xerrorf("%w", errSigHeader)
 	}
 	p.wsp()
@@ -284,6 +298,14 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 			// ../rfc/6376:1134
 			ds.SignedHeaders = p.xsignedHeaderFields()
 		case "i":
+			if arc {
+				// ARC instance. ../rfc/8617
+				ds.Instance = int(p.xnumber(2))
+				if ds.Instance < 1 || ds.Instance > 50 {
+					xerrorf("%w: %d", errSigInstance, ds.Instance)
+				}
+				break
+			}
 			// ../rfc/6376:1171
 			id := p.xauid()
 			ds.Identity = &id
@@ -325,6 +347,10 @@ func parseSignature(buf []byte, smtputf8 bool) (sig *Sig, verifySig []byte, err
 
 	// ../rfc/6376:2532
 	required := []string{"v", "a", "b", "bh", "d", "h", "s"}
+	if arc {
+		// ARC-Message-Signature requires i= instead of v=. ../rfc/8617
+		required[0] = "i"
+	}
 	for _, req := range required {
 		if _, ok := seen[req]; !ok {
 			xerrorf("%w: %q", errSigMissingTag, req)
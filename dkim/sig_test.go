@@ -137,6 +137,25 @@ func TestSig(t *testing.T) {
 	}
 	test("dkim-signature: v = 1 ; a=ed25519-sha256; s=test; d=beacon.example; h=from; b=dGVzdAo=; bh=LjkN2rUhrS3zKXfH2vNgUzz5ERRJkgP9CURXBX0JP0Q= ; i=\"test \\\"\\\\test\"@beacon.example\r\n", true, sig4, nil)
 
+	// ARC-Message-Signature, with instance instead of version and identity.
+	sig5 := &Sig{
+		AlgorithmSign:    "ed25519",
+		AlgorithmHash:    "sha256",
+		Signature:        xbase64("dGVzdAo="),
+		BodyHash:         xbase64("LjkN2rUhrS3zKXfH2vNgUzz5ERRJkgP9CURXBX0JP0Q="),
+		Domain:           xdomain("beacon.example"),
+		SignedHeaders:    []string{"from"},
+		Selector:         xdomain("test"),
+		Canonicalization: "relaxed/relaxed",
+		Length:           -1,
+		SignTime:         -1,
+		ExpireTime:       -1,
+		Instance:         2,
+	}
+	test("arc-message-signature: i=2; a=ed25519-sha256; c=relaxed/relaxed; s=test; d=beacon.example; h=from; b=dGVzdAo=; bh=LjkN2rUhrS3zKXfH2vNgUzz5ERRJkgP9CURXBX0JP0Q=\r\n", true, sig5, nil)
+	test("arc-message-signature: i=51; a=ed25519-sha256; s=test; d=beacon.example; h=from; b=dGVzdAo=; bh=LjkN2rUhrS3zKXfH2vNgUzz5ERRJkgP9CURXBX0JP0Q=\r\n", true, nil, errSigInstance)
+	test("arc-message-signature: v=1; a=ed25519-sha256; s=test; d=beacon.example; h=from; b=dGVzdAo=; bh=LjkN2rUhrS3zKXfH2vNgUzz5ERRJkgP9CURXBX0JP0Q=\r\n", true, nil, errSigMissingTag)
+
 	test("", true, nil, errSigMissingCRLF)
 	test("other: ...\r\n", true, nil, errSigHeader)
 	test("dkim-signature: v=2\r\n", true, nil, errSigUnknownVersion)
@@ -0,0 +1,426 @@
+// Package dkimrotate implements rotation of DKIM keys for configured domains.
+//
+// A rotation goes through phases:
+//
+//   - Publish: New selectors with fresh keys are added to the configuration of
+//     the domain, one for each selector used for signing, but are not yet used.
+//     The DNS TXT records of the new selectors must be published.
+//   - Once the DNS records of all new selectors resolve with the new public keys,
+//     signing switches to the new selectors.
+//   - Grace: The old selectors are no longer used for signing, but their DNS
+//     records must remain published for a while, for messages still in transit and
+//     for verification of recently sent messages.
+//   - Remove: After the grace period, the old selectors can be removed from the
+//     configuration and DNS, which finishes the rotation.
+//
+// DNS records are checked periodically in the background. The state of
+// rotations is stored in a database.
+package dkimrotate
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var pkglog = mlog.New("dkimrotate", nil)
+
+var timeNow = time.Now // Tests override this.
+
+// DefaultGracePeriod is the time old selectors remain published after signing
+// switched to the new selectors, if no other period is specified.
+const DefaultGracePeriod = 7 * 24 * time.Hour
+
+var (
+	ErrInProgress = errors.New("dkim key rotation already in progress for domain")
+	ErrNotFound   = errors.New("no dkim key rotation in progress for domain")
+	ErrPhase      = errors.New("dkim key rotation is not in the required phase")
+)
+
+// Phase of a rotation.
+type Phase string
+
+const (
+	PhasePublish Phase = "publish" // Waiting for the DNS records of the new selectors.
+	PhaseGrace   Phase = "grace"   // Signing with new selectors, old selectors must remain published.
+	PhaseRemove  Phase = "remove"  // Grace period is over, old selectors can be removed.
+)
+
+// Rotation is an in-progress DKIM key rotation for a domain.
+type Rotation struct {
+	Domain       string        // Unicode.
+	Started      time.Time     `bstore:"default now"`
+	GracePeriod  time.Duration // Time to keep old selectors published after switching.
+	OldSelectors []string      // Selectors in use for signing and ARC sealing when rotation started.
+	NewSelectors []string      // Replacements, in same order as OldSelectors.
+
+	LastCheck      time.Time // Of DNS records of new selectors.
+	LastCheckError string    // Empty if records of all new selectors were found.
+
+	Switched time.Time // When signing switched to new selectors. Zero while in publish phase.
+
+	RemovalLogged bool // Whether we logged that the old selectors can be removed.
+}
+
+// Phase returns the phase of the rotation at time now.
+func (r Rotation) Phase(now time.Time) Phase {
+	if r.Switched.IsZero() {
+		return PhasePublish
+	} else if now.Before(r.Switched.Add(r.GracePeriod)) {
+		return PhaseGrace
+	}
+	return PhaseRemove
+}
+
+var DBTypes = []any{Rotation{}} // Types stored in DB.
+var DB *bstore.DB               // Exported for backups.
+var mutex sync.Mutex
+
+func database(ctx context.Context) (rdb *bstore.DB, rerr error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB == nil {
+		p := beacon.DataDirPath("dkimrotate.db")
+		os.MkdirAll(filepath.Dir(p), 0770)
+		db, err := bstore.Open(ctx, p, &bstore.Options{Timeout: 5 * time.Second, Perm: 0660}, DBTypes...)
+		if err != nil {
+			return nil, err
+		}
+		DB = db
+	}
+	return DB, nil
+}
+
+// Init opens the database.
+func Init() error {
+	_, err := database(beacon.Shutdown)
+	return err
+}
+
+// Close closes the database.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB != nil {
+		err := DB.Close()
+		pkglog.Check(err, "closing database")
+		DB = nil
+	}
+}
+
+// List returns all rotations in progress.
+func List(ctx context.Context) ([]Rotation, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bstore.QueryDB[Rotation](ctx, db).SortAsc("Domain").List()
+}
+
+// Get returns the rotation in progress for domain, or ErrNotFound.
+func Get(ctx context.Context, domain dns.Domain) (Rotation, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return Rotation{}, err
+	}
+	r := Rotation{Domain: domain.Name()}
+	err = db.Get(ctx, &r)
+	if err == bstore.ErrAbsent {
+		return Rotation{}, ErrNotFound
+	}
+	return r, err
+}
+
+// Begin starts a rotation for domain. New keys are generated for the selectors
+// used for signing and ARC sealing. If gracePeriod is zero, DefaultGracePeriod is
+// used.
+func Begin(ctx context.Context, log mlog.Log, domain dns.Domain, gracePeriod time.Duration) (Rotation, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return Rotation{}, err
+	}
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+
+	// The check for a rotation in progress and the insert of the new rotation are
+	// done in a single transaction, so concurrent calls can't both start a rotation.
+	var r Rotation
+	var names []string
+	err = db.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Get(&Rotation{Domain: domain.Name()}); err == nil {
+			return ErrInProgress
+		} else if err != bstore.ErrAbsent {
+			return err
+		}
+
+		domConf, ok := beacon.Conf.Domain(domain)
+		if !ok {
+			return fmt.Errorf("unknown domain")
+		}
+		old := append([]string{}, domConf.DKIM.Sign...)
+		if domConf.DKIM.ARCSeal != "" && !contains(old, domConf.DKIM.ARCSeal) {
+			old = append(old, domConf.DKIM.ARCSeal)
+		}
+		if len(old) == 0 {
+			return fmt.Errorf("domain has no dkim selectors for signing")
+		}
+
+		var err error
+		names, err = beacon.DKIMSelectorsGenerate(ctx, domain, old)
+		if err != nil {
+			return fmt.Errorf("generating new dkim selectors: %v", err)
+		}
+
+		r = Rotation{
+			Domain:       domain.Name(),
+			Started:      timeNow(),
+			GracePeriod:  gracePeriod,
+			OldSelectors: old,
+			NewSelectors: names,
+		}
+		if err := tx.Insert(&r); err != nil {
+			return fmt.Errorf("storing rotation: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if names != nil {
+			// Don't leave the new selectors behind.
+			xerr := beacon.DKIMSelectorsRemove(ctx, domain, names)
+			log.Check(xerr, "removing new dkim selectors after error")
+		}
+		return Rotation{}, err
+	}
+	log.Info("dkim key rotation started", slog.Any("domain", domain), slog.Any("oldselectors", r.OldSelectors), slog.Any("newselectors", names))
+	return r, nil
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Records returns the DNS TXT records that must be published for the new
+// selectors of a rotation, in zone file format.
+func Records(r Rotation) ([]string, error) {
+	domain, err := dns.ParseDomain(r.Domain)
+	if err != nil {
+		return nil, fmt.Errorf("parsing domain: %v", err)
+	}
+	domConf, ok := beacon.Conf.Domain(domain)
+	if !ok {
+		return nil, fmt.Errorf("unknown domain")
+	}
+	var records []string
+	for _, name := range r.NewSelectors {
+		sel, ok := domConf.DKIM.Selectors[name]
+		if !ok {
+			return nil, fmt.Errorf("selector %q not found in configuration", name)
+		}
+		txt, err := beacon.DKIMRecord(sel)
+		if err != nil {
+			return nil, fmt.Errorf("making dns txt record for selector %q: %v", name, err)
+		}
+		records = append(records, fmt.Sprintf("%s._domainkey.%s.   TXT %s", name, domain.ASCII, beacon.TXTStrings(txt)))
+	}
+	return records, nil
+}
+
+// checkDNS returns an error if the DNS record of one of the new selectors is
+// absent or does not have the public key of the selector.
+func checkDNS(ctx context.Context, log mlog.Log, resolver dns.Resolver, domain dns.Domain, r Rotation) error {
+	domConf, ok := beacon.Conf.Domain(domain)
+	if !ok {
+		return fmt.Errorf("unknown domain")
+	}
+	for _, name := range r.NewSelectors {
+		sel, ok := domConf.DKIM.Selectors[name]
+		if !ok {
+			return fmt.Errorf("selector %q not found in configuration", name)
+		}
+		status, record, _, _, err := dkim.Lookup(ctx, log.Logger, resolver, dns.Domain{ASCII: name}, domain)
+		if err != nil {
+			return fmt.Errorf("looking up dns record for selector %q: %s: %v", name, status, err)
+		}
+		pubKey, ok := record.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pubKey.Equal(sel.Key.Public()) {
+			return fmt.Errorf("dns record for selector %q does not have the public key of the new selector", name)
+		}
+	}
+	return nil
+}
+
+// Check looks up the DNS records of the new selectors of a rotation in the
+// publish phase. If all records are present with the new public keys, signing
+// switches to the new selectors and the rotation enters the grace phase. The
+// updated rotation is returned.
+func Check(ctx context.Context, log mlog.Log, resolver dns.Resolver, domain dns.Domain) (Rotation, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return Rotation{}, err
+	}
+	r, err := Get(ctx, domain)
+	if err != nil {
+		return Rotation{}, err
+	}
+	if r.Phase(timeNow()) != PhasePublish {
+		return r, nil
+	}
+
+	dnsErr := checkDNS(ctx, log, resolver, domain, r)
+	r.LastCheck = timeNow()
+	r.LastCheckError = ""
+	if dnsErr != nil {
+		r.LastCheckError = dnsErr.Error()
+		log.Debugx("dns records for new dkim selectors not yet present", dnsErr, slog.Any("domain", domain))
+	} else {
+		replace := map[string]string{}
+		for i, name := range r.OldSelectors {
+			replace[name] = r.NewSelectors[i]
+		}
+		if err := beacon.DKIMSignReplace(ctx, domain, replace); err != nil {
+			return Rotation{}, fmt.Errorf("switching to new dkim selectors: %v", err)
+		}
+		r.Switched = timeNow()
+		log.Info("dns records for new dkim selectors found, switched signing to new selectors", slog.Any("domain", domain), slog.Any("selectors", r.NewSelectors))
+	}
+	if err := db.Update(ctx, &r); err != nil {
+		return Rotation{}, fmt.Errorf("updating rotation: %v", err)
+	}
+	return r, nil
+}
+
+// Finish removes the old selectors of a rotation in the remove phase from the
+// configuration, and removes the rotation. The DNS records of the old selectors
+// should be removed afterwards.
+func Finish(ctx context.Context, log mlog.Log, domain dns.Domain) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := Get(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if r.Phase(timeNow()) != PhaseRemove {
+		return fmt.Errorf("%w: grace period for old selectors has not yet passed", ErrPhase)
+	}
+	if err := beacon.DKIMSelectorsRemove(ctx, domain, r.OldSelectors); err != nil {
+		return fmt.Errorf("removing old dkim selectors: %v", err)
+	}
+	if err := db.Delete(ctx, &r); err != nil {
+		return fmt.Errorf("removing rotation: %v", err)
+	}
+	log.Info("dkim key rotation finished", slog.Any("domain", domain), slog.Any("removedselectors", r.OldSelectors))
+	return nil
+}
+
+// Cancel aborts a rotation in the publish phase, removing the new selectors from
+// the configuration.
+func Cancel(ctx context.Context, log mlog.Log, domain dns.Domain) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := Get(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if r.Phase(timeNow()) != PhasePublish {
+		return fmt.Errorf("%w: already signing with new selectors", ErrPhase)
+	}
+	if err := beacon.DKIMSelectorsRemove(ctx, domain, r.NewSelectors); err != nil {
+		return fmt.Errorf("removing new dkim selectors: %v", err)
+	}
+	if err := db.Delete(ctx, &r); err != nil {
+		return fmt.Errorf("removing rotation: %v", err)
+	}
+	log.Info("dkim key rotation canceled", slog.Any("domain", domain))
+	return nil
+}
+
+// Start launches a goroutine that periodically checks the DNS records of
+// rotations in the publish phase, switching to the new selectors when they are
+// published, and logs when old selectors can be removed.
+func Start(resolver dns.Resolver) {
+	go func() {
+		log := pkglog
+
+		defer func() {
+			// In case of panic don't take the whole program down.
+			x := recover()
+			if x != nil {
+				log.Error("recover from panic", slog.Any("panic", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Dkimrotate)
+			}
+		}()
+
+		timer := time.NewTimer(time.Minute)
+		defer timer.Stop()
+		for {
+			select {
+			case <-beacon.Shutdown.Done():
+				return
+			case <-timer.C:
+			}
+
+			checkRotations(beacon.Shutdown, log, resolver)
+			timer.Reset(time.Hour)
+		}
+	}()
+}
+
+func checkRotations(ctx context.Context, log mlog.Log, resolver dns.Resolver) {
+	db, err := database(ctx)
+	if err != nil {
+		log.Errorx("opening dkim key rotation database", err)
+		return
+	}
+	l, err := List(ctx)
+	if err != nil {
+		log.Errorx("listing dkim key rotations", err)
+		return
+	}
+	for _, r := range l {
+		domain, err := dns.ParseDomain(r.Domain)
+		if err != nil {
+			log.Errorx("parsing domain of dkim key rotation", err, slog.String("domain", r.Domain))
+			continue
+		}
+		switch r.Phase(timeNow()) {
+		case PhasePublish:
+			_, err := Check(ctx, log, resolver, domain)
+			log.Check(err, "checking dkim key rotation", slog.Any("domain", domain))
+		case PhaseRemove:
+			if r.RemovalLogged {
+				continue
+			}
+			log.Info("grace period of dkim key rotation has passed, old selectors can be removed by finishing the rotation", slog.Any("domain", domain), slog.Any("selectors", r.OldSelectors))
+			r.RemovalLogged = true
+			err := db.Update(ctx, &r)
+			log.Check(err, "updating dkim key rotation")
+		}
+	}
+}
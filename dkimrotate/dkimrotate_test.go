@@ -0,0 +1,178 @@
+package dkimrotate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+)
+
+var ctxbg = context.Background()
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	// The rotation modifies the dynamic config file and writes key files, so work on
+	// a copy.
+	os.RemoveAll("../testdata/dkimrotate/data")
+	defer os.RemoveAll("../testdata/dkimrotate/data")
+	configDir := filepath.FromSlash("../testdata/dkimrotate/data/config")
+	err := os.MkdirAll(configDir, 0770)
+	tcheck(t, err, "mkdir")
+	for _, name := range []string{"beacon.conf", "domains.conf", "testsel.ed25519key.pkcs8.pem"} {
+		buf, err := os.ReadFile(filepath.Join("../testdata/dkimrotate", name))
+		tcheck(t, err, "read testdata")
+		err = os.WriteFile(filepath.Join(configDir, name), buf, 0660)
+		tcheck(t, err, "write testdata")
+	}
+
+	beacon.Shutdown = ctxbg
+	beacon.ConfigStaticPath = filepath.Join(configDir, "beacon.conf")
+	beacon.ConfigDynamicPath = filepath.Join(configDir, "domains.conf")
+	beacon.MustLoadConfig(true, false)
+
+	err = Init()
+	tcheck(t, err, "init")
+	defer Close()
+
+	log := mlog.New("dkimrotate", nil)
+
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	domain := dns.Domain{ASCII: "beacon.example"}
+
+	_, err = Get(ctxbg, domain)
+	if err != ErrNotFound {
+		t.Fatalf("get without rotation: got err %v, expected ErrNotFound", err)
+	}
+
+	r, err := Begin(ctxbg, log, domain, time.Hour)
+	tcheck(t, err, "begin")
+	if len(r.NewSelectors) != 1 || r.Phase(now) != PhasePublish || strings.Join(r.OldSelectors, ",") != "testsel" {
+		t.Fatalf("unexpected rotation %#v", r)
+	}
+	newSel := r.NewSelectors[0]
+
+	_, err = Begin(ctxbg, log, domain, time.Hour)
+	if err != ErrInProgress {
+		t.Fatalf("second begin: got err %v, expected ErrInProgress", err)
+	}
+
+	domConf, _ := beacon.Conf.Domain(domain)
+	if _, ok := domConf.DKIM.Selectors[newSel]; !ok || strings.Join(domConf.DKIM.Sign, ",") != "testsel" {
+		t.Fatalf("new selector not in config or signing changed early: %#v", domConf.DKIM)
+	}
+
+	records, err := Records(r)
+	tcheck(t, err, "records")
+	if len(records) != 1 || !strings.HasPrefix(records[0], newSel+"._domainkey.beacon.example.") {
+		t.Fatalf("unexpected records %q", records)
+	}
+
+	// Record not yet in DNS.
+	resolver := dns.MockResolver{TXT: map[string][]string{}}
+	r, err = Check(ctxbg, log, resolver, domain)
+	tcheck(t, err, "check")
+	if r.Phase(now) != PhasePublish || r.LastCheckError == "" {
+		t.Fatalf("rotation switched without dns record: %#v", r)
+	}
+
+	// Record with another key.
+	oldRecord, err := beacon.DKIMRecord(domConf.DKIM.Selectors["testsel"])
+	tcheck(t, err, "dkim record")
+	resolver.TXT[newSel+"._domainkey.beacon.example."] = []string{oldRecord}
+	r, err = Check(ctxbg, log, resolver, domain)
+	tcheck(t, err, "check")
+	if r.Phase(now) != PhasePublish || r.LastCheckError == "" {
+		t.Fatalf("rotation switched with wrong dns record: %#v", r)
+	}
+
+	// Finish is not possible while waiting for dns.
+	err = Finish(ctxbg, log, domain)
+	if !errors.Is(err, ErrPhase) {
+		t.Fatalf("finish in publish phase: got err %v, expected ErrPhase", err)
+	}
+
+	// Correct record, signing switches.
+	newRecord, err := beacon.DKIMRecord(domConf.DKIM.Selectors[newSel])
+	tcheck(t, err, "dkim record")
+	resolver.TXT[newSel+"._domainkey.beacon.example."] = []string{newRecord}
+	r, err = Check(ctxbg, log, resolver, domain)
+	tcheck(t, err, "check")
+	if r.Phase(now) != PhaseGrace || r.LastCheckError != "" {
+		t.Fatalf("rotation did not switch: %#v", r)
+	}
+	domConf, _ = beacon.Conf.Domain(domain)
+	if strings.Join(domConf.DKIM.Sign, ",") != newSel {
+		t.Fatalf("signing did not switch to new selector: %#v", domConf.DKIM.Sign)
+	}
+
+	// Messages are signed with the new selector.
+	selectors := beacon.DKIMSelectors(domConf.DKIM)
+	if len(selectors) != 1 || selectors[0].Domain.ASCII != newSel {
+		t.Fatalf("unexpected signing selectors %#v", selectors)
+	}
+	_, err = dkim.Sign(ctxbg, log.Logger, "mjl", domain, selectors, false, strings.NewReader("From: <mjl@beacon.example>\r\n\r\ntest\r\n"))
+	tcheck(t, err, "dkim sign")
+
+	// Not possible to cancel after switching, or to finish during grace period.
+	err = Cancel(ctxbg, log, domain)
+	if !errors.Is(err, ErrPhase) {
+		t.Fatalf("cancel in grace phase: got err %v, expected ErrPhase", err)
+	}
+	err = Finish(ctxbg, log, domain)
+	if !errors.Is(err, ErrPhase) {
+		t.Fatalf("finish in grace phase: got err %v, expected ErrPhase", err)
+	}
+
+	// After grace period, the background check logs removal once.
+	now = now.Add(2 * time.Hour)
+	checkRotations(ctxbg, log, resolver)
+	r, err = Get(ctxbg, domain)
+	tcheck(t, err, "get")
+	if r.Phase(now) != PhaseRemove || !r.RemovalLogged {
+		t.Fatalf("unexpected rotation after grace period %#v", r)
+	}
+
+	err = Finish(ctxbg, log, domain)
+	tcheck(t, err, "finish")
+	domConf, _ = beacon.Conf.Domain(domain)
+	if _, ok := domConf.DKIM.Selectors["testsel"]; ok || len(domConf.DKIM.Selectors) != 1 {
+		t.Fatalf("old selector not removed: %#v", domConf.DKIM.Selectors)
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "old", "testsel.ed25519key.pkcs8.pem")); err != nil {
+		t.Fatalf("old private key not moved: %v", err)
+	}
+	_, err = Get(ctxbg, domain)
+	if err != ErrNotFound {
+		t.Fatalf("get after finish: got err %v, expected ErrNotFound", err)
+	}
+
+	// Start another rotation and cancel it.
+	r, err = Begin(ctxbg, log, domain, 0)
+	tcheck(t, err, "begin")
+	if r.GracePeriod != DefaultGracePeriod {
+		t.Fatalf("got grace period %v, expected default %v", r.GracePeriod, DefaultGracePeriod)
+	}
+	err = Cancel(ctxbg, log, domain)
+	tcheck(t, err, "cancel")
+	domConf, _ = beacon.Conf.Domain(domain)
+	if _, ok := domConf.DKIM.Selectors[r.NewSelectors[0]]; ok || len(domConf.DKIM.Selectors) != 1 {
+		t.Fatalf("new selector not removed after cancel: %#v", domConf.DKIM.Selectors)
+	}
+}
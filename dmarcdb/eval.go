@@ -50,13 +50,13 @@ var (
 	metricReport = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "beacon_dmarcdb_report_queued_total",
-			Help: "Total messages with DMARC aggregate/error reports queued.",
+			Help: "Total messages with DMARC aggregate/error/failure reports queued.",
 		},
 	)
 	metricReportError = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "beacon_dmarcdb_report_error_total",
-			Help: "Total errors while composing or queueing DMARC aggregate/error reports.",
+			Help: "Total errors while composing or queueing DMARC aggregate/error/failure reports.",
 		},
 	)
 )
@@ -101,7 +101,7 @@ type Evaluation struct {
 	Addresses []string
 
 	// Policy used for evaluation. We don't store the "fo" field for failure reporting
-	// options, since we don't send failure reports for individual messages.
+	// options, failure reports for individual messages are sent during delivery.
 	PolicyPublished dmarcrpt.PolicyPublished
 
 	// For "row" in a report record.
@@ -518,81 +518,26 @@ func parseRecipient(log mlog.Log, uri dmarc.URI) (r recipient, ok bool) {
 	return r, true
 }
 
-func removeEvaluations(ctx context.Context, log mlog.Log, db *bstore.DB, endTime time.Time, domain string) {
-	q := bstore.QueryDB[Evaluation](ctx, db)
-	q.FilterLess("Evaluated", endTime)
-	q.FilterNonzero(Evaluation{PolicyDomain: domain})
-	_, err := q.Delete()
-	log.Check(err, "removing evaluations after processing for dmarc aggregate report")
-}
-
-// replaceable for testing.
-var queueAdd = queue.Add
-
-func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver, db *bstore.DB, endTime time.Time, domain string) (cleanup bool, rerr error) {
-	dom, err := dns.ParseDomain(domain)
-	if err != nil {
-		return false, fmt.Errorf("parsing domain for sending reports: %v", err)
-	}
-
-	// We'll cleanup records by default.
-	cleanup = true
-	// If we encounter a temporary error we cancel cleanup of evaluations on error.
-	tempError := false
-
-	defer func() {
-		if !cleanup || tempError {
-			log.Debug("not cleaning up evaluations after attempting to send dmarc aggregate report")
-		} else {
-			removeEvaluations(ctx, log, db, endTime, domain)
-		}
-	}()
-
-	// We're going to build up this report.
-	report := dmarcrpt.Feedback{
-		Version: "1.0",
-		ReportMetadata: dmarcrpt.ReportMetadata{
-			OrgName: beacon.Conf.Static.HostnameDomain.ASCII,
-			Email:   "postmaster@" + beacon.Conf.Static.HostnameDomain.ASCII,
-			// ReportID and DateRange are set after we've seen evaluations.
-			// Errors is filled below when we encounter problems.
-		},
-		// We'll fill the records below.
-		Records: []dmarcrpt.ReportRecord{},
-	}
-
-	var errors []string // For report.ReportMetaData.Errors
-
-	// Check if we should be sending a report at all: if there are rua URIs in the
-	// current DMARC record. The interval may have changed too, but we'll flush out our
-	// evaluations regardless. We always use the latest DMARC record when sending, but
-	// we'll lump all policies of the last interval into one report.
-	// ../rfc/7489:1714
-	status, _, record, _, _, err := dmarc.Lookup(ctx, log.Logger, resolver, dom)
-	if err != nil {
-		// todo future: we could perhaps still send this report, assuming the values we know. in case of temporary error, we could also schedule again regardless of next interval hour (we would now only retry a 24h-interval report after 24h passed).
-		// Remove records unless it was a temporary error. We'll try again next round.
-		cleanup = status != dmarc.StatusTemperror
-		return cleanup, fmt.Errorf("looking up current dmarc record for reporting address: %v", err)
-	}
-
-	var recipients []recipient
-
-	// Gather all aggregate reporting addresses to try to send to. We'll start with
-	// those in the initial DMARC record, but will follow external reporting addresses
-	// and possibly update the list.
-	for _, uri := range record.AggregateReportAddresses {
+// reportRecipients returns the recipients for reports about policy domain dom,
+// for reporting addresses uris from its DMARC record, with field the name of the
+// DMARC record field, for messages. We start with the addresses in the DMARC
+// record, but will follow external reporting addresses through their "_report"
+// DMARC record, with their addresses returned by extURIs, and possibly update the
+// list. Problems are returned in errors, for inclusion in reports. If tempError is
+// set, a temporary error occurred and reporting should be tried again later.
+func reportRecipients(ctx context.Context, log mlog.Log, resolver dns.Resolver, dom dns.Domain, field string, uris []dmarc.URI, extURIs func(r *dmarc.Record) []dmarc.URI) (recipients []recipient, errors []string, tempError bool) {
+	for _, uri := range uris {
 		r, ok := parseRecipient(log, uri)
 		if !ok {
 			continue
 		}
 
-		// Check if domain of rua recipient has the same organizational domain as for the
+		// Check if domain of recipient has the same organizational domain as for the
 		// evaluations. If not, we need to verify we are allowed to send.
-		ruaOrgDom := publicsuffix.Lookup(ctx, log.Logger, r.address.Domain)
+		rcptOrgDom := publicsuffix.Lookup(ctx, log.Logger, r.address.Domain)
 		evalOrgDom := publicsuffix.Lookup(ctx, log.Logger, dom)
 
-		if ruaOrgDom == evalOrgDom {
+		if rcptOrgDom == evalOrgDom {
 			recipients = append(recipients, r)
 			continue
 		}
@@ -601,7 +546,7 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 		// <policydomain>._report._dmarc.<host> lookup.
 		// ../rfc/7489:1556
 		accepts, status, records, _, _, err := dmarc.LookupExternalReportsAccepted(ctx, log.Logger, resolver, evalOrgDom, r.address.Domain)
-		log.Debugx("checking if rua address with different organization domain has opted into receiving dmarc reports", err,
+		log.Debugx("checking if "+field+" address with different organization domain has opted into receiving dmarc reports", err,
 			slog.Any("policydomain", evalOrgDom),
 			slog.Any("destinationdomain", r.address.Domain),
 			slog.Bool("accepts", accepts),
@@ -614,7 +559,7 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 			errors = append(errors, "temporary error checking authorization for report delegation to external address")
 		}
 		if !accepts {
-			errors = append(errors, fmt.Sprintf("rua %s is external domain that does not opt-in to receiving dmarc records through _report dmarc record", r.address))
+			errors = append(errors, fmt.Sprintf("%s %s is external domain that does not opt-in to receiving dmarc records through _report dmarc record", field, r.address))
 			continue
 		}
 
@@ -629,16 +574,16 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 		foundReplacement := false
 		rlog := log.With(slog.Any("followedaddress", uri.Address))
 		for _, record := range records {
-			for _, exturi := range record.AggregateReportAddresses {
+			for _, exturi := range extURIs(record) {
 				extr, ok := parseRecipient(rlog, exturi)
 				if !ok {
 					continue
 				}
 				if extr.address.Domain != r.address.Domain {
-					rlog.Debug("rua address in external _report dmarc record has different host than initial dmarc record, ignoring new name", slog.Any("externaladdress", extr.address))
-					errors = append(errors, fmt.Sprintf("rua %s is external domain with a replacement address %s with different host", r.address, extr.address))
+					rlog.Debug(field+" address in external _report dmarc record has different host than initial dmarc record, ignoring new name", slog.Any("externaladdress", extr.address))
+					errors = append(errors, fmt.Sprintf("%s %s is external domain with a replacement address %s with different host", field, r.address, extr.address))
 				} else {
-					rlog.Debug("using replacement rua address from external _report dmarc record", slog.Any("externaladdress", extr.address))
+					rlog.Debug("using replacement "+field+" address from external _report dmarc record", slog.Any("externaladdress", extr.address))
 					foundReplacement = true
 					recipients = append(recipients, extr)
 				}
@@ -648,6 +593,80 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 			recipients = append(recipients, r)
 		}
 	}
+	return
+}
+
+// suppressed returns whether outgoing reports to addr are currently suppressed.
+func suppressed(ctx context.Context, db *bstore.DB, addr smtp.Address) (bool, error) {
+	q := bstore.QueryDB[SuppressAddress](ctx, db)
+	q.FilterNonzero(SuppressAddress{ReportingAddress: addr.Path().String()})
+	q.FilterGreater("Until", time.Now())
+	exists, err := q.Exists()
+	if err != nil {
+		return false, fmt.Errorf("querying suppress list: %v", err)
+	}
+	return exists, nil
+}
+
+func removeEvaluations(ctx context.Context, log mlog.Log, db *bstore.DB, endTime time.Time, domain string) {
+	q := bstore.QueryDB[Evaluation](ctx, db)
+	q.FilterLess("Evaluated", endTime)
+	q.FilterNonzero(Evaluation{PolicyDomain: domain})
+	_, err := q.Delete()
+	log.Check(err, "removing evaluations after processing for dmarc aggregate report")
+}
+
+// replaceable for testing.
+var queueAdd = queue.Add
+
+func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver, db *bstore.DB, endTime time.Time, domain string) (cleanup bool, rerr error) {
+	dom, err := dns.ParseDomain(domain)
+	if err != nil {
+		return false, fmt.Errorf("parsing domain for sending reports: %v", err)
+	}
+
+	// We'll cleanup records by default.
+	cleanup = true
+	// If we encounter a temporary error we cancel cleanup of evaluations on error.
+	tempError := false
+
+	defer func() {
+		if !cleanup || tempError {
+			log.Debug("not cleaning up evaluations after attempting to send dmarc aggregate report")
+		} else {
+			removeEvaluations(ctx, log, db, endTime, domain)
+		}
+	}()
+
+	// We're going to build up this report.
+	report := dmarcrpt.Feedback{
+		Version: "1.0",
+		ReportMetadata: dmarcrpt.ReportMetadata{
+			OrgName: beacon.Conf.Static.HostnameDomain.ASCII,
+			Email:   "postmaster@" + beacon.Conf.Static.HostnameDomain.ASCII,
+			// ReportID and DateRange are set after we've seen evaluations.
+			// Errors is filled below when we encounter problems.
+		},
+		// We'll fill the records below.
+		Records: []dmarcrpt.ReportRecord{},
+	}
+
+	// Check if we should be sending a report at all: if there are rua URIs in the
+	// current DMARC record. The interval may have changed too, but we'll flush out our
+	// evaluations regardless. We always use the latest DMARC record when sending, but
+	// we'll lump all policies of the last interval into one report.
+	// ../rfc/7489:1714
+	status, _, record, _, _, err := dmarc.Lookup(ctx, log.Logger, resolver, dom)
+	if err != nil {
+		// todo future: we could perhaps still send this report, assuming the values we know. in case of temporary error, we could also schedule again regardless of next interval hour (we would now only retry a 24h-interval report after 24h passed).
+		// Remove records unless it was a temporary error. We'll try again next round.
+		cleanup = status != dmarc.StatusTemperror
+		return cleanup, fmt.Errorf("looking up current dmarc record for reporting address: %v", err)
+	}
+
+	// Gather all aggregate reporting addresses to try to send to.
+	recipients, errors, tempErr := reportRecipients(ctx, log, resolver, dom, "rua", record.AggregateReportAddresses, func(r *dmarc.Record) []dmarc.URI { return r.AggregateReportAddresses })
+	tempError = tempErr
 
 	if len(recipients) == 0 {
 		// No reports requested, perfectly fine, no work to do for us.
@@ -726,7 +745,7 @@ func sendReportDomain(ctx context.Context, log mlog.Log, resolver dns.Resolver,
 	// but shouldn't hurt.
 	report.ReportMetadata.ReportID = endTime.UTC().Format("20060102.15") + "." + beacon.ReceivedID(first.ID)
 
-	// We may include errors we encountered when composing the report. We
+	// We may include errors we encountered when gathering recipients. We
 	// don't currently include errors about dmarc evaluations, e.g. DNS
 	// lookup errors during incoming deliveries.
 	report.ReportMetadata.Errors = errors
@@ -821,14 +840,9 @@ Period: %s - %s UTC
 	var queued bool
 	for _, rcpt := range recipients {
 		// If recipient is on suppression list, we won't queue the reporting message.
-		q := bstore.QueryDB[SuppressAddress](ctx, db)
-		q.FilterNonzero(SuppressAddress{ReportingAddress: rcpt.address.Path().String()})
-		q.FilterGreater("Until", time.Now())
-		exists, err := q.Exists()
-		if err != nil {
-			return false, fmt.Errorf("querying suppress list: %v", err)
-		}
-		if exists {
+		if exists, err := suppressed(ctx, db, rcpt.address); err != nil {
+			return false, err
+		} else if exists {
 			log.Info("suppressing outgoing dmarc aggregate report", slog.Any("reportingaddress", rcpt.address))
 			continue
 		}
@@ -985,14 +999,9 @@ Submitting-URI: %s
 
 	for _, rcpt := range recipients {
 		// If recipient is on suppression list, we won't queue the reporting message.
-		q := bstore.QueryDB[SuppressAddress](ctx, db)
-		q.FilterNonzero(SuppressAddress{ReportingAddress: rcpt.Address.Path().String()})
-		q.FilterGreater("Until", time.Now())
-		exists, err := q.Exists()
-		if err != nil {
-			return fmt.Errorf("querying suppress list: %v", err)
-		}
-		if exists {
+		if exists, err := suppressed(ctx, db, rcpt.Address); err != nil {
+			return err
+		} else if exists {
 			log.Info("suppressing outgoing dmarc error report", slog.Any("reportingaddress", rcpt.Address))
 			continue
 		}
@@ -0,0 +1,413 @@
+package dmarcdb
+
+// Failure reports, also known as forensic reports, are sent for individual
+// messages that fail DMARC. ../rfc/7489
+//
+// They use the Abuse Reporting Format (ARF) with authentication failure
+// extensions. ../rfc/5965 ../rfc/6591
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dmarc"
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/beaconio"
+	"github.com/qompassai/beacon/beaconvar"
+	"github.com/qompassai/beacon/queue"
+	"github.com/qompassai/beacon/smtp"
+	"github.com/qompassai/beacon/spf"
+	"github.com/qompassai/beacon/store"
+)
+
+const (
+	// Default maximum number of failure reports per reported domain per hour.
+	failureReportsDefaultMaxPerHour = 10
+
+	// Maximum number of failure reports for all domains per hour. Each incoming
+	// message with a spoofed From domain could otherwise cause an outgoing report.
+	failureReportsMaxTotalPerHour = 1000
+
+	// Messages larger than this are only reported with their headers.
+	failureReportMaxBodyMessageSize = 1024 * 1024
+)
+
+// Failure is an incoming message that failed authentication, for which a failure
+// report can be sent.
+type Failure struct {
+	PolicyDomain    dns.Domain    // Domain where DMARC policy was found.
+	Record          *dmarc.Record // DMARC record with "ruf" and "fo" fields.
+	FromDomain      dns.Domain    // Domain in message From header, the reported domain.
+	AlignedDKIMPass bool
+	AlignedSPFPass  bool
+	DKIMResults     []dkim.Result
+	SPFResult       spf.Status
+	SourceIP        net.IP
+	MailFrom        smtp.Path
+	RcptTo          []smtp.Path // Our recipients, redacted in the report.
+	Arrival         time.Time
+	AuthResults     message.AuthResults // As added to the message during delivery.
+	DeliveryResult  string              // "delivered", "spam", "policy", "reject" or "other". ../rfc/6591
+	SMTPUTF8        bool                // Whether message was delivered with SMTPUTF8.
+}
+
+// authFailure returns the type of failure to report, based on the failure
+// reporting options ("fo") of the DMARC record: "dmarc", "dkim" or "spf". If the
+// failure should not be reported, an empty string is returned.
+func (f Failure) authFailure() string {
+	// ../rfc/7489
+	opts := f.Record.FailureReportingOptions
+	if len(opts) == 0 {
+		opts = []string{"0"}
+	}
+	if slices.Contains(opts, "0") && !f.AlignedDKIMPass && !f.AlignedSPFPass || slices.Contains(opts, "1") && (!f.AlignedDKIMPass || !f.AlignedSPFPass) {
+		return "dmarc"
+	}
+	if slices.Contains(opts, "d") && f.failedDKIM() != nil {
+		return "dkim"
+	}
+	if slices.Contains(opts, "s") && f.SPFResult == spf.StatusFail {
+		return "spf"
+	}
+	return ""
+}
+
+// failedDKIM returns the first DKIM signature that failed verification, if any.
+func (f Failure) failedDKIM() *dkim.Sig {
+	for _, r := range f.DKIMResults {
+		if r.Status == dkim.StatusFail && r.Sig != nil {
+			return r.Sig
+		}
+	}
+	return nil
+}
+
+// Rate limiting of failure reports, with counts for the current hour.
+var failureLimiter struct {
+	sync.Mutex
+	hour   int64          // Unix time divided by an hour, for counts.
+	counts map[string]int // By reporting address.
+	total  int
+}
+
+// failureRateLimitAdd returns whether a failure report to reporting address addr
+// may be sent. If add is set and the report may be sent, it is counted.
+func failureRateLimitAdd(addr string, maxPerHour int, add bool) bool {
+	if maxPerHour == 0 {
+		maxPerHour = failureReportsDefaultMaxPerHour
+	}
+
+	failureLimiter.Lock()
+	defer failureLimiter.Unlock()
+
+	hour := time.Now().Unix() / 3600
+	if hour != failureLimiter.hour || failureLimiter.counts == nil {
+		failureLimiter.hour = hour
+		failureLimiter.counts = map[string]int{}
+		failureLimiter.total = 0
+	}
+	if failureLimiter.counts[addr] >= maxPerHour || failureLimiter.total >= failureReportsMaxTotalPerHour {
+		return false
+	}
+	if add {
+		failureLimiter.counts[addr]++
+		failureLimiter.total++
+	}
+	return true
+}
+
+// SendFailureReport queues a failure report about an incoming message to the
+// "ruf" addresses of the DMARC record, if failure reports are enabled in the
+// configuration, the "fo" field of the DMARC record asks for a report for this
+// failure. Reporting addresses are skipped when they reached their rate limit. The
+// original message is read from msg, of size msgSize.
+func SendFailureReport(ctx context.Context, log mlog.Log, resolver dns.Resolver, f Failure, msg io.ReaderAt, msgSize int64) error {
+	conf := beacon.Conf.Static.DMARCFailureReports
+	if conf == nil || beacon.Conf.Static.NoOutgoingDMARCReports || f.Record == nil || len(f.Record.FailureReportAddresses) == 0 {
+		return nil
+	}
+
+	authFailure := f.authFailure()
+	if authFailure == "" {
+		return nil
+	}
+	log = log.With(slog.Any("policydomain", f.PolicyDomain), slog.String("authfailure", authFailure))
+
+	db, err := evalDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	// We follow the same rules for external reporting addresses as for aggregate
+	// reports. ../rfc/7489
+	allRecipients, _, _ := reportRecipients(ctx, log, resolver, f.PolicyDomain, "ruf", f.Record.FailureReportAddresses, func(r *dmarc.Record) []dmarc.URI { return r.FailureReportAddresses })
+
+	// Skip reporting addresses on the suppression list or that reached their rate
+	// limit. The rate limit is only counted when the report is queued below.
+	var recipients []recipient
+	for _, rcpt := range allRecipients {
+		if exists, err := suppressed(ctx, db, rcpt.address); err != nil {
+			return err
+		} else if exists {
+			log.Info("suppressing outgoing dmarc failure report", slog.Any("reportingaddress", rcpt.address))
+		} else if !failureRateLimitAdd(rcpt.address.String(), conf.MaxPerHour, false) {
+			log.Info("not sending dmarc failure report due to rate limit", slog.Any("reportingaddress", rcpt.address))
+		} else {
+			recipients = append(recipients, rcpt)
+		}
+	}
+	if len(recipients) == 0 {
+		log.Debug("no failure reporting addresses to send to")
+		return nil
+	}
+
+	// We include the full message only if configured, and if it is not too large. We
+	// don't include the body of messages that need SMTPUTF8: We would have to send the
+	// report with SMTPUTF8, which remote reporting addresses may not support.
+	var orig []byte
+	headersOnly := !conf.IncludeBody || msgSize > failureReportMaxBodyMessageSize || f.SMTPUTF8
+	if headersOnly {
+		orig, err = message.ReadHeaders(bufio.NewReader(&beaconio.AtReader{R: msg}))
+		if err != nil && errors.Is(err, message.ErrHeaderSeparator) {
+			// Whole message is a header.
+			orig, err = io.ReadAll(&beaconio.AtReader{R: msg})
+		}
+	} else {
+		orig, err = io.ReadAll(&beaconio.AtReader{R: msg})
+	}
+	if err != nil {
+		return fmt.Errorf("reading message for dmarc failure report: %v", err)
+	}
+	orig = redact(orig, f.RcptTo)
+
+	// Machine-readable part of the report. ../rfc/5965 ../rfc/6591
+	var feedback strings.Builder
+	field := func(k, v string) {
+		fmt.Fprintf(&feedback, "%s: %s\r\n", k, v)
+	}
+	field("Feedback-Type", "auth-failure")
+	field("User-Agent", "beacon/"+beaconvar.Version)
+	field("Version", "1")
+	field("Original-Mail-From", "<"+f.MailFrom.DSNString(false)+">")
+	for _, rcpt := range f.RcptTo {
+		field("Original-Rcpt-To", "<"+redactedPath(rcpt).DSNString(false)+">")
+	}
+	field("Arrival-Date", f.Arrival.Format(message.RFC5322Z))
+	field("Source-IP", f.SourceIP.String())
+	field("Reported-Domain", f.FromDomain.ASCII)
+	feedback.WriteString(f.AuthResults.Header())
+	field("Auth-Failure", authFailure)
+	if authFailure == "dmarc" {
+		// ../rfc/7489
+		var aligned []string
+		if f.AlignedDKIMPass {
+			aligned = append(aligned, "dkim")
+		}
+		if f.AlignedSPFPass {
+			aligned = append(aligned, "spf")
+		}
+		if len(aligned) == 0 {
+			aligned = []string{"none"}
+		}
+		field("Identity-Alignment", strings.Join(aligned, ", "))
+	} else if sig := f.failedDKIM(); authFailure == "dkim" && sig != nil {
+		// ../rfc/6591
+		field("DKIM-Domain", sig.Domain.ASCII)
+		field("DKIM-Selector", sig.Selector.ASCII)
+	}
+	if f.DeliveryResult != "" {
+		field("Delivery-Result", f.DeliveryResult)
+	}
+
+	msgf, err := store.CreateMessageTemp(log, "dmarcfailurereportout")
+	if err != nil {
+		return fmt.Errorf("creating temporary message file for outgoing dmarc failure report: %v", err)
+	}
+	defer store.CloseRemoveTempFile(log, msgf, "message with generated dmarc failure report")
+
+	from := smtp.Address{Localpart: "postmaster", Domain: beacon.Conf.Static.HostnameDomain}
+
+	subject := fmt.Sprintf("DMARC failure report for %s", f.FromDomain.ASCII)
+	text := fmt.Sprintf(`Attached is a DMARC failure report about a message received by us with your
+domain in the message From header, that failed authentication. You are
+receiving this message because your address is specified in the "ruf" field of
+the DMARC record for your domain. Addresses of our recipients are redacted.
+
+Reported domain: %s
+Source IP: %s
+Authentication failure: %s
+Arrival date: %s
+`, f.FromDomain, f.SourceIP, authFailure, f.Arrival.Format(message.RFC5322Z))
+
+	var addrs []message.NameAddress
+	for _, rcpt := range recipients {
+		addrs = append(addrs, message.NameAddress{Address: rcpt.address})
+	}
+
+	msgPrefix, has8bit, smtputf8, messageID, err := composeFailureReport(ctx, log, msgf, from, addrs, subject, text, feedback.String(), orig, headersOnly)
+	if err != nil {
+		return fmt.Errorf("composing message with outgoing dmarc failure report: %v", err)
+	}
+
+	msgInfo, err := msgf.Stat()
+	if err != nil {
+		return fmt.Errorf("stat message with outgoing dmarc failure report: %v", err)
+	}
+	reportSize := int64(len(msgPrefix)) + msgInfo.Size()
+	for _, rcpt := range recipients {
+		if rcpt.maxSize > 0 && reportSize > int64(rcpt.maxSize) {
+			log.Debug("dmarc failure report too large for recipient", slog.Any("recipient", rcpt.address), slog.Int64("size", reportSize))
+			continue
+		}
+		if !failureRateLimitAdd(rcpt.address.String(), conf.MaxPerHour, true) {
+			log.Info("not sending dmarc failure report due to rate limit", slog.Any("reportingaddress", rcpt.address))
+			continue
+		}
+
+		qm := queue.MakeMsg(beacon.Conf.Static.Postmaster.Account, from.Path(), rcpt.address.Path(), has8bit, smtputf8, reportSize, messageID, []byte(msgPrefix), nil)
+		// Don't try as long as regular deliveries, and stop before we would send the
+		// delayed DSN. Though we also won't send that due to IsDMARCReport.
+		qm.MaxAttempts = 5
+		qm.IsDMARCReport = true
+
+		if err := queueAdd(ctx, log, &qm, msgf); err != nil {
+			log.Errorx("queueing message with dmarc failure report", err)
+			metricReportError.Inc()
+		} else {
+			log.Debug("dmarc failure report queued", slog.Any("recipient", rcpt.address))
+			metricReport.Inc()
+		}
+	}
+	return nil
+}
+
+// redactedPath returns p with its localpart replaced. ../rfc/6590
+func redactedPath(p smtp.Path) smtp.Path {
+	return smtp.Path{Localpart: "redacted", IPDomain: p.IPDomain}
+}
+
+// redact replaces the addresses of our recipients in buf with redacted
+// addresses, so reports don't reveal who received a message.
+func redact(buf []byte, rcpts []smtp.Path) []byte {
+	for _, rcpt := range rcpts {
+		for _, s := range []string{rcpt.XString(false), rcpt.XString(true)} {
+			re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(s))
+			buf = re.ReplaceAllLiteral(buf, []byte(redactedPath(rcpt).XString(false)))
+		}
+	}
+	return buf
+}
+
+func composeFailureReport(ctx context.Context, log mlog.Log, mf *os.File, fromAddr smtp.Address, recipients []message.NameAddress, subject, text, feedback string, orig []byte, headersOnly bool) (msgPrefix string, has8bit, smtputf8 bool, messageID string, rerr error) {
+	xc := message.NewComposer(mf, 100*1024*1024)
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+
+	// We only use smtputf8 if we have to, with a utf-8 localpart. For IDNA, we use ASCII domains.
+	for _, a := range recipients {
+		if a.Address.Localpart.IsInternational() {
+			xc.SMTPUTF8 = true
+			break
+		}
+	}
+
+	xc.HeaderAddrs("From", []message.NameAddress{{Address: fromAddr}})
+	xc.HeaderAddrs("To", recipients)
+	xc.Subject(subject)
+	messageID = fmt.Sprintf("<%s>", beacon.MessageIDGen(xc.SMTPUTF8))
+	xc.Header("Message-Id", messageID)
+	xc.Header("Date", time.Now().Format(message.RFC5322Z))
+	xc.Header("User-Agent", "beacon/"+beaconvar.Version)
+	xc.Header("MIME-Version", "1.0")
+
+	// Multipart report, with a text/plain, the feedback report and the original
+	// message or its headers. ../rfc/5965
+	mp := multipart.NewWriter(xc)
+	xc.Header("Content-Type", fmt.Sprintf(`multipart/report; report-type=feedback-report; boundary="%s"`, mp.Boundary()))
+	xc.Line()
+
+	textBody, ct, cte := xc.TextPart(text)
+	textHdr := textproto.MIMEHeader{}
+	textHdr.Set("Content-Type", ct)
+	textHdr.Set("Content-Transfer-Encoding", cte)
+	textp, err := mp.CreatePart(textHdr)
+	xc.Checkf(err, "adding text part to message")
+	_, err = textp.Write(textBody)
+	xc.Checkf(err, "writing text part")
+
+	feedbackHdr := textproto.MIMEHeader{}
+	feedbackHdr.Set("Content-Type", "message/feedback-report")
+	feedbackHdr.Set("Content-Transfer-Encoding", "7BIT")
+	feedbackp, err := mp.CreatePart(feedbackHdr)
+	xc.Checkf(err, "adding feedback report part to message")
+	_, err = feedbackp.Write([]byte(feedback))
+	xc.Checkf(err, "writing feedback report part")
+
+	orig8bit := slices.ContainsFunc(orig, func(b byte) bool { return b >= 0x80 })
+	origHdr := textproto.MIMEHeader{}
+	if headersOnly && orig8bit {
+		// ../rfc/6533
+		origHdr.Set("Content-Type", "text/rfc822-headers; charset=utf-8")
+		origHdr.Set("Content-Transfer-Encoding", "BASE64")
+	} else if headersOnly {
+		origHdr.Set("Content-Type", "text/rfc822-headers")
+		origHdr.Set("Content-Transfer-Encoding", "7BIT")
+	} else if orig8bit {
+		// Message/rfc822 cannot have a base64 transfer encoding. ../rfc/2046
+		origHdr.Set("Content-Type", "message/rfc822")
+		origHdr.Set("Content-Transfer-Encoding", "8BIT")
+		xc.Has8bit = true
+	} else {
+		origHdr.Set("Content-Type", "message/rfc822")
+		origHdr.Set("Content-Transfer-Encoding", "7BIT")
+	}
+	origp, err := mp.CreatePart(origHdr)
+	xc.Checkf(err, "adding original message part to message")
+	if headersOnly && orig8bit {
+		wc := beaconio.Base64Writer(origp)
+		_, err = io.Copy(wc, bytes.NewReader(orig))
+		xc.Checkf(err, "writing original message headers")
+		err = wc.Close()
+		xc.Checkf(err, "flushing original message headers")
+	} else {
+		_, err = origp.Write(orig)
+		xc.Checkf(err, "writing original message")
+	}
+
+	err = mp.Close()
+	xc.Checkf(err, "closing multipart")
+
+	xc.Flush()
+
+	msgPrefix = dkimSign(ctx, log, fromAddr, xc.SMTPUTF8, mf)
+
+	return msgPrefix, xc.Has8bit, xc.SMTPUTF8, messageID, nil
+}
@@ -0,0 +1,176 @@
+package dmarcdb
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dmarc"
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/beaconio"
+	"github.com/qompassai/beacon/queue"
+	"github.com/qompassai/beacon/smtp"
+	"github.com/qompassai/beacon/spf"
+)
+
+func TestFailureReport(t *testing.T) {
+	os.RemoveAll("../testdata/dmarcdb/data")
+	beacon.Context = ctxbg
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/dmarcdb/beacon.conf")
+	beacon.MustLoadConfig(true, false)
+	EvalDB = nil
+
+	db, err := evalDB(ctxbg)
+	tcheckf(t, err, "database")
+	defer func() {
+		EvalDB.Close()
+		EvalDB = nil
+	}()
+
+	beacon.Conf.Static.DMARCFailureReports = &config.DMARCFailureReports{MaxPerHour: 3}
+	defer func() {
+		beacon.Conf.Static.DMARCFailureReports = nil
+	}()
+	failureLimiter.counts = nil
+
+	log := mlog.New("dmarcdb", nil)
+
+	resolver := dns.MockResolver{
+		TXT: map[string][]string{
+			"_dmarc.sender.example.": {"v=DMARC1; p=reject; ruf=mailto:dmarcfail@sender.example"},
+		},
+	}
+
+	msg := strings.ReplaceAll(`From: <spoofed@sender.example>
+To: <mjl@beacon.example>
+Cc: <MJL@Beacon.Example>, <other@beacon.example>
+Subject: test
+
+secret body
+`, "\n", "\r\n")
+
+	rcptTo := smtp.Path{Localpart: "mjl", IPDomain: dns.IPDomain{Domain: dns.Domain{ASCII: "beacon.example"}}}
+	failure := Failure{
+		PolicyDomain: dns.Domain{ASCII: "sender.example"},
+		FromDomain:   dns.Domain{ASCII: "sender.example"},
+		DKIMResults: []dkim.Result{
+			{Status: dkim.StatusFail, Sig: &dkim.Sig{Domain: dns.Domain{ASCII: "sender.example"}, Selector: dns.Domain{ASCII: "sel"}}},
+		},
+		SPFResult:      spf.StatusFail,
+		SourceIP:       net.ParseIP("10.1.2.3"),
+		MailFrom:       smtp.Path{Localpart: "spoofed", IPDomain: dns.IPDomain{Domain: dns.Domain{ASCII: "sender.example"}}},
+		RcptTo:         []smtp.Path{rcptTo},
+		Arrival:        time.Now(),
+		AuthResults:    message.AuthResults{Hostname: "mail.beacon.example", Methods: []message.AuthMethod{{Method: "dmarc", Result: "fail"}}},
+		DeliveryResult: "reject",
+	}
+
+	var reports []string
+	queueAdd = func(ctx context.Context, log mlog.Log, qm *queue.Msg, msgFile *os.File) error {
+		buf, err := io.ReadAll(&beaconio.AtReader{R: msgFile})
+		tcheckf(t, err, "read report message")
+		reports = append(reports, qm.Recipient().String()+"\n"+string(qm.MsgPrefix)+string(buf))
+		return nil
+	}
+	defer func() {
+		queueAdd = queue.Add
+	}()
+
+	test := func(dmarcTXT string, f Failure, expReport bool, expContains ...string) {
+		t.Helper()
+
+		reports = nil
+		resolver.TXT["_dmarc.sender.example."] = []string{dmarcTXT}
+		_, _, record, _, _, err := dmarc.Lookup(ctxbg, log.Logger, resolver, f.PolicyDomain)
+		tcheckf(t, err, "dmarc lookup")
+		f.Record = record
+
+		err = SendFailureReport(ctxbg, log, resolver, f, strings.NewReader(msg), int64(len(msg)))
+		tcheckf(t, err, "send failure report")
+		if len(reports) > 1 || len(reports) == 1 != expReport {
+			t.Fatalf("got %d reports, expected report %v", len(reports), expReport)
+		}
+		if !expReport {
+			return
+		}
+		report := reports[0]
+		for _, s := range expContains {
+			if !strings.Contains(report, s) {
+				t.Fatalf("report does not contain %q:\n%s", s, report)
+			}
+		}
+		for _, s := range []string{"mjl@", "MJL@"} {
+			if strings.Contains(report, s) {
+				t.Fatalf("report contains unredacted recipient %q:\n%s", s, report)
+			}
+		}
+	}
+
+	const ruf = "v=DMARC1; p=reject; ruf=mailto:dmarcfail@sender.example"
+
+	// Default fo=0, both dkim and spf unaligned, headers only.
+	test(ruf, failure, true,
+		"dmarcfail@sender.example\n",
+		"report-type=feedback-report",
+		"Feedback-Type: auth-failure\r\n",
+		"Auth-Failure: dmarc\r\n",
+		"Identity-Alignment: none\r\n",
+		"Original-Rcpt-To: <redacted@beacon.example>\r\n",
+		"Source-IP: 10.1.2.3\r\n",
+		"Reported-Domain: sender.example\r\n",
+		"Content-Type: text/rfc822-headers",
+		"Cc: <redacted@beacon.example>, <other@beacon.example>",
+	)
+	if strings.Contains(reports[0], "secret body") {
+		t.Fatalf("headers-only report contains body")
+	}
+
+	// DMARC passes due to aligned dkim, not reported with fo=0, but with fo=1.
+	f := failure
+	f.AlignedDKIMPass = true
+	test(ruf, f, false)
+	test(ruf+"; fo=1", f, true, "Auth-Failure: dmarc\r\n", "Identity-Alignment: dkim\r\n")
+
+	// With fo=d and fo=s, any failing dkim signature or spf is reported.
+	f.AlignedSPFPass = true
+	test(ruf+"; fo=1", f, false)
+	test(ruf+"; fo=d", f, true, "Auth-Failure: dkim\r\n", "DKIM-Domain: sender.example\r\n", "DKIM-Selector: sel\r\n")
+
+	// Rate limit reached, but only for the reporting address that was sent to.
+	test(ruf, failure, false)
+	test(ruf+",mailto:dmarcfail2@sender.example", failure, true, "dmarcfail2@sender.example\n")
+	failureLimiter.counts = nil
+
+	// Full message included.
+	beacon.Conf.Static.DMARCFailureReports.IncludeBody = true
+	test(ruf+"; fo=s", f, true, "Auth-Failure: spf\r\n", "Content-Type: message/rfc822", "secret body")
+	beacon.Conf.Static.DMARCFailureReports.IncludeBody = false
+
+	// External reporting address without authorization.
+	test("v=DMARC1; p=reject; ruf=mailto:dmarcfail@other.example", failure, false)
+
+	// External reporting address with authorization.
+	resolver.TXT["sender.example._report._dmarc.other.example."] = []string{"v=DMARC1"}
+	test("v=DMARC1; p=reject; ruf=mailto:dmarcfail@other.example", failure, true, "dmarcfail@other.example\n")
+
+	// Suppressed address.
+	sa := SuppressAddress{ReportingAddress: "dmarcfail@sender.example", Until: time.Now().Add(time.Minute)}
+	err = db.Insert(ctxbg, &sa)
+	tcheckf(t, err, "insert suppress address")
+	test(ruf, failure, false)
+	failureLimiter.counts = nil
+
+	// No reports if not enabled.
+	beacon.Conf.Static.DMARCFailureReports = nil
+	test("v=DMARC1; p=reject; ruf=mailto:dmarcfail@other.example", failure, false)
+}
@@ -30,6 +30,11 @@ var (
 	MetricLookup stub.HistogramVec = stub.HistogramVecIgnore{}
 )
 
+// DefaultResolver, if set, is used for lookups by a StrictResolver without
+// Resolver, instead of adns.DefaultResolver. Set during startup when upstream
+// resolvers with DNSSEC validation are configured.
+var DefaultResolver Resolver
+
 // Resolver is the interface strict resolver implements.
 type Resolver interface {
 	LookupPort(ctx context.Context, network, service string) (port int, err error)
@@ -60,7 +65,7 @@ func WithPackage(resolver Resolver, name string) Resolver {
 // preventing "search"-relative lookups.
 type StrictResolver struct {
 	Pkg      string         // Name of subsystem that is making DNS requests, for metrics.
-	Resolver *adns.Resolver // Where the actual lookups are done. If nil, adns.DefaultResolver is used for lookups.
+	Resolver *adns.Resolver // Where the actual lookups are done. If nil, DefaultResolver or adns.DefaultResolver is used for lookups.
 	Log      *slog.Logger
 }
 
@@ -103,10 +108,13 @@ func (r StrictResolver) WithPackage(name string) Resolver {
 }
 
 func (r StrictResolver) resolver() Resolver {
-	if r.Resolver == nil {
-		return adns.DefaultResolver
+	if r.Resolver != nil {
+		return r.Resolver
+	}
+	if DefaultResolver != nil {
+		return DefaultResolver
 	}
-	return r.Resolver
+	return adns.DefaultResolver
 }
 
 func resolveErrorHint(err *error) {
@@ -12,6 +12,16 @@
 //
 // The health of a DNSBL "zone" can be check through a lookup of 127.0.0.1
 // (must not be present) and 127.0.0.2 (must be present).
+//
+// Domain-based block lists (also called RHSBLs, or URIBLs when used for domains
+// of links in message bodies) contain domain names instead of IP addresses. The
+// name to look up is the domain followed by the zone, e.g.
+// "example.org.dbl.example". The health of a domain-based list can be checked
+// through a lookup of "invalid" (must not be present) and "test" (must be
+// present).
+//
+// Block lists can return different addresses for a listed name, e.g. to indicate
+// the reason of the listing. Function Listed interprets the returned addresses.
 package dnsbl
 
 import (
@@ -47,18 +57,13 @@ var (
 
 // Lookup checks if "ip" occurs in the DNS block list "zone" (e.g. dnsbl.example.org).
 func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone dns.Domain, ip net.IP) (rstatus Status, rexplanation string, rerr error) {
-	log := mlog.New("dnsbl", elog)
-	start := time.Now()
-	defer func() {
-		MetricLookup.ObserveLabels(float64(time.Since(start))/float64(time.Second), zone.Name(), string(rstatus))
-		log.Debugx("dnsbl lookup result", rerr,
-			slog.Any("zone", zone),
-			slog.Any("ip", ip),
-			slog.Any("status", rstatus),
-			slog.String("explanation", rexplanation),
-			slog.Duration("duration", time.Since(start)))
-	}()
+	rstatus, _, rexplanation, rerr = LookupCodes(ctx, elog, resolver, zone, ip)
+	return
+}
 
+// LookupCodes is like Lookup, but also returns the addresses the block list
+// returned for a listed "ip", which can be interpreted with Listed.
+func LookupCodes(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone dns.Domain, ip net.IP) (rstatus Status, rcodes []net.IP, rexplanation string, rerr error) {
 	b := &strings.Builder{}
 	v4 := ip.To4()
 	if v4 != nil {
@@ -84,25 +89,81 @@ func Lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone
 			b.WriteByte(chars[v>>4&0xf])
 		}
 	}
-	b.WriteString("." + zone.ASCII + ".")
-	addr := b.String()
+	return lookup(ctx, elog, resolver, zone, b.String(), slog.Any("ip", ip))
+}
+
+// LookupDomain checks if "domain" occurs in the domain-based block list "zone"
+// (e.g. dbl.example.org). Domain-based lists typically contain organizational
+// domains, so callers usually look up the organizational domain of a name. The
+// returned addresses can be interpreted with Listed.
+func LookupDomain(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone, domain dns.Domain) (rstatus Status, rcodes []net.IP, rexplanation string, rerr error) {
+	return lookup(ctx, elog, resolver, zone, domain.ASCII, slog.Any("domain", domain))
+}
+
+func lookup(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone dns.Domain, name string, attr slog.Attr) (rstatus Status, rcodes []net.IP, rexplanation string, rerr error) {
+	log := mlog.New("dnsbl", elog)
+	start := time.Now()
+	defer func() {
+		MetricLookup.ObserveLabels(float64(time.Since(start))/float64(time.Second), zone.Name(), string(rstatus))
+		log.Debugx("dnsbl lookup result", rerr,
+			slog.Any("zone", zone),
+			attr,
+			slog.Any("status", rstatus),
+			slog.Any("codes", rcodes),
+			slog.String("explanation", rexplanation),
+			slog.Duration("duration", time.Since(start)))
+	}()
+
+	addr := name + "." + zone.ASCII + "."
 
 	// ../rfc/5782:175
-	_, _, err := dns.WithPackage(resolver, "dnsbl").LookupIP(ctx, "ip4", addr)
+	codes, _, err := dns.WithPackage(resolver, "dnsbl").LookupIP(ctx, "ip4", addr)
 	if dns.IsNotFound(err) {
-		return StatusPass, "", nil
+		return StatusPass, nil, "", nil
 	} else if err != nil {
-		return StatusTemperr, "", fmt.Errorf("%w: %s", ErrDNS, err)
+		return StatusTemperr, nil, "", fmt.Errorf("%w: %s", ErrDNS, err)
 	}
 
 	txts, _, err := dns.WithPackage(resolver, "dnsbl").LookupTXT(ctx, addr)
 	if dns.IsNotFound(err) {
-		return StatusFail, "", nil
+		return StatusFail, codes, "", nil
 	} else if err != nil {
 		log.Debugx("looking up txt record from dnsbl", err, slog.String("addr", addr))
-		return StatusFail, "", nil
+		return StatusFail, codes, "", nil
 	}
-	return StatusFail, strings.Join(txts, "; "), nil
+	return StatusFail, codes, strings.Join(txts, "; "), nil
+}
+
+// errorCodes are returned by some block lists for queries they refuse to
+// answer, e.g. through public resolvers or above a query limit. They do not
+// indicate a listing.
+var errorCodes = net.IPNet{IP: net.IPv4(127, 255, 255, 0), Mask: net.CIDRMask(24, 32)}
+
+// Listed returns whether any of the addresses "codes" returned by a block list
+// indicate a listing. If "returnCodes" is empty, any address in 127.0.0.0/8 is a
+// listing. Otherwise only addresses in one of the "returnCodes" networks are. If
+// only addresses that block lists use to indicate an error (127.255.255.0/24)
+// were returned, and they are not explicitly in "returnCodes", ErrDNS is
+// returned.
+func Listed(codes []net.IP, returnCodes []net.IPNet) (bool, error) {
+	loopback := net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+	var errcode net.IP
+	for _, ip := range codes {
+		for _, n := range returnCodes {
+			if n.Contains(ip) {
+				return true, nil
+			}
+		}
+		if errorCodes.Contains(ip) {
+			errcode = ip
+		} else if len(returnCodes) == 0 && loopback.Contains(ip) {
+			return true, nil
+		}
+	}
+	if errcode != nil {
+		return false, fmt.Errorf("%w: block list returned error code %s", ErrDNS, errcode)
+	}
+	return false, nil
 }
 
 // CheckHealth checks whether the DNSBL "zone" is operating correctly by
@@ -134,3 +195,31 @@ func CheckHealth(ctx context.Context, elog *slog.Logger, resolver dns.Resolver,
 	}
 	return ErrDNS
 }
+
+// CheckHealthDomain checks whether the domain-based block list "zone" is
+// operating correctly by querying for "test" (must be present) and "invalid"
+// (must not be present).
+// For temporary errors, ErrDNS is returned.
+func CheckHealthDomain(ctx context.Context, elog *slog.Logger, resolver dns.Resolver, zone dns.Domain) (rerr error) {
+	log := mlog.New("dnsbl", elog)
+	start := time.Now()
+	defer func() {
+		log.Debugx("dnsbl domain healthcheck result", rerr, slog.Any("zone", zone), slog.Duration("duration", time.Since(start)))
+	}()
+
+	status1, _, _, err1 := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "invalid"})
+	status2, _, _, err2 := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "test"})
+	if status1 == StatusPass && status2 == StatusFail {
+		return nil
+	} else if status1 == StatusFail {
+		return fmt.Errorf("dnsbl contains unwanted test name invalid")
+	} else if status2 == StatusPass {
+		return fmt.Errorf("dnsbl does not contain required test name test")
+	}
+	if err1 != nil {
+		return err1
+	} else if err2 != nil {
+		return err2
+	}
+	return ErrDNS
+}
@@ -64,3 +64,73 @@ func TestDNSBL(t *testing.T) {
 		t.Fatalf("bad dnsbl is healthy")
 	}
 }
+
+func TestDomainBL(t *testing.T) {
+	ctx := context.Background()
+	log := mlog.New("dnsbl", nil)
+
+	resolver := dns.MockResolver{
+		A: map[string][]string{
+			"test.dbl.example.":            {"127.0.1.2"}, // required for health
+			"spam.example.dbl.example.":    {"127.0.1.2"},
+			"phish.example.dbl.example.":   {"127.0.1.4", "127.0.1.2"},
+			"refused.example.dbl.example.": {"127.255.255.254"},
+		},
+		TXT: map[string][]string{
+			"spam.example.dbl.example.": {"listed!"},
+		},
+	}
+	zone := dns.Domain{ASCII: "dbl.example"}
+
+	status, codes, expl, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "spam.example"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	} else if status != StatusFail || len(codes) != 1 || !codes[0].Equal(net.ParseIP("127.0.1.2")) || expl != "listed!" {
+		t.Fatalf("lookup, got status %v, codes %v, explanation %q", status, codes, expl)
+	}
+
+	if status, _, _, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "ham.example"}); err != nil {
+		t.Fatalf("lookup: %v", err)
+	} else if status != StatusPass {
+		t.Fatalf("lookup, got status %v, expected pass", status)
+	}
+
+	_, phishCodes, _, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "phish.example"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	_, refusedCodes, _, err := LookupDomain(ctx, log.Logger, resolver, zone, dns.Domain{ASCII: "refused.example"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+
+	_, phishOnly, _ := net.ParseCIDR("127.0.1.4/32")
+	testListed := func(codes []net.IP, returnCodes []net.IPNet, expListed, expErr bool) {
+		t.Helper()
+		listed, err := Listed(codes, returnCodes)
+		if listed != expListed || (err != nil) != expErr {
+			t.Fatalf("listed for %v with return codes %v: got %v, %v, expected %v, err %v", codes, returnCodes, listed, err, expListed, expErr)
+		}
+	}
+	testListed(codes, nil, true, false)
+	testListed(codes, []net.IPNet{*phishOnly}, false, false)
+	testListed(phishCodes, []net.IPNet{*phishOnly}, true, false)
+	testListed(refusedCodes, nil, false, true)
+	testListed(nil, nil, false, false)
+
+	if err := CheckHealthDomain(ctx, log.Logger, resolver, zone); err != nil {
+		t.Fatalf("domain dnsbl not healthy: %v", err)
+	}
+	if err := CheckHealthDomain(ctx, log.Logger, resolver, dns.Domain{ASCII: "other.example"}); err == nil {
+		t.Fatalf("bad domain dnsbl is healthy")
+	}
+	unhealthyResolver := dns.MockResolver{
+		A: map[string][]string{
+			"test.dbl.example.":    {"127.0.1.2"},
+			"invalid.dbl.example.": {"127.0.1.2"}, // Should not be present in healthy dnsbl.
+		},
+	}
+	if err := CheckHealthDomain(ctx, log.Logger, unhealthyResolver, zone); err == nil {
+		t.Fatalf("bad domain dnsbl is healthy")
+	}
+}
@@ -0,0 +1,595 @@
+// Package dnsblserver implements a DNS block list (RFC 5782) of IPs of remote
+// mail servers with a bad reputation, served by a built-in DNS server.
+//
+// Reputation is gathered from incoming messages in all accounts: Messages marked
+// as junk and messages marked as non-junk. Messages rejected for junk content
+// during the SMTP transaction are counted separately, in the database of this
+// package, because they are not necessarily kept in accounts. Each message is
+// counted once, also when its delivery is retried. The weight of a message is halved
+// after each configured half-life. An IP is listed when the weighted number of
+// junk or rejected messages reaches a threshold, and few of its messages were
+// marked as non-junk. Configured IPs and networks are never listed.
+//
+// IPv4 addresses are listed individually, IPv6 addresses as /64 networks, like
+// reputation analysis for incoming messages.
+//
+// Account messages are processed incrementally: Each refresh only looks at
+// messages modified since the previous refresh (by modseq), and keeps the
+// contribution of each marked message, so it can be undone when the message is
+// marked differently or expunged. The listed IPs are recomputed periodically
+// from the weighted scores, and kept in memory for answering DNS requests.
+package dnsblserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/store"
+)
+
+var pkglog = mlog.New("dnsblserver", nil)
+
+var (
+	metricListed = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "beacon_dnsblserver_listed",
+			Help: "Number of IPs and IPv6 networks listed in the DNSBL served by the built-in DNS server.",
+		},
+	)
+	metricQuery = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "beacon_dnsblserver_query_total",
+			Help: "Number of DNS requests by result: listed, notlisted, zone (requests for the zone itself), refused (outside the zone) or error (malformed requests).",
+		},
+		[]string{"result"},
+	)
+)
+
+var timeNow = time.Now // Tests override this.
+
+const (
+	DefaultPort            = 53
+	DefaultJunkThreshold   = 3
+	DefaultRejectThreshold = 5
+	DefaultMaxHamFraction  = 0.1
+	DefaultHalfLife        = 7 * 24 * time.Hour
+	DefaultRefreshInterval = 15 * time.Minute
+)
+
+// Reject holds the weighted number of messages from a remote IP that were
+// rejected as junk during SMTP.
+type Reject struct {
+	IP      string    // IPv4 address or IPv6 /64 network, as in RemoteIPMasked1 of messages.
+	Score   float64   // Weighted number of rejects at Updated.
+	Updated time.Time `bstore:"nonzero,index"`
+}
+
+// RejectMessage is a message counted in the rejects of its remote IP. Rejected
+// messages are typically retried, e.g. after a temporary junk rejection, and are
+// only counted once.
+type RejectMessage struct {
+	Key      string    // Message-ID, or "sha256:" with hex hash of the message if it has no Message-ID.
+	IP       string    `bstore:"nonzero"`
+	Received time.Time `bstore:"nonzero,index"`
+}
+
+// Mark is the contribution of a message marked as junk or non-junk in an
+// account to the reputation of its remote IP.
+type Mark struct {
+	ID        int64
+	Account   string    `bstore:"nonzero,unique Account+MessageID"`
+	MessageID int64     `bstore:"nonzero"`
+	IP        string    `bstore:"nonzero"`
+	Junk      bool      // Otherwise marked as non-junk.
+	Received  time.Time `bstore:"nonzero,index"`
+}
+
+// Reputation holds the weighted number of messages from a remote IP marked as
+// junk and non-junk, across all accounts.
+type Reputation struct {
+	IP      string    // IPv4 address or IPv6 /64 network, as in RemoteIPMasked1 of messages.
+	Junk    float64   // Weighted number of junk messages at Updated.
+	Ham     float64   // Weighted number of non-junk messages at Updated.
+	Updated time.Time `bstore:"nonzero,index"`
+}
+
+// AccountState tracks the last processed modification of messages of an account.
+type AccountState struct {
+	Account string
+	ModSeq  store.ModSeq
+}
+
+var DBTypes = []any{Reject{}, RejectMessage{}, Mark{}, Reputation{}, AccountState{}} // Types stored in DB.
+var DB *bstore.DB                                                                    // Exported for backups.
+var mutex sync.Mutex
+
+func database(ctx context.Context) (rdb *bstore.DB, rerr error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB == nil {
+		p := beacon.DataDirPath("dnsblserver.db")
+		os.MkdirAll(filepath.Dir(p), 0770)
+		db, err := bstore.Open(ctx, p, &bstore.Options{Timeout: 5 * time.Second, Perm: 0660}, DBTypes...)
+		if err != nil {
+			return nil, err
+		}
+		DB = db
+	}
+	return DB, nil
+}
+
+// Init opens the database.
+func Init() error {
+	_, err := database(beacon.Shutdown)
+	return err
+}
+
+// Close closes the database.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB != nil {
+		err := DB.Close()
+		pkglog.Check(err, "closing database")
+		DB = nil
+	}
+}
+
+// maskIP returns the listed form of ip: the IP itself for IPv4, and the /64
+// network for IPv6. Like RemoteIPMasked1 of messages.
+func maskIP(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.To4().String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// settings returns the configuration with defaults filled in.
+func settings(conf config.DNSBLServer) config.DNSBLServer {
+	if conf.Port == 0 {
+		conf.Port = DefaultPort
+	}
+	if conf.JunkThreshold == 0 {
+		conf.JunkThreshold = DefaultJunkThreshold
+	}
+	if conf.RejectThreshold == 0 {
+		conf.RejectThreshold = DefaultRejectThreshold
+	}
+	if conf.MaxHamFraction == 0 {
+		conf.MaxHamFraction = DefaultMaxHamFraction
+	}
+	if conf.HalfLife == 0 {
+		conf.HalfLife = DefaultHalfLife
+	}
+	if conf.RefreshInterval == 0 {
+		conf.RefreshInterval = DefaultRefreshInterval
+	}
+	if conf.Explanation == "" {
+		conf.Explanation = "Listed for junk reputation at " + beacon.Conf.Static.HostnameDomain.ASCII
+	}
+	return conf
+}
+
+// decay returns the weight of a message from age ago.
+func decay(age, halfLife time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// AddReject records a message from ip that was rejected as junk. Message key
+// identifies the message, as Message-ID, or the hash of the message prefixed
+// with "sha256:". Nothing is recorded if the message was recorded before, or if
+// the DNSBL server is not configured.
+func AddReject(ctx context.Context, log mlog.Log, ip net.IP, msgKey string) error {
+	conf := beacon.Conf.Static.DNSBLServer
+	if conf == nil || ip == nil {
+		return nil
+	} else if msgKey == "" {
+		return fmt.Errorf("missing message key")
+	}
+	halfLife := settings(*conf).HalfLife
+
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	now := timeNow()
+	return db.Write(ctx, func(tx *bstore.Tx) error {
+		rm := RejectMessage{Key: msgKey}
+		if err := tx.Get(&rm); err == nil {
+			log.Debug("reject already recorded for message", slog.String("key", msgKey))
+			return nil
+		} else if err != bstore.ErrAbsent {
+			return fmt.Errorf("get reject message: %v", err)
+		}
+		rm.IP = maskIP(ip)
+		rm.Received = now
+		if err := tx.Insert(&rm); err != nil {
+			return fmt.Errorf("insert reject message: %v", err)
+		}
+
+		r := Reject{IP: rm.IP}
+		err := tx.Get(&r)
+		if err == bstore.ErrAbsent {
+			r.Score = 1
+			r.Updated = now
+			return tx.Insert(&r)
+		} else if err != nil {
+			return fmt.Errorf("get reject: %v", err)
+		}
+		r.Score = r.Score*decay(now.Sub(r.Updated), halfLife) + 1
+		r.Updated = now
+		return tx.Update(&r)
+	})
+}
+
+// score is the weighted number of messages from an IP.
+type score struct {
+	Junk    float64
+	Ham     float64
+	Rejects float64
+}
+
+// addReputation adds the weighted junk and ham contributions to the reputation of
+// ip, decaying the existing scores. Scores never go below zero.
+func addReputation(tx *bstore.Tx, halfLife time.Duration, now time.Time, ip string, junk, ham float64) error {
+	r := Reputation{IP: ip}
+	err := tx.Get(&r)
+	if err == bstore.ErrAbsent {
+		r.Junk = math.Max(0, junk)
+		r.Ham = math.Max(0, ham)
+		r.Updated = now
+		return tx.Insert(&r)
+	} else if err != nil {
+		return fmt.Errorf("get reputation: %v", err)
+	}
+	w := decay(now.Sub(r.Updated), halfLife)
+	r.Junk = math.Max(0, r.Junk*w+junk)
+	r.Ham = math.Max(0, r.Ham*w+ham)
+	r.Updated = now
+	return tx.Update(&r)
+}
+
+// removeMark undoes the contribution of mark to the reputation of its IP, and
+// removes the mark.
+func removeMark(tx *bstore.Tx, halfLife time.Duration, now time.Time, mark Mark) error {
+	w := decay(now.Sub(mark.Received), halfLife)
+	var err error
+	if mark.Junk {
+		err = addReputation(tx, halfLife, now, mark.IP, -w, 0)
+	} else {
+		err = addReputation(tx, halfLife, now, mark.IP, 0, -w)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&mark)
+}
+
+// updateAccount processes the messages in the account that were modified since
+// the previous update, adjusting the reputations of their remote IPs.
+func updateAccount(ctx context.Context, log mlog.Log, db *bstore.DB, conf config.DNSBLServer, accName string) error {
+	now := timeNow()
+	since := now.Add(-8 * conf.HalfLife)
+
+	st := AccountState{Account: accName}
+	if err := db.Get(ctx, &st); err != nil && err != bstore.ErrAbsent {
+		return fmt.Errorf("get account state: %v", err)
+	}
+
+	acc, err := store.OpenAccount(log, accName)
+	if err != nil {
+		return fmt.Errorf("open account: %v", err)
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	// Messages are gathered in a read-only transaction on the account, then processed
+	// in a single transaction in our database.
+	var msgs []store.Message
+	modseq := st.ModSeq
+	q := bstore.QueryDB[store.Message](ctx, acc.DB)
+	q.FilterGreater("ModSeq", st.ModSeq)
+	err = q.ForEach(func(m store.Message) error {
+		if m.ModSeq > modseq {
+			modseq = m.ModSeq
+		}
+		if !m.Received.Before(since) {
+			msgs = append(msgs, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing modified messages: %v", err)
+	}
+	if modseq == st.ModSeq {
+		return nil
+	}
+
+	return db.Write(ctx, func(tx *bstore.Tx) error {
+		for _, m := range msgs {
+			q := bstore.QueryTx[Mark](tx)
+			q.FilterNonzero(Mark{Account: accName, MessageID: m.ID})
+			mark, err := q.Get()
+			if err == nil {
+				if err := removeMark(tx, conf.HalfLife, now, mark); err != nil {
+					return err
+				}
+			} else if err != bstore.ErrAbsent {
+				return fmt.Errorf("get mark: %v", err)
+			}
+
+			// Rejected messages are counted when rejected, unless marked as non-junk later.
+			if m.Expunged || m.RemoteIPMasked1 == "" || !(m.Notjunk || m.Junk && !m.IsReject) {
+				continue
+			}
+			mark = Mark{Account: accName, MessageID: m.ID, IP: m.RemoteIPMasked1, Junk: !m.Notjunk, Received: m.Received}
+			if err := tx.Insert(&mark); err != nil {
+				return fmt.Errorf("insert mark: %v", err)
+			}
+			w := decay(now.Sub(m.Received), conf.HalfLife)
+			if mark.Junk {
+				err = addReputation(tx, conf.HalfLife, now, mark.IP, w, 0)
+			} else {
+				err = addReputation(tx, conf.HalfLife, now, mark.IP, 0, w)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		st.ModSeq = modseq
+		if err := tx.Get(&AccountState{Account: accName}); err == bstore.ErrAbsent {
+			return tx.Insert(&st)
+		} else if err != nil {
+			return fmt.Errorf("get account state: %v", err)
+		}
+		return tx.Update(&st)
+	})
+}
+
+// update processes modified messages in all accounts, and removes the marks of
+// accounts that no longer exist.
+func update(ctx context.Context, log mlog.Log, conf config.DNSBLServer) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+
+	accNames := beacon.Conf.Accounts()
+	for _, accName := range accNames {
+		if err := updateAccount(ctx, log, db, conf, accName); err != nil {
+			return fmt.Errorf("account %s: %v", accName, err)
+		}
+	}
+
+	now := timeNow()
+	return db.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[AccountState](tx)
+		q.FilterFn(func(st AccountState) bool {
+			return !slices.Contains(accNames, st.Account)
+		})
+		removed, err := q.List()
+		if err != nil {
+			return fmt.Errorf("listing removed accounts: %v", err)
+		}
+		for _, st := range removed {
+			mq := bstore.QueryTx[Mark](tx)
+			mq.FilterNonzero(Mark{Account: st.Account})
+			marks, err := mq.List()
+			if err != nil {
+				return fmt.Errorf("listing marks of removed account: %v", err)
+			}
+			for _, mark := range marks {
+				if err := removeMark(tx, conf.HalfLife, now, mark); err != nil {
+					return err
+				}
+			}
+			if err := tx.Delete(&st); err != nil {
+				return fmt.Errorf("removing account state: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// compute returns the listed IPs and their scores, based on the reputations from
+// marked messages in all accounts and rejected messages.
+func compute(ctx context.Context, log mlog.Log, conf config.DNSBLServer) (map[string]score, error) {
+	now := timeNow()
+	since := now.Add(-8 * conf.HalfLife)
+	scores := map[string]score{}
+
+	db, err := database(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rq := bstore.QueryDB[Reputation](ctx, db)
+	rq.FilterGreaterEqual("Updated", since)
+	err = rq.ForEach(func(r Reputation) error {
+		w := decay(now.Sub(r.Updated), conf.HalfLife)
+		sc := scores[r.IP]
+		sc.Junk += r.Junk * w
+		sc.Ham += r.Ham * w
+		scores[r.IP] = sc
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing reputations: %v", err)
+	}
+
+	q := bstore.QueryDB[Reject](ctx, db)
+	q.FilterGreaterEqual("Updated", since)
+	err = q.ForEach(func(r Reject) error {
+		sc := scores[r.IP]
+		sc.Rejects += r.Score * decay(now.Sub(r.Updated), conf.HalfLife)
+		scores[r.IP] = sc
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing rejects: %v", err)
+	}
+
+	listed := map[string]score{}
+	for ipstr, sc := range scores {
+		if sc.Junk < conf.JunkThreshold && sc.Rejects < conf.RejectThreshold {
+			continue
+		}
+		if sc.Ham > conf.MaxHamFraction*(sc.Junk+sc.Ham+sc.Rejects) {
+			continue
+		}
+		ip := net.ParseIP(ipstr)
+		if ip == nil || allowed(conf, ip) {
+			continue
+		}
+		listed[ipstr] = sc
+	}
+	return listed, nil
+}
+
+// allowed returns whether ip is in one of the allowed networks.
+func allowed(conf config.DNSBLServer, ip net.IP) bool {
+	for _, n := range conf.AllowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// expire removes rejects, reject messages, reputations and marks that no longer contribute to
+// listings.
+func expire(ctx context.Context, halfLife time.Duration) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	since := timeNow().Add(-8 * halfLife)
+	return db.Write(ctx, func(tx *bstore.Tx) error {
+		q := bstore.QueryTx[Reject](tx)
+		q.FilterLess("Updated", since)
+		if _, err := q.Delete(); err != nil {
+			return fmt.Errorf("removing rejects: %v", err)
+		}
+		rmq := bstore.QueryTx[RejectMessage](tx)
+		rmq.FilterLess("Received", since)
+		if _, err := rmq.Delete(); err != nil {
+			return fmt.Errorf("removing reject messages: %v", err)
+		}
+		rq := bstore.QueryTx[Reputation](tx)
+		rq.FilterLess("Updated", since)
+		if _, err := rq.Delete(); err != nil {
+			return fmt.Errorf("removing reputations: %v", err)
+		}
+		mq := bstore.QueryTx[Mark](tx)
+		mq.FilterLess("Received", since)
+		if _, err := mq.Delete(); err != nil {
+			return fmt.Errorf("removing marks: %v", err)
+		}
+		return nil
+	})
+}
+
+// listing is the in-memory state of the block list, for answering requests.
+var listing = struct {
+	sync.Mutex
+	ips     map[string]score
+	updated time.Time
+}{
+	ips: map[string]score{},
+}
+
+// refresh recomputes the listed IPs.
+func refresh(ctx context.Context, log mlog.Log, conf config.DNSBLServer) error {
+	if err := expire(ctx, conf.HalfLife); err != nil {
+		return fmt.Errorf("removing expired scores: %v", err)
+	}
+	if err := update(ctx, log, conf); err != nil {
+		return fmt.Errorf("updating reputations: %v", err)
+	}
+	ips, err := compute(ctx, log, conf)
+	if err != nil {
+		return err
+	}
+	listing.Lock()
+	listing.ips = ips
+	listing.updated = timeNow()
+	listing.Unlock()
+	metricListed.Set(float64(len(ips)))
+	log.Debug("dnsbl listing refreshed", slog.Int("listed", len(ips)))
+	return nil
+}
+
+// Listed returns whether ip is currently listed.
+func Listed(ip net.IP) bool {
+	listing.Lock()
+	defer listing.Unlock()
+	_, ok := listing.ips[maskIP(ip)]
+	return ok
+}
+
+// Start periodically recomputes the listed IPs, and starts serving DNS requests
+// on the listeners set up by Listen. Nothing is done if the DNSBL server is not
+// configured.
+func Start() {
+	if beacon.Conf.Static.DNSBLServer == nil {
+		return
+	}
+	conf := settings(*beacon.Conf.Static.DNSBLServer)
+
+	for _, serve := range servers {
+		go serve(conf)
+	}
+
+	go func() {
+		log := pkglog
+
+		defer func() {
+			// In case of panic don't take the whole program down.
+			x := recover()
+			if x != nil {
+				log.Error("recover from panic", slog.Any("panic", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Dnsblserver)
+			}
+		}()
+
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-beacon.Shutdown.Done():
+				return
+			case <-timer.C:
+			}
+
+			err := refresh(beacon.Shutdown, log, conf)
+			log.Check(err, "refreshing dnsbl listing")
+			timer.Reset(conf.RefreshInterval)
+		}
+	}()
+}
@@ -0,0 +1,222 @@
+package dnsblserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/store"
+)
+
+var ctxbg = context.Background()
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestDNSBLServer(t *testing.T) {
+	os.RemoveAll("../testdata/dnsblserver/data")
+	defer os.RemoveAll("../testdata/dnsblserver/data")
+	beacon.Shutdown = ctxbg
+	beacon.Context = ctxbg
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/dnsblserver/beacon.conf")
+	beacon.ConfigDynamicPath = filepath.FromSlash("../testdata/dnsblserver/domains.conf")
+	beacon.MustLoadConfig(true, false)
+
+	err := Init()
+	tcheck(t, err, "init")
+	defer Close()
+
+	log := mlog.New("dnsblserver", nil)
+	conf := settings(*beacon.Conf.Static.DNSBLServer)
+
+	acc, err := store.OpenAccount(log, "mjl")
+	tcheck(t, err, "open account")
+	defer func() {
+		err := acc.Close()
+		tcheck(t, err, "close account")
+	}()
+	switchStop := store.Switchboard()
+	defer switchStop()
+
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	deliver := func(remoteIP, masked string, junk bool) store.Message {
+		t.Helper()
+		f, err := store.CreateMessageTemp(log, "dnsblservertest")
+		tcheck(t, err, "create temp file")
+		defer store.CloseRemoveTempFile(log, f, "test message")
+		msg := strings.ReplaceAll("From: <remote@example.org>\nTo: <mjl@beacon.example>\nSubject: test\n\nbody\n", "\n", "\r\n")
+		_, err = f.Write([]byte(msg))
+		tcheck(t, err, "write message")
+		m := store.Message{
+			Received:        now,
+			RemoteIP:        remoteIP,
+			RemoteIPMasked1: masked,
+			Size:            int64(len(msg)),
+		}
+		m.Junk = junk
+		m.Notjunk = !junk
+		acc.WithWLock(func() {
+			err = acc.DeliverMailbox(log, "Inbox", &m, f)
+		})
+		tcheck(t, err, "deliver")
+		return m
+	}
+
+	// Listed for junk.
+	junk1 := deliver("1.2.3.4", "1.2.3.4", true)
+	deliver("1.2.3.4", "1.2.3.4", true)
+	// Too much ham.
+	deliver("1.2.3.5", "1.2.3.5", true)
+	deliver("1.2.3.5", "1.2.3.5", true)
+	deliver("1.2.3.5", "1.2.3.5", false)
+	// Allowed.
+	deliver("10.0.0.5", "10.0.0.5", true)
+	deliver("10.0.0.5", "10.0.0.5", true)
+	// IPv6 networks are listed.
+	deliver("2001:db8::1", "2001:db8::", true)
+	deliver("2001:db8::2", "2001:db8::", true)
+	// Listed for rejects.
+	for i := 0; i < 3; i++ {
+		err := AddReject(ctxbg, log, net.ParseIP("1.2.3.6"), fmt.Sprintf("reject%d@remote.example", i))
+		tcheck(t, err, "add reject")
+	}
+	// Not enough rejects, retried deliveries of the same message are counted once.
+	for i := 0; i < 3; i++ {
+		err = AddReject(ctxbg, log, net.ParseIP("1.2.3.7"), "retried@remote.example")
+		tcheck(t, err, "add reject")
+	}
+
+	err = refresh(ctxbg, log, conf)
+	tcheck(t, err, "refresh")
+	for _, ip := range []string{"1.2.3.4", "1.2.3.6", "2001:db8::ff"} {
+		if !Listed(net.ParseIP(ip)) {
+			t.Fatalf("ip %s not listed", ip)
+		}
+	}
+	for _, ip := range []string{"1.2.3.5", "1.2.3.7", "10.0.0.5", "2001:db8:1::1"} {
+		if Listed(net.ParseIP(ip)) {
+			t.Fatalf("ip %s listed", ip)
+		}
+	}
+
+	// DNS requests.
+	request := func(name string, typ dnsmessage.Type) dnsmessage.Message {
+		t.Helper()
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1})
+		err := b.StartQuestions()
+		tcheck(t, err, "start questions")
+		err = b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET})
+		tcheck(t, err, "question")
+		req, err := b.Finish()
+		tcheck(t, err, "finish request")
+		buf, err := handle(conf, req, 512)
+		tcheck(t, err, "handle request")
+		var resp dnsmessage.Message
+		err = resp.Unpack(buf)
+		tcheck(t, err, "parse response")
+		tcompare(t, resp.Header.ID, uint16(1))
+		return resp
+	}
+	testA := func(name string, exp bool) {
+		t.Helper()
+		resp := request(name, dnsmessage.TypeA)
+		if exp {
+			tcompare(t, resp.Header.RCode, dnsmessage.RCodeSuccess)
+			tcompare(t, len(resp.Answers), 1)
+			tcompare(t, resp.Answers[0].Body, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}})
+		} else {
+			tcompare(t, resp.Header.RCode, dnsmessage.RCodeNameError)
+			tcompare(t, len(resp.Answers), 0)
+			tcompare(t, len(resp.Authorities), 1)
+		}
+	}
+	testA("4.3.2.1.dnsbl.beacon.example.", true)
+	testA("4.3.2.1.DNSBL.beacon.example.", true)
+	testA("5.3.2.1.dnsbl.beacon.example.", false)
+	testA("2.0.0.127.dnsbl.beacon.example.", true) // Test address. ../rfc/5782:355
+	testA("1.0.0.127.dnsbl.beacon.example.", false)
+	testA("f.f.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.dnsbl.beacon.example.", true)
+	testA("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2.dnsbl.beacon.example.", false)
+	testA("bogus.dnsbl.beacon.example.", false)
+
+	resp := request("4.3.2.1.dnsbl.beacon.example.", dnsmessage.TypeTXT)
+	tcompare(t, resp.Answers[0].Body, &dnsmessage.TXTResource{TXT: []string{"Listed for junk reputation at beacon.example"}})
+
+	resp = request("dnsbl.beacon.example.", dnsmessage.TypeSOA)
+	tcompare(t, resp.Header.Authoritative, true)
+	tcompare(t, len(resp.Answers), 1)
+
+	resp = request("other.example.", dnsmessage.TypeA)
+	tcompare(t, resp.Header.RCode, dnsmessage.RCodeRefused)
+
+	// Only modified messages are processed again. Marking a junk message as non-junk
+	// undoes its junk contribution.
+	err = refresh(ctxbg, log, conf)
+	tcheck(t, err, "refresh")
+	tcompare(t, Listed(net.ParseIP("1.2.3.4")), true)
+	acc.WithWLock(func() {
+		err = acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+			modseq, err := acc.NextModSeq(tx)
+			if err != nil {
+				return err
+			}
+			junk1.ModSeq = modseq
+			junk1.Junk = false
+			junk1.Notjunk = true
+			return tx.Update(&junk1)
+		})
+	})
+	tcheck(t, err, "marking message as non-junk")
+	err = refresh(ctxbg, log, conf)
+	tcheck(t, err, "refresh")
+	tcompare(t, Listed(net.ParseIP("1.2.3.4")), false)
+	db, err := database(ctxbg)
+	tcheck(t, err, "database")
+	r := Reputation{IP: "1.2.3.4"}
+	err = db.Get(ctxbg, &r)
+	tcheck(t, err, "get reputation")
+	tcompare(t, [2]float64{r.Junk, r.Ham}, [2]float64{1, 1})
+
+	// After enough half-lives, nothing is listed anymore and rejects are removed.
+	now = now.Add(8*conf.HalfLife + time.Minute)
+	err = refresh(ctxbg, log, conf)
+	tcheck(t, err, "refresh")
+	if Listed(net.ParseIP("1.2.3.4")) || Listed(net.ParseIP("1.2.3.6")) {
+		t.Fatalf("ips still listed after decay")
+	}
+	n, err := bstore.QueryDB[Reject](ctxbg, db).Count()
+	tcheck(t, err, "count rejects")
+	tcompare(t, n, 0)
+	n, err = bstore.QueryDB[RejectMessage](ctxbg, db).Count()
+	tcheck(t, err, "count reject messages")
+	tcompare(t, n, 0)
+	n, err = bstore.QueryDB[Mark](ctxbg, db).Count()
+	tcheck(t, err, "count marks")
+	tcompare(t, n, 0)
+}
@@ -0,0 +1,321 @@
+package dnsblserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/beacon-"
+)
+
+// TTL for answers, and for negative caching through the SOA record.
+const ttl = 300
+
+// Set up by Listen, started by Start.
+var servers []func(conf config.DNSBLServer)
+
+// Listen binds the UDP and TCP sockets for the DNS server, if configured. Must be
+// called while still running as root, before dropping privileges, like other
+// listeners.
+func Listen() {
+	if beacon.Conf.Static.DNSBLServer == nil {
+		return
+	}
+	conf := settings(*beacon.Conf.Static.DNSBLServer)
+	for _, ip := range conf.IPs {
+		addr := net.JoinHostPort(ip, strconv.Itoa(conf.Port))
+		if os.Getuid() == 0 {
+			pkglog.Print("listening for dnsbl requests", slog.String("address", addr))
+		}
+		network := beacon.Network(ip)
+		ln, err := beacon.Listen(network, addr)
+		if err != nil {
+			pkglog.Fatalx("dnsbl server: listen for tcp", err, slog.String("address", addr))
+		}
+		udpNetwork := strings.Replace(network, "tcp", "udp", 1)
+		pc, err := beacon.ListenPacket(udpNetwork, addr)
+		if err != nil {
+			pkglog.Fatalx("dnsbl server: listen for udp", err, slog.String("address", addr))
+		}
+		servers = append(servers, func(conf config.DNSBLServer) { serveUDP(conf, pc) }, func(conf config.DNSBLServer) { serveTCP(conf, ln) })
+	}
+}
+
+func recoverPanic() {
+	x := recover()
+	if x != nil {
+		pkglog.Error("recover from panic", slog.Any("panic", x))
+		debug.PrintStack()
+		metrics.PanicInc(metrics.Dnsblserver)
+	}
+}
+
+func serveUDP(conf config.DNSBLServer, pc net.PacketConn) {
+	defer recoverPanic()
+
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			pkglog.Infox("dnsbl server: reading udp request", err)
+			continue
+		}
+		resp, err := handle(conf, buf[:n], 512)
+		if err != nil {
+			pkglog.Debugx("dnsbl server: handling udp request", err, slog.Any("remote", addr))
+			continue
+		}
+		_, err = pc.WriteTo(resp, addr)
+		pkglog.Check(err, "dnsbl server: writing udp response", slog.Any("remote", addr))
+	}
+}
+
+func serveTCP(conf config.DNSBLServer, ln net.Listener) {
+	defer recoverPanic()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			pkglog.Infox("dnsbl server: accept", err)
+			continue
+		}
+		go serveTCPConn(conf, conn)
+	}
+}
+
+// serveTCPConn handles requests on a connection, each prefixed with a 2-byte
+// length, until the client closes the connection or is idle for too long.
+func serveTCPConn(conf config.DNSBLServer, conn net.Conn) {
+	defer recoverPanic()
+	defer func() {
+		err := conn.Close()
+		pkglog.Check(err, "dnsbl server: closing tcp connection")
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			return
+		}
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+		resp, err := handle(conf, buf, 65535)
+		if err != nil {
+			pkglog.Debugx("dnsbl server: handling tcp request", err, slog.Any("remote", conn.RemoteAddr()))
+			return
+		}
+		out := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// handle parses a DNS request and returns the response. An error is returned
+// for requests that cannot be parsed, which are not answered.
+func handle(conf config.DNSBLServer, req []byte, maxSize int) ([]byte, error) {
+	var p dnsmessage.Parser
+	reqh, err := p.Start(req)
+	if err != nil {
+		metricQuery.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("parsing request header: %v", err)
+	}
+	if reqh.Response {
+		metricQuery.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("message is a response, not a request")
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		metricQuery.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("parsing questions: %v", err)
+	}
+
+	h := dnsmessage.Header{ID: reqh.ID, Response: true, OpCode: reqh.OpCode, RecursionDesired: reqh.RecursionDesired}
+	if reqh.OpCode != 0 || len(questions) != 1 {
+		h.RCode = dnsmessage.RCodeNotImplemented
+		if len(questions) != 1 {
+			h.RCode = dnsmessage.RCodeFormatError
+		}
+		metricQuery.WithLabelValues("error").Inc()
+		b := dnsmessage.NewBuilder(nil, h)
+		return b.Finish()
+	}
+	q := questions[0]
+
+	zone := conf.ZoneDomain.ASCII + "."
+	name := strings.ToLower(q.Name.String())
+	if q.Class != dnsmessage.ClassINET || name != zone && !strings.HasSuffix(name, "."+zone) {
+		h.RCode = dnsmessage.RCodeRefused
+		metricQuery.WithLabelValues("refused").Inc()
+		b := dnsmessage.NewBuilder(nil, h)
+		b.EnableCompression()
+		if err := b.StartQuestions(); err != nil {
+			return nil, err
+		}
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+		return b.Finish()
+	}
+	h.Authoritative = true
+
+	zoneName, err := dnsmessage.NewName(zone)
+	if err != nil {
+		return nil, fmt.Errorf("zone name: %v", err)
+	}
+	rh := func(typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: q.Name, Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+
+	// Determine the answer records, if any.
+	var a, txt, soa, ns bool
+	if name == zone {
+		metricQuery.WithLabelValues("zone").Inc()
+		switch q.Type {
+		case dnsmessage.TypeSOA:
+			soa = true
+		case dnsmessage.TypeNS:
+			ns = true
+		}
+	} else {
+		ip := parseReverseIP(strings.TrimSuffix(name, "."+zone))
+		// ../rfc/5782:355
+		if ip != nil && (ip.Equal(net.IPv4(127, 0, 0, 2)) || Listed(ip)) {
+			metricQuery.WithLabelValues("listed").Inc()
+			switch q.Type {
+			case dnsmessage.TypeA:
+				a = true
+			case dnsmessage.TypeTXT:
+				txt = true
+			}
+		} else {
+			metricQuery.WithLabelValues("notlisted").Inc()
+			h.RCode = dnsmessage.RCodeNameError
+		}
+	}
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), h)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if a {
+		if err := b.AResource(rh(dnsmessage.TypeA), dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}}); err != nil {
+			return nil, err
+		}
+	}
+	if txt {
+		if err := b.TXTResource(rh(dnsmessage.TypeTXT), dnsmessage.TXTResource{TXT: []string{conf.Explanation}}); err != nil {
+			return nil, err
+		}
+	}
+	host, err := dnsmessage.NewName(beacon.Conf.Static.HostnameDomain.ASCII + ".")
+	if err != nil {
+		return nil, fmt.Errorf("hostname: %v", err)
+	}
+	if ns {
+		if err := b.NSResource(rh(dnsmessage.TypeNS), dnsmessage.NSResource{NS: host}); err != nil {
+			return nil, err
+		}
+	}
+	soaHeader := dnsmessage.ResourceHeader{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: ttl}
+	mbox, err := dnsmessage.NewName("hostmaster." + zone)
+	if err != nil {
+		return nil, fmt.Errorf("soa mailbox: %v", err)
+	}
+	listing.Lock()
+	serial := uint32(listing.updated.Unix())
+	listing.Unlock()
+	soaResource := dnsmessage.SOAResource{NS: host, MBox: mbox, Serial: serial, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: ttl}
+	if soa {
+		if err := b.SOAResource(soaHeader, soaResource); err != nil {
+			return nil, err
+		}
+	} else if !a && !txt && !ns {
+		// SOA in authority section, for negative caching (RFC 2308).
+		if err := b.StartAuthorities(); err != nil {
+			return nil, err
+		}
+		if err := b.SOAResource(soaHeader, soaResource); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) > maxSize {
+		// Cannot happen with our small responses, but let the client retry over TCP.
+		h.Truncated = true
+		b := dnsmessage.NewBuilder(nil, h)
+		return b.Finish()
+	}
+	return resp, nil
+}
+
+// parseReverseIP parses the IP address from the labels of a DNSBL request,
+// e.g. "4.3.2.1" for 1.2.3.4. IPv6 addresses have 32 labels with a nibble each.
+// Returns nil for invalid names.
+func parseReverseIP(s string) net.IP {
+	t := strings.Split(s, ".")
+	switch len(t) {
+	case 4:
+		ip := make(net.IP, 4)
+		for i, label := range t {
+			v, err := strconv.ParseUint(label, 10, 8)
+			if err != nil || label != strconv.FormatUint(v, 10) {
+				return nil
+			}
+			ip[3-i] = byte(v)
+		}
+		return ip
+	case 32:
+		ip := make(net.IP, 16)
+		for i, label := range t {
+			v, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil
+			}
+			// First label is the lowest nibble of the last byte.
+			pos := 31 - i
+			if pos%2 == 0 {
+				ip[pos/2] |= byte(v) << 4
+			} else {
+				ip[pos/2] |= byte(v)
+			}
+		}
+		return ip
+	}
+	return nil
+}
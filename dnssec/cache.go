@@ -0,0 +1,73 @@
+package dnssec
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Maximum duration responses are cached, regardless of TTL.
+const maxTTL = time.Hour
+
+// Duration negative responses are cached if the response has no SOA record.
+const defaultNegativeTTL = time.Minute
+
+type cacheKey struct {
+	name string // Lower case, with trailing dot.
+	typ  dnsmessage.Type
+}
+
+// answer is a validated response to a request.
+type answer struct {
+	rcode      dnsmessage.RCode
+	name       string                // Name after following CNAMEs.
+	records    []dnsmessage.Resource // CNAMEs followed, and records of the requested type at name. Without RRSIGs.
+	authentic  bool                  // Whether all records, or their absence, were verified.
+	delegation bool                  // For DS requests without records, whether name was proven to be a delegation, i.e. an unsigned zone.
+	server     string                // Upstream resolver that sent the response.
+	expires    time.Time
+}
+
+// cache holds validated answers until they expire. Cached answers must not be
+// modified.
+type cache struct {
+	sync.Mutex
+	size    int
+	entries map[cacheKey]answer
+}
+
+func (c *cache) get(k cacheKey, now time.Time) (answer, bool) {
+	c.Lock()
+	defer c.Unlock()
+	a, ok := c.entries[k]
+	if ok && !now.Before(a.expires) {
+		delete(c.entries, k)
+		return answer{}, false
+	}
+	return a, ok
+}
+
+func (c *cache) add(k cacheKey, a answer, now time.Time) {
+	if !now.Before(a.expires) {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if len(c.entries) >= c.size {
+		// Remove expired entries. If that doesn't free up a tenth of the cache, remove
+		// arbitrary entries.
+		for ek, ea := range c.entries {
+			if !now.Before(ea.expires) {
+				delete(c.entries, ek)
+			}
+		}
+		for ek := range c.entries {
+			if len(c.entries) < c.size*9/10 {
+				break
+			}
+			delete(c.entries, ek)
+		}
+	}
+	c.entries[k] = a
+}
@@ -0,0 +1,368 @@
+// Package dnssec implements a DNS resolver that sends requests to upstream
+// recursive resolvers over DNS-over-TLS (RFC 7858) or DNS-over-HTTPS (RFC 8484),
+// and validates DNSSEC signatures (RFC 4033, RFC 4034, RFC 4035) itself.
+//
+// The system resolver, used through package adns, trusts the "authentic data" bit
+// in responses from its recursive resolver, so DNSSEC security depends on a
+// local validating resolver. This resolver never trusts the bit. Instead,
+// requests are sent with the "DNSSEC OK" bit, and RRSIG records in responses are
+// verified with DNSKEY records, which are verified with DS records from the
+// parent zone, up to the trust anchors of the root zone. Only answers with a
+// complete chain of trust are marked as authentic in the adns.Result.
+//
+// Whether a zone is signed is determined by following DS records from the root
+// zone, not by the presence of signatures. Answers from zones without a chain of
+// trust (unsigned zones, delegated to with a proven absence of DS records) are
+// returned as not authentic. Answers from signed zones without valid signatures
+// by the zone are "bogus", and result in a temporary error, like validating
+// resolvers respond with SERVFAIL.
+//
+// Denial of existence, for non-existent names and for names without records of
+// the requested type, is verified with NSEC (RFC 4034) and NSEC3 (RFC 5155)
+// records, as are records synthesized from wildcards. Signed zones must include
+// these proofs, responses without them are bogus. Proofs with NSEC3 opt-out, or
+// NSEC3 parameters that are not supported (RFC 9276), are returned as not
+// authentic.
+//
+// Validated responses are cached, honoring TTLs.
+package dnssec
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mjl-/adns"
+
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/stub"
+)
+
+var (
+	MetricExchange   stub.HistogramVec = stub.HistogramVecIgnore{}
+	MetricCache      stub.CounterVec   = stub.CounterVecIgnore{}
+	MetricValidation stub.CounterVec   = stub.CounterVecIgnore{}
+)
+
+var timeNow = time.Now // Tests override this.
+
+// DefaultCacheSize is the maximum number of cached responses if not configured.
+const DefaultCacheSize = 10000
+
+// RootTrustAnchors are the DS records of the key signing keys of the root zone,
+// KSK-2017 and KSK-2024, as published by IANA at
+// https://data.iana.org/root-anchors/root-anchors.xml.
+var RootTrustAnchors = []DS{
+	mustParseDS("20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"),
+	mustParseDS("38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16"),
+}
+
+// Opts holds optional settings for a Resolver.
+type Opts struct {
+	CacheSize int            // Maximum number of cached responses. Default DefaultCacheSize.
+	RootCAs   *x509.CertPool // For verifying TLS certificates of upstream resolvers. If nil, the system roots are used.
+	Log       *slog.Logger
+}
+
+// Resolver sends DNS requests to upstream resolvers over DNS-over-TLS or
+// DNS-over-HTTPS, and validates DNSSEC signatures. Resolver implements
+// dns.Resolver. Use New to create a Resolver.
+type Resolver struct {
+	upstreams    []*url.URL // With scheme "tls" and host with port, or scheme "https".
+	trustAnchors []DS
+	tlsConfig    *tls.Config
+	httpClient   *http.Client
+	cache        *cache
+	log          mlog.Log
+}
+
+var _ dns.Resolver = (*Resolver)(nil)
+
+// New returns a new resolver that sends requests to upstreams, in order until
+// one responds. Upstreams are URLs with scheme "tls" for DNS-over-TLS, e.g.
+// "tls://dns.example" or "tls://192.0.2.1:853", or "https" for DNS-over-HTTPS,
+// e.g. "https://dns.example/dns-query". If trustAnchors is empty,
+// RootTrustAnchors are used.
+func New(upstreams []string, trustAnchors []DS, opts Opts) (*Resolver, error) {
+	if len(upstreams) == 0 {
+		return nil, errors.New("at least one upstream resolver required")
+	}
+	var urls []*url.URL
+	for _, s := range upstreams {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("parsing upstream %q: %v", s, err)
+		}
+		if u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("upstream %q must be a url with just a host, and a path for https", s)
+		}
+		switch u.Scheme {
+		case "tls":
+			if u.Path != "" {
+				return nil, fmt.Errorf("upstream %q with scheme tls cannot have a path", s)
+			}
+			if u.Port() == "" {
+				u.Host = net.JoinHostPort(u.Hostname(), "853")
+			}
+		case "https":
+		default:
+			return nil, fmt.Errorf("upstream %q has unsupported scheme %q, must be tls or https", s, u.Scheme)
+		}
+		urls = append(urls, u)
+	}
+	if len(trustAnchors) == 0 {
+		trustAnchors = RootTrustAnchors
+	}
+	cacheSize := opts.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    opts.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig.Clone()
+	r := &Resolver{
+		upstreams:    urls,
+		trustAnchors: trustAnchors,
+		tlsConfig:    tlsConfig,
+		httpClient:   &http.Client{Transport: transport},
+		cache:        &cache{size: cacheSize, entries: map[cacheKey]answer{}},
+		log:          mlog.New("dnssec", opts.Log),
+	}
+	return r, nil
+}
+
+// query looks up the records of type typ for name, following CNAMEs. If there
+// are no such records, a "not found" error is returned, along with the result
+// that indicates whether the absence was verified. The returned name is the
+// target of the CNAMEs, or name if there were none.
+func (r *Resolver) query(ctx context.Context, name string, typ dnsmessage.Type) (string, []dnsmessage.Resource, adns.Result, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	a, err := r.lookup(ctx, newRequest(), name, typ)
+	if err != nil {
+		return "", nil, adns.Result{}, err
+	}
+	result := adns.Result{Authentic: a.authentic}
+	var rrs []dnsmessage.Resource
+	for _, rr := range a.records {
+		if rr.Header.Type == typ {
+			rrs = append(rrs, rr)
+		}
+	}
+	if len(rrs) == 0 {
+		return a.name, nil, result, &adns.DNSError{Err: "no such host", Name: name, Server: a.server, IsNotFound: true}
+	}
+	return a.name, rrs, result, nil
+}
+
+func (r *Resolver) LookupPort(ctx context.Context, network, service string) (port int, err error) {
+	// Services are looked up locally, not through DNS.
+	return adns.DefaultResolver.LookupPort(ctx, network, service)
+}
+
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, adns.Result, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, adns.Result{}, &adns.DNSError{Err: "unrecognized address", Name: addr}
+	}
+	var name string
+	if ip4 := ip.To4(); ip4 != nil {
+		name = fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	} else {
+		var b strings.Builder
+		for i := len(ip) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "%x.%x.", ip[i]&0xf, ip[i]>>4)
+		}
+		b.WriteString("ip6.arpa.")
+		name = b.String()
+	}
+	_, rrs, result, err := r.query(ctx, name, dnsmessage.TypePTR)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []string
+	for _, rr := range rrs {
+		l = append(l, rr.Body.(*dnsmessage.PTRResource).PTR.String())
+	}
+	return l, result, nil
+}
+
+// LookupCNAME returns the name after following CNAMEs from host, or host itself
+// if it has address records but no CNAME.
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, adns.Result, error) {
+	target, _, result, err := r.query(ctx, host, dnsmessage.TypeA)
+	if err != nil && (!dns.IsNotFound(err) || target == "") {
+		return "", result, err
+	}
+	return target, result, nil
+}
+
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, adns.Result, error) {
+	ips, result, err := r.LookupIP(ctx, "ip", host)
+	var l []string
+	for _, ip := range ips {
+		l = append(l, ip.String())
+	}
+	return l, result, err
+}
+
+// LookupIP looks up IPv4 and/or IPv6 addresses for network "ip", "ip4" or "ip6".
+// The result is only authentic if all lookups were authentic.
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, adns.Result, error) {
+	var types []dnsmessage.Type
+	switch network {
+	case "ip":
+		types = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	case "ip4":
+		types = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		types = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		return nil, adns.Result{}, &adns.DNSError{Err: "unsupported network " + network, Name: host}
+	}
+	result := adns.Result{Authentic: true}
+	var ips []net.IP
+	var notFound error
+	for _, typ := range types {
+		_, rrs, xresult, err := r.query(ctx, host, typ)
+		result.Authentic = result.Authentic && xresult.Authentic
+		if err != nil && dns.IsNotFound(err) {
+			notFound = err
+			continue
+		} else if err != nil {
+			return nil, adns.Result{}, err
+		}
+		for _, rr := range rrs {
+			switch b := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(b.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(b.AAAA[:]))
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, result, notFound
+	}
+	return ips, result, nil
+}
+
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, adns.Result, error) {
+	ips, result, err := r.LookupIP(ctx, "ip", host)
+	var l []net.IPAddr
+	for _, ip := range ips {
+		l = append(l, net.IPAddr{IP: ip})
+	}
+	return l, result, err
+}
+
+// LookupMX returns MX records sorted by preference.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, adns.Result, error) {
+	_, rrs, result, err := r.query(ctx, name, dnsmessage.TypeMX)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []*net.MX
+	for _, rr := range rrs {
+		mx := rr.Body.(*dnsmessage.MXResource)
+		l = append(l, &net.MX{Host: mx.MX.String(), Pref: mx.Pref})
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Pref < l[j].Pref
+	})
+	return l, result, nil
+}
+
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, adns.Result, error) {
+	_, rrs, result, err := r.query(ctx, name, dnsmessage.TypeNS)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []*net.NS
+	for _, rr := range rrs {
+		l = append(l, &net.NS{Host: rr.Body.(*dnsmessage.NSResource).NS.String()})
+	}
+	return l, result, nil
+}
+
+// LookupSRV looks up SRV records for "_service._proto.name", or name if both
+// service and proto are empty. Records are sorted by priority, and by weight
+// (highest first) within a priority.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, adns.Result, error) {
+	if service != "" || proto != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+	target, rrs, result, err := r.query(ctx, name, dnsmessage.TypeSRV)
+	if err != nil {
+		return "", nil, result, err
+	}
+	var l []*net.SRV
+	for _, rr := range rrs {
+		srv := rr.Body.(*dnsmessage.SRVResource)
+		l = append(l, &net.SRV{Target: srv.Target.String(), Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Priority != l[j].Priority {
+			return l[i].Priority < l[j].Priority
+		}
+		return l[i].Weight > l[j].Weight
+	})
+	return target, l, result, nil
+}
+
+// LookupTXT returns TXT records, with the strings of each record concatenated.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, adns.Result, error) {
+	_, rrs, result, err := r.query(ctx, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []string
+	for _, rr := range rrs {
+		l = append(l, strings.Join(rr.Body.(*dnsmessage.TXTResource).TXT, ""))
+	}
+	return l, result, nil
+}
+
+// LookupTLSA looks up TLSA records for "_port._protocol.host", or host if port
+// is 0 and protocol empty.
+func (r *Resolver) LookupTLSA(ctx context.Context, port int, protocol, host string) ([]adns.TLSA, adns.Result, error) {
+	name := host
+	if port != 0 || protocol != "" {
+		name = fmt.Sprintf("_%d._%s.%s", port, protocol, host)
+	}
+	_, rrs, result, err := r.query(ctx, name, typeTLSA)
+	if err != nil {
+		return nil, result, err
+	}
+	var l []adns.TLSA
+	for _, rr := range rrs {
+		data := rr.Body.(*dnsmessage.UnknownResource).Data
+		if len(data) < 3 {
+			return nil, result, &adns.DNSError{Err: "malformed tlsa record", Name: name}
+		}
+		l = append(l, adns.TLSA{
+			Usage:     adns.TLSAUsage(data[0]),
+			Selector:  adns.TLSASelector(data[1]),
+			MatchType: adns.TLSAMatchType(data[2]),
+			CertAssoc: data[3:],
+		})
+	}
+	return l, result, nil
+}
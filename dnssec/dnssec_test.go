@@ -0,0 +1,591 @@
+package dnssec
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mjl-/adns"
+
+	"github.com/qompassai/beacon/dns"
+)
+
+var ctxbg = context.Background()
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, expected %v", got, exp)
+	}
+}
+
+// testZone is a signed zone with a single key.
+type testZone struct {
+	name   string
+	alg    uint8
+	key    crypto.Signer
+	dnskey dnskey
+}
+
+func newTestZone(t *testing.T, name string, alg uint8) testZone {
+	var key crypto.Signer
+	var pub []byte
+	switch alg {
+	case algECDSAP256SHA256:
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tcheck(t, err, "generate ecdsa key")
+		pub = append(k.X.FillBytes(make([]byte, 32)), k.Y.FillBytes(make([]byte, 32))...)
+		key = k
+	case algED25519:
+		p, k, err := ed25519.GenerateKey(rand.Reader)
+		tcheck(t, err, "generate ed25519 key")
+		pub = p
+		key = k
+	}
+	// Flags: zone key and secure entry point. Protocol 3.
+	rdata := append([]byte{0x01, 0x01, 3, alg}, pub...)
+	k, err := parseDNSKEY(rdata)
+	tcheck(t, err, "parse dnskey")
+	return testZone{name, alg, key, k}
+}
+
+func (z testZone) ds() DS {
+	h := sha256.Sum256(append(wireName(z.name), z.dnskey.rdata...))
+	return DS{z.dnskey.keyTag(), z.alg, digestSHA256, h[:]}
+}
+
+func rr(name string, typ dnsmessage.Type, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: 300},
+		Body:   body,
+	}
+}
+
+// sign returns an RRSIG record for the records.
+func (z testZone) sign(t *testing.T, rrs []dnsmessage.Resource, now time.Time) dnsmessage.Resource {
+	t.Helper()
+	owner := canonicalName(rrs[0].Header.Name)
+	typ := rrs[0].Header.Type
+	buf := binary.BigEndian.AppendUint16(nil, uint16(typ))
+	buf = append(buf, z.alg, byte(countLabels(owner)))
+	buf = binary.BigEndian.AppendUint32(buf, 300)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(now.Add(24*time.Hour).Unix()))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(now.Add(-time.Hour).Unix()))
+	buf = binary.BigEndian.AppendUint16(buf, z.dnskey.keyTag())
+	buf = append(buf, wireName(z.name)...)
+	sig, err := parseRRSIG(buf)
+	tcheck(t, err, "parse rrsig")
+	data, err := signedData(sig, owner, typ, rrs)
+	tcheck(t, err, "signed data")
+
+	var signature []byte
+	switch k := z.key.(type) {
+	case *ecdsa.PrivateKey:
+		h := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, k, h[:])
+		tcheck(t, err, "ecdsa sign")
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, data)
+	}
+	return rr(owner, typeRRSIG, &dnsmessage.UnknownResource{Type: typeRRSIG, Data: append(buf, signature...)})
+}
+
+// typeBitmap returns an NSEC type bitmap for types below 256.
+func typeBitmap(types ...dnsmessage.Type) []byte {
+	b := make([]byte, 32)
+	var n int
+	for _, typ := range types {
+		b[typ/8] |= 0x80 >> (typ % 8)
+		if int(typ/8) >= n {
+			n = int(typ/8) + 1
+		}
+	}
+	return append([]byte{0, byte(n)}, b[:n]...)
+}
+
+// testServer answers requests like a recursive resolver, from records in
+// memory.
+type testServer struct {
+	records  map[rrsetKey][]dnsmessage.Resource // Including RRSIGs for the records.
+	nsecs    map[string][]dnsmessage.Resource   // NSEC records of signed zones with signatures, by zone.
+	noProofs atomic.Bool                        // Whether to leave NSEC records out of responses.
+	requests atomic.Int32
+}
+
+func (s *testServer) add(rrs ...dnsmessage.Resource) {
+	for _, rr := range rrs {
+		typ := rr.Header.Type
+		if typ == typeRRSIG {
+			typ = dnsmessage.Type(binary.BigEndian.Uint16(rr.Body.(*dnsmessage.UnknownResource).Data))
+		}
+		k := rrsetKey{canonicalName(rr.Header.Name), typ}
+		s.records[k] = append(s.records[k], rr)
+	}
+}
+
+// addNSECs adds a signed NSEC chain for zone z, with the names in the zone and
+// their types.
+func (s *testServer) addNSECs(t *testing.T, z testZone, names map[string][]dnsmessage.Type, now time.Time) {
+	var l []string
+	for name := range names {
+		l = append(l, name)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return canonicalCompare(l[i], l[j]) < 0
+	})
+	for i, name := range l {
+		data := append(wireName(l[(i+1)%len(l)]), typeBitmap(append(names[name], typeRRSIG, typeNSEC)...)...)
+		nsec := rr(name, typeNSEC, &dnsmessage.UnknownResource{Type: typeNSEC, Data: data})
+		s.nsecs[z.name] = append(s.nsecs[z.name], nsec, z.sign(t, []dnsmessage.Resource{nsec}, now))
+	}
+}
+
+// exists returns whether there are records for name or names below it.
+func (s *testServer) exists(name string) bool {
+	for k := range s.records {
+		if isSubdomain(k.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testServer) handle(t *testing.T, req []byte) []byte {
+	s.requests.Add(1)
+
+	var msg dnsmessage.Message
+	err := msg.Unpack(req)
+	tcheck(t, err, "parse request")
+	q := msg.Questions[0]
+	name := canonicalName(q.Name)
+
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.Header.ID, Response: true, RecursionAvailable: true},
+		Questions: msg.Questions,
+	}
+	// Add the NSEC records of the zone of name. DS records are in the parent zone.
+	proofs := func() {
+		if s.noProofs.Load() {
+			return
+		}
+		zone := name
+		if q.Type == typeDS {
+			zone = parentName(name)
+		}
+		for ; s.nsecs[zone] == nil && zone != "."; zone = parentName(zone) {
+		}
+		resp.Authorities = s.nsecs[zone]
+	}
+	for i := 0; i < 10; i++ {
+		owner := name
+		exists := s.exists(name)
+		if w := wildcardName(parentName(name)); !exists && s.exists(w) {
+			// Synthesized from wildcard, with proof that name doesn't exist.
+			owner = w
+			exists = true
+			proofs()
+		}
+		if rrs, ok := s.records[rrsetKey{owner, q.Type}]; ok {
+			for _, rr := range rrs {
+				rr.Header.Name = dnsmessage.MustNewName(name)
+				resp.Answers = append(resp.Answers, rr)
+			}
+			break
+		} else if rrs, ok := s.records[rrsetKey{owner, dnsmessage.TypeCNAME}]; ok {
+			resp.Answers = append(resp.Answers, rrs...)
+			name = canonicalName(rrs[0].Body.(*dnsmessage.CNAMEResource).CNAME)
+			continue
+		}
+		if !exists {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+		proofs()
+		break
+	}
+	buf, err := resp.Pack()
+	tcheck(t, err, "pack response")
+	return buf
+}
+
+// serveTLS serves DNS-over-TLS requests.
+func (s *testServer) serveTLS(t *testing.T, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var size [2]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint16(size[:]))
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			resp := s.handle(t, req)
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+		}()
+	}
+}
+
+func TestResolver(t *testing.T) {
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	root := newTestZone(t, ".", algECDSAP256SHA256)
+	example := newTestZone(t, "example.", algED25519)
+
+	srv := &testServer{records: map[rrsetKey][]dnsmessage.Resource{}, nsecs: map[string][]dnsmessage.Resource{}}
+	// Names and types in the signed zones, for the NSEC chains.
+	zoneTypes := map[string]map[string][]dnsmessage.Type{
+		".":        {".": {dnsmessage.TypeNS, dnsmessage.TypeSOA}},
+		"example.": {"example.": {dnsmessage.TypeNS, dnsmessage.TypeSOA}},
+	}
+	addType := func(z testZone, rrs ...dnsmessage.Resource) {
+		for _, rr := range rrs {
+			name := canonicalName(rr.Header.Name)
+			zoneTypes[z.name][name] = append(zoneTypes[z.name][name], rr.Header.Type)
+		}
+	}
+	unsigned := func(z testZone, rrs ...dnsmessage.Resource) {
+		srv.add(rrs...)
+		addType(z, rrs...)
+	}
+	signed := func(z testZone, rrs ...dnsmessage.Resource) {
+		unsigned(z, rrs...)
+		srv.add(z.sign(t, rrs, now))
+	}
+
+	// Root zone, delegating securely to example. and insecurely to insecure..
+	signed(root, rr(".", typeDNSKEY, &dnsmessage.UnknownResource{Type: typeDNSKEY, Data: root.dnskey.rdata}))
+	exampleDS := example.ds()
+	dsdata := binary.BigEndian.AppendUint16(nil, exampleDS.KeyTag)
+	dsdata = append(dsdata, exampleDS.Algorithm, exampleDS.DigestType)
+	signed(root, rr("example.", typeDS, &dnsmessage.UnknownResource{Type: typeDS, Data: append(dsdata, exampleDS.Digest...)}))
+	zoneTypes["."]["example."] = append(zoneTypes["."]["example."], dnsmessage.TypeNS)
+	unsigned(root, rr("insecure.", dnsmessage.TypeNS, &dnsmessage.NSResource{NS: dnsmessage.MustNewName("ns.insecure.")}))
+
+	// Signed zone.
+	signed(example, rr("example.", typeDNSKEY, &dnsmessage.UnknownResource{Type: typeDNSKEY, Data: example.dnskey.rdata}))
+	signed(example, rr("example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}}))
+	signed(example,
+		rr("example.", dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: 20, MX: dnsmessage.MustNewName("mail2.example.")}),
+		rr("example.", dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("Mail.Example.")}),
+	)
+	signed(example, rr("mail.example.", dnsmessage.TypeA, &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}}))
+	signed(example, rr("alias.example.", dnsmessage.TypeCNAME, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("mail.example.")}))
+	tlsaData, _ := hex.DecodeString("030101" + strings.Repeat("ab", 32))
+	signed(example, rr("_25._tcp.mail.example.", typeTLSA, &dnsmessage.UnknownResource{Type: typeTLSA, Data: tlsaData}))
+	// Signature for other data.
+	bogus := example.sign(t, []dnsmessage.Resource{rr("bogus.example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"original"}})}, now)
+	unsigned(example, rr("bogus.example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"modified"}}))
+	srv.add(bogus)
+	// Missing signature in signed zone.
+	unsigned(example, rr("unsigned.example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"stripped"}}))
+	// Signed by a key of another zone.
+	unsigned(example, rr("othersigner.example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"root"}}))
+	srv.add(root.sign(t, []dnsmessage.Resource{rr("othersigner.example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"root"}})}, now))
+	// Wildcard.
+	signed(example, rr("*.wild.example.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"wildcard"}}))
+
+	srv.addNSECs(t, root, zoneTypes["."], now)
+	srv.addNSECs(t, example, zoneTypes["example."], now)
+
+	// Unsigned zone.
+	srv.add(rr("insecure.", dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: []string{"unsigned"}}))
+
+	// Certificate for TLS server.
+	tlsKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tcheck(t, err, "generate tls key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certBuf, err := x509.CreateCertificate(rand.Reader, template, template, tlsKey.Public(), tlsKey)
+	tcheck(t, err, "create certificate")
+	cert, err := x509.ParseCertificate(certBuf)
+	tcheck(t, err, "parse certificate")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{certBuf}, PrivateKey: tlsKey}}}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	tcheck(t, err, "listen")
+	defer ln.Close()
+	go srv.serveTLS(t, ln)
+
+	// Port that is not listening, for checking that the next upstream is tried.
+	closedln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	closedAddr := closedln.Addr().String()
+	closedln.Close()
+
+	httpsrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		req, err := io.ReadAll(r.Body)
+		tcheck(t, err, "read request")
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(srv.handle(t, req))
+	}))
+	httpsrv.TLS = tlsConfig
+	httpsrv.StartTLS()
+	defer httpsrv.Close()
+
+	anchors := []DS{root.ds()}
+	resolver, err := New([]string{"tls://" + closedAddr, "tls://" + ln.Addr().String()}, anchors, Opts{RootCAs: pool})
+	tcheck(t, err, "new resolver")
+
+	// Secure answer.
+	txt, result, err := resolver.LookupTXT(ctxbg, "example.")
+	tcheck(t, err, "lookup txt")
+	tcompare(t, txt, []string{"v=spf1 -all"})
+	tcompare(t, result.Authentic, true)
+
+	// Cached.
+	n := srv.requests.Load()
+	_, result, err = resolver.LookupTXT(ctxbg, "EXAMPLE.")
+	tcheck(t, err, "lookup txt")
+	tcompare(t, result.Authentic, true)
+	tcompare(t, srv.requests.Load(), n)
+
+	// Secure answer, with CNAME, and secure absence of AAAA records.
+	ips, result, err := resolver.LookupIP(ctxbg, "ip", "alias.example.")
+	tcheck(t, err, "lookup ip")
+	tcompare(t, ips, []net.IP{net.IPv4(10, 0, 0, 1).To4()})
+	tcompare(t, result.Authentic, true)
+
+	cname, result, err := resolver.LookupCNAME(ctxbg, "alias.example.")
+	tcheck(t, err, "lookup cname")
+	tcompare(t, cname, "mail.example.")
+	tcompare(t, result.Authentic, true)
+
+	tlsa, result, err := resolver.LookupTLSA(ctxbg, 25, "tcp", "mail.example.")
+	tcheck(t, err, "lookup tlsa")
+	tcompare(t, tlsa, []adns.TLSA{{Usage: adns.TLSAUsageDANEEE, Selector: adns.TLSASelectorSPKI, MatchType: adns.TLSAMatchTypeSHA256, CertAssoc: tlsaData[3:]}})
+	tcompare(t, result.Authentic, true)
+
+	// Non-existent name.
+	_, result, err = resolver.LookupTXT(ctxbg, "absent.example.")
+	if !dns.IsNotFound(err) {
+		t.Fatalf("got err %v, expected not found", err)
+	}
+	tcompare(t, result.Authentic, true)
+
+	// Existing name without records of requested type, and empty non-terminal.
+	_, result, err = resolver.LookupTXT(ctxbg, "mail.example.")
+	if !dns.IsNotFound(err) {
+		t.Fatalf("got err %v, expected not found", err)
+	}
+	tcompare(t, result.Authentic, true)
+	_, result, err = resolver.LookupTXT(ctxbg, "_tcp.mail.example.")
+	if !dns.IsNotFound(err) {
+		t.Fatalf("got err %v, expected not found", err)
+	}
+	tcompare(t, result.Authentic, true)
+
+	// Synthesized from wildcard.
+	txt, result, err = resolver.LookupTXT(ctxbg, "a.wild.example.")
+	tcheck(t, err, "lookup txt")
+	tcompare(t, txt, []string{"wildcard"})
+	tcompare(t, result.Authentic, true)
+
+	// Unsigned zone.
+	txt, result, err = resolver.LookupTXT(ctxbg, "insecure.")
+	tcheck(t, err, "lookup txt")
+	tcompare(t, txt, []string{"unsigned"})
+	tcompare(t, result.Authentic, false)
+
+	// Bogus responses: signature for other data, missing signature in signed zone,
+	// signature from other zone.
+	for _, name := range []string{"bogus.example.", "unsigned.example.", "othersigner.example."} {
+		_, _, err = resolver.LookupTXT(ctxbg, name)
+		var dnsErr *adns.DNSError
+		if err == nil || dns.IsNotFound(err) || !errors.As(err, &dnsErr) || !dnsErr.IsTemporary {
+			t.Fatalf("%s: got err %v, expected temporary error", name, err)
+		}
+	}
+
+	// Without proofs, non-existent names and wildcard answers are bogus.
+	srv.noProofs.Store(true)
+	for _, name := range []string{"absent2.example.", "b.wild.example."} {
+		_, _, err = resolver.LookupTXT(ctxbg, name)
+		var dnsErr *adns.DNSError
+		if err == nil || dns.IsNotFound(err) || !errors.As(err, &dnsErr) || !dnsErr.IsTemporary {
+			t.Fatalf("%s: got err %v, expected temporary error", name, err)
+		}
+	}
+	srv.noProofs.Store(false)
+
+	// Expired signatures, after cache entries have expired too.
+	now = now.Add(48 * time.Hour)
+	_, _, err = resolver.LookupTXT(ctxbg, "example.")
+	if err == nil {
+		t.Fatalf("got nil err for expired signature")
+	}
+	now = now.Add(-48 * time.Hour)
+
+	// DNS-over-HTTPS, through a StrictResolver.
+	resolver, err = New([]string{httpsrv.URL + "/dns-query"}, anchors, Opts{RootCAs: pool})
+	tcheck(t, err, "new resolver")
+	dns.DefaultResolver = resolver
+	defer func() { dns.DefaultResolver = nil }()
+	mxs, result, err := dns.StrictResolver{}.LookupMX(ctxbg, "example.")
+	tcheck(t, err, "lookup mx")
+	tcompare(t, mxs, []*net.MX{{Host: "Mail.Example.", Pref: 10}, {Host: "mail2.example.", Pref: 20}})
+	tcompare(t, result.Authentic, true)
+
+	// Trust anchor that doesn't match.
+	resolver, err = New([]string{httpsrv.URL}, []DS{example.ds()}, Opts{RootCAs: pool})
+	tcheck(t, err, "new resolver")
+	_, _, err = resolver.LookupTXT(ctxbg, "example.")
+	if err == nil {
+		t.Fatalf("got nil err for mismatching trust anchor")
+	}
+
+	_, err = New([]string{"udp://127.0.0.1"}, nil, Opts{})
+	if err == nil {
+		t.Fatalf("got nil err for unsupported upstream scheme")
+	}
+}
+
+func TestNSEC3Hash(t *testing.T) {
+	// From RFC 5155 appendix A.
+	salt, _ := hex.DecodeString("aabbccdd")
+	tcompare(t, nsec3Hash("example.", salt, 12), "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom")
+	tcompare(t, nsec3Hash("a.example.", salt, 12), "35mthgpgcu1qg68fab165klnsnk3dpvl")
+}
+
+func TestDenial(t *testing.T) {
+	// NSEC3 chain for zone example. with names example., a.example., the unsigned
+	// delegation b.example. and empty non-terminal d.example. for c.d.example..
+	salt := []byte{0xaa, 0xbb}
+	nsec3s := func(optOut bool) denial {
+		names := map[string][]byte{
+			"example.":     typeBitmap(dnsmessage.TypeNS, dnsmessage.TypeSOA, typeRRSIG, typeDNSKEY),
+			"a.example.":   typeBitmap(dnsmessage.TypeA, typeRRSIG),
+			"b.example.":   typeBitmap(dnsmessage.TypeNS),
+			"d.example.":   nil,
+			"c.d.example.": typeBitmap(dnsmessage.TypeTXT, typeRRSIG),
+		}
+		var hashes []string
+		bitmaps := map[string][]byte{}
+		for name, bitmap := range names {
+			h := nsec3Hash(name, salt, 1)
+			hashes = append(hashes, h)
+			bitmaps[h] = bitmap
+		}
+		sort.Strings(hashes)
+		var d denial
+		for i, h := range hashes {
+			d.nsec3s = append(d.nsec3s, nsec3Record{"example.", h, hashes[(i+1)%len(hashes)], optOut, salt, 1, bitmaps[h]})
+		}
+		return d
+	}
+
+	d := nsec3s(false)
+	testNameError := func(d denial, name string, expOK, expOptOut bool) {
+		t.Helper()
+		ok, optOut := d.nameError(name)
+		tcompare(t, []bool{ok, optOut}, []bool{expOK, expOptOut})
+	}
+	testNoData := func(d denial, name string, typ dnsmessage.Type, expOK, expDelegation, expOptOut bool) {
+		t.Helper()
+		ok, delegation, optOut := d.noData(name, typ)
+		tcompare(t, []bool{ok, delegation, optOut}, []bool{expOK, expDelegation, expOptOut})
+	}
+	testNameError(d, "x.example.", true, false)
+	testNameError(d, "x.y.a.example.", true, false)
+	testNameError(d, "a.example.", false, false)
+	testNameError(d, "x.b.example.", false, false) // Below delegation.
+	testNameError(nsec3s(true), "x.example.", true, true)
+	testNoData(d, "a.example.", dnsmessage.TypeAAAA, true, false, false)
+	testNoData(d, "a.example.", dnsmessage.TypeA, false, false, false)
+	testNoData(d, "d.example.", dnsmessage.TypeTXT, true, false, false)
+	testNoData(d, "b.example.", typeDS, true, true, false)
+	testNoData(d, "b.example.", dnsmessage.TypeA, false, false, false) // Parent side of delegation.
+	testNoData(d, "example.", typeDS, false, false, false)             // Child side of delegation.
+	testNoData(d, "x.example.", typeDS, false, false, false)
+	testNoData(nsec3s(true), "x.example.", typeDS, false, false, true)
+
+	// NSEC chain for zone example. with names example., the unsigned delegation
+	// b.example., and c.d.example. with empty non-terminal d.example..
+	d = denial{nsecs: []nsecRecord{
+		{"example.", "example.", "b.example.", typeBitmap(dnsmessage.TypeNS, dnsmessage.TypeSOA, typeRRSIG, typeNSEC, typeDNSKEY)},
+		{"example.", "b.example.", "c.d.example.", typeBitmap(dnsmessage.TypeNS, typeRRSIG, typeNSEC)},
+		{"example.", "c.d.example.", "example.", typeBitmap(dnsmessage.TypeTXT, typeRRSIG, typeNSEC)},
+	}}
+	testNameError(d, "a.example.", true, false)
+	testNameError(d, "e.example.", true, false)
+	testNameError(d, "x.c.d.example.", true, false)
+	testNameError(d, "x.b.example.", false, false) // Below delegation.
+	testNameError(d, "d.example.", false, false)   // Empty non-terminal.
+	testNameError(d, "x.other.", false, false)     // Outside zone.
+	testNoData(d, "d.example.", dnsmessage.TypeTXT, true, false, false)
+	testNoData(d, "c.d.example.", dnsmessage.TypeA, true, false, false)
+	testNoData(d, "c.d.example.", dnsmessage.TypeTXT, false, false, false)
+	testNoData(d, "b.example.", typeDS, true, true, false)
+	testNoData(d, "b.example.", dnsmessage.TypeA, false, false, false)
+
+	// Wildcard in NSEC3 chain: *.example. proves absence of TXT for x.example., and
+	// the answer for x.example. must prove x.example. doesn't exist.
+	d = nsec3s(false)
+	w := nsec3Hash("*.example.", salt, 1)
+	n := d.nsec3Cover("*.example.")
+	d.nsec3s = append(d.nsec3s, nsec3Record{"example.", w, n.next, false, salt, 1, typeBitmap(dnsmessage.TypeA, typeRRSIG)})
+	n.next = w
+	testNoData(d, "x.example.", dnsmessage.TypeTXT, true, false, false)
+	testNoData(d, "x.example.", dnsmessage.TypeA, false, false, false)
+	tcompare(t, d.wildcardAnswer("x.example.", 1), true)
+	tcompare(t, d.wildcardAnswer("a.example.", 1), false)
+}
+
+func TestParseDS(t *testing.T) {
+	ds, err := ParseDS("20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D")
+	tcheck(t, err, "parse ds")
+	tcompare(t, ds, RootTrustAnchors[0])
+	tcompare(t, ds.String(), "20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D")
+
+	for _, s := range []string{"", "20326 8 2", "x 8 2 00", "20326 8 2 zz"} {
+		if _, err := ParseDS(s); err == nil {
+			t.Fatalf("got nil err for invalid ds %q", s)
+		}
+	}
+}
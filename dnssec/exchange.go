@@ -0,0 +1,188 @@
+package dnssec
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mjl-/adns"
+)
+
+// Maximum duration of a request to a single upstream resolver.
+const upstreamTimeout = 10 * time.Second
+
+// exchange sends a request for name and typ to the upstream resolvers in order,
+// until one responds. The response and the upstream that sent it are returned.
+func (r *Resolver) exchange(ctx context.Context, name string, typ dnsmessage.Type) (*dnsmessage.Message, string, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, "", &adns.DNSError{Err: "invalid name", Name: name}
+	}
+	q := dnsmessage.Question{Name: qname, Type: typ, Class: dnsmessage.ClassINET}
+
+	var lastErr error
+	var lastServer string
+	for _, u := range r.upstreams {
+		start := time.Now()
+		var msg *dnsmessage.Message
+		if u.Scheme == "https" {
+			msg, err = r.exchangeHTTPS(ctx, u, q)
+		} else {
+			msg, err = r.exchangeTLS(ctx, u.Host, q)
+		}
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		MetricExchange.ObserveLabels(float64(time.Since(start))/float64(time.Second), u.Scheme, result)
+		if err == nil {
+			return msg, u.String(), nil
+		}
+		r.log.Debugx("dns request to upstream resolver", err,
+			slog.String("upstream", u.String()),
+			slog.String("name", name),
+			slog.Any("type", typ))
+		lastErr = err
+		lastServer = u.String()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	timeout := errors.Is(lastErr, os.ErrDeadlineExceeded) || errors.Is(lastErr, context.DeadlineExceeded)
+	return nil, lastServer, &adns.DNSError{Underlying: lastErr, Err: lastErr.Error(), Name: name, Server: lastServer, IsTimeout: timeout, IsTemporary: true}
+}
+
+// packRequest returns a recursive request for q with the "DNSSEC OK" bit set.
+func packRequest(id uint16, q dnsmessage.Question) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var rh dnsmessage.ResourceHeader
+	if err := rh.SetEDNS0(4096, dnsmessage.RCodeSuccess, true); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// parseResponse parses a response and checks that it matches the request.
+func parseResponse(buf []byte, id uint16, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("parsing response: %v", err)
+	}
+	if !msg.Header.Response || msg.Header.ID != id {
+		return nil, errors.New("message is not a response to request")
+	}
+	if len(msg.Questions) != 1 || msg.Questions[0].Type != q.Type || msg.Questions[0].Class != q.Class || !strings.EqualFold(msg.Questions[0].Name.String(), q.Name.String()) {
+		return nil, errors.New("response is for different question")
+	}
+	if msg.Header.Truncated {
+		return nil, errors.New("response is truncated")
+	}
+	return &msg, nil
+}
+
+// exchangeTLS sends a request over DNS-over-TLS, RFC 7858, with messages
+// prefixed by their size, like DNS over TCP.
+//
+// todo: reuse connections for multiple requests.
+func (r *Resolver) exchangeTLS(ctx context.Context, addr string, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := r.tlsConfig.Clone()
+	config.ServerName = host
+	dialer := tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	id := uint16(rand.Uint32())
+	req, err := packRequest(id, q)
+	if err != nil {
+		return nil, fmt.Errorf("packing request: %v", err)
+	}
+	buf := binary.BigEndian.AppendUint16(nil, uint16(len(req)))
+	if _, err := conn.Write(append(buf, req...)); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+	var sizebuf [2]byte
+	if _, err := io.ReadFull(conn, sizebuf[:]); err != nil {
+		return nil, fmt.Errorf("read response size: %w", err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(sizebuf[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return parseResponse(resp, id, q)
+}
+
+// exchangeHTTPS sends a request with DNS-over-HTTPS, RFC 8484, as POST request.
+func (r *Resolver) exchangeHTTPS(ctx context.Context, u *url.URL, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+
+	// ID 0 makes responses cache-friendly for HTTP caches.
+	req, err := packRequest(0, q)
+	if err != nil {
+		return nil, fmt.Errorf("packing request: %v", err)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("new http request: %v", err)
+	}
+	hreq.Header.Set("Content-Type", "application/dns-message")
+	hreq.Header.Set("Accept", "application/dns-message")
+	resp, err := r.httpClient.Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http response status %q", resp.Status)
+	}
+	if ct, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || ct != "application/dns-message" {
+		return nil, fmt.Errorf("http response has content-type %q, expected application/dns-message", resp.Header.Get("Content-Type"))
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("read http response: %w", err)
+	}
+	return parseResponse(buf, 0, q)
+}
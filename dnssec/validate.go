@@ -0,0 +1,1255 @@
+package dnssec
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mjl-/adns"
+)
+
+// Record types not known to package dnsmessage.
+const (
+	typeDNAME  dnsmessage.Type = 39
+	typeDS     dnsmessage.Type = 43
+	typeRRSIG  dnsmessage.Type = 46
+	typeNSEC   dnsmessage.Type = 47
+	typeDNSKEY dnsmessage.Type = 48
+	typeNSEC3  dnsmessage.Type = 50
+	typeTLSA   dnsmessage.Type = 52
+)
+
+// Supported DNSSEC signing algorithms. Algorithms based on SHA-1 are not
+// supported, records signed with them are treated as unsigned.
+const (
+	algRSASHA256       = 8
+	algRSASHA512       = 10
+	algECDSAP256SHA256 = 13
+	algECDSAP384SHA384 = 14
+	algED25519         = 15
+)
+
+// Supported DS digest types.
+const (
+	digestSHA1   = 1
+	digestSHA256 = 2
+	digestSHA384 = 4
+)
+
+// Flag in DNSKEY records for keys that sign zone data.
+const flagZoneKey = 0x100
+
+// NSEC3 records with more iterations are ignored, as recommended by RFC 9276.
+const maxNSEC3Iterations = 150
+
+// Maximum number of nested lookups while following CNAMEs and chains of trust.
+const maxDepth = 32
+
+// Maximum number of CNAMEs followed in a response.
+const maxCNAMEs = 10
+
+// errBogus indicates records have signatures that do not verify.
+var errBogus = errors.New("dnssec validation failed")
+
+func supportedAlgorithm(alg uint8) bool {
+	switch alg {
+	case algRSASHA256, algRSASHA512, algECDSAP256SHA256, algECDSAP384SHA384, algED25519:
+		return true
+	}
+	return false
+}
+
+func supportedDigest(digestType uint8) bool {
+	switch digestType {
+	case digestSHA1, digestSHA256, digestSHA384:
+		return true
+	}
+	return false
+}
+
+// DS is a delegation signer record, identifying a DNSKEY of a zone by the digest
+// of the key. Used as trust anchor for the root zone.
+type DS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// ParseDS parses a DS record value in presentation format, e.g.
+// "20326 8 2 E06D44B8...".
+func ParseDS(s string) (DS, error) {
+	t := strings.Fields(s)
+	if len(t) < 4 {
+		return DS{}, errors.New("ds record must have key tag, algorithm, digest type and digest")
+	}
+	keyTag, err := strconv.ParseUint(t[0], 10, 16)
+	if err != nil {
+		return DS{}, fmt.Errorf("parsing key tag: %v", err)
+	}
+	alg, err := strconv.ParseUint(t[1], 10, 8)
+	if err != nil {
+		return DS{}, fmt.Errorf("parsing algorithm: %v", err)
+	}
+	digestType, err := strconv.ParseUint(t[2], 10, 8)
+	if err != nil {
+		return DS{}, fmt.Errorf("parsing digest type: %v", err)
+	}
+	digest, err := hex.DecodeString(strings.Join(t[3:], ""))
+	if err != nil {
+		return DS{}, fmt.Errorf("parsing digest: %v", err)
+	}
+	return DS{uint16(keyTag), uint8(alg), uint8(digestType), digest}, nil
+}
+
+func mustParseDS(s string) DS {
+	ds, err := ParseDS(s)
+	if err != nil {
+		panic(err)
+	}
+	return ds
+}
+
+// String returns the DS record value in presentation format.
+func (ds DS) String() string {
+	return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(hex.EncodeToString(ds.Digest)))
+}
+
+func parseDSData(data []byte) (DS, error) {
+	if len(data) < 4 {
+		return DS{}, errors.New("ds record too short")
+	}
+	return DS{binary.BigEndian.Uint16(data), data[2], data[3], data[4:]}, nil
+}
+
+// matches returns whether ds is a digest of key k for zone.
+func (ds DS) matches(zone string, k dnskey) bool {
+	if ds.KeyTag != k.keyTag() || ds.Algorithm != k.Algorithm {
+		return false
+	}
+	data := append(wireName(zone), k.rdata...)
+	var digest []byte
+	switch ds.DigestType {
+	case digestSHA1:
+		h := sha1.Sum(data)
+		digest = h[:]
+	case digestSHA256:
+		h := sha256.Sum256(data)
+		digest = h[:]
+	case digestSHA384:
+		h := sha512.Sum384(data)
+		digest = h[:]
+	default:
+		return false
+	}
+	return bytes.Equal(digest, ds.Digest)
+}
+
+type dnskey struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+	rdata     []byte
+}
+
+func parseDNSKEY(data []byte) (dnskey, error) {
+	if len(data) < 4 {
+		return dnskey{}, errors.New("dnskey record too short")
+	}
+	return dnskey{binary.BigEndian.Uint16(data), data[2], data[3], data[4:], data}, nil
+}
+
+// keyTag returns the key tag for the key, RFC 4034 appendix B.
+func (k dnskey) keyTag() uint16 {
+	var ac uint32
+	for i, b := range k.rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac)
+}
+
+// dnskeys returns the parsable DNSKEY records of owner.
+func dnskeys(owner string, rrs []dnsmessage.Resource) []dnskey {
+	var l []dnskey
+	for _, rr := range rrs {
+		u, ok := rr.Body.(*dnsmessage.UnknownResource)
+		if !ok || rr.Header.Type != typeDNSKEY || canonicalName(rr.Header.Name) != owner {
+			continue
+		}
+		if k, err := parseDNSKEY(u.Data); err == nil {
+			l = append(l, k)
+		}
+	}
+	return l
+}
+
+type rrsig struct {
+	TypeCovered dnsmessage.Type
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string // Lower case, with trailing dot.
+	Signature   []byte
+	signed      []byte // Record data without signature, with signer name in canonical form.
+}
+
+func parseRRSIG(data []byte) (rrsig, error) {
+	if len(data) < 18 {
+		return rrsig{}, errors.New("rrsig record too short")
+	}
+	sig := rrsig{
+		TypeCovered: dnsmessage.Type(binary.BigEndian.Uint16(data[0:])),
+		Algorithm:   data[2],
+		Labels:      data[3],
+		OriginalTTL: binary.BigEndian.Uint32(data[4:]),
+		Expiration:  binary.BigEndian.Uint32(data[8:]),
+		Inception:   binary.BigEndian.Uint32(data[12:]),
+		KeyTag:      binary.BigEndian.Uint16(data[16:]),
+	}
+	name, n, err := parseWireName(data[18:])
+	if err != nil {
+		return rrsig{}, fmt.Errorf("parsing signer name: %v", err)
+	}
+	sig.SignerName = name
+	sig.Signature = data[18+n:]
+	sig.signed = append(append([]byte{}, data[:18]...), wireName(name)...)
+	return sig, nil
+}
+
+// validTime returns whether now is within the validity period of the
+// signature. Times are compared with serial number arithmetic, RFC 4034 section
+// 3.1.5.
+func (sig rrsig) validTime(now time.Time) bool {
+	t := uint32(now.Unix())
+	return int32(t-sig.Inception) >= 0 && int32(sig.Expiration-t) >= 0
+}
+
+// parseWireName parses an uncompressed name in wire format, returning the name
+// in lower case with trailing dot, and the number of bytes consumed.
+func parseWireName(b []byte) (string, int, error) {
+	var labels []string
+	o := 0
+	for {
+		if o >= len(b) {
+			return "", 0, errors.New("name too short")
+		}
+		n := int(b[o])
+		o++
+		if n == 0 {
+			break
+		} else if n > 63 {
+			return "", 0, errors.New("compressed or invalid label")
+		} else if o+n > len(b) {
+			return "", 0, errors.New("label too short")
+		}
+		label := string(b[o : o+n])
+		if strings.Contains(label, ".") {
+			return "", 0, errors.New("label with dot not supported")
+		}
+		labels = append(labels, lowerASCII(label))
+		o += n
+	}
+	if len(labels) == 0 {
+		return ".", o, nil
+	}
+	return strings.Join(labels, ".") + ".", o, nil
+}
+
+// wireName returns the name, with trailing dot, in uncompressed wire format.
+func wireName(name string) []byte {
+	if name == "." {
+		return []byte{0}
+	}
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// canonicalName returns the name in lower case, with trailing dot.
+func canonicalName(n dnsmessage.Name) string {
+	return lowerASCII(n.String())
+}
+
+// countLabels returns the number of labels in name, not counting a leading
+// wildcard label, for comparing with the labels field of RRSIG records.
+func countLabels(name string) int {
+	if name == "." {
+		return 0
+	}
+	n := strings.Count(name, ".")
+	if strings.HasPrefix(name, "*.") {
+		n--
+	}
+	return n
+}
+
+// isSubdomain returns whether name is parent or a subdomain of parent.
+func isSubdomain(name, parent string) bool {
+	return parent == "." || name == parent || strings.HasSuffix(name, "."+parent)
+}
+
+// canonicalRData returns the record data in canonical form, RFC 4034 section
+// 6.2: uncompressed names, in lower case.
+func canonicalRData(body dnsmessage.ResourceBody) ([]byte, error) {
+	name := func(n dnsmessage.Name) []byte {
+		return wireName(canonicalName(n))
+	}
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return b.A[:], nil
+	case *dnsmessage.AAAAResource:
+		return b.AAAA[:], nil
+	case *dnsmessage.CNAMEResource:
+		return name(b.CNAME), nil
+	case *dnsmessage.NSResource:
+		return name(b.NS), nil
+	case *dnsmessage.PTRResource:
+		return name(b.PTR), nil
+	case *dnsmessage.MXResource:
+		return append(binary.BigEndian.AppendUint16(nil, b.Pref), name(b.MX)...), nil
+	case *dnsmessage.SRVResource:
+		buf := binary.BigEndian.AppendUint16(nil, b.Priority)
+		buf = binary.BigEndian.AppendUint16(buf, b.Weight)
+		buf = binary.BigEndian.AppendUint16(buf, b.Port)
+		return append(buf, name(b.Target)...), nil
+	case *dnsmessage.SOAResource:
+		buf := append(name(b.NS), name(b.MBox)...)
+		for _, v := range []uint32{b.Serial, b.Refresh, b.Retry, b.Expire, b.MinTTL} {
+			buf = binary.BigEndian.AppendUint32(buf, v)
+		}
+		return buf, nil
+	case *dnsmessage.TXTResource:
+		var buf []byte
+		for _, s := range b.TXT {
+			if len(s) > 255 {
+				return nil, errors.New("txt string too long")
+			}
+			buf = append(buf, byte(len(s)))
+			buf = append(buf, s...)
+		}
+		return buf, nil
+	case *dnsmessage.UnknownResource:
+		// Types without names in their data, like DNSKEY, DS, TLSA.
+		return b.Data, nil
+	}
+	return nil, fmt.Errorf("unsupported record type %T", body)
+}
+
+// signedData returns the data that is signed by sig for the records, RFC 4034
+// section 3.1.8.1.
+func signedData(sig rrsig, owner string, typ dnsmessage.Type, rrs []dnsmessage.Resource) ([]byte, error) {
+	var rdatas [][]byte
+	for _, rr := range rrs {
+		data, err := canonicalRData(rr.Body)
+		if err != nil {
+			return nil, err
+		}
+		rdatas = append(rdatas, data)
+	}
+	sort.Slice(rdatas, func(i, j int) bool {
+		return bytes.Compare(rdatas[i], rdatas[j]) < 0
+	})
+	buf := append([]byte{}, sig.signed...)
+	ownerWire := wireName(owner)
+	for i, data := range rdatas {
+		if i > 0 && bytes.Equal(data, rdatas[i-1]) {
+			continue
+		}
+		buf = append(buf, ownerWire...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(typ))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(dnsmessage.ClassINET))
+		buf = binary.BigEndian.AppendUint32(buf, sig.OriginalTTL)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+// verify checks the signature over data with key k.
+func verify(k dnskey, sig rrsig, data []byte) error {
+	switch k.Algorithm {
+	case algRSASHA256, algRSASHA512:
+		pub, err := parseRSAKey(k.PublicKey)
+		if err != nil {
+			return err
+		}
+		h := crypto.SHA256
+		if k.Algorithm == algRSASHA512 {
+			h = crypto.SHA512
+		}
+		hh := h.New()
+		hh.Write(data)
+		return rsa.VerifyPKCS1v15(pub, h, hh.Sum(nil), sig.Signature)
+
+	case algECDSAP256SHA256, algECDSAP384SHA384:
+		curve := elliptic.P256()
+		size := 32
+		var digest []byte
+		if k.Algorithm == algECDSAP256SHA256 {
+			h := sha256.Sum256(data)
+			digest = h[:]
+		} else {
+			curve = elliptic.P384()
+			size = 48
+			h := sha512.Sum384(data)
+			digest = h[:]
+		}
+		if len(k.PublicKey) != 2*size || len(sig.Signature) != 2*size {
+			return errors.New("invalid ecdsa key or signature size")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(k.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(k.PublicKey[size:]),
+		}
+		r := new(big.Int).SetBytes(sig.Signature[:size])
+		s := new(big.Int).SetBytes(sig.Signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid ecdsa signature")
+		}
+		return nil
+
+	case algED25519:
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("invalid ed25519 key size")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(k.PublicKey), data, sig.Signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %d", k.Algorithm)
+}
+
+// parseRSAKey parses an RSA public key from a DNSKEY record, RFC 3110 section 2.
+func parseRSAKey(b []byte) (*rsa.PublicKey, error) {
+	if len(b) < 1 {
+		return nil, errors.New("rsa key too short")
+	}
+	n := int(b[0])
+	b = b[1:]
+	if n == 0 {
+		if len(b) < 2 {
+			return nil, errors.New("rsa key too short")
+		}
+		n = int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if n == 0 || n > 4 || len(b) <= n {
+		return nil, errors.New("invalid rsa key exponent")
+	}
+	var e int
+	for _, c := range b[:n] {
+		e = e<<8 | int(c)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(b[n:]), E: e}, nil
+}
+
+// hasType returns whether the type bitmap of an NSEC or NSEC3 record, RFC 4034
+// section 4.1.2, includes typ.
+func hasType(bitmap []byte, typ dnsmessage.Type) bool {
+	for len(bitmap) >= 2 {
+		window, n := bitmap[0], int(bitmap[1])
+		if n == 0 || n > 32 || len(bitmap) < 2+n {
+			return false
+		}
+		if window == byte(typ>>8) {
+			bit := int(typ & 0xff)
+			return bit/8 < n && bitmap[2+bit/8]&(0x80>>(bit%8)) != 0
+		}
+		bitmap = bitmap[2+n:]
+	}
+	return false
+}
+
+// nsec3Hash returns the hashed owner name for name, as used in the first label
+// of NSEC3 records, RFC 5155 section 5.
+func nsec3Hash(name string, salt []byte, iterations int) string {
+	h := sha1.Sum(append(wireName(name), salt...))
+	for i := 0; i < iterations; i++ {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+	return strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(h[:]))
+}
+
+type rrsetKey struct {
+	name string // Lower case, with trailing dot.
+	typ  dnsmessage.Type
+}
+
+// groupRRsets groups records by owner name and type, and RRSIG records by owner
+// name and type covered.
+func groupRRsets(rrs []dnsmessage.Resource) (map[rrsetKey][]dnsmessage.Resource, map[rrsetKey][]rrsig) {
+	rrsets := map[rrsetKey][]dnsmessage.Resource{}
+	sigs := map[rrsetKey][]rrsig{}
+	for _, rr := range rrs {
+		if rr.Header.Class != dnsmessage.ClassINET {
+			continue
+		}
+		owner := canonicalName(rr.Header.Name)
+		if rr.Header.Type == typeRRSIG {
+			u, ok := rr.Body.(*dnsmessage.UnknownResource)
+			if !ok {
+				continue
+			}
+			sig, err := parseRRSIG(u.Data)
+			if err != nil {
+				continue
+			}
+			k := rrsetKey{owner, sig.TypeCovered}
+			sigs[k] = append(sigs[k], sig)
+			continue
+		}
+		k := rrsetKey{owner, rr.Header.Type}
+		rrsets[k] = append(rrsets[k], rr)
+	}
+	return rrsets, sigs
+}
+
+// request holds the state for a lookup, shared with its nested lookups for
+// following CNAMEs and chains of trust.
+type request struct {
+	depth int             // Number of nested lookups.
+	zones map[string]zone // Zones of names, determined while following DS records from the root.
+}
+
+func newRequest() *request {
+	return &request{zones: map[string]zone{}}
+}
+
+// zone is the closest enclosing zone of a name.
+type zone struct {
+	apex   string // Lower case, with trailing dot.
+	secure bool   // Whether the zone has a chain of trust from the trust anchors.
+}
+
+// lookup returns the validated answer for a request, from the cache or from an
+// upstream resolver.
+func (r *Resolver) lookup(ctx context.Context, req *request, name string, typ dnsmessage.Type) (answer, error) {
+	if req.depth >= maxDepth {
+		return answer{}, &adns.DNSError{Err: "too many nested lookups", Name: name, IsTemporary: true}
+	}
+	req.depth++
+	defer func() {
+		req.depth--
+	}()
+
+	name = lowerASCII(name)
+	k := cacheKey{name, typ}
+	if a, ok := r.cache.get(k, timeNow()); ok {
+		MetricCache.IncLabels("hit")
+		return a, nil
+	}
+	MetricCache.IncLabels("miss")
+
+	msg, server, err := r.exchange(ctx, name, typ)
+	if err != nil {
+		return answer{}, err
+	}
+	switch msg.Header.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	case dnsmessage.RCodeServerFailure:
+		return answer{}, &adns.DNSError{Err: "server misbehaving", Name: name, Server: server, IsTemporary: true}
+	default:
+		return answer{}, &adns.DNSError{Err: fmt.Sprintf("server responded with %s", msg.Header.RCode), Name: name, Server: server}
+	}
+
+	a, err := r.validate(ctx, req, name, typ, msg)
+	var dnsErr *adns.DNSError
+	if err != nil && errors.As(err, &dnsErr) {
+		return answer{}, err
+	} else if err != nil {
+		MetricValidation.IncLabels("bogus")
+		r.log.Infox("verifying dnssec signatures", err, slog.String("name", name), slog.Any("type", typ), slog.String("server", server))
+		return answer{}, &adns.DNSError{Underlying: err, Err: err.Error(), Name: name, Server: server, IsTemporary: true}
+	}
+	if a.authentic {
+		MetricValidation.IncLabels("secure")
+	} else {
+		MetricValidation.IncLabels("insecure")
+	}
+	a.server = server
+	r.cache.add(k, a, timeNow())
+	return a, nil
+}
+
+// validate verifies the records in the response for name and typ, following
+// CNAMEs, or the proof that no records exist.
+func (r *Resolver) validate(ctx context.Context, req *request, name string, typ dnsmessage.Type, msg *dnsmessage.Message) (answer, error) {
+	rrsets, sigs := groupRRsets(msg.Answers)
+
+	a := answer{rcode: msg.Header.RCode, name: name, authentic: true}
+	ttl := uint32(maxTTL / time.Second)
+	var found bool
+	for i := 0; ; i++ {
+		k := rrsetKey{a.name, typ}
+		rrs, ok := rrsets[k]
+		if !ok {
+			k = rrsetKey{a.name, dnsmessage.TypeCNAME}
+			rrs, ok = rrsets[k]
+			if !ok {
+				break
+			}
+		}
+		secure, err := r.verifyRRset(ctx, req, k.name, k.typ, rrs, sigs[k], msg.Authorities)
+		if err != nil {
+			return answer{}, err
+		}
+		a.authentic = a.authentic && secure
+		a.records = append(a.records, rrs...)
+		for _, rr := range rrs {
+			if rr.Header.TTL < ttl {
+				ttl = rr.Header.TTL
+			}
+		}
+		if k.typ == typ {
+			found = true
+			break
+		}
+		if i >= maxCNAMEs {
+			return answer{}, &adns.DNSError{Err: "too many cnames", Name: name}
+		}
+		a.name = canonicalName(rrs[0].Body.(*dnsmessage.CNAMEResource).CNAME)
+	}
+
+	if !found {
+		secure, delegation, err := r.verifyDenial(ctx, req, a.name, typ, msg.Header.RCode, msg.Authorities)
+		if err != nil {
+			return answer{}, err
+		}
+		a.authentic = a.authentic && secure
+		a.delegation = delegation
+
+		// Negative caching, RFC 2308 section 5.
+		negTTL := uint32(defaultNegativeTTL / time.Second)
+		for _, rr := range msg.Authorities {
+			if soa, ok := rr.Body.(*dnsmessage.SOAResource); ok {
+				negTTL = rr.Header.TTL
+				if soa.MinTTL < negTTL {
+					negTTL = soa.MinTTL
+				}
+			}
+		}
+		if negTTL < ttl {
+			ttl = negTTL
+		}
+	}
+	a.expires = timeNow().Add(time.Duration(ttl) * time.Second)
+	return a, nil
+}
+
+// zoneFor returns the closest enclosing zone for records of type typ at name,
+// and whether it is secure. The zone is found by looking up DS records for each
+// name from the root down to name: a secure DS record starts a secure zone, a
+// delegation without DS records (proven by NSEC/NSEC3) starts an insecure zone.
+// The security status of a zone does not depend on whether its records have
+// signatures, so stripped signatures are detected.
+func (r *Resolver) zoneFor(ctx context.Context, req *request, name string, typ dnsmessage.Type) (zone, error) {
+	// DS records are in the parent zone. A CNAME cannot be at the apex of a zone, so
+	// its zone is the zone of its parent, which also prevents looking up DS records
+	// for a name through its own CNAME.
+	if typ == typeDS || typ == dnsmessage.TypeCNAME {
+		name = parentName(name)
+	}
+
+	z := zone{".", r.anchorsSupported()}
+	labels := nameLabels(name)
+	for i := len(labels) - 1; i >= 0 && z.secure; i-- {
+		c := strings.Join(labels[i:], ".") + "."
+		if xz, ok := req.zones[c]; ok {
+			z = xz
+			continue
+		}
+
+		a, err := r.lookup(ctx, req, c, typeDS)
+		if err != nil {
+			return zone{}, err
+		}
+		var dss []DS
+		for _, rr := range a.records {
+			u, ok := rr.Body.(*dnsmessage.UnknownResource)
+			if !ok || rr.Header.Type != typeDS || canonicalName(rr.Header.Name) != c {
+				continue
+			}
+			if ds, err := parseDSData(u.Data); err == nil {
+				dss = append(dss, ds)
+			}
+		}
+		if len(dss) > 0 {
+			// Secure delegation, unless we cannot verify any of the keys.
+			z = zone{c, a.authentic && slices.ContainsFunc(dss, func(ds DS) bool {
+				return supportedAlgorithm(ds.Algorithm) && supportedDigest(ds.DigestType)
+			})}
+		} else if a.name != c {
+			// CNAME at c, verified as part of the lookup, so not a zone cut.
+		} else if !a.authentic || a.delegation {
+			// Delegation to an unsigned zone, possibly in an NSEC3 opt-out span.
+			z = zone{c, false}
+		} else if a.rcode == dnsmessage.RCodeNameError {
+			// Names below c don't exist either, no further zone cuts.
+			req.zones[c] = z
+			break
+		}
+		req.zones[c] = z
+	}
+	return z, nil
+}
+
+// anchorsSupported returns whether any of the trust anchors can be used for
+// verifying the root zone.
+func (r *Resolver) anchorsSupported() bool {
+	return slices.ContainsFunc(r.trustAnchors, func(ds DS) bool {
+		return supportedAlgorithm(ds.Algorithm) && supportedDigest(ds.DigestType)
+	})
+}
+
+// verifyRRset verifies the signatures of records, returning whether the records
+// are secure, i.e. have a valid signature through a chain of trust. Records in an
+// insecure zone are not secure. Records in a secure zone must have a valid
+// signature by the zone, an error wrapping errBogus is returned otherwise. For
+// records synthesized from a wildcard, authorities must prove that owner does not
+// exist.
+func (r *Resolver) verifyRRset(ctx context.Context, req *request, owner string, typ dnsmessage.Type, rrs []dnsmessage.Resource, sigs []rrsig, authorities []dnsmessage.Resource) (bool, error) {
+	z, err := r.zoneFor(ctx, req, owner, typ)
+	if err != nil || !z.secure {
+		return false, err
+	}
+	labels, err := r.verifySignatures(ctx, req, z.apex, owner, typ, rrs, sigs)
+	if err != nil {
+		return false, err
+	}
+	if labels == countLabels(owner) {
+		return true, nil
+	}
+
+	// Synthesized from a wildcard, RFC 4035 section 5.3.4.
+	d, err := r.denialRecords(ctx, req, z.apex, authorities)
+	if err != nil {
+		return false, err
+	} else if d.wildcardAnswer(owner, labels) {
+		return true, nil
+	} else if d.unsupported {
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: no proof that %s does not exist for records from wildcard", errBogus, owner)
+}
+
+// verifySignatures checks that at least one signature for the records verifies
+// with a key of the secure zone apex. The number of labels of the signature is
+// returned, which is less than the number of labels of owner for records
+// synthesized from a wildcard.
+func (r *Resolver) verifySignatures(ctx context.Context, req *request, apex, owner string, typ dnsmessage.Type, rrs []dnsmessage.Resource, sigs []rrsig) (int, error) {
+	if len(sigs) == 0 {
+		return 0, fmt.Errorf("%w: no signatures for %s in secure zone %s", errBogus, owner, apex)
+	}
+
+	now := timeNow()
+	var keys []dnskey
+	var keysErr error
+	bogus := fmt.Errorf("%w: no signatures for %s with supported algorithm", errBogus, owner)
+	for _, sig := range sigs {
+		if sig.TypeCovered != typ || !supportedAlgorithm(sig.Algorithm) {
+			continue
+		}
+		if sig.SignerName != apex {
+			bogus = fmt.Errorf("%w: signer %s for %s is not zone apex %s", errBogus, sig.SignerName, owner, apex)
+			continue
+		}
+		labels := countLabels(owner)
+		if int(sig.Labels) > labels {
+			bogus = fmt.Errorf("%w: invalid number of labels in signature for %s", errBogus, owner)
+			continue
+		}
+		if !sig.validTime(now) {
+			bogus = fmt.Errorf("%w: signature for %s not valid at current time", errBogus, owner)
+			continue
+		}
+
+		if keys == nil && keysErr == nil {
+			keys, keysErr = r.zoneKeys(ctx, req, apex, owner, typ, rrs)
+		}
+		if keysErr != nil {
+			return 0, keysErr
+		}
+
+		// For records synthesized from a wildcard, the signature is for the wildcard
+		// name, RFC 4035 section 5.3.2.
+		signedOwner := owner
+		if int(sig.Labels) < labels {
+			signedOwner = wildcardName(lastLabels(owner, int(sig.Labels)))
+		}
+		data, err := signedData(sig, signedOwner, typ, rrs)
+		if err != nil {
+			bogus = fmt.Errorf("%w: %v", errBogus, err)
+			continue
+		}
+		bogus = fmt.Errorf("%w: no key %d for signature from %s", errBogus, sig.KeyTag, sig.SignerName)
+		for _, k := range keys {
+			if k.Algorithm != sig.Algorithm || k.keyTag() != sig.KeyTag || k.Flags&flagZoneKey == 0 || k.Protocol != 3 {
+				continue
+			}
+			if err := verify(k, sig, data); err != nil {
+				bogus = fmt.Errorf("%w: verifying signature for %s: %v", errBogus, owner, err)
+				continue
+			}
+			return int(sig.Labels), nil
+		}
+	}
+	return 0, bogus
+}
+
+// zoneKeys returns the verified DNSKEY records of the secure zone apex, for
+// verifying signatures for records at owner. The DNSKEY records at the apex
+// itself are verified with the DS records of the zone.
+func (r *Resolver) zoneKeys(ctx context.Context, req *request, apex, owner string, typ dnsmessage.Type, rrs []dnsmessage.Resource) ([]dnskey, error) {
+	if typ == typeDNSKEY && owner == apex {
+		return r.trustedKeys(ctx, req, apex, rrs)
+	}
+	a, err := r.lookup(ctx, req, apex, typeDNSKEY)
+	if err != nil {
+		return nil, err
+	} else if !a.authentic {
+		return nil, fmt.Errorf("%w: dnskey records for secure zone %s not verified", errBogus, apex)
+	}
+	return dnskeys(apex, a.records), nil
+}
+
+// trustedKeys returns the DNSKEY records of the secure zone that match a trusted
+// DS record: a trust anchor for the root zone, or a secure DS record from the
+// parent zone.
+func (r *Resolver) trustedKeys(ctx context.Context, req *request, apex string, rrs []dnsmessage.Resource) ([]dnskey, error) {
+	var dss []DS
+	if apex == "." {
+		dss = r.trustAnchors
+	} else {
+		a, err := r.lookup(ctx, req, apex, typeDS)
+		if err != nil {
+			return nil, err
+		} else if !a.authentic {
+			return nil, fmt.Errorf("%w: ds records for secure zone %s not verified", errBogus, apex)
+		}
+		for _, rr := range a.records {
+			u, ok := rr.Body.(*dnsmessage.UnknownResource)
+			if !ok || rr.Header.Type != typeDS {
+				continue
+			}
+			if ds, err := parseDSData(u.Data); err == nil {
+				dss = append(dss, ds)
+			}
+		}
+	}
+
+	keys := dnskeys(apex, rrs)
+	var trusted []dnskey
+	for _, ds := range dss {
+		if !supportedAlgorithm(ds.Algorithm) || !supportedDigest(ds.DigestType) {
+			continue
+		}
+		for _, k := range keys {
+			if ds.matches(apex, k) {
+				trusted = append(trusted, k)
+			}
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("%w: no dnskey for %s matches ds records", errBogus, apex)
+	}
+	return trusted, nil
+}
+
+// verifyDenial verifies the absence of records of type typ at name, for a
+// response without such records. In a secure zone, the authority section must
+// have NSEC or NSEC3 records proving name does not exist (for rcode NXDOMAIN), or
+// that it has no records of type typ, an error wrapping errBogus is returned
+// otherwise. For type DS, delegation indicates whether the proof shows name is a
+// delegation, i.e. the start of an unsigned zone.
+func (r *Resolver) verifyDenial(ctx context.Context, req *request, name string, typ dnsmessage.Type, rcode dnsmessage.RCode, authorities []dnsmessage.Resource) (secure, delegation bool, rerr error) {
+	z, err := r.zoneFor(ctx, req, name, typ)
+	if err != nil || !z.secure {
+		return false, false, err
+	}
+	d, err := r.denialRecords(ctx, req, z.apex, authorities)
+	if err != nil {
+		return false, false, err
+	}
+	if rcode == dnsmessage.RCodeNameError {
+		if ok, optOut := d.nameError(name); ok {
+			return !optOut, false, nil
+		} else if d.unsupported {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("%w: no proof that %s does not exist", errBogus, name)
+	}
+	ok, delegation, optOut := d.noData(name, typ)
+	if ok {
+		return true, delegation, nil
+	} else if optOut || d.unsupported {
+		return false, false, nil
+	}
+	return false, false, fmt.Errorf("%w: no proof that %s has no records of type %s", errBogus, name, typ)
+}
+
+// nsecRecord is a verified NSEC record, RFC 4034 section 4.
+type nsecRecord struct {
+	apex   string
+	owner  string
+	next   string
+	bitmap []byte
+}
+
+// nsec3Record is a verified NSEC3 record, RFC 5155 section 3.
+type nsec3Record struct {
+	apex       string
+	hash       string // Hashed owner name, lower case base32hex, the first label of the owner name.
+	next       string // Next hashed owner name, lower case base32hex.
+	optOut     bool
+	salt       []byte
+	iterations int
+	bitmap     []byte
+}
+
+// denial holds the verified NSEC and NSEC3 records from an authority section.
+type denial struct {
+	nsecs  []nsecRecord
+	nsec3s []nsec3Record
+
+	// Whether NSEC3 records with unsupported hash algorithm or too many iterations
+	// were present. Responses that can't be proven because of those are treated as
+	// insecure, RFC 9276 section 3.2.
+	unsupported bool
+}
+
+// denialRecords returns the NSEC and NSEC3 records of the secure zone apex in
+// authorities, after verifying their signatures.
+func (r *Resolver) denialRecords(ctx context.Context, req *request, apex string, authorities []dnsmessage.Resource) (denial, error) {
+	var d denial
+	rrsets, sigs := groupRRsets(authorities)
+	for k, rrs := range rrsets {
+		if k.typ == typeNSEC && !isSubdomain(k.name, apex) || k.typ == typeNSEC3 && parentName(k.name) != apex || k.typ != typeNSEC && k.typ != typeNSEC3 {
+			continue
+		}
+		// Records from other zones, e.g. a parent or child zone, cannot prove anything
+		// about this zone.
+		if len(rrs) != 1 || !slices.ContainsFunc(sigs[k], func(sig rrsig) bool { return sig.SignerName == apex }) {
+			continue
+		}
+		u, ok := rrs[0].Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		labels, err := r.verifySignatures(ctx, req, apex, k.name, k.typ, rrs, sigs[k])
+		if err != nil {
+			return denial{}, err
+		} else if labels != countLabels(k.name) {
+			return denial{}, fmt.Errorf("%w: %s record for %s synthesized from wildcard", errBogus, k.typ, k.name)
+		}
+
+		if k.typ == typeNSEC {
+			next, n, err := parseWireName(u.Data)
+			if err != nil {
+				continue
+			}
+			d.nsecs = append(d.nsecs, nsecRecord{apex, k.name, next, u.Data[n:]})
+			continue
+		}
+
+		// Hash algorithm, flags, iterations, salt length, salt, hash length, next hashed
+		// owner, type bitmap.
+		data := u.Data
+		if len(data) < 5 {
+			continue
+		}
+		iterations := int(binary.BigEndian.Uint16(data[2:]))
+		if data[0] != 1 || iterations > maxNSEC3Iterations {
+			d.unsupported = true
+			continue
+		}
+		saltLen := int(data[4])
+		if len(data) < 5+saltLen+1 {
+			continue
+		}
+		salt := data[5 : 5+saltLen]
+		hashLen := int(data[5+saltLen])
+		if len(data) < 5+saltLen+1+hashLen {
+			continue
+		}
+		hash, _, _ := strings.Cut(k.name, ".")
+		next := strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(data[5+saltLen+1 : 5+saltLen+1+hashLen]))
+		d.nsec3s = append(d.nsec3s, nsec3Record{apex, hash, next, data[1]&1 != 0, salt, iterations, data[5+saltLen+1+hashLen:]})
+	}
+	return d, nil
+}
+
+// nsecMatch returns the NSEC record with owner name.
+func (d denial) nsecMatch(name string) *nsecRecord {
+	for i, n := range d.nsecs {
+		if n.owner == name {
+			return &d.nsecs[i]
+		}
+	}
+	return nil
+}
+
+// nsecCover returns the NSEC record proving that name does not exist: name sorts
+// between its owner and next name. NSEC records at delegations cannot prove
+// anything about names below the delegation, RFC 4035 section 5.4.
+func (d denial) nsecCover(name string) *nsecRecord {
+	for i, n := range d.nsecs {
+		if !isSubdomain(name, n.apex) || n.owner == name {
+			continue
+		}
+		if isSubdomain(name, n.owner) && (hasType(n.bitmap, dnsmessage.TypeNS) && !hasType(n.bitmap, dnsmessage.TypeSOA) || hasType(n.bitmap, typeDNAME)) {
+			continue
+		}
+		if covers(canonicalCompare(n.owner, n.next) >= 0, canonicalCompare(n.owner, name) < 0, canonicalCompare(name, n.next) < 0) {
+			return &d.nsecs[i]
+		}
+	}
+	return nil
+}
+
+// nsec3Match returns the NSEC3 record with the hash of name as owner.
+func (d denial) nsec3Match(name string) *nsec3Record {
+	for i, n := range d.nsec3s {
+		if isSubdomain(name, n.apex) && nsec3Hash(name, n.salt, n.iterations) == n.hash {
+			return &d.nsec3s[i]
+		}
+	}
+	return nil
+}
+
+// nsec3Cover returns the NSEC3 record proving that name does not exist: the hash
+// of name sorts between the hashed owner and next hashed owner.
+func (d denial) nsec3Cover(name string) *nsec3Record {
+	for i, n := range d.nsec3s {
+		if !isSubdomain(name, n.apex) {
+			continue
+		}
+		h := nsec3Hash(name, n.salt, n.iterations)
+		if covers(n.hash >= n.next, n.hash < h, h < n.next) {
+			return &d.nsec3s[i]
+		}
+	}
+	return nil
+}
+
+// covers returns whether a name sorts between the owner and next name of a
+// record, given whether it sorts after owner and before next. The last record
+// in a zone wraps around, with the first name of the zone as next name.
+func covers(wraps, afterOwner, beforeNext bool) bool {
+	if wraps {
+		return afterOwner || beforeNext
+	}
+	return afterOwner && beforeNext
+}
+
+// nameLabels returns the labels of name, without the root label.
+func nameLabels(name string) []string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
+
+// parentName returns the name without its first label, or "." for the root.
+func parentName(name string) string {
+	_, parent, ok := strings.Cut(name, ".")
+	if !ok || parent == "" {
+		return "."
+	}
+	return parent
+}
+
+// lastLabels returns the name formed by the last n labels of name.
+func lastLabels(name string, n int) string {
+	labels := nameLabels(name)
+	if n >= len(labels) {
+		return name
+	} else if n <= 0 {
+		return "."
+	}
+	return strings.Join(labels[len(labels)-n:], ".") + "."
+}
+
+// wildcardName returns the wildcard name directly below name.
+func wildcardName(name string) string {
+	if name == "." {
+		return "*."
+	}
+	return "*." + name
+}
+
+// commonAncestor returns the longest name that both a and b are subdomains of.
+func commonAncestor(a, b string) string {
+	la, lb := nameLabels(a), nameLabels(b)
+	n := 0
+	for n < len(la) && n < len(lb) && la[len(la)-1-n] == lb[len(lb)-1-n] {
+		n++
+	}
+	return lastLabels(a, n)
+}
+
+// canonicalCompare compares names in canonical order, RFC 4034 section 6.1:
+// label by label, starting with the last label.
+func canonicalCompare(a, b string) int {
+	la, lb := nameLabels(a), nameLabels(b)
+	for i := 0; i < len(la) && i < len(lb); i++ {
+		if c := strings.Compare(la[len(la)-1-i], lb[len(lb)-1-i]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// nsecClosestEncloser returns the closest encloser of name, the longest existing
+// ancestor, given NSEC record n covering name, RFC 4035 section 5.4.
+func nsecClosestEncloser(name string, n *nsecRecord) string {
+	ce := commonAncestor(name, n.owner)
+	if xce := commonAncestor(name, n.next); countLabels(xce) > countLabels(ce) {
+		ce = xce
+	}
+	return ce
+}
+
+// nsec3ClosestEncloser returns the closest encloser of name, proven by an NSEC3
+// record matching the closest encloser, and an NSEC3 record covering the next
+// closer name, the name one label longer than the closest encloser, RFC 5155
+// section 8.3.
+func (d denial) nsec3ClosestEncloser(name string) (closestEncloser string, nextCloser *nsec3Record, ok bool) {
+	for ce := name; ce != "."; {
+		child := ce
+		ce = parentName(ce)
+		m := d.nsec3Match(ce)
+		if m == nil {
+			continue
+		}
+		if hasType(m.bitmap, dnsmessage.TypeNS) && !hasType(m.bitmap, dnsmessage.TypeSOA) || hasType(m.bitmap, typeDNAME) {
+			return "", nil, false
+		}
+		c := d.nsec3Cover(child)
+		return ce, c, c != nil
+	}
+	return "", nil, false
+}
+
+// nameError returns whether the records prove that name does not exist, and that
+// no wildcard could have matched it, RFC 4035 section 5.4 and RFC 5155 section
+// 8.4. If the proof is for an NSEC3 opt-out span, optOut is set: name could be
+// an unsigned delegation, so the response is not secure.
+func (d denial) nameError(name string) (ok, optOut bool) {
+	// If the next name is below name, name is an empty non-terminal, it exists.
+	if n := d.nsecCover(name); n != nil && !isSubdomain(n.next, name) {
+		ce := nsecClosestEncloser(name, n)
+		if d.nsecCover(wildcardName(ce)) != nil {
+			return true, false
+		}
+	}
+	if ce, nextCloser, ok := d.nsec3ClosestEncloser(name); ok && d.nsec3Cover(wildcardName(ce)) != nil {
+		return true, nextCloser.optOut
+	}
+	return false, false
+}
+
+// noData returns whether the records prove that name has no records of type typ,
+// RFC 4035 section 5.4 and RFC 5155 sections 8.5-8.7. For DS records, delegation
+// is set if name is a delegation without DS records, and optOut is set if name
+// may be an unsigned delegation in an NSEC3 opt-out span.
+func (d denial) noData(name string, typ dnsmessage.Type) (ok, delegation, optOut bool) {
+	// Records at a delegation are from the parent zone, and can only prove absence of
+	// DS records. Records at the apex of a child zone cannot prove absence of DS
+	// records.
+	check := func(bitmap []byte) bool {
+		if hasType(bitmap, typ) || hasType(bitmap, dnsmessage.TypeCNAME) {
+			return false
+		}
+		isDelegation := hasType(bitmap, dnsmessage.TypeNS) && !hasType(bitmap, dnsmessage.TypeSOA)
+		return !(typ != typeDS && isDelegation || typ == typeDS && hasType(bitmap, dnsmessage.TypeSOA))
+	}
+	isDelegation := func(bitmap []byte) bool {
+		return typ == typeDS && hasType(bitmap, dnsmessage.TypeNS)
+	}
+
+	if m := d.nsecMatch(name); m != nil {
+		if check(m.bitmap) {
+			return true, isDelegation(m.bitmap), false
+		}
+		return false, false, false
+	}
+	if n := d.nsecCover(name); n != nil {
+		// Empty non-terminal, a name without records with existing names below it.
+		if n.next != name && isSubdomain(n.next, name) {
+			return true, false, false
+		}
+		// Wildcard without records of type typ.
+		if w := d.nsecMatch(wildcardName(nsecClosestEncloser(name, n))); w != nil && check(w.bitmap) {
+			return true, false, false
+		}
+	}
+
+	if m := d.nsec3Match(name); m != nil {
+		if check(m.bitmap) {
+			return true, isDelegation(m.bitmap), false
+		}
+		return false, false, false
+	}
+	if ce, nextCloser, ok := d.nsec3ClosestEncloser(name); ok {
+		if typ == typeDS && nextCloser.optOut {
+			return false, false, true
+		}
+		if w := d.nsec3Match(wildcardName(ce)); w != nil && check(w.bitmap) {
+			return true, false, false
+		}
+	}
+	return false, false, false
+}
+
+// wildcardAnswer returns whether the records prove that owner, with records
+// synthesized from a wildcard with the given number of labels, does not exist
+// itself, RFC 4035 section 5.3.4 and RFC 5155 section 8.8.
+func (d denial) wildcardAnswer(owner string, labels int) bool {
+	return d.nsecCover(owner) != nil || d.nsec3Cover(lastLabels(owner, labels+1)) != nil
+}
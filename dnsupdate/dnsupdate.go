@@ -0,0 +1,602 @@
+// Package dnsupdate changes DNS records on an authoritative name server with
+// dynamic updates (RFC 2136), authenticated with TSIG (RFC 8945).
+package dnsupdate
+
+import (
+	"context"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var timeNow = time.Now // Tests override this.
+
+var (
+	ErrTSIG   = errors.New("tsig verification of response failed")
+	ErrUpdate = errors.New("dns update rejected by server")
+)
+
+// ../rfc/2136
+const opcodeUpdate dnsmessage.OpCode = 5
+
+const (
+	typeTLSA dnsmessage.Type = 52
+	typeTSIG dnsmessage.Type = 250
+
+	// ../rfc/2136 Class NONE is used to delete individual records.
+	classNone dnsmessage.Class = 254
+)
+
+// Default fudge for TSIG, the allowed difference in time between client and server.
+// ../rfc/8945
+const fudge = 300
+
+// TSIGKey is a shared secret for authenticating update messages.
+type TSIGKey struct {
+	Name      string // Name of the key, as known by the server, e.g. "beacon.".
+	Algorithm string // "hmac-sha256", "hmac-sha384" or "hmac-sha512".
+	Secret    []byte
+}
+
+// Algorithms returns the supported TSIG algorithms.
+func Algorithms() []string {
+	return []string{"hmac-sha256", "hmac-sha384", "hmac-sha512"}
+}
+
+func (k TSIGKey) hash() (func() hash.Hash, error) {
+	// ../rfc/8945
+	switch strings.ToLower(strings.TrimSuffix(k.Algorithm, ".")) {
+	case "hmac-sha256":
+		return sha256.New, nil
+	case "hmac-sha384":
+		return sha512.New384, nil
+	case "hmac-sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported tsig algorithm %q", k.Algorithm)
+}
+
+// Record is a DNS resource record in zone file representation.
+type Record struct {
+	Name  string // Absolute name in lower case ASCII, with trailing dot.
+	Type  string // E.g. "MX". Only types in RecordTypes can be updated.
+	Value string // Record data. For TXT the unquoted concatenated text.
+}
+
+// RecordTypes returns the record types that can be updated. Records of other
+// types, e.g. CAA, are parsed but skipped by Sync, and refused by Update.
+func RecordTypes() []string {
+	return []string{"MX", "TXT", "CNAME", "SRV", "TLSA"}
+}
+
+// String returns the record as line in a zone file.
+func (r Record) String() string {
+	v := r.Value
+	if r.Type == "TXT" {
+		v = `"` + v + `"`
+	}
+	return fmt.Sprintf("%s %s %s", r.Name, r.Type, v)
+}
+
+// pack adds the record to the builder.
+func (r Record) pack(b *dnsmessage.Builder, class dnsmessage.Class, ttl uint32) error {
+	name, err := dnsmessage.NewName(r.Name)
+	if err != nil {
+		return fmt.Errorf("name %q: %v", r.Name, err)
+	}
+	h := dnsmessage.ResourceHeader{Name: name, Class: class, TTL: ttl}
+	fields := strings.Fields(r.Value)
+	badValue := func() error {
+		return fmt.Errorf("bad value %q for %s record", r.Value, r.Type)
+	}
+	parseUint16 := func(s string) (uint16, error) {
+		v, err := strconv.ParseUint(s, 10, 16)
+		return uint16(v), err
+	}
+
+	switch r.Type {
+	case "MX":
+		if len(fields) != 2 {
+			return badValue()
+		}
+		pref, err := parseUint16(fields[0])
+		if err != nil {
+			return badValue()
+		}
+		mx, err := dnsmessage.NewName(fields[1])
+		if err != nil {
+			return badValue()
+		}
+		return b.MXResource(h, dnsmessage.MXResource{Pref: pref, MX: mx})
+
+	case "CNAME":
+		if len(fields) != 1 {
+			return badValue()
+		}
+		target, err := dnsmessage.NewName(fields[0])
+		if err != nil {
+			return badValue()
+		}
+		return b.CNAMEResource(h, dnsmessage.CNAMEResource{CNAME: target})
+
+	case "TXT":
+		// Character strings have a maximum length of 255 bytes, longer texts are split.
+		var l []string
+		s := r.Value
+		for len(s) > 255 {
+			l = append(l, s[:255])
+			s = s[255:]
+		}
+		l = append(l, s)
+		return b.TXTResource(h, dnsmessage.TXTResource{TXT: l})
+
+	case "SRV":
+		if len(fields) != 4 {
+			return badValue()
+		}
+		var v [3]uint16
+		for i := range v {
+			v[i], err = parseUint16(fields[i])
+			if err != nil {
+				return badValue()
+			}
+		}
+		target, err := dnsmessage.NewName(fields[3])
+		if err != nil {
+			return badValue()
+		}
+		return b.SRVResource(h, dnsmessage.SRVResource{Priority: v[0], Weight: v[1], Port: v[2], Target: target})
+
+	case "TLSA":
+		// ../rfc/6698
+		if len(fields) != 4 {
+			return badValue()
+		}
+		var data []byte
+		for _, s := range fields[:3] {
+			v, err := strconv.ParseUint(s, 10, 8)
+			if err != nil {
+				return badValue()
+			}
+			data = append(data, byte(v))
+		}
+		assoc, err := hex.DecodeString(fields[3])
+		if err != nil {
+			return badValue()
+		}
+		data = append(data, assoc...)
+		return b.UnknownResource(h, dnsmessage.UnknownResource{Type: typeTLSA, Data: data})
+	}
+	return fmt.Errorf("unsupported record type %q", r.Type)
+}
+
+// Update sends a single dynamic update message for zone to server, a host:port
+// address, deleting the records in remove and adding the records in add. The
+// update is applied atomically by the server. The message is sent over TCP. If
+// the key has an empty name, the message is not signed.
+func Update(ctx context.Context, log mlog.Log, server string, zone dns.Domain, key TSIGKey, ttl uint32, remove, add []Record) (rerr error) {
+	log = log.With(slog.String("server", server), slog.Any("zone", zone))
+	defer func() {
+		if rerr != nil {
+			log.Debugx("dns update failed", rerr)
+		}
+	}()
+
+	msg, reqMAC, id, err := buildUpdate(zone, key, ttl, remove, add)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return fmt.Errorf("dial: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+
+	// ../rfc/1035 Messages over TCP are prefixed with a two byte length.
+	if err := writeTCP(conn, msg); err != nil {
+		return fmt.Errorf("write update message: %v", err)
+	}
+	resp, err := readTCP(conn)
+	if err != nil {
+		return fmt.Errorf("read response: %v", err)
+	}
+
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return fmt.Errorf("parsing response: %v", err)
+	}
+	if h.ID != id || !h.Response || h.OpCode != opcodeUpdate {
+		return fmt.Errorf("unexpected response message, id %d, response %v, opcode %d", h.ID, h.Response, h.OpCode)
+	}
+
+	var tsigErr error
+	if key.Name != "" {
+		tsigErr = verifyTSIG(resp, key, reqMAC, timeNow())
+	}
+	if h.RCode != dnsmessage.RCodeSuccess {
+		// Error responses may not be signed, e.g. when the server does not know our key.
+		return fmt.Errorf("%w: %s", ErrUpdate, rcodeString(h.RCode))
+	}
+	if tsigErr != nil {
+		return tsigErr
+	}
+	log.Debug("dns update applied", slog.Int("removed", len(remove)), slog.Int("added", len(add)))
+	return nil
+}
+
+// buildUpdate returns a signed update message, and the MAC and message ID needed
+// to verify the response.
+func buildUpdate(zone dns.Domain, key TSIGKey, ttl uint32, remove, add []Record) (msg, mac []byte, id uint16, rerr error) {
+	var idbuf [2]byte
+	if _, err := cryptorand.Read(idbuf[:]); err != nil {
+		return nil, nil, 0, fmt.Errorf("random message id: %v", err)
+	}
+	id = binary.BigEndian.Uint16(idbuf[:])
+
+	// ../rfc/2136 Zone section has the zone name with type SOA.
+	zoneName, err := dnsmessage.NewName(zone.ASCII + ".")
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("zone name: %v", err)
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: opcodeUpdate})
+	if err := b.StartQuestions(); err != nil {
+		return nil, nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, nil, 0, fmt.Errorf("zone section: %v", err)
+	}
+	// No prerequisites, the update section is the authority section.
+	// ../rfc/2136
+	if err := b.StartAnswers(); err != nil {
+		return nil, nil, 0, err
+	}
+	if err := b.StartAuthorities(); err != nil {
+		return nil, nil, 0, err
+	}
+	for _, r := range remove {
+		// ../rfc/2136
+		if err := r.pack(&b, classNone, 0); err != nil {
+			return nil, nil, 0, fmt.Errorf("record to remove: %v", err)
+		}
+	}
+	for _, r := range add {
+		if err := r.pack(&b, dnsmessage.ClassINET, ttl); err != nil {
+			return nil, nil, 0, fmt.Errorf("record to add: %v", err)
+		}
+	}
+	msg, err = b.Finish()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("finishing message: %v", err)
+	}
+	if key.Name == "" {
+		return msg, nil, id, nil
+	}
+	msg, mac, err = signTSIG(msg, key, nil, timeNow())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return msg, mac, id, nil
+}
+
+// tsig holds the fields of a TSIG record.
+// ../rfc/8945
+type tsig struct {
+	KeyName    string
+	Algorithm  string
+	TimeSigned uint64
+	Fudge      uint16
+	MAC        []byte
+	OrigID     uint16
+	Error      uint16
+	Other      []byte
+}
+
+// variables returns the TSIG variables included in the MAC calculation.
+// ../rfc/8945
+func (t tsig) variables() []byte {
+	var b []byte
+	b = append(b, packName(t.KeyName)...)
+	b = binary.BigEndian.AppendUint16(b, uint16(dnsmessage.ClassANY))
+	b = binary.BigEndian.AppendUint32(b, 0) // TTL
+	b = append(b, packName(t.Algorithm)...)
+	b = append(b, byte(t.TimeSigned>>40), byte(t.TimeSigned>>32))
+	b = binary.BigEndian.AppendUint32(b, uint32(t.TimeSigned))
+	b = binary.BigEndian.AppendUint16(b, t.Fudge)
+	b = binary.BigEndian.AppendUint16(b, t.Error)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(t.Other)))
+	b = append(b, t.Other...)
+	return b
+}
+
+// record returns the TSIG resource record in wire format.
+func (t tsig) record() []byte {
+	var rdata []byte
+	rdata = append(rdata, packName(t.Algorithm)...)
+	rdata = append(rdata, byte(t.TimeSigned>>40), byte(t.TimeSigned>>32))
+	rdata = binary.BigEndian.AppendUint32(rdata, uint32(t.TimeSigned))
+	rdata = binary.BigEndian.AppendUint16(rdata, t.Fudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(t.MAC)))
+	rdata = append(rdata, t.MAC...)
+	rdata = binary.BigEndian.AppendUint16(rdata, t.OrigID)
+	rdata = binary.BigEndian.AppendUint16(rdata, t.Error)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(t.Other)))
+	rdata = append(rdata, t.Other...)
+
+	var b []byte
+	b = append(b, packName(t.KeyName)...)
+	b = binary.BigEndian.AppendUint16(b, uint16(typeTSIG))
+	b = binary.BigEndian.AppendUint16(b, uint16(dnsmessage.ClassANY))
+	b = binary.BigEndian.AppendUint32(b, 0) // TTL
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	b = append(b, rdata...)
+	return b
+}
+
+// packName returns an uncompressed name in canonical (lower case) wire format.
+func packName(name string) []byte {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	var b []byte
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0)
+}
+
+// signTSIG appends a TSIG record to msg and returns the new message and the MAC.
+// For responses, requestMAC must be the MAC of the request.
+// ../rfc/8945
+func signTSIG(msg []byte, key TSIGKey, requestMAC []byte, now time.Time) ([]byte, []byte, error) {
+	h, err := key.hash()
+	if err != nil {
+		return nil, nil, err
+	}
+	t := tsig{
+		KeyName:    key.Name,
+		Algorithm:  strings.ToLower(strings.TrimSuffix(key.Algorithm, ".")) + ".",
+		TimeSigned: uint64(now.Unix()),
+		Fudge:      fudge,
+		OrigID:     binary.BigEndian.Uint16(msg[0:2]),
+	}
+	mac := hmac.New(h, key.Secret)
+	if requestMAC != nil {
+		mac.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+		mac.Write(requestMAC)
+	}
+	mac.Write(msg)
+	mac.Write(t.variables())
+	t.MAC = mac.Sum(nil)
+
+	nmsg := append(append([]byte{}, msg...), t.record()...)
+	arcount := binary.BigEndian.Uint16(nmsg[10:12])
+	binary.BigEndian.PutUint16(nmsg[10:12], arcount+1)
+	return nmsg, t.MAC, nil
+}
+
+// splitTSIG returns the message without its TSIG record, with the additional
+// record count and ID adjusted, and the parsed TSIG record. The TSIG record must be
+// the last record of the message.
+// ../rfc/8945
+func splitTSIG(msg []byte) ([]byte, tsig, error) {
+	var t tsig
+	if len(msg) < 12 {
+		return nil, t, errors.New("message too short")
+	}
+	counts := 0
+	for i := 0; i < 4; i++ {
+		counts += int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+	arcount := binary.BigEndian.Uint16(msg[10:12])
+	if arcount == 0 {
+		return nil, t, errors.New("message has no tsig record")
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:6]))
+
+	// Walk the records to find the start of the last one.
+	off := 12
+	var start int
+	for i := 0; i < counts; i++ {
+		start = off
+		var err error
+		off, err = skipName(msg, off)
+		if err != nil {
+			return nil, t, err
+		}
+		if i < qdcount {
+			off += 4
+		} else {
+			if off+10 > len(msg) {
+				return nil, t, errors.New("truncated record")
+			}
+			off += 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+		}
+		if off > len(msg) {
+			return nil, t, errors.New("truncated message")
+		}
+	}
+	if off != len(msg) {
+		return nil, t, errors.New("trailing data after records")
+	}
+
+	name, noff, err := readName(msg, start)
+	if err != nil {
+		return nil, t, err
+	}
+	if noff+10 > len(msg) || dnsmessage.Type(binary.BigEndian.Uint16(msg[noff:])) != typeTSIG {
+		return nil, t, errors.New("last record is not tsig")
+	}
+	t.KeyName = name
+	rdata := msg[noff+10:]
+	t.Algorithm, noff, err = readName(rdata, 0)
+	if err != nil {
+		return nil, t, fmt.Errorf("tsig algorithm: %v", err)
+	}
+	rd := rdata[noff:]
+	if len(rd) < 10 {
+		return nil, t, errors.New("truncated tsig record")
+	}
+	t.TimeSigned = uint64(binary.BigEndian.Uint16(rd[0:]))<<32 | uint64(binary.BigEndian.Uint32(rd[2:]))
+	t.Fudge = binary.BigEndian.Uint16(rd[6:])
+	macSize := int(binary.BigEndian.Uint16(rd[8:]))
+	rd = rd[10:]
+	if len(rd) < macSize+6 {
+		return nil, t, errors.New("truncated tsig record")
+	}
+	t.MAC = rd[:macSize]
+	rd = rd[macSize:]
+	t.OrigID = binary.BigEndian.Uint16(rd[0:])
+	t.Error = binary.BigEndian.Uint16(rd[2:])
+	otherSize := int(binary.BigEndian.Uint16(rd[4:]))
+	if len(rd) != 6+otherSize {
+		return nil, t, errors.New("bad tsig other data length")
+	}
+	t.Other = rd[6:]
+
+	nmsg := append([]byte{}, msg[:start]...)
+	binary.BigEndian.PutUint16(nmsg[0:2], t.OrigID)
+	binary.BigEndian.PutUint16(nmsg[10:12], arcount-1)
+	return nmsg, t, nil
+}
+
+// verifyTSIG checks the TSIG record of msg, signed at a time close to now. For
+// responses, requestMAC must be the MAC of the request.
+func verifyTSIG(msg []byte, key TSIGKey, requestMAC []byte, now time.Time) error {
+	h, err := key.hash()
+	if err != nil {
+		return err
+	}
+	nmsg, t, err := splitTSIG(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTSIG, err)
+	}
+	if !strings.EqualFold(strings.TrimSuffix(t.KeyName, "."), strings.TrimSuffix(key.Name, ".")) {
+		return fmt.Errorf("%w: unexpected key name %q", ErrTSIG, t.KeyName)
+	}
+	if t.Error != 0 {
+		return fmt.Errorf("%w: tsig error %s", ErrTSIG, rcodeString(dnsmessage.RCode(t.Error)))
+	}
+	mac := hmac.New(h, key.Secret)
+	if requestMAC != nil {
+		mac.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+		mac.Write(requestMAC)
+	}
+	mac.Write(nmsg)
+	mac.Write(t.variables())
+	if !hmac.Equal(mac.Sum(nil), t.MAC) {
+		return fmt.Errorf("%w: bad mac", ErrTSIG)
+	}
+	// ../rfc/8945
+	if diff := now.Unix() - int64(t.TimeSigned); diff > int64(t.Fudge) || -diff > int64(t.Fudge) {
+		return fmt.Errorf("%w: time signed outside of fudge period", ErrTSIG)
+	}
+	return nil
+}
+
+// skipName returns the offset after the possibly compressed name at off.
+func skipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errors.New("truncated name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1, nil
+		case n&0xc0 == 0xc0:
+			return off + 2, nil
+		case n&0xc0 != 0:
+			return 0, errors.New("bad label")
+		}
+		off += 1 + n
+	}
+}
+
+// readName reads an uncompressed name at off, returning it in presentation format
+// with trailing dot, and the offset after the name.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	for {
+		if off >= len(msg) {
+			return "", 0, errors.New("truncated name")
+		}
+		n := int(msg[off])
+		if n == 0 {
+			return strings.Join(labels, ".") + ".", off + 1, nil
+		} else if n&0xc0 != 0 || off+1+n > len(msg) {
+			return "", 0, errors.New("bad or compressed name")
+		}
+		labels = append(labels, string(msg[off+1:off+1+n]))
+		off += 1 + n
+	}
+}
+
+func rcodeString(rc dnsmessage.RCode) string {
+	// ../rfc/2136 ../rfc/8945
+	switch rc {
+	case 6:
+		return "YXDOMAIN"
+	case 7:
+		return "YXRRSET"
+	case 8:
+		return "NXRRSET"
+	case 9:
+		return "NOTAUTH"
+	case 10:
+		return "NOTZONE"
+	case 16:
+		return "BADSIG"
+	case 17:
+		return "BADKEY"
+	case 18:
+		return "BADTIME"
+	}
+	return strings.TrimPrefix(rc.String(), "RCode")
+}
+
+func writeTCP(conn net.Conn, msg []byte) error {
+	if len(msg) > 0xffff {
+		return errors.New("message too large")
+	}
+	buf := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	_, err := conn.Write(append(buf, msg...))
+	return err
+}
+
+func readTCP(r io.Reader) ([]byte, error) {
+	var lenbuf [2]byte
+	if _, err := io.ReadFull(r, lenbuf[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(lenbuf[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,367 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/mlog"
+)
+
+var ctxbg = context.Background()
+var pkglog = mlog.New("dnsupdate", nil)
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+// testServer is a minimal authoritative server accepting TSIG-signed updates for
+// a single zone over TCP.
+type testServer struct {
+	t    *testing.T
+	key  TSIGKey
+	zone string
+	ln   net.Listener
+
+	sync.Mutex
+	records     map[Record]bool
+	badRespMAC  bool // Corrupt MAC in response.
+	updateCount int
+}
+
+func newTestServer(t *testing.T, key TSIGKey, zone string, records []Record) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tcheck(t, err, "listen")
+	s := &testServer{t: t, key: key, zone: zone, ln: ln, records: map[Record]bool{}}
+	for _, r := range records {
+		s.records[r] = true
+	}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			msg, err := readTCP(conn)
+			if err != nil {
+				return
+			}
+			resp := s.handle(msg)
+			writeTCP(conn, resp)
+		}()
+	}
+}
+
+func (s *testServer) handle(msg []byte) []byte {
+	s.Lock()
+	defer s.Unlock()
+
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		s.t.Errorf("server: parsing message: %v", err)
+		return nil
+	}
+	response := func(rcode dnsmessage.RCode, reqMAC []byte) []byte {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, OpCode: opcodeUpdate, RCode: rcode})
+		buf, err := b.Finish()
+		if err != nil {
+			s.t.Errorf("server: building response: %v", err)
+		}
+		if reqMAC == nil {
+			return buf
+		}
+		buf, _, err = signTSIG(buf, s.key, reqMAC, time.Now())
+		if err != nil {
+			s.t.Errorf("server: signing response: %v", err)
+		}
+		if s.badRespMAC {
+			buf[len(buf)-10] ^= 1 // In MAC, before original id, error and other len.
+		}
+		return buf
+	}
+
+	if err := verifyTSIG(msg, s.key, nil, time.Now()); err != nil {
+		return response(9, nil) // NOTAUTH
+	}
+	_, tsig, err := splitTSIG(msg)
+	if err != nil {
+		s.t.Errorf("server: split tsig: %v", err)
+		return nil
+	}
+
+	q, err := p.Question()
+	if err != nil || q.Type != dnsmessage.TypeSOA || !strings.EqualFold(q.Name.String(), s.zone) {
+		return response(10, tsig.MAC) // NOTZONE
+	}
+	p.SkipAllQuestions()
+	p.SkipAllAnswers()
+
+	var remove, add []Record
+	for {
+		rh, err := p.AuthorityHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		} else if err != nil {
+			s.t.Errorf("server: authority header: %v", err)
+			return response(dnsmessage.RCodeFormatError, tsig.MAC)
+		}
+		r := Record{Name: strings.ToLower(rh.Name.String())}
+		switch rh.Type {
+		case dnsmessage.TypeMX:
+			v, err := p.MXResource()
+			tcheck(s.t, err, "mx")
+			r.Type, r.Value = "MX", fmt.Sprintf("%d %s", v.Pref, strings.ToLower(v.MX.String()))
+		case dnsmessage.TypeTXT:
+			v, err := p.TXTResource()
+			tcheck(s.t, err, "txt")
+			r.Type, r.Value = "TXT", strings.Join(v.TXT, "")
+		case dnsmessage.TypeCNAME:
+			v, err := p.CNAMEResource()
+			tcheck(s.t, err, "cname")
+			r.Type, r.Value = "CNAME", strings.ToLower(v.CNAME.String())
+		case dnsmessage.TypeSRV:
+			v, err := p.SRVResource()
+			tcheck(s.t, err, "srv")
+			r.Type, r.Value = "SRV", fmt.Sprintf("%d %d %d %s", v.Priority, v.Weight, v.Port, strings.ToLower(v.Target.String()))
+		case typeTLSA:
+			v, err := p.UnknownResource()
+			tcheck(s.t, err, "tlsa")
+			r.Type, r.Value = "TLSA", fmt.Sprintf("%d %d %d %x", v.Data[0], v.Data[1], v.Data[2], v.Data[3:])
+		default:
+			return response(dnsmessage.RCodeNotImplemented, tsig.MAC)
+		}
+		switch rh.Class {
+		case classNone:
+			remove = append(remove, r)
+		case dnsmessage.ClassINET:
+			add = append(add, r)
+		default:
+			return response(dnsmessage.RCodeFormatError, tsig.MAC)
+		}
+	}
+	for _, r := range remove {
+		delete(s.records, r)
+	}
+	for _, r := range add {
+		s.records[r] = true
+	}
+	s.updateCount++
+	return response(dnsmessage.RCodeSuccess, tsig.MAC)
+}
+
+// current returns the record sets at the server for the names and types of
+// records, like a check of the domain would find them.
+func (s *testServer) current(records []Record) []RRSet {
+	s.Lock()
+	defer s.Unlock()
+	var l []RRSet
+	seen := map[[2]string]bool{}
+	for _, r := range records {
+		k := [2]string{r.Name, r.Type}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		rs := RRSet{Name: r.Name, Type: r.Type}
+		for rr := range s.records {
+			if rr.Name == r.Name && rr.Type == r.Type {
+				rs.Values = append(rs.Values, rr.Value)
+			}
+		}
+		sort.Strings(rs.Values)
+		l = append(l, rs)
+	}
+	return l
+}
+
+func (s *testServer) list() []string {
+	s.Lock()
+	defer s.Unlock()
+	var l []string
+	for r := range s.records {
+		l = append(l, r.String())
+	}
+	sort.Strings(l)
+	return l
+}
+
+func TestParseRecords(t *testing.T) {
+	lines := strings.Split(`; comment
+$TTL 300
+
+;; _25._tcp.mail.example.com.    TLSA 3 1 1 abcd
+_25._tcp.mail.example.com.       TLSA 3 1 1 ABCD
+example.com.                     MX 10 Mail.Example.com.
+sel._domainkey.example.com.   TXT (
+		"v=DKIM1;k=ed25519;"
+ 		"p=abc"
+	)
+example.com.   300 IN            TXT "v=spf1 mx ~all"
+_imaps._tcp.example.com.         SRV 0 1 993 mail.example.com.
+example.com.                     CAA 0 issue "letsencrypt.org"`, "\n")
+	records, err := ParseRecords(lines)
+	tcheck(t, err, "parse records")
+	exp := []Record{
+		{"_25._tcp.mail.example.com.", "TLSA", "3 1 1 abcd"},
+		{"example.com.", "MX", "10 mail.example.com."},
+		{"sel._domainkey.example.com.", "TXT", "v=DKIM1;k=ed25519;p=abc"},
+		{"example.com.", "TXT", "v=spf1 mx ~all"},
+		{"_imaps._tcp.example.com.", "SRV", "0 1 993 mail.example.com."},
+		{"example.com.", "CAA", `0 issue letsencrypt.org`},
+	}
+	if !reflect.DeepEqual(records, exp) {
+		t.Fatalf("got records %#v, expected %#v", records, exp)
+	}
+
+	for _, s := range []string{
+		`example.com MX 10 mail.example.com.`,
+		`example.com. TXT "unterminated`,
+		`example.com. TXT ( "unterminated paren"`,
+		`example.com. TXT unquoted`,
+		`example.com. MX`,
+	} {
+		_, err := ParseRecords([]string{s})
+		if err == nil {
+			t.Fatalf("parsing %q: expected error", s)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	key := TSIGKey{Name: "beacon.", Algorithm: "hmac-sha256", Secret: []byte("0123456789abcdef0123456789abcdef")}
+
+	srv := newTestServer(t, key, "example.com.", []Record{
+		{"example.com.", "MX", "10 old.example.net."},
+		{"example.com.", "TXT", "v=spf1 -all"},
+		{"example.com.", "TXT", "site-verification=1234"},
+		{"_dmarc.example.com.", "TXT", "v=DMARC1;p=reject"},
+	})
+	defer srv.ln.Close()
+
+	records, err := ParseRecords(strings.Split(`example.com.                     MX 10 mail.example.com.
+example.com.                     TXT "v=spf1 mx ~all"
+_dmarc.example.com.              TXT "v=DMARC1;p=reject"
+sel._domainkey.example.com.      TXT "v=DKIM1;k=ed25519;p=`+strings.Repeat("a", 300)+`"
+mta-sts.example.com.             CNAME mail.example.com.
+_imaps._tcp.example.com.         SRV 0 1 993 mail.example.com.
+_25._tcp.mail.example.com.       TLSA 3 1 1 abcd
+mail.example.net.                TXT "v=spf1 a -all"
+example.com.                     CAA 0 issue "letsencrypt.org"`, "\n"))
+	tcheck(t, err, "parse records")
+
+	conf := Config{
+		Server: srv.ln.Addr().String(),
+		Zone:   dns.Domain{ASCII: "example.com"},
+		Key:    key,
+		TTL:    300,
+	}
+
+	// Dry run, nothing changes.
+	result, err := Sync(ctxbg, pkglog, conf, records, srv.current(records), true)
+	tcheck(t, err, "sync dry run")
+	expRemove := []Record{
+		{"example.com.", "MX", "10 old.example.net."},
+		{"example.com.", "TXT", "v=spf1 -all"},
+	}
+	if !reflect.DeepEqual(result.Remove, expRemove) {
+		t.Fatalf("got remove %v, expected %v", result.Remove, expRemove)
+	}
+	if len(result.Add) != 6 || len(result.Unchanged) != 1 || len(result.Skipped) != 2 {
+		t.Fatalf("unexpected result %#v", result)
+	}
+	if srv.updateCount != 0 {
+		t.Fatalf("dry run sent update")
+	}
+
+	// Apply.
+	_, err = Sync(ctxbg, pkglog, conf, records, srv.current(records), false)
+	tcheck(t, err, "sync")
+	exp := []string{
+		`_25._tcp.mail.example.com. TLSA 3 1 1 abcd`,
+		`_dmarc.example.com. TXT "v=DMARC1;p=reject"`,
+		`_imaps._tcp.example.com. SRV 0 1 993 mail.example.com.`,
+		`example.com. MX 10 mail.example.com.`,
+		`example.com. TXT "site-verification=1234"`,
+		`example.com. TXT "v=spf1 mx ~all"`,
+		`mta-sts.example.com. CNAME mail.example.com.`,
+		`sel._domainkey.example.com. TXT "v=DKIM1;k=ed25519;p=` + strings.Repeat("a", 300) + `"`,
+	}
+	if got := srv.list(); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got records after update:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(exp, "\n"))
+	}
+
+	// Nothing left to do.
+	result, err = Sync(ctxbg, pkglog, conf, records, srv.current(records), false)
+	tcheck(t, err, "sync again")
+	if len(result.Remove) != 0 || len(result.Add) != 0 || len(result.Unchanged) != 7 || srv.updateCount != 1 {
+		t.Fatalf("unexpected result after update %#v", result)
+	}
+
+	// Records that were not checked are skipped.
+	result, err = Sync(ctxbg, pkglog, conf, records, srv.current(records[:1]), true)
+	tcheck(t, err, "sync with partial check")
+	if len(result.Remove) != 0 || len(result.Add) != 0 || len(result.Unchanged) != 1 || len(result.Skipped) != len(records)-1 {
+		t.Fatalf("unexpected result with partial check %#v", result)
+	}
+
+	// Wrong key is refused by server.
+	add := []Record{{"x.example.com.", "TXT", "test"}}
+	badKey := key
+	badKey.Secret = []byte("wrong")
+	err = Update(ctxbg, pkglog, conf.Server, conf.Zone, badKey, 300, nil, add)
+	if !errors.Is(err, ErrUpdate) {
+		t.Fatalf("update with bad key: got err %v, expected ErrUpdate", err)
+	}
+
+	// Record types that cannot be updated are refused before sending.
+	err = Update(ctxbg, pkglog, conf.Server, conf.Zone, key, 300, nil, []Record{{"example.com.", "CAA", "0 issue letsencrypt.org"}})
+	if err == nil || !strings.Contains(err.Error(), "unsupported record type") {
+		t.Fatalf("update with caa record: got err %v, expected unsupported record type", err)
+	}
+
+	// Update for other zone is refused.
+	err = Update(ctxbg, pkglog, conf.Server, dns.Domain{ASCII: "example.org"}, key, 300, nil, add)
+	if !errors.Is(err, ErrUpdate) {
+		t.Fatalf("update for other zone: got err %v, expected ErrUpdate", err)
+	}
+
+	// Response with bad signature.
+	srv.Lock()
+	srv.badRespMAC = true
+	srv.Unlock()
+	err = Update(ctxbg, pkglog, conf.Server, conf.Zone, key, 300, nil, add)
+	if !errors.Is(err, ErrTSIG) {
+		t.Fatalf("update with bad response signature: got err %v, expected ErrTSIG", err)
+	}
+	srv.Lock()
+	srv.badRespMAC = false
+	srv.Unlock()
+
+	// Request signed too long ago is refused.
+	timeNow = func() time.Time { return time.Now().Add(-time.Hour) }
+	err = Update(ctxbg, pkglog, conf.Server, conf.Zone, key, 300, nil, add)
+	timeNow = time.Now
+	if !errors.Is(err, ErrUpdate) {
+		t.Fatalf("update with old signature: got err %v, expected ErrUpdate", err)
+	}
+}
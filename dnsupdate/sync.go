@@ -0,0 +1,290 @@
+package dnsupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/mlog"
+)
+
+// Config is the configuration for updating records in a zone.
+type Config struct {
+	Server string     // Address of server accepting updates, host:port.
+	Zone   dns.Domain // Only records in this zone are updated.
+	Key    TSIGKey
+	TTL    uint32 // For added records.
+}
+
+// Changes describes the changes needed to make DNS match the requested records.
+type Changes struct {
+	Remove    []Record // Records present in DNS that conflict with requested records.
+	Add       []Record // Requested records missing in DNS.
+	Unchanged []Record // Requested records already present in DNS.
+	Skipped   []Record // Requested records outside the zone or of unsupported type, to be managed manually.
+}
+
+// ParseRecords parses records in zone file format, as generated for the
+// required DNS records of a domain. Lines with comments, directives and empty
+// lines are ignored. Names must be absolute. Records can span multiple lines
+// with parentheses.
+func ParseRecords(lines []string) ([]Record, error) {
+	var records []Record
+	var pending string
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if pending == "" && (line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "$")) {
+			continue
+		}
+		pending += " " + line
+		open, err := parenOpen(pending)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if open {
+			continue
+		}
+		r, err := parseRecord(pending)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		records = append(records, r)
+		pending = ""
+	}
+	if pending != "" {
+		return nil, errors.New("unterminated parenthesis at end of records")
+	}
+	return records, nil
+}
+
+// parenOpen returns whether s has an unclosed parenthesis outside quoted strings.
+func parenOpen(s string) (bool, error) {
+	var quoted, open bool
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			if open {
+				return false, errors.New("nested parenthesis")
+			}
+			open = true
+		case c == ')':
+			if !open {
+				return false, errors.New("unexpected closing parenthesis")
+			}
+			open = false
+		case c == ';':
+			return false, errors.New("comment after record not supported")
+		}
+	}
+	return open, nil
+}
+
+func parseRecord(s string) (Record, error) {
+	// Tokenize, keeping quoted strings as single tokens, without parentheses.
+	var tokens []string
+	var quoted []bool
+	var cur strings.Builder
+	var inQuote, haveToken bool
+	for _, c := range s {
+		switch {
+		case c == '"':
+			if inQuote {
+				tokens = append(tokens, cur.String())
+				quoted = append(quoted, true)
+				cur.Reset()
+				haveToken = false
+			}
+			inQuote = !inQuote
+		case inQuote:
+			cur.WriteRune(c)
+		case c == ' ' || c == '\t' || c == '(' || c == ')':
+			if haveToken {
+				tokens = append(tokens, cur.String())
+				quoted = append(quoted, false)
+				cur.Reset()
+				haveToken = false
+			}
+		default:
+			cur.WriteRune(c)
+			haveToken = true
+		}
+	}
+	if inQuote {
+		return Record{}, errors.New("unterminated quoted string")
+	}
+	if haveToken {
+		tokens = append(tokens, cur.String())
+		quoted = append(quoted, false)
+	}
+
+	if len(tokens) < 3 {
+		return Record{}, errors.New("record needs name, type and value")
+	}
+	name := strings.ToLower(tokens[0])
+	if !strings.HasSuffix(name, ".") {
+		return Record{}, fmt.Errorf("name %q must be absolute", tokens[0])
+	}
+	tokens, quoted = tokens[1:], quoted[1:]
+	// Optional TTL and class.
+	if _, err := strconv.ParseUint(tokens[0], 10, 32); err == nil && !quoted[0] {
+		tokens, quoted = tokens[1:], quoted[1:]
+	}
+	if len(tokens) > 0 && strings.EqualFold(tokens[0], "IN") && !quoted[0] {
+		tokens, quoted = tokens[1:], quoted[1:]
+	}
+	if len(tokens) < 2 {
+		return Record{}, errors.New("record needs type and value")
+	}
+	typ := strings.ToUpper(tokens[0])
+	tokens, quoted = tokens[1:], quoted[1:]
+
+	var value string
+	switch typ {
+	case "TXT":
+		for i, t := range tokens {
+			if !quoted[i] {
+				return Record{}, fmt.Errorf("txt record has unquoted value %q", t)
+			}
+			value += t
+		}
+	case "MX", "CNAME", "SRV":
+		// Names in the value are case-insensitive, the numbers are not affected.
+		value = strings.ToLower(strings.Join(tokens, " "))
+	case "TLSA":
+		value = strings.ToLower(strings.Join(tokens, " "))
+	default:
+		value = strings.Join(tokens, " ")
+	}
+	return Record{Name: name, Type: typ, Value: value}, nil
+}
+
+// inZone returns whether name is the zone apex or below it.
+func inZone(name string, zone dns.Domain) bool {
+	z := strings.ToLower(zone.ASCII) + "."
+	return name == z || strings.HasSuffix(name, "."+z)
+}
+
+// txtVersion returns the version tag of a TXT record like "v=spf1", or an empty
+// string. Records with the same version tag at a name are replaced, other TXT
+// records at that name are left alone.
+func txtVersion(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(strings.ToLower(s), "v=") {
+		return ""
+	}
+	if i := strings.IndexAny(s, "; "); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ToLower(s)
+}
+
+// RRSet holds the records of a type at a name as currently found in DNS, e.g. by
+// a check of a domain.
+type RRSet struct {
+	Name   string   // Absolute, e.g. "example.com.".
+	Type   string   // E.g. "TXT".
+	Values []string // In the form of Record.Value.
+}
+
+// Sync computes which records must be removed and added to make DNS match the
+// requested records, based on the records currently in DNS in current. Unless
+// dryRun is set, the changes are sent to the server in a single update message.
+//
+// Requested records for which current has no record set of the same name and type,
+// i.e. that were not checked, are skipped. For a requested TXT record with a
+// version tag, like "v=spf1", other TXT records at the same name with the same tag
+// are replaced. For other types, all records of the type at the name are replaced.
+func Sync(ctx context.Context, log mlog.Log, conf Config, records []Record, current []RRSet, dryRun bool) (Changes, error) {
+	var changes Changes
+
+	type rrset struct {
+		name, typ, version string
+	}
+	type nameType struct {
+		name, typ string
+	}
+	found := map[nameType][]string{}
+	for _, rs := range current {
+		k := nameType{strings.ToLower(rs.Name), rs.Type}
+		for _, v := range rs.Values {
+			if rs.Type != "TXT" {
+				// Names in values are case-insensitive, like in parseRecord.
+				v = strings.ToLower(v)
+			}
+			found[k] = append(found[k], v)
+		}
+		if _, ok := found[k]; !ok {
+			found[k] = []string{}
+		}
+	}
+
+	want := map[rrset][]string{}
+	var sets []rrset
+	for _, r := range records {
+		if _, ok := found[nameType{r.Name, r.Type}]; !ok || !inZone(r.Name, conf.Zone) || !slices.Contains(RecordTypes(), r.Type) {
+			changes.Skipped = append(changes.Skipped, r)
+			continue
+		}
+		k := rrset{r.Name, r.Type, ""}
+		if r.Type == "TXT" {
+			k.version = txtVersion(r.Value)
+		}
+		if _, ok := want[k]; !ok {
+			sets = append(sets, k)
+		}
+		want[k] = append(want[k], r.Value)
+	}
+
+	for _, k := range sets {
+		var have []string
+		for _, v := range found[nameType{k.name, k.typ}] {
+			if k.typ != "TXT" || k.version == "" || txtVersion(v) == k.version {
+				have = append(have, v)
+			}
+		}
+		haveMap := map[string]bool{}
+		for _, v := range have {
+			haveMap[v] = true
+		}
+		wantMap := map[string]bool{}
+		for _, v := range want[k] {
+			wantMap[v] = true
+			r := Record{k.name, k.typ, v}
+			if haveMap[v] {
+				changes.Unchanged = append(changes.Unchanged, r)
+			} else {
+				changes.Add = append(changes.Add, r)
+			}
+		}
+		// TXT records without version tag only get added, we cannot tell which existing
+		// records they would replace.
+		if k.typ == "TXT" && k.version == "" {
+			continue
+		}
+		sort.Strings(have)
+		for _, v := range have {
+			if !wantMap[v] {
+				changes.Remove = append(changes.Remove, Record{k.name, k.typ, v})
+			}
+		}
+	}
+
+	if dryRun || len(changes.Remove) == 0 && len(changes.Add) == 0 {
+		return changes, nil
+	}
+	if err := Update(ctx, log, conf.Server, conf.Zone, conf.Key, conf.TTL, changes.Remove, changes.Add); err != nil {
+		return changes, err
+	}
+	log.Info("dns records updated", slog.Any("zone", conf.Zone), slog.Int("removed", len(changes.Remove)), slog.Int("added", len(changes.Add)))
+	return changes, nil
+}
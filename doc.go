@@ -26,6 +26,7 @@ low-maintenance self-hosted email.
 	beacon config test
 	beacon config dnscheck domain
 	beacon config dnsrecords domain
+	beacon config dnssync [-dryrun] domain
 	beacon config describe-domains >domains.conf
 	beacon config describe-static >beacon.conf
 	beacon config account add account address
@@ -51,6 +52,11 @@ low-maintenance self-hosted email.
 	beacon dkim txt <$selector._domainkey.$domain.key.pkcs8.pem
 	beacon dkim verify message
 	beacon dkim sign message
+	beacon dkim rotate start [-grace duration] domain
+	beacon dkim rotate status [domain]
+	beacon dkim rotate check domain
+	beacon dkim rotate finish domain
+	beacon dkim rotate cancel domain
 	beacon dmarc lookup domain
 	beacon dmarc parsereportmsg message ...
 	beacon dmarc verify remoteip mailfromaddress helodomain < message
@@ -452,6 +458,23 @@ configured.
 
 	usage: beacon config dnsrecords domain
 
+# beacon config dnssync
+
+Update DNS with the required records for the domain through dynamic DNS updates.
+
+The required records, as printed by "beacon config dnsrecords", are compared with
+the records currently in DNS. Conflicting records are removed and missing records
+are added with a single DNS UPDATE message (RFC 2136), authenticated with TSIG.
+The domain must have DNSUpdate configured in domains.conf. Records outside the
+configured zone and records of types that cannot be compared (e.g. CAA) are
+skipped and must be managed manually.
+
+With -dryrun, the changes are printed but not applied.
+
+	usage: beacon config dnssync [-dryrun] domain
+	  -dryrun
+	    	only print changes, do not update dns
+
 # beacon config describe-domains
 
 Prints an annotated empty configuration for use as domains.conf.
@@ -743,6 +766,62 @@ headers prepended.
 
 	usage: beacon dkim sign message
 
+# beacon dkim rotate start
+
+Start rotation of the DKIM keys of a domain.
+
+For each selector currently used for signing or ARC sealing, a new selector with
+a fresh key of the same type is added to the configuration. The DNS TXT records
+for the new selectors are printed, they must be published in DNS. The running
+beacon instance periodically checks DNS, and switches signing to the new
+selectors once the records are found, see "beacon dkim rotate check".
+
+After switching, the DNS records of the old selectors must remain published for
+the grace period, for messages still in transit and verification of recently
+sent messages. After the grace period, the rotation can be finished with "beacon
+dkim rotate finish".
+
+	usage: beacon dkim rotate start [-grace duration] domain
+	  -grace duration
+	    	period to keep publishing old selectors after switching to new selectors (default 168h0m0s)
+
+# beacon dkim rotate status
+
+Print the state of DKIM key rotations in progress.
+
+For rotations waiting for DNS records of the new selectors, the records to
+publish are printed.
+
+	usage: beacon dkim rotate status [domain]
+
+# beacon dkim rotate check
+
+Check DNS for the records of the new selectors of a DKIM key rotation.
+
+If the records of all new selectors are found, signing switches to the new
+selectors. DNS is also checked periodically by the running beacon instance, this
+command checks immediately.
+
+	usage: beacon dkim rotate check domain
+
+# beacon dkim rotate finish
+
+Finish a DKIM key rotation after its grace period has passed.
+
+The old selectors are removed from the configuration and their private keys
+moved to the "old" directory. Their DNS records should be removed afterwards.
+
+	usage: beacon dkim rotate finish domain
+
+# beacon dkim rotate cancel
+
+Cancel a DKIM key rotation that is still waiting for DNS records.
+
+The new selectors are removed from the configuration. A rotation can no longer
+be canceled after signing has switched to the new selectors.
+
+	usage: beacon dkim rotate cancel domain
+
 # beacon dmarc lookup
 
 Lookup dmarc policy for domain, a DNS TXT record at _dmarc.<domain>, validate and print it.
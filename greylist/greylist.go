@@ -0,0 +1,230 @@
+// Package greylist implements greylisting for incoming SMTP deliveries.
+//
+// The first delivery attempt for a triplet of remote IP network, SMTP MAIL FROM
+// and RCPT TO is rejected with a temporary failure. A retry after a delay is
+// accepted, after which the triplet is remembered and future deliveries are
+// accepted immediately. Legitimate mail servers retry, many spam-sending botnets
+// don't.
+//
+// Large mail providers often retry from other IPs. SPF- or DKIM-verified sender
+// domains of deliveries that passed greylisting are remembered, and aren't
+// greylisted again.
+package greylist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+)
+
+var (
+	metricCheck = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "beacon_greylist_check_total",
+			Help: "Number of greylist checks by result: greylisted (temporarily rejected), passed (accepted retry), known (earlier passed triplet) or domain (verified sender domain that passed before).",
+		},
+		[]string{"result"},
+	)
+)
+
+var timeNow = time.Now // Tests override this.
+
+const (
+	DefaultDelay  = 5 * time.Minute
+	DefaultExpiry = 35 * 24 * time.Hour
+)
+
+// Triplet is a combination of remote IP network, MAIL FROM and RCPT TO seen in
+// delivery attempts.
+type Triplet struct {
+	ID             int64
+	RemoteIPMasked string    `bstore:"unique RemoteIPMasked+MailFrom+RcptTo,nonzero"` // IPv4 /24 or IPv6 /64 network.
+	MailFrom       string    // Empty for the null sender, e.g. for DSNs.
+	RcptTo         string    `bstore:"nonzero"`
+	First          time.Time `bstore:"nonzero"` // First attempt since greylisting started for this triplet.
+	Last           time.Time `bstore:"nonzero,index"`
+	Attempts       int       // Attempts before passing, including the first.
+	Passed         bool      // Whether a retry was accepted.
+}
+
+// Domain is an SPF- or DKIM-verified sender domain of a delivery that passed
+// greylisting.
+type Domain struct {
+	Domain   string    // Unicode.
+	LastPass time.Time `bstore:"nonzero,index"`
+}
+
+var DBTypes = []any{Triplet{}, Domain{}} // Types stored in DB.
+var DB *bstore.DB                        // Exported for backups.
+var mutex sync.Mutex
+var lastCleanup time.Time // Protected by mutex.
+
+func database(ctx context.Context) (rdb *bstore.DB, rerr error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB == nil {
+		p := beacon.DataDirPath("greylist.db")
+		os.MkdirAll(filepath.Dir(p), 0770)
+		db, err := bstore.Open(ctx, p, &bstore.Options{Timeout: 5 * time.Second, Perm: 0660}, DBTypes...)
+		if err != nil {
+			return nil, err
+		}
+		DB = db
+	}
+	return DB, nil
+}
+
+// Init opens the database.
+func Init() error {
+	_, err := database(beacon.Shutdown)
+	return err
+}
+
+// Close closes the database.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB != nil {
+		err := DB.Close()
+		mlog.New("greylist", nil).Check(err, "closing database")
+		DB = nil
+	}
+}
+
+// maskIP returns the network of ip used in triplets, a /24 for IPv4 and a /64
+// for IPv6, to allow for retries from other IPs from the same pool.
+func maskIP(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// Check returns whether a delivery attempt must be rejected with a temporary
+// failure. The triplet for remoteIP, mailFrom and rcptTo is added or updated.
+// If the attempt is accepted, the verifiedDomains (SPF-verified MAIL FROM domain
+// and DKIM-verified domains) are remembered, and future deliveries from those
+// domains are accepted without greylisting.
+func Check(ctx context.Context, log mlog.Log, conf config.Greylisting, remoteIP net.IP, mailFrom, rcptTo string, verifiedDomains []string) (greylisted bool, rerr error) {
+	db, err := database(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	delay := conf.Delay
+	if delay == 0 {
+		delay = DefaultDelay
+	}
+	expiry := conf.Expiry
+	if expiry == 0 {
+		expiry = DefaultExpiry
+	}
+
+	now := timeNow()
+	var result string
+	err = db.Write(ctx, func(tx *bstore.Tx) error {
+		for _, dom := range verifiedDomains {
+			d := Domain{Domain: dom}
+			if err := tx.Get(&d); err == bstore.ErrAbsent {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("get domain: %v", err)
+			}
+			if now.Sub(d.LastPass) > expiry {
+				continue
+			}
+			d.LastPass = now
+			if err := tx.Update(&d); err != nil {
+				return fmt.Errorf("update domain: %v", err)
+			}
+			result = "domain"
+			return nil
+		}
+
+		q := bstore.QueryTx[Triplet](tx)
+		q.FilterNonzero(Triplet{RemoteIPMasked: maskIP(remoteIP), RcptTo: rcptTo})
+		q.FilterEqual("MailFrom", mailFrom)
+		t, err := q.Get()
+		if err == bstore.ErrAbsent {
+			t = Triplet{RemoteIPMasked: maskIP(remoteIP), MailFrom: mailFrom, RcptTo: rcptTo, First: now, Last: now, Attempts: 1}
+			result = "greylisted"
+			return tx.Insert(&t)
+		} else if err != nil {
+			return fmt.Errorf("get triplet: %v", err)
+		}
+
+		switch {
+		case t.Passed && now.Sub(t.Last) <= expiry:
+			result = "known"
+		case t.Passed || now.Sub(t.First) > expiry:
+			// Passed long ago, or not retried in time. Start over.
+			t.First = now
+			t.Attempts = 1
+			t.Passed = false
+			result = "greylisted"
+		case now.Sub(t.First) < delay:
+			t.Attempts++
+			result = "greylisted"
+		default:
+			t.Attempts++
+			t.Passed = true
+			result = "passed"
+		}
+		t.Last = now
+		if err := tx.Update(&t); err != nil {
+			return fmt.Errorf("update triplet: %v", err)
+		}
+
+		if result != "passed" {
+			return nil
+		}
+		for _, dom := range verifiedDomains {
+			d := Domain{Domain: dom, LastPass: now}
+			if err := tx.Get(&Domain{Domain: dom}); err == bstore.ErrAbsent {
+				err = tx.Insert(&d)
+			} else if err == nil {
+				err = tx.Update(&d)
+			}
+			if err != nil {
+				return fmt.Errorf("storing domain: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	metricCheck.WithLabelValues(result).Inc()
+	log.Debug("greylist checked", slog.String("result", result), slog.String("mailfrom", mailFrom), slog.String("rcptto", rcptTo))
+
+	mutex.Lock()
+	cleanup := now.Sub(lastCleanup) > time.Hour
+	if cleanup {
+		lastCleanup = now
+	}
+	mutex.Unlock()
+	if cleanup {
+		nt, err := bstore.QueryDB[Triplet](ctx, db).FilterLess("Last", now.Add(-expiry)).Delete()
+		log.Check(err, "removing expired greylist triplets")
+		nd, err := bstore.QueryDB[Domain](ctx, db).FilterLess("LastPass", now.Add(-expiry)).Delete()
+		log.Check(err, "removing expired greylist domains")
+		log.Debug("removed expired greylist entries", slog.Int("triplets", nt), slog.Int("domains", nd))
+	}
+
+	return result == "greylisted", nil
+}
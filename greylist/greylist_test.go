@@ -0,0 +1,85 @@
+package greylist
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+)
+
+var ctxbg = context.Background()
+
+func TestGreylist(t *testing.T) {
+	beacon.Shutdown = ctxbg
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/greylist/fake.conf")
+	beacon.Conf.Static.DataDir = "."
+
+	dbpath := beacon.DataDirPath("greylist.db")
+	os.MkdirAll(filepath.Dir(dbpath), 0770)
+	os.Remove(dbpath)
+	defer os.Remove(dbpath)
+
+	err := Init()
+	if err != nil {
+		t.Fatalf("init database: %s", err)
+	}
+	defer Close()
+
+	log := mlog.New("greylist", nil)
+
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	conf := config.Greylisting{Delay: time.Minute, Expiry: 24 * time.Hour}
+
+	check := func(ip, mailFrom string, domains []string, expGreylisted bool) {
+		t.Helper()
+		greylisted, err := Check(ctxbg, log, conf, net.ParseIP(ip), mailFrom, "mjl@beacon.example", domains)
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		if greylisted != expGreylisted {
+			t.Fatalf("got greylisted %v, expected %v", greylisted, expGreylisted)
+		}
+	}
+
+	// First attempt and retry before the delay are greylisted.
+	check("10.0.0.1", "remote@example.org", nil, true)
+	now = now.Add(30 * time.Second)
+	check("10.0.0.1", "remote@example.org", nil, true)
+
+	// Retry after delay, from other IP in same network, passes.
+	now = now.Add(time.Minute)
+	check("10.0.0.2", "remote@example.org", []string{"example.org"}, false)
+	check("10.0.0.1", "remote@example.org", nil, false)
+
+	// Other network, sender and null sender are new triplets.
+	check("10.0.1.1", "remote@example.org", nil, true)
+	check("10.0.0.1", "other@example.net", nil, true)
+	check("10.0.0.1", "", nil, true)
+
+	// Domain that passed before is not greylisted.
+	check("192.168.0.1", "other@example.org", []string{"example.org"}, false)
+
+	// Triplets and domains expire.
+	now = now.Add(25 * time.Hour)
+	check("10.0.0.1", "remote@example.org", []string{"example.org"}, true)
+
+	// A retry after the expiry starts over.
+	now = now.Add(25 * time.Hour)
+	check("10.0.0.1", "remote@example.org", nil, true)
+	now = now.Add(2 * time.Minute)
+	check("10.0.0.1", "remote@example.org", nil, false)
+
+	// IPv6 triplets are for the /64.
+	check("2001:db8::1", "remote@example.org", nil, true)
+	now = now.Add(2 * time.Minute)
+	check("2001:db8::2", "remote@example.org", nil, false)
+}
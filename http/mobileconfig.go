@@ -190,6 +190,25 @@ func MobileConfig(addresses []string, fullName string) ([]byte, error) {
 			},
 		}),
 	}
+
+	// Add the address book, for synchronizing contacts over CardDAV. Apple software
+	// does not find the server through the well-known URL on its own when setting up
+	// the mail account.
+	if davConfig, err := beacon.CardDAVConfigDomain(addr.Domain); err == nil {
+		content := p.Dict["PayloadContent"].(array)
+		p.Dict["PayloadContent"] = append(content, dict(map[string]any{
+			"CardDAVAccountDescription": addresses[0] + " contacts",
+			"CardDAVHostName":           davConfig.Host.ASCII,
+			"CardDAVPort":               davConfig.Port,
+			"CardDAVPrincipalURL":       davConfig.Path + "principal/",
+			"CardDAVUseSSL":             davConfig.TLS,
+			"CardDAVUsername":           addresses[0],
+			"PayloadIdentifier":         reverseAddr + ".carddav.account",
+			"PayloadType":               "com.apple.carddav.account",
+			"PayloadUUID":               uuid("carddav"),
+			"PayloadVersion":            1,
+		}))
+	}
 	if _, err := fmt.Fprint(&w, xml.Header); err != nil {
 		return nil, err
 	}
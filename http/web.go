@@ -28,6 +28,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/qompassai/beacon/autotls"
+	"github.com/qompassai/beacon/carddav"
 	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/mlog"
@@ -493,6 +494,15 @@ func Listen() {
 		}
 	}
 
+	// CardDAV is served below the account path, with a well-known URL for clients to
+	// find it.
+	handleCardDAV := func(srv *serve, path string, forwarded bool) {
+		davPath := path + "dav/"
+		handler := safeHeaders(http.StripPrefix(davPath[:len(davPath)-1], http.HandlerFunc(carddav.Handler(davPath, forwarded))))
+		srv.Handle("carddav", nil, davPath, handler)
+		srv.Handle("carddav", nil, "/.well-known/carddav", safeHeaders(http.RedirectHandler(davPath, http.StatusMovedPermanently)))
+	}
+
 	// Initialize listeners in deterministic order for the same potential error
 	// messages.
 	names := maps.Keys(beacon.Conf.Static.Listeners)
@@ -537,6 +547,7 @@ func Listen() {
 			handler := safeHeaders(http.StripPrefix(path[:len(path)-1], http.HandlerFunc(webaccount.Handler(path, l.AccountHTTP.Forwarded))))
 			srv.Handle("account", nil, path, handler)
 			redirectToTrailingSlash(srv, "account", path)
+			handleCardDAV(srv, path, l.AccountHTTP.Forwarded)
 		}
 		if l.AccountHTTPS.Enabled {
 			port := config.Port(l.AccountHTTPS.Port, 443)
@@ -548,6 +559,7 @@ func Listen() {
 			handler := safeHeaders(http.StripPrefix(path[:len(path)-1], http.HandlerFunc(webaccount.Handler(path, l.AccountHTTPS.Forwarded))))
 			srv.Handle("account", nil, path, handler)
 			redirectToTrailingSlash(srv, "account", path)
+			handleCardDAV(srv, path, l.AccountHTTPS.Forwarded)
 		}
 
 		if l.AdminHTTP.Enabled {
@@ -12,7 +12,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/scram"
+	"github.com/qompassai/beacon/store"
 )
 
 func TestAuthenticatePlain(t *testing.T) {
@@ -183,3 +186,55 @@ func TestAuthenticateCRAMMD5(t *testing.T) {
 
 	tc.close()
 }
+
+func TestAuthenticateAppPassword(t *testing.T) {
+	tc := start(t)
+	defer tc.close()
+
+	// With two-factor authentication required, the account password is refused.
+	acc := beacon.Conf.Dynamic.Accounts["mjl"]
+	acc.RequireTOTP = true
+	beacon.Conf.Dynamic.Accounts["mjl"] = acc
+
+	tc.transactf("no", "authenticate plain %s", base64.StdEncoding.EncodeToString([]byte("\u0000mjl@beacon.example\u0000testtest")))
+	tc.xcode("AUTHENTICATIONFAILED")
+	tc.transactf("no", "login mjl@beacon.example testtest")
+
+	password, err := tc.account.AppPasswordAdd(ctxbg, pkglog, "test")
+	tc.check(err, "add app password")
+	tc.transactf("ok", "login mjl@beacon.example %s", password)
+}
+
+func TestAuthenticateExternal(t *testing.T) {
+	clientCert := fakeCert(t)
+
+	tc := startArgsMore(t, true, true, true, true, "mjl", &clientCert)
+
+	// Public key not yet registered.
+	tc.transactf("no", "authenticate external =")
+	tc.xcode("AUTHENTICATIONFAILED")
+
+	acc := beacon.Conf.Dynamic.Accounts["mjl"]
+	acc.TLSPublicKeys = []config.TLSPublicKey{{Name: "test", Fingerprint: store.TLSPublicKeyFingerprint(clientCert.Leaf), LoginAddress: "mjl@beacon.example"}}
+	beacon.Conf.Dynamic.Accounts["mjl"] = acc
+
+	// Authorization identity must match login address.
+	tc.transactf("no", "authenticate external %s", base64.StdEncoding.EncodeToString([]byte("other@beacon.example")))
+	tc.xcode("AUTHENTICATIONFAILED")
+
+	tc.transactf("ok", "authenticate external %s", base64.StdEncoding.EncodeToString([]byte("mjl@beacon.example")))
+	tc.close()
+
+	tc = startArgsMore(t, true, true, true, true, "mjl", &clientCert)
+	acc = beacon.Conf.Dynamic.Accounts["mjl"]
+	acc.TLSPublicKeys = []config.TLSPublicKey{{Name: "test", Fingerprint: store.TLSPublicKeyFingerprint(clientCert.Leaf), LoginAddress: "mjl@beacon.example"}}
+	beacon.Conf.Dynamic.Accounts["mjl"] = acc
+	tc.transactf("ok", "authenticate external =")
+	tc.close()
+
+	// Without TLS client certificate.
+	tc = startArgs(t, true, true, true, true, "mjl")
+	tc.transactf("no", "authenticate external =")
+	tc.xcode("AUTHENTICATIONFAILED")
+	tc.close()
+}
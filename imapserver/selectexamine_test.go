@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/qompassai/beacon/imapclient"
+	"github.com/qompassai/beacon/store"
 )
 
 func TestSelect(t *testing.T) {
@@ -69,4 +70,14 @@ func testSelectExamine(t *testing.T, examine bool) {
 	tc.transactf("ok", cmd+" inbox")
 	tc.xuntagged(uclosed, uflags, upermflags, uexists1, uuidval1, uuidnext2, ulist)
 	tc.xcode(okcode)
+
+	// Keywords of labels defined in webmail are included in the flags.
+	err := tc.account.DB.Insert(ctxbg, &store.Label{Name: "Work", Keyword: "work"})
+	tcheck(t, err, "insert label")
+	ulabelflags := imapclient.UntaggedFlags(append(append([]string{}, flags...), "work"))
+	labelpermflags := append(append(append([]string{}, permflags[:len(permflags)-1]...), "work"), `\*`)
+	ulabelpermflags := imapclient.UntaggedResult{Status: imapclient.OK, RespText: imapclient.RespText{Code: "PERMANENTFLAGS", CodeArg: imapclient.CodeList{Code: "PERMANENTFLAGS", Args: labelpermflags}, More: "x"}}
+	tc.transactf("ok", cmd+" inbox")
+	tc.xuntagged(uclosed, ulabelflags, ulabelpermflags, uexists1, uuidval1, uuidnext2, ulist)
+	tc.xcode(okcode)
 }
@@ -66,6 +66,7 @@ import (
 	"github.com/mjl-/bstore"
 
 	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/metrics"
 	"github.com/qompassai/beacon/mlog"
@@ -318,6 +319,9 @@ func Listen() {
 		var tlsConfig *tls.Config
 		if listener.TLS != nil {
 			tlsConfig = listener.TLS.Config
+			if listener.TLS.ClientAuthConfig != nil {
+				tlsConfig = listener.TLS.ClientAuthConfig
+			}
 		}
 
 		if listener.IMAP.Enabled {
@@ -1219,7 +1223,7 @@ func (c *conn) applyChanges(changes []store.Change, initial bool) {
 		case store.ChangeRemoveMailbox, store.ChangeAddMailbox, store.ChangeRenameMailbox, store.ChangeAddSubscription:
 			n = append(n, change)
 			continue
-		case store.ChangeMailboxCounts, store.ChangeMailboxSpecialUse, store.ChangeMailboxKeywords, store.ChangeThread:
+		case store.ChangeMailboxCounts, store.ChangeMailboxSpecialUse, store.ChangeMailboxKeywords, store.ChangeThread, store.ChangeSettings, store.ChangeLabels, store.ChangeSubmissionUndoEnd:
 		default:
 			panic(fmt.Errorf("missing case for %#v", change))
 		}
@@ -1366,6 +1370,10 @@ func (c *conn) capabilities() string {
 	} else {
 		caps += " LOGINDISABLED"
 	}
+	// Only offered when the client sent a certificate, it is the only way to use it.
+	if c.tls && len(c.conn.(*tls.Conn).ConnectionState().PeerCertificates) > 0 {
+		caps += " AUTH=EXTERNAL"
+	}
 	return caps
 }
 
@@ -1505,9 +1513,11 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 	}()
 
 	var authVariant string
+	var loginAddress string // Username attempted, for the login attempt log.
 	authResult := "error"
 	defer func() {
 		metrics.AuthenticationInc("imap", authVariant, authResult)
+		c.recordLoginAttempt(authVariant, authResult, loginAddress)
 		switch authResult {
 		case "ok":
 			beacon.LimiterFailedAuth.Reset(c.remoteIP, time.Now())
@@ -1579,12 +1589,14 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		authz := string(plain[0])
 		authc := string(plain[1])
 		password := string(plain[2])
+		loginAddress = authc
 
 		if authz != "" && authz != authc {
 			xusercodeErrorf("AUTHORIZATIONFAILED", "cannot assume role")
 		}
 
-		acc, err := store.OpenEmailAuth(c.log, authc, password)
+		c.xcheckLoginLockout(&authResult, "", authc, "bad credentials")
+		acc, err := store.OpenEmailAuth(c.log, authc, password, false)
 		if err != nil {
 			if errors.Is(err, store.ErrUnknownCredentials) {
 				authResult = "badcreds"
@@ -1612,10 +1624,12 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 			xsyntaxErrorf("malformed cram-md5 response")
 		}
 		addr := t[0]
+		loginAddress = addr
 		c.log.Debug("cram-md5 auth", slog.String("address", addr))
 		acc, _, err := store.OpenEmail(c.log, addr)
 		if err != nil {
 			if errors.Is(err, store.ErrUnknownCredentials) {
+				authResult = "badcreds"
 				c.log.Info("failed authentication attempt", slog.String("username", addr), slog.Any("remote", c.remoteIP))
 				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
 			}
@@ -1627,6 +1641,16 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 				c.xsanity(err, "close account")
 			}
 		}()
+		c.xcheckLoginLockout(&authResult, acc.Name, addr, "bad credentials")
+		// CRAM-MD5 secrets are derived from the account password, which is refused when
+		// an app password is required.
+		appPasswordRequired, err := acc.AppPasswordsRequired(context.TODO())
+		xcheckf(err, "checking whether app password is required")
+		if appPasswordRequired {
+			authResult = "badcreds"
+			c.log.Info("failed authentication attempt, app password required", slog.String("username", addr), slog.Any("remote", c.remoteIP))
+			xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+		}
 		var ipadhash, opadhash hash.Hash
 		acc.WithRLock(func() {
 			err := acc.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -1656,6 +1680,7 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		opadhash.Write(ipadhash.Sum(nil))
 		digest := fmt.Sprintf("%x", opadhash.Sum(nil))
 		if digest != t[1] {
+			authResult = "badcreds"
 			c.log.Info("failed authentication attempt", slog.String("username", addr), slog.Any("remote", c.remoteIP))
 			xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
 		}
@@ -1696,6 +1721,7 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 			xsyntaxErrorf("starting scram: %s", err)
 		}
 		c.log.Debug("scram auth", slog.String("authentication", ss.Authentication))
+		loginAddress = ss.Authentication
 		acc, _, err := store.OpenEmail(c.log, ss.Authentication)
 		if err != nil {
 			// todo: we could continue scram with a generated salt, deterministically generated
@@ -1712,6 +1738,15 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		if ss.Authorization != "" && ss.Authorization != ss.Authentication {
 			xuserErrorf("authentication with authorization for different user not supported")
 		}
+		c.xcheckLoginLockout(&authResult, acc.Name, ss.Authentication, "bad credentials")
+		// SCRAM secrets are derived from the account password, which is refused when an
+		// app password is required.
+		appPasswordRequired, err := acc.AppPasswordsRequired(context.TODO())
+		xcheckf(err, "checking whether app password is required")
+		if appPasswordRequired {
+			c.log.Info("scram auth attempt while app password is required", slog.String("address", ss.Authentication))
+			xuserErrorf("scram not possible")
+		}
 		var xscram store.SCRAM
 		acc.WithRLock(func() {
 			err := acc.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -1759,6 +1794,36 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 		acc = nil // Cancel cleanup.
 		c.username = ss.Authentication
 
+	case "EXTERNAL":
+		// Authentication with the TLS client certificate. The client only sends the
+		// requested authorization identity, possibly empty. See ../rfc/4422, appendix A.
+		authVariant = "external"
+
+		authz := string(xreadInitial())
+		loginAddress = authz
+		if !c.tls {
+			xusercodeErrorf("AUTHENTICATIONFAILED", "tls client certificate required")
+		}
+		acc, loginAddress, err := store.OpenTLSClientCert(c.log, c.conn.(*tls.Conn).ConnectionState(), authz)
+		if err != nil {
+			if errors.Is(err, store.ErrUnknownCredentials) {
+				authResult = "badcreds"
+				c.log.Infox("failed authentication attempt", err, slog.String("authz", authz), slog.Any("remote", c.remoteIP))
+				xusercodeErrorf("AUTHENTICATIONFAILED", "bad credentials")
+			}
+			xserverErrorf("looking up tls client certificate: %v", err)
+		}
+		defer func() {
+			if acc != nil {
+				err := acc.Close()
+				c.xsanity(err, "close account")
+			}
+		}()
+		c.xcheckLoginLockout(&authResult, acc.Name, loginAddress, "bad credentials")
+		c.account = acc
+		acc = nil // Cancel cleanup.
+		c.username = loginAddress
+
 	default:
 		xuserErrorf("method not supported")
 	}
@@ -1771,22 +1836,64 @@ func (c *conn) cmdAuthenticate(tag, cmd string, p *parser) {
 	c.writeresultf("%s OK [CAPABILITY %s] authenticate done", tag, c.capabilities())
 }
 
+// recordLoginAttempt adds an authentication attempt to the login attempt log.
+func (c *conn) recordLoginAttempt(authMech, result, loginAddress string) {
+	var cs *tls.ConnectionState
+	if tc, ok := c.conn.(*tls.Conn); ok {
+		xcs := tc.ConnectionState()
+		cs = &xcs
+	}
+	var localIP string
+	if a, ok := c.conn.LocalAddr().(*net.TCPAddr); ok {
+		localIP = a.IP.String()
+	}
+	loginattempt.Record(context.TODO(), c.log, loginattempt.LoginAttempt{
+		LoginAddress: loginAddress,
+		RemoteIP:     c.remoteIP.String(),
+		LocalIP:      localIP,
+		TLS:          loginattempt.TLSInfo(cs),
+		Protocol:     "imap",
+		AuthMech:     authMech,
+		Result:       result,
+	})
+}
+
+// xcheckLoginLockout fails the authentication if authentication for the account,
+// or the account of username if accountName is empty, is blocked after too many
+// failed attempts. Called before verifying credentials. The response is the same
+// as for bad credentials, badCredsMsg, so attempts during a lockout don't reveal
+// whether a password is correct.
+func (c *conn) xcheckLoginLockout(authResult *string, accountName, username, badCredsMsg string) {
+	locked, err := loginattempt.LockedLogin(context.TODO(), accountName, username)
+	if err != nil {
+		xserverErrorf("checking login lockout: %v", err)
+	}
+	if !locked {
+		return
+	}
+	*authResult = "locked"
+	c.log.Info("failed authentication attempt, authentication for account blocked", slog.String("username", username), slog.Any("remote", c.remoteIP))
+	xusercodeErrorf("AUTHENTICATIONFAILED", "%s", badCredsMsg)
+}
+
 // Login logs in with username and password.
 //
 // Status: Not authenticated.
 func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 	// Command: ../rfc/9051:1597 ../rfc/3501:1663
 
+	var userid string
 	authResult := "error"
 	defer func() {
 		metrics.AuthenticationInc("imap", "login", authResult)
+		c.recordLoginAttempt("login", authResult, userid)
 	}()
 
 	// todo: get this line logged with traceauth. the plaintext password is included on the command line, which we've already read (before dispatching to this function).
 
 	// Request syntax: ../rfc/9051:6667 ../rfc/3501:4804
 	p.xspace()
-	userid := p.xastring()
+	userid = p.xastring()
 	p.xspace()
 	password := p.xastring()
 	p.xempty()
@@ -1809,7 +1916,8 @@ func (c *conn) cmdLogin(tag, cmd string, p *parser) {
 		}
 	}()
 
-	acc, err := store.OpenEmailAuth(c.log, userid, password)
+	c.xcheckLoginLockout(&authResult, "", userid, "login failed")
+	acc, err := store.OpenEmailAuth(c.log, userid, password, false)
 	if err != nil {
 		authResult = "badcreds"
 		var code string
@@ -1993,17 +2101,26 @@ func (c *conn) cmdSelectExamine(isselect bool, tag, cmd string, p *parser) {
 	var highDeletedModSeq store.ModSeq
 	var firstUnseen msgseq = 0
 	var mb store.Mailbox
+	var labelKeywords []string
 	c.account.WithRLock(func() {
 		c.xdbread(func(tx *bstore.Tx) {
 			mb = c.xmailbox(tx, name, "")
 
+			// Keywords of labels defined in webmail are announced as flags, so clients can
+			// offer them even before they are used in this mailbox.
+			err := bstore.QueryTx[store.Label](tx).ForEach(func(l store.Label) error {
+				labelKeywords = append(labelKeywords, l.Keyword)
+				return nil
+			})
+			xcheckf(err, "listing labels")
+
 			q := bstore.QueryTx[store.Message](tx)
 			q.FilterNonzero(store.Message{MailboxID: mb.ID})
 			q.FilterEqual("Expunged", false)
 			q.SortAsc("UID")
 			c.uids = []store.UID{}
 			var seq msgseq = 1
-			err := q.ForEach(func(m store.Message) error {
+			err = q.ForEach(func(m store.Message) error {
 				c.uids = append(c.uids, m.UID)
 				if firstUnseen == 0 && !m.Seen {
 					firstUnseen = seq
@@ -2030,12 +2147,17 @@ func (c *conn) cmdSelectExamine(isselect bool, tag, cmd string, p *parser) {
 	})
 	c.applyChanges(c.comm.Get(), true)
 
-	var flags string
-	if len(mb.Keywords) > 0 {
-		flags = " " + strings.Join(mb.Keywords, " ")
+	var flags, labelFlags string
+	keywords, _ := store.MergeKeywords(mb.Keywords, labelKeywords)
+	if len(keywords) > 0 {
+		flags = " " + strings.Join(keywords, " ")
+	}
+	if len(labelKeywords) > 0 {
+		sort.Strings(labelKeywords)
+		labelFlags = " " + strings.Join(labelKeywords, " ")
 	}
 	c.bwritelinef(`* FLAGS (\Seen \Answered \Flagged \Deleted \Draft $Forwarded $Junk $NotJunk $Phishing $MDNSent%s)`, flags)
-	c.bwritelinef(`* OK [PERMANENTFLAGS (\Seen \Answered \Flagged \Deleted \Draft $Forwarded $Junk $NotJunk $Phishing $MDNSent \*)] x`)
+	c.bwritelinef(`* OK [PERMANENTFLAGS (\Seen \Answered \Flagged \Deleted \Draft $Forwarded $Junk $NotJunk $Phishing $MDNSent%s \*)] x`, labelFlags)
 	if !c.enabled[capIMAP4rev2] {
 		c.bwritelinef(`* 0 RECENT`)
 	}
@@ -335,6 +335,12 @@ func startNoSwitchboard(t *testing.T) *testconn {
 }
 
 func startArgs(t *testing.T, first, isTLS, allowLoginWithoutTLS, setPassword bool, accname string) *testconn {
+	return startArgsMore(t, first, isTLS, allowLoginWithoutTLS, setPassword, accname, nil)
+}
+
+// startArgsMore is like startArgs, but if clientCert is set, the server requests
+// a TLS client certificate and the client sends clientCert.
+func startArgsMore(t *testing.T, first, isTLS, allowLoginWithoutTLS, setPassword bool, accname string, clientCert *tls.Certificate) *testconn {
 	limitersInit() // Reset rate limiters.
 
 	if first {
@@ -359,9 +365,14 @@ func startArgs(t *testing.T, first, isTLS, allowLoginWithoutTLS, setPassword boo
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{fakeCert(t)},
 	}
+	clientConfig := &tls.Config{InsecureSkipVerify: true}
+	if clientCert != nil {
+		tlsConfig.ClientAuth = tls.RequestClientCert
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
 	if isTLS {
 		serverConn = tls.Server(serverConn, tlsConfig)
-		clientConn = tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+		clientConn = tls.Client(clientConn, clientConfig)
 	}
 
 	done := make(chan struct{})
@@ -0,0 +1,241 @@
+package junk
+
+// Features besides words of text, enabled through Params. Features are stored in
+// the word database like regular words, with a prefix ending in a colon. The
+// tokenizer never includes a colon in words, so features cannot clash with words
+// from text.
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/publicsuffix"
+)
+
+// Maximum number of bytes of a text part to look through for links.
+const maxLinkScan = 1024 * 1024
+
+// parseState holds properties of a message gathered while parsing its parts,
+// for features about the structure of the message.
+type parseState struct {
+	text, html    bool  // Whether a text and/or html part was found.
+	htmlSize      int64 // Bytes of html read, including markup.
+	htmlTextSize  int64 // Bytes of text in html, without markup.
+	attachmentMax int   // Limit on number of attachment features.
+}
+
+// addFeature adds a feature word with prefix to words.
+func addFeature(words map[string]struct{}, prefix, value string) {
+	words[prefix+":"+value] = struct{}{}
+}
+
+// addLink adds features for the domain, and its organizational domain, of a link
+// in a message.
+func (f *Filter) addLink(words map[string]struct{}, link string) {
+	host := message.LinkHost(link)
+	if host == "" {
+		return
+	}
+	if net.ParseIP(host) != nil {
+		// Links to IP addresses are a strong signal, their address isn't.
+		addFeature(words, "link", "ip")
+		return
+	}
+	d, err := dns.ParseDomain(host)
+	if err != nil {
+		return
+	}
+	addFeature(words, "link", d.ASCII)
+	org := publicsuffix.Lookup(context.Background(), f.log.Logger, d)
+	addFeature(words, "linkorg", org.ASCII)
+}
+
+// addTextLinks adds link features for http and https URLs in the text.
+func (f *Filter) addTextLinks(r io.Reader, words map[string]struct{}) error {
+	buf, err := io.ReadAll(io.LimitReader(r, maxLinkScan))
+	if err != nil {
+		return err
+	}
+	for _, link := range message.Links(string(buf)) {
+		f.addLink(words, link)
+	}
+	return nil
+}
+
+// addAttachment adds features for the media type and file name extension of an
+// attachment.
+func (f *Filter) addAttachment(p message.Part, words map[string]struct{}, st *parseState) {
+	if st.attachmentMax <= 0 {
+		return
+	}
+	st.attachmentMax--
+
+	ct := strings.ToLower(p.MediaType + "/" + p.MediaSubType)
+	if p.MediaType == "" {
+		ct = "text/plain"
+	}
+	addFeature(words, "attachment", ct)
+
+	filename := p.ContentTypeParams["name"]
+	if h, err := p.Header(); err == nil {
+		if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			filename = params["filename"]
+		}
+	}
+	if filename != "" {
+		if dec, err := (&mime.WordDecoder{}).DecodeHeader(filename); err == nil {
+			filename = dec
+		}
+	}
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(filename)), ".")
+	if ext != "" && len(ext) <= 10 {
+		addFeature(words, "attachmentext", ext)
+	}
+}
+
+// isAttachment returns whether part is an attachment, instead of the text or
+// html of the message.
+func isAttachment(p message.Part) bool {
+	if h, err := p.Header(); err == nil {
+		if disp, _, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && strings.EqualFold(disp, "attachment") {
+			return true
+		}
+	}
+	ct := p.MediaType + "/" + p.MediaSubType
+	return !(ct == "/" || ct == "TEXT/PLAIN" || ct == "TEXT/HTML")
+}
+
+// addStructure adds features about the parts of the message and its headers.
+func (f *Filter) addStructure(p message.Part, words map[string]struct{}, st *parseState) {
+	switch {
+	case st.text && st.html:
+		addFeature(words, "mime", "text+html")
+	case st.html:
+		addFeature(words, "mime", "html")
+	case st.text:
+		addFeature(words, "mime", "text")
+	default:
+		addFeature(words, "mime", "none")
+	}
+
+	if st.htmlSize > 0 {
+		// Bucket the percentage of text in html. Messages with mostly images and
+		// markup have little text.
+		pct := 100 * st.htmlTextSize / st.htmlSize
+		bucket := 0
+		for _, b := range []int64{5, 10, 20, 40, 60, 80} {
+			if pct >= b {
+				bucket = int(b)
+			}
+		}
+		addFeature(words, "htmltext", strconv.Itoa(bucket))
+	}
+
+	env := p.Envelope
+	if env == nil {
+		return
+	}
+	if env.Date.IsZero() {
+		addFeature(words, "hdr", "no-date")
+	}
+	if len(env.From) == 0 {
+		addFeature(words, "hdr", "no-from")
+	}
+	if env.MessageID == "" {
+		addFeature(words, "hdr", "no-messageid")
+	} else if len(env.From) > 0 {
+		msgidDom, fromDom := messageIDDomain(env.MessageID), env.From[0].Host
+		md, err := dns.ParseDomain(msgidDom)
+		fd, ferr := dns.ParseDomain(fromDom)
+		if err != nil {
+			addFeature(words, "hdr", "bad-messageid")
+		} else if ferr == nil {
+			ctx := context.Background()
+			if publicsuffix.Lookup(ctx, f.log.Logger, md) != publicsuffix.Lookup(ctx, f.log.Logger, fd) {
+				addFeature(words, "hdr", "messageid-mismatch")
+			}
+		}
+	}
+}
+
+// messageIDDomain returns the domain of a Message-ID header value, or an empty
+// string.
+func messageIDDomain(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">")
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(s[i+1:])
+}
+
+// addAuthResults adds features for the SPF, DKIM and DMARC verdicts in the
+// topmost Authentication-Results header, which is added during delivery. Lower
+// headers may have been added by the sender and are not trusted.
+func addAuthResults(hdrs map[string][]string, words map[string]struct{}) {
+	l := hdrs["Authentication-Results"]
+	if len(l) == 0 {
+		addFeature(words, "auth", "none")
+		return
+	}
+	// First element is the authserv-id, the others are method results.
+	t := strings.Split(stripComments(l[0]), ";")
+	for _, s := range t[1:] {
+		s = strings.TrimSpace(s)
+		method, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			continue
+		}
+		method = strings.ToLower(strings.TrimSpace(method))
+		if i := strings.Index(method, "/"); i >= 0 {
+			method = method[:i] // Version, e.g. "spf/1".
+		}
+		switch method {
+		case "spf", "dkim", "dmarc":
+		default:
+			continue
+		}
+		result, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		result = strings.ToLower(result)
+		if result != "" {
+			addFeature(words, "auth", method+"="+result)
+		}
+	}
+}
+
+// stripComments removes parenthesized comments from a header value, e.g. from
+// Authentication-Results.
+func stripComments(s string) string {
+	var b strings.Builder
+	var depth int
+	var quoted bool
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quoted:
+			if c == '"' {
+				quoted = false
+			}
+		case c == '"' && depth == 0:
+			quoted = true
+		case c == '(':
+			depth++
+			continue
+		case c == ')' && depth > 0:
+			depth--
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
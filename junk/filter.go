@@ -55,6 +55,13 @@ type Params struct {
 	TopWords    int     `sconf-doc:"Number of most spammy/hammy words to use for calculating probability. E.g. 10."`
 	IgnoreWords float64 `sconf:"optional" sconf-doc:"Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1, causing word (combinations) of 0.4 to 0.6 to be ignored."`
 	RareWords   int     `sconf:"optional" sconf-doc:"Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2."`
+
+	// Features besides words, stored in the word database with a prefix. Changing
+	// these requires retraining to take effect for existing messages.
+	Links       bool `sconf:"optional" sconf-doc:"Track ham/spam ranking for domains of http(s) links in text and html parts, and their organizational domains (based on the public suffix list). Links to IP addresses are tracked as a single feature."`
+	Attachments bool `sconf:"optional" sconf-doc:"Track ham/spam ranking for media types and file name extensions of attachments."`
+	Structure   bool `sconf:"optional" sconf-doc:"Track ham/spam ranking for the message structure: whether it has text and/or html parts, the ratio of text to markup in html parts, and header anomalies such as a missing Date or Message-ID header, or a Message-ID domain that doesn't match the From domain."`
+	AuthResults bool `sconf:"optional" sconf-doc:"Track ham/spam ranking for SPF, DKIM and DMARC verdicts in the Authentication-Results header added during delivery. Messages without the header, such as those sent by the account, are tracked as such."`
 }
 
 var DBTypes = []any{wordscore{}} // Stored in DB.
@@ -344,19 +351,45 @@ func loadWords(ctx context.Context, db *bstore.DB, l []string, dst map[string]wo
 
 // ClassifyWords returns the spam probability for the given words, and number of recognized ham and spam words.
 func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (probability float64, nham, nspam int, rerr error) {
-	if f.closed {
-		return 0, 0, 0, errClosed
+	c, err := f.ExplainWords(ctx, words)
+	if err != nil {
+		return 0, 0, 0, err
 	}
+	return c.Probability, len(c.TopHam), len(c.TopSpam), nil
+}
+
+// WordProbability is a word (combination) used for classifying a message.
+type WordProbability struct {
+	Word        string
+	Probability float64 // Spam probability, between 0 (ham) and 1 (spam), after applying MaxPower and RareWords.
+	Ham         uint32  // Number of trained ham messages containing the word.
+	Spam        uint32  // Number of trained spam messages containing the word.
+}
 
-	type xword struct {
-		Word string
-		R    float64
+// Classification holds the details of classifying a message, for explaining to
+// users why a message was classified as ham or spam.
+type Classification struct {
+	Probability float64           // Spam probability, between 0 (ham) and 1 (spam).
+	TopHam      []WordProbability // Most hammy words used for the probability, most hammy first.
+	TopSpam     []WordProbability // Most spammy words used for the probability, most spammy first.
+	Words       int               // Number of words (combinations) in the message.
+	Known       int               // Number of words present in the database.
+	Hams        uint32            // Number of ham messages the filter was trained with.
+	Spams       uint32            // Number of spam messages the filter was trained with.
+}
+
+// ExplainWords classifies words like ClassifyWords, but returns the words used
+// for calculating the probability.
+func (f *Filter) ExplainWords(ctx context.Context, words map[string]struct{}) (Classification, error) {
+	if f.closed {
+		return Classification{}, errClosed
 	}
 
 	var hamHigh float64 = 0
 	var spamLow float64 = 1
-	var topHam []xword
-	var topSpam []xword
+	var topHam []WordProbability
+	var topSpam []WordProbability
+	var known int
 
 	// Find words that should be in the database.
 	lookupWords := []string{}
@@ -388,7 +421,7 @@ func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (
 	fetched := map[string]word{}
 	if len(lookupWords) > 0 {
 		if err := loadWords(ctx, f.db, lookupWords, fetched); err != nil {
-			return 0, 0, 0, err
+			return Classification{}, err
 		}
 		for w, c := range fetched {
 			delete(expect, w)
@@ -405,6 +438,7 @@ func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (
 		if !ok {
 			continue
 		}
+		known++
 		var wS, wH float64
 		if f.spams > 0 {
 			wS = float64(c.Spam) / float64(f.spams)
@@ -431,7 +465,7 @@ func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (
 			if len(topHam) >= f.TopWords && r > hamHigh {
 				continue
 			}
-			topHam = append(topHam, xword{w, r})
+			topHam = append(topHam, WordProbability{w, r, c.Ham, c.Spam})
 			if r > hamHigh {
 				hamHigh = r
 			}
@@ -439,7 +473,7 @@ func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (
 			if len(topSpam) >= f.TopWords && r < spamLow {
 				continue
 			}
-			topSpam = append(topSpam, xword{w, r})
+			topSpam = append(topSpam, WordProbability{w, r, c.Ham, c.Spam})
 			if r < spamLow {
 				spamLow = r
 			}
@@ -448,24 +482,24 @@ func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (
 
 	sort.Slice(topHam, func(i, j int) bool {
 		a, b := topHam[i], topHam[j]
-		if a.R == b.R {
+		if a.Probability == b.Probability {
 			return len(a.Word) > len(b.Word)
 		}
-		return a.R < b.R
+		return a.Probability < b.Probability
 	})
 	sort.Slice(topSpam, func(i, j int) bool {
 		a, b := topSpam[i], topSpam[j]
-		if a.R == b.R {
+		if a.Probability == b.Probability {
 			return len(a.Word) > len(b.Word)
 		}
-		return a.R > b.R
+		return a.Probability > b.Probability
 	})
 
-	nham = f.TopWords
+	nham := f.TopWords
 	if nham > len(topHam) {
 		nham = len(topHam)
 	}
-	nspam = f.TopWords
+	nspam := f.TopWords
 	if nspam > len(topSpam) {
 		nspam = len(topSpam)
 	}
@@ -474,16 +508,24 @@ func (f *Filter) ClassifyWords(ctx context.Context, words map[string]struct{}) (
 
 	var eta float64
 	for _, x := range topHam {
-		eta += math.Log(1-x.R) - math.Log(x.R)
+		eta += math.Log(1-x.Probability) - math.Log(x.Probability)
 	}
 	for _, x := range topSpam {
-		eta += math.Log(1-x.R) - math.Log(x.R)
+		eta += math.Log(1-x.Probability) - math.Log(x.Probability)
 	}
 
 	f.log.Debug("top words", slog.Any("hams", topHam), slog.Any("spams", topSpam))
 
-	prob := 1 / (1 + math.Pow(math.E, eta))
-	return prob, len(topHam), len(topSpam), nil
+	c := Classification{
+		Probability: 1 / (1 + math.Pow(math.E, eta)),
+		TopHam:      topHam,
+		TopSpam:     topSpam,
+		Words:       len(words),
+		Known:       known,
+		Hams:        f.hams,
+		Spams:       f.spams,
+	}
+	return c, nil
 }
 
 // ClassifyMessagePath is a convenience wrapper for calling ClassifyMessage on a file.
@@ -531,6 +573,16 @@ func (f *Filter) ClassifyMessage(ctx context.Context, m message.Part) (probabili
 	return probability, words, nham, nspam, err
 }
 
+// ExplainMessage parses the mail message and classifies it like ClassifyMessage,
+// returning the details of the classification.
+func (f *Filter) ExplainMessage(ctx context.Context, m message.Part) (Classification, error) {
+	words, err := f.ParseMessage(m)
+	if err != nil {
+		return Classification{}, err
+	}
+	return f.ExplainWords(ctx, words)
+}
+
 // Train adds the words of a single message to the filter.
 func (f *Filter) Train(ctx context.Context, ham bool, words map[string]struct{}) error {
 	if err := f.ensureBloom(); err != nil {
@@ -753,6 +805,24 @@ func (f *Filter) fileSize(p string) int {
 	return int(fi.Size())
 }
 
+// Counts returns the number of ham and spam messages the filter was trained with.
+func (f *Filter) Counts() (hams, spams uint32) {
+	return f.hams, f.spams
+}
+
+// WordCount returns the number of words (combinations) in the database, not
+// including unsaved changes.
+func (f *Filter) WordCount(ctx context.Context) (int, error) {
+	if f.closed {
+		return 0, errClosed
+	}
+	n, err := bstore.QueryDB[wordscore](ctx, f.db).FilterNotEqual("Word", "-").Count()
+	if err != nil {
+		return 0, fmt.Errorf("counting words: %v", err)
+	}
+	return n, nil
+}
+
 // DB returns the database, for backups.
 func (f *Filter) DB() *bstore.DB {
 	return f.db
@@ -202,3 +202,68 @@ func TestFilter(t *testing.T) {
 	err = f.Close()
 	tcheck(t, err, "close filter")
 }
+
+func TestExplain(t *testing.T) {
+	log := mlog.New("junk", nil)
+	params := Params{
+		Onegrams: true,
+		MaxPower: 0.01,
+		TopWords: 10,
+	}
+	dbPath := filepath.FromSlash("../testdata/junk/explain.db")
+	bloomPath := filepath.FromSlash("../testdata/junk/explain.bloom")
+	os.Remove(dbPath)
+	os.Remove(bloomPath)
+	defer os.Remove(dbPath)
+	defer os.Remove(bloomPath)
+	f, err := NewFilter(ctxbg, log, params, dbPath, bloomPath)
+	tcheck(t, err, "new filter")
+	defer func() {
+		err := f.Close()
+		tcheck(t, err, "close filter")
+	}()
+
+	words := func(l ...string) map[string]struct{} {
+		m := map[string]struct{}{}
+		for _, w := range l {
+			m[w] = struct{}{}
+		}
+		return m
+	}
+	for i := 0; i < 2; i++ {
+		err = f.Train(ctxbg, true, words("hello", "meeting"))
+		tcheck(t, err, "train ham")
+		err = f.Train(ctxbg, false, words("cheap", "pills"))
+		tcheck(t, err, "train spam")
+	}
+	err = f.Save()
+	tcheck(t, err, "save")
+
+	hams, spams := f.Counts()
+	if hams != 2 || spams != 2 {
+		t.Fatalf("got counts %d/%d, expected 2/2", hams, spams)
+	}
+	n, err := f.WordCount(ctxbg)
+	tcheck(t, err, "word count")
+	if n != 4 {
+		t.Fatalf("got word count %d, expected 4", n)
+	}
+
+	c, err := f.ExplainWords(ctxbg, words("hello", "cheap", "pills", "unknown"))
+	tcheck(t, err, "explain")
+	if c.Words != 4 || c.Known != 3 || len(c.TopHam) != 1 || len(c.TopSpam) != 2 {
+		t.Fatalf("unexpected classification %#v", c)
+	}
+	if c.TopHam[0].Word != "hello" || c.TopHam[0].Ham != 2 || c.TopHam[0].Spam != 0 || c.TopHam[0].Probability >= 0.5 {
+		t.Fatalf("unexpected top ham word %#v", c.TopHam[0])
+	}
+	if c.Probability < 0.5 {
+		t.Fatalf("got probability %v, expected spam", c.Probability)
+	}
+
+	prob, nham, nspam, err := f.ClassifyWords(ctxbg, words("hello", "cheap", "pills", "unknown"))
+	tcheck(t, err, "classify")
+	if prob != c.Probability || nham != 1 || nspam != 2 {
+		t.Fatalf("classify got %v %d %d, expected same as explain", prob, nham, nspam)
+	}
+}
@@ -68,10 +68,18 @@ func (f *Filter) ParseMessage(p message.Part) (map[string]struct{}, error) {
 		}
 	}
 
-	if err := f.mailParse(p, metaWords, textWords, htmlWords); err != nil {
+	st := parseState{attachmentMax: 10}
+	if err := f.mailParse(p, &st, metaWords, textWords, htmlWords); err != nil {
 		return nil, fmt.Errorf("parsing message: %w", err)
 	}
 
+	if f.Structure {
+		f.addStructure(p, metaWords, &st)
+	}
+	if f.AuthResults {
+		addAuthResults(hdrs, metaWords)
+	}
+
 	for w := range metaWords {
 		textWords[w] = struct{}{}
 	}
@@ -83,17 +91,26 @@ func (f *Filter) ParseMessage(p message.Part) (map[string]struct{}, error) {
 }
 
 // mailParse looks through the mail for the first text and html parts, and tokenizes their words.
-func (f *Filter) mailParse(p message.Part, metaWords, textWords, htmlWords map[string]struct{}) error {
+func (f *Filter) mailParse(p message.Part, st *parseState, metaWords, textWords, htmlWords map[string]struct{}) error {
 	ct := p.MediaType + "/" + p.MediaSubType
 
+	if f.Attachments && len(p.Parts) == 0 && p.Message == nil && isAttachment(p) {
+		f.addAttachment(p, metaWords, st)
+	}
+
 	if ct == "TEXT/HTML" {
-		err := f.tokenizeHTML(p.ReaderUTF8OrBinary(), metaWords, htmlWords)
+		st.html = true
+		err := f.tokenizeHTML(p.ReaderUTF8OrBinary(), st, metaWords, htmlWords)
 		// log.Printf("html parsed, words %v", htmlWords)
 		return err
 	}
 	if ct == "" || strings.HasPrefix(ct, "TEXT/") {
+		st.text = true
 		err := f.tokenizeText(p.ReaderUTF8OrBinary(), textWords)
 		// log.Printf("text parsed, words %v", textWords)
+		if err == nil && f.Links {
+			err = f.addTextLinks(p.ReaderUTF8OrBinary(), metaWords)
+		}
 		return err
 	}
 	if p.Message != nil {
@@ -101,10 +118,10 @@ func (f *Filter) mailParse(p message.Part, metaWords, textWords, htmlWords map[s
 		if err := p.SetMessageReaderAt(); err != nil {
 			return fmt.Errorf("setting reader on nested message: %w", err)
 		}
-		return f.mailParse(*p.Message, metaWords, textWords, htmlWords)
+		return f.mailParse(*p.Message, st, metaWords, textWords, htmlWords)
 	}
 	for _, sp := range p.Parts {
-		if err := f.mailParse(sp, metaWords, textWords, htmlWords); err != nil {
+		if err := f.mailParse(sp, st, metaWords, textWords, htmlWords); err != nil {
 			return err
 		}
 	}
@@ -231,13 +248,34 @@ func (f *Filter) tokenizeText(r io.Reader, words map[string]struct{}) error {
 	return nil
 }
 
-// tokenizeHTML parses html, and tokenizes its text into words.
-func (f *Filter) tokenizeHTML(r io.Reader, meta, words map[string]struct{}) error {
+// tokenizeHTML parses html, and tokenizes its text into words. Links are added to
+// meta if enabled.
+func (f *Filter) tokenizeHTML(r io.Reader, st *parseState, meta, words map[string]struct{}) error {
+	cr := &countReader{r: r}
 	htmlReader := &htmlTextReader{
-		t:    html.NewTokenizer(r),
-		meta: map[string]struct{}{},
+		t:     html.NewTokenizer(cr),
+		meta:  map[string]struct{}{},
+		links: f.Links,
+	}
+	err := f.tokenizeText(htmlReader, words)
+	st.htmlSize += cr.n
+	st.htmlTextSize += htmlReader.n
+	for _, l := range htmlReader.hrefs {
+		f.addLink(meta, l)
 	}
-	return f.tokenizeText(htmlReader, words)
+	return err
+}
+
+// countReader counts the bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	r.n += int64(n)
+	return n, err
 }
 
 type htmlTextReader struct {
@@ -246,6 +284,9 @@ type htmlTextReader struct {
 	tagStack []string
 	buf      []byte
 	err      error
+	n        int64    // Bytes of text returned.
+	links    bool     // Whether to gather hrefs.
+	hrefs    []string // Targets of links, if links is set. At most 1000.
 }
 
 func (r *htmlTextReader) Read(buf []byte) (n int, err error) {
@@ -257,6 +298,7 @@ func (r *htmlTextReader) Read(buf []byte) (n int, err error) {
 		if n > len(nbuf) {
 			n = len(nbuf)
 		}
+		r.n += int64(n)
 		copy(buf, nbuf[:n])
 		nbuf = nbuf[n:]
 		if len(nbuf) < cap(r.buf) {
@@ -305,6 +347,15 @@ func (r *htmlTextReader) Read(buf []byte) (n int, err error) {
 					}
 				}
 			}
+			if tag == "a" && moreAttr && r.links && len(r.hrefs) < 1000 {
+				var key, val []byte
+				for moreAttr {
+					key, val, moreAttr = r.t.TagAttr()
+					if string(key) == "href" && len(val) > 0 {
+						r.hrefs = append(r.hrefs, string(val))
+					}
+				}
+			}
 
 			// Empty elements, https://developer.mozilla.org/en-US/docs/Glossary/Empty_element
 			switch tag {
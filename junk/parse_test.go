@@ -3,8 +3,10 @@ package junk
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/mlog"
 )
 
@@ -25,7 +27,7 @@ func FuzzParseMessage(f *testing.F) {
 	bloomPath := filepath.FromSlash("../testdata/junk/parse.bloom")
 	os.Remove(dbPath)
 	os.Remove(bloomPath)
-	params := Params{Twograms: true}
+	params := Params{Twograms: true, Links: true, Attachments: true, Structure: true, AuthResults: true}
 	log := mlog.New("junk", nil)
 	jf, err := NewFilter(ctxbg, log, params, dbPath, bloomPath)
 	if err != nil {
@@ -35,3 +37,75 @@ func FuzzParseMessage(f *testing.F) {
 		jf.tokenizeMail(s)
 	})
 }
+
+func TestFeatures(t *testing.T) {
+	const msg = `Authentication-Results: beacon.example; spf=pass smtp.mailfrom=example.org;
+	dkim=fail (bad signature) header.d=example.org; dmarc=fail header.from=example.org
+Authentication-Results: spoofed.example; dkim=pass header.d=example.org
+From: <sender@example.org>
+To: <mjl@beacon.example>
+Subject: test
+Message-Id: <1@mail.other.example>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=x
+
+--x
+Content-Type: text/plain
+
+see https://www.shop.example.co.uk/offer, or http://10.0.0.1/.
+--x
+Content-Type: text/html
+
+<p>hi <a href="https://click.tracker.example/c">click</a><img src="https://img.example/x.png"></p>
+--x
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="invoice.PDF"
+
+data
+--x--
+`
+
+	log := mlog.New("junk", nil)
+	params := Params{Links: true, Attachments: true, Structure: true, AuthResults: true}
+	f := &Filter{Params: params, log: log}
+	data := strings.ReplaceAll(msg, "\n", "\r\n")
+	p, err := message.EnsurePart(log.Logger, false, strings.NewReader(data), int64(len(data)))
+	tcheck(t, err, "parse message")
+	words, err := f.ParseMessage(p)
+	tcheck(t, err, "parse message words")
+
+	for _, w := range []string{
+		"link:www.shop.example.co.uk",
+		"linkorg:example.co.uk",
+		"link:ip",
+		"link:click.tracker.example",
+		"linkorg:tracker.example",
+		"attachment:application/octet-stream",
+		"attachmentext:pdf",
+		"mime:text+html",
+		"hdr:no-date",
+		"hdr:messageid-mismatch",
+		"auth:spf=pass",
+		"auth:dkim=fail",
+		"auth:dmarc=fail",
+	} {
+		if _, ok := words[w]; !ok {
+			t.Fatalf("missing feature %q in words %v", w, words)
+		}
+	}
+	for _, w := range []string{"auth:dkim=pass", "link:img.example", "hdr:no-messageid"} {
+		if _, ok := words[w]; ok {
+			t.Fatalf("unexpected feature %q", w)
+		}
+	}
+
+	// Without feature params, no features are added.
+	f = &Filter{Params: Params{Onegrams: true}, log: log}
+	words, err = f.ParseMessage(p)
+	tcheck(t, err, "parse message words")
+	for w := range words {
+		if strings.Contains(w, ":") && !strings.HasPrefix(w, "From:") && !strings.HasPrefix(w, "To:") && !strings.HasPrefix(w, "Subject:") {
+			t.Fatalf("unexpected feature %q without params", w)
+		}
+	}
+}
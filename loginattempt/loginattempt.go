@@ -0,0 +1,292 @@
+// Package loginattempt keeps a log of authentication attempts for IMAP, SMTP
+// submission and the web interfaces, and blocks authentication for accounts after
+// too many consecutive failures.
+//
+// Attempts are stored in a database so admins and users can see where logins are
+// coming from, and whether an account is under a brute-force attack. Failed
+// attempts are also rate limited per IP in memory, see beacon.LimiterFailedAuth.
+package loginattempt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/smtp"
+)
+
+var timeNow = time.Now // Tests override this.
+
+// Attempts older than this are removed from the database.
+const keepAttempts = 30 * 24 * time.Hour
+
+// Default duration for which an account is blocked, if not configured.
+const defaultLockoutPeriod = time.Hour
+
+// LoginAttempt is a single authentication attempt.
+type LoginAttempt struct {
+	ID           int64
+	Time         time.Time `bstore:"nonzero,default now,index"`
+	AccountName  string    `bstore:"index AccountName+Time"` // Empty if no account could be found, e.g. for an unknown address, or an admin login.
+	LoginAddress string    // As used in the attempt. May not exist.
+	RemoteIP     string
+	LocalIP      string
+	TLS          string // TLS version and cipher suite, empty if the connection was not TLS.
+	Protocol     string // "imap", "submission", "webmail", "webaccount", "webadmin" or "carddav".
+	AuthMech     string // E.g. "plain", "scram-sha-256", "external" or "weblogin".
+	Result       string // E.g. "ok", "badcreds", "badtotp", "locked", "aborted" or "error".
+}
+
+// Lockout tracks consecutive failed authentication attempts for an account, and
+// whether authentication is blocked.
+type Lockout struct {
+	AccountName string
+	Failures    int       // Consecutive failed attempts since last successful login or unblock.
+	LastFailure time.Time // Time of most recent failed attempt.
+	Until       time.Time // If in the future, authentication for the account is blocked.
+}
+
+var DBTypes = []any{LoginAttempt{}, Lockout{}} // Types stored in DB.
+var DB *bstore.DB                              // Exported for backups.
+var mutex sync.Mutex
+var lastCleanup time.Time // Protected by mutex.
+
+func database(ctx context.Context) (rdb *bstore.DB, rerr error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB == nil {
+		p := beacon.DataDirPath("loginattempt.db")
+		os.MkdirAll(filepath.Dir(p), 0770)
+		db, err := bstore.Open(ctx, p, &bstore.Options{Timeout: 5 * time.Second, Perm: 0660}, DBTypes...)
+		if err != nil {
+			return nil, err
+		}
+		DB = db
+	}
+	return DB, nil
+}
+
+// Init opens the database.
+func Init() error {
+	_, err := database(beacon.Shutdown)
+	return err
+}
+
+// Close closes the database.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB != nil {
+		err := DB.Close()
+		mlog.New("loginattempt", nil).Check(err, "closing database")
+		DB = nil
+	}
+}
+
+// TLSInfo returns the TLS version and cipher suite of a connection, for
+// LoginAttempt.TLS. An empty string is returned for a nil cs.
+func TLSInfo(cs *tls.ConnectionState) string {
+	if cs == nil {
+		return ""
+	}
+	versions := map[uint16]string{
+		tls.VersionTLS10: "TLS1.0",
+		tls.VersionTLS11: "TLS1.1",
+		tls.VersionTLS12: "TLS1.2",
+		tls.VersionTLS13: "TLS1.3",
+	}
+	version, ok := versions[cs.Version]
+	if !ok {
+		version = fmt.Sprintf("TLS %x", cs.Version)
+	}
+	return version + " " + tls.CipherSuiteName(cs.CipherSuite)
+}
+
+// Record stores an authentication attempt. If AccountName is not set, it is
+// looked up through LoginAddress. For attempts for an account, the consecutive
+// failures are updated, and authentication for the account is blocked when the
+// number of failures reaches the configured LoginLockout threshold. Errors are
+// logged, not returned: authentication should not fail because an attempt cannot
+// be stored.
+func Record(ctx context.Context, log mlog.Log, a LoginAttempt) {
+	if a.AccountName == "" {
+		a.AccountName = accountForAddress(a.LoginAddress)
+	}
+	if err := record(ctx, log, a); err != nil {
+		log.Errorx("storing login attempt", err, slog.String("account", a.AccountName), slog.String("protocol", a.Protocol))
+	}
+}
+
+// accountForAddress returns the account for a login address, or an empty string
+// if the address is not valid or not for an account.
+func accountForAddress(loginAddress string) string {
+	if loginAddress == "" {
+		return ""
+	}
+	addr, err := smtp.ParseAddress(loginAddress)
+	if err != nil {
+		return ""
+	}
+	accName, _, _, err := beacon.FindAccount(addr.Localpart, addr.Domain, false)
+	if err != nil {
+		return ""
+	}
+	return accName
+}
+
+func record(ctx context.Context, log mlog.Log, a LoginAttempt) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+	a.ID = 0
+	a.Time = now
+	err = db.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Insert(&a); err != nil {
+			return fmt.Errorf("inserting login attempt: %v", err)
+		}
+		if a.AccountName == "" {
+			return nil
+		}
+
+		lo := Lockout{AccountName: a.AccountName}
+		err := tx.Get(&lo)
+		if err != nil && err != bstore.ErrAbsent {
+			return fmt.Errorf("get lockout: %v", err)
+		}
+		exists := err == nil
+
+		if a.Result == "ok" && exists {
+			return tx.Delete(&lo)
+		} else if a.Result != "badcreds" && a.Result != "badtotp" {
+			return nil
+		}
+
+		if !lo.Until.IsZero() && !now.Before(lo.Until) {
+			// Previous lockout has expired, start counting again.
+			lo.Failures = 0
+			lo.Until = time.Time{}
+		}
+		lo.Failures++
+		lo.LastFailure = now
+		if accConf, ok := beacon.Conf.Account(a.AccountName); ok && accConf.LoginLockout != nil && lo.Until.IsZero() && lo.Failures >= accConf.LoginLockout.MaxFailures {
+			period := accConf.LoginLockout.Period
+			if period == 0 {
+				period = defaultLockoutPeriod
+			}
+			lo.Until = now.Add(period)
+			log.Info("blocking authentication for account after too many failed attempts", slog.String("account", a.AccountName), slog.Int("failures", lo.Failures), slog.Time("until", lo.Until))
+		}
+		if exists {
+			return tx.Update(&lo)
+		}
+		return tx.Insert(&lo)
+	})
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	cleanup := now.Sub(lastCleanup) > time.Hour
+	if cleanup {
+		lastCleanup = now
+	}
+	mutex.Unlock()
+	if cleanup {
+		n, err := bstore.QueryDB[LoginAttempt](ctx, db).FilterLess("Time", now.Add(-keepAttempts)).Delete()
+		if err != nil {
+			return fmt.Errorf("removing old login attempts: %v", err)
+		}
+		log.Debug("removed old login attempts", slog.Int("count", n))
+	}
+	return nil
+}
+
+// Locked returns whether authentication for the account is blocked, and until
+// when.
+func Locked(ctx context.Context, accountName string) (until time.Time, locked bool, rerr error) {
+	db, err := database(ctx)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	lo := Lockout{AccountName: accountName}
+	if err := db.Get(ctx, &lo); err == bstore.ErrAbsent {
+		return time.Time{}, false, nil
+	} else if err != nil {
+		return time.Time{}, false, err
+	}
+	return lo.Until, timeNow().Before(lo.Until), nil
+}
+
+// LockedLogin returns whether authentication is blocked for the account, or for
+// the account of loginAddress if accountName is empty. Unknown addresses are not
+// blocked. Protocols call it before verifying credentials, and respond to attempts
+// for a blocked account as if the credentials were bad, so a lockout doesn't
+// reveal whether a password is correct.
+func LockedLogin(ctx context.Context, accountName, loginAddress string) (bool, error) {
+	if accountName == "" {
+		accountName = accountForAddress(loginAddress)
+	}
+	if accountName == "" {
+		return false, nil
+	}
+	_, locked, err := Locked(ctx, accountName)
+	return locked, err
+}
+
+// Attempts returns the most recent authentication attempts, newest first, for an
+// account, or all accounts if accountName is empty. At most limit attempts are
+// returned, if limit is larger than zero.
+func Attempts(ctx context.Context, accountName string, limit int) ([]LoginAttempt, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := bstore.QueryDB[LoginAttempt](ctx, db)
+	if accountName != "" {
+		q.FilterNonzero(LoginAttempt{AccountName: accountName})
+	}
+	q.SortDesc("Time")
+	if limit > 0 {
+		q.Limit(limit)
+	}
+	return q.List()
+}
+
+// Lockouts returns the accounts for which authentication is currently blocked.
+func Lockouts(ctx context.Context) ([]Lockout, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := bstore.QueryDB[Lockout](ctx, db)
+	q.FilterGreater("Until", timeNow())
+	q.SortAsc("AccountName")
+	return q.List()
+}
+
+// Unblock removes a block on authentication for an account, and resets its count
+// of consecutive failed attempts.
+func Unblock(ctx context.Context, log mlog.Log, accountName string) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = bstore.QueryDB[Lockout](ctx, db).FilterNonzero(Lockout{AccountName: accountName}).Delete()
+	if err == nil {
+		log.Info("authentication for account unblocked", slog.String("account", accountName))
+	}
+	return err
+}
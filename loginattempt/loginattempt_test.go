@@ -0,0 +1,129 @@
+package loginattempt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+)
+
+var ctxbg = context.Background()
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func TestLoginAttempt(t *testing.T) {
+	beacon.Shutdown = ctxbg
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/loginattempt/beacon.conf")
+	beacon.MustLoadConfig(true, false)
+
+	dbpath := beacon.DataDirPath("loginattempt.db")
+	os.MkdirAll(filepath.Dir(dbpath), 0770)
+	os.Remove(dbpath)
+	defer os.Remove(dbpath)
+
+	err := Init()
+	tcheck(t, err, "init")
+	defer Close()
+
+	log := mlog.New("loginattempt", nil)
+
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	attempt := func(address, result string) {
+		t.Helper()
+		Record(ctxbg, log, LoginAttempt{LoginAddress: address, RemoteIP: "10.0.0.1", Protocol: "imap", AuthMech: "plain", Result: result})
+	}
+
+	checkLocked := func(accountName string, expLocked bool) {
+		t.Helper()
+		_, locked, err := Locked(ctxbg, accountName)
+		tcheck(t, err, "locked")
+		if locked != expLocked {
+			t.Fatalf("got locked %v, expected %v", locked, expLocked)
+		}
+	}
+
+	// Failures below the threshold, reset by a successful login.
+	attempt("mjl@beacon.example", "badcreds")
+	attempt("mjl@beacon.example", "badcreds")
+	attempt("mjl@beacon.example", "ok")
+	attempt("mjl@beacon.example", "badcreds")
+	attempt("mjl@beacon.example", "badtotp")
+	checkLocked("mjl", false)
+
+	// Third consecutive failure blocks the account.
+	attempt("mjl@beacon.example", "badcreds")
+	checkLocked("mjl", true)
+
+	// Protocols check by login address before verifying credentials.
+	checkLockedLogin := func(accountName, address string, expLocked bool) {
+		t.Helper()
+		locked, err := LockedLogin(ctxbg, accountName, address)
+		tcheck(t, err, "locked login")
+		if locked != expLocked {
+			t.Fatalf("got locked %v for login %q, expected %v", locked, address, expLocked)
+		}
+	}
+	checkLockedLogin("", "mjl@beacon.example", true)
+	checkLockedLogin("mjl", "", true)
+	checkLockedLogin("", "unknown@beacon.example", false)
+	checkLockedLogin("", "bogus", false)
+
+	// Accounts without LoginLockout and unknown addresses are never blocked.
+	for i := 0; i < 5; i++ {
+		attempt("other@beacon.example", "badcreds")
+		attempt("unknown@beacon.example", "badcreds")
+	}
+	checkLocked("other", false)
+
+	lockouts, err := Lockouts(ctxbg)
+	tcheck(t, err, "lockouts")
+	if len(lockouts) != 1 || lockouts[0].AccountName != "mjl" || lockouts[0].Failures != 3 || !lockouts[0].Until.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected lockouts %#v", lockouts)
+	}
+
+	l, err := Attempts(ctxbg, "mjl", 0)
+	tcheck(t, err, "attempts for account")
+	if len(l) != 6 {
+		t.Fatalf("got %d attempts for account, expected 6", len(l))
+	}
+	l, err = Attempts(ctxbg, "", 3)
+	tcheck(t, err, "attempts")
+	if len(l) != 3 {
+		t.Fatalf("got %d attempts, expected 3", len(l))
+	}
+
+	// Lockout expires.
+	now = now.Add(time.Hour)
+	checkLocked("mjl", false)
+	attempt("mjl@beacon.example", "badcreds")
+	checkLocked("mjl", false)
+
+	// Unblock.
+	attempt("mjl@beacon.example", "badcreds")
+	attempt("mjl@beacon.example", "badcreds")
+	checkLocked("mjl", true)
+	err = Unblock(ctxbg, log, "mjl")
+	tcheck(t, err, "unblock")
+	checkLocked("mjl", false)
+
+	// Old attempts are removed.
+	now = now.Add(keepAttempts + 2*time.Hour)
+	attempt("mjl@beacon.example", "ok")
+	l, err = Attempts(ctxbg, "", 0)
+	tcheck(t, err, "attempts")
+	if len(l) != 1 {
+		t.Fatalf("got %d attempts after cleanup, expected 1", len(l))
+	}
+}
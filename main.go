@@ -44,6 +44,7 @@ import (
 	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dane"
 	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dmarc"
 	"github.com/qompassai/beacon/dmarcdb"
 	"github.com/qompassai/beacon/dmarcrpt"
@@ -114,6 +115,7 @@ var commands = []struct {
 	{"config test", cmdConfigTest},
 	{"config dnscheck", cmdConfigDNSCheck},
 	{"config dnsrecords", cmdConfigDNSRecords},
+	{"config dnssync", cmdConfigDNSSync},
 	{"config describe-domains", cmdConfigDescribeDomains},
 	{"config describe-static", cmdConfigDescribeStatic},
 	{"config account add", cmdConfigAccountAdd},
@@ -142,6 +144,11 @@ var commands = []struct {
 	{"dkim txt", cmdDKIMTXT},
 	{"dkim verify", cmdDKIMVerify},
 	{"dkim sign", cmdDKIMSign},
+	{"dkim rotate start", cmdDKIMRotateStart},
+	{"dkim rotate status", cmdDKIMRotateStatus},
+	{"dkim rotate check", cmdDKIMRotateCheck},
+	{"dkim rotate finish", cmdDKIMRotateFinish},
+	{"dkim rotate cancel", cmdDKIMRotateCancel},
 	{"dmarc lookup", cmdDMARCLookup},
 	{"dmarc parsereportmsg", cmdDMARCParsereportmsg},
 	{"dmarc verify", cmdDMARCVerify},
@@ -876,6 +883,64 @@ func cmdConfigDNSCheck(c *cmd) {
 	printResult("Autodiscover", result.Autodiscover.Result)
 }
 
+func cmdConfigDNSSync(c *cmd) {
+	c.params = "[-dryrun] domain"
+	c.help = `Update DNS with the required records for the domain through dynamic DNS updates.
+
+The required records, as printed by "beacon config dnsrecords", are compared with
+the records currently in DNS. Conflicting records are removed and missing records
+are added with a single DNS UPDATE message (RFC 2136), authenticated with TSIG.
+The domain must have DNSUpdate configured in domains.conf. Records outside the
+configured zone and records of types that cannot be compared (e.g. CAA) are
+skipped and must be managed manually.
+
+With -dryrun, the changes are printed but not applied.
+`
+	var dryRun bool
+	c.flag.BoolVar(&dryRun, "dryrun", false, "only print changes, do not update dns")
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+
+	d := xparseDomain(args[0], "domain")
+	mustLoadConfig()
+	_, ok := beacon.Conf.Domain(d)
+	if !ok {
+		log.Fatalf("unknown domain")
+	}
+
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		err, ok := x.(*sherpa.Error)
+		if !ok {
+			panic(x)
+		}
+		log.Fatalf("%s", err)
+	}()
+
+	result := webadmin.DomainDNSSync(context.Background(), c.log, args[0], dryRun)
+	printRecords := func(prefix string, l []string) {
+		for _, r := range l {
+			fmt.Printf("%s %s\n", prefix, r)
+		}
+	}
+	printRecords("remove", result.Remove)
+	printRecords("add", result.Add)
+	printRecords("unchanged", result.Unchanged)
+	printRecords("skipped", result.Skipped)
+	if dryRun {
+		fmt.Println("dry run, dns not updated")
+	} else if len(result.Remove) == 0 && len(result.Add) == 0 {
+		fmt.Println("dns up to date")
+	} else {
+		fmt.Println("dns updated")
+	}
+}
+
 func cmdConfigEnsureACMEHostprivatekeys(c *cmd) {
 	c.params = ""
 	c.help = `Ensure host private keys exist for TLS listeners with ACME.
@@ -2193,6 +2258,142 @@ func cmdDKIMLookup(c *cmd) {
 	}
 }
 
+func cmdDKIMRotateStart(c *cmd) {
+	c.params = "[-grace duration] domain"
+	c.help = `Start rotation of the DKIM keys of a domain.
+
+For each selector currently used for signing or ARC sealing, a new selector with
+a fresh key of the same type is added to the configuration. The DNS TXT records
+for the new selectors are printed, they must be published in DNS. The running
+beacon instance periodically checks DNS, and switches signing to the new
+selectors once the records are found, see "beacon dkim rotate check".
+
+After switching, the DNS records of the old selectors must remain published for
+the grace period, for messages still in transit and verification of recently
+sent messages. After the grace period, the rotation can be finished with "beacon
+dkim rotate finish".
+`
+	var grace time.Duration
+	c.flag.DurationVar(&grace, "grace", dkimrotate.DefaultGracePeriod, "period to keep publishing old selectors after switching to new selectors")
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	d := xparseDomain(args[0], "domain")
+	mustLoadConfig()
+	ctlcmdDKIMRotateStart(xctl(), d, grace)
+}
+
+func ctlcmdDKIMRotateStart(ctl *ctl, d dns.Domain, grace time.Duration) {
+	ctl.xwrite("dkimrotatestart")
+	ctl.xwrite(d.Name())
+	ctl.xwrite(grace.String())
+	ctl.xreadok()
+	if _, err := io.Copy(os.Stdout, ctl.reader()); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+func cmdDKIMRotateStatus(c *cmd) {
+	c.params = "[domain]"
+	c.help = `Print the state of DKIM key rotations in progress.
+
+For rotations waiting for DNS records of the new selectors, the records to
+publish are printed.
+`
+	args := c.Parse()
+	if len(args) > 1 {
+		c.Usage()
+	}
+	var d dns.Domain
+	if len(args) == 1 {
+		d = xparseDomain(args[0], "domain")
+	}
+	mustLoadConfig()
+	ctlcmdDKIMRotateStatus(xctl(), d)
+}
+
+func ctlcmdDKIMRotateStatus(ctl *ctl, d dns.Domain) {
+	ctl.xwrite("dkimrotatestatus")
+	ctl.xwrite(d.Name())
+	ctl.xreadok()
+	if _, err := io.Copy(os.Stdout, ctl.reader()); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+func cmdDKIMRotateCheck(c *cmd) {
+	c.params = "domain"
+	c.help = `Check DNS for the records of the new selectors of a DKIM key rotation.
+
+If the records of all new selectors are found, signing switches to the new
+selectors. DNS is also checked periodically by the running beacon instance, this
+command checks immediately.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	d := xparseDomain(args[0], "domain")
+	mustLoadConfig()
+	ctlcmdDKIMRotateCheck(xctl(), d)
+}
+
+func ctlcmdDKIMRotateCheck(ctl *ctl, d dns.Domain) {
+	ctl.xwrite("dkimrotatecheck")
+	ctl.xwrite(d.Name())
+	ctl.xreadok()
+	if _, err := io.Copy(os.Stdout, ctl.reader()); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+func cmdDKIMRotateFinish(c *cmd) {
+	c.params = "domain"
+	c.help = `Finish a DKIM key rotation after its grace period has passed.
+
+The old selectors are removed from the configuration and their private keys
+moved to the "old" directory. Their DNS records should be removed afterwards.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	d := xparseDomain(args[0], "domain")
+	mustLoadConfig()
+	ctlcmdDKIMRotateFinish(xctl(), d)
+}
+
+func ctlcmdDKIMRotateFinish(ctl *ctl, d dns.Domain) {
+	ctl.xwrite("dkimrotatefinish")
+	ctl.xwrite(d.Name())
+	ctl.xreadok()
+	fmt.Printf("dkim key rotation finished, remember to remove the dns records of the old selectors of %s\n", d)
+}
+
+func cmdDKIMRotateCancel(c *cmd) {
+	c.params = "domain"
+	c.help = `Cancel a DKIM key rotation that is still waiting for DNS records.
+
+The new selectors are removed from the configuration. A rotation can no longer
+be canceled after signing has switched to the new selectors.
+`
+	args := c.Parse()
+	if len(args) != 1 {
+		c.Usage()
+	}
+	d := xparseDomain(args[0], "domain")
+	mustLoadConfig()
+	ctlcmdDKIMRotateCancel(xctl(), d)
+}
+
+func ctlcmdDKIMRotateCancel(ctl *ctl, d dns.Domain) {
+	ctl.xwrite("dkimrotatecancel")
+	ctl.xwrite(d.Name())
+	ctl.xreadok()
+	fmt.Printf("dkim key rotation canceled, dns records of the new selectors of %s can be removed\n", d)
+}
+
 func cmdDMARCLookup(c *cmd) {
 	c.params = "domain"
 	c.help = "Lookup dmarc policy for domain, a DNS TXT record at _dmarc.<domain>, validate and print it."
@@ -2,6 +2,7 @@ package message
 
 import (
 	"fmt"
+	"strings"
 )
 
 // ../rfc/8601:577
@@ -54,6 +55,18 @@ func MakeAuthProp(typ, property, value string, isAddrLike bool, Comment string)
 // Header returns an Authentication-Results header, possibly spanning multiple
 // lines, always ending in crlf.
 func (h AuthResults) Header() string {
+	return h.header("Authentication-Results:")
+}
+
+// ARCHeader returns an ARC-Authentication-Results header for the ARC instance,
+// possibly spanning multiple lines, always ending in crlf. The header has the
+// same form as Authentication-Results, with the instance as first field.
+// ../rfc/8617
+func (h AuthResults) ARCHeader(instance int) string {
+	return h.header(fmt.Sprintf("ARC-Authentication-Results: i=%d;", instance))
+}
+
+func (h AuthResults) header(prefix string) string {
 	// Escaping of values: ../rfc/8601:684 ../rfc/2045:661
 
 	optComment := func(s string) string {
@@ -64,7 +77,7 @@ func (h AuthResults) Header() string {
 	}
 
 	w := &HeaderWriter{}
-	w.Add("", "Authentication-Results:"+optComment(h.Comment)+" "+value(h.Hostname)+";")
+	w.Add("", prefix+optComment(h.Comment)+" "+value(h.Hostname)+";")
 	for i, m := range h.Methods {
 		w.Newline()
 
@@ -123,3 +136,128 @@ func value(s string) string {
 	r += `"`
 	return r
 }
+
+// ParseAuthResults parses the value of an Authentication-Results header, i.e.
+// without the header name and colon. Comments are ignored. Parsing is lenient:
+// methods and properties that cannot be parsed are skipped. An error is only
+// returned if the header has no authserv-id.
+// ../rfc/8601:577
+func ParseAuthResults(s string) (AuthResults, error) {
+	var r AuthResults
+
+	parts := splitAuthResults(s)
+	if len(parts) == 0 || len(parts[0]) == 0 {
+		return r, fmt.Errorf("missing authserv-id")
+	}
+	r.Hostname = unquoteAuthValue(parts[0][0])
+	for _, tokens := range parts[1:] {
+		if len(tokens) == 0 || len(tokens) == 1 && strings.EqualFold(tokens[0], "none") {
+			continue
+		}
+		k, v, ok := strings.Cut(tokens[0], "=")
+		if !ok {
+			continue
+		}
+		method, _, _ := strings.Cut(k, "/") // Ignore version.
+		m := AuthMethod{Method: strings.ToLower(method), Result: strings.ToLower(v)}
+		for _, t := range tokens[1:] {
+			k, v, ok := strings.Cut(t, "=")
+			if !ok {
+				continue
+			}
+			v = unquoteAuthValue(v)
+			if strings.EqualFold(k, "reason") {
+				m.Reason = v
+			} else if typ, prop, ok := strings.Cut(k, "."); ok {
+				m.Props = append(m.Props, AuthProp{Type: strings.ToLower(typ), Property: strings.ToLower(prop), Value: v})
+			}
+		}
+		r.Methods = append(r.Methods, m)
+	}
+	return r, nil
+}
+
+// splitAuthResults returns the tokens of each ";"-separated part of an
+// Authentication-Results header value. Comments are removed, and whitespace around
+// "=" is removed so "name=value" is a single token.
+func splitAuthResults(s string) [][]string {
+	var parts [][]string
+	var tokens []string
+	var token strings.Builder
+	flush := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+	var quoted, escaped bool
+	var depth int
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+			if depth == 0 {
+				token.WriteRune(c)
+			}
+		case c == '\\' && (quoted || depth > 0):
+			escaped = true
+			if depth == 0 {
+				token.WriteRune(c)
+			}
+		case quoted:
+			token.WriteRune(c)
+			if c == '"' {
+				quoted = false
+			}
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth > 0:
+		case c == '"':
+			quoted = true
+			token.WriteRune(c)
+		case c == ';':
+			flush()
+			parts = append(parts, tokens)
+			tokens = nil
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			flush()
+		default:
+			token.WriteRune(c)
+		}
+	}
+	flush()
+	parts = append(parts, tokens)
+
+	// Join "name = value" into a single token.
+	for i, l := range parts {
+		var nl []string
+		for _, t := range l {
+			if len(nl) > 0 && (strings.Index(nl[len(nl)-1], "=") == len(nl[len(nl)-1])-1 || strings.HasPrefix(t, "=") && !strings.Contains(nl[len(nl)-1], "=")) {
+				nl[len(nl)-1] += t
+			} else {
+				nl = append(nl, t)
+			}
+		}
+		parts[i] = nl
+	}
+	return parts
+}
+
+func unquoteAuthValue(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var r strings.Builder
+	var escaped bool
+	for _, c := range s[1 : len(s)-1] {
+		if !escaped && c == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		r.WriteRune(c)
+	}
+	return r.String()
+}
@@ -1,6 +1,7 @@
 package message
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/qompassai/beacon/dns"
@@ -23,4 +24,33 @@ func TestAuthResults(t *testing.T) {
 	if s != exp {
 		t.Fatalf("got %q, expected %q", s, exp)
 	}
+
+	s = authRes.ARCHeader(2)
+	const expARC = "ARC-Authentication-Results: i=2; (xn--mx-lka.example) møx.example;\r\n\tdkim=pass header.d=møx.example (xn--mx-lka.example)\r\n"
+	if s != expARC {
+		t.Fatalf("got %q, expected %q", s, expARC)
+	}
+}
+
+func TestParseAuthResults(t *testing.T) {
+	const s = " (comment) mx.example 1;\r\n\tdkim=pass (good (nested) signature) header.d=example.org header.b=\"ab=\";\r\n\tspf = fail reason=\"not \\\"permitted\\\"\" smtp.mailfrom=sender@example.org;\r\n\tdmarc/1=pass header.from=example.org; none"
+	r, err := ParseAuthResults(s)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	exp := AuthResults{
+		Hostname: "mx.example",
+		Methods: []AuthMethod{
+			{"dkim", "pass", "", "", []AuthProp{{"header", "d", "example.org", false, ""}, {"header", "b", "ab=", false, ""}}},
+			{"spf", "fail", "", `not "permitted"`, []AuthProp{{"smtp", "mailfrom", "sender@example.org", false, ""}}},
+			{"dmarc", "pass", "", "", []AuthProp{{"header", "from", "example.org", false, ""}}},
+		},
+	}
+	if !reflect.DeepEqual(r, exp) {
+		t.Fatalf("got %#v, expected %#v", r, exp)
+	}
+
+	if _, err := ParseAuthResults(" (only comment)"); err == nil {
+		t.Fatalf("expected error for missing authserv-id")
+	}
 }
@@ -0,0 +1,596 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar is an iCalendar object (RFC 5545) from a text/calendar part, as used
+// for meeting invitations sent by email (iMIP, RFC 6047). Only the properties
+// needed for showing invitations and replying to them are parsed.
+type Calendar struct {
+	Method string // iTIP method (RFC 5546) in upper case, e.g. "REQUEST", "REPLY" or "CANCEL". Can be empty.
+	ProdID string
+	Events []CalendarEvent
+
+	zones map[string]*calZone // VTIMEZONE components by TZID, included in replies.
+}
+
+// CalendarEvent is a VEVENT component of a calendar.
+type CalendarEvent struct {
+	UID          string
+	RecurrenceID string // Value of RECURRENCE-ID, set for an event about a single occurrence of a recurring event.
+	Sequence     int    // Revision of the event, incremented by the organizer on significant changes.
+	Start        time.Time
+	End          time.Time // Zero if absent. Calculated from DURATION if present.
+	AllDay       bool      // If start (and end) are dates without time.
+	Summary      string
+	Description  string
+	Location     string
+	Status       string // In upper case, e.g. "CONFIRMED", "TENTATIVE", "CANCELLED". Can be empty.
+	Recurrence   string // Value of RRULE, e.g. "FREQ=WEEKLY;COUNT=10". Empty if not recurring.
+	Organizer    CalendarAddress
+	Attendees    []CalendarAddress
+
+	// Content lines as parsed, included in replies.
+	dtstart, dtend, duration, recurrenceID, organizer string
+	tzids                                             []string // Of VTIMEZONE components referenced by dtstart or dtend.
+}
+
+// CalendarAddress is an organizer or attendee of an event.
+type CalendarAddress struct {
+	Address  string // Email address, without "mailto:".
+	Name     string // Common name, can be empty.
+	PartStat string // Participation status in upper case, e.g. "NEEDS-ACTION", "ACCEPTED", "TENTATIVE", "DECLINED". Empty for organizer.
+	Role     string // E.g. "REQ-PARTICIPANT", "OPT-PARTICIPANT", "CHAIR". Can be empty.
+	RSVP     bool   // Whether the organizer requests a reply.
+}
+
+var errCalendar = errors.New("bad icalendar")
+
+// calProp is a content line.
+type calProp struct {
+	name   string            // Upper case.
+	params map[string]string // Upper case names, values without quotes.
+	value  string            // As encoded.
+	line   string            // Unfolded content line.
+}
+
+func (p calProp) text() string {
+	return calUnescape(p.value)
+}
+
+// ParseCalendar parses data as iCalendar object with events. Times with a time
+// zone are resolved through the IANA time zone database, or through the
+// VTIMEZONE components in the calendar. Times without time zone ("floating") are
+// returned in UTC.
+func ParseCalendar(data []byte) (*Calendar, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: invalid utf-8", errCalendar)
+	}
+
+	// Unfold lines.
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("%w: continuation line without property", errCalendar)
+			}
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	zones := map[string]*calZone{}
+	cal := &Calendar{zones: zones}
+	var events [][]calProp
+	var zone *calZone
+	var obs *calObservance
+	var stack []string
+	for _, line := range lines {
+		p, err := parseCalProp(line)
+		if err != nil {
+			return nil, err
+		}
+		if zone != nil {
+			zone.lines = append(zone.lines, line)
+		}
+		switch p.name {
+		case "BEGIN":
+			comp := strings.ToUpper(p.value)
+			stack = append(stack, comp)
+			path := strings.Join(stack, "/")
+			switch {
+			case len(stack) == 1 && comp != "VCALENDAR":
+				return nil, fmt.Errorf("%w: expected VCALENDAR, saw %q", errCalendar, comp)
+			case path == "VCALENDAR/VEVENT":
+				events = append(events, nil)
+			case path == "VCALENDAR/VTIMEZONE":
+				zone = &calZone{lines: []string{line}}
+			case path == "VCALENDAR/VTIMEZONE/STANDARD" || path == "VCALENDAR/VTIMEZONE/DAYLIGHT":
+				zone.observances = append(zone.observances, calObservance{})
+				obs = &zone.observances[len(zone.observances)-1]
+			}
+			continue
+		case "END":
+			if len(stack) == 0 || !strings.EqualFold(stack[len(stack)-1], p.value) {
+				return nil, fmt.Errorf("%w: unexpected END:%s", errCalendar, p.value)
+			}
+			switch strings.Join(stack, "/") {
+			case "VCALENDAR/VTIMEZONE":
+				if zone.tzid != "" {
+					zones[zone.tzid] = zone
+				}
+				zone = nil
+			case "VCALENDAR/VTIMEZONE/STANDARD", "VCALENDAR/VTIMEZONE/DAYLIGHT":
+				obs = nil
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				// Anything after the calendar, e.g. a second calendar, is ignored.
+				goto done
+			}
+			continue
+		}
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("%w: property outside VCALENDAR", errCalendar)
+		}
+
+		switch strings.Join(stack, "/") {
+		case "VCALENDAR":
+			switch p.name {
+			case "METHOD":
+				cal.Method = strings.ToUpper(p.value)
+			case "PRODID":
+				cal.ProdID = p.text()
+			}
+		case "VCALENDAR/VEVENT":
+			events[len(events)-1] = append(events[len(events)-1], p)
+		case "VCALENDAR/VTIMEZONE":
+			if p.name == "TZID" {
+				zone.tzid = p.text()
+			}
+		case "VCALENDAR/VTIMEZONE/STANDARD", "VCALENDAR/VTIMEZONE/DAYLIGHT":
+			if obs == nil {
+				continue
+			}
+			if err := obs.add(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: missing END:VCALENDAR", errCalendar)
+
+done:
+	for _, props := range events {
+		ev, err := parseCalEvent(props, zones)
+		if err != nil {
+			return nil, err
+		}
+		cal.Events = append(cal.Events, ev)
+	}
+	return cal, nil
+}
+
+func parseCalProp(line string) (calProp, error) {
+	p := calProp{line: line, params: map[string]string{}}
+
+	// Find the colon separating the name and parameters from the value. Parameter
+	// values can be quoted and contain colons.
+	var quoted bool
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return calProp{}, fmt.Errorf("%w: missing colon in line %q", errCalendar, line)
+	}
+	p.value = line[colon+1:]
+
+	var fields []string
+	quoted = false
+	start := 0
+	for i, c := range line[:colon] {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ';' && !quoted {
+			fields = append(fields, line[start:i])
+			start = i + 1
+		}
+	}
+	fields = append(fields, line[start:colon])
+	p.name = strings.ToUpper(fields[0])
+	if p.name == "" {
+		return calProp{}, fmt.Errorf("%w: missing property name in line %q", errCalendar, line)
+	}
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return calProp{}, fmt.Errorf("%w: bad parameter %q", errCalendar, f)
+		}
+		if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+			v = v[1 : len(v)-1]
+		}
+		p.params[strings.ToUpper(k)] = v
+	}
+	return p, nil
+}
+
+func parseCalEvent(props []calProp, zones map[string]*calZone) (ev CalendarEvent, rerr error) {
+	var duration time.Duration
+	var haveDuration bool
+	for _, p := range props {
+		var err error
+		switch p.name {
+		case "UID":
+			ev.UID = p.text()
+		case "RECURRENCE-ID":
+			ev.RecurrenceID = p.value
+			ev.recurrenceID = p.line
+		case "SEQUENCE":
+			ev.Sequence, err = strconv.Atoi(p.value)
+		case "DTSTART":
+			ev.Start, ev.AllDay, err = parseCalTime(p, zones)
+			ev.dtstart = p.line
+		case "DTEND":
+			ev.End, _, err = parseCalTime(p, zones)
+			ev.dtend = p.line
+		case "DURATION":
+			duration, err = parseCalDuration(p.value)
+			haveDuration = true
+			ev.duration = p.line
+		case "SUMMARY":
+			ev.Summary = p.text()
+		case "DESCRIPTION":
+			ev.Description = p.text()
+		case "LOCATION":
+			ev.Location = p.text()
+		case "STATUS":
+			ev.Status = strings.ToUpper(p.value)
+		case "RRULE":
+			ev.Recurrence = p.value
+		case "ORGANIZER":
+			ev.Organizer = parseCalAddress(p)
+			ev.organizer = p.line
+		case "ATTENDEE":
+			ev.Attendees = append(ev.Attendees, parseCalAddress(p))
+		}
+		if err != nil {
+			return ev, fmt.Errorf("%w: parsing %s: %v", errCalendar, p.name, err)
+		}
+		if tzid := p.params["TZID"]; (p.name == "DTSTART" || p.name == "DTEND") && zones[tzid] != nil && (len(ev.tzids) == 0 || ev.tzids[0] != tzid) {
+			ev.tzids = append(ev.tzids, tzid)
+		}
+	}
+	if ev.UID == "" {
+		return ev, fmt.Errorf("%w: event without uid", errCalendar)
+	}
+	if ev.End.IsZero() && haveDuration && !ev.Start.IsZero() {
+		ev.End = ev.Start.Add(duration)
+	}
+	return ev, nil
+}
+
+func parseCalAddress(p calProp) CalendarAddress {
+	addr := p.value
+	if len(addr) >= len("mailto:") && strings.EqualFold(addr[:len("mailto:")], "mailto:") {
+		addr = addr[len("mailto:"):]
+	}
+	return CalendarAddress{
+		Address:  addr,
+		Name:     p.params["CN"],
+		PartStat: strings.ToUpper(p.params["PARTSTAT"]),
+		Role:     strings.ToUpper(p.params["ROLE"]),
+		RSVP:     strings.EqualFold(p.params["RSVP"], "TRUE"),
+	}
+}
+
+// parseCalTime parses a DATE or DATE-TIME value.
+func parseCalTime(p calProp, zones map[string]*calZone) (t time.Time, allDay bool, rerr error) {
+	v := p.value
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(v) == len("20060102") {
+		t, err := time.Parse("20060102", v)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	t, err := time.Parse("20060102T150405", v)
+	if err != nil {
+		return t, false, err
+	}
+	tzid := p.params["TZID"]
+	if tzid == "" {
+		return t, false, nil
+	}
+	if loc, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), false, nil
+	}
+	if z, ok := zones[tzid]; ok {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone(tzid, z.offset(t))), false, nil
+	}
+	return t, false, nil
+}
+
+// parseCalDuration parses a duration like "PT1H30M", "P1D" or "P2W".
+func parseCalDuration(s string) (time.Duration, error) {
+	var neg bool
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	var d time.Duration
+	var inTime bool
+	var n int
+	var digits bool
+	for _, c := range s[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+			digits = true
+			continue
+		case c == 'T' && !inTime && !digits:
+			inTime = true
+			continue
+		}
+		if !digits {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+		if inTime {
+			unit = map[rune]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+		}
+		u, ok := unit[c]
+		if !ok {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		d += time.Duration(n) * u
+		n = 0
+		digits = false
+	}
+	if digits {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// calZone is a VTIMEZONE, for time zones not in the time zone database, e.g.
+// with Windows names as used by Microsoft software.
+type calZone struct {
+	tzid        string
+	observances []calObservance
+	lines       []string // Content lines, from BEGIN to END.
+}
+
+// calObservance is a STANDARD or DAYLIGHT component of a VTIMEZONE, typically
+// with a yearly recurrence rule for the onset.
+type calObservance struct {
+	start    time.Time // Local time of first onset.
+	offsetTo int       // In seconds.
+
+	// From RRULE, month and the n-th weekday of the month, negative n counting from
+	// the end of the month. Zero month if there is no rule.
+	month   time.Month
+	n       int
+	weekday time.Weekday
+}
+
+func (o *calObservance) add(p calProp) error {
+	var err error
+	switch p.name {
+	case "DTSTART":
+		o.start, err = time.Parse("20060102T150405", p.value)
+	case "TZOFFSETTO":
+		o.offsetTo, err = parseCalOffset(p.value)
+	case "RRULE":
+		for _, kv := range strings.Split(p.value, ";") {
+			k, v, _ := strings.Cut(kv, "=")
+			switch strings.ToUpper(k) {
+			case "BYMONTH":
+				var m int
+				m, err = strconv.Atoi(v)
+				o.month = time.Month(m)
+			case "BYDAY":
+				days := map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+				if len(v) < 3 {
+					return fmt.Errorf("%w: bad BYDAY %q in time zone", errCalendar, v)
+				}
+				var ok bool
+				if o.weekday, ok = days[strings.ToUpper(v[len(v)-2:])]; !ok {
+					return fmt.Errorf("%w: bad BYDAY %q in time zone", errCalendar, v)
+				}
+				o.n, err = strconv.Atoi(v[:len(v)-2])
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: parsing %s in time zone: %v", errCalendar, p.name, err)
+	}
+	return nil
+}
+
+// onset returns the local time the observance starts in year.
+func (o calObservance) onset(year int) time.Time {
+	if o.month == 0 {
+		return o.start
+	}
+	h, m, s := o.start.Clock()
+	if o.n >= 0 {
+		t := time.Date(year, o.month, 1, h, m, s, 0, time.UTC)
+		t = t.AddDate(0, 0, (int(o.weekday)-int(t.Weekday())+7)%7)
+		return t.AddDate(0, 0, 7*(o.n-1))
+	}
+	t := time.Date(year, o.month+1, 0, h, m, s, 0, time.UTC) // Last day of month.
+	t = t.AddDate(0, 0, -((int(t.Weekday()) - int(o.weekday) + 7) % 7))
+	return t.AddDate(0, 0, 7*(o.n+1))
+}
+
+// offset returns the UTC offset in seconds for local time t, from the observance
+// with the latest onset before t.
+func (z *calZone) offset(t time.Time) int {
+	var offset int
+	var last time.Time
+	for _, o := range z.observances {
+		for _, year := range []int{t.Year() - 1, t.Year()} {
+			on := o.onset(year)
+			if !on.After(t) && !on.Before(o.start) && (last.IsZero() || on.After(last)) {
+				last = on
+				offset = o.offsetTo
+			}
+		}
+	}
+	return offset
+}
+
+// parseCalOffset parses a UTC offset like "+0100" or "-053000".
+func parseCalOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 || s[0] != '+' && s[0] != '-' {
+		return 0, fmt.Errorf("bad utc offset %q", s)
+	}
+	v, err := strconv.Atoi(s[1:])
+	if err != nil {
+		return 0, fmt.Errorf("bad utc offset %q", s)
+	}
+	if len(s) == 5 {
+		v *= 100
+	}
+	secs := v/10000*3600 + v/100%100*60 + v%100
+	if s[0] == '-' {
+		secs = -secs
+	}
+	return secs, nil
+}
+
+// Reply returns an iCalendar object with method REPLY (RFC 5546) for the events
+// with uid, with attendee and its participation status, e.g. "ACCEPTED",
+// "TENTATIVE" or "DECLINED", and an optional comment for the organizer.
+func (c *Calendar) Reply(uid string, attendee CalendarAddress, partStat, comment, prodID string, now time.Time) (string, error) {
+	var b strings.Builder
+	line := func(s string) {
+		// Fold at 75 octets, without splitting utf-8 sequences.
+		max := 75
+		for len(s) > max {
+			n := max
+			for n > 0 && !utf8.RuneStart(s[n]) {
+				n--
+			}
+			b.WriteString(s[:n] + "\r\n ")
+			s = s[n:]
+			max = 74
+		}
+		b.WriteString(s + "\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + calEscape(prodID))
+	line("METHOD:REPLY")
+	var found bool
+	zones := map[string]bool{}
+	for _, ev := range c.Events {
+		if ev.UID != uid {
+			continue
+		}
+		found = true
+		for _, tzid := range ev.tzids {
+			if !zones[tzid] {
+				zones[tzid] = true
+				for _, l := range c.zones[tzid].lines {
+					line(l)
+				}
+			}
+		}
+	}
+	for _, ev := range c.Events {
+		if ev.UID != uid {
+			continue
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + calEscape(ev.UID))
+		if ev.recurrenceID != "" {
+			line(ev.recurrenceID)
+		}
+		if ev.Sequence != 0 {
+			line(fmt.Sprintf("SEQUENCE:%d", ev.Sequence))
+		}
+		line("DTSTAMP:" + now.UTC().Format("20060102T150405Z"))
+		if ev.dtstart != "" {
+			line(ev.dtstart)
+		}
+		if ev.dtend != "" {
+			line(ev.dtend)
+		}
+		if ev.duration != "" {
+			line(ev.duration)
+		}
+		if ev.Summary != "" {
+			line("SUMMARY:" + calEscape(ev.Summary))
+		}
+		if ev.organizer != "" {
+			line(ev.organizer)
+		}
+		params := ";PARTSTAT=" + partStat
+		if name := strings.Map(func(r rune) rune {
+			if r == '"' || r < 0x20 {
+				return -1
+			}
+			return r
+		}, attendee.Name); name != "" {
+			params += `;CN="` + name + `"`
+		}
+		line("ATTENDEE" + params + ":mailto:" + attendee.Address)
+		if comment != "" {
+			line("COMMENT:" + calEscape(comment))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	if !found {
+		return "", fmt.Errorf("no event with uid %q", uid)
+	}
+	return b.String(), nil
+}
+
+func calEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+func calUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,186 @@
+package message
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCalendar(t *testing.T) {
+	const invite = "BEGIN:VCALENDAR\r\n" +
+		"PRODID:-//Example//Calendar//EN\r\n" +
+		"VERSION:2.0\r\n" +
+		"METHOD:REQUEST\r\n" +
+		"BEGIN:VTIMEZONE\r\n" +
+		"TZID:W. Europe Standard Time\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:16010101T030000\r\n" +
+		"TZOFFSETFROM:+0200\r\n" +
+		"TZOFFSETTO:+0100\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\n" +
+		"END:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\n" +
+		"DTSTART:16010101T020000\r\n" +
+		"TZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0200\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\n" +
+		"END:DAYLIGHT\r\n" +
+		"END:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:event1@example.org\r\n" +
+		"SEQUENCE:2\r\n" +
+		"DTSTAMP:20231001T120000Z\r\n" +
+		"DTSTART;TZID=W. Europe Standard Time:20231010T140000\r\n" +
+		"DURATION:PT1H30M\r\n" +
+		"SUMMARY:Planning\\, quarterly\r\n" +
+		"DESCRIPTION:Agenda:\\n1. Budget\r\n" +
+		"LOCATION:Room 1\r\n" +
+		"ORGANIZER;CN=\"Doe, Jane\":mailto:jane@example.org\r\n" +
+		"ATTENDEE;CN=mjl;PARTSTAT=NEEDS-ACTION;ROLE=REQ-PARTICIPANT;RSVP=TRUE:MAILTO:\r\n" +
+		" mjl@beacon.example\r\n" +
+		"ATTENDEE;PARTSTAT=ACCEPTED:mailto:jane@example.org\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"TRIGGER:-PT15M\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	cal, err := ParseCalendar([]byte(invite))
+	tcheck(t, err, "parse calendar")
+	if cal.Method != "REQUEST" || cal.ProdID != "-//Example//Calendar//EN" || len(cal.Events) != 1 {
+		t.Fatalf("unexpected calendar %#v", cal)
+	}
+	ev := cal.Events[0]
+	if ev.UID != "event1@example.org" || ev.Sequence != 2 || ev.Summary != "Planning, quarterly" || ev.Description != "Agenda:\n1. Budget" || ev.Location != "Room 1" || ev.AllDay {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+	// Daylight saving time in October, before the last Sunday.
+	start := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	if !ev.Start.Equal(start) || !ev.End.Equal(start.Add(90*time.Minute)) {
+		t.Fatalf("got start %s end %s, expected start %s", ev.Start, ev.End, start)
+	}
+	expOrg := CalendarAddress{Address: "jane@example.org", Name: "Doe, Jane"}
+	if ev.Organizer != expOrg {
+		t.Fatalf("got organizer %#v, expected %#v", ev.Organizer, expOrg)
+	}
+	expAtt := CalendarAddress{Address: "mjl@beacon.example", Name: "mjl", PartStat: "NEEDS-ACTION", Role: "REQ-PARTICIPANT", RSVP: true}
+	if len(ev.Attendees) != 2 || ev.Attendees[0] != expAtt || ev.Attendees[1].PartStat != "ACCEPTED" {
+		t.Fatalf("got attendees %#v", ev.Attendees)
+	}
+
+	// Standard time after the last Sunday of October.
+	z := calZone{tzid: "x", observances: []calObservance{{start: time.Date(1601, 1, 1, 3, 0, 0, 0, time.UTC), offsetTo: 3600, month: 10, n: -1}, {start: time.Date(1601, 1, 1, 2, 0, 0, 0, time.UTC), offsetTo: 7200, month: 3, n: -1}}}
+	for _, tc := range []struct {
+		t      time.Time
+		offset int
+	}{
+		{time.Date(2023, 10, 29, 2, 0, 0, 0, time.UTC), 7200},
+		{time.Date(2023, 10, 29, 3, 0, 0, 0, time.UTC), 3600},
+		{time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), 3600},
+		{time.Date(2024, 3, 31, 2, 0, 0, 0, time.UTC), 7200},
+	} {
+		if offset := z.offset(tc.t); offset != tc.offset {
+			t.Fatalf("offset for %s: got %d, expected %d", tc.t, offset, tc.offset)
+		}
+	}
+
+	reply, err := cal.Reply("event1@example.org", CalendarAddress{Address: "mjl@beacon.example", Name: `"mjl"`}, "ACCEPTED", "See you; there.", "-//beacon//test//EN", time.Date(2023, 10, 2, 8, 0, 0, 0, time.UTC))
+	tcheck(t, err, "reply")
+	for _, s := range []string{
+		"METHOD:REPLY\r\n",
+		"UID:event1@example.org\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTAMP:20231002T080000Z\r\n",
+		"DTSTART;TZID=W. Europe Standard Time:20231010T140000\r\n",
+		"DURATION:PT1H30M\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:W. Europe Standard Time\r\n",
+		"SUMMARY:Planning\\, quarterly\r\n",
+		"ORGANIZER;CN=\"Doe, Jane\":mailto:jane@example.org\r\n",
+		"ATTENDEE;PARTSTAT=ACCEPTED;CN=\"mjl\":mailto:mjl@beacon.example\r\n",
+		"COMMENT:See you\\; there.\r\n",
+	} {
+		if !strings.Contains(reply, s) {
+			t.Fatalf("reply does not contain %q:\n%s", s, reply)
+		}
+	}
+	rcal, err := ParseCalendar([]byte(reply))
+	tcheck(t, err, "parse reply")
+	if rcal.Method != "REPLY" || len(rcal.Events) != 1 || len(rcal.Events[0].Attendees) != 1 || rcal.Events[0].Attendees[0].PartStat != "ACCEPTED" || !rcal.Events[0].Start.Equal(start) {
+		t.Fatalf("unexpected reply %#v", rcal)
+	}
+	_, err = cal.Reply("other", expAtt, "ACCEPTED", "", "x", time.Now())
+	if err == nil {
+		t.Fatalf("reply for unknown uid succeeded")
+	}
+
+	// Long lines are folded.
+	long := &Calendar{Events: []CalendarEvent{{UID: "x", Summary: strings.Repeat("é", 100)}}}
+	reply, err = long.Reply("x", expAtt, "DECLINED", "", "x", time.Now())
+	tcheck(t, err, "reply")
+	for _, line := range strings.Split(reply, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %q", line)
+		}
+	}
+	rcal, err = ParseCalendar([]byte(reply))
+	tcheck(t, err, "parse reply")
+	if rcal.Events[0].Summary != long.Events[0].Summary {
+		t.Fatalf("got summary %q after folding", rcal.Events[0].Summary)
+	}
+
+	// All-day event, cancellation.
+	cal, err = ParseCalendar([]byte("BEGIN:VCALENDAR\nMETHOD:CANCEL\nBEGIN:VEVENT\nUID:x\nDTSTART;VALUE=DATE:20231010\nDTEND;VALUE=DATE:20231011\nSTATUS:cancelled\nEND:VEVENT\nEND:VCALENDAR\n"))
+	tcheck(t, err, "parse")
+	ev = cal.Events[0]
+	if cal.Method != "CANCEL" || !ev.AllDay || ev.Status != "CANCELLED" || !ev.Start.Equal(time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)) || !ev.End.Equal(ev.Start.AddDate(0, 0, 1)) {
+		t.Fatalf("unexpected calendar %#v", cal)
+	}
+
+	// IANA time zone, and floating time.
+	cal, err = ParseCalendar([]byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDTSTART;TZID=America/New_York:20230710T090000\r\nDTEND:20230710T100000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	tcheck(t, err, "parse")
+	ev = cal.Events[0]
+	if !ev.Start.Equal(time.Date(2023, 7, 10, 13, 0, 0, 0, time.UTC)) || !ev.End.Equal(time.Date(2023, 7, 10, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got start %s, end %s", ev.Start, ev.End)
+	}
+
+	// Properties after a nested component in a time zone observance.
+	cal, err = ParseCalendar([]byte("BEGIN:VCALENDAR\r\nBEGIN:VTIMEZONE\r\nTZID:X\r\nBEGIN:STANDARD\r\nBEGIN:X\r\nEND:X\r\nTZOFFSETTO:+0100\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\nEND:VCALENDAR\r\n"))
+	tcheck(t, err, "parse")
+	tcompare(t, len(cal.Events), 0)
+
+	for _, s := range []string{
+		"",
+		"BEGIN:VCARD\r\nEND:VCARD\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nEND:VEVENT\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:no uid\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDTSTART:bogus\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDURATION:P1X\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nno colon\r\nEND:VCALENDAR\r\n",
+	} {
+		_, err := ParseCalendar([]byte(s))
+		if !errors.Is(err, errCalendar) {
+			t.Fatalf("parsing %q: got err %v, expected errCalendar", s, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		s string
+		d time.Duration
+	}{
+		{"PT1H30M", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P2W", 14 * 24 * time.Hour},
+		{"-PT15M", -15 * time.Minute},
+		{"P1DT12H", 36 * time.Hour},
+	} {
+		d, err := parseCalDuration(tc.s)
+		tcheck(t, err, "parse duration")
+		if d != tc.d {
+			t.Fatalf("duration %q: got %s, expected %s", tc.s, d, tc.d)
+		}
+	}
+}
@@ -138,10 +138,27 @@ func (c *Composer) Line() {
 // quotedprintable, if needed. The returned ct and cte headers are for use with
 // Content-Type and Content-Transfer-Encoding headers.
 func (c *Composer) TextPart(text string) (textBody []byte, ct, cte string) {
+	return c.textPart("plain", text)
+}
+
+// HTMLPart is like TextPart, but for a text/html part.
+func (c *Composer) HTMLPart(html string) (htmlBody []byte, ct, cte string) {
+	return c.textPart("html", html)
+}
+
+// CalendarPart is like TextPart, but for a text/calendar part with an iTIP
+// method, e.g. "REPLY", for sending a calendar object by email (iMIP, RFC 6047).
+func (c *Composer) CalendarPart(calendar, method string) (calendarBody []byte, ct, cte string) {
+	return c.textPart("calendar", calendar, "method", method)
+}
+
+// textPart prepares a text part, with optional additional content-type parameters
+// as key/value pairs.
+func (c *Composer) textPart(subtype, text string, params ...string) (textBody []byte, ct, cte string) {
 	if !strings.HasSuffix(text, "\n") {
 		text += "\n"
 	}
-	text = strings.ReplaceAll(text, "\n", "\r\n")
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
 	charset := "us-ascii"
 	if !isASCII(text) {
 		charset = "utf-8"
@@ -158,7 +175,11 @@ func (c *Composer) TextPart(text string) (textBody []byte, ct, cte string) {
 		cte = "7bit"
 	}
 
-	ct = mime.FormatMediaType("text/plain", map[string]string{"charset": charset})
+	ctparams := map[string]string{"charset": charset}
+	for i := 0; i+1 < len(params); i += 2 {
+		ctparams[params[i]] = params[i+1]
+	}
+	ct = mime.FormatMediaType("text/"+subtype, ctparams)
 	return []byte(text), ct, cte
 }
 
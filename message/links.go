@@ -0,0 +1,52 @@
+package message
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Links returns the http and https URLs in text s, in order of appearance. A
+// link ends at whitespace, quotes, angle brackets, parentheses, brackets, braces
+// or a backslash. Trailing punctuation is not included in a link, it typically
+// ends the sentence the link is in.
+func Links(s string) []string {
+	var l []string
+	for {
+		i := strings.Index(s, "://")
+		if i < 0 {
+			break
+		}
+		// Only ASCII is compared case-insensitively, so offsets in s stay valid.
+		var start int
+		if i >= len("https") && strings.EqualFold(s[i-len("https"):i], "https") {
+			start = i - len("https")
+		} else if i >= len("http") && strings.EqualFold(s[i-len("http"):i], "http") {
+			start = i - len("http")
+		} else {
+			s = s[i+len("://"):]
+			continue
+		}
+		s = s[start:]
+		end := strings.IndexAny(s, " \t\r\n\"'<>()[]{}\\")
+		if end < 0 {
+			end = len(s)
+		}
+		l = append(l, strings.TrimRight(s[:end], ".,;:!?"))
+		s = s[end:]
+	}
+	return l
+}
+
+// LinkHost returns the lower-cased host name or IP address of an http or https
+// link, without trailing dot. An empty string is returned for other schemes and
+// links that cannot be parsed.
+func LinkHost(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
@@ -0,0 +1,32 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	check := func(s string, expLinks, expHosts []string) {
+		t.Helper()
+
+		links := Links(s)
+		tcompare(t, links, expLinks)
+		var hosts []string
+		for _, link := range links {
+			hosts = append(hosts, LinkHost(link))
+		}
+		tcompare(t, hosts, expHosts)
+	}
+
+	check("no links here", nil, nil)
+	check("httpx://a.example http:/b.example", nil, nil)
+	check("see https://www.Example.com/path?x=1.", []string{"https://www.Example.com/path?x=1"}, []string{"www.example.com"})
+	check(`<a href="HTTP://host.example./">x</a> (http://other.example:8080/a), done`, []string{"HTTP://host.example./", "http://other.example:8080/a"}, []string{"host.example", "other.example"})
+	check("http://1.2.3.4/x\\y", []string{"http://1.2.3.4/x"}, []string{"1.2.3.4"})
+	check("ftp://files.example https://ok.example!", []string{"https://ok.example"}, []string{"ok.example"})
+
+	// Runes that change length when lower-cased must not affect offsets.
+	check(strings.Repeat("Ⱥ", 30), nil, nil)
+	check(strings.Repeat("Ⱥ", 20)+" http://example.com/x", []string{"http://example.com/x"}, []string{"example.com"})
+	check("ȺȺHTTPS://Ⱥ.example/ȺȺ", []string{"HTTPS://Ⱥ.example/ȺȺ"}, []string{"ⱥ.example"})
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/qompassai/beacon/dmarc"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/dnsbl"
+	"github.com/qompassai/beacon/dnssec"
 	"github.com/qompassai/beacon/iprev"
 	"github.com/qompassai/beacon/metrics"
 	"github.com/qompassai/beacon/mlog"
@@ -150,6 +151,36 @@ func init() {
 		},
 	)}
 
+	dnssec.MetricExchange = histogramVec{promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "beacon_dnssec_exchange_duration_seconds",
+			Help:    "DNS requests to upstream resolvers over DNS-over-TLS or DNS-over-HTTPS.",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.100, 0.5, 1, 5, 10, 20},
+		},
+		[]string{
+			"transport", // tls, https
+			"result",    // ok, error
+		},
+	)}
+	dnssec.MetricCache = counterVec{promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "beacon_dnssec_cache_total",
+			Help: "DNS lookups in the cache of the resolver with DNSSEC verification, including lookups for verifying signatures.",
+		},
+		[]string{
+			"result", // hit, miss
+		},
+	)}
+	dnssec.MetricValidation = counterVec{promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "beacon_dnssec_validation_total",
+			Help: "DNSSEC verification results of responses from upstream resolvers.",
+		},
+		[]string{
+			"result", // secure, insecure, bogus
+		},
+	)}
+
 	iprev.MetricIPRev = histogramVec{promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "beacon_iprev_lookup_total",
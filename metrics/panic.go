@@ -28,11 +28,16 @@ const (
 	Smtpclient       Panic = "smtpclient"
 	Smtpserver       Panic = "smtpserver"
 	Tlsrptdb         Panic = "tlsrptdb"
+	Dkimrotate       Panic = "dkimrotate"
+	Quarantine       Panic = "quarantine"
+	Dnsblserver      Panic = "dnsblserver"
 	Dkimverify       Panic = "dkimverify"
 	Spfverify        Panic = "spfverify"
+	Arcverify        Panic = "arcverify"
 	Upgradethreads   Panic = "upgradethreads"
 	Importmanage     Panic = "importmanage"
 	Importmessages   Panic = "importmessages"
+	Junkretrain      Panic = "junkretrain"
 	Store            Panic = "store"
 	Webadmin         Panic = "webadmin"
 	Webmailsendevent Panic = "webmailsendevent"
@@ -56,9 +61,12 @@ func init() {
 		Smtpserver,
 		Dkimverify,
 		Spfverify,
+		Arcverify,
 		Upgradethreads,
 		Importmanage,
 		Importmessages,
+		Junkretrain,
+		Dnsblserver,
 		Webadmin,
 		Webmailsendevent,
 		Webmail,
@@ -0,0 +1,229 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/beaconvar"
+	"github.com/qompassai/beacon/smtp"
+	"github.com/qompassai/beacon/store"
+)
+
+// accountURL returns the URL of the account web interface for links in digests,
+// or an empty string if not known.
+func accountURL() string {
+	conf := beacon.Conf.Static.Quarantine
+	if conf.AccountURL != "" {
+		return conf.AccountURL
+	}
+
+	var names []string
+	for name := range beacon.Conf.Static.Listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := beacon.Conf.Static.Listeners[name]
+		if !l.AccountHTTPS.Enabled {
+			continue
+		}
+		host := beacon.Conf.Static.HostnameDomain
+		if !l.HostnameDomain.IsZero() {
+			host = l.HostnameDomain
+		}
+		u := url.URL{Scheme: "https", Host: host.ASCII, Path: l.AccountHTTPS.Path}
+		if l.AccountHTTPS.Port != 0 && l.AccountHTTPS.Port != 443 {
+			u.Host += fmt.Sprintf(":%d", l.AccountHTTPS.Port)
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		return u.String()
+	}
+	return ""
+}
+
+// sendDigests delivers a digest to each account with messages that were
+// quarantined since the previous digest, if the digest interval has passed.
+func sendDigests(ctx context.Context, log mlog.Log) error {
+	conf := beacon.Conf.Static.Quarantine
+	if conf.NoDigests {
+		return nil
+	}
+	interval := conf.DigestInterval
+	if interval == 0 {
+		interval = DefaultDigestInterval
+	}
+
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+
+	q := bstore.QueryDB[Message](ctx, db)
+	q.FilterEqual("DigestSent", false)
+	q.SortAsc("Received")
+	msgs, err := q.List()
+	if err != nil {
+		return fmt.Errorf("listing messages for digests: %v", err)
+	}
+	accountMsgs := map[string][]Message{}
+	for _, m := range msgs {
+		accountMsgs[m.Account] = append(accountMsgs[m.Account], m)
+	}
+
+	now := timeNow()
+	for accName, l := range accountMsgs {
+		d := Digest{Account: accName}
+		if err := db.Get(ctx, &d); err != nil && err != bstore.ErrAbsent {
+			return fmt.Errorf("get digest: %v", err)
+		} else if err == nil && now.Sub(d.Sent) < interval {
+			continue
+		}
+
+		if err := sendDigest(ctx, log, accName, l); err != nil {
+			log.Errorx("sending quarantine digest", err, slog.String("account", accName))
+			continue
+		}
+
+		err := db.Write(ctx, func(tx *bstore.Tx) error {
+			for _, m := range l {
+				m.DigestSent = true
+				if err := tx.Update(&m); err != nil && !errors.Is(err, bstore.ErrAbsent) {
+					return fmt.Errorf("marking message as sent in digest: %v", err)
+				}
+			}
+			d.Sent = now
+			if err := tx.Get(&Digest{Account: accName}); err == bstore.ErrAbsent {
+				return tx.Insert(&d)
+			}
+			return tx.Update(&d)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDigest composes a digest message listing msgs, and delivers it to the
+// Inbox of the account.
+func sendDigest(ctx context.Context, log mlog.Log, accName string, msgs []Message) (rerr error) {
+	log = log.With(slog.String("account", accName))
+
+	var rcpts []message.NameAddress
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		if seen[m.RcptTo] {
+			continue
+		}
+		seen[m.RcptTo] = true
+		addr, err := smtp.ParseAddress(m.RcptTo)
+		if err != nil {
+			continue
+		}
+		rcpts = append(rcpts, message.NameAddress{Address: addr})
+	}
+
+	baseURL := accountURL()
+	var text strings.Builder
+	fmt.Fprintf(&text, `Incoming messages for you have been quarantined because they may be spam or
+otherwise harmful. They have not been delivered to your mailbox. Quarantined
+messages are removed automatically after %d days.
+
+If you recognize a message as legitimate, you can release it to your mailbox
+through your account web interface.
+
+`, int(retention()/(24*time.Hour)))
+	for _, m := range msgs {
+		fmt.Fprintf(&text, "Received: %s\n", m.Received.Format(message.RFC5322Z))
+		fmt.Fprintf(&text, "From: %s\n", m.MsgFrom)
+		fmt.Fprintf(&text, "To: %s\n", m.RcptTo)
+		fmt.Fprintf(&text, "Subject: %s\n", m.Subject)
+		fmt.Fprintf(&text, "Reason: %s\n", m.Reason)
+		if baseURL != "" {
+			fmt.Fprintf(&text, "Release: %s#quarantine/%d\n", baseURL, m.ID)
+		}
+		text.WriteString("\n")
+	}
+
+	msgf, err := store.CreateMessageTemp(log, "quarantinedigest")
+	if err != nil {
+		return fmt.Errorf("creating temporary message file: %v", err)
+	}
+	defer store.CloseRemoveTempFile(log, msgf, "message with quarantine digest")
+
+	xc := message.NewComposer(msgf, 100*1024*1024)
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		if err, ok := x.(error); ok && errors.Is(err, message.ErrCompose) {
+			rerr = err
+			return
+		}
+		panic(x)
+	}()
+
+	for _, a := range rcpts {
+		if a.Address.Localpart.IsInternational() {
+			xc.SMTPUTF8 = true
+			break
+		}
+	}
+
+	from := smtp.Address{Localpart: "postmaster", Domain: beacon.Conf.Static.HostnameDomain}
+	xc.HeaderAddrs("From", []message.NameAddress{{Address: from}})
+	xc.HeaderAddrs("To", rcpts)
+	xc.Subject(fmt.Sprintf("Quarantined messages: %d new", len(msgs)))
+	xc.Header("Message-Id", fmt.Sprintf("<%s>", beacon.MessageIDGen(xc.SMTPUTF8)))
+	xc.Header("Date", timeNow().Format(message.RFC5322Z))
+	xc.Header("User-Agent", "beacon/"+beaconvar.Version)
+	xc.Header("MIME-Version", "1.0")
+	textBody, ct, cte := xc.TextPart(text.String())
+	xc.Header("Content-Type", ct)
+	xc.Header("Content-Transfer-Encoding", cte)
+	xc.Line()
+	xc.Write(textBody)
+	xc.Flush()
+
+	fi, err := msgf.Stat()
+	if err != nil {
+		return fmt.Errorf("stat digest message: %v", err)
+	}
+
+	acc, err := store.OpenAccount(log, accName)
+	if err != nil {
+		return fmt.Errorf("open account: %v", err)
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	m := store.Message{
+		Received: timeNow(),
+		Size:     fi.Size(),
+	}
+	acc.WithWLock(func() {
+		err = acc.DeliverMailbox(log, "Inbox", &m, msgf)
+	})
+	if err != nil {
+		return fmt.Errorf("delivering digest: %v", err)
+	}
+	log.Info("quarantine digest delivered", slog.Int("messages", len(msgs)))
+	return nil
+}
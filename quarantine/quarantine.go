@@ -0,0 +1,667 @@
+// Package quarantine implements a central quarantine for suspicious incoming
+// messages.
+//
+// Messages are quarantined for a reason:
+//
+//   - dnsbl and junk: Messages rejected during the SMTP transaction because the
+//     remote IP is on a DNS blocklist or because the junk filter classified the
+//     message as spam. The quarantine holds these instead of the Rejects mailbox of
+//     the account.
+//   - contentscan: Messages quarantined by a content scanner. They are accepted in
+//     the SMTP transaction, but not delivered.
+//   - hold: Messages matching a configured hold rule. They are accepted, but not
+//     delivered.
+//
+// Quarantined messages are held for a configurable retention period. They can be
+// released, delivering them to the recipient's account, optionally training the
+// junk filter with the message as non-junk. Accounts periodically get a digest
+// message listing their newly quarantined messages.
+//
+// Messages are stored in the "quarantine" directory in the data directory, with
+// an index database.
+package quarantine
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/beaconio"
+	"github.com/qompassai/beacon/smtp"
+	"github.com/qompassai/beacon/store"
+)
+
+var pkglog = mlog.New("quarantine", nil)
+
+var (
+	metricQuarantined = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "beacon_quarantine_added_total",
+			Help: "Number of messages added to the quarantine, by reason.",
+		},
+		[]string{"reason"},
+	)
+	metricReleased = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "beacon_quarantine_released_total",
+			Help: "Number of messages released from the quarantine.",
+		},
+	)
+)
+
+var timeNow = time.Now // Tests override this.
+
+const (
+	DefaultRetention      = 30 * 24 * time.Hour
+	DefaultDigestInterval = 24 * time.Hour
+)
+
+var ErrNotFound = errors.New("message not found in quarantine")
+
+// Reason a message was quarantined.
+type Reason string
+
+const (
+	ReasonDNSBL       Reason = "dnsbl"       // Remote IP is on a DNS blocklist, message was rejected.
+	ReasonJunk        Reason = "junk"        // Junk filter classified message as spam, message was rejected.
+	ReasonContentScan Reason = "contentscan" // Content scanner quarantined the message.
+	ReasonHold        Reason = "hold"        // Message matched a hold rule.
+)
+
+// Message is a message held in the quarantine.
+type Message struct {
+	ID       int64
+	Received time.Time `bstore:"default now,index"`
+	Reason   Reason    `bstore:"nonzero,index"`
+	Detail   string    // More specific reason, e.g. from the junk analysis or the content scanner.
+
+	Account     string `bstore:"nonzero,index Account+Received"`
+	RcptTo      string `bstore:"nonzero"`
+	MailFrom    string // SMTP MAIL FROM, empty for the null sender.
+	MsgFrom     string // Address in message From header, can be empty.
+	Subject     string
+	MessageID   string // Canonical Message-Id, without <>. Can be empty.
+	MessageHash []byte `json:"-"` // SHA-256 of the message file without MsgPrefix, for recognizing messages without Message-Id.
+	Size        int64  // Including MsgPrefix.
+	MsgPrefix   []byte `json:"-"` // Headers added during delivery, prepended to the message file.
+
+	DigestSent bool // Whether the message was listed in a digest to the account.
+
+	// Fields of the store.Message, with the reputation-related fields used by the
+	// junk filter, restored when the message is released.
+	RemoteIP           string           `json:"-"`
+	RemoteIPMasked1    string           `json:"-"`
+	RemoteIPMasked2    string           `json:"-"`
+	RemoteIPMasked3    string           `json:"-"`
+	EHLODomain         string           `json:"-"`
+	MailFromLocalpart  smtp.Localpart   `json:"-"`
+	MailFromDomain     string           `json:"-"`
+	RcptToLocalpart    smtp.Localpart   `json:"-"`
+	RcptToDomain       string           `json:"-"`
+	MsgFromLocalpart   smtp.Localpart   `json:"-"`
+	MsgFromDomain      string           `json:"-"`
+	MsgFromOrgDomain   string           `json:"-"`
+	EHLOValidated      bool             `json:"-"`
+	MailFromValidated  bool             `json:"-"`
+	MsgFromValidated   bool             `json:"-"`
+	EHLOValidation     store.Validation `json:"-"`
+	MailFromValidation store.Validation `json:"-"`
+	MsgFromValidation  store.Validation `json:"-"`
+	DKIMDomains        []string         `json:"-"`
+	OrigEHLODomain     string           `json:"-"`
+	OrigDKIMDomains    []string         `json:"-"`
+	IsForward          bool             `json:"-"`
+}
+
+// MessagePath returns the path of the message file.
+func (m Message) MessagePath() string {
+	return beacon.DataDirPath(filepath.Join("quarantine", store.MessagePath(m.ID)))
+}
+
+// storeMessage returns a store.Message for delivery of a released message.
+func (m Message) storeMessage() store.Message {
+	return store.Message{
+		Received:           m.Received,
+		RemoteIP:           m.RemoteIP,
+		RemoteIPMasked1:    m.RemoteIPMasked1,
+		RemoteIPMasked2:    m.RemoteIPMasked2,
+		RemoteIPMasked3:    m.RemoteIPMasked3,
+		EHLODomain:         m.EHLODomain,
+		MailFrom:           m.MailFrom,
+		MailFromLocalpart:  m.MailFromLocalpart,
+		MailFromDomain:     m.MailFromDomain,
+		RcptToLocalpart:    m.RcptToLocalpart,
+		RcptToDomain:       m.RcptToDomain,
+		MsgFromLocalpart:   m.MsgFromLocalpart,
+		MsgFromDomain:      m.MsgFromDomain,
+		MsgFromOrgDomain:   m.MsgFromOrgDomain,
+		EHLOValidated:      m.EHLOValidated,
+		MailFromValidated:  m.MailFromValidated,
+		MsgFromValidated:   m.MsgFromValidated,
+		EHLOValidation:     m.EHLOValidation,
+		MailFromValidation: m.MailFromValidation,
+		MsgFromValidation:  m.MsgFromValidation,
+		DKIMDomains:        m.DKIMDomains,
+		OrigEHLODomain:     m.OrigEHLODomain,
+		OrigDKIMDomains:    m.OrigDKIMDomains,
+		IsForward:          m.IsForward,
+		MsgPrefix:          m.MsgPrefix,
+		Size:               m.Size,
+	}
+}
+
+// Digest is the time of the last digest sent to an account.
+type Digest struct {
+	Account string
+	Sent    time.Time
+}
+
+var DBTypes = []any{Message{}, Digest{}} // Types stored in DB.
+var DB *bstore.DB                        // Exported for backups.
+var mutex sync.Mutex
+
+// Release and Delete are serialized, so a message is not released twice.
+var opMutex sync.Mutex
+
+func database(ctx context.Context) (rdb *bstore.DB, rerr error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB == nil {
+		p := beacon.DataDirPath(filepath.FromSlash("quarantine/index.db"))
+		os.MkdirAll(filepath.Dir(p), 0770)
+		db, err := bstore.Open(ctx, p, &bstore.Options{Timeout: 5 * time.Second, Perm: 0660}, DBTypes...)
+		if err != nil {
+			return nil, err
+		}
+		DB = db
+	}
+	return DB, nil
+}
+
+// Init opens the database.
+func Init() error {
+	_, err := database(beacon.Shutdown)
+	return err
+}
+
+// Close closes the database.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if DB != nil {
+		err := DB.Close()
+		pkglog.Check(err, "closing database")
+		DB = nil
+	}
+}
+
+// Enabled returns whether messages are quarantined for reason.
+func Enabled(reason Reason) bool {
+	conf := beacon.Conf.Static.Quarantine
+	if conf == nil {
+		return false
+	}
+	if len(conf.Reasons) == 0 {
+		return true
+	}
+	for _, r := range conf.Reasons {
+		if Reason(r) == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldRuleMatch returns whether the message matches a configured hold rule, and
+// is to be held in the quarantine.
+func HoldRuleMatch(log mlog.Log, mailFrom, rcptTo string, msgPrefix []byte, msgFile *os.File) bool {
+	conf := beacon.Conf.Static.Quarantine
+	if !Enabled(ReasonHold) || len(conf.HoldRules) == 0 {
+		return false
+	}
+
+	var header map[string][]string
+	for _, hr := range conf.HoldRules {
+		if len(hr.HeadersRegexpCompiled) > 0 && header == nil {
+			p, err := message.Parse(log.Logger, false, store.FileMsgReader(msgPrefix, msgFile))
+			if err != nil {
+				log.Infox("parsing message for hold rules, continuing with headers", err)
+			}
+			h, err := p.Header()
+			if err != nil {
+				log.Infox("parsing message headers for hold rules, not holding", err)
+				return false
+			}
+			header = h
+		}
+		if holdRuleMatch(hr, mailFrom, rcptTo, header) {
+			return true
+		}
+	}
+	return false
+}
+
+func holdRuleMatch(hr config.QuarantineHoldRule, mailFrom, rcptTo string, header map[string][]string) bool {
+	if hr.SMTPMailFromRegexpCompiled != nil && !hr.SMTPMailFromRegexpCompiled.MatchString(mailFrom) {
+		return false
+	}
+	if hr.RcptToRegexpCompiled != nil && !hr.RcptToRegexpCompiled.MatchString(rcptTo) {
+		return false
+	}
+header:
+	for _, t := range hr.HeadersRegexpCompiled {
+		for k, vl := range header {
+			k = strings.ToLower(k)
+			if !t[0].MatchString(k) {
+				continue
+			}
+			for _, v := range vl {
+				v = strings.ToLower(strings.TrimSpace(v))
+				if t[1].MatchString(v) {
+					continue header
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Add adds a message to the quarantine. The message in msgFile, with m.MsgPrefix
+// and m.Size, is linked or copied into the quarantine. Other fields of m are
+// stored for delivery when the message is released. If the account already has
+// the same message in the quarantine, e.g. due to a retried delivery attempt,
+// the message is not added again.
+func Add(ctx context.Context, log mlog.Log, reason Reason, detail, accountName, rcptTo string, m store.Message, msgFile *os.File) (rerr error) {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+
+	qm := Message{
+		Received:           m.Received,
+		Reason:             reason,
+		Detail:             detail,
+		Account:            accountName,
+		RcptTo:             rcptTo,
+		MailFrom:           m.MailFrom,
+		Size:               m.Size,
+		MsgPrefix:          m.MsgPrefix,
+		RemoteIP:           m.RemoteIP,
+		RemoteIPMasked1:    m.RemoteIPMasked1,
+		RemoteIPMasked2:    m.RemoteIPMasked2,
+		RemoteIPMasked3:    m.RemoteIPMasked3,
+		EHLODomain:         m.EHLODomain,
+		MailFromLocalpart:  m.MailFromLocalpart,
+		MailFromDomain:     m.MailFromDomain,
+		RcptToLocalpart:    m.RcptToLocalpart,
+		RcptToDomain:       m.RcptToDomain,
+		MsgFromLocalpart:   m.MsgFromLocalpart,
+		MsgFromDomain:      m.MsgFromDomain,
+		MsgFromOrgDomain:   m.MsgFromOrgDomain,
+		EHLOValidated:      m.EHLOValidated,
+		MailFromValidated:  m.MailFromValidated,
+		MsgFromValidated:   m.MsgFromValidated,
+		EHLOValidation:     m.EHLOValidation,
+		MailFromValidation: m.MailFromValidation,
+		MsgFromValidation:  m.MsgFromValidation,
+		DKIMDomains:        m.DKIMDomains,
+		OrigEHLODomain:     m.OrigEHLODomain,
+		OrigDKIMDomains:    m.OrigDKIMDomains,
+		IsForward:          m.IsForward,
+	}
+	if qm.Received.IsZero() {
+		qm.Received = timeNow()
+	}
+
+	if p, err := message.Parse(log.Logger, false, store.FileMsgReader(m.MsgPrefix, msgFile)); err != nil {
+		log.Infox("parsing quarantined message", err)
+	} else if p.Envelope != nil {
+		qm.Subject = p.Envelope.Subject
+		if len(p.Envelope.From) > 0 {
+			a := p.Envelope.From[0]
+			qm.MsgFrom = a.User + "@" + a.Host
+		}
+		if msgID, _, err := message.MessageIDCanonical(p.Envelope.MessageID); err == nil {
+			qm.MessageID = msgID
+		}
+	}
+
+	// MsgPrefix differs between delivery attempts, only hash the message file.
+	h := sha256.New()
+	if _, err := io.Copy(h, &beaconio.AtReader{R: msgFile}); err != nil {
+		return fmt.Errorf("hashing message: %v", err)
+	}
+	qm.MessageHash = h.Sum(nil)
+
+	tx, err := db.Begin(ctx, true)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			err := tx.Rollback()
+			log.Check(err, "rollback quarantine transaction")
+		}
+	}()
+
+	q := bstore.QueryTx[Message](tx)
+	q.FilterNonzero(Message{Account: accountName})
+	q.FilterFn(func(o Message) bool {
+		return qm.MessageID != "" && o.MessageID == qm.MessageID || string(o.MessageHash) == string(qm.MessageHash)
+	})
+	if exists, err := q.Exists(); err != nil {
+		return fmt.Errorf("checking for message in quarantine: %v", err)
+	} else if exists {
+		log.Info("message already in quarantine, not adding again", slog.String("account", accountName))
+		return nil
+	}
+
+	if err := tx.Insert(&qm); err != nil {
+		return fmt.Errorf("inserting message: %v", err)
+	}
+
+	dst := qm.MessagePath()
+	defer func() {
+		if dst != "" {
+			err := os.Remove(dst)
+			log.Check(err, "removing quarantine message file", slog.String("path", dst))
+		}
+	}()
+	dstDir := filepath.Dir(dst)
+	os.MkdirAll(dstDir, 0770)
+	if err := beaconio.LinkOrCopy(log, dst, msgFile.Name(), nil, true); err != nil {
+		return fmt.Errorf("linking/copying message to quarantine: %v", err)
+	} else if err := beaconio.SyncDir(log, dstDir); err != nil {
+		return fmt.Errorf("sync directory: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %v", err)
+	}
+	tx = nil
+	dst = ""
+
+	metricQuarantined.WithLabelValues(string(reason)).Inc()
+	log.Info("message added to quarantine", slog.Int64("id", qm.ID), slog.Any("reason", reason), slog.String("account", accountName), slog.String("rcptto", rcptTo))
+	return nil
+}
+
+// Filter selects messages in the quarantine. Zero fields are ignored.
+type Filter struct {
+	Account string
+	Reason  Reason
+	Search  string // Case-insensitive substring of MAIL FROM, message From, RCPT TO or subject.
+	Limit   int
+}
+
+// List returns messages in the quarantine matching filter, most recent first.
+func List(ctx context.Context, f Filter) ([]Message, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := bstore.QueryDB[Message](ctx, db)
+	if f.Account != "" || f.Reason != "" {
+		q.FilterNonzero(Message{Account: f.Account, Reason: f.Reason})
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		q.FilterFn(func(m Message) bool {
+			for _, s := range []string{m.MailFrom, m.MsgFrom, m.RcptTo, m.Subject} {
+				if strings.Contains(strings.ToLower(s), search) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	q.SortDesc("Received")
+	if f.Limit > 0 {
+		q.Limit(f.Limit)
+	}
+	return q.List()
+}
+
+// Get returns a message from the quarantine. If accountName is not empty, the
+// message must belong to that account.
+func Get(ctx context.Context, accountName string, id int64) (Message, error) {
+	db, err := database(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	m := Message{ID: id}
+	err = db.Get(ctx, &m)
+	if err == bstore.ErrAbsent || err == nil && accountName != "" && m.Account != accountName {
+		return Message{}, ErrNotFound
+	}
+	return m, err
+}
+
+// Headers returns the header section of a quarantined message, for a preview
+// without exposing the potentially harmful message body.
+func Headers(ctx context.Context, accountName string, id int64) (string, error) {
+	m, err := Get(ctx, accountName, id)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(m.MessagePath())
+	if err != nil {
+		return "", fmt.Errorf("open message file: %v", err)
+	}
+	defer f.Close()
+	buf, err := message.ReadHeaders(bufio.NewReader(store.FileMsgReader(m.MsgPrefix, f)))
+	if err != nil && errors.Is(err, message.ErrHeaderSeparator) {
+		// Whole message is a header, return all of it.
+		buf, err = io.ReadAll(store.FileMsgReader(m.MsgPrefix, f))
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading message headers: %v", err)
+	}
+	return string(buf), nil
+}
+
+// Release delivers a quarantined message to the account of the recipient, based
+// on the rulesets of its destination address, and removes it from the quarantine. If
+// train is set, the message is marked as non-junk and the junk filter of the
+// account is trained with it. If accountName is not empty, the message must
+// belong to that account.
+func Release(ctx context.Context, log mlog.Log, accountName string, id int64, train bool) error {
+	opMutex.Lock()
+	defer opMutex.Unlock()
+
+	qm, err := Get(ctx, accountName, id)
+	if err != nil {
+		return err
+	}
+
+	acc, err := store.OpenAccount(log, qm.Account)
+	if err != nil {
+		return fmt.Errorf("open account: %v", err)
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	f, err := os.Open(qm.MessagePath())
+	if err != nil {
+		return fmt.Errorf("open message file: %v", err)
+	}
+	defer f.Close()
+
+	// Use the rulesets of the destination the message was addressed to. If the
+	// address no longer belongs to the account, the message is delivered to the
+	// Inbox.
+	var dest config.Destination
+	if addr, err := smtp.ParseAddress(qm.RcptTo); err == nil {
+		if accName, _, d, err := beacon.FindAccount(addr.Localpart, addr.Domain, true); err == nil && accName == qm.Account {
+			dest = d
+		}
+	}
+	m := qm.storeMessage()
+	if train {
+		m.Notjunk = true
+	}
+	acc.WithWLock(func() {
+		err = acc.DeliverDestination(log, dest, &m, f)
+	})
+	if err != nil {
+		return fmt.Errorf("delivering released message: %w", err)
+	}
+
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	if err := db.Delete(ctx, &qm); err != nil {
+		return fmt.Errorf("removing released message from quarantine: %v", err)
+	}
+	p := qm.MessagePath()
+	err = os.Remove(p)
+	log.Check(err, "removing released message file", slog.String("path", p))
+
+	metricReleased.Inc()
+	log.Info("message released from quarantine", slog.Int64("id", id), slog.String("account", qm.Account), slog.Bool("train", train))
+	return nil
+}
+
+// Delete removes a message from the quarantine. If accountName is not empty, the
+// message must belong to that account.
+func Delete(ctx context.Context, log mlog.Log, accountName string, id int64) error {
+	opMutex.Lock()
+	defer opMutex.Unlock()
+
+	m, err := Get(ctx, accountName, id)
+	if err != nil {
+		return err
+	}
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	if err := db.Delete(ctx, &m); err != nil {
+		return fmt.Errorf("removing message from quarantine: %v", err)
+	}
+	p := m.MessagePath()
+	err = os.Remove(p)
+	log.Check(err, "removing quarantine message file", slog.String("path", p))
+	log.Info("message removed from quarantine", slog.Int64("id", id), slog.String("account", m.Account))
+	return nil
+}
+
+// RemoveDelivered removes messages with messageID for the account from the
+// quarantine, typically after a later delivery attempt of the same message
+// succeeded.
+func RemoveDelivered(ctx context.Context, log mlog.Log, accountName, messageID string) error {
+	if messageID == "" {
+		return nil
+	}
+	msgID, _, err := message.MessageIDCanonical(messageID)
+	if err != nil {
+		return nil
+	}
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	q := bstore.QueryDB[Message](ctx, db)
+	q.FilterNonzero(Message{Account: accountName, MessageID: msgID})
+	return remove(ctx, log, q)
+}
+
+// remove deletes the messages selected by q, and their files.
+func remove(ctx context.Context, log mlog.Log, q *bstore.Query[Message]) error {
+	opMutex.Lock()
+	defer opMutex.Unlock()
+
+	var removed []Message
+	q.Gather(&removed)
+	if _, err := q.Delete(); err != nil {
+		return fmt.Errorf("removing messages from quarantine: %v", err)
+	}
+	for _, m := range removed {
+		p := m.MessagePath()
+		err := os.Remove(p)
+		log.Check(err, "removing quarantine message file", slog.String("path", p))
+	}
+	if len(removed) > 0 {
+		log.Debug("messages removed from quarantine", slog.Int("count", len(removed)))
+	}
+	return nil
+}
+
+// Start launches a goroutine that periodically removes messages after their
+// retention period and sends digests to accounts.
+func Start() {
+	go func() {
+		log := pkglog
+
+		defer func() {
+			// In case of panic don't take the whole program down.
+			x := recover()
+			if x != nil {
+				log.Error("recover from panic", slog.Any("panic", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Quarantine)
+			}
+		}()
+
+		timer := time.NewTimer(time.Minute)
+		defer timer.Stop()
+		for {
+			select {
+			case <-beacon.Shutdown.Done():
+				return
+			case <-timer.C:
+			}
+
+			if beacon.Conf.Static.Quarantine != nil {
+				err := expire(beacon.Shutdown, log)
+				log.Check(err, "removing expired messages from quarantine")
+				err = sendDigests(beacon.Shutdown, log)
+				log.Check(err, "sending quarantine digests")
+			}
+			timer.Reset(time.Hour)
+		}
+	}()
+}
+
+func retention() time.Duration {
+	if conf := beacon.Conf.Static.Quarantine; conf != nil && conf.Retention > 0 {
+		return conf.Retention
+	}
+	return DefaultRetention
+}
+
+// expire removes messages older than the retention period.
+func expire(ctx context.Context, log mlog.Log) error {
+	db, err := database(ctx)
+	if err != nil {
+		return err
+	}
+	q := bstore.QueryDB[Message](ctx, db)
+	q.FilterLess("Received", timeNow().Add(-retention()))
+	return remove(ctx, log, q)
+}
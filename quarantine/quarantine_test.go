@@ -0,0 +1,156 @@
+package quarantine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/store"
+)
+
+var ctxbg = context.Background()
+
+func tcheck(t *testing.T, err error, msg string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	os.RemoveAll("../testdata/quarantine/data")
+	defer os.RemoveAll("../testdata/quarantine/data")
+	beacon.Shutdown = ctxbg
+	beacon.Context = ctxbg
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/quarantine/beacon.conf")
+	beacon.ConfigDynamicPath = filepath.FromSlash("../testdata/quarantine/domains.conf")
+	beacon.MustLoadConfig(true, false)
+
+	err := Init()
+	tcheck(t, err, "init")
+	defer Close()
+
+	log := mlog.New("quarantine", nil)
+
+	acc, err := store.OpenAccount(log, "mjl")
+	tcheck(t, err, "open account")
+	defer func() {
+		err := acc.Close()
+		tcheck(t, err, "close account")
+	}()
+	switchStop := store.Switchboard()
+	defer switchStop()
+
+	now := time.Now().Round(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	msgFile := func(subject string) *os.File {
+		t.Helper()
+		f, err := store.CreateMessageTemp(log, "quarantinetest")
+		tcheck(t, err, "create temp file")
+		_, err = f.Write([]byte(strings.ReplaceAll("From: <remote@example.org>\nTo: <mjl@beacon.example>\nSubject: "+subject+"\nMessage-Id: <"+strings.ReplaceAll(subject, " ", ".")+"@example.org>\n\nbody\n", "\n", "\r\n")))
+		tcheck(t, err, "write message")
+		return f
+	}
+
+	add := func(reason Reason, rcptTo, subject string) {
+		t.Helper()
+		f := msgFile(subject)
+		defer store.CloseRemoveTempFile(log, f, "test message")
+		fi, err := f.Stat()
+		tcheck(t, err, "stat")
+		prefix := []byte("X-Test: 1\r\n")
+		m := store.Message{Received: now, MailFrom: "remote@example.org", MsgPrefix: prefix, Size: int64(len(prefix)) + fi.Size()}
+		err = Add(ctxbg, log, reason, "test", "mjl", rcptTo, m, f)
+		tcheck(t, err, "add")
+	}
+
+	add(ReasonJunk, "mjl@beacon.example", "cheap pills")
+	add(ReasonHold, "hold@beacon.example", "your invoice")
+	// Retried delivery is not added again.
+	add(ReasonJunk, "mjl@beacon.example", "cheap pills")
+
+	l, err := List(ctxbg, Filter{})
+	tcheck(t, err, "list")
+	tcompare(t, len(l), 2)
+	l, err = List(ctxbg, Filter{Search: "PILLS"})
+	tcheck(t, err, "list")
+	tcompare(t, len(l), 1)
+	tcompare(t, l[0].Subject, "cheap pills")
+	tcompare(t, l[0].MsgFrom, "remote@example.org")
+	tcompare(t, l[0].MessageID, "cheap.pills@example.org")
+	l, err = List(ctxbg, Filter{Reason: ReasonHold})
+	tcheck(t, err, "list")
+	tcompare(t, len(l), 1)
+
+	// Hold rules.
+	f := msgFile("your invoice")
+	tcompare(t, HoldRuleMatch(log, "remote@example.org", "hold@beacon.example", nil, f), true)
+	tcompare(t, HoldRuleMatch(log, "remote@example.org", "mjl@beacon.example", nil, f), false)
+	store.CloseRemoveTempFile(log, f, "test message")
+	f = msgFile("hello")
+	tcompare(t, HoldRuleMatch(log, "remote@example.org", "hold@beacon.example", nil, f), false)
+	store.CloseRemoveTempFile(log, f, "test message")
+
+	// Digest is delivered to the account, and not again within the interval.
+	countInbox := func() int {
+		t.Helper()
+		n, err := bstore.QueryDB[store.Message](ctxbg, acc.DB).Count()
+		tcheck(t, err, "count messages")
+		return n
+	}
+	err = sendDigests(ctxbg, log)
+	tcheck(t, err, "send digests")
+	tcompare(t, countInbox(), 1)
+	m, err := bstore.QueryDB[store.Message](ctxbg, acc.DB).Get()
+	tcheck(t, err, "get digest message")
+	buf, err := os.ReadFile(acc.MessagePath(m.ID))
+	tcheck(t, err, "read digest")
+	if !strings.Contains(string(buf), "Subject: Quarantined messages: 2 new") || !strings.Contains(string(buf), "https://mail.beacon.example/account/#quarantine/") {
+		t.Fatalf("unexpected digest %q", buf)
+	}
+
+	add(ReasonDNSBL, "mjl@beacon.example", "another")
+	err = sendDigests(ctxbg, log)
+	tcheck(t, err, "send digests")
+	tcompare(t, countInbox(), 1)
+
+	now = now.Add(DefaultDigestInterval)
+	err = sendDigests(ctxbg, log)
+	tcheck(t, err, "send digests")
+	tcompare(t, countInbox(), 2)
+
+	// Messages are removed after the retention period.
+	qm, err := Get(ctxbg, "", l[0].ID)
+	tcheck(t, err, "get")
+	_, err = os.Stat(qm.MessagePath())
+	tcheck(t, err, "stat message file")
+	add(ReasonJunk, "mjl@beacon.example", "recent")
+	now = now.Add(DefaultRetention - time.Minute)
+	err = expire(ctxbg, log)
+	tcheck(t, err, "expire")
+	l, err = List(ctxbg, Filter{})
+	tcheck(t, err, "list")
+	tcompare(t, len(l), 1)
+	tcompare(t, l[0].Subject, "recent")
+	_, err = os.Stat(qm.MessagePath())
+	if !os.IsNotExist(err) {
+		t.Fatalf("got err %v for expired message file, expected not exist", err)
+	}
+}
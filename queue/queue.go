@@ -5,6 +5,7 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -221,7 +222,9 @@ func MakeMsg(senderAccount string, sender, recipient smtp.Path, has8bit, smtputf
 // ID must be 0 and will be set after inserting in the queue.
 //
 // Add sets derived fields like RecipientDomainStr, and fields related to queueing,
-// such as Queued, NextAttempt, LastAttempt, LastError.
+// such as Queued, NextAttempt, LastAttempt, LastError. If NextAttempt is in the
+// future, the first delivery attempt is delayed until then, e.g. to allow undoing
+// a submission with DropUnstarted.
 func Add(ctx context.Context, log mlog.Log, qm *Msg, msgFile *os.File) error {
 	// todo: Add should accept multiple rcptTo if they are for the same domain. so we can queue them for delivery in one (or just a few) session(s), transferring the data only once. ../rfc/5321:3759
 
@@ -230,7 +233,9 @@ func Add(ctx context.Context, log mlog.Log, qm *Msg, msgFile *os.File) error {
 	}
 	qm.Queued = time.Now()
 	qm.DialedIPs = nil
-	qm.NextAttempt = qm.Queued
+	if qm.NextAttempt.Before(qm.Queued) {
+		qm.NextAttempt = qm.Queued
+	}
 	qm.LastAttempt = nil
 	qm.LastError = ""
 	qm.RecipientDomainStr = formatIPDomain(qm.RecipientDomain)
@@ -388,6 +393,49 @@ func Drop(ctx context.Context, log mlog.Log, ID int64, toDomain string, recipien
 	return n, nil
 }
 
+// ErrDeliveryStarted is returned by DropUnstarted if delivery of a message has
+// already started.
+var ErrDeliveryStarted = errors.New("delivery has started")
+
+// DropUnstarted removes the messages with the IDs from the queue, but only if
+// delivery has not started for any of them, i.e. their first delivery attempt is
+// still in the future. Otherwise no message is removed and ErrDeliveryStarted is
+// returned. Used for undoing a submission made with a send delay.
+func DropUnstarted(ctx context.Context, log mlog.Log, ids []int64) error {
+	var msgs []Msg
+	err := DB.Write(ctx, func(tx *bstore.Tx) error {
+		// The queue only starts delivery of messages with a NextAttempt in the past.
+		now := time.Now()
+		for _, id := range ids {
+			qm := Msg{ID: id}
+			if err := tx.Get(&qm); err == bstore.ErrAbsent {
+				// Already delivered or failed.
+				return ErrDeliveryStarted
+			} else if err != nil {
+				return fmt.Errorf("get message: %w", err)
+			}
+			if qm.Attempts > 0 || !now.Before(qm.NextAttempt) {
+				return ErrDeliveryStarted
+			}
+			if err := tx.Delete(&qm); err != nil {
+				return fmt.Errorf("removing message from queue: %w", err)
+			}
+			msgs = append(msgs, qm)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		p := m.MessagePath()
+		if err := os.Remove(p); err != nil {
+			log.Errorx("removing queue message from file system", err, slog.Int64("queuemsgid", m.ID), slog.String("path", p))
+		}
+	}
+	return nil
+}
+
 // SaveRequireTLS updates the RequireTLS field of the message with id.
 func SaveRequireTLS(ctx context.Context, id int64, requireTLS *bool) error {
 	return DB.Write(ctx, func(tx *bstore.Tx) error {
@@ -8,6 +8,7 @@ import (
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -143,6 +144,21 @@ func TestQueue(t *testing.T) {
 		t.Fatalf("dropped message not removed from file system")
 	}
 
+	// A message with a delayed first attempt can be removed until delivery starts.
+	qm = MakeMsg("mjl", path, path, false, false, int64(len(testmsg)), "<test@localhost>", nil, nil)
+	qm.NextAttempt = time.Now().Add(time.Minute)
+	err = Add(ctxbg, pkglog, &qm, mf)
+	tcheck(t, err, "add delayed message to queue")
+	err = DropUnstarted(ctxbg, pkglog, []int64{qm.ID})
+	tcheck(t, err, "drop unstarted message")
+	if _, err := os.Stat(qm.MessagePath()); err == nil || !os.IsNotExist(err) {
+		t.Fatalf("dropped message not removed from file system")
+	}
+	err = DropUnstarted(ctxbg, pkglog, []int64{msg.ID})
+	if !errors.Is(err, ErrDeliveryStarted) {
+		t.Fatalf("drop unstarted for message due for delivery, got err %v, expected ErrDeliveryStarted", err)
+	}
+
 	next := nextWork(ctxbg, pkglog, nil)
 	if next > 0 {
 		t.Fatalf("nextWork in %s, should be now", next)
@@ -159,8 +175,8 @@ func TestQueue(t *testing.T) {
 	mailHost := dns.Domain{ASCII: "mail.beacon.example"}
 	resolver := dns.MockResolver{
 		A: map[string][]string{
-			"mail.beacon.example.":   {"127.0.0.1"},
-			"submission.example.": {"127.0.0.1"},
+			"mail.beacon.example.": {"127.0.0.1"},
+			"submission.example.":  {"127.0.0.1"},
 		},
 		MX: map[string][]*net.MX{"beacon.example.": {{Host: "mail.beacon.example", Pref: 10}}},
 	}
@@ -144,3 +144,58 @@ func (l *Limiter) maskIP(i int, ip net.IP) [16]byte {
 	}
 	return *(*[16]byte)(ipmasked.To16())
 }
+
+// Blocked returns the IPs and subnets for which the limit has been reached in any
+// of the current windows, e.g. for showing in an admin interface.
+func (l *Limiter) Blocked(tm time.Time) []net.IPNet {
+	l.Lock()
+	defer l.Unlock()
+
+	var r []net.IPNet
+	seen := map[struct {
+		Index    uint8
+		IPMasked [16]byte
+	}]bool{}
+	for _, pl := range l.WindowLimits {
+		t := uint32(tm.UnixNano() / int64(pl.Window))
+		if t != pl.Time || pl.Counts == nil {
+			continue
+		}
+		for k, v := range pl.Counts {
+			if v < pl.Limits[k.Index] || seen[k] {
+				continue
+			}
+			seen[k] = true
+			r = append(r, maskedNet(k.Index, k.IPMasked))
+		}
+	}
+	return r
+}
+
+// Unblock clears the counts for the IP or subnet, as returned by Blocked, in all
+// windows.
+func (l *Limiter) Unblock(ipnet net.IPNet) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, pl := range l.WindowLimits {
+		for k := range pl.Counts {
+			n := maskedNet(k.Index, k.IPMasked)
+			if n.IP.Equal(ipnet.IP) && n.Mask.String() == ipnet.Mask.String() {
+				delete(pl.Counts, k)
+			}
+		}
+	}
+}
+
+// maskedNet returns the subnet for a masked IP of class i, with the mask from
+// maskIP.
+func maskedNet(i uint8, ipmasked [16]byte) net.IPNet {
+	ip := net.IP(ipmasked[:])
+	if ip4 := ip.To4(); ip4 != nil {
+		ones := [...]int{32, 26, 21}[i]
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(ones, 32)}
+	}
+	ones := [...]int{64, 48, 32}[i]
+	return net.IPNet{IP: append(net.IP{}, ip...), Mask: net.CIDRMask(ones, 128)}
+}
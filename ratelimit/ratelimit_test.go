@@ -70,3 +70,43 @@ func TestLimiter(t *testing.T) {
 	check(true, net.ParseIP("10.0.1.1"), min3, 1)    // ipmasked3 still ok
 	check(false, net.ParseIP("10.0.1.255"), min3, 1) // ipmasked3 also full
 }
+
+func TestLimiterBlocked(t *testing.T) {
+	l := &Limiter{
+		WindowLimits: []WindowLimit{
+			{
+				Window: time.Minute,
+				Limits: [...]int64{2, 4, 6},
+			},
+		},
+	}
+
+	now := time.Now()
+	ip := net.ParseIP("10.0.0.1")
+	l.Add(ip, now, 1)
+	if blocked := l.Blocked(now); len(blocked) != 0 {
+		t.Fatalf("blocked, got %v, expected none", blocked)
+	}
+	l.Add(ip, now, 1)
+	blocked := l.Blocked(now)
+	if len(blocked) != 1 || blocked[0].String() != "10.0.0.1/32" {
+		t.Fatalf("blocked, got %v, expected 10.0.0.1/32", blocked)
+	}
+	if l.CanAdd(ip, now, 1) {
+		t.Fatalf("canadd for blocked ip")
+	}
+
+	l.Unblock(blocked[0])
+	if blocked := l.Blocked(now); len(blocked) != 0 {
+		t.Fatalf("blocked after unblock, got %v, expected none", blocked)
+	}
+	if !l.CanAdd(ip, now, 1) {
+		t.Fatalf("cannot add for unblocked ip")
+	}
+
+	// Blocked only in current window.
+	l.Add(ip, now, 2)
+	if blocked := l.Blocked(now.Add(time.Minute)); len(blocked) != 0 {
+		t.Fatalf("blocked in next window, got %v, expected none", blocked)
+	}
+}
@@ -5,13 +5,18 @@ import (
 	"os"
 	"time"
 
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dmarcdb"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/dnsblserver"
+	"github.com/qompassai/beacon/greylist"
 	"github.com/qompassai/beacon/http"
 	"github.com/qompassai/beacon/imapserver"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
 	"github.com/qompassai/beacon/mtastsdb"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/queue"
 	"github.com/qompassai/beacon/smtpserver"
 	"github.com/qompassai/beacon/store"
@@ -57,6 +62,7 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 	smtpserver.Listen()
 	imapserver.Listen()
 	http.Listen()
+	dnsblserver.Listen()
 
 	if !skipForkExec {
 		// If we were just launched as root, fork and exec as unprivileged user, handing
@@ -78,6 +84,26 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 		return fmt.Errorf("tlsrpt init: %s", err)
 	}
 
+	if err := loginattempt.Init(); err != nil {
+		return fmt.Errorf("loginattempt init: %s", err)
+	}
+
+	if err := greylist.Init(); err != nil {
+		return fmt.Errorf("greylist init: %s", err)
+	}
+
+	if err := dkimrotate.Init(); err != nil {
+		return fmt.Errorf("dkimrotate init: %s", err)
+	}
+
+	if err := quarantine.Init(); err != nil {
+		return fmt.Errorf("quarantine init: %s", err)
+	}
+
+	if err := dnsblserver.Init(); err != nil {
+		return fmt.Errorf("dnsblserver init: %s", err)
+	}
+
 	done := make(chan struct{}, 1)
 	if err := queue.Start(dns.StrictResolver{Pkg: "queue"}, done); err != nil {
 		return fmt.Errorf("queue start: %s", err)
@@ -95,6 +121,10 @@ func start(mtastsdbRefresher, sendDMARCReports, sendTLSReports, skipForkExec boo
 		tlsrptsend.Start(dns.StrictResolver{Pkg: "tlsrptsend"})
 	}
 
+	dkimrotate.Start(dns.StrictResolver{Pkg: "dkimrotate"})
+	quarantine.Start()
+	dnsblserver.Start()
+
 	store.StartAuthCache()
 	smtpserver.Serve()
 	imapserver.Serve()
@@ -12,11 +12,14 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/qompassai/beacon/arc"
+	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dkim"
 	"github.com/qompassai/beacon/dmarc"
 	"github.com/qompassai/beacon/dmarcrpt"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/dnsbl"
+	"github.com/qompassai/beacon/greylist"
 	"github.com/qompassai/beacon/iprev"
 	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/mlog"
@@ -38,10 +41,16 @@ type delivery struct {
 	msgCc       []message.Address
 	msgFrom     smtp.Address
 	dnsBLs      []dns.Domain
+	domainBLs   []config.DomainBL
+	uriBLs      []config.DomainBL
 	dmarcUse    bool
 	dmarcResult dmarc.Result
 	dkimResults []dkim.Result
-	iprevStatus iprev.Status
+	// Domain of the most recent sealer of a valid ARC chain, if it is a trusted
+	// sealer. Zero otherwise.
+	arcTrustedSealer dns.Domain
+	iprevStatus      iprev.Status
+	greylisting      *config.Greylisting
 }
 
 type analysis struct {
@@ -59,6 +68,8 @@ type analysis struct {
 	// Additional headers to add during delivery. Used for reasons a message to a
 	// dmarc/tls reporting address isn't processed.
 	headers string
+	// Additional methods for the Authentication-Results header, for DNSBL listings.
+	authMethods []message.AuthMethod
 }
 
 const (
@@ -77,6 +88,9 @@ const (
 	reasonSubjectpass       = "subjectpass"
 	reasonSubjectpassError  = "subjectpass-error"
 	reasonIPrev             = "iprev" // No or mild junk reputation signals, and bad iprev.
+	reasonGreylisted        = "greylisted"
+	reasonScanQuarantine    = "content-scan-quarantine"
+	reasonQuarantineHold    = "quarantine-hold"
 )
 
 func isListDomain(d delivery, ld dns.Domain) bool {
@@ -91,8 +105,65 @@ func isListDomain(d delivery, ld dns.Domain) bool {
 	return false
 }
 
+// arcAuthenticatedFrom returns whether the ARC-Authentication-Results of the most
+// recent ARC set, i.e. the results as seen by the sealer, show the message From
+// domain was authenticated: a dmarc pass for the From domain, or a dkim or spf
+// pass for a domain aligned with the From domain.
+func arcAuthenticatedFrom(ctx context.Context, log mlog.Log, r arc.Result, fromDomain dns.Domain) bool {
+	if len(r.Sets) == 0 || fromDomain.IsZero() {
+		return false
+	}
+	ar, err := r.Sets[len(r.Sets)-1].AuthResults()
+	if err != nil {
+		log.Debugx("parsing arc-authentication-results of sealer", err)
+		return false
+	}
+
+	propDomain := func(m message.AuthMethod, typ, prop string) dns.Domain {
+		for _, p := range m.Props {
+			if p.Type == typ && p.Property == prop {
+				v := p.Value
+				if i := strings.LastIndex(v, "@"); i >= 0 {
+					v = v[i+1:]
+				}
+				d, err := dns.ParseDomain(v)
+				if err != nil {
+					return dns.Domain{}
+				}
+				return d
+			}
+		}
+		return dns.Domain{}
+	}
+	orgDomain := publicsuffix.Lookup(ctx, log.Logger, fromDomain)
+	aligned := func(d dns.Domain) bool {
+		return !d.IsZero() && publicsuffix.Lookup(ctx, log.Logger, d) == orgDomain
+	}
+	for _, m := range ar.Methods {
+		if m.Result != "pass" {
+			continue
+		}
+		switch m.Method {
+		case "dmarc":
+			if propDomain(m, "header", "from") == fromDomain {
+				return true
+			}
+		case "dkim":
+			if aligned(propDomain(m, "header", "d")) {
+				return true
+			}
+		case "spf":
+			if aligned(propDomain(m, "smtp", "mailfrom")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d delivery) analysis {
 	var headers string
+	var authMethods []message.AuthMethod
 
 	mailbox := d.rcptAcc.destination.Mailbox
 	if mailbox == "" {
@@ -119,7 +190,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 	// failing DMARC, and we clear fields that could implicate the forwarding mail
 	// server during future classifications on incoming messages (the forwarding mail
 	// server isn't responsible for the message).
-	if rs != nil && rs.IsForward {
+	clearForwarder := func(forwarderDomain dns.Domain) {
 		d.dmarcUse = false
 		d.m.IsForward = true
 		d.m.RemoteIPMasked1 = ""
@@ -131,13 +202,23 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		d.m.OrigDKIMDomains = d.m.DKIMDomains
 		dkimdoms := []string{}
 		for _, dom := range d.m.DKIMDomains {
-			if dom != rs.VerifiedDNSDomain.Name() {
+			if dom != forwarderDomain.Name() {
 				dkimdoms = append(dkimdoms, dom)
 			}
 		}
 		d.m.DKIMDomains = dkimdoms
+	}
+	if rs != nil && rs.IsForward {
+		clearForwarder(rs.VerifiedDNSDomain)
 		dmarcOverrideReason = string(dmarcrpt.PolicyOverrideForwarded)
 		log.Info("forwarded message, clearing identifying signals of forwarding mail server")
+	} else if !d.arcTrustedSealer.IsZero() {
+		// A trusted ARC sealer, e.g. a mailing list, vouched for the authentication
+		// results it saw before it modified the message, with an aligned pass for the From
+		// domain, so we treat it like a forwarder.
+		clearForwarder(d.arcTrustedSealer)
+		dmarcOverrideReason = string(dmarcrpt.PolicyOverrideTrustedForwarder)
+		log.Info("message sealed by trusted arc sealer, clearing identifying signals of sealing mail server", slog.Any("sealer", d.arcTrustedSealer))
 	}
 
 	assignMailbox := func(tx *bstore.Tx) error {
@@ -178,7 +259,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 				})
 			})
 			if mberr != nil {
-				return analysis{false, mailbox, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing", err, nil, nil, reasonReputationError, dmarcOverrideReason, headers}
+				return analysis{false, mailbox, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing", err, nil, nil, reasonReputationError, dmarcOverrideReason, headers, authMethods}
 			}
 			d.m.MailboxID = 0 // We plan to reject, no need to set intended MailboxID.
 		}
@@ -192,7 +273,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			d.m.Seen = true
 			log.Info("accepting reject to configured mailbox due to ruleset")
 		}
-		return analysis{accept, mailbox, code, secode, err == nil, errmsg, err, nil, nil, reason, dmarcOverrideReason, headers}
+		return analysis{accept, mailbox, code, secode, err == nil, errmsg, err, nil, nil, reason, dmarcOverrideReason, headers, authMethods}
 	}
 
 	if d.dmarcUse && d.dmarcResult.Reject {
@@ -357,13 +438,14 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 	reason = reasonNoBadSignals
 	accept := true
 	var junkSubjectpass bool
+	var contentHam bool
 	f, jf, err := d.acc.OpenJunkFilter(ctx, log)
 	if err == nil {
 		defer func() {
 			err := f.Close()
 			log.Check(err, "closing junkfilter")
 		}()
-		contentProb, _, _, _, err := f.ClassifyMessageReader(ctx, store.FileMsgReader(d.m.MsgPrefix, d.dataFile), d.m.Size)
+		contentProb, _, nham, _, err := f.ClassifyMessageReader(ctx, store.FileMsgReader(d.m.MsgPrefix, d.dataFile), d.m.Size)
 		if err != nil {
 			log.Errorx("testing for spam", err)
 			return reject(smtp.C451LocalErr, smtp.SeSys3Other0, "error processing", err, reasonJunkClassifyError)
@@ -418,6 +500,9 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		}
 		accept = contentProb <= threshold
 		junkSubjectpass = contentProb < threshold-0.2
+		// Without recognized ham words, e.g. with a new junk filter, we cannot tell if
+		// the content is ham.
+		contentHam = accept && nham > 0 && contentProb < threshold-0.2
 		log.Info("content analyzed",
 			slog.Bool("accept", accept),
 			slog.Float64("contentprob", contentProb),
@@ -435,7 +520,7 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 		blocked := func(zone dns.Domain) bool {
 			dnsblctx, dnsblcancel := context.WithTimeout(ctx, 30*time.Second)
 			defer dnsblcancel()
-			if !checkDNSBLHealth(dnsblctx, log, resolver, zone) {
+			if !checkDNSBLHealth(dnsblctx, log, resolver, zone, false) {
 				log.Info("dnsbl not healthy, skipping", slog.Any("zone", zone))
 				return false
 			}
@@ -444,6 +529,14 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 			dnsblcancel()
 			if status == dnsbl.StatusFail {
 				log.Info("rejecting due to listing in dnsbl", slog.Any("zone", zone), slog.String("explanation", expl))
+				authMethods = append(authMethods, message.AuthMethod{
+					Method: "x-dnsbl",
+					Result: "fail",
+					Props: []message.AuthProp{
+						message.MakeAuthProp("policy", "zone", zone.ASCII, true, ""),
+						message.MakeAuthProp("policy", "ip", d.m.RemoteIP, false, ""),
+					},
+				})
 				return true
 			} else if err != nil {
 				log.Infox("dnsbl lookup", err, slog.Any("zone", zone), slog.Any("status", status))
@@ -460,10 +553,42 @@ func analyze(ctx context.Context, log mlog.Log, resolver dns.Resolver, d deliver
 				break
 			}
 		}
+
+		// Domain-based block lists, for domains of the sender and links in the message.
+		// Listings in multiple lists can be needed to reach the weight for a reject.
+		if !dnsblocklisted && (len(d.domainBLs) > 0 || len(d.uriBLs) > 0) {
+			weight, methods := domainBLCheck(ctx, log, resolver, d)
+			authMethods = append(authMethods, methods...)
+			if weight >= 1 {
+				log.Info("rejecting due to listings in domain dnsbls", slog.Float64("weight", weight))
+				accept = false
+				dnsblocklisted = true
+				reason = reasonDNSBlocklisted
+			}
+		}
+	}
+
+	// Messages that are not clearly ham get greylisted, unless from a verified
+	// domain with some good reputation.
+	verifiedHam := (d.m.MailFromValidated || len(d.m.DKIMDomains) > 0) && isjunk != nil && !*isjunk
+	if accept && d.greylisting != nil && !contentHam && !verifiedHam {
+		var verifiedDomains []string
+		if d.m.MailFromValidated && d.m.MailFromDomain != "" {
+			verifiedDomains = append(verifiedDomains, d.m.MailFromDomain)
+		}
+		verifiedDomains = append(verifiedDomains, d.m.DKIMDomains...)
+		greylisted, err := greylist.Check(ctx, log, *d.greylisting, net.ParseIP(d.m.RemoteIP), d.m.MailFrom, d.rcptAcc.rcptTo.String(), verifiedDomains)
+		if err != nil {
+			// We don't want to lose messages due to greylisting problems.
+			log.Errorx("checking greylist, accepting message", err)
+		} else if greylisted {
+			log.Info("temporarily rejecting message for greylisting")
+			return analysis{accept: false, mailbox: mailbox, code: smtp.C451LocalErr, secode: smtp.SePol7DeliveryUnauth1, userError: true, errmsg: "greylisted, try again later", reason: reasonGreylisted, dmarcOverrideReason: dmarcOverrideReason, headers: headers, authMethods: authMethods}
+		}
 	}
 
 	if accept {
-		return analysis{accept: true, mailbox: mailbox, reason: reasonNoBadSignals, dmarcOverrideReason: dmarcOverrideReason, headers: headers}
+		return analysis{accept: true, mailbox: mailbox, reason: reasonNoBadSignals, dmarcOverrideReason: dmarcOverrideReason, headers: headers, authMethods: authMethods}
 	}
 
 	if subjectpassKey != "" && d.dmarcResult.Status == dmarc.StatusPass && method == methodNone && (dnsblocklisted || junkSubjectpass) {
@@ -0,0 +1,74 @@
+package smtpserver
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/contentscan"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/store"
+)
+
+// contentScansFor returns the content scanners that apply to submissions or to
+// incoming deliveries.
+func contentScansFor(l []config.ContentScan, submission bool) []config.ContentScan {
+	var r []config.ContentScan
+	for _, cs := range l {
+		if submission && !cs.NoSubmission || !submission && !cs.NoIncoming {
+			r = append(r, cs)
+		}
+	}
+	return r
+}
+
+// contentScan calls the content scanners for the message in dataFile. If the
+// message is rejected or temporarily failed by a scanner, an SMTP error is
+// returned to the client. Otherwise the verdict is returned for quarantine and
+// headers to add. The quarantine mailbox, which can come from the scanner, is
+// checked like mailbox names from users. An invalid name, or Inbox, is replaced
+// with the default quarantine mailbox.
+func (c *conn) contentScan(ctx context.Context, dataFile *os.File, size int64) contentscan.Verdict {
+	env := contentscan.Envelope{
+		Submission: c.submission,
+		RemoteIP:   c.remoteIP,
+		Hostname:   c.hello.String(),
+		MailFrom:   c.mailFrom.String(),
+		QueueID:    beacon.ReceivedID(c.cid),
+	}
+	if c.account != nil {
+		env.Account = c.account.Name
+	}
+	for _, rcpt := range c.recipients {
+		env.RcptTo = append(env.RcptTo, rcpt.rcptTo.String())
+	}
+
+	v := contentscan.Scan(ctx, c.log, c.contentScans, env, dataFile, size)
+	switch v.Action {
+	case contentscan.ActionReject, contentscan.ActionTempfail:
+		c.log.Info("message refused by content scanner",
+			slog.String("scanner", v.Scanner),
+			slog.Any("action", v.Action),
+			slog.String("reason", v.Message))
+		if c.submission {
+			metricSubmission.WithLabelValues("contentscan").Inc()
+		} else {
+			metricDelivery.WithLabelValues("reject", "content-scan").Inc()
+			c.setSlow(true)
+		}
+		xsmtpUserErrorf(v.Code, v.SecondaryCode(), "%s", v.Message)
+	case contentscan.ActionQuarantine:
+		if name, _, err := store.CheckMailboxName(v.Mailbox, false); err != nil {
+			c.log.Errorx("invalid quarantine mailbox from content scanner, using default mailbox", err,
+				slog.String("scanner", v.Scanner),
+				slog.String("mailbox", v.Mailbox))
+			v.Mailbox = contentscan.DefaultQuarantineMailbox
+		} else {
+			v.Mailbox = name
+		}
+		c.log.Info("message quarantined by content scanner", slog.String("scanner", v.Scanner), slog.String("mailbox", v.Mailbox), slog.String("reason", v.Message))
+	}
+	return v
+}
@@ -3,19 +3,34 @@ package smtpserver
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/dnsbl"
+	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/publicsuffix"
+	"github.com/qompassai/beacon/store"
 )
 
 var dnsblHealth = struct {
 	sync.Mutex
-	zones map[dns.Domain]dnsblStatus
+	zones map[dnsblZone]dnsblStatus
 }{
-	zones: map[dns.Domain]dnsblStatus{},
+	zones: map[dnsblZone]dnsblStatus{},
+}
+
+type dnsblZone struct {
+	zone   dns.Domain
+	domain bool // Whether zone is a domain-based list, with different health checks.
 }
 
 type dnsblStatus struct {
@@ -23,15 +38,207 @@ type dnsblStatus struct {
 	err  error // nil, dnsbl.ErrDNS or other
 }
 
-// checkDNSBLHealth checks healthiness of DNSBL "zone", keeping the result cached for 4 hours.
-func checkDNSBLHealth(ctx context.Context, log mlog.Log, resolver dns.Resolver, zone dns.Domain) (rok bool) {
+// checkDNSBLHealth checks healthiness of DNSBL "zone", keeping the result cached
+// for 4 hours. If domain is set, zone is a domain-based list.
+func checkDNSBLHealth(ctx context.Context, log mlog.Log, resolver dns.Resolver, zone dns.Domain, domain bool) (rok bool) {
 	dnsblHealth.Lock()
 	defer dnsblHealth.Unlock()
-	status, ok := dnsblHealth.zones[zone]
+	key := dnsblZone{zone, domain}
+	status, ok := dnsblHealth.zones[key]
 	if !ok || time.Since(status.last) > 4*time.Hour {
-		status.err = dnsbl.CheckHealth(ctx, log.Logger, resolver, zone)
+		if domain {
+			status.err = dnsbl.CheckHealthDomain(ctx, log.Logger, resolver, zone)
+		} else {
+			status.err = dnsbl.CheckHealth(ctx, log.Logger, resolver, zone)
+		}
 		status.last = time.Now()
-		dnsblHealth.zones[zone] = status
+		dnsblHealth.zones[key] = status
 	}
 	return status.err == nil || errors.Is(status.err, dnsbl.ErrDNS)
 }
+
+// Maximum number of organizational domains of links looked up in URIBLs, and
+// number of bytes of a text part searched for links.
+const (
+	maxURIBLDomains = 20
+	maxURIBLScan    = 1024 * 1024
+)
+
+// domainBLCheck looks up the organizational domains of the EHLO hostname, SMTP
+// MAIL FROM, message From header and DKIM signatures in the domain-based block
+// lists, and the organizational domains of links in the message in the URIBLs.
+// It returns the sum of the weights of the listings, and methods for the
+// Authentication-Results header for listings and temporary errors.
+func domainBLCheck(ctx context.Context, log mlog.Log, resolver dns.Resolver, d delivery) (weight float64, methods []message.AuthMethod) {
+	orgDomain := func(s string) (dns.Domain, bool) {
+		if s == "" {
+			return dns.Domain{}, false
+		}
+		dom, err := dns.ParseDomain(s)
+		if err != nil {
+			return dns.Domain{}, false
+		}
+		return publicsuffix.Lookup(ctx, log.Logger, dom), true
+	}
+
+	type identity struct {
+		name   string // ehlo, mailfrom, from, dkim, uri.
+		domain dns.Domain
+	}
+	var identities []identity
+	seen := map[identity]bool{}
+	add := func(name, s string) {
+		if dom, ok := orgDomain(s); ok && !seen[identity{name, dom}] {
+			seen[identity{name, dom}] = true
+			identities = append(identities, identity{name, dom})
+		}
+	}
+	add("ehlo", d.m.EHLODomain)
+	add("mailfrom", d.m.MailFromDomain)
+	add("from", d.msgFrom.Domain.Name())
+	for _, s := range d.m.DKIMDomains {
+		add("dkim", s)
+	}
+	var links []dns.Domain
+	if len(d.uriBLs) > 0 {
+		links = linkDomains(ctx, log, d)
+	}
+
+	check := func(bl config.DomainBL, name string, dom dns.Domain) bool {
+		dnsblctx, dnsblcancel := context.WithTimeout(ctx, 30*time.Second)
+		defer dnsblcancel()
+		if !checkDNSBLHealth(dnsblctx, log, resolver, bl.ZoneDomain, true) {
+			log.Info("domain dnsbl not healthy, skipping", slog.Any("zone", bl.ZoneDomain))
+			return false
+		}
+
+		status, codes, expl, err := dnsbl.LookupDomain(dnsblctx, log.Logger, resolver, bl.ZoneDomain, dom)
+		var listed bool
+		if err == nil && status == dnsbl.StatusFail {
+			listed, err = dnsbl.Listed(codes, bl.ReturnNets)
+			if err != nil {
+				status = dnsbl.StatusTemperr
+			}
+		}
+		if err != nil {
+			log.Infox("domain dnsbl lookup", err, slog.Any("zone", bl.ZoneDomain), slog.Any("domain", dom), slog.Any("status", status))
+		}
+		if !listed && err == nil {
+			return false
+		}
+
+		var codestrs []string
+		for _, ip := range codes {
+			codestrs = append(codestrs, ip.String())
+		}
+		result := "fail"
+		if !listed {
+			result = "temperror"
+		} else {
+			log.Info("domain listed in dnsbl",
+				slog.Any("zone", bl.ZoneDomain),
+				slog.String("identity", name),
+				slog.Any("domain", dom),
+				slog.Any("codes", codestrs),
+				slog.String("explanation", expl),
+				slog.Float64("weight", bl.Weight))
+		}
+		methods = append(methods, message.AuthMethod{
+			Method:  "x-dnsbl",
+			Result:  result,
+			Comment: strings.Join(codestrs, ","),
+			Props: []message.AuthProp{
+				message.MakeAuthProp("policy", "zone", bl.ZoneDomain.ASCII, true, ""),
+				message.MakeAuthProp("policy", name, dom.ASCII, true, ""),
+			},
+		})
+		return listed
+	}
+
+	// Like IP-based DNSBLs, we look up sequentially, and stop when we have enough
+	// listings to reject.
+	for _, bl := range d.domainBLs {
+		for _, id := range identities {
+			if len(bl.Identities) > 0 && !slices.Contains(bl.Identities, id.name) {
+				continue
+			}
+			if check(bl, id.name, id.domain) {
+				weight += bl.Weight
+				// A single listing per list is enough.
+				break
+			}
+		}
+		if weight >= 1 {
+			return
+		}
+	}
+	for _, bl := range d.uriBLs {
+		for _, dom := range links {
+			if check(bl, "uri", dom) {
+				weight += bl.Weight
+				break
+			}
+		}
+		if weight >= 1 {
+			return
+		}
+	}
+	return
+}
+
+// linkDomains returns the organizational domains of http and https links in the
+// text and html parts of the message.
+func linkDomains(ctx context.Context, log mlog.Log, d delivery) []dns.Domain {
+	p, err := message.Parse(log.Logger, false, store.FileMsgReader(d.m.MsgPrefix, d.dataFile))
+	if err == nil {
+		err = p.Walk(log.Logger, nil)
+	}
+	if err != nil {
+		log.Debugx("parsing message for link domains", err)
+		return nil
+	}
+
+	var l []dns.Domain
+	seen := map[dns.Domain]bool{}
+	var walk func(p message.Part)
+	walk = func(p message.Part) {
+		if len(l) >= maxURIBLDomains {
+			return
+		}
+		if len(p.Parts) > 0 {
+			for _, pp := range p.Parts {
+				walk(pp)
+			}
+			return
+		}
+		ct := p.MediaType + "/" + p.MediaSubType
+		if ct != "/" && ct != "TEXT/PLAIN" && ct != "TEXT/HTML" {
+			return
+		}
+		buf, err := io.ReadAll(io.LimitReader(p.ReaderUTF8OrBinary(), maxURIBLScan))
+		if err != nil {
+			log.Debugx("reading message part for link domains", err)
+			return
+		}
+		for _, link := range message.Links(string(buf)) {
+			host := message.LinkHost(link)
+			if host == "" || net.ParseIP(host) != nil {
+				continue
+			}
+			dom, err := dns.ParseDomain(host)
+			if err != nil {
+				continue
+			}
+			dom = publicsuffix.Lookup(ctx, log.Logger, dom)
+			if !seen[dom] {
+				seen[dom] = true
+				l = append(l, dom)
+				if len(l) >= maxURIBLDomains {
+					return
+				}
+			}
+		}
+	}
+	walk(p)
+	return l
+}
@@ -102,7 +102,7 @@ func FuzzServer(f *testing.F) {
 			const submission = false
 			err := serverConn.SetDeadline(time.Now().Add(time.Second))
 			flog(err, "set server deadline")
-			serve("test", cid, dns.Domain{ASCII: "beacon.example"}, nil, serverConn, resolver, submission, false, 100<<10, false, false, false, nil, 0)
+			serve("test", cid, dns.Domain{ASCII: "beacon.example"}, nil, serverConn, resolver, submission, false, 100<<10, false, false, false, nil, nil, nil, 0, nil, nil)
 			cid++
 		}
 
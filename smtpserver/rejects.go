@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -18,8 +19,9 @@ import (
 	"github.com/qompassai/beacon/store"
 )
 
-// rejectPresent returns whether the message is already present in the rejects mailbox.
-func rejectPresent(log mlog.Log, acc *store.Account, rejectsMailbox string, m *store.Message, f *os.File) (present bool, msgID string, hash []byte, rerr error) {
+// rejectIdentity returns the canonical Message-ID and the hash of a rejected
+// message, for recognizing retried deliveries of the message.
+func rejectIdentity(log mlog.Log, m *store.Message, f *os.File) (msgID string, hash []byte, rerr error) {
 	if p, err := message.Parse(log.Logger, false, store.FileMsgReader(m.MsgPrefix, f)); err != nil {
 		log.Infox("parsing reject message for message-id", err)
 	} else if header, err := p.Header(); err != nil {
@@ -40,9 +42,22 @@ func rejectPresent(log mlog.Log, acc *store.Account, rejectsMailbox string, m *s
 	}
 
 	if msgID == "" && len(hash) == 0 {
-		return false, "", nil, fmt.Errorf("no message-id or hash for determining reject message presence")
+		return "", nil, fmt.Errorf("no message-id or hash for identifying reject message")
+	}
+	return msgID, hash, nil
+}
+
+// rejectKey returns the key for a rejected message, as used for counting
+// rejects for the dnsbl server: the Message-ID, or the hash of the message.
+func rejectKey(msgID string, hash []byte) string {
+	if msgID != "" {
+		return msgID
 	}
+	return "sha256:" + hex.EncodeToString(hash)
+}
 
+// rejectPresent returns whether the message is already present in the rejects mailbox.
+func rejectPresent(acc *store.Account, rejectsMailbox, msgID string, hash []byte) (present bool, rerr error) {
 	var exists bool
 	var err error
 	acc.WithRLock(func() {
@@ -68,7 +83,7 @@ func rejectPresent(log mlog.Log, acc *store.Account, rejectsMailbox string, m *s
 		})
 	})
 	if err != nil {
-		return false, "", nil, fmt.Errorf("querying for presence of reject message: %w", err)
+		return false, fmt.Errorf("querying for presence of reject message: %w", err)
 	}
-	return exists, msgID, hash, nil
+	return exists, nil
 }
@@ -34,14 +34,18 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/qompassai/beacon/arc"
 	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/contentscan"
 	"github.com/qompassai/beacon/dkim"
 	"github.com/qompassai/beacon/dmarc"
 	"github.com/qompassai/beacon/dmarcdb"
 	"github.com/qompassai/beacon/dmarcrpt"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/dnsblserver"
 	"github.com/qompassai/beacon/dsn"
 	"github.com/qompassai/beacon/iprev"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/metrics"
 	"github.com/qompassai/beacon/mlog"
@@ -49,6 +53,7 @@ import (
 	"github.com/qompassai/beacon/beaconio"
 	"github.com/qompassai/beacon/beaconvar"
 	"github.com/qompassai/beacon/publicsuffix"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/queue"
 	"github.com/qompassai/beacon/ratelimit"
 	"github.com/qompassai/beacon/scram"
@@ -148,7 +153,7 @@ var (
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "beacon_smtpserver_submission_total",
-			Help: "SMTP server incoming submission results, known values (those ending with error are server errors): ok, badmessage, badfrom, badheader, messagelimiterror, recipientlimiterror, localserveerror, queueerror.",
+			Help: "SMTP server incoming submission results, known values (those ending with error are server errors): ok, badmessage, badfrom, badheader, messagelimiterror, recipientlimiterror, localserveerror, queueerror, contentscan, quarantined, quarantineerror.",
 		},
 		[]string{
 			"result",
@@ -182,9 +187,13 @@ func Listen() {
 	for _, name := range names {
 		listener := beacon.Conf.Static.Listeners[name]
 
-		var tlsConfig *tls.Config
+		var tlsConfig, submissionTLSConfig *tls.Config
 		if listener.TLS != nil {
 			tlsConfig = listener.TLS.Config
+			submissionTLSConfig = listener.TLS.Config
+			if listener.TLS.ClientAuthConfig != nil {
+				submissionTLSConfig = listener.TLS.ClientAuthConfig
+			}
 		}
 
 		maxMsgSize := listener.SMTPMaxMessageSize
@@ -200,7 +209,7 @@ func Listen() {
 			port := config.Port(listener.SMTP.Port, 25)
 			for _, ip := range listener.IPs {
 				firstTimeSenderDelay := durationDefault(listener.SMTP.FirstTimeSenderDelay, firstTimeSenderDelayDefault)
-				listen1("smtp", name, ip, port, hostname, tlsConfig, false, false, maxMsgSize, false, listener.SMTP.RequireSTARTTLS, !listener.SMTP.NoRequireTLS, listener.SMTP.DNSBLZones, firstTimeSenderDelay)
+				listen1("smtp", name, ip, port, hostname, tlsConfig, false, false, maxMsgSize, false, listener.SMTP.RequireSTARTTLS, !listener.SMTP.NoRequireTLS, listener.SMTP.DNSBLZones, listener.SMTP.DomainBLs, listener.SMTP.URIBLs, firstTimeSenderDelay, listener.SMTP.Greylisting, contentScansFor(listener.ContentScans, false))
 			}
 		}
 		if listener.Submission.Enabled {
@@ -210,7 +219,7 @@ func Listen() {
 			}
 			port := config.Port(listener.Submission.Port, 587)
 			for _, ip := range listener.IPs {
-				listen1("submission", name, ip, port, hostname, tlsConfig, true, false, maxMsgSize, !listener.Submission.NoRequireSTARTTLS, !listener.Submission.NoRequireSTARTTLS, true, nil, 0)
+				listen1("submission", name, ip, port, hostname, submissionTLSConfig, true, false, maxMsgSize, !listener.Submission.NoRequireSTARTTLS, !listener.Submission.NoRequireSTARTTLS, true, nil, nil, nil, 0, nil, contentScansFor(listener.ContentScans, true))
 			}
 		}
 
@@ -221,7 +230,7 @@ func Listen() {
 			}
 			port := config.Port(listener.Submissions.Port, 465)
 			for _, ip := range listener.IPs {
-				listen1("submissions", name, ip, port, hostname, tlsConfig, true, true, maxMsgSize, true, true, true, nil, 0)
+				listen1("submissions", name, ip, port, hostname, submissionTLSConfig, true, true, maxMsgSize, true, true, true, nil, nil, nil, 0, nil, contentScansFor(listener.ContentScans, true))
 			}
 		}
 	}
@@ -229,7 +238,7 @@ func Listen() {
 
 var servers []func()
 
-func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig *tls.Config, submission, xtls bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, firstTimeSenderDelay time.Duration) {
+func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig *tls.Config, submission, xtls bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, domainBLs, uriBLs []config.DomainBL, firstTimeSenderDelay time.Duration, greylisting *config.Greylisting, contentScans []config.ContentScan) {
 	log := mlog.New("smtpserver", nil)
 	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
 	if os.Getuid() == 0 {
@@ -257,7 +266,7 @@ func listen1(protocol, name, ip string, port int, hostname dns.Domain, tlsConfig
 
 			// Package is set on the resolver by the dkim/spf/dmarc/etc packages.
 			resolver := dns.StrictResolver{Log: log.Logger}
-			go serve(name, beacon.Cid(), hostname, tlsConfig, conn, resolver, submission, xtls, maxMessageSize, requireTLSForAuth, requireTLSForDelivery, requireTLS, dnsBLs, firstTimeSenderDelay)
+			go serve(name, beacon.Cid(), hostname, tlsConfig, conn, resolver, submission, xtls, maxMessageSize, requireTLSForAuth, requireTLSForDelivery, requireTLS, dnsBLs, domainBLs, uriBLs, firstTimeSenderDelay, greylisting, contentScans)
 		}
 	}
 
@@ -303,7 +312,11 @@ type conn struct {
 	cmdStart              time.Time // Start of current command.
 	ncmds                 int       // Number of commands processed. Used to abort connection when first incoming command is unknown/invalid.
 	dnsBLs                []dns.Domain
+	domainBLs             []config.DomainBL // Domain-based block lists for EHLO, MAIL FROM, From and DKIM domains.
+	uriBLs                []config.DomainBL // Domain-based block lists for domains of links in messages.
 	firstTimeSenderDelay  time.Duration
+	greylisting           *config.Greylisting  // If set, messages without reputation are greylisted.
+	contentScans          []config.ContentScan // Called for each message after DATA.
 
 	// If non-zero, taken into account during Read and Write. Set while processing DATA
 	// command, we don't want the entire delivery to take too long.
@@ -547,7 +560,7 @@ func (c *conn) writelinef(format string, args ...any) {
 
 var cleanClose struct{} // Sentinel value for panic/recover indicating clean close of connection.
 
-func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.Config, nc net.Conn, resolver dns.Resolver, submission, tls bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, firstTimeSenderDelay time.Duration) {
+func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.Config, nc net.Conn, resolver dns.Resolver, submission, tls bool, maxMessageSize int64, requireTLSForAuth, requireTLSForDelivery, requireTLS bool, dnsBLs []dns.Domain, domainBLs, uriBLs []config.DomainBL, firstTimeSenderDelay time.Duration, greylisting *config.Greylisting, contentScans []config.ContentScan) {
 	var localIP, remoteIP net.IP
 	if a, ok := nc.LocalAddr().(*net.TCPAddr); ok {
 		localIP = a.IP
@@ -579,7 +592,11 @@ func serve(listenerName string, cid int64, hostname dns.Domain, tlsConfig *tls.C
 		requireTLSForAuth:     requireTLSForAuth,
 		requireTLSForDelivery: requireTLSForDelivery,
 		dnsBLs:                dnsBLs,
+		domainBLs:             domainBLs,
+		uriBLs:                uriBLs,
 		firstTimeSenderDelay:  firstTimeSenderDelay,
+		greylisting:           greylisting,
+		contentScans:          contentScans,
 	}
 	var logmutex sync.Mutex
 	c.log = mlog.New("smtpserver", nil).WithFunc(func() []slog.Attr {
@@ -874,7 +891,13 @@ func (c *conn) cmdHello(p *parser, ehlo bool) {
 			// authentication. The client should select the bare variant when TLS isn't
 			// present, and also not indicate the server supports the PLUS variant in that
 			// case, or it would trigger the mechanism downgrade detection.
-			c.bwritelinef("250-AUTH SCRAM-SHA-256-PLUS SCRAM-SHA-256 SCRAM-SHA-1-PLUS SCRAM-SHA-1 CRAM-MD5 PLAIN LOGIN")
+			mechs := "SCRAM-SHA-256-PLUS SCRAM-SHA-256 SCRAM-SHA-1-PLUS SCRAM-SHA-1 CRAM-MD5 PLAIN LOGIN"
+			// EXTERNAL is only offered when the client sent a certificate, it is the only way
+			// to use it.
+			if c.tls && len(c.conn.(*tls.Conn).ConnectionState().PeerCertificates) > 0 {
+				mechs += " EXTERNAL"
+			}
+			c.bwritelinef("250-AUTH %s", mechs)
 		} else {
 			c.bwritelinef("250-AUTH ")
 		}
@@ -969,9 +992,11 @@ func (c *conn) cmdAuth(p *parser) {
 	}()
 
 	var authVariant string
+	var loginAddress string // Username attempted, for the login attempt log.
 	authResult := "error"
 	defer func() {
 		metrics.AuthenticationInc("submission", authVariant, authResult)
+		c.recordLoginAttempt(authVariant, authResult, loginAddress)
 		switch authResult {
 		case "ok":
 			beacon.LimiterFailedAuth.Reset(c.remoteIP, time.Now())
@@ -1055,13 +1080,15 @@ func (c *conn) cmdAuth(p *parser) {
 		authz := string(plain[0])
 		authc := string(plain[1])
 		password := string(plain[2])
+		loginAddress = authc
 
 		if authz != "" && authz != authc {
 			authResult = "badcreds"
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "cannot assume other role")
 		}
 
-		acc, err := store.OpenEmailAuth(c.log, authc, password)
+		c.xcheckLoginLockout(&authResult, "", authc, "bad user/pass")
+		acc, err := store.OpenEmailAuth(c.log, authc, password, false)
 		if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
 			// ../rfc/4954:274
 			authResult = "badcreds"
@@ -1096,6 +1123,7 @@ func (c *conn) cmdAuth(p *parser) {
 		// I-D says maximum length must be 64 bytes. We allow more, for long user names
 		// (domains).
 		username := string(xreadInitial())
+		loginAddress = username
 
 		// Again, client should ignore the challenge, we send the same as the example in
 		// the I-D.
@@ -1106,7 +1134,8 @@ func (c *conn) cmdAuth(p *parser) {
 		password := string(xreadContinuation())
 		c.xtrace(mlog.LevelTrace) // Restore.
 
-		acc, err := store.OpenEmailAuth(c.log, username, password)
+		c.xcheckLoginLockout(&authResult, "", username, "bad user/pass")
+		acc, err := store.OpenEmailAuth(c.log, username, password, false)
 		if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
 			// ../rfc/4954:274
 			authResult = "badcreds"
@@ -1138,10 +1167,12 @@ func (c *conn) cmdAuth(p *parser) {
 			xsmtpUserErrorf(smtp.C501BadParamSyntax, smtp.SeProto5BadParams4, "malformed cram-md5 response")
 		}
 		addr := t[0]
+		loginAddress = addr
 		c.log.Debug("cram-md5 auth", slog.String("address", addr))
 		acc, _, err := store.OpenEmail(c.log, addr)
 		if err != nil {
 			if errors.Is(err, store.ErrUnknownCredentials) {
+				authResult = "badcreds"
 				c.log.Info("failed authentication attempt", slog.String("username", addr), slog.Any("remote", c.remoteIP))
 				xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
 			}
@@ -1153,6 +1184,16 @@ func (c *conn) cmdAuth(p *parser) {
 				c.log.Check(err, "closing account")
 			}
 		}()
+		c.xcheckLoginLockout(&authResult, acc.Name, addr, "bad user/pass")
+		// CRAM-MD5 secrets are derived from the account password, which is refused when
+		// an app password is required.
+		appPasswordRequired, err := acc.AppPasswordsRequired(context.TODO())
+		xcheckf(err, "checking whether app password is required")
+		if appPasswordRequired {
+			authResult = "badcreds"
+			c.log.Info("failed authentication attempt, app password required", slog.String("username", addr), slog.Any("remote", c.remoteIP))
+			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
+		}
 		var ipadhash, opadhash hash.Hash
 		acc.WithRLock(func() {
 			err := acc.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -1182,6 +1223,7 @@ func (c *conn) cmdAuth(p *parser) {
 		opadhash.Write(ipadhash.Sum(nil))
 		digest := fmt.Sprintf("%x", opadhash.Sum(nil))
 		if digest != t[1] {
+			authResult = "badcreds"
 			c.log.Info("failed authentication attempt", slog.String("username", addr), slog.Any("remote", c.remoteIP))
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad user/pass")
 		}
@@ -1226,6 +1268,7 @@ func (c *conn) cmdAuth(p *parser) {
 		ss, err := scram.NewServer(h, c0, cs, channelBindingRequired)
 		xcheckf(err, "starting scram")
 		c.log.Debug("scram auth", slog.String("authentication", ss.Authentication))
+		loginAddress = ss.Authentication
 		acc, _, err := store.OpenEmail(c.log, ss.Authentication)
 		if err != nil {
 			// todo: we could continue scram with a generated salt, deterministically generated
@@ -1243,6 +1286,15 @@ func (c *conn) cmdAuth(p *parser) {
 		if ss.Authorization != "" && ss.Authorization != ss.Authentication {
 			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "authentication with authorization for different user not supported")
 		}
+		c.xcheckLoginLockout(&authResult, acc.Name, ss.Authentication, "bad credentials")
+		// SCRAM secrets are derived from the account password, which is refused when an
+		// app password is required.
+		appPasswordRequired, err := acc.AppPasswordsRequired(context.TODO())
+		xcheckf(err, "checking whether app password is required")
+		if appPasswordRequired {
+			c.log.Info("failed authentication attempt, app password required", slog.String("username", ss.Authentication), slog.Any("remote", c.remoteIP))
+			xsmtpUserErrorf(smtp.C454TempAuthFail, smtp.SeSys3Other0, "scram not possible")
+		}
 		var xscram store.SCRAM
 		acc.WithRLock(func() {
 			err := acc.DB.Read(context.TODO(), func(tx *bstore.Tx) error {
@@ -1296,12 +1348,81 @@ func (c *conn) cmdAuth(p *parser) {
 		// ../rfc/4954:276
 		c.writecodeline(smtp.C235AuthSuccess, smtp.SePol7Other0, "nice", nil)
 
+	case "EXTERNAL":
+		// Authentication with the TLS client certificate. The client only sends the
+		// requested authorization identity, possibly empty. See ../rfc/4422, appendix A.
+		authVariant = "external"
+
+		authz := string(xreadInitial())
+		loginAddress = authz
+		if !c.tls {
+			xsmtpUserErrorf(smtp.C538EncReqForAuth, smtp.SePol7EncReqForAuth11, "tls client certificate required")
+		}
+		acc, certLoginAddress, err := store.OpenTLSClientCert(c.log, c.conn.(*tls.Conn).ConnectionState(), authz)
+		if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
+			// ../rfc/4954:274
+			authResult = "badcreds"
+			c.log.Infox("failed authentication attempt", err, slog.String("authz", authz), slog.Any("remote", c.remoteIP))
+			xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "bad credentials")
+		}
+		xcheckf(err, "looking up tls client certificate")
+		defer func() {
+			if acc != nil {
+				err := acc.Close()
+				c.log.Check(err, "closing account")
+			}
+		}()
+		c.xcheckLoginLockout(&authResult, acc.Name, certLoginAddress, "bad credentials")
+
+		authResult = "ok"
+		c.authFailed = 0
+		c.setSlow(false)
+		c.account = acc
+		acc = nil // Cancel cleanup.
+		c.username = certLoginAddress
+		// ../rfc/4954:276
+		c.writecodeline(smtp.C235AuthSuccess, smtp.SePol7Other0, "nice", nil)
+
 	default:
 		// ../rfc/4954:176
 		xsmtpUserErrorf(smtp.C504ParamNotImpl, smtp.SeProto5BadParams4, "mechanism %s not supported", mech)
 	}
 }
 
+// recordLoginAttempt adds an authentication attempt to the login attempt log.
+func (c *conn) recordLoginAttempt(authMech, result, loginAddress string) {
+	var cs *tls.ConnectionState
+	if tc, ok := c.conn.(*tls.Conn); ok {
+		xcs := tc.ConnectionState()
+		cs = &xcs
+	}
+	loginattempt.Record(context.TODO(), c.log, loginattempt.LoginAttempt{
+		LoginAddress: loginAddress,
+		RemoteIP:     c.remoteIP.String(),
+		LocalIP:      c.localIP.String(),
+		TLS:          loginattempt.TLSInfo(cs),
+		Protocol:     "submission",
+		AuthMech:     authMech,
+		Result:       result,
+	})
+}
+
+// xcheckLoginLockout fails the authentication if authentication for the account,
+// or the account of username if accountName is empty, is blocked after too many
+// failed attempts. Called before verifying credentials. The response is the same
+// as for bad credentials, badCredsMsg, so attempts during a lockout don't reveal
+// whether a password is correct.
+func (c *conn) xcheckLoginLockout(authResult *string, accountName, username, badCredsMsg string) {
+	locked, err := loginattempt.LockedLogin(context.TODO(), accountName, username)
+	xcheckf(err, "checking login lockout")
+	if !locked {
+		return
+	}
+	*authResult = "locked"
+	c.log.Info("failed authentication attempt, authentication for account blocked", slog.String("username", username), slog.Any("remote", c.remoteIP))
+	xsmtpUserErrorf(smtp.C535AuthBadCreds, smtp.SePol7AuthBadCreds8, "%s", badCredsMsg)
+}
+
 // ../rfc/5321:1879 ../rfc/5321:1025
 func (c *conn) cmdMail(p *parser) {
 	// requirements for maximum line length:
@@ -1780,13 +1901,19 @@ func (c *conn) cmdData(p *parser) {
 		return recvHdr.String()
 	}
 
+	// Content scanners can reject the message, or quarantine it and add headers.
+	var scanVerdict contentscan.Verdict
+	if len(c.contentScans) > 0 {
+		scanVerdict = c.contentScan(cmdctx, dataFile, msgWriter.Size)
+	}
+
 	// Submission is easiest because user is trusted. Far fewer checks to make. So
 	// handle it first, and leave the rest of the function for handling wild west
 	// internet traffic.
 	if c.submission {
-		c.submit(cmdctx, recvHdrFor, msgWriter, dataFile)
+		c.submit(cmdctx, recvHdrFor, msgWriter, dataFile, scanVerdict)
 	} else {
-		c.deliver(cmdctx, recvHdrFor, msgWriter, iprevStatus, iprevAuthentic, dataFile)
+		c.deliver(cmdctx, recvHdrFor, msgWriter, iprevStatus, iprevAuthentic, dataFile, scanVerdict)
 	}
 }
 
@@ -1807,8 +1934,36 @@ func hasTLSRequiredNo(h textproto.MIMEHeader) bool {
 	return true
 }
 
+// receivedAuthResults returns the SPF, DKIM and DMARC results from our own
+// Authentication-Results header, added when we received the message. Only the
+// topmost Authentication-Results header is considered, headers further down
+// could have been added by the sender. The returned AuthResults has no methods
+// if the message does not have our header.
+func receivedAuthResults(h textproto.MIMEHeader, smtputf8 bool) message.AuthResults {
+	hostname := beacon.Conf.Static.HostnameDomain
+	r := message.AuthResults{
+		Hostname: hostname.XName(smtputf8),
+		Comment:  hostname.ASCIIExtra(smtputf8),
+	}
+	l := h.Values("Authentication-Results")
+	if len(l) == 0 {
+		return r
+	}
+	ar, err := message.ParseAuthResults(l[0])
+	if err != nil || !strings.EqualFold(ar.Hostname, hostname.ASCII) && !strings.EqualFold(ar.Hostname, hostname.Unicode) {
+		return r
+	}
+	for _, m := range ar.Methods {
+		switch m.Method {
+		case "spf", "dkim", "dmarc":
+			r.Methods = append(r.Methods, m)
+		}
+	}
+	return r
+}
+
 // submit is used for mail from authenticated users that we will try to deliver.
-func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, dataFile *os.File) {
+func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, dataFile *os.File, scanVerdict contentscan.Verdict) {
 	// Similar between ../smtpserver/server.go:/submit\( and ../webmail/webmail.go:/MessageSubmit\(
 
 	var msgPrefix []byte
@@ -1863,7 +2018,11 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 		msgPrefix = append(msgPrefix, "Date: "+time.Now().Format(message.RFC5322Z)+"\r\n"...)
 	}
 
+	// Headers from content scanners, added before DKIM signing.
+	msgPrefix = append(msgPrefix, scanVerdict.HeaderText()...)
+
 	// Check outoging message rate limit.
+	var sendDelay time.Duration
 	err = c.account.DB.Read(ctx, func(tx *bstore.Tx) error {
 		rcpts := make([]smtp.Path, len(c.recipients))
 		for i, r := range c.recipients {
@@ -1878,6 +2037,12 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 			metricSubmission.WithLabelValues("recipientlimiterror").Inc()
 			xsmtpUserErrorf(smtp.C451LocalErr, smtp.SePol7DeliveryUnauth1, "max number of new/first-time recipients (%d) over past 24h reached, try increasing per-account setting MaxFirstTimeRecipientsPerDay", rcptlimit)
 		}
+
+		// The send delay from the webmail settings applies to all submissions of the
+		// account. Only submissions from webmail can be undone.
+		settings, err := store.SettingsGet(tx)
+		xcheckf(err, "get settings")
+		sendDelay = time.Duration(settings.SendDelay) * time.Second
 		return nil
 	})
 	xcheckf(err, "read-only transaction")
@@ -1916,8 +2081,69 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 			},
 		},
 	}
+
+	// Add an ARC set when relaying a message that was received earlier, e.g. one
+	// that is submitted again for forwarding, recognized by its existing
+	// authentication headers. The set records the authentication results from when
+	// we received the message, and is sealed by the domain of the account that
+	// received it, not the domain of the message From header. ../rfc/8617
+	accConf, _ := c.account.Conf()
+	arcConfDom, _ := beacon.Conf.Domain(accConf.DNSDomain)
+	if sel, ok := beacon.ARCSealSelector(arcConfDom.DKIM); ok && (header.Get("Authentication-Results") != "" || header.Get("Arc-Seal") != "") {
+		arcResult := arc.Verify(ctx, c.log.Logger, c.resolver, c.smtputf8, store.FileMsgReader(msgPrefix, dataFile))
+		arcAuthResults := receivedAuthResults(header, c.smtputf8)
+		if arcResult.Status != arc.StatusNone {
+			arcAuthResults.Methods = append(arcAuthResults.Methods, message.AuthMethod{Method: "arc", Result: string(arcResult.Status)})
+		}
+		if len(arcAuthResults.Methods) == 0 {
+			c.log.Debug("not adding arc set, message has no authentication results of ours and no arc chain")
+		} else if arcHeaders, err := arc.Sign(ctx, c.log.Logger, accConf.DNSDomain, sel, c.smtputf8, store.FileMsgReader(msgPrefix, dataFile), arcResult.Status, arcAuthResults); errors.Is(err, arc.ErrChainFailed) {
+			c.log.Infox("not adding arc set to failed arc chain", err)
+		} else if err != nil {
+			c.log.Errorx("arc seal for domain", err, slog.Any("domain", accConf.DNSDomain))
+			metricServerErrors.WithLabelValues("arcseal").Inc()
+		} else {
+			msgPrefix = append(msgPrefix, []byte(arcHeaders)...)
+		}
+	}
+
 	msgPrefix = append(msgPrefix, []byte(authResults.Header())...)
 
+	// A quarantined message is not sent, but stored in a mailbox of the sender.
+	if scanVerdict.Action == contentscan.ActionQuarantine {
+		m := store.Message{
+			Received:  time.Now(),
+			MailFrom:  c.mailFrom.String(),
+			MsgPrefix: msgPrefix,
+			Size:      int64(len(msgPrefix)) + msgWriter.Size,
+		}
+		c.account.WithWLock(func() {
+			err = c.account.DeliverMailbox(c.log, scanVerdict.Mailbox, &m, dataFile)
+		})
+		if err != nil {
+			metricSubmission.WithLabelValues("quarantineerror").Inc()
+			c.log.Errorx("storing quarantined message", err)
+			xsmtpServerErrorf(errCodes(smtp.C451LocalErr, smtp.SeSys3Other0, err), "error storing message: %v", err)
+		}
+		metricSubmission.WithLabelValues("quarantined").Inc()
+		c.log.Info("submitted message quarantined, not queued for delivery",
+			slog.String("scanner", scanVerdict.Scanner),
+			slog.String("mailbox", scanVerdict.Mailbox),
+			slog.String("reason", scanVerdict.Message))
+
+		c.transactionGood++
+		c.transactionBad-- // Compensate for early earlier pessimistic increase.
+
+		c.rset()
+		c.writecodeline(smtp.C250Completed, smtp.SeMailbox2Other0, "message quarantined, not sent", nil)
+		return
+	}
+
+	var nextAttempt time.Time
+	if sendDelay > 0 {
+		nextAttempt = time.Now().Add(sendDelay)
+	}
+
 	// We always deliver through the queue. It would be more efficient to deliver
 	// directly, but we don't want to circumvent all the anti-spam measures. Accounts
 	// on a single beacon instance should be allowed to block each other.
@@ -1938,6 +2164,7 @@ func (c *conn) submit(ctx context.Context, recvHdrFor func(string) string, msgWr
 
 		msgSize := int64(len(xmsgPrefix)) + msgWriter.Size
 		qm := queue.MakeMsg(c.account.Name, *c.mailFrom, rcptAcc.rcptTo, msgWriter.Has8bit, c.smtputf8, msgSize, messageID, xmsgPrefix, c.requireTLS)
+		qm.NextAttempt = nextAttempt
 		if err := queue.Add(ctx, c.log, &qm, dataFile); err != nil {
 			// Aborting the transaction is not great. But continuing and generating DSNs will
 			// probably result in errors as well...
@@ -2014,7 +2241,7 @@ func (c *conn) xlocalserveError(lp smtp.Localpart) {
 
 // deliver is called for incoming messages from external, typically untrusted
 // sources. i.e. not submitted by authenticated users.
-func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, iprevStatus iprev.Status, iprevAuthentic bool, dataFile *os.File) {
+func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgWriter *message.Writer, iprevStatus iprev.Status, iprevAuthentic bool, dataFile *os.File, scanVerdict contentscan.Verdict) {
 	// todo: in decision making process, if we run into (some) temporary errors, attempt to continue. if we decide to accept, all good. if we decide to reject, we'll make it a temporary reject.
 
 	msgFrom, envelope, headers, err := message.From(c.log.Logger, false, dataFile)
@@ -2089,6 +2316,25 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		dkimcancel()
 	}()
 
+	// ARC
+	wg.Add(1)
+	var arcResult arc.Result
+	go func() {
+		defer func() {
+			x := recover() // Should not happen, but don't take program down if it does.
+			if x != nil {
+				c.log.Error("arc verify panic", slog.Any("err", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Arcverify)
+			}
+		}()
+		defer wg.Done()
+		arcctx, arccancel := context.WithTimeout(ctx, time.Minute)
+		defer arccancel()
+		arcResult = arc.Verify(arcctx, c.log.Logger, c.resolver, c.smtputf8, dataFile)
+		arccancel()
+	}()
+
 	// SPF.
 	// ../rfc/7208:472
 	var receivedSPF spf.Received
@@ -2124,7 +2370,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		}
 	}()
 
-	// Wait for DKIM and SPF validation to finish.
+	// Wait for DKIM, ARC and SPF validation to finish.
 	wg.Wait()
 
 	// Give immediate response if all recipients are unknown.
@@ -2212,6 +2458,48 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			slog.Any("identity", identity))
 	}
 
+	// Add ARC result to Authentication-Results header, only for messages with ARC
+	// headers. A passing chain from a trusted sealer changes junk analysis, like
+	// forwarded messages. ../rfc/8617
+	var arcTrustedSealer dns.Domain
+	if arcResult.Status != arc.StatusNone {
+		var comment, reason string
+		var props []message.AuthProp
+		if arcResult.Status == arc.StatusPass {
+			sealer := arcResult.Sealer()
+			comment = "sealer " + sealer.XName(c.smtputf8)
+			for _, d := range beacon.Conf.Static.ARCTrustedSealerDomains {
+				if d != sealer {
+					continue
+				}
+				// Only override DMARC if the sealer saw the From domain authenticated.
+				if arcAuthenticatedFrom(ctx, c.log, arcResult, msgFrom.Domain) {
+					arcTrustedSealer = sealer
+					comment += ", trusted"
+				} else {
+					comment += ", trusted, but no aligned pass"
+				}
+				break
+			}
+			props = append(props, message.MakeAuthProp("header", "oldest-pass", strconv.Itoa(arcResult.OldestPass), false, ""))
+		}
+		if arcResult.Err != nil {
+			reason = arcResult.Err.Error()
+		}
+		props = append(props, message.MakeAuthProp("smtp", "remote-ip", c.remoteIP.String(), false, ""))
+		authResults.Methods = append(authResults.Methods, message.AuthMethod{
+			Method:  "arc",
+			Result:  string(arcResult.Status),
+			Comment: comment,
+			Reason:  reason,
+			Props:   props,
+		})
+		c.log.Debugx("arc verification result", arcResult.Err,
+			slog.Any("status", arcResult.Status),
+			slog.Any("sealer", arcResult.Sealer()),
+			slog.Any("trustedsealer", arcTrustedSealer))
+	}
+
 	// Add SPF results to Authentication-Results header. ../rfc/7208:2141
 	var spfIdentity *dns.Domain
 	var mailFromValidation = store.ValidationUnknown
@@ -2375,7 +2663,32 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		deliverErrors = append(deliverErrors, e)
 	}
 
-	// For each recipient, do final spam analysis and delivery.
+	// We send at most one DMARC failure report per message, after delivery.
+	var dmarcFailure *dmarcdb.Failure
+
+	// A reject is recorded at most once per message for the built-in DNSBL server.
+	var dnsblRejectRecorded bool
+
+	// Analysis results of local recipients, for delivery after all recipients have
+	// been analyzed.
+	type recipientAnalysis struct {
+		rcptAcc rcptAccount
+		acc     *store.Account // Set to nil when closed.
+		m       store.Message
+		a       analysis
+		log     mlog.Log
+	}
+	var analyses []recipientAnalysis
+	defer func() {
+		for _, ra := range analyses {
+			if ra.acc != nil {
+				err := ra.acc.Close()
+				ra.log.Check(err, "closing account after delivery")
+			}
+		}
+	}()
+
+	// For each recipient, do final spam analysis.
 	for _, rcptAcc := range c.recipients {
 		log := c.log.With(slog.Any("mailfrom", c.mailFrom), slog.Any("rcptto", rcptAcc.rcptTo))
 
@@ -2533,8 +2846,48 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			msgTo = envelope.To
 			msgCc = envelope.CC
 		}
-		d := delivery{c.tls, &m, dataFile, rcptAcc, acc, msgTo, msgCc, msgFrom, c.dnsBLs, dmarcUse, dmarcResult, dkimResults, iprevStatus}
+		d := delivery{c.tls, &m, dataFile, rcptAcc, acc, msgTo, msgCc, msgFrom, c.dnsBLs, c.domainBLs, c.uriBLs, dmarcUse, dmarcResult, dkimResults, arcTrustedSealer, iprevStatus, c.greylisting}
 		a := analyze(ctx, log, c.resolver, d)
+		analyses = append(analyses, recipientAnalysis{rcptAcc, acc, m, a, log})
+		acc = nil // Closed through analyses.
+	}
+
+	// Greylisting is decided per recipient, but if any recipient is greylisted, the
+	// whole transaction is rejected with a temporary error. Otherwise we would
+	// deliver to the other recipients, and send a DSN for the greylisted recipient,
+	// making the failure permanent. The sender retries the transaction, with all
+	// recipients.
+	for _, ra := range analyses {
+		if ra.a.reason == reasonGreylisted {
+			ra.log.Info("temporarily rejecting transaction for greylisted recipient")
+			metricDelivery.WithLabelValues("reject", ra.a.reason).Inc()
+			xsmtpErrorf(ra.a.code, ra.a.secode, ra.a.userError, "%s", ra.a.errmsg)
+		}
+	}
+
+	// For each local recipient, do delivery.
+	for i := range analyses {
+		ra := &analyses[i]
+		rcptAcc, acc, m, a, log := ra.rcptAcc, ra.acc, ra.m, ra.a, ra.log
+
+		// A message quarantined by a content scanner is kept in the central quarantine
+		// if configured, or delivered to the quarantine mailbox, if it would otherwise be
+		// accepted. Messages matching a hold rule are kept in the central quarantine.
+		var quarantineReason quarantine.Reason
+		var quarantineDetail string
+		if a.accept && scanVerdict.Action == contentscan.ActionQuarantine {
+			if quarantine.Enabled(quarantine.ReasonContentScan) {
+				quarantineReason = quarantine.ReasonContentScan
+				quarantineDetail = scanVerdict.Scanner + ": " + scanVerdict.Message
+			} else {
+				a.mailbox = scanVerdict.Mailbox
+			}
+			a.reason = reasonScanQuarantine
+		} else if a.accept && quarantine.HoldRuleMatch(log, c.mailFrom.String(), rcptAcc.rcptTo.String(), nil, dataFile) {
+			quarantineReason = quarantine.ReasonHold
+			quarantineDetail = "hold rule"
+			a.reason = reasonQuarantineHold
+		}
 
 		// Any DMARC result override is stored in the evaluation for outgoing DMARC
 		// aggregate reports, and added to the Authentication-Results message header.
@@ -2562,6 +2915,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 		rcptAuthResults := authResults
 		rcptAuthResults.Methods = append([]message.AuthMethod{}, authResults.Methods...)
 		rcptAuthResults.Methods = append(rcptAuthResults.Methods, rcptDMARCMethod)
+		rcptAuthResults.Methods = append(rcptAuthResults.Methods, a.authMethods...)
 
 		// Prepend reason as message header, for easy display in mail clients.
 		var xbeacon string
@@ -2569,6 +2923,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			xbeacon = "X-Mox-Reason: " + a.reason + "\r\n"
 		}
 		xbeacon += a.headers
+		xbeacon += scanVerdict.HeaderText()
 
 		// ../rfc/5321:3204
 		// Received-SPF header goes before Received. ../rfc/7208:2038
@@ -2664,7 +3019,7 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 					Policy:          dmarcrpt.Disposition(r.Policy),
 					SubdomainPolicy: sp,
 					Percentage:      r.Percentage,
-					// We don't save ReportingOptions, we don't do per-message failure reporting.
+					// We don't save ReportingOptions, failure reports are sent below.
 				},
 				SourceIP:        c.remoteIP.String(),
 				Disposition:     disposition,
@@ -2715,10 +3070,90 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 			log.Check(err, "adding dmarc evaluation to database for aggregate report")
 		}
 
+		// Send a DMARC failure report if requested by the policy domain, under the same
+		// conditions as for aggregate reports. Not for messages to reporting addresses,
+		// we don't want reporting loops.
+		reportingAddress := rcptAcc.destination.DMARCReports || rcptAcc.destination.HostTLSReports || rcptAcc.destination.DomainTLSReports
+		if dmarcFailure == nil && !reportingAddress && dmarcResult.Record != nil && len(dmarcResult.Record.FailureReportAddresses) > 0 && (dmarcResult.Status == dmarc.StatusPass || dmarcResult.Status == dmarc.StatusFail) && (a.accept && !m.IsReject || a.reason == reasonDMARCPolicy) {
+			deliveryResult := "delivered"
+			if !a.accept {
+				deliveryResult = "reject"
+			}
+			var rcptTo []smtp.Path
+			for _, rcpt := range c.recipients {
+				rcptTo = append(rcptTo, rcpt.rcptTo)
+			}
+			dmarcFailure = &dmarcdb.Failure{
+				PolicyDomain:    dmarcResult.Domain,
+				Record:          dmarcResult.Record,
+				FromDomain:      msgFrom.Domain,
+				AlignedDKIMPass: dmarcResult.AlignedDKIMPass,
+				AlignedSPFPass:  dmarcResult.AlignedSPFPass,
+				DKIMResults:     dkimResults,
+				SPFResult:       receivedSPF.Result,
+				SourceIP:        c.remoteIP,
+				MailFrom:        *c.mailFrom,
+				RcptTo:          rcptTo,
+				Arrival:         m.Received,
+				AuthResults:     rcptAuthResults,
+				DeliveryResult:  deliveryResult,
+				SMTPUTF8:        c.smtputf8,
+			}
+		}
+
+		if !a.accept {
+			switch {
+			case a.reason == reasonDNSBlocklisted && quarantine.Enabled(quarantine.ReasonDNSBL):
+				quarantineReason = quarantine.ReasonDNSBL
+			case (a.reason == reasonJunkContent || a.reason == reasonJunkContentStrict) && quarantine.Enabled(quarantine.ReasonJunk):
+				quarantineReason = quarantine.ReasonJunk
+			}
+			quarantineDetail = a.reason
+		}
+
+		// Quarantined messages are not delivered. Rejected messages are still rejected,
+		// but are kept in the quarantine instead of the rejects mailbox.
+		if quarantineReason != "" {
+			err := quarantine.Add(ctx, log, quarantineReason, quarantineDetail, acc.Name, rcptAcc.rcptTo.String(), m, dataFile)
+			if err != nil {
+				log.Errorx("adding message to quarantine", err)
+				metricDelivery.WithLabelValues("quarantineerror", a.reason).Inc()
+				if a.accept {
+					addError(rcptAcc, smtp.C451LocalErr, smtp.SeSys3Other0, false, "error processing")
+					continue
+				}
+				// Fall back to the rejects mailbox.
+				quarantineReason = ""
+			} else if a.accept {
+				log.Info("incoming message quarantined", slog.String("reason", a.reason), slog.Any("msgfrom", msgFrom))
+				metricDelivery.WithLabelValues("quarantined", a.reason).Inc()
+				continue
+			}
+		}
+
 		if !a.accept {
+			// Only rejects for junk content count towards listing the remote IP in our own
+			// DNSBL, e.g. not rejects because of listings in DNSBLs (listings should not
+			// propagate between block lists), or failing SPF or iprev. Messages rejected with
+			// a temporary error are retried, they are counted once.
+			junkContent := a.reason == reasonJunkContent || a.reason == reasonJunkContentStrict
+			if !dnsblRejectRecorded && a.err == nil && junkContent && !m.IsForward {
+				dnsblRejectRecorded = true
+				if msgID, hash, err := rejectIdentity(log, &m, dataFile); err != nil {
+					log.Errorx("identifying reject message for dnsbl server", err)
+				} else {
+					err := dnsblserver.AddReject(ctx, log, net.ParseIP(m.RemoteIP), rejectKey(msgID, hash))
+					log.Check(err, "recording reject for dnsbl server")
+				}
+			}
+
 			conf, _ := acc.Conf()
-			if conf.RejectsMailbox != "" {
-				present, _, messagehash, err := rejectPresent(log, acc, conf.RejectsMailbox, &m, dataFile)
+			if quarantineReason == "" && conf.RejectsMailbox != "" {
+				var present bool
+				msgID, messagehash, err := rejectIdentity(log, &m, dataFile)
+				if err == nil {
+					present, err = rejectPresent(acc, conf.RejectsMailbox, msgID, messagehash)
+				}
 				if err != nil {
 					log.Errorx("checking whether reject is already present", err)
 				} else if !present {
@@ -2831,11 +3266,22 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 					log.Errorx("removing message from rejects mailbox", err, slog.String("messageid", messageID))
 				}
 			}
+			if beacon.Conf.Static.Quarantine != nil && m.MessageID != "" {
+				if err := quarantine.RemoveDelivered(ctx, log, acc.Name, m.MessageID); err != nil {
+					log.Errorx("removing message from quarantine", err, slog.String("messageid", messageID))
+				}
+			}
 		})
 
-		err = acc.Close()
+		err := acc.Close()
 		log.Check(err, "closing account after delivering")
-		acc = nil
+		ra.acc = nil
+	}
+
+	// Reporting addresses are looked up in DNS, we don't make the remote SMTP client
+	// wait for that.
+	if dmarcFailure != nil {
+		c.sendDMARCFailureReport(*dmarcFailure, dataFile, msgWriter.Size)
 	}
 
 	// If all recipients failed to deliver, return an error.
@@ -2929,6 +3375,44 @@ func (c *conn) deliver(ctx context.Context, recvHdrFor func(string) string, msgW
 	c.writecodeline(smtp.C250Completed, smtp.SeMailbox2Other0, "it is done", nil)
 }
 
+// Pending DMARC failure reports, sent in the background. Tests wait for them.
+var dmarcFailureReports sync.WaitGroup
+
+// sendDMARCFailureReport sends a DMARC failure report for the message in the
+// background. The message file is opened again, the file is removed when the DATA
+// command is done, which can be before the report has read the message.
+func (c *conn) sendDMARCFailureReport(f dmarcdb.Failure, dataFile *os.File, size int64) {
+	log := c.log
+	msgFile, err := os.Open(dataFile.Name())
+	if err != nil {
+		log.Errorx("opening message file for dmarc failure report", err)
+		return
+	}
+	resolver := c.resolver
+
+	dmarcFailureReports.Add(1)
+	go func() {
+		defer dmarcFailureReports.Done()
+		defer func() {
+			x := recover() // Should not happen, but don't take program down if it does.
+			if x != nil {
+				log.Error("dmarc failure report panic", slog.Any("err", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Smtpserver)
+			}
+		}()
+		defer func() {
+			err := msgFile.Close()
+			log.Check(err, "closing message file for dmarc failure report")
+		}()
+
+		ctx, cancel := context.WithTimeout(beacon.Shutdown, time.Minute)
+		defer cancel()
+		err := dmarcdb.SendFailureReport(ctx, log, resolver, f, msgFile, size)
+		log.Check(err, "sending dmarc failure report")
+	}()
+}
+
 // ecode returns either ecode, or a more specific error based on err.
 // For example, ecode can be turned from an "other system" error into a "mail
 // system full" if the error indicates no disk space is available.
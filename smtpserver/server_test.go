@@ -4,6 +4,7 @@ package smtpserver
 // todo: test delivering a message to multiple recipients, and with some of them failing.
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/ed25519"
@@ -13,11 +14,15 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"mime/quotedprintable"
 	"net"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"testing"
@@ -27,12 +32,17 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/qompassai/beacon/arc"
 	"github.com/qompassai/beacon/config"
+	"github.com/qompassai/beacon/contentscan"
 	"github.com/qompassai/beacon/dkim"
 	"github.com/qompassai/beacon/dmarcdb"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/greylist"
+	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/queue"
 	"github.com/qompassai/beacon/sasl"
 	"github.com/qompassai/beacon/smtp"
@@ -83,19 +93,23 @@ test email, unique.
 `, "\n", "\r\n")
 
 type testserver struct {
-	t          *testing.T
-	acc        *store.Account
-	switchStop func()
-	comm       *store.Comm
-	cid        int64
-	resolver   dns.Resolver
-	auth       func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error)
-	user, pass string
-	submission bool
-	requiretls bool
-	dnsbls     []dns.Domain
-	tlsmode    smtpclient.TLSMode
-	tlspkix    bool
+	t            *testing.T
+	acc          *store.Account
+	switchStop   func()
+	comm         *store.Comm
+	cid          int64
+	resolver     dns.Resolver
+	auth         func(mechanisms []string, cs *tls.ConnectionState) (sasl.Client, error)
+	user, pass   string
+	submission   bool
+	requiretls   bool
+	dnsbls       []dns.Domain
+	domainbls    []config.DomainBL
+	uribls       []config.DomainBL
+	greylisting  *config.Greylisting
+	contentScans []config.ContentScan
+	tlsmode      smtpclient.TLSMode
+	tlspkix      bool
 }
 
 func newTestServer(t *testing.T, configPath string, resolver dns.Resolver) *testserver {
@@ -183,7 +197,7 @@ func (ts *testserver) runRaw(fn func(clientConn net.Conn)) {
 		tlsConfig := &tls.Config{
 			Certificates: []tls.Certificate{fakeCert(ts.t)},
 		}
-		serve("test", ts.cid-2, dns.Domain{ASCII: "beacon.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, false, 100<<20, false, false, ts.requiretls, ts.dnsbls, 0)
+		serve("test", ts.cid-2, dns.Domain{ASCII: "beacon.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, false, 100<<20, false, false, ts.requiretls, ts.dnsbls, ts.domainbls, ts.uribls, 0, ts.greylisting, ts.contentScans)
 		close(serverdone)
 	}()
 
@@ -801,6 +815,469 @@ func TestDMARCSent(t *testing.T) {
 	})
 }
 
+// Test that a DMARC failure report is queued for a message failing DMARC.
+func TestDMARCFailureReport(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.1"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.":        {"v=spf1 ip4:127.0.0.1 -all"},
+			"_dmarc.example.org.": {"v=DMARC1;p=reject;ruf=mailto:dmarcfail@example.org"},
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/junk/beacon.conf"), resolver)
+	defer ts.close()
+
+	beacon.Conf.Static.DMARCFailureReports = &config.DMARCFailureReports{}
+	defer func() { beacon.Conf.Static.DMARCFailureReports = nil }()
+
+	ts.run(func(err error, client *smtpclient.Client) {
+		mailFrom := "remote@example.org"
+		rcptTo := "mjl@beacon.example"
+		if err == nil {
+			err = client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+		}
+		var cerr smtpclient.Error
+		if err == nil || !errors.As(err, &cerr) || cerr.Code != smtp.C550MailboxUnavail {
+			t.Fatalf("attempt to deliver message failing dmarc, got err %v, expected smtpclient.Error with code %d", err, smtp.C550MailboxUnavail)
+		}
+	})
+
+	dmarcFailureReports.Wait()
+	msgs, err := queue.List(ctxbg)
+	tcheck(t, err, "listing queue")
+	tcompare(t, len(msgs), 1)
+	tcompare(t, msgs[0].Recipient().String(), "dmarcfail@example.org")
+	tcompare(t, msgs[0].IsDMARCReport, true)
+}
+
+// Test that a valid ARC chain from a trusted sealer overrides a failing DMARC
+// reject policy.
+func TestARC(t *testing.T) {
+	sealKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	record := &dkim.Record{Version: "DKIM1", Key: "ed25519", PublicKey: sealKey.Public()}
+	txt, err := record.Record()
+	tcheck(t, err, "dkim record")
+
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.":  {"127.0.0.10"}, // For mx check.
+			"list.example.": {"127.0.0.10"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.":                 {"v=spf1 ip4:127.0.0.10 -all"},
+			"_dmarc.example.org.":          {"v=DMARC1;p=reject"},
+			"sel._domainkey.list.example.": {txt},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"list.example."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/beacon.conf"), resolver)
+	defer ts.close()
+
+	sel := dkim.Selector{
+		Hash:          "sha256",
+		HeaderRelaxed: true,
+		BodyRelaxed:   true,
+		Headers:       []string{"From", "To", "Subject", "Message-Id"},
+		PrivateKey:    sealKey,
+		Domain:        dns.Domain{ASCII: "sel"},
+	}
+	seal := func(methods ...message.AuthMethod) string {
+		t.Helper()
+		authRes := message.AuthResults{Hostname: "list.example", Methods: methods}
+		arcHeaders, err := arc.Sign(ctxbg, pkglog.Logger, dns.Domain{ASCII: "list.example"}, sel, false, strings.NewReader(deliverMessage), arc.StatusNone, authRes)
+		tcheck(t, err, "arc sign")
+		return arcHeaders + deliverMessage
+	}
+	fromProp := message.MakeAuthProp("header", "from", "example.org", true, "")
+	msg := seal(message.AuthMethod{Method: "dmarc", Result: "pass", Props: []message.AuthProp{fromProp}})
+
+	deliver := func(expCode int) {
+		t.Helper()
+		ts.run(func(err error, client *smtpclient.Client) {
+			t.Helper()
+			if err == nil {
+				err = client.Deliver(ctxbg, "remote@list.example", "mjl@beacon.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+			}
+			var cerr smtpclient.Error
+			if expCode == 0 {
+				tcheck(t, err, "deliver")
+			} else if err == nil || !errors.As(err, &cerr) || cerr.Code != expCode {
+				t.Fatalf("deliver, got err %v, expected smtpclient.Error with code %d", err, expCode)
+			}
+		})
+	}
+
+	// Sealer is not trusted, DMARC policy is enforced.
+	deliver(smtp.C550MailboxUnavail)
+
+	// Trusted sealer, but it did not see an aligned pass, DMARC policy is enforced.
+	beacon.Conf.Static.ARCTrustedSealerDomains = []dns.Domain{{ASCII: "list.example"}}
+	defer func() { beacon.Conf.Static.ARCTrustedSealerDomains = nil }()
+	passmsg := msg
+	msg = seal(message.AuthMethod{Method: "dmarc", Result: "fail", Props: []message.AuthProp{fromProp}})
+	deliver(smtp.C550MailboxUnavail)
+	msg = seal(message.AuthMethod{Method: "dkim", Result: "pass", Props: []message.AuthProp{message.MakeAuthProp("header", "d", "other.example", true, "")}})
+	deliver(smtp.C550MailboxUnavail)
+
+	// Trusted sealer with dmarc pass, message is accepted, treated as forwarded.
+	msg = passmsg
+	deliver(0)
+
+	m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).FilterEqual("Expunged", false).SortDesc("ID").Limit(1).Get()
+	tcheck(t, err, "get delivered message")
+	if !m.IsForward || m.RemoteIPMasked1 != "" {
+		t.Fatalf("message not treated as forwarded: %#v", m)
+	}
+	if !strings.Contains(string(m.MsgPrefix), "arc=pass (sealer list.example, trusted)") {
+		t.Fatalf("missing arc result in message prefix:\n%s", m.MsgPrefix)
+	}
+}
+
+// Test that the authentication results for ARC sets added on submission come
+// from our own topmost Authentication-Results header only.
+func TestReceivedAuthResults(t *testing.T) {
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/beacon.conf"), dns.MockResolver{})
+	defer ts.close()
+
+	hostname := beacon.Conf.Static.HostnameDomain.ASCII
+	header := func(values ...string) textproto.MIMEHeader {
+		return textproto.MIMEHeader{"Authentication-Results": values}
+	}
+	methods := func(ar message.AuthResults) (l []string) {
+		for _, m := range ar.Methods {
+			l = append(l, m.Method+"="+m.Result)
+		}
+		return l
+	}
+
+	ours := hostname + "; auth=pass smtp.mailfrom=mjl@beacon.example; spf=pass smtp.mailfrom=example.org; dkim=pass header.d=example.org; dmarc=pass header.from=example.org"
+	ar := receivedAuthResults(header(ours, "other.example; dmarc=fail header.from=example.org"), false)
+	if ar.Hostname != hostname {
+		t.Fatalf("got hostname %q, expected %q", ar.Hostname, hostname)
+	}
+	if got, exp := methods(ar), []string{"spf=pass", "dkim=pass", "dmarc=pass"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got methods %v, expected %v", got, exp)
+	}
+
+	// Header not added by us, e.g. by the sender.
+	ar = receivedAuthResults(header("other.example; dmarc=pass header.from=example.org", ours), false)
+	if len(ar.Methods) != 0 {
+		t.Fatalf("got methods %v, expected none", methods(ar))
+	}
+
+	ar = receivedAuthResults(header(), false)
+	if len(ar.Methods) != 0 {
+		t.Fatalf("got methods %v, expected none", methods(ar))
+	}
+}
+
+// Test greylisting of messages from senders without reputation.
+func TestGreylist(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.":        {"127.0.0.10"}, // For mx check.
+			"unverified.example.": {"127.0.0.10"},
+			"verified.example.":   {"127.0.0.10"},
+		},
+		TXT: map[string][]string{
+			"example.org.":      {"v=spf1 ip4:127.0.0.10 -all"},
+			"verified.example.": {"v=spf1 ip4:127.0.0.10 -all"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/beacon.conf"), resolver)
+	ts.greylisting = &config.Greylisting{Delay: time.Nanosecond}
+	greylist.Close()
+	defer greylist.Close()
+	defer ts.close()
+
+	deliver := func(mailFrom string, expCode int) {
+		t.Helper()
+		ts.run(func(err error, client *smtpclient.Client) {
+			t.Helper()
+			rcptTo := "mjl@beacon.example"
+			if err == nil {
+				err = client.Deliver(ctxbg, mailFrom, rcptTo, int64(len(deliverMessage)), strings.NewReader(deliverMessage), false, false, false)
+			}
+			var cerr smtpclient.Error
+			if expCode == 0 {
+				tcheck(t, err, "deliver")
+			} else if err == nil || !errors.As(err, &cerr) || cerr.Code != expCode {
+				t.Fatalf("deliver, got err %v, expected smtpclient.Error with code %d", err, expCode)
+			}
+		})
+	}
+
+	// First attempt is greylisted, retry is accepted.
+	deliver("remote@example.org", smtp.C451LocalErr)
+	deliver("remote@example.org", 0)
+
+	// Now known triplet.
+	deliver("remote@example.org", 0)
+
+	// Other sender from SPF-verified domain that passed greylisting is accepted too.
+	deliver("other@example.org", 0)
+
+	// Sender without verified domain is greylisted.
+	deliver("remote@unverified.example", smtp.C451LocalErr)
+
+	// If one recipient of a transaction is greylisted, the whole transaction fails
+	// temporarily, and nothing is delivered. The first recipient is greylisted, the
+	// second is a retry that passes greylisting, after which the sender domain is
+	// known. The retry of the transaction is delivered to all recipients.
+	deliver("remote@verified.example", smtp.C451LocalErr)
+	countMessages := func() int {
+		t.Helper()
+		n, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).Count()
+		tcheck(t, err, "count messages")
+		return n
+	}
+	transaction := func(expCode string) {
+		t.Helper()
+		ts.runRaw(func(conn net.Conn) {
+			t.Helper()
+			defer conn.Close()
+
+			// Plain text SMTP would cause a junk reject, so we start TLS.
+			var br *bufio.Reader
+			command := func(s, expCode string) {
+				t.Helper()
+				if s != "" {
+					_, err := conn.Write([]byte(s))
+					tcheck(t, err, "write")
+				}
+				for {
+					line, err := br.ReadString('\n')
+					tcheck(t, err, "read")
+					if !strings.HasPrefix(line, expCode) {
+						t.Fatalf("got smtp response %q, expected code %s", line, expCode)
+					}
+					if len(line) < 4 || line[3] != '-' {
+						break
+					}
+				}
+			}
+			br = bufio.NewReader(conn)
+			command("", "220")
+			command("EHLO remote.example\r\n", "250")
+			command("STARTTLS\r\n", "220")
+			conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+			br = bufio.NewReader(conn)
+			command("EHLO remote.example\r\n", "250")
+			command("MAIL FROM:<remote@verified.example>\r\n", "250")
+			command("RCPT TO:<mjl@beacon2.example>\r\n", "250")
+			command("RCPT TO:<mjl@beacon.example>\r\n", "250")
+			command("DATA\r\n", "354")
+			msg := strings.Replace(deliverMessage, "To: <mjl@beacon.example>", "To: <mjl@beacon.example>, <mjl@beacon2.example>", 1)
+			command(msg+".\r\n", expCode)
+		})
+	}
+	nmsgs := countMessages()
+	transaction("451")
+	tcompare(t, countMessages(), nmsgs)
+	transaction("250")
+	tcompare(t, countMessages(), nmsgs+2)
+
+	// Greylisted messages are not stored in the rejects mailbox.
+	n, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).FilterNonzero(store.Message{IsReject: true}).Count()
+	tcheck(t, err, "count rejects")
+	tcompare(t, n, 0)
+}
+
+// Test content scanners rejecting, quarantining and adding headers to incoming
+// messages.
+func TestContentScan(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.": {"v=spf1 ip4:127.0.0.10 -all"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/beacon.conf"), resolver)
+	defer ts.close()
+
+	script := `msg=$(cat)
+case "$msg" in
+*EICAR*) echo "virus found"; exit 1;;
+*confidential*) echo '{"Action": "quarantine", "Headers": [{"Name": "X-DLP", "Value": "confidential"}]}';;
+*mailbox:*) mb=$(echo "$msg" | sed -n 's/.*mailbox:\([^ ]*\).*/\1/p'); echo '{"Action": "quarantine", "Mailbox": "'"$mb"'"}';;
+*broken*) exit 3;;
+*) echo '{"Action": "accept", "Headers": [{"Name": "X-Scanned", "Value": "clean"}]}';;
+esac
+`
+	ts.contentScans = []config.ContentScan{{Command: []string{"sh", "-c", script}}}
+
+	deliver := func(text string, expCode int) {
+		t.Helper()
+		msg := strings.ReplaceAll(deliverMessage, "test email", text)
+		ts.run(func(err error, client *smtpclient.Client) {
+			t.Helper()
+			if err == nil {
+				err = client.Deliver(ctxbg, "remote@example.org", "mjl@beacon.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+			}
+			var cerr smtpclient.Error
+			if expCode == 0 {
+				tcheck(t, err, "deliver")
+			} else if err == nil || !errors.As(err, &cerr) || cerr.Code != expCode {
+				t.Fatalf("deliver, got err %v, expected smtpclient.Error with code %d", err, expCode)
+			}
+		})
+	}
+
+	lastMessage := func() (store.Message, string) {
+		t.Helper()
+		m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).SortDesc("ID").Limit(1).Get()
+		tcheck(t, err, "get last message")
+		mb, err := bstore.QueryDB[store.Mailbox](ctxbg, ts.acc.DB).FilterID(m.MailboxID).Get()
+		tcheck(t, err, "get mailbox")
+		return m, mb.Name
+	}
+
+	// Accepted with added header.
+	deliver("clean message", 0)
+	m, mailbox := lastMessage()
+	if mailbox != "Inbox" || !strings.Contains(string(m.MsgPrefix), "X-Scanned: clean\r\n") {
+		t.Fatalf("got mailbox %q, prefix %q, expected inbox and added header", mailbox, m.MsgPrefix)
+	}
+
+	// Rejected.
+	deliver("EICAR test", smtp.C554TransactionFailed)
+
+	// Quarantined.
+	deliver("confidential data", 0)
+	m, mailbox = lastMessage()
+	if mailbox != contentscan.DefaultQuarantineMailbox || !strings.Contains(string(m.MsgPrefix), "X-DLP: confidential\r\n") {
+		t.Fatalf("got mailbox %q, prefix %q, expected quarantine mailbox and added header", mailbox, m.MsgPrefix)
+	}
+
+	// Mailbox chosen by scanner is used if it is valid, otherwise the default
+	// quarantine mailbox.
+	for _, tc := range []struct{ mailbox, exp string }{
+		{"Suspicious/dlp", "Suspicious/dlp"},
+		{"inbox/dlp", "Inbox/dlp"},
+		{"Inbox", contentscan.DefaultQuarantineMailbox},
+		{"/bad", contentscan.DefaultQuarantineMailbox},
+		{"#bad", contentscan.DefaultQuarantineMailbox},
+		{"bad//slashes", contentscan.DefaultQuarantineMailbox},
+	} {
+		deliver("mailbox:"+tc.mailbox+" data", 0)
+		_, mailbox = lastMessage()
+		if mailbox != tc.exp {
+			t.Fatalf("scanner mailbox %q: got mailbox %q, expected %q", tc.mailbox, mailbox, tc.exp)
+		}
+	}
+
+	// Failing scanner, fail open by default.
+	deliver("broken scanner", 0)
+
+	// Fail closed.
+	ts.contentScans[0].FailClosed = true
+	deliver("broken scanner", smtp.C451LocalErr)
+
+	// Not scanned if only for submissions.
+	ts.contentScans[0].NoIncoming = true
+	ts.contentScans = contentScansFor(ts.contentScans, false)
+	deliver("EICAR test", 0)
+}
+
+// Test messages held by hold rules and content scanners in the central
+// quarantine, and releasing them.
+func TestQuarantine(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.": {"127.0.0.10"}, // For mx check.
+		},
+		TXT: map[string][]string{
+			"example.org.": {"v=spf1 ip4:127.0.0.10 -all"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/beacon.conf"), resolver)
+	quarantine.Close()
+	defer quarantine.Close()
+	defer ts.close()
+
+	beacon.Conf.Static.Quarantine = &config.Quarantine{
+		HoldRules: []config.QuarantineHoldRule{
+			{HeadersRegexpCompiled: [][2]*regexp.Regexp{{regexp.MustCompile("^subject$"), regexp.MustCompile("invoice")}}},
+		},
+	}
+	defer func() { beacon.Conf.Static.Quarantine = nil }()
+
+	ts.contentScans = []config.ContentScan{{Command: []string{"sh", "-c", `grep -q confidential && echo '{"Action": "quarantine"}'; exit 0`}}}
+
+	deliver := func(subject string) {
+		t.Helper()
+		msg := strings.ReplaceAll(deliverMessage, "Subject: test", "Subject: "+subject)
+		msg = strings.ReplaceAll(msg, "<test@example.org>", "<"+strings.ReplaceAll(subject, " ", ".")+"@example.org>")
+		ts.run(func(err error, client *smtpclient.Client) {
+			t.Helper()
+			if err == nil {
+				err = client.Deliver(ctxbg, "remote@example.org", "mjl@beacon.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+			}
+			tcheck(t, err, "deliver")
+		})
+	}
+
+	count := func() int {
+		t.Helper()
+		n, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).Count()
+		tcheck(t, err, "count messages")
+		return n
+	}
+
+	deliver("your invoice")
+	deliver("confidential report")
+	tcompare(t, count(), 0)
+
+	l, err := quarantine.List(ctxbg, quarantine.Filter{Account: "mjl"})
+	tcheck(t, err, "list quarantine")
+	tcompare(t, len(l), 2)
+	tcompare(t, l[0].Reason, quarantine.ReasonContentScan)
+	tcompare(t, l[1].Reason, quarantine.ReasonHold)
+	tcompare(t, l[1].Subject, "your invoice")
+	tcompare(t, l[1].RcptTo, "mjl@beacon.example")
+
+	hdrs, err := quarantine.Headers(ctxbg, "mjl", l[1].ID)
+	tcheck(t, err, "headers")
+	if !strings.Contains(hdrs, "Subject: your invoice\r\n") || !strings.Contains(hdrs, "X-Mox-Reason: quarantine-hold\r\n") || strings.Contains(hdrs, "test email") {
+		t.Fatalf("unexpected headers %q", hdrs)
+	}
+
+	// Other accounts cannot access the message.
+	_, err = quarantine.Headers(ctxbg, "other", l[1].ID)
+	if err != quarantine.ErrNotFound {
+		t.Fatalf("got err %v, expected ErrNotFound", err)
+	}
+
+	err = quarantine.Release(ctxbg, pkglog, "mjl", l[1].ID, true)
+	tcheck(t, err, "release")
+	tcompare(t, count(), 1)
+	m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).Get()
+	tcheck(t, err, "get released message")
+	tcompare(t, m.Notjunk, true)
+	tcompare(t, m.Size, l[1].Size)
+
+	err = quarantine.Delete(ctxbg, pkglog, "", l[0].ID)
+	tcheck(t, err, "delete")
+	l, err = quarantine.List(ctxbg, quarantine.Filter{})
+	tcheck(t, err, "list quarantine")
+	tcompare(t, len(l), 0)
+}
+
 // Test DNSBL, then getting through with subjectpass.
 func TestBlocklistedSubjectpass(t *testing.T) {
 	// Set up a DNSBL on dnsbl.example, and get DMARC pass.
@@ -871,6 +1348,64 @@ func TestBlocklistedSubjectpass(t *testing.T) {
 	})
 }
 
+// Test rejecting messages with sender and link domains listed in domain-based
+// block lists, with weights adding up.
+func TestDomainBL(t *testing.T) {
+	resolver := &dns.MockResolver{
+		A: map[string][]string{
+			"example.org.":                {"127.0.0.10"}, // For mx check.
+			"test.dbl.example.":           {"127.0.1.2"},  // For healthcheck.
+			"example.org.dbl.example.":    {"127.0.1.2"},
+			"test.uribl.example.":         {"127.0.0.2"}, // For healthcheck.
+			"spam.example.uribl.example.": {"127.0.0.2"},
+		},
+		TXT: map[string][]string{
+			"example.org.": {"v=spf1 ip4:127.0.0.10 -all"},
+		},
+		PTR: map[string][]string{
+			"127.0.0.10": {"example.org."}, // For iprev check.
+		},
+	}
+	ts := newTestServer(t, filepath.FromSlash("../testdata/smtp/beacon.conf"), resolver)
+	defer ts.close()
+	zone := func(s string) dns.Domain { return dns.Domain{ASCII: s} }
+	_, returnCodes, _ := net.ParseCIDR("127.0.1.0/24")
+	ts.domainbls = []config.DomainBL{{ZoneDomain: zone("dbl.example"), ReturnNets: []net.IPNet{*returnCodes}, Identities: []string{"from"}, Weight: 0.5}}
+	ts.uribls = []config.DomainBL{{ZoneDomain: zone("uribl.example"), Weight: 0.5}}
+
+	deliver := func(msg string, expCode int) {
+		t.Helper()
+		ts.run(func(err error, client *smtpclient.Client) {
+			t.Helper()
+			if err == nil {
+				err = client.Deliver(ctxbg, "remote@example.org", "mjl@beacon.example", int64(len(msg)), strings.NewReader(msg), false, false, false)
+			}
+			var cerr smtpclient.Error
+			if expCode == 0 {
+				tcheck(t, err, "deliver")
+			} else if err == nil || !errors.As(err, &cerr) || cerr.Code != expCode {
+				t.Fatalf("deliver, got err %v, expected smtpclient.Error with code %d", err, expCode)
+			}
+		})
+	}
+
+	// Listing of From domain alone is not enough for a reject.
+	deliver(deliverMessage, 0)
+
+	// The listing is recorded in the Authentication-Results header.
+	m, err := bstore.QueryDB[store.Message](ctxbg, ts.acc.DB).Get()
+	tcheck(t, err, "get message")
+	buf, err := io.ReadAll(ts.acc.MessageReader(m))
+	tcheck(t, err, "read message")
+	if !strings.Contains(string(buf), "x-dnsbl=fail (127.0.1.2) policy.zone=dbl.example policy.from=example.org") {
+		t.Fatalf("missing dnsbl result in message headers: %q", buf)
+	}
+
+	// With a listed link domain, the weights add up to a reject.
+	linkMessage := strings.Replace(deliverMessage2, "test email, unique.", "visit https://www.spam.example/offer now", 1)
+	deliver(linkMessage, smtp.C451LocalErr)
+}
+
 // Test accepting a DMARC report.
 func TestDMARCReport(t *testing.T) {
 	resolver := &dns.MockResolver{
@@ -1195,7 +1730,7 @@ func TestNonSMTP(t *testing.T) {
 		tlsConfig := &tls.Config{
 			Certificates: []tls.Certificate{fakeCert(ts.t)},
 		}
-		serve("test", ts.cid-2, dns.Domain{ASCII: "beacon.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, false, 100<<20, false, false, false, ts.dnsbls, 0)
+		serve("test", ts.cid-2, dns.Domain{ASCII: "beacon.example"}, tlsConfig, serverConn, ts.resolver, ts.submission, false, 100<<20, false, false, false, ts.dnsbls, nil, nil, 0, nil, nil)
 		close(serverdone)
 	}()
 
@@ -1457,7 +1992,7 @@ func TestPostmaster(t *testing.T) {
 		})
 	}
 
-	testDeliver("postmaster", nil)                  // Plain postmaster address without domain.
+	testDeliver("postmaster", nil)                     // Plain postmaster address without domain.
 	testDeliver("postmaster@host.beacon.example", nil) // Postmaster address with configured mail server hostname.
 	testDeliver("postmaster@beacon.example", nil)      // Postmaster address without explicitly configured destination.
 	testDeliver("postmaster@unknown.example", &smtpclient.Error{Code: smtp.C550MailboxUnavail, Secode: smtp.SeAddr1UnknownDestMailbox1})
@@ -712,8 +712,115 @@ type LoginSession struct {
 	csrfToken    CSRFToken
 }
 
+// CalendarReply is a reply sent from webmail to a meeting invitation (iMIP). Used
+// to recognize updates and cancellations for events that were already answered.
+// Only the most recent reply for an event (or single occurrence) is kept.
+type CalendarReply struct {
+	ID           int64
+	UID          string    `bstore:"nonzero,index UID+RecurrenceID"` // Of the event.
+	RecurrenceID string    // Set if the reply was about a single occurrence of a recurring event.
+	Sequence     int       // Of the event that was answered.
+	PartStat     string    `bstore:"nonzero"` // Participation status sent, e.g. "ACCEPTED", "TENTATIVE", "DECLINED".
+	Attendee     string    `bstore:"nonzero"` // Address the reply was sent from.
+	Sent         time.Time `bstore:"nonzero,default now"`
+}
+
+// SavedSearch is a search query saved by the user in webmail, shown as virtual
+// mailbox. The query syntax is parsed by the webmail package.
+type SavedSearch struct {
+	ID      int64
+	Name    string    `bstore:"nonzero,unique"`
+	Search  string    `bstore:"nonzero"`
+	Created time.Time `bstore:"nonzero,default now"`
+}
+
+// Label is a user-defined name and color for a keyword, for display and
+// selection in webmail. Messages are labeled by setting the keyword, so IMAP
+// clients see the labels as keywords.
+type Label struct {
+	ID      int64
+	Name    string `bstore:"nonzero,unique"`
+	Keyword string `bstore:"nonzero,unique"` // Lower-case IMAP keyword.
+	Color   string // HTML color, e.g. "#ff8800", or empty for the default color.
+}
+
+// SubmissionUndo is a message submitted from webmail with a send delay. Until the
+// first delivery attempt, at Until, the submission can be undone, restoring the
+// message as draft.
+type SubmissionUndo struct {
+	ID            int64
+	Until         time.Time `bstore:"nonzero,index"`
+	QueueMsgIDs   []int64   // Messages in the delivery queue, one per recipient.
+	SentMessageID int64     // Copy of the message in the Sent mailbox, 0 if none.
+	Bcc           []string  // Addresses, not in the submitted message, but restored in the draft.
+}
+
+// SubmissionID is a client-generated ID of a message submitted from webmail. A
+// submission with an ID that was seen before is not sent again, e.g. when a client
+// retries a submission after losing the connection while the request was in
+// flight.
+type SubmissionID struct {
+	ID      string
+	Created time.Time `bstore:"nonzero,index"`
+}
+
+// Settings are the webmail preferences of an account. They are stored in the
+// account database, not in the browser, so they apply to all sessions and devices.
+// Only a single record, with ID 1, is stored.
+type Settings struct {
+	ID uint8 // Singleton ID 1. Zero in DefaultSettings.
+
+	// Added below the text of composed messages, also for messages composed by the
+	// server, e.g. replies to calendar invitations.
+	Signature string
+	Quoting   Quoting
+
+	// Address to use as From for new messages. If empty, the login address is used.
+	DefaultFrom string
+
+	// Seconds to delay delivery of submitted messages, during which sending can be
+	// undone in webmail. Zero for immediate delivery.
+	SendDelay int
+
+	Layout         string // "auto", "leftright" or "topbottom".
+	Threading      string // "off", "on" or "unread".
+	OrderAsc       bool   // Show oldest messages first.
+	ShowHTML       bool   // Show HTML version of a message instead of text, if both are present.
+	ShowShortcuts  bool   // Briefly show keyboard shortcut for a button that was clicked.
+	ShowAllHeaders bool
+	ShowHeaders    []string // Additional message headers to show.
+}
+
+// Quoting is the style of quoting the original message in replies.
+type Quoting string
+
+const (
+	Default Quoting = ""       // Bottom-quote if text is selected, top-quote otherwise.
+	Bottom  Quoting = "bottom" // Text is written below the quoted original.
+	Top     Quoting = "top"    // Text is written above the quoted original.
+)
+
+// DefaultSettings are used as long as no settings were saved for an account. Its
+// ID is 0, so clients can recognize that no settings were saved yet.
+var DefaultSettings = Settings{
+	Layout:        "auto",
+	Threading:     "on",
+	ShowShortcuts: true,
+}
+
+// SettingsGet returns the settings of the account, or DefaultSettings if none
+// were saved yet.
+func SettingsGet(tx *bstore.Tx) (Settings, error) {
+	s := Settings{ID: 1}
+	err := tx.Get(&s)
+	if err == bstore.ErrAbsent {
+		return DefaultSettings, nil
+	}
+	return s, err
+}
+
 // Types stored in DB.
-var DBTypes = []any{NextUIDValidity{}, Message{}, Recipient{}, Mailbox{}, Subscription{}, Outgoing{}, Password{}, Subjectpass{}, SyncState{}, Upgrade{}, RecipientDomainTLS{}, DiskUsage{}, LoginSession{}}
+var DBTypes = []any{NextUIDValidity{}, Message{}, Recipient{}, Mailbox{}, Subscription{}, Outgoing{}, Password{}, Subjectpass{}, SyncState{}, Upgrade{}, RecipientDomainTLS{}, DiskUsage{}, LoginSession{}, TOTP{}, AppPassword{}, Contact{}, AddressBook{}, CalendarReply{}, SavedSearch{}, Label{}, Settings{}, SubmissionUndo{}, SubmissionID{}}
 
 // Account holds the information about a user, includings mailboxes, messages, imap subscriptions.
 type Account struct {
@@ -2067,8 +2174,13 @@ func manageAuthCache() {
 
 // OpenEmailAuth opens an account given an email address and password.
 //
+// For web logins, only the account password is accepted, the second factor is
+// checked separately. For other protocols (IMAP, SMTP submission, CardDAV), app
+// passwords are accepted, and the account password is refused if two-factor
+// authentication is enabled for the account or required by its configuration.
+//
 // The email address may contain a catchall separator.
-func OpenEmailAuth(log mlog.Log, email string, password string) (acc *Account, rerr error) {
+func OpenEmailAuth(log mlog.Log, email string, password string, web bool) (acc *Account, rerr error) {
 	acc, _, rerr = OpenEmail(log, email)
 	if rerr != nil {
 		return
@@ -2082,6 +2194,19 @@ func OpenEmailAuth(log mlog.Log, email string, password string) (acc *Account, r
 		}
 	}()
 
+	if !web {
+		if ok, err := acc.appPasswordCheck(context.TODO(), log, email, password); err != nil {
+			return acc, err
+		} else if ok {
+			return acc, nil
+		}
+		if required, err := acc.AppPasswordsRequired(context.TODO()); err != nil {
+			return acc, fmt.Errorf("checking whether app password is required: %v", err)
+		} else if required {
+			return acc, ErrUnknownCredentials
+		}
+	}
+
 	pw, err := bstore.QueryDB[Password](context.TODO(), acc.DB).Get()
 	if err != nil {
 		if err == bstore.ErrAbsent {
@@ -2281,6 +2406,62 @@ func MergeKeywords(l, add []string) ([]string, bool) {
 	return l, changed
 }
 
+// KeywordReplace replaces keyword kw with nkw on all messages and in the
+// keywords of all mailboxes. If nkw is empty, kw is removed. Both must already be
+// lower-case. The returned changes must be broadcast after the transaction is
+// committed.
+func (a *Account) KeywordReplace(tx *bstore.Tx, kw, nkw string) ([]Change, error) {
+	var changes []Change
+
+	q := bstore.QueryTx[Message](tx)
+	q.FilterEqual("Expunged", false)
+	q.FilterFn(func(m Message) bool {
+		return slices.Contains(m.Keywords, kw)
+	})
+	msgs, err := q.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing messages with keyword: %v", err)
+	}
+	var modseq ModSeq
+	for _, m := range msgs {
+		if modseq == 0 {
+			modseq, err = a.NextModSeq(tx)
+			if err != nil {
+				return nil, fmt.Errorf("assigning next modseq: %v", err)
+			}
+		}
+		m.Keywords, _ = RemoveKeywords(m.Keywords, []string{kw})
+		if nkw != "" {
+			m.Keywords, _ = MergeKeywords(m.Keywords, []string{nkw})
+		}
+		m.ModSeq = modseq
+		if err := tx.Update(&m); err != nil {
+			return nil, fmt.Errorf("updating message: %v", err)
+		}
+		changes = append(changes, m.ChangeFlags(m.Flags))
+	}
+
+	mbq := bstore.QueryTx[Mailbox](tx)
+	mbq.FilterFn(func(mb Mailbox) bool {
+		return slices.Contains(mb.Keywords, kw)
+	})
+	mailboxes, err := mbq.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing mailboxes with keyword: %v", err)
+	}
+	for _, mb := range mailboxes {
+		mb.Keywords, _ = RemoveKeywords(mb.Keywords, []string{kw})
+		if nkw != "" {
+			mb.Keywords, _ = MergeKeywords(mb.Keywords, []string{nkw})
+		}
+		if err := tx.Update(&mb); err != nil {
+			return nil, fmt.Errorf("updating mailbox: %v", err)
+		}
+		changes = append(changes, mb.ChangeKeywords())
+	}
+	return changes, nil
+}
+
 // CheckKeyword returns an error if kw is not a valid keyword. Kw should
 // already be in lower-case.
 func CheckKeyword(kw string) error {
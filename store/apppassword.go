@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/mlog"
+)
+
+// Maximum number of app passwords per account. Each is checked with bcrypt when
+// authenticating, so the number is kept small.
+const appPasswordsMax = 20
+
+var ErrAppPasswordsMax = errors.New("maximum number of app passwords reached")
+
+// AppPassword is a randomly generated password for use with IMAP, SMTP submission
+// and CardDAV, typically one per device or application. When two-factor
+// authentication is enabled for an account, or required by its configuration, the
+// account password is only accepted for web logins, and these protocols require
+// an app password instead. App passwords can be removed individually, e.g. when a
+// device is lost.
+type AppPassword struct {
+	ID      int64
+	Created time.Time `bstore:"default now"`
+
+	// Description, e.g. the name of the device.
+	Name string `bstore:"nonzero"`
+
+	// Bcrypt hash of the password, never returned to clients.
+	Hash string `bstore:"nonzero" json:"-"`
+
+	// Last successful authentication with a not recently used password. Not
+	// updated for each authentication, successful authentications are cached for a
+	// while.
+	LastUsed time.Time
+}
+
+// AppPasswordsRequired returns whether the account password is refused for IMAP,
+// SMTP submission and CardDAV, i.e. whether two-factor authentication is enabled
+// for the account, or required by its configuration.
+func (a *Account) AppPasswordsRequired(ctx context.Context) (bool, error) {
+	accConf, _ := beacon.Conf.Account(a.Name)
+	if accConf.RequireTOTP {
+		return true, nil
+	}
+	enabled, _, err := a.TOTPStatus(ctx)
+	return enabled, err
+}
+
+// AppPasswordList returns the app passwords of the account.
+func (a *Account) AppPasswordList(ctx context.Context) ([]AppPassword, error) {
+	return bstore.QueryDB[AppPassword](ctx, a.DB).SortAsc("ID").List()
+}
+
+// AppPasswordAdd generates and stores a new app password, returning it in plain
+// text. It is not stored in plain text, so can only be shown to the user once.
+func (a *Account) AppPasswordAdd(ctx context.Context, log mlog.Log, name string) (password string, rerr error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name required")
+	}
+
+	// 4 groups of 4 characters, 80 bits.
+	var buf [10]byte
+	if _, err := cryptorand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("generating app password: %v", err)
+	}
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(buf[:]))
+	password = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hashing app password: %v", err)
+	}
+
+	err = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		n, err := bstore.QueryTx[AppPassword](tx).Count()
+		if err != nil {
+			return err
+		} else if n >= appPasswordsMax {
+			return ErrAppPasswordsMax
+		}
+		return tx.Insert(&AppPassword{Name: name, Hash: string(hash)})
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Info("app password added", slog.String("account", a.Name), slog.String("name", name))
+	return password, nil
+}
+
+// AppPasswordRemove removes an app password. Connections that authenticated with
+// it are not closed.
+func (a *Account) AppPasswordRemove(ctx context.Context, log mlog.Log, id int64) error {
+	ap := AppPassword{ID: id}
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if err := tx.Get(&ap); err != nil {
+			return err
+		}
+		return tx.Delete(&ap)
+	})
+	if err != nil {
+		return err
+	}
+	authCacheRemove(ap.Hash)
+	log.Info("app password removed", slog.String("account", a.Name), slog.String("name", ap.Name))
+	return nil
+}
+
+// appPasswordCheck returns whether password matches one of the app passwords of
+// the account. On a match not in the auth cache, the last use is updated.
+func (a *Account) appPasswordCheck(ctx context.Context, log mlog.Log, email, password string) (bool, error) {
+	aps, err := a.AppPasswordList(ctx)
+	if err != nil {
+		return false, fmt.Errorf("listing app passwords: %v", err)
+	}
+
+	authCache.Lock()
+	for _, ap := range aps {
+		if len(password) >= 8 && authCache.success[authKey{email, ap.Hash}] == password {
+			authCache.Unlock()
+			return true, nil
+		}
+	}
+	authCache.Unlock()
+
+	for _, ap := range aps {
+		if err := bcrypt.CompareHashAndPassword([]byte(ap.Hash), []byte(password)); err != nil {
+			continue
+		}
+		authCache.Lock()
+		authCache.success[authKey{email, ap.Hash}] = password
+		authCache.Unlock()
+
+		ap.LastUsed = time.Now()
+		err := a.DB.Update(ctx, &ap)
+		log.Check(err, "updating last use of app password")
+		return true, nil
+	}
+	return false, nil
+}
+
+// authCacheRemove removes cached successful authentications for a password hash,
+// e.g. after the app password was removed.
+func authCacheRemove(hash string) {
+	authCache.Lock()
+	defer authCache.Unlock()
+	for k := range authCache.success {
+		if k.hash == hash {
+			delete(authCache.success, k)
+		}
+	}
+}
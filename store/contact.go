@@ -0,0 +1,150 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/vcard"
+)
+
+// Maximum size of a vCard for a contact.
+const ContactMaxSize = 1024 * 1024
+
+var (
+	ErrContactUID = errors.New("another contact with the same uid exists")
+)
+
+// Contact is an entry in the address book of the account, stored as vCard. Each
+// account has a single address book, managed in webmail and synchronized with
+// CardDAV clients.
+type Contact struct {
+	ID      int64
+	Created time.Time `bstore:"default now"`
+	Updated time.Time `bstore:"default now"`
+
+	// Name of the CardDAV resource within the address book collection, e.g.
+	// "<uid>.vcf". Chosen by CardDAV clients when creating contacts.
+	Resource string `bstore:"nonzero,unique"`
+
+	// UID from vCard, unique within the address book.
+	UID string `bstore:"nonzero,unique"`
+
+	// From vCard FN (formatted name), and lower-case EMAIL properties. Kept for
+	// listing and searching without parsing the vCard.
+	Name   string
+	Emails []string
+
+	// Full vCard, as stored by a CardDAV client, or generated by webmail.
+	VCard string `bstore:"nonzero"`
+}
+
+// ETag returns the entity tag for the contact, for CardDAV, including quotes.
+func (c Contact) ETag() string {
+	h := sha256.Sum256([]byte(c.VCard))
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+// AddressBook holds the state of the address book. There is a single record, with
+// ID 1, added when the first contact is stored.
+type AddressBook struct {
+	ID int64
+
+	// Incremented on each change to contacts in the address book. Used by CardDAV
+	// clients to quickly determine whether they need to synchronize, e.g. through
+	// the "getctag" property.
+	Changes int64
+}
+
+// ContactPut parses data as vCard and stores it under resource, adding or
+// replacing a contact. If a contact with the same UID exists under a different
+// resource, ErrContactUID is returned. Errors about the vCard wrap
+// vcard.ErrSyntax.
+func ContactPut(tx *bstore.Tx, resource, data string) (c Contact, created bool, rerr error) {
+	if len(data) > ContactMaxSize {
+		return Contact{}, false, fmt.Errorf("%w: vcard too large", vcard.ErrSyntax)
+	}
+	card, err := vcard.Parse(data)
+	if err != nil {
+		return Contact{}, false, err
+	}
+	uid := card.Text("UID")
+	if uid == "" {
+		return Contact{}, false, fmt.Errorf("%w: missing uid", vcard.ErrSyntax)
+	}
+
+	c, err = bstore.QueryTx[Contact](tx).FilterNonzero(Contact{Resource: resource}).Get()
+	if err == bstore.ErrAbsent {
+		created = true
+	} else if err != nil {
+		return Contact{}, false, fmt.Errorf("looking up contact: %v", err)
+	}
+
+	exists, err := bstore.QueryTx[Contact](tx).FilterNonzero(Contact{UID: uid}).FilterNotEqual("Resource", resource).Exists()
+	if err != nil {
+		return Contact{}, false, fmt.Errorf("looking up contact by uid: %v", err)
+	} else if exists {
+		return Contact{}, false, ErrContactUID
+	}
+
+	c.Resource = resource
+	c.UID = uid
+	c.Name = card.Text("FN")
+	c.Emails = nil
+	for _, e := range card.Texts("EMAIL") {
+		c.Emails = append(c.Emails, strings.ToLower(strings.TrimPrefix(e, "mailto:")))
+	}
+	c.VCard = data
+	c.Updated = time.Now()
+	if created {
+		err = tx.Insert(&c)
+	} else {
+		err = tx.Update(&c)
+	}
+	if err != nil {
+		return Contact{}, false, fmt.Errorf("storing contact: %v", err)
+	}
+	if err := addressBookChanged(tx); err != nil {
+		return Contact{}, false, err
+	}
+	return c, created, nil
+}
+
+// ContactRemove removes a contact.
+func ContactRemove(tx *bstore.Tx, c Contact) error {
+	if err := tx.Delete(&c); err != nil {
+		return fmt.Errorf("removing contact: %v", err)
+	}
+	return addressBookChanged(tx)
+}
+
+func addressBookChanged(tx *bstore.Tx) error {
+	ab := AddressBook{ID: 1}
+	err := tx.Get(&ab)
+	if err == bstore.ErrAbsent {
+		ab.Changes = 1
+		err = tx.Insert(&ab)
+	} else if err == nil {
+		ab.Changes++
+		err = tx.Update(&ab)
+	}
+	if err != nil {
+		return fmt.Errorf("updating address book: %v", err)
+	}
+	return nil
+}
+
+// AddressBookChanges returns the number of changes made to the address book.
+func AddressBookChanges(tx *bstore.Tx) (int64, error) {
+	ab := AddressBook{ID: 1}
+	err := tx.Get(&ab)
+	if err == bstore.ErrAbsent {
+		return 0, nil
+	}
+	return ab.Changes, err
+}
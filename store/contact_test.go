@@ -0,0 +1,83 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/vcard"
+)
+
+func TestContact(t *testing.T) {
+	log := mlog.New("store", nil)
+	os.RemoveAll("../testdata/store/data")
+	beacon.ConfigStaticPath = filepath.FromSlash("../testdata/store/beacon.conf")
+	beacon.MustLoadConfig(true, false)
+	acc, err := OpenAccount(log, "mjl")
+	tcheck(t, err, "open account")
+	defer func() {
+		err = acc.Close()
+		tcheck(t, err, "closing account")
+	}()
+	defer Switchboard()()
+
+	const card1 = "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:uid1\r\nFN:Jane Doe\r\nEMAIL:Jane@Example.org\r\nEND:VCARD\r\n"
+	const card2 = "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:uid2\r\nFN:John\r\nEND:VCARD\r\n"
+
+	var c1 Contact
+	err = acc.DB.Write(ctxbg, func(tx *bstore.Tx) error {
+		var created bool
+		c1, created, err = ContactPut(tx, "a.vcf", card1)
+		tcheck(t, err, "put contact")
+		if !created || c1.Name != "Jane Doe" || len(c1.Emails) != 1 || c1.Emails[0] != "jane@example.org" || c1.VCard != card1 {
+			t.Fatalf("unexpected contact %#v, created %v", c1, created)
+		}
+
+		// Replace, same resource.
+		c, created, err := ContactPut(tx, "a.vcf", card1)
+		tcheck(t, err, "put contact")
+		if created || c.ID != c1.ID {
+			t.Fatalf("contact not replaced, created %v, id %d", created, c.ID)
+		}
+
+		// Same UID under different resource.
+		_, _, err = ContactPut(tx, "b.vcf", card1)
+		if !errors.Is(err, ErrContactUID) {
+			t.Fatalf("got err %v, expected ErrContactUID", err)
+		}
+
+		// Bad vcard.
+		_, _, err = ContactPut(tx, "b.vcf", "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:x\r\nEND:VCARD\r\n")
+		if !errors.Is(err, vcard.ErrSyntax) {
+			t.Fatalf("got err %v, expected ErrSyntax", err)
+		}
+
+		_, _, err = ContactPut(tx, "b.vcf", card2)
+		tcheck(t, err, "put contact")
+
+		n, err := AddressBookChanges(tx)
+		tcheck(t, err, "address book changes")
+		if n != 3 {
+			t.Fatalf("got %d address book changes, expected 3", n)
+		}
+
+		err = ContactRemove(tx, c1)
+		tcheck(t, err, "remove contact")
+		count, err := bstore.QueryTx[Contact](tx).Count()
+		tcheck(t, err, "count contacts")
+		if count != 1 {
+			t.Fatalf("got %d contacts, expected 1", count)
+		}
+		return nil
+	})
+	tcheck(t, err, "write")
+
+	if c1.ETag() == (Contact{VCard: card2}).ETag() {
+		t.Fatalf("same etag for different vcards")
+	}
+}
@@ -109,6 +109,31 @@ func (a DirArchiver) Close() error {
 // file "errors.txt" is added to the archive describing the errors. The goal is to
 // let users export (hopefully) most messages even in the face of errors.
 func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir string, archiver Archiver, maildir bool, mailboxOpt string) error {
+	return exportMessages(ctx, log, db, accountDir, archiver, maildir, mailboxOpt, ExportSelection{}, nil)
+}
+
+// ExportSelection selects messages to export with ExportSelected. Messages
+// matching any of the fields are exported.
+type ExportSelection struct {
+	MessageIDs []int64 // Individual messages.
+	ThreadIDs  []int64 // All messages of threads, in any mailbox.
+	MailboxIDs []int64 // All messages in mailboxes.
+}
+
+// ExportSelected is like ExportMessages, but exports only the messages from
+// selection, which must not be empty. Messages are stored in archiver under the
+// name of their mailbox, like ExportMessages does.
+//
+// If progress is not nil, it is called after each exported message, with the
+// number of messages exported so far and the total number of messages.
+func ExportSelected(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir string, archiver Archiver, maildir bool, selection ExportSelection, progress func(exported, total int)) error {
+	if len(selection.MessageIDs) == 0 && len(selection.ThreadIDs) == 0 && len(selection.MailboxIDs) == 0 {
+		return fmt.Errorf("no messages selected")
+	}
+	return exportMessages(ctx, log, db, accountDir, archiver, maildir, "", selection, progress)
+}
+
+func exportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir string, archiver Archiver, maildir bool, mailboxOpt string, selection ExportSelection, progress func(exported, total int)) error {
 	// todo optimize: should prepare next file to add to archive (can be an mbox with many messages) while writing a file to the archive (which typically compresses, which takes time).
 
 	// Start transaction without closure, we are going to close it early, but don't
@@ -170,14 +195,59 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 		mailboxOrder[mbID] = i
 	}
 
-	// Fetch all messages. This can take quite a bit of memory if the mailbox is large.
-	q := bstore.QueryTx[Message](tx)
-	if mailboxID > 0 {
-		q.FilterNonzero(Message{MailboxID: mailboxID})
+	for _, mbID := range selection.MailboxIDs {
+		if _, ok := id2name[mbID]; !ok {
+			return fmt.Errorf("mailbox not found")
+		}
 	}
-	msgs, err := q.List()
-	if err != nil {
-		return fmt.Errorf("listing messages: %v", err)
+
+	// Fetch all messages. This can take quite a bit of memory if the mailbox is large.
+	var msgs []Message
+	if len(selection.MessageIDs) == 0 && len(selection.ThreadIDs) == 0 && len(selection.MailboxIDs) == 0 {
+		q := bstore.QueryTx[Message](tx)
+		q.FilterEqual("Expunged", false)
+		if mailboxID > 0 {
+			q.FilterNonzero(Message{MailboxID: mailboxID})
+		}
+		msgs, err = q.List()
+		if err != nil {
+			return fmt.Errorf("listing messages: %v", err)
+		}
+	} else {
+		// Messages can match multiple parts of the selection, we only export them once.
+		seen := map[int64]bool{}
+		add := func(q *bstore.Query[Message]) error {
+			q.FilterEqual("Expunged", false)
+			return q.ForEach(func(m Message) error {
+				if !seen[m.ID] {
+					seen[m.ID] = true
+					msgs = append(msgs, m)
+				}
+				return nil
+			})
+		}
+		anys := func(l []int64) []any {
+			r := make([]any, len(l))
+			for i, v := range l {
+				r[i] = v
+			}
+			return r
+		}
+		if len(selection.MessageIDs) > 0 {
+			if err := add(bstore.QueryTx[Message](tx).FilterIDs(selection.MessageIDs)); err != nil {
+				return fmt.Errorf("listing selected messages: %v", err)
+			}
+		}
+		if len(selection.ThreadIDs) > 0 {
+			if err := add(bstore.QueryTx[Message](tx).FilterEqual("ThreadID", anys(selection.ThreadIDs)...)); err != nil {
+				return fmt.Errorf("listing messages of threads: %v", err)
+			}
+		}
+		if len(selection.MailboxIDs) > 0 {
+			if err := add(bstore.QueryTx[Message](tx).FilterEqual("MailboxID", anys(selection.MailboxIDs)...)); err != nil {
+				return fmt.Errorf("listing messages of mailboxes: %v", err)
+			}
+		}
 	}
 
 	// Close transaction. We don't want to hold it for too long. We are now at risk
@@ -368,6 +438,9 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 			if m.Flags.MDNSent {
 				name += maildirFlag("$MDNSent")
 			}
+			for _, kw := range m.Keywords {
+				name += maildirFlag(kw)
+			}
 
 			p = filepath.Join(p, name)
 
@@ -456,6 +529,7 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 		if m.MDNSent {
 			xkeywords = append(xkeywords, "$MDNSent")
 		}
+		xkeywords = append(xkeywords, m.Keywords...)
 		if len(xkeywords) > 0 {
 			if _, err := fmt.Fprintf(mboxwriter, "X-Keywords: %s\n", strings.Join(xkeywords, ",")); err != nil {
 				return fmt.Errorf("writing x-keywords header: %v", err)
@@ -504,7 +578,10 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 		return nil
 	}
 
-	for _, m := range msgs {
+	for i, m := range msgs {
+		if progress != nil && i > 0 {
+			progress(i, len(msgs))
+		}
 		if m.MailboxID != curMailboxID {
 			if err := finishMailbox(); err != nil {
 				return err
@@ -540,6 +617,9 @@ func ExportMessages(ctx context.Context, log mlog.Log, db *bstore.DB, accountDir
 	if err := finishMailbox(); err != nil {
 		return err
 	}
+	if progress != nil && len(msgs) > 0 {
+		progress(len(msgs), len(msgs))
+	}
 
 	if errors != "" {
 		w, err := archiver.Create("errors.txt", int64(len(errors)), time.Now())
@@ -11,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/exp/slices"
+
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
 )
@@ -118,4 +120,44 @@ func TestExport(t *testing.T) {
 
 	checkDirFiles(filepath.FromSlash("../testdata/exportmaildir"), 2)
 	checkDirFiles(filepath.FromSlash("../testdata/exportmbox"), 2)
+
+	// Export selected message, with keyword, in maildir with dovecot-keywords.
+	m.Keywords = []string{"$label1"}
+	err = acc.DB.Update(ctxbg, &m)
+	tcheck(t, err, "update message keywords")
+	var selZip bytes.Buffer
+	var progress []int
+	archiver := ZipArchiver{zip.NewWriter(&selZip)}
+	err = ExportSelected(ctxbg, log, acc.DB, acc.Dir, archiver, true, ExportSelection{MessageIDs: []int64{m.ID}}, func(exported, total int) {
+		progress = append(progress, exported, total)
+	})
+	tcheck(t, err, "export selected")
+	err = archiver.Close()
+	tcheck(t, err, "archiver close")
+	if !slices.Equal(progress, []int{1, 1}) {
+		t.Fatalf("got progress %v, expected [1 1]", progress)
+	}
+	r, err := zip.NewReader(bytes.NewReader(selZip.Bytes()), int64(selZip.Len()))
+	tcheck(t, err, "reading maildir zip")
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if f.Name == "Trash/dovecot-keywords" {
+			fr, err := f.Open()
+			tcheck(t, err, "open dovecot-keywords")
+			buf, err := io.ReadAll(fr)
+			tcheck(t, err, "read dovecot-keywords")
+			if string(buf) != "0 $label1\n" {
+				t.Fatalf("got dovecot-keywords %q, expected keyword", buf)
+			}
+		}
+	}
+	if len(names) != 3+2 || !slices.Contains(names, "Trash/dovecot-keywords") {
+		t.Fatalf("selected maildir zip, expected 3 dirs, message and dovecot-keywords, got %v", names)
+	}
+
+	err = ExportSelected(ctxbg, log, acc.DB, acc.Dir, archiver, true, ExportSelection{}, nil)
+	if err == nil {
+		t.Fatalf("export with empty selection, expected error")
+	}
 }
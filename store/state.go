@@ -105,6 +105,23 @@ type ChangeMailboxKeywords struct {
 	Keywords    []string
 }
 
+// ChangeSettings is sent when the webmail settings of an account are saved.
+type ChangeSettings struct {
+	Settings Settings
+}
+
+// ChangeLabels is sent when a label is created, changed or removed. It has all
+// labels of the account.
+type ChangeLabels struct {
+	Labels []Label
+}
+
+// ChangeSubmissionUndoEnd is sent when delivery of a message submitted with a send
+// delay starts, after which the submission can no longer be undone.
+type ChangeSubmissionUndoEnd struct {
+	ID int64 // ID of SubmissionUndo.
+}
+
 var switchboardBusy atomic.Bool
 
 // Switchboard distributes changes to accounts to interested listeners. See Comm and Change.
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/mlog"
+)
+
+// TLSPublicKeyFingerprint returns the fingerprint of the public key of a TLS
+// certificate, as registered with accounts in the configuration: the SHA-256 hash
+// of the DER-encoded SubjectPublicKeyInfo, in lower case hex.
+func TLSPublicKeyFingerprint(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(h[:])
+}
+
+// OpenTLSClientCert opens the account that registered the public key of the TLS
+// client certificate of a connection, for authentication with SASL mechanism
+// EXTERNAL. The certificate itself is not verified, e.g. its expiration time or
+// signature by a CA is not checked, only its public key is matched.
+//
+// If authz, the requested authorization identity, is not empty, it must match
+// the login address registered with the key. On success, the login address is
+// returned. If no key matches, ErrUnknownCredentials is returned.
+func OpenTLSClientCert(log mlog.Log, cs tls.ConnectionState, authz string) (acc *Account, loginAddress string, rerr error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, "", fmt.Errorf("%w: no tls client certificate", ErrUnknownCredentials)
+	}
+	fp := TLSPublicKeyFingerprint(cs.PeerCertificates[0])
+	accountName, key, ok := beacon.Conf.TLSPublicKey(fp)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: tls public key %s not registered", ErrUnknownCredentials, fp)
+	}
+	if authz != "" && !strings.EqualFold(authz, key.LoginAddress) {
+		return nil, "", fmt.Errorf("%w: authorization identity %q does not match login address for tls public key", ErrUnknownCredentials, authz)
+	}
+	acc, err := OpenAccount(log, accountName)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Debug("authenticated with tls client certificate", slog.String("account", accountName), slog.String("keyname", key.Name))
+	return acc, key.LoginAddress, nil
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/totp"
+)
+
+// Number of recovery codes generated when enrolling, or when regenerating them.
+const totpRecoveryCodes = 10
+
+var (
+	ErrTOTPEnabled    = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnabled = errors.New("two-factor authentication not enabled")
+	ErrTOTPNotStarted = errors.New("two-factor authentication enrollment not started")
+	ErrTOTPInvalid    = errors.New("invalid two-factor authentication code")
+)
+
+// TOTP holds the second authentication factor, time-based one-time passwords
+// (RFC 6238) from an authenticator app, for web logins (webmail, webaccount).
+// Once enabled, IMAP, SMTP submission and CardDAV require an AppPassword instead
+// of the account password. At most one record exists, with ID 1, created when
+// enrollment starts.
+type TOTP struct {
+	ID      int
+	Created time.Time `bstore:"default now"`
+
+	// Shared secret, as configured in the authenticator app.
+	Secret []byte `bstore:"nonzero"`
+
+	// Only set after a valid code was entered for the secret, completing enrollment.
+	// Only then is a code required for logging in.
+	Enabled bool
+
+	// Time step counter of the most recently used code. Codes for this or earlier time
+	// steps are refused, so an observed code cannot be used again.
+	LastCounter int64
+
+	// SHA-256 hashes, hex-encoded, of recovery codes that have not been used yet. A
+	// recovery code can be used once instead of a TOTP code, e.g. after losing the
+	// device with the authenticator app.
+	RecoveryCodeHashes []string
+}
+
+// TOTPStatus returns whether TOTP is enabled for the account, and the number of
+// unused recovery codes.
+func (a *Account) TOTPStatus(ctx context.Context) (enabled bool, recoveryCodes int, rerr error) {
+	t := TOTP{ID: 1}
+	err := a.DB.Get(ctx, &t)
+	if err == bstore.ErrAbsent {
+		return false, 0, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	return t.Enabled, len(t.RecoveryCodeHashes), nil
+}
+
+// TOTPEnrollStart generates a new secret for the account, replacing any pending
+// enrollment. The enrollment must be completed with TOTPEnrollFinish. If TOTP is
+// already enabled, ErrTOTPEnabled is returned.
+func (a *Account) TOTPEnrollStart(ctx context.Context) (secret []byte, rerr error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		t := TOTP{ID: 1}
+		err := tx.Get(&t)
+		if err == nil && t.Enabled {
+			return ErrTOTPEnabled
+		} else if err == nil {
+			if err := tx.Delete(&t); err != nil {
+				return fmt.Errorf("removing pending enrollment: %v", err)
+			}
+		} else if err != bstore.ErrAbsent {
+			return err
+		}
+		return tx.Insert(&TOTP{ID: 1, Secret: secret})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// TOTPEnrollFinish completes enrollment if code is valid for the pending secret,
+// and returns newly generated recovery codes. From now on, web logins require a
+// TOTP code.
+func (a *Account) TOTPEnrollFinish(ctx context.Context, log mlog.Log, code string) (recoveryCodes []string, rerr error) {
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		t := TOTP{ID: 1}
+		if err := tx.Get(&t); err == bstore.ErrAbsent {
+			return ErrTOTPNotStarted
+		} else if err != nil {
+			return err
+		} else if t.Enabled {
+			return ErrTOTPEnabled
+		}
+
+		counter, err := totp.Verify(t.Secret, code, time.Now(), 1)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrTOTPInvalid, err)
+		}
+
+		var hashes []string
+		recoveryCodes, hashes, err = makeRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		t.Enabled = true
+		t.LastCounter = counter
+		t.RecoveryCodeHashes = hashes
+		return tx.Update(&t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info("two-factor authentication enabled for account", slog.String("account", a.Name))
+	return recoveryCodes, nil
+}
+
+// TOTPVerify checks code, either a TOTP code or an unused recovery code, for an
+// account with TOTP enabled. A used recovery code is removed. ErrTOTPInvalid is
+// returned for invalid codes, ErrTOTPNotEnabled if TOTP is not enabled.
+func (a *Account) TOTPVerify(ctx context.Context, log mlog.Log, code string) error {
+	return a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		return totpVerify(tx, log, a.Name, code)
+	})
+}
+
+func totpVerify(tx *bstore.Tx, log mlog.Log, accountName, code string) error {
+	t := TOTP{ID: 1}
+	if err := tx.Get(&t); err == bstore.ErrAbsent {
+		return ErrTOTPNotEnabled
+	} else if err != nil {
+		return err
+	} else if !t.Enabled {
+		return ErrTOTPNotEnabled
+	}
+
+	counter, err := totp.Verify(t.Secret, code, time.Now(), 1)
+	if err == nil {
+		if counter <= t.LastCounter {
+			return fmt.Errorf("%w: code already used", ErrTOTPInvalid)
+		}
+		t.LastCounter = counter
+		return tx.Update(&t)
+	}
+
+	// Try as recovery code.
+	h := recoveryCodeHash(code)
+	for i, rh := range t.RecoveryCodeHashes {
+		if subtle.ConstantTimeCompare([]byte(rh), []byte(h)) == 1 {
+			t.RecoveryCodeHashes = append(t.RecoveryCodeHashes[:i], t.RecoveryCodeHashes[i+1:]...)
+			log.Info("two-factor authentication recovery code used", slog.String("account", accountName), slog.Int("remaining", len(t.RecoveryCodeHashes)))
+			return tx.Update(&t)
+		}
+	}
+	return ErrTOTPInvalid
+}
+
+// TOTPRecoveryCodesReset replaces the recovery codes with newly generated codes,
+// after verifying code.
+func (a *Account) TOTPRecoveryCodesReset(ctx context.Context, log mlog.Log, code string) (recoveryCodes []string, rerr error) {
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if err := totpVerify(tx, log, a.Name, code); err != nil {
+			return err
+		}
+		t := TOTP{ID: 1}
+		if err := tx.Get(&t); err != nil {
+			return err
+		}
+		var hashes []string
+		var err error
+		recoveryCodes, hashes, err = makeRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		t.RecoveryCodeHashes = hashes
+		return tx.Update(&t)
+	})
+	return recoveryCodes, err
+}
+
+// TOTPRemove disables TOTP for the account, removing the secret and any pending
+// enrollment. If code is not empty, it is verified first. Admins can remove TOTP
+// without code, e.g. for a user who lost their authenticator app and recovery
+// codes.
+func (a *Account) TOTPRemove(ctx context.Context, log mlog.Log, code string) error {
+	err := a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		if code != "" {
+			if err := totpVerify(tx, log, a.Name, code); err != nil {
+				return err
+			}
+		}
+		_, err := bstore.QueryTx[TOTP](tx).Delete()
+		return err
+	})
+	if err == nil {
+		log.Info("two-factor authentication removed for account", slog.String("account", a.Name))
+	}
+	return err
+}
+
+// makeRecoveryCodes returns new random recovery codes of the form xxxxx-xxxxx (50
+// bits) and their hashes.
+func makeRecoveryCodes() (codes, hashes []string, rerr error) {
+	for i := 0; i < totpRecoveryCodes; i++ {
+		var buf [10]byte
+		if _, err := cryptorand.Read(buf[:]); err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %v", err)
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(buf[:]))[:10]
+		code := s[:5] + "-" + s[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, recoveryCodeHash(code))
+	}
+	return codes, hashes, nil
+}
+
+// recoveryCodeHash returns the hex-encoded SHA-256 hash of a normalized recovery
+// code. Recovery codes are randomly generated with enough entropy that a plain
+// hash is sufficient.
+func recoveryCodeHash(code string) string {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(code)))
+}
@@ -34,9 +34,7 @@ func (a *Account) OpenJunkFilter(ctx context.Context, log mlog.Log) (*junk.Filte
 		return nil, jf, ErrNoJunkFilter
 	}
 
-	basePath := beacon.DataDirPath("accounts")
-	dbPath := filepath.Join(basePath, a.Name, "junkfilter.db")
-	bloomPath := filepath.Join(basePath, a.Name, "junkfilter.bloom")
+	dbPath, bloomPath := a.junkFilterPaths()
 
 	if _, xerr := os.Stat(dbPath); xerr != nil && os.IsNotExist(xerr) {
 		f, err := junk.NewFilter(ctx, log, jf.Params, dbPath, bloomPath)
@@ -46,6 +44,159 @@ func (a *Account) OpenJunkFilter(ctx context.Context, log mlog.Log) (*junk.Filte
 	return f, jf, err
 }
 
+// junkFilterPaths returns the paths to the database and bloom filter files of the
+// junk filter of the account.
+func (a *Account) junkFilterPaths() (dbPath, bloomPath string) {
+	basePath := beacon.DataDirPath("accounts")
+	dbPath = filepath.Join(basePath, a.Name, "junkfilter.db")
+	bloomPath = filepath.Join(basePath, a.Name, "junkfilter.bloom")
+	return
+}
+
+// JunkFilterStats holds statistics about the junk filter of an account.
+type JunkFilterStats struct {
+	Hams      uint32 // Number of messages trained as ham.
+	Spams     uint32 // Number of messages trained as spam.
+	Words     int    // Number of words (combinations) in the database.
+	DBSize    int64  // Size of the database file in bytes.
+	BloomSize int64  // Size of the bloom filter file in bytes.
+}
+
+// JunkFilterStats returns statistics about the junk filter of the account.
+// The account read lock must be held.
+func (a *Account) JunkFilterStats(ctx context.Context, log mlog.Log) (JunkFilterStats, error) {
+	jf, _, err := a.OpenJunkFilter(ctx, log)
+	if err != nil {
+		return JunkFilterStats{}, err
+	}
+	defer func() {
+		err := jf.Close()
+		log.Check(err, "closing junk filter")
+	}()
+
+	var stats JunkFilterStats
+	stats.Hams, stats.Spams = jf.Counts()
+	stats.Words, err = jf.WordCount(ctx)
+	if err != nil {
+		return JunkFilterStats{}, err
+	}
+	dbPath, bloomPath := a.junkFilterPaths()
+	if fi, err := os.Stat(dbPath); err == nil {
+		stats.DBSize = fi.Size()
+	}
+	if fi, err := os.Stat(bloomPath); err == nil {
+		stats.BloomSize = fi.Size()
+	}
+	return stats, nil
+}
+
+// ResetJunkFilter removes the junk filter files of the account, resulting in an
+// empty filter on next use. The TrainedJunk fields of messages are cleared, so
+// future changes to junk flags don't untrain words from the new filter. The
+// account write lock must be held.
+func (a *Account) ResetJunkFilter(ctx context.Context, log mlog.Log) error {
+	dbPath, bloomPath := a.junkFilterPaths()
+	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing junk filter database: %v", err)
+	}
+	if err := os.Remove(bloomPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing junk filter bloom filter: %v", err)
+	}
+	q := bstore.QueryDB[Message](ctx, a.DB)
+	q.FilterFn(func(m Message) bool { return m.TrainedJunk != nil })
+	_, err := q.UpdateField("TrainedJunk", (*bool)(nil))
+	if err != nil {
+		return fmt.Errorf("clearing trained junk status of messages: %v", err)
+	}
+	return nil
+}
+
+// RetrainJunkFilter resets the junk filter of the account and trains it with all
+// messages that have the junk or nonjunk flag set. Progress is called
+// periodically with the number of messages processed so far, if not nil. The
+// account write lock must be held.
+func (a *Account) RetrainJunkFilter(ctx context.Context, log mlog.Log, progress func(done, total, trained int)) (total, trained int, rerr error) {
+	conf, _ := a.Conf()
+	if conf.JunkFilter == nil {
+		return 0, 0, ErrNoJunkFilter
+	}
+
+	if err := a.ResetJunkFilter(ctx, log); err != nil {
+		return 0, 0, err
+	}
+
+	// Open junk filter, this creates new files.
+	jf, _, err := a.OpenJunkFilter(ctx, log)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open new junk filter: %v", err)
+	}
+	defer func() {
+		if jf == nil {
+			return
+		}
+		err := jf.Close()
+		log.Check(err, "closing junk filter during cleanup")
+	}()
+
+	q := bstore.QueryDB[Message](ctx, a.DB)
+	q.FilterEqual("Expunged", false)
+	count, err := q.Count()
+	if err != nil {
+		return 0, 0, fmt.Errorf("counting messages: %v", err)
+	}
+
+	// Read through messages with junk or nonjunk flag set, and train them.
+	q = bstore.QueryDB[Message](ctx, a.DB)
+	q.FilterEqual("Expunged", false)
+	var trainedIDs []int64
+	err = q.ForEach(func(m Message) error {
+		total++
+		ok, err := a.TrainMessage(ctx, log, jf, m)
+		if ok {
+			trained++
+			trainedIDs = append(trainedIDs, m.ID)
+		}
+		if progress != nil && total%100 == 0 {
+			progress(total, count, trained)
+		}
+		return err
+	})
+	if err != nil {
+		return total, trained, fmt.Errorf("training messages: %v", err)
+	}
+
+	// Mark trained messages, so they are untrained when their flags change.
+	err = a.DB.Write(ctx, func(tx *bstore.Tx) error {
+		for _, id := range trainedIDs {
+			m := Message{ID: id}
+			if err := tx.Get(&m); err != nil {
+				return err
+			}
+			trainedJunk := m.Junk
+			m.TrainedJunk = &trainedJunk
+			if err := tx.Update(&m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return total, trained, fmt.Errorf("marking messages as trained: %v", err)
+	}
+
+	// Close junk filter, marking success.
+	err = jf.Close()
+	jf = nil
+	if err != nil {
+		return total, trained, fmt.Errorf("closing junk filter: %v", err)
+	}
+	if progress != nil {
+		progress(total, count, trained)
+	}
+	log.Info("retrained messages", slog.Int("total", total), slog.Int("trained", trained))
+	return total, trained, nil
+}
+
 // RetrainMessages (un)trains messages, if relevant given their flags. Updates
 // m.TrainedJunk after retraining.
 func (a *Account) RetrainMessages(ctx context.Context, log mlog.Log, tx *bstore.Tx, msgs []Message, absentOK bool) (rerr error) {
@@ -0,0 +1,125 @@
+// Package totp implements time-based one-time passwords (TOTP, RFC 6238), as
+// generated by authenticator apps, for use as second authentication factor.
+//
+// Codes are 6 digits, for 30 second time steps, based on HMAC-SHA1, which are the
+// defaults of (and often the only parameters supported by) authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ../rfc/6238:184 ../rfc/4226:480
+
+// Period is the duration of a single time step.
+const Period = 30 * time.Second
+
+// Digits is the number of decimal digits in a code.
+const Digits = 6
+
+// SecretSize is the number of random bytes in a new secret. RFC 4226 requires at
+// least 128 bits and recommends 160 bits.
+const SecretSize = 20
+
+var (
+	ErrSyntax  = errors.New("totp: malformed code")
+	ErrInvalid = errors.New("totp: invalid code")
+)
+
+// GenerateSecret returns a new random secret.
+func GenerateSecret() ([]byte, error) {
+	buf := make([]byte, SecretSize)
+	if _, err := cryptorand.Read(buf); err != nil {
+		return nil, fmt.Errorf("generating secret: %v", err)
+	}
+	return buf, nil
+}
+
+// EncodeSecret returns the secret in base32 without padding, the form used in
+// otpauth URIs and for manual entry in authenticator apps.
+func EncodeSecret(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// Counter returns the time step counter for t.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for a time step counter, see Counter.
+func Code(secret []byte, counter int64) string {
+	return code(secret, counter, Digits)
+}
+
+// code implements HOTP, ../rfc/4226:467
+func code(secret []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation. ../rfc/4226:510
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, v%mod)
+}
+
+// Verify checks if code is valid for secret at time t, allowing for up to skew
+// time steps of clock difference in either direction. Whitespace in code is
+// ignored. On success, the counter of the matching time step is returned. Callers
+// should refuse codes for counters that have been used before, to prevent replay
+// of an observed code.
+func Verify(secret []byte, code string, t time.Time, skew int) (counter int64, rerr error) {
+	code = strings.Join(strings.Fields(code), "")
+	if len(code) != Digits {
+		return 0, ErrSyntax
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return 0, ErrSyntax
+		}
+	}
+
+	now := Counter(t)
+	for i := -skew; i <= skew; i++ {
+		// Compare all candidates, without shortcut, and in constant time.
+		if subtle.ConstantTimeCompare([]byte(Code(secret, now+int64(i))), []byte(code)) == 1 {
+			counter = now + int64(i)
+		}
+	}
+	if counter == 0 {
+		return 0, ErrInvalid
+	}
+	return counter, nil
+}
+
+// URI returns an otpauth URI for configuring an authenticator app, typically
+// shown as QR code. Issuer is shown by authenticator apps, along with account, to
+// identify the secret.
+func URI(secret []byte, issuer, account string) string {
+	// Format at https://github.com/google/google-authenticator/wiki/Key-Uri-Format.
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", Digits))
+	q.Set("period", fmt.Sprintf("%d", int(Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// Test vectors for SHA1 from RFC 6238, appendix B. ../rfc/6238:625
+	secret := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		tm := time.Unix(v.unix, 0)
+		if c := code(secret, Counter(tm), 8); c != v.code {
+			t.Fatalf("code for %d: got %q, expected %q", v.unix, c, v.code)
+		}
+		if c := Code(secret, Counter(tm)); c != v.code[2:] {
+			t.Fatalf("6-digit code for %d: got %q, expected %q", v.unix, c, v.code[2:])
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("generate secret: %v", err)
+	}
+	now := time.Now()
+	c := Code(secret, Counter(now))
+
+	counter, err := Verify(secret, c[:3]+" "+c[3:], now, 1)
+	if err != nil || counter != Counter(now) {
+		t.Fatalf("verify: got counter %d, err %v, expected counter %d", counter, err, Counter(now))
+	}
+
+	// Previous time step is accepted with skew.
+	if _, err := Verify(secret, c, now.Add(Period), 1); err != nil {
+		t.Fatalf("verify with skew: %v", err)
+	}
+	if _, err := Verify(secret, c, now.Add(2*Period), 1); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("verify beyond skew: got err %v, expected ErrInvalid", err)
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "12345a"} {
+		if _, err := Verify(secret, bad, now, 1); !errors.Is(err, ErrSyntax) {
+			t.Fatalf("verify %q: got err %v, expected ErrSyntax", bad, err)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI([]byte("12345678901234567890"), "Example Mail", "mjl@example.org")
+	exp := "otpauth://totp/Example%20Mail:mjl@example.org?algorithm=SHA1&digits=6&issuer=Example+Mail&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if uri != exp {
+		t.Fatalf("got uri %q, expected %q", uri, exp)
+	}
+	if strings.Contains(EncodeSecret([]byte{1}), "=") {
+		t.Fatalf("encoded secret has padding")
+	}
+}
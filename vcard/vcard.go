@@ -0,0 +1,266 @@
+// Package vcard parses and writes vCards (RFC 6350), for contacts in the address
+// book.
+//
+// Properties are kept as they were parsed, including parameters and values in
+// their encoded form, so cards from clients can be stored, modified and written
+// again without losing information this package does not interpret. Both vCard
+// 4.0 and 3.0 (RFC 2426, used by many CardDAV clients) are accepted.
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrSyntax = errors.New("vcard: syntax error")
+)
+
+// Card is a single vCard.
+type Card struct {
+	// Properties in order, without BEGIN and END.
+	Props []Prop
+}
+
+// Prop is a property (content line) of a vCard.
+type Prop struct {
+	Group  string // Optional, without dot.
+	Name   string // Upper case.
+	Params string // Parameters as encoded, without leading semicolon, e.g. "TYPE=work;PREF=1". May be empty.
+	Value  string // Value as encoded, e.g. with escaped commas and semicolons for text values.
+}
+
+// New returns a new vCard 4.0 with UID and formatted name.
+func New(uid, name string) *Card {
+	c := &Card{}
+	c.Props = []Prop{
+		{Name: "VERSION", Value: "4.0"},
+		{Name: "UID", Value: EscapeText(uid)},
+		{Name: "FN", Value: EscapeText(name)},
+	}
+	return c
+}
+
+// Parse parses data as a single vCard. Lines must be terminated with CRLF or
+// LF. Folded lines are unfolded.
+func Parse(data string) (*Card, error) {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("%w: continuation line without property", ErrSyntax)
+			}
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 || !strings.EqualFold(lines[0], "BEGIN:VCARD") || !strings.EqualFold(lines[len(lines)-1], "END:VCARD") {
+		return nil, fmt.Errorf("%w: missing BEGIN:VCARD or END:VCARD, or multiple cards", ErrSyntax)
+	}
+
+	c := &Card{}
+	for _, line := range lines[1 : len(lines)-1] {
+		p, err := parseProp(line)
+		if err != nil {
+			return nil, err
+		}
+		if p.Name == "BEGIN" || p.Name == "END" {
+			return nil, fmt.Errorf("%w: nested %s", ErrSyntax, p.Name)
+		}
+		c.Props = append(c.Props, p)
+	}
+	version := c.Value("VERSION")
+	if version != "4.0" && version != "3.0" {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrSyntax, version)
+	}
+	return c, nil
+}
+
+func parseProp(line string) (Prop, error) {
+	if !utf8.ValidString(line) {
+		return Prop{}, fmt.Errorf("%w: invalid utf-8", ErrSyntax)
+	}
+	// Find the colon separating name and parameters from the value, skipping quoted
+	// parameter values, which can contain colons.
+	var quoted bool
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return Prop{}, fmt.Errorf("%w: missing colon in line %q", ErrSyntax, line)
+	}
+	var p Prop
+	p.Value = line[colon+1:]
+	name := line[:colon]
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name, p.Params = name[:i], name[i+1:]
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		p.Group, name = name[:i], name[i+1:]
+	}
+	if name == "" {
+		return Prop{}, fmt.Errorf("%w: missing property name in line %q", ErrSyntax, line)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return Prop{}, fmt.Errorf("%w: invalid property name %q", ErrSyntax, name)
+		}
+	}
+	p.Name = strings.ToUpper(name)
+	return p, nil
+}
+
+// String returns the vCard in its encoded form, with CRLF line endings and lines
+// folded at 75 octets.
+func (c *Card) String() string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCARD\r\n")
+	for _, p := range c.Props {
+		line := p.Name
+		if p.Group != "" {
+			line = p.Group + "." + line
+		}
+		if p.Params != "" {
+			line += ";" + p.Params
+		}
+		line += ":" + p.Value
+		writeFolded(&b, line)
+	}
+	b.WriteString("END:VCARD\r\n")
+	return b.String()
+}
+
+// writeFolded writes line, folding it into lines of at most 75 octets, without
+// splitting utf-8 sequences.
+func writeFolded(b *strings.Builder, line string) {
+	max := 75
+	for len(line) > max {
+		n := max
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		b.WriteString(line[:n])
+		b.WriteString("\r\n ")
+		line = line[n:]
+		max = 74 // Account for the leading space.
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// Value returns the encoded value of the first property with name, or an empty
+// string.
+func (c *Card) Value(name string) string {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// Text returns the unescaped text value of the first property with name, or an
+// empty string.
+func (c *Card) Text(name string) string {
+	return UnescapeText(c.Value(name))
+}
+
+// Texts returns the unescaped text values of all properties with name.
+func (c *Card) Texts(name string) []string {
+	var l []string
+	for _, p := range c.Props {
+		if p.Name == name {
+			l = append(l, UnescapeText(p.Value))
+		}
+	}
+	return l
+}
+
+// SetText sets the unescaped text value of the first property with name, adding
+// the property if absent. Other properties with name are removed. If value is
+// empty, all properties with name are removed.
+func (c *Card) SetText(name, value string) {
+	if value == "" {
+		c.SetTexts(name, nil)
+	} else {
+		c.SetTexts(name, []string{value})
+	}
+}
+
+// SetTexts sets the unescaped text values for properties with name. Properties
+// with a value that is still present are kept as is, including their
+// parameters. Other properties with name are removed, and new values are added
+// as properties without parameters.
+func (c *Card) SetTexts(name string, values []string) {
+	need := map[string]bool{}
+	for _, v := range values {
+		need[v] = true
+	}
+	have := map[string]bool{}
+	var props []Prop
+	last := -1
+	for _, p := range c.Props {
+		if p.Name != name {
+			props = append(props, p)
+			continue
+		}
+		v := UnescapeText(p.Value)
+		if need[v] && !have[v] {
+			have[v] = true
+			props = append(props, p)
+			last = len(props) - 1
+		}
+	}
+	var nprops []Prop
+	for _, v := range values {
+		if !have[v] {
+			have[v] = true
+			nprops = append(nprops, Prop{Name: name, Value: EscapeText(v)})
+		}
+	}
+	if last < 0 {
+		props = append(props, nprops...)
+	} else {
+		props = append(props[:last+1], append(nprops, props[last+1:]...)...)
+	}
+	c.Props = props
+}
+
+// EscapeText escapes a text value for use in a property.
+func EscapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// UnescapeText unescapes a text value of a property. Unknown escapes are kept
+// as the escaped character.
+func UnescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package vcard
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", got, exp)
+	}
+}
+
+func TestParse(t *testing.T) {
+	const data = "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:urn:uuid:1234\r\nN:Doe;Jane;;;\r\nFN:Jane Doe\r\nitem1.EMAIL;TYPE=\"work,pref\":jane@\r\n example.org\r\nEMAIL:jane@home.example\r\nNOTE:a\\, b\\; c\\nd\\\\\r\nX-TEST;X-PARAM=\"a:b\":x:y\r\nEND:VCARD\r\n"
+	c, err := Parse(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	tcompare(t, c.Value("VERSION"), "3.0")
+	tcompare(t, c.Text("UID"), "urn:uuid:1234")
+	tcompare(t, c.Text("FN"), "Jane Doe")
+	tcompare(t, c.Texts("EMAIL"), []string{"jane@example.org", "jane@home.example"})
+	tcompare(t, c.Props[4], Prop{"item1", "EMAIL", `TYPE="work,pref"`, "jane@example.org"})
+	tcompare(t, c.Text("NOTE"), "a, b; c\nd\\")
+	tcompare(t, c.Props[7], Prop{"", "X-TEST", `X-PARAM="a:b"`, "x:y"})
+
+	// Unfolded again on parse.
+	c2, err := Parse(c.String())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	tcompare(t, c2, c)
+
+	bad := []string{
+		"",
+		"BEGIN:VCARD\r\nVERSION:4.0\r\n",
+		"BEGIN:VCARD\r\nFN:x\r\nEND:VCARD\r\n", // No version.
+		"BEGIN:VCARD\r\nVERSION:2.1\r\nEND:VCARD\r\n",                                            // Bad version.
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN\r\nEND:VCARD\r\n",                                      // No colon.
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nF N:x\r\nEND:VCARD\r\n",                                   // Bad name.
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nBEGIN:VCARD\r\nEND:VCARD\r\n",                             // Nested.
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nEND:VCARD\r\nBEGIN:VCARD\r\nVERSION:4.0\r\nEND:VCARD\r\n", // Multiple.
+	}
+	for _, s := range bad {
+		if _, err := Parse(s); !errors.Is(err, ErrSyntax) {
+			t.Fatalf("parse %q: got err %v, expected ErrSyntax", s, err)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	c := New("uid1", strings.Repeat("é", 50))
+	s := c.String()
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line too long: %q", line)
+		}
+	}
+	c2, err := Parse(s)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	tcompare(t, c2.Text("FN"), strings.Repeat("é", 50))
+	tcompare(t, c2.Value("VERSION"), "4.0")
+}
+
+func TestSetTexts(t *testing.T) {
+	c := New("uid1", "x")
+	c.Props = append(c.Props, Prop{Name: "EMAIL", Params: "TYPE=work", Value: "a@example.org"}, Prop{Name: "EMAIL", Value: "b@example.org"}, Prop{Name: "NOTE", Value: "note"})
+	c.SetTexts("EMAIL", []string{"a@example.org", "c@example.org"})
+	tcompare(t, c.Props[3:], []Prop{{Name: "EMAIL", Params: "TYPE=work", Value: "a@example.org"}, {Name: "EMAIL", Value: "c@example.org"}, {Name: "NOTE", Value: "note"}})
+
+	c.SetText("NOTE", "a,b")
+	tcompare(t, c.Props[5], Prop{Name: "NOTE", Value: `a\,b`})
+	c.SetText("NOTE", "")
+	tcompare(t, len(c.Props), 5)
+	c.SetTexts("TEL", []string{"+1 555"})
+	tcompare(t, c.Props[5], Prop{Name: "TEL", Value: "+1 555"})
+}
@@ -17,10 +17,15 @@ import (
 
 	"github.com/mjl-/bstore"
 
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dmarcdb"
+	"github.com/qompassai/beacon/dnsblserver"
+	"github.com/qompassai/beacon/greylist"
 	"github.com/qompassai/beacon/junk"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/beaconvar"
 	"github.com/qompassai/beacon/mtastsdb"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/queue"
 	"github.com/qompassai/beacon/store"
 	"github.com/qompassai/beacon/tlsrptdb"
@@ -222,6 +227,26 @@ possibly making them potentially no longer readable by the previous version.
 		checkf(err, qdir, "walking queue directory")
 	}
 
+	// Check the quarantine database, and that its messages exist on disk.
+	checkQuarantine := func() {
+		dbpath := filepath.Join(dataDir, "quarantine/index.db")
+		if !exists(dbpath) {
+			return
+		}
+		checkDB(true, dbpath, quarantine.DBTypes)
+
+		db, err := bstore.Open(ctxbg, dbpath, &bstore.Options{MustExist: true}, quarantine.DBTypes...)
+		checkf(err, dbpath, "opening quarantine database to check messages")
+		if err == nil {
+			err := bstore.QueryDB[quarantine.Message](ctxbg, db).ForEach(func(m quarantine.Message) error {
+				p := filepath.Join(dataDir, "quarantine", store.MessagePath(m.ID))
+				checkFile(dbpath, p, len(m.MsgPrefix), m.Size)
+				return nil
+			})
+			checkf(err, dbpath, "reading messages in quarantine database to check files")
+		}
+	}
+
 	// Check an account, with its database file and messages.
 	checkAccount := func(name string) {
 		accdir := filepath.Join(dataDir, "accounts", name)
@@ -420,9 +445,9 @@ possibly making them potentially no longer readable by the previous version.
 				p = p[len(dataDir)+1:]
 			}
 			switch p {
-			case "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "receivedid.key", "lastknownversion":
+			case "dmarcrpt.db", "dmarceval.db", "mtasts.db", "tlsrpt.db", "tlsrptresult.db", "loginattempt.db", "greylist.db", "dkimrotate.db", "dnsblserver.db", "receivedid.key", "lastknownversion":
 				return nil
-			case "acme", "queue", "accounts", "tmp", "moved":
+			case "acme", "queue", "quarantine", "accounts", "tmp", "moved":
 				return fs.SkipDir
 			case "beaconversion":
 				buf, err := os.ReadFile(dpath)
@@ -443,7 +468,12 @@ possibly making them potentially no longer readable by the previous version.
 	checkDB(true, filepath.Join(dataDir, "mtasts.db"), mtastsdb.DBTypes)
 	checkDB(true, filepath.Join(dataDir, "tlsrpt.db"), tlsrptdb.ReportDBTypes)
 	checkDB(false, filepath.Join(dataDir, "tlsrptresult.db"), tlsrptdb.ResultDBTypes) // After v0.0.7.
+	checkDB(false, filepath.Join(dataDir, "loginattempt.db"), loginattempt.DBTypes)
+	checkDB(false, filepath.Join(dataDir, "greylist.db"), greylist.DBTypes)
+	checkDB(false, filepath.Join(dataDir, "dkimrotate.db"), dkimrotate.DBTypes)
+	checkDB(false, filepath.Join(dataDir, "dnsblserver.db"), dnsblserver.DBTypes)
 	checkQueue()
+	checkQuarantine()
 	checkAccounts()
 	checkOther()
 
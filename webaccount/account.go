@@ -8,8 +8,12 @@ import (
 	"compress/gzip"
 	"context"
 	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -17,21 +21,28 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	_ "embed"
 
 	"golang.org/x/exp/slog"
 
+	"github.com/mjl-/bstore"
 	"github.com/mjl-/sherpa"
 	"github.com/mjl-/sherpadoc"
 	"github.com/mjl-/sherpaprom"
+	"rsc.io/qr"
 
 	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/junk"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
 	"github.com/qompassai/beacon/beaconvar"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/store"
+	"github.com/qompassai/beacon/totp"
 	"github.com/qompassai/beacon/webauth"
 )
 
@@ -361,12 +372,14 @@ func (w Account) LoginPrep(ctx context.Context) string {
 }
 
 // Login returns a session token for the credentials, or fails with error code
-// "user:badLogin". Call LoginPrep to get a loginToken.
-func (w Account) Login(ctx context.Context, loginToken, username, password string) store.CSRFToken {
+// "user:badLogin". Call LoginPrep to get a loginToken. If two-factor
+// authentication is enabled for the account and totpCode is empty, the call fails
+// with error code "user:totpRequired", and should be repeated with a totpCode.
+func (w Account) Login(ctx context.Context, loginToken, username, password, totpCode string) store.CSRFToken {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Accounts, "webaccount", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
+	csrfToken, err := webauth.Login(ctx, log, webauth.Accounts, "webaccount", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password, totpCode)
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
@@ -412,6 +425,478 @@ func (Account) SetPassword(ctx context.Context, password string) {
 	xcheckf(ctx, err, "restoring session after password reset")
 }
 
+// TOTPEnrollment holds a new secret for enrolling an authenticator app.
+type TOTPEnrollment struct {
+	Secret    string // Base32-encoded, for manual entry in an authenticator app.
+	URI       string // otpauth URI with the secret.
+	QRCodePNG string // Base64-encoded PNG image with a QR code of the URI.
+}
+
+// xchecktotpf is like xcheckf, but turns errors about invalid codes and state into
+// user errors.
+func xchecktotpf(ctx context.Context, err error, format string, args ...any) {
+	for _, e := range []error{store.ErrTOTPInvalid, store.ErrTOTPEnabled, store.ErrTOTPNotEnabled, store.ErrTOTPNotStarted} {
+		if errors.Is(err, e) {
+			xcheckuserf(ctx, err, format, args...)
+		}
+	}
+	xcheckf(ctx, err, format, args...)
+}
+
+// TOTPStatus returns whether two-factor authentication with an authenticator app
+// is enabled, whether it is required by the account configuration, and how many
+// unused recovery codes are left.
+func (Account) TOTPStatus(ctx context.Context) (enabled, required bool, recoveryCodesLeft int) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, _ := beacon.Conf.Account(reqInfo.AccountName)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	enabled, recoveryCodesLeft, err = acc.TOTPStatus(ctx)
+	xcheckf(ctx, err, "get two-factor authentication status")
+	return enabled, accConf.RequireTOTP, recoveryCodesLeft
+}
+
+// TOTPEnrollStart generates a new secret for two-factor authentication. The
+// secret is not used for logins until TOTPEnrollFinish is called with a valid code.
+func (Account) TOTPEnrollStart(ctx context.Context) TOTPEnrollment {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	secret, err := acc.TOTPEnrollStart(ctx)
+	xchecktotpf(ctx, err, "starting two-factor authentication enrollment")
+
+	// Authenticator apps show the issuer and account name to identify the secret.
+	issuer := beacon.Conf.Static.HostnameDomain.Name()
+	uri := totp.URI(secret, issuer, reqInfo.LoginAddress)
+	code, err := qr.Encode(uri, qr.M)
+	xcheckf(ctx, err, "making qr code")
+	return TOTPEnrollment{
+		Secret:    totp.EncodeSecret(secret),
+		URI:       uri,
+		QRCodePNG: base64.StdEncoding.EncodeToString(code.PNG()),
+	}
+}
+
+// TOTPEnrollFinish completes enrollment by checking a code from the authenticator
+// app, and returns recovery codes to show to the user once. Each recovery code can
+// be used once instead of a code from the authenticator app.
+func (Account) TOTPEnrollFinish(ctx context.Context, code string) (recoveryCodes []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	recoveryCodes, err = acc.TOTPEnrollFinish(ctx, log, code)
+	xchecktotpf(ctx, err, "finishing two-factor authentication enrollment")
+	return recoveryCodes
+}
+
+// TOTPDisable disables two-factor authentication after verifying code, a code
+// from the authenticator app or a recovery code. Not allowed if the account
+// configuration requires two-factor authentication.
+func (Account) TOTPDisable(ctx context.Context, code string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	accConf, _ := beacon.Conf.Account(reqInfo.AccountName)
+	if accConf.RequireTOTP {
+		xcheckuserf(ctx, errors.New("required by account configuration"), "disabling two-factor authentication")
+	}
+	if code == "" {
+		xcheckuserf(ctx, errors.New("code required"), "disabling two-factor authentication")
+	}
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.TOTPRemove(ctx, log, code)
+	xchecktotpf(ctx, err, "disabling two-factor authentication")
+}
+
+// TOTPRecoveryCodesRegenerate replaces the recovery codes with new codes after
+// verifying code, and returns the new codes.
+func (Account) TOTPRecoveryCodesRegenerate(ctx context.Context, code string) (recoveryCodes []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	recoveryCodes, err = acc.TOTPRecoveryCodesReset(ctx, log, code)
+	xchecktotpf(ctx, err, "regenerating recovery codes")
+	return recoveryCodes
+}
+
+// AppPasswords returns the app passwords of the account, for IMAP, SMTP
+// submission and CardDAV. Also returns whether app passwords are required for
+// these protocols, i.e. whether the account password is refused, because
+// two-factor authentication is enabled or required.
+func (Account) AppPasswords(ctx context.Context) (appPasswords []store.AppPassword, required bool) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	appPasswords, err = acc.AppPasswordList(ctx)
+	xcheckf(ctx, err, "listing app passwords")
+	required, err = acc.AppPasswordsRequired(ctx)
+	xcheckf(ctx, err, "checking whether app passwords are required")
+	return appPasswords, required
+}
+
+// AppPasswordAdd generates a new app password and returns it. It is only
+// returned once, it cannot be retrieved later.
+func (Account) AppPasswordAdd(ctx context.Context, name string) (password string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	if strings.TrimSpace(name) == "" {
+		xcheckuserf(ctx, errors.New("name required"), "adding app password")
+	}
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	password, err = acc.AppPasswordAdd(ctx, log, name)
+	if errors.Is(err, store.ErrAppPasswordsMax) {
+		xcheckuserf(ctx, err, "adding app password")
+	}
+	xcheckf(ctx, err, "adding app password")
+	return password
+}
+
+// AppPasswordRemove removes an app password, after which it can no longer be
+// used for authentication.
+func (Account) AppPasswordRemove(ctx context.Context, id int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	err = acc.AppPasswordRemove(ctx, log, id)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, errors.New("not found"), "removing app password")
+	}
+	xcheckf(ctx, err, "removing app password")
+}
+
+// TLSPublicKeys returns the public keys of TLS client certificates registered for
+// authentication with SASL mechanism EXTERNAL on IMAP and SMTP submission.
+func (Account) TLSPublicKeys(ctx context.Context) []config.TLSPublicKey {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, ok := beacon.Conf.Account(reqInfo.AccountName)
+	if !ok {
+		xcheckf(ctx, errors.New("not found"), "looking up account")
+	}
+	return accConf.TLSPublicKeys
+}
+
+// TLSPublicKeyAdd registers the public key of a TLS client certificate for
+// authentication as loginAddress, which must be an address of the account. Key is
+// a PEM-encoded certificate or public key, or a fingerprint of the public key: a
+// SHA-256 hash of the DER-encoded SubjectPublicKeyInfo in hex.
+func (Account) TLSPublicKeyAdd(ctx context.Context, name, loginAddress, key string) config.TLSPublicKey {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, ok := beacon.Conf.Account(reqInfo.AccountName)
+	if !ok {
+		xcheckf(ctx, errors.New("not found"), "looking up account")
+	}
+	if name == "" {
+		xcheckuserf(ctx, errors.New("name required"), "checking name")
+	}
+	if _, ok := accConf.Destinations[loginAddress]; !ok || strings.HasPrefix(loginAddress, "@") {
+		xcheckuserf(ctx, errors.New("not an address of the account"), "checking login address")
+	}
+
+	fp, err := parseTLSPublicKey(key)
+	xcheckuserf(ctx, err, "parsing key")
+	if accName, _, ok := beacon.Conf.TLSPublicKey(fp); ok {
+		if accName == reqInfo.AccountName {
+			xcheckuserf(ctx, errors.New("already registered"), "adding key")
+		}
+		xcheckuserf(ctx, errors.New("registered with another account"), "adding key")
+	}
+
+	k := config.TLSPublicKey{Name: name, Fingerprint: fp, LoginAddress: loginAddress}
+	keys := append(append([]config.TLSPublicKey{}, accConf.TLSPublicKeys...), k)
+	err = beacon.AccountTLSPublicKeysSave(ctx, reqInfo.AccountName, keys)
+	xcheckf(ctx, err, "saving tls public keys")
+	return k
+}
+
+// parseTLSPublicKey returns the fingerprint for a PEM-encoded certificate or
+// public key, or a hex-encoded fingerprint.
+func parseTLSPublicKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	b, _ := pem.Decode([]byte(key))
+	if b == nil {
+		fp := strings.ToLower(strings.ReplaceAll(key, ":", ""))
+		if buf, err := hex.DecodeString(fp); err != nil || len(buf) != sha256.Size {
+			return "", errors.New("not a pem-encoded certificate or public key, or sha-256 fingerprint in hex")
+		}
+		return fp, nil
+	}
+	var spki []byte
+	switch b.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("parsing certificate: %v", err)
+		}
+		return store.TLSPublicKeyFingerprint(cert), nil
+	case "PUBLIC KEY":
+		if _, err := x509.ParsePKIXPublicKey(b.Bytes); err != nil {
+			return "", fmt.Errorf("parsing public key: %v", err)
+		}
+		spki = b.Bytes
+	default:
+		return "", fmt.Errorf("unrecognized pem type %q, need CERTIFICATE or PUBLIC KEY", b.Type)
+	}
+	h := sha256.Sum256(spki)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// TLSPublicKeyRemove removes a registered TLS public key by its fingerprint.
+func (Account) TLSPublicKeyRemove(ctx context.Context, fingerprint string) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, ok := beacon.Conf.Account(reqInfo.AccountName)
+	if !ok {
+		xcheckf(ctx, errors.New("not found"), "looking up account")
+	}
+	var keys []config.TLSPublicKey
+	for _, k := range accConf.TLSPublicKeys {
+		if k.Fingerprint != fingerprint {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == len(accConf.TLSPublicKeys) {
+		xcheckuserf(ctx, errors.New("not found"), "looking up key")
+	}
+	err := beacon.AccountTLSPublicKeysSave(ctx, reqInfo.AccountName, keys)
+	xcheckf(ctx, err, "saving tls public keys")
+}
+
+// LoginAttempts returns the most recent authentication attempts for the account,
+// newest first.
+func (Account) LoginAttempts(ctx context.Context, limit int) []loginattempt.LoginAttempt {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	l, err := loginattempt.Attempts(ctx, reqInfo.AccountName, limit)
+	xcheckf(ctx, err, "listing login attempts")
+	return l
+}
+
+// LoginLockout returns whether authentication for the account is blocked after too
+// many consecutive failed attempts, and until when. Sessions that were already
+// logged in, like this one, are not affected.
+func (Account) LoginLockout(ctx context.Context) (locked bool, until time.Time) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	until, locked, err := loginattempt.Locked(ctx, reqInfo.AccountName)
+	xcheckf(ctx, err, "checking login lockout")
+	return locked, until
+}
+
+// LoginLockoutRemove unblocks authentication for the account.
+func (Account) LoginLockoutRemove(ctx context.Context) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	err := loginattempt.Unblock(ctx, pkglog.WithContext(ctx), reqInfo.AccountName)
+	xcheckf(ctx, err, "unblocking account")
+}
+
+// Quarantine returns the messages for the account in the quarantine, most recent
+// first.
+func (Account) Quarantine(ctx context.Context) []quarantine.Message {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	l, err := quarantine.List(ctx, quarantine.Filter{Account: reqInfo.AccountName})
+	xcheckf(ctx, err, "listing messages in quarantine")
+	return l
+}
+
+// QuarantineHeaders returns the header section of a quarantined message of the
+// account.
+func (Account) QuarantineHeaders(ctx context.Context, id int64) string {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	h, err := quarantine.Headers(ctx, reqInfo.AccountName, id)
+	if err == quarantine.ErrNotFound {
+		xcheckuserf(ctx, err, "get message headers")
+	}
+	xcheckf(ctx, err, "get message headers")
+	return h
+}
+
+// QuarantineRelease delivers a quarantined message to the account, and removes it
+// from the quarantine. If train is set, the junk filter is trained with the
+// message as non-junk.
+func (Account) QuarantineRelease(ctx context.Context, id int64, train bool) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	err := quarantine.Release(ctx, pkglog.WithContext(ctx), reqInfo.AccountName, id, train)
+	if err == quarantine.ErrNotFound {
+		xcheckuserf(ctx, err, "releasing message")
+	}
+	xcheckf(ctx, err, "releasing message")
+}
+
+// QuarantineDelete removes a message of the account from the quarantine.
+func (Account) QuarantineDelete(ctx context.Context, id int64) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	err := quarantine.Delete(ctx, pkglog.WithContext(ctx), reqInfo.AccountName, id)
+	if err == quarantine.ErrNotFound {
+		xcheckuserf(ctx, err, "removing message")
+	}
+	xcheckf(ctx, err, "removing message")
+}
+
+// JunkFilter returns whether the junk filter is enabled for the account, its
+// threshold and parameters, and statistics about its database. Statistics are
+// not gathered while retraining.
+func (Account) JunkFilter(ctx context.Context) (enabled bool, threshold float64, params junk.Params, stats store.JunkFilterStats) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, ok := beacon.Conf.Account(reqInfo.AccountName)
+	if !ok {
+		xcheckf(ctx, errors.New("not found"), "looking up account")
+	}
+	if accConf.JunkFilter == nil {
+		return
+	}
+	enabled, threshold, params = true, accConf.JunkFilter.Threshold, accConf.JunkFilter.Params
+
+	if junkRetrainStatus(reqInfo.AccountName).Running {
+		return
+	}
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	acc.WithRLock(func() {
+		stats, err = acc.JunkFilterStats(ctx, log)
+	})
+	xcheckf(ctx, err, "gathering junk filter statistics")
+	return
+}
+
+// JunkFilterSave changes the threshold and parameters of the junk filter of the
+// account. The junk filter must already be enabled. Changes to the n-gram
+// parameters only take effect for existing messages after retraining.
+func (Account) JunkFilterSave(ctx context.Context, threshold float64, junkParams junk.Params) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, ok := beacon.Conf.Account(reqInfo.AccountName)
+	if !ok {
+		xcheckf(ctx, errors.New("not found"), "looking up account")
+	}
+	if accConf.JunkFilter == nil {
+		xcheckuserf(ctx, store.ErrNoJunkFilter, "saving junk filter")
+	}
+	if threshold <= 0 || threshold > 1 {
+		xcheckuserf(ctx, errors.New("must be above 0 and at most 1"), "checking threshold")
+	}
+	if !junkParams.Onegrams && !junkParams.Twograms && !junkParams.Threegrams {
+		xcheckuserf(ctx, errors.New("at least one of one-, two- or three-grams must be enabled"), "checking parameters")
+	}
+	if junkParams.MaxPower < 0 || junkParams.MaxPower >= 0.5 {
+		xcheckuserf(ctx, errors.New("must be at least 0 and below 0.5"), "checking max power")
+	}
+	if junkParams.TopWords <= 0 {
+		xcheckuserf(ctx, errors.New("must be above 0"), "checking top words")
+	}
+	if junkParams.IgnoreWords < 0 || junkParams.IgnoreWords >= 0.5 {
+		xcheckuserf(ctx, errors.New("must be at least 0 and below 0.5"), "checking ignore words")
+	}
+	if junkParams.RareWords < 0 {
+		xcheckuserf(ctx, errors.New("must be at least 0"), "checking rare words")
+	}
+
+	jf := config.JunkFilter{Threshold: threshold, Params: junkParams}
+	err := beacon.AccountJunkFilterSave(ctx, reqInfo.AccountName, &jf)
+	xcheckf(ctx, err, "saving junk filter")
+}
+
+// JunkFilterReset removes all words from the junk filter of the account. Messages
+// are not retrained, so the filter starts out empty.
+func (Account) JunkFilterReset(ctx context.Context) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	if junkRetrainStatus(reqInfo.AccountName).Running {
+		xcheckuserf(ctx, errJunkRetrainRunning, "resetting junk filter")
+	}
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	acc.WithWLock(func() {
+		err = acc.ResetJunkFilter(ctx, log)
+	})
+	xcheckf(ctx, err, "resetting junk filter")
+}
+
+// JunkFilterRetrain starts recreating the junk filter of the account from the
+// junk and nonjunk flags of the messages in all mailboxes. Use
+// JunkFilterRetrainProgress to follow progress. Deliveries to the account are
+// delayed until retraining has finished.
+func (Account) JunkFilterRetrain(ctx context.Context) {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	accConf, ok := beacon.Conf.Account(reqInfo.AccountName)
+	if !ok {
+		xcheckf(ctx, errors.New("not found"), "looking up account")
+	}
+	if accConf.JunkFilter == nil {
+		xcheckuserf(ctx, store.ErrNoJunkFilter, "retraining junk filter")
+	}
+	err := junkRetrainStart(pkglog.WithContext(ctx), reqInfo.AccountName)
+	xcheckuserf(ctx, err, "retraining junk filter")
+}
+
+// JunkFilterRetrainProgress returns the progress of the current or most recent
+// retrain of the junk filter.
+func (Account) JunkFilterRetrainProgress(ctx context.Context) JunkRetrainProgress {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	return junkRetrainStatus(reqInfo.AccountName)
+}
+
 // Account returns information about the account: full name, the default domain,
 // and the destinations (keys are email addresses, or localparts to the default
 // domain). todo: replace with a function that returns the whole account, when
@@ -226,22 +226,48 @@ const [dom, style, attr, prop] = (function () {
 // NOTE: GENERATED by github.com/mjl-/sherpats, DO NOT MODIFY
 var api;
 (function (api) {
-	api.structTypes = { "Destination": true, "Domain": true, "ImportProgress": true, "Ruleset": true };
-	api.stringsTypes = { "CSRFToken": true };
+	// Reason a message was quarantined.
+	let Reason;
+	(function (Reason) {
+		Reason["ReasonDNSBL"] = "dnsbl";
+		Reason["ReasonJunk"] = "junk";
+		Reason["ReasonContentScan"] = "contentscan";
+		Reason["ReasonHold"] = "hold";
+	})(Reason = api.Reason || (api.Reason = {}));
+	api.structTypes = { "AppPassword": true, "Destination": true, "Domain": true, "ImportProgress": true, "JunkFilterStats": true, "JunkRetrainProgress": true, "LoginAttempt": true, "Message": true, "Params": true, "Ruleset": true, "TLSPublicKey": true, "TOTPEnrollment": true };
+	api.stringsTypes = { "CSRFToken": true, "Reason": true };
 	api.intsTypes = {};
 	api.types = {
+		"TOTPEnrollment": { "Name": "TOTPEnrollment", "Docs": "", "Fields": [{ "Name": "Secret", "Docs": "", "Typewords": ["string"] }, { "Name": "URI", "Docs": "", "Typewords": ["string"] }, { "Name": "QRCodePNG", "Docs": "", "Typewords": ["string"] }] },
+		"AppPassword": { "Name": "AppPassword", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Created", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "LastUsed", "Docs": "", "Typewords": ["timestamp"] }] },
+		"TLSPublicKey": { "Name": "TLSPublicKey", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Fingerprint", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }] },
+		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Time", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["string"] }] },
+		"Message": { "Name": "Message", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Received", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Reason", "Docs": "", "Typewords": ["Reason"] }, { "Name": "Detail", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "RcptTo", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "DigestSent", "Docs": "", "Typewords": ["bool"] }] },
+		"Params": { "Name": "Params", "Docs": "", "Fields": [{ "Name": "Onegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "Twograms", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threegrams", "Docs": "", "Typewords": ["bool"] }, { "Name": "MaxPower", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "IgnoreWords", "Docs": "", "Typewords": ["float64"] }, { "Name": "RareWords", "Docs": "", "Typewords": ["int32"] }, { "Name": "Links", "Docs": "", "Typewords": ["bool"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["bool"] }, { "Name": "Structure", "Docs": "", "Typewords": ["bool"] }, { "Name": "AuthResults", "Docs": "", "Typewords": ["bool"] }] },
+		"JunkFilterStats": { "Name": "JunkFilterStats", "Docs": "", "Fields": [{ "Name": "Hams", "Docs": "", "Typewords": ["uint32"] }, { "Name": "Spams", "Docs": "", "Typewords": ["uint32"] }, { "Name": "Words", "Docs": "", "Typewords": ["int32"] }, { "Name": "DBSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "BloomSize", "Docs": "", "Typewords": ["int64"] }] },
+		"JunkRetrainProgress": { "Name": "JunkRetrainProgress", "Docs": "", "Fields": [{ "Name": "Running", "Docs": "", "Typewords": ["bool"] }, { "Name": "Done", "Docs": "", "Typewords": ["int32"] }, { "Name": "Total", "Docs": "", "Typewords": ["int32"] }, { "Name": "Trained", "Docs": "", "Typewords": ["int32"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }, { "Name": "Finished", "Docs": "", "Typewords": ["nullable", "timestamp"] }] },
 		"Domain": { "Name": "Domain", "Docs": "", "Fields": [{ "Name": "ASCII", "Docs": "", "Typewords": ["string"] }, { "Name": "Unicode", "Docs": "", "Typewords": ["string"] }] },
 		"Destination": { "Name": "Destination", "Docs": "", "Fields": [{ "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Rulesets", "Docs": "", "Typewords": ["[]", "Ruleset"] }, { "Name": "FullName", "Docs": "", "Typewords": ["string"] }] },
 		"Ruleset": { "Name": "Ruleset", "Docs": "", "Fields": [{ "Name": "SMTPMailFromRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "HeadersRegexp", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListAllowDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "AcceptRejectsToMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "VerifiedDNSDomain", "Docs": "", "Typewords": ["Domain"] }, { "Name": "ListAllowDNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
 		"ImportProgress": { "Name": "ImportProgress", "Docs": "", "Fields": [{ "Name": "Token", "Docs": "", "Typewords": ["string"] }] },
 		"CSRFToken": { "Name": "CSRFToken", "Docs": "", "Values": null },
+		"Reason": { "Name": "Reason", "Docs": "", "Values": [{ "Name": "ReasonDNSBL", "Value": "dnsbl", "Docs": "" }, { "Name": "ReasonJunk", "Value": "junk", "Docs": "" }, { "Name": "ReasonContentScan", "Value": "contentscan", "Docs": "" }, { "Name": "ReasonHold", "Value": "hold", "Docs": "" }] },
 	};
 	api.parser = {
+		TOTPEnrollment: (v) => api.parse("TOTPEnrollment", v),
+		AppPassword: (v) => api.parse("AppPassword", v),
+		TLSPublicKey: (v) => api.parse("TLSPublicKey", v),
+		LoginAttempt: (v) => api.parse("LoginAttempt", v),
+		Message: (v) => api.parse("Message", v),
+		Params: (v) => api.parse("Params", v),
+		JunkFilterStats: (v) => api.parse("JunkFilterStats", v),
+		JunkRetrainProgress: (v) => api.parse("JunkRetrainProgress", v),
 		Domain: (v) => api.parse("Domain", v),
 		Destination: (v) => api.parse("Destination", v),
 		Ruleset: (v) => api.parse("Ruleset", v),
 		ImportProgress: (v) => api.parse("ImportProgress", v),
 		CSRFToken: (v) => api.parse("CSRFToken", v),
+		Reason: (v) => api.parse("Reason", v),
 	};
 	// Account exports web API functions for the account web interface. All its
 	// methods are exported under api/. Function calls require valid HTTP
@@ -278,12 +304,14 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Login returns a session token for the credentials, or fails with error code
-		// "user:badLogin". Call LoginPrep to get a loginToken.
-		async Login(loginToken, username, password) {
+		// "user:badLogin". Call LoginPrep to get a loginToken. If two-factor
+		// authentication is enabled for the account and totpCode is empty, the call fails
+		// with error code "user:totpRequired", and should be repeated with a totpCode.
+		async Login(loginToken, username, password, totpCode) {
 			const fn = "Login";
-			const paramTypes = [["string"], ["string"], ["string"]];
+			const paramTypes = [["string"], ["string"], ["string"], ["string"]];
 			const returnTypes = [["CSRFToken"]];
-			const params = [loginToken, username, password];
+			const params = [loginToken, username, password, totpCode];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Logout invalidates the session token.
@@ -304,6 +332,223 @@ var api;
 			const params = [password];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// TOTPStatus returns whether two-factor authentication with an authenticator app
+		// is enabled, whether it is required by the account configuration, and how many
+		// unused recovery codes are left.
+		async TOTPStatus() {
+			const fn = "TOTPStatus";
+			const paramTypes = [];
+			const returnTypes = [["bool"], ["bool"], ["int32"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPEnrollStart generates a new secret for two-factor authentication. The
+		// secret is not used for logins until TOTPEnrollFinish is called with a valid code.
+		async TOTPEnrollStart() {
+			const fn = "TOTPEnrollStart";
+			const paramTypes = [];
+			const returnTypes = [["TOTPEnrollment"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPEnrollFinish completes enrollment by checking a code from the authenticator
+		// app, and returns recovery codes to show to the user once. Each recovery code can
+		// be used once instead of a code from the authenticator app.
+		async TOTPEnrollFinish(code) {
+			const fn = "TOTPEnrollFinish";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "string"]];
+			const params = [code];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPDisable disables two-factor authentication after verifying code, a code
+		// from the authenticator app or a recovery code. Not allowed if the account
+		// configuration requires two-factor authentication.
+		async TOTPDisable(code) {
+			const fn = "TOTPDisable";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [code];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TOTPRecoveryCodesRegenerate replaces the recovery codes with new codes after
+		// verifying code, and returns the new codes.
+		async TOTPRecoveryCodesRegenerate(code) {
+			const fn = "TOTPRecoveryCodesRegenerate";
+			const paramTypes = [["string"]];
+			const returnTypes = [["[]", "string"]];
+			const params = [code];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AppPasswords returns the app passwords of the account, for IMAP, SMTP
+		// submission and CardDAV. Also returns whether app passwords are required for
+		// these protocols, i.e. whether the account password is refused, because
+		// two-factor authentication is enabled or required.
+		async AppPasswords() {
+			const fn = "AppPasswords";
+			const paramTypes = [];
+			const returnTypes = [["[]", "AppPassword"], ["bool"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AppPasswordAdd generates a new app password and returns it. It is only
+		// returned once, it cannot be retrieved later.
+		async AppPasswordAdd(name) {
+			const fn = "AppPasswordAdd";
+			const paramTypes = [["string"]];
+			const returnTypes = [["string"]];
+			const params = [name];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AppPasswordRemove removes an app password, after which it can no longer be
+		// used for authentication.
+		async AppPasswordRemove(id) {
+			const fn = "AppPasswordRemove";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TLSPublicKeys returns the public keys of TLS client certificates registered for
+		// authentication with SASL mechanism EXTERNAL on IMAP and SMTP submission.
+		async TLSPublicKeys() {
+			const fn = "TLSPublicKeys";
+			const paramTypes = [];
+			const returnTypes = [["[]", "TLSPublicKey"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TLSPublicKeyAdd registers the public key of a TLS client certificate for
+		// authentication as loginAddress, which must be an address of the account. Key is
+		// a PEM-encoded certificate or public key, or a fingerprint of the public key: a
+		// SHA-256 hash of the DER-encoded SubjectPublicKeyInfo in hex.
+		async TLSPublicKeyAdd(name, loginAddress, key) {
+			const fn = "TLSPublicKeyAdd";
+			const paramTypes = [["string"], ["string"], ["string"]];
+			const returnTypes = [["TLSPublicKey"]];
+			const params = [name, loginAddress, key];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// TLSPublicKeyRemove removes a registered TLS public key by its fingerprint.
+		async TLSPublicKeyRemove(fingerprint) {
+			const fn = "TLSPublicKeyRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [fingerprint];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginAttempts returns the most recent authentication attempts for the account,
+		// newest first.
+		async LoginAttempts(limit) {
+			const fn = "LoginAttempts";
+			const paramTypes = [["int32"]];
+			const returnTypes = [["[]", "LoginAttempt"]];
+			const params = [limit];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginLockout returns whether authentication for the account is blocked after too
+		// many consecutive failed attempts, and until when. Sessions that were already
+		// logged in, like this one, are not affected.
+		async LoginLockout() {
+			const fn = "LoginLockout";
+			const paramTypes = [];
+			const returnTypes = [["bool"], ["timestamp"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginLockoutRemove unblocks authentication for the account.
+		async LoginLockoutRemove() {
+			const fn = "LoginLockoutRemove";
+			const paramTypes = [];
+			const returnTypes = [];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// Quarantine returns the messages for the account in the quarantine, most recent
+		// first.
+		async Quarantine() {
+			const fn = "Quarantine";
+			const paramTypes = [];
+			const returnTypes = [["[]", "Message"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QuarantineHeaders returns the header section of a quarantined message of the
+		// account.
+		async QuarantineHeaders(id) {
+			const fn = "QuarantineHeaders";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["string"]];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QuarantineRelease delivers a quarantined message to the account, and removes it
+		// from the quarantine. If train is set, the junk filter is trained with the
+		// message as non-junk.
+		async QuarantineRelease(id, train) {
+			const fn = "QuarantineRelease";
+			const paramTypes = [["int64"], ["bool"]];
+			const returnTypes = [];
+			const params = [id, train];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QuarantineDelete removes a message of the account from the quarantine.
+		async QuarantineDelete(id) {
+			const fn = "QuarantineDelete";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkFilter returns whether the junk filter is enabled for the account, its
+		// threshold and parameters, and statistics about its database. Statistics are
+		// not gathered while retraining.
+		async JunkFilter() {
+			const fn = "JunkFilter";
+			const paramTypes = [];
+			const returnTypes = [["bool"], ["float64"], ["Params"], ["JunkFilterStats"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkFilterSave changes the threshold and parameters of the junk filter of the
+		// account. The junk filter must already be enabled. Changes to the n-gram
+		// parameters only take effect for existing messages after retraining.
+		async JunkFilterSave(threshold, junkParams) {
+			const fn = "JunkFilterSave";
+			const paramTypes = [["float64"], ["Params"]];
+			const returnTypes = [];
+			const params = [threshold, junkParams];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkFilterReset removes all words from the junk filter of the account. Messages
+		// are not retrained, so the filter starts out empty.
+		async JunkFilterReset() {
+			const fn = "JunkFilterReset";
+			const paramTypes = [];
+			const returnTypes = [];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkFilterRetrain starts recreating the junk filter of the account from the
+		// junk and nonjunk flags of the messages in all mailboxes. Use
+		// JunkFilterRetrainProgress to follow progress. Deliveries to the account are
+		// delayed until retraining has finished.
+		async JunkFilterRetrain() {
+			const fn = "JunkFilterRetrain";
+			const paramTypes = [];
+			const returnTypes = [];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkFilterRetrainProgress returns the progress of the current or most recent
+		// retrain of the junk filter.
+		async JunkFilterRetrainProgress() {
+			const fn = "JunkFilterRetrainProgress";
+			const paramTypes = [];
+			const returnTypes = [["JunkRetrainProgress"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// Account returns information about the account: full name, the default domain,
 		// and the destinations (keys are email addresses, or localparts to the default
 		// domain). todo: replace with a function that returns the whole account, when
@@ -709,6 +954,8 @@ const login = async (reason) => {
 		let autosize;
 		let username;
 		let password;
+		let totpBox;
+		let totpCode;
 		const root = dom.div(style({ position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in' }), dom.div(reasonElem = reason ? dom.div(style({ marginBottom: '2ex', textAlign: 'center' }), reason) : dom.div(), dom.div(style({ backgroundColor: 'white', borderRadius: '.25em', padding: '1em', boxShadow: '0 0 20px rgba(0, 0, 0, 0.1)', border: '1px solid #ddd', maxWidth: '95vw', overflowX: 'auto', maxHeight: '95vh', overflowY: 'auto', marginBottom: '20vh' }), dom.form(async function submit(e) {
 			e.preventDefault();
 			e.stopPropagation();
@@ -716,7 +963,7 @@ const login = async (reason) => {
 			try {
 				fieldset.disabled = true;
 				const loginToken = await client.LoginPrep();
-				const token = await client.Login(loginToken, username.value, password.value);
+				const token = await client.Login(loginToken, username.value, password.value, totpCode.value);
 				try {
 					window.localStorage.setItem('webaccountaddress', username.value);
 					window.localStorage.setItem('webaccountcsrftoken', token);
@@ -731,13 +978,21 @@ const login = async (reason) => {
 				resolve(token);
 			}
 			catch (err) {
+				if (err.code === 'user:totpRequired') {
+					// Password was correct, ask for the second factor and submit again.
+					totpBox.style.display = '';
+					totpCode.required = true;
+					fieldset.disabled = false;
+					totpCode.focus();
+					return;
+				}
 				console.log('login error', err);
 				window.alert('Error: ' + errmsg(err));
 			}
 			finally {
 				fieldset.disabled = false;
 			}
-		}, fieldset = dom.fieldset(dom.h1('Account'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Email address', style({ marginBottom: '.5ex' })), autosize = dom.span(dom._class('autosize'), username = dom.input(attr.required(''), attr.placeholder('jane@example.org'), function change() { autosize.dataset.value = username.value; }, function input() { autosize.dataset.value = username.value; }))), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Password', style({ marginBottom: '.5ex' })), password = dom.input(attr.type('password'), attr.required(''))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Login')))))));
+		}, fieldset = dom.fieldset(dom.h1('Account'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Email address', style({ marginBottom: '.5ex' })), autosize = dom.span(dom._class('autosize'), username = dom.input(attr.required(''), attr.placeholder('jane@example.org'), function change() { autosize.dataset.value = username.value; }, function input() { autosize.dataset.value = username.value; }))), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Password', style({ marginBottom: '.5ex' })), password = dom.input(attr.type('password'), attr.required(''))), totpBox = dom.label(style({ display: 'none', marginBottom: '2ex' }), dom.div('Two-factor authentication code', style({ marginBottom: '.5ex' })), totpCode = dom.input(attr.autocomplete('one-time-code'), attr.title('Code from your authenticator app, or one of your recovery codes.'))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Login')))))));
 		document.body.appendChild(root);
 		username.focus();
 	});
@@ -823,6 +1078,260 @@ const index = async () => {
 	let mailboxPrefixHint;
 	let importProgress;
 	let importAbortBox;
+	let totpBox;
+	let appPasswordsBox;
+	let tlsPublicKeysBox;
+	let loginAttemptsBox;
+	let junkFilterBox;
+	const totpRecoveryCodes = (codes) => dom.div(box(yellow, 'Store these recovery codes in a safe place, they are only shown once. Each code can be used once instead of a code from your authenticator app, e.g. when you lose your device.'), dom.pre(codes.join('\n')));
+	// Render the two-factor authentication state in totpBox, with an optional extra
+	// element, e.g. with new recovery codes.
+	const totpRender = async (extra) => {
+		const [enabled, required, recoveryCodesLeft] = await client.TOTPStatus();
+		let codeFieldset;
+		let code;
+		const codeAction = async (fn) => {
+			if (!code.value) {
+				window.alert('Enter a code from your authenticator app, or a recovery code.');
+				return;
+			}
+			codeFieldset.disabled = true;
+			try {
+				await fn(code.value);
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+			}
+			finally {
+				codeFieldset.disabled = false;
+			}
+		};
+		if (enabled) {
+			dom._kids(totpBox, extra || [], dom.p('Two-factor authentication is enabled. Logins to webmail and this account page require a code from your authenticator app. IMAP, SMTP submission and CardDAV require an app password instead of your account password. Recovery codes left: ' + recoveryCodesLeft + '.'), codeFieldset = dom.fieldset(code = dom.input(attr.autocomplete('one-time-code'), attr.placeholder('Code or recovery code')), ' ', dom.clickbutton('Regenerate recovery codes', attr.title('Replace the recovery codes with new codes. The old codes can no longer be used.'), async function click() {
+				await codeAction(async (c) => {
+					const codes = await client.TOTPRecoveryCodesRegenerate(c);
+					await totpRender(totpRecoveryCodes(codes || []));
+				});
+			}), ' ', required ? [] : dom.clickbutton('Disable', async function click() {
+				await codeAction(async (c) => {
+					await client.TOTPDisable(c);
+					await totpRender();
+					await appPasswordsRender();
+				});
+			})));
+			return;
+		}
+		dom._kids(totpBox, required ? box(yellow, 'Two-factor authentication is required for this account. Until you enable it, you can only log in to this account page, not to webmail.') : [], dom.p('Protect logins to webmail and this account page with a code from an authenticator app, in addition to your password. Once enabled, IMAP, SMTP submission and CardDAV require an app password instead of your account password.'), dom.clickbutton('Enable two-factor authentication', async function click(e) {
+			const button = e.target;
+			button.disabled = true;
+			try {
+				const enrollment = await client.TOTPEnrollStart();
+				dom._kids(totpBox, dom.p('Scan the QR code with your authenticator app, or enter the secret manually. Then enter the code shown by the app to complete enabling two-factor authentication.'), dom.img(attr.src('data:image/png;base64,' + enrollment.QRCodePNG), attr.title(enrollment.URI)), dom.p('Secret: ', dom.span(style({ fontFamily: 'monospace' }), enrollment.Secret)), dom.form(async function submit(e) {
+					e.preventDefault();
+					e.stopPropagation();
+					await codeAction(async (c) => {
+						const codes = await client.TOTPEnrollFinish(c);
+						await totpRender(totpRecoveryCodes(codes || []));
+						await appPasswordsRender();
+					});
+				}, codeFieldset = dom.fieldset(code = dom.input(attr.autocomplete('one-time-code'), attr.required(''), attr.placeholder('Code')), ' ', dom.submitbutton('Enable'))));
+				code.focus();
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				button.disabled = false;
+			}
+		}));
+	};
+	// Render the app passwords and a form to add one in appPasswordsBox, with an
+	// optional extra element, e.g. with a new password.
+	const appPasswordsRender = async (extra) => {
+		const [appPasswords, required] = await client.AppPasswords();
+		let appPasswordFieldset;
+		let appPasswordName;
+		dom._kids(appPasswordsBox, extra || [], dom.p('App passwords are generated passwords for email and contacts applications, for IMAP, SMTP submission and CardDAV, typically one per device. ' + (required ? 'Because two-factor authentication is enabled or required, these protocols do not accept your account password, only app passwords.' : 'These protocols also accept your account password, until two-factor authentication is enabled.')), dom.table(dom.thead(dom.tr(dom.th('Name'), dom.th('Created'), dom.th('Last used'), dom.th('Action'))), dom.tbody((appPasswords || []).length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'None')) : [], (appPasswords || []).map(ap => dom.tr(dom.td(ap.Name), dom.td(ap.Created.toLocaleString()), dom.td(ap.LastUsed.getTime() > 0 ? ap.LastUsed.toLocaleString() : '-'), dom.td(dom.clickbutton('Remove', async function click(e) {
+			if (!window.confirm('Are you sure you want to remove this app password? Applications using it can no longer log in.')) {
+				return;
+			}
+			const button = e.target;
+			button.disabled = true;
+			try {
+				await client.AppPasswordRemove(ap.ID);
+				await appPasswordsRender();
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				button.disabled = false;
+			}
+		})))))), dom.br(), dom.form(async function submit(e) {
+			e.preventDefault();
+			e.stopPropagation();
+			appPasswordFieldset.disabled = true;
+			try {
+				const password = await client.AppPasswordAdd(appPasswordName.value);
+				await appPasswordsRender(dom.div(box(yellow, 'New app password, configure it in your application now, it is only shown once: ', dom.span(style({ fontFamily: 'monospace' }), password))));
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+			}
+			finally {
+				appPasswordFieldset.disabled = false;
+			}
+		}, appPasswordFieldset = dom.fieldset(appPasswordName = dom.input(attr.required(''), attr.placeholder('e.g. phone')), ' ', dom.submitbutton('Add app password'))));
+	};
+	// Render the registered TLS public keys and a form to add a key in tlsPublicKeysBox.
+	const tlsPublicKeysRender = async () => {
+		const keys = await client.TLSPublicKeys();
+		let keyFieldset;
+		let keyName;
+		let keyLoginAddress;
+		let keyData;
+		dom._kids(tlsPublicKeysBox, dom.p('TLS client certificates with a registered public key can log in to IMAP and SMTP submission without password, with SASL mechanism EXTERNAL. Only on listeners configured to request client certificates.'), dom.table(dom.thead(dom.tr(dom.th('Name'), dom.th('Login address'), dom.th('Fingerprint'), dom.th('Action'))), dom.tbody((keys || []).length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'None')) : [], (keys || []).map(k => dom.tr(dom.td(k.Name), dom.td(k.LoginAddress), dom.td(style({ fontFamily: 'monospace' }), k.Fingerprint), dom.td(dom.clickbutton('Remove', async function click(e) {
+			if (!window.confirm('Are you sure you want to remove this key?')) {
+				return;
+			}
+			const button = e.target;
+			button.disabled = true;
+			try {
+				await client.TLSPublicKeyRemove(k.Fingerprint);
+				await tlsPublicKeysRender();
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				button.disabled = false;
+			}
+		})))))), dom.br(), dom.h3('Add key'), dom.form(async function submit(e) {
+			e.preventDefault();
+			e.stopPropagation();
+			keyFieldset.disabled = true;
+			try {
+				await client.TLSPublicKeyAdd(keyName.value, keyLoginAddress.value, keyData.value);
+				await tlsPublicKeysRender();
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+			}
+			finally {
+				keyFieldset.disabled = false;
+			}
+		}, keyFieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'Name', dom.br(), keyName = dom.input(attr.required(''), attr.placeholder('e.g. laptop'))), ' ', dom.label(style({ display: 'inline-block' }), 'Login address', dom.br(), keyLoginAddress = dom.select(attr.required(''), Object.keys(destinations || {}).filter(addr => !addr.startsWith('@')).sort().map(addr => dom.option(addr)))), dom.br(), dom.label(style({ display: 'inline-block', marginTop: '1ex' }), 'Certificate or public key in PEM format, or SHA-256 fingerprint of the public key in hex', dom.br(), keyData = dom.textarea(attr.required(''), attr.rows('6'), style({ width: '40em', fontFamily: 'monospace' }))), dom.br(), dom.submitbutton('Add key'))));
+	};
+	// Render recent login attempts for the account in loginAttemptsBox, and whether
+	// authentication is blocked after too many failed attempts.
+	const loginAttemptsRender = async () => {
+		const [[locked, until], attempts] = await Promise.all([
+			client.LoginLockout(),
+			client.LoginAttempts(50),
+		]);
+		dom._kids(loginAttemptsBox, dom.p('Recent authentication attempts for your account, for IMAP, SMTP submission, webmail and this account page. Check for attempts you do not recognize.'), locked ? dom.p(box(red, 'Authentication for IMAP, SMTP submission and webmail is blocked until ' + until.toString() + ' after too many failed attempts. ', dom.clickbutton('Unblock', async function click(e) {
+			const button = e.target;
+			button.disabled = true;
+			try {
+				await client.LoginLockoutRemove();
+				await loginAttemptsRender();
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				button.disabled = false;
+			}
+		}))) : [], dom.table(dom.thead(dom.tr(dom.th('Time'), dom.th('Login address'), dom.th('Protocol'), dom.th('Mechanism'), dom.th('Result'), dom.th('Remote IP'), dom.th('TLS'))), dom.tbody((attempts || []).length === 0 ? dom.tr(dom.td(attr.colspan('7'), 'None')) : [], (attempts || []).map(a => dom.tr(dom.td(a.Time.toLocaleString()), dom.td(a.LoginAddress), dom.td(a.Protocol), dom.td(a.AuthMech), dom.td(a.Result === 'ok' ? [] : style({ backgroundColor: a.Result === 'aborted' ? yellow : red }), a.Result), dom.td(a.RemoteIP), dom.td(a.TLS || '-'))))));
+	};
+	// Render junk filter statistics, settings and retrain/reset actions in
+	// junkFilterBox. While retraining, progress is refreshed periodically.
+	const junkFilterRender = async () => {
+		const [[enabled, threshold, params, stats], progress] = await Promise.all([
+			client.JunkFilter(),
+			client.JunkFilterRetrainProgress(),
+		]);
+		if (!enabled) {
+			dom._kids(junkFilterBox, dom.p('No junk filter is configured for your account.'));
+			return;
+		}
+		let junkFieldset;
+		let junkThreshold;
+		let junkOnegrams;
+		let junkTwograms;
+		let junkThreegrams;
+		let junkMaxPower;
+		let junkTopWords;
+		let junkIgnoreWords;
+		let junkRareWords;
+		let junkLinks;
+		let junkAttachments;
+		let junkStructure;
+		let junkAuthResults;
+		const action = async (e, confirmText, fn) => {
+			if (!window.confirm(confirmText)) {
+				return;
+			}
+			const button = e.target;
+			button.disabled = true;
+			try {
+				await fn();
+				await junkFilterRender();
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				button.disabled = false;
+			}
+		};
+		dom._kids(junkFilterBox, dom.p('The junk filter learns from the messages you mark as junk or non-junk, and classifies incoming messages based on the words they contain. In webmail, you can see why a message was classified as junk with "Explain junk classification".'), progress.Running ?
+			box(yellow, 'Retraining junk filter, ' + progress.Done + ' of ' + progress.Total + ' messages processed, ' + progress.Trained + ' trained. Incoming messages are delayed until retraining has finished.') :
+			dom.table(dom._class('slim'), dom.tr(dom.td('Messages trained as non-junk'), dom.td('' + stats.Hams)), dom.tr(dom.td('Messages trained as junk'), dom.td('' + stats.Spams)), dom.tr(dom.td('Words (combinations)'), dom.td('' + stats.Words)), dom.tr(dom.td('Database size'), dom.td(((stats.DBSize + stats.BloomSize) / (1024 * 1024)).toFixed(1) + ' MB'))), !progress.Running && progress.Error ? box(red, 'Retraining junk filter failed: ' + progress.Error) : [], !progress.Running && !progress.Error && progress.Finished ? dom.p('Retraining finished at ' + progress.Finished.toLocaleString() + ', ' + progress.Trained + ' of ' + progress.Total + ' messages trained.') : [], dom.br(), dom.h3('Settings'), dom.form(async function submit(e) {
+			e.preventDefault();
+			e.stopPropagation();
+			junkFieldset.disabled = true;
+			try {
+				const nparams = {
+					Onegrams: junkOnegrams.checked,
+					Twograms: junkTwograms.checked,
+					Threegrams: junkThreegrams.checked,
+					MaxPower: parseFloat(junkMaxPower.value),
+					TopWords: parseInt(junkTopWords.value),
+					IgnoreWords: parseFloat(junkIgnoreWords.value),
+					RareWords: parseInt(junkRareWords.value),
+					Links: junkLinks.checked,
+					Attachments: junkAttachments.checked,
+					Structure: junkStructure.checked,
+					AuthResults: junkAuthResults.checked,
+				};
+				await client.JunkFilterSave(parseFloat(junkThreshold.value), nparams);
+				window.alert('Junk filter settings saved.');
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+			}
+			finally {
+				junkFieldset.disabled = false;
+			}
+		}, junkFieldset = dom.fieldset(dom.table(dom._class('slim'), dom.tr(dom.td(dom.span('Threshold', attr.title('Spam probability between 0 and 1 above which incoming messages are rejected as junk. Lower values reject more messages. E.g. 0.95.'))), dom.td(junkThreshold = dom.input(attr.required(''), attr.value('' + threshold)))), dom.tr(dom.td(dom.span('Words', attr.title('Track ham/spam ranking for single words, and/or each two or three consecutive words. Changes only apply to existing messages after retraining.'))), dom.td(dom.label(junkOnegrams = dom.input(attr.type('checkbox'), params.Onegrams ? attr.checked('') : []), ' Single'), ' ', dom.label(junkTwograms = dom.input(attr.type('checkbox'), params.Twograms ? attr.checked('') : []), ' Two consecutive'), ' ', dom.label(junkThreegrams = dom.input(attr.type('checkbox'), params.Threegrams ? attr.checked('') : []), ' Three consecutive'))), dom.tr(dom.td(dom.span('Max power', attr.title('Maximum power a word (combination) can have. If spaminess is 0.99, and max power is 0.1, spaminess of the word will be set to 0.9. Similar for ham words.'))), dom.td(junkMaxPower = dom.input(attr.required(''), attr.value('' + params.MaxPower)))), dom.tr(dom.td(dom.span('Top words', attr.title('Number of most spammy/hammy words to use for calculating probability. E.g. 10.'))), dom.td(junkTopWords = dom.input(attr.type('number'), attr.required(''), attr.min('1'), attr.value('' + params.TopWords)))), dom.tr(dom.td(dom.span('Ignore words', attr.title('Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1, causing word (combinations) of 0.4 to 0.6 to be ignored.'))), dom.td(junkIgnoreWords = dom.input(attr.required(''), attr.value('' + params.IgnoreWords)))), dom.tr(dom.td(dom.span('Rare words', attr.title('Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2.'))), dom.td(junkRareWords = dom.input(attr.type('number'), attr.required(''), attr.min('0'), attr.value('' + params.RareWords)))), dom.tr(dom.td(dom.span('Features', attr.title('Besides words, also use these properties of messages for classification. Changes only apply to existing messages after retraining.'))), dom.td(dom.label(junkLinks = dom.input(attr.type('checkbox'), params.Links ? attr.checked('') : []), ' Link domains', attr.title('Domains of links, and their organizational domains.')), ' ', dom.label(junkAttachments = dom.input(attr.type('checkbox'), params.Attachments ? attr.checked('') : []), ' Attachment types', attr.title('Media types and file name extensions of attachments.')), ' ', dom.label(junkStructure = dom.input(attr.type('checkbox'), params.Structure ? attr.checked('') : []), ' Structure', attr.title('Text and/or HTML parts, ratio of text to markup in HTML, and header anomalies such as a missing Date header or mismatching Message-ID domain.')), ' ', dom.label(junkAuthResults = dom.input(attr.type('checkbox'), params.AuthResults ? attr.checked('') : []), ' Authentication results', attr.title('SPF, DKIM and DMARC verdicts determined during delivery.'))))), dom.submitbutton('Save'))), dom.br(), dom.h3('Training'), dom.p('Retraining recreates the junk filter from all messages in your mailboxes that are marked as junk or non-junk. Resetting removes all words from the junk filter, it will only learn from messages marked as junk or non-junk from then on.'), dom.div(dom.clickbutton('Retrain', progress.Running ? attr.disabled('') : [], async function click(e) {
+			await action(e, 'Are you sure you want to retrain the junk filter?', () => client.JunkFilterRetrain());
+		}), ' ', dom.clickbutton('Reset', progress.Running ? attr.disabled('') : [], async function click(e) {
+			await action(e, 'Are you sure you want to reset the junk filter? All learned words will be removed.', () => client.JunkFilterReset());
+		})));
+		if (progress.Running) {
+			window.setTimeout(async () => {
+				if (!junkFilterBox.isConnected) {
+					return;
+				}
+				try {
+					await junkFilterRender();
+				}
+				catch (err) {
+					console.log({ err });
+				}
+			}, 1000);
+		}
+	};
 	const importTrack = async (token) => {
 		const importConnection = dom.div('Waiting for updates...');
 		importProgress.appendChild(importConnection);
@@ -915,7 +1424,7 @@ const index = async () => {
 		finally {
 			fullNameFieldset.disabled = false;
 		}
-	}), dom.br(), dom.h2('Addresses'), dom.ul(Object.entries(destinations).sort().map(t => dom.li(dom.a(t[0], attr.href('#destinations/' + t[0])), t[0].startsWith('@') ? ' (catchall)' : []))), dom.br(), dom.h2('Change password'), passwordForm = dom.form(passwordFieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'New password', dom.br(), password1 = dom.input(attr.type('password'), attr.autocomplete('new-password'), attr.required(''), function focus() {
+	}), dom.br(), dom.h2('Addresses'), dom.ul(Object.entries(destinations).sort().map(t => dom.li(dom.a(t[0], attr.href('#destinations/' + t[0])), t[0].startsWith('@') ? ' (catchall)' : []))), dom.br(), dom.h2('Quarantine'), dom.p('Incoming messages that may be spam or otherwise harmful can be held in the quarantine instead of being delivered. ', dom.a('View quarantined messages', attr.href('#quarantine')), '.'), dom.br(), dom.h2('Change password'), passwordForm = dom.form(passwordFieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'New password', dom.br(), password1 = dom.input(attr.type('password'), attr.autocomplete('new-password'), attr.required(''), function focus() {
 		passwordHint.style.display = '';
 	})), ' ', dom.label(style({ display: 'inline-block' }), 'New password repeat', dom.br(), password2 = dom.input(attr.type('password'), attr.autocomplete('new-password'), attr.required(''))), ' ', dom.submitbutton('Change password')), passwordHint = dom.div(style({ display: 'none', marginTop: '.5ex' }), dom.clickbutton('Generate random password', function click(e) {
 		e.preventDefault();
@@ -953,7 +1462,7 @@ const index = async () => {
 		finally {
 			passwordFieldset.disabled = false;
 		}
-	}), dom.br(), dom.h2('Export'), dom.p('Export all messages in all mailboxes. In maildir or mbox format, as .zip or .tgz file.'), dom.table(dom._class('slim'), dom.tr(dom.td('Maildirs in .tgz'), dom.td(exportForm('mail-export-maildir.tgz'))), dom.tr(dom.td('Maildirs in .zip'), dom.td(exportForm('mail-export-maildir.zip'))), dom.tr(dom.td('Mbox files in .tgz'), dom.td(exportForm('mail-export-mbox.tgz'))), dom.tr(dom.td('Mbox files in .zip'), dom.td(exportForm('mail-export-mbox.zip')))), dom.br(), dom.h2('Import'), dom.p('Import messages from a .zip or .tgz file with maildirs and/or mbox files.'), importForm = dom.form(async function submit(e) {
+	}), dom.br(), dom.h2('Two-factor authentication'), totpBox = dom.div(), dom.br(), dom.h2('App passwords'), appPasswordsBox = dom.div(), dom.br(), dom.h2('TLS client certificates'), tlsPublicKeysBox = dom.div(), dom.br(), dom.h2('Login attempts'), loginAttemptsBox = dom.div(), dom.br(), dom.h2('Junk filter'), junkFilterBox = dom.div(), dom.br(), dom.h2('Export'), dom.p('Export all messages in all mailboxes. In maildir or mbox format, as .zip or .tgz file.'), dom.table(dom._class('slim'), dom.tr(dom.td('Maildirs in .tgz'), dom.td(exportForm('mail-export-maildir.tgz'))), dom.tr(dom.td('Maildirs in .zip'), dom.td(exportForm('mail-export-maildir.zip'))), dom.tr(dom.td('Mbox files in .tgz'), dom.td(exportForm('mail-export-mbox.tgz'))), dom.tr(dom.td('Mbox files in .zip'), dom.td(exportForm('mail-export-mbox.zip')))), dom.br(), dom.h2('Import'), dom.p('Import messages from a .zip or .tgz file with maildirs and/or mbox files.'), importForm = dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
 		const request = async () => {
@@ -1019,6 +1528,11 @@ const index = async () => {
 		mailboxPrefixHint.style.display = '';
 	})), mailboxPrefixHint = dom.p(style({ display: 'none', fontStyle: 'italic', marginTop: '.5ex' }), 'If set, any mbox/maildir path with this prefix will have it stripped before importing. For example, if all mailboxes are in a directory "Takeout", specify that path in the field above so mailboxes like "Takeout/Inbox.mbox" are imported into a mailbox called "Inbox" instead of "Takeout/Inbox".')), dom.div(dom.submitbutton('Upload and import'), dom.p(style({ fontStyle: 'italic', marginTop: '.5ex' }), 'The file is uploaded first, then its messages are imported, finally messages are matched for threading. Importing is done in a transaction, you can abort the entire import before it is finished.')))), importAbortBox = dom.div(), // Outside fieldset because it gets disabled, above progress because may be scrolling it down quickly with problems.
 	importProgress = dom.div(style({ display: 'none' })), footer);
+	await totpRender();
+	await appPasswordsRender();
+	await tlsPublicKeysRender();
+	await loginAttemptsRender();
+	await junkFilterRender();
 	// Try to show the progress of an earlier import session. The user may have just
 	// refreshed the browser.
 	let importToken;
@@ -1164,6 +1678,67 @@ const destination = async (name) => {
 		}
 	}), dom.br(), dom.br(), dom.br(), dom.p("Apple's mail applications don't do account autoconfiguration, and when adding an account it can choose defaults that don't work with modern email servers. Adding an account through a \"mobileconfig\" profile file can be more convenient: It contains the IMAP/SMTP settings such as host name, port, TLS, authentication mechanism and user name. This profile does not contain a login password. Opening the profile adds it under Profiles in System Preferences (macOS) or Settings (iOS), where you can install it. These profiles are not signed, so users will have to ignore the warnings about them being unsigned. ", dom.br(), dom.a(attr.href('https://autoconfig.' + domainName(domain) + '/profile.mobileconfig?addresses=' + encodeURIComponent(addresses.join(',')) + '&name=' + encodeURIComponent(dest.FullName)), attr.download(''), 'Download .mobileconfig email account profile'), dom.br(), dom.a(attr.href('https://autoconfig.' + domainName(domain) + '/profile.mobileconfig.qrcode.png?addresses=' + encodeURIComponent(addresses.join(',')) + '&name=' + encodeURIComponent(dest.FullName)), attr.download(''), 'Open QR-code with link to .mobileconfig profile')));
 };
+const quarantine = async (selectedID) => {
+	const msgs = await client.Quarantine() || [];
+	const headersBox = dom.div();
+	const showHeaders = async (m) => {
+		const headers = await client.QuarantineHeaders(m.ID);
+		dom._kids(headersBox, dom.h2('Headers of message from ' + (m.MsgFrom || m.MailFrom || '(unknown)')), dom.pre(headers));
+		headersBox.scrollIntoView();
+	};
+	const action = async (e, fn) => {
+		const target = e.target;
+		try {
+			target.disabled = true;
+			await fn();
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			target.disabled = false;
+		}
+		if (window.location.hash !== '#quarantine') {
+			// Hash change handler renders the page again.
+			window.location.hash = '#quarantine';
+		}
+		else {
+			await quarantine();
+		}
+	};
+	dom._kids(page, crumbs(crumblink('Mox Account', '#'), 'Quarantine'), dom.p('Incoming messages for you that were held back because they may be spam or otherwise harmful. Only headers are shown. If you recognize a message as legitimate, release it to deliver it to your mailbox. Releasing and training as non-junk also teaches your junk filter that similar messages are not spam.'), msgs.length === 0 ? dom.p('No messages in the quarantine.') : dom.table(dom.thead(dom.tr(dom.th('Received'), dom.th('From'), dom.th('To'), dom.th('Subject'), dom.th('Reason'), dom.th('Action'))), dom.tbody(msgs.map(m => dom.tr(m.ID === selectedID ? style({ backgroundColor: yellow }) : [], dom.td(m.Received.toLocaleString()), dom.td(m.MsgFrom || '-', attr.title('SMTP MAIL FROM: ' + (m.MailFrom || '(null sender)'))), dom.td(m.RcptTo), dom.td(m.Subject), dom.td(m.Reason), dom.td(dom.clickbutton('Headers', async function click(e) {
+		const target = e.target;
+		try {
+			target.disabled = true;
+			await showHeaders(m);
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+		}
+		finally {
+			target.disabled = false;
+		}
+	}), ' ', dom.clickbutton('Release', async function click(e) {
+		await action(e, () => client.QuarantineRelease(m.ID, false));
+	}), ' ', dom.clickbutton('Release and train as non-junk', async function click(e) {
+		await action(e, () => client.QuarantineRelease(m.ID, true));
+	}), ' ', dom.clickbutton('Delete', async function click(e) {
+		if (!window.confirm('Are you sure you want to remove this message? It will be removed completely.')) {
+			return;
+		}
+		await action(e, () => client.QuarantineDelete(m.ID));
+	})))))), dom.br(), headersBox);
+	const selected = msgs.find(m => m.ID === selectedID);
+	if (selectedID !== undefined && !selected) {
+		dom._kids(headersBox, box(yellow, 'Message is no longer in the quarantine, it may have been released, removed or expired.'));
+	}
+	else if (selected) {
+		await showHeaders(selected);
+	}
+};
 const init = async () => {
 	let curhash;
 	const hashChange = async () => {
@@ -1183,6 +1758,12 @@ const init = async () => {
 			else if (t[0] === 'destinations' && t.length === 2) {
 				await destination(t[1]);
 			}
+			else if (h === 'quarantine') {
+				await quarantine();
+			}
+			else if (t[0] === 'quarantine' && t.length === 2 && /^[0-9]+$/.test(t[1])) {
+				await quarantine(parseInt(t[1]));
+			}
 			else {
 				dom._kids(page, 'page not found');
 			}
@@ -12,6 +12,8 @@ const login = async (reason: string) => {
 		let autosize: HTMLElement
 		let username: HTMLInputElement
 		let password: HTMLInputElement
+		let totpBox: HTMLElement
+		let totpCode: HTMLInputElement
 
 		const root = dom.div(
 			style({position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: '1', animation: 'fadein .15s ease-in'}),
@@ -29,7 +31,7 @@ const login = async (reason: string) => {
 							try {
 								fieldset.disabled = true
 								const loginToken = await client.LoginPrep()
-								const token = await client.Login(loginToken, username.value, password.value)
+								const token = await client.Login(loginToken, username.value, password.value, totpCode.value)
 								try {
 									window.localStorage.setItem('webaccountaddress', username.value)
 									window.localStorage.setItem('webaccountcsrftoken', token)
@@ -42,6 +44,14 @@ const login = async (reason: string) => {
 								}
 								resolve(token)
 							} catch (err) {
+								if ((err as any).code === 'user:totpRequired') {
+									// Password was correct, ask for the second factor and submit again.
+									totpBox.style.display = ''
+									totpCode.required = true
+									fieldset.disabled = false
+									totpCode.focus()
+									return
+								}
 								console.log('login error', err)
 								window.alert('Error: ' + errmsg(err))
 							} finally {
@@ -67,6 +77,11 @@ const login = async (reason: string) => {
 								dom.div('Password', style({marginBottom: '.5ex'})),
 								password=dom.input(attr.type('password'), attr.required('')),
 							),
+							totpBox=dom.label(
+								style({display: 'none', marginBottom: '2ex'}),
+								dom.div('Two-factor authentication code', style({marginBottom: '.5ex'})),
+								totpCode=dom.input(attr.autocomplete('one-time-code'), attr.title('Code from your authenticator app, or one of your recovery codes.')),
+							),
 							dom.div(
 								style({textAlign: 'center'}),
 								dom.submitbutton('Login'),
@@ -186,6 +201,487 @@ const index = async () => {
 	let importProgress: HTMLElement
 	let importAbortBox: HTMLElement
 
+	let totpBox: HTMLElement
+	let appPasswordsBox: HTMLElement
+	let tlsPublicKeysBox: HTMLElement
+	let loginAttemptsBox: HTMLElement
+	let junkFilterBox: HTMLElement
+
+	const totpRecoveryCodes = (codes: string[]) => dom.div(
+		box(yellow, 'Store these recovery codes in a safe place, they are only shown once. Each code can be used once instead of a code from your authenticator app, e.g. when you lose your device.'),
+		dom.pre(codes.join('\n')),
+	)
+
+	// Render the two-factor authentication state in totpBox, with an optional extra
+	// element, e.g. with new recovery codes.
+	const totpRender = async (extra?: HTMLElement) => {
+		const [enabled, required, recoveryCodesLeft] = await client.TOTPStatus()
+
+		let codeFieldset: HTMLFieldSetElement
+		let code: HTMLInputElement
+
+		const codeAction = async (fn: (code: string) => Promise<void>) => {
+			if (!code.value) {
+				window.alert('Enter a code from your authenticator app, or a recovery code.')
+				return
+			}
+			codeFieldset.disabled = true
+			try {
+				await fn(code.value)
+			} catch (err) {
+				console.log({err})
+				window.alert('Error: ' + errmsg(err))
+			} finally {
+				codeFieldset.disabled = false
+			}
+		}
+
+		if (enabled) {
+			dom._kids(totpBox,
+				extra || [],
+				dom.p('Two-factor authentication is enabled. Logins to webmail and this account page require a code from your authenticator app. IMAP, SMTP submission and CardDAV require an app password instead of your account password. Recovery codes left: ' + recoveryCodesLeft + '.'),
+				codeFieldset=dom.fieldset(
+					code=dom.input(attr.autocomplete('one-time-code'), attr.placeholder('Code or recovery code')),
+					' ',
+					dom.clickbutton('Regenerate recovery codes', attr.title('Replace the recovery codes with new codes. The old codes can no longer be used.'), async function click() {
+						await codeAction(async (c: string) => {
+							const codes = await client.TOTPRecoveryCodesRegenerate(c)
+							await totpRender(totpRecoveryCodes(codes || []))
+						})
+					}),
+					' ',
+					required ? [] : dom.clickbutton('Disable', async function click() {
+						await codeAction(async (c: string) => {
+							await client.TOTPDisable(c)
+							await totpRender()
+							await appPasswordsRender()
+						})
+					}),
+				),
+			)
+			return
+		}
+
+		dom._kids(totpBox,
+			required ? box(yellow, 'Two-factor authentication is required for this account. Until you enable it, you can only log in to this account page, not to webmail.') : [],
+			dom.p('Protect logins to webmail and this account page with a code from an authenticator app, in addition to your password. Once enabled, IMAP, SMTP submission and CardDAV require an app password instead of your account password.'),
+			dom.clickbutton('Enable two-factor authentication', async function click(e: MouseEvent) {
+				const button = e.target! as HTMLButtonElement
+				button.disabled = true
+				try {
+					const enrollment = await client.TOTPEnrollStart()
+					dom._kids(totpBox,
+						dom.p('Scan the QR code with your authenticator app, or enter the secret manually. Then enter the code shown by the app to complete enabling two-factor authentication.'),
+						dom.img(attr.src('data:image/png;base64,' + enrollment.QRCodePNG), attr.title(enrollment.URI)),
+						dom.p('Secret: ', dom.span(style({fontFamily: 'monospace'}), enrollment.Secret)),
+						dom.form(
+							async function submit(e: SubmitEvent) {
+								e.preventDefault()
+								e.stopPropagation()
+								await codeAction(async (c: string) => {
+									const codes = await client.TOTPEnrollFinish(c)
+									await totpRender(totpRecoveryCodes(codes || []))
+									await appPasswordsRender()
+								})
+							},
+							codeFieldset=dom.fieldset(
+								code=dom.input(attr.autocomplete('one-time-code'), attr.required(''), attr.placeholder('Code')),
+								' ',
+								dom.submitbutton('Enable'),
+							),
+						),
+					)
+					code.focus()
+				} catch (err) {
+					console.log({err})
+					window.alert('Error: ' + errmsg(err))
+					button.disabled = false
+				}
+			}),
+		)
+	}
+
+	// Render the app passwords and a form to add one in appPasswordsBox, with an
+	// optional extra element, e.g. with a new password.
+	const appPasswordsRender = async (extra?: HTMLElement) => {
+		const [appPasswords, required] = await client.AppPasswords()
+
+		let appPasswordFieldset: HTMLFieldSetElement
+		let appPasswordName: HTMLInputElement
+
+		dom._kids(appPasswordsBox,
+			extra || [],
+			dom.p('App passwords are generated passwords for email and contacts applications, for IMAP, SMTP submission and CardDAV, typically one per device. ' + (required ? 'Because two-factor authentication is enabled or required, these protocols do not accept your account password, only app passwords.' : 'These protocols also accept your account password, until two-factor authentication is enabled.')),
+			dom.table(
+				dom.thead(
+					dom.tr(
+						dom.th('Name'),
+						dom.th('Created'),
+						dom.th('Last used'),
+						dom.th('Action'),
+					),
+				),
+				dom.tbody(
+					(appPasswords || []).length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'None')) : [],
+					(appPasswords || []).map(ap =>
+						dom.tr(
+							dom.td(ap.Name),
+							dom.td(ap.Created.toLocaleString()),
+							dom.td(ap.LastUsed.getTime() > 0 ? ap.LastUsed.toLocaleString() : '-'),
+							dom.td(
+								dom.clickbutton('Remove', async function click(e: MouseEvent) {
+									if (!window.confirm('Are you sure you want to remove this app password? Applications using it can no longer log in.')) {
+										return
+									}
+									const button = e.target! as HTMLButtonElement
+									button.disabled = true
+									try {
+										await client.AppPasswordRemove(ap.ID)
+										await appPasswordsRender()
+									} catch (err) {
+										console.log({err})
+										window.alert('Error: ' + errmsg(err))
+										button.disabled = false
+									}
+								}),
+							),
+						)
+					),
+				),
+			),
+			dom.br(),
+			dom.form(
+				async function submit(e: SubmitEvent) {
+					e.preventDefault()
+					e.stopPropagation()
+					appPasswordFieldset.disabled = true
+					try {
+						const password = await client.AppPasswordAdd(appPasswordName.value)
+						await appPasswordsRender(dom.div(box(yellow, 'New app password, configure it in your application now, it is only shown once: ', dom.span(style({fontFamily: 'monospace'}), password))))
+					} catch (err) {
+						console.log({err})
+						window.alert('Error: ' + errmsg(err))
+					} finally {
+						appPasswordFieldset.disabled = false
+					}
+				},
+				appPasswordFieldset=dom.fieldset(
+					appPasswordName=dom.input(attr.required(''), attr.placeholder('e.g. phone')),
+					' ',
+					dom.submitbutton('Add app password'),
+				),
+			),
+		)
+	}
+
+	// Render the registered TLS public keys and a form to add a key in tlsPublicKeysBox.
+	const tlsPublicKeysRender = async () => {
+		const keys = await client.TLSPublicKeys()
+
+		let keyFieldset: HTMLFieldSetElement
+		let keyName: HTMLInputElement
+		let keyLoginAddress: HTMLSelectElement
+		let keyData: HTMLTextAreaElement
+
+		dom._kids(tlsPublicKeysBox,
+			dom.p('TLS client certificates with a registered public key can log in to IMAP and SMTP submission without password, with SASL mechanism EXTERNAL. Only on listeners configured to request client certificates.'),
+			dom.table(
+				dom.thead(
+					dom.tr(
+						dom.th('Name'),
+						dom.th('Login address'),
+						dom.th('Fingerprint'),
+						dom.th('Action'),
+					),
+				),
+				dom.tbody(
+					(keys || []).length === 0 ? dom.tr(dom.td(attr.colspan('4'), 'None')) : [],
+					(keys || []).map(k =>
+						dom.tr(
+							dom.td(k.Name),
+							dom.td(k.LoginAddress),
+							dom.td(style({fontFamily: 'monospace'}), k.Fingerprint),
+							dom.td(
+								dom.clickbutton('Remove', async function click(e: MouseEvent) {
+									if (!window.confirm('Are you sure you want to remove this key?')) {
+										return
+									}
+									const button = e.target! as HTMLButtonElement
+									button.disabled = true
+									try {
+										await client.TLSPublicKeyRemove(k.Fingerprint)
+										await tlsPublicKeysRender()
+									} catch (err) {
+										console.log({err})
+										window.alert('Error: ' + errmsg(err))
+										button.disabled = false
+									}
+								}),
+							),
+						)
+					),
+				),
+			),
+			dom.br(),
+			dom.h3('Add key'),
+			dom.form(
+				async function submit(e: SubmitEvent) {
+					e.preventDefault()
+					e.stopPropagation()
+					keyFieldset.disabled = true
+					try {
+						await client.TLSPublicKeyAdd(keyName.value, keyLoginAddress.value, keyData.value)
+						await tlsPublicKeysRender()
+					} catch (err) {
+						console.log({err})
+						window.alert('Error: ' + errmsg(err))
+					} finally {
+						keyFieldset.disabled = false
+					}
+				},
+				keyFieldset=dom.fieldset(
+					dom.label(
+						style({display: 'inline-block'}),
+						'Name',
+						dom.br(),
+						keyName=dom.input(attr.required(''), attr.placeholder('e.g. laptop')),
+					),
+					' ',
+					dom.label(
+						style({display: 'inline-block'}),
+						'Login address',
+						dom.br(),
+						keyLoginAddress=dom.select(
+							attr.required(''),
+							Object.keys(destinations || {}).filter(addr => !addr.startsWith('@')).sort().map(addr => dom.option(addr)),
+						),
+					),
+					dom.br(),
+					dom.label(
+						style({display: 'inline-block', marginTop: '1ex'}),
+						'Certificate or public key in PEM format, or SHA-256 fingerprint of the public key in hex',
+						dom.br(),
+						keyData=dom.textarea(attr.required(''), attr.rows('6'), style({width: '40em', fontFamily: 'monospace'})),
+					),
+					dom.br(),
+					dom.submitbutton('Add key'),
+				),
+			),
+		)
+	}
+
+	// Render recent login attempts for the account in loginAttemptsBox, and whether
+	// authentication is blocked after too many failed attempts.
+	const loginAttemptsRender = async () => {
+		const [[locked, until], attempts] = await Promise.all([
+			client.LoginLockout(),
+			client.LoginAttempts(50),
+		])
+
+		dom._kids(loginAttemptsBox,
+			dom.p('Recent authentication attempts for your account, for IMAP, SMTP submission, webmail and this account page. Check for attempts you do not recognize.'),
+			locked ? dom.p(
+				box(red,
+					'Authentication for IMAP, SMTP submission and webmail is blocked until ' + until.toString() + ' after too many failed attempts. ',
+					dom.clickbutton('Unblock', async function click(e: MouseEvent) {
+						const button = e.target! as HTMLButtonElement
+						button.disabled = true
+						try {
+							await client.LoginLockoutRemove()
+							await loginAttemptsRender()
+						} catch (err) {
+							console.log({err})
+							window.alert('Error: ' + errmsg(err))
+							button.disabled = false
+						}
+					}),
+				),
+			) : [],
+			dom.table(
+				dom.thead(
+					dom.tr(
+						dom.th('Time'),
+						dom.th('Login address'),
+						dom.th('Protocol'),
+						dom.th('Mechanism'),
+						dom.th('Result'),
+						dom.th('Remote IP'),
+						dom.th('TLS'),
+					),
+				),
+				dom.tbody(
+					(attempts || []).length === 0 ? dom.tr(dom.td(attr.colspan('7'), 'None')) : [],
+					(attempts || []).map(a =>
+						dom.tr(
+							dom.td(a.Time.toLocaleString()),
+							dom.td(a.LoginAddress),
+							dom.td(a.Protocol),
+							dom.td(a.AuthMech),
+							dom.td(a.Result === 'ok' ? [] : style({backgroundColor: a.Result === 'aborted' ? yellow : red}), a.Result),
+							dom.td(a.RemoteIP),
+							dom.td(a.TLS || '-'),
+						)
+					),
+				),
+			),
+		)
+	}
+
+	// Render junk filter statistics, settings and retrain/reset actions in
+	// junkFilterBox. While retraining, progress is refreshed periodically.
+	const junkFilterRender = async () => {
+		const [[enabled, threshold, params, stats], progress] = await Promise.all([
+			client.JunkFilter(),
+			client.JunkFilterRetrainProgress(),
+		])
+		if (!enabled) {
+			dom._kids(junkFilterBox, dom.p('No junk filter is configured for your account.'))
+			return
+		}
+
+		let junkFieldset: HTMLFieldSetElement
+		let junkThreshold: HTMLInputElement
+		let junkOnegrams: HTMLInputElement
+		let junkTwograms: HTMLInputElement
+		let junkThreegrams: HTMLInputElement
+		let junkMaxPower: HTMLInputElement
+		let junkTopWords: HTMLInputElement
+		let junkIgnoreWords: HTMLInputElement
+		let junkRareWords: HTMLInputElement
+		let junkLinks: HTMLInputElement
+		let junkAttachments: HTMLInputElement
+		let junkStructure: HTMLInputElement
+		let junkAuthResults: HTMLInputElement
+
+		const action = async (e: MouseEvent, confirmText: string, fn: () => Promise<void>) => {
+			if (!window.confirm(confirmText)) {
+				return
+			}
+			const button = e.target! as HTMLButtonElement
+			button.disabled = true
+			try {
+				await fn()
+				await junkFilterRender()
+			} catch (err) {
+				console.log({err})
+				window.alert('Error: ' + errmsg(err))
+				button.disabled = false
+			}
+		}
+
+		dom._kids(junkFilterBox,
+			dom.p('The junk filter learns from the messages you mark as junk or non-junk, and classifies incoming messages based on the words they contain. In webmail, you can see why a message was classified as junk with "Explain junk classification".'),
+			progress.Running ?
+				box(yellow, 'Retraining junk filter, ' + progress.Done + ' of ' + progress.Total + ' messages processed, ' + progress.Trained + ' trained. Incoming messages are delayed until retraining has finished.') :
+				dom.table(dom._class('slim'),
+					dom.tr(dom.td('Messages trained as non-junk'), dom.td(''+stats.Hams)),
+					dom.tr(dom.td('Messages trained as junk'), dom.td(''+stats.Spams)),
+					dom.tr(dom.td('Words (combinations)'), dom.td(''+stats.Words)),
+					dom.tr(dom.td('Database size'), dom.td(((stats.DBSize + stats.BloomSize)/(1024*1024)).toFixed(1) + ' MB')),
+				),
+			!progress.Running && progress.Error ? box(red, 'Retraining junk filter failed: ' + progress.Error) : [],
+			!progress.Running && !progress.Error && progress.Finished ? dom.p('Retraining finished at ' + progress.Finished.toLocaleString() + ', ' + progress.Trained + ' of ' + progress.Total + ' messages trained.') : [],
+			dom.br(),
+			dom.h3('Settings'),
+			dom.form(
+				async function submit(e: SubmitEvent) {
+					e.preventDefault()
+					e.stopPropagation()
+					junkFieldset.disabled = true
+					try {
+						const nparams: api.Params = {
+							Onegrams: junkOnegrams.checked,
+							Twograms: junkTwograms.checked,
+							Threegrams: junkThreegrams.checked,
+							MaxPower: parseFloat(junkMaxPower.value),
+							TopWords: parseInt(junkTopWords.value),
+							IgnoreWords: parseFloat(junkIgnoreWords.value),
+							RareWords: parseInt(junkRareWords.value),
+							Links: junkLinks.checked,
+							Attachments: junkAttachments.checked,
+							Structure: junkStructure.checked,
+							AuthResults: junkAuthResults.checked,
+						}
+						await client.JunkFilterSave(parseFloat(junkThreshold.value), nparams)
+						window.alert('Junk filter settings saved.')
+					} catch (err) {
+						console.log({err})
+						window.alert('Error: ' + errmsg(err))
+					} finally {
+						junkFieldset.disabled = false
+					}
+				},
+				junkFieldset=dom.fieldset(
+					dom.table(dom._class('slim'),
+						dom.tr(
+							dom.td(dom.span('Threshold', attr.title('Spam probability between 0 and 1 above which incoming messages are rejected as junk. Lower values reject more messages. E.g. 0.95.'))),
+							dom.td(junkThreshold=dom.input(attr.required(''), attr.value(''+threshold))),
+						),
+						dom.tr(
+							dom.td(dom.span('Words', attr.title('Track ham/spam ranking for single words, and/or each two or three consecutive words. Changes only apply to existing messages after retraining.'))),
+							dom.td(
+								dom.label(junkOnegrams=dom.input(attr.type('checkbox'), params.Onegrams ? attr.checked('') : []), ' Single'), ' ',
+								dom.label(junkTwograms=dom.input(attr.type('checkbox'), params.Twograms ? attr.checked('') : []), ' Two consecutive'), ' ',
+								dom.label(junkThreegrams=dom.input(attr.type('checkbox'), params.Threegrams ? attr.checked('') : []), ' Three consecutive'),
+							),
+						),
+						dom.tr(
+							dom.td(dom.span('Max power', attr.title('Maximum power a word (combination) can have. If spaminess is 0.99, and max power is 0.1, spaminess of the word will be set to 0.9. Similar for ham words.'))),
+							dom.td(junkMaxPower=dom.input(attr.required(''), attr.value(''+params.MaxPower))),
+						),
+						dom.tr(
+							dom.td(dom.span('Top words', attr.title('Number of most spammy/hammy words to use for calculating probability. E.g. 10.'))),
+							dom.td(junkTopWords=dom.input(attr.type('number'), attr.required(''), attr.min('1'), attr.value(''+params.TopWords))),
+						),
+						dom.tr(
+							dom.td(dom.span('Ignore words', attr.title('Ignore words that are this much away from 0.5 haminess/spaminess. E.g. 0.1, causing word (combinations) of 0.4 to 0.6 to be ignored.'))),
+							dom.td(junkIgnoreWords=dom.input(attr.required(''), attr.value(''+params.IgnoreWords))),
+						),
+						dom.tr(
+							dom.td(dom.span('Rare words', attr.title('Occurrences in word database until a word is considered rare and its influence in calculating probability reduced. E.g. 1 or 2.'))),
+							dom.td(junkRareWords=dom.input(attr.type('number'), attr.required(''), attr.min('0'), attr.value(''+params.RareWords))),
+						),
+						dom.tr(
+							dom.td(dom.span('Features', attr.title('Besides words, also use these properties of messages for classification. Changes only apply to existing messages after retraining.'))),
+							dom.td(
+								dom.label(junkLinks=dom.input(attr.type('checkbox'), params.Links ? attr.checked('') : []), ' Link domains', attr.title('Domains of links, and their organizational domains.')), ' ',
+								dom.label(junkAttachments=dom.input(attr.type('checkbox'), params.Attachments ? attr.checked('') : []), ' Attachment types', attr.title('Media types and file name extensions of attachments.')), ' ',
+								dom.label(junkStructure=dom.input(attr.type('checkbox'), params.Structure ? attr.checked('') : []), ' Structure', attr.title('Text and/or HTML parts, ratio of text to markup in HTML, and header anomalies such as a missing Date header or mismatching Message-ID domain.')), ' ',
+								dom.label(junkAuthResults=dom.input(attr.type('checkbox'), params.AuthResults ? attr.checked('') : []), ' Authentication results', attr.title('SPF, DKIM and DMARC verdicts determined during delivery.')),
+							),
+						),
+					),
+					dom.submitbutton('Save'),
+				),
+			),
+			dom.br(),
+			dom.h3('Training'),
+			dom.p('Retraining recreates the junk filter from all messages in your mailboxes that are marked as junk or non-junk. Resetting removes all words from the junk filter, it will only learn from messages marked as junk or non-junk from then on.'),
+			dom.div(
+				dom.clickbutton('Retrain', progress.Running ? attr.disabled('') : [], async function click(e: MouseEvent) {
+					await action(e, 'Are you sure you want to retrain the junk filter?', () => client.JunkFilterRetrain())
+				}),
+				' ',
+				dom.clickbutton('Reset', progress.Running ? attr.disabled('') : [], async function click(e: MouseEvent) {
+					await action(e, 'Are you sure you want to reset the junk filter? All learned words will be removed.', () => client.JunkFilterReset())
+				}),
+			),
+		)
+
+		if (progress.Running) {
+			window.setTimeout(async () => {
+				if (!junkFilterBox.isConnected) {
+					return
+				}
+				try {
+					await junkFilterRender()
+				} catch (err) {
+					console.log({err})
+				}
+			}, 1000)
+		}
+	}
+
 	const importTrack = async (token: string) => {
 		const importConnection = dom.div('Waiting for updates...')
 		importProgress.appendChild(importConnection)
@@ -349,6 +845,9 @@ const index = async () => {
 			),
 		),
 		dom.br(),
+		dom.h2('Quarantine'),
+		dom.p('Incoming messages that may be spam or otherwise harmful can be held in the quarantine instead of being delivered. ', dom.a('View quarantined messages', attr.href('#quarantine')), '.'),
+		dom.br(),
 		dom.h2('Change password'),
 		passwordForm=dom.form(
 			passwordFieldset=dom.fieldset(
@@ -414,6 +913,21 @@ const index = async () => {
 			},
 		),
 		dom.br(),
+		dom.h2('Two-factor authentication'),
+		totpBox=dom.div(),
+		dom.br(),
+		dom.h2('App passwords'),
+		appPasswordsBox=dom.div(),
+		dom.br(),
+		dom.h2('TLS client certificates'),
+		tlsPublicKeysBox=dom.div(),
+		dom.br(),
+		dom.h2('Login attempts'),
+		loginAttemptsBox=dom.div(),
+		dom.br(),
+		dom.h2('Junk filter'),
+		junkFilterBox=dom.div(),
+		dom.br(),
 		dom.h2('Export'),
 		dom.p('Export all messages in all mailboxes. In maildir or mbox format, as .zip or .tgz file.'),
 		dom.table(dom._class('slim'),
@@ -537,6 +1051,12 @@ const index = async () => {
 		footer,
 	)
 
+	await totpRender()
+	await appPasswordsRender()
+	await tlsPublicKeysRender()
+	await loginAttemptsRender()
+	await junkFilterRender()
+
 	// Try to show the progress of an earlier import session. The user may have just
 	// refreshed the browser.
 	let importToken: string
@@ -793,6 +1313,111 @@ const destination = async (name: string) => {
 	)
 }
 
+const quarantine = async (selectedID?: number) => {
+	const msgs = await client.Quarantine() || []
+
+	const headersBox = dom.div()
+
+	const showHeaders = async (m: api.Message) => {
+		const headers = await client.QuarantineHeaders(m.ID)
+		dom._kids(headersBox,
+			dom.h2('Headers of message from ' + (m.MsgFrom || m.MailFrom || '(unknown)')),
+			dom.pre(headers),
+		)
+		headersBox.scrollIntoView()
+	}
+
+	const action = async (e: MouseEvent, fn: () => Promise<void>) => {
+		const target = e.target! as HTMLButtonElement
+		try {
+			target.disabled = true
+			await fn()
+		} catch (err) {
+			console.log({err})
+			window.alert('Error: ' + errmsg(err))
+			return
+		} finally {
+			target.disabled = false
+		}
+		if (window.location.hash !== '#quarantine') {
+			// Hash change handler renders the page again.
+			window.location.hash = '#quarantine'
+		} else {
+			await quarantine()
+		}
+	}
+
+	dom._kids(page,
+		crumbs(
+			crumblink('Mox Account', '#'),
+			'Quarantine',
+		),
+		dom.p('Incoming messages for you that were held back because they may be spam or otherwise harmful. Only headers are shown. If you recognize a message as legitimate, release it to deliver it to your mailbox. Releasing and training as non-junk also teaches your junk filter that similar messages are not spam.'),
+		msgs.length === 0 ? dom.p('No messages in the quarantine.') : dom.table(
+			dom.thead(
+				dom.tr(
+					dom.th('Received'),
+					dom.th('From'),
+					dom.th('To'),
+					dom.th('Subject'),
+					dom.th('Reason'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				msgs.map(m =>
+					dom.tr(
+						m.ID === selectedID ? style({backgroundColor: yellow}) : [],
+						dom.td(m.Received.toLocaleString()),
+						dom.td(m.MsgFrom || '-', attr.title('SMTP MAIL FROM: ' + (m.MailFrom || '(null sender)'))),
+						dom.td(m.RcptTo),
+						dom.td(m.Subject),
+						dom.td(m.Reason),
+						dom.td(
+							dom.clickbutton('Headers', async function click(e: MouseEvent) {
+								const target = e.target! as HTMLButtonElement
+								try {
+									target.disabled = true
+									await showHeaders(m)
+								} catch (err) {
+									console.log({err})
+									window.alert('Error: ' + errmsg(err))
+								} finally {
+									target.disabled = false
+								}
+							}),
+							' ',
+							dom.clickbutton('Release', async function click(e: MouseEvent) {
+								await action(e, () => client.QuarantineRelease(m.ID, false))
+							}),
+							' ',
+							dom.clickbutton('Release and train as non-junk', async function click(e: MouseEvent) {
+								await action(e, () => client.QuarantineRelease(m.ID, true))
+							}),
+							' ',
+							dom.clickbutton('Delete', async function click(e: MouseEvent) {
+								if (!window.confirm('Are you sure you want to remove this message? It will be removed completely.')) {
+									return
+								}
+								await action(e, () => client.QuarantineDelete(m.ID))
+							}),
+						),
+					),
+				),
+			),
+		),
+		dom.br(),
+		headersBox,
+	)
+
+	const selected = msgs.find(m => m.ID === selectedID)
+	if (selectedID !== undefined && !selected) {
+		dom._kids(headersBox, box(yellow, 'Message is no longer in the quarantine, it may have been released, removed or expired.'))
+	} else if (selected) {
+		await showHeaders(selected)
+	}
+}
+
 const init = async () => {
 	let curhash: string | undefined
 
@@ -811,6 +1436,10 @@ const init = async () => {
 				await index()
 			} else if (t[0] === 'destinations' && t.length === 2) {
 				await destination(t[1])
+			} else if (h === 'quarantine') {
+				await quarantine()
+			} else if (t[0] === 'quarantine' && t.length === 2 && /^[0-9]+$/.test(t[1])) {
+				await quarantine(parseInt(t[1]))
 			} else {
 				dom._kids(page, 'page not found')
 			}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/base32"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,17 +17,21 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime/debug"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mjl-/bstore"
 	"github.com/mjl-/sherpa"
 
+	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
 	"github.com/qompassai/beacon/store"
+	"github.com/qompassai/beacon/totp"
 	"github.com/qompassai/beacon/webauth"
 )
 
@@ -44,6 +49,13 @@ func tcheck(t *testing.T, err error, msg string) {
 	}
 }
 
+func tcompare(t *testing.T, got, exp any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, expected %v", got, exp)
+	}
+}
+
 func readBody(r io.Reader) string {
 	buf, err := io.ReadAll(r)
 	if err != nil {
@@ -99,14 +111,14 @@ func TestAccount(t *testing.T) {
 	ctx := context.WithValue(ctxbg, requestInfoCtxKey, reqInfo)
 
 	// Missing login token.
-	tneedErrorCode(t, "user:error", func() { api.Login(ctx, "", "mjl@beacon.example", "test1234") })
+	tneedErrorCode(t, "user:error", func() { api.Login(ctx, "", "mjl@beacon.example", "test1234", "") })
 
 	// Login with loginToken.
 	loginCookie := &http.Cookie{Name: "webaccountlogin"}
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
 
-	csrfToken := api.Login(ctx, loginCookie.Value, "mjl@beacon.example", "test1234")
+	csrfToken := api.Login(ctx, loginCookie.Value, "mjl@beacon.example", "test1234", "")
 	var sessionCookie *http.Cookie
 	for _, c := range respRec.Result().Cookies() {
 		if c.Name == "webaccountsession" {
@@ -121,9 +133,9 @@ func TestAccount(t *testing.T) {
 	// Valid loginToken, but bad credentials.
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
-	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "mjl@beacon.example", "badauth") })
-	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "baduser@beacon.example", "badauth") })
-	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "baduser@baddomain.example", "badauth") })
+	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "mjl@beacon.example", "badauth", "") })
+	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "baduser@beacon.example", "badauth", "") })
+	tneedErrorCode(t, "user:loginFailed", func() { api.Login(ctx, loginCookie.Value, "baduser@baddomain.example", "badauth", "") })
 
 	type httpHeaders [][2]string
 	ctJSON := [2]string{"Content-Type", "application/json; charset=utf-8"}
@@ -222,6 +234,114 @@ func TestAccount(t *testing.T) {
 	api.AccountSaveFullName(ctx, fullName+" changed") // todo: check if value was changed
 	api.AccountSaveFullName(ctx, fullName)
 
+	// Two-factor authentication.
+	enabled, _, _ := api.TOTPStatus(ctx)
+	tcompare(t, enabled, false)
+	tneedErrorCode(t, "user:error", func() { api.TOTPEnrollFinish(ctx, "123456") }) // Not started.
+	enrollment := api.TOTPEnrollStart(ctx)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	tcheck(t, err, "decode totp secret")
+	now := time.Now()
+	tneedErrorCode(t, "user:error", func() { api.TOTPEnrollFinish(ctx, "bad") })
+	recoveryCodes := api.TOTPEnrollFinish(ctx, totp.Code(secret, totp.Counter(now)))
+	tcompare(t, len(recoveryCodes), 10)
+	enabled, _, left := api.TOTPStatus(ctx)
+	tcompare(t, enabled, true)
+	tcompare(t, left, 10)
+
+	// Login now needs a code. Code from enrollment cannot be reused.
+	loginctx := context.WithValue(ctxbg, requestInfoCtxKey, requestInfo{"", "", "", httptest.NewRecorder(), &http.Request{RemoteAddr: "127.0.0.1:1234"}})
+	loginReq := loginctx.Value(requestInfoCtxKey).(requestInfo).Request
+	login := func(totpCode string) {
+		t.Helper()
+		loginCookie.Value = api.LoginPrep(loginctx)
+		loginReq.Header = http.Header{"Cookie": []string{loginCookie.String()}}
+		api.Login(loginctx, loginCookie.Value, "mjl@beacon.example", "test1234", totpCode)
+	}
+	tneedErrorCode(t, "user:totpRequired", func() { login("") })
+	tneedErrorCode(t, "user:loginFailed", func() { login(totp.Code(secret, totp.Counter(now))) })
+	login(totp.Code(secret, totp.Counter(now)+1))
+	login(recoveryCodes[0])
+	tneedErrorCode(t, "user:loginFailed", func() { login(recoveryCodes[0]) }) // Already used.
+
+	// With two-factor authentication, IMAP/SMTP/CardDAV need an app password, the
+	// account password is only for web logins.
+	emailAuth := func(password string, web bool, expErr error) {
+		t.Helper()
+		acc, err := store.OpenEmailAuth(pkglog, "mjl@beacon.example", password, web)
+		if err != expErr {
+			t.Fatalf("got err %v, expected %v", err, expErr)
+		}
+		if err == nil {
+			err = acc.Close()
+			tcheck(t, err, "closing account")
+		}
+	}
+	appPasswords, required := api.AppPasswords(ctx)
+	tcompare(t, len(appPasswords), 0)
+	tcompare(t, required, true)
+	emailAuth("test1234", false, store.ErrUnknownCredentials)
+	emailAuth("test1234", true, nil)
+	tneedErrorCode(t, "user:error", func() { api.AppPasswordAdd(ctx, " ") })
+	appPassword := api.AppPasswordAdd(ctx, "phone")
+	emailAuth(appPassword, false, nil)
+	emailAuth(appPassword, false, nil) // From cache.
+	emailAuth(appPassword, true, store.ErrUnknownCredentials)
+	appPasswords, _ = api.AppPasswords(ctx)
+	tcompare(t, len(appPasswords), 1)
+	tcompare(t, appPasswords[0].Name, "phone")
+	tcompare(t, appPasswords[0].LastUsed.IsZero(), false)
+
+	recoveryCodes = api.TOTPRecoveryCodesRegenerate(ctx, recoveryCodes[1])
+	tneedErrorCode(t, "user:error", func() { api.TOTPDisable(ctx, "") })
+	api.TOTPDisable(ctx, recoveryCodes[0])
+	enabled, _, _ = api.TOTPStatus(ctx)
+	tcompare(t, enabled, false)
+	login("")
+	emailAuth("test1234", false, nil)
+	emailAuth(appPassword, false, nil)
+	api.AppPasswordRemove(ctx, appPasswords[0].ID)
+	emailAuth(appPassword, false, store.ErrUnknownCredentials)
+	tneedErrorCode(t, "user:error", func() { api.AppPasswordRemove(ctx, appPasswords[0].ID) })
+
+	// TLS public keys for SASL EXTERNAL.
+	fp := strings.Repeat("ab", 32)
+	tcompare(t, len(api.TLSPublicKeys(ctx)), 0)
+	tneedErrorCode(t, "user:error", func() { api.TLSPublicKeyAdd(ctx, "test", "mjl@beacon.example", "bad") })
+	tneedErrorCode(t, "user:error", func() { api.TLSPublicKeyAdd(ctx, "test", "nobody@beacon.example", fp) }) // Not an address of the account.
+	api.TLSPublicKeyAdd(ctx, "test", "mjl@beacon.example", strings.ToUpper(fp))
+	tcompare(t, api.TLSPublicKeys(ctx), []config.TLSPublicKey{{Name: "test", Fingerprint: fp, LoginAddress: "mjl@beacon.example"}})
+	tneedErrorCode(t, "user:error", func() { api.TLSPublicKeyAdd(ctx, "test2", "mjl@beacon.example", fp) }) // Duplicate.
+	api.TLSPublicKeyRemove(ctx, fp)
+	tcompare(t, len(api.TLSPublicKeys(ctx)), 0)
+
+	// Junk filter settings, reset and retrain.
+	enabled, threshold, junkParams, _ := api.JunkFilter(ctx)
+	tcompare(t, enabled, true)
+	tcompare(t, threshold, 0.95)
+	tneedErrorCode(t, "user:error", func() { api.JunkFilterSave(ctx, 1.5, junkParams) })
+	junkParams.Onegrams, junkParams.Twograms = false, false
+	tneedErrorCode(t, "user:error", func() { api.JunkFilterSave(ctx, 0.9, junkParams) })
+	junkParams.Twograms = true
+	api.JunkFilterSave(ctx, 0.9, junkParams)
+	_, threshold, _, _ = api.JunkFilter(ctx)
+	tcompare(t, threshold, 0.9)
+	api.JunkFilterSave(ctx, 0.95, junkParams)
+	api.JunkFilterReset(ctx)
+	api.JunkFilterRetrain(ctx)
+	for i := 0; api.JunkFilterRetrainProgress(ctx).Running; i++ {
+		if i >= 100 {
+			t.Fatalf("junk filter retrain did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	progress := api.JunkFilterRetrainProgress(ctx)
+	if progress.Error != "" || progress.Finished == nil {
+		t.Fatalf("unexpected junk filter retrain progress %#v", progress)
+	}
+	_, _, _, stats := api.JunkFilter(ctx)
+	tcompare(t, stats.Hams+stats.Spams, uint32(progress.Trained))
+
 	go ImportManage()
 
 	// Import mbox/maildir tgz/zip.
@@ -2,6 +2,98 @@
 
 namespace api {
 
+// TOTPEnrollment holds a new secret for enrolling an authenticator app.
+export interface TOTPEnrollment {
+	Secret: string  // Base32-encoded, for manual entry in an authenticator app.
+	URI: string  // otpauth URI with the secret.
+	QRCodePNG: string  // Base64-encoded PNG image with a QR code of the URI.
+}
+
+// AppPassword is a randomly generated password for use with IMAP, SMTP submission
+// and CardDAV, typically one per device or application. When two-factor
+// authentication is enabled for an account, or required by its configuration, the
+// account password is only accepted for web logins, and these protocols require
+// an app password instead. App passwords can be removed individually, e.g. when a
+// device is lost.
+export interface AppPassword {
+	ID: number
+	Created: Date
+	Name: string  // Description, e.g. the name of the device.
+	LastUsed: Date  // Last successful authentication with a not recently used password. Not updated for each authentication, successful authentications are cached for a while.
+}
+
+export interface TLSPublicKey {
+	Name: string
+	Fingerprint: string
+	LoginAddress: string
+}
+
+// LoginAttempt is a single authentication attempt.
+export interface LoginAttempt {
+	ID: number
+	Time: Date
+	AccountName: string  // Empty if no account could be found, e.g. for an unknown address, or an admin login.
+	LoginAddress: string  // As used in the attempt. May not exist.
+	RemoteIP: string
+	LocalIP: string
+	TLS: string  // TLS version and cipher suite, empty if the connection was not TLS.
+	Protocol: string  // "imap", "submission", "webmail", "webaccount", "webadmin" or "carddav".
+	AuthMech: string  // E.g. "plain", "scram-sha-256", "external" or "weblogin".
+	Result: string  // E.g. "ok", "badcreds", "badtotp", "locked", "aborted" or "error".
+}
+
+// Message is a message held in the quarantine.
+export interface Message {
+	ID: number
+	Received: Date
+	Reason: Reason
+	Detail: string  // More specific reason, e.g. from the junk analysis or the content scanner.
+	Account: string
+	RcptTo: string
+	MailFrom: string  // SMTP MAIL FROM, empty for the null sender.
+	MsgFrom: string  // Address in message From header, can be empty.
+	Subject: string
+	MessageID: string  // Canonical Message-Id, without <>. Can be empty.
+	Size: number  // Including MsgPrefix.
+	DigestSent: boolean  // Whether the message was listed in a digest to the account.
+}
+
+// Params holds parameters for the filter. Most are at test-time. The first are
+// used during parsing and training.
+export interface Params {
+	Onegrams: boolean
+	Twograms: boolean
+	Threegrams: boolean
+	MaxPower: number
+	TopWords: number
+	IgnoreWords: number
+	RareWords: number
+	Links: boolean  // Features besides words, stored in the word database with a prefix. Changing these requires retraining to take effect for existing messages.
+	Attachments: boolean
+	Structure: boolean
+	AuthResults: boolean
+}
+
+// JunkFilterStats holds statistics about the junk filter of an account.
+export interface JunkFilterStats {
+	Hams: number  // Number of messages trained as ham.
+	Spams: number  // Number of messages trained as spam.
+	Words: number  // Number of words (combinations) in the database.
+	DBSize: number  // Size of the database file in bytes.
+	BloomSize: number  // Size of the bloom filter file in bytes.
+}
+
+// JunkRetrainProgress is the state of retraining the junk filter of an account
+// with the messages in its mailboxes.
+export interface JunkRetrainProgress {
+	Running: boolean
+	Done: number  // Number of messages processed.
+	Total: number  // Total number of messages to process.
+	Trained: number  // Number of messages with junk or nonjunk flag that were trained.
+	Error: string  // If retraining failed.
+	Finished?: Date | null  // Nil while running or if never started.
+}
+
 // Domain is a domain name, with one or more labels, with at least an ASCII
 // representation, and for IDNA non-ASCII domains a unicode representation.
 // The ASCII string must be used for DNS lookups. The strings do not have a
@@ -36,23 +128,49 @@ export interface ImportProgress {
 
 export type CSRFToken = string
 
-export const structTypes: {[typename: string]: boolean} = {"Destination":true,"Domain":true,"ImportProgress":true,"Ruleset":true}
-export const stringsTypes: {[typename: string]: boolean} = {"CSRFToken":true}
+// Reason a message was quarantined.
+export enum Reason {
+	ReasonDNSBL = "dnsbl",  // Remote IP is on a DNS blocklist, message was rejected.
+	ReasonJunk = "junk",  // Junk filter classified message as spam, message was rejected.
+	ReasonContentScan = "contentscan",  // Content scanner quarantined the message.
+	ReasonHold = "hold",  // Message matched a hold rule.
+}
+
+export const structTypes: {[typename: string]: boolean} = {"AppPassword":true,"Destination":true,"Domain":true,"ImportProgress":true,"JunkFilterStats":true,"JunkRetrainProgress":true,"LoginAttempt":true,"Message":true,"Params":true,"Ruleset":true,"TLSPublicKey":true,"TOTPEnrollment":true}
+export const stringsTypes: {[typename: string]: boolean} = {"CSRFToken":true,"Reason":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
+	"TOTPEnrollment": {"Name":"TOTPEnrollment","Docs":"","Fields":[{"Name":"Secret","Docs":"","Typewords":["string"]},{"Name":"URI","Docs":"","Typewords":["string"]},{"Name":"QRCodePNG","Docs":"","Typewords":["string"]}]},
+	"AppPassword": {"Name":"AppPassword","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Created","Docs":"","Typewords":["timestamp"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"LastUsed","Docs":"","Typewords":["timestamp"]}]},
+	"TLSPublicKey": {"Name":"TLSPublicKey","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Fingerprint","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]}]},
+	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Time","Docs":"","Typewords":["timestamp"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["string"]}]},
+	"Message": {"Name":"Message","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Received","Docs":"","Typewords":["timestamp"]},{"Name":"Reason","Docs":"","Typewords":["Reason"]},{"Name":"Detail","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"RcptTo","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MsgFrom","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"DigestSent","Docs":"","Typewords":["bool"]}]},
+	"Params": {"Name":"Params","Docs":"","Fields":[{"Name":"Onegrams","Docs":"","Typewords":["bool"]},{"Name":"Twograms","Docs":"","Typewords":["bool"]},{"Name":"Threegrams","Docs":"","Typewords":["bool"]},{"Name":"MaxPower","Docs":"","Typewords":["float64"]},{"Name":"TopWords","Docs":"","Typewords":["int32"]},{"Name":"IgnoreWords","Docs":"","Typewords":["float64"]},{"Name":"RareWords","Docs":"","Typewords":["int32"]},{"Name":"Links","Docs":"","Typewords":["bool"]},{"Name":"Attachments","Docs":"","Typewords":["bool"]},{"Name":"Structure","Docs":"","Typewords":["bool"]},{"Name":"AuthResults","Docs":"","Typewords":["bool"]}]},
+	"JunkFilterStats": {"Name":"JunkFilterStats","Docs":"","Fields":[{"Name":"Hams","Docs":"","Typewords":["uint32"]},{"Name":"Spams","Docs":"","Typewords":["uint32"]},{"Name":"Words","Docs":"","Typewords":["int32"]},{"Name":"DBSize","Docs":"","Typewords":["int64"]},{"Name":"BloomSize","Docs":"","Typewords":["int64"]}]},
+	"JunkRetrainProgress": {"Name":"JunkRetrainProgress","Docs":"","Fields":[{"Name":"Running","Docs":"","Typewords":["bool"]},{"Name":"Done","Docs":"","Typewords":["int32"]},{"Name":"Total","Docs":"","Typewords":["int32"]},{"Name":"Trained","Docs":"","Typewords":["int32"]},{"Name":"Error","Docs":"","Typewords":["string"]},{"Name":"Finished","Docs":"","Typewords":["nullable","timestamp"]}]},
 	"Domain": {"Name":"Domain","Docs":"","Fields":[{"Name":"ASCII","Docs":"","Typewords":["string"]},{"Name":"Unicode","Docs":"","Typewords":["string"]}]},
 	"Destination": {"Name":"Destination","Docs":"","Fields":[{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"Rulesets","Docs":"","Typewords":["[]","Ruleset"]},{"Name":"FullName","Docs":"","Typewords":["string"]}]},
 	"Ruleset": {"Name":"Ruleset","Docs":"","Fields":[{"Name":"SMTPMailFromRegexp","Docs":"","Typewords":["string"]},{"Name":"VerifiedDomain","Docs":"","Typewords":["string"]},{"Name":"HeadersRegexp","Docs":"","Typewords":["{}","string"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ListAllowDomain","Docs":"","Typewords":["string"]},{"Name":"AcceptRejectsToMailbox","Docs":"","Typewords":["string"]},{"Name":"Mailbox","Docs":"","Typewords":["string"]},{"Name":"VerifiedDNSDomain","Docs":"","Typewords":["Domain"]},{"Name":"ListAllowDNSDomain","Docs":"","Typewords":["Domain"]}]},
 	"ImportProgress": {"Name":"ImportProgress","Docs":"","Fields":[{"Name":"Token","Docs":"","Typewords":["string"]}]},
 	"CSRFToken": {"Name":"CSRFToken","Docs":"","Values":null},
+	"Reason": {"Name":"Reason","Docs":"","Values":[{"Name":"ReasonDNSBL","Value":"dnsbl","Docs":""},{"Name":"ReasonJunk","Value":"junk","Docs":""},{"Name":"ReasonContentScan","Value":"contentscan","Docs":""},{"Name":"ReasonHold","Value":"hold","Docs":""}]},
 }
 
 export const parser = {
+	TOTPEnrollment: (v: any) => parse("TOTPEnrollment", v) as TOTPEnrollment,
+	AppPassword: (v: any) => parse("AppPassword", v) as AppPassword,
+	TLSPublicKey: (v: any) => parse("TLSPublicKey", v) as TLSPublicKey,
+	LoginAttempt: (v: any) => parse("LoginAttempt", v) as LoginAttempt,
+	Message: (v: any) => parse("Message", v) as Message,
+	Params: (v: any) => parse("Params", v) as Params,
+	JunkFilterStats: (v: any) => parse("JunkFilterStats", v) as JunkFilterStats,
+	JunkRetrainProgress: (v: any) => parse("JunkRetrainProgress", v) as JunkRetrainProgress,
 	Domain: (v: any) => parse("Domain", v) as Domain,
 	Destination: (v: any) => parse("Destination", v) as Destination,
 	Ruleset: (v: any) => parse("Ruleset", v) as Ruleset,
 	ImportProgress: (v: any) => parse("ImportProgress", v) as ImportProgress,
 	CSRFToken: (v: any) => parse("CSRFToken", v) as CSRFToken,
+	Reason: (v: any) => parse("Reason", v) as Reason,
 }
 
 // Account exports web API functions for the account web interface. All its
@@ -96,12 +214,14 @@ export class Client {
 	}
 
 	// Login returns a session token for the credentials, or fails with error code
-	// "user:badLogin". Call LoginPrep to get a loginToken.
-	async Login(loginToken: string, username: string, password: string): Promise<CSRFToken> {
+	// "user:badLogin". Call LoginPrep to get a loginToken. If two-factor
+	// authentication is enabled for the account and totpCode is empty, the call fails
+	// with error code "user:totpRequired", and should be repeated with a totpCode.
+	async Login(loginToken: string, username: string, password: string, totpCode: string): Promise<CSRFToken> {
 		const fn: string = "Login"
-		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const paramTypes: string[][] = [["string"],["string"],["string"],["string"]]
 		const returnTypes: string[][] = [["CSRFToken"]]
-		const params: any[] = [loginToken, username, password]
+		const params: any[] = [loginToken, username, password, totpCode]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as CSRFToken
 	}
 
@@ -125,6 +245,246 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// TOTPStatus returns whether two-factor authentication with an authenticator app
+	// is enabled, whether it is required by the account configuration, and how many
+	// unused recovery codes are left.
+	async TOTPStatus(): Promise<[boolean, boolean, number]> {
+		const fn: string = "TOTPStatus"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["bool"],["bool"],["int32"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [boolean, boolean, number]
+	}
+
+	// TOTPEnrollStart generates a new secret for two-factor authentication. The
+	// secret is not used for logins until TOTPEnrollFinish is called with a valid code.
+	async TOTPEnrollStart(): Promise<TOTPEnrollment> {
+		const fn: string = "TOTPEnrollStart"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["TOTPEnrollment"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as TOTPEnrollment
+	}
+
+	// TOTPEnrollFinish completes enrollment by checking a code from the authenticator
+	// app, and returns recovery codes to show to the user once. Each recovery code can
+	// be used once instead of a code from the authenticator app.
+	async TOTPEnrollFinish(code: string): Promise<string[] | null> {
+		const fn: string = "TOTPEnrollFinish"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","string"]]
+		const params: any[] = [code]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
+	}
+
+	// TOTPDisable disables two-factor authentication after verifying code, a code
+	// from the authenticator app or a recovery code. Not allowed if the account
+	// configuration requires two-factor authentication.
+	async TOTPDisable(code: string): Promise<void> {
+		const fn: string = "TOTPDisable"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [code]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// TOTPRecoveryCodesRegenerate replaces the recovery codes with new codes after
+	// verifying code, and returns the new codes.
+	async TOTPRecoveryCodesRegenerate(code: string): Promise<string[] | null> {
+		const fn: string = "TOTPRecoveryCodesRegenerate"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["[]","string"]]
+		const params: any[] = [code]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
+	}
+
+	// AppPasswords returns the app passwords of the account, for IMAP, SMTP
+	// submission and CardDAV. Also returns whether app passwords are required for
+	// these protocols, i.e. whether the account password is refused, because
+	// two-factor authentication is enabled or required.
+	async AppPasswords(): Promise<[AppPassword[] | null, boolean]> {
+		const fn: string = "AppPasswords"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","AppPassword"],["bool"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [AppPassword[] | null, boolean]
+	}
+
+	// AppPasswordAdd generates a new app password and returns it. It is only
+	// returned once, it cannot be retrieved later.
+	async AppPasswordAdd(name: string): Promise<string> {
+		const fn: string = "AppPasswordAdd"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = [name]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
+	// AppPasswordRemove removes an app password, after which it can no longer be
+	// used for authentication.
+	async AppPasswordRemove(id: number): Promise<void> {
+		const fn: string = "AppPasswordRemove"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// TLSPublicKeys returns the public keys of TLS client certificates registered for
+	// authentication with SASL mechanism EXTERNAL on IMAP and SMTP submission.
+	async TLSPublicKeys(): Promise<TLSPublicKey[] | null> {
+		const fn: string = "TLSPublicKeys"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","TLSPublicKey"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as TLSPublicKey[] | null
+	}
+
+	// TLSPublicKeyAdd registers the public key of a TLS client certificate for
+	// authentication as loginAddress, which must be an address of the account. Key is
+	// a PEM-encoded certificate or public key, or a fingerprint of the public key: a
+	// SHA-256 hash of the DER-encoded SubjectPublicKeyInfo in hex.
+	async TLSPublicKeyAdd(name: string, loginAddress: string, key: string): Promise<TLSPublicKey> {
+		const fn: string = "TLSPublicKeyAdd"
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const returnTypes: string[][] = [["TLSPublicKey"]]
+		const params: any[] = [name, loginAddress, key]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as TLSPublicKey
+	}
+
+	// TLSPublicKeyRemove removes a registered TLS public key by its fingerprint.
+	async TLSPublicKeyRemove(fingerprint: string): Promise<void> {
+		const fn: string = "TLSPublicKeyRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [fingerprint]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// LoginAttempts returns the most recent authentication attempts for the account,
+	// newest first.
+	async LoginAttempts(limit: number): Promise<LoginAttempt[] | null> {
+		const fn: string = "LoginAttempts"
+		const paramTypes: string[][] = [["int32"]]
+		const returnTypes: string[][] = [["[]","LoginAttempt"]]
+		const params: any[] = [limit]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as LoginAttempt[] | null
+	}
+
+	// LoginLockout returns whether authentication for the account is blocked after too
+	// many consecutive failed attempts, and until when. Sessions that were already
+	// logged in, like this one, are not affected.
+	async LoginLockout(): Promise<[boolean, Date]> {
+		const fn: string = "LoginLockout"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["bool"],["timestamp"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [boolean, Date]
+	}
+
+	// LoginLockoutRemove unblocks authentication for the account.
+	async LoginLockoutRemove(): Promise<void> {
+		const fn: string = "LoginLockoutRemove"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = []
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// Quarantine returns the messages for the account in the quarantine, most recent
+	// first.
+	async Quarantine(): Promise<Message[] | null> {
+		const fn: string = "Quarantine"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","Message"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Message[] | null
+	}
+
+	// QuarantineHeaders returns the header section of a quarantined message of the
+	// account.
+	async QuarantineHeaders(id: number): Promise<string> {
+		const fn: string = "QuarantineHeaders"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
+	// QuarantineRelease delivers a quarantined message to the account, and removes it
+	// from the quarantine. If train is set, the junk filter is trained with the
+	// message as non-junk.
+	async QuarantineRelease(id: number, train: boolean): Promise<void> {
+		const fn: string = "QuarantineRelease"
+		const paramTypes: string[][] = [["int64"],["bool"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id, train]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// QuarantineDelete removes a message of the account from the quarantine.
+	async QuarantineDelete(id: number): Promise<void> {
+		const fn: string = "QuarantineDelete"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// JunkFilter returns whether the junk filter is enabled for the account, its
+	// threshold and parameters, and statistics about its database. Statistics are
+	// not gathered while retraining.
+	async JunkFilter(): Promise<[boolean, number, Params, JunkFilterStats]> {
+		const fn: string = "JunkFilter"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["bool"],["float64"],["Params"],["JunkFilterStats"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [boolean, number, Params, JunkFilterStats]
+	}
+
+	// JunkFilterSave changes the threshold and parameters of the junk filter of the
+	// account. The junk filter must already be enabled. Changes to the n-gram
+	// parameters only take effect for existing messages after retraining.
+	async JunkFilterSave(threshold: number, junkParams: Params): Promise<void> {
+		const fn: string = "JunkFilterSave"
+		const paramTypes: string[][] = [["float64"],["Params"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [threshold, junkParams]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// JunkFilterReset removes all words from the junk filter of the account. Messages
+	// are not retrained, so the filter starts out empty.
+	async JunkFilterReset(): Promise<void> {
+		const fn: string = "JunkFilterReset"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = []
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// JunkFilterRetrain starts recreating the junk filter of the account from the
+	// junk and nonjunk flags of the messages in all mailboxes. Use
+	// JunkFilterRetrainProgress to follow progress. Deliveries to the account are
+	// delayed until retraining has finished.
+	async JunkFilterRetrain(): Promise<void> {
+		const fn: string = "JunkFilterRetrain"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = []
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// JunkFilterRetrainProgress returns the progress of the current or most recent
+	// retrain of the junk filter.
+	async JunkFilterRetrainProgress(): Promise<JunkRetrainProgress> {
+		const fn: string = "JunkFilterRetrainProgress"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["JunkRetrainProgress"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as JunkRetrainProgress
+	}
+
 	// Account returns information about the account: full name, the default domain,
 	// and the destinations (keys are email addresses, or localparts to the default
 	// domain). todo: replace with a function that returns the whole account, when
@@ -0,0 +1,104 @@
+package webaccount
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/store"
+)
+
+// JunkRetrainProgress is the state of retraining the junk filter of an account
+// with the messages in its mailboxes.
+type JunkRetrainProgress struct {
+	Running  bool
+	Done     int        // Number of messages processed.
+	Total    int        // Total number of messages to process.
+	Trained  int        // Number of messages with junk or nonjunk flag that were trained.
+	Error    string     // If retraining failed.
+	Finished *time.Time // Nil while running or if never started.
+}
+
+// Retrains that are in progress or were finished since startup, by account name.
+var junkRetrains = struct {
+	sync.Mutex
+	accounts map[string]*JunkRetrainProgress
+}{accounts: map[string]*JunkRetrainProgress{}}
+
+var errJunkRetrainRunning = errors.New("junk filter retrain in progress")
+
+// junkRetrainStatus returns the progress of the most recent retrain of the account.
+func junkRetrainStatus(accountName string) JunkRetrainProgress {
+	junkRetrains.Lock()
+	defer junkRetrains.Unlock()
+	if p, ok := junkRetrains.accounts[accountName]; ok {
+		return *p
+	}
+	return JunkRetrainProgress{}
+}
+
+// junkRetrainStart starts retraining the junk filter of the account in the
+// background.
+func junkRetrainStart(log mlog.Log, accountName string) error {
+	junkRetrains.Lock()
+	defer junkRetrains.Unlock()
+	if p, ok := junkRetrains.accounts[accountName]; ok && p.Running {
+		return errJunkRetrainRunning
+	}
+	p := &JunkRetrainProgress{Running: true}
+	junkRetrains.accounts[accountName] = p
+
+	go func() {
+		log := log.With(slog.String("account", accountName))
+
+		var err error
+		defer func() {
+			x := recover()
+			if x != nil {
+				log.Error("junk filter retrain panic", slog.Any("err", x))
+				debug.PrintStack()
+				metrics.PanicInc(metrics.Junkretrain)
+				err = fmt.Errorf("unexpected error: %v", x)
+			}
+
+			junkRetrains.Lock()
+			defer junkRetrains.Unlock()
+			p.Running = false
+			now := time.Now()
+			p.Finished = &now
+			if err != nil {
+				p.Error = err.Error()
+			}
+		}()
+
+		acc, err := store.OpenAccount(log, accountName)
+		if err != nil {
+			err = fmt.Errorf("open account: %v", err)
+			return
+		}
+		defer func() {
+			err := acc.Close()
+			log.Check(err, "closing account after retraining junk filter")
+		}()
+
+		progress := func(done, total, trained int) {
+			junkRetrains.Lock()
+			defer junkRetrains.Unlock()
+			p.Done = done
+			p.Total = total
+			p.Trained = trained
+		}
+		acc.WithWLock(func() {
+			_, _, err = acc.RetrainJunkFilter(beacon.Shutdown, log, progress)
+		})
+		log.Check(err, "retraining junk filter")
+	}()
+	return nil
+}
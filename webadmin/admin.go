@@ -45,11 +45,14 @@ import (
 
 	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dkim"
+	"github.com/qompassai/beacon/dkimrotate"
 	"github.com/qompassai/beacon/dmarc"
 	"github.com/qompassai/beacon/dmarcdb"
 	"github.com/qompassai/beacon/dmarcrpt"
 	"github.com/qompassai/beacon/dns"
 	"github.com/qompassai/beacon/dnsbl"
+	"github.com/qompassai/beacon/dnsupdate"
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/metrics"
 	"github.com/qompassai/beacon/mlog"
 	beacon "github.com/qompassai/beacon/beacon-"
@@ -57,6 +60,7 @@ import (
 	"github.com/qompassai/beacon/mtasts"
 	"github.com/qompassai/beacon/mtastsdb"
 	"github.com/qompassai/beacon/publicsuffix"
+	"github.com/qompassai/beacon/quarantine"
 	"github.com/qompassai/beacon/queue"
 	"github.com/qompassai/beacon/smtp"
 	"github.com/qompassai/beacon/spf"
@@ -234,7 +238,7 @@ func (w Admin) Login(ctx context.Context, loginToken, password string) store.CSR
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, "", password)
+	csrfToken, err := webauth.Login(ctx, log, webauth.Admin, "webadmin", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, "", password, "")
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
@@ -283,6 +287,7 @@ type TLSCheckResult struct {
 }
 
 type DANECheckResult struct {
+	TLSA map[string][]string // MX host to TLSA records found at _25._tcp of the host.
 	Result
 }
 
@@ -335,6 +340,7 @@ type MTASTSRecord struct {
 }
 type MTASTSCheckResult struct {
 	TXT        string
+	CNAME      string // Target of CNAME record for mta-sts host, if any.
 	Record     *MTASTSRecord
 	PolicyText string
 	Policy     *mtasts.Policy
@@ -347,8 +353,10 @@ type SRVConfCheckResult struct {
 }
 
 type AutoconfCheckResult struct {
-	ClientSettingsDomainIPs []string
-	IPs                     []string
+	ClientSettingsDomainCNAME string // Target of CNAME record for client settings domain, if any.
+	ClientSettingsDomainIPs   []string
+	CNAME                     string // Target of CNAME record for autoconfig host, if any.
+	IPs                       []string
 	Result
 }
 
@@ -860,10 +868,18 @@ EOF
 			if !result.Authentic {
 				addf(&r.DANE.Warnings, "DANE is inactive because MX records are not DNSSEC-signed.")
 			}
+			r.DANE.TLSA = map[string][]string{}
 			for _, mx := range mxl {
 				expect := expectedDANERecords(mx.Host)
 
 				tlsal, tlsaResult, err := resolver.LookupTLSA(ctx, 25, "tcp", mx.Host+".")
+				if err == nil || dns.IsNotFound(err) {
+					l := []string{}
+					for _, e := range tlsal {
+						l = append(l, e.Record())
+					}
+					r.DANE.TLSA[mx.Host] = l
+				}
 				if dns.IsNotFound(err) {
 					if len(expect) > 0 {
 						addf(&r.DANE.Errors, "No DANE records for MX host %s, expected: %s.", mx.Host, strings.Join(maps.Keys(expect), "; "))
@@ -1256,6 +1272,12 @@ Ensure a DNS TXT record like the following exists:
 			r.MTASTS.Record = &MTASTSRecord{*record}
 		}
 
+		cname, _, err := resolver.LookupCNAME(ctx, "mta-sts."+domain.ASCII+".")
+		if err != nil && !dns.IsNotFound(err) {
+			addf(&r.MTASTS.Errors, "Looking up CNAME record for mta-sts host: %s", err)
+		}
+		r.MTASTS.CNAME = cname
+
 		policy, text, err := mtasts.FetchPolicy(ctx, log.Logger, domain)
 		if err != nil {
 			addf(&r.MTASTS.Errors, "Fetching MTA-STS policy: %s", err)
@@ -1401,6 +1423,12 @@ When enabling MTA-STS, or updating a policy, always update the policy first (thr
 		if domConf.ClientSettingsDomain != "" {
 			addf(&r.Autoconf.Instructions, "Ensure a DNS CNAME record like the following exists:\n\n\t%s CNAME %s\n\nNote: the trailing dot is relevant, it makes the host name absolute instead of relative to the domain name.", domConf.ClientSettingsDNSDomain.ASCII+".", beacon.Conf.Static.HostnameDomain.ASCII+".")
 
+			cname, _, err := resolver.LookupCNAME(ctx, domConf.ClientSettingsDNSDomain.ASCII+".")
+			if err != nil && !dns.IsNotFound(err) {
+				addf(&r.Autoconf.Errors, "Looking up client settings DNS CNAME record: %s", err)
+			}
+			r.Autoconf.ClientSettingsDomainCNAME = cname
+
 			ips, ourIPs, notOurIPs, err := lookupIPs(&r.Autoconf.Errors, domConf.ClientSettingsDNSDomain.ASCII+".")
 			if err != nil {
 				addf(&r.Autoconf.Errors, "Looking up client settings DNS CNAME: %s", err)
@@ -1418,6 +1446,12 @@ When enabling MTA-STS, or updating a policy, always update the policy first (thr
 		addf(&r.Autoconf.Instructions, "Ensure a DNS CNAME record like the following exists:\n\n\tautoconfig.%s CNAME %s\n\nNote: the trailing dot is relevant, it makes the host name absolute instead of relative to the domain name.", domain.ASCII+".", beacon.Conf.Static.HostnameDomain.ASCII+".")
 
 		host := "autoconfig." + domain.ASCII + "."
+		cname, _, err := resolver.LookupCNAME(ctx, host)
+		if err != nil && !dns.IsNotFound(err) {
+			addf(&r.Autoconf.Errors, "Looking up autoconfig CNAME record: %s", err)
+		}
+		r.Autoconf.CNAME = cname
+
 		ips, ourIPs, notOurIPs, err := lookupIPs(&r.Autoconf.Errors, host)
 		if err != nil {
 			addf(&r.Autoconf.Errors, "Looking up autoconfig host: %s", err)
@@ -1452,6 +1486,7 @@ When enabling MTA-STS, or updating a policy, always update the policy first (thr
 		match := false
 		for _, srv := range srvs {
 			ips, ourIPs, notOurIPs, err := lookupIPs(&r.Autodiscover.Errors, srv.Target)
+			r.Autodiscover.Records = append(r.Autodiscover.Records, AutodiscoverSRV{*srv, ips})
 			if err != nil {
 				addf(&r.Autodiscover.Errors, "Looking up target %q from SRV record: %s", srv.Target, err)
 				continue
@@ -1460,7 +1495,6 @@ When enabling MTA-STS, or updating a policy, always update the policy first (thr
 				continue
 			}
 			match = true
-			r.Autodiscover.Records = append(r.Autodiscover.Records, AutodiscoverSRV{*srv, ips})
 			if !isUnspecifiedNAT {
 				if len(ourIPs) == 0 {
 					addf(&r.Autodiscover.Errors, "SRV target %q does not point to our IPs.", srv.Target)
@@ -1844,6 +1878,152 @@ func DomainRecords(ctx context.Context, log mlog.Log, domain string) []string {
 	return records
 }
 
+// DNSSyncResult is the outcome of synchronizing the required DNS records through
+// dynamic DNS updates. Records are in zone file format.
+type DNSSyncResult struct {
+	Remove    []string // Records removed, or to be removed, from DNS.
+	Add       []string // Records added, or to be added, to DNS.
+	Unchanged []string // Required records already present in DNS.
+	Skipped   []string // Required records not managed through updates, e.g. CAA or outside the zone.
+}
+
+// DomainDNSSync compares the required DNS records for the domain with the records
+// in DNS, and unless dryRun is set, updates DNS through the name server configured
+// for dynamic updates.
+func (Admin) DomainDNSSync(ctx context.Context, domain string, dryRun bool) DNSSyncResult {
+	log := pkglog.WithContext(ctx)
+	return DomainDNSSync(ctx, log, domain, dryRun)
+}
+
+// DomainDNSSync is the implementation of API function Admin.DomainDNSSync, taking
+// a logger.
+func DomainDNSSync(ctx context.Context, log mlog.Log, domain string, dryRun bool) DNSSyncResult {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	dc, ok := beacon.Conf.Domain(d)
+	if !ok {
+		xcheckuserf(ctx, errors.New("unknown domain"), "lookup domain")
+	}
+	du := dc.DNSUpdate
+	if du == nil {
+		xcheckuserf(ctx, errors.New("no dns update configured for domain"), "sync dns records")
+	}
+
+	server := du.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	algorithm := du.TSIGAlgorithm
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	ttl := du.TTL
+	if ttl == 0 {
+		ttl = 300
+	}
+	conf := dnsupdate.Config{
+		Server: server,
+		Zone:   du.DNSZone,
+		Key:    dnsupdate.TSIGKey{Name: du.TSIGKeyName, Algorithm: algorithm, Secret: du.Secret},
+		TTL:    uint32(ttl),
+	}
+
+	records, err := dnsupdate.ParseRecords(DomainRecords(ctx, log, domain))
+	xcheckf(ctx, err, "parsing required dns records")
+
+	// The changes are based on the records found by checking the domain.
+	resolver := dns.StrictResolver{Pkg: "check", Log: log.Logger}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	nctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	checks := checkDomain(nctx, resolver, dialer, domain)
+	changes, err := dnsupdate.Sync(ctx, log, conf, records, checkRRSets(d, dc, checks), dryRun)
+	xcheckf(ctx, err, "sync dns records")
+
+	lines := func(l []dnsupdate.Record) []string {
+		r := []string{}
+		for _, rec := range l {
+			r = append(r, rec.String())
+		}
+		return r
+	}
+	return DNSSyncResult{lines(changes.Remove), lines(changes.Add), lines(changes.Unchanged), lines(changes.Skipped)}
+}
+
+// checkRRSets returns the record sets of the domain that were found in DNS during
+// the checks of the domain.
+func checkRRSets(domain dns.Domain, domConf config.Domain, checks CheckResult) []dnsupdate.RRSet {
+	absolute := func(s string) string {
+		if s == "" || strings.HasSuffix(s, ".") {
+			return s
+		}
+		return s + "."
+	}
+	var l []dnsupdate.RRSet
+	add := func(name, typ string, values ...string) {
+		rs := dnsupdate.RRSet{Name: strings.ToLower(absolute(name)), Type: typ}
+		for _, v := range values {
+			if v != "" {
+				rs.Values = append(rs.Values, v)
+			}
+		}
+		l = append(l, rs)
+	}
+	srvValues := func(srvs []net.SRV) []string {
+		var l []string
+		for _, srv := range srvs {
+			l = append(l, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, absolute(srv.Target)))
+		}
+		return l
+	}
+
+	d := domain.ASCII
+	h := beacon.Conf.Static.HostnameDomain.ASCII
+
+	var mxs []string
+	for _, mx := range checks.MX.Records {
+		mxs = append(mxs, fmt.Sprintf("%d %s", mx.Pref, absolute(mx.Host)))
+	}
+	add(d, "MX", mxs...)
+	add(d, "TXT", checks.SPF.DomainTXT)
+	add(h, "TXT", checks.SPF.HostTXT)
+	for sel := range domConf.DKIM.Selectors {
+		var txt string
+		for _, r := range checks.DKIM.Records {
+			if r.Selector == sel {
+				txt = r.TXT
+			}
+		}
+		add(sel+"._domainkey."+d, "TXT", txt)
+	}
+	var dmarcTXT string
+	if checks.DMARC.Domain == domain.Name() {
+		// Not for a record found at the organizational domain.
+		dmarcTXT = checks.DMARC.TXT
+	}
+	add("_dmarc."+d, "TXT", dmarcTXT)
+	add("_smtp._tls."+h, "TXT", checks.HostTLSRPT.TXT)
+	add("_smtp._tls."+d, "TXT", checks.DomainTLSRPT.TXT)
+	add("_mta-sts."+d, "TXT", checks.MTASTS.TXT)
+	add("mta-sts."+d, "CNAME", absolute(checks.MTASTS.CNAME))
+	add("autoconfig."+d, "CNAME", absolute(checks.Autoconf.CNAME))
+	if domConf.ClientSettingsDomain != "" {
+		add(domConf.ClientSettingsDNSDomain.ASCII, "CNAME", absolute(checks.Autoconf.ClientSettingsDomainCNAME))
+	}
+	for service, srvs := range checks.SRVConf.SRVs {
+		add(service+"._tcp."+d, "SRV", srvValues(srvs)...)
+	}
+	var autodiscover []net.SRV
+	for _, r := range checks.Autodiscover.Records {
+		autodiscover = append(autodiscover, r.SRV)
+	}
+	add("_autodiscover._tcp."+d, "SRV", srvValues(autodiscover)...)
+	for host, records := range checks.DANE.TLSA {
+		add("_25._tcp."+host, "TLSA", records...)
+	}
+	return l
+}
+
 // DomainAdd adds a new domain and reloads the configuration.
 func (Admin) DomainAdd(ctx context.Context, domain, accountName, localpart string) {
 	d, err := dns.ParseDomain(domain)
@@ -1911,6 +2091,182 @@ func (Admin) SetAccountLimits(ctx context.Context, accountName string, maxOutgoi
 	xcheckf(ctx, err, "saving account limits")
 }
 
+// SetAccountRequireTOTP sets whether two-factor authentication with an
+// authenticator app is required for web logins of the account.
+func (Admin) SetAccountRequireTOTP(ctx context.Context, accountName string, require bool) {
+	err := beacon.AccountRequireTOTPSave(ctx, accountName, require)
+	xcheckf(ctx, err, "saving account two-factor authentication requirement")
+}
+
+// AccountTOTPStatus returns whether two-factor authentication is enabled for the
+// account, and the number of unused recovery codes.
+func (Admin) AccountTOTPStatus(ctx context.Context, accountName string) (enabled bool, recoveryCodesLeft int) {
+	log := pkglog.WithContext(ctx)
+	acc, err := store.OpenAccount(log, accountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	enabled, recoveryCodesLeft, err = acc.TOTPStatus(ctx)
+	xcheckf(ctx, err, "get two-factor authentication status")
+	return enabled, recoveryCodesLeft
+}
+
+// AccountTOTPReset removes two-factor authentication for the account, e.g. for a
+// user who lost their authenticator app and recovery codes. If the account
+// configuration requires two-factor authentication, the user must enroll again at
+// the next login to the account web interface.
+func (Admin) AccountTOTPReset(ctx context.Context, accountName string) {
+	log := pkglog.WithContext(ctx)
+	acc, err := store.OpenAccount(log, accountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+	err = acc.TOTPRemove(ctx, log, "")
+	xcheckf(ctx, err, "removing two-factor authentication")
+}
+
+// SetAccountLoginLockout sets the number of consecutive failed authentication
+// attempts after which authentication for the account is blocked, and for how many
+// minutes. A zero maxFailures disables blocking for the account.
+func (Admin) SetAccountLoginLockout(ctx context.Context, accountName string, maxFailures, periodMinutes int) {
+	if maxFailures < 0 || periodMinutes < 0 {
+		xcheckuserf(ctx, errors.New("values cannot be negative"), "checking login lockout")
+	}
+	err := beacon.AccountLoginLockoutSave(ctx, accountName, maxFailures, time.Duration(periodMinutes)*time.Minute)
+	xcheckf(ctx, err, "saving account login lockout")
+}
+
+// LoginAttempts returns the most recent authentication attempts for an account,
+// or for all accounts and unknown users if accountName is empty, newest first.
+func (Admin) LoginAttempts(ctx context.Context, accountName string, limit int) []loginattempt.LoginAttempt {
+	l, err := loginattempt.Attempts(ctx, accountName, limit)
+	xcheckf(ctx, err, "listing login attempts")
+	return l
+}
+
+// LoginBlocks returns the accounts for which authentication is blocked after too
+// many consecutive failed attempts, and the IPs and subnets that are currently
+// rate limited after failed authentication attempts.
+func (Admin) LoginBlocks(ctx context.Context) (lockouts []loginattempt.Lockout, ipNets []string) {
+	lockouts, err := loginattempt.Lockouts(ctx)
+	xcheckf(ctx, err, "listing blocked accounts")
+	for _, n := range beacon.LimiterFailedAuth.Blocked(time.Now()) {
+		ipNets = append(ipNets, n.String())
+	}
+	sort.Strings(ipNets)
+	return lockouts, ipNets
+}
+
+// LoginLockoutRemove unblocks authentication for an account.
+func (Admin) LoginLockoutRemove(ctx context.Context, accountName string) {
+	err := loginattempt.Unblock(ctx, pkglog.WithContext(ctx), accountName)
+	xcheckf(ctx, err, "unblocking account")
+}
+
+// LoginIPBlockRemove clears the failed authentication attempts for an IP or
+// subnet, as returned by LoginBlocks, so it is no longer rate limited.
+func (Admin) LoginIPBlockRemove(ctx context.Context, ipNet string) {
+	_, n, err := net.ParseCIDR(ipNet)
+	xcheckuserf(ctx, err, "parsing ip network")
+	beacon.LimiterFailedAuth.Unblock(*n)
+	pkglog.WithContext(ctx).Info("failed authentication rate limit cleared for ip network", slog.String("ipnet", ipNet))
+}
+
+// DKIMRotation is the state of a DKIM key rotation in progress for a domain.
+type DKIMRotation struct {
+	Started        time.Time
+	Phase          string   // "publish", "grace" or "remove".
+	OldSelectors   []string // In use for signing when the rotation started.
+	NewSelectors   []string // Replacements, in same order as OldSelectors.
+	Records        []string // DNS records to publish for the new selectors, in zone file format.
+	LastCheck      time.Time
+	LastCheckError string    // Empty if records of new selectors were found at last check.
+	Switched       time.Time // When signing switched to the new selectors. Zero in publish phase.
+	GraceEnd       time.Time // After which the old selectors can be removed. Zero in publish phase.
+}
+
+// DKIMRotation returns the DKIM key rotation in progress for domain, or nil if
+// there is none.
+func (Admin) DKIMRotation(ctx context.Context, domain string) *DKIMRotation {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	r, err := dkimrotate.Get(ctx, d)
+	if err == dkimrotate.ErrNotFound {
+		return nil
+	}
+	xcheckf(ctx, err, "get dkim key rotation")
+	records, err := dkimrotate.Records(r)
+	xcheckf(ctx, err, "making dns records for new selectors")
+	dr := DKIMRotation{
+		Started:        r.Started,
+		Phase:          string(r.Phase(time.Now())),
+		OldSelectors:   r.OldSelectors,
+		NewSelectors:   r.NewSelectors,
+		Records:        records,
+		LastCheck:      r.LastCheck,
+		LastCheckError: r.LastCheckError,
+		Switched:       r.Switched,
+	}
+	if !r.Switched.IsZero() {
+		dr.GraceEnd = r.Switched.Add(r.GracePeriod)
+	}
+	return &dr
+}
+
+// DKIMRotationStart starts a DKIM key rotation for domain, generating new
+// selectors for those currently used for signing. After switching to the new
+// selectors, the old selectors must remain published for graceDays days.
+func (Admin) DKIMRotationStart(ctx context.Context, domain string, graceDays int) {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	if graceDays <= 0 {
+		xcheckuserf(ctx, errors.New("grace period must be at least 1 day"), "checking grace period")
+	}
+	_, err = dkimrotate.Begin(ctx, pkglog.WithContext(ctx), d, time.Duration(graceDays)*24*time.Hour)
+	if errors.Is(err, dkimrotate.ErrInProgress) {
+		xcheckuserf(ctx, err, "starting dkim key rotation")
+	}
+	xcheckf(ctx, err, "starting dkim key rotation")
+}
+
+// DKIMRotationCheck checks DNS for the records of the new selectors of a DKIM
+// key rotation, switching signing to the new selectors if all are found.
+func (Admin) DKIMRotationCheck(ctx context.Context, domain string) {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	resolver := dns.StrictResolver{Pkg: "webadmin", Log: pkglog.WithContext(ctx).Logger}
+	_, err = dkimrotate.Check(ctx, pkglog.WithContext(ctx), resolver, d)
+	xcheckf(ctx, err, "checking dkim key rotation")
+}
+
+// DKIMRotationFinish finishes a DKIM key rotation after its grace period,
+// removing the old selectors from the configuration.
+func (Admin) DKIMRotationFinish(ctx context.Context, domain string) {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	err = dkimrotate.Finish(ctx, pkglog.WithContext(ctx), d)
+	if errors.Is(err, dkimrotate.ErrPhase) {
+		xcheckuserf(ctx, err, "finishing dkim key rotation")
+	}
+	xcheckf(ctx, err, "finishing dkim key rotation")
+}
+
+// DKIMRotationCancel cancels a DKIM key rotation that is still waiting for its
+// DNS records, removing the new selectors from the configuration.
+func (Admin) DKIMRotationCancel(ctx context.Context, domain string) {
+	d, err := dns.ParseDomain(domain)
+	xcheckuserf(ctx, err, "parsing domain")
+	err = dkimrotate.Cancel(ctx, pkglog.WithContext(ctx), d)
+	if errors.Is(err, dkimrotate.ErrPhase) {
+		xcheckuserf(ctx, err, "canceling dkim key rotation")
+	}
+	xcheckf(ctx, err, "canceling dkim key rotation")
+}
+
 // ClientConfigsDomain returns configurations for email clients, IMAP and
 // Submission (SMTP) for the domain.
 func (Admin) ClientConfigsDomain(ctx context.Context, domain string) beacon.ClientConfigs {
@@ -1963,6 +2319,52 @@ func (Admin) QueueSaveRequireTLS(ctx context.Context, id int64, requireTLS *bool
 	xcheckf(ctx, err, "update requiretls for message in queue")
 }
 
+// QuarantineList returns messages in the quarantine, most recent first. Only
+// messages matching the non-empty account, reason and search text (a substring
+// of the SMTP MAIL FROM, message From, RCPT TO or subject) are returned, at most
+// limit if greater than zero.
+func (Admin) QuarantineList(ctx context.Context, account, reason, search string, limit int) []quarantine.Message {
+	l, err := quarantine.List(ctx, quarantine.Filter{Account: account, Reason: quarantine.Reason(reason), Search: search, Limit: limit})
+	xcheckf(ctx, err, "listing messages in quarantine")
+	return l
+}
+
+// QuarantineHeaders returns the header section of a quarantined message.
+func (Admin) QuarantineHeaders(ctx context.Context, id int64) string {
+	h, err := quarantine.Headers(ctx, "", id)
+	if err == quarantine.ErrNotFound {
+		xcheckuserf(ctx, err, "get message headers")
+	}
+	xcheckf(ctx, err, "get message headers")
+	return h
+}
+
+// QuarantineRelease delivers quarantined messages to the accounts of their
+// recipients, and removes them from the quarantine. If train is set, the junk
+// filters of the accounts are trained with the messages as non-junk.
+func (Admin) QuarantineRelease(ctx context.Context, ids []int64, train bool) {
+	log := pkglog.WithContext(ctx)
+	for _, id := range ids {
+		err := quarantine.Release(ctx, log, "", id, train)
+		if err == quarantine.ErrNotFound {
+			xcheckuserf(ctx, err, "releasing message %d", id)
+		}
+		xcheckf(ctx, err, "releasing message %d", id)
+	}
+}
+
+// QuarantineDelete removes messages from the quarantine.
+func (Admin) QuarantineDelete(ctx context.Context, ids []int64) {
+	log := pkglog.WithContext(ctx)
+	for _, id := range ids {
+		err := quarantine.Delete(ctx, log, "", id)
+		if err == quarantine.ErrNotFound {
+			xcheckuserf(ctx, err, "removing message %d", id)
+		}
+		xcheckf(ctx, err, "removing message %d", id)
+	}
+}
+
 // LogLevels returns the current log levels.
 func (Admin) LogLevels(ctx context.Context) map[string]string {
 	m := map[string]string{}
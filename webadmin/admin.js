@@ -327,8 +327,16 @@ var api;
 		SPFResult["SPFTemperror"] = "temperror";
 		SPFResult["SPFPermerror"] = "permerror";
 	})(SPFResult = api.SPFResult || (api.SPFResult = {}));
-	api.structTypes = { "AuthResults": true, "AutoconfCheckResult": true, "AutodiscoverCheckResult": true, "AutodiscoverSRV": true, "CheckResult": true, "ClientConfigs": true, "ClientConfigsEntry": true, "DANECheckResult": true, "DKIMAuthResult": true, "DKIMCheckResult": true, "DKIMRecord": true, "DMARCCheckResult": true, "DMARCRecord": true, "DMARCSummary": true, "DNSSECResult": true, "DateRange": true, "Directive": true, "Domain": true, "DomainFeedback": true, "Evaluation": true, "EvaluationStat": true, "Extension": true, "FailureDetails": true, "IPDomain": true, "IPRevCheckResult": true, "Identifiers": true, "MTASTSCheckResult": true, "MTASTSRecord": true, "MX": true, "MXCheckResult": true, "Modifier": true, "Msg": true, "Pair": true, "Policy": true, "PolicyEvaluated": true, "PolicyOverrideReason": true, "PolicyPublished": true, "PolicyRecord": true, "Record": true, "Report": true, "ReportMetadata": true, "ReportRecord": true, "Result": true, "ResultPolicy": true, "Reverse": true, "Row": true, "SMTPAuth": true, "SPFAuthResult": true, "SPFCheckResult": true, "SPFRecord": true, "SRV": true, "SRVConfCheckResult": true, "STSMX": true, "Summary": true, "SuppressAddress": true, "TLSCheckResult": true, "TLSRPTCheckResult": true, "TLSRPTDateRange": true, "TLSRPTRecord": true, "TLSRPTSummary": true, "TLSRPTSuppressAddress": true, "TLSReportRecord": true, "TLSResult": true, "Transport": true, "TransportSMTP": true, "TransportSocks": true, "URI": true, "WebForward": true, "WebHandler": true, "WebRedirect": true, "WebStatic": true, "WebserverConfig": true };
-	api.stringsTypes = { "Align": true, "Alignment": true, "CSRFToken": true, "DKIMResult": true, "DMARCPolicy": true, "DMARCResult": true, "Disposition": true, "IP": true, "Localpart": true, "Mode": true, "PolicyOverride": true, "PolicyType": true, "RUA": true, "ResultType": true, "SPFDomainScope": true, "SPFResult": true };
+	// Reason a message was quarantined.
+	let Reason;
+	(function (Reason) {
+		Reason["ReasonDNSBL"] = "dnsbl";
+		Reason["ReasonJunk"] = "junk";
+		Reason["ReasonContentScan"] = "contentscan";
+		Reason["ReasonHold"] = "hold";
+	})(Reason = api.Reason || (api.Reason = {}));
+	api.structTypes = { "AuthResults": true, "AutoconfCheckResult": true, "AutodiscoverCheckResult": true, "AutodiscoverSRV": true, "CheckResult": true, "ClientConfigs": true, "ClientConfigsEntry": true, "DANECheckResult": true, "DKIMAuthResult": true, "DKIMCheckResult": true, "DKIMRecord": true, "DKIMRotation": true, "DMARCCheckResult": true, "DMARCRecord": true, "DMARCSummary": true, "DNSSECResult": true, "DNSSyncResult": true, "DateRange": true, "Directive": true, "Domain": true, "DomainFeedback": true, "Evaluation": true, "EvaluationStat": true, "Extension": true, "FailureDetails": true, "IPDomain": true, "IPRevCheckResult": true, "Identifiers": true, "Lockout": true, "LoginAttempt": true, "MTASTSCheckResult": true, "MTASTSRecord": true, "MX": true, "MXCheckResult": true, "Message": true, "Modifier": true, "Msg": true, "Pair": true, "Policy": true, "PolicyEvaluated": true, "PolicyOverrideReason": true, "PolicyPublished": true, "PolicyRecord": true, "Record": true, "Report": true, "ReportMetadata": true, "ReportRecord": true, "Result": true, "ResultPolicy": true, "Reverse": true, "Row": true, "SMTPAuth": true, "SPFAuthResult": true, "SPFCheckResult": true, "SPFRecord": true, "SRV": true, "SRVConfCheckResult": true, "STSMX": true, "Summary": true, "SuppressAddress": true, "TLSCheckResult": true, "TLSRPTCheckResult": true, "TLSRPTDateRange": true, "TLSRPTRecord": true, "TLSRPTSummary": true, "TLSRPTSuppressAddress": true, "TLSReportRecord": true, "TLSResult": true, "Transport": true, "TransportSMTP": true, "TransportSocks": true, "URI": true, "WebForward": true, "WebHandler": true, "WebRedirect": true, "WebStatic": true, "WebserverConfig": true };
+	api.stringsTypes = { "Align": true, "Alignment": true, "CSRFToken": true, "DKIMResult": true, "DMARCPolicy": true, "DMARCResult": true, "Disposition": true, "IP": true, "Localpart": true, "Mode": true, "PolicyOverride": true, "PolicyType": true, "RUA": true, "Reason": true, "ResultType": true, "SPFDomainScope": true, "SPFResult": true };
 	api.intsTypes = {};
 	api.types = {
 		"CheckResult": { "Name": "CheckResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "DNSSEC", "Docs": "", "Typewords": ["DNSSECResult"] }, { "Name": "IPRev", "Docs": "", "Typewords": ["IPRevCheckResult"] }, { "Name": "MX", "Docs": "", "Typewords": ["MXCheckResult"] }, { "Name": "TLS", "Docs": "", "Typewords": ["TLSCheckResult"] }, { "Name": "DANE", "Docs": "", "Typewords": ["DANECheckResult"] }, { "Name": "SPF", "Docs": "", "Typewords": ["SPFCheckResult"] }, { "Name": "DKIM", "Docs": "", "Typewords": ["DKIMCheckResult"] }, { "Name": "DMARC", "Docs": "", "Typewords": ["DMARCCheckResult"] }, { "Name": "HostTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "DomainTLSRPT", "Docs": "", "Typewords": ["TLSRPTCheckResult"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["MTASTSCheckResult"] }, { "Name": "SRVConf", "Docs": "", "Typewords": ["SRVConfCheckResult"] }, { "Name": "Autoconf", "Docs": "", "Typewords": ["AutoconfCheckResult"] }, { "Name": "Autodiscover", "Docs": "", "Typewords": ["AutodiscoverCheckResult"] }] },
@@ -338,7 +346,7 @@ var api;
 		"MXCheckResult": { "Name": "MXCheckResult", "Docs": "", "Fields": [{ "Name": "Records", "Docs": "", "Typewords": ["[]", "MX"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"MX": { "Name": "MX", "Docs": "", "Fields": [{ "Name": "Host", "Docs": "", "Typewords": ["string"] }, { "Name": "Pref", "Docs": "", "Typewords": ["int32"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"TLSCheckResult": { "Name": "TLSCheckResult", "Docs": "", "Fields": [{ "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
-		"DANECheckResult": { "Name": "DANECheckResult", "Docs": "", "Fields": [{ "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"DANECheckResult": { "Name": "DANECheckResult", "Docs": "", "Fields": [{ "Name": "TLSA", "Docs": "", "Typewords": ["{}", "[]", "string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"SPFCheckResult": { "Name": "SPFCheckResult", "Docs": "", "Fields": [{ "Name": "DomainTXT", "Docs": "", "Typewords": ["string"] }, { "Name": "DomainRecord", "Docs": "", "Typewords": ["nullable", "SPFRecord"] }, { "Name": "HostTXT", "Docs": "", "Typewords": ["string"] }, { "Name": "HostRecord", "Docs": "", "Typewords": ["nullable", "SPFRecord"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"SPFRecord": { "Name": "SPFRecord", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Directives", "Docs": "", "Typewords": ["[]", "Directive"] }, { "Name": "Redirect", "Docs": "", "Typewords": ["string"] }, { "Name": "Explanation", "Docs": "", "Typewords": ["string"] }, { "Name": "Other", "Docs": "", "Typewords": ["[]", "Modifier"] }] },
 		"Directive": { "Name": "Directive", "Docs": "", "Fields": [{ "Name": "Qualifier", "Docs": "", "Typewords": ["string"] }, { "Name": "Mechanism", "Docs": "", "Typewords": ["string"] }, { "Name": "DomainSpec", "Docs": "", "Typewords": ["string"] }, { "Name": "IPstr", "Docs": "", "Typewords": ["string"] }, { "Name": "IP4CIDRLen", "Docs": "", "Typewords": ["nullable", "int32"] }, { "Name": "IP6CIDRLen", "Docs": "", "Typewords": ["nullable", "int32"] }] },
@@ -352,14 +360,14 @@ var api;
 		"TLSRPTCheckResult": { "Name": "TLSRPTCheckResult", "Docs": "", "Fields": [{ "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "Record", "Docs": "", "Typewords": ["nullable", "TLSRPTRecord"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"TLSRPTRecord": { "Name": "TLSRPTRecord", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "RUAs", "Docs": "", "Typewords": ["[]", "[]", "RUA"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Extension"] }] },
 		"Extension": { "Name": "Extension", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["string"] }, { "Name": "Value", "Docs": "", "Typewords": ["string"] }] },
-		"MTASTSCheckResult": { "Name": "MTASTSCheckResult", "Docs": "", "Fields": [{ "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "Record", "Docs": "", "Typewords": ["nullable", "MTASTSRecord"] }, { "Name": "PolicyText", "Docs": "", "Typewords": ["string"] }, { "Name": "Policy", "Docs": "", "Typewords": ["nullable", "Policy"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"MTASTSCheckResult": { "Name": "MTASTSCheckResult", "Docs": "", "Fields": [{ "Name": "TXT", "Docs": "", "Typewords": ["string"] }, { "Name": "CNAME", "Docs": "", "Typewords": ["string"] }, { "Name": "Record", "Docs": "", "Typewords": ["nullable", "MTASTSRecord"] }, { "Name": "PolicyText", "Docs": "", "Typewords": ["string"] }, { "Name": "Policy", "Docs": "", "Typewords": ["nullable", "Policy"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"MTASTSRecord": { "Name": "MTASTSRecord", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "ID", "Docs": "", "Typewords": ["string"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Pair"] }] },
 		"Pair": { "Name": "Pair", "Docs": "", "Fields": [{ "Name": "Key", "Docs": "", "Typewords": ["string"] }, { "Name": "Value", "Docs": "", "Typewords": ["string"] }] },
 		"Policy": { "Name": "Policy", "Docs": "", "Fields": [{ "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "STSMX"] }, { "Name": "MaxAgeSeconds", "Docs": "", "Typewords": ["int32"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Pair"] }] },
 		"STSMX": { "Name": "STSMX", "Docs": "", "Fields": [{ "Name": "Wildcard", "Docs": "", "Typewords": ["bool"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"SRVConfCheckResult": { "Name": "SRVConfCheckResult", "Docs": "", "Fields": [{ "Name": "SRVs", "Docs": "", "Typewords": ["{}", "[]", "SRV"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"SRV": { "Name": "SRV", "Docs": "", "Fields": [{ "Name": "Target", "Docs": "", "Typewords": ["string"] }, { "Name": "Port", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Priority", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Weight", "Docs": "", "Typewords": ["uint16"] }] },
-		"AutoconfCheckResult": { "Name": "AutoconfCheckResult", "Docs": "", "Fields": [{ "Name": "ClientSettingsDomainIPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"AutoconfCheckResult": { "Name": "AutoconfCheckResult", "Docs": "", "Fields": [{ "Name": "ClientSettingsDomainCNAME", "Docs": "", "Typewords": ["string"] }, { "Name": "ClientSettingsDomainIPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "CNAME", "Docs": "", "Typewords": ["string"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AutodiscoverCheckResult": { "Name": "AutodiscoverCheckResult", "Docs": "", "Fields": [{ "Name": "Records", "Docs": "", "Typewords": ["[]", "AutodiscoverSRV"] }, { "Name": "Errors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Warnings", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Instructions", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"AutodiscoverSRV": { "Name": "AutodiscoverSRV", "Docs": "", "Fields": [{ "Name": "Target", "Docs": "", "Typewords": ["string"] }, { "Name": "Port", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Priority", "Docs": "", "Typewords": ["uint16"] }, { "Name": "Weight", "Docs": "", "Typewords": ["uint16"] }, { "Name": "IPs", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"PolicyRecord": { "Name": "PolicyRecord", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Inserted", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "ValidEnd", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastUpdate", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastUse", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Backoff", "Docs": "", "Typewords": ["bool"] }, { "Name": "RecordID", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }, { "Name": "Mode", "Docs": "", "Typewords": ["Mode"] }, { "Name": "MX", "Docs": "", "Typewords": ["[]", "STSMX"] }, { "Name": "MaxAgeSeconds", "Docs": "", "Typewords": ["int32"] }, { "Name": "Extensions", "Docs": "", "Typewords": ["[]", "Pair"] }, { "Name": "PolicyText", "Docs": "", "Typewords": ["string"] }] },
@@ -385,10 +393,15 @@ var api;
 		"SPFAuthResult": { "Name": "SPFAuthResult", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Scope", "Docs": "", "Typewords": ["SPFDomainScope"] }, { "Name": "Result", "Docs": "", "Typewords": ["SPFResult"] }] },
 		"DMARCSummary": { "Name": "DMARCSummary", "Docs": "", "Fields": [{ "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "Total", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionNone", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionQuarantine", "Docs": "", "Typewords": ["int32"] }, { "Name": "DispositionReject", "Docs": "", "Typewords": ["int32"] }, { "Name": "DKIMFail", "Docs": "", "Typewords": ["int32"] }, { "Name": "SPFFail", "Docs": "", "Typewords": ["int32"] }, { "Name": "PolicyOverrides", "Docs": "", "Typewords": ["{}", "int32"] }] },
 		"Reverse": { "Name": "Reverse", "Docs": "", "Fields": [{ "Name": "Hostnames", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"DNSSyncResult": { "Name": "DNSSyncResult", "Docs": "", "Fields": [{ "Name": "Remove", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Add", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Unchanged", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Skipped", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"LoginAttempt": { "Name": "LoginAttempt", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Time", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalIP", "Docs": "", "Typewords": ["string"] }, { "Name": "TLS", "Docs": "", "Typewords": ["string"] }, { "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "AuthMech", "Docs": "", "Typewords": ["string"] }, { "Name": "Result", "Docs": "", "Typewords": ["string"] }] },
+		"Lockout": { "Name": "Lockout", "Docs": "", "Fields": [{ "Name": "AccountName", "Docs": "", "Typewords": ["string"] }, { "Name": "Failures", "Docs": "", "Typewords": ["int32"] }, { "Name": "LastFailure", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Until", "Docs": "", "Typewords": ["timestamp"] }] },
+		"DKIMRotation": { "Name": "DKIMRotation", "Docs": "", "Fields": [{ "Name": "Started", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Phase", "Docs": "", "Typewords": ["string"] }, { "Name": "OldSelectors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "NewSelectors", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Records", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "LastCheck", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastCheckError", "Docs": "", "Typewords": ["string"] }, { "Name": "Switched", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "GraceEnd", "Docs": "", "Typewords": ["timestamp"] }] },
 		"ClientConfigs": { "Name": "ClientConfigs", "Docs": "", "Fields": [{ "Name": "Entries", "Docs": "", "Typewords": ["[]", "ClientConfigsEntry"] }] },
 		"ClientConfigsEntry": { "Name": "ClientConfigsEntry", "Docs": "", "Fields": [{ "Name": "Protocol", "Docs": "", "Typewords": ["string"] }, { "Name": "Host", "Docs": "", "Typewords": ["Domain"] }, { "Name": "Port", "Docs": "", "Typewords": ["int32"] }, { "Name": "Listener", "Docs": "", "Typewords": ["string"] }, { "Name": "Note", "Docs": "", "Typewords": ["string"] }] },
 		"Msg": { "Name": "Msg", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Queued", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "SenderAccount", "Docs": "", "Typewords": ["string"] }, { "Name": "SenderLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "SenderDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "RecipientLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "RecipientDomain", "Docs": "", "Typewords": ["IPDomain"] }, { "Name": "RecipientDomainStr", "Docs": "", "Typewords": ["string"] }, { "Name": "Attempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "MaxAttempts", "Docs": "", "Typewords": ["int32"] }, { "Name": "DialedIPs", "Docs": "", "Typewords": ["{}", "[]", "IP"] }, { "Name": "NextAttempt", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "LastAttempt", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "LastError", "Docs": "", "Typewords": ["string"] }, { "Name": "Has8bit", "Docs": "", "Typewords": ["bool"] }, { "Name": "SMTPUTF8", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsDMARCReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsTLSReport", "Docs": "", "Typewords": ["bool"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgPrefix", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "DSNUTF8", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "Transport", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }] },
 		"IPDomain": { "Name": "IPDomain", "Docs": "", "Fields": [{ "Name": "IP", "Docs": "", "Typewords": ["IP"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
+		"Message": { "Name": "Message", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Received", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Reason", "Docs": "", "Typewords": ["Reason"] }, { "Name": "Detail", "Docs": "", "Typewords": ["string"] }, { "Name": "Account", "Docs": "", "Typewords": ["string"] }, { "Name": "RcptTo", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "DigestSent", "Docs": "", "Typewords": ["bool"] }] },
 		"WebserverConfig": { "Name": "WebserverConfig", "Docs": "", "Fields": [{ "Name": "WebDNSDomainRedirects", "Docs": "", "Typewords": ["[]", "[]", "Domain"] }, { "Name": "WebDomainRedirects", "Docs": "", "Typewords": ["[]", "[]", "string"] }, { "Name": "WebHandlers", "Docs": "", "Typewords": ["[]", "WebHandler"] }] },
 		"WebHandler": { "Name": "WebHandler", "Docs": "", "Fields": [{ "Name": "LogName", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["string"] }, { "Name": "PathRegexp", "Docs": "", "Typewords": ["string"] }, { "Name": "DontRedirectPlainHTTP", "Docs": "", "Typewords": ["bool"] }, { "Name": "Compress", "Docs": "", "Typewords": ["bool"] }, { "Name": "WebStatic", "Docs": "", "Typewords": ["nullable", "WebStatic"] }, { "Name": "WebRedirect", "Docs": "", "Typewords": ["nullable", "WebRedirect"] }, { "Name": "WebForward", "Docs": "", "Typewords": ["nullable", "WebForward"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "DNSDomain", "Docs": "", "Typewords": ["Domain"] }] },
 		"WebStatic": { "Name": "WebStatic", "Docs": "", "Fields": [{ "Name": "StripPrefix", "Docs": "", "Typewords": ["string"] }, { "Name": "Root", "Docs": "", "Typewords": ["string"] }, { "Name": "ListFiles", "Docs": "", "Typewords": ["bool"] }, { "Name": "ContinueNotFound", "Docs": "", "Typewords": ["bool"] }, { "Name": "ResponseHeaders", "Docs": "", "Typewords": ["{}", "string"] }] },
@@ -419,6 +432,7 @@ var api;
 		"SPFResult": { "Name": "SPFResult", "Docs": "", "Values": [{ "Name": "SPFNone", "Value": "none", "Docs": "" }, { "Name": "SPFNeutral", "Value": "neutral", "Docs": "" }, { "Name": "SPFPass", "Value": "pass", "Docs": "" }, { "Name": "SPFFail", "Value": "fail", "Docs": "" }, { "Name": "SPFSoftfail", "Value": "softfail", "Docs": "" }, { "Name": "SPFTemperror", "Value": "temperror", "Docs": "" }, { "Name": "SPFPermerror", "Value": "permerror", "Docs": "" }] },
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
 		"IP": { "Name": "IP", "Docs": "", "Values": [] },
+		"Reason": { "Name": "Reason", "Docs": "", "Values": [{ "Name": "ReasonDNSBL", "Value": "dnsbl", "Docs": "" }, { "Name": "ReasonJunk", "Value": "junk", "Docs": "" }, { "Name": "ReasonContentScan", "Value": "contentscan", "Docs": "" }, { "Name": "ReasonHold", "Value": "hold", "Docs": "" }] },
 	};
 	api.parser = {
 		CheckResult: (v) => api.parse("CheckResult", v),
@@ -475,10 +489,15 @@ var api;
 		SPFAuthResult: (v) => api.parse("SPFAuthResult", v),
 		DMARCSummary: (v) => api.parse("DMARCSummary", v),
 		Reverse: (v) => api.parse("Reverse", v),
+		DNSSyncResult: (v) => api.parse("DNSSyncResult", v),
+		LoginAttempt: (v) => api.parse("LoginAttempt", v),
+		Lockout: (v) => api.parse("Lockout", v),
+		DKIMRotation: (v) => api.parse("DKIMRotation", v),
 		ClientConfigs: (v) => api.parse("ClientConfigs", v),
 		ClientConfigsEntry: (v) => api.parse("ClientConfigsEntry", v),
 		Msg: (v) => api.parse("Msg", v),
 		IPDomain: (v) => api.parse("IPDomain", v),
+		Message: (v) => api.parse("Message", v),
 		WebserverConfig: (v) => api.parse("WebserverConfig", v),
 		WebHandler: (v) => api.parse("WebHandler", v),
 		WebStatic: (v) => api.parse("WebStatic", v),
@@ -509,6 +528,7 @@ var api;
 		SPFResult: (v) => api.parse("SPFResult", v),
 		Localpart: (v) => api.parse("Localpart", v),
 		IP: (v) => api.parse("IP", v),
+		Reason: (v) => api.parse("Reason", v),
 	};
 	// Admin exports web API functions for the admin web interface. All its methods are
 	// exported under api/. Function calls require valid HTTP Authentication
@@ -721,6 +741,16 @@ var api;
 			const params = [domain];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// DomainDNSSync compares the required DNS records for the domain with the records
+		// in DNS, and unless dryRun is set, updates DNS through the name server configured
+		// for dynamic updates.
+		async DomainDNSSync(domain, dryRun) {
+			const fn = "DomainDNSSync";
+			const paramTypes = [["string"], ["bool"]];
+			const returnTypes = [["DNSSyncResult"]];
+			const params = [domain, dryRun];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// DomainAdd adds a new domain and reloads the configuration.
 		async DomainAdd(domain, accountName, localpart) {
 			const fn = "DomainAdd";
@@ -788,6 +818,127 @@ var api;
 			const params = [accountName, maxOutgoingMessagesPerDay, maxFirstTimeRecipientsPerDay, maxMsgSize];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// SetAccountRequireTOTP sets whether two-factor authentication with an
+		// authenticator app is required for web logins of the account.
+		async SetAccountRequireTOTP(accountName, require0) {
+			const fn = "SetAccountRequireTOTP";
+			const paramTypes = [["string"], ["bool"]];
+			const returnTypes = [];
+			const params = [accountName, require0];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AccountTOTPStatus returns whether two-factor authentication is enabled for the
+		// account, and the number of unused recovery codes.
+		async AccountTOTPStatus(accountName) {
+			const fn = "AccountTOTPStatus";
+			const paramTypes = [["string"]];
+			const returnTypes = [["bool"], ["int32"]];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// AccountTOTPReset removes two-factor authentication for the account, e.g. for a
+		// user who lost their authenticator app and recovery codes. If the account
+		// configuration requires two-factor authentication, the user must enroll again at
+		// the next login to the account web interface.
+		async AccountTOTPReset(accountName) {
+			const fn = "AccountTOTPReset";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SetAccountLoginLockout sets the number of consecutive failed authentication
+		// attempts after which authentication for the account is blocked, and for how many
+		// minutes. A zero maxFailures disables blocking for the account.
+		async SetAccountLoginLockout(accountName, maxFailures, periodMinutes) {
+			const fn = "SetAccountLoginLockout";
+			const paramTypes = [["string"], ["int32"], ["int32"]];
+			const returnTypes = [];
+			const params = [accountName, maxFailures, periodMinutes];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginAttempts returns the most recent authentication attempts for an account,
+		// or for all accounts and unknown users if accountName is empty, newest first.
+		async LoginAttempts(accountName, limit) {
+			const fn = "LoginAttempts";
+			const paramTypes = [["string"], ["int32"]];
+			const returnTypes = [["[]", "LoginAttempt"]];
+			const params = [accountName, limit];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginBlocks returns the accounts for which authentication is blocked after too
+		// many consecutive failed attempts, and the IPs and subnets that are currently
+		// rate limited after failed authentication attempts.
+		async LoginBlocks() {
+			const fn = "LoginBlocks";
+			const paramTypes = [];
+			const returnTypes = [["[]", "Lockout"], ["[]", "string"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginLockoutRemove unblocks authentication for an account.
+		async LoginLockoutRemove(accountName) {
+			const fn = "LoginLockoutRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [accountName];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LoginIPBlockRemove clears the failed authentication attempts for an IP or
+		// subnet, as returned by LoginBlocks, so it is no longer rate limited.
+		async LoginIPBlockRemove(ipNet) {
+			const fn = "LoginIPBlockRemove";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [ipNet];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DKIMRotation returns the DKIM key rotation in progress for domain, or nil if
+		// there is none.
+		async DKIMRotation(domain) {
+			const fn = "DKIMRotation";
+			const paramTypes = [["string"]];
+			const returnTypes = [["nullable", "DKIMRotation"]];
+			const params = [domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DKIMRotationStart starts a DKIM key rotation for domain, generating new
+		// selectors for those currently used for signing. After switching to the new
+		// selectors, the old selectors must remain published for graceDays days.
+		async DKIMRotationStart(domain, graceDays) {
+			const fn = "DKIMRotationStart";
+			const paramTypes = [["string"], ["int32"]];
+			const returnTypes = [];
+			const params = [domain, graceDays];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DKIMRotationCheck checks DNS for the records of the new selectors of a DKIM
+		// key rotation, switching signing to the new selectors if all are found.
+		async DKIMRotationCheck(domain) {
+			const fn = "DKIMRotationCheck";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DKIMRotationFinish finishes a DKIM key rotation after its grace period,
+		// removing the old selectors from the configuration.
+		async DKIMRotationFinish(domain) {
+			const fn = "DKIMRotationFinish";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// DKIMRotationCancel cancels a DKIM key rotation that is still waiting for its
+		// DNS records, removing the new selectors from the configuration.
+		async DKIMRotationCancel(domain) {
+			const fn = "DKIMRotationCancel";
+			const paramTypes = [["string"]];
+			const returnTypes = [];
+			const params = [domain];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// ClientConfigsDomain returns configurations for email clients, IMAP and
 		// Submission (SMTP) for the domain.
 		async ClientConfigsDomain(domain) {
@@ -839,6 +990,43 @@ var api;
 			const params = [id, requireTLS];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// QuarantineList returns messages in the quarantine, most recent first. Only
+		// messages matching the non-empty account, reason and search text (a substring
+		// of the SMTP MAIL FROM, message From, RCPT TO or subject) are returned, at most
+		// limit if greater than zero.
+		async QuarantineList(account, reason, search, limit) {
+			const fn = "QuarantineList";
+			const paramTypes = [["string"], ["string"], ["string"], ["int32"]];
+			const returnTypes = [["[]", "Message"]];
+			const params = [account, reason, search, limit];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QuarantineHeaders returns the header section of a quarantined message.
+		async QuarantineHeaders(id) {
+			const fn = "QuarantineHeaders";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["string"]];
+			const params = [id];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QuarantineRelease delivers quarantined messages to the accounts of their
+		// recipients, and removes them from the quarantine. If train is set, the junk
+		// filters of the accounts are trained with the messages as non-junk.
+		async QuarantineRelease(ids, train) {
+			const fn = "QuarantineRelease";
+			const paramTypes = [["[]", "int64"], ["bool"]];
+			const returnTypes = [];
+			const params = [ids, train];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// QuarantineDelete removes messages from the quarantine.
+		async QuarantineDelete(ids) {
+			const fn = "QuarantineDelete";
+			const paramTypes = [["[]", "int64"]];
+			const returnTypes = [];
+			const params = [ids];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// LogLevels returns the current log levels.
 		async LogLevels() {
 			const fn = "LogLevels";
@@ -1590,7 +1778,7 @@ const index = async () => {
 	let domain;
 	let account;
 	let localpart;
-	dom._kids(page, crumbs('Mox Admin'), checkUpdatesEnabled ? [] : dom.p(box(yellow, 'Warning: Checking for updates has not been enabled in beacon.conf (CheckUpdates: true).', dom.br(), 'Make sure you stay up to date through another mechanism!', dom.br(), 'You have a responsibility to keep the internet-connected software you run up to date and secure!', dom.br(), 'See ', link('https://updates.xbeacon.nl/changelog'))), dom.p(dom.a('Accounts', attr.href('#accounts')), dom.br(), dom.a('Queue', attr.href('#queue')), ' (' + queueSize + ')', dom.br()), dom.h2('Domains'), (domains || []).length === 0 ? box(red, 'No domains') :
+	dom._kids(page, crumbs('Mox Admin'), checkUpdatesEnabled ? [] : dom.p(box(yellow, 'Warning: Checking for updates has not been enabled in beacon.conf (CheckUpdates: true).', dom.br(), 'Make sure you stay up to date through another mechanism!', dom.br(), 'You have a responsibility to keep the internet-connected software you run up to date and secure!', dom.br(), 'See ', link('https://updates.xbeacon.nl/changelog'))), dom.p(dom.a('Accounts', attr.href('#accounts')), dom.br(), dom.a('Queue', attr.href('#queue')), ' (' + queueSize + ')', dom.br(), dom.a('Quarantine', attr.href('#quarantine')), dom.br()), dom.h2('Domains'), (domains || []).length === 0 ? box(red, 'No domains') :
 		dom.ul((domains || []).map(d => dom.li(dom.a(attr.href('#domains/' + domainName(d)), domainString(d))))), dom.br(), dom.h2('Add domain'), dom.form(async function submit(e) {
 		e.preventDefault();
 		e.stopPropagation();
@@ -1607,7 +1795,7 @@ const index = async () => {
 			fieldset.disabled = false;
 		}
 		window.location.hash = '#domains/' + domain.value;
-	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'Domain', dom.br(), domain = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), 'Postmaster/reporting account', dom.br(), account = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Localpart (optional)', attr.title('Must be set if and only if account does not yet exist. The localpart for the user of this domain. E.g. postmaster.')), dom.br(), localpart = dom.input()), ' ', dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. You should add the required DNS records after adding the domain.')))), dom.br(), dom.h2('Reports'), dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))), dom.div(dom.a('TLS', attr.href('#tlsrpt/reports'))), dom.br(), dom.h2('Operations'), dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))), dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))), dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))), 
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'Domain', dom.br(), domain = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), 'Postmaster/reporting account', dom.br(), account = dom.input(attr.required(''))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Localpart (optional)', attr.title('Must be set if and only if account does not yet exist. The localpart for the user of this domain. E.g. postmaster.')), dom.br(), localpart = dom.input()), ' ', dom.submitbutton('Add domain', attr.title('Domain will be added and the config reloaded. You should add the required DNS records after adding the domain.')))), dom.br(), dom.h2('Reports'), dom.div(dom.a('DMARC', attr.href('#dmarc/reports'))), dom.div(dom.a('TLS', attr.href('#tlsrpt/reports'))), dom.br(), dom.h2('Operations'), dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))), dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))), dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))), dom.div(dom.a('Login attempts and blocks', attr.href('#loginattempts'))), 
 	// todo: routing, globally, per domain and per account
 	dom.br(), dom.h2('DNS blocklist status'), dom.div(dom.a('DNSBL status', attr.href('#dnsbl'))), dom.br(), dom.h2('Configuration'), dom.div(dom.a('Webserver', attr.href('#webserver'))), dom.div(dom.a('Files', attr.href('#config'))), dom.div(dom.a('Log levels', attr.href('#loglevels'))), footer);
 };
@@ -1718,6 +1906,12 @@ const accounts = async () => {
 };
 const account = async (name) => {
 	const config = await client.Account(name);
+	const [totpEnabled, totpRecoveryCodesLeft] = await client.AccountTOTPStatus(name);
+	const [[lockouts], attempts] = await Promise.all([
+		client.LoginBlocks(),
+		client.LoginAttempts(name, 10),
+	]);
+	const lockout = (lockouts || []).find(l => l.AccountName === name);
 	let form;
 	let fieldset;
 	let email;
@@ -1729,6 +1923,11 @@ const account = async (name) => {
 	let fieldsetPassword;
 	let password;
 	let passwordHint;
+	let fieldsetTOTP;
+	let requireTOTP;
+	let fieldsetLockout;
+	let lockoutMaxFailures;
+	let lockoutPeriod;
 	const xparseSize = (s) => {
 		const origs = s;
 		s = s.toLowerCase();
@@ -1884,7 +2083,72 @@ const account = async (name) => {
 		finally {
 			fieldsetPassword.disabled = false;
 		}
-	}), dom.br(), dom.h2('Danger'), dom.clickbutton('Remove account', async function click(e) {
+	}), dom.br(), dom.h2('Two-factor authentication'), dom.p(totpEnabled ? 'Enabled with an authenticator app, recovery codes left: ' + totpRecoveryCodesLeft + '.' : 'Not enabled.'), dom.form(fieldsetTOTP = dom.fieldset(dom.label(style({ display: 'block', marginBottom: '.5ex' }), attr.title('Require two-factor authentication with time-based one-time passwords (TOTP) from an authenticator app for logging in to the webmail and account web interfaces. Until the user has enrolled an authenticator app, only a login to the account web interface is allowed, for enrolling. IMAP, SMTP submission and CardDAV only accept app passwords, not the account password. App passwords are managed in the account web interface. RequireTOTP in configuration file.'), requireTOTP = dom.input(attr.type('checkbox'), config.RequireTOTP ? attr.checked('') : []), ' Require for webmail and account web interface logins'), dom.submitbutton('Save')), async function submit(e) {
+		e.stopPropagation();
+		e.preventDefault();
+		fieldsetTOTP.disabled = true;
+		try {
+			await client.SetAccountRequireTOTP(name, requireTOTP.checked);
+			window.alert('Two-factor authentication requirement saved.');
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			fieldsetTOTP.disabled = false;
+		}
+	}), totpEnabled ? dom.div(style({ marginTop: '.5ex' }), dom.clickbutton('Reset two-factor authentication', attr.title('Remove the authenticator app secret and recovery codes, e.g. for a user who lost both. If two-factor authentication is required, the user must enroll again in the account web interface.'), async function click(e) {
+		if (!window.confirm('Are you sure you want to reset two-factor authentication for this account?')) {
+			return;
+		}
+		const target = e.target;
+		target.disabled = true;
+		try {
+			await client.AccountTOTPReset(name);
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			target.disabled = false;
+		}
+		window.location.reload(); // todo: only reload the two-factor authentication status
+	})) : [], dom.br(), dom.h2('Login lockout'), lockout ? dom.p(box(yellow, 'Authentication is blocked until ' + lockout.Until.toString() + ', after ' + lockout.Failures + ' consecutive failed attempts. ', dom.clickbutton('Unblock', async function click(e) {
+		const target = e.target;
+		target.disabled = true;
+		try {
+			await client.LoginLockoutRemove(name);
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			target.disabled = false;
+		}
+		window.location.reload(); // todo: only reload the lockout status
+	}))) : [], dom.form(fieldsetLockout = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Max consecutive failures', attr.title('Number of consecutive failed authentication attempts, from any IP address, after which authentication for the account is blocked. A successful login resets the count. Zero disables blocking. MaxFailures in LoginLockout in configuration file.')), dom.br(), lockoutMaxFailures = dom.input(attr.type('number'), attr.required(''), attr.min('0'), attr.value('' + (config.LoginLockout ? config.LoginLockout.MaxFailures : 0)))), ' ', dom.label(style({ display: 'inline-block' }), dom.span('Block period in minutes', attr.title('How long authentication is blocked. Zero means the default of 60 minutes. Period in LoginLockout in configuration file.')), dom.br(), lockoutPeriod = dom.input(attr.type('number'), attr.required(''), attr.min('0'), attr.value('' + (config.LoginLockout ? Math.round(config.LoginLockout.Period / (60 * 1000 * 1000 * 1000)) : 0)))), ' ', dom.submitbutton('Save')), async function submit(e) {
+		e.stopPropagation();
+		e.preventDefault();
+		fieldsetLockout.disabled = true;
+		try {
+			await client.SetAccountLoginLockout(name, parseInt(lockoutMaxFailures.value), parseInt(lockoutPeriod.value));
+			window.alert('Login lockout saved.');
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			fieldsetLockout.disabled = false;
+		}
+	}), dom.br(), dom.h2('Recent login attempts'), loginAttemptsTable(attempts || []), dom.p(dom.a('All login attempts and blocks', attr.href('#loginattempts'))), dom.br(), dom.h2('Danger'), dom.clickbutton('Remove account', async function click(e) {
 		e.preventDefault();
 		if (!window.confirm('Are you sure you want to remove this account?')) {
 			return;
@@ -1908,18 +2172,41 @@ const account = async (name) => {
 const domain = async (d) => {
 	const end = new Date();
 	const start = new Date(new Date().getTime() - 30 * 24 * 3600 * 1000);
-	const [dmarcSummaries, tlsrptSummaries, localpartAccounts, dnsdomain, clientConfigs] = await Promise.all([
+	const [dmarcSummaries, tlsrptSummaries, localpartAccounts, dnsdomain, clientConfigs, dkimRotation] = await Promise.all([
 		client.DMARCSummaries(start, end, d),
 		client.TLSRPTSummaries(start, end, d),
 		client.DomainLocalparts(d),
 		client.Domain(d),
 		client.ClientConfigsDomain(d),
+		client.DKIMRotation(d),
 	]);
 	let form;
 	let fieldset;
 	let localpart;
 	let account;
-	dom._kids(page, crumbs(crumblink('Mox Admin', '#'), 'Domain ' + domainString(dnsdomain)), dom.ul(dom.li(dom.a('Required DNS records', attr.href('#domains/' + d + '/dnsrecords'))), dom.li(dom.a('Check current actual DNS records and domain configuration', attr.href('#domains/' + d + '/dnscheck')))), dom.br(), dom.h2('Client configuration'), dom.p('If autoconfig/autodiscover does not work with an email client, use the settings below for this domain. Authenticate with email address and password. ', dom.span('Explicitly configure', attr.title('To prevent authentication mechanism downgrade attempts that may result in clients sending plain text passwords to a MitM.')), ' the first supported authentication mechanism: SCRAM-SHA-256-PLUS, SCRAM-SHA-1-PLUS, SCRAM-SHA-256, SCRAM-SHA-1, CRAM-MD5.'), dom.table(dom.thead(dom.tr(dom.th('Protocol'), dom.th('Host'), dom.th('Port'), dom.th('Listener'), dom.th('Note'))), dom.tbody((clientConfigs.Entries || []).map(e => dom.tr(dom.td(e.Protocol), dom.td(domainString(e.Host)), dom.td('' + e.Port), dom.td('' + e.Listener), dom.td('' + e.Note))))), dom.br(), dom.h2('DMARC aggregate reports summary'), renderDMARCSummaries(dmarcSummaries || []), dom.br(), dom.h2('TLS reports summary'), renderTLSRPTSummaries(tlsrptSummaries || []), dom.br(), dom.h2('Addresses'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Account'), dom.th('Action'))), dom.tbody(Object.entries(localpartAccounts).map(t => dom.tr(dom.td(t[0] || '(catchall)'), dom.td(dom.a(t[1], attr.href('#accounts/' + t[1]))), dom.td(dom.clickbutton('Remove', async function click(e) {
+	let rotationFieldset;
+	let rotationGraceDays;
+	const rotationButton = (text, confirmText, fn) => dom.clickbutton(text, async function click(e) {
+		e.preventDefault();
+		if (confirmText && !window.confirm(confirmText)) {
+			return;
+		}
+		const target = e.target;
+		target.disabled = true;
+		try {
+			await fn();
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			target.disabled = false;
+		}
+		window.location.reload(); // todo: only reload the rotation
+	});
+	dom._kids(page, crumbs(crumblink('Mox Admin', '#'), 'Domain ' + domainString(dnsdomain)), dom.ul(dom.li(dom.a('Required DNS records', attr.href('#domains/' + d + '/dnsrecords'))), dom.li(dom.a('Check current actual DNS records and domain configuration', attr.href('#domains/' + d + '/dnscheck'))), dom.li(dom.a('Sync required DNS records with dynamic DNS updates', attr.href('#domains/' + d + '/dnssync')))), dom.br(), dom.h2('Client configuration'), dom.p('If autoconfig/autodiscover does not work with an email client, use the settings below for this domain. Authenticate with email address and password. ', dom.span('Explicitly configure', attr.title('To prevent authentication mechanism downgrade attempts that may result in clients sending plain text passwords to a MitM.')), ' the first supported authentication mechanism: SCRAM-SHA-256-PLUS, SCRAM-SHA-1-PLUS, SCRAM-SHA-256, SCRAM-SHA-1, CRAM-MD5.'), dom.table(dom.thead(dom.tr(dom.th('Protocol'), dom.th('Host'), dom.th('Port'), dom.th('Listener'), dom.th('Note'))), dom.tbody((clientConfigs.Entries || []).map(e => dom.tr(dom.td(e.Protocol), dom.td(domainString(e.Host)), dom.td('' + e.Port), dom.td('' + e.Listener), dom.td('' + e.Note))))), dom.br(), dom.h2('DMARC aggregate reports summary'), renderDMARCSummaries(dmarcSummaries || []), dom.br(), dom.h2('TLS reports summary'), renderTLSRPTSummaries(tlsrptSummaries || []), dom.br(), dom.h2('Addresses'), dom.table(dom.thead(dom.tr(dom.th('Address'), dom.th('Account'), dom.th('Action'))), dom.tbody(Object.entries(localpartAccounts).map(t => dom.tr(dom.td(t[0] || '(catchall)'), dom.td(dom.a(t[1], attr.href('#accounts/' + t[1]))), dom.td(dom.clickbutton('Remove', async function click(e) {
 		e.preventDefault();
 		if (!window.confirm('Are you sure you want to remove this address?')) {
 			return;
@@ -1955,7 +2242,44 @@ const domain = async (d) => {
 		}
 		form.reset();
 		window.location.reload(); // todo: only reload the addresses
-	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Localpart', attr.title('An empty localpart is the catchall destination/address for the domain.')), dom.br(), localpart = dom.input()), ' ', dom.label(style({ display: 'inline-block' }), 'Account', dom.br(), account = dom.input(attr.required(''))), ' ', dom.submitbutton('Add address', attr.title('Address will be added and the config reloaded.')))), dom.br(), dom.h2('External checks'), dom.ul(dom.li(link('https://internet.nl/mail/' + dnsdomain.ASCII + '/', 'Check configuration at internet.nl'))), dom.br(), dom.h2('Danger'), dom.clickbutton('Remove domain', async function click(e) {
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Localpart', attr.title('An empty localpart is the catchall destination/address for the domain.')), dom.br(), localpart = dom.input()), ' ', dom.label(style({ display: 'inline-block' }), 'Account', dom.br(), account = dom.input(attr.required(''))), ' ', dom.submitbutton('Add address', attr.title('Address will be added and the config reloaded.')))), dom.br(), dom.h2('DKIM key rotation'), !dkimRotation ? [
+		dom.p('Rotating DKIM keys generates a new selector with a fresh key for each selector currently used for signing. Once the DNS records for the new selectors are published, signing switches to the new selectors. The DNS records of the old selectors must remain published for a grace period, after which the rotation can be finished, removing the old selectors.'),
+		dom.form(async function submit(e) {
+			e.preventDefault();
+			e.stopPropagation();
+			rotationFieldset.disabled = true;
+			try {
+				await client.DKIMRotationStart(d, parseInt(rotationGraceDays.value));
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				return;
+			}
+			finally {
+				rotationFieldset.disabled = false;
+			}
+			window.location.reload(); // todo: only reload the rotation
+		}, rotationFieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), dom.span('Grace period (days)', attr.title('Time to keep the DNS records of the old selectors published after switching to the new selectors, for messages still in transit and verification of recently sent messages.')), dom.br(), rotationGraceDays = dom.input(attr.type('number'), attr.min('1'), attr.value('7'), attr.required(''))), ' ', dom.submitbutton('Start rotation', attr.title('New selectors will be added to the config, but not yet used for signing.')))),
+	] : [
+		dom.table(dom.tr(dom.td('Started'), dom.td(dkimRotation.Started.toISOString())), dom.tr(dom.td('Phase'), dom.td(dkimRotation.Phase)), dom.tr(dom.td('Old selectors'), dom.td((dkimRotation.OldSelectors || []).join(', '))), dom.tr(dom.td('New selectors'), dom.td((dkimRotation.NewSelectors || []).join(', '))), dkimRotation.Phase !== 'publish' ? [
+			dom.tr(dom.td('Switched'), dom.td(dkimRotation.Switched.toISOString())),
+			dom.tr(dom.td('Grace period ends'), dom.td(dkimRotation.GraceEnd.toISOString())),
+		] : []),
+		dkimRotation.Phase === 'publish' ? [
+			dom.p('Publish the DNS records below. DNS is checked periodically, signing switches to the new selectors once the records are found.'),
+			dom.pre(dom._class('literal'), (dkimRotation.Records || []).join('\n')),
+			dkimRotation.LastCheck.getTime() > 0 ? dom.p('Last check at ', dkimRotation.LastCheck.toISOString(), ': ', dkimRotation.LastCheckError || 'ok') : [],
+			rotationButton('Check DNS now', '', async () => await client.DKIMRotationCheck(d)),
+			' ',
+			rotationButton('Cancel rotation', 'Are you sure you want to cancel the rotation? The new selectors will be removed.', async () => await client.DKIMRotationCancel(d)),
+		] : [],
+		dkimRotation.Phase === 'grace' ? dom.p('Signing with the new selectors. Keep the DNS records of the old selectors published until the grace period ends.') : [],
+		dkimRotation.Phase === 'remove' ? [
+			dom.p('The grace period has passed. Finish the rotation to remove the old selectors from the configuration, then remove their DNS records.'),
+			rotationButton('Finish rotation', 'Are you sure you want to remove the old selectors?', async () => await client.DKIMRotationFinish(d)),
+		] : [],
+	], dom.br(), dom.h2('External checks'), dom.ul(dom.li(link('https://internet.nl/mail/' + dnsdomain.ASCII + '/', 'Check configuration at internet.nl'))), dom.br(), dom.h2('Danger'), dom.clickbutton('Remove domain', async function click(e) {
 		e.preventDefault();
 		if (!window.confirm('Are you sure you want to remove this domain?')) {
 			return;
@@ -1983,6 +2307,39 @@ const domainDNSRecords = async (d) => {
 	]);
 	dom._kids(page, crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'DNS Records'), dom.h1('Required DNS records'), dom.pre('pre', dom._class('literal'), (records || []).join('\n')), dom.br());
 };
+const domainDNSSync = async (d) => {
+	const [changes, dnsdomain] = await Promise.all([
+		client.DomainDNSSync(d, true),
+		client.Domain(d),
+	]);
+	const recordsSection = (title, l) => [
+		dom.h2(title),
+		(l || []).length === 0 ? dom.div('(none)') : dom.pre(dom._class('literal'), (l || []).join('\n')),
+		dom.br(),
+	];
+	const render = (r, applied) => {
+		const pending = (r.Remove || []).length > 0 || (r.Add || []).length > 0;
+		dom._kids(page, crumbs(crumblink('Mox Admin', '#'), crumblink('Domain ' + domainString(dnsdomain), '#domains/' + d), 'Sync DNS'), dom.h1('Sync required DNS records'), dom.p('Required DNS records are compared with the records currently in DNS. Conflicting records are removed and missing records added through a dynamic DNS update (RFC 2136) to the name server configured for the domain. Records outside the zone and records of some types, like CAA, are skipped and must be managed manually.'), applied ? box(green, pending ? 'DNS records updated.' : 'DNS records already up to date.') : [], recordsSection(applied ? 'Removed' : 'To remove', r.Remove), recordsSection(applied ? 'Added' : 'To add', r.Add), recordsSection('Unchanged', r.Unchanged), recordsSection('Skipped', r.Skipped), applied || !pending ? [] : dom.clickbutton('Apply changes', attr.title('Send the dynamic DNS update to the name server.'), async function click(e) {
+			e.preventDefault();
+			const target = e.target;
+			target.disabled = true;
+			let nr;
+			try {
+				nr = await client.DomainDNSSync(d, false);
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				return;
+			}
+			finally {
+				target.disabled = false;
+			}
+			render(nr, true);
+		}));
+	};
+	render(changes, false);
+};
 const domainDNSCheck = async (d) => {
 	const [checks, dnsdomain] = await Promise.all([
 		client.CheckDomain(d),
@@ -2616,6 +2973,48 @@ const makeMTASTSTable = (items) => {
 		age(e.Inserted, false, nowSecs),
 	].map(v => dom.td(v === null ? [] : (v instanceof HTMLElement ? v : '' + v)))))));
 };
+const loginAttemptsTable = (attempts) => {
+	const nowSecs = new Date().getTime() / 1000;
+	return dom.table(dom._class('hover'), dom.thead(dom.tr(dom.th('Time'), dom.th('Account'), dom.th('Login address'), dom.th('Protocol'), dom.th('Mechanism'), dom.th('Result'), dom.th('Remote IP'), dom.th('Local IP'), dom.th('TLS'))), dom.tbody(attempts.length === 0 ? dom.tr(dom.td(attr.colspan('9'), 'No login attempts.')) : [], attempts.map(a => dom.tr(dom.td(age(a.Time, false, nowSecs)), dom.td(a.AccountName ? dom.a(attr.href('#accounts/' + a.AccountName), a.AccountName) : '-'), dom.td(a.LoginAddress || '-'), dom.td(a.Protocol), dom.td(a.AuthMech), dom.td(a.Result === 'ok' ? [] : style({ backgroundColor: a.Result === 'aborted' ? yellow : red }), a.Result), dom.td(a.RemoteIP), dom.td(a.LocalIP || '-'), dom.td(a.TLS || '-')))));
+};
+const loginAttempts = async () => {
+	const [[lockouts, ipNets], attempts] = await Promise.all([
+		client.LoginBlocks(),
+		client.LoginAttempts('', 200),
+	]);
+	const nowSecs = new Date().getTime() / 1000;
+	dom._kids(page, crumbs(crumblink('Mox Admin', '#'), 'Login attempts'), dom.p('Authentication attempts for IMAP, SMTP submission and the web interfaces. Failed attempts are rate limited per IP address and subnet. Accounts with a login lockout configured are blocked after too many consecutive failed attempts, from any IP address.'), dom.h2('Blocked accounts'), dom.table(dom._class('hover'), dom.thead(dom.tr(dom.th('Account'), dom.th('Failures'), dom.th('Last failure'), dom.th('Until'), dom.th('Action'))), dom.tbody((lockouts || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), 'No blocked accounts.')) : [], (lockouts || []).map(l => dom.tr(dom.td(dom.a(attr.href('#accounts/' + l.AccountName), l.AccountName)), dom.td('' + l.Failures), dom.td(age(l.LastFailure, false, nowSecs)), dom.td(l.Until.toISOString()), dom.td(dom.clickbutton('Unblock', async function click(e) {
+		const target = e.target;
+		try {
+			target.disabled = true;
+			await client.LoginLockoutRemove(l.AccountName);
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			target.disabled = false;
+		}
+		window.location.reload(); // todo: only reload the list
+	})))))), dom.br(), dom.h2('Rate limited IPs and subnets'), dom.p('IP addresses and subnets with too many failed authentication attempts in the past minute or day. Authentication attempts from these IPs are refused until the rate limit window has passed.'), dom.table(dom._class('hover'), dom.thead(dom.tr(dom.th('IP/subnet'), dom.th('Action'))), dom.tbody((ipNets || []).length === 0 ? dom.tr(dom.td(attr.colspan('2'), 'No rate limited IPs.')) : [], (ipNets || []).map(ipnet => dom.tr(dom.td(ipnet), dom.td(dom.clickbutton('Unblock', async function click(e) {
+		const target = e.target;
+		try {
+			target.disabled = true;
+			await client.LoginIPBlockRemove(ipnet);
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+			return;
+		}
+		finally {
+			target.disabled = false;
+		}
+		window.location.reload(); // todo: only reload the list
+	})))))), dom.br(), dom.h2('Recent login attempts'), loginAttemptsTable(attempts || []));
+};
 const dnsbl = async () => {
 	const ipZoneResults = await client.DNSBLStatus();
 	const url = (ip) => {
@@ -2694,6 +3093,88 @@ const queueList = async () => {
 		}))),
 	]);
 };
+const quarantineList = async () => {
+	let fieldset;
+	let account;
+	let reason;
+	let search;
+	const resultsBox = dom.div();
+	const headersBox = dom.div();
+	const render = async () => {
+		const msgs = await client.QuarantineList(account.value, reason.value, search.value, 1000) || [];
+		const nowSecs = new Date().getTime() / 1000;
+		// Checkboxes for selecting messages for bulk operations.
+		const checkboxes = [];
+		const bulk = async (e, confirmText, fn) => {
+			const ids = checkboxes.filter(t => t[1].checked).map(t => t[0].ID);
+			if (ids.length === 0) {
+				window.alert('No messages selected.');
+				return;
+			}
+			if (confirmText && !window.confirm(confirmText)) {
+				return;
+			}
+			const target = e.target;
+			try {
+				target.disabled = true;
+				await fn(ids);
+			}
+			catch (err) {
+				console.log({ err });
+				window.alert('Error: ' + errmsg(err));
+				return;
+			}
+			finally {
+				target.disabled = false;
+			}
+			dom._kids(headersBox);
+			await render();
+		};
+		dom._kids(resultsBox, msgs.length === 0 ? dom.p('No matching messages in the quarantine.') : [
+			dom.p(dom.clickbutton('Release', attr.title('Deliver the selected messages to the accounts of their recipients, and remove them from the quarantine.'), async function click(e) {
+				await bulk(e, '', ids => client.QuarantineRelease(ids, false));
+			}), ' ', dom.clickbutton('Release and train as non-junk', attr.title('Deliver the selected messages to the accounts of their recipients, and train the junk filters of the accounts with the messages as non-junk.'), async function click(e) {
+				await bulk(e, '', ids => client.QuarantineRelease(ids, true));
+			}), ' ', dom.clickbutton('Delete', async function click(e) {
+				await bulk(e, 'Are you sure you want to remove the selected messages? They will be removed completely.', ids => client.QuarantineDelete(ids));
+			})),
+			dom.table(dom._class('hover'), dom.thead(dom.tr(dom.th(dom.input(attr.type('checkbox'), attr.title('Select all messages.'), function change(e) {
+				const checked = e.target.checked;
+				checkboxes.forEach(t => t[1].checked = checked);
+			})), dom.th('Received'), dom.th('Account'), dom.th('Reason'), dom.th('From'), dom.th('To'), dom.th('Subject'), dom.th('Size'), dom.th('Digest'), dom.th('Headers'))), dom.tbody(msgs.map(m => {
+				const checkbox = dom.input(attr.type('checkbox'));
+				checkboxes.push([m, checkbox]);
+				return dom.tr(dom.td(checkbox), dom.td(age(new Date(m.Received), false, nowSecs)), dom.td(m.Account), dom.td(m.Reason, attr.title(m.Detail)), dom.td(m.MsgFrom || '-', attr.title('SMTP MAIL FROM: ' + (m.MailFrom || '(null sender)'))), dom.td(m.RcptTo), dom.td(m.Subject), dom.td(formatSize(m.Size)), dom.td(m.DigestSent ? 'Sent' : '-'), dom.td(dom.clickbutton('Show', async function click() {
+					try {
+						const headers = await client.QuarantineHeaders(m.ID);
+						dom._kids(headersBox, dom.h2('Headers of message ' + m.ID), dom.pre(dom._class('literal'), headers));
+						headersBox.scrollIntoView();
+					}
+					catch (err) {
+						console.log({ err });
+						window.alert('Error: ' + errmsg(err));
+					}
+				})));
+			}))),
+		]);
+	};
+	dom._kids(page, crumbs(crumblink('Mox Admin', '#'), 'Quarantine'), dom.p('Incoming messages held in the quarantine, because the remote IP is on a DNS blocklist, the junk filter classified them as spam, a content scanner quarantined them, or they matched a hold rule. Only headers are shown, the message bodies may be harmful. Released messages are delivered to the account of the recipient.'), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		fieldset.disabled = true;
+		try {
+			await render();
+		}
+		catch (err) {
+			console.log({ err });
+			window.alert('Error: ' + errmsg(err));
+		}
+		finally {
+			fieldset.disabled = false;
+		}
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'inline-block' }), 'Account', dom.br(), account = dom.input()), ' ', dom.label(style({ display: 'inline-block' }), 'Reason', dom.br(), reason = dom.select(dom.option('(any)', attr.value('')), dom.option('DNS blocklist', attr.value('dnsbl')), dom.option('Junk filter', attr.value('junk')), dom.option('Content scanner', attr.value('contentscan')), dom.option('Hold rule', attr.value('hold')))), ' ', dom.label(style({ display: 'inline-block' }), 'Search', dom.br(), search = dom.input(attr.placeholder('From, to or subject'))), ' ', dom.submitbutton('Search'))), dom.br(), resultsBox, headersBox);
+	await render();
+};
 const webserver = async () => {
 	let conf = await client.WebserverConfig();
 	// We disable this while saving the form.
@@ -3054,9 +3535,15 @@ const init = async () => {
 			else if (t[0] === 'domains' && t.length === 3 && t[2] === 'dnsrecords') {
 				await domainDNSRecords(t[1]);
 			}
+			else if (t[0] === 'domains' && t.length === 3 && t[2] === 'dnssync') {
+				await domainDNSSync(t[1]);
+			}
 			else if (h === 'queue') {
 				await queueList();
 			}
+			else if (h === 'quarantine') {
+				await quarantineList();
+			}
 			else if (h === 'tlsrpt') {
 				await tlsrptIndex();
 			}
@@ -3093,6 +3580,9 @@ const init = async () => {
 			else if (h === 'dnsbl') {
 				await dnsbl();
 			}
+			else if (h === 'loginattempts') {
+				await loginAttempts();
+			}
 			else if (h === 'webserver') {
 				await webserver();
 			}
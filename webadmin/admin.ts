@@ -271,6 +271,7 @@ const index = async () => {
 		dom.p(
 			dom.a('Accounts', attr.href('#accounts')), dom.br(),
 			dom.a('Queue', attr.href('#queue')), ' ('+queueSize+')', dom.br(),
+			dom.a('Quarantine', attr.href('#quarantine')), dom.br(),
 		),
 		dom.h2('Domains'),
 		(domains || []).length === 0 ? box(red, 'No domains') :
@@ -329,6 +330,7 @@ const index = async () => {
 		dom.div(dom.a('MTA-STS policies', attr.href('#mtasts'))),
 		dom.div(dom.a('DMARC evaluations', attr.href('#dmarc/evaluations'))),
 		dom.div(dom.a('TLS connection results', attr.href('#tlsrpt/results'))),
+		dom.div(dom.a('Login attempts and blocks', attr.href('#loginattempts'))),
 		// todo: routing, globally, per domain and per account
 		dom.br(),
 		dom.h2('DNS blocklist status'),
@@ -553,6 +555,12 @@ const accounts = async () => {
 
 const account = async (name: string) => {
 	const config = await client.Account(name)
+	const [totpEnabled, totpRecoveryCodesLeft] = await client.AccountTOTPStatus(name)
+	const [[lockouts], attempts] = await Promise.all([
+		client.LoginBlocks(),
+		client.LoginAttempts(name, 10),
+	])
+	const lockout = (lockouts || []).find(l => l.AccountName === name)
 
 	let form: HTMLFormElement
 	let fieldset: HTMLFieldSetElement
@@ -568,6 +576,13 @@ const account = async (name: string) => {
 	let password: HTMLInputElement
 	let passwordHint: HTMLElement
 
+	let fieldsetTOTP: HTMLFieldSetElement
+	let requireTOTP: HTMLInputElement
+
+	let fieldsetLockout: HTMLFieldSetElement
+	let lockoutMaxFailures: HTMLInputElement
+	let lockoutPeriod: HTMLInputElement
+
 	const xparseSize = (s: string) => {
 		const origs = s
 		s = s.toLowerCase()
@@ -803,6 +818,114 @@ const account = async (name: string) => {
 			},
 		),
 		dom.br(),
+		dom.h2('Two-factor authentication'),
+		dom.p(totpEnabled ? 'Enabled with an authenticator app, recovery codes left: ' + totpRecoveryCodesLeft + '.' : 'Not enabled.'),
+		dom.form(
+			fieldsetTOTP=dom.fieldset(
+				dom.label(
+					style({display: 'block', marginBottom: '.5ex'}),
+					attr.title('Require two-factor authentication with time-based one-time passwords (TOTP) from an authenticator app for logging in to the webmail and account web interfaces. Until the user has enrolled an authenticator app, only a login to the account web interface is allowed, for enrolling. IMAP, SMTP submission and CardDAV only accept app passwords, not the account password. App passwords are managed in the account web interface. RequireTOTP in configuration file.'),
+					requireTOTP=dom.input(attr.type('checkbox'), config.RequireTOTP ? attr.checked('') : []),
+					' Require for webmail and account web interface logins',
+				),
+				dom.submitbutton('Save'),
+			),
+			async function submit(e: SubmitEvent) {
+				e.stopPropagation()
+				e.preventDefault()
+				fieldsetTOTP.disabled = true
+				try {
+					await client.SetAccountRequireTOTP(name, requireTOTP.checked)
+					window.alert('Two-factor authentication requirement saved.')
+				} catch (err) {
+					console.log({err})
+					window.alert('Error: ' + errmsg(err))
+					return
+				} finally {
+					fieldsetTOTP.disabled = false
+				}
+			},
+		),
+		totpEnabled ? dom.div(
+			style({marginTop: '.5ex'}),
+			dom.clickbutton('Reset two-factor authentication', attr.title('Remove the authenticator app secret and recovery codes, e.g. for a user who lost both. If two-factor authentication is required, the user must enroll again in the account web interface.'), async function click(e: MouseEvent) {
+				if (!window.confirm('Are you sure you want to reset two-factor authentication for this account?')) {
+					return
+				}
+				const target = e.target! as HTMLButtonElement
+				target.disabled = true
+				try {
+					await client.AccountTOTPReset(name)
+				} catch (err) {
+					console.log({err})
+					window.alert('Error: ' + errmsg(err))
+					return
+				} finally {
+					target.disabled = false
+				}
+				window.location.reload() // todo: only reload the two-factor authentication status
+			}),
+		) : [],
+		dom.br(),
+		dom.h2('Login lockout'),
+		lockout ? dom.p(
+			box(yellow,
+				'Authentication is blocked until ' + lockout.Until.toString() + ', after ' + lockout.Failures + ' consecutive failed attempts. ',
+				dom.clickbutton('Unblock', async function click(e: MouseEvent) {
+					const target = e.target! as HTMLButtonElement
+					target.disabled = true
+					try {
+						await client.LoginLockoutRemove(name)
+					} catch (err) {
+						console.log({err})
+						window.alert('Error: ' + errmsg(err))
+						return
+					} finally {
+						target.disabled = false
+					}
+					window.location.reload() // todo: only reload the lockout status
+				}),
+			),
+		) : [],
+		dom.form(
+			fieldsetLockout=dom.fieldset(
+				dom.label(
+					style({display: 'inline-block'}),
+					dom.span('Max consecutive failures', attr.title('Number of consecutive failed authentication attempts, from any IP address, after which authentication for the account is blocked. A successful login resets the count. Zero disables blocking. MaxFailures in LoginLockout in configuration file.')),
+					dom.br(),
+					lockoutMaxFailures=dom.input(attr.type('number'), attr.required(''), attr.min('0'), attr.value('' + (config.LoginLockout ? config.LoginLockout.MaxFailures : 0))),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					dom.span('Block period in minutes', attr.title('How long authentication is blocked. Zero means the default of 60 minutes. Period in LoginLockout in configuration file.')),
+					dom.br(),
+					lockoutPeriod=dom.input(attr.type('number'), attr.required(''), attr.min('0'), attr.value('' + (config.LoginLockout ? Math.round(config.LoginLockout.Period/(60*1000*1000*1000)) : 0))),
+				),
+				' ',
+				dom.submitbutton('Save'),
+			),
+			async function submit(e: SubmitEvent) {
+				e.stopPropagation()
+				e.preventDefault()
+				fieldsetLockout.disabled = true
+				try {
+					await client.SetAccountLoginLockout(name, parseInt(lockoutMaxFailures.value), parseInt(lockoutPeriod.value))
+					window.alert('Login lockout saved.')
+				} catch (err) {
+					console.log({err})
+					window.alert('Error: ' + errmsg(err))
+					return
+				} finally {
+					fieldsetLockout.disabled = false
+				}
+			},
+		),
+		dom.br(),
+		dom.h2('Recent login attempts'),
+		loginAttemptsTable(attempts || []),
+		dom.p(dom.a('All login attempts and blocks', attr.href('#loginattempts'))),
+		dom.br(),
 		dom.h2('Danger'),
 		dom.clickbutton('Remove account', async function click(e: MouseEvent) {
 			e.preventDefault()
@@ -828,18 +951,41 @@ const account = async (name: string) => {
 const domain = async (d: string) => {
 	const end = new Date()
 	const start = new Date(new Date().getTime() - 30*24*3600*1000)
-	const [dmarcSummaries, tlsrptSummaries, localpartAccounts, dnsdomain, clientConfigs] = await Promise.all([
+	const [dmarcSummaries, tlsrptSummaries, localpartAccounts, dnsdomain, clientConfigs, dkimRotation] = await Promise.all([
 		client.DMARCSummaries(start, end, d),
 		client.TLSRPTSummaries(start, end, d),
 		client.DomainLocalparts(d),
 		client.Domain(d),
 		client.ClientConfigsDomain(d),
+		client.DKIMRotation(d),
 	])
 
 	let form: HTMLFormElement
 	let fieldset: HTMLFieldSetElement
 	let localpart: HTMLInputElement
 	let account: HTMLInputElement
+	let rotationFieldset: HTMLFieldSetElement
+	let rotationGraceDays: HTMLInputElement
+
+	const rotationButton = (text: string, confirmText: string, fn: () => Promise<void>) =>
+		dom.clickbutton(text, async function click(e: MouseEvent) {
+			e.preventDefault()
+			if (confirmText && !window.confirm(confirmText)) {
+				return
+			}
+			const target = e.target! as HTMLButtonElement
+			target.disabled = true
+			try {
+				await fn()
+			} catch (err) {
+				console.log({err})
+				window.alert('Error: ' + errmsg(err))
+				return
+			} finally {
+				target.disabled = false
+			}
+			window.location.reload() // todo: only reload the rotation
+		})
 
 	dom._kids(page,
 		crumbs(
@@ -849,6 +995,7 @@ const domain = async (d: string) => {
 		dom.ul(
 			dom.li(dom.a('Required DNS records', attr.href('#domains/' + d + '/dnsrecords'))),
 			dom.li(dom.a('Check current actual DNS records and domain configuration', attr.href('#domains/' + d + '/dnscheck'))),
+			dom.li(dom.a('Sync required DNS records with dynamic DNS updates', attr.href('#domains/' + d + '/dnssync'))),
 		),
 		dom.br(),
 		dom.h2('Client configuration'),
@@ -952,6 +1099,62 @@ const domain = async (d: string) => {
 			),
 		),
 		dom.br(),
+		dom.h2('DKIM key rotation'),
+		!dkimRotation ? [
+			dom.p('Rotating DKIM keys generates a new selector with a fresh key for each selector currently used for signing. Once the DNS records for the new selectors are published, signing switches to the new selectors. The DNS records of the old selectors must remain published for a grace period, after which the rotation can be finished, removing the old selectors.'),
+			dom.form(
+				async function submit(e: SubmitEvent) {
+					e.preventDefault()
+					e.stopPropagation()
+					rotationFieldset.disabled = true
+					try {
+						await client.DKIMRotationStart(d, parseInt(rotationGraceDays.value))
+					} catch (err) {
+						console.log({err})
+						window.alert('Error: ' + errmsg(err))
+						return
+					} finally {
+						rotationFieldset.disabled = false
+					}
+					window.location.reload() // todo: only reload the rotation
+				},
+				rotationFieldset=dom.fieldset(
+					dom.label(
+						style({display: 'inline-block'}),
+						dom.span('Grace period (days)', attr.title('Time to keep the DNS records of the old selectors published after switching to the new selectors, for messages still in transit and verification of recently sent messages.')),
+						dom.br(),
+						rotationGraceDays=dom.input(attr.type('number'), attr.min('1'), attr.value('7'), attr.required('')),
+					),
+					' ',
+					dom.submitbutton('Start rotation', attr.title('New selectors will be added to the config, but not yet used for signing.')),
+				),
+			),
+		] : [
+			dom.table(
+				dom.tr(dom.td('Started'), dom.td(dkimRotation.Started.toISOString())),
+				dom.tr(dom.td('Phase'), dom.td(dkimRotation.Phase)),
+				dom.tr(dom.td('Old selectors'), dom.td((dkimRotation.OldSelectors || []).join(', '))),
+				dom.tr(dom.td('New selectors'), dom.td((dkimRotation.NewSelectors || []).join(', '))),
+				dkimRotation.Phase !== 'publish' ? [
+					dom.tr(dom.td('Switched'), dom.td(dkimRotation.Switched.toISOString())),
+					dom.tr(dom.td('Grace period ends'), dom.td(dkimRotation.GraceEnd.toISOString())),
+				] : [],
+			),
+			dkimRotation.Phase === 'publish' ? [
+				dom.p('Publish the DNS records below. DNS is checked periodically, signing switches to the new selectors once the records are found.'),
+				dom.pre(dom._class('literal'), (dkimRotation.Records || []).join('\n')),
+				dkimRotation.LastCheck.getTime() > 0 ? dom.p('Last check at ', dkimRotation.LastCheck.toISOString(), ': ', dkimRotation.LastCheckError || 'ok') : [],
+				rotationButton('Check DNS now', '', async () => await client.DKIMRotationCheck(d)),
+				' ',
+				rotationButton('Cancel rotation', 'Are you sure you want to cancel the rotation? The new selectors will be removed.', async () => await client.DKIMRotationCancel(d)),
+			] : [],
+			dkimRotation.Phase === 'grace' ? dom.p('Signing with the new selectors. Keep the DNS records of the old selectors published until the grace period ends.') : [],
+			dkimRotation.Phase === 'remove' ? [
+				dom.p('The grace period has passed. Finish the rotation to remove the old selectors from the configuration, then remove their DNS records.'),
+				rotationButton('Finish rotation', 'Are you sure you want to remove the old selectors?', async () => await client.DKIMRotationFinish(d)),
+			] : [],
+		],
+		dom.br(),
 		dom.h2('External checks'),
 		dom.ul(
 			dom.li(link('https://internet.nl/mail/'+dnsdomain.ASCII+'/', 'Check configuration at internet.nl')),
@@ -997,6 +1200,54 @@ const domainDNSRecords = async (d: string) => {
 	)
 }
 
+const domainDNSSync = async (d: string) => {
+	const [changes, dnsdomain] = await Promise.all([
+		client.DomainDNSSync(d, true),
+		client.Domain(d),
+	])
+
+	const recordsSection = (title: string, l: string[] | null | undefined) => [
+		dom.h2(title),
+		(l || []).length === 0 ? dom.div('(none)') : dom.pre(dom._class('literal'), (l || []).join('\n')),
+		dom.br(),
+	]
+
+	const render = (r: api.DNSSyncResult, applied: boolean) => {
+		const pending = (r.Remove || []).length > 0 || (r.Add || []).length > 0
+		dom._kids(page,
+			crumbs(
+				crumblink('Mox Admin', '#'),
+				crumblink('Domain ' + domainString(dnsdomain), '#domains/'+d),
+				'Sync DNS',
+			),
+			dom.h1('Sync required DNS records'),
+			dom.p('Required DNS records are compared with the records currently in DNS. Conflicting records are removed and missing records added through a dynamic DNS update (RFC 2136) to the name server configured for the domain. Records outside the zone and records of some types, like CAA, are skipped and must be managed manually.'),
+			applied ? box(green, pending ? 'DNS records updated.' : 'DNS records already up to date.') : [],
+			recordsSection(applied ? 'Removed' : 'To remove', r.Remove),
+			recordsSection(applied ? 'Added' : 'To add', r.Add),
+			recordsSection('Unchanged', r.Unchanged),
+			recordsSection('Skipped', r.Skipped),
+			applied || !pending ? [] : dom.clickbutton('Apply changes', attr.title('Send the dynamic DNS update to the name server.'), async function click(e: MouseEvent) {
+				e.preventDefault()
+				const target = e.target! as HTMLButtonElement
+				target.disabled = true
+				let nr: api.DNSSyncResult
+				try {
+					nr = await client.DomainDNSSync(d, false)
+				} catch (err) {
+					console.log({err})
+					window.alert('Error: ' + errmsg(err))
+					return
+				} finally {
+					target.disabled = false
+				}
+				render(nr, true)
+			}),
+		)
+	}
+	render(changes, false)
+}
+
 const domainDNSCheck = async (d: string) => {
 	const [checks, dnsdomain] = await Promise.all([
 		client.CheckDomain(d),
@@ -2185,6 +2436,135 @@ const makeMTASTSTable = (items: api.PolicyRecord[]) => {
 	)
 }
 
+const loginAttemptsTable = (attempts: api.LoginAttempt[]) => {
+	const nowSecs = new Date().getTime()/1000
+	return dom.table(dom._class('hover'),
+		dom.thead(
+			dom.tr(
+				dom.th('Time'),
+				dom.th('Account'),
+				dom.th('Login address'),
+				dom.th('Protocol'),
+				dom.th('Mechanism'),
+				dom.th('Result'),
+				dom.th('Remote IP'),
+				dom.th('Local IP'),
+				dom.th('TLS'),
+			),
+		),
+		dom.tbody(
+			attempts.length === 0 ? dom.tr(dom.td(attr.colspan('9'), 'No login attempts.')) : [],
+			attempts.map(a =>
+				dom.tr(
+					dom.td(age(a.Time, false, nowSecs)),
+					dom.td(a.AccountName ? dom.a(attr.href('#accounts/' + a.AccountName), a.AccountName) : '-'),
+					dom.td(a.LoginAddress || '-'),
+					dom.td(a.Protocol),
+					dom.td(a.AuthMech),
+					dom.td(a.Result === 'ok' ? [] : style({backgroundColor: a.Result === 'aborted' ? yellow : red}), a.Result),
+					dom.td(a.RemoteIP),
+					dom.td(a.LocalIP || '-'),
+					dom.td(a.TLS || '-'),
+				)
+			),
+		),
+	)
+}
+
+const loginAttempts = async () => {
+	const [[lockouts, ipNets], attempts] = await Promise.all([
+		client.LoginBlocks(),
+		client.LoginAttempts('', 200),
+	])
+
+	const nowSecs = new Date().getTime()/1000
+
+	dom._kids(page,
+		crumbs(
+			crumblink('Mox Admin', '#'),
+			'Login attempts',
+		),
+		dom.p('Authentication attempts for IMAP, SMTP submission and the web interfaces. Failed attempts are rate limited per IP address and subnet. Accounts with a login lockout configured are blocked after too many consecutive failed attempts, from any IP address.'),
+		dom.h2('Blocked accounts'),
+		dom.table(dom._class('hover'),
+			dom.thead(
+				dom.tr(
+					dom.th('Account'),
+					dom.th('Failures'),
+					dom.th('Last failure'),
+					dom.th('Until'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				(lockouts || []).length === 0 ? dom.tr(dom.td(attr.colspan('5'), 'No blocked accounts.')) : [],
+				(lockouts || []).map(l =>
+					dom.tr(
+						dom.td(dom.a(attr.href('#accounts/' + l.AccountName), l.AccountName)),
+						dom.td(''+l.Failures),
+						dom.td(age(l.LastFailure, false, nowSecs)),
+						dom.td(l.Until.toISOString()),
+						dom.td(
+							dom.clickbutton('Unblock', async function click(e: MouseEvent) {
+								const target = e.target! as HTMLButtonElement
+								try {
+									target.disabled = true
+									await client.LoginLockoutRemove(l.AccountName)
+								} catch (err) {
+									console.log({err})
+									window.alert('Error: ' + errmsg(err))
+									return
+								} finally {
+									target.disabled = false
+								}
+								window.location.reload() // todo: only reload the list
+							}),
+						),
+					)
+				),
+			),
+		),
+		dom.br(),
+		dom.h2('Rate limited IPs and subnets'),
+		dom.p('IP addresses and subnets with too many failed authentication attempts in the past minute or day. Authentication attempts from these IPs are refused until the rate limit window has passed.'),
+		dom.table(dom._class('hover'),
+			dom.thead(
+				dom.tr(
+					dom.th('IP/subnet'),
+					dom.th('Action'),
+				),
+			),
+			dom.tbody(
+				(ipNets || []).length === 0 ? dom.tr(dom.td(attr.colspan('2'), 'No rate limited IPs.')) : [],
+				(ipNets || []).map(ipnet =>
+					dom.tr(
+						dom.td(ipnet),
+						dom.td(
+							dom.clickbutton('Unblock', async function click(e: MouseEvent) {
+								const target = e.target! as HTMLButtonElement
+								try {
+									target.disabled = true
+									await client.LoginIPBlockRemove(ipnet)
+								} catch (err) {
+									console.log({err})
+									window.alert('Error: ' + errmsg(err))
+									return
+								} finally {
+									target.disabled = false
+								}
+								window.location.reload() // todo: only reload the list
+							}),
+						),
+					)
+				),
+			),
+		),
+		dom.br(),
+		dom.h2('Recent login attempts'),
+		loginAttemptsTable(attempts || []),
+	)
+}
+
 const dnsbl = async () => {
 	const ipZoneResults = await client.DNSBLStatus()
 
@@ -2347,6 +2727,175 @@ const queueList = async () => {
 	)
 }
 
+const quarantineList = async () => {
+	let fieldset: HTMLFieldSetElement
+	let account: HTMLInputElement
+	let reason: HTMLSelectElement
+	let search: HTMLInputElement
+	const resultsBox = dom.div()
+	const headersBox = dom.div()
+
+	const render = async () => {
+		const msgs = await client.QuarantineList(account.value, reason.value, search.value, 1000) || []
+		const nowSecs = new Date().getTime()/1000
+
+		// Checkboxes for selecting messages for bulk operations.
+		const checkboxes: [api.Message, HTMLInputElement][] = []
+
+		const bulk = async (e: MouseEvent, confirmText: string, fn: (ids: number[]) => Promise<void>) => {
+			const ids = checkboxes.filter(t => t[1].checked).map(t => t[0].ID)
+			if (ids.length === 0) {
+				window.alert('No messages selected.')
+				return
+			}
+			if (confirmText && !window.confirm(confirmText)) {
+				return
+			}
+			const target = e.target! as HTMLButtonElement
+			try {
+				target.disabled = true
+				await fn(ids)
+			} catch (err) {
+				console.log({err})
+				window.alert('Error: ' + errmsg(err))
+				return
+			} finally {
+				target.disabled = false
+			}
+			dom._kids(headersBox)
+			await render()
+		}
+
+		dom._kids(resultsBox,
+			msgs.length === 0 ? dom.p('No matching messages in the quarantine.') : [
+				dom.p(
+					dom.clickbutton('Release', attr.title('Deliver the selected messages to the accounts of their recipients, and remove them from the quarantine.'), async function click(e: MouseEvent) {
+						await bulk(e, '', ids => client.QuarantineRelease(ids, false))
+					}),
+					' ',
+					dom.clickbutton('Release and train as non-junk', attr.title('Deliver the selected messages to the accounts of their recipients, and train the junk filters of the accounts with the messages as non-junk.'), async function click(e: MouseEvent) {
+						await bulk(e, '', ids => client.QuarantineRelease(ids, true))
+					}),
+					' ',
+					dom.clickbutton('Delete', async function click(e: MouseEvent) {
+						await bulk(e, 'Are you sure you want to remove the selected messages? They will be removed completely.', ids => client.QuarantineDelete(ids))
+					}),
+				),
+				dom.table(dom._class('hover'),
+					dom.thead(
+						dom.tr(
+							dom.th(
+								dom.input(attr.type('checkbox'), attr.title('Select all messages.'), function change(e: Event) {
+									const checked = (e.target! as HTMLInputElement).checked
+									checkboxes.forEach(t => t[1].checked = checked)
+								}),
+							),
+							dom.th('Received'),
+							dom.th('Account'),
+							dom.th('Reason'),
+							dom.th('From'),
+							dom.th('To'),
+							dom.th('Subject'),
+							dom.th('Size'),
+							dom.th('Digest'),
+							dom.th('Headers'),
+						),
+					),
+					dom.tbody(
+						msgs.map(m => {
+							const checkbox = dom.input(attr.type('checkbox'))
+							checkboxes.push([m, checkbox])
+							return dom.tr(
+								dom.td(checkbox),
+								dom.td(age(new Date(m.Received), false, nowSecs)),
+								dom.td(m.Account),
+								dom.td(m.Reason, attr.title(m.Detail)),
+								dom.td(m.MsgFrom || '-', attr.title('SMTP MAIL FROM: ' + (m.MailFrom || '(null sender)'))),
+								dom.td(m.RcptTo),
+								dom.td(m.Subject),
+								dom.td(formatSize(m.Size)),
+								dom.td(m.DigestSent ? 'Sent' : '-'),
+								dom.td(
+									dom.clickbutton('Show', async function click() {
+										try {
+											const headers = await client.QuarantineHeaders(m.ID)
+											dom._kids(headersBox,
+												dom.h2('Headers of message ' + m.ID),
+												dom.pre(dom._class('literal'), headers),
+											)
+											headersBox.scrollIntoView()
+										} catch (err) {
+											console.log({err})
+											window.alert('Error: ' + errmsg(err))
+										}
+									}),
+								),
+							)
+						}),
+					),
+				),
+			],
+		)
+	}
+
+	dom._kids(page,
+		crumbs(
+			crumblink('Mox Admin', '#'),
+			'Quarantine',
+		),
+		dom.p('Incoming messages held in the quarantine, because the remote IP is on a DNS blocklist, the junk filter classified them as spam, a content scanner quarantined them, or they matched a hold rule. Only headers are shown, the message bodies may be harmful. Released messages are delivered to the account of the recipient.'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				fieldset.disabled = true
+				try {
+					await render()
+				} catch (err) {
+					console.log({err})
+					window.alert('Error: ' + errmsg(err))
+				} finally {
+					fieldset.disabled = false
+				}
+			},
+			fieldset=dom.fieldset(
+				dom.label(
+					style({display: 'inline-block'}),
+					'Account',
+					dom.br(),
+					account=dom.input(),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					'Reason',
+					dom.br(),
+					reason=dom.select(
+						dom.option('(any)', attr.value('')),
+						dom.option('DNS blocklist', attr.value('dnsbl')),
+						dom.option('Junk filter', attr.value('junk')),
+						dom.option('Content scanner', attr.value('contentscan')),
+						dom.option('Hold rule', attr.value('hold')),
+					),
+				),
+				' ',
+				dom.label(
+					style({display: 'inline-block'}),
+					'Search',
+					dom.br(),
+					search=dom.input(attr.placeholder('From, to or subject')),
+				),
+				' ',
+				dom.submitbutton('Search'),
+			),
+		),
+		dom.br(),
+		resultsBox,
+		headersBox,
+	)
+	await render()
+}
+
 const webserver = async () => {
 	let conf = await client.WebserverConfig()
 
@@ -3033,8 +3582,12 @@ const init = async () => {
 				await domainDNSCheck(t[1])
 			} else if (t[0] === 'domains' && t.length === 3 && t[2] === 'dnsrecords') {
 				await domainDNSRecords(t[1])
+			} else if (t[0] === 'domains' && t.length === 3 && t[2] === 'dnssync') {
+				await domainDNSSync(t[1])
 			} else if (h === 'queue') {
 				await queueList()
+			} else if (h === 'quarantine') {
+				await quarantineList()
 			} else if (h === 'tlsrpt') {
 				await tlsrptIndex()
 			} else if (h === 'tlsrpt/reports') {
@@ -3059,6 +3612,8 @@ const init = async () => {
 				await mtasts()
 			} else if (h === 'dnsbl') {
 				await dnsbl()
+			} else if (h === 'loginattempts') {
+				await loginAttempts()
 			} else if (h === 'webserver') {
 				await webserver()
 			} else {
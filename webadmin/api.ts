@@ -3,7 +3,7 @@
 namespace api {
 
 // CheckResult is the analysis of a domain, its actual configuration (DNS, TLS,
-// connectivity) and the mox configuration. It includes configuration instructions
+// connectivity) and the beacon configuration. It includes configuration instructions
 // (e.g. DNS records), and warnings and errors encountered.
 export interface CheckResult {
 	Domain: string
@@ -66,6 +66,7 @@ export interface TLSCheckResult {
 }
 
 export interface DANECheckResult {
+	TLSA?: { [key: string]: string[] | null }  // MX host to TLSA records found at _25._tcp of the host.
 	Errors?: string[] | null
 	Warnings?: string[] | null
 	Instructions?: string[] | null
@@ -192,6 +193,7 @@ export interface Extension {
 
 export interface MTASTSCheckResult {
 	TXT: string
+	CNAME: string  // Target of CNAME record for mta-sts host, if any.
 	Record?: MTASTSRecord | null
 	PolicyText: string
 	Policy?: Policy | null
@@ -244,7 +246,9 @@ export interface SRV {
 }
 
 export interface AutoconfCheckResult {
+	ClientSettingsDomainCNAME: string  // Target of CNAME record for client settings domain, if any.
 	ClientSettingsDomainIPs?: string[] | null
+	CNAME: string  // Target of CNAME record for autoconfig host, if any.
 	IPs?: string[] | null
 	Errors?: string[] | null
 	Warnings?: string[] | null
@@ -451,6 +455,51 @@ export interface Reverse {
 	Hostnames?: string[] | null
 }
 
+// DNSSyncResult is the outcome of synchronizing the required DNS records through
+// dynamic DNS updates. Records are in zone file format.
+export interface DNSSyncResult {
+	Remove?: string[] | null  // Records removed, or to be removed, from DNS.
+	Add?: string[] | null  // Records added, or to be added, to DNS.
+	Unchanged?: string[] | null  // Required records already present in DNS.
+	Skipped?: string[] | null  // Required records not managed through updates, e.g. CAA or outside the zone.
+}
+
+// LoginAttempt is a single authentication attempt.
+export interface LoginAttempt {
+	ID: number
+	Time: Date
+	AccountName: string  // Empty if no account could be found, e.g. for an unknown address, or an admin login.
+	LoginAddress: string  // As used in the attempt. May not exist.
+	RemoteIP: string
+	LocalIP: string
+	TLS: string  // TLS version and cipher suite, empty if the connection was not TLS.
+	Protocol: string  // "imap", "submission", "webmail", "webaccount", "webadmin" or "carddav".
+	AuthMech: string  // E.g. "plain", "scram-sha-256", "external" or "weblogin".
+	Result: string  // E.g. "ok", "badcreds", "badtotp", "locked", "aborted" or "error".
+}
+
+// Lockout tracks consecutive failed authentication attempts for an account, and
+// whether authentication is blocked.
+export interface Lockout {
+	AccountName: string
+	Failures: number  // Consecutive failed attempts since last successful login or unblock.
+	LastFailure: Date  // Time of most recent failed attempt.
+	Until: Date  // If in the future, authentication for the account is blocked.
+}
+
+// DKIMRotation is the state of a DKIM key rotation in progress for a domain.
+export interface DKIMRotation {
+	Started: Date
+	Phase: string  // "publish", "grace" or "remove".
+	OldSelectors?: string[] | null  // In use for signing when the rotation started.
+	NewSelectors?: string[] | null  // Replacements, in same order as OldSelectors.
+	Records?: string[] | null  // DNS records to publish for the new selectors, in zone file format.
+	LastCheck: Date
+	LastCheckError: string  // Empty if records of new selectors were found at last check.
+	Switched: Date  // When signing switched to the new selectors. Zero in publish phase.
+	GraceEnd: Date  // After which the old selectors can be removed. Zero in publish phase.
+}
+
 // ClientConfigs holds the client configuration for IMAP/Submission for a
 // domain.
 export interface ClientConfigs {
@@ -502,6 +551,22 @@ export interface IPDomain {
 	Domain: Domain
 }
 
+// Message is a message held in the quarantine.
+export interface Message {
+	ID: number
+	Received: Date
+	Reason: Reason
+	Detail: string  // More specific reason, e.g. from the junk analysis or the content scanner.
+	Account: string
+	RcptTo: string
+	MailFrom: string  // SMTP MAIL FROM, empty for the null sender.
+	MsgFrom: string  // Address in message From header, can be empty.
+	Subject: string
+	MessageID: string  // Canonical Message-Id, without <>. Can be empty.
+	Size: number  // Including MsgPrefix.
+	DigestSent: boolean  // Whether the message was listed in a digest to the account.
+}
+
 // WebserverConfig is the combination of WebDomainRedirects and WebHandlers
 // from the domains.conf configuration file.
 export interface WebserverConfig {
@@ -597,7 +662,7 @@ export interface Evaluation {
 	Optional: boolean  // If optional, this evaluation is not a reason to send a DMARC report, but it will be included when a report is sent due to other non-optional evaluations. Set for evaluations of incoming DMARC reports. We don't want such deliveries causing us to send a report, or we would keep exchanging reporting messages forever. Also set for when evaluation is a DMARC reject for domains we haven't positively interacted with, to prevent being used to flood an unsuspecting domain with reports.
 	IntervalHours: number  // Effective aggregate reporting interval in hours. Between 1 and 24, rounded up from seconds from policy to first number that can divide 24.
 	Addresses?: string[] | null  // "rua" in DMARC record, we only store evaluations for records with aggregate reporting addresses, so always non-empty.
-	PolicyPublished: PolicyPublished  // Policy used for evaluation. We don't store the "fo" field for failure reporting options, since we don't send failure reports for individual messages.
+	PolicyPublished: PolicyPublished  // Policy used for evaluation. We don't store the "fo" field for failure reporting options, failure reports for individual messages are sent during delivery.
 	SourceIP: string  // For "row" in a report record.
 	Disposition: Disposition
 	AlignedDKIMPass: boolean
@@ -770,8 +835,16 @@ export type Localpart = string
 // be an IPv4 address.
 export type IP = string
 
-export const structTypes: {[typename: string]: boolean} = {"AuthResults":true,"AutoconfCheckResult":true,"AutodiscoverCheckResult":true,"AutodiscoverSRV":true,"CheckResult":true,"ClientConfigs":true,"ClientConfigsEntry":true,"DANECheckResult":true,"DKIMAuthResult":true,"DKIMCheckResult":true,"DKIMRecord":true,"DMARCCheckResult":true,"DMARCRecord":true,"DMARCSummary":true,"DNSSECResult":true,"DateRange":true,"Directive":true,"Domain":true,"DomainFeedback":true,"Evaluation":true,"EvaluationStat":true,"Extension":true,"FailureDetails":true,"IPDomain":true,"IPRevCheckResult":true,"Identifiers":true,"MTASTSCheckResult":true,"MTASTSRecord":true,"MX":true,"MXCheckResult":true,"Modifier":true,"Msg":true,"Pair":true,"Policy":true,"PolicyEvaluated":true,"PolicyOverrideReason":true,"PolicyPublished":true,"PolicyRecord":true,"Record":true,"Report":true,"ReportMetadata":true,"ReportRecord":true,"Result":true,"ResultPolicy":true,"Reverse":true,"Row":true,"SMTPAuth":true,"SPFAuthResult":true,"SPFCheckResult":true,"SPFRecord":true,"SRV":true,"SRVConfCheckResult":true,"STSMX":true,"Summary":true,"SuppressAddress":true,"TLSCheckResult":true,"TLSRPTCheckResult":true,"TLSRPTDateRange":true,"TLSRPTRecord":true,"TLSRPTSummary":true,"TLSRPTSuppressAddress":true,"TLSReportRecord":true,"TLSResult":true,"Transport":true,"TransportSMTP":true,"TransportSocks":true,"URI":true,"WebForward":true,"WebHandler":true,"WebRedirect":true,"WebStatic":true,"WebserverConfig":true}
-export const stringsTypes: {[typename: string]: boolean} = {"Align":true,"Alignment":true,"CSRFToken":true,"DKIMResult":true,"DMARCPolicy":true,"DMARCResult":true,"Disposition":true,"IP":true,"Localpart":true,"Mode":true,"PolicyOverride":true,"PolicyType":true,"RUA":true,"ResultType":true,"SPFDomainScope":true,"SPFResult":true}
+// Reason a message was quarantined.
+export enum Reason {
+	ReasonDNSBL = "dnsbl",  // Remote IP is on a DNS blocklist, message was rejected.
+	ReasonJunk = "junk",  // Junk filter classified message as spam, message was rejected.
+	ReasonContentScan = "contentscan",  // Content scanner quarantined the message.
+	ReasonHold = "hold",  // Message matched a hold rule.
+}
+
+export const structTypes: {[typename: string]: boolean} = {"AuthResults":true,"AutoconfCheckResult":true,"AutodiscoverCheckResult":true,"AutodiscoverSRV":true,"CheckResult":true,"ClientConfigs":true,"ClientConfigsEntry":true,"DANECheckResult":true,"DKIMAuthResult":true,"DKIMCheckResult":true,"DKIMRecord":true,"DKIMRotation":true,"DMARCCheckResult":true,"DMARCRecord":true,"DMARCSummary":true,"DNSSECResult":true,"DNSSyncResult":true,"DateRange":true,"Directive":true,"Domain":true,"DomainFeedback":true,"Evaluation":true,"EvaluationStat":true,"Extension":true,"FailureDetails":true,"IPDomain":true,"IPRevCheckResult":true,"Identifiers":true,"Lockout":true,"LoginAttempt":true,"MTASTSCheckResult":true,"MTASTSRecord":true,"MX":true,"MXCheckResult":true,"Message":true,"Modifier":true,"Msg":true,"Pair":true,"Policy":true,"PolicyEvaluated":true,"PolicyOverrideReason":true,"PolicyPublished":true,"PolicyRecord":true,"Record":true,"Report":true,"ReportMetadata":true,"ReportRecord":true,"Result":true,"ResultPolicy":true,"Reverse":true,"Row":true,"SMTPAuth":true,"SPFAuthResult":true,"SPFCheckResult":true,"SPFRecord":true,"SRV":true,"SRVConfCheckResult":true,"STSMX":true,"Summary":true,"SuppressAddress":true,"TLSCheckResult":true,"TLSRPTCheckResult":true,"TLSRPTDateRange":true,"TLSRPTRecord":true,"TLSRPTSummary":true,"TLSRPTSuppressAddress":true,"TLSReportRecord":true,"TLSResult":true,"Transport":true,"TransportSMTP":true,"TransportSocks":true,"URI":true,"WebForward":true,"WebHandler":true,"WebRedirect":true,"WebStatic":true,"WebserverConfig":true}
+export const stringsTypes: {[typename: string]: boolean} = {"Align":true,"Alignment":true,"CSRFToken":true,"DKIMResult":true,"DMARCPolicy":true,"DMARCResult":true,"Disposition":true,"IP":true,"Localpart":true,"Mode":true,"PolicyOverride":true,"PolicyType":true,"RUA":true,"Reason":true,"ResultType":true,"SPFDomainScope":true,"SPFResult":true}
 export const intsTypes: {[typename: string]: boolean} = {}
 export const types: TypenameMap = {
 	"CheckResult": {"Name":"CheckResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"DNSSEC","Docs":"","Typewords":["DNSSECResult"]},{"Name":"IPRev","Docs":"","Typewords":["IPRevCheckResult"]},{"Name":"MX","Docs":"","Typewords":["MXCheckResult"]},{"Name":"TLS","Docs":"","Typewords":["TLSCheckResult"]},{"Name":"DANE","Docs":"","Typewords":["DANECheckResult"]},{"Name":"SPF","Docs":"","Typewords":["SPFCheckResult"]},{"Name":"DKIM","Docs":"","Typewords":["DKIMCheckResult"]},{"Name":"DMARC","Docs":"","Typewords":["DMARCCheckResult"]},{"Name":"HostTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"DomainTLSRPT","Docs":"","Typewords":["TLSRPTCheckResult"]},{"Name":"MTASTS","Docs":"","Typewords":["MTASTSCheckResult"]},{"Name":"SRVConf","Docs":"","Typewords":["SRVConfCheckResult"]},{"Name":"Autoconf","Docs":"","Typewords":["AutoconfCheckResult"]},{"Name":"Autodiscover","Docs":"","Typewords":["AutodiscoverCheckResult"]}]},
@@ -781,7 +854,7 @@ export const types: TypenameMap = {
 	"MXCheckResult": {"Name":"MXCheckResult","Docs":"","Fields":[{"Name":"Records","Docs":"","Typewords":["[]","MX"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"MX": {"Name":"MX","Docs":"","Fields":[{"Name":"Host","Docs":"","Typewords":["string"]},{"Name":"Pref","Docs":"","Typewords":["int32"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]}]},
 	"TLSCheckResult": {"Name":"TLSCheckResult","Docs":"","Fields":[{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
-	"DANECheckResult": {"Name":"DANECheckResult","Docs":"","Fields":[{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
+	"DANECheckResult": {"Name":"DANECheckResult","Docs":"","Fields":[{"Name":"TLSA","Docs":"","Typewords":["{}","[]","string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"SPFCheckResult": {"Name":"SPFCheckResult","Docs":"","Fields":[{"Name":"DomainTXT","Docs":"","Typewords":["string"]},{"Name":"DomainRecord","Docs":"","Typewords":["nullable","SPFRecord"]},{"Name":"HostTXT","Docs":"","Typewords":["string"]},{"Name":"HostRecord","Docs":"","Typewords":["nullable","SPFRecord"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"SPFRecord": {"Name":"SPFRecord","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Directives","Docs":"","Typewords":["[]","Directive"]},{"Name":"Redirect","Docs":"","Typewords":["string"]},{"Name":"Explanation","Docs":"","Typewords":["string"]},{"Name":"Other","Docs":"","Typewords":["[]","Modifier"]}]},
 	"Directive": {"Name":"Directive","Docs":"","Fields":[{"Name":"Qualifier","Docs":"","Typewords":["string"]},{"Name":"Mechanism","Docs":"","Typewords":["string"]},{"Name":"DomainSpec","Docs":"","Typewords":["string"]},{"Name":"IPstr","Docs":"","Typewords":["string"]},{"Name":"IP4CIDRLen","Docs":"","Typewords":["nullable","int32"]},{"Name":"IP6CIDRLen","Docs":"","Typewords":["nullable","int32"]}]},
@@ -795,14 +868,14 @@ export const types: TypenameMap = {
 	"TLSRPTCheckResult": {"Name":"TLSRPTCheckResult","Docs":"","Fields":[{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"Record","Docs":"","Typewords":["nullable","TLSRPTRecord"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"TLSRPTRecord": {"Name":"TLSRPTRecord","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"RUAs","Docs":"","Typewords":["[]","[]","RUA"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Extension"]}]},
 	"Extension": {"Name":"Extension","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["string"]},{"Name":"Value","Docs":"","Typewords":["string"]}]},
-	"MTASTSCheckResult": {"Name":"MTASTSCheckResult","Docs":"","Fields":[{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"Record","Docs":"","Typewords":["nullable","MTASTSRecord"]},{"Name":"PolicyText","Docs":"","Typewords":["string"]},{"Name":"Policy","Docs":"","Typewords":["nullable","Policy"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
+	"MTASTSCheckResult": {"Name":"MTASTSCheckResult","Docs":"","Fields":[{"Name":"TXT","Docs":"","Typewords":["string"]},{"Name":"CNAME","Docs":"","Typewords":["string"]},{"Name":"Record","Docs":"","Typewords":["nullable","MTASTSRecord"]},{"Name":"PolicyText","Docs":"","Typewords":["string"]},{"Name":"Policy","Docs":"","Typewords":["nullable","Policy"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"MTASTSRecord": {"Name":"MTASTSRecord","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"ID","Docs":"","Typewords":["string"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Pair"]}]},
 	"Pair": {"Name":"Pair","Docs":"","Fields":[{"Name":"Key","Docs":"","Typewords":["string"]},{"Name":"Value","Docs":"","Typewords":["string"]}]},
 	"Policy": {"Name":"Policy","Docs":"","Fields":[{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MX","Docs":"","Typewords":["[]","STSMX"]},{"Name":"MaxAgeSeconds","Docs":"","Typewords":["int32"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Pair"]}]},
 	"STSMX": {"Name":"STSMX","Docs":"","Fields":[{"Name":"Wildcard","Docs":"","Typewords":["bool"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"SRVConfCheckResult": {"Name":"SRVConfCheckResult","Docs":"","Fields":[{"Name":"SRVs","Docs":"","Typewords":["{}","[]","SRV"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"SRV": {"Name":"SRV","Docs":"","Fields":[{"Name":"Target","Docs":"","Typewords":["string"]},{"Name":"Port","Docs":"","Typewords":["uint16"]},{"Name":"Priority","Docs":"","Typewords":["uint16"]},{"Name":"Weight","Docs":"","Typewords":["uint16"]}]},
-	"AutoconfCheckResult": {"Name":"AutoconfCheckResult","Docs":"","Fields":[{"Name":"ClientSettingsDomainIPs","Docs":"","Typewords":["[]","string"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
+	"AutoconfCheckResult": {"Name":"AutoconfCheckResult","Docs":"","Fields":[{"Name":"ClientSettingsDomainCNAME","Docs":"","Typewords":["string"]},{"Name":"ClientSettingsDomainIPs","Docs":"","Typewords":["[]","string"]},{"Name":"CNAME","Docs":"","Typewords":["string"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"AutodiscoverCheckResult": {"Name":"AutodiscoverCheckResult","Docs":"","Fields":[{"Name":"Records","Docs":"","Typewords":["[]","AutodiscoverSRV"]},{"Name":"Errors","Docs":"","Typewords":["[]","string"]},{"Name":"Warnings","Docs":"","Typewords":["[]","string"]},{"Name":"Instructions","Docs":"","Typewords":["[]","string"]}]},
 	"AutodiscoverSRV": {"Name":"AutodiscoverSRV","Docs":"","Fields":[{"Name":"Target","Docs":"","Typewords":["string"]},{"Name":"Port","Docs":"","Typewords":["uint16"]},{"Name":"Priority","Docs":"","Typewords":["uint16"]},{"Name":"Weight","Docs":"","Typewords":["uint16"]},{"Name":"IPs","Docs":"","Typewords":["[]","string"]}]},
 	"PolicyRecord": {"Name":"PolicyRecord","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Inserted","Docs":"","Typewords":["timestamp"]},{"Name":"ValidEnd","Docs":"","Typewords":["timestamp"]},{"Name":"LastUpdate","Docs":"","Typewords":["timestamp"]},{"Name":"LastUse","Docs":"","Typewords":["timestamp"]},{"Name":"Backoff","Docs":"","Typewords":["bool"]},{"Name":"RecordID","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]},{"Name":"Mode","Docs":"","Typewords":["Mode"]},{"Name":"MX","Docs":"","Typewords":["[]","STSMX"]},{"Name":"MaxAgeSeconds","Docs":"","Typewords":["int32"]},{"Name":"Extensions","Docs":"","Typewords":["[]","Pair"]},{"Name":"PolicyText","Docs":"","Typewords":["string"]}]},
@@ -828,10 +901,15 @@ export const types: TypenameMap = {
 	"SPFAuthResult": {"Name":"SPFAuthResult","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Scope","Docs":"","Typewords":["SPFDomainScope"]},{"Name":"Result","Docs":"","Typewords":["SPFResult"]}]},
 	"DMARCSummary": {"Name":"DMARCSummary","Docs":"","Fields":[{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"Total","Docs":"","Typewords":["int32"]},{"Name":"DispositionNone","Docs":"","Typewords":["int32"]},{"Name":"DispositionQuarantine","Docs":"","Typewords":["int32"]},{"Name":"DispositionReject","Docs":"","Typewords":["int32"]},{"Name":"DKIMFail","Docs":"","Typewords":["int32"]},{"Name":"SPFFail","Docs":"","Typewords":["int32"]},{"Name":"PolicyOverrides","Docs":"","Typewords":["{}","int32"]}]},
 	"Reverse": {"Name":"Reverse","Docs":"","Fields":[{"Name":"Hostnames","Docs":"","Typewords":["[]","string"]}]},
+	"DNSSyncResult": {"Name":"DNSSyncResult","Docs":"","Fields":[{"Name":"Remove","Docs":"","Typewords":["[]","string"]},{"Name":"Add","Docs":"","Typewords":["[]","string"]},{"Name":"Unchanged","Docs":"","Typewords":["[]","string"]},{"Name":"Skipped","Docs":"","Typewords":["[]","string"]}]},
+	"LoginAttempt": {"Name":"LoginAttempt","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Time","Docs":"","Typewords":["timestamp"]},{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"LoginAddress","Docs":"","Typewords":["string"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"LocalIP","Docs":"","Typewords":["string"]},{"Name":"TLS","Docs":"","Typewords":["string"]},{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"AuthMech","Docs":"","Typewords":["string"]},{"Name":"Result","Docs":"","Typewords":["string"]}]},
+	"Lockout": {"Name":"Lockout","Docs":"","Fields":[{"Name":"AccountName","Docs":"","Typewords":["string"]},{"Name":"Failures","Docs":"","Typewords":["int32"]},{"Name":"LastFailure","Docs":"","Typewords":["timestamp"]},{"Name":"Until","Docs":"","Typewords":["timestamp"]}]},
+	"DKIMRotation": {"Name":"DKIMRotation","Docs":"","Fields":[{"Name":"Started","Docs":"","Typewords":["timestamp"]},{"Name":"Phase","Docs":"","Typewords":["string"]},{"Name":"OldSelectors","Docs":"","Typewords":["[]","string"]},{"Name":"NewSelectors","Docs":"","Typewords":["[]","string"]},{"Name":"Records","Docs":"","Typewords":["[]","string"]},{"Name":"LastCheck","Docs":"","Typewords":["timestamp"]},{"Name":"LastCheckError","Docs":"","Typewords":["string"]},{"Name":"Switched","Docs":"","Typewords":["timestamp"]},{"Name":"GraceEnd","Docs":"","Typewords":["timestamp"]}]},
 	"ClientConfigs": {"Name":"ClientConfigs","Docs":"","Fields":[{"Name":"Entries","Docs":"","Typewords":["[]","ClientConfigsEntry"]}]},
 	"ClientConfigsEntry": {"Name":"ClientConfigsEntry","Docs":"","Fields":[{"Name":"Protocol","Docs":"","Typewords":["string"]},{"Name":"Host","Docs":"","Typewords":["Domain"]},{"Name":"Port","Docs":"","Typewords":["int32"]},{"Name":"Listener","Docs":"","Typewords":["string"]},{"Name":"Note","Docs":"","Typewords":["string"]}]},
 	"Msg": {"Name":"Msg","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Queued","Docs":"","Typewords":["timestamp"]},{"Name":"SenderAccount","Docs":"","Typewords":["string"]},{"Name":"SenderLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"SenderDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"RecipientLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"RecipientDomain","Docs":"","Typewords":["IPDomain"]},{"Name":"RecipientDomainStr","Docs":"","Typewords":["string"]},{"Name":"Attempts","Docs":"","Typewords":["int32"]},{"Name":"MaxAttempts","Docs":"","Typewords":["int32"]},{"Name":"DialedIPs","Docs":"","Typewords":["{}","[]","IP"]},{"Name":"NextAttempt","Docs":"","Typewords":["timestamp"]},{"Name":"LastAttempt","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"LastError","Docs":"","Typewords":["string"]},{"Name":"Has8bit","Docs":"","Typewords":["bool"]},{"Name":"SMTPUTF8","Docs":"","Typewords":["bool"]},{"Name":"IsDMARCReport","Docs":"","Typewords":["bool"]},{"Name":"IsTLSReport","Docs":"","Typewords":["bool"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"MsgPrefix","Docs":"","Typewords":["nullable","string"]},{"Name":"DSNUTF8","Docs":"","Typewords":["nullable","string"]},{"Name":"Transport","Docs":"","Typewords":["string"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]}]},
 	"IPDomain": {"Name":"IPDomain","Docs":"","Fields":[{"Name":"IP","Docs":"","Typewords":["IP"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
+	"Message": {"Name":"Message","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Received","Docs":"","Typewords":["timestamp"]},{"Name":"Reason","Docs":"","Typewords":["Reason"]},{"Name":"Detail","Docs":"","Typewords":["string"]},{"Name":"Account","Docs":"","Typewords":["string"]},{"Name":"RcptTo","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MsgFrom","Docs":"","Typewords":["string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"DigestSent","Docs":"","Typewords":["bool"]}]},
 	"WebserverConfig": {"Name":"WebserverConfig","Docs":"","Fields":[{"Name":"WebDNSDomainRedirects","Docs":"","Typewords":["[]","[]","Domain"]},{"Name":"WebDomainRedirects","Docs":"","Typewords":["[]","[]","string"]},{"Name":"WebHandlers","Docs":"","Typewords":["[]","WebHandler"]}]},
 	"WebHandler": {"Name":"WebHandler","Docs":"","Fields":[{"Name":"LogName","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["string"]},{"Name":"PathRegexp","Docs":"","Typewords":["string"]},{"Name":"DontRedirectPlainHTTP","Docs":"","Typewords":["bool"]},{"Name":"Compress","Docs":"","Typewords":["bool"]},{"Name":"WebStatic","Docs":"","Typewords":["nullable","WebStatic"]},{"Name":"WebRedirect","Docs":"","Typewords":["nullable","WebRedirect"]},{"Name":"WebForward","Docs":"","Typewords":["nullable","WebForward"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"DNSDomain","Docs":"","Typewords":["Domain"]}]},
 	"WebStatic": {"Name":"WebStatic","Docs":"","Fields":[{"Name":"StripPrefix","Docs":"","Typewords":["string"]},{"Name":"Root","Docs":"","Typewords":["string"]},{"Name":"ListFiles","Docs":"","Typewords":["bool"]},{"Name":"ContinueNotFound","Docs":"","Typewords":["bool"]},{"Name":"ResponseHeaders","Docs":"","Typewords":["{}","string"]}]},
@@ -862,6 +940,7 @@ export const types: TypenameMap = {
 	"SPFResult": {"Name":"SPFResult","Docs":"","Values":[{"Name":"SPFNone","Value":"none","Docs":""},{"Name":"SPFNeutral","Value":"neutral","Docs":""},{"Name":"SPFPass","Value":"pass","Docs":""},{"Name":"SPFFail","Value":"fail","Docs":""},{"Name":"SPFSoftfail","Value":"softfail","Docs":""},{"Name":"SPFTemperror","Value":"temperror","Docs":""},{"Name":"SPFPermerror","Value":"permerror","Docs":""}]},
 	"Localpart": {"Name":"Localpart","Docs":"","Values":null},
 	"IP": {"Name":"IP","Docs":"","Values":[]},
+	"Reason": {"Name":"Reason","Docs":"","Values":[{"Name":"ReasonDNSBL","Value":"dnsbl","Docs":""},{"Name":"ReasonJunk","Value":"junk","Docs":""},{"Name":"ReasonContentScan","Value":"contentscan","Docs":""},{"Name":"ReasonHold","Value":"hold","Docs":""}]},
 }
 
 export const parser = {
@@ -919,10 +998,15 @@ export const parser = {
 	SPFAuthResult: (v: any) => parse("SPFAuthResult", v) as SPFAuthResult,
 	DMARCSummary: (v: any) => parse("DMARCSummary", v) as DMARCSummary,
 	Reverse: (v: any) => parse("Reverse", v) as Reverse,
+	DNSSyncResult: (v: any) => parse("DNSSyncResult", v) as DNSSyncResult,
+	LoginAttempt: (v: any) => parse("LoginAttempt", v) as LoginAttempt,
+	Lockout: (v: any) => parse("Lockout", v) as Lockout,
+	DKIMRotation: (v: any) => parse("DKIMRotation", v) as DKIMRotation,
 	ClientConfigs: (v: any) => parse("ClientConfigs", v) as ClientConfigs,
 	ClientConfigsEntry: (v: any) => parse("ClientConfigsEntry", v) as ClientConfigsEntry,
 	Msg: (v: any) => parse("Msg", v) as Msg,
 	IPDomain: (v: any) => parse("IPDomain", v) as IPDomain,
+	Message: (v: any) => parse("Message", v) as Message,
 	WebserverConfig: (v: any) => parse("WebserverConfig", v) as WebserverConfig,
 	WebHandler: (v: any) => parse("WebHandler", v) as WebHandler,
 	WebStatic: (v: any) => parse("WebStatic", v) as WebStatic,
@@ -953,6 +1037,7 @@ export const parser = {
 	SPFResult: (v: any) => parse("SPFResult", v) as SPFResult,
 	Localpart: (v: any) => parse("Localpart", v) as Localpart,
 	IP: (v: any) => parse("IP", v) as IP,
+	Reason: (v: any) => parse("Reason", v) as Reason,
 }
 
 // Admin exports web API functions for the admin web interface. All its methods are
@@ -1192,6 +1277,17 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string[] | null
 	}
 
+	// DomainDNSSync compares the required DNS records for the domain with the records
+	// in DNS, and unless dryRun is set, updates DNS through the name server configured
+	// for dynamic updates.
+	async DomainDNSSync(domain: string, dryRun: boolean): Promise<DNSSyncResult> {
+		const fn: string = "DomainDNSSync"
+		const paramTypes: string[][] = [["string"],["bool"]]
+		const returnTypes: string[][] = [["DNSSyncResult"]]
+		const params: any[] = [domain, dryRun]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as DNSSyncResult
+	}
+
 	// DomainAdd adds a new domain and reloads the configuration.
 	async DomainAdd(domain: string, accountName: string, localpart: string): Promise<void> {
 		const fn: string = "DomainAdd"
@@ -1267,6 +1363,140 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// SetAccountRequireTOTP sets whether two-factor authentication with an
+	// authenticator app is required for web logins of the account.
+	async SetAccountRequireTOTP(accountName: string, require0: boolean): Promise<void> {
+		const fn: string = "SetAccountRequireTOTP"
+		const paramTypes: string[][] = [["string"],["bool"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, require0]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// AccountTOTPStatus returns whether two-factor authentication is enabled for the
+	// account, and the number of unused recovery codes.
+	async AccountTOTPStatus(accountName: string): Promise<[boolean, number]> {
+		const fn: string = "AccountTOTPStatus"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["bool"],["int32"]]
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [boolean, number]
+	}
+
+	// AccountTOTPReset removes two-factor authentication for the account, e.g. for a
+	// user who lost their authenticator app and recovery codes. If the account
+	// configuration requires two-factor authentication, the user must enroll again at
+	// the next login to the account web interface.
+	async AccountTOTPReset(accountName: string): Promise<void> {
+		const fn: string = "AccountTOTPReset"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// SetAccountLoginLockout sets the number of consecutive failed authentication
+	// attempts after which authentication for the account is blocked, and for how many
+	// minutes. A zero maxFailures disables blocking for the account.
+	async SetAccountLoginLockout(accountName: string, maxFailures: number, periodMinutes: number): Promise<void> {
+		const fn: string = "SetAccountLoginLockout"
+		const paramTypes: string[][] = [["string"],["int32"],["int32"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName, maxFailures, periodMinutes]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// LoginAttempts returns the most recent authentication attempts for an account,
+	// or for all accounts and unknown users if accountName is empty, newest first.
+	async LoginAttempts(accountName: string, limit: number): Promise<LoginAttempt[] | null> {
+		const fn: string = "LoginAttempts"
+		const paramTypes: string[][] = [["string"],["int32"]]
+		const returnTypes: string[][] = [["[]","LoginAttempt"]]
+		const params: any[] = [accountName, limit]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as LoginAttempt[] | null
+	}
+
+	// LoginBlocks returns the accounts for which authentication is blocked after too
+	// many consecutive failed attempts, and the IPs and subnets that are currently
+	// rate limited after failed authentication attempts.
+	async LoginBlocks(): Promise<[Lockout[] | null, string[] | null]> {
+		const fn: string = "LoginBlocks"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","Lockout"],["[]","string"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [Lockout[] | null, string[] | null]
+	}
+
+	// LoginLockoutRemove unblocks authentication for an account.
+	async LoginLockoutRemove(accountName: string): Promise<void> {
+		const fn: string = "LoginLockoutRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [accountName]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// LoginIPBlockRemove clears the failed authentication attempts for an IP or
+	// subnet, as returned by LoginBlocks, so it is no longer rate limited.
+	async LoginIPBlockRemove(ipNet: string): Promise<void> {
+		const fn: string = "LoginIPBlockRemove"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ipNet]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// DKIMRotation returns the DKIM key rotation in progress for domain, or nil if
+	// there is none.
+	async DKIMRotation(domain: string): Promise<DKIMRotation | null> {
+		const fn: string = "DKIMRotation"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["nullable","DKIMRotation"]]
+		const params: any[] = [domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as DKIMRotation | null
+	}
+
+	// DKIMRotationStart starts a DKIM key rotation for domain, generating new
+	// selectors for those currently used for signing. After switching to the new
+	// selectors, the old selectors must remain published for graceDays days.
+	async DKIMRotationStart(domain: string, graceDays: number): Promise<void> {
+		const fn: string = "DKIMRotationStart"
+		const paramTypes: string[][] = [["string"],["int32"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domain, graceDays]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// DKIMRotationCheck checks DNS for the records of the new selectors of a DKIM
+	// key rotation, switching signing to the new selectors if all are found.
+	async DKIMRotationCheck(domain: string): Promise<void> {
+		const fn: string = "DKIMRotationCheck"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// DKIMRotationFinish finishes a DKIM key rotation after its grace period,
+	// removing the old selectors from the configuration.
+	async DKIMRotationFinish(domain: string): Promise<void> {
+		const fn: string = "DKIMRotationFinish"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// DKIMRotationCancel cancels a DKIM key rotation that is still waiting for its
+	// DNS records, removing the new selectors from the configuration.
+	async DKIMRotationCancel(domain: string): Promise<void> {
+		const fn: string = "DKIMRotationCancel"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [domain]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// ClientConfigsDomain returns configurations for email clients, IMAP and
 	// Submission (SMTP) for the domain.
 	async ClientConfigsDomain(domain: string): Promise<ClientConfigs> {
@@ -1324,6 +1554,47 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// QuarantineList returns messages in the quarantine, most recent first. Only
+	// messages matching the non-empty account, reason and search text (a substring
+	// of the SMTP MAIL FROM, message From, RCPT TO or subject) are returned, at most
+	// limit if greater than zero.
+	async QuarantineList(account: string, reason: string, search: string, limit: number): Promise<Message[] | null> {
+		const fn: string = "QuarantineList"
+		const paramTypes: string[][] = [["string"],["string"],["string"],["int32"]]
+		const returnTypes: string[][] = [["[]","Message"]]
+		const params: any[] = [account, reason, search, limit]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Message[] | null
+	}
+
+	// QuarantineHeaders returns the header section of a quarantined message.
+	async QuarantineHeaders(id: number): Promise<string> {
+		const fn: string = "QuarantineHeaders"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["string"]]
+		const params: any[] = [id]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as string
+	}
+
+	// QuarantineRelease delivers quarantined messages to the accounts of their
+	// recipients, and removes them from the quarantine. If train is set, the junk
+	// filters of the accounts are trained with the messages as non-junk.
+	async QuarantineRelease(ids: number[] | null, train: boolean): Promise<void> {
+		const fn: string = "QuarantineRelease"
+		const paramTypes: string[][] = [["[]","int64"],["bool"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ids, train]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// QuarantineDelete removes messages from the quarantine.
+	async QuarantineDelete(ids: number[] | null): Promise<void> {
+		const fn: string = "QuarantineDelete"
+		const paramTypes: string[][] = [["[]","int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [ids]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// LogLevels returns the current log levels.
 	async LogLevels(): Promise<{ [key: string]: string }> {
 		const fn: string = "LogLevels"
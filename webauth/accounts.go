@@ -15,7 +15,7 @@ var Accounts SessionAuth = accountSessionAuth{}
 type accountSessionAuth struct{}
 
 func (accountSessionAuth) login(ctx context.Context, log mlog.Log, username, password string) (bool, string, error) {
-	acc, err := store.OpenEmailAuth(log, username, password)
+	acc, err := store.OpenEmailAuth(log, username, password, true)
 	if err != nil && errors.Is(err, store.ErrUnknownCredentials) {
 		return false, "", nil
 	} else if err != nil {
@@ -0,0 +1,57 @@
+package webauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mjl-/sherpa"
+
+	"github.com/qompassai/beacon/beacon-"
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/store"
+)
+
+// checkTOTP verifies the second authentication factor for an account after its
+// password was verified. It returns the authentication result for metrics, and a
+// *sherpa.Error for user errors.
+//
+// If the account has TOTP enabled and totpCode is empty, error code
+// "user:totpRequired" is returned, for the frontend to ask for a code and retry
+// the login. If the account configuration requires TOTP but the user has not yet
+// enrolled, logins are only allowed for the account web interface, where the user
+// can enroll, and error code "user:totpEnrollRequired" is returned otherwise.
+func checkTOTP(ctx context.Context, log mlog.Log, kind, accountName, totpCode string) (authResult string, rerr error) {
+	acc, err := store.OpenAccount(log, accountName)
+	if err != nil {
+		return "error", fmt.Errorf("open account: %v", err)
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	enabled, _, err := acc.TOTPStatus(ctx)
+	if err != nil {
+		return "error", fmt.Errorf("get two-factor authentication status: %v", err)
+	}
+	if !enabled {
+		accConf, _ := beacon.Conf.Account(accountName)
+		if accConf.RequireTOTP && kind != "webaccount" {
+			return "totpenroll", &sherpa.Error{Code: "user:totpEnrollRequired", Message: "two-factor authentication is required for this account, first enroll an authenticator app in the account web interface"}
+		}
+		return "ok", nil
+	}
+
+	if totpCode == "" {
+		return "totprequired", &sherpa.Error{Code: "user:totpRequired", Message: "two-factor authentication code required"}
+	}
+	if err := acc.TOTPVerify(ctx, log, totpCode); errors.Is(err, store.ErrTOTPInvalid) {
+		time.Sleep(BadAuthDelay)
+		return "badtotp", &sherpa.Error{Code: "user:loginFailed", Message: "invalid two-factor authentication code"}
+	} else if err != nil {
+		return "error", fmt.Errorf("verifying two-factor authentication code: %v", err)
+	}
+	return "ok", nil
+}
@@ -47,6 +47,7 @@ import (
 
 	"github.com/mjl-/sherpa"
 
+	"github.com/qompassai/beacon/loginattempt"
 	"github.com/qompassai/beacon/metrics"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
@@ -216,9 +217,15 @@ func LoginPrep(ctx context.Context, log mlog.Log, kind, cookiePath string, isFor
 // credentials through sessionAuth, and setting a session token cookie on the HTTP
 // response and returning the associated CSRF token.
 //
+// For accounts with two-factor authentication enabled, totpCode must hold a code
+// from the authenticator app or a recovery code. Admin logins pass an empty
+// totpCode.
+//
 // In case of a user error, a *sherpa.Error is returned that sherpa handlers can
-// pass to panic. For bad credentials, the error code is "user:loginFailed".
-func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, cookiePath string, isForwarded bool, w http.ResponseWriter, r *http.Request, loginToken, username, password string) (store.CSRFToken, error) {
+// pass to panic. For bad credentials, the error code is "user:loginFailed". When a
+// two-factor authentication code is needed but missing, the error code is
+// "user:totpRequired".
+func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, cookiePath string, isForwarded bool, w http.ResponseWriter, r *http.Request, loginToken, username, password, totpCode string) (store.CSRFToken, error) {
 	loginCookie, _ := r.Cookie(kind + "login")
 	if loginCookie == nil || loginCookie.Value != loginToken {
 		return "", &sherpa.Error{Code: "user:error", Message: "missing login token"}
@@ -234,19 +241,51 @@ func Login(ctx context.Context, log mlog.Log, sessionAuth SessionAuth, kind, coo
 		return "", &sherpa.Error{Code: "user:error", Message: "too many authentication attempts"}
 	}
 
-	valid, accountName, err := sessionAuth.login(ctx, log, username, password)
+	// Check for a lockout before verifying the password, responding as for bad
+	// credentials, so attempts during a lockout don't reveal whether a password is
+	// correct.
+	locked, err := loginattempt.LockedLogin(ctx, "", username)
+	var valid bool
+	var accountName string
+	if err == nil && !locked {
+		valid, accountName, err = sessionAuth.login(ctx, log, username, password)
+	}
 	var authResult string
 	defer func() {
 		metrics.AuthenticationInc(kind, "weblogin", authResult)
+		var localIP string
+		if a, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+			localIP = a.IP.String()
+		}
+		loginattempt.Record(ctx, log, loginattempt.LoginAttempt{
+			AccountName:  accountName,
+			LoginAddress: username,
+			RemoteIP:     ip.String(),
+			LocalIP:      localIP,
+			TLS:          loginattempt.TLSInfo(r.TLS),
+			Protocol:     kind,
+			AuthMech:     "weblogin",
+			Result:       authResult,
+		})
 	}()
 	if err != nil {
 		authResult = "error"
 		return "", fmt.Errorf("evaluating login attempt: %v", err)
+	} else if locked {
+		time.Sleep(BadAuthDelay)
+		authResult = "locked"
+		return "", &sherpa.Error{Code: "user:loginFailed", Message: "invalid credentials"}
 	} else if !valid {
 		time.Sleep(BadAuthDelay)
 		authResult = "badcreds"
 		return "", &sherpa.Error{Code: "user:loginFailed", Message: "invalid credentials"}
 	}
+	if accountName != "" {
+		authResult, err = checkTOTP(ctx, log, kind, accountName, totpCode)
+		if err != nil {
+			return "", err
+		}
+	}
 	authResult = "ok"
 	beacon.LimiterFailedAuth.Reset(ip, start)
 
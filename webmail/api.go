@@ -15,6 +15,7 @@ import (
 	"net/mail"
 	"net/textproto"
 	"os"
+	"regexp"
 	"runtime/debug"
 	"sort"
 	"strings"
@@ -25,16 +26,20 @@ import (
 
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slog"
+	"golang.org/x/net/html"
 
 	"github.com/mjl-/bstore"
 	"github.com/mjl-/sherpa"
 	"github.com/mjl-/sherpadoc"
 	"github.com/mjl-/sherpaprom"
 
+	"github.com/qompassai/beacon/config"
 	"github.com/qompassai/beacon/dkim"
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/junk"
 	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/metrics"
+	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
 	"github.com/qompassai/beacon/beaconio"
 	"github.com/qompassai/beacon/beaconvar"
@@ -44,6 +49,7 @@ import (
 	"github.com/qompassai/beacon/smtp"
 	"github.com/qompassai/beacon/smtpclient"
 	"github.com/qompassai/beacon/store"
+	"github.com/qompassai/beacon/vcard"
 	"github.com/qompassai/beacon/webauth"
 )
 
@@ -103,12 +109,14 @@ func (w Webmail) LoginPrep(ctx context.Context) string {
 }
 
 // Login returns a session token for the credentials, or fails with error code
-// "user:badLogin". Call LoginPrep to get a loginToken.
-func (w Webmail) Login(ctx context.Context, loginToken, username, password string) store.CSRFToken {
+// "user:badLogin". Call LoginPrep to get a loginToken. If two-factor
+// authentication is enabled for the account and totpCode is empty, the call fails
+// with error code "user:totpRequired", and should be repeated with a totpCode.
+func (w Webmail) Login(ctx context.Context, loginToken, username, password, totpCode string) store.CSRFToken {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 
-	csrfToken, err := webauth.Login(ctx, log, webauth.Accounts, "webmail", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password)
+	csrfToken, err := webauth.Login(ctx, log, webauth.Accounts, "webmail", w.cookiePath, w.isForwarded, reqInfo.Response, reqInfo.Request, loginToken, username, password, totpCode)
 	if _, ok := err.(*sherpa.Error); ok {
 		panic(err)
 	}
@@ -197,7 +205,8 @@ type SubmitMessage struct {
 	Cc                 []string
 	Bcc                []string
 	Subject            string
-	TextBody           string
+	TextBody           string // Ignored if HTMLBody is set.
+	HTMLBody           string // If set, a text part is generated from the sanitized HTML, and data: URIs of images are sent as inline parts.
 	Attachments        []File
 	ForwardAttachments ForwardAttachments
 	IsForward          bool
@@ -205,6 +214,8 @@ type SubmitMessage struct {
 	ReplyTo            string // If non-empty, Reply-To header to add to message.
 	UserAgent          string // User-Agent header added if not empty.
 	RequireTLS         *bool  // For "Require TLS" extension during delivery.
+	DraftMessageID     int64  // If set, previous version of this message as draft, removed when the message is submitted or saved as new draft.
+	SubmitID           string // Optional client-generated ID, unique per composed message. A message with an ID that was already submitted is not sent again.
 }
 
 // ForwardAttachments references attachments by a list of message.Part paths.
@@ -265,17 +276,32 @@ func xmessageID(ctx context.Context, tx *bstore.Tx, messageID int64) store.Messa
 	return m
 }
 
-// MessageSubmit sends a message by submitting it the outgoing email queue. The
-// message is sent to all addresses listed in the To, Cc and Bcc addresses, without
-// Bcc message header.
-//
-// If a Sent mailbox is configured, messages are added to it after submitting
-// to the delivery queue.
-func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
-	// Similar between ../smtpserver/server.go:/submit\( and ../webmail/webmail.go:/MessageSubmit\(
+// xcomposeRecover turns panics from a message.Composer into sherpa errors. Must
+// be called with defer.
+func xcomposeRecover(ctx context.Context) {
+	x := recover()
+	if x == nil {
+		return
+	}
+	if err, ok := x.(error); ok && errors.Is(err, message.ErrMessageSize) {
+		xcheckuserf(ctx, err, "making message")
+	} else if ok && errors.Is(err, message.ErrCompose) {
+		xcheckf(ctx, err, "making message")
+	}
+	panic(x)
+}
 
-	// todo: consider making this an HTTP POST, so we can upload as regular form, which is probably more efficient for encoding for the client and we can stream the data in.
+// submitAddresses are the parsed addresses of a SubmitMessage.
+type submitAddresses struct {
+	from    message.NameAddress
+	replyTo *message.NameAddress // Nil if absent.
+	to      []message.NameAddress
+	cc      []message.NameAddress
+	bcc     []message.NameAddress
+}
 
+// xparseSubmitAddresses checks the header values of m and parses its addresses.
+func xparseSubmitAddresses(ctx context.Context, m SubmitMessage) (addrs submitAddresses) {
 	// Prevent any accidental control characters, or attempts at getting bare \r or \n
 	// into messages.
 	for _, l := range [][]string{m.To, m.Cc, m.Bcc, {m.From, m.Subject, m.ReplyTo, m.UserAgent}} {
@@ -288,152 +314,51 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		}
 	}
 
-	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
-	log := pkglog.WithContext(ctx).With(slog.String("account", reqInfo.AccountName))
-	acc, err := store.OpenAccount(log, reqInfo.AccountName)
-	xcheckf(ctx, err, "open account")
-	defer func() {
-		err := acc.Close()
-		log.Check(err, "closing account")
-	}()
-
-	log.Debug("message submit")
-
-	fromAddr, err := parseAddress(m.From)
+	var err error
+	addrs.from, err = parseAddress(m.From)
 	xcheckuserf(ctx, err, "parsing From address")
 
-	var replyTo *message.NameAddress
 	if m.ReplyTo != "" {
 		a, err := parseAddress(m.ReplyTo)
 		xcheckuserf(ctx, err, "parsing Reply-To address")
-		replyTo = &a
-	}
-
-	var recipients []smtp.Address
-
-	var toAddrs []message.NameAddress
-	for _, s := range m.To {
-		addr, err := parseAddress(s)
-		xcheckuserf(ctx, err, "parsing To address")
-		toAddrs = append(toAddrs, addr)
-		recipients = append(recipients, addr.Address)
-	}
-
-	var ccAddrs []message.NameAddress
-	for _, s := range m.Cc {
-		addr, err := parseAddress(s)
-		xcheckuserf(ctx, err, "parsing Cc address")
-		ccAddrs = append(ccAddrs, addr)
-		recipients = append(recipients, addr.Address)
-	}
-
-	for _, s := range m.Bcc {
-		addr, err := parseAddress(s)
-		xcheckuserf(ctx, err, "parsing Bcc address")
-		recipients = append(recipients, addr.Address)
-	}
-
-	// Check if from address is allowed for account.
-	fromAccName, _, _, err := beacon.FindAccount(fromAddr.Address.Localpart, fromAddr.Address.Domain, false)
-	if err == nil && fromAccName != reqInfo.AccountName {
-		err = beacon.ErrAccountNotFound
-	}
-	if err != nil && (errors.Is(err, beacon.ErrAccountNotFound) || errors.Is(err, beacon.ErrDomainNotFound)) {
-		metricSubmission.WithLabelValues("badfrom").Inc()
-		xcheckuserf(ctx, errors.New("address not found"), "looking from address for account")
-	}
-	xcheckf(ctx, err, "checking if from address is allowed")
-
-	if len(recipients) == 0 {
-		xcheckuserf(ctx, fmt.Errorf("no recipients"), "composing message")
-	}
-
-	// Check outgoing message rate limit.
-	xdbread(ctx, acc, func(tx *bstore.Tx) {
-		rcpts := make([]smtp.Path, len(recipients))
-		for i, r := range recipients {
-			rcpts[i] = smtp.Path{Localpart: r.Localpart, IPDomain: dns.IPDomain{Domain: r.Domain}}
-		}
-		msglimit, rcptlimit, err := acc.SendLimitReached(tx, rcpts)
-		if msglimit >= 0 {
-			metricSubmission.WithLabelValues("messagelimiterror").Inc()
-			xcheckuserf(ctx, errors.New("send message limit reached"), "checking outgoing rate limit")
-		} else if rcptlimit >= 0 {
-			metricSubmission.WithLabelValues("recipientlimiterror").Inc()
-			xcheckuserf(ctx, errors.New("send message limit reached"), "checking outgoing rate limit")
-		}
-		xcheckf(ctx, err, "checking send limit")
-	})
-
-	has8bit := false // We update this later on.
-
-	// We only use smtputf8 if we have to, with a utf-8 localpart. For IDNA, we use ASCII domains.
-	smtputf8 := false
-	for _, a := range recipients {
-		if a.Localpart.IsInternational() {
-			smtputf8 = true
-			break
-		}
-	}
-	if !smtputf8 && fromAddr.Address.Localpart.IsInternational() {
-		// todo: may want to warn user that they should consider sending with a ascii-only localpart, in case receiver doesn't support smtputf8.
-		smtputf8 = true
+		addrs.replyTo = &a
 	}
 
-	// Create file to compose message into.
-	dataFile, err := store.CreateMessageTemp(log, "webmail-submit")
-	xcheckf(ctx, err, "creating temporary file for message")
-	defer store.CloseRemoveTempFile(log, dataFile, "message to submit")
-
-	// If writing to the message file fails, we abort immediately.
-	xc := message.NewComposer(dataFile, w.maxMessageSize)
-	defer func() {
-		x := recover()
-		if x == nil {
-			return
-		}
-		if err, ok := x.(error); ok && errors.Is(err, message.ErrMessageSize) {
-			xcheckuserf(ctx, err, "making message")
-		} else if ok && errors.Is(err, message.ErrCompose) {
-			xcheckf(ctx, err, "making message")
-		}
-		panic(x)
-	}()
-
-	// todo spec: can we add an Authentication-Results header that indicates this is an authenticated message? the "auth" method is for SMTP AUTH, which this isn't. ../rfc/8601 https://www.iana.org/assignments/email-auth/email-auth.xhtml
-
-	// Each queued message gets a Received header.
-	// We don't have access to the local IP for adding.
-	// We cannot use VIA, because there is no registered method. We would like to use
-	// it to add the ascii domain name in case of smtputf8 and IDNA host name.
-	recvFrom := message.HeaderCommentDomain(beacon.Conf.Static.HostnameDomain, smtputf8)
-	recvBy := beacon.Conf.Static.HostnameDomain.XName(smtputf8)
-	recvID := beacon.ReceivedID(beacon.CidFromCtx(ctx))
-	recvHdrFor := func(rcptTo string) string {
-		recvHdr := &message.HeaderWriter{}
-		// For additional Received-header clauses, see:
-		// https://www.iana.org/assignments/mail-parameters/mail-parameters.xhtml#table-mail-parameters-8
-		// Note: we don't have "via" or "with", there is no registered for webmail.
-		recvHdr.Add(" ", "Received:", "from", recvFrom, "by", recvBy, "id", recvID) // ../rfc/5321:3158
-		if reqInfo.Request.TLS != nil {
-			recvHdr.Add(" ", beacon.TLSReceivedComment(log, *reqInfo.Request.TLS)...)
+	xparse := func(l []string, hdr string) (r []message.NameAddress) {
+		for _, s := range l {
+			addr, err := parseAddress(s)
+			xcheckuserf(ctx, err, "parsing %s address", hdr)
+			r = append(r, addr)
 		}
-		recvHdr.Add(" ", "for", "<"+rcptTo+">;", time.Now().Format(message.RFC5322Z))
-		return recvHdr.String()
+		return r
 	}
+	addrs.to = xparse(m.To, "To")
+	addrs.cc = xparse(m.Cc, "Cc")
+	addrs.bcc = xparse(m.Bcc, "Bcc")
+	return
+}
 
+// xcomposeMessage writes headers and body of m to xc, for either submission or
+// for storing as draft. Bcc addresses are only included in the message headers
+// for drafts. If calendarReply is set, it is added to the body as text/calendar
+// alternative. Errors from writing to xc cause a panic that the caller must
+// handle.
+func xcomposeMessage(ctx context.Context, log mlog.Log, acc *store.Account, xc *message.Composer, m SubmitMessage, addrs submitAddresses, messageID string, draft bool, calendarReply string) {
 	// Outer message headers.
-	xc.HeaderAddrs("From", []message.NameAddress{fromAddr})
-	if replyTo != nil {
-		xc.HeaderAddrs("Reply-To", []message.NameAddress{*replyTo})
+	xc.HeaderAddrs("From", []message.NameAddress{addrs.from})
+	if addrs.replyTo != nil {
+		xc.HeaderAddrs("Reply-To", []message.NameAddress{*addrs.replyTo})
+	}
+	xc.HeaderAddrs("To", addrs.to)
+	xc.HeaderAddrs("Cc", addrs.cc)
+	if draft {
+		// Bcc recipients are only kept in drafts, never in submitted messages.
+		xc.HeaderAddrs("Bcc", addrs.bcc)
 	}
-	xc.HeaderAddrs("To", toAddrs)
-	xc.HeaderAddrs("Cc", ccAddrs)
 	if m.Subject != "" {
 		xc.Subject(m.Subject)
 	}
 
-	messageID := fmt.Sprintf("<%s>", beacon.MessageIDGen(smtputf8))
 	xc.Header("Message-Id", messageID)
 	xc.Header("Date", time.Now().Format(message.RFC5322Z))
 	// Add In-Reply-To and References headers.
@@ -473,20 +398,27 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 	}
 	xc.Header("MIME-Version", "1.0")
 
+	// The body is a single text part, or a multipart/alternative with a text part
+	// generated from the HTML part.
+	textBody := m.TextBody
+	var htmlNode *html.Node
+	var images []inlineImage
+	if m.HTMLBody != "" {
+		var err error
+		htmlNode, images, err = composeHTML(m.HTMLBody)
+		xcheckuserf(ctx, err, "parsing html body")
+		textBody = htmlText(htmlNode)
+	}
+	bodyHdr, xwriteBody := xcomposeBody(ctx, xc, textBody, htmlNode, images, calendarReply)
+
 	if len(m.Attachments) > 0 || len(m.ForwardAttachments.Paths) > 0 {
 		mp := multipart.NewWriter(xc)
 		xc.Header("Content-Type", fmt.Sprintf(`multipart/mixed; boundary="%s"`, mp.Boundary()))
 		xc.Line()
 
-		textBody, ct, cte := xc.TextPart(m.TextBody)
-		textHdr := textproto.MIMEHeader{}
-		textHdr.Set("Content-Type", ct)
-		textHdr.Set("Content-Transfer-Encoding", cte)
-
-		textp, err := mp.CreatePart(textHdr)
-		xcheckf(ctx, err, "adding text part to message")
-		_, err = textp.Write(textBody)
-		xcheckf(ctx, err, "writing text part")
+		bodyp, err := mp.CreatePart(bodyHdr)
+		xcheckf(ctx, err, "adding body part to message")
+		xwriteBody(bodyp)
 
 		xaddPart := func(ct, filename string) io.Writer {
 			ahdr := textproto.MIMEHeader{}
@@ -500,23 +432,6 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 			return ap
 		}
 
-		xaddAttachmentBase64 := func(ct, filename string, base64Data []byte) {
-			ap := xaddPart(ct, filename)
-
-			for len(base64Data) > 0 {
-				line := base64Data
-				n := len(line)
-				if n > 78 {
-					n = 78
-				}
-				line, base64Data = base64Data[:n], base64Data[n:]
-				_, err := ap.Write(line)
-				xcheckf(ctx, err, "writing attachment")
-				_, err = ap.Write([]byte("\r\n"))
-				xcheckf(ctx, err, "writing attachment")
-			}
-		}
-
 		xaddAttachment := func(ct, filename string, r io.Reader) {
 			ap := xaddPart(ct, filename)
 			wc := beaconio.Base64Writer(ap)
@@ -527,20 +442,8 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		}
 
 		for _, a := range m.Attachments {
-			s := a.DataURI
-			if !strings.HasPrefix(s, "data:") {
-				xcheckuserf(ctx, errors.New("missing data: in datauri"), "parsing attachment")
-			}
-			s = s[len("data:"):]
-			t := strings.SplitN(s, ",", 2)
-			if len(t) != 2 {
-				xcheckuserf(ctx, errors.New("missing comma in datauri"), "parsing attachment")
-			}
-			if !strings.HasSuffix(t[0], "base64") {
-				xcheckuserf(ctx, errors.New("missing base64 in datauri"), "parsing attachment")
-			}
-			ct := strings.TrimSuffix(t[0], "base64")
-			ct = strings.TrimSuffix(ct, ";")
+			ct, data, err := parseDataURI(a.DataURI)
+			xcheckuserf(ctx, err, "parsing attachment")
 			if ct == "" {
 				ct = "application/octet-stream"
 			}
@@ -551,11 +454,7 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 			params := map[string]string{"name": filename}
 			ct = mime.FormatMediaType(ct, params)
 
-			// Ensure base64 is valid, then we'll write the original string.
-			_, err := io.Copy(io.Discard, base64.NewDecoder(base64.StdEncoding, strings.NewReader(t[1])))
-			xcheckuserf(ctx, err, "parsing attachment as base64")
-
-			xaddAttachmentBase64(ct, filename, []byte(t[1]))
+			xwriteBase64Lines(ctx, xaddPart(ct, filename), data)
 		}
 
 		if len(m.ForwardAttachments.Paths) > 0 {
@@ -599,117 +498,513 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 		err = mp.Close()
 		xcheckf(ctx, err, "writing mime multipart")
 	} else {
-		textBody, ct, cte := xc.TextPart(m.TextBody)
-		xc.Header("Content-Type", ct)
-		xc.Header("Content-Transfer-Encoding", cte)
+		for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if v := bodyHdr.Get(k); v != "" {
+				xc.Header(k, v)
+			}
+		}
 		xc.Line()
-		xc.Write([]byte(textBody))
+		xwriteBody(xc)
 	}
 
 	xc.Flush()
+}
 
-	// Add DKIM-Signature headers.
-	var msgPrefix string
-	fd := fromAddr.Address.Domain
-	confDom, _ := beacon.Conf.Domain(fd)
-	selectors := beacon.DKIMSelectors(confDom.DKIM)
-	if len(selectors) > 0 {
-		dkimHeaders, err := dkim.Sign(ctx, log.Logger, fromAddr.Address.Localpart, fd, selectors, smtputf8, dataFile)
-		if err != nil {
-			metricServerErrors.WithLabelValues("dkimsign").Inc()
-		}
-		xcheckf(ctx, err, "sign dkim")
+// xcomposeBody returns the headers for the message body and a function that
+// writes the body. Without HTML, the body is a single text part. With HTML, the
+// body is a multipart/alternative with the text and HTML parts, the HTML part in
+// a multipart/related with the inline images, if any. A calendar reply is added
+// as last alternative, as expected for iMIP.
+func xcomposeBody(ctx context.Context, xc *message.Composer, textBody string, htmlNode *html.Node, images []inlineImage, calendarReply string) (textproto.MIMEHeader, func(w io.Writer)) {
+	xwritePart := func(mp *multipart.Writer, hdr textproto.MIMEHeader, body []byte) {
+		p, err := mp.CreatePart(hdr)
+		xcheckf(ctx, err, "adding part to message")
+		_, err = p.Write(body)
+		xcheckf(ctx, err, "writing part")
+	}
 
-		msgPrefix = dkimHeaders
+	text, ct, cte := xc.TextPart(textBody)
+	textHdr := textproto.MIMEHeader{}
+	textHdr.Set("Content-Type", ct)
+	textHdr.Set("Content-Transfer-Encoding", cte)
+	if htmlNode == nil && calendarReply == "" {
+		return textHdr, func(w io.Writer) {
+			_, err := w.Write(text)
+			xcheckf(ctx, err, "writing text body")
+		}
 	}
 
-	fromPath := smtp.Path{
-		Localpart: fromAddr.Address.Localpart,
-		IPDomain:  dns.IPDomain{Domain: fromAddr.Address.Domain},
+	var htmlBody, calBody []byte
+	htmlHdr := textproto.MIMEHeader{}
+	if htmlNode != nil {
+		var sb strings.Builder
+		err := html.Render(&sb, htmlNode)
+		xcheckf(ctx, err, "rendering html body")
+		htmlBody, ct, cte = xc.HTMLPart(sb.String())
+		htmlHdr.Set("Content-Type", ct)
+		htmlHdr.Set("Content-Transfer-Encoding", cte)
 	}
-	for _, rcpt := range recipients {
-		rcptMsgPrefix := recvHdrFor(rcpt.Pack(smtputf8)) + msgPrefix
-		msgSize := int64(len(rcptMsgPrefix)) + xc.Size
-		toPath := smtp.Path{
-			Localpart: rcpt.Localpart,
-			IPDomain:  dns.IPDomain{Domain: rcpt.Domain},
+	calHdr := textproto.MIMEHeader{}
+	if calendarReply != "" {
+		calBody, ct, cte = xc.CalendarPart(calendarReply, "REPLY")
+		calHdr.Set("Content-Type", ct)
+		calHdr.Set("Content-Transfer-Encoding", cte)
+	}
+
+	// Boundaries are generated before writing, they are needed in the headers.
+	altBoundary := multipart.NewWriter(io.Discard).Boundary()
+	relBoundary := multipart.NewWriter(io.Discard).Boundary()
+	bodyHdr := textproto.MIMEHeader{}
+	bodyHdr.Set("Content-Type", fmt.Sprintf(`multipart/alternative; boundary="%s"`, altBoundary))
+
+	return bodyHdr, func(w io.Writer) {
+		mp := multipart.NewWriter(w)
+		err := mp.SetBoundary(altBoundary)
+		xcheckf(ctx, err, "setting multipart boundary")
+		xwritePart(mp, textHdr, text)
+
+		if htmlNode != nil && len(images) == 0 {
+			xwritePart(mp, htmlHdr, htmlBody)
+		} else if htmlNode != nil {
+			relHdr := textproto.MIMEHeader{}
+			relHdr.Set("Content-Type", fmt.Sprintf(`multipart/related; boundary="%s"; type="text/html"`, relBoundary))
+			relp, err := mp.CreatePart(relHdr)
+			xcheckf(ctx, err, "adding related part to message")
+			rmp := multipart.NewWriter(relp)
+			err = rmp.SetBoundary(relBoundary)
+			xcheckf(ctx, err, "setting multipart boundary")
+			xwritePart(rmp, htmlHdr, htmlBody)
+
+			for _, img := range images {
+				ihdr := textproto.MIMEHeader{}
+				ihdr.Set("Content-Type", mime.FormatMediaType(img.contentType, map[string]string{"name": img.filename}))
+				ihdr.Set("Content-Transfer-Encoding", "base64")
+				ihdr.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": img.filename}))
+				ihdr.Set("Content-Id", "<"+img.cid+">")
+				ip, err := rmp.CreatePart(ihdr)
+				xcheckf(ctx, err, "adding image part to message")
+				xwriteBase64Lines(ctx, ip, img.base64Data)
+			}
+			err = rmp.Close()
+			xcheckf(ctx, err, "writing mime multipart")
 		}
-		qm := queue.MakeMsg(reqInfo.AccountName, fromPath, toPath, has8bit, smtputf8, msgSize, messageID, []byte(rcptMsgPrefix), m.RequireTLS)
-		err := queue.Add(ctx, log, &qm, dataFile)
-		if err != nil {
-			metricSubmission.WithLabelValues("queueerror").Inc()
+		if calendarReply != "" {
+			xwritePart(mp, calHdr, calBody)
 		}
-		xcheckf(ctx, err, "adding message to the delivery queue")
-		metricSubmission.WithLabelValues("ok").Inc()
+		err = mp.Close()
+		xcheckf(ctx, err, "writing mime multipart")
 	}
+}
 
-	var modseq store.ModSeq // Only set if needed.
+// xwriteBase64Lines writes already base64-encoded data in lines of at most 78
+// characters.
+func xwriteBase64Lines(ctx context.Context, w io.Writer, base64Data string) {
+	for len(base64Data) > 0 {
+		line := base64Data
+		n := len(line)
+		if n > 78 {
+			n = 78
+		}
+		line, base64Data = base64Data[:n], base64Data[n:]
+		_, err := io.WriteString(w, line+"\r\n")
+		xcheckf(ctx, err, "writing base64 data")
+	}
+}
 
-	// Append message to Sent mailbox and mark original messages as answered/forwarded.
-	acc.WithRLock(func() {
-		var changes []store.Change
+// MessageSubmit sends a message by submitting it the outgoing email queue. The
+// message is sent to all addresses listed in the To, Cc and Bcc addresses, without
+// Bcc message header.
+//
+// If a Sent mailbox is configured, messages are added to it after submitting
+// to the delivery queue.
+//
+// If From is empty, the default From address from the settings is used, or the
+// login address if no default is configured.
+//
+// If the account has a send delay configured, delivery attempts only start after
+// the delay, and until then the submission can be undone with MessageSubmitUndo.
+func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) SubmitResult {
+	if m.From == "" {
+		m.From = xdefaultFrom(ctx)
+	}
+	return w.submit(ctx, m, "", true)
+}
 
-		metricked := false
-		defer func() {
-			if x := recover(); x != nil {
-				if !metricked {
-					metricServerErrors.WithLabelValues("submit").Inc()
-				}
-				panic(x)
-			}
-		}()
-		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			if m.ResponseMessageID > 0 {
-				rm := xmessageID(ctx, tx, m.ResponseMessageID)
-				oflags := rm.Flags
-				if m.IsForward {
-					rm.Forwarded = true
-				} else {
-					rm.Answered = true
-				}
-				if !rm.Junk && !rm.Notjunk {
-					rm.Notjunk = true
-				}
-				if rm.Flags != oflags {
-					modseq, err = acc.NextModSeq(tx)
-					xcheckf(ctx, err, "next modseq")
-					rm.ModSeq = modseq
-					err := tx.Update(&rm)
-					xcheckf(ctx, err, "updating flags of replied/forwarded message")
-					changes = append(changes, rm.ChangeFlags(oflags))
+// Submission IDs are kept for this long for recognizing retried submissions.
+const submissionIDExpiration = 7 * 24 * time.Hour
 
-					err = acc.RetrainMessages(ctx, log, tx, []store.Message{rm}, false)
-					xcheckf(ctx, err, "retraining messages after reply/forward")
-				}
-			}
+// SubmitResult is returned by MessageSubmit.
+type SubmitResult struct {
+	// If nonzero, the submission can be undone with MessageSubmitUndo until
+	// UndoUntil, as long as delivery has not started. When the undo window closes, a
+	// ChangeSubmissionUndoEnd is sent to the client.
+	UndoID    int64
+	UndoUntil time.Time
 
-			sentmb, err := bstore.QueryTx[store.Mailbox](tx).FilterEqual("Sent", true).Get()
-			if err == bstore.ErrAbsent {
-				// There is no mailbox designated as Sent mailbox, so we're done.
-				return
-			}
-			xcheckf(ctx, err, "message submitted to queue, adding to Sent mailbox")
+	// Set if a message with the same SubmitID was submitted before. Nothing was done.
+	Duplicate bool
+}
 
-			if modseq == 0 {
-				modseq, err = acc.NextModSeq(tx)
-				xcheckf(ctx, err, "next modseq")
-			}
+// xdefaultFrom returns the From address for messages that don't specify one: the
+// default From address from the settings, or the login address.
+func xdefaultFrom(ctx context.Context) string {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
 
-			sentm := store.Message{
-				CreateSeq:     modseq,
-				ModSeq:        modseq,
-				MailboxID:     sentmb.ID,
-				MailboxOrigID: sentmb.ID,
-				Flags:         store.Flags{Notjunk: true, Seen: true},
-				Size:          int64(len(msgPrefix)) + xc.Size,
-				MsgPrefix:     []byte(msgPrefix),
-			}
+	if settings := xsettings(ctx, acc); settings.DefaultFrom != "" {
+		return settings.DefaultFrom
+	}
+	return reqInfo.LoginAddress
+}
 
-			if ok, maxSize, err := acc.CanAddMessageSize(tx, sentm.Size); err != nil {
-				xcheckf(ctx, err, "checking quota")
-			} else if !ok {
-				xcheckuserf(ctx, fmt.Errorf("account over maximum total message size %d", maxSize), "checking quota")
-			}
+// xsettings returns the webmail settings of the account.
+func xsettings(ctx context.Context, acc *store.Account) (settings store.Settings) {
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		var err error
+		settings, err = store.SettingsGet(tx)
+		xcheckf(ctx, err, "get settings")
+	})
+	return
+}
+
+// withSignature returns text with signature appended, separated by the
+// conventional "-- " line. If signature is empty, text is returned as is.
+func withSignature(text, signature string) string {
+	if signature == "" {
+		return text
+	}
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text + "\n-- \n" + strings.TrimRight(signature, "\n") + "\n"
+}
+
+// submit composes and submits message m, see MessageSubmit. If calendarReply is
+// set, it is an iCalendar object with method REPLY that is added as text/calendar
+// alternative to the text body. If sendDelay is set, the send delay from the
+// account settings is applied.
+func (w Webmail) submit(ctx context.Context, m SubmitMessage, calendarReply string, sendDelay bool) SubmitResult {
+	// Similar between ../smtpserver/server.go:/submit\( and ../webmail/webmail.go:/MessageSubmit\(
+
+	// todo: consider making this an HTTP POST, so we can upload as regular form, which is probably more efficient for encoding for the client and we can stream the data in.
+
+	addrs := xparseSubmitAddresses(ctx, m)
+
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := pkglog.WithContext(ctx).With(slog.String("account", reqInfo.AccountName))
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	log.Debug("message submit")
+
+	// Record the submission ID before doing anything, so a concurrent retry of the
+	// same submission is recognized. If the submission fails before anything was
+	// queued, the ID is removed again so the client can retry.
+	var queued bool
+	if m.SubmitID != "" {
+		if len(m.SubmitID) > 64 {
+			xcheckuserf(ctx, errors.New("submit id too long"), "checking submit id")
+		}
+		var duplicate bool
+		acc.WithRLock(func() {
+			xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+				// Remove old records, retries don't happen after this long.
+				_, err := bstore.QueryTx[store.SubmissionID](tx).FilterLess("Created", time.Now().Add(-submissionIDExpiration)).Delete()
+				xcheckf(ctx, err, "removing expired submission ids")
+
+				sid := store.SubmissionID{ID: m.SubmitID}
+				err = tx.Get(&sid)
+				if err == nil {
+					duplicate = true
+					return
+				} else if err != bstore.ErrAbsent {
+					xcheckf(ctx, err, "looking up submission id")
+				}
+				sid.Created = time.Now()
+				err = tx.Insert(&sid)
+				xcheckf(ctx, err, "storing submission id")
+			})
+		})
+		if duplicate {
+			log.Info("duplicate message submission, not sending again", slog.String("submitid", m.SubmitID))
+			metricSubmission.WithLabelValues("duplicate").Inc()
+			return SubmitResult{Duplicate: true}
+		}
+		defer func() {
+			x := recover()
+			if x == nil {
+				return
+			}
+			if !queued {
+				acc.WithRLock(func() {
+					err := acc.DB.Delete(context.Background(), &store.SubmissionID{ID: m.SubmitID})
+					log.Check(err, "removing submission id after failed submission")
+				})
+			}
+			panic(x)
+		}()
+	}
+
+	fromAddr := addrs.from
+
+	var recipients []smtp.Address
+	for _, l := range [][]message.NameAddress{addrs.to, addrs.cc, addrs.bcc} {
+		for _, a := range l {
+			recipients = append(recipients, a.Address)
+		}
+	}
+
+	// Check if from address is allowed for account.
+	fromAccName, _, _, err := beacon.FindAccount(fromAddr.Address.Localpart, fromAddr.Address.Domain, false)
+	if err == nil && fromAccName != reqInfo.AccountName {
+		err = beacon.ErrAccountNotFound
+	}
+	if err != nil && (errors.Is(err, beacon.ErrAccountNotFound) || errors.Is(err, beacon.ErrDomainNotFound)) {
+		metricSubmission.WithLabelValues("badfrom").Inc()
+		xcheckuserf(ctx, errors.New("address not found"), "looking from address for account")
+	}
+	xcheckf(ctx, err, "checking if from address is allowed")
+
+	if len(recipients) == 0 {
+		xcheckuserf(ctx, fmt.Errorf("no recipients"), "composing message")
+	}
+
+	var delay time.Duration
+
+	// Check outgoing message rate limit.
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		rcpts := make([]smtp.Path, len(recipients))
+		for i, r := range recipients {
+			rcpts[i] = smtp.Path{Localpart: r.Localpart, IPDomain: dns.IPDomain{Domain: r.Domain}}
+		}
+		msglimit, rcptlimit, err := acc.SendLimitReached(tx, rcpts)
+		if msglimit >= 0 {
+			metricSubmission.WithLabelValues("messagelimiterror").Inc()
+			xcheckuserf(ctx, errors.New("send message limit reached"), "checking outgoing rate limit")
+		} else if rcptlimit >= 0 {
+			metricSubmission.WithLabelValues("recipientlimiterror").Inc()
+			xcheckuserf(ctx, errors.New("send message limit reached"), "checking outgoing rate limit")
+		}
+		xcheckf(ctx, err, "checking send limit")
+
+		// Check the draft before queueing, we don't want to fail after.
+		if m.DraftMessageID > 0 {
+			xdraftMailbox(ctx, tx, xmessageID(ctx, tx, m.DraftMessageID))
+		}
+
+		// With localserve, messages are delivered immediately, not queued.
+		if sendDelay && !queue.Localserve {
+			settings, err := store.SettingsGet(tx)
+			xcheckf(ctx, err, "get settings")
+			delay = time.Duration(settings.SendDelay) * time.Second
+		}
+	})
+
+	has8bit := false // We update this later on.
+
+	// We only use smtputf8 if we have to, with a utf-8 localpart. For IDNA, we use ASCII domains.
+	smtputf8 := false
+	for _, a := range recipients {
+		if a.Localpart.IsInternational() {
+			smtputf8 = true
+			break
+		}
+	}
+	if !smtputf8 && fromAddr.Address.Localpart.IsInternational() {
+		// todo: may want to warn user that they should consider sending with a ascii-only localpart, in case receiver doesn't support smtputf8.
+		smtputf8 = true
+	}
+
+	// Create file to compose message into.
+	dataFile, err := store.CreateMessageTemp(log, "webmail-submit")
+	xcheckf(ctx, err, "creating temporary file for message")
+	defer store.CloseRemoveTempFile(log, dataFile, "message to submit")
+
+	// If writing to the message file fails, we abort immediately.
+	xc := message.NewComposer(dataFile, w.maxMessageSize)
+	defer xcomposeRecover(ctx)
+
+	// todo spec: can we add an Authentication-Results header that indicates this is an authenticated message? the "auth" method is for SMTP AUTH, which this isn't. ../rfc/8601 https://www.iana.org/assignments/email-auth/email-auth.xhtml
+
+	// Each queued message gets a Received header.
+	// We don't have access to the local IP for adding.
+	// We cannot use VIA, because there is no registered method. We would like to use
+	// it to add the ascii domain name in case of smtputf8 and IDNA host name.
+	recvFrom := message.HeaderCommentDomain(beacon.Conf.Static.HostnameDomain, smtputf8)
+	recvBy := beacon.Conf.Static.HostnameDomain.XName(smtputf8)
+	recvID := beacon.ReceivedID(beacon.CidFromCtx(ctx))
+	recvHdrFor := func(rcptTo string) string {
+		recvHdr := &message.HeaderWriter{}
+		// For additional Received-header clauses, see:
+		// https://www.iana.org/assignments/mail-parameters/mail-parameters.xhtml#table-mail-parameters-8
+		// Note: we don't have "via" or "with", there is no registered for webmail.
+		recvHdr.Add(" ", "Received:", "from", recvFrom, "by", recvBy, "id", recvID) // ../rfc/5321:3158
+		if reqInfo.Request.TLS != nil {
+			recvHdr.Add(" ", beacon.TLSReceivedComment(log, *reqInfo.Request.TLS)...)
+		}
+		recvHdr.Add(" ", "for", "<"+rcptTo+">;", time.Now().Format(message.RFC5322Z))
+		return recvHdr.String()
+	}
+
+	messageID := fmt.Sprintf("<%s>", beacon.MessageIDGen(smtputf8))
+	xcomposeMessage(ctx, log, acc, xc, m, addrs, messageID, false, calendarReply)
+
+	// Add DKIM-Signature headers.
+	var msgPrefix string
+	fd := fromAddr.Address.Domain
+	confDom, _ := beacon.Conf.Domain(fd)
+	selectors := beacon.DKIMSelectors(confDom.DKIM)
+	if len(selectors) > 0 {
+		dkimHeaders, err := dkim.Sign(ctx, log.Logger, fromAddr.Address.Localpart, fd, selectors, smtputf8, dataFile)
+		if err != nil {
+			metricServerErrors.WithLabelValues("dkimsign").Inc()
+		}
+		xcheckf(ctx, err, "sign dkim")
+
+		msgPrefix = dkimHeaders
+	}
+
+	// With a send delay, the first delivery attempt is scheduled after the delay, so
+	// the submission can still be undone.
+	var undo store.SubmissionUndo
+	var nextAttempt time.Time
+	if delay > 0 {
+		undo.Until = time.Now().Add(delay)
+		nextAttempt = undo.Until
+		for _, a := range addrs.bcc {
+			undo.Bcc = append(undo.Bcc, (&mail.Address{Name: a.DisplayName, Address: a.Address.Pack(true)}).String())
+		}
+	}
+
+	fromPath := smtp.Path{
+		Localpart: fromAddr.Address.Localpart,
+		IPDomain:  dns.IPDomain{Domain: fromAddr.Address.Domain},
+	}
+	for _, rcpt := range recipients {
+		rcptMsgPrefix := recvHdrFor(rcpt.Pack(smtputf8)) + msgPrefix
+		msgSize := int64(len(rcptMsgPrefix)) + xc.Size
+		toPath := smtp.Path{
+			Localpart: rcpt.Localpart,
+			IPDomain:  dns.IPDomain{Domain: rcpt.Domain},
+		}
+		qm := queue.MakeMsg(reqInfo.AccountName, fromPath, toPath, has8bit, smtputf8, msgSize, messageID, []byte(rcptMsgPrefix), m.RequireTLS)
+		qm.NextAttempt = nextAttempt
+		err := queue.Add(ctx, log, &qm, dataFile)
+		if err != nil {
+			metricSubmission.WithLabelValues("queueerror").Inc()
+		}
+		xcheckf(ctx, err, "adding message to the delivery queue")
+		queued = true
+		metricSubmission.WithLabelValues("ok").Inc()
+		undo.QueueMsgIDs = append(undo.QueueMsgIDs, qm.ID)
+	}
+
+	var modseq store.ModSeq // Only set if needed.
+
+	// Removing the draft requires a write lock, like other expunges.
+	withLock := acc.WithRLock
+	if m.DraftMessageID > 0 {
+		withLock = acc.WithWLock
+	}
+	var removeDraftID int64
+
+	// Append message to Sent mailbox, mark original messages as answered/forwarded
+	// and remove the draft.
+	withLock(func() {
+		var changes []store.Change
+
+		metricked := false
+		defer func() {
+			if x := recover(); x != nil {
+				if !metricked {
+					metricServerErrors.WithLabelValues("submit").Inc()
+				}
+				panic(x)
+			}
+		}()
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			if m.ResponseMessageID > 0 {
+				rm := xmessageID(ctx, tx, m.ResponseMessageID)
+				oflags := rm.Flags
+				if m.IsForward {
+					rm.Forwarded = true
+				} else {
+					rm.Answered = true
+				}
+				if !rm.Junk && !rm.Notjunk {
+					rm.Notjunk = true
+				}
+				if rm.Flags != oflags {
+					modseq, err = acc.NextModSeq(tx)
+					xcheckf(ctx, err, "next modseq")
+					rm.ModSeq = modseq
+					err := tx.Update(&rm)
+					xcheckf(ctx, err, "updating flags of replied/forwarded message")
+					changes = append(changes, rm.ChangeFlags(oflags))
+
+					err = acc.RetrainMessages(ctx, log, tx, []store.Message{rm}, false)
+					xcheckf(ctx, err, "retraining messages after reply/forward")
+				}
+			}
+
+			if m.DraftMessageID > 0 {
+				if modseq == 0 {
+					modseq, err = acc.NextModSeq(tx)
+					xcheckf(ctx, err, "next modseq")
+				}
+				if l, ok := xremoveDraft(ctx, log, acc, tx, m.DraftMessageID, modseq); ok {
+					changes = append(changes, l...)
+					removeDraftID = m.DraftMessageID
+				}
+			}
+
+			if delay > 0 {
+				// Remove records of earlier submissions whose undo window has closed, e.g.
+				// because of a restart before the timer fired.
+				_, err := bstore.QueryTx[store.SubmissionUndo](tx).FilterLess("Until", time.Now()).Delete()
+				xcheckf(ctx, err, "removing expired submission undo records")
+
+				err = tx.Insert(&undo)
+				xcheckf(ctx, err, "storing submission undo record")
+			}
+
+			sentmb, err := bstore.QueryTx[store.Mailbox](tx).FilterEqual("Sent", true).Get()
+			if err == bstore.ErrAbsent {
+				// There is no mailbox designated as Sent mailbox, so we're done.
+				return
+			}
+			xcheckf(ctx, err, "message submitted to queue, adding to Sent mailbox")
+
+			if modseq == 0 {
+				modseq, err = acc.NextModSeq(tx)
+				xcheckf(ctx, err, "next modseq")
+			}
+
+			sentm := store.Message{
+				CreateSeq:     modseq,
+				ModSeq:        modseq,
+				MailboxID:     sentmb.ID,
+				MailboxOrigID: sentmb.ID,
+				Flags:         store.Flags{Notjunk: true, Seen: true},
+				Size:          int64(len(msgPrefix)) + xc.Size,
+				MsgPrefix:     []byte(msgPrefix),
+			}
+
+			if ok, maxSize, err := acc.CanAddMessageSize(tx, sentm.Size); err != nil {
+				xcheckf(ctx, err, "checking quota")
+			} else if !ok {
+				xcheckuserf(ctx, fmt.Errorf("account over maximum total message size %d", maxSize), "checking quota")
+			}
 
 			// Update mailbox before delivery, which changes uidnext.
 			sentmb.Add(sentm.MailboxCounts())
@@ -724,17 +1019,1349 @@ func (w Webmail) MessageSubmit(ctx context.Context, m SubmitMessage) {
 			xcheckf(ctx, err, "message submitted to queue, appending message to Sent mailbox")
 
 			changes = append(changes, sentm.ChangeAddUID(), sentmb.ChangeCounts())
+
+			if undo.ID > 0 {
+				undo.SentMessageID = sentm.ID
+				err = tx.Update(&undo)
+				xcheckf(ctx, err, "updating submission undo record")
+			}
 		})
 
 		store.BroadcastChanges(acc, changes)
 	})
+
+	if removeDraftID > 0 {
+		p := acc.MessagePath(removeDraftID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file for draft", slog.String("path", p))
+	}
+
+	if undo.ID == 0 {
+		return SubmitResult{}
+	}
+	accountName := reqInfo.AccountName
+	undoID := undo.ID
+	time.AfterFunc(delay, func() {
+		submissionUndoEnd(log, accountName, undoID)
+	})
+	return SubmitResult{UndoID: undo.ID, UndoUntil: undo.Until}
+}
+
+// submissionUndoEnd is called when the undo window of a submission closes. It
+// removes the undo record and notifies clients. If the submission was already
+// undone, nothing happens.
+func submissionUndoEnd(log mlog.Log, accountName string, undoID int64) {
+	defer logPanic(context.Background())
+
+	acc, err := store.OpenAccount(log, accountName)
+	if err != nil {
+		log.Errorx("open account for ending submission undo window", err)
+		return
+	}
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	acc.WithRLock(func() {
+		err := acc.DB.Delete(context.Background(), &store.SubmissionUndo{ID: undoID})
+		if err == bstore.ErrAbsent {
+			return
+		} else if err != nil {
+			log.Errorx("removing submission undo record", err)
+			return
+		}
+		store.BroadcastChanges(acc, []store.Change{store.ChangeSubmissionUndoEnd{ID: undoID}})
+	})
+}
+
+// MessageSubmitUndo undoes a submission made with a send delay, as returned by
+// MessageSubmit. This is only possible while delivery of the message has not
+// started. The message is removed from the delivery queue and from the Sent
+// mailbox, and added as draft message, including its Bcc header, whose ID is
+// returned.
+func (w Webmail) MessageSubmitUndo(ctx context.Context, undoID int64) int64 {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := pkglog.WithContext(ctx).With(slog.String("account", reqInfo.AccountName))
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	log.Debug("message submit undo", slog.Int64("undoid", undoID))
+
+	undo := store.SubmissionUndo{ID: undoID}
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		err := tx.Get(&undo)
+		if err == bstore.ErrAbsent || err == nil && !time.Now().Before(undo.Until) {
+			xcheckuserf(ctx, errors.New("message can no longer be undone"), "looking up submission")
+		}
+		xcheckf(ctx, err, "looking up submission")
+
+		// Check for the draft mailbox before removing from the queue, we don't want to
+		// fail after.
+		xdraftsMailbox(ctx, tx)
+	})
+	if len(undo.QueueMsgIDs) == 0 {
+		xcheckf(ctx, errors.New("no queued messages"), "looking up submission")
+	}
+
+	// Compose the draft from the queued message, adding back the Bcc header, before
+	// removing the message from the queue.
+	dataFile, err := store.CreateMessageTemp(log, "webmail-undo")
+	xcheckf(ctx, err, "creating temporary file for message")
+	defer store.CloseRemoveTempFile(log, dataFile, "draft message")
+
+	xc := message.NewComposer(dataFile, 0)
+	defer xcomposeRecover(ctx)
+
+	var bcc []message.NameAddress
+	for _, s := range undo.Bcc {
+		a, err := parseAddress(s)
+		xcheckf(ctx, err, "parsing bcc address")
+		if a.Address.Localpart.IsInternational() {
+			xc.SMTPUTF8 = true
+		}
+		bcc = append(bcc, a)
+	}
+	xc.HeaderAddrs("Bcc", bcc)
+
+	qp := queue.Msg{ID: undo.QueueMsgIDs[0]}.MessagePath()
+	qf, err := os.Open(qp)
+	xcheckf(ctx, err, "open queued message")
+	defer func() {
+		err := qf.Close()
+		log.Check(err, "closing queued message file", slog.String("path", qp))
+	}()
+	_, err = io.Copy(xc, qf)
+	xcheckf(ctx, err, "reading queued message")
+	xc.Flush()
+
+	err = queue.DropUnstarted(ctx, log, undo.QueueMsgIDs)
+	if errors.Is(err, queue.ErrDeliveryStarted) {
+		xcheckuserf(ctx, err, "removing message from queue")
+	}
+	xcheckf(ctx, err, "removing message from queue")
+
+	var dm store.Message
+	var removeSentID int64
+	acc.WithWLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			err := tx.Delete(&undo)
+			xcheckf(ctx, err, "removing submission undo record")
+
+			modseq, err := acc.NextModSeq(tx)
+			xcheckf(ctx, err, "next modseq")
+
+			if undo.SentMessageID > 0 {
+				sm := store.Message{ID: undo.SentMessageID}
+				err := tx.Get(&sm)
+				if err != bstore.ErrAbsent {
+					xcheckf(ctx, err, "get sent message")
+				}
+				if err == nil && !sm.Expunged {
+					mb := xmailboxID(ctx, tx, sm.MailboxID)
+					changes = append(changes, xremoveMessage(ctx, log, acc, tx, sm, mb, modseq)...)
+					removeSentID = sm.ID
+				}
+			}
+
+			// Get the mailbox after removing the sent message, it may be the same mailbox.
+			mb := xdraftsMailbox(ctx, tx)
+			var l []store.Change
+			dm, l = xaddDraft(ctx, log, acc, tx, mb, dataFile, xc.Size, modseq)
+			changes = append(changes, l...)
+			changes = append(changes, store.ChangeSubmissionUndoEnd{ID: undo.ID})
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+
+	if removeSentID > 0 {
+		p := acc.MessagePath(removeSentID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file for sent message", slog.String("path", p))
+	}
+
+	return dm.ID
+}
+
+// xdraftMailbox returns the mailbox of draft message dm, raising a user error if
+// the message is not a draft, i.e. it has no Draft flag and is not in the mailbox
+// with special-use flag Draft.
+func xdraftMailbox(ctx context.Context, tx *bstore.Tx, dm store.Message) store.Mailbox {
+	mb := xmailboxID(ctx, tx, dm.MailboxID)
+	if !dm.Draft && !mb.Draft {
+		xcheckuserf(ctx, errors.New("message is not a draft"), "checking draft message")
+	}
+	return mb
+}
+
+// xremoveDraft marks draft message draftID as expunged, updating the counts of
+// its mailbox and the disk usage of the account. If the message no longer exists,
+// false is returned. Otherwise the caller must broadcast the returned changes and
+// remove the message file after the transaction is committed.
+//
+// Must be called with account wlock held.
+func xremoveDraft(ctx context.Context, log mlog.Log, acc *store.Account, tx *bstore.Tx, draftID int64, modseq store.ModSeq) ([]store.Change, bool) {
+	dm := store.Message{ID: draftID}
+	err := tx.Get(&dm)
+	if err == bstore.ErrAbsent || err == nil && dm.Expunged {
+		return nil, false
+	}
+	xcheckf(ctx, err, "get draft message")
+	mb := xdraftMailbox(ctx, tx, dm)
+	return xremoveMessage(ctx, log, acc, tx, dm, mb, modseq), true
+}
+
+// xremoveMessage marks message m in mailbox mb as expunged, updating the counts of
+// the mailbox and the disk usage of the account. The caller must broadcast the
+// returned changes and remove the message file after the transaction is committed.
+//
+// Must be called with account wlock held.
+func xremoveMessage(ctx context.Context, log mlog.Log, acc *store.Account, tx *bstore.Tx, m store.Message, mb store.Mailbox, modseq store.ModSeq) []store.Change {
+	qmr := bstore.QueryTx[store.Recipient](tx)
+	qmr.FilterEqual("MessageID", m.ID)
+	_, err := qmr.Delete()
+	xcheckf(ctx, err, "removing message recipients")
+
+	mb.Sub(m.MailboxCounts())
+	err = tx.Update(&mb)
+	xcheckf(ctx, err, "updating mailbox counts")
+
+	m.Expunged = true
+	m.ModSeq = modseq
+	err = tx.Update(&m)
+	xcheckf(ctx, err, "marking message as expunged")
+
+	err = acc.AddMessageSize(log, tx, -m.Size)
+	xcheckf(ctx, err, "updating disk usage")
+
+	// Untrain the message if it was trained, e.g. when set as junk by an IMAP client.
+	m.Junk = false
+	m.Notjunk = false
+	err = acc.RetrainMessages(ctx, log, tx, []store.Message{m}, true)
+	xcheckf(ctx, err, "untraining message")
+
+	ch := store.ChangeRemoveUIDs{MailboxID: mb.ID, UIDs: []store.UID{m.UID}, ModSeq: modseq}
+	return []store.Change{ch, mb.ChangeCounts()}
+}
+
+// xdraftsMailbox returns the mailbox with special-use flag Draft, raising a user
+// error if there is none.
+func xdraftsMailbox(ctx context.Context, tx *bstore.Tx) store.Mailbox {
+	mb, err := bstore.QueryTx[store.Mailbox](tx).FilterEqual("Draft", true).Get()
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, errors.New("no mailbox with special-use flag draft"), "looking up draft mailbox")
+	}
+	xcheckf(ctx, err, "looking up draft mailbox")
+	return mb
+}
+
+// xaddDraft adds the message in dataFile of size bytes as draft message to mailbox
+// mb. The caller must broadcast the returned changes.
+//
+// Must be called with account wlock held.
+func xaddDraft(ctx context.Context, log mlog.Log, acc *store.Account, tx *bstore.Tx, mb store.Mailbox, dataFile *os.File, size int64, modseq store.ModSeq) (store.Message, []store.Change) {
+	dm := store.Message{
+		CreateSeq:     modseq,
+		ModSeq:        modseq,
+		MailboxID:     mb.ID,
+		MailboxOrigID: mb.ID,
+		Flags:         store.Flags{Seen: true, Draft: true},
+		Size:          size,
+	}
+
+	if ok, maxSize, err := acc.CanAddMessageSize(tx, dm.Size); err != nil {
+		xcheckf(ctx, err, "checking quota")
+	} else if !ok {
+		xcheckuserf(ctx, fmt.Errorf("account over maximum total message size %d", maxSize), "checking quota")
+	}
+
+	// Update mailbox before delivery, which changes uidnext.
+	mb.Add(dm.MailboxCounts())
+	err := tx.Update(&mb)
+	xcheckf(ctx, err, "updating draft mailbox for counts")
+
+	err = acc.DeliverMessage(log, tx, &dm, dataFile, true, true, false, true)
+	xcheckf(ctx, err, "adding message to draft mailbox")
+
+	return dm, []store.Change{dm.ChangeAddUID(), mb.ChangeCounts()}
+}
+
+// MessageDraftSave stores m as draft message in the mailbox with special-use flag
+// Draft, and returns the ID of the new message. If m.DraftMessageID is set, that
+// previous version of the draft is removed in the same transaction.
+//
+// Unlike with MessageSubmit, recipients are optional, and Bcc addresses are
+// kept in the message header.
+func (w Webmail) MessageDraftSave(ctx context.Context, m SubmitMessage) int64 {
+	addrs := xparseSubmitAddresses(ctx, m)
+
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	log := pkglog.WithContext(ctx).With(slog.String("account", reqInfo.AccountName))
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	log.Debug("message draft save", slog.Int64("previousdraftid", m.DraftMessageID))
+
+	dataFile, err := store.CreateMessageTemp(log, "webmail-draft")
+	xcheckf(ctx, err, "creating temporary file for message")
+	defer store.CloseRemoveTempFile(log, dataFile, "draft message")
+
+	xc := message.NewComposer(dataFile, w.maxMessageSize)
+	defer xcomposeRecover(ctx)
+
+	messageID := fmt.Sprintf("<%s>", beacon.MessageIDGen(false))
+	xcomposeMessage(ctx, log, acc, xc, m, addrs, messageID, true, "")
+
+	var dm store.Message
+	var removeDraftID int64
+	acc.WithWLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb := xdraftsMailbox(ctx, tx)
+
+			modseq, err := acc.NextModSeq(tx)
+			xcheckf(ctx, err, "next modseq")
+
+			if m.DraftMessageID > 0 {
+				if l, ok := xremoveDraft(ctx, log, acc, tx, m.DraftMessageID, modseq); ok {
+					changes = append(changes, l...)
+					removeDraftID = m.DraftMessageID
+					// Previous draft may have been in the same mailbox, get the updated counts.
+					mb = xmailboxID(ctx, tx, mb.ID)
+				}
+			}
+
+			var l []store.Change
+			dm, l = xaddDraft(ctx, log, acc, tx, mb, dataFile, xc.Size, modseq)
+			changes = append(changes, l...)
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+
+	if removeDraftID > 0 {
+		p := acc.MessagePath(removeDraftID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file for previous draft", slog.String("path", p))
+	}
+
+	return dm.ID
+}
+
+// MessageDraftDelete removes a draft message, e.g. when the message is
+// discarded in the composer. Removing a draft that no longer exists is not an
+// error.
+func (Webmail) MessageDraftDelete(ctx context.Context, draftMessageID int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	var removed bool
+	acc.WithWLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			modseq, err := acc.NextModSeq(tx)
+			xcheckf(ctx, err, "next modseq")
+			changes, removed = xremoveDraft(ctx, log, acc, tx, draftMessageID, modseq)
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+
+	if removed {
+		p := acc.MessagePath(draftMessageID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file for draft", slog.String("path", p))
+	}
+}
+
+// MessageDraftOpen returns a draft message as SubmitMessage, for continuing to
+// compose it. If the draft has an HTML part, it is returned as HTMLBody, with
+// inline images as data URIs. Attachments are returned as files with data URIs.
+// If the draft is a reply to a message in the account, ResponseMessageID is set.
+// When the message is submitted or saved again, DraftMessageID is used to remove
+// this draft.
+func (Webmail) MessageDraftOpen(ctx context.Context, draftMessageID int64) (sm SubmitMessage) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	var dm store.Message
+	var inReplyTo store.Message
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		dm = xmessageID(ctx, tx, draftMessageID)
+		xdraftMailbox(ctx, tx, dm)
+	})
+
+	state := msgState{acc: acc}
+	defer state.clear()
+	pm, err := parsedMessage(log, dm, &state, true, false)
+	xcheckf(ctx, err, "parsing message")
+
+	addrs := func(l []message.Address) []string {
+		r := []string{}
+		for _, a := range l {
+			r = append(r, addressString(a, true))
+		}
+		return r
+	}
+	env := message.Envelope{}
+	if state.part.Envelope != nil {
+		env = *state.part.Envelope
+	}
+	sm = SubmitMessage{
+		To:             addrs(env.To),
+		Cc:             addrs(env.CC),
+		Bcc:            addrs(env.BCC),
+		Subject:        env.Subject,
+		Attachments:    []File{},
+		DraftMessageID: dm.ID,
+	}
+	if len(env.From) > 0 {
+		sm.From = addressString(env.From[0], true)
+	}
+	if len(env.ReplyTo) > 0 {
+		sm.ReplyTo = addressString(env.ReplyTo[0], true)
+	}
+	htmlBody, related, err := draftHTML(state.part)
+	xcheckf(ctx, err, "reading html part of draft")
+	sm.HTMLBody = htmlBody
+	if htmlBody == "" && len(pm.Texts) > 0 {
+		// Composing converts to CRLF and ensures text ends with a newline, undo both so
+		// saving again doesn't keep adding them.
+		sm.TextBody = strings.TrimSuffix(strings.ReplaceAll(pm.Texts[0], "\r\n", "\n"), "\n")
+	}
+	if h, err := state.part.Header(); err == nil {
+		sm.UserAgent = h.Get("User-Agent")
+		if strings.EqualFold(strings.TrimSpace(h.Get("TLS-Required")), "no") {
+			sm.RequireTLS = new(bool)
+		}
+	}
+
+	for _, a := range pm.attachments {
+		if related[strings.ToLower(a.Part.ContentID)] {
+			// Inline image, already part of the HTML body.
+			continue
+		}
+		buf, err := io.ReadAll(a.Part.Reader())
+		xcheckf(ctx, err, "reading attachment")
+		ct := strings.ToLower(a.Part.MediaType + "/" + a.Part.MediaSubType)
+		sm.Attachments = append(sm.Attachments, File{a.Filename, "data:" + ct + ";base64," + base64.StdEncoding.EncodeToString(buf)})
+	}
+
+	// Look up the message this draft is a reply to, so it gets marked as answered
+	// when the message is sent.
+	if msgID, _, err := message.MessageIDCanonical(env.InReplyTo); err == nil && msgID != "" {
+		xdbread(ctx, acc, func(tx *bstore.Tx) {
+			q := bstore.QueryTx[store.Message](tx)
+			q.FilterNonzero(store.Message{MessageID: msgID})
+			q.FilterEqual("Expunged", false)
+			q.FilterFn(func(m store.Message) bool { return !m.Draft })
+			q.SortDesc("Received")
+			q.Limit(1)
+			inReplyTo, err = q.Get()
+			if err != bstore.ErrAbsent {
+				xcheckf(ctx, err, "looking up message replied to")
+			}
+		})
+		sm.ResponseMessageID = inReplyTo.ID
+	}
+	return
+}
+
+// MessageMove moves messages to another mailbox. If the message is already in
+// the mailbox an error is returned.
+func (Webmail) MessageMove(ctx context.Context, messageIDs []int64, mailboxID int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	acc.WithRLock(func() {
+		retrain := make([]store.Message, 0, len(messageIDs))
+		removeChanges := map[int64]store.ChangeRemoveUIDs{}
+		// n adds, 1 remove, 2 mailboxcounts, optimistic and at least for a single message.
+		changes := make([]store.Change, 0, len(messageIDs)+3)
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			var mbSrc store.Mailbox
+			var modseq store.ModSeq
+
+			mbDst := xmailboxID(ctx, tx, mailboxID)
+
+			if len(messageIDs) == 0 {
+				return
+			}
+
+			keywords := map[string]struct{}{}
+
+			for _, mid := range messageIDs {
+				m := xmessageID(ctx, tx, mid)
+
+				// We may have loaded this mailbox in the previous iteration of this loop.
+				if m.MailboxID != mbSrc.ID {
+					if mbSrc.ID != 0 {
+						err = tx.Update(&mbSrc)
+						xcheckf(ctx, err, "updating source mailbox counts")
+						changes = append(changes, mbSrc.ChangeCounts())
+					}
+					mbSrc = xmailboxID(ctx, tx, m.MailboxID)
+				}
+
+				if mbSrc.ID == mailboxID {
+					// Client should filter out messages that are already in mailbox.
+					xcheckuserf(ctx, errors.New("already in destination mailbox"), "moving message")
+				}
+
+				if modseq == 0 {
+					modseq, err = acc.NextModSeq(tx)
+					xcheckf(ctx, err, "assigning next modseq")
+				}
+
+				ch := removeChanges[m.MailboxID]
+				ch.UIDs = append(ch.UIDs, m.UID)
+				ch.ModSeq = modseq
+				ch.MailboxID = m.MailboxID
+				removeChanges[m.MailboxID] = ch
+
+				// Copy of message record that we'll insert when UID is freed up.
+				om := m
+				om.PrepareExpunge()
+				om.ID = 0 // Assign new ID.
+				om.ModSeq = modseq
+
+				mbSrc.Sub(m.MailboxCounts())
+
+				if mbDst.Trash {
+					m.Seen = true
+				}
+				conf, _ := acc.Conf()
+				m.MailboxID = mbDst.ID
+				if m.IsReject && m.MailboxDestinedID != 0 {
+					// Incorrectly delivered to Rejects mailbox. Adjust MailboxOrigID so this message
+					// is used for reputation calculation during future deliveries.
+					m.MailboxOrigID = m.MailboxDestinedID
+					m.IsReject = false
+					m.Seen = false
+				}
+				m.UID = mbDst.UIDNext
+				m.ModSeq = modseq
+				mbDst.UIDNext++
+				m.JunkFlagsForMailbox(mbDst, conf)
+				err = tx.Update(&m)
+				xcheckf(ctx, err, "updating moved message in database")
+
+				// Now that UID is unused, we can insert the old record again.
+				err = tx.Insert(&om)
+				xcheckf(ctx, err, "inserting record for expunge after moving message")
+
+				mbDst.Add(m.MailboxCounts())
+
+				changes = append(changes, m.ChangeAddUID())
+				retrain = append(retrain, m)
+
+				for _, kw := range m.Keywords {
+					keywords[kw] = struct{}{}
+				}
+			}
+
+			err = tx.Update(&mbSrc)
+			xcheckf(ctx, err, "updating source mailbox counts")
+
+			changes = append(changes, mbSrc.ChangeCounts(), mbDst.ChangeCounts())
+
+			// Ensure destination mailbox has keywords of the moved messages.
+			var mbKwChanged bool
+			mbDst.Keywords, mbKwChanged = store.MergeKeywords(mbDst.Keywords, maps.Keys(keywords))
+			if mbKwChanged {
+				changes = append(changes, mbDst.ChangeKeywords())
+			}
+
+			err = tx.Update(&mbDst)
+			xcheckf(ctx, err, "updating mailbox with uidnext")
+
+			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
+			xcheckf(ctx, err, "retraining messages after move")
+		})
+
+		// Ensure UIDs of the removed message are in increasing order. It is quite common
+		// for all messages to be from a single source mailbox, meaning this is just one
+		// change, for which we preallocated space.
+		for _, ch := range removeChanges {
+			sort.Slice(ch.UIDs, func(i, j int) bool {
+				return ch.UIDs[i] < ch.UIDs[j]
+			})
+			changes = append(changes, ch)
+		}
+		store.BroadcastChanges(acc, changes)
+	})
+}
+
+// MessageDelete permanently deletes messages, without moving them to the Trash mailbox.
+func (Webmail) MessageDelete(ctx context.Context, messageIDs []int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	if len(messageIDs) == 0 {
+		return
+	}
+
+	acc.WithWLock(func() {
+		removeChanges := map[int64]store.ChangeRemoveUIDs{}
+		changes := make([]store.Change, 0, len(messageIDs)+1) // n remove, 1 mailbox counts
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			var modseq store.ModSeq
+			var mb store.Mailbox
+			remove := make([]store.Message, 0, len(messageIDs))
+
+			var totalSize int64
+			for _, mid := range messageIDs {
+				m := xmessageID(ctx, tx, mid)
+				totalSize += m.Size
+
+				if m.MailboxID != mb.ID {
+					if mb.ID != 0 {
+						err := tx.Update(&mb)
+						xcheckf(ctx, err, "updating mailbox counts")
+						changes = append(changes, mb.ChangeCounts())
+					}
+					mb = xmailboxID(ctx, tx, m.MailboxID)
+				}
+
+				qmr := bstore.QueryTx[store.Recipient](tx)
+				qmr.FilterEqual("MessageID", m.ID)
+				_, err = qmr.Delete()
+				xcheckf(ctx, err, "removing message recipients")
+
+				mb.Sub(m.MailboxCounts())
+
+				if modseq == 0 {
+					modseq, err = acc.NextModSeq(tx)
+					xcheckf(ctx, err, "assigning next modseq")
+				}
+				m.Expunged = true
+				m.ModSeq = modseq
+				err = tx.Update(&m)
+				xcheckf(ctx, err, "marking message as expunged")
+
+				ch := removeChanges[m.MailboxID]
+				ch.UIDs = append(ch.UIDs, m.UID)
+				ch.MailboxID = m.MailboxID
+				ch.ModSeq = modseq
+				removeChanges[m.MailboxID] = ch
+				remove = append(remove, m)
+			}
+
+			if mb.ID != 0 {
+				err := tx.Update(&mb)
+				xcheckf(ctx, err, "updating count in mailbox")
+				changes = append(changes, mb.ChangeCounts())
+			}
+
+			err = acc.AddMessageSize(log, tx, -totalSize)
+			xcheckf(ctx, err, "updating disk usage")
+
+			// Mark removed messages as not needing training, then retrain them, so if they
+			// were trained, they get untrained.
+			for i := range remove {
+				remove[i].Junk = false
+				remove[i].Notjunk = false
+			}
+			err = acc.RetrainMessages(ctx, log, tx, remove, true)
+			xcheckf(ctx, err, "untraining deleted messages")
+		})
+
+		for _, ch := range removeChanges {
+			sort.Slice(ch.UIDs, func(i, j int) bool {
+				return ch.UIDs[i] < ch.UIDs[j]
+			})
+			changes = append(changes, ch)
+		}
+		store.BroadcastChanges(acc, changes)
+	})
+
+	for _, mID := range messageIDs {
+		p := acc.MessagePath(mID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file for expunge")
+	}
+}
+
+// FlagsAdd adds flags, either system flags like \Seen or custom keywords. The
+// flags should be lower-case, but will be converted and verified.
+func (Webmail) FlagsAdd(ctx context.Context, messageIDs []int64, flaglist []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	flags, keywords, err := store.ParseFlagsKeywords(flaglist)
+	xcheckuserf(ctx, err, "parsing flags")
+
+	acc.WithRLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			var modseq store.ModSeq
+			var retrain []store.Message
+			var mb, origmb store.Mailbox
+
+			for _, mid := range messageIDs {
+				m := xmessageID(ctx, tx, mid)
+
+				if mb.ID != m.MailboxID {
+					if mb.ID != 0 {
+						err := tx.Update(&mb)
+						xcheckf(ctx, err, "updating mailbox")
+						if mb.MailboxCounts != origmb.MailboxCounts {
+							changes = append(changes, mb.ChangeCounts())
+						}
+						if mb.KeywordsChanged(origmb) {
+							changes = append(changes, mb.ChangeKeywords())
+						}
+					}
+					mb = xmailboxID(ctx, tx, m.MailboxID)
+					origmb = mb
+				}
+				mb.Keywords, _ = store.MergeKeywords(mb.Keywords, keywords)
+
+				mb.Sub(m.MailboxCounts())
+				oflags := m.Flags
+				m.Flags = m.Flags.Set(flags, flags)
+				var kwChanged bool
+				m.Keywords, kwChanged = store.MergeKeywords(m.Keywords, keywords)
+				mb.Add(m.MailboxCounts())
+
+				if m.Flags == oflags && !kwChanged {
+					continue
+				}
+
+				if modseq == 0 {
+					modseq, err = acc.NextModSeq(tx)
+					xcheckf(ctx, err, "assigning next modseq")
+				}
+				m.ModSeq = modseq
+				err = tx.Update(&m)
+				xcheckf(ctx, err, "updating message")
+
+				changes = append(changes, m.ChangeFlags(oflags))
+				retrain = append(retrain, m)
+			}
+
+			if mb.ID != 0 {
+				err := tx.Update(&mb)
+				xcheckf(ctx, err, "updating mailbox")
+				if mb.MailboxCounts != origmb.MailboxCounts {
+					changes = append(changes, mb.ChangeCounts())
+				}
+				if mb.KeywordsChanged(origmb) {
+					changes = append(changes, mb.ChangeKeywords())
+				}
+			}
+
+			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
+			xcheckf(ctx, err, "retraining messages")
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+}
+
+// FlagsClear clears flags, either system flags like \Seen or custom keywords.
+func (Webmail) FlagsClear(ctx context.Context, messageIDs []int64, flaglist []string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	flags, keywords, err := store.ParseFlagsKeywords(flaglist)
+	xcheckuserf(ctx, err, "parsing flags")
+
+	acc.WithRLock(func() {
+		var retrain []store.Message
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			var modseq store.ModSeq
+			var mb, origmb store.Mailbox
+
+			for _, mid := range messageIDs {
+				m := xmessageID(ctx, tx, mid)
+
+				if mb.ID != m.MailboxID {
+					if mb.ID != 0 {
+						err := tx.Update(&mb)
+						xcheckf(ctx, err, "updating counts for mailbox")
+						if mb.MailboxCounts != origmb.MailboxCounts {
+							changes = append(changes, mb.ChangeCounts())
+						}
+						// note: cannot remove keywords from mailbox by removing keywords from message.
+					}
+					mb = xmailboxID(ctx, tx, m.MailboxID)
+					origmb = mb
+				}
+
+				oflags := m.Flags
+				mb.Sub(m.MailboxCounts())
+				m.Flags = m.Flags.Set(flags, store.Flags{})
+				var changed bool
+				m.Keywords, changed = store.RemoveKeywords(m.Keywords, keywords)
+				mb.Add(m.MailboxCounts())
+
+				if m.Flags == oflags && !changed {
+					continue
+				}
+
+				if modseq == 0 {
+					modseq, err = acc.NextModSeq(tx)
+					xcheckf(ctx, err, "assigning next modseq")
+				}
+				m.ModSeq = modseq
+				err = tx.Update(&m)
+				xcheckf(ctx, err, "updating message")
+
+				changes = append(changes, m.ChangeFlags(oflags))
+				retrain = append(retrain, m)
+			}
+
+			if mb.ID != 0 {
+				err := tx.Update(&mb)
+				xcheckf(ctx, err, "updating keywords in mailbox")
+				if mb.MailboxCounts != origmb.MailboxCounts {
+					changes = append(changes, mb.ChangeCounts())
+				}
+				// note: cannot remove keywords from mailbox by removing keywords from message.
+			}
+
+			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
+			xcheckf(ctx, err, "retraining messages")
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+}
+
+// MailboxCreate creates a new mailbox.
+func (Webmail) MailboxCreate(ctx context.Context, name string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	name, _, err = store.CheckMailboxName(name, false)
+	xcheckuserf(ctx, err, "checking mailbox name")
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			var exists bool
+			var err error
+			changes, _, exists, err = acc.MailboxCreate(tx, name)
+			if exists {
+				xcheckuserf(ctx, errors.New("mailbox already exists"), "creating mailbox")
+			}
+			xcheckf(ctx, err, "creating mailbox")
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+}
+
+// MailboxDelete deletes a mailbox and all its messages.
+func (Webmail) MailboxDelete(ctx context.Context, mailboxID int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	// Messages to remove after having broadcasted the removal of messages.
+	var removeMessageIDs []int64
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb := xmailboxID(ctx, tx, mailboxID)
+			if mb.Name == "Inbox" {
+				// Inbox is special in IMAP and cannot be removed.
+				xcheckuserf(ctx, errors.New("cannot remove special Inbox"), "checking mailbox")
+			}
+
+			var hasChildren bool
+			var err error
+			changes, removeMessageIDs, hasChildren, err = acc.MailboxDelete(ctx, log, tx, mb)
+			if hasChildren {
+				xcheckuserf(ctx, errors.New("mailbox has children"), "deleting mailbox")
+			}
+			xcheckf(ctx, err, "deleting mailbox")
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+
+	for _, mID := range removeMessageIDs {
+		p := acc.MessagePath(mID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file for mailbox delete", slog.String("path", p))
+	}
+}
+
+// MailboxEmpty empties a mailbox, removing all messages from the mailbox, but not
+// its child mailboxes.
+func (Webmail) MailboxEmpty(ctx context.Context, mailboxID int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	var expunged []store.Message
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mb := xmailboxID(ctx, tx, mailboxID)
+
+			modseq, err := acc.NextModSeq(tx)
+			xcheckf(ctx, err, "next modseq")
+
+			// Mark messages as expunged.
+			qm := bstore.QueryTx[store.Message](tx)
+			qm.FilterNonzero(store.Message{MailboxID: mb.ID})
+			qm.FilterEqual("Expunged", false)
+			qm.SortAsc("UID")
+			qm.Gather(&expunged)
+			_, err = qm.UpdateNonzero(store.Message{ModSeq: modseq, Expunged: true})
+			xcheckf(ctx, err, "deleting messages")
+
+			// Remove Recipients.
+			anyIDs := make([]any, len(expunged))
+			for i, m := range expunged {
+				anyIDs[i] = m.ID
+			}
+			qmr := bstore.QueryTx[store.Recipient](tx)
+			qmr.FilterEqual("MessageID", anyIDs...)
+			_, err = qmr.Delete()
+			xcheckf(ctx, err, "removing message recipients")
+
+			// Adjust mailbox counts, gather UIDs for broadcasted change, prepare for untraining.
+			var totalSize int64
+			uids := make([]store.UID, len(expunged))
+			for i, m := range expunged {
+				m.Expunged = false // Gather returns updated values.
+				mb.Sub(m.MailboxCounts())
+				totalSize += m.Size
+				uids[i] = m.UID
+
+				expunged[i].Junk = false
+				expunged[i].Notjunk = false
+			}
+
+			err = tx.Update(&mb)
+			xcheckf(ctx, err, "updating mailbox for counts")
+
+			err = acc.AddMessageSize(log, tx, -totalSize)
+			xcheckf(ctx, err, "updating disk usage")
+
+			err = acc.RetrainMessages(ctx, log, tx, expunged, true)
+			xcheckf(ctx, err, "retraining expunged messages")
+
+			chremove := store.ChangeRemoveUIDs{MailboxID: mb.ID, UIDs: uids, ModSeq: modseq}
+			changes = []store.Change{chremove, mb.ChangeCounts()}
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+
+	for _, m := range expunged {
+		p := acc.MessagePath(m.ID)
+		err := os.Remove(p)
+		log.Check(err, "removing message file after emptying mailbox", slog.String("path", p))
+	}
+}
+
+// MailboxRename renames a mailbox, possibly moving it to a new parent. The mailbox
+// ID and its messages are unchanged.
+func (Webmail) MailboxRename(ctx context.Context, mailboxID int64, newName string) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	// Renaming Inbox is special for IMAP. For IMAP we have to implement it per the
+	// standard. We can just say no.
+	newName, _, err = store.CheckMailboxName(newName, false)
+	xcheckuserf(ctx, err, "checking new mailbox name")
+
+	acc.WithWLock(func() {
+		var changes []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			mbsrc := xmailboxID(ctx, tx, mailboxID)
+			var err error
+			var isInbox, notExists, alreadyExists bool
+			changes, isInbox, notExists, alreadyExists, err = acc.MailboxRename(tx, mbsrc, newName)
+			if isInbox || notExists || alreadyExists {
+				xcheckuserf(ctx, err, "renaming mailbox")
+			}
+			xcheckf(ctx, err, "renaming mailbox")
+		})
+
+		store.BroadcastChanges(acc, changes)
+	})
+}
+
+// CompleteRecipient returns autocomplete matches for a recipient, returning the
+// matches, contacts from the address book first, then previous recipients with
+// most recently used first, and whether this is the full list and further
+// requests for longer prefixes aren't necessary.
+func (Webmail) CompleteRecipient(ctx context.Context, search string) ([]string, bool) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	search = strings.ToLower(search)
+
+	var matches []string
+	all := true
+	acc.WithRLock(func() {
+		xdbread(ctx, acc, func(tx *bstore.Tx) {
+			type key struct {
+				localpart smtp.Localpart
+				domain    string
+			}
+			seen := map[key]bool{}
+
+			// Contacts match on name and email addresses.
+			err := bstore.QueryTx[store.Contact](tx).SortAsc("Name").ForEach(func(c store.Contact) error {
+				nameMatch := strings.Contains(strings.ToLower(c.Name), search)
+				for _, e := range c.Emails {
+					if !nameMatch && !strings.Contains(e, search) {
+						continue
+					}
+					addr, err := smtp.ParseAddress(e)
+					if err != nil {
+						continue
+					}
+					k := key{addr.Localpart, addr.Domain.Name()}
+					if seen[k] {
+						continue
+					}
+					if len(matches) >= 20 {
+						all = false
+						return bstore.StopForEach
+					}
+					matches = append(matches, addressString(message.Address{Name: c.Name, User: addr.Localpart.String(), Host: addr.Domain.ASCII}, false))
+					seen[k] = true
+				}
+				return nil
+			})
+			xcheckf(ctx, err, "listing contacts")
+			if !all {
+				return
+			}
+
+			q := bstore.QueryTx[store.Recipient](tx)
+			q.SortDesc("Sent")
+			err = q.ForEach(func(r store.Recipient) error {
+				k := key{r.Localpart, r.Domain}
+				if seen[k] {
+					return nil
+				}
+				// todo: we should have the address including name available in the database for searching. Will result in better matching, and also for the name.
+				address := fmt.Sprintf("<%s@%s>", r.Localpart.String(), r.Domain)
+				if !strings.Contains(strings.ToLower(address), search) {
+					return nil
+				}
+				if len(matches) >= 20 {
+					all = false
+					return bstore.StopForEach
+				}
+
+				// Look in the message that was sent for a name along with the address.
+				m := store.Message{ID: r.MessageID}
+				err := tx.Get(&m)
+				xcheckf(ctx, err, "get sent message")
+				if !m.Expunged && m.ParsedBuf != nil {
+					var part message.Part
+					err := json.Unmarshal(m.ParsedBuf, &part)
+					xcheckf(ctx, err, "parsing part")
+
+					dom, err := dns.ParseDomain(r.Domain)
+					xcheckf(ctx, err, "parsing domain of recipient")
+
+					var found bool
+					lp := r.Localpart.String()
+					checkAddrs := func(l []message.Address) {
+						if found {
+							return
+						}
+						for _, a := range l {
+							if a.Name != "" && a.User == lp && strings.EqualFold(a.Host, dom.ASCII) {
+								found = true
+								address = addressString(a, false)
+								return
+							}
+						}
+					}
+					if part.Envelope != nil {
+						env := part.Envelope
+						checkAddrs(env.To)
+						checkAddrs(env.CC)
+						checkAddrs(env.BCC)
+					}
+				}
+
+				matches = append(matches, address)
+				seen[k] = true
+				return nil
+			})
+			xcheckf(ctx, err, "listing recipients")
+		})
+	})
+	return matches, all
+}
+
+// Contact is an entry in the address book, with the fields that can be edited in
+// webmail. Contacts are stored as vCard, other properties, e.g. added by CardDAV
+// clients, are kept when saving.
+type Contact struct {
+	ID     int64 // Zero for a new contact.
+	Name   string
+	Emails []string
+	Phones []string
+	Note   string
+}
+
+// ContactList returns all contacts in the address book, sorted by name.
+func (Webmail) ContactList(ctx context.Context) []Contact {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	l := []Contact{}
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		err := bstore.QueryTx[store.Contact](tx).SortAsc("Name").ForEach(func(c store.Contact) error {
+			card, err := vcard.Parse(c.VCard)
+			if err != nil {
+				log.Errorx("parsing stored vcard", err, slog.Int64("contactid", c.ID))
+				return nil
+			}
+			l = append(l, Contact{c.ID, c.Name, card.Texts("EMAIL"), card.Texts("TEL"), card.Text("NOTE")})
+			return nil
+		})
+		xcheckf(ctx, err, "listing contacts")
+	})
+	return l
+}
+
+// ContactSave adds a new contact to the address book if its ID is zero, or
+// updates an existing contact. The saved contact is returned.
+func (Webmail) ContactSave(ctx context.Context, contact Contact) Contact {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	contact.Name = strings.TrimSpace(contact.Name)
+	if contact.Name == "" {
+		xcheckuserf(ctx, errors.New("name required"), "checking contact")
+	}
+	clean := func(l []string) []string {
+		var r []string
+		for _, s := range l {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+	contact.Emails = clean(contact.Emails)
+	contact.Phones = clean(contact.Phones)
+	for _, e := range contact.Emails {
+		_, err := smtp.ParseAddress(e)
+		xcheckuserf(ctx, err, "parsing email address %q", e)
+	}
+
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		var card *vcard.Card
+		var resource string
+		if contact.ID == 0 {
+			var buf [16]byte
+			_, err := cryptorand.Read(buf[:])
+			xcheckf(ctx, err, "generating uid")
+			buf[6] = buf[6]&0x0f | 0x40 // Version 4, random.
+			buf[8] = buf[8]&0x3f | 0x80 // Variant.
+			uuid := fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+			card = vcard.New("urn:uuid:"+uuid, contact.Name)
+			resource = uuid + ".vcf"
+		} else {
+			c := store.Contact{ID: contact.ID}
+			err := tx.Get(&c)
+			if err == bstore.ErrAbsent {
+				xcheckuserf(ctx, err, "get contact")
+			}
+			xcheckf(ctx, err, "get contact")
+			card, err = vcard.Parse(c.VCard)
+			xcheckf(ctx, err, "parsing stored vcard")
+			card.SetText("FN", contact.Name)
+			resource = c.Resource
+		}
+		card.SetTexts("EMAIL", contact.Emails)
+		card.SetTexts("TEL", contact.Phones)
+		card.SetText("NOTE", contact.Note)
+
+		c, _, err := store.ContactPut(tx, resource, card.String())
+		xcheckf(ctx, err, "storing contact")
+		contact.ID = c.ID
+	})
+	return contact
+}
+
+// ContactDelete removes a contact from the address book.
+func (Webmail) ContactDelete(ctx context.Context, contactID int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		c := store.Contact{ID: contactID}
+		err := tx.Get(&c)
+		if err == bstore.ErrAbsent {
+			xcheckuserf(ctx, err, "get contact")
+		}
+		xcheckf(ctx, err, "get contact")
+		err = store.ContactRemove(tx, c)
+		xcheckf(ctx, err, "removing contact")
+	})
+}
+
+// xinvite returns the calendar in the text/calendar part at partPath of a message.
+func xinvite(ctx context.Context, log mlog.Log, acc *store.Account, messageID int64, partPath []int) (cal *message.Calendar) {
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		m := xmessageID(ctx, tx, messageID)
+		msgr := acc.MessageReader(m)
+		defer func() {
+			err := msgr.Close()
+			log.Check(err, "closing message reader")
+		}()
+		p, err := m.LoadPart(msgr)
+		xcheckf(ctx, err, "load parsed message")
+		for _, i := range partPath {
+			if i < 0 || i >= len(p.Parts) {
+				xcheckuserf(ctx, errors.New("unknown part"), "looking up calendar part")
+			}
+			p = p.Parts[i]
+		}
+		if p.MediaType != "TEXT" || p.MediaSubType != "CALENDAR" {
+			xcheckuserf(ctx, errors.New("not a text/calendar part"), "looking up calendar part")
+		}
+		buf, err := io.ReadAll(&beaconio.LimitReader{R: p.ReaderUTF8OrBinary(), Limit: 1024 * 1024})
+		xcheckf(ctx, err, "reading calendar part")
+		cal, err = message.ParseCalendar(buf)
+		xcheckuserf(ctx, err, "parsing calendar part")
+	})
+	return
 }
 
-// MessageMove moves messages to another mailbox. If the message is already in
-// the mailbox an error is returned.
-func (Webmail) MessageMove(ctx context.Context, messageIDs []int64, mailboxID int64) {
+// CalendarReply answers a meeting invitation in the text/calendar part at
+// partPath of a message, with participation status "ACCEPTED", "TENTATIVE" or
+// "DECLINED", and an optional comment for the organizer. The reply (iMIP) is sent
+// to the organizer through the regular submission, from the address of this
+// account that was invited, and is added to the Sent mailbox.
+func (w Webmail) CalendarReply(ctx context.Context, messageID int64, partPath []int, partStat, comment string) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+
+	// Subject prefix and text for the reply.
+	replies := map[string][2]string{
+		"ACCEPTED":  {"Accepted", "accepted"},
+		"TENTATIVE": {"Tentative", "tentatively accepted"},
+		"DECLINED":  {"Declined", "declined"},
+	}
+	replyText, ok := replies[partStat]
+	if !ok {
+		xcheckuserf(ctx, fmt.Errorf("unknown participation status %q", partStat), "checking reply")
+	}
+
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
 	xcheckf(ctx, err, "open account")
 	defer func() {
@@ -742,128 +2369,135 @@ func (Webmail) MessageMove(ctx context.Context, messageIDs []int64, mailboxID in
 		log.Check(err, "closing account")
 	}()
 
-	acc.WithRLock(func() {
-		retrain := make([]store.Message, 0, len(messageIDs))
-		removeChanges := map[int64]store.ChangeRemoveUIDs{}
-		// n adds, 1 remove, 2 mailboxcounts, optimistic and at least for a single message.
-		changes := make([]store.Change, 0, len(messageIDs)+3)
-
-		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			var mbSrc store.Mailbox
-			var modseq store.ModSeq
-
-			mbDst := xmailboxID(ctx, tx, mailboxID)
-
-			if len(messageIDs) == 0 {
-				return
-			}
-
-			keywords := map[string]struct{}{}
-
-			for _, mid := range messageIDs {
-				m := xmessageID(ctx, tx, mid)
-
-				// We may have loaded this mailbox in the previous iteration of this loop.
-				if m.MailboxID != mbSrc.ID {
-					if mbSrc.ID != 0 {
-						err = tx.Update(&mbSrc)
-						xcheckf(ctx, err, "updating source mailbox counts")
-						changes = append(changes, mbSrc.ChangeCounts())
-					}
-					mbSrc = xmailboxID(ctx, tx, m.MailboxID)
-				}
-
-				if mbSrc.ID == mailboxID {
-					// Client should filter out messages that are already in mailbox.
-					xcheckuserf(ctx, errors.New("already in destination mailbox"), "moving message")
-				}
+	cal := xinvite(ctx, log, acc, messageID, partPath)
+	if cal.Method != "REQUEST" || len(cal.Events) == 0 {
+		xcheckuserf(ctx, errors.New("not an invitation"), "checking calendar")
+	}
+	ev := cal.Events[0]
+	if ev.Organizer.Address == "" {
+		xcheckuserf(ctx, errors.New("invitation without organizer"), "checking calendar")
+	}
 
-				if modseq == 0 {
-					modseq, err = acc.NextModSeq(tx)
-					xcheckf(ctx, err, "assigning next modseq")
-				}
+	// Find the attendee for this account.
+	var attendee *message.CalendarAddress
+	for _, a := range ev.Attendees {
+		addr, err := smtp.ParseAddress(a.Address)
+		if err != nil {
+			continue
+		}
+		accName, _, _, err := beacon.FindAccount(addr.Localpart, addr.Domain, false)
+		if err == nil && accName == reqInfo.AccountName {
+			attendee = &a
+			break
+		}
+	}
+	if attendee == nil {
+		xcheckuserf(ctx, errors.New("no attendee with address of this account"), "checking calendar")
+	}
 
-				ch := removeChanges[m.MailboxID]
-				ch.UIDs = append(ch.UIDs, m.UID)
-				ch.ModSeq = modseq
-				ch.MailboxID = m.MailboxID
-				removeChanges[m.MailboxID] = ch
+	reply, err := cal.Reply(ev.UID, message.CalendarAddress{Address: attendee.Address, Name: attendee.Name}, partStat, comment, "-//beacon//webmail "+beaconvar.Version+"//EN", time.Now())
+	xcheckf(ctx, err, "composing calendar reply")
 
-				// Copy of message record that we'll insert when UID is freed up.
-				om := m
-				om.PrepareExpunge()
-				om.ID = 0 // Assign new ID.
-				om.ModSeq = modseq
+	who := attendee.Name
+	if who == "" {
+		who = attendee.Address
+	}
+	text := fmt.Sprintf("%s has %s the invitation.\n", who, replyText[1])
+	if comment != "" {
+		text += "\n" + comment + "\n"
+	}
+	text = withSignature(text, xsettings(ctx, acc).Signature)
+	m := SubmitMessage{
+		From:              (&mail.Address{Name: attendee.Name, Address: attendee.Address}).String(),
+		To:                []string{(&mail.Address{Name: ev.Organizer.Name, Address: ev.Organizer.Address}).String()},
+		Subject:           replyText[0] + ": " + ev.Summary,
+		TextBody:          text,
+		ResponseMessageID: messageID,
+	}
+	w.submit(ctx, m, reply, false)
 
-				mbSrc.Sub(m.MailboxCounts())
+	// Remember the reply, for recognizing updated and cancelled invitations.
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		for _, e := range cal.Events {
+			if e.UID != ev.UID {
+				continue
+			}
+			cr, err := bstore.QueryTx[store.CalendarReply](tx).FilterNonzero(store.CalendarReply{UID: e.UID}).FilterEqual("RecurrenceID", e.RecurrenceID).Get()
+			if err == bstore.ErrAbsent {
+				cr = store.CalendarReply{UID: e.UID, RecurrenceID: e.RecurrenceID}
+			} else {
+				xcheckf(ctx, err, "looking up earlier calendar reply")
+			}
+			cr.Sequence = e.Sequence
+			cr.PartStat = partStat
+			cr.Attendee = attendee.Address
+			cr.Sent = time.Now()
+			if cr.ID == 0 {
+				err = tx.Insert(&cr)
+			} else {
+				err = tx.Update(&cr)
+			}
+			xcheckf(ctx, err, "storing calendar reply")
+		}
+	})
+}
 
-				if mbDst.Trash {
-					m.Seen = true
-				}
-				conf, _ := acc.Conf()
-				m.MailboxID = mbDst.ID
-				if m.IsReject && m.MailboxDestinedID != 0 {
-					// Incorrectly delivered to Rejects mailbox. Adjust MailboxOrigID so this message
-					// is used for reputation calculation during future deliveries.
-					m.MailboxOrigID = m.MailboxDestinedID
-					m.IsReject = false
-					m.Seen = false
-				}
-				m.UID = mbDst.UIDNext
-				m.ModSeq = modseq
-				mbDst.UIDNext++
-				m.JunkFlagsForMailbox(mbDst, conf)
-				err = tx.Update(&m)
-				xcheckf(ctx, err, "updating moved message in database")
+// InviteStatus is the state of an invitation or cancellation, compared with the
+// most recent reply sent from webmail for the event.
+type InviteStatus struct {
+	PartStat  string    // Of the most recent reply for the event, e.g. "ACCEPTED". Empty if not answered.
+	Replied   time.Time // Zero if not answered.
+	Updated   bool      // If the invitation is newer than the answered event, e.g. with a changed time, and should be answered again.
+	Cancelled bool      // If the organizer cancelled the event.
+}
 
-				// Now that UID is unused, we can insert the old record again.
-				err = tx.Insert(&om)
-				xcheckf(ctx, err, "inserting record for expunge after moving message")
+// InviteStatuses returns the status for each invitation in a message, in the
+// order of ParsedMessage.Invites.
+func (Webmail) InviteStatuses(ctx context.Context, messageID int64) []InviteStatus {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
 
-				mbDst.Add(m.MailboxCounts())
+	var m store.Message
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		m = xmessageID(ctx, tx, messageID)
+	})
 
-				changes = append(changes, m.ChangeAddUID())
-				retrain = append(retrain, m)
+	state := msgState{acc: acc}
+	defer state.clear()
+	pm, err := parsedMessage(log, m, &state, true, false)
+	xcheckf(ctx, err, "parsing message")
 
-				for _, kw := range m.Keywords {
-					keywords[kw] = struct{}{}
-				}
+	l := make([]InviteStatus, len(pm.Invites))
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		for i, inv := range pm.Invites {
+			if len(inv.Calendar.Events) == 0 {
+				continue
 			}
-
-			err = tx.Update(&mbSrc)
-			xcheckf(ctx, err, "updating source mailbox counts")
-
-			changes = append(changes, mbSrc.ChangeCounts(), mbDst.ChangeCounts())
-
-			// Ensure destination mailbox has keywords of the moved messages.
-			var mbKwChanged bool
-			mbDst.Keywords, mbKwChanged = store.MergeKeywords(mbDst.Keywords, maps.Keys(keywords))
-			if mbKwChanged {
-				changes = append(changes, mbDst.ChangeKeywords())
+			ev := inv.Calendar.Events[0]
+			st := InviteStatus{Cancelled: inv.Calendar.Method == "CANCEL" || ev.Status == "CANCELLED"}
+			cr, err := bstore.QueryTx[store.CalendarReply](tx).FilterNonzero(store.CalendarReply{UID: ev.UID}).FilterEqual("RecurrenceID", ev.RecurrenceID).Get()
+			if err == nil {
+				st.PartStat = cr.PartStat
+				st.Replied = cr.Sent
+				st.Updated = inv.Calendar.Method == "REQUEST" && ev.Sequence > cr.Sequence
+			} else if err != bstore.ErrAbsent {
+				xcheckf(ctx, err, "looking up calendar reply")
 			}
-
-			err = tx.Update(&mbDst)
-			xcheckf(ctx, err, "updating mailbox with uidnext")
-
-			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
-			xcheckf(ctx, err, "retraining messages after move")
-		})
-
-		// Ensure UIDs of the removed message are in increasing order. It is quite common
-		// for all messages to be from a single source mailbox, meaning this is just one
-		// change, for which we preallocated space.
-		for _, ch := range removeChanges {
-			sort.Slice(ch.UIDs, func(i, j int) bool {
-				return ch.UIDs[i] < ch.UIDs[j]
-			})
-			changes = append(changes, ch)
+			l[i] = st
 		}
-		store.BroadcastChanges(acc, changes)
 	})
+	return l
 }
 
-// MessageDelete permanently deletes messages, without moving them to the Trash mailbox.
-func (Webmail) MessageDelete(ctx context.Context, messageIDs []int64) {
+// Settings returns the webmail settings of the account. They are also sent in
+// the start event of the SSE connection.
+func (Webmail) Settings(ctx context.Context) store.Settings {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -873,95 +2507,129 @@ func (Webmail) MessageDelete(ctx context.Context, messageIDs []int64) {
 		log.Check(err, "closing account")
 	}()
 
-	if len(messageIDs) == 0 {
-		return
+	return xsettings(ctx, acc)
+}
+
+// SettingsSave saves the webmail settings of the account. Other sessions of the
+// account get the new settings in a ChangeSettings event.
+func (Webmail) SettingsSave(ctx context.Context, settings store.Settings) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	settings.ID = 1
+	switch settings.Quoting {
+	case store.Default, store.Bottom, store.Top:
+	default:
+		xcheckuserf(ctx, fmt.Errorf("unknown quoting %q", settings.Quoting), "checking settings")
+	}
+	switch settings.Layout {
+	case "auto", "leftright", "topbottom":
+	default:
+		xcheckuserf(ctx, fmt.Errorf("unknown layout %q", settings.Layout), "checking settings")
+	}
+	switch ThreadMode(settings.Threading) {
+	case ThreadOff, ThreadOn, ThreadUnread:
+	default:
+		xcheckuserf(ctx, fmt.Errorf("unknown threading mode %q", settings.Threading), "checking settings")
+	}
+	if settings.SendDelay < 0 || settings.SendDelay > 300 {
+		xcheckuserf(ctx, fmt.Errorf("send delay must be between 0 and 300 seconds"), "checking settings")
+	}
+	if settings.DefaultFrom != "" {
+		for _, c := range settings.DefaultFrom {
+			if c < 0x20 {
+				xcheckuserf(ctx, errors.New("control characters not allowed"), "checking default from address")
+			}
+		}
+		addr, err := parseAddress(settings.DefaultFrom)
+		xcheckuserf(ctx, err, "parsing default from address")
+		accName, _, _, err := beacon.FindAccount(addr.Address.Localpart, addr.Address.Domain, false)
+		if err == nil && accName != reqInfo.AccountName {
+			err = beacon.ErrAccountNotFound
+		}
+		if err != nil && (errors.Is(err, beacon.ErrAccountNotFound) || errors.Is(err, beacon.ErrDomainNotFound)) {
+			xcheckuserf(ctx, errors.New("address not found"), "looking up default from address for account")
+		}
+		xcheckf(ctx, err, "checking default from address")
+	}
+	if settings.ShowHeaders == nil {
+		settings.ShowHeaders = []string{}
 	}
 
 	acc.WithWLock(func() {
-		removeChanges := map[int64]store.ChangeRemoveUIDs{}
-		changes := make([]store.Change, 0, len(messageIDs)+1) // n remove, 1 mailbox counts
-
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			var modseq store.ModSeq
-			var mb store.Mailbox
-			remove := make([]store.Message, 0, len(messageIDs))
-
-			var totalSize int64
-			for _, mid := range messageIDs {
-				m := xmessageID(ctx, tx, mid)
-				totalSize += m.Size
-
-				if m.MailboxID != mb.ID {
-					if mb.ID != 0 {
-						err := tx.Update(&mb)
-						xcheckf(ctx, err, "updating mailbox counts")
-						changes = append(changes, mb.ChangeCounts())
-					}
-					mb = xmailboxID(ctx, tx, m.MailboxID)
-				}
-
-				qmr := bstore.QueryTx[store.Recipient](tx)
-				qmr.FilterEqual("MessageID", m.ID)
-				_, err = qmr.Delete()
-				xcheckf(ctx, err, "removing message recipients")
-
-				mb.Sub(m.MailboxCounts())
-
-				if modseq == 0 {
-					modseq, err = acc.NextModSeq(tx)
-					xcheckf(ctx, err, "assigning next modseq")
-				}
-				m.Expunged = true
-				m.ModSeq = modseq
-				err = tx.Update(&m)
-				xcheckf(ctx, err, "marking message as expunged")
-
-				ch := removeChanges[m.MailboxID]
-				ch.UIDs = append(ch.UIDs, m.UID)
-				ch.MailboxID = m.MailboxID
-				ch.ModSeq = modseq
-				removeChanges[m.MailboxID] = ch
-				remove = append(remove, m)
+			err := tx.Get(&store.Settings{ID: 1})
+			if err == bstore.ErrAbsent {
+				err = tx.Insert(&settings)
+				xcheckf(ctx, err, "inserting settings")
+				return
 			}
+			xcheckf(ctx, err, "get settings")
+			err = tx.Update(&settings)
+			xcheckf(ctx, err, "updating settings")
+		})
 
-			if mb.ID != 0 {
-				err := tx.Update(&mb)
-				xcheckf(ctx, err, "updating count in mailbox")
-				changes = append(changes, mb.ChangeCounts())
-			}
+		store.BroadcastChanges(acc, []store.Change{store.ChangeSettings{Settings: settings}})
+	})
+}
 
-			err = acc.AddMessageSize(log, tx, -totalSize)
-			xcheckf(ctx, err, "updating disk usage")
+var labelColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
 
-			// Mark removed messages as not needing training, then retrain them, so if they
-			// were trained, they get untrained.
-			for i := range remove {
-				remove[i].Junk = false
-				remove[i].Notjunk = false
-			}
-			err = acc.RetrainMessages(ctx, log, tx, remove, true)
-			xcheckf(ctx, err, "untraining deleted messages")
-		})
+// xchecklabel normalizes and checks the fields of a label. Without keyword, the
+// lower-cased name is used as keyword.
+func xchecklabel(ctx context.Context, l *store.Label) {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		xcheckuserf(ctx, errors.New("name required"), "checking label")
+	}
+	l.Keyword = strings.ToLower(strings.TrimSpace(l.Keyword))
+	if l.Keyword == "" {
+		l.Keyword = strings.ToLower(l.Name)
+	}
+	err := store.CheckKeyword(l.Keyword)
+	xcheckuserf(ctx, err, "checking label keyword")
+	if l.Color != "" && !labelColorRegexp.MatchString(l.Color) {
+		xcheckuserf(ctx, errors.New(`color must be of the form "#rrggbb"`), "checking label color")
+	}
+}
 
-		for _, ch := range removeChanges {
-			sort.Slice(ch.UIDs, func(i, j int) bool {
-				return ch.UIDs[i] < ch.UIDs[j]
-			})
-			changes = append(changes, ch)
-		}
-		store.BroadcastChanges(acc, changes)
-	})
+// xlabelsChange returns a change with all labels, for broadcasting after a
+// label was modified.
+func xlabelsChange(ctx context.Context, tx *bstore.Tx) store.ChangeLabels {
+	labels, err := bstore.QueryTx[store.Label](tx).SortAsc("Name").List()
+	xcheckf(ctx, err, "listing labels")
+	return store.ChangeLabels{Labels: labels}
+}
+
+// xlabelID returns the label with the ID, or aborts with a user error.
+func xlabelID(ctx context.Context, tx *bstore.Tx, labelID int64) store.Label {
+	l := store.Label{ID: labelID}
+	err := tx.Get(&l)
+	if err == bstore.ErrAbsent {
+		xcheckuserf(ctx, err, "get label")
+	}
+	xcheckf(ctx, err, "get label")
+	return l
+}
 
-	for _, mID := range messageIDs {
-		p := acc.MessagePath(mID)
-		err := os.Remove(p)
-		log.Check(err, "removing message file for expunge")
+// xlabelUpdate stores a modified label, with a user error if its name or keyword
+// is already in use by another label.
+func xlabelUpdate(ctx context.Context, tx *bstore.Tx, l *store.Label) {
+	err := tx.Update(l)
+	if errors.Is(err, bstore.ErrUnique) {
+		xcheckuserf(ctx, errors.New("label with name or keyword already exists"), "updating label")
 	}
+	xcheckf(ctx, err, "updating label")
 }
 
-// FlagsAdd adds flags, either system flags like \Seen or custom keywords. The
-// flags should be lower-case, but will be converted and verified.
-func (Webmail) FlagsAdd(ctx context.Context, messageIDs []int64, flaglist []string) {
+// Labels returns the labels of the account, sorted by name.
+func (Webmail) Labels(ctx context.Context) []store.Label {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -971,80 +2639,18 @@ func (Webmail) FlagsAdd(ctx context.Context, messageIDs []int64, flaglist []stri
 		log.Check(err, "closing account")
 	}()
 
-	flags, keywords, err := store.ParseFlagsKeywords(flaglist)
-	xcheckuserf(ctx, err, "parsing flags")
-
-	acc.WithRLock(func() {
-		var changes []store.Change
-
-		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			var modseq store.ModSeq
-			var retrain []store.Message
-			var mb, origmb store.Mailbox
-
-			for _, mid := range messageIDs {
-				m := xmessageID(ctx, tx, mid)
-
-				if mb.ID != m.MailboxID {
-					if mb.ID != 0 {
-						err := tx.Update(&mb)
-						xcheckf(ctx, err, "updating mailbox")
-						if mb.MailboxCounts != origmb.MailboxCounts {
-							changes = append(changes, mb.ChangeCounts())
-						}
-						if mb.KeywordsChanged(origmb) {
-							changes = append(changes, mb.ChangeKeywords())
-						}
-					}
-					mb = xmailboxID(ctx, tx, m.MailboxID)
-					origmb = mb
-				}
-				mb.Keywords, _ = store.MergeKeywords(mb.Keywords, keywords)
-
-				mb.Sub(m.MailboxCounts())
-				oflags := m.Flags
-				m.Flags = m.Flags.Set(flags, flags)
-				var kwChanged bool
-				m.Keywords, kwChanged = store.MergeKeywords(m.Keywords, keywords)
-				mb.Add(m.MailboxCounts())
-
-				if m.Flags == oflags && !kwChanged {
-					continue
-				}
-
-				if modseq == 0 {
-					modseq, err = acc.NextModSeq(tx)
-					xcheckf(ctx, err, "assigning next modseq")
-				}
-				m.ModSeq = modseq
-				err = tx.Update(&m)
-				xcheckf(ctx, err, "updating message")
-
-				changes = append(changes, m.ChangeFlags(oflags))
-				retrain = append(retrain, m)
-			}
-
-			if mb.ID != 0 {
-				err := tx.Update(&mb)
-				xcheckf(ctx, err, "updating mailbox")
-				if mb.MailboxCounts != origmb.MailboxCounts {
-					changes = append(changes, mb.ChangeCounts())
-				}
-				if mb.KeywordsChanged(origmb) {
-					changes = append(changes, mb.ChangeKeywords())
-				}
-			}
-
-			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
-			xcheckf(ctx, err, "retraining messages")
-		})
-
-		store.BroadcastChanges(acc, changes)
+	var labels []store.Label
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		labels, err = bstore.QueryTx[store.Label](tx).SortAsc("Name").List()
+		xcheckf(ctx, err, "listing labels")
 	})
+	return labels
 }
 
-// FlagsClear clears flags, either system flags like \Seen or custom keywords.
-func (Webmail) FlagsClear(ctx context.Context, messageIDs []int64, flaglist []string) {
+// LabelCreate adds a label for a keyword, with a name and color for display. If
+// keyword is empty, the lower-cased name is used. Color is of the form "#rrggbb",
+// or empty for the default color.
+func (Webmail) LabelCreate(ctx context.Context, name, keyword, color string) store.Label {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -1054,75 +2660,29 @@ func (Webmail) FlagsClear(ctx context.Context, messageIDs []int64, flaglist []st
 		log.Check(err, "closing account")
 	}()
 
-	flags, keywords, err := store.ParseFlagsKeywords(flaglist)
-	xcheckuserf(ctx, err, "parsing flags")
+	l := store.Label{Name: name, Keyword: keyword, Color: color}
+	xchecklabel(ctx, &l)
 
 	acc.WithRLock(func() {
-		var retrain []store.Message
 		var changes []store.Change
 
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			var modseq store.ModSeq
-			var mb, origmb store.Mailbox
-
-			for _, mid := range messageIDs {
-				m := xmessageID(ctx, tx, mid)
-
-				if mb.ID != m.MailboxID {
-					if mb.ID != 0 {
-						err := tx.Update(&mb)
-						xcheckf(ctx, err, "updating counts for mailbox")
-						if mb.MailboxCounts != origmb.MailboxCounts {
-							changes = append(changes, mb.ChangeCounts())
-						}
-						// note: cannot remove keywords from mailbox by removing keywords from message.
-					}
-					mb = xmailboxID(ctx, tx, m.MailboxID)
-					origmb = mb
-				}
-
-				oflags := m.Flags
-				mb.Sub(m.MailboxCounts())
-				m.Flags = m.Flags.Set(flags, store.Flags{})
-				var changed bool
-				m.Keywords, changed = store.RemoveKeywords(m.Keywords, keywords)
-				mb.Add(m.MailboxCounts())
-
-				if m.Flags == oflags && !changed {
-					continue
-				}
-
-				if modseq == 0 {
-					modseq, err = acc.NextModSeq(tx)
-					xcheckf(ctx, err, "assigning next modseq")
-				}
-				m.ModSeq = modseq
-				err = tx.Update(&m)
-				xcheckf(ctx, err, "updating message")
-
-				changes = append(changes, m.ChangeFlags(oflags))
-				retrain = append(retrain, m)
-			}
-
-			if mb.ID != 0 {
-				err := tx.Update(&mb)
-				xcheckf(ctx, err, "updating keywords in mailbox")
-				if mb.MailboxCounts != origmb.MailboxCounts {
-					changes = append(changes, mb.ChangeCounts())
-				}
-				// note: cannot remove keywords from mailbox by removing keywords from message.
+			err := tx.Insert(&l)
+			if errors.Is(err, bstore.ErrUnique) {
+				xcheckuserf(ctx, errors.New("label with name or keyword already exists"), "adding label")
 			}
-
-			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
-			xcheckf(ctx, err, "retraining messages")
+			xcheckf(ctx, err, "adding label")
+			changes = append(changes, xlabelsChange(ctx, tx))
 		})
 
 		store.BroadcastChanges(acc, changes)
 	})
+	return l
 }
 
-// MailboxCreate creates a new mailbox.
-func (Webmail) MailboxCreate(ctx context.Context, name string) {
+// LabelRename changes the name and keyword of a label. If the keyword changes, it
+// is replaced on all messages.
+func (Webmail) LabelRename(ctx context.Context, labelID int64, name, keyword string) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -1132,27 +2692,31 @@ func (Webmail) MailboxCreate(ctx context.Context, name string) {
 		log.Check(err, "closing account")
 	}()
 
-	name, _, err = store.CheckMailboxName(name, false)
-	xcheckuserf(ctx, err, "checking mailbox name")
-
-	acc.WithWLock(func() {
+	acc.WithRLock(func() {
 		var changes []store.Change
+
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			var exists bool
-			var err error
-			changes, _, exists, err = acc.MailboxCreate(tx, name)
-			if exists {
-				xcheckuserf(ctx, errors.New("mailbox already exists"), "creating mailbox")
+			l := xlabelID(ctx, tx, labelID)
+			okeyword := l.Keyword
+			l.Name = name
+			l.Keyword = keyword
+			xchecklabel(ctx, &l)
+			xlabelUpdate(ctx, tx, &l)
+
+			if l.Keyword != okeyword {
+				changes, err = acc.KeywordReplace(tx, okeyword, l.Keyword)
+				xcheckf(ctx, err, "replacing keyword on messages")
 			}
-			xcheckf(ctx, err, "creating mailbox")
+			changes = append(changes, xlabelsChange(ctx, tx))
 		})
 
 		store.BroadcastChanges(acc, changes)
 	})
 }
 
-// MailboxDelete deletes a mailbox and all its messages.
-func (Webmail) MailboxDelete(ctx context.Context, mailboxID int64) {
+// LabelColor changes the color of a label. Color is of the form "#rrggbb", or
+// empty for the default color.
+func (Webmail) LabelColor(ctx context.Context, labelID int64, color string) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -1162,41 +2726,23 @@ func (Webmail) MailboxDelete(ctx context.Context, mailboxID int64) {
 		log.Check(err, "closing account")
 	}()
 
-	// Messages to remove after having broadcasted the removal of messages.
-	var removeMessageIDs []int64
-
-	acc.WithWLock(func() {
+	acc.WithRLock(func() {
 		var changes []store.Change
 
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			mb := xmailboxID(ctx, tx, mailboxID)
-			if mb.Name == "Inbox" {
-				// Inbox is special in IMAP and cannot be removed.
-				xcheckuserf(ctx, errors.New("cannot remove special Inbox"), "checking mailbox")
-			}
-
-			var hasChildren bool
-			var err error
-			changes, removeMessageIDs, hasChildren, err = acc.MailboxDelete(ctx, log, tx, mb)
-			if hasChildren {
-				xcheckuserf(ctx, errors.New("mailbox has children"), "deleting mailbox")
-			}
-			xcheckf(ctx, err, "deleting mailbox")
+			l := xlabelID(ctx, tx, labelID)
+			l.Color = color
+			xchecklabel(ctx, &l)
+			xlabelUpdate(ctx, tx, &l)
+			changes = append(changes, xlabelsChange(ctx, tx))
 		})
 
 		store.BroadcastChanges(acc, changes)
 	})
-
-	for _, mID := range removeMessageIDs {
-		p := acc.MessagePath(mID)
-		err := os.Remove(p)
-		log.Check(err, "removing message file for mailbox delete", slog.String("path", p))
-	}
 }
 
-// MailboxEmpty empties a mailbox, removing all messages from the mailbox, but not
-// its child mailboxes.
-func (Webmail) MailboxEmpty(ctx context.Context, mailboxID int64) {
+// LabelDelete removes a label, and its keyword from all messages.
+func (Webmail) LabelDelete(ctx context.Context, labelID int64) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -1206,75 +2752,99 @@ func (Webmail) MailboxEmpty(ctx context.Context, mailboxID int64) {
 		log.Check(err, "closing account")
 	}()
 
-	var expunged []store.Message
-
-	acc.WithWLock(func() {
+	acc.WithRLock(func() {
 		var changes []store.Change
 
 		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			mb := xmailboxID(ctx, tx, mailboxID)
-
-			modseq, err := acc.NextModSeq(tx)
-			xcheckf(ctx, err, "next modseq")
+			l := xlabelID(ctx, tx, labelID)
+			err := tx.Delete(&l)
+			xcheckf(ctx, err, "removing label")
 
-			// Mark messages as expunged.
-			qm := bstore.QueryTx[store.Message](tx)
-			qm.FilterNonzero(store.Message{MailboxID: mb.ID})
-			qm.FilterEqual("Expunged", false)
-			qm.SortAsc("UID")
-			qm.Gather(&expunged)
-			_, err = qm.UpdateNonzero(store.Message{ModSeq: modseq, Expunged: true})
-			xcheckf(ctx, err, "deleting messages")
+			changes, err = acc.KeywordReplace(tx, l.Keyword, "")
+			xcheckf(ctx, err, "removing keyword from messages")
+			changes = append(changes, xlabelsChange(ctx, tx))
+		})
 
-			// Remove Recipients.
-			anyIDs := make([]any, len(expunged))
-			for i, m := range expunged {
-				anyIDs[i] = m.ID
-			}
-			qmr := bstore.QueryTx[store.Recipient](tx)
-			qmr.FilterEqual("MessageID", anyIDs...)
-			_, err = qmr.Delete()
-			xcheckf(ctx, err, "removing message recipients")
+		store.BroadcastChanges(acc, changes)
+	})
+}
 
-			// Adjust mailbox counts, gather UIDs for broadcasted change, prepare for untraining.
-			var totalSize int64
-			uids := make([]store.UID, len(expunged))
-			for i, m := range expunged {
-				m.Expunged = false // Gather returns updated values.
-				mb.Sub(m.MailboxCounts())
-				totalSize += m.Size
-				uids[i] = m.UID
+// xresolveLabels replaces label names in the label filters, including those in
+// OR groups, with the keywords of the labels. Names are matched
+// case-insensitively. Other values, like keywords and flags, are kept.
+func xresolveLabels(ctx context.Context, tx *bstore.Tx, f *Filter, nf *NotFilter) {
+	labels, err := bstore.QueryTx[store.Label](tx).List()
+	xcheckf(ctx, err, "listing labels")
+	if len(labels) == 0 {
+		return
+	}
+	keywords := map[string]string{}
+	for _, l := range labels {
+		keywords[strings.ToLower(l.Name)] = l.Keyword
+	}
 
-				expunged[i].Junk = false
-				expunged[i].Notjunk = false
+	var resolve func(f *Filter, nf *NotFilter)
+	resolve = func(f *Filter, nf *NotFilter) {
+		for _, l := range [][]string{f.Labels, nf.Labels} {
+			for i, v := range l {
+				if kw, ok := keywords[strings.ToLower(v)]; ok {
+					l[i] = kw
+				}
 			}
+		}
+		for _, alts := range f.Or {
+			for i := range alts {
+				resolve(&alts[i].Filter, &alts[i].NotFilter)
+			}
+		}
+	}
+	resolve(f, nf)
+}
 
-			err = tx.Update(&mb)
-			xcheckf(ctx, err, "updating mailbox for counts")
-
-			err = acc.AddMessageSize(log, tx, -totalSize)
-			xcheckf(ctx, err, "updating disk usage")
-
-			err = acc.RetrainMessages(ctx, log, tx, expunged, true)
-			xcheckf(ctx, err, "retraining expunged messages")
+// SearchParse parses a search query, as typed in the search bar, into a Query.
+// See ParseSearch for the syntax. A mailbox name in the search is resolved into
+// Filter.MailboxID, and label names are resolved into their keywords.
+func (Webmail) SearchParse(ctx context.Context, search string) Query {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
 
-			chremove := store.ChangeRemoveUIDs{MailboxID: mb.ID, UIDs: uids, ModSeq: modseq}
-			changes = []store.Change{chremove, mb.ChangeCounts()}
-		})
+	q, err := ParseSearch(search)
+	xcheckuserf(ctx, err, "parsing search")
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		xresolveLabels(ctx, tx, &q.Filter, &q.NotFilter)
 
-		store.BroadcastChanges(acc, changes)
+		if q.Filter.MailboxName == "" {
+			return
+		}
+		mb, err := acc.MailboxFind(tx, q.Filter.MailboxName)
+		xcheckf(ctx, err, "looking up mailbox")
+		if mb == nil {
+			xcheckuserf(ctx, errors.New("mailbox not found"), "looking up mailbox %q", q.Filter.MailboxName)
+		}
+		q.Filter.MailboxID = mb.ID
+		q.Filter.MailboxName = ""
 	})
-
-	for _, m := range expunged {
-		p := acc.MessagePath(m.ID)
-		err := os.Remove(p)
-		log.Check(err, "removing message file after emptying mailbox", slog.String("path", p))
-	}
+	return q
+}
+
+// SavedSearchItem is a saved search with its number of unread messages, for
+// display as virtual mailbox.
+type SavedSearchItem struct {
+	ID     int64
+	Name   string
+	Search string
+	Unread int
 }
 
-// MailboxRename renames a mailbox, possibly moving it to a new parent. The mailbox
-// ID and its messages are unchanged.
-func (Webmail) MailboxRename(ctx context.Context, mailboxID int64, newName string) {
+// SavedSearches returns the saved searches of the account, sorted by name, with
+// the current number of unread messages matching each search.
+func (Webmail) SavedSearches(ctx context.Context) []SavedSearchItem {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -1283,34 +2853,68 @@ func (Webmail) MailboxRename(ctx context.Context, mailboxID int64, newName strin
 		err := acc.Close()
 		log.Check(err, "closing account")
 	}()
+	accConf, _ := acc.Conf()
 
-	// Renaming Inbox is special for IMAP. For IMAP we have to implement it per the
-	// standard. We can just say no.
-	newName, _, err = store.CheckMailboxName(newName, false)
-	xcheckuserf(ctx, err, "checking new mailbox name")
+	l := []SavedSearchItem{}
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		searches, err := bstore.QueryTx[store.SavedSearch](tx).SortAsc("Name").List()
+		xcheckf(ctx, err, "listing saved searches")
+		if len(searches) == 0 {
+			return
+		}
 
-	acc.WithWLock(func() {
-		var changes []store.Change
+		// We count unread messages by matching all unread messages against each search.
+		unread, err := bstore.QueryTx[store.Message](tx).FilterEqual("Expunged", false).FilterEqual("Seen", false).List()
+		xcheckf(ctx, err, "listing unread messages")
+		msgs := map[int64]store.Message{}
+		for _, m := range unread {
+			msgs[m.ID] = m
+		}
+		getmsg := func(messageID int64, mailboxID int64, uid store.UID) (store.Message, error) {
+			return msgs[messageID], nil
+		}
 
-		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
-			mbsrc := xmailboxID(ctx, tx, mailboxID)
-			var err error
-			var isInbox, notExists, alreadyExists bool
-			changes, isInbox, notExists, alreadyExists, err = acc.MailboxRename(tx, mbsrc, newName)
-			if isInbox || notExists || alreadyExists {
-				xcheckuserf(ctx, err, "renaming mailbox")
+		for _, ss := range searches {
+			item := SavedSearchItem{ss.ID, ss.Name, ss.Search, 0}
+			q, err := ParseSearch(ss.Search)
+			if err != nil {
+				log.Errorx("parsing saved search", err, slog.String("name", ss.Name))
+				l = append(l, item)
+				continue
 			}
-			xcheckf(ctx, err, "renaming mailbox")
-		})
-
-		store.BroadcastChanges(acc, changes)
+			xresolveLabels(ctx, tx, &q.Filter, &q.NotFilter)
+			if q.Filter.MailboxName != "" {
+				mb, err := acc.MailboxFind(tx, q.Filter.MailboxName)
+				xcheckf(ctx, err, "looking up mailbox")
+				if mb == nil {
+					// Mailbox has been removed, nothing can match.
+					l = append(l, item)
+					continue
+				}
+				q.Filter.MailboxID = mb.ID
+			}
+			matchMailboxes, mailboxIDs, mailboxPrefixes := xprepareMailboxIDs(ctx, tx, q.Filter, accConf.RejectsMailbox)
+			if q.Filter.MailboxChildrenIncluded {
+				xgatherMailboxIDs(ctx, tx, mailboxIDs, mailboxPrefixes)
+			}
+			v := view{Request: Request{Query: q}, matchMailboxIDs: matchMailboxes, mailboxIDs: mailboxIDs}
+			for _, m := range unread {
+				match, err := v.matches(log, acc, false, m.ID, m.MailboxID, m.UID, m.Flags, m.Keywords, getmsg)
+				if err != nil {
+					log.Errorx("matching message for saved search", err, slog.Int64("msgid", m.ID))
+				} else if match {
+					item.Unread++
+				}
+			}
+			l = append(l, item)
+		}
 	})
+	return l
 }
 
-// CompleteRecipient returns autocomplete matches for a recipient, returning the
-// matches, most recently used first, and whether this is the full list and further
-// requests for longer prefixes aren't necessary.
-func (Webmail) CompleteRecipient(ctx context.Context, search string) ([]string, bool) {
+// SavedSearchSave saves a search under a name, replacing the search of an
+// existing saved search with the same name.
+func (Webmail) SavedSearchSave(ctx context.Context, name, search string) {
 	log := pkglog.WithContext(ctx)
 	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
 	acc, err := store.OpenAccount(log, reqInfo.AccountName)
@@ -1320,77 +2924,49 @@ func (Webmail) CompleteRecipient(ctx context.Context, search string) ([]string,
 		log.Check(err, "closing account")
 	}()
 
-	search = strings.ToLower(search)
-
-	var matches []string
-	all := true
-	acc.WithRLock(func() {
-		xdbread(ctx, acc, func(tx *bstore.Tx) {
-			type key struct {
-				localpart smtp.Localpart
-				domain    string
-			}
-			seen := map[key]bool{}
-
-			q := bstore.QueryTx[store.Recipient](tx)
-			q.SortDesc("Sent")
-			err := q.ForEach(func(r store.Recipient) error {
-				k := key{r.Localpart, r.Domain}
-				if seen[k] {
-					return nil
-				}
-				// todo: we should have the address including name available in the database for searching. Will result in better matching, and also for the name.
-				address := fmt.Sprintf("<%s@%s>", r.Localpart.String(), r.Domain)
-				if !strings.Contains(strings.ToLower(address), search) {
-					return nil
-				}
-				if len(matches) >= 20 {
-					all = false
-					return bstore.StopForEach
-				}
-
-				// Look in the message that was sent for a name along with the address.
-				m := store.Message{ID: r.MessageID}
-				err := tx.Get(&m)
-				xcheckf(ctx, err, "get sent message")
-				if !m.Expunged && m.ParsedBuf != nil {
-					var part message.Part
-					err := json.Unmarshal(m.ParsedBuf, &part)
-					xcheckf(ctx, err, "parsing part")
+	name = strings.TrimSpace(name)
+	search = strings.TrimSpace(search)
+	if name == "" {
+		xcheckuserf(ctx, errors.New("name required"), "checking saved search")
+	}
+	if search == "" {
+		xcheckuserf(ctx, errors.New("search required"), "checking saved search")
+	}
+	_, err = ParseSearch(search)
+	xcheckuserf(ctx, err, "parsing search")
 
-					dom, err := dns.ParseDomain(r.Domain)
-					xcheckf(ctx, err, "parsing domain of recipient")
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		ss, err := bstore.QueryTx[store.SavedSearch](tx).FilterNonzero(store.SavedSearch{Name: name}).Get()
+		if err == bstore.ErrAbsent {
+			err = tx.Insert(&store.SavedSearch{Name: name, Search: search})
+			xcheckf(ctx, err, "inserting saved search")
+			return
+		}
+		xcheckf(ctx, err, "looking up saved search")
+		ss.Search = search
+		err = tx.Update(&ss)
+		xcheckf(ctx, err, "updating saved search")
+	})
+}
 
-					var found bool
-					lp := r.Localpart.String()
-					checkAddrs := func(l []message.Address) {
-						if found {
-							return
-						}
-						for _, a := range l {
-							if a.Name != "" && a.User == lp && strings.EqualFold(a.Host, dom.ASCII) {
-								found = true
-								address = addressString(a, false)
-								return
-							}
-						}
-					}
-					if part.Envelope != nil {
-						env := part.Envelope
-						checkAddrs(env.To)
-						checkAddrs(env.CC)
-						checkAddrs(env.BCC)
-					}
-				}
+// SavedSearchDelete removes a saved search.
+func (Webmail) SavedSearchDelete(ctx context.Context, savedSearchID int64) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
 
-				matches = append(matches, address)
-				seen[k] = true
-				return nil
-			})
-			xcheckf(ctx, err, "listing recipients")
-		})
+	xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+		err := tx.Delete(&store.SavedSearch{ID: savedSearchID})
+		if err == bstore.ErrAbsent {
+			xcheckuserf(ctx, err, "removing saved search")
+		}
+		xcheckf(ctx, err, "removing saved search")
 	})
-	return matches, all
 }
 
 // addressString returns an address into a string as it could be used in a message header.
@@ -1631,6 +3207,340 @@ func (Webmail) RecipientSecurity(ctx context.Context, messageAddressee string) (
 	return recipientSecurity(ctx, resolver, messageAddressee)
 }
 
+// ExportProgress returns the progress of an export started through the export
+// endpoint with progressID. Exports that were not started yet, or that finished a
+// while ago, return zero values.
+func (Webmail) ExportProgress(ctx context.Context, progressID string) ExportProgress {
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	return exportProgressGet(exportProgressKey{reqInfo.AccountName, progressID})
+}
+
+// JunkExplanation explains how the junk filter of the account classifies a
+// message.
+type JunkExplanation struct {
+	Threshold      float64 // Spam probability above which incoming messages are rejected.
+	Classification junk.Classification
+}
+
+// JunkExplain classifies a message with the current junk filter of the account,
+// returning the most hammy and spammy words that determined the probability.
+// Training since delivery may result in a different classification than at the
+// time of delivery.
+func (Webmail) JunkExplain(ctx context.Context, msgID int64) JunkExplanation {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	var m store.Message
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		m = xmessageID(ctx, tx, msgID)
+	})
+
+	mr := acc.MessageReader(m)
+	defer func() {
+		err := mr.Close()
+		log.Check(err, "closing message reader")
+	}()
+	p, err := m.LoadPart(mr)
+	xcheckf(ctx, err, "loading message part")
+
+	var x JunkExplanation
+	acc.WithRLock(func() {
+		var jf *junk.Filter
+		var conf *config.JunkFilter
+		jf, conf, err = acc.OpenJunkFilter(ctx, log)
+		if err != nil {
+			return
+		}
+		defer func() {
+			err := jf.Close()
+			log.Check(err, "closing junk filter")
+		}()
+		x.Threshold = conf.Threshold
+		x.Classification, err = jf.ExplainMessage(ctx, p)
+	})
+	if errors.Is(err, store.ErrNoJunkFilter) {
+		xcheckuserf(ctx, err, "open junk filter")
+	}
+	xcheckf(ctx, err, "classifying message")
+	return x
+}
+
+// SyncResult holds the changes to an account since a modseq, as returned by Sync.
+type SyncResult struct {
+	// ModSeq to pass in the next call to Sync.
+	ModSeq store.ModSeq
+
+	// If set, the changes since the requested modseq are not available, e.g.
+	// because the client has no state yet (modseq 0), or because the records of
+	// removed messages have been cleaned up. The client must discard its cached
+	// messages. Only Mailboxes and ModSeq are set.
+	Full bool
+
+	// All mailboxes, with their current counts. Mailboxes don't have a modseq, they
+	// are always returned in full.
+	Mailboxes []store.Mailbox
+
+	Added   []MessageItem // Messages added since modseq.
+	Changed []SyncMessage // Messages with changed flags or mailbox (when moved) since modseq.
+	Removed []int64       // IDs of messages removed since modseq. May include IDs the client doesn't know.
+
+	// If set, not all changes have been returned, Sync must be called again with
+	// ModSeq.
+	More bool
+}
+
+// SyncMessage is the current state of a message that was changed.
+type SyncMessage struct {
+	ID        int64
+	MailboxID int64
+	ModSeq    store.ModSeq
+	Flags     store.Flags
+	Keywords  []string
+}
+
+// xsyncState returns the modseq state of the account.
+func xsyncState(ctx context.Context, tx *bstore.Tx) store.SyncState {
+	ss := store.SyncState{ID: 1}
+	err := tx.Get(&ss)
+	if err == bstore.ErrAbsent {
+		// No modseq assigned yet. Same values as NextModSeq initializes to.
+		return store.SyncState{ID: 1, LastModSeq: 1, HighestDeletedModSeq: -1}
+	}
+	xcheckf(ctx, err, "get sync state")
+	return ss
+}
+
+// Maximum number of messages returned by a single Sync call. Messages with the
+// same modseq are always returned together, so the limit can be exceeded.
+const syncMessageLimit = 500
+
+// Sync returns the changes to messages since modseq, and all mailboxes. Used by
+// clients that keep messages cached, e.g. while offline, and reconnect. Pass
+// modseq 0 for the initial call, the result has Full set and the current modseq.
+func (Webmail) Sync(ctx context.Context, modseq store.ModSeq) (r SyncResult) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	if modseq < 0 {
+		xcheckuserf(ctx, errors.New("modseq cannot be negative"), "checking modseq")
+	}
+
+	state := msgState{acc: acc}
+	defer state.clear()
+
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		ss := xsyncState(ctx, tx)
+		if modseq > ss.LastModSeq {
+			xcheckuserf(ctx, errors.New("modseq is higher than current modseq"), "checking modseq")
+		}
+
+		r.Mailboxes, err = bstore.QueryTx[store.Mailbox](tx).List()
+		xcheckf(ctx, err, "list mailboxes")
+
+		r.ModSeq = ss.LastModSeq
+		if modseq == 0 || modseq < ss.HighestDeletedModSeq {
+			r.Full = true
+			return
+		}
+
+		var n int
+		var last store.ModSeq
+		q := bstore.QueryTx[store.Message](tx)
+		q.FilterGreater("ModSeq", modseq)
+		q.SortAsc("ModSeq")
+		err = q.ForEach(func(m store.Message) error {
+			if n >= syncMessageLimit && m.ModSeq != last {
+				r.More = true
+				return bstore.StopForEach
+			}
+			n++
+			last = m.ModSeq
+
+			if m.Expunged {
+				// Messages both added and removed since modseq were never seen by the client.
+				if m.CreateSeq <= modseq {
+					r.Removed = append(r.Removed, m.ID)
+				}
+			} else if m.CreateSeq > modseq {
+				mi, err := messageItem(log, m, &state)
+				if err != nil {
+					return fmt.Errorf("making messageitem for message %d: %v", m.ID, err)
+				}
+				r.Added = append(r.Added, mi)
+			} else {
+				sm := SyncMessage{m.ID, m.MailboxID, m.ModSeq, m.Flags, m.Keywords}
+				r.Changed = append(r.Changed, sm)
+			}
+			return nil
+		})
+		xcheckf(ctx, err, "gathering changed messages")
+		if r.More {
+			r.ModSeq = last
+		}
+	})
+	return
+}
+
+// SyncFlagChange is a change to message flags made by a client while offline,
+// to be applied with SyncFlags.
+type SyncFlagChange struct {
+	MessageIDs []int64
+	Flags      []string // System flags like \Seen and keywords, as for FlagsAdd.
+	Clear      bool     // Whether Flags are cleared instead of added.
+}
+
+// SyncFlagsResult lists the messages for which flag changes were not applied.
+type SyncFlagsResult struct {
+	// Messages that were changed after the modseq the client was synchronized at,
+	// e.g. by another client. Their flags have not been changed, the client should
+	// call Sync and show the user the current state.
+	Conflicts []int64
+
+	// Messages that no longer exist.
+	Removed []int64
+}
+
+// SyncFlags applies flag changes that a client made while offline, when its
+// state was synchronized at modseq. Changes are applied in order. Messages that
+// were changed since modseq are not modified, and returned as conflicts, as are
+// messages that were removed.
+func (Webmail) SyncFlags(ctx context.Context, modseq store.ModSeq, changes []SyncFlagChange) (r SyncFlagsResult) {
+	log := pkglog.WithContext(ctx)
+	reqInfo := ctx.Value(requestInfoCtxKey).(requestInfo)
+	acc, err := store.OpenAccount(log, reqInfo.AccountName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	if modseq <= 0 {
+		xcheckuserf(ctx, errors.New("modseq must be positive"), "checking modseq")
+	}
+
+	type flagChange struct {
+		flags    store.Flags
+		keywords []string
+	}
+	var parsed []flagChange
+	for _, c := range changes {
+		flags, keywords, err := store.ParseFlagsKeywords(c.Flags)
+		xcheckuserf(ctx, err, "parsing flags")
+		parsed = append(parsed, flagChange{flags, keywords})
+	}
+
+	acc.WithRLock(func() {
+		var bchanges []store.Change
+
+		xdbwrite(ctx, acc, func(tx *bstore.Tx) {
+			var nmodseq store.ModSeq
+			skip := map[int64]bool{}
+			mailboxes := map[int64]store.Mailbox{}
+			origMailboxes := map[int64]store.Mailbox{}
+			var retrain []store.Message
+			retrainIndex := map[int64]int{}
+
+			for i, c := range changes {
+				for _, mid := range c.MessageIDs {
+					if skip[mid] {
+						continue
+					}
+
+					m := store.Message{ID: mid}
+					err := tx.Get(&m)
+					if err == bstore.ErrAbsent || err == nil && m.Expunged {
+						skip[mid] = true
+						r.Removed = append(r.Removed, mid)
+						continue
+					}
+					xcheckf(ctx, err, "get message")
+					// Messages changed by an earlier change in this call have our new modseq.
+					if m.ModSeq > modseq && m.ModSeq != nmodseq {
+						skip[mid] = true
+						r.Conflicts = append(r.Conflicts, mid)
+						continue
+					}
+
+					mb, ok := mailboxes[m.MailboxID]
+					if !ok {
+						mb = xmailboxID(ctx, tx, m.MailboxID)
+						origMailboxes[mb.ID] = mb
+					}
+
+					oflags := m.Flags
+					mb.Sub(m.MailboxCounts())
+					var kwChanged bool
+					if c.Clear {
+						m.Flags = m.Flags.Set(parsed[i].flags, store.Flags{})
+						m.Keywords, kwChanged = store.RemoveKeywords(m.Keywords, parsed[i].keywords)
+					} else {
+						m.Flags = m.Flags.Set(parsed[i].flags, parsed[i].flags)
+						m.Keywords, kwChanged = store.MergeKeywords(m.Keywords, parsed[i].keywords)
+						mb.Keywords, _ = store.MergeKeywords(mb.Keywords, parsed[i].keywords)
+					}
+					mb.Add(m.MailboxCounts())
+					mailboxes[mb.ID] = mb
+
+					if m.Flags == oflags && !kwChanged {
+						continue
+					}
+
+					if nmodseq == 0 {
+						nmodseq, err = acc.NextModSeq(tx)
+						xcheckf(ctx, err, "assigning next modseq")
+					}
+					m.ModSeq = nmodseq
+					err = tx.Update(&m)
+					xcheckf(ctx, err, "updating message")
+
+					bchanges = append(bchanges, m.ChangeFlags(oflags))
+					if j, ok := retrainIndex[m.ID]; ok {
+						retrain[j] = m
+					} else {
+						retrainIndex[m.ID] = len(retrain)
+						retrain = append(retrain, m)
+					}
+				}
+			}
+
+			mbIDs := maps.Keys(mailboxes)
+			sort.Slice(mbIDs, func(i, j int) bool {
+				return mbIDs[i] < mbIDs[j]
+			})
+			for _, id := range mbIDs {
+				mb := mailboxes[id]
+				origmb := origMailboxes[id]
+				err := tx.Update(&mb)
+				xcheckf(ctx, err, "updating mailbox")
+				if mb.MailboxCounts != origmb.MailboxCounts {
+					bchanges = append(bchanges, mb.ChangeCounts())
+				}
+				if mb.KeywordsChanged(origmb) {
+					bchanges = append(bchanges, mb.ChangeKeywords())
+				}
+			}
+
+			err = acc.RetrainMessages(ctx, log, tx, retrain, false)
+			xcheckf(ctx, err, "retraining messages")
+		})
+
+		store.BroadcastChanges(acc, bchanges)
+	})
+	return
+}
+
 // logPanic can be called with a defer from a goroutine to prevent the entire program from being shutdown in case of a panic.
 func logPanic(ctx context.Context) {
 	x := recover()
@@ -1791,6 +3701,6 @@ func slicesAny[T any](l []T) []any {
 }
 
 // SSETypes exists to ensure the generated API contains the types, for use in SSE events.
-func (Webmail) SSETypes() (start EventStart, viewErr EventViewErr, viewReset EventViewReset, viewMsgs EventViewMsgs, viewChanges EventViewChanges, msgAdd ChangeMsgAdd, msgRemove ChangeMsgRemove, msgFlags ChangeMsgFlags, msgThread ChangeMsgThread, mailboxRemove ChangeMailboxRemove, mailboxAdd ChangeMailboxAdd, mailboxRename ChangeMailboxRename, mailboxCounts ChangeMailboxCounts, mailboxSpecialUse ChangeMailboxSpecialUse, mailboxKeywords ChangeMailboxKeywords, flags store.Flags) {
+func (Webmail) SSETypes() (start EventStart, viewErr EventViewErr, viewReset EventViewReset, viewMsgs EventViewMsgs, viewChanges EventViewChanges, msgAdd ChangeMsgAdd, msgRemove ChangeMsgRemove, msgFlags ChangeMsgFlags, msgThread ChangeMsgThread, mailboxRemove ChangeMailboxRemove, mailboxAdd ChangeMailboxAdd, mailboxRename ChangeMailboxRename, mailboxCounts ChangeMailboxCounts, mailboxSpecialUse ChangeMailboxSpecialUse, mailboxKeywords ChangeMailboxKeywords, settings ChangeSettings, labels ChangeLabels, submissionUndoEnd ChangeSubmissionUndoEnd, flags store.Flags) {
 	return
 }
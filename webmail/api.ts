@@ -38,6 +38,14 @@ export interface Filter {
 	Headers?: (string[] | null)[] | null  // Header values can be empty, it's a check if the header is present, regardless of value.
 	SizeMin: number
 	SizeMax: number
+	Or?: (FilterAlternative[] | null)[] | null  // OR groups, e.g. from "from:a OR from:b" in a search query. A message must match at least one alternative of each group.
+}
+
+// FilterAlternative is an alternative in an OR group of a filter. Mailbox-related
+// fields in its Filter are ignored.
+export interface FilterAlternative {
+	Filter: Filter
+	NotFilter: NotFilter
 }
 
 // NotFilter matches messages that don't match these fields.
@@ -67,6 +75,7 @@ export interface ParsedMessage {
 	Texts?: string[] | null  // Text parts, can be empty.
 	HasHTML: boolean  // Whether there is an HTML part. The webclient renders HTML message parts through an iframe and a separate request with strict CSP headers to prevent script execution and loading of external resources, which isn't possible when loading in iframe with inline HTML because not all browsers support the iframe csp attribute.
 	ListReplyAddress?: MessageAddress | null  // From List-Post.
+	Invites?: Invite[] | null  // Meeting invitations, replies and cancellations from text/calendar parts (iMIP), can be empty.
 }
 
 // Part represents a whole mail message, or a part of a multipart message. It
@@ -127,6 +136,48 @@ export interface Domain {
 	Unicode: string  // Name as U-labels. Empty if this is an ASCII-only domain. No trailing dot.
 }
 
+// Invite is a calendar object from a text/calendar part of a message, typically
+// a meeting invitation. The part is also listed as attachment.
+export interface Invite {
+	Path?: number[] | null  // Of the text/calendar part.
+	Calendar: Calendar
+}
+
+// Calendar is an iCalendar object (RFC 5545) from a text/calendar part, as used
+// for meeting invitations sent by email (iMIP, RFC 6047). Only the properties
+// needed for showing invitations and replying to them are parsed.
+export interface Calendar {
+	Method: string  // iTIP method (RFC 5546) in upper case, e.g. "REQUEST", "REPLY" or "CANCEL". Can be empty.
+	ProdID: string
+	Events?: CalendarEvent[] | null
+}
+
+// CalendarEvent is a VEVENT component of a calendar.
+export interface CalendarEvent {
+	UID: string
+	RecurrenceID: string  // Value of RECURRENCE-ID, set for an event about a single occurrence of a recurring event.
+	Sequence: number  // Revision of the event, incremented by the organizer on significant changes.
+	Start: Date
+	End: Date  // Zero if absent. Calculated from DURATION if present.
+	AllDay: boolean  // If start (and end) are dates without time.
+	Summary: string
+	Description: string
+	Location: string
+	Status: string  // In upper case, e.g. "CONFIRMED", "TENTATIVE", "CANCELLED". Can be empty.
+	Recurrence: string  // Value of RRULE, e.g. "FREQ=WEEKLY;COUNT=10". Empty if not recurring.
+	Organizer: CalendarAddress
+	Attendees?: CalendarAddress[] | null
+}
+
+// CalendarAddress is an organizer or attendee of an event.
+export interface CalendarAddress {
+	Address: string  // Email address, without "mailto:".
+	Name: string  // Common name, can be empty.
+	PartStat: string  // Participation status in upper case, e.g. "NEEDS-ACTION", "ACCEPTED", "TENTATIVE", "DECLINED". Empty for organizer.
+	Role: string  // E.g. "REQ-PARTICIPANT", "OPT-PARTICIPANT", "CHAIR". Can be empty.
+	RSVP: boolean  // Whether the organizer requests a reply.
+}
+
 // SubmitMessage is an email message to be sent to one or more recipients.
 // Addresses are formatted as just email address, or with a name like "name
 // <user@host>".
@@ -136,7 +187,8 @@ export interface SubmitMessage {
 	Cc?: string[] | null
 	Bcc?: string[] | null
 	Subject: string
-	TextBody: string
+	TextBody: string  // Ignored if HTMLBody is set.
+	HTMLBody: string  // If set, a text part is generated from the sanitized HTML, and data: URIs of images are sent as inline parts.
 	Attachments?: File[] | null
 	ForwardAttachments: ForwardAttachments
 	IsForward: boolean
@@ -144,6 +196,8 @@ export interface SubmitMessage {
 	ReplyTo: string  // If non-empty, Reply-To header to add to message.
 	UserAgent: string  // User-Agent header added if not empty.
 	RequireTLS?: boolean | null  // For "Require TLS" extension during delivery.
+	DraftMessageID: number  // If set, previous version of this message as draft, removed when the message is submitted or saved as new draft.
+	SubmitID: string  // Optional client-generated ID, unique per composed message. A message with an ID that was already submitted is not sent again.
 }
 
 // File is a new attachment (not from an existing message that is being
@@ -159,6 +213,70 @@ export interface ForwardAttachments {
 	Paths?: (number[] | null)[] | null  // List of attachments, each path is a list of indices into the top-level message.Part.Parts.
 }
 
+// SubmitResult is returned by MessageSubmit.
+export interface SubmitResult {
+	UndoID: number  // If nonzero, the submission can be undone with MessageSubmitUndo until UndoUntil, as long as delivery has not started. When the undo window closes, a ChangeSubmissionUndoEnd is sent to the client.
+	UndoUntil: Date
+	Duplicate: boolean  // Set if a message with the same SubmitID was submitted before. Nothing was done.
+}
+
+// Contact is an entry in the address book, with the fields that can be edited in
+// webmail. Contacts are stored as vCard, other properties, e.g. added by CardDAV
+// clients, are kept when saving.
+export interface Contact {
+	ID: number  // Zero for a new contact.
+	Name: string
+	Emails?: string[] | null
+	Phones?: string[] | null
+	Note: string
+}
+
+// InviteStatus is the state of an invitation or cancellation, compared with the
+// most recent reply sent from webmail for the event.
+export interface InviteStatus {
+	PartStat: string  // Of the most recent reply for the event, e.g. "ACCEPTED". Empty if not answered.
+	Replied: Date  // Zero if not answered.
+	Updated: boolean  // If the invitation is newer than the answered event, e.g. with a changed time, and should be answered again.
+	Cancelled: boolean  // If the organizer cancelled the event.
+}
+
+// Settings are the webmail preferences of an account. They are stored in the
+// account database, not in the browser, so they apply to all sessions and devices.
+// Only a single record, with ID 1, is stored.
+export interface Settings {
+	ID: number  // Singleton ID 1. Zero in DefaultSettings.
+	Signature: string  // Added below the text of composed messages, also for messages composed by the server, e.g. replies to calendar invitations.
+	Quoting: Quoting
+	DefaultFrom: string  // Address to use as From for new messages. If empty, the login address is used.
+	SendDelay: number  // Seconds to delay delivery of submitted messages, during which sending can be undone in webmail. Zero for immediate delivery.
+	Layout: string  // "auto", "leftright" or "topbottom".
+	Threading: string  // "off", "on" or "unread".
+	OrderAsc: boolean  // Show oldest messages first.
+	ShowHTML: boolean  // Show HTML version of a message instead of text, if both are present.
+	ShowShortcuts: boolean  // Briefly show keyboard shortcut for a button that was clicked.
+	ShowAllHeaders: boolean
+	ShowHeaders?: string[] | null  // Additional message headers to show.
+}
+
+// Label is a user-defined name and color for a keyword, for display and
+// selection in webmail. Messages are labeled by setting the keyword, so IMAP
+// clients see the labels as keywords.
+export interface Label {
+	ID: number
+	Name: string
+	Keyword: string  // Lower-case IMAP keyword.
+	Color: string  // HTML color, e.g. "#ff8800", or empty for the default color.
+}
+
+// SavedSearchItem is a saved search with its number of unread messages, for
+// display as virtual mailbox.
+export interface SavedSearchItem {
+	ID: number
+	Name: string
+	Search: string
+	Unread: number
+}
+
 // Mailbox is collection of messages, e.g. Inbox or Sent.
 export interface Mailbox {
 	ID: number
@@ -189,53 +307,50 @@ export interface RecipientSecurity {
 	RequireTLS: SecurityResult  // Whether recipient domain is known to implement the REQUIRETLS SMTP extension. Will be "unknown" if no delivery to the domain has been attempted yet.
 }
 
-// EventStart is the first message sent on an SSE connection, giving the client
-// basic data to populate its UI. After this event, messages will follow quickly in
-// an EventViewMsgs event.
-export interface EventStart {
-	SSEID: number
-	LoginAddress: MessageAddress
-	Addresses?: MessageAddress[] | null
-	DomainAddressConfigs?: { [key: string]: DomainAddressConfig }  // ASCII domain to address config.
-	MailboxName: string
-	Mailboxes?: Mailbox[] | null
-	RejectsMailbox: string
-	Version: string
+// ExportProgress is the progress of an export, for display by the client.
+export interface ExportProgress {
+	Exported: number  // Number of messages added to the archive so far.
+	Total: number  // Number of messages to export, 0 until known.
+	Done: boolean  // Whether the export has finished, successfully or not.
+	Error: string  // If the export failed.
 }
 
-// DomainAddressConfig has the address (localpart) configuration for a domain, so
-// the webmail client can decide if an address matches the addresses of the
-// account.
-export interface DomainAddressConfig {
-	LocalpartCatchallSeparator: string  // Can be empty.
-	LocalpartCaseSensitive: boolean
+// JunkExplanation explains how the junk filter of the account classifies a
+// message.
+export interface JunkExplanation {
+	Threshold: number  // Spam probability above which incoming messages are rejected.
+	Classification: Classification
 }
 
-// EventViewErr indicates an error during a query for messages. The request is
-// aborted, no more request-related messages will be sent until the next request.
-export interface EventViewErr {
-	ViewID: number
-	RequestID: number
-	Err: string  // To be displayed in client.
+// Classification holds the details of classifying a message, for explaining to
+// users why a message was classified as ham or spam.
+export interface Classification {
+	Probability: number  // Spam probability, between 0 (ham) and 1 (spam).
+	TopHam?: WordProbability[] | null  // Most hammy words used for the probability, most hammy first.
+	TopSpam?: WordProbability[] | null  // Most spammy words used for the probability, most spammy first.
+	Words: number  // Number of words (combinations) in the message.
+	Known: number  // Number of words present in the database.
+	Hams: number  // Number of ham messages the filter was trained with.
+	Spams: number  // Number of spam messages the filter was trained with.
 }
 
-// EventViewReset indicates that a request for the next set of messages in a few
-// could not be fulfilled, e.g. because the anchor message does not exist anymore.
-// The client should clear its list of messages. This can happen before
-// EventViewMsgs events are sent.
-export interface EventViewReset {
-	ViewID: number
-	RequestID: number
+// WordProbability is a word (combination) used for classifying a message.
+export interface WordProbability {
+	Word: string
+	Probability: number  // Spam probability, between 0 (ham) and 1 (spam), after applying MaxPower and RareWords.
+	Ham: number  // Number of trained ham messages containing the word.
+	Spam: number  // Number of trained spam messages containing the word.
 }
 
-// EventViewMsgs contains messages for a view, possibly a continuation of an
-// earlier list of messages.
-export interface EventViewMsgs {
-	ViewID: number
-	RequestID: number
-	MessageItems?: (MessageItem[] | null)[] | null  // If empty, this was the last message for the request. If non-empty, a list of thread messages. Each with the first message being the reason this thread is included and can be used as AnchorID in followup requests. If the threading mode is "off" in the query, there will always be only a single message. If a thread is sent, all messages in the thread are sent, including those that don't match the query (e.g. from another mailbox). Threads can be displayed based on the ThreadParentIDs field, with possibly slightly different display based on field ThreadMissingLink.
-	ParsedMessage?: ParsedMessage | null  // If set, will match the target page.DestMessageID from the request.
-	ViewEnd: boolean  // If set, there are no more messages in this view at this moment. Messages can be added, typically via Change messages, e.g. for new deliveries.
+// SyncResult holds the changes to an account since a modseq, as returned by Sync.
+export interface SyncResult {
+	ModSeq: ModSeq  // ModSeq to pass in the next call to Sync.
+	Full: boolean  // If set, the changes since the requested modseq are not available, e.g. because the client has no state yet (modseq 0), or because the records of removed messages have been cleaned up. The client must discard its cached messages. Only Mailboxes and ModSeq are set.
+	Mailboxes?: Mailbox[] | null  // All mailboxes, with their current counts. Mailboxes don't have a modseq, they are always returned in full.
+	Added?: MessageItem[] | null  // Messages added since modseq.
+	Changed?: SyncMessage[] | null  // Messages with changed flags or mailbox (when moved) since modseq.
+	Removed?: number[] | null  // IDs of messages removed since modseq. May include IDs the client doesn't know.
+	More: boolean  // If set, not all changes have been returned, Sync must be called again with ModSeq.
 }
 
 // MessageItem is sent by queries, it has derived information analyzed from
@@ -344,22 +459,13 @@ export interface Attachment {
 	Part: Part
 }
 
-// EventViewChanges contain one or more changes relevant for the client, either
-// with new mailbox total/unseen message counts, or messages added/removed/modified
-// (flags) for the current view.
-export interface EventViewChanges {
-	ViewID: number
-	Changes?: (any[] | null)[] | null  // The first field of [2]any is a string, the second of the Change types below.
-}
-
-// ChangeMsgAdd adds a new message and possibly its thread to the view.
-export interface ChangeMsgAdd {
+// SyncMessage is the current state of a message that was changed.
+export interface SyncMessage {
+	ID: number
 	MailboxID: number
-	UID: UID
 	ModSeq: ModSeq
-	Flags: Flags  // System flags.
-	Keywords?: string[] | null  // Other flags.
-	MessageItems?: MessageItem[] | null
+	Flags: Flags
+	Keywords?: string[] | null
 }
 
 // Flags for a mail message.
@@ -376,6 +482,90 @@ export interface Flags {
 	MDNSent: boolean
 }
 
+// SyncFlagChange is a change to message flags made by a client while offline,
+// to be applied with SyncFlags.
+export interface SyncFlagChange {
+	MessageIDs?: number[] | null
+	Flags?: string[] | null  // System flags like \Seen and keywords, as for FlagsAdd.
+	Clear: boolean  // Whether Flags are cleared instead of added.
+}
+
+// SyncFlagsResult lists the messages for which flag changes were not applied.
+export interface SyncFlagsResult {
+	Conflicts?: number[] | null  // Messages that were changed after the modseq the client was synchronized at, e.g. by another client. Their flags have not been changed, the client should call Sync and show the user the current state.
+	Removed?: number[] | null  // Messages that no longer exist.
+}
+
+// EventStart is the first message sent on an SSE connection, giving the client
+// basic data to populate its UI. After this event, messages will follow quickly in
+// an EventViewMsgs event.
+export interface EventStart {
+	SSEID: number
+	LoginAddress: MessageAddress
+	Addresses?: MessageAddress[] | null
+	DomainAddressConfigs?: { [key: string]: DomainAddressConfig }  // ASCII domain to address config.
+	MailboxName: string
+	Mailboxes?: Mailbox[] | null
+	RejectsMailbox: string
+	Settings: Settings
+	Labels?: Label[] | null  // Sorted by name.
+	ModSeq: ModSeq  // Current modseq, for use with Sync and SyncFlags.
+	Version: string
+}
+
+// DomainAddressConfig has the address (localpart) configuration for a domain, so
+// the webmail client can decide if an address matches the addresses of the
+// account.
+export interface DomainAddressConfig {
+	LocalpartCatchallSeparator: string  // Can be empty.
+	LocalpartCaseSensitive: boolean
+}
+
+// EventViewErr indicates an error during a query for messages. The request is
+// aborted, no more request-related messages will be sent until the next request.
+export interface EventViewErr {
+	ViewID: number
+	RequestID: number
+	Err: string  // To be displayed in client.
+}
+
+// EventViewReset indicates that a request for the next set of messages in a few
+// could not be fulfilled, e.g. because the anchor message does not exist anymore.
+// The client should clear its list of messages. This can happen before
+// EventViewMsgs events are sent.
+export interface EventViewReset {
+	ViewID: number
+	RequestID: number
+}
+
+// EventViewMsgs contains messages for a view, possibly a continuation of an
+// earlier list of messages.
+export interface EventViewMsgs {
+	ViewID: number
+	RequestID: number
+	MessageItems?: (MessageItem[] | null)[] | null  // If empty, this was the last message for the request. If non-empty, a list of thread messages. Each with the first message being the reason this thread is included and can be used as AnchorID in followup requests. If the threading mode is "off" in the query, there will always be only a single message. If a thread is sent, all messages in the thread are sent, including those that don't match the query (e.g. from another mailbox). Threads can be displayed based on the ThreadParentIDs field, with possibly slightly different display based on field ThreadMissingLink.
+	ParsedMessage?: ParsedMessage | null  // If set, will match the target page.DestMessageID from the request.
+	ViewEnd: boolean  // If set, there are no more messages in this view at this moment. Messages can be added, typically via Change messages, e.g. for new deliveries.
+}
+
+// EventViewChanges contain one or more changes relevant for the client, either
+// with new mailbox total/unseen message counts, or messages added/removed/modified
+// (flags) for the current view.
+export interface EventViewChanges {
+	ViewID: number
+	Changes?: (any[] | null)[] | null  // The first field of [2]any is a string, the second of the Change types below.
+}
+
+// ChangeMsgAdd adds a new message and possibly its thread to the view.
+export interface ChangeMsgAdd {
+	MailboxID: number
+	UID: UID
+	ModSeq: ModSeq
+	Flags: Flags  // System flags.
+	Keywords?: string[] | null  // Other flags.
+	MessageItems?: MessageItem[] | null
+}
+
 // ChangeMsgRemove removes one or more messages from the view.
 export interface ChangeMsgRemove {
 	MailboxID: number
@@ -456,6 +646,24 @@ export interface ChangeMailboxKeywords {
 	Keywords?: string[] | null
 }
 
+// ChangeSettings has the new webmail settings of the account, saved by this or
+// another session.
+export interface ChangeSettings {
+	Settings: Settings
+}
+
+// ChangeLabels has all labels of the account, after a label was created, changed
+// or removed.
+export interface ChangeLabels {
+	Labels?: Label[] | null
+}
+
+// ChangeSubmissionUndoEnd indicates a submission made with a send delay can no
+// longer be undone, because the delay has passed or it was undone.
+export interface ChangeSubmissionUndoEnd {
+	ID: number  // ID of SubmissionUndo.
+}
+
 // IMAP UID.
 export type UID = number
 
@@ -500,6 +708,13 @@ export enum AttachmentType {
 	AttachmentPresentation = "presentation",  // odp, pptx, ...
 }
 
+// Quoting is the style of quoting the original message in replies.
+export enum Quoting {
+	Default = "",  // Bottom-quote if text is selected, top-quote otherwise.
+	Bottom = "bottom",  // Text is written below the quoted original.
+	Top = "top",  // Text is written above the quoted original.
+}
+
 // SecurityResult indicates whether a security feature is supported.
 export enum SecurityResult {
 	SecurityResultError = "error",
@@ -516,38 +731,57 @@ export enum SecurityResult {
 // An empty string can be a valid localpart.
 export type Localpart = string
 
-export const structTypes: {[typename: string]: boolean} = {"Address":true,"Attachment":true,"ChangeMailboxAdd":true,"ChangeMailboxCounts":true,"ChangeMailboxKeywords":true,"ChangeMailboxRemove":true,"ChangeMailboxRename":true,"ChangeMailboxSpecialUse":true,"ChangeMsgAdd":true,"ChangeMsgFlags":true,"ChangeMsgRemove":true,"ChangeMsgThread":true,"Domain":true,"DomainAddressConfig":true,"Envelope":true,"EventStart":true,"EventViewChanges":true,"EventViewErr":true,"EventViewMsgs":true,"EventViewReset":true,"File":true,"Filter":true,"Flags":true,"ForwardAttachments":true,"Mailbox":true,"Message":true,"MessageAddress":true,"MessageEnvelope":true,"MessageItem":true,"NotFilter":true,"Page":true,"ParsedMessage":true,"Part":true,"Query":true,"RecipientSecurity":true,"Request":true,"SpecialUse":true,"SubmitMessage":true}
-export const stringsTypes: {[typename: string]: boolean} = {"AttachmentType":true,"CSRFToken":true,"Localpart":true,"SecurityResult":true,"ThreadMode":true}
+export const structTypes: {[typename: string]: boolean} = {"Address":true,"Attachment":true,"Calendar":true,"CalendarAddress":true,"CalendarEvent":true,"ChangeLabels":true,"ChangeMailboxAdd":true,"ChangeMailboxCounts":true,"ChangeMailboxKeywords":true,"ChangeMailboxRemove":true,"ChangeMailboxRename":true,"ChangeMailboxSpecialUse":true,"ChangeMsgAdd":true,"ChangeMsgFlags":true,"ChangeMsgRemove":true,"ChangeMsgThread":true,"ChangeSettings":true,"ChangeSubmissionUndoEnd":true,"Classification":true,"Contact":true,"Domain":true,"DomainAddressConfig":true,"Envelope":true,"EventStart":true,"EventViewChanges":true,"EventViewErr":true,"EventViewMsgs":true,"EventViewReset":true,"ExportProgress":true,"File":true,"Filter":true,"FilterAlternative":true,"Flags":true,"ForwardAttachments":true,"Invite":true,"InviteStatus":true,"JunkExplanation":true,"Label":true,"Mailbox":true,"Message":true,"MessageAddress":true,"MessageEnvelope":true,"MessageItem":true,"NotFilter":true,"Page":true,"ParsedMessage":true,"Part":true,"Query":true,"RecipientSecurity":true,"Request":true,"SavedSearchItem":true,"Settings":true,"SpecialUse":true,"SubmitMessage":true,"SubmitResult":true,"SyncFlagChange":true,"SyncFlagsResult":true,"SyncMessage":true,"SyncResult":true,"WordProbability":true}
+export const stringsTypes: {[typename: string]: boolean} = {"AttachmentType":true,"CSRFToken":true,"Localpart":true,"Quoting":true,"SecurityResult":true,"ThreadMode":true}
 export const intsTypes: {[typename: string]: boolean} = {"ModSeq":true,"UID":true,"Validation":true}
 export const types: TypenameMap = {
 	"Request": {"Name":"Request","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"SSEID","Docs":"","Typewords":["int64"]},{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"Cancel","Docs":"","Typewords":["bool"]},{"Name":"Query","Docs":"","Typewords":["Query"]},{"Name":"Page","Docs":"","Typewords":["Page"]}]},
 	"Query": {"Name":"Query","Docs":"","Fields":[{"Name":"OrderAsc","Docs":"","Typewords":["bool"]},{"Name":"Threading","Docs":"","Typewords":["ThreadMode"]},{"Name":"Filter","Docs":"","Typewords":["Filter"]},{"Name":"NotFilter","Docs":"","Typewords":["NotFilter"]}]},
-	"Filter": {"Name":"Filter","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"MailboxChildrenIncluded","Docs":"","Typewords":["bool"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Words","Docs":"","Typewords":["[]","string"]},{"Name":"From","Docs":"","Typewords":["[]","string"]},{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"Oldest","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Newest","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Subject","Docs":"","Typewords":["[]","string"]},{"Name":"Attachments","Docs":"","Typewords":["AttachmentType"]},{"Name":"Labels","Docs":"","Typewords":["[]","string"]},{"Name":"Headers","Docs":"","Typewords":["[]","[]","string"]},{"Name":"SizeMin","Docs":"","Typewords":["int64"]},{"Name":"SizeMax","Docs":"","Typewords":["int64"]}]},
+	"Filter": {"Name":"Filter","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"MailboxChildrenIncluded","Docs":"","Typewords":["bool"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Words","Docs":"","Typewords":["[]","string"]},{"Name":"From","Docs":"","Typewords":["[]","string"]},{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"Oldest","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Newest","Docs":"","Typewords":["nullable","timestamp"]},{"Name":"Subject","Docs":"","Typewords":["[]","string"]},{"Name":"Attachments","Docs":"","Typewords":["AttachmentType"]},{"Name":"Labels","Docs":"","Typewords":["[]","string"]},{"Name":"Headers","Docs":"","Typewords":["[]","[]","string"]},{"Name":"SizeMin","Docs":"","Typewords":["int64"]},{"Name":"SizeMax","Docs":"","Typewords":["int64"]},{"Name":"Or","Docs":"","Typewords":["[]","[]","FilterAlternative"]}]},
+	"FilterAlternative": {"Name":"FilterAlternative","Docs":"","Fields":[{"Name":"Filter","Docs":"","Typewords":["Filter"]},{"Name":"NotFilter","Docs":"","Typewords":["NotFilter"]}]},
 	"NotFilter": {"Name":"NotFilter","Docs":"","Fields":[{"Name":"Words","Docs":"","Typewords":["[]","string"]},{"Name":"From","Docs":"","Typewords":["[]","string"]},{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"Subject","Docs":"","Typewords":["[]","string"]},{"Name":"Attachments","Docs":"","Typewords":["AttachmentType"]},{"Name":"Labels","Docs":"","Typewords":["[]","string"]}]},
 	"Page": {"Name":"Page","Docs":"","Fields":[{"Name":"AnchorMessageID","Docs":"","Typewords":["int64"]},{"Name":"Count","Docs":"","Typewords":["int32"]},{"Name":"DestMessageID","Docs":"","Typewords":["int64"]}]},
-	"ParsedMessage": {"Name":"ParsedMessage","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Part","Docs":"","Typewords":["Part"]},{"Name":"Headers","Docs":"","Typewords":["{}","[]","string"]},{"Name":"Texts","Docs":"","Typewords":["[]","string"]},{"Name":"HasHTML","Docs":"","Typewords":["bool"]},{"Name":"ListReplyAddress","Docs":"","Typewords":["nullable","MessageAddress"]}]},
+	"ParsedMessage": {"Name":"ParsedMessage","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Part","Docs":"","Typewords":["Part"]},{"Name":"Headers","Docs":"","Typewords":["{}","[]","string"]},{"Name":"Texts","Docs":"","Typewords":["[]","string"]},{"Name":"HasHTML","Docs":"","Typewords":["bool"]},{"Name":"ListReplyAddress","Docs":"","Typewords":["nullable","MessageAddress"]},{"Name":"Invites","Docs":"","Typewords":["[]","Invite"]}]},
 	"Part": {"Name":"Part","Docs":"","Fields":[{"Name":"BoundaryOffset","Docs":"","Typewords":["int64"]},{"Name":"HeaderOffset","Docs":"","Typewords":["int64"]},{"Name":"BodyOffset","Docs":"","Typewords":["int64"]},{"Name":"EndOffset","Docs":"","Typewords":["int64"]},{"Name":"RawLineCount","Docs":"","Typewords":["int64"]},{"Name":"DecodedSize","Docs":"","Typewords":["int64"]},{"Name":"MediaType","Docs":"","Typewords":["string"]},{"Name":"MediaSubType","Docs":"","Typewords":["string"]},{"Name":"ContentTypeParams","Docs":"","Typewords":["{}","string"]},{"Name":"ContentID","Docs":"","Typewords":["string"]},{"Name":"ContentDescription","Docs":"","Typewords":["string"]},{"Name":"ContentTransferEncoding","Docs":"","Typewords":["string"]},{"Name":"Envelope","Docs":"","Typewords":["nullable","Envelope"]},{"Name":"Parts","Docs":"","Typewords":["[]","Part"]},{"Name":"Message","Docs":"","Typewords":["nullable","Part"]}]},
 	"Envelope": {"Name":"Envelope","Docs":"","Fields":[{"Name":"Date","Docs":"","Typewords":["timestamp"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"From","Docs":"","Typewords":["[]","Address"]},{"Name":"Sender","Docs":"","Typewords":["[]","Address"]},{"Name":"ReplyTo","Docs":"","Typewords":["[]","Address"]},{"Name":"To","Docs":"","Typewords":["[]","Address"]},{"Name":"CC","Docs":"","Typewords":["[]","Address"]},{"Name":"BCC","Docs":"","Typewords":["[]","Address"]},{"Name":"InReplyTo","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]}]},
 	"Address": {"Name":"Address","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"User","Docs":"","Typewords":["string"]},{"Name":"Host","Docs":"","Typewords":["string"]}]},
 	"MessageAddress": {"Name":"MessageAddress","Docs":"","Fields":[{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"User","Docs":"","Typewords":["string"]},{"Name":"Domain","Docs":"","Typewords":["Domain"]}]},
 	"Domain": {"Name":"Domain","Docs":"","Fields":[{"Name":"ASCII","Docs":"","Typewords":["string"]},{"Name":"Unicode","Docs":"","Typewords":["string"]}]},
-	"SubmitMessage": {"Name":"SubmitMessage","Docs":"","Fields":[{"Name":"From","Docs":"","Typewords":["string"]},{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"Cc","Docs":"","Typewords":["[]","string"]},{"Name":"Bcc","Docs":"","Typewords":["[]","string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"TextBody","Docs":"","Typewords":["string"]},{"Name":"Attachments","Docs":"","Typewords":["[]","File"]},{"Name":"ForwardAttachments","Docs":"","Typewords":["ForwardAttachments"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ResponseMessageID","Docs":"","Typewords":["int64"]},{"Name":"ReplyTo","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]}]},
+	"Invite": {"Name":"Invite","Docs":"","Fields":[{"Name":"Path","Docs":"","Typewords":["[]","int32"]},{"Name":"Calendar","Docs":"","Typewords":["Calendar"]}]},
+	"Calendar": {"Name":"Calendar","Docs":"","Fields":[{"Name":"Method","Docs":"","Typewords":["string"]},{"Name":"ProdID","Docs":"","Typewords":["string"]},{"Name":"Events","Docs":"","Typewords":["[]","CalendarEvent"]}]},
+	"CalendarEvent": {"Name":"CalendarEvent","Docs":"","Fields":[{"Name":"UID","Docs":"","Typewords":["string"]},{"Name":"RecurrenceID","Docs":"","Typewords":["string"]},{"Name":"Sequence","Docs":"","Typewords":["int32"]},{"Name":"Start","Docs":"","Typewords":["timestamp"]},{"Name":"End","Docs":"","Typewords":["timestamp"]},{"Name":"AllDay","Docs":"","Typewords":["bool"]},{"Name":"Summary","Docs":"","Typewords":["string"]},{"Name":"Description","Docs":"","Typewords":["string"]},{"Name":"Location","Docs":"","Typewords":["string"]},{"Name":"Status","Docs":"","Typewords":["string"]},{"Name":"Recurrence","Docs":"","Typewords":["string"]},{"Name":"Organizer","Docs":"","Typewords":["CalendarAddress"]},{"Name":"Attendees","Docs":"","Typewords":["[]","CalendarAddress"]}]},
+	"CalendarAddress": {"Name":"CalendarAddress","Docs":"","Fields":[{"Name":"Address","Docs":"","Typewords":["string"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"PartStat","Docs":"","Typewords":["string"]},{"Name":"Role","Docs":"","Typewords":["string"]},{"Name":"RSVP","Docs":"","Typewords":["bool"]}]},
+	"SubmitMessage": {"Name":"SubmitMessage","Docs":"","Fields":[{"Name":"From","Docs":"","Typewords":["string"]},{"Name":"To","Docs":"","Typewords":["[]","string"]},{"Name":"Cc","Docs":"","Typewords":["[]","string"]},{"Name":"Bcc","Docs":"","Typewords":["[]","string"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"TextBody","Docs":"","Typewords":["string"]},{"Name":"HTMLBody","Docs":"","Typewords":["string"]},{"Name":"Attachments","Docs":"","Typewords":["[]","File"]},{"Name":"ForwardAttachments","Docs":"","Typewords":["ForwardAttachments"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"ResponseMessageID","Docs":"","Typewords":["int64"]},{"Name":"ReplyTo","Docs":"","Typewords":["string"]},{"Name":"UserAgent","Docs":"","Typewords":["string"]},{"Name":"RequireTLS","Docs":"","Typewords":["nullable","bool"]},{"Name":"DraftMessageID","Docs":"","Typewords":["int64"]},{"Name":"SubmitID","Docs":"","Typewords":["string"]}]},
 	"File": {"Name":"File","Docs":"","Fields":[{"Name":"Filename","Docs":"","Typewords":["string"]},{"Name":"DataURI","Docs":"","Typewords":["string"]}]},
 	"ForwardAttachments": {"Name":"ForwardAttachments","Docs":"","Fields":[{"Name":"MessageID","Docs":"","Typewords":["int64"]},{"Name":"Paths","Docs":"","Typewords":["[]","[]","int32"]}]},
+	"SubmitResult": {"Name":"SubmitResult","Docs":"","Fields":[{"Name":"UndoID","Docs":"","Typewords":["int64"]},{"Name":"UndoUntil","Docs":"","Typewords":["timestamp"]},{"Name":"Duplicate","Docs":"","Typewords":["bool"]}]},
+	"Contact": {"Name":"Contact","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Emails","Docs":"","Typewords":["[]","string"]},{"Name":"Phones","Docs":"","Typewords":["[]","string"]},{"Name":"Note","Docs":"","Typewords":["string"]}]},
+	"InviteStatus": {"Name":"InviteStatus","Docs":"","Fields":[{"Name":"PartStat","Docs":"","Typewords":["string"]},{"Name":"Replied","Docs":"","Typewords":["timestamp"]},{"Name":"Updated","Docs":"","Typewords":["bool"]},{"Name":"Cancelled","Docs":"","Typewords":["bool"]}]},
+	"Settings": {"Name":"Settings","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["uint8"]},{"Name":"Signature","Docs":"","Typewords":["string"]},{"Name":"Quoting","Docs":"","Typewords":["Quoting"]},{"Name":"DefaultFrom","Docs":"","Typewords":["string"]},{"Name":"SendDelay","Docs":"","Typewords":["int32"]},{"Name":"Layout","Docs":"","Typewords":["string"]},{"Name":"Threading","Docs":"","Typewords":["string"]},{"Name":"OrderAsc","Docs":"","Typewords":["bool"]},{"Name":"ShowHTML","Docs":"","Typewords":["bool"]},{"Name":"ShowShortcuts","Docs":"","Typewords":["bool"]},{"Name":"ShowAllHeaders","Docs":"","Typewords":["bool"]},{"Name":"ShowHeaders","Docs":"","Typewords":["[]","string"]}]},
+	"Label": {"Name":"Label","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Keyword","Docs":"","Typewords":["string"]},{"Name":"Color","Docs":"","Typewords":["string"]}]},
+	"SavedSearchItem": {"Name":"SavedSearchItem","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"Search","Docs":"","Typewords":["string"]},{"Name":"Unread","Docs":"","Typewords":["int32"]}]},
 	"Mailbox": {"Name":"Mailbox","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"Name","Docs":"","Typewords":["string"]},{"Name":"UIDValidity","Docs":"","Typewords":["uint32"]},{"Name":"UIDNext","Docs":"","Typewords":["UID"]},{"Name":"Archive","Docs":"","Typewords":["bool"]},{"Name":"Draft","Docs":"","Typewords":["bool"]},{"Name":"Junk","Docs":"","Typewords":["bool"]},{"Name":"Sent","Docs":"","Typewords":["bool"]},{"Name":"Trash","Docs":"","Typewords":["bool"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]},{"Name":"HaveCounts","Docs":"","Typewords":["bool"]},{"Name":"Total","Docs":"","Typewords":["int64"]},{"Name":"Deleted","Docs":"","Typewords":["int64"]},{"Name":"Unread","Docs":"","Typewords":["int64"]},{"Name":"Unseen","Docs":"","Typewords":["int64"]},{"Name":"Size","Docs":"","Typewords":["int64"]}]},
 	"RecipientSecurity": {"Name":"RecipientSecurity","Docs":"","Fields":[{"Name":"STARTTLS","Docs":"","Typewords":["SecurityResult"]},{"Name":"MTASTS","Docs":"","Typewords":["SecurityResult"]},{"Name":"DNSSEC","Docs":"","Typewords":["SecurityResult"]},{"Name":"DANE","Docs":"","Typewords":["SecurityResult"]},{"Name":"RequireTLS","Docs":"","Typewords":["SecurityResult"]}]},
-	"EventStart": {"Name":"EventStart","Docs":"","Fields":[{"Name":"SSEID","Docs":"","Typewords":["int64"]},{"Name":"LoginAddress","Docs":"","Typewords":["MessageAddress"]},{"Name":"Addresses","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"DomainAddressConfigs","Docs":"","Typewords":["{}","DomainAddressConfig"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Mailboxes","Docs":"","Typewords":["[]","Mailbox"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"Version","Docs":"","Typewords":["string"]}]},
-	"DomainAddressConfig": {"Name":"DomainAddressConfig","Docs":"","Fields":[{"Name":"LocalpartCatchallSeparator","Docs":"","Typewords":["string"]},{"Name":"LocalpartCaseSensitive","Docs":"","Typewords":["bool"]}]},
-	"EventViewErr": {"Name":"EventViewErr","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"RequestID","Docs":"","Typewords":["int64"]},{"Name":"Err","Docs":"","Typewords":["string"]}]},
-	"EventViewReset": {"Name":"EventViewReset","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"RequestID","Docs":"","Typewords":["int64"]}]},
-	"EventViewMsgs": {"Name":"EventViewMsgs","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"RequestID","Docs":"","Typewords":["int64"]},{"Name":"MessageItems","Docs":"","Typewords":["[]","[]","MessageItem"]},{"Name":"ParsedMessage","Docs":"","Typewords":["nullable","ParsedMessage"]},{"Name":"ViewEnd","Docs":"","Typewords":["bool"]}]},
+	"ExportProgress": {"Name":"ExportProgress","Docs":"","Fields":[{"Name":"Exported","Docs":"","Typewords":["int32"]},{"Name":"Total","Docs":"","Typewords":["int32"]},{"Name":"Done","Docs":"","Typewords":["bool"]},{"Name":"Error","Docs":"","Typewords":["string"]}]},
+	"JunkExplanation": {"Name":"JunkExplanation","Docs":"","Fields":[{"Name":"Threshold","Docs":"","Typewords":["float64"]},{"Name":"Classification","Docs":"","Typewords":["Classification"]}]},
+	"Classification": {"Name":"Classification","Docs":"","Fields":[{"Name":"Probability","Docs":"","Typewords":["float64"]},{"Name":"TopHam","Docs":"","Typewords":["[]","WordProbability"]},{"Name":"TopSpam","Docs":"","Typewords":["[]","WordProbability"]},{"Name":"Words","Docs":"","Typewords":["int32"]},{"Name":"Known","Docs":"","Typewords":["int32"]},{"Name":"Hams","Docs":"","Typewords":["uint32"]},{"Name":"Spams","Docs":"","Typewords":["uint32"]}]},
+	"WordProbability": {"Name":"WordProbability","Docs":"","Fields":[{"Name":"Word","Docs":"","Typewords":["string"]},{"Name":"Probability","Docs":"","Typewords":["float64"]},{"Name":"Ham","Docs":"","Typewords":["uint32"]},{"Name":"Spam","Docs":"","Typewords":["uint32"]}]},
+	"SyncResult": {"Name":"SyncResult","Docs":"","Fields":[{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"Full","Docs":"","Typewords":["bool"]},{"Name":"Mailboxes","Docs":"","Typewords":["[]","Mailbox"]},{"Name":"Added","Docs":"","Typewords":["[]","MessageItem"]},{"Name":"Changed","Docs":"","Typewords":["[]","SyncMessage"]},{"Name":"Removed","Docs":"","Typewords":["[]","int64"]},{"Name":"More","Docs":"","Typewords":["bool"]}]},
 	"MessageItem": {"Name":"MessageItem","Docs":"","Fields":[{"Name":"Message","Docs":"","Typewords":["Message"]},{"Name":"Envelope","Docs":"","Typewords":["MessageEnvelope"]},{"Name":"Attachments","Docs":"","Typewords":["[]","Attachment"]},{"Name":"IsSigned","Docs":"","Typewords":["bool"]},{"Name":"IsEncrypted","Docs":"","Typewords":["bool"]},{"Name":"FirstLine","Docs":"","Typewords":["string"]},{"Name":"MatchQuery","Docs":"","Typewords":["bool"]}]},
 	"Message": {"Name":"Message","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"UID","Docs":"","Typewords":["UID"]},{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"CreateSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"Expunged","Docs":"","Typewords":["bool"]},{"Name":"IsReject","Docs":"","Typewords":["bool"]},{"Name":"IsForward","Docs":"","Typewords":["bool"]},{"Name":"MailboxOrigID","Docs":"","Typewords":["int64"]},{"Name":"MailboxDestinedID","Docs":"","Typewords":["int64"]},{"Name":"Received","Docs":"","Typewords":["timestamp"]},{"Name":"RemoteIP","Docs":"","Typewords":["string"]},{"Name":"RemoteIPMasked1","Docs":"","Typewords":["string"]},{"Name":"RemoteIPMasked2","Docs":"","Typewords":["string"]},{"Name":"RemoteIPMasked3","Docs":"","Typewords":["string"]},{"Name":"EHLODomain","Docs":"","Typewords":["string"]},{"Name":"MailFrom","Docs":"","Typewords":["string"]},{"Name":"MailFromLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"MailFromDomain","Docs":"","Typewords":["string"]},{"Name":"RcptToLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"RcptToDomain","Docs":"","Typewords":["string"]},{"Name":"MsgFromLocalpart","Docs":"","Typewords":["Localpart"]},{"Name":"MsgFromDomain","Docs":"","Typewords":["string"]},{"Name":"MsgFromOrgDomain","Docs":"","Typewords":["string"]},{"Name":"EHLOValidated","Docs":"","Typewords":["bool"]},{"Name":"MailFromValidated","Docs":"","Typewords":["bool"]},{"Name":"MsgFromValidated","Docs":"","Typewords":["bool"]},{"Name":"EHLOValidation","Docs":"","Typewords":["Validation"]},{"Name":"MailFromValidation","Docs":"","Typewords":["Validation"]},{"Name":"MsgFromValidation","Docs":"","Typewords":["Validation"]},{"Name":"DKIMDomains","Docs":"","Typewords":["[]","string"]},{"Name":"OrigEHLODomain","Docs":"","Typewords":["string"]},{"Name":"OrigDKIMDomains","Docs":"","Typewords":["[]","string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]},{"Name":"SubjectBase","Docs":"","Typewords":["string"]},{"Name":"MessageHash","Docs":"","Typewords":["nullable","string"]},{"Name":"ThreadID","Docs":"","Typewords":["int64"]},{"Name":"ThreadParentIDs","Docs":"","Typewords":["[]","int64"]},{"Name":"ThreadMissingLink","Docs":"","Typewords":["bool"]},{"Name":"ThreadMuted","Docs":"","Typewords":["bool"]},{"Name":"ThreadCollapsed","Docs":"","Typewords":["bool"]},{"Name":"IsMailingList","Docs":"","Typewords":["bool"]},{"Name":"ReceivedTLSVersion","Docs":"","Typewords":["uint16"]},{"Name":"ReceivedTLSCipherSuite","Docs":"","Typewords":["uint16"]},{"Name":"ReceivedRequireTLS","Docs":"","Typewords":["bool"]},{"Name":"Seen","Docs":"","Typewords":["bool"]},{"Name":"Answered","Docs":"","Typewords":["bool"]},{"Name":"Flagged","Docs":"","Typewords":["bool"]},{"Name":"Forwarded","Docs":"","Typewords":["bool"]},{"Name":"Junk","Docs":"","Typewords":["bool"]},{"Name":"Notjunk","Docs":"","Typewords":["bool"]},{"Name":"Deleted","Docs":"","Typewords":["bool"]},{"Name":"Draft","Docs":"","Typewords":["bool"]},{"Name":"Phishing","Docs":"","Typewords":["bool"]},{"Name":"MDNSent","Docs":"","Typewords":["bool"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]},{"Name":"Size","Docs":"","Typewords":["int64"]},{"Name":"TrainedJunk","Docs":"","Typewords":["nullable","bool"]},{"Name":"MsgPrefix","Docs":"","Typewords":["nullable","string"]},{"Name":"ParsedBuf","Docs":"","Typewords":["nullable","string"]}]},
 	"MessageEnvelope": {"Name":"MessageEnvelope","Docs":"","Fields":[{"Name":"Date","Docs":"","Typewords":["timestamp"]},{"Name":"Subject","Docs":"","Typewords":["string"]},{"Name":"From","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"Sender","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"ReplyTo","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"To","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"CC","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"BCC","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"InReplyTo","Docs":"","Typewords":["string"]},{"Name":"MessageID","Docs":"","Typewords":["string"]}]},
 	"Attachment": {"Name":"Attachment","Docs":"","Fields":[{"Name":"Path","Docs":"","Typewords":["[]","int32"]},{"Name":"Filename","Docs":"","Typewords":["string"]},{"Name":"Part","Docs":"","Typewords":["Part"]}]},
+	"SyncMessage": {"Name":"SyncMessage","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]},{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"Flags","Docs":"","Typewords":["Flags"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]}]},
+	"Flags": {"Name":"Flags","Docs":"","Fields":[{"Name":"Seen","Docs":"","Typewords":["bool"]},{"Name":"Answered","Docs":"","Typewords":["bool"]},{"Name":"Flagged","Docs":"","Typewords":["bool"]},{"Name":"Forwarded","Docs":"","Typewords":["bool"]},{"Name":"Junk","Docs":"","Typewords":["bool"]},{"Name":"Notjunk","Docs":"","Typewords":["bool"]},{"Name":"Deleted","Docs":"","Typewords":["bool"]},{"Name":"Draft","Docs":"","Typewords":["bool"]},{"Name":"Phishing","Docs":"","Typewords":["bool"]},{"Name":"MDNSent","Docs":"","Typewords":["bool"]}]},
+	"SyncFlagChange": {"Name":"SyncFlagChange","Docs":"","Fields":[{"Name":"MessageIDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Flags","Docs":"","Typewords":["[]","string"]},{"Name":"Clear","Docs":"","Typewords":["bool"]}]},
+	"SyncFlagsResult": {"Name":"SyncFlagsResult","Docs":"","Fields":[{"Name":"Conflicts","Docs":"","Typewords":["[]","int64"]},{"Name":"Removed","Docs":"","Typewords":["[]","int64"]}]},
+	"EventStart": {"Name":"EventStart","Docs":"","Fields":[{"Name":"SSEID","Docs":"","Typewords":["int64"]},{"Name":"LoginAddress","Docs":"","Typewords":["MessageAddress"]},{"Name":"Addresses","Docs":"","Typewords":["[]","MessageAddress"]},{"Name":"DomainAddressConfigs","Docs":"","Typewords":["{}","DomainAddressConfig"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Mailboxes","Docs":"","Typewords":["[]","Mailbox"]},{"Name":"RejectsMailbox","Docs":"","Typewords":["string"]},{"Name":"Settings","Docs":"","Typewords":["Settings"]},{"Name":"Labels","Docs":"","Typewords":["[]","Label"]},{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"Version","Docs":"","Typewords":["string"]}]},
+	"DomainAddressConfig": {"Name":"DomainAddressConfig","Docs":"","Fields":[{"Name":"LocalpartCatchallSeparator","Docs":"","Typewords":["string"]},{"Name":"LocalpartCaseSensitive","Docs":"","Typewords":["bool"]}]},
+	"EventViewErr": {"Name":"EventViewErr","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"RequestID","Docs":"","Typewords":["int64"]},{"Name":"Err","Docs":"","Typewords":["string"]}]},
+	"EventViewReset": {"Name":"EventViewReset","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"RequestID","Docs":"","Typewords":["int64"]}]},
+	"EventViewMsgs": {"Name":"EventViewMsgs","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"RequestID","Docs":"","Typewords":["int64"]},{"Name":"MessageItems","Docs":"","Typewords":["[]","[]","MessageItem"]},{"Name":"ParsedMessage","Docs":"","Typewords":["nullable","ParsedMessage"]},{"Name":"ViewEnd","Docs":"","Typewords":["bool"]}]},
 	"EventViewChanges": {"Name":"EventViewChanges","Docs":"","Fields":[{"Name":"ViewID","Docs":"","Typewords":["int64"]},{"Name":"Changes","Docs":"","Typewords":["[]","[]","any"]}]},
 	"ChangeMsgAdd": {"Name":"ChangeMsgAdd","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"UID","Docs":"","Typewords":["UID"]},{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"Flags","Docs":"","Typewords":["Flags"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]},{"Name":"MessageItems","Docs":"","Typewords":["[]","MessageItem"]}]},
-	"Flags": {"Name":"Flags","Docs":"","Fields":[{"Name":"Seen","Docs":"","Typewords":["bool"]},{"Name":"Answered","Docs":"","Typewords":["bool"]},{"Name":"Flagged","Docs":"","Typewords":["bool"]},{"Name":"Forwarded","Docs":"","Typewords":["bool"]},{"Name":"Junk","Docs":"","Typewords":["bool"]},{"Name":"Notjunk","Docs":"","Typewords":["bool"]},{"Name":"Deleted","Docs":"","Typewords":["bool"]},{"Name":"Draft","Docs":"","Typewords":["bool"]},{"Name":"Phishing","Docs":"","Typewords":["bool"]},{"Name":"MDNSent","Docs":"","Typewords":["bool"]}]},
 	"ChangeMsgRemove": {"Name":"ChangeMsgRemove","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"UIDs","Docs":"","Typewords":["[]","UID"]},{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]}]},
 	"ChangeMsgFlags": {"Name":"ChangeMsgFlags","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"UID","Docs":"","Typewords":["UID"]},{"Name":"ModSeq","Docs":"","Typewords":["ModSeq"]},{"Name":"Mask","Docs":"","Typewords":["Flags"]},{"Name":"Flags","Docs":"","Typewords":["Flags"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]}]},
 	"ChangeMsgThread": {"Name":"ChangeMsgThread","Docs":"","Fields":[{"Name":"MessageIDs","Docs":"","Typewords":["[]","int64"]},{"Name":"Muted","Docs":"","Typewords":["bool"]},{"Name":"Collapsed","Docs":"","Typewords":["bool"]}]},
@@ -558,12 +792,16 @@ export const types: TypenameMap = {
 	"ChangeMailboxSpecialUse": {"Name":"ChangeMailboxSpecialUse","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"SpecialUse","Docs":"","Typewords":["SpecialUse"]}]},
 	"SpecialUse": {"Name":"SpecialUse","Docs":"","Fields":[{"Name":"Archive","Docs":"","Typewords":["bool"]},{"Name":"Draft","Docs":"","Typewords":["bool"]},{"Name":"Junk","Docs":"","Typewords":["bool"]},{"Name":"Sent","Docs":"","Typewords":["bool"]},{"Name":"Trash","Docs":"","Typewords":["bool"]}]},
 	"ChangeMailboxKeywords": {"Name":"ChangeMailboxKeywords","Docs":"","Fields":[{"Name":"MailboxID","Docs":"","Typewords":["int64"]},{"Name":"MailboxName","Docs":"","Typewords":["string"]},{"Name":"Keywords","Docs":"","Typewords":["[]","string"]}]},
+	"ChangeSettings": {"Name":"ChangeSettings","Docs":"","Fields":[{"Name":"Settings","Docs":"","Typewords":["Settings"]}]},
+	"ChangeLabels": {"Name":"ChangeLabels","Docs":"","Fields":[{"Name":"Labels","Docs":"","Typewords":["[]","Label"]}]},
+	"ChangeSubmissionUndoEnd": {"Name":"ChangeSubmissionUndoEnd","Docs":"","Fields":[{"Name":"ID","Docs":"","Typewords":["int64"]}]},
 	"UID": {"Name":"UID","Docs":"","Values":null},
 	"ModSeq": {"Name":"ModSeq","Docs":"","Values":null},
 	"Validation": {"Name":"Validation","Docs":"","Values":[{"Name":"ValidationUnknown","Value":0,"Docs":""},{"Name":"ValidationStrict","Value":1,"Docs":""},{"Name":"ValidationDMARC","Value":2,"Docs":""},{"Name":"ValidationRelaxed","Value":3,"Docs":""},{"Name":"ValidationPass","Value":4,"Docs":""},{"Name":"ValidationNeutral","Value":5,"Docs":""},{"Name":"ValidationTemperror","Value":6,"Docs":""},{"Name":"ValidationPermerror","Value":7,"Docs":""},{"Name":"ValidationFail","Value":8,"Docs":""},{"Name":"ValidationSoftfail","Value":9,"Docs":""},{"Name":"ValidationNone","Value":10,"Docs":""}]},
 	"CSRFToken": {"Name":"CSRFToken","Docs":"","Values":null},
 	"ThreadMode": {"Name":"ThreadMode","Docs":"","Values":[{"Name":"ThreadOff","Value":"off","Docs":""},{"Name":"ThreadOn","Value":"on","Docs":""},{"Name":"ThreadUnread","Value":"unread","Docs":""}]},
 	"AttachmentType": {"Name":"AttachmentType","Docs":"","Values":[{"Name":"AttachmentIndifferent","Value":"","Docs":""},{"Name":"AttachmentNone","Value":"none","Docs":""},{"Name":"AttachmentAny","Value":"any","Docs":""},{"Name":"AttachmentImage","Value":"image","Docs":""},{"Name":"AttachmentPDF","Value":"pdf","Docs":""},{"Name":"AttachmentArchive","Value":"archive","Docs":""},{"Name":"AttachmentSpreadsheet","Value":"spreadsheet","Docs":""},{"Name":"AttachmentDocument","Value":"document","Docs":""},{"Name":"AttachmentPresentation","Value":"presentation","Docs":""}]},
+	"Quoting": {"Name":"Quoting","Docs":"","Values":[{"Name":"Default","Value":"","Docs":""},{"Name":"Bottom","Value":"bottom","Docs":""},{"Name":"Top","Value":"top","Docs":""}]},
 	"SecurityResult": {"Name":"SecurityResult","Docs":"","Values":[{"Name":"SecurityResultError","Value":"error","Docs":""},{"Name":"SecurityResultNo","Value":"no","Docs":""},{"Name":"SecurityResultYes","Value":"yes","Docs":""},{"Name":"SecurityResultUnknown","Value":"unknown","Docs":""}]},
 	"Localpart": {"Name":"Localpart","Docs":"","Values":null},
 }
@@ -572,6 +810,7 @@ export const parser = {
 	Request: (v: any) => parse("Request", v) as Request,
 	Query: (v: any) => parse("Query", v) as Query,
 	Filter: (v: any) => parse("Filter", v) as Filter,
+	FilterAlternative: (v: any) => parse("FilterAlternative", v) as FilterAlternative,
 	NotFilter: (v: any) => parse("NotFilter", v) as NotFilter,
 	Page: (v: any) => parse("Page", v) as Page,
 	ParsedMessage: (v: any) => parse("ParsedMessage", v) as ParsedMessage,
@@ -580,23 +819,41 @@ export const parser = {
 	Address: (v: any) => parse("Address", v) as Address,
 	MessageAddress: (v: any) => parse("MessageAddress", v) as MessageAddress,
 	Domain: (v: any) => parse("Domain", v) as Domain,
+	Invite: (v: any) => parse("Invite", v) as Invite,
+	Calendar: (v: any) => parse("Calendar", v) as Calendar,
+	CalendarEvent: (v: any) => parse("CalendarEvent", v) as CalendarEvent,
+	CalendarAddress: (v: any) => parse("CalendarAddress", v) as CalendarAddress,
 	SubmitMessage: (v: any) => parse("SubmitMessage", v) as SubmitMessage,
 	File: (v: any) => parse("File", v) as File,
 	ForwardAttachments: (v: any) => parse("ForwardAttachments", v) as ForwardAttachments,
+	SubmitResult: (v: any) => parse("SubmitResult", v) as SubmitResult,
+	Contact: (v: any) => parse("Contact", v) as Contact,
+	InviteStatus: (v: any) => parse("InviteStatus", v) as InviteStatus,
+	Settings: (v: any) => parse("Settings", v) as Settings,
+	Label: (v: any) => parse("Label", v) as Label,
+	SavedSearchItem: (v: any) => parse("SavedSearchItem", v) as SavedSearchItem,
 	Mailbox: (v: any) => parse("Mailbox", v) as Mailbox,
 	RecipientSecurity: (v: any) => parse("RecipientSecurity", v) as RecipientSecurity,
+	ExportProgress: (v: any) => parse("ExportProgress", v) as ExportProgress,
+	JunkExplanation: (v: any) => parse("JunkExplanation", v) as JunkExplanation,
+	Classification: (v: any) => parse("Classification", v) as Classification,
+	WordProbability: (v: any) => parse("WordProbability", v) as WordProbability,
+	SyncResult: (v: any) => parse("SyncResult", v) as SyncResult,
+	MessageItem: (v: any) => parse("MessageItem", v) as MessageItem,
+	Message: (v: any) => parse("Message", v) as Message,
+	MessageEnvelope: (v: any) => parse("MessageEnvelope", v) as MessageEnvelope,
+	Attachment: (v: any) => parse("Attachment", v) as Attachment,
+	SyncMessage: (v: any) => parse("SyncMessage", v) as SyncMessage,
+	Flags: (v: any) => parse("Flags", v) as Flags,
+	SyncFlagChange: (v: any) => parse("SyncFlagChange", v) as SyncFlagChange,
+	SyncFlagsResult: (v: any) => parse("SyncFlagsResult", v) as SyncFlagsResult,
 	EventStart: (v: any) => parse("EventStart", v) as EventStart,
 	DomainAddressConfig: (v: any) => parse("DomainAddressConfig", v) as DomainAddressConfig,
 	EventViewErr: (v: any) => parse("EventViewErr", v) as EventViewErr,
 	EventViewReset: (v: any) => parse("EventViewReset", v) as EventViewReset,
 	EventViewMsgs: (v: any) => parse("EventViewMsgs", v) as EventViewMsgs,
-	MessageItem: (v: any) => parse("MessageItem", v) as MessageItem,
-	Message: (v: any) => parse("Message", v) as Message,
-	MessageEnvelope: (v: any) => parse("MessageEnvelope", v) as MessageEnvelope,
-	Attachment: (v: any) => parse("Attachment", v) as Attachment,
 	EventViewChanges: (v: any) => parse("EventViewChanges", v) as EventViewChanges,
 	ChangeMsgAdd: (v: any) => parse("ChangeMsgAdd", v) as ChangeMsgAdd,
-	Flags: (v: any) => parse("Flags", v) as Flags,
 	ChangeMsgRemove: (v: any) => parse("ChangeMsgRemove", v) as ChangeMsgRemove,
 	ChangeMsgFlags: (v: any) => parse("ChangeMsgFlags", v) as ChangeMsgFlags,
 	ChangeMsgThread: (v: any) => parse("ChangeMsgThread", v) as ChangeMsgThread,
@@ -607,12 +864,16 @@ export const parser = {
 	ChangeMailboxSpecialUse: (v: any) => parse("ChangeMailboxSpecialUse", v) as ChangeMailboxSpecialUse,
 	SpecialUse: (v: any) => parse("SpecialUse", v) as SpecialUse,
 	ChangeMailboxKeywords: (v: any) => parse("ChangeMailboxKeywords", v) as ChangeMailboxKeywords,
+	ChangeSettings: (v: any) => parse("ChangeSettings", v) as ChangeSettings,
+	ChangeLabels: (v: any) => parse("ChangeLabels", v) as ChangeLabels,
+	ChangeSubmissionUndoEnd: (v: any) => parse("ChangeSubmissionUndoEnd", v) as ChangeSubmissionUndoEnd,
 	UID: (v: any) => parse("UID", v) as UID,
 	ModSeq: (v: any) => parse("ModSeq", v) as ModSeq,
 	Validation: (v: any) => parse("Validation", v) as Validation,
 	CSRFToken: (v: any) => parse("CSRFToken", v) as CSRFToken,
 	ThreadMode: (v: any) => parse("ThreadMode", v) as ThreadMode,
 	AttachmentType: (v: any) => parse("AttachmentType", v) as AttachmentType,
+	Quoting: (v: any) => parse("Quoting", v) as Quoting,
 	SecurityResult: (v: any) => parse("SecurityResult", v) as SecurityResult,
 	Localpart: (v: any) => parse("Localpart", v) as Localpart,
 }
@@ -655,12 +916,14 @@ export class Client {
 	}
 
 	// Login returns a session token for the credentials, or fails with error code
-	// "user:badLogin". Call LoginPrep to get a loginToken.
-	async Login(loginToken: string, username: string, password: string): Promise<CSRFToken> {
+	// "user:badLogin". Call LoginPrep to get a loginToken. If two-factor
+	// authentication is enabled for the account and totpCode is empty, the call fails
+	// with error code "user:totpRequired", and should be repeated with a totpCode.
+	async Login(loginToken: string, username: string, password: string, totpCode: string): Promise<CSRFToken> {
 		const fn: string = "Login"
-		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const paramTypes: string[][] = [["string"],["string"],["string"],["string"]]
 		const returnTypes: string[][] = [["CSRFToken"]]
-		const params: any[] = [loginToken, username, password]
+		const params: any[] = [loginToken, username, password, totpCode]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as CSRFToken
 	}
 
@@ -713,14 +976,84 @@ export class Client {
 	// 
 	// If a Sent mailbox is configured, messages are added to it after submitting
 	// to the delivery queue.
-	async MessageSubmit(m: SubmitMessage): Promise<void> {
+	// 
+	// If From is empty, the default From address from the settings is used, or the
+	// login address if no default is configured.
+	// 
+	// If the account has a send delay configured, delivery attempts only start after
+	// the delay, and until then the submission can be undone with MessageSubmitUndo.
+	async MessageSubmit(m: SubmitMessage): Promise<SubmitResult> {
 		const fn: string = "MessageSubmit"
 		const paramTypes: string[][] = [["SubmitMessage"]]
-		const returnTypes: string[][] = []
+		const returnTypes: string[][] = [["SubmitResult"]]
 		const params: any[] = [m]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SubmitResult
+	}
+
+	// submit composes and submits message m, see MessageSubmit. If calendarReply is
+	// set, it is an iCalendar object with method REPLY that is added as text/calendar
+	// alternative to the text body. If sendDelay is set, the send delay from the
+	// account settings is applied.
+	async submit(m: SubmitMessage, calendarReply: string, sendDelay: boolean): Promise<SubmitResult> {
+		const fn: string = "submit"
+		const paramTypes: string[][] = [["SubmitMessage"],["string"],["bool"]]
+		const returnTypes: string[][] = [["SubmitResult"]]
+		const params: any[] = [m, calendarReply, sendDelay]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SubmitResult
+	}
+
+	// MessageSubmitUndo undoes a submission made with a send delay, as returned by
+	// MessageSubmit. This is only possible while delivery of the message has not
+	// started. The message is removed from the delivery queue and from the Sent
+	// mailbox, and added as draft message, including its Bcc header, whose ID is
+	// returned.
+	async MessageSubmitUndo(undoID: number): Promise<number> {
+		const fn: string = "MessageSubmitUndo"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["int64"]]
+		const params: any[] = [undoID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as number
+	}
+
+	// MessageDraftSave stores m as draft message in the mailbox with special-use flag
+	// Draft, and returns the ID of the new message. If m.DraftMessageID is set, that
+	// previous version of the draft is removed in the same transaction.
+	// 
+	// Unlike with MessageSubmit, recipients are optional, and Bcc addresses are
+	// kept in the message header.
+	async MessageDraftSave(m: SubmitMessage): Promise<number> {
+		const fn: string = "MessageDraftSave"
+		const paramTypes: string[][] = [["SubmitMessage"]]
+		const returnTypes: string[][] = [["int64"]]
+		const params: any[] = [m]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as number
+	}
+
+	// MessageDraftDelete removes a draft message, e.g. when the message is
+	// discarded in the composer. Removing a draft that no longer exists is not an
+	// error.
+	async MessageDraftDelete(draftMessageID: number): Promise<void> {
+		const fn: string = "MessageDraftDelete"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [draftMessageID]
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
 	}
 
+	// MessageDraftOpen returns a draft message as SubmitMessage, for continuing to
+	// compose it. If the draft has an HTML part, it is returned as HTMLBody, with
+	// inline images as data URIs. Attachments are returned as files with data URIs.
+	// If the draft is a reply to a message in the account, ResponseMessageID is set.
+	// When the message is submitted or saved again, DraftMessageID is used to remove
+	// this draft.
+	async MessageDraftOpen(draftMessageID: number): Promise<SubmitMessage> {
+		const fn: string = "MessageDraftOpen"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["SubmitMessage"]]
+		const params: any[] = [draftMessageID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SubmitMessage
+	}
+
 	// MessageMove moves messages to another mailbox. If the message is already in
 	// the mailbox an error is returned.
 	async MessageMove(messageIDs: number[] | null, mailboxID: number): Promise<void> {
@@ -798,7 +1131,8 @@ export class Client {
 	}
 
 	// CompleteRecipient returns autocomplete matches for a recipient, returning the
-	// matches, most recently used first, and whether this is the full list and further
+	// matches, contacts from the address book first, then previous recipients with
+	// most recently used first, and whether this is the full list and further
 	// requests for longer prefixes aren't necessary.
 	async CompleteRecipient(search: string): Promise<[string[] | null, boolean]> {
 		const fn: string = "CompleteRecipient"
@@ -808,6 +1142,166 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [string[] | null, boolean]
 	}
 
+	// ContactList returns all contacts in the address book, sorted by name.
+	async ContactList(): Promise<Contact[] | null> {
+		const fn: string = "ContactList"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","Contact"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Contact[] | null
+	}
+
+	// ContactSave adds a new contact to the address book if its ID is zero, or
+	// updates an existing contact. The saved contact is returned.
+	async ContactSave(contact: Contact): Promise<Contact> {
+		const fn: string = "ContactSave"
+		const paramTypes: string[][] = [["Contact"]]
+		const returnTypes: string[][] = [["Contact"]]
+		const params: any[] = [contact]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Contact
+	}
+
+	// ContactDelete removes a contact from the address book.
+	async ContactDelete(contactID: number): Promise<void> {
+		const fn: string = "ContactDelete"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [contactID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// CalendarReply answers a meeting invitation in the text/calendar part at
+	// partPath of a message, with participation status "ACCEPTED", "TENTATIVE" or
+	// "DECLINED", and an optional comment for the organizer. The reply (iMIP) is sent
+	// to the organizer through the regular submission, from the address of this
+	// account that was invited, and is added to the Sent mailbox.
+	async CalendarReply(messageID: number, partPath: number[] | null, partStat: string, comment: string): Promise<void> {
+		const fn: string = "CalendarReply"
+		const paramTypes: string[][] = [["int64"],["[]","int32"],["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [messageID, partPath, partStat, comment]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// InviteStatuses returns the status for each invitation in a message, in the
+	// order of ParsedMessage.Invites.
+	async InviteStatuses(messageID: number): Promise<InviteStatus[] | null> {
+		const fn: string = "InviteStatuses"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["[]","InviteStatus"]]
+		const params: any[] = [messageID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as InviteStatus[] | null
+	}
+
+	// Settings returns the webmail settings of the account. They are also sent in
+	// the start event of the SSE connection.
+	async Settings(): Promise<Settings> {
+		const fn: string = "Settings"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["Settings"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Settings
+	}
+
+	// SettingsSave saves the webmail settings of the account. Other sessions of the
+	// account get the new settings in a ChangeSettings event.
+	async SettingsSave(settings: Settings): Promise<void> {
+		const fn: string = "SettingsSave"
+		const paramTypes: string[][] = [["Settings"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [settings]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// Labels returns the labels of the account, sorted by name.
+	async Labels(): Promise<Label[] | null> {
+		const fn: string = "Labels"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","Label"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Label[] | null
+	}
+
+	// LabelCreate adds a label for a keyword, with a name and color for display. If
+	// keyword is empty, the lower-cased name is used. Color is of the form "#rrggbb",
+	// or empty for the default color.
+	async LabelCreate(name: string, keyword: string, color: string): Promise<Label> {
+		const fn: string = "LabelCreate"
+		const paramTypes: string[][] = [["string"],["string"],["string"]]
+		const returnTypes: string[][] = [["Label"]]
+		const params: any[] = [name, keyword, color]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Label
+	}
+
+	// LabelRename changes the name and keyword of a label. If the keyword changes, it
+	// is replaced on all messages.
+	async LabelRename(labelID: number, name: string, keyword: string): Promise<void> {
+		const fn: string = "LabelRename"
+		const paramTypes: string[][] = [["int64"],["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [labelID, name, keyword]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// LabelColor changes the color of a label. Color is of the form "#rrggbb", or
+	// empty for the default color.
+	async LabelColor(labelID: number, color: string): Promise<void> {
+		const fn: string = "LabelColor"
+		const paramTypes: string[][] = [["int64"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [labelID, color]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// LabelDelete removes a label, and its keyword from all messages.
+	async LabelDelete(labelID: number): Promise<void> {
+		const fn: string = "LabelDelete"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [labelID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// SearchParse parses a search query, as typed in the search bar, into a Query.
+	// See ParseSearch for the syntax. A mailbox name in the search is resolved into
+	// Filter.MailboxID, and label names are resolved into their keywords.
+	async SearchParse(search: string): Promise<Query> {
+		const fn: string = "SearchParse"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["Query"]]
+		const params: any[] = [search]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as Query
+	}
+
+	// SavedSearches returns the saved searches of the account, sorted by name, with
+	// the current number of unread messages matching each search.
+	async SavedSearches(): Promise<SavedSearchItem[] | null> {
+		const fn: string = "SavedSearches"
+		const paramTypes: string[][] = []
+		const returnTypes: string[][] = [["[]","SavedSearchItem"]]
+		const params: any[] = []
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SavedSearchItem[] | null
+	}
+
+	// SavedSearchSave saves a search under a name, replacing the search of an
+	// existing saved search with the same name.
+	async SavedSearchSave(name: string, search: string): Promise<void> {
+		const fn: string = "SavedSearchSave"
+		const paramTypes: string[][] = [["string"],["string"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [name, search]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
+	// SavedSearchDelete removes a saved search.
+	async SavedSearchDelete(savedSearchID: number): Promise<void> {
+		const fn: string = "SavedSearchDelete"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = []
+		const params: any[] = [savedSearchID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as void
+	}
+
 	// MailboxSetSpecialUse sets the special use flags of a mailbox.
 	async MailboxSetSpecialUse(mb: Mailbox): Promise<void> {
 		const fn: string = "MailboxSetSpecialUse"
@@ -848,13 +1342,59 @@ export class Client {
 		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as RecipientSecurity
 	}
 
+	// ExportProgress returns the progress of an export started through the export
+	// endpoint with progressID. Exports that were not started yet, or that finished a
+	// while ago, return zero values.
+	async ExportProgress(progressID: string): Promise<ExportProgress> {
+		const fn: string = "ExportProgress"
+		const paramTypes: string[][] = [["string"]]
+		const returnTypes: string[][] = [["ExportProgress"]]
+		const params: any[] = [progressID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as ExportProgress
+	}
+
+	// JunkExplain classifies a message with the current junk filter of the account,
+	// returning the most hammy and spammy words that determined the probability.
+	// Training since delivery may result in a different classification than at the
+	// time of delivery.
+	async JunkExplain(msgID: number): Promise<JunkExplanation> {
+		const fn: string = "JunkExplain"
+		const paramTypes: string[][] = [["int64"]]
+		const returnTypes: string[][] = [["JunkExplanation"]]
+		const params: any[] = [msgID]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as JunkExplanation
+	}
+
+	// Sync returns the changes to messages since modseq, and all mailboxes. Used by
+	// clients that keep messages cached, e.g. while offline, and reconnect. Pass
+	// modseq 0 for the initial call, the result has Full set and the current modseq.
+	async Sync(modseq: ModSeq): Promise<SyncResult> {
+		const fn: string = "Sync"
+		const paramTypes: string[][] = [["ModSeq"]]
+		const returnTypes: string[][] = [["SyncResult"]]
+		const params: any[] = [modseq]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SyncResult
+	}
+
+	// SyncFlags applies flag changes that a client made while offline, when its
+	// state was synchronized at modseq. Changes are applied in order. Messages that
+	// were changed since modseq are not modified, and returned as conflicts, as are
+	// messages that were removed.
+	async SyncFlags(modseq: ModSeq, changes: SyncFlagChange[] | null): Promise<SyncFlagsResult> {
+		const fn: string = "SyncFlags"
+		const paramTypes: string[][] = [["ModSeq"],["[]","SyncFlagChange"]]
+		const returnTypes: string[][] = [["SyncFlagsResult"]]
+		const params: any[] = [modseq, changes]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as SyncFlagsResult
+	}
+
 	// SSETypes exists to ensure the generated API contains the types, for use in SSE events.
-	async SSETypes(): Promise<[EventStart, EventViewErr, EventViewReset, EventViewMsgs, EventViewChanges, ChangeMsgAdd, ChangeMsgRemove, ChangeMsgFlags, ChangeMsgThread, ChangeMailboxRemove, ChangeMailboxAdd, ChangeMailboxRename, ChangeMailboxCounts, ChangeMailboxSpecialUse, ChangeMailboxKeywords, Flags]> {
+	async SSETypes(): Promise<[EventStart, EventViewErr, EventViewReset, EventViewMsgs, EventViewChanges, ChangeMsgAdd, ChangeMsgRemove, ChangeMsgFlags, ChangeMsgThread, ChangeMailboxRemove, ChangeMailboxAdd, ChangeMailboxRename, ChangeMailboxCounts, ChangeMailboxSpecialUse, ChangeMailboxKeywords, ChangeSettings, ChangeLabels, ChangeSubmissionUndoEnd, Flags]> {
 		const fn: string = "SSETypes"
 		const paramTypes: string[][] = []
-		const returnTypes: string[][] = [["EventStart"],["EventViewErr"],["EventViewReset"],["EventViewMsgs"],["EventViewChanges"],["ChangeMsgAdd"],["ChangeMsgRemove"],["ChangeMsgFlags"],["ChangeMsgThread"],["ChangeMailboxRemove"],["ChangeMailboxAdd"],["ChangeMailboxRename"],["ChangeMailboxCounts"],["ChangeMailboxSpecialUse"],["ChangeMailboxKeywords"],["Flags"]]
+		const returnTypes: string[][] = [["EventStart"],["EventViewErr"],["EventViewReset"],["EventViewMsgs"],["EventViewChanges"],["ChangeMsgAdd"],["ChangeMsgRemove"],["ChangeMsgFlags"],["ChangeMsgThread"],["ChangeMailboxRemove"],["ChangeMailboxAdd"],["ChangeMailboxRename"],["ChangeMailboxCounts"],["ChangeMailboxSpecialUse"],["ChangeMailboxKeywords"],["ChangeSettings"],["ChangeLabels"],["ChangeSubmissionUndoEnd"],["Flags"]]
 		const params: any[] = []
-		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [EventStart, EventViewErr, EventViewReset, EventViewMsgs, EventViewChanges, ChangeMsgAdd, ChangeMsgRemove, ChangeMsgFlags, ChangeMsgThread, ChangeMailboxRemove, ChangeMailboxAdd, ChangeMailboxRename, ChangeMailboxCounts, ChangeMailboxSpecialUse, ChangeMailboxKeywords, Flags]
+		return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params) as [EventStart, EventViewErr, EventViewReset, EventViewMsgs, EventViewChanges, ChangeMsgAdd, ChangeMsgRemove, ChangeMsgFlags, ChangeMsgThread, ChangeMailboxRemove, ChangeMailboxAdd, ChangeMailboxRename, ChangeMailboxCounts, ChangeMailboxSpecialUse, ChangeMailboxKeywords, ChangeSettings, ChangeLabels, ChangeSubmissionUndoEnd, Flags]
 	}
 }
 
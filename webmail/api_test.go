@@ -3,12 +3,15 @@ package webmail
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/exp/slices"
 
@@ -16,6 +19,7 @@ import (
 	"github.com/mjl-/sherpa"
 
 	"github.com/qompassai/beacon/dns"
+	"github.com/qompassai/beacon/message"
 	"github.com/qompassai/beacon/mlog"
 	"github.com/qompassai/beacon/beacon-"
 	"github.com/qompassai/beacon/queue"
@@ -91,7 +95,7 @@ func TestAPI(t *testing.T) {
 	loginctx := context.WithValue(ctxbg, requestInfoCtxKey, loginReqInfo)
 
 	// Missing login token.
-	tneedErrorCode(t, "user:error", func() { api.Login(loginctx, "", "mjl@beacon.example", "test1234") })
+	tneedErrorCode(t, "user:error", func() { api.Login(loginctx, "", "mjl@beacon.example", "test1234", "") })
 
 	// Login with loginToken.
 	loginCookie := &http.Cookie{Name: "webmaillogin"}
@@ -116,7 +120,7 @@ func TestAPI(t *testing.T) {
 			}
 		}()
 
-		api.Login(loginctx, loginCookie.Value, username, password)
+		api.Login(loginctx, loginCookie.Value, username, password, "")
 	}
 	testLogin("mjl@beacon.example", "test1234")
 	testLogin("mjl@beacon.example", "bad", "user:loginFailed")
@@ -169,6 +173,88 @@ func TestAPI(t *testing.T) {
 	tneedError(t, func() { api.FlagsClear(ctx, []int64{inboxText.ID}, []string{``}) })
 	tneedError(t, func() { api.FlagsClear(ctx, []int64{inboxText.ID}, []string{`\unknownsystem`}) })
 
+	// Labels, renamed and removed on messages too.
+	tcompare(t, len(api.Labels(ctx)), 0)
+	label := api.LabelCreate(ctx, " Work ", "", "#ff8800")
+	tcompare(t, label, store.Label{ID: label.ID, Name: "Work", Keyword: "work", Color: "#ff8800"})
+	tcompare(t, api.Labels(ctx), []store.Label{label})
+	tneedError(t, func() { api.LabelCreate(ctx, "Other", "WORK", "") }) // Duplicate keyword.
+	tneedError(t, func() { api.LabelCreate(ctx, "Work", "other", "") }) // Duplicate name.
+	tneedError(t, func() { api.LabelCreate(ctx, "", "other", "") })
+	tneedError(t, func() { api.LabelCreate(ctx, "Other", "bad keyword", "") })
+	tneedError(t, func() { api.LabelCreate(ctx, "Other", `\seen`, "") })
+	tneedError(t, func() { api.LabelCreate(ctx, "Other", "", "red") })
+	api.FlagsAdd(ctx, []int64{inboxText.ID}, []string{"work"})
+	api.LabelRename(ctx, label.ID, "Job", "job")
+	lm := store.Message{ID: inboxText.ID}
+	err = acc.DB.Get(ctx, &lm)
+	tcheck(t, err, "get message")
+	tcompare(t, lm.Keywords, []string{"job"})
+	lmb := store.Mailbox{ID: lm.MailboxID}
+	err = acc.DB.Get(ctx, &lmb)
+	tcheck(t, err, "get mailbox")
+	if !slices.Contains(lmb.Keywords, "job") || slices.Contains(lmb.Keywords, "work") {
+		t.Fatalf("mailbox keywords %v, expected job instead of work", lmb.Keywords)
+	}
+	lq := api.SearchParse(ctx, `label:JOB -l:other`)
+	tcompare(t, lq.Filter.Labels, []string{"job"})
+	tcompare(t, lq.NotFilter.Labels, []string{"other"})
+	api.LabelColor(ctx, label.ID, "")
+	tcompare(t, api.Labels(ctx), []store.Label{{ID: label.ID, Name: "Job", Keyword: "job"}})
+	tneedError(t, func() { api.LabelColor(ctx, label.ID, "#12345") })
+	tneedError(t, func() { api.LabelRename(ctx, 1<<40, "x", "x") })
+	api.LabelDelete(ctx, label.ID)
+	err = acc.DB.Get(ctx, &lm)
+	tcheck(t, err, "get message")
+	tcompare(t, len(lm.Keywords), 0)
+	tcompare(t, len(api.Labels(ctx)), 0)
+	tneedError(t, func() { api.LabelDelete(ctx, label.ID) })
+
+	// JunkExplain
+	jx := api.JunkExplain(ctx, inboxText.ID)
+	tcompare(t, jx.Threshold, 0.95)
+	if jx.Classification.Words == 0 {
+		t.Fatalf("junk explain found no words in message")
+	}
+	tneedError(t, func() { api.JunkExplain(ctx, 1<<40) })
+
+	// SearchParse
+	q := api.SearchParse(ctx, `mb:Testbox1 s:test OR -f:mjl`)
+	tcompare(t, q.Filter.MailboxName, "")
+	if q.Filter.MailboxID <= 0 || len(q.Filter.Or) != 1 {
+		t.Fatalf("unexpected query %#v", q)
+	}
+	tneedError(t, func() { api.SearchParse(ctx, `mb:Bogus`) })
+	tneedError(t, func() { api.SearchParse(ctx, `a OR`) })
+
+	// SavedSearchSave, SavedSearches, SavedSearchDelete
+	api.SavedSearchSave(ctx, "messages", "subject:message")
+	api.SavedSearchSave(ctx, "text", "s:text OR s:html -s:html")
+	api.SavedSearchSave(ctx, "testbox", "mb:Testbox1")
+	api.SavedSearchSave(ctx, "gone", "mb:Testbox1")
+	tneedError(t, func() { api.SavedSearchSave(ctx, "", "subject:x") })
+	tneedError(t, func() { api.SavedSearchSave(ctx, "bad", "(subject:x") })
+	savedSearchUnread := func() map[string]int {
+		t.Helper()
+		m := map[string]int{}
+		for _, ss := range api.SavedSearches(ctx) {
+			m[ss.Name] = ss.Unread
+		}
+		return m
+	}
+	tcompare(t, savedSearchUnread(), map[string]int{"messages": 2, "text": 1, "testbox": 1, "gone": 1})
+	api.FlagsAdd(ctx, []int64{inboxText.ID}, []string{`\seen`})
+	api.SavedSearchSave(ctx, "gone", "mb:Inbox -s:message")
+	tcompare(t, savedSearchUnread(), map[string]int{"messages": 1, "text": 0, "testbox": 1, "gone": 4})
+	api.FlagsClear(ctx, []int64{inboxText.ID}, []string{`\seen`})
+	for _, ss := range api.SavedSearches(ctx) {
+		if ss.Name == "gone" {
+			api.SavedSearchDelete(ctx, ss.ID)
+		}
+	}
+	tcompare(t, len(api.SavedSearches(ctx)), 3)
+	tneedError(t, func() { api.SavedSearchDelete(ctx, 1<<40) })
+
 	// MailboxSetSpecialUse
 	var inbox, archive, sent, testbox1 store.Mailbox
 	err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
@@ -242,6 +328,16 @@ func TestAPI(t *testing.T) {
 	tneedError(t, func() { api.ParsedMessage(ctx, testbox1Alt.ID) }) // Message was removed and no longer exists.
 	tneedError(t, func() { api.MailboxEmpty(ctx, 0) })               // Bad ID.
 
+	// Sync without state, for the current modseq.
+	sr := api.Sync(ctx, 0)
+	tcompare(t, sr.Full, true)
+	tcompare(t, len(sr.Added), 0)
+	tcompare(t, len(sr.Mailboxes) > 0, true)
+	syncModSeq := sr.ModSeq
+	tneedError(t, func() { api.Sync(ctx, -1) })
+	tneedError(t, func() { api.Sync(ctx, syncModSeq+1) }) // In the future.
+	oldAltRelID := inboxAltRel.ID
+
 	// MessageMove
 	tneedError(t, func() { api.MessageMove(ctx, []int64{testbox1Alt.ID}, inbox.ID) }) // Message was removed (with MailboxEmpty above).
 	api.MessageMove(ctx, []int64{}, testbox1.ID)                                      // No messages.
@@ -268,6 +364,60 @@ func TestAPI(t *testing.T) {
 	tdeliver(t, acc, testbox1Alt)
 	tdeliver(t, acc, inboxAltRel)
 
+	// Sync, with changes from the moves, deletes and deliveries above.
+	sr = api.Sync(ctx, syncModSeq)
+	tcompare(t, sr.Full, false)
+	tcompare(t, sr.More, false)
+	for _, id := range []int64{inboxMinimal.ID, inboxHTML.ID, inboxText.ID, oldAltRelID} {
+		if !slices.Contains(sr.Removed, id) {
+			t.Fatalf("sync: message %d not in removed %v", id, sr.Removed)
+		}
+	}
+	var syncAdded []int64
+	for _, mi := range sr.Added {
+		syncAdded = append(syncAdded, mi.Message.ID)
+	}
+	tcompare(t, syncAdded, []int64{testbox1Alt.ID, inboxAltRel.ID})
+	tcompare(t, len(sr.Changed), 1)
+	tcompare(t, sr.Changed[0].ID, rejectsMinimal.ID)
+	tcompare(t, sr.Changed[0].MailboxID, testbox1.ID) // Moved.
+
+	// SyncFlags, with a conflicting change made after the sync.
+	syncModSeq = sr.ModSeq
+	api.FlagsAdd(ctx, []int64{inboxAlt.ID}, []string{`\flagged`})
+	sfr := api.SyncFlags(ctx, syncModSeq, []SyncFlagChange{
+		{[]int64{inboxAlt.ID, inboxAltRel.ID}, []string{`\seen`}, false},
+		{[]int64{inboxAltRel.ID}, []string{`offline`}, false},
+		{[]int64{inboxAltRel.ID}, []string{`\seen`}, true},
+		{[]int64{inboxMinimal.ID}, []string{`\seen`}, false},
+	})
+	tcompare(t, sfr, SyncFlagsResult{Conflicts: []int64{inboxAlt.ID}, Removed: []int64{inboxMinimal.ID}})
+	sr = api.Sync(ctx, syncModSeq)
+	tcompare(t, len(sr.Changed), 2)
+	tcompare(t, sr.Changed[0].Flags.Flagged, true)
+	tcompare(t, sr.Changed[1].ID, inboxAltRel.ID)
+	tcompare(t, sr.Changed[1].Flags.Seen, false)
+	tcompare(t, sr.Changed[1].Keywords, []string{"offline"})
+	tneedError(t, func() { api.SyncFlags(ctx, 0, nil) })
+	badChanges := []SyncFlagChange{{[]int64{inboxAlt.ID}, []string{` bad syntax `}, false}}
+	tneedError(t, func() { api.SyncFlags(ctx, sr.ModSeq, badChanges) })
+	api.FlagsClear(ctx, []int64{inboxAlt.ID}, []string{`\flagged`})
+	api.FlagsClear(ctx, []int64{inboxAltRel.ID}, []string{`offline`})
+
+	// Sync needs full resync when removed messages were cleaned up.
+	err = acc.DB.Write(ctx, func(tx *bstore.Tx) error {
+		ss := store.SyncState{ID: 1}
+		if err := tx.Get(&ss); err != nil {
+			return err
+		}
+		ss.HighestDeletedModSeq = syncModSeq + 1
+		return tx.Update(&ss)
+	})
+	tcheck(t, err, "update sync state")
+	sr = api.Sync(ctx, syncModSeq)
+	tcompare(t, sr.Full, true)
+	tcompare(t, len(sr.Changed), 0)
+
 	// MessageSubmit
 	queue.Localserve = true // Deliver directly to us instead attempting actual delivery.
 	api.MessageSubmit(ctx, SubmitMessage{
@@ -345,6 +495,282 @@ func TestAPI(t *testing.T) {
 		TextBody: fmt.Sprintf("%80s", "tést"),
 	})
 
+	// Send html with inline image, with generated text part.
+	api.MessageSubmit(ctx, SubmitMessage{
+		From:     "mjl@beacon.example",
+		To:       []string{"mjl+to@beacon.example"},
+		Subject:  "html",
+		HTMLBody: `<p>hi <b>there</b></p><img src="data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==" alt="logo"><script>alert(1)</script>`,
+		Attachments: []File{
+			{
+				Filename: "test.txt",
+				DataURI:  "data:text/plain;base64,dGVzdAo=",
+			},
+		},
+	})
+	// Only images can be inlined.
+	tneedError(t, func() {
+		api.MessageSubmit(ctx, SubmitMessage{
+			From:     "mjl@beacon.example",
+			To:       []string{"mjl+to@beacon.example"},
+			HTMLBody: `<img src="data:text/plain;base64,dGVzdAo=">`,
+		})
+	})
+
+	// Submissions with a SubmitID are sent only once. A failed submission can be
+	// retried with the same ID.
+	tneedError(t, func() {
+		api.MessageSubmit(ctx, SubmitMessage{
+			From:     "mjl@beacon.example",
+			To:       []string{"mjl+to@beacon.example"},
+			HTMLBody: `<img src="data:text/plain;base64,dGVzdAo=">`,
+			SubmitID: "submit1",
+		})
+	})
+	submitOnce := SubmitMessage{
+		From:     "mjl@beacon.example",
+		To:       []string{"mjl+to@beacon.example"},
+		TextBody: "only once",
+		SubmitID: "submit1",
+	}
+	sres := api.MessageSubmit(ctx, submitOnce)
+	tcompare(t, sres.Duplicate, false)
+	sres = api.MessageSubmit(ctx, submitOnce)
+	tcompare(t, sres.Duplicate, true)
+
+	// MessageDraftSave, without draft mailbox.
+	draft := SubmitMessage{
+		From:     "mjl <mjl@beacon.example>",
+		To:       []string{},
+		Cc:       []string{},
+		Bcc:      []string{"mjl bcc <mjl+bcc@beacon.example>"},
+		Subject:  "unfinished",
+		TextBody: "to be continued",
+		Attachments: []File{
+			{
+				Filename: "test1.png",
+				DataURI:  "data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==",
+			},
+		},
+		ResponseMessageID: testbox1Alt.ID,
+	}
+	tneedError(t, func() { api.MessageDraftSave(ctx, draft) })
+
+	var drafts store.Mailbox
+	err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+		drafts, err = bstore.QueryTx[store.Mailbox](tx).FilterNonzero(store.Mailbox{Name: "Drafts"}).Get()
+		return err
+	})
+	tcheck(t, err, "get drafts mailbox")
+	api.MailboxSetSpecialUse(ctx, store.Mailbox{ID: drafts.ID, SpecialUse: store.SpecialUse{Draft: true}})
+
+	// MessageDraftSave and MessageDraftOpen.
+	draftID := api.MessageDraftSave(ctx, draft)
+	opened := api.MessageDraftOpen(ctx, draftID)
+	draft.DraftMessageID = draftID
+	tcompare(t, opened, draft)
+
+	// Saving again replaces the previous draft.
+	opened.TextBody = "continued"
+	draftID2 := api.MessageDraftSave(ctx, opened)
+	tneedError(t, func() { api.MessageDraftOpen(ctx, draftID) })
+	opened = api.MessageDraftOpen(ctx, draftID2)
+	tcompare(t, opened.TextBody, "continued")
+	tcompare(t, opened.DraftMessageID, draftID2)
+
+	// HTML drafts are opened with inline images as data URIs, not as attachments.
+	opened.TextBody = ""
+	opened.HTMLBody = `<p>html <i>draft</i></p><img src="data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==">`
+	draftID2 = api.MessageDraftSave(ctx, opened)
+	htmlOpened := api.MessageDraftOpen(ctx, draftID2)
+	tcompare(t, htmlOpened.TextBody, "")
+	tcompare(t, strings.Contains(htmlOpened.HTMLBody, `<p>html <i>draft</i></p><img src="data:image/png;base64,iVBORw0KGgoAAAANSUhEUg=="/>`), true)
+	tcompare(t, htmlOpened.Attachments, draft.Attachments)
+	opened = htmlOpened
+
+	// Submit removes the draft.
+	opened.To = []string{"mjl+to@beacon.example"}
+	api.MessageSubmit(ctx, opened)
+	tneedError(t, func() { api.MessageDraftOpen(ctx, draftID2) })
+
+	// MessageDraftDelete, removing again is not an error.
+	draftID3 := api.MessageDraftSave(ctx, draft)
+	api.MessageDraftDelete(ctx, draftID3)
+	api.MessageDraftDelete(ctx, draftID3)
+	err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+		drafts, err = bstore.QueryTx[store.Mailbox](tx).FilterNonzero(store.Mailbox{ID: drafts.ID}).Get()
+		return err
+	})
+	tcheck(t, err, "get drafts mailbox")
+	tcompare(t, drafts.MailboxCounts, store.MailboxCounts{})
+
+	// Only drafts can be opened and removed.
+	tneedError(t, func() { api.MessageDraftOpen(ctx, testbox1Alt.ID) })
+	tneedError(t, func() { api.MessageDraftDelete(ctx, testbox1Alt.ID) })
+	tneedError(t, func() {
+		api.MessageSubmit(ctx, SubmitMessage{From: "mjl@beacon.example", To: []string{"mjl+to@beacon.example"}, DraftMessageID: testbox1Alt.ID})
+	})
+
+	// Meeting invitations, answered, then updated and cancelled.
+	invite := func(method string, sequence int) *testmsg {
+		cal := fmt.Sprintf("BEGIN:VCALENDAR\nVERSION:2.0\nMETHOD:%s\nBEGIN:VEVENT\nUID:meeting1@other.example\nSEQUENCE:%d\nDTSTART:20231010T120000Z\nDTEND:20231010T130000Z\nSUMMARY:Meeting\nORGANIZER;CN=Organizer:mailto:organizer@other.example\nATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:mjl@beacon.example\nEND:VEVENT\nEND:VCALENDAR\n", method, sequence)
+		msg := Message{
+			From:    "organizer@other.example",
+			To:      "mjl@beacon.example",
+			Subject: "Invitation: Meeting",
+			Part: Part{
+				Type: "multipart/alternative",
+				Parts: []Part{
+					{Type: "text/plain", Content: "You are invited."},
+					{Type: "text/calendar; method=" + method, Content: cal},
+				},
+			},
+		}
+		tm := &testmsg{"Inbox", store.Flags{}, nil, msg, zerom, 0}
+		tdeliver(t, acc, tm)
+		return tm
+	}
+	invite1 := invite("REQUEST", 0)
+	invitePM := api.ParsedMessage(ctx, invite1.ID)
+	tcompare(t, len(invitePM.Invites), 1)
+	tcompare(t, invitePM.Invites[0].Path, []int{1})
+	tcompare(t, invitePM.Invites[0].Calendar.Method, "REQUEST")
+	tcompare(t, invitePM.Invites[0].Calendar.Events[0].Summary, "Meeting")
+	tcompare(t, api.InviteStatuses(ctx, invite1.ID), []InviteStatus{{}})
+	tneedError(t, func() { api.CalendarReply(ctx, invite1.ID, []int{1}, "bogus", "") })
+	tneedError(t, func() { api.CalendarReply(ctx, invite1.ID, []int{0}, "ACCEPTED", "") }) // Not a calendar part.
+	tneedError(t, func() { api.CalendarReply(ctx, invite1.ID, []int{2}, "ACCEPTED", "") }) // No such part.
+	api.CalendarReply(ctx, invite1.ID, []int{1}, "ACCEPTED", "See you.")
+	st := api.InviteStatuses(ctx, invite1.ID)
+	tcompare(t, st[0].PartStat, "ACCEPTED")
+	tcompare(t, st[0].Updated || st[0].Cancelled, false)
+
+	// Reply was added to Sent, with the calendar as alternative.
+	err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+		sm, err := bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: sent.ID}).SortDesc("ID").Limit(1).Get()
+		tcheck(t, err, "get sent message")
+		sp, err := sm.LoadPart(acc.MessageReader(sm))
+		tcheck(t, err, "load part")
+		tcompare(t, sp.Envelope.Subject, "Accepted: Meeting")
+		tcompare(t, sp.Envelope.To[0].User, "organizer")
+		tcompare(t, len(sp.Parts), 2)
+		tcompare(t, sp.Parts[1].MediaType+"/"+sp.Parts[1].MediaSubType, "TEXT/CALENDAR")
+		tcompare(t, sp.Parts[1].ContentTypeParams["method"], "REPLY")
+		buf, err := io.ReadAll(sp.Parts[1].Reader())
+		tcheck(t, err, "read calendar")
+		reply, err := message.ParseCalendar(buf)
+		tcheck(t, err, "parse reply")
+		tcompare(t, reply.Method, "REPLY")
+		tcompare(t, reply.Events[0].Attendees[0].PartStat, "ACCEPTED")
+		return nil
+	})
+	tcheck(t, err, "read sent")
+
+	invite2 := invite("REQUEST", 1)
+	st = api.InviteStatuses(ctx, invite2.ID)
+	tcompare(t, st[0].PartStat, "ACCEPTED")
+	tcompare(t, st[0].Updated, true)
+	invite3 := invite("CANCEL", 2)
+	st = api.InviteStatuses(ctx, invite3.ID)
+	tcompare(t, st[0].PartStat, "ACCEPTED")
+	tcompare(t, st[0].Cancelled, true)
+	tneedError(t, func() { api.CalendarReply(ctx, invite3.ID, []int{1}, "DECLINED", "") }) // Not an invitation.
+
+	// Settings, SettingsSave
+	tcompare(t, api.Settings(ctx), store.DefaultSettings)
+	settings := store.DefaultSettings
+	settings.Signature = "mjl\n"
+	settings.Quoting = store.Bottom
+	settings.DefaultFrom = "møx <møx@beacon.example>"
+	settings.Threading = string(ThreadUnread)
+	api.SettingsSave(ctx, settings)
+	settings.ID = 1
+	settings.ShowHeaders = []string{}
+	tcompare(t, api.Settings(ctx), settings)
+	xsettings := func(fn func(s *store.Settings)) store.Settings {
+		s := settings
+		fn(&s)
+		return s
+	}
+	tneedError(t, func() { api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.Quoting = "bogus" })) })
+	tneedError(t, func() { api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.Layout = "" })) })
+	tneedError(t, func() { api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.Threading = "bogus" })) })
+	tneedError(t, func() {
+		// Other account.
+		api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.DefaultFrom = "other@beacon.example" }))
+	})
+	tneedError(t, func() {
+		api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.DefaultFrom = "mjl@unknown.example" }))
+	})
+	tneedError(t, func() { api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.DefaultFrom = "bogus" })) })
+	tcompare(t, withSignature("hi", settings.Signature), "hi\n\n-- \nmjl\n")
+	tcompare(t, withSignature("hi\n", ""), "hi\n")
+
+	// Submit without From uses the default From address from the settings.
+	api.MessageSubmit(ctx, SubmitMessage{
+		To:       []string{"mjl+to@beacon.example"},
+		Subject:  "default from",
+		TextBody: "text",
+	})
+	err = acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+		sm, err := bstore.QueryTx[store.Message](tx).FilterNonzero(store.Message{MailboxID: sent.ID}).SortDesc("ID").Limit(1).Get()
+		tcheck(t, err, "get sent message")
+		sp, err := sm.LoadPart(acc.MessageReader(sm))
+		tcheck(t, err, "load part")
+		tcompare(t, sp.Envelope.Subject, "default from")
+		tcompare(t, sp.Envelope.From[0].User, "møx")
+		return nil
+	})
+	tcheck(t, err, "read sent")
+
+	// Send delay and MessageSubmitUndo. Without localserve, messages are queued
+	// instead of delivered immediately.
+	err = queue.Init()
+	tcheck(t, err, "queue init")
+	queue.Localserve = false
+	tneedError(t, func() { api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.SendDelay = 301 })) })
+	api.SettingsSave(ctx, xsettings(func(s *store.Settings) { s.SendDelay = 30 }))
+	sentCounts := func() (mc store.MailboxCounts) {
+		err := acc.DB.Read(ctx, func(tx *bstore.Tx) error {
+			mb := store.Mailbox{ID: sent.ID}
+			err := tx.Get(&mb)
+			mc = mb.MailboxCounts
+			return err
+		})
+		tcheck(t, err, "get sent mailbox")
+		return
+	}
+	sentBefore := sentCounts()
+	result := api.MessageSubmit(ctx, SubmitMessage{
+		From:     "mjl@beacon.example",
+		To:       []string{"mjl+to@beacon.example"},
+		Bcc:      []string{"mjl bcc <mjl+bcc@beacon.example>"},
+		Subject:  "undo",
+		TextBody: "oops",
+	})
+	if result.UndoID == 0 || !result.UndoUntil.After(time.Now()) {
+		t.Fatalf("submit with send delay, got %#v, expected undo id and time in future", result)
+	}
+	qml, err := queue.List(ctx)
+	tcheck(t, err, "list queue")
+	tcompare(t, len(qml), 2)
+	tcompare(t, qml[0].NextAttempt.After(time.Now()), true)
+	tcompare(t, sentCounts().Total, sentBefore.Total+1)
+	undoDraftID := api.MessageSubmitUndo(ctx, result.UndoID)
+	undone := api.MessageDraftOpen(ctx, undoDraftID)
+	tcompare(t, undone.Subject, "undo")
+	tcompare(t, undone.To, []string{"<mjl+to@beacon.example>"})
+	tcompare(t, undone.Bcc, []string{"mjl bcc <mjl+bcc@beacon.example>"})
+	qml, err = queue.List(ctx)
+	tcheck(t, err, "list queue")
+	tcompare(t, len(qml), 0)
+	tcompare(t, sentCounts(), sentBefore)
+	tneedError(t, func() { api.MessageSubmitUndo(ctx, result.UndoID) }) // Already undone.
+	api.MessageDraftDelete(ctx, undoDraftID)
+	api.SettingsSave(ctx, settings)
+	queue.Shutdown()
+	queue.Localserve = true
+
 	// Send without special-use Sent mailbox.
 	api.MailboxSetSpecialUse(ctx, store.Mailbox{ID: sent.ID, SpecialUse: store.SpecialUse{}})
 	api.MessageSubmit(ctx, SubmitMessage{
@@ -420,6 +846,28 @@ func TestAPI(t *testing.T) {
 	tcompare(t, l, []string{"mjl cc2 <mjl+cc2@beacon.example>"})
 	tcompare(t, full, true)
 
+	// Contacts, which are completed before recipients.
+	tcompare(t, len(api.ContactList(ctx)), 0)
+	tneedError(t, func() { api.ContactSave(ctx, Contact{Name: " "}) })
+	tneedError(t, func() { api.ContactSave(ctx, Contact{Name: "x", Emails: []string{"bogus"}}) })
+	contact := api.ContactSave(ctx, Contact{Name: "Contact cc2", Emails: []string{"Other+cc2@beacon.example", " "}, Phones: []string{"+1 555 0100"}, Note: "a, b"})
+	tcompare(t, contact.ID != 0, true)
+	tcompare(t, api.ContactList(ctx), []Contact{{contact.ID, "Contact cc2", []string{"Other+cc2@beacon.example"}, []string{"+1 555 0100"}, "a, b"}})
+	l, full = api.CompleteRecipient(ctx, "cc2")
+	tcompare(t, l, []string{"Contact cc2 <other+cc2@beacon.example>", "mjl cc2 <mjl+cc2@beacon.example>"})
+	tcompare(t, full, true)
+	// Contact address already matched is not repeated from recipients, and matching is on name too.
+	contact.Emails = append(contact.Emails, "mjl+cc2@beacon.example")
+	contact.Phones = nil
+	api.ContactSave(ctx, contact)
+	l, _ = api.CompleteRecipient(ctx, "contact")
+	tcompare(t, l, []string{"Contact cc2 <other+cc2@beacon.example>", "Contact cc2 <mjl+cc2@beacon.example>"})
+	l, _ = api.CompleteRecipient(ctx, "cc2")
+	tcompare(t, l, []string{"Contact cc2 <other+cc2@beacon.example>", "Contact cc2 <mjl+cc2@beacon.example>"})
+	api.ContactDelete(ctx, contact.ID)
+	tcompare(t, len(api.ContactList(ctx)), 0)
+	tneedError(t, func() { api.ContactDelete(ctx, contact.ID) })
+
 	// RecipientSecurity
 	resolver := dns.MockResolver{}
 	rs, err := recipientSecurity(ctx, resolver, "mjl@a.beacon.example")
@@ -0,0 +1,464 @@
+package webmail
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"github.com/qompassai/beacon/message"
+	"github.com/qompassai/beacon/beacon-"
+)
+
+// parseDataURI parses a base64-encoded data URI, as used for attachments and
+// inline images submitted by the webmail client. The content-type, which may be
+// empty, and the verified base64 data are returned.
+func parseDataURI(s string) (ct, base64Data string, err error) {
+	if !strings.HasPrefix(s, "data:") {
+		return "", "", errors.New("missing data: in datauri")
+	}
+	s = s[len("data:"):]
+	t := strings.SplitN(s, ",", 2)
+	if len(t) != 2 {
+		return "", "", errors.New("missing comma in datauri")
+	}
+	if !strings.HasSuffix(t[0], "base64") {
+		return "", "", errors.New("missing base64 in datauri")
+	}
+	ct = strings.TrimSuffix(t[0], "base64")
+	ct = strings.TrimSuffix(ct, ";")
+
+	// Ensure base64 is valid, callers write the original string.
+	if _, err := io.Copy(io.Discard, base64.NewDecoder(base64.StdEncoding, strings.NewReader(t[1]))); err != nil {
+		return "", "", fmt.Errorf("invalid base64: %v", err)
+	}
+	return ct, t[1], nil
+}
+
+// inlineImage is an image from a data: URI in composed HTML, added as part to a
+// multipart/related message and referenced with a cid: URI.
+type inlineImage struct {
+	cid         string // Without <>.
+	contentType string
+	filename    string
+	base64Data  string
+}
+
+// composeHTML parses and sanitizes HTML composed in webmail, with the same rules
+// as used for displaying HTML messages. Images with data: URIs are replaced with
+// cid: URIs referencing the returned images, to be added to a multipart/related
+// message.
+func composeHTML(s string) (*html.Node, []inlineImage, error) {
+	node, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing html: %v", err)
+	}
+	sanitizeNode(node)
+
+	var images []inlineImage
+	dataCIDs := map[string]string{} // Same image used multiple times is added once.
+	var walk func(n *html.Node) error
+	walk = func(n *html.Node) error {
+		for i, a := range n.Attr {
+			if n.Type != html.ElementNode || n.Data != "img" {
+				break
+			}
+			if a.Key != "src" || a.Namespace != "" || !caselessPrefix(a.Val, "data:") {
+				continue
+			}
+			cid, ok := dataCIDs[a.Val]
+			if !ok {
+				ct, data, err := parseDataURI(a.Val)
+				if err != nil {
+					return fmt.Errorf("parsing image: %v", err)
+				}
+				ct = strings.ToLower(ct)
+				subtype, ok := strings.CutPrefix(ct, "image/")
+				badChar := func(r rune) bool {
+					return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '-' && r != '.'
+				}
+				if !ok || subtype == "" || strings.IndexFunc(subtype, badChar) >= 0 {
+					return fmt.Errorf("only images can be inlined, not %q", ct)
+				}
+				cid = beacon.MessageIDGen(false)
+				dataCIDs[a.Val] = cid
+				filename := fmt.Sprintf("image%d.%s", len(images)+1, strings.TrimSuffix(subtype, "+xml"))
+				images = append(images, inlineImage{cid, ct, filename, data})
+			}
+			n.Attr[i].Val = "cid:" + cid
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(node); err != nil {
+		return nil, nil, err
+	}
+	return node, images, nil
+}
+
+// draftHTML returns the first HTML part of a message as HTML document, with the
+// images from a multipart/related parent inlined as data: URIs. The lower-case
+// content-ids of the related parts are returned, they are part of the HTML and
+// should not also be opened as attachments. If there is no HTML part, an empty
+// string is returned.
+func draftHTML(p *message.Part) (string, map[string]bool, error) {
+	var find func(p *message.Part, parents []*message.Part) (*message.Part, []*message.Part)
+	find = func(p *message.Part, parents []*message.Part) (*message.Part, []*message.Part) {
+		if p.MediaType == "TEXT" && p.MediaSubType == "HTML" {
+			return p, parents
+		}
+		for i := range p.Parts {
+			if hp, hparents := find(&p.Parts[i], append(append([]*message.Part{}, parents...), p)); hp != nil {
+				return hp, hparents
+			}
+		}
+		return nil, nil
+	}
+	hp, parents := find(p, nil)
+	if hp == nil {
+		return "", nil, nil
+	}
+
+	cids := map[string]*message.Part{}
+	related := map[string]bool{}
+	for _, parent := range parents {
+		if parent.MediaType+"/"+parent.MediaSubType != "MULTIPART/RELATED" {
+			continue
+		}
+		for i, rp := range parent.Parts {
+			if rp.ContentID != "" {
+				cids[strings.ToLower(rp.ContentID)] = &parent.Parts[i]
+				related[strings.ToLower(rp.ContentID)] = true
+			}
+		}
+	}
+
+	node, err := html.Parse(hp.ReaderUTF8OrBinary())
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing html: %v", err)
+	}
+	var totalSize int64
+	if err := inlineNode(node, cids, &totalSize); err != nil {
+		return "", nil, fmt.Errorf("inline cid uris in html nodes: %w", err)
+	}
+	sanitizeEditNode(node)
+	var sb strings.Builder
+	if err := html.Render(&sb, node); err != nil {
+		return "", nil, fmt.Errorf("writing html: %v", err)
+	}
+	return sb.String(), related, nil
+}
+
+// Elements allowed in HTML opened in the compose editor, which is part of the
+// webmail page, not an isolated frame. Other elements are replaced by their
+// children, or removed with their children if in editDropElements.
+var editElements = map[string]bool{
+	"html": true, "body": true,
+	"a": true, "abbr": true, "address": true, "article": true, "aside": true, "b": true, "big": true, "blockquote": true, "br": true,
+	"caption": true, "center": true, "cite": true, "code": true, "col": true, "colgroup": true, "dd": true, "del": true, "div": true,
+	"dl": true, "dt": true, "em": true, "figcaption": true, "figure": true, "font": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "i": true, "img": true, "ins": true, "li": true,
+	"main": true, "mark": true, "nav": true, "ol": true, "p": true, "pre": true, "q": true, "s": true, "section": true, "small": true,
+	"span": true, "strike": true, "strong": true, "sub": true, "sup": true, "table": true, "tbody": true, "td": true, "tfoot": true,
+	"th": true, "thead": true, "tr": true, "tt": true, "u": true, "ul": true,
+}
+
+// Elements removed including their contents from HTML for the compose editor.
+var editDropElements = map[string]bool{
+	"head": true, "script": true, "style": true, "template": true, "iframe": true, "frame": true, "frameset": true, "object": true,
+	"embed": true, "applet": true, "noscript": true, "noembed": true, "noframes": true, "svg": true, "math": true, "title": true,
+	"meta": true, "link": true, "base": true, "textarea": true, "select": true, "option": true, "audio": true, "video": true,
+	"source": true, "track": true, "canvas": true, "map": true, "area": true, "input": true, "button": true, "dialog": true,
+}
+
+// Attributes allowed in HTML for the compose editor. The values of href, src and
+// style are checked further.
+var editAttributes = map[string]bool{
+	"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true, "cellspacing": true, "color": true,
+	"colspan": true, "dir": true, "face": true, "height": true, "href": true, "lang": true, "rowspan": true, "size": true,
+	"span": true, "src": true, "start": true, "style": true, "title": true, "type": true, "valign": true, "value": true, "width": true,
+}
+
+// editAttributeOK returns whether attribute a is allowed in HTML for the compose
+// editor. Links must be http, https or mailto URLs, images must be inline data:
+// URIs, and styles cannot reference external resources.
+func editAttributeOK(a html.Attribute) bool {
+	if a.Namespace != "" || !editAttributes[a.Key] {
+		return false
+	}
+	// Browsers ignore control characters and spaces in URLs, e.g. in "java\tscript:".
+	v := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, a.Val)
+	switch a.Key {
+	case "href":
+		return caselessPrefix(v, "http:") || caselessPrefix(v, "https:") || caselessPrefix(v, "mailto:")
+	case "src":
+		return caselessPrefix(v, "data:image/")
+	case "style":
+		lv := strings.ToLower(v)
+		return !strings.Contains(lv, "url(") && !strings.Contains(lv, "image-set(") && !strings.Contains(lv, "expression(") && !strings.Contains(lv, "@import") && !strings.Contains(lv, "\\")
+	}
+	return true
+}
+
+// sanitizeEditNode removes all elements and attributes from an HTML document that
+// are not explicitly allowed in the compose editor. Links open in a new window.
+func sanitizeEditNode(node *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch c.Type {
+			case html.ElementNode:
+				if c.Namespace != "" || editDropElements[c.Data] {
+					n.RemoveChild(c)
+					break
+				}
+				walk(c)
+				if !editElements[c.Data] {
+					// Keep the contents, which have been sanitized already.
+					for cc := c.FirstChild; cc != nil; cc = c.FirstChild {
+						c.RemoveChild(cc)
+						n.InsertBefore(cc, c)
+					}
+					n.RemoveChild(c)
+					break
+				}
+				var attrs []html.Attribute
+				for _, a := range c.Attr {
+					if editAttributeOK(a) {
+						attrs = append(attrs, a)
+					}
+				}
+				if c.Data == "a" {
+					attrs = append(attrs, html.Attribute{Key: "target", Val: "_blank"}, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+				}
+				c.Attr = attrs
+			case html.TextNode, html.DocumentNode, html.DoctypeNode:
+				walk(c)
+			default:
+				// Comments and raw nodes.
+				n.RemoveChild(c)
+			}
+			c = next
+		}
+	}
+	walk(node)
+}
+
+// htmlText returns a plain text version of an HTML document, for the
+// text/plain alternative of composed HTML messages. Paragraphs are separated by
+// empty lines, list items are prefixed with "-" or their number, quoted text with
+// ">", and link URLs are added after the link text.
+func htmlText(node *html.Node) string {
+	w := &htmlTextWriter{}
+	w.node(node)
+	return w.sb.String() + "\n"
+}
+
+type htmlTextWriter struct {
+	sb       strings.Builder
+	quote    int   // Blockquote depth, lines are prefixed with "> " for each level.
+	lists    []int // For each nested list, the next item number for ordered lists, or -1.
+	pre      int   // Depth of pre elements, whitespace is kept as is.
+	newlines int   // Pending newlines, written before the next text.
+	nlquote  int   // Blockquote depth for empty lines of pending newlines, the lowest depth since the last text.
+	space    bool  // Pending space, written before the next text on the same line.
+	midline  bool  // Whether text was written on the current line.
+}
+
+// text writes s, after pending newlines and line prefixes or a pending space.
+func (w *htmlTextWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if w.sb.Len() > 0 && w.newlines > 0 {
+		quote := w.quote
+		if w.nlquote < quote {
+			quote = w.nlquote
+		}
+		for i := 0; i < w.newlines; i++ {
+			if i > 0 {
+				w.sb.WriteString(strings.TrimSpace(strings.Repeat("> ", quote)))
+			}
+			w.sb.WriteString("\n")
+		}
+		w.midline = false
+	}
+	w.newlines = 0
+	if !w.midline {
+		w.sb.WriteString(strings.Repeat("> ", w.quote))
+	} else if w.space && !strings.HasSuffix(w.sb.String(), " ") {
+		w.sb.WriteString(" ")
+	}
+	w.space = false
+	w.sb.WriteString(s)
+	w.midline = true
+	w.nlquote = w.quote
+}
+
+// block ensures a line break, and for n > 1 empty lines, before the next text.
+func (w *htmlTextWriter) block(n int) {
+	if w.sb.Len() > 0 && w.newlines < n {
+		w.newlines = n
+	}
+	if w.quote < w.nlquote {
+		w.nlquote = w.quote
+	}
+	w.space = false
+}
+
+func (w *htmlTextWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if w.pre > 0 {
+			for i, line := range strings.Split(n.Data, "\n") {
+				if i > 0 {
+					w.newlines++
+				}
+				w.text(strings.TrimRight(line, "\r"))
+			}
+			return
+		}
+		fields := strings.Fields(n.Data)
+		if len(fields) == 0 {
+			w.space = w.space || n.Data != ""
+			return
+		}
+		if r, _ := utf8.DecodeRuneInString(n.Data); unicode.IsSpace(r) {
+			w.space = true
+		}
+		w.text(strings.Join(fields, " "))
+		if r, _ := utf8.DecodeLastRuneInString(n.Data); unicode.IsSpace(r) {
+			w.space = true
+		}
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		w.children(n)
+		return
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "head", "script", "style", "title", "template":
+	case "br":
+		if w.sb.Len() > 0 {
+			w.newlines++
+		}
+		w.space = false
+	case "hr":
+		w.block(2)
+		w.text("----")
+		w.block(2)
+	case "img":
+		if alt := strings.TrimSpace(attrValue(n, "alt")); alt != "" {
+			w.text("[" + alt + "]")
+		}
+	case "p", "h1", "h2", "h3", "h4", "h5", "h6", "table", "pre":
+		w.block(2)
+		if n.Data == "pre" {
+			w.pre++
+		}
+		w.children(n)
+		if n.Data == "pre" {
+			w.pre--
+		}
+		w.block(2)
+	case "blockquote":
+		w.block(2)
+		w.quote++
+		w.children(n)
+		w.block(2)
+		w.quote--
+	case "ul", "ol":
+		if len(w.lists) == 0 {
+			w.block(2)
+		} else {
+			w.block(1)
+		}
+		next := -1
+		if n.Data == "ol" {
+			next = 1
+		}
+		w.lists = append(w.lists, next)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		if len(w.lists) == 0 {
+			w.block(2)
+		} else {
+			w.block(1)
+		}
+	case "li":
+		w.block(1)
+		marker := "-"
+		if len(w.lists) > 0 {
+			if next := w.lists[len(w.lists)-1]; next > 0 {
+				marker = fmt.Sprintf("%d.", next)
+				w.lists[len(w.lists)-1]++
+			}
+			marker = strings.Repeat("  ", len(w.lists)-1) + marker
+		}
+		w.text(marker + " ")
+		w.children(n)
+		w.block(1)
+	case "div", "tr", "dt", "dd", "figure", "figcaption", "address", "section", "article", "header", "footer":
+		w.block(1)
+		w.children(n)
+		w.block(1)
+	case "td", "th":
+		w.space = true
+		w.children(n)
+		w.space = true
+	case "a":
+		w.children(n)
+		href := strings.TrimSpace(attrValue(n, "href"))
+		if (caselessPrefix(href, "http:") || caselessPrefix(href, "https:")) && href != strings.TrimSpace(nodeText(n)) {
+			w.space = true
+			w.text("<" + href + ">")
+		}
+	default:
+		w.children(n)
+	}
+}
+
+func (w *htmlTextWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns the text of all text nodes below n.
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+	}
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package webmail
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseDataURI(t *testing.T) {
+	check := func(s, expCT, expData string, expErr bool) {
+		t.Helper()
+		ct, data, err := parseDataURI(s)
+		if (err != nil) != expErr {
+			t.Fatalf("parsing %q: got err %v, expected error %v", s, err, expErr)
+		}
+		if ct != expCT || data != expData {
+			t.Fatalf("parsing %q: got ct %q, data %q, expected %q, %q", s, ct, data, expCT, expData)
+		}
+	}
+
+	check("data:image/png;base64,dGVzdAo=", "image/png", "dGVzdAo=", false)
+	check("data:base64,dGVzdAo=", "", "dGVzdAo=", false)
+	check("data:;base64,", "", "", false)
+	check("image/png;base64,dGVzdAo=", "", "", true)
+	check("data:image/png;base64", "", "", true)
+	check("data:image/png,test", "", "", true)
+	check("data:image/png;base64,!!!", "", "", true)
+}
+
+func TestComposeHTML(t *testing.T) {
+	const png = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUg=="
+	node, images, err := composeHTML(`<p onclick="x()">hi</p><script>alert(1)</script><img src="` + png + `"><img src="` + png + `"><img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=">`)
+	tcheck(t, err, "compose html")
+	tcompare(t, len(images), 2)
+	tcompare(t, images[0].contentType, "image/png")
+	tcompare(t, images[0].filename, "image1.png")
+	tcompare(t, images[0].base64Data, "iVBORw0KGgoAAAANSUhEUg==")
+	tcompare(t, images[1].filename, "image2.gif")
+
+	var sb strings.Builder
+	err = html.Render(&sb, node)
+	tcheck(t, err, "render html")
+	s := sb.String()
+	tcompare(t, strings.Contains(s, "script"), false)
+	tcompare(t, strings.Contains(s, "onclick"), false)
+	tcompare(t, strings.Contains(s, "data:"), false)
+	tcompare(t, strings.Count(s, `src="cid:`+images[0].cid+`"`), 2)
+	tcompare(t, strings.Count(s, `src="cid:`+images[1].cid+`"`), 1)
+
+	_, _, err = composeHTML(`<img src="data:text/html;base64,dGVzdAo=">`)
+	tcheck(t, err, "compose html") // Removed by sanitizeNode.
+	_, _, err = composeHTML(`<img src="data:application/octet-stream;base64,dGVzdAo=">`)
+	if err == nil {
+		t.Fatalf("inline non-image, got nil error")
+	}
+}
+
+func TestSanitizeEditNode(t *testing.T) {
+	check := func(s, exp string) {
+		t.Helper()
+		node, err := html.Parse(strings.NewReader(s))
+		tcheck(t, err, "parse html")
+		sanitizeEditNode(node)
+		var sb strings.Builder
+		err = html.Render(&sb, node)
+		tcheck(t, err, "render html")
+		tcompare(t, sb.String(), "<html><body>"+exp+"</body></html>")
+	}
+
+	check(`<p style="color: red" class="x" onclick="x()">hi <b>there</b></p>`, `<p style="color: red">hi <b>there</b></p>`)
+	check(`<head><title>t</title><style>body{}</style><base href="https://evil.example/"></head>x`, `x`)
+	check(`<iframe srcdoc="&lt;script&gt;alert(1)&lt;/script&gt;"></iframe><object data="x"></object><embed src="x"><script>alert(1)</script>`, ``)
+	check(`<form action="https://evil.example/"><input name="x"><button>go</button>text</form>`, `text`)
+	check(`<meta http-equiv="refresh" content="0;url=https://evil.example/"><!-- comment -->x`, `x`)
+	check(`<a href="javascript:alert(1)">a</a><a href=" java&#9;script:alert(1)">b</a><a href="https://ok.example/">c</a>`, `<a target="_blank" rel="noopener noreferrer">a</a><a target="_blank" rel="noopener noreferrer">b</a><a href="https://ok.example/" target="_blank" rel="noopener noreferrer">c</a>`)
+	check(`<svg><a xlink:href="javascript:alert(1)"><animate attributeName="href" values="javascript:alert(1)"/><text>x</text></a></svg>`, ``)
+	check(`<img src="https://tracker.example/x.png"><img src="data:image/png;base64,AAAA">`, `<img/><img src="data:image/png;base64,AAAA"/>`)
+	check(`<div style="background: url(https://tracker.example/)">x</div><custom-el>y</custom-el>`, `<div>x</div>y`)
+}
+
+func TestHTMLText(t *testing.T) {
+	check := func(s, exp string) {
+		t.Helper()
+		node, err := html.Parse(strings.NewReader(s))
+		tcheck(t, err, "parse html")
+		text := htmlText(node)
+		if text != exp {
+			t.Fatalf("text for html %q:\ngot:\n%s\nexpected:\n%s", s, text, exp)
+		}
+	}
+
+	check(`<title>ignored</title>hi <b>there</b>`, "hi there\n")
+	check(`<p>one</p><p>two<br>three</p>`, "one\n\ntwo\nthree\n")
+	check(`<div>one</div><div>two</div>`, "one\ntwo\n")
+	check(`<p>list:</p><ul><li>a</li><li>b<ol><li>c</li><li>d</li></ol></li></ul><p>end</p>`, "list:\n\n- a\n- b\n  1. c\n  2. d\n\nend\n")
+	check(`<p>On ... wrote:</p><blockquote><p>quoted</p><p>text</p></blockquote>reply`, "On ... wrote:\n\n> quoted\n>\n> text\n\nreply\n")
+	check(`<a href="https://example.org">link</a> and <a href="https://example.org">https://example.org</a>`, "link <https://example.org> and https://example.org\n")
+	check(`<pre>a
+  b</pre>`, "a\n  b\n")
+	check(`<img alt="logo">text<hr>after`, "[logo]text\n\n----\n\nafter\n")
+}
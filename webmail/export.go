@@ -0,0 +1,200 @@
+package webmail
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/mjl-/bstore"
+
+	"github.com/qompassai/beacon/mlog"
+	"github.com/qompassai/beacon/store"
+)
+
+// serveExport writes an archive with messages selected in the form of POST
+// request r. Form fields:
+//
+//   - format: "maildir" or "mbox".
+//   - archive: "zip" or "tgz".
+//   - messageids, threadids, mailboxids: comma-separated IDs of messages, threads
+//     (the ThreadID of messages) and mailboxes to export. At least one must be
+//     non-empty.
+//   - progressid: optional ID chosen by the client, for retrieving progress of
+//     the export with the ExportProgress API call while the archive is written.
+//
+// Keywords of messages are included as dovecot-keywords for maildir, and in the
+// X-Keywords header for mbox. Progress of large exports is also logged.
+func serveExport(ctx context.Context, log mlog.Log, accName string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "405 - method not allowed - use post", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.PostFormValue("format")
+	if format != "maildir" && format != "mbox" {
+		xcheckuserf(ctx, fmt.Errorf("unknown format %q", format), "parsing export request")
+	}
+	archive := r.PostFormValue("archive")
+	if archive != "zip" && archive != "tgz" {
+		xcheckuserf(ctx, fmt.Errorf("unknown archive type %q", archive), "parsing export request")
+	}
+
+	xparseIDs := func(k string) []int64 {
+		s := r.PostFormValue(k)
+		if s == "" {
+			return nil
+		}
+		var ids []int64
+		for _, t := range strings.Split(s, ",") {
+			id, err := strconv.ParseInt(t, 10, 64)
+			if err == nil && id <= 0 {
+				err = errors.New("must be positive")
+			}
+			xcheckuserf(ctx, err, "parsing %s", k)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	selection := store.ExportSelection{
+		MessageIDs: xparseIDs("messageids"),
+		ThreadIDs:  xparseIDs("threadids"),
+		MailboxIDs: xparseIDs("mailboxids"),
+	}
+	if len(selection.MessageIDs) == 0 && len(selection.ThreadIDs) == 0 && len(selection.MailboxIDs) == 0 {
+		xcheckuserf(ctx, errors.New("no messages selected"), "parsing export request")
+	}
+	progressID := r.PostFormValue("progressid")
+	if len(progressID) > 64 {
+		xcheckuserf(ctx, errors.New("too long"), "parsing progressid")
+	}
+
+	acc, err := store.OpenAccount(log, accName)
+	xcheckf(ctx, err, "open account")
+	defer func() {
+		err := acc.Close()
+		log.Check(err, "closing account")
+	}()
+
+	// Check the mailboxes now, we cannot return an error once we started writing the
+	// archive.
+	xdbread(ctx, acc, func(tx *bstore.Tx) {
+		for _, id := range selection.MailboxIDs {
+			xmailboxID(ctx, tx, id)
+		}
+	})
+
+	log.Debug("exporting messages", slog.String("format", format), slog.String("archive", archive), slog.Int("messages", len(selection.MessageIDs)), slog.Int("threads", len(selection.ThreadIDs)), slog.Int("mailboxes", len(selection.MailboxIDs)))
+
+	h := w.Header()
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "mail-export-" + format + "." + archive}))
+	var archiver store.Archiver
+	if archive == "tgz" {
+		// Don't tempt browsers to "helpfully" decompress.
+		h.Set("Content-Type", "application/octet-stream")
+
+		gzw := gzip.NewWriter(w)
+		defer func() {
+			_ = gzw.Close()
+		}()
+		archiver = store.TarArchiver{Writer: tar.NewWriter(gzw)}
+	} else {
+		h.Set("Content-Type", "application/zip")
+		archiver = store.ZipArchiver{Writer: zip.NewWriter(w)}
+	}
+	defer func() {
+		err := archiver.Close()
+		log.Check(err, "exporting mail close")
+	}()
+
+	// Browsers show the progress of the download, but don't know the size. Large
+	// exports can take a while. The client can poll for progress, and we log progress
+	// periodically.
+	key := exportProgressKey{accName, progressID}
+	if progressID != "" {
+		exportProgressSet(key, ExportProgress{})
+	}
+	start := time.Now()
+	lastProgress := start
+	progress := func(exported, total int) {
+		if progressID != "" {
+			exportProgressSet(key, ExportProgress{Exported: exported, Total: total})
+		}
+		if exported < total && time.Since(lastProgress) < 10*time.Second {
+			return
+		}
+		lastProgress = time.Now()
+		log.Info("export progress", slog.Int("exported", exported), slog.Int("total", total), slog.Duration("duration", time.Since(start)))
+	}
+	err = store.ExportSelected(r.Context(), log, acc.DB, acc.Dir, archiver, format == "maildir", selection, progress)
+	log.Check(err, "exporting messages")
+	if progressID != "" {
+		exportProgressDone(key, err)
+	}
+}
+
+// ExportProgress is the progress of an export, for display by the client.
+type ExportProgress struct {
+	Exported int    // Number of messages added to the archive so far.
+	Total    int    // Number of messages to export, 0 until known.
+	Done     bool   // Whether the export has finished, successfully or not.
+	Error    string // If the export failed.
+}
+
+type exportProgressKey struct {
+	accountName string
+	progressID  string
+}
+
+// Progress of exports, by account and progress ID chosen by the client. Kept for
+// a while after an export finished, for the client to see the final state.
+var exportProgress = struct {
+	sync.Mutex
+	m map[exportProgressKey]ExportProgress
+}{m: map[exportProgressKey]ExportProgress{}}
+
+// How long the progress of a finished export remains available.
+const exportProgressKeep = time.Minute
+
+func exportProgressSet(key exportProgressKey, p ExportProgress) {
+	exportProgress.Lock()
+	defer exportProgress.Unlock()
+	exportProgress.m[key] = p
+}
+
+func exportProgressDone(key exportProgressKey, err error) {
+	exportProgress.Lock()
+	defer exportProgress.Unlock()
+	p := exportProgress.m[key]
+	p.Done = true
+	if err != nil {
+		p.Error = err.Error()
+	}
+	exportProgress.m[key] = p
+
+	time.AfterFunc(exportProgressKeep, func() {
+		exportProgress.Lock()
+		defer exportProgress.Unlock()
+		if p, ok := exportProgress.m[key]; ok && p.Done {
+			delete(exportProgress.m, key)
+		}
+	})
+}
+
+// exportProgressGet returns the progress of an export. An unknown export, e.g.
+// one that was not started yet or finished a while ago, has zero values.
+func exportProgressGet(key exportProgressKey) ExportProgress {
+	exportProgress.Lock()
+	defer exportProgress.Unlock()
+	return exportProgress.m[key]
+}
@@ -223,6 +223,7 @@ func parsedMessage(log mlog.Log, m store.Message, state *msgState, full, msgitem
 	}
 
 	pm.Texts = []string{}
+	pm.Invites = []Invite{}
 	pm.attachments = []Attachment{}
 
 	// todo: how should we handle messages where a user prefers html, and we want to show it, but it's a DSN that also has textual-only parts? e.g. gmail's dsn where the first part is multipart/related with multipart/alternative, and second part is the regular message/delivery-status. we want to display both the html and the text.
@@ -285,6 +286,19 @@ func parsedMessage(log mlog.Log, m store.Message, state *msgState, full, msgitem
 			if parent == nil && mt == "MULTIPART/ENCRYPTED" {
 				pm.isEncrypted = true
 			}
+			// Meeting invitations are shown, and also listed as attachment below.
+			if full && mt == "TEXT/CALENDAR" {
+				buf, err := io.ReadAll(&beaconio.LimitReader{R: p.ReaderUTF8OrBinary(), Limit: 1024 * 1024})
+				if err != nil {
+					rerr = fmt.Errorf("reading calendar part: %v", err)
+					return
+				}
+				if cal, err := message.ParseCalendar(buf); err != nil {
+					log.Debugx("parsing calendar part", err, slog.Int64("msgid", m.ID))
+				} else {
+					pm.Invites = append(pm.Invites, Invite{path, *cal})
+				}
+			}
 			// todo: possibly do not include anything below multipart/alternative that starts with text/html, they may be cids. perhaps have a separate list of attachments for the text vs html version?
 			if p.MediaType != "MULTIPART" {
 				var parentct string
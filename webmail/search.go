@@ -0,0 +1,445 @@
+package webmail
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSearch parses a search query, as typed in the search bar or stored as saved
+// search, into a Query with filters. Terms are separated by whitespace and must
+// all match. The syntax:
+//
+//	word              Message text contains word (case-insensitive substring).
+//	"two words"       Quoted text, for spaces or text that looks like a tag. A
+//	                  double quote inside quotes is written as two double quotes.
+//	tag:value         Filter on a field, see below. The value can be quoted.
+//	-term             Message must not match term.
+//	a OR b            Message must match a or b, or more alternatives: a OR b OR c.
+//	(a b)             Parentheses group terms, e.g. "(from:a subject:x) OR from:b".
+//
+// Tags:
+//
+//	from:, f:                 From address or name contains value.
+//	to:, t:                   To, Cc or Bcc address or name contains value.
+//	subject:, s:              Subject contains value.
+//	label:, l:                Message has label (by name or keyword), or flag like
+//	                          \Flagged.
+//	is:                       Message is unread, read, flagged, answered, forwarded,
+//	                          draft, junk or notjunk.
+//	has:                      Message has an attachment ("has:attachment"), or of a
+//	                          type: image, pdf, archive, spreadsheet, document,
+//	                          presentation.
+//	attachments:, a:          Like has:, but also "none" and "any".
+//	mailbox:, mb:             Only messages in the mailbox. Without value, messages
+//	                          in all mailboxes. By default, messages in all mailboxes
+//	                          except Trash, Junk and Rejects are searched.
+//	submb:                    Also search child mailboxes of the mailbox.
+//	after:, start:            Received at or after date (yyyy-mm-dd) or date and time
+//	                          (yyyy-mm-ddThh:mm) in the server time zone.
+//	before:                   Received before date or date and time.
+//	end:                      Received before the end of date, or at date and time.
+//	header:, h:               Message has header "name:value", or just header "name".
+//	size>, size<              Message size larger or smaller than size, with optional
+//	                          unit b, kb, mb, gb.
+//	minsize:, maxsize:        Message size at least or at most size.
+//
+// Mailbox and size tags, dates and headers cannot be negated. Mailbox tags cannot
+// be used in OR groups. A value with an unknown tag is searched for as word.
+//
+// If a mailbox is specified, it is returned in Filter.MailboxName.
+func ParseSearch(search string) (Query, error) {
+	tokens, err := searchTokens(search)
+	if err != nil {
+		return Query{}, err
+	}
+	p := searchParser{tokens: tokens}
+	q := Query{Filter: Filter{MailboxID: -1}}
+	if err := p.sequence(&q.Filter, &q.NotFilter, true); err != nil {
+		return Query{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return Query{}, errors.New(`unexpected ")"`)
+	}
+	return q, nil
+}
+
+type searchTokenKind int
+
+const (
+	searchTerm searchTokenKind = iota
+	searchOpen
+	searchClose
+	searchOr
+)
+
+type searchToken struct {
+	kind  searchTokenKind
+	not   bool
+	tag   string // Lower case, empty if no tag.
+	value string
+}
+
+// searchTokens splits a search into tokens.
+func searchTokens(s string) ([]searchToken, error) {
+	var l []searchToken
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return l, nil
+		}
+		if s[0] == '(' {
+			l = append(l, searchToken{kind: searchOpen})
+			s = s[1:]
+			continue
+		}
+		if s[0] == ')' {
+			l = append(l, searchToken{kind: searchClose})
+			s = s[1:]
+			continue
+		}
+
+		t := searchToken{kind: searchTerm}
+		if s[0] == '-' && len(s) > 1 && !strings.ContainsAny(s[1:2], " \t\r\n") {
+			t.not = true
+			s = s[1:]
+		}
+		if s[0] == '(' {
+			return nil, errors.New("cannot negate group")
+		}
+
+		// Read a word or tag, up to whitespace, a closing parenthesis or a quote.
+		var word string
+		i := strings.IndexAny(s, " \t\r\n)\"")
+		if i < 0 {
+			i = len(s)
+		}
+		word, s = s[:i], s[i:]
+		quoted := strings.HasPrefix(s, `"`)
+		if quoted {
+			var value string
+			value, s = searchQuoted(s[1:])
+			if word == "" {
+				t.value = value
+				l = append(l, t)
+				continue
+			}
+			lw := strings.ToLower(word)
+			if lw == "size>" || lw == "size<" {
+				t.tag = lw
+			} else if strings.HasSuffix(word, ":") && strings.Count(word, ":") == 1 {
+				t.tag = strings.TrimSuffix(lw, ":")
+			} else {
+				return nil, fmt.Errorf("quote in middle of term %q", word)
+			}
+			t.value = value
+			l = append(l, t)
+			continue
+		}
+
+		if word == "OR" && !t.not {
+			l = append(l, searchToken{kind: searchOr})
+			continue
+		}
+		lw := strings.ToLower(word)
+		if strings.HasPrefix(lw, "size>") || strings.HasPrefix(lw, "size<") {
+			t.tag = lw[:5]
+			t.value = word[5:]
+		} else if tag, value, ok := strings.Cut(word, ":"); ok && tag != "" {
+			t.tag = strings.ToLower(tag)
+			t.value = value
+		} else {
+			t.value = word
+		}
+		l = append(l, t)
+	}
+}
+
+// searchQuoted parses a quoted string, with the opening quote already consumed,
+// returning the unquoted value and the remainder. A missing closing quote is
+// implicit at the end.
+func searchQuoted(s string) (value, rest string) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '"')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), ""
+		}
+		b.WriteString(s[:i])
+		s = s[i+1:]
+		if !strings.HasPrefix(s, `"`) {
+			return b.String(), s
+		}
+		b.WriteByte('"')
+		s = s[1:]
+	}
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+// sequence parses terms, until the end or a closing parenthesis, into f and nf.
+func (p *searchParser) sequence(f *Filter, nf *NotFilter, top bool) error {
+	for p.pos < len(p.tokens) && p.tokens[p.pos].kind != searchClose {
+		start := p.pos
+		if err := p.unit(&Filter{}, &NotFilter{}, top); err != nil {
+			return err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != searchOr {
+			// Single unit, apply it again, to f and nf.
+			p.pos = start
+			if err := p.unit(f, nf, top); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// OR group.
+		p.pos = start
+		var group []FilterAlternative
+		for {
+			var alt FilterAlternative
+			if err := p.unit(&alt.Filter, &alt.NotFilter, false); err != nil {
+				return err
+			}
+			group = append(group, alt)
+			if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != searchOr {
+				break
+			}
+			p.pos++
+		}
+		f.Or = append(f.Or, group)
+	}
+	return nil
+}
+
+// unit parses a term or parenthesized group into f and nf.
+func (p *searchParser) unit(f *Filter, nf *NotFilter, top bool) error {
+	if p.pos >= len(p.tokens) {
+		return errors.New("missing term after OR")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case searchOr:
+		return errors.New("unexpected OR")
+	case searchClose:
+		return errors.New(`unexpected ")"`)
+	case searchOpen:
+		if err := p.sequence(f, nf, top); err != nil {
+			return err
+		}
+		if p.pos >= len(p.tokens) {
+			return errors.New(`missing ")"`)
+		}
+		p.pos++
+		return nil
+	}
+	return applySearchTerm(t, f, nf, top)
+}
+
+// applySearchTerm adds the filter for a single term to f or nf.
+func applySearchTerm(t searchToken, f *Filter, nf *NotFilter, top bool) error {
+	if t.tag == "" {
+		if t.not {
+			nf.Words = append(nf.Words, t.value)
+		} else {
+			f.Words = append(f.Words, t.value)
+		}
+		return nil
+	}
+
+	notNegated := func() error {
+		if t.not {
+			return fmt.Errorf("cannot negate %s:", t.tag)
+		}
+		return nil
+	}
+	switch t.tag {
+	case "from", "f":
+		if t.not {
+			nf.From = append(nf.From, t.value)
+		} else {
+			f.From = append(f.From, t.value)
+		}
+	case "to", "t":
+		if t.not {
+			nf.To = append(nf.To, t.value)
+		} else {
+			f.To = append(f.To, t.value)
+		}
+	case "subject", "s":
+		if t.not {
+			nf.Subject = append(nf.Subject, t.value)
+		} else {
+			f.Subject = append(f.Subject, t.value)
+		}
+	case "label", "l":
+		if t.not {
+			nf.Labels = append(nf.Labels, t.value)
+		} else {
+			f.Labels = append(f.Labels, t.value)
+		}
+	case "is":
+		flags := map[string]string{
+			"read":      `\seen`,
+			"seen":      `\seen`,
+			"flagged":   `\flagged`,
+			"answered":  `\answered`,
+			"forwarded": `$forwarded`,
+			"draft":     `\draft`,
+			"junk":      `$junk`,
+			"notjunk":   `$notjunk`,
+		}
+		v := strings.ToLower(t.value)
+		not := t.not
+		if v == "unread" {
+			v = "read"
+			not = !not
+		}
+		flag, ok := flags[v]
+		if !ok {
+			return fmt.Errorf("unknown value %q for is:", t.value)
+		}
+		if not {
+			nf.Labels = append(nf.Labels, flag)
+		} else {
+			f.Labels = append(f.Labels, flag)
+		}
+	case "has", "attachments", "a":
+		types := map[string]AttachmentType{
+			"image":        AttachmentImage,
+			"pdf":          AttachmentPDF,
+			"archive":      AttachmentArchive,
+			"zip":          AttachmentArchive,
+			"spreadsheet":  AttachmentSpreadsheet,
+			"document":     AttachmentDocument,
+			"presentation": AttachmentPresentation,
+		}
+		if t.tag == "has" {
+			types["attachment"] = AttachmentAny
+		} else {
+			types["any"] = AttachmentAny
+			types["none"] = AttachmentNone
+		}
+		at, ok := types[strings.ToLower(t.value)]
+		if !ok {
+			return fmt.Errorf("unknown value %q for %s:", t.value, t.tag)
+		}
+		if t.not {
+			nf.Attachments = at
+		} else {
+			f.Attachments = at
+		}
+	case "mailbox", "mb", "submb":
+		if err := notNegated(); err != nil {
+			return err
+		}
+		if !top {
+			return fmt.Errorf("%s: not possible in OR group", t.tag)
+		}
+		if t.tag == "submb" {
+			f.MailboxChildrenIncluded = true
+		} else if t.value == "" {
+			f.MailboxID = 0
+			f.MailboxName = ""
+		} else {
+			f.MailboxID = 0
+			f.MailboxName = t.value
+		}
+	case "after", "start", "before", "end":
+		if err := notNegated(); err != nil {
+			return err
+		}
+		tm, dateOnly, err := parseSearchTime(t.value)
+		if err != nil {
+			return fmt.Errorf("parsing %s: value: %v", t.tag, err)
+		}
+		switch t.tag {
+		case "after", "start":
+			f.Oldest = &tm
+		case "before":
+			tm = tm.Add(-time.Nanosecond)
+			f.Newest = &tm
+		case "end":
+			if dateOnly {
+				tm = tm.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			f.Newest = &tm
+		}
+	case "header", "h":
+		if err := notNegated(); err != nil {
+			return err
+		}
+		k, v, _ := strings.Cut(t.value, ":")
+		if k == "" {
+			return errors.New("missing header name")
+		}
+		f.Headers = append(f.Headers, [2]string{k, v})
+	case "size>", "size<", "minsize", "maxsize":
+		if err := notNegated(); err != nil {
+			return err
+		}
+		size, err := parseSearchSize(t.value)
+		if err != nil {
+			return fmt.Errorf("parsing %s value: %v", t.tag, err)
+		}
+		switch t.tag {
+		case "size>":
+			f.SizeMin = size + 1
+		case "minsize":
+			f.SizeMin = size
+		case "size<":
+			if size <= 1 {
+				return errors.New("size< must be larger than 1")
+			}
+			f.SizeMax = size - 1
+		case "maxsize":
+			f.SizeMax = size
+		}
+	default:
+		// Not a known tag, e.g. a URL, search as word.
+		w := t.tag + ":" + t.value
+		if t.not {
+			nf.Words = append(nf.Words, w)
+		} else {
+			f.Words = append(f.Words, w)
+		}
+	}
+	return nil
+}
+
+// parseSearchTime parses a date or date and time, returning whether only a date
+// was present.
+func parseSearchTime(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-1-2", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range []string{"2006-1-2T15:04", "2006-1-2T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid date %q, must be like 2006-01-02 or 2006-01-02T15:04", s)
+}
+
+// parseSearchSize parses a size like "10kb" or "2m", with 1024-based units.
+func parseSearchSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	digits := strings.TrimRight(s, "bkmg")
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	units := map[string]int64{"": 1, "b": 1, "k": 1 << 10, "kb": 1 << 10, "m": 1 << 20, "mb": 1 << 20, "g": 1 << 30, "gb": 1 << 30}
+	unit, ok := units[s[len(digits):]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return n * unit, nil
+}
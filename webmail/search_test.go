@@ -0,0 +1,86 @@
+package webmail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSearch(t *testing.T) {
+	check := func(s string, exp Query) {
+		t.Helper()
+		q, err := ParseSearch(s)
+		tcheck(t, err, "parse search")
+		tcompare(t, q, exp)
+	}
+	checkErr := func(s string) {
+		t.Helper()
+		if _, err := ParseSearch(s); err == nil {
+			t.Fatalf("parsing %q: got no error", s)
+		}
+	}
+
+	check("", Query{Filter: Filter{MailboxID: -1}})
+	check(`hello "big world" -spam "say ""hi"""`, Query{
+		Filter:    Filter{MailboxID: -1, Words: []string{"hello", "big world", `say "hi"`}},
+		NotFilter: NotFilter{Words: []string{"spam"}},
+	})
+	check(`from:alice F:bob to:"c d" -s:offer label:$Work -l:todo`, Query{
+		Filter:    Filter{MailboxID: -1, From: []string{"alice", "bob"}, To: []string{"c d"}, Labels: []string{"$Work"}},
+		NotFilter: NotFilter{Subject: []string{"offer"}, Labels: []string{"todo"}},
+	})
+	check(`is:unread -is:flagged has:attachment -a:pdf`, Query{
+		Filter:    Filter{MailboxID: -1, Attachments: AttachmentAny},
+		NotFilter: NotFilter{Labels: []string{`\seen`, `\flagged`}, Attachments: AttachmentPDF},
+	})
+	check(`mailbox:"Archive/2023" submb:`, Query{Filter: Filter{MailboxName: "Archive/2023", MailboxChildrenIncluded: true}})
+	check(`mb:`, Query{Filter: Filter{}})
+	check(`size>10kb size<2M`, Query{Filter: Filter{MailboxID: -1, SizeMin: 10*1024 + 1, SizeMax: 2*1024*1024 - 1}})
+	check(`minsize:100 maxsize:1g`, Query{Filter: Filter{MailboxID: -1, SizeMin: 100, SizeMax: 1 << 30}})
+	check(`h:list-id h:x-spam:yes https://example.org`, Query{Filter: Filter{MailboxID: -1, Headers: [][2]string{{"list-id", ""}, {"x-spam", "yes"}}, Words: []string{"https://example.org"}}})
+
+	after := time.Date(2023, 1, 2, 0, 0, 0, 0, time.Local)
+	before := time.Date(2023, 2, 1, 0, 0, 0, 0, time.Local).Add(-time.Nanosecond)
+	check(`after:2023-01-02 before:2023-02-01`, Query{Filter: Filter{MailboxID: -1, Oldest: &after, Newest: &before}})
+	end := time.Date(2023, 1, 31, 0, 0, 0, 0, time.Local).AddDate(0, 0, 1).Add(-time.Nanosecond)
+	endTime := time.Date(2023, 1, 31, 12, 30, 0, 0, time.Local)
+	check(`end:2023-1-31`, Query{Filter: Filter{MailboxID: -1, Newest: &end}})
+	check(`end:2023-01-31T12:30`, Query{Filter: Filter{MailboxID: -1, Newest: &endTime}})
+
+	// OR groups, with parentheses for grouping.
+	check(`report from:alice OR from:bob OR -is:read`, Query{Filter: Filter{
+		MailboxID: -1,
+		Words:     []string{"report"},
+		Or: [][]FilterAlternative{{
+			{Filter: Filter{From: []string{"alice"}}},
+			{Filter: Filter{From: []string{"bob"}}},
+			{NotFilter: NotFilter{Labels: []string{`\seen`}}},
+		}},
+	}})
+	check(`(from:alice s:x) OR (to:bob (a OR b)) (c d)`, Query{Filter: Filter{
+		MailboxID: -1,
+		Words:     []string{"c", "d"},
+		Or: [][]FilterAlternative{{
+			{Filter: Filter{From: []string{"alice"}, Subject: []string{"x"}}},
+			{Filter: Filter{To: []string{"bob"}, Or: [][]FilterAlternative{{{Filter: Filter{Words: []string{"a"}}}, {Filter: Filter{Words: []string{"b"}}}}}}},
+		}},
+	}})
+	check(`or "OR"`, Query{Filter: Filter{MailboxID: -1, Words: []string{"or", "OR"}}})
+
+	checkErr(`OR a`)
+	checkErr(`a OR`)
+	checkErr(`a OR OR b`)
+	checkErr(`(a`)
+	checkErr(`a)`)
+	checkErr(`-(a b)`)
+	checkErr(`mb:Inbox OR mb:Sent`)
+	checkErr(`(mb:Inbox) OR a`)
+	checkErr(`-mb:Inbox`)
+	checkErr(`-size>10`)
+	checkErr(`size>lots`)
+	checkErr(`size<1`)
+	checkErr(`before:yesterday`)
+	checkErr(`is:bogus`)
+	checkErr(`has:bogus`)
+	checkErr(`h:`)
+	checkErr(`ab"cd"`)
+}
@@ -0,0 +1,393 @@
+"use strict";
+// Javascript is generated from typescript, do not modify generated javascript because changes will be overwritten.
+// Service worker for using webmail with poor or no connectivity.
+//
+// The application and recently viewed messages are cached. Flag changes and
+// message submissions made while offline are stored in IndexedDB and replayed
+// when the webmail client has reconnected. Flag changes are replayed with
+// SyncFlags, which doesn't apply changes to messages that were changed since the
+// client last saw them. Message submissions are only queued if they have a
+// SubmitID: A request that failed may still have reached the server, and the
+// server doesn't send a message with a SubmitID it has already seen again. Queued
+// submissions are kept until the server has responded to them. Submissions the
+// server refuses are saved as draft.
+//
+// Messages from the webmail client:
+// - {type: 'modseq', modseq}: Modseq of the state of the client, stored with queued flag changes.
+// - {type: 'online', modseq, headers}: Client has (re)connected, replay queued changes and sync the
+//   message cache. Headers, with the current CSRF token, are used for API calls.
+// - {type: 'logout'}: Remove all cached and queued data.
+//
+// Messages to the webmail client:
+// - {type: 'queued', fn, count}: Request queued while offline, with total number of queued requests.
+// - {type: 'replayed', result}: Result of replaying queued requests, see ReplayResult.
+const sw = self;
+const appCacheName = 'webmail-app-v1';
+const msgCacheName = 'webmail-msg-v1';
+const appFiles = ['', 'msg.js', 'text.js']; // Relative to scope, '' is the webmail page.
+// Maximum number of requests for messages that we keep cached, older entries
+// are removed first.
+const msgCacheMax = 500;
+// API functions that are queued when offline.
+const queueFunctions = ['FlagsAdd', 'FlagsClear', 'MessageSubmit'];
+// Error from server, for a sherpa call.
+class SherpaError extends Error {
+	code;
+	constructor(code, message) {
+		super(message);
+		this.code = code;
+	}
+}
+let dbPromise = null;
+const openDB = () => {
+	if (!dbPromise) {
+		dbPromise = new Promise((resolve, reject) => {
+			const req = indexedDB.open('webmail-offline', 1);
+			req.onupgradeneeded = () => {
+				req.result.createObjectStore('queue', { keyPath: 'id', autoIncrement: true });
+				req.result.createObjectStore('state');
+			};
+			req.onsuccess = () => resolve(req.result);
+			req.onerror = () => {
+				dbPromise = null;
+				reject(req.error);
+			};
+		});
+	}
+	return dbPromise;
+};
+// dbOp runs fn on object store name in a transaction, and resolves with the result of
+// the request returned by fn when the transaction completes.
+const dbOp = async (name, mode, fn) => {
+	const db = await openDB();
+	return new Promise((resolve, reject) => {
+		const tx = db.transaction(name, mode);
+		const req = fn(tx.objectStore(name));
+		tx.oncomplete = () => resolve(req.result);
+		tx.onerror = () => reject(tx.error);
+		tx.onabort = () => reject(tx.error);
+	});
+};
+const stateGet = async (key) => dbOp('state', 'readonly', store => store.get(key));
+const statePut = async (key, value) => dbOp('state', 'readwrite', store => store.put(value, key));
+const queueList = async () => dbOp('queue', 'readonly', store => store.getAll());
+const queueAdd = async (qr) => dbOp('queue', 'readwrite', store => store.add(qr));
+const queueDelete = async (id) => dbOp('queue', 'readwrite', store => store.delete(id));
+const queueCount = async () => dbOp('queue', 'readonly', store => store.count());
+const notifyClients = async (msg) => {
+	const clients = await sw.clients.matchAll({ type: 'window' });
+	for (const c of clients) {
+		c.postMessage(msg);
+	}
+};
+// Path relative to the scope of the service worker, i.e. the webmail root.
+const relativePath = (url) => {
+	const scope = new URL(sw.registration.scope);
+	if (url.origin !== scope.origin || !url.pathname.startsWith(scope.pathname)) {
+		return null;
+	}
+	return url.pathname.substring(scope.pathname.length);
+};
+// Message ID for cached requests, for removing removed messages from the cache.
+const cachedMessageID = (url) => {
+	const t = /\/msg\/([0-9]+)\//.exec(url) || /\/api\/ParsedMessage\?id=([0-9]+)$/.exec(url);
+	return t ? parseInt(t[1]) : 0;
+};
+const cacheMessage = async (key, resp) => {
+	const cache = await caches.open(msgCacheName);
+	await cache.put(key, resp);
+	const keys = await cache.keys();
+	for (let i = 0; i < keys.length - msgCacheMax; i++) {
+		await cache.delete(keys[i]);
+	}
+};
+// Network first, with the cached version as fallback.
+const fetchApp = async (req) => {
+	const cache = await caches.open(appCacheName);
+	try {
+		const resp = await fetch(req);
+		if (resp.ok) {
+			await cache.put(req, resp.clone());
+		}
+		return resp;
+	}
+	catch (err) {
+		const resp = await cache.match(req);
+		if (resp) {
+			return resp;
+		}
+		throw err;
+	}
+};
+// Cache first, message contents don't change.
+const fetchMessage = async (req) => {
+	const cache = await caches.open(msgCacheName);
+	const cached = await cache.match(req);
+	if (cached) {
+		return cached;
+	}
+	const resp = await fetch(req);
+	if (resp.ok) {
+		await cacheMessage(req, resp.clone());
+	}
+	return resp;
+};
+const jsonResponse = (v) => new Response(JSON.stringify(v), { headers: { 'Content-Type': 'application/json; charset=utf-8' } });
+// ParsedMessage is a POST request, we cache it under a GET request with the
+// message ID.
+const fetchParsedMessage = async (req) => {
+	const body = await req.clone().json();
+	const key = new URL('api/ParsedMessage?id=' + body.params[0], sw.registration.scope).href;
+	try {
+		const resp = await fetch(req);
+		if (resp.ok) {
+			const rresp = resp.clone();
+			const result = await rresp.json();
+			if (result.error === undefined) {
+				await cacheMessage(key, jsonResponse(result));
+			}
+		}
+		return resp;
+	}
+	catch (err) {
+		const cache = await caches.open(msgCacheName);
+		const resp = await cache.match(key);
+		if (resp) {
+			return resp;
+		}
+		throw err;
+	}
+};
+// Requests that change state are queued when the network isn't available, and a
+// result is returned as if the call succeeded.
+const fetchQueue = async (req, fn) => {
+	const body = await req.clone().json();
+	try {
+		return await fetch(req);
+	}
+	catch (err) {
+		// The request may have been processed by the server before the connection
+		// failed. Without a SubmitID, a replay could send the message twice.
+		if (fn === 'MessageSubmit' && !(body.params[0] && body.params[0].SubmitID)) {
+			throw err;
+		}
+		const qr = {
+			fn: fn,
+			params: body.params,
+			modseq: (await stateGet('modseq')) || 0,
+			time: Date.now(),
+		};
+		await queueAdd(qr);
+		await notifyClients({ type: 'queued', fn: fn, count: await queueCount() });
+		if (fn === 'MessageSubmit') {
+			// No undo for queued messages.
+			return jsonResponse({ result: { UndoID: 0, UndoUntil: '0001-01-01T00:00:00Z', Duplicate: false } });
+		}
+		return jsonResponse({ result: null });
+	}
+};
+// call does a sherpa API call with headers from the client, including the CSRF
+// token. Network errors are thrown as is, errors from the server as SherpaError.
+const call = async (fn, headers, params) => {
+	const url = new URL('api/' + fn, sw.registration.scope).href;
+	const resp = await fetch(url, { method: 'POST', headers: headers, body: JSON.stringify({ params: params }) });
+	let result;
+	try {
+		result = await resp.json();
+	}
+	catch (err) {
+		throw new SherpaError('sherpa:badResponse', 'bad response from server, status ' + resp.status);
+	}
+	if (result && result.error) {
+		throw new SherpaError(result.error.code, result.error.message);
+	}
+	return result.result;
+};
+let replaying = null;
+// replay sends queued requests to the server, in order, with the current headers
+// from the client. Consecutive flag changes with the same modseq are combined in a
+// single SyncFlags call.
+const replay = async (headers) => {
+	const r = { flagsApplied: 0, conflicts: [], removed: [], submitted: 0, drafts: [], failed: [], pending: 0 };
+	const queue = await queueList();
+	if (queue.length === 0) {
+		return;
+	}
+	let i = 0;
+	try {
+		while (i < queue.length) {
+			const qr = queue[i];
+			if (qr.fn === 'FlagsAdd' || qr.fn === 'FlagsClear') {
+				let n = 0;
+				const changes = [];
+				while (i + n < queue.length && (queue[i + n].fn === 'FlagsAdd' || queue[i + n].fn === 'FlagsClear') && queue[i + n].modseq === qr.modseq) {
+					const q = queue[i + n];
+					changes.push({ MessageIDs: q.params[0], Flags: q.params[1], Clear: q.fn === 'FlagsClear' });
+					n++;
+				}
+				try {
+					const result = await call('SyncFlags', headers, [qr.modseq, changes]);
+					r.flagsApplied += n;
+					r.conflicts.push(...(result.Conflicts || []));
+					r.removed.push(...(result.Removed || []));
+				}
+				catch (err) {
+					if (!(err instanceof SherpaError) || err.code === 'user:noAuth') {
+						throw err;
+					}
+					r.failed.push('Changing flags: ' + err.message);
+				}
+				for (let j = 0; j < n; j++) {
+					await queueDelete(queue[i + j].id);
+				}
+				i += n;
+			}
+			else if (qr.fn === 'MessageSubmit') {
+				try {
+					// If the server has seen the SubmitID before, the message was already sent,
+					// e.g. by the original request that appeared to fail.
+					await call(qr.fn, headers, qr.params);
+					r.submitted++;
+				}
+				catch (err) {
+					// Without a response from the server, we don't know if it has seen the
+					// submission. We keep it, and try again at next connect.
+					if (!(err instanceof SherpaError) || err.code === 'user:noAuth' || err.code === 'sherpa:badResponse') {
+						throw err;
+					}
+					// Keep the message, the user can fix and send it.
+					try {
+						await call('MessageDraftSave', headers, qr.params);
+						r.drafts.push(err.message);
+					}
+					catch (err2) {
+						if (!(err2 instanceof SherpaError)) {
+							throw err2;
+						}
+						r.failed.push('Sending message: ' + err.message + ', saving as draft: ' + err2.message);
+					}
+				}
+				await queueDelete(qr.id);
+				i++;
+			}
+			else {
+				// Should not happen.
+				await queueDelete(qr.id);
+				i++;
+			}
+		}
+	}
+	catch (err) {
+		// Connection failed, or we are no longer logged in. Try again at next connect.
+		console.log('replaying queued requests', err);
+	}
+	r.pending = queue.length - i;
+	await notifyClients({ type: 'replayed', result: r });
+};
+// syncCache removes messages that were removed on the server from the cache.
+const syncCache = async (headers) => {
+	let modseq = (await stateGet('syncmodseq')) || 0;
+	const cache = await caches.open(msgCacheName);
+	while (true) {
+		const result = await call('Sync', headers, [modseq]);
+		if (result.Full) {
+			if (modseq !== 0) {
+				await caches.delete(msgCacheName);
+			}
+		}
+		else if (result.Removed && result.Removed.length > 0) {
+			const removed = new Set(result.Removed);
+			for (const req of await cache.keys()) {
+				if (removed.has(cachedMessageID(req.url))) {
+					await cache.delete(req);
+				}
+			}
+		}
+		modseq = result.ModSeq;
+		await statePut('syncmodseq', modseq);
+		if (!result.More) {
+			break;
+		}
+	}
+};
+const online = async (modseq, headers) => {
+	if (replaying) {
+		return;
+	}
+	replaying = (async () => {
+		try {
+			await replay(headers);
+			await statePut('modseq', modseq);
+			await syncCache(headers);
+		}
+		catch (err) {
+			console.log('synchronizing after reconnect', err);
+		}
+		finally {
+			replaying = null;
+		}
+	})();
+	await replaying;
+};
+sw.addEventListener('install', (e) => {
+	e.waitUntil((async () => {
+		const cache = await caches.open(appCacheName);
+		try {
+			await cache.addAll(appFiles.map(p => new URL(p, sw.registration.scope).href));
+		}
+		catch (err) {
+			console.log('caching application files', err);
+		}
+		await sw.skipWaiting();
+	})());
+});
+sw.addEventListener('activate', (e) => {
+	e.waitUntil((async () => {
+		for (const name of await caches.keys()) {
+			if (name !== appCacheName && name !== msgCacheName) {
+				await caches.delete(name);
+			}
+		}
+		await sw.clients.claim();
+	})());
+});
+sw.addEventListener('fetch', (e) => {
+	const req = e.request;
+	const path = relativePath(new URL(req.url));
+	if (path === null) {
+		return;
+	}
+	if (req.method === 'GET') {
+		if (appFiles.includes(path)) {
+			e.respondWith(fetchApp(req));
+		}
+		else if (/^msg\/[0-9]+\/(text|html|htmlexternal|msgtext|msghtml|msghtmlexternal|parsedmessage\.js|view\/.*|viewtext\/.*)$/.test(path)) {
+			e.respondWith(fetchMessage(req));
+		}
+	}
+	else if (req.method === 'POST' && path.startsWith('api/')) {
+		const fn = path.substring('api/'.length);
+		if (fn === 'ParsedMessage') {
+			e.respondWith(fetchParsedMessage(req));
+		}
+		else if (queueFunctions.includes(fn)) {
+			e.respondWith(fetchQueue(req, fn));
+		}
+	}
+});
+sw.addEventListener('message', (e) => {
+	const msg = e.data || {};
+	if (msg.type === 'modseq') {
+		e.waitUntil(statePut('modseq', msg.modseq));
+	}
+	else if (msg.type === 'online') {
+		e.waitUntil(online(msg.modseq, msg.headers || []));
+	}
+	else if (msg.type === 'logout') {
+		e.waitUntil((async () => {
+			await caches.delete(msgCacheName);
+			await dbOp('queue', 'readwrite', store => store.clear());
+			await dbOp('state', 'readwrite', store => store.clear());
+		})());
+	}
+});
@@ -110,6 +110,17 @@ type Filter struct {
 	Headers     [][2]string // Header values can be empty, it's a check if the header is present, regardless of value.
 	SizeMin     int64
 	SizeMax     int64
+
+	// OR groups, e.g. from "from:a OR from:b" in a search query. A message must match
+	// at least one alternative of each group.
+	Or [][]FilterAlternative
+}
+
+// FilterAlternative is an alternative in an OR group of a filter. Mailbox-related
+// fields in its Filter are ignored.
+type FilterAlternative struct {
+	Filter    Filter
+	NotFilter NotFilter
 }
 
 // NotFilter matches messages that don't match these fields.
@@ -197,6 +208,10 @@ type ParsedMessage struct {
 
 	ListReplyAddress *MessageAddress // From List-Post.
 
+	// Meeting invitations, replies and cancellations from text/calendar parts
+	// (iMIP), can be empty.
+	Invites []Invite
+
 	// Information used by MessageItem, not exported in this type.
 	envelope    MessageEnvelope
 	attachments []Attachment
@@ -205,6 +220,13 @@ type ParsedMessage struct {
 	firstLine   string
 }
 
+// Invite is a calendar object from a text/calendar part of a message, typically
+// a meeting invitation. The part is also listed as attachment.
+type Invite struct {
+	Path     []int // Of the text/calendar part.
+	Calendar message.Calendar
+}
+
 // EventStart is the first message sent on an SSE connection, giving the client
 // basic data to populate its UI. After this event, messages will follow quickly in
 // an EventViewMsgs event.
@@ -216,6 +238,9 @@ type EventStart struct {
 	MailboxName          string
 	Mailboxes            []store.Mailbox
 	RejectsMailbox       string
+	Settings             store.Settings
+	Labels               []store.Label // Sorted by name.
+	ModSeq               store.ModSeq  // Current modseq, for use with Sync and SyncFlags.
 	Version              string
 }
 
@@ -330,6 +355,24 @@ type ChangeMailboxKeywords struct {
 	store.ChangeMailboxKeywords
 }
 
+// ChangeSettings has the new webmail settings of the account, saved by this or
+// another session.
+type ChangeSettings struct {
+	store.ChangeSettings
+}
+
+// ChangeLabels has all labels of the account, after a label was created, changed
+// or removed.
+type ChangeLabels struct {
+	store.ChangeLabels
+}
+
+// ChangeSubmissionUndoEnd indicates a submission made with a send delay can no
+// longer be undone, because the delay has passed or it was undone.
+type ChangeSubmissionUndoEnd struct {
+	store.ChangeSubmissionUndoEnd
+}
+
 // View holds the information about the returned data for a query. It is used to
 // determine whether mailbox changes should be sent to the client, we only send
 // addition/removal/flag-changes of messages that are in view, or would extend it
@@ -665,6 +708,9 @@ func serveEvents(ctx context.Context, log mlog.Log, w http.ResponseWriter, r *ht
 	}()
 
 	var mbl []store.Mailbox
+	var settings store.Settings
+	var labels []store.Label
+	var modseq store.ModSeq
 
 	// We only take the rlock when getting the tx.
 	acc.WithRLock(func() {
@@ -674,6 +720,14 @@ func serveEvents(ctx context.Context, log mlog.Log, w http.ResponseWriter, r *ht
 
 		mbl, err = bstore.QueryTx[store.Mailbox](qtx).List()
 		xcheckf(ctx, err, "list mailboxes")
+
+		settings, err = store.SettingsGet(qtx)
+		xcheckf(ctx, err, "get settings")
+
+		labels, err = bstore.QueryTx[store.Label](qtx).SortAsc("Name").List()
+		xcheckf(ctx, err, "list labels")
+
+		modseq = xsyncState(ctx, qtx).LastModSeq
 	})
 
 	// Find the designated mailbox if a mailbox name is set, or there are no filters at all.
@@ -729,7 +783,7 @@ func serveEvents(ctx context.Context, log mlog.Log, w http.ResponseWriter, r *ht
 	}
 
 	// Write first event, allowing client to fill its UI with mailboxes.
-	start := EventStart{sse.ID, loginAddress, addresses, domainAddressConfigs, mailbox.Name, mbl, accConf.RejectsMailbox, beaconvar.Version}
+	start := EventStart{sse.ID, loginAddress, addresses, domainAddressConfigs, mailbox.Name, mbl, accConf.RejectsMailbox, settings, labels, modseq, beaconvar.Version}
 	writer.xsendEvent(ctx, log, "start", start)
 
 	// The goroutine doing the querying will send messages on these channels, which
@@ -906,6 +960,15 @@ func serveEvents(ctx context.Context, log mlog.Log, w http.ResponseWriter, r *ht
 			case store.ChangeMailboxKeywords:
 				taggedChanges = append(taggedChanges, [2]any{"ChangeMailboxKeywords", ChangeMailboxKeywords{c}})
 
+			case store.ChangeSettings:
+				taggedChanges = append(taggedChanges, [2]any{"ChangeSettings", ChangeSettings{c}})
+
+			case store.ChangeLabels:
+				taggedChanges = append(taggedChanges, [2]any{"ChangeLabels", ChangeLabels{c}})
+
+			case store.ChangeSubmissionUndoEnd:
+				taggedChanges = append(taggedChanges, [2]any{"ChangeSubmissionUndoEnd", ChangeSubmissionUndoEnd{c}})
+
 			case store.ChangeAddSubscription:
 				// Webmail does not care about subscriptions.
 
@@ -1194,6 +1257,11 @@ func (v view) matches(log mlog.Log, acc *store.Account, checkRange bool, message
 		return false, rerr
 	}
 
+	orFilter := q.orFilterFn(log, acc, &state)
+	if orFilter != nil && (!ensureMessage() || !orFilter(m)) {
+		return false, rerr
+	}
+
 	// Now check that we are either within the sorting order, or "last" was sent.
 	if !checkRange || v.End || ensureMessage() && v.inRange(m) {
 		return true, rerr
@@ -1441,6 +1509,11 @@ func queryMessages(ctx context.Context, log mlog.Log, acc *store.Account, tx *bs
 		q.FilterFn(wordsFilter)
 	}
 
+	orFilter := query.orFilterFn(log, acc, &state)
+	if orFilter != nil {
+		q.FilterFn(orFilter)
+	}
+
 	if query.OrderAsc {
 		q.SortAsc("Received")
 	} else {
@@ -1720,6 +1793,83 @@ func (q Query) flagFilterFn() func(store.Flags, []string) bool {
 	}
 }
 
+// orFilterFn returns a function that applies the OR groups of the query. A nil
+// function is returned if there are no OR groups.
+func (q Query) orFilterFn(log mlog.Log, acc *store.Account, state *msgState) func(m store.Message) bool {
+	if len(q.Filter.Or) == 0 {
+		return nil
+	}
+
+	groups := make([][]func(m store.Message) bool, len(q.Filter.Or))
+	for i, alts := range q.Filter.Or {
+		for _, alt := range alts {
+			groups[i] = append(groups[i], Query{Filter: alt.Filter, NotFilter: alt.NotFilter}.messageFilterFn(log, acc, state))
+		}
+	}
+	return func(m store.Message) bool {
+		for _, fns := range groups {
+			var match bool
+			for _, fn := range fns {
+				if fn(m) {
+					match = true
+					break
+				}
+			}
+			if !match {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// messageFilterFn returns a function that applies all filters of the query except
+// those on mailboxes. Used for the alternatives in OR groups.
+func (q Query) messageFilterFn(log mlog.Log, acc *store.Account, state *msgState) func(m store.Message) bool {
+	var fns []func(m store.Message) bool
+	if flagfilter := q.flagFilterFn(); flagfilter != nil {
+		fns = append(fns, func(m store.Message) bool {
+			return flagfilter(m.Flags, m.Keywords)
+		})
+	}
+	if q.Filter.Oldest != nil {
+		oldest := *q.Filter.Oldest
+		fns = append(fns, func(m store.Message) bool {
+			return !m.Received.Before(oldest)
+		})
+	}
+	if q.Filter.Newest != nil {
+		newest := *q.Filter.Newest
+		fns = append(fns, func(m store.Message) bool {
+			return !m.Received.After(newest)
+		})
+	}
+	if q.Filter.SizeMin > 0 || q.Filter.SizeMax > 0 {
+		fns = append(fns, func(m store.Message) bool {
+			return (q.Filter.SizeMin <= 0 || m.Size >= q.Filter.SizeMin) && (q.Filter.SizeMax <= 0 || m.Size <= q.Filter.SizeMax)
+		})
+	}
+	for _, fn := range []func(m store.Message) bool{
+		q.attachmentFilterFn(log, acc, state),
+		q.envFilterFn(log, state),
+		q.headerFilterFn(log, state),
+		q.wordsFilterFn(log, state),
+		q.orFilterFn(log, acc, state),
+	} {
+		if fn != nil {
+			fns = append(fns, fn)
+		}
+	}
+	return func(m store.Message) bool {
+		for _, fn := range fns {
+			if !fn(m) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // attachmentFilterFn returns a function that filters for the attachment-related
 // filter from the query. A nil function is returned if there are attachment
 // filters.
@@ -76,12 +76,15 @@ var webmailtextHTML []byte
 //go:embed text.js
 var webmailtextJS []byte
 
+//go:embed serviceworker.js
+var webmailServiceWorkerJS []byte
+
 var (
 	// Similar between ../webmail/webmail.go:/metricSubmission and ../smtpserver/server.go:/metricSubmission
 	metricSubmission = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "beacon_webmail_submission_total",
-			Help: "Webmail message submission results, known values (those ending with error are server errors): ok, badfrom, messagelimiterror, recipientlimiterror, queueerror, storesenterror.",
+			Help: "Webmail message submission results, known values (those ending with error are server errors): ok, duplicate, badfrom, messagelimiterror, recipientlimiterror, queueerror, storesenterror.",
 		},
 		[]string{
 			"result",
@@ -227,7 +230,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 		}
 		return
 
-	case "/msg.js", "/text.js":
+	case "/msg.js", "/text.js", "/serviceworker.js":
 		switch r.Method {
 		default:
 			http.Error(w, "405 - method not allowed - use get", http.StatusMethodNotAllowed)
@@ -237,8 +240,12 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 
 		path := filepath.Join("webmail", r.URL.Path[1:])
 		var fallback = webmailmsgJS
-		if r.URL.Path == "/text.js" {
+		switch r.URL.Path {
+		case "/text.js":
 			fallback = webmailtextJS
+		case "/serviceworker.js":
+			// Service worker for offline use, its scope is the webmail path.
+			fallback = webmailServiceWorkerJS
 		}
 
 		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
@@ -247,6 +254,8 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 	}
 
 	isAPI := strings.HasPrefix(r.URL.Path, "/api/")
+	// Exports are started by submitting a form, with the CSRF token as form field.
+	isExport := r.URL.Path == "/export"
 	// Only allow POST for calls, they will not work cross-domain without CORS.
 	if isAPI && r.URL.Path != "/api/" && r.Method != "POST" {
 		http.Error(w, "405 - method not allowed - use post", http.StatusMethodNotAllowed)
@@ -258,7 +267,7 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 	// All other URLs, except the login endpoint require some authentication.
 	if r.URL.Path != "/api/LoginPrep" && r.URL.Path != "/api/Login" {
 		var ok bool
-		accName, sessionToken, loginAddress, ok = webauth.Check(ctx, log, webauth.Accounts, "webmail", isForwarded, w, r, isAPI, isAPI, false)
+		accName, sessionToken, loginAddress, ok = webauth.Check(ctx, log, webauth.Accounts, "webmail", isForwarded, w, r, isAPI, isAPI || isExport, isExport)
 		if !ok {
 			// Response has been written already.
 			return
@@ -272,6 +281,11 @@ func handle(apiHandler http.Handler, isForwarded bool, w http.ResponseWriter, r
 		return
 	}
 
+	if isExport {
+		serveExport(ctx, log, accName, w, r)
+		return
+	}
+
 	// We are now expecting the following URLs:
 	// .../msg/<msgid>/{attachments.zip,parsedmessage.js,raw}
 	// .../msg/<msgid>/{,msg}{text,html,htmlexternal}
@@ -824,6 +838,9 @@ func inlineNode(node *html.Node, cids map[string]*message.Part, totalSize *int64
 		if _, err := io.Copy(w, ap.Reader()); err != nil {
 			return fmt.Errorf("writing base64 datauri: %v", err)
 		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("flushing base64 datauri: %v", err)
+		}
 		node.Attr[i].Val = sb.String()
 	}
 	for node = node.FirstChild; node != nil; node = node.NextSibling {
@@ -260,6 +260,13 @@ var api;
 		AttachmentType["AttachmentDocument"] = "document";
 		AttachmentType["AttachmentPresentation"] = "presentation";
 	})(AttachmentType = api.AttachmentType || (api.AttachmentType = {}));
+	// Quoting is the style of quoting the original message in replies.
+	let Quoting;
+	(function (Quoting) {
+		Quoting["Default"] = "";
+		Quoting["Bottom"] = "bottom";
+		Quoting["Top"] = "top";
+	})(Quoting = api.Quoting || (api.Quoting = {}));
 	// SecurityResult indicates whether a security feature is supported.
 	let SecurityResult;
 	(function (SecurityResult) {
@@ -271,38 +278,57 @@ var api;
 		// lookups.
 		SecurityResult["SecurityResultUnknown"] = "unknown";
 	})(SecurityResult = api.SecurityResult || (api.SecurityResult = {}));
-	api.structTypes = { "Address": true, "Attachment": true, "ChangeMailboxAdd": true, "ChangeMailboxCounts": true, "ChangeMailboxKeywords": true, "ChangeMailboxRemove": true, "ChangeMailboxRename": true, "ChangeMailboxSpecialUse": true, "ChangeMsgAdd": true, "ChangeMsgFlags": true, "ChangeMsgRemove": true, "ChangeMsgThread": true, "Domain": true, "DomainAddressConfig": true, "Envelope": true, "EventStart": true, "EventViewChanges": true, "EventViewErr": true, "EventViewMsgs": true, "EventViewReset": true, "File": true, "Filter": true, "Flags": true, "ForwardAttachments": true, "Mailbox": true, "Message": true, "MessageAddress": true, "MessageEnvelope": true, "MessageItem": true, "NotFilter": true, "Page": true, "ParsedMessage": true, "Part": true, "Query": true, "RecipientSecurity": true, "Request": true, "SpecialUse": true, "SubmitMessage": true };
-	api.stringsTypes = { "AttachmentType": true, "CSRFToken": true, "Localpart": true, "SecurityResult": true, "ThreadMode": true };
+	api.structTypes = { "Address": true, "Attachment": true, "Calendar": true, "CalendarAddress": true, "CalendarEvent": true, "ChangeLabels": true, "ChangeMailboxAdd": true, "ChangeMailboxCounts": true, "ChangeMailboxKeywords": true, "ChangeMailboxRemove": true, "ChangeMailboxRename": true, "ChangeMailboxSpecialUse": true, "ChangeMsgAdd": true, "ChangeMsgFlags": true, "ChangeMsgRemove": true, "ChangeMsgThread": true, "ChangeSettings": true, "ChangeSubmissionUndoEnd": true, "Classification": true, "Contact": true, "Domain": true, "DomainAddressConfig": true, "Envelope": true, "EventStart": true, "EventViewChanges": true, "EventViewErr": true, "EventViewMsgs": true, "EventViewReset": true, "ExportProgress": true, "File": true, "Filter": true, "FilterAlternative": true, "Flags": true, "ForwardAttachments": true, "Invite": true, "InviteStatus": true, "JunkExplanation": true, "Label": true, "Mailbox": true, "Message": true, "MessageAddress": true, "MessageEnvelope": true, "MessageItem": true, "NotFilter": true, "Page": true, "ParsedMessage": true, "Part": true, "Query": true, "RecipientSecurity": true, "Request": true, "SavedSearchItem": true, "Settings": true, "SpecialUse": true, "SubmitMessage": true, "SubmitResult": true, "SyncFlagChange": true, "SyncFlagsResult": true, "SyncMessage": true, "SyncResult": true, "WordProbability": true };
+	api.stringsTypes = { "AttachmentType": true, "CSRFToken": true, "Localpart": true, "Quoting": true, "SecurityResult": true, "ThreadMode": true };
 	api.intsTypes = { "ModSeq": true, "UID": true, "Validation": true };
 	api.types = {
 		"Request": { "Name": "Request", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "SSEID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Cancel", "Docs": "", "Typewords": ["bool"] }, { "Name": "Query", "Docs": "", "Typewords": ["Query"] }, { "Name": "Page", "Docs": "", "Typewords": ["Page"] }] },
 		"Query": { "Name": "Query", "Docs": "", "Fields": [{ "Name": "OrderAsc", "Docs": "", "Typewords": ["bool"] }, { "Name": "Threading", "Docs": "", "Typewords": ["ThreadMode"] }, { "Name": "Filter", "Docs": "", "Typewords": ["Filter"] }, { "Name": "NotFilter", "Docs": "", "Typewords": ["NotFilter"] }] },
-		"Filter": { "Name": "Filter", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxChildrenIncluded", "Docs": "", "Typewords": ["bool"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Words", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Oldest", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Newest", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["AttachmentType"] }, { "Name": "Labels", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Headers", "Docs": "", "Typewords": ["[]", "[]", "string"] }, { "Name": "SizeMin", "Docs": "", "Typewords": ["int64"] }, { "Name": "SizeMax", "Docs": "", "Typewords": ["int64"] }] },
+		"Filter": { "Name": "Filter", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxChildrenIncluded", "Docs": "", "Typewords": ["bool"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Words", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Oldest", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Newest", "Docs": "", "Typewords": ["nullable", "timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["AttachmentType"] }, { "Name": "Labels", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Headers", "Docs": "", "Typewords": ["[]", "[]", "string"] }, { "Name": "SizeMin", "Docs": "", "Typewords": ["int64"] }, { "Name": "SizeMax", "Docs": "", "Typewords": ["int64"] }, { "Name": "Or", "Docs": "", "Typewords": ["[]", "[]", "FilterAlternative"] }] },
+		"FilterAlternative": { "Name": "FilterAlternative", "Docs": "", "Fields": [{ "Name": "Filter", "Docs": "", "Typewords": ["Filter"] }, { "Name": "NotFilter", "Docs": "", "Typewords": ["NotFilter"] }] },
 		"NotFilter": { "Name": "NotFilter", "Docs": "", "Fields": [{ "Name": "Words", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["AttachmentType"] }, { "Name": "Labels", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"Page": { "Name": "Page", "Docs": "", "Fields": [{ "Name": "AnchorMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Count", "Docs": "", "Typewords": ["int32"] }, { "Name": "DestMessageID", "Docs": "", "Typewords": ["int64"] }] },
-		"ParsedMessage": { "Name": "ParsedMessage", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Part", "Docs": "", "Typewords": ["Part"] }, { "Name": "Headers", "Docs": "", "Typewords": ["{}", "[]", "string"] }, { "Name": "Texts", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HasHTML", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListReplyAddress", "Docs": "", "Typewords": ["nullable", "MessageAddress"] }] },
+		"ParsedMessage": { "Name": "ParsedMessage", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Part", "Docs": "", "Typewords": ["Part"] }, { "Name": "Headers", "Docs": "", "Typewords": ["{}", "[]", "string"] }, { "Name": "Texts", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HasHTML", "Docs": "", "Typewords": ["bool"] }, { "Name": "ListReplyAddress", "Docs": "", "Typewords": ["nullable", "MessageAddress"] }, { "Name": "Invites", "Docs": "", "Typewords": ["[]", "Invite"] }] },
 		"Part": { "Name": "Part", "Docs": "", "Fields": [{ "Name": "BoundaryOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "HeaderOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "BodyOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "EndOffset", "Docs": "", "Typewords": ["int64"] }, { "Name": "RawLineCount", "Docs": "", "Typewords": ["int64"] }, { "Name": "DecodedSize", "Docs": "", "Typewords": ["int64"] }, { "Name": "MediaType", "Docs": "", "Typewords": ["string"] }, { "Name": "MediaSubType", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTypeParams", "Docs": "", "Typewords": ["{}", "string"] }, { "Name": "ContentID", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentDescription", "Docs": "", "Typewords": ["string"] }, { "Name": "ContentTransferEncoding", "Docs": "", "Typewords": ["string"] }, { "Name": "Envelope", "Docs": "", "Typewords": ["nullable", "Envelope"] }, { "Name": "Parts", "Docs": "", "Typewords": ["[]", "Part"] }, { "Name": "Message", "Docs": "", "Typewords": ["nullable", "Part"] }] },
 		"Envelope": { "Name": "Envelope", "Docs": "", "Fields": [{ "Name": "Date", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "Sender", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "CC", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "BCC", "Docs": "", "Typewords": ["[]", "Address"] }, { "Name": "InReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }] },
 		"Address": { "Name": "Address", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "User", "Docs": "", "Typewords": ["string"] }, { "Name": "Host", "Docs": "", "Typewords": ["string"] }] },
 		"MessageAddress": { "Name": "MessageAddress", "Docs": "", "Fields": [{ "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "User", "Docs": "", "Typewords": ["string"] }, { "Name": "Domain", "Docs": "", "Typewords": ["Domain"] }] },
 		"Domain": { "Name": "Domain", "Docs": "", "Fields": [{ "Name": "ASCII", "Docs": "", "Typewords": ["string"] }, { "Name": "Unicode", "Docs": "", "Typewords": ["string"] }] },
-		"SubmitMessage": { "Name": "SubmitMessage", "Docs": "", "Fields": [{ "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Cc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Bcc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "TextBody", "Docs": "", "Typewords": ["string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["[]", "File"] }, { "Name": "ForwardAttachments", "Docs": "", "Typewords": ["ForwardAttachments"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ResponseMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }] },
+		"Invite": { "Name": "Invite", "Docs": "", "Fields": [{ "Name": "Path", "Docs": "", "Typewords": ["[]", "int32"] }, { "Name": "Calendar", "Docs": "", "Typewords": ["Calendar"] }] },
+		"Calendar": { "Name": "Calendar", "Docs": "", "Fields": [{ "Name": "Method", "Docs": "", "Typewords": ["string"] }, { "Name": "ProdID", "Docs": "", "Typewords": ["string"] }, { "Name": "Events", "Docs": "", "Typewords": ["[]", "CalendarEvent"] }] },
+		"CalendarEvent": { "Name": "CalendarEvent", "Docs": "", "Fields": [{ "Name": "UID", "Docs": "", "Typewords": ["string"] }, { "Name": "RecurrenceID", "Docs": "", "Typewords": ["string"] }, { "Name": "Sequence", "Docs": "", "Typewords": ["int32"] }, { "Name": "Start", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "End", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "AllDay", "Docs": "", "Typewords": ["bool"] }, { "Name": "Summary", "Docs": "", "Typewords": ["string"] }, { "Name": "Description", "Docs": "", "Typewords": ["string"] }, { "Name": "Location", "Docs": "", "Typewords": ["string"] }, { "Name": "Status", "Docs": "", "Typewords": ["string"] }, { "Name": "Recurrence", "Docs": "", "Typewords": ["string"] }, { "Name": "Organizer", "Docs": "", "Typewords": ["CalendarAddress"] }, { "Name": "Attendees", "Docs": "", "Typewords": ["[]", "CalendarAddress"] }] },
+		"CalendarAddress": { "Name": "CalendarAddress", "Docs": "", "Fields": [{ "Name": "Address", "Docs": "", "Typewords": ["string"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "PartStat", "Docs": "", "Typewords": ["string"] }, { "Name": "Role", "Docs": "", "Typewords": ["string"] }, { "Name": "RSVP", "Docs": "", "Typewords": ["bool"] }] },
+		"SubmitMessage": { "Name": "SubmitMessage", "Docs": "", "Fields": [{ "Name": "From", "Docs": "", "Typewords": ["string"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Cc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Bcc", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "TextBody", "Docs": "", "Typewords": ["string"] }, { "Name": "HTMLBody", "Docs": "", "Typewords": ["string"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["[]", "File"] }, { "Name": "ForwardAttachments", "Docs": "", "Typewords": ["ForwardAttachments"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "ResponseMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "UserAgent", "Docs": "", "Typewords": ["string"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "DraftMessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "SubmitID", "Docs": "", "Typewords": ["string"] }] },
 		"File": { "Name": "File", "Docs": "", "Fields": [{ "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "DataURI", "Docs": "", "Typewords": ["string"] }] },
 		"ForwardAttachments": { "Name": "ForwardAttachments", "Docs": "", "Fields": [{ "Name": "MessageID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Paths", "Docs": "", "Typewords": ["[]", "[]", "int32"] }] },
+		"SubmitResult": { "Name": "SubmitResult", "Docs": "", "Fields": [{ "Name": "UndoID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UndoUntil", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Duplicate", "Docs": "", "Typewords": ["bool"] }] },
+		"Contact": { "Name": "Contact", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Emails", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Phones", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Note", "Docs": "", "Typewords": ["string"] }] },
+		"InviteStatus": { "Name": "InviteStatus", "Docs": "", "Fields": [{ "Name": "PartStat", "Docs": "", "Typewords": ["string"] }, { "Name": "Replied", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Updated", "Docs": "", "Typewords": ["bool"] }, { "Name": "Cancelled", "Docs": "", "Typewords": ["bool"] }] },
+		"Settings": { "Name": "Settings", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["uint8"] }, { "Name": "Signature", "Docs": "", "Typewords": ["string"] }, { "Name": "Quoting", "Docs": "", "Typewords": ["Quoting"] }, { "Name": "DefaultFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "SendDelay", "Docs": "", "Typewords": ["int32"] }, { "Name": "Layout", "Docs": "", "Typewords": ["string"] }, { "Name": "Threading", "Docs": "", "Typewords": ["string"] }, { "Name": "OrderAsc", "Docs": "", "Typewords": ["bool"] }, { "Name": "ShowHTML", "Docs": "", "Typewords": ["bool"] }, { "Name": "ShowShortcuts", "Docs": "", "Typewords": ["bool"] }, { "Name": "ShowAllHeaders", "Docs": "", "Typewords": ["bool"] }, { "Name": "ShowHeaders", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"Label": { "Name": "Label", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Keyword", "Docs": "", "Typewords": ["string"] }, { "Name": "Color", "Docs": "", "Typewords": ["string"] }] },
+		"SavedSearchItem": { "Name": "SavedSearchItem", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "Search", "Docs": "", "Typewords": ["string"] }, { "Name": "Unread", "Docs": "", "Typewords": ["int32"] }] },
 		"Mailbox": { "Name": "Mailbox", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Name", "Docs": "", "Typewords": ["string"] }, { "Name": "UIDValidity", "Docs": "", "Typewords": ["uint32"] }, { "Name": "UIDNext", "Docs": "", "Typewords": ["UID"] }, { "Name": "Archive", "Docs": "", "Typewords": ["bool"] }, { "Name": "Draft", "Docs": "", "Typewords": ["bool"] }, { "Name": "Junk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Sent", "Docs": "", "Typewords": ["bool"] }, { "Name": "Trash", "Docs": "", "Typewords": ["bool"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "HaveCounts", "Docs": "", "Typewords": ["bool"] }, { "Name": "Total", "Docs": "", "Typewords": ["int64"] }, { "Name": "Deleted", "Docs": "", "Typewords": ["int64"] }, { "Name": "Unread", "Docs": "", "Typewords": ["int64"] }, { "Name": "Unseen", "Docs": "", "Typewords": ["int64"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }] },
 		"RecipientSecurity": { "Name": "RecipientSecurity", "Docs": "", "Fields": [{ "Name": "STARTTLS", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "MTASTS", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "DNSSEC", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "DANE", "Docs": "", "Typewords": ["SecurityResult"] }, { "Name": "RequireTLS", "Docs": "", "Typewords": ["SecurityResult"] }] },
-		"EventStart": { "Name": "EventStart", "Docs": "", "Fields": [{ "Name": "SSEID", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["MessageAddress"] }, { "Name": "Addresses", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "DomainAddressConfigs", "Docs": "", "Typewords": ["{}", "DomainAddressConfig"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailboxes", "Docs": "", "Typewords": ["[]", "Mailbox"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }] },
-		"DomainAddressConfig": { "Name": "DomainAddressConfig", "Docs": "", "Fields": [{ "Name": "LocalpartCatchallSeparator", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCaseSensitive", "Docs": "", "Typewords": ["bool"] }] },
-		"EventViewErr": { "Name": "EventViewErr", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "RequestID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Err", "Docs": "", "Typewords": ["string"] }] },
-		"EventViewReset": { "Name": "EventViewReset", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "RequestID", "Docs": "", "Typewords": ["int64"] }] },
-		"EventViewMsgs": { "Name": "EventViewMsgs", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "RequestID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageItems", "Docs": "", "Typewords": ["[]", "[]", "MessageItem"] }, { "Name": "ParsedMessage", "Docs": "", "Typewords": ["nullable", "ParsedMessage"] }, { "Name": "ViewEnd", "Docs": "", "Typewords": ["bool"] }] },
+		"ExportProgress": { "Name": "ExportProgress", "Docs": "", "Fields": [{ "Name": "Exported", "Docs": "", "Typewords": ["int32"] }, { "Name": "Total", "Docs": "", "Typewords": ["int32"] }, { "Name": "Done", "Docs": "", "Typewords": ["bool"] }, { "Name": "Error", "Docs": "", "Typewords": ["string"] }] },
+		"JunkExplanation": { "Name": "JunkExplanation", "Docs": "", "Fields": [{ "Name": "Threshold", "Docs": "", "Typewords": ["float64"] }, { "Name": "Classification", "Docs": "", "Typewords": ["Classification"] }] },
+		"Classification": { "Name": "Classification", "Docs": "", "Fields": [{ "Name": "Probability", "Docs": "", "Typewords": ["float64"] }, { "Name": "TopHam", "Docs": "", "Typewords": ["[]", "WordProbability"] }, { "Name": "TopSpam", "Docs": "", "Typewords": ["[]", "WordProbability"] }, { "Name": "Words", "Docs": "", "Typewords": ["int32"] }, { "Name": "Known", "Docs": "", "Typewords": ["int32"] }, { "Name": "Hams", "Docs": "", "Typewords": ["uint32"] }, { "Name": "Spams", "Docs": "", "Typewords": ["uint32"] }] },
+		"WordProbability": { "Name": "WordProbability", "Docs": "", "Fields": [{ "Name": "Word", "Docs": "", "Typewords": ["string"] }, { "Name": "Probability", "Docs": "", "Typewords": ["float64"] }, { "Name": "Ham", "Docs": "", "Typewords": ["uint32"] }, { "Name": "Spam", "Docs": "", "Typewords": ["uint32"] }] },
+		"SyncResult": { "Name": "SyncResult", "Docs": "", "Fields": [{ "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Full", "Docs": "", "Typewords": ["bool"] }, { "Name": "Mailboxes", "Docs": "", "Typewords": ["[]", "Mailbox"] }, { "Name": "Added", "Docs": "", "Typewords": ["[]", "MessageItem"] }, { "Name": "Changed", "Docs": "", "Typewords": ["[]", "SyncMessage"] }, { "Name": "Removed", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "More", "Docs": "", "Typewords": ["bool"] }] },
 		"MessageItem": { "Name": "MessageItem", "Docs": "", "Fields": [{ "Name": "Message", "Docs": "", "Typewords": ["Message"] }, { "Name": "Envelope", "Docs": "", "Typewords": ["MessageEnvelope"] }, { "Name": "Attachments", "Docs": "", "Typewords": ["[]", "Attachment"] }, { "Name": "IsSigned", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsEncrypted", "Docs": "", "Typewords": ["bool"] }, { "Name": "FirstLine", "Docs": "", "Typewords": ["string"] }, { "Name": "MatchQuery", "Docs": "", "Typewords": ["bool"] }] },
 		"Message": { "Name": "Message", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UID", "Docs": "", "Typewords": ["UID"] }, { "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "CreateSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Expunged", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsReject", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsForward", "Docs": "", "Typewords": ["bool"] }, { "Name": "MailboxOrigID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxDestinedID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Received", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "RemoteIP", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIPMasked1", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIPMasked2", "Docs": "", "Typewords": ["string"] }, { "Name": "RemoteIPMasked3", "Docs": "", "Typewords": ["string"] }, { "Name": "EHLODomain", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFrom", "Docs": "", "Typewords": ["string"] }, { "Name": "MailFromLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "MailFromDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "RcptToLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "RcptToDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromLocalpart", "Docs": "", "Typewords": ["Localpart"] }, { "Name": "MsgFromDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "MsgFromOrgDomain", "Docs": "", "Typewords": ["string"] }, { "Name": "EHLOValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "MailFromValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "MsgFromValidated", "Docs": "", "Typewords": ["bool"] }, { "Name": "EHLOValidation", "Docs": "", "Typewords": ["Validation"] }, { "Name": "MailFromValidation", "Docs": "", "Typewords": ["Validation"] }, { "Name": "MsgFromValidation", "Docs": "", "Typewords": ["Validation"] }, { "Name": "DKIMDomains", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "OrigEHLODomain", "Docs": "", "Typewords": ["string"] }, { "Name": "OrigDKIMDomains", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }, { "Name": "SubjectBase", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageHash", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ThreadID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ThreadParentIDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "ThreadMissingLink", "Docs": "", "Typewords": ["bool"] }, { "Name": "ThreadMuted", "Docs": "", "Typewords": ["bool"] }, { "Name": "ThreadCollapsed", "Docs": "", "Typewords": ["bool"] }, { "Name": "IsMailingList", "Docs": "", "Typewords": ["bool"] }, { "Name": "ReceivedTLSVersion", "Docs": "", "Typewords": ["uint16"] }, { "Name": "ReceivedTLSCipherSuite", "Docs": "", "Typewords": ["uint16"] }, { "Name": "ReceivedRequireTLS", "Docs": "", "Typewords": ["bool"] }, { "Name": "Seen", "Docs": "", "Typewords": ["bool"] }, { "Name": "Answered", "Docs": "", "Typewords": ["bool"] }, { "Name": "Flagged", "Docs": "", "Typewords": ["bool"] }, { "Name": "Forwarded", "Docs": "", "Typewords": ["bool"] }, { "Name": "Junk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Notjunk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Deleted", "Docs": "", "Typewords": ["bool"] }, { "Name": "Draft", "Docs": "", "Typewords": ["bool"] }, { "Name": "Phishing", "Docs": "", "Typewords": ["bool"] }, { "Name": "MDNSent", "Docs": "", "Typewords": ["bool"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Size", "Docs": "", "Typewords": ["int64"] }, { "Name": "TrainedJunk", "Docs": "", "Typewords": ["nullable", "bool"] }, { "Name": "MsgPrefix", "Docs": "", "Typewords": ["nullable", "string"] }, { "Name": "ParsedBuf", "Docs": "", "Typewords": ["nullable", "string"] }] },
 		"MessageEnvelope": { "Name": "MessageEnvelope", "Docs": "", "Fields": [{ "Name": "Date", "Docs": "", "Typewords": ["timestamp"] }, { "Name": "Subject", "Docs": "", "Typewords": ["string"] }, { "Name": "From", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "Sender", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "ReplyTo", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "To", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "CC", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "BCC", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "InReplyTo", "Docs": "", "Typewords": ["string"] }, { "Name": "MessageID", "Docs": "", "Typewords": ["string"] }] },
 		"Attachment": { "Name": "Attachment", "Docs": "", "Fields": [{ "Name": "Path", "Docs": "", "Typewords": ["[]", "int32"] }, { "Name": "Filename", "Docs": "", "Typewords": ["string"] }, { "Name": "Part", "Docs": "", "Typewords": ["Part"] }] },
+		"SyncMessage": { "Name": "SyncMessage", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Flags", "Docs": "", "Typewords": ["Flags"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"Flags": { "Name": "Flags", "Docs": "", "Fields": [{ "Name": "Seen", "Docs": "", "Typewords": ["bool"] }, { "Name": "Answered", "Docs": "", "Typewords": ["bool"] }, { "Name": "Flagged", "Docs": "", "Typewords": ["bool"] }, { "Name": "Forwarded", "Docs": "", "Typewords": ["bool"] }, { "Name": "Junk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Notjunk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Deleted", "Docs": "", "Typewords": ["bool"] }, { "Name": "Draft", "Docs": "", "Typewords": ["bool"] }, { "Name": "Phishing", "Docs": "", "Typewords": ["bool"] }, { "Name": "MDNSent", "Docs": "", "Typewords": ["bool"] }] },
+		"SyncFlagChange": { "Name": "SyncFlagChange", "Docs": "", "Fields": [{ "Name": "MessageIDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Flags", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "Clear", "Docs": "", "Typewords": ["bool"] }] },
+		"SyncFlagsResult": { "Name": "SyncFlagsResult", "Docs": "", "Fields": [{ "Name": "Conflicts", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Removed", "Docs": "", "Typewords": ["[]", "int64"] }] },
+		"EventStart": { "Name": "EventStart", "Docs": "", "Fields": [{ "Name": "SSEID", "Docs": "", "Typewords": ["int64"] }, { "Name": "LoginAddress", "Docs": "", "Typewords": ["MessageAddress"] }, { "Name": "Addresses", "Docs": "", "Typewords": ["[]", "MessageAddress"] }, { "Name": "DomainAddressConfigs", "Docs": "", "Typewords": ["{}", "DomainAddressConfig"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Mailboxes", "Docs": "", "Typewords": ["[]", "Mailbox"] }, { "Name": "RejectsMailbox", "Docs": "", "Typewords": ["string"] }, { "Name": "Settings", "Docs": "", "Typewords": ["Settings"] }, { "Name": "Labels", "Docs": "", "Typewords": ["[]", "Label"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Version", "Docs": "", "Typewords": ["string"] }] },
+		"DomainAddressConfig": { "Name": "DomainAddressConfig", "Docs": "", "Fields": [{ "Name": "LocalpartCatchallSeparator", "Docs": "", "Typewords": ["string"] }, { "Name": "LocalpartCaseSensitive", "Docs": "", "Typewords": ["bool"] }] },
+		"EventViewErr": { "Name": "EventViewErr", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "RequestID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Err", "Docs": "", "Typewords": ["string"] }] },
+		"EventViewReset": { "Name": "EventViewReset", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "RequestID", "Docs": "", "Typewords": ["int64"] }] },
+		"EventViewMsgs": { "Name": "EventViewMsgs", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "RequestID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MessageItems", "Docs": "", "Typewords": ["[]", "[]", "MessageItem"] }, { "Name": "ParsedMessage", "Docs": "", "Typewords": ["nullable", "ParsedMessage"] }, { "Name": "ViewEnd", "Docs": "", "Typewords": ["bool"] }] },
 		"EventViewChanges": { "Name": "EventViewChanges", "Docs": "", "Fields": [{ "Name": "ViewID", "Docs": "", "Typewords": ["int64"] }, { "Name": "Changes", "Docs": "", "Typewords": ["[]", "[]", "any"] }] },
 		"ChangeMsgAdd": { "Name": "ChangeMsgAdd", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UID", "Docs": "", "Typewords": ["UID"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Flags", "Docs": "", "Typewords": ["Flags"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }, { "Name": "MessageItems", "Docs": "", "Typewords": ["[]", "MessageItem"] }] },
-		"Flags": { "Name": "Flags", "Docs": "", "Fields": [{ "Name": "Seen", "Docs": "", "Typewords": ["bool"] }, { "Name": "Answered", "Docs": "", "Typewords": ["bool"] }, { "Name": "Flagged", "Docs": "", "Typewords": ["bool"] }, { "Name": "Forwarded", "Docs": "", "Typewords": ["bool"] }, { "Name": "Junk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Notjunk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Deleted", "Docs": "", "Typewords": ["bool"] }, { "Name": "Draft", "Docs": "", "Typewords": ["bool"] }, { "Name": "Phishing", "Docs": "", "Typewords": ["bool"] }, { "Name": "MDNSent", "Docs": "", "Typewords": ["bool"] }] },
 		"ChangeMsgRemove": { "Name": "ChangeMsgRemove", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UIDs", "Docs": "", "Typewords": ["[]", "UID"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }] },
 		"ChangeMsgFlags": { "Name": "ChangeMsgFlags", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "UID", "Docs": "", "Typewords": ["UID"] }, { "Name": "ModSeq", "Docs": "", "Typewords": ["ModSeq"] }, { "Name": "Mask", "Docs": "", "Typewords": ["Flags"] }, { "Name": "Flags", "Docs": "", "Typewords": ["Flags"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }] },
 		"ChangeMsgThread": { "Name": "ChangeMsgThread", "Docs": "", "Fields": [{ "Name": "MessageIDs", "Docs": "", "Typewords": ["[]", "int64"] }, { "Name": "Muted", "Docs": "", "Typewords": ["bool"] }, { "Name": "Collapsed", "Docs": "", "Typewords": ["bool"] }] },
@@ -313,12 +339,16 @@ var api;
 		"ChangeMailboxSpecialUse": { "Name": "ChangeMailboxSpecialUse", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "SpecialUse", "Docs": "", "Typewords": ["SpecialUse"] }] },
 		"SpecialUse": { "Name": "SpecialUse", "Docs": "", "Fields": [{ "Name": "Archive", "Docs": "", "Typewords": ["bool"] }, { "Name": "Draft", "Docs": "", "Typewords": ["bool"] }, { "Name": "Junk", "Docs": "", "Typewords": ["bool"] }, { "Name": "Sent", "Docs": "", "Typewords": ["bool"] }, { "Name": "Trash", "Docs": "", "Typewords": ["bool"] }] },
 		"ChangeMailboxKeywords": { "Name": "ChangeMailboxKeywords", "Docs": "", "Fields": [{ "Name": "MailboxID", "Docs": "", "Typewords": ["int64"] }, { "Name": "MailboxName", "Docs": "", "Typewords": ["string"] }, { "Name": "Keywords", "Docs": "", "Typewords": ["[]", "string"] }] },
+		"ChangeSettings": { "Name": "ChangeSettings", "Docs": "", "Fields": [{ "Name": "Settings", "Docs": "", "Typewords": ["Settings"] }] },
+		"ChangeLabels": { "Name": "ChangeLabels", "Docs": "", "Fields": [{ "Name": "Labels", "Docs": "", "Typewords": ["[]", "Label"] }] },
+		"ChangeSubmissionUndoEnd": { "Name": "ChangeSubmissionUndoEnd", "Docs": "", "Fields": [{ "Name": "ID", "Docs": "", "Typewords": ["int64"] }] },
 		"UID": { "Name": "UID", "Docs": "", "Values": null },
 		"ModSeq": { "Name": "ModSeq", "Docs": "", "Values": null },
 		"Validation": { "Name": "Validation", "Docs": "", "Values": [{ "Name": "ValidationUnknown", "Value": 0, "Docs": "" }, { "Name": "ValidationStrict", "Value": 1, "Docs": "" }, { "Name": "ValidationDMARC", "Value": 2, "Docs": "" }, { "Name": "ValidationRelaxed", "Value": 3, "Docs": "" }, { "Name": "ValidationPass", "Value": 4, "Docs": "" }, { "Name": "ValidationNeutral", "Value": 5, "Docs": "" }, { "Name": "ValidationTemperror", "Value": 6, "Docs": "" }, { "Name": "ValidationPermerror", "Value": 7, "Docs": "" }, { "Name": "ValidationFail", "Value": 8, "Docs": "" }, { "Name": "ValidationSoftfail", "Value": 9, "Docs": "" }, { "Name": "ValidationNone", "Value": 10, "Docs": "" }] },
 		"CSRFToken": { "Name": "CSRFToken", "Docs": "", "Values": null },
 		"ThreadMode": { "Name": "ThreadMode", "Docs": "", "Values": [{ "Name": "ThreadOff", "Value": "off", "Docs": "" }, { "Name": "ThreadOn", "Value": "on", "Docs": "" }, { "Name": "ThreadUnread", "Value": "unread", "Docs": "" }] },
 		"AttachmentType": { "Name": "AttachmentType", "Docs": "", "Values": [{ "Name": "AttachmentIndifferent", "Value": "", "Docs": "" }, { "Name": "AttachmentNone", "Value": "none", "Docs": "" }, { "Name": "AttachmentAny", "Value": "any", "Docs": "" }, { "Name": "AttachmentImage", "Value": "image", "Docs": "" }, { "Name": "AttachmentPDF", "Value": "pdf", "Docs": "" }, { "Name": "AttachmentArchive", "Value": "archive", "Docs": "" }, { "Name": "AttachmentSpreadsheet", "Value": "spreadsheet", "Docs": "" }, { "Name": "AttachmentDocument", "Value": "document", "Docs": "" }, { "Name": "AttachmentPresentation", "Value": "presentation", "Docs": "" }] },
+		"Quoting": { "Name": "Quoting", "Docs": "", "Values": [{ "Name": "Default", "Value": "", "Docs": "" }, { "Name": "Bottom", "Value": "bottom", "Docs": "" }, { "Name": "Top", "Value": "top", "Docs": "" }] },
 		"SecurityResult": { "Name": "SecurityResult", "Docs": "", "Values": [{ "Name": "SecurityResultError", "Value": "error", "Docs": "" }, { "Name": "SecurityResultNo", "Value": "no", "Docs": "" }, { "Name": "SecurityResultYes", "Value": "yes", "Docs": "" }, { "Name": "SecurityResultUnknown", "Value": "unknown", "Docs": "" }] },
 		"Localpart": { "Name": "Localpart", "Docs": "", "Values": null },
 	};
@@ -326,6 +356,7 @@ var api;
 		Request: (v) => api.parse("Request", v),
 		Query: (v) => api.parse("Query", v),
 		Filter: (v) => api.parse("Filter", v),
+		FilterAlternative: (v) => api.parse("FilterAlternative", v),
 		NotFilter: (v) => api.parse("NotFilter", v),
 		Page: (v) => api.parse("Page", v),
 		ParsedMessage: (v) => api.parse("ParsedMessage", v),
@@ -334,23 +365,41 @@ var api;
 		Address: (v) => api.parse("Address", v),
 		MessageAddress: (v) => api.parse("MessageAddress", v),
 		Domain: (v) => api.parse("Domain", v),
+		Invite: (v) => api.parse("Invite", v),
+		Calendar: (v) => api.parse("Calendar", v),
+		CalendarEvent: (v) => api.parse("CalendarEvent", v),
+		CalendarAddress: (v) => api.parse("CalendarAddress", v),
 		SubmitMessage: (v) => api.parse("SubmitMessage", v),
 		File: (v) => api.parse("File", v),
 		ForwardAttachments: (v) => api.parse("ForwardAttachments", v),
+		SubmitResult: (v) => api.parse("SubmitResult", v),
+		Contact: (v) => api.parse("Contact", v),
+		InviteStatus: (v) => api.parse("InviteStatus", v),
+		Settings: (v) => api.parse("Settings", v),
+		Label: (v) => api.parse("Label", v),
+		SavedSearchItem: (v) => api.parse("SavedSearchItem", v),
 		Mailbox: (v) => api.parse("Mailbox", v),
 		RecipientSecurity: (v) => api.parse("RecipientSecurity", v),
+		ExportProgress: (v) => api.parse("ExportProgress", v),
+		JunkExplanation: (v) => api.parse("JunkExplanation", v),
+		Classification: (v) => api.parse("Classification", v),
+		WordProbability: (v) => api.parse("WordProbability", v),
+		SyncResult: (v) => api.parse("SyncResult", v),
+		MessageItem: (v) => api.parse("MessageItem", v),
+		Message: (v) => api.parse("Message", v),
+		MessageEnvelope: (v) => api.parse("MessageEnvelope", v),
+		Attachment: (v) => api.parse("Attachment", v),
+		SyncMessage: (v) => api.parse("SyncMessage", v),
+		Flags: (v) => api.parse("Flags", v),
+		SyncFlagChange: (v) => api.parse("SyncFlagChange", v),
+		SyncFlagsResult: (v) => api.parse("SyncFlagsResult", v),
 		EventStart: (v) => api.parse("EventStart", v),
 		DomainAddressConfig: (v) => api.parse("DomainAddressConfig", v),
 		EventViewErr: (v) => api.parse("EventViewErr", v),
 		EventViewReset: (v) => api.parse("EventViewReset", v),
 		EventViewMsgs: (v) => api.parse("EventViewMsgs", v),
-		MessageItem: (v) => api.parse("MessageItem", v),
-		Message: (v) => api.parse("Message", v),
-		MessageEnvelope: (v) => api.parse("MessageEnvelope", v),
-		Attachment: (v) => api.parse("Attachment", v),
 		EventViewChanges: (v) => api.parse("EventViewChanges", v),
 		ChangeMsgAdd: (v) => api.parse("ChangeMsgAdd", v),
-		Flags: (v) => api.parse("Flags", v),
 		ChangeMsgRemove: (v) => api.parse("ChangeMsgRemove", v),
 		ChangeMsgFlags: (v) => api.parse("ChangeMsgFlags", v),
 		ChangeMsgThread: (v) => api.parse("ChangeMsgThread", v),
@@ -361,12 +410,16 @@ var api;
 		ChangeMailboxSpecialUse: (v) => api.parse("ChangeMailboxSpecialUse", v),
 		SpecialUse: (v) => api.parse("SpecialUse", v),
 		ChangeMailboxKeywords: (v) => api.parse("ChangeMailboxKeywords", v),
+		ChangeSettings: (v) => api.parse("ChangeSettings", v),
+		ChangeLabels: (v) => api.parse("ChangeLabels", v),
+		ChangeSubmissionUndoEnd: (v) => api.parse("ChangeSubmissionUndoEnd", v),
 		UID: (v) => api.parse("UID", v),
 		ModSeq: (v) => api.parse("ModSeq", v),
 		Validation: (v) => api.parse("Validation", v),
 		CSRFToken: (v) => api.parse("CSRFToken", v),
 		ThreadMode: (v) => api.parse("ThreadMode", v),
 		AttachmentType: (v) => api.parse("AttachmentType", v),
+		Quoting: (v) => api.parse("Quoting", v),
 		SecurityResult: (v) => api.parse("SecurityResult", v),
 		Localpart: (v) => api.parse("Localpart", v),
 	};
@@ -402,12 +455,14 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Login returns a session token for the credentials, or fails with error code
-		// "user:badLogin". Call LoginPrep to get a loginToken.
-		async Login(loginToken, username, password) {
+		// "user:badLogin". Call LoginPrep to get a loginToken. If two-factor
+		// authentication is enabled for the account and totpCode is empty, the call fails
+		// with error code "user:totpRequired", and should be repeated with a totpCode.
+		async Login(loginToken, username, password, totpCode) {
 			const fn = "Login";
-			const paramTypes = [["string"], ["string"], ["string"]];
+			const paramTypes = [["string"], ["string"], ["string"], ["string"]];
 			const returnTypes = [["CSRFToken"]];
-			const params = [loginToken, username, password];
+			const params = [loginToken, username, password, totpCode];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// Logout invalidates the session token.
@@ -455,13 +510,78 @@ var api;
 		// 
 		// If a Sent mailbox is configured, messages are added to it after submitting
 		// to the delivery queue.
+		// 
+		// If From is empty, the default From address from the settings is used, or the
+		// login address if no default is configured.
+		// 
+		// If the account has a send delay configured, delivery attempts only start after
+		// the delay, and until then the submission can be undone with MessageSubmitUndo.
 		async MessageSubmit(m) {
 			const fn = "MessageSubmit";
 			const paramTypes = [["SubmitMessage"]];
-			const returnTypes = [];
+			const returnTypes = [["SubmitResult"]];
+			const params = [m];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// submit composes and submits message m, see MessageSubmit. If calendarReply is
+		// set, it is an iCalendar object with method REPLY that is added as text/calendar
+		// alternative to the text body. If sendDelay is set, the send delay from the
+		// account settings is applied.
+		async submit(m, calendarReply, sendDelay) {
+			const fn = "submit";
+			const paramTypes = [["SubmitMessage"], ["string"], ["bool"]];
+			const returnTypes = [["SubmitResult"]];
+			const params = [m, calendarReply, sendDelay];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// MessageSubmitUndo undoes a submission made with a send delay, as returned by
+		// MessageSubmit. This is only possible while delivery of the message has not
+		// started. The message is removed from the delivery queue and from the Sent
+		// mailbox, and added as draft message, including its Bcc header, whose ID is
+		// returned.
+		async MessageSubmitUndo(undoID) {
+			const fn = "MessageSubmitUndo";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["int64"]];
+			const params = [undoID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// MessageDraftSave stores m as draft message in the mailbox with special-use flag
+		// Draft, and returns the ID of the new message. If m.DraftMessageID is set, that
+		// previous version of the draft is removed in the same transaction.
+		// 
+		// Unlike with MessageSubmit, recipients are optional, and Bcc addresses are
+		// kept in the message header.
+		async MessageDraftSave(m) {
+			const fn = "MessageDraftSave";
+			const paramTypes = [["SubmitMessage"]];
+			const returnTypes = [["int64"]];
 			const params = [m];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// MessageDraftDelete removes a draft message, e.g. when the message is
+		// discarded in the composer. Removing a draft that no longer exists is not an
+		// error.
+		async MessageDraftDelete(draftMessageID) {
+			const fn = "MessageDraftDelete";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [draftMessageID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// MessageDraftOpen returns a draft message as SubmitMessage, for continuing to
+		// compose it. If the draft has an HTML part, it is returned as HTMLBody, with
+		// inline images as data URIs. Attachments are returned as files with data URIs.
+		// If the draft is a reply to a message in the account, ResponseMessageID is set.
+		// When the message is submitted or saved again, DraftMessageID is used to remove
+		// this draft.
+		async MessageDraftOpen(draftMessageID) {
+			const fn = "MessageDraftOpen";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["SubmitMessage"]];
+			const params = [draftMessageID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// MessageMove moves messages to another mailbox. If the message is already in
 		// the mailbox an error is returned.
 		async MessageMove(messageIDs, mailboxID) {
@@ -531,7 +651,8 @@ var api;
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
 		// CompleteRecipient returns autocomplete matches for a recipient, returning the
-		// matches, most recently used first, and whether this is the full list and further
+		// matches, contacts from the address book first, then previous recipients with
+		// most recently used first, and whether this is the full list and further
 		// requests for longer prefixes aren't necessary.
 		async CompleteRecipient(search) {
 			const fn = "CompleteRecipient";
@@ -540,6 +661,150 @@ var api;
 			const params = [search];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// ContactList returns all contacts in the address book, sorted by name.
+		async ContactList() {
+			const fn = "ContactList";
+			const paramTypes = [];
+			const returnTypes = [["[]", "Contact"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ContactSave adds a new contact to the address book if its ID is zero, or
+		// updates an existing contact. The saved contact is returned.
+		async ContactSave(contact) {
+			const fn = "ContactSave";
+			const paramTypes = [["Contact"]];
+			const returnTypes = [["Contact"]];
+			const params = [contact];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// ContactDelete removes a contact from the address book.
+		async ContactDelete(contactID) {
+			const fn = "ContactDelete";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [contactID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// CalendarReply answers a meeting invitation in the text/calendar part at
+		// partPath of a message, with participation status "ACCEPTED", "TENTATIVE" or
+		// "DECLINED", and an optional comment for the organizer. The reply (iMIP) is sent
+		// to the organizer through the regular submission, from the address of this
+		// account that was invited, and is added to the Sent mailbox.
+		async CalendarReply(messageID, partPath, partStat, comment) {
+			const fn = "CalendarReply";
+			const paramTypes = [["int64"], ["[]", "int32"], ["string"], ["string"]];
+			const returnTypes = [];
+			const params = [messageID, partPath, partStat, comment];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// InviteStatuses returns the status for each invitation in a message, in the
+		// order of ParsedMessage.Invites.
+		async InviteStatuses(messageID) {
+			const fn = "InviteStatuses";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["[]", "InviteStatus"]];
+			const params = [messageID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// Settings returns the webmail settings of the account. They are also sent in
+		// the start event of the SSE connection.
+		async Settings() {
+			const fn = "Settings";
+			const paramTypes = [];
+			const returnTypes = [["Settings"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SettingsSave saves the webmail settings of the account. Other sessions of the
+		// account get the new settings in a ChangeSettings event.
+		async SettingsSave(settings) {
+			const fn = "SettingsSave";
+			const paramTypes = [["Settings"]];
+			const returnTypes = [];
+			const params = [settings];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// Labels returns the labels of the account, sorted by name.
+		async Labels() {
+			const fn = "Labels";
+			const paramTypes = [];
+			const returnTypes = [["[]", "Label"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LabelCreate adds a label for a keyword, with a name and color for display. If
+		// keyword is empty, the lower-cased name is used. Color is of the form "#rrggbb",
+		// or empty for the default color.
+		async LabelCreate(name, keyword, color) {
+			const fn = "LabelCreate";
+			const paramTypes = [["string"], ["string"], ["string"]];
+			const returnTypes = [["Label"]];
+			const params = [name, keyword, color];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LabelRename changes the name and keyword of a label. If the keyword changes, it
+		// is replaced on all messages.
+		async LabelRename(labelID, name, keyword) {
+			const fn = "LabelRename";
+			const paramTypes = [["int64"], ["string"], ["string"]];
+			const returnTypes = [];
+			const params = [labelID, name, keyword];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LabelColor changes the color of a label. Color is of the form "#rrggbb", or
+		// empty for the default color.
+		async LabelColor(labelID, color) {
+			const fn = "LabelColor";
+			const paramTypes = [["int64"], ["string"]];
+			const returnTypes = [];
+			const params = [labelID, color];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// LabelDelete removes a label, and its keyword from all messages.
+		async LabelDelete(labelID) {
+			const fn = "LabelDelete";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [labelID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SearchParse parses a search query, as typed in the search bar, into a Query.
+		// See ParseSearch for the syntax. A mailbox name in the search is resolved into
+		// Filter.MailboxID, and label names are resolved into their keywords.
+		async SearchParse(search) {
+			const fn = "SearchParse";
+			const paramTypes = [["string"]];
+			const returnTypes = [["Query"]];
+			const params = [search];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SavedSearches returns the saved searches of the account, sorted by name, with
+		// the current number of unread messages matching each search.
+		async SavedSearches() {
+			const fn = "SavedSearches";
+			const paramTypes = [];
+			const returnTypes = [["[]", "SavedSearchItem"]];
+			const params = [];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SavedSearchSave saves a search under a name, replacing the search of an
+		// existing saved search with the same name.
+		async SavedSearchSave(name, search) {
+			const fn = "SavedSearchSave";
+			const paramTypes = [["string"], ["string"]];
+			const returnTypes = [];
+			const params = [name, search];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SavedSearchDelete removes a saved search.
+		async SavedSearchDelete(savedSearchID) {
+			const fn = "SavedSearchDelete";
+			const paramTypes = [["int64"]];
+			const returnTypes = [];
+			const params = [savedSearchID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// MailboxSetSpecialUse sets the special use flags of a mailbox.
 		async MailboxSetSpecialUse(mb) {
 			const fn = "MailboxSetSpecialUse";
@@ -576,11 +841,53 @@ var api;
 			const params = [messageAddressee];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
+		// ExportProgress returns the progress of an export started through the export
+		// endpoint with progressID. Exports that were not started yet, or that finished a
+		// while ago, return zero values.
+		async ExportProgress(progressID) {
+			const fn = "ExportProgress";
+			const paramTypes = [["string"]];
+			const returnTypes = [["ExportProgress"]];
+			const params = [progressID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// JunkExplain classifies a message with the current junk filter of the account,
+		// returning the most hammy and spammy words that determined the probability.
+		// Training since delivery may result in a different classification than at the
+		// time of delivery.
+		async JunkExplain(msgID) {
+			const fn = "JunkExplain";
+			const paramTypes = [["int64"]];
+			const returnTypes = [["JunkExplanation"]];
+			const params = [msgID];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// Sync returns the changes to messages since modseq, and all mailboxes. Used by
+		// clients that keep messages cached, e.g. while offline, and reconnect. Pass
+		// modseq 0 for the initial call, the result has Full set and the current modseq.
+		async Sync(modseq) {
+			const fn = "Sync";
+			const paramTypes = [["ModSeq"]];
+			const returnTypes = [["SyncResult"]];
+			const params = [modseq];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
+		// SyncFlags applies flag changes that a client made while offline, when its
+		// state was synchronized at modseq. Changes are applied in order. Messages that
+		// were changed since modseq are not modified, and returned as conflicts, as are
+		// messages that were removed.
+		async SyncFlags(modseq, changes) {
+			const fn = "SyncFlags";
+			const paramTypes = [["ModSeq"], ["[]", "SyncFlagChange"]];
+			const returnTypes = [["SyncFlagsResult"]];
+			const params = [modseq, changes];
+			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
+		}
 		// SSETypes exists to ensure the generated API contains the types, for use in SSE events.
 		async SSETypes() {
 			const fn = "SSETypes";
 			const paramTypes = [];
-			const returnTypes = [["EventStart"], ["EventViewErr"], ["EventViewReset"], ["EventViewMsgs"], ["EventViewChanges"], ["ChangeMsgAdd"], ["ChangeMsgRemove"], ["ChangeMsgFlags"], ["ChangeMsgThread"], ["ChangeMailboxRemove"], ["ChangeMailboxAdd"], ["ChangeMailboxRename"], ["ChangeMailboxCounts"], ["ChangeMailboxSpecialUse"], ["ChangeMailboxKeywords"], ["Flags"]];
+			const returnTypes = [["EventStart"], ["EventViewErr"], ["EventViewReset"], ["EventViewMsgs"], ["EventViewChanges"], ["ChangeMsgAdd"], ["ChangeMsgRemove"], ["ChangeMsgFlags"], ["ChangeMsgThread"], ["ChangeMailboxRemove"], ["ChangeMailboxAdd"], ["ChangeMailboxRename"], ["ChangeMailboxCounts"], ["ChangeMailboxSpecialUse"], ["ChangeMailboxKeywords"], ["ChangeSettings"], ["ChangeLabels"], ["ChangeSubmissionUndoEnd"], ["Flags"]];
 			const params = [];
 			return await _sherpaCall(this.baseURL, this.authState, { ...this.options }, paramTypes, returnTypes, fn, params);
 		}
@@ -1203,11 +1510,11 @@ Enable consistency checking in UI updates:
 	settingsPut({...settings, checkConsistency: true})
 
 - todo: in msglistView, show names of people we have sent to, and address otherwise.
-- todo: implement settings stored in the server, such as mailboxCollapsed, keyboard shortcuts. also new settings for displaying email as html by default for configured sender address or domain. name to use for "From", optional default Reply-To and Bcc addresses, signatures (per address), configured labels/keywords with human-readable name, colors and toggling with shortcut keys 1-9.
+- todo: store more settings in the server, such as mailboxCollapsed, keyboard shortcuts. also new settings for displaying email as html by default for configured sender address or domain. name to use for "From", optional default Reply-To and Bcc addresses, signatures per address, toggling labels with shortcut keys 1-9.
 - todo: in msglist, if our address is in the from header, list addresses in the to/cc/bcc, it's likely a sent folder
 - todo: automated tests? perhaps some unit tests, then ui scenario's.
 - todo: compose, wrap lines
-- todo: composing of html messages. possibly based on contenteditable. would be good if we can include original html, but quoted. must make sure to not include dangerous scripts/resources, or sandbox it.
+- todo: compose html, keep formatting of html replied to when quoting a selection.
 - todo: make alt up/down keys work on html iframe too. requires loading it from sameorigin, to get access to its inner document.
 - todo: reconnect with last known modseq and don't clear the message list, only update it
 - todo: resize and move of compose window
@@ -1217,7 +1524,7 @@ Enable consistency checking in UI updates:
 - todo: only show orange underline where it could be a problem? in addresses and anchor texts. we may be lighting up a christmas tree now, desensitizing users.
 - todo: saved searches that are displayed below list of mailboxes, for quick access to preset view
 - todo: when search on free-form text is active, highlight the searched text in the message view.
-- todo: composeView: save as draft, periodically and when closing.
+- todo: composeView: also save draft when the browser tab is closed, not only periodically.
 - todo: forwarding of html parts, including inline attachments, so the html version can be rendered like the original by the receiver.
 - todo: buttons/mechanism to operate on all messages in a mailbox/search query, without having to list and select all messages. e.g. clearing flags/labels.
 - todo: can we detect if browser supports proper CSP? if not, refuse to load html messages?
@@ -1342,8 +1649,88 @@ const settingsPut = (nsettings) => {
 	catch (err) {
 		console.log('storing settings in localstorage', err);
 	}
+	// Preferences shared by all sessions are also saved on the server.
+	if (accountSettingsLoaded) {
+		const ns = withLocalSettings(accountSettings);
+		if (JSON.stringify(ns) !== JSON.stringify(accountSettings)) {
+			accountSettingsSave(ns);
+		}
+	}
 };
 let settings = parseSettings();
+// Settings stored on the server, shared by all sessions of the account. Set when
+// the SSE connection is initialized, and updated on ChangeSettings events. The
+// preferences that are also in settings, like layout and threading, are kept in
+// sync with settings.
+let accountSettings = {
+	ID: 0,
+	Signature: '',
+	Quoting: api.Quoting.Default,
+	DefaultFrom: '',
+	SendDelay: 0,
+	Layout: 'auto',
+	Threading: api.ThreadMode.ThreadOn,
+	OrderAsc: false,
+	ShowHTML: false,
+	ShowShortcuts: true,
+	ShowAllHeaders: false,
+	ShowHeaders: [],
+};
+// Whether accountSettings have been received from the server. Only then are
+// changed preferences saved to the server.
+let accountSettingsLoaded = false;
+// Return account settings with the shared preferences from settings.
+const withLocalSettings = (s) => {
+	return {
+		...s,
+		Layout: settings.layout,
+		Threading: settings.threading,
+		OrderAsc: settings.orderAsc,
+		ShowHTML: settings.showHTML,
+		ShowShortcuts: settings.showShortcuts,
+		ShowAllHeaders: settings.showAllHeaders,
+		ShowHeaders: settings.showHeaders,
+	};
+};
+// Save account settings on the server. Other sessions get a ChangeSettings event.
+const accountSettingsSave = async (s) => {
+	accountSettings = s;
+	try {
+		await client.SettingsSave(s);
+	}
+	catch (err) {
+		window.alert('Error saving settings: ' + errmsg(err));
+	}
+};
+// Labels defined for the account, with a name and color for a keyword. Set when
+// the SSE connection is initialized, and updated on ChangeLabels events.
+let accountLabels = [];
+// Return black or white, whichever is more readable on a background color of the
+// form "#rrggbb".
+const labelTextColor = (color) => {
+	const v = parseInt(color.substring(1), 16);
+	const luminance = 0.299 * (v >> 16 & 0xff) + 0.587 * (v >> 8 & 0xff) + 0.114 * (v & 0xff);
+	return luminance > 140 ? 'black' : 'white';
+};
+// Return the text and styling for showing a keyword, with the name and color of
+// the label for the keyword, if any.
+const keywordKids = (kw) => {
+	const l = accountLabels.find(l => l.Keyword === kw);
+	if (!l) {
+		return [kw];
+	}
+	return [
+		l.Color ? style({ backgroundColor: l.Color, borderColor: l.Color, color: labelTextColor(l.Color) }) : [],
+		attr.title('Label "' + l.Name + '", keyword ' + kw),
+		l.Name,
+	];
+};
+// Signature from the settings, with the conventional "-- " separator line. Empty
+// if no signature is configured.
+const signatureBlock = () => {
+	const sig = accountSettings.Signature.replace(/\r/g, '').replace(/\n+$/, '');
+	return sig ? '-- \n' + sig + '\n' : '';
+};
 // All addresses for this account, can include "@domain" wildcard, User is empty in
 // that case. Set when SSE connection is initialized.
 let accountAddresses = [];
@@ -1365,6 +1752,8 @@ const login = async (reason) => {
 		let autosize;
 		let username;
 		let password;
+		let totpBox;
+		let totpCode;
 		const root = dom.div(style({ position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: zindexes.login, animation: 'fadein .15s ease-in' }), dom.div(reasonElem = reason ? dom.div(style({ marginBottom: '2ex', textAlign: 'center' }), reason) : dom.div(), dom.div(style({ backgroundColor: 'white', borderRadius: '.25em', padding: '1em', boxShadow: '0 0 20px rgba(0, 0, 0, 0.1)', border: '1px solid #ddd', maxWidth: '95vw', overflowX: 'auto', maxHeight: '95vh', overflowY: 'auto', marginBottom: '20vh' }), dom.form(async function submit(e) {
 			e.preventDefault();
 			e.stopPropagation();
@@ -1372,7 +1761,7 @@ const login = async (reason) => {
 			try {
 				fieldset.disabled = true;
 				const loginToken = await client.LoginPrep();
-				const token = await client.Login(loginToken, username.value, password.value);
+				const token = await client.Login(loginToken, username.value, password.value, totpCode.value);
 				try {
 					window.localStorage.setItem('webmailcsrftoken', token);
 				}
@@ -1386,13 +1775,21 @@ const login = async (reason) => {
 				resolve(token);
 			}
 			catch (err) {
+				if (err.code === 'user:totpRequired') {
+					// Password was correct, ask for the second factor and submit again.
+					totpBox.style.display = '';
+					totpCode.required = true;
+					fieldset.disabled = false;
+					totpCode.focus();
+					return;
+				}
 				console.log('login error', err);
 				window.alert('Error: ' + errmsg(err));
 			}
 			finally {
 				fieldset.disabled = false;
 			}
-		}, fieldset = dom.fieldset(dom.h1('Mail'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Email address', style({ marginBottom: '.5ex' })), autosize = dom.span(dom._class('autosize'), username = dom.input(attr.required(''), attr.placeholder('jane@example.org'), function change() { autosize.dataset.value = username.value; }, function input() { autosize.dataset.value = username.value; }))), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Password', style({ marginBottom: '.5ex' })), password = dom.input(attr.type('password'), attr.required(''))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Login')))))));
+		}, fieldset = dom.fieldset(dom.h1('Mail'), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Email address', style({ marginBottom: '.5ex' })), autosize = dom.span(dom._class('autosize'), username = dom.input(attr.required(''), attr.placeholder('jane@example.org'), function change() { autosize.dataset.value = username.value; }, function input() { autosize.dataset.value = username.value; }))), dom.label(style({ display: 'block', marginBottom: '2ex' }), dom.div('Password', style({ marginBottom: '.5ex' })), password = dom.input(attr.type('password'), attr.required(''))), totpBox = dom.label(style({ display: 'none', marginBottom: '2ex' }), dom.div('Two-factor authentication code', style({ marginBottom: '.5ex' })), totpCode = dom.input(attr.autocomplete('one-time-code'), attr.title('Code from your authenticator app, or one of your recovery codes.'))), dom.div(style({ textAlign: 'center' }), dom.submitbutton('Login')))))));
 		document.body.appendChild(root);
 		username.focus();
 	});
@@ -1884,6 +2281,18 @@ const focusPlaceholder = (s) => {
 		},
 	];
 };
+// Parse search query with the server, falling back to the client-side parser,
+// e.g. for searches with syntax errors.
+const parseSearchServer = async (searchquery, mailboxlistView) => {
+	try {
+		const q = await client.SearchParse(searchquery);
+		return [q.Filter, q.NotFilter];
+	}
+	catch (err) {
+		const [f, notf,] = parseSearch(searchquery, mailboxlistView);
+		return [f, notf];
+	}
+};
 // Parse a location hash into search terms (if any), selected message id (if
 // any) and filters.
 // Optional message id at the end, with ",<num>".
@@ -2082,6 +2491,7 @@ const cmdHelp = async () => {
 		['/', 'search'],
 		['i', 'open inbox'],
 		['?', 'help'],
+		['A', 'contacts'],
 		['ctrl ?', 'tooltip for focused element'],
 		['ctrl m', 'focus message'],
 	].map(t => dom.tr(dom.td(t[0]), dom.td(t[1]))), dom.tr(dom.td(attr.colspan('2'), dom.h2('Mailbox', style({ margin: '0' })))), [
@@ -2114,17 +2524,20 @@ const cmdHelp = async () => {
 		['→', 'expand thread'],
 	].map(t => dom.tr(dom.td(t[0]), dom.td(t[1]))))), dom.div(style({ width: '40em' }), dom.table(dom.tr(dom.td(attr.colspan('2'), dom.h2('Compose', style({ margin: '0' })))), [
 		['ctrl Enter', 'send message'],
-		['ctrl w', 'cancel message'],
+		['ctrl s', 'save draft and close'],
+		['ctrl w', 'cancel message, removing its draft'],
 		['ctrl O', 'add To'],
 		['ctrl C', 'add Cc'],
 		['ctrl B', 'add Bcc'],
 		['ctrl Y', 'add Reply-To'],
+		['ctrl H', 'switch between plain text and HTML'],
 		['ctrl -', 'remove current address'],
 		['ctrl +', 'add address of same type'],
 	].map(t => dom.tr(dom.td(t[0]), dom.td(t[1]))), dom.tr(dom.td(attr.colspan('2'), dom.h2('Message', style({ margin: '1ex 0 0 0' })))), [
 		['r', 'reply or list reply'],
 		['R', 'reply all'],
 		['f', 'forward message'],
+		['e', 'edit draft'],
 		['v', 'view attachments'],
 		['t', 'view text version'],
 		['T', 'view HTML version'],
@@ -2193,8 +2606,246 @@ const cmdTooltip = async () => {
 			style({ top: '' + (pos.y + pos.height + 2) + 'px', maxHeight: '' + (window.innerHeight - (pos.y + pos.height + 2)) + 'px' }), title);
 	}));
 };
+// Show popup with the settings stored on the server, for all sessions of the
+// account.
+const cmdSettings = async () => {
+	let fieldset;
+	let signature;
+	let quoting;
+	let defaultFrom;
+	let sendDelay;
+	let showShortcuts;
+	let showHTML;
+	const remove = popup(style({ minWidth: '30em' }), dom.h1('Settings'), dom.div(style({ marginBottom: '1ex' }), 'Settings are stored on the server and apply to all sessions, also on other devices.'), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		const ns = {
+			...withLocalSettings(accountSettings),
+			Signature: signature.value,
+			Quoting: quoting.value,
+			DefaultFrom: defaultFrom.value,
+			SendDelay: parseInt(sendDelay.value),
+			ShowShortcuts: showShortcuts.checked,
+			ShowHTML: showHTML.checked,
+		};
+		await withStatus('Saving settings', client.SettingsSave(ns), fieldset);
+		accountSettings = ns;
+		settingsPut({ ...settings, showShortcuts: ns.ShowShortcuts, showHTML: ns.ShowHTML });
+		remove();
+	}, fieldset = dom.fieldset(dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div('Signature'), signature = dom.textarea(dom._class('mono'), attr.rows('5'), style({ width: '100%' }), new String(accountSettings.Signature)), dom.div(style({ fontStyle: 'italic' }), 'Added to new messages and replies, and to messages composed by the server, like replies to invitations.')), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div('Quoting in replies'), quoting = dom.select(dom.option('Automatic: write below selected text, above the message otherwise', attr.value(api.Quoting.Default), accountSettings.Quoting === api.Quoting.Default ? attr.selected('') : []), dom.option('Write below quoted message', attr.value(api.Quoting.Bottom), accountSettings.Quoting === api.Quoting.Bottom ? attr.selected('') : []), dom.option('Write above quoted message', attr.value(api.Quoting.Top), accountSettings.Quoting === api.Quoting.Top ? attr.selected('') : []))), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div('Default From address'), defaultFrom = dom.select(dom.option('Login address', attr.value('')), accountAddresses.filter(a => a.User).map(a => {
+		const v = formatAddress(a);
+		return dom.option(formatAddressFull(a), attr.value(v), v === accountSettings.DefaultFrom ? attr.selected('') : []);
+	}))), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div('Send delay'), sendDelay = dom.select([0, 10, 20, 30, 60].map(n => dom.option(n === 0 ? 'None, send immediately' : n + ' seconds', attr.value('' + n), n === accountSettings.SendDelay ? attr.selected('') : []))), dom.div(style({ fontStyle: 'italic' }), 'Sending a message can be undone during the delay.')), dom.label(style({ display: 'block' }), showShortcuts = dom.input(attr.type('checkbox'), settings.showShortcuts ? attr.checked('') : []), ' Briefly show keyboard shortcut when a button is clicked'), dom.label(style({ display: 'block' }), showHTML = dom.input(attr.type('checkbox'), settings.showHTML ? attr.checked('') : []), ' Show HTML version of messages by default'), dom.div(style({ marginTop: '1ex' }), dom.submitbutton('Save')))));
+};
+// Show popup to create, rename, recolor and remove labels. Renaming the keyword
+// of a label, or removing a label, changes the keywords of all messages.
+const cmdLabels = async () => {
+	const defaultColor = '#ffd700';
+	const labelsElem = dom.div();
+	const render = () => {
+		dom._kids(labelsElem, accountLabels.length === 0 ? dom.div(style({ marginBottom: '1ex' }), 'No labels yet.') : [], accountLabels.map(l => {
+			let fieldset;
+			let color;
+			let name;
+			let keyword;
+			return dom.form(async function submit(e) {
+				e.preventDefault();
+				e.stopPropagation();
+				if (keyword.value !== l.Keyword && !window.confirm('Change keyword from "' + l.Keyword + '" to "' + keyword.value + '" on all messages?')) {
+					return;
+				}
+				if (name.value !== l.Name || keyword.value !== l.Keyword) {
+					await withStatus('Renaming label', client.LabelRename(l.ID, name.value, keyword.value), fieldset);
+				}
+				if (color.value !== (l.Color || defaultColor)) {
+					await withStatus('Changing label color', client.LabelColor(l.ID, color.value), fieldset);
+				}
+				accountLabels = await client.Labels() || [];
+				render();
+			}, fieldset = dom.fieldset(style({ marginBottom: '.5ex' }), color = dom.input(attr.type('color'), attr.value(l.Color || defaultColor), attr.title('Color of label.')), ' ', name = dom.input(attr.required(''), attr.value(l.Name), attr.title('Name of label, shown in webmail.')), ' ', keyword = dom.input(attr.required(''), attr.value(l.Keyword), attr.title('Keyword stored on messages, as seen by IMAP clients. Lower-case, ascii-only, without spaces and without the following special characters: (){%*"\].')), ' ', dom.submitbutton('Save'), ' ', dom.clickbutton('Remove', attr.title('Remove label and its keyword from all messages.'), async function click(e) {
+				if (!window.confirm('Remove label "' + l.Name + '" and remove its keyword from all messages?')) {
+					return;
+				}
+				await withStatus('Removing label', client.LabelDelete(l.ID), e.target);
+				accountLabels = await client.Labels() || [];
+				render();
+			})));
+		}));
+	};
+	render();
+	let fieldsetnew;
+	let newcolor;
+	let newname;
+	let newkeyword;
+	popup(style({ minWidth: '30em' }), dom.h1('Labels'), dom.div(style({ marginBottom: '1ex' }), 'Labels are keywords on messages, shown with a name and color. IMAP clients see the keywords.'), labelsElem, dom.br(), dom.form(async function submit(e) {
+		e.preventDefault();
+		e.stopPropagation();
+		await withStatus('Adding label', client.LabelCreate(newname.value, newkeyword.value, newcolor.value), fieldsetnew);
+		accountLabels = await client.Labels() || [];
+		render();
+		newname.value = '';
+		newkeyword.value = '';
+	}, fieldsetnew = dom.fieldset(newcolor = dom.input(attr.type('color'), attr.value(defaultColor), attr.title('Color of new label.')), ' ', newname = dom.input(attr.required(''), attr.placeholder('Name'), attr.title('Name of new label.')), ' ', newkeyword = dom.input(attr.placeholder('Keyword (optional)'), attr.title('Keyword for new label. If empty, the lower-cased name is used.')), ' ', dom.submitbutton('Add label'))));
+};
+// Show popup to export the selected messages as an archive with maildirs or mbox
+// files. The archive is downloaded in a new tab. The browser shows the progress of
+// the download, but does not know its size, so the popup shows the number of
+// exported messages while the archive is written.
+const cmdExport = (title, sel) => {
+	const progressID = Array.from(window.crypto.getRandomValues(new Uint8Array(16))).map(b => ('0' + b.toString(16)).slice(-2)).join('');
+	let form;
+	let progressElem;
+	// Poll for progress until the export is done or the popup is closed.
+	const poll = async () => {
+		while (progressElem.isConnected) {
+			await new Promise(resolve => window.setTimeout(resolve, 1000));
+			if (!progressElem.isConnected) {
+				break;
+			}
+			let p;
+			try {
+				p = await client.ExportProgress(progressID);
+			}
+			catch (err) {
+				dom._kids(progressElem, 'Error retrieving export progress: ' + errmsg(err));
+				break;
+			}
+			if (p.Error) {
+				dom._kids(progressElem, 'Export failed: ' + p.Error);
+				break;
+			}
+			else if (p.Done) {
+				dom._kids(progressElem, 'Export finished, ' + p.Total + ' message' + (p.Total === 1 ? '' : 's') + ' exported.');
+				break;
+			}
+			else if (p.Total > 0) {
+				dom._kids(progressElem, 'Exported ' + p.Exported + ' of ' + p.Total + ' messages...');
+			}
+		}
+	};
+	popup(dom.h1(title), form = dom.form(attr.target('_blank'), attr.method('POST'), attr.action('export'), function submit() {
+		// Hide after the form has been submitted.
+		window.setTimeout(() => {
+			form.style.display = 'none';
+			progressElem.style.display = '';
+			poll();
+		}, 0);
+	}, dom.input(attr.type('hidden'), attr.name('csrf'), attr.value(localStorageGet('webmailcsrftoken') || '')), dom.input(attr.type('hidden'), attr.name('messageids'), attr.value((sel.messageIDs || []).join(','))), dom.input(attr.type('hidden'), attr.name('threadids'), attr.value((sel.threadIDs || []).join(','))), dom.input(attr.type('hidden'), attr.name('mailboxids'), attr.value((sel.mailboxIDs || []).join(','))), dom.input(attr.type('hidden'), attr.name('progressid'), attr.value(progressID)), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div('Format'), dom.select(attr.name('format'), dom.option('Mbox, a file per mailbox', attr.value('mbox')), dom.option('Maildir, a directory per mailbox', attr.value('maildir')))), dom.label(style({ display: 'block', marginBottom: '1ex' }), dom.div('Archive'), dom.select(attr.name('archive'), dom.option('Zip', attr.value('zip')), dom.option('Tar, gzip-compressed', attr.value('tgz')))), dom.div(style({ marginBottom: '1ex', fontStyle: 'italic' }), 'Flags and labels are included as keywords.'), dom.submitbutton('Export')), progressElem = dom.div(style({ display: 'none' }), 'Preparing export...'));
+	form.querySelector('select').focus();
+};
+// Show the address book in a popup, with contacts that can be added, edited and
+// removed, and written to. Contacts are also synchronized with CardDAV clients.
+const cmdContacts = async () => {
+	let contacts = await withStatus('Listing contacts', client.ContactList());
+	const lines = (s) => s.split('\n').map(s => s.trim()).filter(s => !!s);
+	const addressee = (c, email) => {
+		let name = c.Name;
+		if (/[()<>\[\]:;@\\,."]/.test(name)) {
+			name = '"' + name.replace(/["\\]/g, s => '\\' + s) + '"';
+		}
+		return name + ' <' + email + '>';
+	};
+	let searchElem;
+	let listElem;
+	let editElem;
+	const render = () => {
+		const s = searchElem.value.toLowerCase();
+		const l = contacts.filter(c => !s || c.Name.toLowerCase().includes(s) || (c.Emails || []).some(e => e.toLowerCase().includes(s)));
+		dom._kids(listElem, l.length === 0 ? dom.div(style({ padding: '1ex 0' }), contacts.length === 0 ? 'No contacts yet.' : 'No matching contacts.') : dom.table(dom.tbody(l.map(c => dom.tr(dom.td(dom.a(attr.href('#'), c.Name, function click(e) {
+			e.preventDefault();
+			edit(c);
+		})), dom.td((c.Emails || []).join(', ')), dom.td((c.Phones || []).join(', ')), dom.td((c.Emails || []).length === 0 ? [] : dom.clickbutton('Compose', attr.title('Compose a message to the first email address of this contact.'), function click() {
+			remove();
+			compose({ to: [addressee(c, (c.Emails || [])[0])] });
+		})))))));
+	};
+	const edit = (c) => {
+		let fieldset;
+		let name;
+		let emails;
+		let phones;
+		let note;
+		const done = () => {
+			dom._kids(editElem);
+			render();
+			searchElem.focus();
+		};
+		dom._kids(editElem, dom.form(style({ marginTop: '1em', paddingTop: '1ex', borderTop: '1px solid #ddd' }), async function submit(e) {
+			e.preventDefault();
+			e.stopPropagation();
+			const nc = await withStatus('Saving contact', client.ContactSave({ ID: c.ID, Name: name.value, Emails: lines(emails.value), Phones: lines(phones.value), Note: note.value }), fieldset);
+			contacts = [...contacts.filter(x => x.ID !== nc.ID), nc].sort((a, b) => a.Name.localeCompare(b.Name));
+			done();
+		}, fieldset = dom.fieldset(dom.h2(c.ID ? 'Edit contact' : 'New contact'), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Name', dom.br(), name = dom.input(attr.value(c.Name), attr.required(''), style({ width: '100%' }))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Email addresses, one per line', dom.br(), emails = dom.textarea(attr.rows('3'), style({ width: '100%' }), (c.Emails || []).join('\n'))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Phone numbers, one per line', dom.br(), phones = dom.textarea(attr.rows('2'), style({ width: '100%' }), (c.Phones || []).join('\n'))), dom.label(style({ display: 'block', marginBottom: '1ex' }), 'Note', dom.br(), note = dom.textarea(attr.rows('3'), style({ width: '100%' }), c.Note)), dom.div(dom.submitbutton('Save'), ' ', c.ID ? [
+			dom.clickbutton('Delete', async function click() {
+				if (!window.confirm('Are you sure you want to delete this contact?')) {
+					return;
+				}
+				await withStatus('Deleting contact', client.ContactDelete(c.ID), fieldset);
+				contacts = contacts.filter(x => x.ID !== c.ID);
+				done();
+			}), ' ',
+		] : [], dom.clickbutton('Cancel', function click() {
+			done();
+		})))));
+		name.focus();
+	};
+	const remove = popup(style({ minWidth: '40em', maxWidth: '60em' }), dom.h1('Contacts'), dom.p(style({ color: '#888' }), 'Contacts are suggested when composing messages, and can be synchronized with other devices over CardDAV.'), dom.div(style({ display: 'flex', gap: '.5em', marginBottom: '1ex' }), searchElem = dom.input(attr.placeholder('Search...'), style({ flexGrow: '1' }), function input() {
+		render();
+	}), dom.clickbutton('New contact', function click() {
+		edit({ ID: 0, Name: '', Emails: [], Phones: [], Note: '' });
+	})), listElem = dom.div(), editElem = dom.div());
+	render();
+	searchElem.focus();
+};
 let composeView = null;
+// Notice with a button to undo sending a message that was submitted with a send
+// delay. Shown until the undo window closes. Only for the most recent submission.
+let submitUndoElem = null;
+let submitUndoID = 0;
+const submitUndoHide = (undoID) => {
+	if (undoID !== submitUndoID || !submitUndoElem) {
+		return;
+	}
+	submitUndoElem.remove();
+	submitUndoElem = null;
+	submitUndoID = 0;
+};
+// Show notice for a submission that can be undone. On undo, the message is opened
+// as draft in a new composer, with from as From address.
+const submitUndoShow = (r, from) => {
+	submitUndoHide(submitUndoID);
+	const undoID = r.UndoID;
+	submitUndoID = undoID;
+	submitUndoElem = dom.div(style({ position: 'fixed', bottom: '1ex', left: '50%', transform: 'translateX(-50%)', zIndex: zindexes.compose, backgroundColor: '#ffffaa', border: '1px solid #ccc', boxShadow: '0px 0px 20px rgba(0, 0, 0, 0.1)', padding: '.5em 1em', borderRadius: '.25em' }), 'Message sent. ', dom.clickbutton('Undo', attr.title('Remove the message from the delivery queue and open it as draft again.'), async function click(e) {
+		const draftID = await withStatus('Undoing send', client.MessageSubmitUndo(undoID), e.target);
+		submitUndoHide(undoID);
+		const sm = await withStatus('Opening draft', client.MessageDraftOpen(draftID));
+		compose({
+			from: from,
+			to: sm.To || [],
+			cc: sm.Cc || [],
+			bcc: sm.Bcc || [],
+			replyto: sm.ReplyTo,
+			subject: sm.Subject,
+			body: sm.TextBody,
+			htmlBody: sm.HTMLBody || undefined,
+			responseMessageID: sm.ResponseMessageID,
+			draftMessageID: sm.DraftMessageID,
+			draftAttachments: sm.Attachments || [],
+			requireTLS: sm.RequireTLS,
+		});
+	}));
+	document.body.appendChild(submitUndoElem);
+	// The server sends a ChangeSubmissionUndoEnd when the undo window closes, but the
+	// connection may be down at that moment.
+	window.setTimeout(() => submitUndoHide(undoID), r.UndoUntil.getTime() - new Date().getTime());
+};
 const compose = (opts) => {
+	// New messages start with the signature.
+	if (opts.body === undefined && opts.htmlBody === undefined && !opts.draftMessageID && signatureBlock()) {
+		opts = { ...opts, body: '\n\n' + signatureBlock() };
+	}
 	log('compose', opts);
 	if (composeView) {
 		// todo: should allow multiple
@@ -2207,6 +2858,9 @@ const compose = (opts) => {
 	let subjectAutosize;
 	let subject;
 	let body;
+	let htmlEditor;
+	let htmlToolbar;
+	let htmlImage;
 	let attachments;
 	let requiretls;
 	let toBtn, ccBtn, bccBtn, replyToBtn, customFromBtn;
@@ -2214,11 +2868,32 @@ const compose = (opts) => {
 	let toRow, replyToRow, ccRow, bccRow; // We show/hide rows as needed.
 	let toViews = [], replytoViews = [], ccViews = [], bccViews = [];
 	let forwardAttachmentViews = [];
-	const cmdCancel = async () => {
+	let draftAttachmentViews = [];
+	let draftStatus;
+	let draftMessageID = opts.draftMessageID || 0;
+	let draftSaved = ''; // JSON of message as last saved, to only save when changed.
+	let draftSaving = false;
+	// Random ID for this message, so it is sent only once, also when a submission is
+	// retried by the service worker.
+	const submitID = Array.from(window.crypto.getRandomValues(new Uint8Array(16))).map(b => ('0'+b.toString(16)).slice(-2)).join('');
+	let closed = false;
+	let htmlMode = !!opts.htmlBody;
+	const close = () => {
+		closed = true;
+		window.clearInterval(autosaveID);
 		composeElem.remove();
 		composeView = null;
 	};
-	const submit = async () => {
+	const cmdCancel = async () => {
+		if (draftMessageID) {
+			if (!window.confirm('Discard message and remove its draft?')) {
+				return;
+			}
+			await withStatus('Removing draft', client.MessageDraftDelete(draftMessageID));
+		}
+		close();
+	};
+	const composedMessage = async () => {
 		const files = await new Promise((resolve, reject) => {
 			const l = [];
 			if (attachments.files && attachments.files.length === 0) {
@@ -2243,6 +2918,7 @@ const compose = (opts) => {
 		if (replytoViews && replytoViews.length === 1 && replytoViews[0].input.value) {
 			replyTo = replytoViews[0].input.value;
 		}
+		files.push(...draftAttachmentViews.filter(v => v.checkbox.checked).map(v => v.file));
 		const forwardAttachmentPaths = forwardAttachmentViews.filter(v => v.checkbox.checked).map(v => v.path);
 		const message = {
 			From: customFrom ? customFrom.value : from.value,
@@ -2252,19 +2928,129 @@ const compose = (opts) => {
 			ReplyTo: replyTo,
 			UserAgent: 'beaconwebmail/' + beaconversion,
 			Subject: subject.value,
-			TextBody: body.value,
+			TextBody: htmlMode ? '' : body.value,
+			HTMLBody: htmlMode ? htmlEditor.innerHTML : '',
 			Attachments: files,
 			ForwardAttachments: forwardAttachmentPaths.length === 0 ? { MessageID: 0, Paths: [] } : { MessageID: opts.attachmentsMessageItem.Message.ID, Paths: forwardAttachmentPaths },
 			IsForward: opts.isForward || false,
 			ResponseMessageID: opts.responseMessageID || 0,
 			RequireTLS: requiretls.value === '' ? null : requiretls.value === 'yes',
+			DraftMessageID: 0,
+			SubmitID: '',
 		};
-		await client.MessageSubmit(message);
-		cmdCancel();
+		return message;
+	};
+	const submit = async () => {
+		draftSaving = true; // Prevent autosave while sending.
+		let result;
+		let fromAddr;
+		try {
+			const message = await composedMessage();
+			message.DraftMessageID = draftMessageID;
+			message.SubmitID = submitID;
+			fromAddr = accountAddresses.find(a => formatAddressFull(a) === message.From);
+			result = await client.MessageSubmit(message);
+		}
+		finally {
+			draftSaving = false;
+		}
+		close();
+		if (result.UndoID) {
+			submitUndoShow(result, fromAddr ? [fromAddr] : opts.from);
+		}
+	};
+	// Save message as draft, replacing the previous draft, if it changed since the
+	// last save.
+	const saveDraft = async () => {
+		if (draftSaving) {
+			return;
+		}
+		draftSaving = true;
+		try {
+			const message = await composedMessage();
+			const s = JSON.stringify(message);
+			if (s === draftSaved) {
+				return;
+			}
+			message.DraftMessageID = draftMessageID;
+			draftMessageID = await client.MessageDraftSave(message);
+			draftSaved = s;
+			dom._kids(draftStatus, 'Draft saved at ' + new Date().toLocaleTimeString() + '.');
+		}
+		finally {
+			draftSaving = false;
+		}
 	};
+	const autosaveID = window.setInterval(async () => {
+		if (closed) {
+			return;
+		}
+		try {
+			await saveDraft();
+		}
+		catch (err) {
+			dom._kids(draftStatus, 'Error saving draft: ' + errmsg(err));
+		}
+	}, 30 * 1000);
 	const cmdSend = async () => {
 		await withStatus('Sending email', submit(), fieldset);
 	};
+	const cmdSaveDraft = async () => {
+		await withStatus('Saving draft', saveDraft(), fieldset);
+		close();
+	};
+	// Text of the message, for checking mentions of attachments.
+	const bodyText = () => htmlMode ? htmlEditor.innerText : body.value;
+	const showHTMLMode = () => {
+		body.style.display = htmlMode ? 'none' : '';
+		htmlToolbar.style.display = htmlMode ? '' : 'none';
+		htmlEditor.style.display = htmlMode ? '' : 'none';
+	};
+	// Switch between composing plain text and HTML. Formatting is lost when
+	// switching to plain text.
+	const cmdToggleHTML = async () => {
+		if (htmlMode) {
+			if (!window.confirm('Switch to plain text? Formatting and inline images are removed.')) {
+				return;
+			}
+			body.value = htmlEditor.innerText;
+			htmlMode = false;
+		}
+		else {
+			dom._kids(htmlEditor, body.value.split('\n').map((line, i) => [i > 0 ? dom.br() : [], new String(line)]));
+			htmlMode = true;
+		}
+		showHTMLMode();
+		if (htmlMode) {
+			htmlEditor.focus();
+		}
+		else {
+			body.focus();
+		}
+	};
+	const htmlCommand = (command, value) => {
+		htmlEditor.focus();
+		document.execCommand(command, false, value);
+	};
+	const cmdHTMLLink = async () => {
+		const url = window.prompt('Link to URL', 'https://');
+		if (url && url !== 'https://') {
+			htmlCommand('createLink', url);
+		}
+	};
+	// Insert image files as data URIs, they are sent as inline parts.
+	const insertImages = (files) => {
+		for (const f of files) {
+			if (!f.type.startsWith('image/')) {
+				continue;
+			}
+			const fr = new window.FileReader();
+			fr.addEventListener('load', () => {
+				htmlCommand('insertImage', fr.result);
+			});
+			fr.readAsDataURL(f);
+		}
+	};
 	const cmdAddTo = async () => { newAddrView('', true, toViews, toBtn, toCell, toRow); };
 	const cmdAddCc = async () => { newAddrView('', true, ccViews, ccBtn, ccCell, ccRow); };
 	const cmdAddBcc = async () => { newAddrView('', true, bccViews, bccBtn, bccCell, bccRow); };
@@ -2279,11 +3065,13 @@ const compose = (opts) => {
 	};
 	const shortcuts = {
 		'ctrl Enter': cmdSend,
+		'ctrl s': cmdSaveDraft,
 		'ctrl w': cmdCancel,
 		'ctrl O': cmdAddTo,
 		'ctrl C': cmdAddCc,
 		'ctrl B': cmdAddBcc,
 		'ctrl Y': cmdReplyTo,
+		'ctrl H': cmdToggleHTML,
 		// ctrl - and ctrl = (+) not included, they are handled by keydown handlers on in the inputs they remove/add.
 	};
 	const newAddrView = (addr, isRecipient, views, btn, cell, row, single) => {
@@ -2446,7 +3234,7 @@ const compose = (opts) => {
 	};
 	let noAttachmentsWarning;
 	const checkAttachments = () => {
-		const missingAttachments = !attachments.files?.length && !forwardAttachmentViews.find(v => v.checkbox.checked) && !!body.value.split('\n').find(s => !s.startsWith('>') && s.match(/attach(ed|ment)/));
+		const missingAttachments = !attachments.files?.length && !forwardAttachmentViews.find(v => v.checkbox.checked) && !draftAttachmentViews.find(v => v.checkbox.checked) && !!bodyText().split('\n').find(s => !s.startsWith('>') && s.match(/attach(ed|ment)/));
 		noAttachmentsWarning.style.display = missingAttachments ? '' : 'none';
 	};
 	const normalizeUser = (a) => {
@@ -2469,7 +3257,8 @@ const compose = (opts) => {
 	};
 	let haveFrom = false;
 	const fromOptions = accountAddresses.map(a => {
-		const selected = opts.from && opts.from.length === 1 && equalAddress(a, opts.from[0]) || loginAddress && equalAddress(a, loginAddress) && (!opts.from || envelopeIdentity(opts.from));
+		const isDefault = accountSettings.DefaultFrom ? formatAddress(a) === accountSettings.DefaultFrom : loginAddress && equalAddress(a, loginAddress);
+		const selected = opts.from && opts.from.length === 1 && equalAddress(a, opts.from[0]) || isDefault && (!opts.from || envelopeIdentity(opts.from));
 		const o = dom.option(formatAddressFull(a), selected ? attr.selected('') : []);
 		if (selected) {
 			haveFrom = true;
@@ -2496,16 +3285,47 @@ const compose = (opts) => {
 		minWidth: '40em',
 		maxWidth: '95vw',
 		borderRadius: '.25em',
-	}), dom.form(fieldset = dom.fieldset(dom.table(style({ width: '100%' }), dom.tr(dom.td(style({ textAlign: 'right', color: '#555' }), dom.span('From:')), dom.td(dom.clickbutton('Cancel', style({ float: 'right', marginLeft: '1em', marginTop: '.15em' }), attr.title('Close window, discarding message.'), clickCmd(cmdCancel, shortcuts)), from = dom.select(attr.required(''), style({ width: 'auto' }), fromOptions), ' ', toBtn = dom.clickbutton('To', clickCmd(cmdAddTo, shortcuts)), ' ', ccBtn = dom.clickbutton('Cc', clickCmd(cmdAddCc, shortcuts)), ' ', bccBtn = dom.clickbutton('Bcc', clickCmd(cmdAddBcc, shortcuts)), ' ', replyToBtn = dom.clickbutton('ReplyTo', clickCmd(cmdReplyTo, shortcuts)), ' ', customFromBtn = dom.clickbutton('From', attr.title('Set custom From address/name.'), clickCmd(cmdCustomFrom, shortcuts)))), toRow = dom.tr(dom.td('To:', style({ textAlign: 'right', color: '#555' })), toCell = dom.td(style({ lineHeight: '1.5' }))), replyToRow = dom.tr(dom.td('Reply-To:', style({ textAlign: 'right', color: '#555' })), replyToCell = dom.td(style({ lineHeight: '1.5' }))), ccRow = dom.tr(dom.td('Cc:', style({ textAlign: 'right', color: '#555' })), ccCell = dom.td(style({ lineHeight: '1.5' }))), bccRow = dom.tr(dom.td('Bcc:', style({ textAlign: 'right', color: '#555' })), bccCell = dom.td(style({ lineHeight: '1.5' }))), dom.tr(dom.td('Subject:', style({ textAlign: 'right', color: '#555' })), dom.td(subjectAutosize = dom.span(dom._class('autosize'), style({ width: '100%' }), // Without 100% width, the span takes minimal width for input, we want the full table cell.
+	}), dom.form(fieldset = dom.fieldset(dom.table(style({ width: '100%' }), dom.tr(dom.td(style({ textAlign: 'right', color: '#555' }), dom.span('From:')), dom.td(dom.clickbutton('Cancel', style({ float: 'right', marginLeft: '1em', marginTop: '.15em' }), attr.title('Close window, discarding message and removing its draft.'), clickCmd(cmdCancel, shortcuts)), from = dom.select(attr.required(''), style({ width: 'auto' }), fromOptions), ' ', toBtn = dom.clickbutton('To', clickCmd(cmdAddTo, shortcuts)), ' ', ccBtn = dom.clickbutton('Cc', clickCmd(cmdAddCc, shortcuts)), ' ', bccBtn = dom.clickbutton('Bcc', clickCmd(cmdAddBcc, shortcuts)), ' ', replyToBtn = dom.clickbutton('ReplyTo', clickCmd(cmdReplyTo, shortcuts)), ' ', customFromBtn = dom.clickbutton('From', attr.title('Set custom From address/name.'), clickCmd(cmdCustomFrom, shortcuts)))), toRow = dom.tr(dom.td('To:', style({ textAlign: 'right', color: '#555' })), toCell = dom.td(style({ lineHeight: '1.5' }))), replyToRow = dom.tr(dom.td('Reply-To:', style({ textAlign: 'right', color: '#555' })), replyToCell = dom.td(style({ lineHeight: '1.5' }))), ccRow = dom.tr(dom.td('Cc:', style({ textAlign: 'right', color: '#555' })), ccCell = dom.td(style({ lineHeight: '1.5' }))), bccRow = dom.tr(dom.td('Bcc:', style({ textAlign: 'right', color: '#555' })), bccCell = dom.td(style({ lineHeight: '1.5' }))), dom.tr(dom.td('Subject:', style({ textAlign: 'right', color: '#555' })), dom.td(subjectAutosize = dom.span(dom._class('autosize'), style({ width: '100%' }), // Without 100% width, the span takes minimal width for input, we want the full table cell.
 	subject = dom.input(style({ width: '100%' }), attr.value(opts.subject || ''), attr.required(''), focusPlaceholder('subject...'), function input() {
 		subjectAutosize.dataset.value = subject.value;
 	}))))), body = dom.textarea(dom._class('mono'), attr.rows('15'), style({ width: '100%' }), 
 	// Explicit string object so it doesn't get the highlight-unicode-block-changes
 	// treatment, which would cause characters to disappear.
-	new String(opts.body || ''), opts.body && !opts.isForward && !opts.body.startsWith('\n\n') ? prop({ selectionStart: opts.body.length, selectionEnd: opts.body.length }) : [], function keyup(e) {
+	new String(opts.body || ''), opts.bodyCursor !== undefined ? prop({ selectionStart: opts.bodyCursor, selectionEnd: opts.bodyCursor }) : (opts.body && !opts.isForward && !opts.body.startsWith('\n\n') ? prop({ selectionStart: opts.body.length, selectionEnd: opts.body.length }) : []), function keyup(e) {
 		if (e.key === 'Enter') {
 			checkAttachments();
 		}
+	}), htmlToolbar = dom.div(style({ margin: '.25em 0' }), dom.clickbutton(dom.b('B'), attr.title('Bold.'), function click() { htmlCommand('bold'); }), ' ', dom.clickbutton(dom.span('I', style({ fontStyle: 'italic' })), attr.title('Italic.'), function click() { htmlCommand('italic'); }), ' ', dom.clickbutton(dom.span('U', style({ textDecoration: 'underline' })), attr.title('Underline.'), function click() { htmlCommand('underline'); }), ' ', dom.clickbutton('List', attr.title('Bulleted list.'), function click() { htmlCommand('insertUnorderedList'); }), ' ', dom.clickbutton('1. List', attr.title('Numbered list.'), function click() { htmlCommand('insertOrderedList'); }), ' ', dom.clickbutton('Quote', attr.title('Quote text.'), function click() { htmlCommand('formatBlock', 'blockquote'); }), ' ', dom.clickbutton('Link', attr.title('Make a link of the selected text.'), clickCmd(cmdHTMLLink, shortcuts)), ' ', dom.clickbutton('Image', attr.title('Insert an image, sent as part of the message.'), function click() { htmlImage.click(); }), ' ', dom.clickbutton('Clear', attr.title('Remove formatting from the selected text.'), function click() { htmlCommand('removeFormat'); }), htmlImage = dom.input(attr.type('file'), attr.multiple(''), style({ display: 'none' }), function change() {
+		insertImages([...(htmlImage.files || [])]);
+		htmlImage.value = '';
+	})), htmlEditor = dom.div(dom._attrs({ contenteditable: 'true' }), style({ width: '100%', minHeight: '20em', maxHeight: '60vh', overflowY: 'auto', border: '1px solid #ccc', padding: '.25em', boxSizing: 'border-box' }), function keyup(e) {
+		if (e.key === 'Enter') {
+			checkAttachments();
+		}
+	}, function paste(e) {
+		const files = [...(e.clipboardData?.files || [])].filter(f => f.type.startsWith('image/'));
+		if (files.length > 0) {
+			e.preventDefault();
+			insertImages(files);
+			return;
+		}
+		const pastedHTML = e.clipboardData?.getData('text/html');
+		const sel = window.getSelection();
+		if (pastedHTML && sel && sel.rangeCount > 0) {
+			e.preventDefault();
+			const range = sel.getRangeAt(0);
+			range.deleteContents();
+			const frag = document.createDocumentFragment();
+			frag.append(...sanitizeEditHTML(pastedHTML));
+			const last = frag.lastChild;
+			range.insertNode(frag);
+			if (last) {
+				range.setStartAfter(last);
+				range.collapse(true);
+				sel.removeAllRanges();
+				sel.addRange(range);
+			}
+		}
 	}), !(opts.attachmentsMessageItem && opts.attachmentsMessageItem.Attachments && opts.attachmentsMessageItem.Attachments.length > 0) ? [] : dom.div(style({ margin: '.5em 0' }), 'Forward attachments: ', forwardAttachmentViews = (opts.attachmentsMessageItem?.Attachments || []).map(a => {
 		const filename = a.Filename || '(unnamed)';
 		const size = formatSize(a.Part.DecodedSize);
@@ -2519,11 +3339,24 @@ const compose = (opts) => {
 		return v;
 	}), dom.label(style({ color: '#666' }), dom.input(attr.type('checkbox'), function change(e) {
 		forwardAttachmentViews.forEach(v => v.checkbox.checked = e.target.checked);
-	}), ' (Toggle all)')), noAttachmentsWarning = dom.div(style({ display: 'none', backgroundColor: '#fcd284', padding: '0.15em .25em', margin: '.5em 0' }), 'Message mentions attachments, but no files are attached.'), dom.label(style({ margin: '1ex 0', display: 'block' }), 'Attachments ', attachments = dom.input(attr.type('file'), attr.multiple(''), function change() { checkAttachments(); })), dom.label(style({ margin: '1ex 0', display: 'block' }), attr.title('How to use TLS for message delivery over SMTP:\n\nDefault: Delivery attempts follow the policies published by the recipient domain: Verification with MTA-STS and/or DANE, or optional opportunistic unverified STARTTLS if the domain does not specify a policy.\n\nWith RequireTLS: For sensitive messages, you may want to require verified TLS. The recipient destination domain SMTP server must support the REQUIRETLS SMTP extension for delivery to succeed. It is automatically chosen when the destination domain mail servers of all recipients are known to support it.\n\nFallback to insecure: If delivery fails due to MTA-STS and/or DANE policies specified by the recipient domain, and the content is not sensitive, you may choose to ignore the recipient domain TLS policies so delivery can succeed.'), 'TLS ', requiretls = dom.select(dom.option(attr.value(''), 'Default'), dom.option(attr.value('yes'), 'With RequireTLS'), dom.option(attr.value('no'), 'Fallback to insecure'))), dom.div(style({ margin: '3ex 0 1ex 0', display: 'block' }), dom.submitbutton('Send'))), async function submit(e) {
+	}), ' (Toggle all)')), !(opts.draftAttachments && opts.draftAttachments.length > 0) ? [] : dom.div(style({ margin: '.5em 0' }), 'Draft attachments: ', draftAttachmentViews = opts.draftAttachments.map(f => {
+		const checkbox = dom.input(attr.type('checkbox'), attr.checked(''), function change() { checkAttachments(); });
+		const root = dom.label(checkbox, ' ' + (f.Filename || '(unnamed)') + ' ');
+		const v = {
+			root: root,
+			file: f,
+			checkbox: checkbox,
+		};
+		return v;
+	})), noAttachmentsWarning = dom.div(style({ display: 'none', backgroundColor: '#fcd284', padding: '0.15em .25em', margin: '.5em 0' }), 'Message mentions attachments, but no files are attached.'), dom.label(style({ margin: '1ex 0', display: 'block' }), 'Attachments ', attachments = dom.input(attr.type('file'), attr.multiple(''), function change() { checkAttachments(); })), dom.label(style({ margin: '1ex 0', display: 'block' }), attr.title('How to use TLS for message delivery over SMTP:\n\nDefault: Delivery attempts follow the policies published by the recipient domain: Verification with MTA-STS and/or DANE, or optional opportunistic unverified STARTTLS if the domain does not specify a policy.\n\nWith RequireTLS: For sensitive messages, you may want to require verified TLS. The recipient destination domain SMTP server must support the REQUIRETLS SMTP extension for delivery to succeed. It is automatically chosen when the destination domain mail servers of all recipients are known to support it.\n\nFallback to insecure: If delivery fails due to MTA-STS and/or DANE policies specified by the recipient domain, and the content is not sensitive, you may choose to ignore the recipient domain TLS policies so delivery can succeed.'), 'TLS ', requiretls = dom.select(dom.option(attr.value(''), 'Default'), dom.option(attr.value('yes'), 'With RequireTLS'), dom.option(attr.value('no'), 'Fallback to insecure'))), dom.div(style({ margin: '3ex 0 1ex 0', display: 'block' }), dom.submitbutton('Send'), ' ', dom.clickbutton('Save draft', attr.title('Save message as draft in the Drafts mailbox and close window. Drafts are also saved automatically while composing.'), clickCmd(cmdSaveDraft, shortcuts)), ' ', dom.clickbutton('HTML', attr.title('Switch between composing plain text and formatted HTML, with inline images.'), clickCmd(cmdToggleHTML, shortcuts)), ' ', draftStatus = dom.span(style({ color: '#666' })))), async function submit(e) {
 		e.preventDefault();
 		shortcutCmd(cmdSend, shortcuts);
 	}));
 	subjectAutosize.dataset.value = subject.value;
+	if (opts.htmlBody) {
+		htmlEditor.append(...sanitizeEditHTML(opts.htmlBody));
+	}
+	showHTMLMode();
 	(opts.to && opts.to.length > 0 ? opts.to : ['']).forEach(s => newAddrView(s, true, toViews, toBtn, toCell, toRow));
 	(opts.cc || []).forEach(s => newAddrView(s, true, ccViews, ccBtn, ccCell, ccRow));
 	(opts.bcc || []).forEach(s => newAddrView(s, true, bccViews, bccBtn, bccCell, bccRow));
@@ -2539,19 +3372,117 @@ const compose = (opts) => {
 	if (!opts.replyto) {
 		replyToRow.style.display = 'none';
 	}
+	if (opts.requireTLS !== undefined && opts.requireTLS !== null) {
+		requiretls.value = opts.requireTLS ? 'yes' : 'no';
+	}
 	document.body.appendChild(composeElem);
 	if (toViews.length > 0 && !toViews[0].input.value) {
 		toViews[0].input.focus();
 	}
+	else if (htmlMode) {
+		htmlEditor.focus();
+	}
 	else {
 		body.focus();
 	}
+	// Only save a draft once the message has changed.
+	composedMessage().then(m => { draftSaved = JSON.stringify(m); });
 	composeView = {
 		root: composeElem,
 		key: keyHandler(shortcuts),
 	};
 	return composeView;
 };
+// Elements and attributes allowed in HTML in the compose editor, which is part of
+// the webmail page, not an isolated frame. Like sanitizeEditNode on the server.
+// Other elements are replaced by their children, or removed with their children
+// if in editDropElements.
+const editElements = new Set([
+	'a', 'abbr', 'address', 'article', 'aside', 'b', 'big', 'blockquote', 'br',
+	'caption', 'center', 'cite', 'code', 'col', 'colgroup', 'dd', 'del', 'div',
+	'dl', 'dt', 'em', 'figcaption', 'figure', 'font', 'footer', 'h1', 'h2',
+	'h3', 'h4', 'h5', 'h6', 'header', 'hr', 'i', 'img', 'ins', 'li',
+	'main', 'mark', 'nav', 'ol', 'p', 'pre', 'q', 's', 'section', 'small',
+	'span', 'strike', 'strong', 'sub', 'sup', 'table', 'tbody', 'td', 'tfoot',
+	'th', 'thead', 'tr', 'tt', 'u', 'ul',
+]);
+const editDropElements = new Set([
+	'head', 'script', 'style', 'template', 'iframe', 'frame', 'frameset', 'object',
+	'embed', 'applet', 'noscript', 'noembed', 'noframes', 'svg', 'math', 'title',
+	'meta', 'link', 'base', 'textarea', 'select', 'option', 'audio', 'video',
+	'source', 'track', 'canvas', 'map', 'area', 'input', 'button', 'dialog',
+]);
+const editAttributes = new Set([
+	'align', 'alt', 'bgcolor', 'border', 'cellpadding', 'cellspacing', 'color',
+	'colspan', 'dir', 'face', 'height', 'href', 'lang', 'rowspan', 'size',
+	'span', 'src', 'start', 'style', 'title', 'type', 'valign', 'value', 'width',
+]);
+// editAttributeOK returns whether an attribute is allowed in the compose editor.
+// Links must be http, https or mailto URLs, images must be inline data: URIs, and
+// styles cannot reference external resources.
+const editAttributeOK = (name, value) => {
+	if (!editAttributes.has(name)) {
+		return false;
+	}
+	// Browsers ignore control characters and spaces in URLs, e.g. in "java\tscript:".
+	const v = value.replace(/[\u0000-\u0020]/g, '').toLowerCase();
+	if (name === 'href') {
+		return v.startsWith('http:') || v.startsWith('https:') || v.startsWith('mailto:');
+	}
+	else if (name === 'src') {
+		return v.startsWith('data:image/');
+	}
+	else if (name === 'style') {
+		return !v.includes('url(') && !v.includes('image-set(') && !v.includes('expression(') && !v.includes('@import') && !v.includes('\\');
+	}
+	return true;
+};
+// sanitizeEditHTML parses html in an inert document, and returns new nodes with
+// only the allowed elements and attributes, for inserting in the compose editor.
+// The parsed nodes themselves are never inserted, and the result isn't parsed
+// again.
+const sanitizeEditHTML = (html) => {
+	const doc = new DOMParser().parseFromString(html, 'text/html');
+	const copy = (n) => {
+		if (n.nodeType === Node.TEXT_NODE) {
+			return [document.createTextNode(n.textContent || '')];
+		}
+		else if (n.nodeType !== Node.ELEMENT_NODE) {
+			return [];
+		}
+		const e = n;
+		const name = e.localName;
+		if (e.namespaceURI !== 'http://www.w3.org/1999/xhtml' || editDropElements.has(name)) {
+			return [];
+		}
+		const kids = [...e.childNodes].flatMap(c => copy(c));
+		if (!editElements.has(name)) {
+			return kids;
+		}
+		const ne = document.createElement(name);
+		for (const a of [...e.attributes]) {
+			if (!a.namespaceURI && editAttributeOK(a.name, a.value)) {
+				ne.setAttribute(a.name, a.value);
+			}
+		}
+		if (name === 'a') {
+			ne.setAttribute('target', '_blank');
+			ne.setAttribute('rel', 'noopener noreferrer');
+		}
+		ne.append(...kids);
+		return [ne];
+	};
+	return [...doc.body.childNodes].flatMap(c => copy(c));
+};
+// Fetch the HTML of a message for quoting in a reply, sanitized for the compose
+// editor. Images other than inline images are removed.
+const quoteHTML = async (msgID) => {
+	const resp = await fetch('msg/' + msgID + '/html');
+	if (!resp.ok) {
+		throw new Error('fetching html: ' + resp.statusText);
+	}
+	return sanitizeEditHTML(await resp.text());
+};
 // Show popover to edit labels for msgs.
 const labelsPopover = (e, msgs, possibleLabels) => {
 	if (msgs.length === 0) {
@@ -2571,7 +3502,7 @@ const labelsPopover = (e, msgs, possibleLabels) => {
 			await withStatus('Adding label', client.FlagsAdd(msgIDs, [l]), e.target);
 			activeLabels.push(l);
 		}
-	}), ' ', dom.span(dom._class('keyword'), l))))), dom.hr(style({ margin: '2ex 0' })), dom.form(async function submit(e) {
+	}), ' ', dom.span(dom._class('keyword'), keywordKids(l)))))), dom.hr(style({ margin: '2ex 0' })), dom.form(async function submit(e) {
 		e.preventDefault();
 		await withStatus('Adding new label', client.FlagsAdd(msgIDs, [newlabel.value]), fieldsetnew);
 		remove();
@@ -2673,7 +3604,7 @@ const newMsgitemView = (mi, msglistView, otherMailbox, listMailboxes, receivedTi
 		// Keywords are normally shown per message. For collapsed threads, we show the
 		// keywords of the thread root message as normal, and any additional keywords from
 		// children in a way that draws less attention.
-		const keywords = (m.Keywords || []).map(kw => dom.span(dom._class('keyword'), kw));
+		const keywords = (m.Keywords || []).map(kw => dom.span(dom._class('keyword'), keywordKids(kw)));
 		if (msgitemView.isCollapsedThreadRoot()) {
 			const keywordsSeen = new Set();
 			for (const kw of (m.Keywords || [])) {
@@ -2683,7 +3614,7 @@ const newMsgitemView = (mi, msglistView, otherMailbox, listMailboxes, receivedTi
 				for (const kw of (miv.messageitem.Message.Keywords || [])) {
 					if (!keywordsSeen.has(kw)) {
 						keywordsSeen.add(kw);
-						keywords.push(dom.span(dom._class('keyword'), dom._class('keywordcollapsed'), kw));
+						keywords.push(dom.span(dom._class('keyword'), dom._class('keywordcollapsed'), keywordKids(kw)));
 					}
 				}
 			}
@@ -2992,23 +3923,47 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 			body = pm.Texts[0];
 		}
 		body = body.replace(/\r/g, '').replace(/\n\n\n\n*/g, '\n\n').trim();
+		const sig = signatureBlock();
+		let htmlBody;
+		let bodyCursor;
 		if (forward) {
-			body = '\n\n---- Forwarded Message ----\n\n' + body;
+			body = '\n\n' + (sig ? sig + '\n' : '') + '---- Forwarded Message ----\n\n' + body;
 		}
 		else {
 			body = body.split('\n').map(line => '> ' + line).join('\n');
-			if (haveSel) {
-				body += '\n\n';
+			let onWroteLine = '';
+			if (!haveSel && mi.Envelope.Date && mi.Envelope.From && mi.Envelope.From.length === 1) {
+				const from = mi.Envelope.From[0];
+				const name = from.Name || formatEmailAddress(from);
+				const datetime = mi.Envelope.Date.toLocaleDateString(undefined, { weekday: "short", year: "numeric", month: "short", day: "numeric" }) + ' at ' + mi.Envelope.Date.toLocaleTimeString();
+				onWroteLine = 'On ' + datetime + ', ' + name + ' wrote:\n';
+			}
+			// By default, we write below selected text, and above the full message.
+			if (accountSettings.Quoting === api.Quoting.Bottom || accountSettings.Quoting === api.Quoting.Default && haveSel) {
+				body = onWroteLine + body + '\n\n';
+				bodyCursor = body.length;
+				if (sig) {
+					body += '\n' + sig;
+				}
 			}
 			else {
-				let onWroteLine = '';
-				if (mi.Envelope.Date && mi.Envelope.From && mi.Envelope.From.length === 1) {
-					const from = mi.Envelope.From[0];
-					const name = from.Name || formatEmailAddress(from);
-					const datetime = mi.Envelope.Date.toLocaleDateString(undefined, { weekday: "short", year: "numeric", month: "short", day: "numeric" }) + ' at ' + mi.Envelope.Date.toLocaleTimeString();
-					onWroteLine = 'On ' + datetime + ', ' + name + ' wrote:\n';
+				body = '\n\n' + (sig ? sig + '\n' : '') + onWroteLine + body;
+				// Keep the formatting of HTML messages by replying in HTML, unless only selected
+				// text is quoted.
+				if (pm.HasHTML && !haveSel) {
+					try {
+						const quote = document.createElement('blockquote');
+						quote.style.borderLeft = '2px solid #ccc';
+						quote.style.margin = '0 0 0 .5em';
+						quote.style.paddingLeft = '.5em';
+						quote.append(...await quoteHTML(m.ID));
+						const sigElems = sig ? [dom.div(dom.br()), sig.trim().split('\n').map(line => dom.div(line ? new String(line) : dom.br()))] : [];
+						htmlBody = dom.div(dom.div(dom.br()), sigElems, dom.div(dom.br()), onWroteLine ? dom.div(new String(onWroteLine.trim())) : [], quote).innerHTML;
+					}
+					catch (err) {
+						log('fetching html for quoting, replying in plain text', err);
+					}
 				}
-				body = '\n\n' + onWroteLine + body;
 			}
 		}
 		const subjectPrefix = forward ? 'Fwd:' : 'Re:';
@@ -3021,10 +3976,12 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 			bcc: bcc.map(a => formatAddress(a)),
 			subject: subject,
 			body: body,
+			htmlBody: htmlBody,
 			isForward: forward,
 			attachmentsMessageItem: forward ? mi : undefined,
 			responseMessageID: m.ID,
 			isList: m.IsMailingList,
+			bodyCursor: bodyCursor,
 		};
 		if (all) {
 			opts.to = (to || []).concat((mi.Envelope.To || []).filter(a => !envelopeIdentity([a]))).map(a => formatAddress(a));
@@ -3050,6 +4007,26 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 	};
 	const cmdReply = async () => { await reply(false); };
 	const cmdReplyAll = async () => { await reply(true); };
+	const cmdEditDraft = async () => {
+		if (!isDraft) {
+			return;
+		}
+		const sm = await withStatus('Opening draft', client.MessageDraftOpen(m.ID));
+		compose({
+			from: mi.Envelope.From || undefined,
+			to: sm.To || [],
+			cc: sm.Cc || [],
+			bcc: sm.Bcc || [],
+			replyto: sm.ReplyTo,
+			subject: sm.Subject,
+			body: sm.TextBody,
+			htmlBody: sm.HTMLBody || undefined,
+			responseMessageID: sm.ResponseMessageID,
+			draftMessageID: sm.DraftMessageID,
+			draftAttachments: sm.Attachments || [],
+			requireTLS: sm.RequireTLS,
+		});
+	};
 	const cmdPrint = async () => {
 		if (urlType) {
 			window.open('msg/' + m.ID + '/msg' + urlType + '#print', '_blank');
@@ -3114,6 +4091,12 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 		const mimepart = (p) => dom.li((p.MediaType + '/' + p.MediaSubType).toLowerCase(), p.ContentTypeParams ? ' ' + JSON.stringify(p.ContentTypeParams) : [], p.Parts && p.Parts.length === 0 ? [] : dom.ul(style({ listStyle: 'disc', marginLeft: '1em' }), (p.Parts || []).map(pp => mimepart(pp))));
 		popup(style({ display: 'flex', gap: '1em' }), dom.div(dom.h1('Mime structure'), dom.ul(style({ listStyle: 'disc', marginLeft: '1em' }), mimepart(pm.Part))), dom.div(style({ whiteSpace: 'pre-wrap', tabSize: 4, maxWidth: '50%' }), dom.h1('Message'), JSON.stringify(m, undefined, '\t')), dom.div(style({ whiteSpace: 'pre-wrap', tabSize: 4, maxWidth: '50%' }), dom.h1('Part'), JSON.stringify(pm.Part, undefined, '\t')));
 	};
+	const cmdExplainJunk = async () => {
+		const x = await withStatus('Classifying message with junk filter', client.JunkExplain(m.ID));
+		const c = x.Classification;
+		const wordTable = (title, l) => dom.div(dom.h1(title), l.length === 0 ? dom.div('None.') : dom.table(dom.thead(dom.tr(dom.th('Word'), dom.th('Spam probability', attr.title('Between 0 (ham) and 1 (spam).')), dom.th('Ham', attr.title('Number of trained non-junk messages containing the word.')), dom.th('Spam', attr.title('Number of trained junk messages containing the word.')))), dom.tbody(l.map(w => dom.tr(dom.td(w.Word), dom.td(style({ textAlign: 'right' }), w.Probability.toFixed(3)), dom.td(style({ textAlign: 'right' }), '' + w.Ham), dom.td(style({ textAlign: 'right' }), '' + w.Spam))))));
+		popup(style({ maxWidth: '60em' }), dom.h1('Junk classification'), dom.p('Spam probability ' + c.Probability.toFixed(3) + ', ' + (c.Probability > x.Threshold ? 'above' : 'below') + ' the threshold of ' + x.Threshold + ' for rejecting incoming messages.'), dom.p(c.Known + ' of ' + c.Words + ' words (combinations) of the message are known to the junk filter, which is trained with ' + c.Hams + ' non-junk and ' + c.Spams + ' junk messages. The probability is calculated from the most hammy and spammy words below. The classification is made with the current junk filter, and may differ from the classification at the time of delivery.'), dom.div(style({ display: 'flex', gap: '2em' }), wordTable('Top ham words', c.TopHam || []), wordTable('Top spam words', c.TopSpam || [])));
+	};
 	const cmdUp = async () => { msgscrollElem.scrollTo({ top: msgscrollElem.scrollTop - 3 * msgscrollElem.getBoundingClientRect().height / 4, behavior: 'smooth' }); };
 	const cmdDown = async () => { msgscrollElem.scrollTo({ top: msgscrollElem.scrollTop + 3 * msgscrollElem.getBoundingClientRect().height / 4, behavior: 'smooth' }); };
 	const cmdHome = async () => { msgscrollElem.scrollTo({ top: 0 }); };
@@ -3126,6 +4109,7 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 		f: cmdForward,
 		r: cmdReply,
 		R: cmdReplyAll,
+		e: cmdEditDraft,
 		v: cmdViewAttachments,
 		t: cmdShowText,
 		T: cmdShowHTMLCycle,
@@ -3146,18 +4130,19 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 		M: msglistView.cmdMarkUnread,
 	};
 	let urlType; // text, html, htmlexternal; for opening in new tab/print
-	let msgbuttonElem, msgheaderElem, msgattachmentElem, msgmodeElem;
+	let msgbuttonElem, msgheaderElem, msgattachmentElem, msginviteElem, msgmodeElem;
 	let msgheaderdetailsElem = null; // When full headers are visible, or some headers are requested through settings.
-	const msgmetaElem = dom.div(style({ backgroundColor: '#f8f8f8', borderBottom: '5px solid white', maxHeight: '90%', overflowY: 'auto' }), attr.role('region'), attr.arialabel('Buttons and headers for message'), msgbuttonElem = dom.div(), dom.div(attr.arialive('assertive'), msgheaderElem = dom.table(dom._class('msgheaders'), style({ marginBottom: '1ex', width: '100%' })), msgattachmentElem = dom.div(), msgmodeElem = dom.div()), 
+	const msgmetaElem = dom.div(style({ backgroundColor: '#f8f8f8', borderBottom: '5px solid white', maxHeight: '90%', overflowY: 'auto' }), attr.role('region'), attr.arialabel('Buttons and headers for message'), msgbuttonElem = dom.div(), dom.div(attr.arialive('assertive'), msgheaderElem = dom.table(dom._class('msgheaders'), style({ marginBottom: '1ex', width: '100%' })), msgattachmentElem = dom.div(), msginviteElem = dom.div(), msgmodeElem = dom.div()), 
 	// Explicit gray line with white border below that separates headers from body, to
 	// prevent HTML messages from faking UI elements.
 	dom.div(style({ height: '2px', backgroundColor: '#ccc' })));
 	const msgscrollElem = dom.div(dom._class('pad', 'yscrollauto'), attr.role('region'), attr.arialabel('Message body'), style({ backgroundColor: 'white' }));
 	const msgcontentElem = dom.div(dom._class('scrollparent'), style({ flexGrow: '1' }));
 	const trashMailboxID = listMailboxes().find(mb => mb.Trash)?.ID;
+	const isDraft = m.Draft || m.MailboxID === listMailboxes().find(mb => mb.Draft)?.ID;
 	// Initially called with potentially null pm, once loaded called again with pm set.
 	const loadButtons = (pm) => {
-		dom._kids(msgbuttonElem, dom.div(dom._class('pad'), (!pm || !pm.ListReplyAddress) ? [] : dom.clickbutton('Reply to list', attr.title('Compose a reply to this mailing list.'), clickCmd(cmdReplyList, shortcuts)), ' ', (pm && pm.ListReplyAddress && formatEmailAddress(pm.ListReplyAddress) === fromAddress) ? [] : dom.clickbutton('Reply', attr.title('Compose a reply to the sender of this message.'), clickCmd(cmdReply, shortcuts)), ' ', (mi.Envelope.To || []).length <= 1 && (mi.Envelope.CC || []).length === 0 && (mi.Envelope.BCC || []).length === 0 ? [] :
+		dom._kids(msgbuttonElem, dom.div(dom._class('pad'), !isDraft ? [] : [dom.clickbutton('Edit draft', attr.title('Continue composing this draft message.'), clickCmd(cmdEditDraft, shortcuts)), ' '], (!pm || !pm.ListReplyAddress) ? [] : dom.clickbutton('Reply to list', attr.title('Compose a reply to this mailing list.'), clickCmd(cmdReplyList, shortcuts)), ' ', (pm && pm.ListReplyAddress && formatEmailAddress(pm.ListReplyAddress) === fromAddress) ? [] : dom.clickbutton('Reply', attr.title('Compose a reply to the sender of this message.'), clickCmd(cmdReply, shortcuts)), ' ', (mi.Envelope.To || []).length <= 1 && (mi.Envelope.CC || []).length === 0 && (mi.Envelope.BCC || []).length === 0 ? [] :
 			dom.clickbutton('Reply all', attr.title('Compose a reply to all participants of this message.'), clickCmd(cmdReplyAll, shortcuts)), ' ', dom.clickbutton('Forward', attr.title('Compose a forwarding message, optionally including attachments.'), clickCmd(cmdForward, shortcuts)), ' ', dom.clickbutton('Archive', attr.title('Move to the Archive mailbox.'), clickCmd(msglistView.cmdArchive, shortcuts)), ' ', m.MailboxID === trashMailboxID ?
 			dom.clickbutton('Delete', attr.title('Permanently delete message.'), clickCmd(msglistView.cmdDelete, shortcuts)) :
 			dom.clickbutton('Trash', attr.title('Move to the Trash mailbox.'), clickCmd(msglistView.cmdTrash, shortcuts)), ' ', dom.clickbutton('Junk', attr.title('Move to Junk mailbox, marking as junk and causing this message to be used in spam classification of new incoming messages.'), clickCmd(msglistView.cmdJunk, shortcuts)), ' ', dom.clickbutton('Move to...', function click(e) {
@@ -3174,7 +4159,14 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 				dom.clickbutton('Unmute thread', clickCmd(msglistView.cmdUnmute, shortcuts)),
 				dom.clickbutton('Open in new tab', clickCmd(cmdOpenNewTab, shortcuts)),
 				dom.clickbutton('Show raw original message in new tab', clickCmd(cmdOpenRaw, shortcuts)),
+				dom.clickbutton('Export message', attr.title('Download this message as mbox or maildir archive.'), function click() {
+					cmdExport('Export message', { messageIDs: [m.ID] });
+				}),
+				dom.clickbutton('Export thread', attr.title('Download all messages of the thread of this message, in all mailboxes.'), function click() {
+					cmdExport('Export thread', { threadIDs: [m.ThreadID] });
+				}),
 				dom.clickbutton('Show internals in popup', clickCmd(cmdShowInternals, shortcuts)),
+				dom.clickbutton('Explain junk classification', attr.title('Show the words that determine the junk filter classification of this message.'), clickCmd(cmdExplainJunk, shortcuts)),
 			].map(b => dom.div(b))));
 		})));
 	};
@@ -3323,6 +4315,49 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 			});
 		});
 	};
+	// Show meeting invitations, replies and cancellations, with their status based on
+	// earlier replies, and buttons to reply to invitations.
+	const loadInvites = async (pm) => {
+		const invites = pm.Invites || [];
+		if (invites.length === 0) {
+			return;
+		}
+		const statuses = await withStatus('Fetching invitation status', client.InviteStatuses(m.ID)) || [];
+		const formatTime = (d, allDay) => {
+			const date = d.toLocaleDateString(undefined, { weekday: 'short', year: 'numeric', month: 'short', day: 'numeric', timeZone: allDay ? 'UTC' : undefined });
+			return allDay ? date : date + ' ' + d.toLocaleTimeString(undefined, { hour: '2-digit', minute: '2-digit' });
+		};
+		const formatAddress = (a) => a.Name ? a.Name + ' <' + a.Address + '>' : a.Address;
+		const methods = { REQUEST: 'Invitation', REPLY: 'Reply to invitation', CANCEL: 'Cancelled event' };
+		dom._kids(msginviteElem, invites.map((inv, index) => {
+			const events = inv.Calendar.Events || [];
+			if (events.length === 0) {
+				return [];
+			}
+			const ev = events[0];
+			const st = statuses[index];
+			const answered = st && st.PartStat ? 'You replied "' + st.PartStat.toLowerCase() + '" on ' + formatTime(st.Replied, false) + '.' : '';
+			let status = '';
+			if (st && st.Cancelled) {
+				status = 'The organizer cancelled this event. ' + answered;
+			}
+			else if (st && st.Updated) {
+				status = 'The event was updated after you replied. ' + answered + ' You can reply again.';
+			}
+			else {
+				status = answered;
+			}
+			const canReply = inv.Calendar.Method === 'REQUEST' && !(st && st.Cancelled);
+			let fieldset;
+			let comment;
+			const reply = async (partStat) => {
+				await withStatus('Sending reply', client.CalendarReply(m.ID, inv.Path || [], partStat, comment.value), fieldset);
+				dom._kids(msginviteElem);
+				await loadInvites(pm);
+			};
+			return dom.div(dom._class('pad'), style({ borderTop: '1px solid #ccc' }), dom.div(dom.span(methods[inv.Calendar.Method] || 'Event', ': ', style({ color: '#555' })), dom.b(ev.Summary || '(no title)')), dom.div(formatTime(ev.Start, ev.AllDay), ev.End.getFullYear() > 1 && !(ev.AllDay && ev.End.getTime() - ev.Start.getTime() <= 24 * 3600 * 1000) ? ' – ' + formatTime(ev.AllDay ? new Date(ev.End.getTime() - 24 * 3600 * 1000) : ev.End, ev.AllDay) : [], ev.Recurrence ? dom.span(' (recurring)', attr.title(ev.Recurrence)) : []), ev.Location ? dom.div('Location: ' + ev.Location) : [], ev.Organizer.Address ? dom.div('Organizer: ' + formatAddress(ev.Organizer)) : [], (ev.Attendees || []).length === 0 ? [] : dom.div('Attendees: ', join((ev.Attendees || []).map(a => dom.span(formatAddress(a), a.PartStat && a.PartStat !== 'NEEDS-ACTION' ? ' (' + a.PartStat.toLowerCase() + ')' : [])), () => ', ')), status ? dom.div(style({ marginTop: '.5ex' }), dom.span(status, style({ backgroundColor: st && (st.Cancelled || st.Updated) ? '#ffca91' : '', padding: '0 .15em' }))) : [], !canReply ? [] : dom.div(style({ marginTop: '.5ex' }), fieldset = dom.fieldset(dom.span(dom._class('btngroup'), dom.clickbutton('Accept', async function click() { await reply('ACCEPTED'); }), dom.clickbutton('Tentative', async function click() { await reply('TENTATIVE'); }), dom.clickbutton('Decline', async function click() { await reply('DECLINED'); })), ' ', comment = dom.input(attr.placeholder('Optional comment for organizer')))));
+		}));
+	};
 	const mv = {
 		root: root,
 		messageitem: mi,
@@ -3360,6 +4395,7 @@ const newMsgView = (miv, msglistView, listMailboxes, possibleLabels, messageLoad
 		loadButtons(pm);
 		loadHeaderDetails(pm);
 		loadMoreHeaders(pm);
+		loadInvites(pm);
 		const htmlNote = 'In the HTML viewer, the following potentially dangerous functionality is disabled: submitting forms, starting a download from a link, navigating away from this page by clicking a link. If a link does not work, try explicitly opening it in a new tab.';
 		const haveText = pm.Texts && pm.Texts.length > 0;
 		if (!haveText && !pm.HasHTML) {
@@ -3767,7 +4803,9 @@ const newMsglistView = (msgElem, listMailboxes, setLocationHash, otherMailbox, p
 				movePopover(e, listMailboxes(), effselected.map(miv => miv.messageitem.Message).filter(m => effselected.length === 1 || !sentMailboxID || m.MailboxID !== sentMailboxID || !otherMailbox(sentMailboxID)));
 			}), ' ', dom.clickbutton('Labels...', attr.title('Add/remove labels ...'), function click(e) {
 				labelsPopover(e, effselected.map(miv => miv.messageitem.Message), possibleLabels);
-			}), ' ', dom.clickbutton('Mark Not Junk', attr.title('Mark as not junk, causing this message to be used in spam classification of new incoming messages.'), clickCmd(cmdMarkNotJunk, shortcuts)), ' ', dom.clickbutton('Mark Read', clickCmd(cmdMarkRead, shortcuts)), ' ', dom.clickbutton('Mark Unread', clickCmd(cmdMarkUnread, shortcuts)), ' ', dom.clickbutton('Mute thread', clickCmd(cmdMute, shortcuts)), ' ', dom.clickbutton('Unmute thread', clickCmd(cmdUnmute, shortcuts))))));
+			}), ' ', dom.clickbutton('Mark Not Junk', attr.title('Mark as not junk, causing this message to be used in spam classification of new incoming messages.'), clickCmd(cmdMarkNotJunk, shortcuts)), ' ', dom.clickbutton('Mark Read', clickCmd(cmdMarkRead, shortcuts)), ' ', dom.clickbutton('Mark Unread', clickCmd(cmdMarkUnread, shortcuts)), ' ', dom.clickbutton('Mute thread', clickCmd(cmdMute, shortcuts)), ' ', dom.clickbutton('Unmute thread', clickCmd(cmdUnmute, shortcuts)), ' ', dom.clickbutton('Export...', attr.title('Download the selected messages as mbox or maildir archive.'), function click() {
+				cmdExport('Export ' + effselected.length + ' messages', { messageIDs: effselected.map(miv => miv.messageitem.Message.ID) });
+			})))));
 		}
 		setLocationHash();
 	};
@@ -4738,7 +5776,14 @@ const newMailboxView = (xmb, mailboxlistView, otherMailbox) => {
 			}
 			remove();
 			await withStatus('Emptying mailbox', client.MailboxEmpty(mbv.mailbox.ID));
-		})), dom.div(dom.clickbutton('Rename mailbox', function click() {
+		})), dom.div(dom.clickbutton('Export mailbox', attr.title('Download the messages of this mailbox as mbox or maildir archive.'), function click() {
+			remove();
+			cmdExport('Export mailbox ' + mbv.mailbox.Name, { mailboxIDs: [mbv.mailbox.ID] });
+		})), mailboxlistView.mailboxes().find(mb => mb.Name.startsWith(mbv.mailbox.Name + '/')) ? dom.div(dom.clickbutton('Export mailbox and children', attr.title('Download the messages of this mailbox and the mailboxes inside it as mbox or maildir archive.'), function click() {
+			remove();
+			const ids = mailboxlistView.mailboxes().filter(mb => mb.ID === mbv.mailbox.ID || mb.Name.startsWith(mbv.mailbox.Name + '/')).map(mb => mb.ID);
+			cmdExport('Export mailbox ' + mbv.mailbox.Name + ' and children', { mailboxIDs: ids });
+		})) : [], dom.div(dom.clickbutton('Rename mailbox', function click() {
 			remove();
 			let fieldset, name;
 			const remove2 = popover(actionBtn, {}, dom.form(async function submit(e) {
@@ -4874,7 +5919,7 @@ const newMailboxView = (xmb, mailboxlistView, otherMailbox) => {
 	};
 	return mbv;
 };
-const newMailboxlistView = (msglistView, requestNewView, updatePageTitle, setLocationHash, unloadSearch, otherMailbox) => {
+const newMailboxlistView = (msglistView, requestNewView, updatePageTitle, setLocationHash, unloadSearch, otherMailbox, openSearch) => {
 	let mailboxViews = [];
 	let mailboxViewActive;
 	// Reorder mailboxes and assign new short names and indenting. Called after changing the list.
@@ -4973,6 +6018,8 @@ const newMailboxlistView = (msglistView, requestNewView, updatePageTitle, setLoc
 	};
 	const root = dom.div();
 	const mailboxesElem = dom.div();
+	const savedSearchesElem = dom.div();
+	const labelsElem = dom.div();
 	dom._kids(root, dom.div(attr.role('region'), attr.arialabel('Mailboxes'), dom.div(dom.h1('Mailboxes', style({ display: 'inline', fontSize: 'inherit' })), ' ', dom.clickbutton('+', attr.arialabel('Create new mailbox.'), attr.title('Create new mailbox.'), style({ padding: '0 .25em' }), function click(e) {
 		let fieldset, name;
 		const remove = popover(e.target, {}, dom.form(async function submit(e) {
@@ -4980,7 +6027,41 @@ const newMailboxlistView = (msglistView, requestNewView, updatePageTitle, setLoc
 			await withStatus('Creating mailbox', client.MailboxCreate(name.value), fieldset);
 			remove();
 		}, fieldset = dom.fieldset(dom.label('Name ', name = dom.input(attr.required('yes'), focusPlaceholder('Lists/Go/Nuts'))), ' ', dom.submitbutton('Create'))));
-	})), mailboxesElem));
+	})), mailboxesElem), savedSearchesElem, labelsElem);
+	// Saved searches are shown as virtual mailboxes, with their number of unread
+	// messages, as calculated by the server.
+	let savedSearchesTimer = 0;
+	const loadSavedSearches = async () => {
+		const l = await client.SavedSearches() || [];
+		dom._kids(savedSearchesElem, l.length === 0 ? [] : dom.div(attr.role('region'), attr.arialabel('Saved searches'), style({ marginTop: '1ex' }), dom.h1('Saved searches', style({ fontSize: 'inherit' })), l.map(ss => dom.div(dom._class('mailboxitem'), attr.tabindex('0'), attr.title('Search: ' + ss.Search), async function keydown(e) {
+			if (e.key === 'Enter') {
+				e.stopPropagation();
+				await openSearch(ss.Search);
+			}
+		}, async function click() {
+			await openSearch(ss.Search);
+		}, dom.div(dom._class('mailbox'), style({ display: 'flex', justifyContent: 'space-between' }), dom.div(style({ whiteSpace: 'nowrap', overflow: 'hidden', textOverflow: 'ellipsis' }), ss.Name), dom.div(style({ whiteSpace: 'nowrap' }), dom.clickbutton(dom._class('mailboxhoveronly'), 'x', attr.tabindex('-1'), attr.arialabel('Remove saved search'), attr.title('Remove saved search.'), async function click(e) {
+			e.stopPropagation();
+			if (!window.confirm('Are you sure you want to remove saved search "' + ss.Name + '"?')) {
+				return;
+			}
+			await withStatus('Removing saved search', client.SavedSearchDelete(ss.ID));
+			await loadSavedSearches();
+		}), ' ', dom.b(dom._class('silenttitle'), ss.Unread === 0 ? [] : ['' + ss.Unread, attr.title('' + ss.Unread + ' unread')])))))));
+	};
+	// Labels are shown with their color, clicking searches for messages with the label.
+	const setLabels = (labels) => {
+		dom._kids(labelsElem, dom.div(attr.role('region'), attr.arialabel('Labels'), style({ marginTop: '1ex' }), dom.div(dom.h1('Labels', style({ display: 'inline', fontSize: 'inherit' })), ' ', dom.clickbutton('...', attr.arialabel('Edit labels.'), attr.title('Create, rename, recolor and remove labels.'), style({ padding: '0 .25em' }), function click() {
+			cmdLabels();
+		})), labels.map(l => dom.div(dom._class('mailboxitem'), attr.tabindex('0'), attr.title('Search messages with label.'), async function keydown(e) {
+			if (e.key === 'Enter') {
+				e.stopPropagation();
+				await openSearch('label:' + l.Keyword);
+			}
+		}, async function click() {
+			await openSearch('label:' + l.Keyword);
+		}, dom.div(dom._class('mailbox'), style({ whiteSpace: 'nowrap', overflow: 'hidden', textOverflow: 'ellipsis' }), dom.span(dom._class('keyword'), keywordKids(l.Keyword)))))));
+	};
 	const loadMailboxes = (mailboxes, mbnameOpt) => {
 		mailboxViews = mailboxes.map(mb => newMailboxView(mb, mblv, otherMailbox));
 		updateMailboxNames();
@@ -5096,6 +6177,23 @@ const newMailboxlistView = (msglistView, requestNewView, updatePageTitle, setLoc
 			}
 			mbv.setKeywords(keywords);
 		},
+		setLabels: setLabels,
+		loadSavedSearches: loadSavedSearches,
+		updateSavedSearches: () => {
+			// Changes often come in batches, we only reload once.
+			if (savedSearchesTimer || savedSearchesElem.children.length === 0) {
+				return;
+			}
+			savedSearchesTimer = window.setTimeout(async () => {
+				savedSearchesTimer = 0;
+				try {
+					await loadSavedSearches();
+				}
+				catch (err) {
+					console.log('updating saved searches', err);
+				}
+			}, 2000);
+		},
 	};
 	return mblv;
 };
@@ -5383,13 +6481,26 @@ const newSearchView = (searchbarElem, mailboxlistView, startSearch, searchViewCl
 			},
 		};
 		return v;
-	}), () => ' '), ' ', labels = dom.input(focusPlaceholder('todo -done "-dashingname"'), attr.title('User-defined labels.'), changeHandlers))), dom.tr(dom.td('Headers'), headersCell = dom.td(headerViews = [newHeaderView(true)])), dom.tr(dom.td('Size between'), dom.td(minsize = dom.input(style({ width: '6em' }), focusPlaceholder('10kb'), changeHandlers), ' and ', maxsize = dom.input(style({ width: '6em' }), focusPlaceholder('1mb'), changeHandlers)))), dom.div(style({ padding: '1ex', textAlign: 'right' }), dom.submitbutton('Search')), async function submit(e) {
+	}), () => ' '), ' ', labels = dom.input(focusPlaceholder('todo -done "-dashingname"'), attr.title('User-defined labels.'), changeHandlers))), dom.tr(dom.td('Headers'), headersCell = dom.td(headerViews = [newHeaderView(true)])), dom.tr(dom.td('Size between'), dom.td(minsize = dom.input(style({ width: '6em' }), focusPlaceholder('10kb'), changeHandlers), ' and ', maxsize = dom.input(style({ width: '6em' }), focusPlaceholder('1mb'), changeHandlers)))), dom.div(style({ padding: '1ex', textAlign: 'right' }), dom.clickbutton('Save search...', attr.title('Save the search, showing it below the mailboxes with its number of unread messages.'), async function click(e) {
+		const q = searchbarElem.value.trim();
+		if (!q) {
+			window.alert('Search is empty.');
+			return;
+		}
+		const name = window.prompt('Name for saved search', '');
+		if (!name) {
+			return;
+		}
+		await withStatus('Saving search', client.SavedSearchSave(name, q), e.target);
+		await mailboxlistView.loadSavedSearches();
+	}), ' ', dom.submitbutton('Search')), async function submit(e) {
 		e.preventDefault();
 		await searchView.submit();
 	})));
 	const submit = async () => {
-		const [f, notf, _] = parseSearch(searchbarElem.value, mailboxlistView);
-		await startSearch(f, notf);
+		// The server parses the search, it knows the full syntax, including OR groups.
+		const q = await withStatus('Parsing search', client.SearchParse(searchbarElem.value));
+		await startSearch(q.Filter, q.NotFilter);
 	};
 	let loaded = false;
 	const searchView = {
@@ -5409,6 +6520,7 @@ const newSearchView = (searchbarElem, mailboxlistView, startSearch, searchViewCl
 };
 const init = async () => {
 	let connectionElem; // SSE connection status/error. Empty when connected.
+	let offlineElem; // Status of changes made while offline.
 	let layoutElem; // Select dropdown for layout.
 	let loginAddressElem;
 	let msglistscrollElem;
@@ -5475,6 +6587,11 @@ const init = async () => {
 		search = { active: false, query: '' };
 		searchView.root.remove();
 	};
+	const openSearch = async (q) => {
+		searchbarElem.value = q;
+		const query = await withStatus('Parsing search', client.SearchParse(q));
+		await startSearch(query.Filter, query.NotFilter);
+	};
 	const clearList = () => {
 		msglistView.clear();
 		listendElem.remove();
@@ -5532,19 +6649,18 @@ const init = async () => {
 	// msgElem can show a message, show actions on multiple messages, or be empty.
 	let msgElem = dom.div(style({ position: 'absolute', right: 0, left: 0, top: 0, bottom: 0 }), style({ backgroundColor: '#f8f8f8' }));
 	// Returns possible labels based, either from active mailbox (possibly from search), or all mailboxes.
+	// Keywords of defined labels are always included.
 	const possibleLabels = () => {
-		if (requestFilter.MailboxID > 0) {
-			const mb = mailboxlistView.findMailboxByID(requestFilter.MailboxID);
-			if (mb) {
-				return mb.Keywords || [];
-			}
-		}
 		const all = {};
-		mailboxlistView.mailboxes().forEach(mb => {
-			for (const k of (mb.Keywords || [])) {
+		for (const l of accountLabels) {
+			all[l.Keyword] = undefined;
+		}
+		const mb = requestFilter.MailboxID > 0 ? mailboxlistView.findMailboxByID(requestFilter.MailboxID) : null;
+		for (const xmb of mb ? [mb] : mailboxlistView.mailboxes()) {
+			for (const k of (xmb.Keywords || [])) {
 				all[k] = undefined;
 			}
-		});
+		}
 		const l = Object.keys(all);
 		l.sort();
 		return l;
@@ -5568,7 +6684,7 @@ const init = async () => {
 	const otherMailbox = (mailboxID) => requestFilter.MailboxID !== mailboxID ? (mailboxlistView.findMailboxByID(mailboxID) || null) : null;
 	const listMailboxes = () => mailboxlistView.mailboxes();
 	const msglistView = newMsglistView(msgElem, listMailboxes, setLocationHash, otherMailbox, possibleLabels, () => msglistscrollElem ? msglistscrollElem.getBoundingClientRect().height : 0, refineKeyword, viewportEnsureMessages);
-	const mailboxlistView = newMailboxlistView(msglistView, requestNewView, updatePageTitle, setLocationHash, unloadSearch, otherMailbox);
+	const mailboxlistView = newMailboxlistView(msglistView, requestNewView, updatePageTitle, setLocationHash, unloadSearch, otherMailbox, openSearch);
 	let refineUnreadBtn, refineReadBtn, refineAttachmentsBtn, refineLabelBtn;
 	const refineToggleActive = (btn) => {
 		for (const e of [refineUnreadBtn, refineReadBtn, refineAttachmentsBtn, refineLabelBtn]) {
@@ -5579,6 +6695,7 @@ const init = async () => {
 		}
 	};
 	let threadMode;
+	let orderAscElem;
 	let msglistElem = dom.div(dom._class('msglist'), style({ position: 'absolute', left: '0', right: 0, top: 0, bottom: 0, display: 'flex', flexDirection: 'column' }), dom.div(attr.role('region'), attr.arialabel('Filter and sorting buttons for message list'), style({ display: 'flex', justifyContent: 'space-between', backgroundColor: '#f8f8f8', borderBottom: '1px solid #ccc', padding: '.25em .5em' }), dom.div(dom.h1('Refine:', style({ fontWeight: 'normal', fontSize: 'inherit', display: 'inline', margin: 0 }), attr.title('Refine message listing with quick filters. These refinement filters are in addition to any search criteria, but the refine attachment filter overrides a search attachment criteria.')), ' ', dom.span(dom._class('btngroup'), refineUnreadBtn = dom.clickbutton(settings.refine === 'unread' ? dom._class('active') : [], 'Unread', attr.title('Only show messages marked as unread.'), async function click(e) {
 		settingsPut({ ...settings, refine: 'unread' });
 		refineToggleActive(e.target);
@@ -5601,7 +6718,7 @@ const init = async () => {
 				await withStatus('Requesting messages', requestNewView(false));
 				remove();
 			};
-			return dom.div(dom.clickbutton(dom._class('keyword'), l, async function click() {
+			return dom.div(dom.clickbutton(dom._class('keyword'), keywordKids(l), async function click() {
 				await selectLabel();
 			}));
 		}), labels.length === 0 ? dom.div('No labels yet, set one on a message first.') : []));
@@ -5619,7 +6736,7 @@ const init = async () => {
 		else {
 			msglistView.threadToggle();
 		}
-	}), ' ', dom.clickbutton('↑↓', attr.title('Toggle sorting by date received.'), settings.orderAsc ? dom._class('invert') : [], async function click(e) {
+	}), ' ', orderAscElem = dom.clickbutton('↑↓', attr.title('Toggle sorting by date received.'), settings.orderAsc ? dom._class('invert') : [], async function click(e) {
 		settingsPut({ ...settings, orderAsc: !settings.orderAsc });
 		e.target.classList.toggle('invert', settings.orderAsc);
 		// We don't want to include the currently selected message because it could cause a
@@ -5744,11 +6861,12 @@ const init = async () => {
 		'?': cmdHelp,
 		'ctrl ?': cmdTooltip,
 		c: cmdCompose,
+		A: cmdContacts,
 		'ctrl m': cmdFocusMsg,
 	};
 	const webmailroot = dom.div(style({ display: 'flex', flexDirection: 'column', alignContent: 'stretch', height: '100dvh' }), dom.div(dom._class('topbar'), style({ display: 'flex' }), attr.role('region'), attr.arialabel('Top bar'), topcomposeboxElem = dom.div(dom._class('pad'), style({ width: settings.mailboxesWidth + 'px', textAlign: 'center' }), dom.clickbutton('Compose', attr.title('Compose new email message.'), function click() {
 		shortcutCmd(cmdCompose, shortcuts);
-	})), dom.div(dom._class('pad'), style({ paddingLeft: 0, display: 'flex', flexGrow: 1 }), searchbarElemBox = dom.search(style({ display: 'flex', marginRight: '.5em' }), dom.form(style({ display: 'flex', flexGrow: 1 }), searchbarElem = dom.input(attr.placeholder('Search...'), style({ position: 'relative', width: '100%' }), attr.title('Search messages based on criteria like matching free-form text, in a mailbox, labels, addressees.'), focusPlaceholder('word "with space" -notword mb:Inbox f:from@x.example t:rcpt@x.example start:2023-7-1 end:2023-7-8 s:"subject" a:images l:$Forwarded h:Reply-To:other@x.example minsize:500kb'), function click() {
+	})), dom.div(dom._class('pad'), style({ paddingLeft: 0, display: 'flex', flexGrow: 1 }), searchbarElemBox = dom.search(style({ display: 'flex', marginRight: '.5em' }), dom.form(style({ display: 'flex', flexGrow: 1 }), searchbarElem = dom.input(attr.placeholder('Search...'), style({ position: 'relative', width: '100%' }), attr.title('Search messages based on criteria like matching free-form text, in a mailbox, labels, addressees.'), focusPlaceholder('word "with space" -notword mb:Inbox f:from@x.example t:rcpt@x.example start:2023-7-1 end:2023-7-8 s:"subject" a:image l:$Forwarded is:unread h:Reply-To:other@x.example minsize:500kb f:a@x.example OR f:b@x.example'), function click() {
 		cmdSearch();
 		showShortcut('/');
 	}, function focus() {
@@ -5793,7 +6911,7 @@ const init = async () => {
 	}), async function submit(e) {
 		e.preventDefault();
 		await searchView.submit();
-	})), connectionElem = dom.div(), statusElem = dom.div(style({ marginLeft: '.5em', flexGrow: '1' }), attr.role('status')), dom.div(style({ paddingLeft: '1em' }), layoutElem = dom.select(attr.title('Layout of message list and message panes. Top/bottom has message list above message view. Left/Right has message list left, message view right. Auto selects based on window width and automatically switches on resize. Wide screens get left/right, smaller screens get top/bottom.'), dom.option('Auto layout', attr.value('auto'), settings.layout === 'auto' ? attr.selected('') : []), dom.option('Top/bottom', attr.value('topbottom'), settings.layout === 'topbottom' ? attr.selected('') : []), dom.option('Left/right', attr.value('leftright'), settings.layout === 'leftright' ? attr.selected('') : []), function change() {
+	})), connectionElem = dom.div(), offlineElem = dom.div(), statusElem = dom.div(style({ marginLeft: '.5em', flexGrow: '1' }), attr.role('status')), dom.div(style({ paddingLeft: '1em' }), layoutElem = dom.select(attr.title('Layout of message list and message panes. Top/bottom has message list above message view. Left/Right has message list left, message view right. Auto selects based on window width and automatically switches on resize. Wide screens get left/right, smaller screens get top/bottom.'), dom.option('Auto layout', attr.value('auto'), settings.layout === 'auto' ? attr.selected('') : []), dom.option('Top/bottom', attr.value('topbottom'), settings.layout === 'topbottom' ? attr.selected('') : []), dom.option('Left/right', attr.value('leftright'), settings.layout === 'leftright' ? attr.selected('') : []), function change() {
 		settingsPut({ ...settings, layout: layoutElem.value });
 		if (layoutElem.value === 'auto') {
 			autoselectLayout();
@@ -5801,9 +6919,12 @@ const init = async () => {
 		else {
 			selectLayout(layoutElem.value);
 		}
+	}), ' ', dom.clickbutton('Contacts', attr.title('Show contacts in the address book, for adding, editing and writing to contacts.'), clickCmd(cmdContacts, shortcuts)), ' ', dom.clickbutton('Settings', attr.title('Settings like signature and default From address, stored on the server for all sessions.'), function click() {
+		cmdSettings();
 	}), ' ', dom.clickbutton('Tooltip', attr.title('Show tooltips, based on the title attributes (underdotted text) for the focused element and all user interface elements below it. Use the keyboard shortcut "ctrl ?" instead of clicking on the tooltip button, which changes focus to the tooltip button.'), clickCmd(cmdTooltip, shortcuts)), ' ', dom.clickbutton('Help', attr.title('Show popup with basic usage information and a keyboard shortcuts.'), clickCmd(cmdHelp, shortcuts)), ' ', loginAddressElem = dom.span(), ' ', dom.clickbutton('Logout', attr.title('Logout, invalidating this session.'), async function click(e) {
 		await withStatus('Logging out', client.Logout(), e.target);
 		localStorageRemove('webmailcsrftoken');
+		serviceWorkerPost({ type: 'logout' });
 		if (eventSource) {
 			eventSource.close();
 			eventSource = null;
@@ -5977,7 +7098,10 @@ const init = async () => {
 		checkMsglistWidth();
 	});
 	window.addEventListener('hashchange', async () => {
-		const [search, msgid, f, notf] = parseLocationHash(mailboxlistView);
+		let [search, msgid, f, notf] = parseLocationHash(mailboxlistView);
+		if (search) {
+			[f, notf] = await parseSearchServer(search, mailboxlistView);
+		}
 		requestMsgID = msgid;
 		if (search) {
 			mailboxlistView.closeMailbox();
@@ -5989,10 +7113,38 @@ const init = async () => {
 		}
 		await withStatus('Requesting messages', requestNewView(false, f, notf));
 	});
+	// Apply settings from the server, at startup and when changed by another session.
+	// If no settings were saved yet (ID 0), the preferences of this browser are saved
+	// to the server instead.
+	const applyAccountSettings = async (s) => {
+		accountSettingsLoaded = true;
+		if (s.ID === 0) {
+			await accountSettingsSave(withLocalSettings(s));
+			return;
+		}
+		accountSettings = { ...s, ShowHeaders: s.ShowHeaders || [] };
+		const prev = settings;
+		settingsPut({ ...settings, layout: s.Layout, threading: s.Threading, orderAsc: s.OrderAsc, showHTML: s.ShowHTML, showShortcuts: s.ShowShortcuts, showAllHeaders: s.ShowAllHeaders, showHeaders: s.ShowHeaders || [] });
+		if (prev.layout !== settings.layout) {
+			layoutElem.value = settings.layout;
+			if (settings.layout === 'auto') {
+				autoselectLayout();
+			}
+			else {
+				selectLayout(settings.layout);
+			}
+		}
+		if (prev.threading !== settings.threading || prev.orderAsc !== settings.orderAsc) {
+			threadMode.value = settings.threading;
+			orderAscElem.classList.toggle('invert', settings.orderAsc);
+			await withStatus('Requesting messages', requestNewView(false));
+		}
+	};
 	let eventSource = null; // If set, we have a connection.
 	let connecting = false; // Check before reconnecting.
 	let noreconnect = false; // Set after one reconnect attempt fails.
 	let noreconnectTimer = 0; // Timer ID for resetting noreconnect.
+	let knownModSeq = 0; // Highest modseq of changes we have seen, sent to the service worker for queued changes.
 	// Don't show disconnection just before user navigates away.
 	let leaving = false;
 	window.addEventListener('beforeunload', () => {
@@ -6018,6 +7170,54 @@ const init = async () => {
 			connect(true);
 		}
 	});
+	// Reconnect when the network comes back, e.g. on phones with poor connectivity.
+	window.addEventListener('online', () => {
+		if (!eventSource && !connecting) {
+			noreconnect = false;
+			connect(true);
+		}
+	});
+	// The service worker caches recently viewed messages for use while offline, and
+	// queues flag changes and submitted messages while offline. They are replayed
+	// when we are connected again.
+	const serviceWorkerPost = (msg) => {
+		if (window.navigator.serviceWorker && window.navigator.serviceWorker.controller) {
+			window.navigator.serviceWorker.controller.postMessage(msg);
+		}
+	};
+	const updateModSeq = (modseq) => {
+		if (modseq > knownModSeq) {
+			knownModSeq = modseq;
+			serviceWorkerPost({ type: 'modseq', modseq: modseq });
+		}
+	};
+	const plural = (n, s) => n + ' ' + s + (n === 1 ? '' : 's');
+	const serviceWorkerMessage = (msg) => {
+		if (msg.type === 'queued') {
+			dom._kids(offlineElem, attr.role('status'), dom.span(style({ backgroundColor: '#ffca91', padding: '0 .15em', borderRadius: '.15em' }), 'Offline', attr.title('Changes are stored in this browser, and applied when connected again.')), ' ', plural(msg.count, 'queued change'));
+		}
+		else if (msg.type === 'replayed') {
+			const r = msg.result;
+			dom._kids(offlineElem);
+			if (r.pending > 0) {
+				dom._kids(offlineElem, attr.role('status'), plural(r.pending, 'queued change'), ' not yet applied');
+			}
+			if (r.conflicts.length + r.removed.length + r.drafts.length + r.failed.length === 0) {
+				return;
+			}
+			popup(style({ maxWidth: '40em' }), dom.h1('Changes made while offline'), dom.p('Applied ', plural(r.flagsApplied, 'flag change'), ', sent ', plural(r.submitted, 'message'), '.'), r.conflicts.length > 0 ? dom.p('Flags of ', plural(r.conflicts.length, 'message'), ' were not changed because the messages were changed in another session in the meantime. The current flags are shown.') : [], r.removed.length > 0 ? dom.p('Flags of ', plural(r.removed.length, 'message'), ' were not changed because the messages were removed in the meantime.') : [], r.drafts.length > 0 ? [
+				dom.p('Messages that could not be sent have been saved as draft:'),
+				dom.ul(r.drafts.map((s) => dom.li(s))),
+			] : [], r.failed.length > 0 ? [
+				dom.p('Failed changes:'),
+				dom.ul(r.failed.map((s) => dom.li(s))),
+			] : []);
+		}
+	};
+	if (window.navigator.serviceWorker) {
+		window.navigator.serviceWorker.addEventListener('message', (e) => serviceWorkerMessage(e.data || {}));
+		window.navigator.serviceWorker.register('serviceworker.js').catch(err => console.log('registering service worker', err));
+	}
 	const showNotConnected = () => {
 		dom._kids(connectionElem, attr.role('status'), dom.span(style({ backgroundColor: '#ffa9a9', padding: '0 .15em', borderRadius: '.15em' }), 'Not connected', attr.title('Not receiving real-time updates, including of new deliveries.')), ' ', dom.clickbutton('Reconnect', function click() {
 			if (!eventSource && !connecting) {
@@ -6046,6 +7246,9 @@ const init = async () => {
 			return;
 		}
 		let [searchQuery, msgid, f, notf] = parseLocationHash(mailboxlistView);
+		if (searchQuery) {
+			[f, notf] = await parseSearchServer(searchQuery, mailboxlistView);
+		}
 		requestMsgID = msgid;
 		requestFilter = f;
 		requestNotFilter = notf;
@@ -6187,6 +7390,7 @@ const init = async () => {
 				mailboxName = (start.Mailboxes || []).find(mb => mb.ID === requestFilter.MailboxID)?.Name || '';
 			}
 			mailboxlistView.loadMailboxes(start.Mailboxes || [], search.active ? undefined : mailboxName);
+			mailboxlistView.loadSavedSearches().catch(err => console.log('loading saved searches', err));
 			if (searchView.root.parentElement) {
 				searchView.ensureLoaded();
 			}
@@ -6195,6 +7399,12 @@ const init = async () => {
 			}
 			dom._kids(queryactivityElem, 'loading...');
 			msglistscrollElem.appendChild(listloadingElem);
+			applyAccountSettings(start.Settings);
+			accountLabels = start.Labels || [];
+			mailboxlistView.setLabels(accountLabels);
+			// Apply changes made while offline, and update the cache of messages.
+			knownModSeq = start.ModSeq;
+			serviceWorkerPost({ type: 'online', modseq: knownModSeq, headers: [['content-type', 'application/json'], ['x-mox-csrf', localStorageGet('webmailcsrftoken') || '']] });
 			noreconnectTimer = setTimeout(() => {
 				noreconnect = false;
 				noreconnectTimer = 0;
@@ -6267,6 +7477,22 @@ const init = async () => {
 		eventSource.addEventListener('viewChanges', async (e) => {
 			const viewChanges = checkParse(() => api.parser.EventViewChanges(JSON.parse(e.data)));
 			log('event viewChanges', viewChanges);
+			// Settings, labels, the end of undo windows and modseqs apply regardless of the view.
+			for (const tc of viewChanges.Changes || []) {
+				if (tc && (tc[0] === 'ChangeMsgAdd' || tc[0] === 'ChangeMsgRemove' || tc[0] === 'ChangeMsgFlags')) {
+					updateModSeq(tc[1].ModSeq);
+				}
+				if (tc && tc[0] === 'ChangeSettings') {
+					await applyAccountSettings(api.parser.ChangeSettings(tc[1]).Settings);
+				}
+				else if (tc && tc[0] === 'ChangeLabels') {
+					accountLabels = api.parser.ChangeLabels(tc[1]).Labels || [];
+					mailboxlistView.setLabels(accountLabels);
+				}
+				else if (tc && tc[0] === 'ChangeSubmissionUndoEnd') {
+					submitUndoHide(api.parser.ChangeSubmissionUndoEnd(tc[1]).ID);
+				}
+			}
 			if (viewChanges.ViewID !== viewID) {
 				log('received viewChanges for other viewID', { expected: viewID, got: viewChanges.ViewID });
 				return;
@@ -6280,6 +7506,7 @@ const init = async () => {
 					if (tag === 'ChangeMailboxCounts') {
 						const c = api.parser.ChangeMailboxCounts(x);
 						mailboxlistView.setMailboxCounts(c.MailboxID, c.Total, c.Unread);
+						mailboxlistView.updateSavedSearches();
 					}
 					else if (tag === 'ChangeMailboxSpecialUse') {
 						const c = api.parser.ChangeMailboxSpecialUse(x);
@@ -6319,6 +7546,9 @@ const init = async () => {
 						const c = api.parser.ChangeMailboxRename(x);
 						mailboxlistView.renameMailbox(c.MailboxID, c.NewName);
 					}
+					else if (tag === 'ChangeSettings' || tag === 'ChangeLabels' || tag === 'ChangeSubmissionUndoEnd') {
+						// Handled above.
+					}
 					else {
 						throw new Error('unknown change tag ' + tag);
 					}
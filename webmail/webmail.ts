@@ -63,11 +63,11 @@ Enable consistency checking in UI updates:
 	settingsPut({...settings, checkConsistency: true})
 
 - todo: in msglistView, show names of people we have sent to, and address otherwise.
-- todo: implement settings stored in the server, such as mailboxCollapsed, keyboard shortcuts. also new settings for displaying email as html by default for configured sender address or domain. name to use for "From", optional default Reply-To and Bcc addresses, signatures (per address), configured labels/keywords with human-readable name, colors and toggling with shortcut keys 1-9.
+- todo: store more settings in the server, such as mailboxCollapsed, keyboard shortcuts. also new settings for displaying email as html by default for configured sender address or domain. name to use for "From", optional default Reply-To and Bcc addresses, signatures per address, toggling labels with shortcut keys 1-9.
 - todo: in msglist, if our address is in the from header, list addresses in the to/cc/bcc, it's likely a sent folder
 - todo: automated tests? perhaps some unit tests, then ui scenario's.
 - todo: compose, wrap lines
-- todo: composing of html messages. possibly based on contenteditable. would be good if we can include original html, but quoted. must make sure to not include dangerous scripts/resources, or sandbox it.
+- todo: compose html, keep formatting of html replied to when quoting a selection.
 - todo: make alt up/down keys work on html iframe too. requires loading it from sameorigin, to get access to its inner document.
 - todo: reconnect with last known modseq and don't clear the message list, only update it
 - todo: resize and move of compose window
@@ -77,7 +77,7 @@ Enable consistency checking in UI updates:
 - todo: only show orange underline where it could be a problem? in addresses and anchor texts. we may be lighting up a christmas tree now, desensitizing users.
 - todo: saved searches that are displayed below list of mailboxes, for quick access to preset view
 - todo: when search on free-form text is active, highlight the searched text in the message view.
-- todo: composeView: save as draft, periodically and when closing.
+- todo: composeView: also save draft when the browser tab is closed, not only periodically.
 - todo: forwarding of html parts, including inline attachments, so the html version can be rendered like the original by the receiver.
 - todo: buttons/mechanism to operate on all messages in a mailbox/search query, without having to list and select all messages. e.g. clearing flags/labels.
 - todo: can we detect if browser supports proper CSP? if not, refuse to load html messages?
@@ -209,10 +209,98 @@ const settingsPut = (nsettings: typeof defaultSettings) => {
 	} catch (err) {
 		console.log('storing settings in localstorage', err)
 	}
+
+	// Preferences shared by all sessions are also saved on the server.
+	if (accountSettingsLoaded) {
+		const ns = withLocalSettings(accountSettings)
+		if (JSON.stringify(ns) !== JSON.stringify(accountSettings)) {
+			accountSettingsSave(ns)
+		}
+	}
 }
 
 let settings = parseSettings()
 
+// Settings stored on the server, shared by all sessions of the account. Set when
+// the SSE connection is initialized, and updated on ChangeSettings events. The
+// preferences that are also in settings, like layout and threading, are kept in
+// sync with settings.
+let accountSettings: api.Settings = {
+	ID: 0,
+	Signature: '',
+	Quoting: api.Quoting.Default,
+	DefaultFrom: '',
+	SendDelay: 0,
+	Layout: 'auto',
+	Threading: api.ThreadMode.ThreadOn,
+	OrderAsc: false,
+	ShowHTML: false,
+	ShowShortcuts: true,
+	ShowAllHeaders: false,
+	ShowHeaders: [],
+}
+
+// Whether accountSettings have been received from the server. Only then are
+// changed preferences saved to the server.
+let accountSettingsLoaded = false
+
+// Return account settings with the shared preferences from settings.
+const withLocalSettings = (s: api.Settings): api.Settings => {
+	return {
+		...s,
+		Layout: settings.layout,
+		Threading: settings.threading,
+		OrderAsc: settings.orderAsc,
+		ShowHTML: settings.showHTML,
+		ShowShortcuts: settings.showShortcuts,
+		ShowAllHeaders: settings.showAllHeaders,
+		ShowHeaders: settings.showHeaders,
+	}
+}
+
+// Save account settings on the server. Other sessions get a ChangeSettings event.
+const accountSettingsSave = async (s: api.Settings) => {
+	accountSettings = s
+	try {
+		await client.SettingsSave(s)
+	} catch (err) {
+		window.alert('Error saving settings: ' + errmsg(err))
+	}
+}
+
+// Labels defined for the account, with a name and color for a keyword. Set when
+// the SSE connection is initialized, and updated on ChangeLabels events.
+let accountLabels: api.Label[] = []
+
+// Return black or white, whichever is more readable on a background color of the
+// form "#rrggbb".
+const labelTextColor = (color: string): string => {
+	const v = parseInt(color.substring(1), 16)
+	const luminance = 0.299*(v>>16 & 0xff) + 0.587*(v>>8 & 0xff) + 0.114*(v & 0xff)
+	return luminance > 140 ? 'black' : 'white'
+}
+
+// Return the text and styling for showing a keyword, with the name and color of
+// the label for the keyword, if any.
+const keywordKids = (kw: string): ElemArg[] => {
+	const l = accountLabels.find(l => l.Keyword === kw)
+	if (!l) {
+		return [kw]
+	}
+	return [
+		l.Color ? style({backgroundColor: l.Color, borderColor: l.Color, color: labelTextColor(l.Color)}) : [],
+		attr.title('Label "' + l.Name + '", keyword ' + kw),
+		l.Name,
+	]
+}
+
+// Signature from the settings, with the conventional "-- " separator line. Empty
+// if no signature is configured.
+const signatureBlock = (): string => {
+	const sig = accountSettings.Signature.replace(/\r/g, '').replace(/\n+$/, '')
+	return sig ? '-- \n' + sig + '\n' : ''
+}
+
 // All addresses for this account, can include "@domain" wildcard, User is empty in
 // that case. Set when SSE connection is initialized.
 let accountAddresses: api.MessageAddress[] = []
@@ -239,6 +327,8 @@ const login = async (reason: string) => {
 		let autosize: HTMLElement
 		let username: HTMLInputElement
 		let password: HTMLInputElement
+		let totpBox: HTMLElement
+		let totpCode: HTMLInputElement
 		const root = dom.div(
 			style({position: 'absolute', top: 0, right: 0, bottom: 0, left: 0, backgroundColor: '#eee', display: 'flex', alignItems: 'center', justifyContent: 'center', zIndex: zindexes.login, animation: 'fadein .15s ease-in'}),
 			dom.div(
@@ -255,7 +345,7 @@ const login = async (reason: string) => {
 							try {
 								fieldset.disabled = true
 								const loginToken = await client.LoginPrep()
-								const token = await client.Login(loginToken, username.value, password.value)
+								const token = await client.Login(loginToken, username.value, password.value, totpCode.value)
 								try {
 									window.localStorage.setItem('webmailcsrftoken', token)
 								} catch (err) {
@@ -267,6 +357,14 @@ const login = async (reason: string) => {
 								}
 								resolve(token)
 							} catch (err) {
+								if ((err as any).code === 'user:totpRequired') {
+									// Password was correct, ask for the second factor and submit again.
+									totpBox.style.display = ''
+									totpCode.required = true
+									fieldset.disabled = false
+									totpCode.focus()
+									return
+								}
 								console.log('login error', err)
 								window.alert('Error: ' + errmsg(err))
 							} finally {
@@ -292,6 +390,11 @@ const login = async (reason: string) => {
 								dom.div('Password', style({marginBottom: '.5ex'})),
 								password=dom.input(attr.type('password'), attr.required('')),
 							),
+							totpBox=dom.label(
+								style({display: 'none', marginBottom: '2ex'}),
+								dom.div('Two-factor authentication code', style({marginBottom: '.5ex'})),
+								totpCode=dom.input(attr.autocomplete('one-time-code'), attr.title('Code from your authenticator app, or one of your recovery codes.')),
+							),
 							dom.div(
 								style({textAlign: 'center'}),
 								dom.submitbutton('Login'),
@@ -814,6 +917,18 @@ const focusPlaceholder = (s: string): any[] => {
 	]
 }
 
+// Parse search query with the server, falling back to the client-side parser,
+// e.g. for searches with syntax errors.
+const parseSearchServer = async (searchquery: string, mailboxlistView: MailboxlistView): Promise<[api.Filter, api.NotFilter]> => {
+	try {
+		const q = await client.SearchParse(searchquery)
+		return [q.Filter, q.NotFilter]
+	} catch (err) {
+		const [f, notf, ] = parseSearch(searchquery, mailboxlistView)
+		return [f, notf]
+	}
+}
+
 // Parse a location hash into search terms (if any), selected message id (if
 // any) and filters.
 // Optional message id at the end, with ",<num>".
@@ -1053,6 +1168,7 @@ const cmdHelp = async () => {
 						['/', 'search'],
 						['i', 'open inbox'],
 						['?', 'help'],
+						['A', 'contacts'],
 						['ctrl ?', 'tooltip for focused element'],
 						['ctrl m', 'focus message'],
 					].map(t => dom.tr(dom.td(t[0]), dom.td(t[1]))),
@@ -1106,11 +1222,13 @@ const cmdHelp = async () => {
 					dom.tr(dom.td(attr.colspan('2'), dom.h2('Compose', style({margin: '0'})))),
 					[
 						['ctrl Enter', 'send message'],
-						['ctrl w', 'cancel message'],
+						['ctrl s', 'save draft and close'],
+						['ctrl w', 'cancel message, removing its draft'],
 						['ctrl O', 'add To'],
 						['ctrl C', 'add Cc'],
 						['ctrl B', 'add Bcc'],
 						['ctrl Y', 'add Reply-To'],
+						['ctrl H', 'switch between plain text and HTML'],
 						['ctrl -', 'remove current address'],
 						['ctrl +', 'add address of same type'],
 					].map(t => dom.tr(dom.td(t[0]), dom.td(t[1]))),
@@ -1120,6 +1238,7 @@ const cmdHelp = async () => {
 						['r', 'reply or list reply'],
 						['R', 'reply all'],
 						['f', 'forward message'],
+						['e', 'edit draft'],
 						['v', 'view attachments'],
 						['t', 'view text version'],
 						['T', 'view HTML version'],
@@ -1215,6 +1334,378 @@ const cmdTooltip = async () => {
 	)
 }
 
+// Show popup with the settings stored on the server, for all sessions of the
+// account.
+const cmdSettings = async () => {
+	let fieldset: HTMLFieldSetElement
+	let signature: HTMLTextAreaElement
+	let quoting: HTMLSelectElement
+	let defaultFrom: HTMLSelectElement
+	let sendDelay: HTMLSelectElement
+	let showShortcuts: HTMLInputElement
+	let showHTML: HTMLInputElement
+
+	const remove = popup(
+		style({minWidth: '30em'}),
+		dom.h1('Settings'),
+		dom.div(style({marginBottom: '1ex'}), 'Settings are stored on the server and apply to all sessions, also on other devices.'),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				const ns: api.Settings = {
+					...withLocalSettings(accountSettings),
+					Signature: signature.value,
+					Quoting: quoting.value as api.Quoting,
+					DefaultFrom: defaultFrom.value,
+					SendDelay: parseInt(sendDelay.value),
+					ShowShortcuts: showShortcuts.checked,
+					ShowHTML: showHTML.checked,
+				}
+				await withStatus('Saving settings', client.SettingsSave(ns), fieldset)
+				accountSettings = ns
+				settingsPut({...settings, showShortcuts: ns.ShowShortcuts, showHTML: ns.ShowHTML})
+				remove()
+			},
+			fieldset=dom.fieldset(
+				dom.label(
+					style({display: 'block', marginBottom: '1ex'}),
+					dom.div('Signature'),
+					signature=dom.textarea(dom._class('mono'), attr.rows('5'), style({width: '100%'}), new String(accountSettings.Signature)),
+					dom.div(style({fontStyle: 'italic'}), 'Added to new messages and replies, and to messages composed by the server, like replies to invitations.'),
+				),
+				dom.label(
+					style({display: 'block', marginBottom: '1ex'}),
+					dom.div('Quoting in replies'),
+					quoting=dom.select(
+						dom.option('Automatic: write below selected text, above the message otherwise', attr.value(api.Quoting.Default), accountSettings.Quoting === api.Quoting.Default ? attr.selected('') : []),
+						dom.option('Write below quoted message', attr.value(api.Quoting.Bottom), accountSettings.Quoting === api.Quoting.Bottom ? attr.selected('') : []),
+						dom.option('Write above quoted message', attr.value(api.Quoting.Top), accountSettings.Quoting === api.Quoting.Top ? attr.selected('') : []),
+					),
+				),
+				dom.label(
+					style({display: 'block', marginBottom: '1ex'}),
+					dom.div('Default From address'),
+					defaultFrom=dom.select(
+						dom.option('Login address', attr.value('')),
+						accountAddresses.filter(a => a.User).map(a => {
+							const v = formatAddress(a)
+							return dom.option(formatAddressFull(a), attr.value(v), v === accountSettings.DefaultFrom ? attr.selected('') : [])
+						}),
+					),
+				),
+				dom.label(
+					style({display: 'block', marginBottom: '1ex'}),
+					dom.div('Send delay'),
+					sendDelay=dom.select(
+						[0, 10, 20, 30, 60].map(n => dom.option(n === 0 ? 'None, send immediately' : n+' seconds', attr.value(''+n), n === accountSettings.SendDelay ? attr.selected('') : [])),
+					),
+					dom.div(style({fontStyle: 'italic'}), 'Sending a message can be undone during the delay.'),
+				),
+				dom.label(
+					style({display: 'block'}),
+					showShortcuts=dom.input(attr.type('checkbox'), settings.showShortcuts ? attr.checked('') : []),
+					' Briefly show keyboard shortcut when a button is clicked',
+				),
+				dom.label(
+					style({display: 'block'}),
+					showHTML=dom.input(attr.type('checkbox'), settings.showHTML ? attr.checked('') : []),
+					' Show HTML version of messages by default',
+				),
+				dom.div(style({marginTop: '1ex'}), dom.submitbutton('Save')),
+			),
+		),
+	)
+}
+
+// Show popup to create, rename, recolor and remove labels. Renaming the keyword
+// of a label, or removing a label, changes the keywords of all messages.
+const cmdLabels = async () => {
+	const defaultColor = '#ffd700'
+	const labelsElem = dom.div()
+
+	const render = () => {
+		dom._kids(labelsElem,
+			accountLabels.length === 0 ? dom.div(style({marginBottom: '1ex'}), 'No labels yet.') : [],
+			accountLabels.map(l => {
+				let fieldset: HTMLFieldSetElement
+				let color: HTMLInputElement
+				let name: HTMLInputElement
+				let keyword: HTMLInputElement
+
+				return dom.form(
+					async function submit(e: SubmitEvent) {
+						e.preventDefault()
+						e.stopPropagation()
+						if (keyword.value !== l.Keyword && !window.confirm('Change keyword from "' + l.Keyword + '" to "' + keyword.value + '" on all messages?')) {
+							return
+						}
+						if (name.value !== l.Name || keyword.value !== l.Keyword) {
+							await withStatus('Renaming label', client.LabelRename(l.ID, name.value, keyword.value), fieldset)
+						}
+						if (color.value !== (l.Color || defaultColor)) {
+							await withStatus('Changing label color', client.LabelColor(l.ID, color.value), fieldset)
+						}
+						accountLabels = await client.Labels() || []
+						render()
+					},
+					fieldset=dom.fieldset(
+						style({marginBottom: '.5ex'}),
+						color=dom.input(attr.type('color'), attr.value(l.Color || defaultColor), attr.title('Color of label.')),
+						' ',
+						name=dom.input(attr.required(''), attr.value(l.Name), attr.title('Name of label, shown in webmail.')),
+						' ',
+						keyword=dom.input(attr.required(''), attr.value(l.Keyword), attr.title('Keyword stored on messages, as seen by IMAP clients. Lower-case, ascii-only, without spaces and without the following special characters: (){%*"\].')),
+						' ',
+						dom.submitbutton('Save'),
+						' ',
+						dom.clickbutton('Remove', attr.title('Remove label and its keyword from all messages.'), async function click(e: MouseEvent) {
+							if (!window.confirm('Remove label "' + l.Name + '" and remove its keyword from all messages?')) {
+								return
+							}
+							await withStatus('Removing label', client.LabelDelete(l.ID), e.target! as HTMLButtonElement)
+							accountLabels = await client.Labels() || []
+							render()
+						}),
+					),
+				)
+			}),
+		)
+	}
+	render()
+
+	let fieldsetnew: HTMLFieldSetElement
+	let newcolor: HTMLInputElement
+	let newname: HTMLInputElement
+	let newkeyword: HTMLInputElement
+
+	popup(
+		style({minWidth: '30em'}),
+		dom.h1('Labels'),
+		dom.div(style({marginBottom: '1ex'}), 'Labels are keywords on messages, shown with a name and color. IMAP clients see the keywords.'),
+		labelsElem,
+		dom.br(),
+		dom.form(
+			async function submit(e: SubmitEvent) {
+				e.preventDefault()
+				e.stopPropagation()
+				await withStatus('Adding label', client.LabelCreate(newname.value, newkeyword.value, newcolor.value), fieldsetnew)
+				accountLabels = await client.Labels() || []
+				render()
+				newname.value = ''
+				newkeyword.value = ''
+			},
+			fieldsetnew=dom.fieldset(
+				newcolor=dom.input(attr.type('color'), attr.value(defaultColor), attr.title('Color of new label.')),
+				' ',
+				newname=dom.input(attr.required(''), attr.placeholder('Name'), attr.title('Name of new label.')),
+				' ',
+				newkeyword=dom.input(attr.placeholder('Keyword (optional)'), attr.title('Keyword for new label. If empty, the lower-cased name is used.')),
+				' ',
+				dom.submitbutton('Add label'),
+			),
+		),
+	)
+}
+
+// Messages to export with cmdExport. Messages matching any of the fields are
+// exported.
+type ExportSelection = {
+	messageIDs?: number[]
+	threadIDs?: number[] // ThreadID of messages.
+	mailboxIDs?: number[]
+}
+
+// Show popup to export the selected messages as an archive with maildirs or mbox
+// files. The archive is downloaded in a new tab. The browser shows the progress of
+// the download, but does not know its size, so the popup shows the number of
+// exported messages while the archive is written.
+const cmdExport = (title: string, sel: ExportSelection) => {
+	const progressID = Array.from(window.crypto.getRandomValues(new Uint8Array(16))).map(b => ('0'+b.toString(16)).slice(-2)).join('')
+	let form: HTMLFormElement
+	let progressElem: HTMLElement
+
+	// Poll for progress until the export is done or the popup is closed.
+	const poll = async () => {
+		while (progressElem.isConnected) {
+			await new Promise(resolve => window.setTimeout(resolve, 1000))
+			if (!progressElem.isConnected) {
+				break
+			}
+			let p: api.ExportProgress
+			try {
+				p = await client.ExportProgress(progressID)
+			} catch (err) {
+				dom._kids(progressElem, 'Error retrieving export progress: '+errmsg(err))
+				break
+			}
+			if (p.Error) {
+				dom._kids(progressElem, 'Export failed: '+p.Error)
+				break
+			} else if (p.Done) {
+				dom._kids(progressElem, 'Export finished, '+p.Total+' message'+(p.Total === 1 ? '' : 's')+' exported.')
+				break
+			} else if (p.Total > 0) {
+				dom._kids(progressElem, 'Exported '+p.Exported+' of '+p.Total+' messages...')
+			}
+		}
+	}
+
+	popup(
+		dom.h1(title),
+		form=dom.form(
+			attr.target('_blank'), attr.method('POST'), attr.action('export'),
+			function submit() {
+				// Hide after the form has been submitted.
+				window.setTimeout(() => {
+					form.style.display = 'none'
+					progressElem.style.display = ''
+					poll()
+				}, 0)
+			},
+			dom.input(attr.type('hidden'), attr.name('csrf'), attr.value(localStorageGet('webmailcsrftoken') || '')),
+			dom.input(attr.type('hidden'), attr.name('messageids'), attr.value((sel.messageIDs || []).join(','))),
+			dom.input(attr.type('hidden'), attr.name('threadids'), attr.value((sel.threadIDs || []).join(','))),
+			dom.input(attr.type('hidden'), attr.name('mailboxids'), attr.value((sel.mailboxIDs || []).join(','))),
+			dom.input(attr.type('hidden'), attr.name('progressid'), attr.value(progressID)),
+			dom.label(
+				style({display: 'block', marginBottom: '1ex'}),
+				dom.div('Format'),
+				dom.select(attr.name('format'),
+					dom.option('Mbox, a file per mailbox', attr.value('mbox')),
+					dom.option('Maildir, a directory per mailbox', attr.value('maildir')),
+				),
+			),
+			dom.label(
+				style({display: 'block', marginBottom: '1ex'}),
+				dom.div('Archive'),
+				dom.select(attr.name('archive'),
+					dom.option('Zip', attr.value('zip')),
+					dom.option('Tar, gzip-compressed', attr.value('tgz')),
+				),
+			),
+			dom.div(style({marginBottom: '1ex', fontStyle: 'italic'}), 'Flags and labels are included as keywords.'),
+			dom.submitbutton('Export'),
+		),
+		progressElem=dom.div(style({display: 'none'}), 'Preparing export...'),
+	)
+	form.querySelector('select')!.focus()
+}
+
+// Show the address book in a popup, with contacts that can be added, edited and
+// removed, and written to. Contacts are also synchronized with CardDAV clients.
+const cmdContacts = async () => {
+	let contacts = await withStatus('Listing contacts', client.ContactList())
+
+	const lines = (s: string) => s.split('\n').map(s => s.trim()).filter(s => !!s)
+	const addressee = (c: api.Contact, email: string) => {
+		let name = c.Name
+		if (/[()<>\[\]:;@\\,."]/.test(name)) {
+			name = '"' + name.replace(/["\\]/g, s => '\\'+s) + '"'
+		}
+		return name + ' <' + email + '>'
+	}
+
+	let searchElem: HTMLInputElement
+	let listElem: HTMLElement
+	let editElem: HTMLElement
+
+	const render = () => {
+		const s = searchElem.value.toLowerCase()
+		const l = contacts.filter(c => !s || c.Name.toLowerCase().includes(s) || (c.Emails || []).some(e => e.toLowerCase().includes(s)))
+		dom._kids(listElem,
+			l.length === 0 ? dom.div(style({padding: '1ex 0'}), contacts.length === 0 ? 'No contacts yet.' : 'No matching contacts.') : dom.table(
+				dom.tbody(
+					l.map(c => dom.tr(
+						dom.td(dom.a(attr.href('#'), c.Name, function click(e: MouseEvent) {
+							e.preventDefault()
+							edit(c)
+						})),
+						dom.td((c.Emails || []).join(', ')),
+						dom.td((c.Phones || []).join(', ')),
+						dom.td(
+							(c.Emails || []).length === 0 ? [] : dom.clickbutton('Compose', attr.title('Compose a message to the first email address of this contact.'), function click() {
+								remove()
+								compose({to: [addressee(c, (c.Emails || [])[0])]})
+							}),
+						),
+					)),
+				),
+			),
+		)
+	}
+
+	const edit = (c: api.Contact) => {
+		let fieldset: HTMLFieldSetElement
+		let name: HTMLInputElement
+		let emails: HTMLTextAreaElement
+		let phones: HTMLTextAreaElement
+		let note: HTMLTextAreaElement
+
+		const done = () => {
+			dom._kids(editElem)
+			render()
+			searchElem.focus()
+		}
+
+		dom._kids(editElem,
+			dom.form(
+				style({marginTop: '1em', paddingTop: '1ex', borderTop: '1px solid #ddd'}),
+				async function submit(e: SubmitEvent) {
+					e.preventDefault()
+					e.stopPropagation()
+					const nc = await withStatus('Saving contact', client.ContactSave({ID: c.ID, Name: name.value, Emails: lines(emails.value), Phones: lines(phones.value), Note: note.value}), fieldset)
+					contacts = [...contacts.filter(x => x.ID !== nc.ID), nc].sort((a, b) => a.Name.localeCompare(b.Name))
+					done()
+				},
+				fieldset=dom.fieldset(
+					dom.h2(c.ID ? 'Edit contact' : 'New contact'),
+					dom.label(style({display: 'block', marginBottom: '1ex'}), 'Name', dom.br(), name=dom.input(attr.value(c.Name), attr.required(''), style({width: '100%'}))),
+					dom.label(style({display: 'block', marginBottom: '1ex'}), 'Email addresses, one per line', dom.br(), emails=dom.textarea(attr.rows('3'), style({width: '100%'}), (c.Emails || []).join('\n'))),
+					dom.label(style({display: 'block', marginBottom: '1ex'}), 'Phone numbers, one per line', dom.br(), phones=dom.textarea(attr.rows('2'), style({width: '100%'}), (c.Phones || []).join('\n'))),
+					dom.label(style({display: 'block', marginBottom: '1ex'}), 'Note', dom.br(), note=dom.textarea(attr.rows('3'), style({width: '100%'}), c.Note)),
+					dom.div(
+						dom.submitbutton('Save'), ' ',
+						c.ID ? [
+							dom.clickbutton('Delete', async function click() {
+								if (!window.confirm('Are you sure you want to delete this contact?')) {
+									return
+								}
+								await withStatus('Deleting contact', client.ContactDelete(c.ID), fieldset)
+								contacts = contacts.filter(x => x.ID !== c.ID)
+								done()
+							}), ' ',
+						] : [],
+						dom.clickbutton('Cancel', function click() {
+							done()
+						}),
+					),
+				),
+			),
+		)
+		name.focus()
+	}
+
+	const remove = popup(
+		style({minWidth: '40em', maxWidth: '60em'}),
+		dom.h1('Contacts'),
+		dom.p(style({color: '#888'}), 'Contacts are suggested when composing messages, and can be synchronized with other devices over CardDAV.'),
+		dom.div(
+			style({display: 'flex', gap: '.5em', marginBottom: '1ex'}),
+			searchElem=dom.input(attr.placeholder('Search...'), style({flexGrow: '1'}), function input() {
+				render()
+			}),
+			dom.clickbutton('New contact', function click() {
+				edit({ID: 0, Name: '', Emails: [], Phones: [], Note: ''})
+			}),
+		),
+		listElem=dom.div(),
+		editElem=dom.div(),
+	)
+	render()
+	searchElem.focus()
+}
+
 type ComposeOptions = {
 	from?: api.MessageAddress[]
 	// Addressees should be either directly an email address, or the header form "name
@@ -1227,6 +1718,8 @@ type ComposeOptions = {
 	subject?: string
 	isForward?: boolean
 	body?: string
+	// If set, the message is composed as HTML, starting with this HTML.
+	htmlBody?: string
 	// Message from which to show the attachment to include.
 	attachmentsMessageItem?: api.MessageItem
 	// Message is marked as replied/answered or forwarded after submitting, and
@@ -1234,6 +1727,16 @@ type ComposeOptions = {
 	responseMessageID?: number
 	// Whether message is to a list, due to List-Id header.
 	isList?: boolean
+	// Draft message this message continues. It is replaced when saving the draft
+	// again, and removed when the message is sent.
+	draftMessageID?: number
+	// Attachments of the draft, included again when saving or sending.
+	draftAttachments?: api.File[]
+	// From TLS-Required header of the draft.
+	requireTLS?: boolean | null
+	// Position of the cursor in body. By default at the start, or at the end for
+	// replies written below the quoted text.
+	bodyCursor?: number
 }
 
 interface ComposeView {
@@ -1243,7 +1746,60 @@ interface ComposeView {
 
 let composeView: ComposeView | null = null
 
+// Notice with a button to undo sending a message that was submitted with a send
+// delay. Shown until the undo window closes. Only for the most recent submission.
+let submitUndoElem: HTMLElement | null = null
+let submitUndoID = 0
+
+const submitUndoHide = (undoID: number) => {
+	if (undoID !== submitUndoID || !submitUndoElem) {
+		return
+	}
+	submitUndoElem.remove()
+	submitUndoElem = null
+	submitUndoID = 0
+}
+
+// Show notice for a submission that can be undone. On undo, the message is opened
+// as draft in a new composer, with from as From address.
+const submitUndoShow = (r: api.SubmitResult, from?: api.MessageAddress[]) => {
+	submitUndoHide(submitUndoID)
+	const undoID = r.UndoID
+	submitUndoID = undoID
+	submitUndoElem = dom.div(
+		style({position: 'fixed', bottom: '1ex', left: '50%', transform: 'translateX(-50%)', zIndex: zindexes.compose, backgroundColor: '#ffffaa', border: '1px solid #ccc', boxShadow: '0px 0px 20px rgba(0, 0, 0, 0.1)', padding: '.5em 1em', borderRadius: '.25em'}),
+		'Message sent. ',
+		dom.clickbutton('Undo', attr.title('Remove the message from the delivery queue and open it as draft again.'), async function click(e: MouseEvent) {
+			const draftID = await withStatus('Undoing send', client.MessageSubmitUndo(undoID), e.target! as HTMLButtonElement)
+			submitUndoHide(undoID)
+			const sm = await withStatus('Opening draft', client.MessageDraftOpen(draftID))
+			compose({
+				from: from,
+				to: sm.To || [],
+				cc: sm.Cc || [],
+				bcc: sm.Bcc || [],
+				replyto: sm.ReplyTo,
+				subject: sm.Subject,
+				body: sm.TextBody,
+				htmlBody: sm.HTMLBody || undefined,
+				responseMessageID: sm.ResponseMessageID,
+				draftMessageID: sm.DraftMessageID,
+				draftAttachments: sm.Attachments || [],
+				requireTLS: sm.RequireTLS,
+			})
+		}),
+	)
+	document.body.appendChild(submitUndoElem)
+	// The server sends a ChangeSubmissionUndoEnd when the undo window closes, but the
+	// connection may be down at that moment.
+	window.setTimeout(() => submitUndoHide(undoID), r.UndoUntil.getTime() - new Date().getTime())
+}
+
 const compose = (opts: ComposeOptions) => {
+	// New messages start with the signature.
+	if (opts.body === undefined && opts.htmlBody === undefined && !opts.draftMessageID && signatureBlock()) {
+		opts = {...opts, body: '\n\n' + signatureBlock()}
+	}
 	log('compose', opts)
 
 	if (composeView) {
@@ -1258,6 +1814,12 @@ const compose = (opts: ComposeOptions) => {
 		checkbox: HTMLInputElement
 	}
 
+	type DraftAttachmentView = {
+		root: HTMLElement
+		file: api.File
+		checkbox: HTMLInputElement
+	}
+
 	type AddrView = {
 		root: HTMLElement
 		input: HTMLInputElement
@@ -1271,6 +1833,9 @@ const compose = (opts: ComposeOptions) => {
 	let subjectAutosize: HTMLElement
 	let subject: HTMLInputElement
 	let body: HTMLTextAreaElement
+	let htmlEditor: HTMLElement
+	let htmlToolbar: HTMLElement
+	let htmlImage: HTMLInputElement
 	let attachments: HTMLInputElement
 	let requiretls: HTMLSelectElement
 
@@ -1279,13 +1844,36 @@ const compose = (opts: ComposeOptions) => {
 	let toRow: HTMLElement, replyToRow: HTMLElement, ccRow: HTMLElement, bccRow: HTMLElement // We show/hide rows as needed.
 	let toViews: AddrView[] = [], replytoViews: AddrView[] = [], ccViews: AddrView[] = [], bccViews: AddrView[] = []
 	let forwardAttachmentViews: ForwardAttachmentView[] = []
+	let draftAttachmentViews: DraftAttachmentView[] = []
+	let draftStatus: HTMLElement
+
+	let draftMessageID = opts.draftMessageID || 0
+	let draftSaved = '' // JSON of message as last saved, to only save when changed.
+	let draftSaving = false
+	// Random ID for this message, so it is sent only once, also when a submission is
+	// retried by the service worker.
+	const submitID = Array.from(window.crypto.getRandomValues(new Uint8Array(16))).map(b => ('0'+b.toString(16)).slice(-2)).join('')
+	let closed = false
+	let htmlMode = !!opts.htmlBody
 
-	const cmdCancel = async () => {
+	const close = () => {
+		closed = true
+		window.clearInterval(autosaveID)
 		composeElem.remove()
 		composeView = null
 	}
 
-	const submit = async () => {
+	const cmdCancel = async () => {
+		if (draftMessageID) {
+			if (!window.confirm('Discard message and remove its draft?')) {
+				return
+			}
+			await withStatus('Removing draft', client.MessageDraftDelete(draftMessageID))
+		}
+		close()
+	}
+
+	const composedMessage = async (): Promise<api.SubmitMessage> => {
 		const files = await new Promise<api.File[]>((resolve, reject) => {
 			const l: api.File[] = []
 			if (attachments.files && attachments.files.length === 0) {
@@ -1312,9 +1900,11 @@ const compose = (opts: ComposeOptions) => {
 			replyTo = replytoViews[0].input.value
 		}
 
+		files.push(...draftAttachmentViews.filter(v => v.checkbox.checked).map(v => v.file))
+
 		const forwardAttachmentPaths = forwardAttachmentViews.filter(v => v.checkbox.checked).map(v => v.path)
 
-		const message = {
+		const message: api.SubmitMessage = {
 			From: customFrom ? customFrom.value : from.value,
 			To: toViews.map(v => v.input.value).filter(s => s),
 			Cc: ccViews.map(v => v.input.value).filter(s => s),
@@ -1322,21 +1912,136 @@ const compose = (opts: ComposeOptions) => {
 			ReplyTo: replyTo,
 			UserAgent: 'moxwebmail/'+moxversion,
 			Subject: subject.value,
-			TextBody: body.value,
+			TextBody: htmlMode ? '' : body.value,
+			HTMLBody: htmlMode ? htmlEditor.innerHTML : '',
 			Attachments: files,
 			ForwardAttachments: forwardAttachmentPaths.length === 0 ? {MessageID: 0, Paths: []} : {MessageID: opts.attachmentsMessageItem!.Message.ID, Paths: forwardAttachmentPaths},
 			IsForward: opts.isForward || false,
 			ResponseMessageID: opts.responseMessageID || 0,
 			RequireTLS: requiretls.value === '' ? null : requiretls.value === 'yes',
+			DraftMessageID: 0,
+			SubmitID: '',
+		}
+		return message
+	}
+
+	const submit = async () => {
+		draftSaving = true // Prevent autosave while sending.
+		let result: api.SubmitResult
+		let fromAddr: api.MessageAddress | undefined
+		try {
+			const message = await composedMessage()
+			message.DraftMessageID = draftMessageID
+			message.SubmitID = submitID
+			fromAddr = accountAddresses.find(a => formatAddressFull(a) === message.From)
+			result = await client.MessageSubmit(message)
+		} finally {
+			draftSaving = false
+		}
+		close()
+		if (result.UndoID) {
+			submitUndoShow(result, fromAddr ? [fromAddr] : opts.from)
+		}
+	}
+
+	// Save message as draft, replacing the previous draft, if it changed since the
+	// last save.
+	const saveDraft = async () => {
+		if (draftSaving) {
+			return
+		}
+		draftSaving = true
+		try {
+			const message = await composedMessage()
+			const s = JSON.stringify(message)
+			if (s === draftSaved) {
+				return
+			}
+			message.DraftMessageID = draftMessageID
+			draftMessageID = await client.MessageDraftSave(message)
+			draftSaved = s
+			dom._kids(draftStatus, 'Draft saved at '+new Date().toLocaleTimeString()+'.')
+		} finally {
+			draftSaving = false
 		}
-		await client.MessageSubmit(message)
-		cmdCancel()
 	}
 
+	const autosaveID = window.setInterval(async () => {
+		if (closed) {
+			return
+		}
+		try {
+			await saveDraft()
+		} catch (err) {
+			dom._kids(draftStatus, 'Error saving draft: '+errmsg(err))
+		}
+	}, 30*1000)
+
 	const cmdSend = async () => {
 		await withStatus('Sending email', submit(), fieldset)
 	}
 
+	const cmdSaveDraft = async () => {
+		await withStatus('Saving draft', saveDraft(), fieldset)
+		close()
+	}
+
+	// Text of the message, for checking mentions of attachments.
+	const bodyText = () => htmlMode ? htmlEditor.innerText : body.value
+
+	const showHTMLMode = () => {
+		body.style.display = htmlMode ? 'none' : ''
+		htmlToolbar.style.display = htmlMode ? '' : 'none'
+		htmlEditor.style.display = htmlMode ? '' : 'none'
+	}
+
+	// Switch between composing plain text and HTML. Formatting is lost when
+	// switching to plain text.
+	const cmdToggleHTML = async () => {
+		if (htmlMode) {
+			if (!window.confirm('Switch to plain text? Formatting and inline images are removed.')) {
+				return
+			}
+			body.value = htmlEditor.innerText
+			htmlMode = false
+		} else {
+			dom._kids(htmlEditor, body.value.split('\n').map((line, i) => [i > 0 ? dom.br() : [], new String(line)]))
+			htmlMode = true
+		}
+		showHTMLMode()
+		if (htmlMode) {
+			htmlEditor.focus()
+		} else {
+			body.focus()
+		}
+	}
+
+	const htmlCommand = (command: string, value?: string) => {
+		htmlEditor.focus()
+		document.execCommand(command, false, value)
+	}
+
+	const cmdHTMLLink = async () => {
+		const url = window.prompt('Link to URL', 'https://')
+		if (url && url !== 'https://') {
+			htmlCommand('createLink', url)
+		}
+	}
+
+	// Insert image files as data URIs, they are sent as inline parts.
+	const insertImages = (files: File[]) => {
+		for (const f of files) {
+			if (!f.type.startsWith('image/')) {
+				continue
+			}
+			const fr = new window.FileReader()
+			fr.addEventListener('load', () => {
+				htmlCommand('insertImage', fr.result as string)
+			})
+			fr.readAsDataURL(f)
+		}
+	}
+
 	const cmdAddTo = async () => { newAddrView('', true, toViews, toBtn, toCell, toRow) }
 	const cmdAddCc = async () => { newAddrView('', true, ccViews, ccBtn, ccCell, ccRow) }
 	const cmdAddBcc = async () => { newAddrView('', true, bccViews, bccBtn, bccCell, bccRow) }
@@ -1352,11 +2057,13 @@ const compose = (opts: ComposeOptions) => {
 
 	const shortcuts: {[key: string]: command} = {
 		'ctrl Enter': cmdSend,
+		'ctrl s': cmdSaveDraft,
 		'ctrl w': cmdCancel,
 		'ctrl O': cmdAddTo,
 		'ctrl C': cmdAddCc,
 		'ctrl B': cmdAddBcc,
 		'ctrl Y': cmdReplyTo,
+		'ctrl H': cmdToggleHTML,
 		// ctrl - and ctrl = (+) not included, they are handled by keydown handlers on in the inputs they remove/add.
 	}
 
@@ -1552,7 +2259,7 @@ const compose = (opts: ComposeOptions) => {
 
 	let noAttachmentsWarning: HTMLElement
 	const checkAttachments = () => {
-		const missingAttachments = !attachments.files?.length && !forwardAttachmentViews.find(v => v.checkbox.checked) && !!body.value.split('\n').find(s => !s.startsWith('>') && s.match(/attach(ed|ment)/))
+		const missingAttachments = !attachments.files?.length && !forwardAttachmentViews.find(v => v.checkbox.checked) && !draftAttachmentViews.find(v => v.checkbox.checked) && !!bodyText().split('\n').find(s => !s.startsWith('>') && s.match(/attach(ed|ment)/))
 		noAttachmentsWarning.style.display = missingAttachments ? '' : 'none'
 	}
 
@@ -1577,7 +2284,8 @@ const compose = (opts: ComposeOptions) => {
 
 	let haveFrom = false
 	const fromOptions = accountAddresses.map(a => {
-		const selected = opts.from && opts.from.length === 1 && equalAddress(a, opts.from[0]) || loginAddress && equalAddress(a, loginAddress) && (!opts.from || envelopeIdentity(opts.from))
+		const isDefault = accountSettings.DefaultFrom ? formatAddress(a) === accountSettings.DefaultFrom : loginAddress && equalAddress(a, loginAddress)
+		const selected = opts.from && opts.from.length === 1 && equalAddress(a, opts.from[0]) || isDefault && (!opts.from || envelopeIdentity(opts.from))
 		const o = dom.option(formatAddressFull(a), selected ? attr.selected('') : [])
 		if (selected) {
 			haveFrom = true
@@ -1617,7 +2325,7 @@ const compose = (opts: ComposeOptions) => {
 							dom.span('From:'),
 						),
 						dom.td(
-							dom.clickbutton('Cancel', style({float: 'right', marginLeft: '1em', marginTop: '.15em'}), attr.title('Close window, discarding message.'), clickCmd(cmdCancel, shortcuts)),
+							dom.clickbutton('Cancel', style({float: 'right', marginLeft: '1em', marginTop: '.15em'}), attr.title('Close window, discarding message and removing its draft.'), clickCmd(cmdCancel, shortcuts)),
 							from=dom.select(
 								attr.required(''),
 								style({width: 'auto'}),
@@ -1670,12 +2378,62 @@ const compose = (opts: ComposeOptions) => {
 					// Explicit string object so it doesn't get the highlight-unicode-block-changes
 					// treatment, which would cause characters to disappear.
 					new String(opts.body || ''),
-					opts.body && !opts.isForward && !opts.body.startsWith('\n\n') ? prop({selectionStart: opts.body.length, selectionEnd: opts.body.length}) : [],
+					opts.bodyCursor !== undefined ? prop({selectionStart: opts.bodyCursor, selectionEnd: opts.bodyCursor}) : (opts.body && !opts.isForward && !opts.body.startsWith('\n\n') ? prop({selectionStart: opts.body.length, selectionEnd: opts.body.length}) : []),
+					function keyup(e: KeyboardEvent) {
+						if (e.key === 'Enter') {
+							checkAttachments()
+						}
+					},
+				),
+				htmlToolbar=dom.div(
+					style({margin: '.25em 0'}),
+					dom.clickbutton(dom.b('B'), attr.title('Bold.'), function click() { htmlCommand('bold') }), ' ',
+					dom.clickbutton(dom.span('I', style({fontStyle: 'italic'})), attr.title('Italic.'), function click() { htmlCommand('italic') }), ' ',
+					dom.clickbutton(dom.span('U', style({textDecoration: 'underline'})), attr.title('Underline.'), function click() { htmlCommand('underline') }), ' ',
+					dom.clickbutton('List', attr.title('Bulleted list.'), function click() { htmlCommand('insertUnorderedList') }), ' ',
+					dom.clickbutton('1. List', attr.title('Numbered list.'), function click() { htmlCommand('insertOrderedList') }), ' ',
+					dom.clickbutton('Quote', attr.title('Quote text.'), function click() { htmlCommand('formatBlock', 'blockquote') }), ' ',
+					dom.clickbutton('Link', attr.title('Make a link of the selected text.'), clickCmd(cmdHTMLLink, shortcuts)), ' ',
+					dom.clickbutton('Image', attr.title('Insert an image, sent as part of the message.'), function click() { htmlImage.click() }), ' ',
+					dom.clickbutton('Clear', attr.title('Remove formatting from the selected text.'), function click() { htmlCommand('removeFormat') }),
+					htmlImage=dom.input(attr.type('file'), attr.multiple(''), style({display: 'none'}), function change() {
+						insertImages([...(htmlImage.files || [])])
+						htmlImage.value = ''
+					}),
+				),
+				htmlEditor=dom.div(
+					dom._attrs({contenteditable: 'true'}),
+					style({width: '100%', minHeight: '20em', maxHeight: '60vh', overflowY: 'auto', border: '1px solid #ccc', padding: '.25em', boxSizing: 'border-box'}),
 					function keyup(e: KeyboardEvent) {
 						if (e.key === 'Enter') {
 							checkAttachments()
 						}
 					},
+					function paste(e: ClipboardEvent) {
+						const files = [...(e.clipboardData?.files || [])].filter(f => f.type.startsWith('image/'))
+						if (files.length > 0) {
+							e.preventDefault()
+							insertImages(files)
+							return
+						}
+						const pastedHTML = e.clipboardData?.getData('text/html')
+						const sel = window.getSelection()
+						if (pastedHTML && sel && sel.rangeCount > 0) {
+							e.preventDefault()
+							const range = sel.getRangeAt(0)
+							range.deleteContents()
+							const frag = document.createDocumentFragment()
+							frag.append(...sanitizeEditHTML(pastedHTML))
+							const last = frag.lastChild
+							range.insertNode(frag)
+							if (last) {
+								range.setStartAfter(last)
+								range.collapse(true)
+								sel.removeAllRanges()
+								sel.addRange(range)
+							}
+						}
+					},
 				),
 				!(opts.attachmentsMessageItem && opts.attachmentsMessageItem.Attachments && opts.attachmentsMessageItem.Attachments.length > 0) ? [] : dom.div(
 					style({margin: '.5em 0'}),
@@ -1696,6 +2454,20 @@ const compose = (opts: ComposeOptions) => {
 						forwardAttachmentViews.forEach(v => v.checkbox.checked = (e.target! as HTMLInputElement).checked)
 					}), ' (Toggle all)')
 				),
+				!(opts.draftAttachments && opts.draftAttachments.length > 0) ? [] : dom.div(
+					style({margin: '.5em 0'}),
+					'Draft attachments: ',
+					draftAttachmentViews=opts.draftAttachments.map(f => {
+						const checkbox = dom.input(attr.type('checkbox'), attr.checked(''), function change() { checkAttachments() })
+						const root = dom.label(checkbox, ' '+(f.Filename || '(unnamed)')+' ')
+						const v: DraftAttachmentView = {
+							root: root,
+							file: f,
+							checkbox: checkbox,
+						}
+						return v
+					}),
+				),
 				noAttachmentsWarning=dom.div(style({display: 'none', backgroundColor: '#fcd284', padding: '0.15em .25em', margin: '.5em 0'}), 'Message mentions attachments, but no files are attached.'),
 				dom.label(style({margin: '1ex 0', display: 'block'}), 'Attachments ', attachments=dom.input(attr.type('file'), attr.multiple(''), function change() { checkAttachments() })),
 				dom.label(
@@ -1710,7 +2482,10 @@ const compose = (opts: ComposeOptions) => {
 				),
 				dom.div(
 					style({margin: '3ex 0 1ex 0', display: 'block'}),
-					dom.submitbutton('Send'),
+					dom.submitbutton('Send'), ' ',
+					dom.clickbutton('Save draft', attr.title('Save message as draft in the Drafts mailbox and close window. Drafts are also saved automatically while composing.'), clickCmd(cmdSaveDraft, shortcuts)), ' ',
+					dom.clickbutton('HTML', attr.title('Switch between composing plain text and formatted HTML, with inline images.'), clickCmd(cmdToggleHTML, shortcuts)), ' ',
+					draftStatus=dom.span(style({color: '#666'})),
 				),
 			),
 			async function submit(e: SubmitEvent) {
@@ -1722,6 +2497,11 @@ const compose = (opts: ComposeOptions) => {
 
 	subjectAutosize.dataset.value = subject.value
 
+	if (opts.htmlBody) {
+		htmlEditor.append(...sanitizeEditHTML(opts.htmlBody))
+	}
+	showHTMLMode()
+
 	;(opts.to && opts.to.length > 0 ? opts.to : ['']).forEach(s => newAddrView(s, true, toViews, toBtn, toCell, toRow))
 	;(opts.cc || []).forEach(s => newAddrView(s,true,  ccViews, ccBtn, ccCell, ccRow))
 	;(opts.bcc || []).forEach(s => newAddrView(s, true, bccViews, bccBtn, bccCell, bccRow))
@@ -1737,14 +2517,22 @@ const compose = (opts: ComposeOptions) => {
 	if (!opts.replyto) {
 		replyToRow.style.display = 'none'
 	}
+	if (opts.requireTLS !== undefined && opts.requireTLS !== null) {
+		requiretls.value = opts.requireTLS ? 'yes' : 'no'
+	}
 
 	document.body.appendChild(composeElem)
 	if (toViews.length > 0 && !toViews[0].input.value) {
 		toViews[0].input.focus()
+	} else if (htmlMode) {
+		htmlEditor.focus()
 	} else {
 		body.focus()
 	}
 
+	// Only save a draft once the message has changed.
+	composedMessage().then(m => { draftSaved = JSON.stringify(m) })
+
 	composeView = {
 		root: composeElem,
 		key: keyHandler(shortcuts),
@@ -1752,6 +2540,97 @@ const compose = (opts: ComposeOptions) => {
 	return composeView
 }
 
+// Elements and attributes allowed in HTML in the compose editor, which is part of
+// the webmail page, not an isolated frame. Like sanitizeEditNode on the server.
+// Other elements are replaced by their children, or removed with their children
+// if in editDropElements.
+const editElements = new Set([
+	'a', 'abbr', 'address', 'article', 'aside', 'b', 'big', 'blockquote', 'br',
+	'caption', 'center', 'cite', 'code', 'col', 'colgroup', 'dd', 'del', 'div',
+	'dl', 'dt', 'em', 'figcaption', 'figure', 'font', 'footer', 'h1', 'h2',
+	'h3', 'h4', 'h5', 'h6', 'header', 'hr', 'i', 'img', 'ins', 'li',
+	'main', 'mark', 'nav', 'ol', 'p', 'pre', 'q', 's', 'section', 'small',
+	'span', 'strike', 'strong', 'sub', 'sup', 'table', 'tbody', 'td', 'tfoot',
+	'th', 'thead', 'tr', 'tt', 'u', 'ul',
+])
+const editDropElements = new Set([
+	'head', 'script', 'style', 'template', 'iframe', 'frame', 'frameset', 'object',
+	'embed', 'applet', 'noscript', 'noembed', 'noframes', 'svg', 'math', 'title',
+	'meta', 'link', 'base', 'textarea', 'select', 'option', 'audio', 'video',
+	'source', 'track', 'canvas', 'map', 'area', 'input', 'button', 'dialog',
+])
+const editAttributes = new Set([
+	'align', 'alt', 'bgcolor', 'border', 'cellpadding', 'cellspacing', 'color',
+	'colspan', 'dir', 'face', 'height', 'href', 'lang', 'rowspan', 'size',
+	'span', 'src', 'start', 'style', 'title', 'type', 'valign', 'value', 'width',
+])
+
+// editAttributeOK returns whether an attribute is allowed in the compose editor.
+// Links must be http, https or mailto URLs, images must be inline data: URIs, and
+// styles cannot reference external resources.
+const editAttributeOK = (name: string, value: string): boolean => {
+	if (!editAttributes.has(name)) {
+		return false
+	}
+	// Browsers ignore control characters and spaces in URLs, e.g. in "java\tscript:".
+	const v = value.replace(/[\u0000-\u0020]/g, '').toLowerCase()
+	if (name === 'href') {
+		return v.startsWith('http:') || v.startsWith('https:') || v.startsWith('mailto:')
+	} else if (name === 'src') {
+		return v.startsWith('data:image/')
+	} else if (name === 'style') {
+		return !v.includes('url(') && !v.includes('image-set(') && !v.includes('expression(') && !v.includes('@import') && !v.includes('\\')
+	}
+	return true
+}
+
+// sanitizeEditHTML parses html in an inert document, and returns new nodes with
+// only the allowed elements and attributes, for inserting in the compose editor.
+// The parsed nodes themselves are never inserted, and the result isn't parsed
+// again.
+const sanitizeEditHTML = (html: string): Node[] => {
+	const doc = new DOMParser().parseFromString(html, 'text/html')
+	const copy = (n: Node): Node[] => {
+		if (n.nodeType === Node.TEXT_NODE) {
+			return [document.createTextNode(n.textContent || '')]
+		} else if (n.nodeType !== Node.ELEMENT_NODE) {
+			return []
+		}
+		const e = n as Element
+		const name = e.localName
+		if (e.namespaceURI !== 'http://www.w3.org/1999/xhtml' || editDropElements.has(name)) {
+			return []
+		}
+		const kids = [...e.childNodes].flatMap(c => copy(c))
+		if (!editElements.has(name)) {
+			return kids
+		}
+		const ne = document.createElement(name)
+		for (const a of [...e.attributes]) {
+			if (!a.namespaceURI && editAttributeOK(a.name, a.value)) {
+				ne.setAttribute(a.name, a.value)
+			}
+		}
+		if (name === 'a') {
+			ne.setAttribute('target', '_blank')
+			ne.setAttribute('rel', 'noopener noreferrer')
+		}
+		ne.append(...kids)
+		return [ne]
+	}
+	return [...doc.body.childNodes].flatMap(c => copy(c))
+}
+
+// Fetch the HTML of a message for quoting in a reply, sanitized for the compose
+// editor. Images other than inline images are removed.
+const quoteHTML = async (msgID: number): Promise<Node[]> => {
+	const resp = await fetch('msg/'+msgID+'/html')
+	if (!resp.ok) {
+		throw new Error('fetching html: '+resp.statusText)
+	}
+	return sanitizeEditHTML(await resp.text())
+}
+
 // Show popover to edit labels for msgs.
 const labelsPopover = (e: MouseEvent, msgs: api.Message[], possibleLabels: possibleLabels): void => {
 	if (msgs.length === 0) {
@@ -1785,7 +2664,7 @@ const labelsPopover = (e: MouseEvent, msgs: api.Message[], possibleLabels: possi
 							},
 						),
 						' ',
-						dom.span(dom._class('keyword'), l),
+						dom.span(dom._class('keyword'), keywordKids(l)),
 					),
 				)
 			),
@@ -1968,7 +2847,7 @@ const newMsgitemView = (mi: api.MessageItem, msglistView: MsglistView, otherMail
 		// Keywords are normally shown per message. For collapsed threads, we show the
 		// keywords of the thread root message as normal, and any additional keywords from
 		// children in a way that draws less attention.
-		const keywords = (m.Keywords || []).map(kw => dom.span(dom._class('keyword'), kw))
+		const keywords = (m.Keywords || []).map(kw => dom.span(dom._class('keyword'), keywordKids(kw)))
 		if (msgitemView.isCollapsedThreadRoot()) {
 			const keywordsSeen = new Set<string>()
 			for (const kw of (m.Keywords || [])) {
@@ -1978,7 +2857,7 @@ const newMsgitemView = (mi: api.MessageItem, msglistView: MsglistView, otherMail
 				for (const kw of (miv.messageitem.Message.Keywords || [])) {
 					if (!keywordsSeen.has(kw)) {
 						keywordsSeen.add(kw)
-						keywords.push(dom.span(dom._class('keyword'), dom._class('keywordcollapsed'), kw))
+						keywords.push(dom.span(dom._class('keyword'), dom._class('keywordcollapsed'), keywordKids(kw)))
 					}
 				}
 			}
@@ -2358,21 +3237,45 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 			body = pm.Texts[0]
 		}
 		body = body.replace(/\r/g, '').replace(/\n\n\n\n*/g, '\n\n').trim()
+		const sig = signatureBlock()
+		let htmlBody: string | undefined
+		let bodyCursor: number | undefined
 		if (forward) {
-			body = '\n\n---- Forwarded Message ----\n\n'+body
+			body = '\n\n' + (sig ? sig + '\n' : '') + '---- Forwarded Message ----\n\n'+body
 		} else {
 			body = body.split('\n').map(line => '> ' + line).join('\n')
-			if (haveSel) {
-				body += '\n\n'
+			let onWroteLine = ''
+			if (!haveSel && mi.Envelope.Date && mi.Envelope.From && mi.Envelope.From.length === 1) {
+				const from = mi.Envelope.From[0]
+				const name = from.Name || formatEmailAddress(from)
+				const datetime = mi.Envelope.Date.toLocaleDateString(undefined, {weekday: "short", year: "numeric", month: "short", day: "numeric"}) + ' at ' + mi.Envelope.Date.toLocaleTimeString()
+				onWroteLine = 'On ' + datetime + ', ' + name + ' wrote:\n'
+			}
+			// By default, we write below selected text, and above the full message.
+			if (accountSettings.Quoting === api.Quoting.Bottom || accountSettings.Quoting === api.Quoting.Default && haveSel) {
+				body = onWroteLine + body + '\n\n'
+				bodyCursor = body.length
+				if (sig) {
+					body += '\n' + sig
+				}
 			} else {
-				let onWroteLine = ''
-				if (mi.Envelope.Date && mi.Envelope.From && mi.Envelope.From.length === 1) {
-					const from = mi.Envelope.From[0]
-					const name = from.Name || formatEmailAddress(from)
-					const datetime = mi.Envelope.Date.toLocaleDateString(undefined, {weekday: "short", year: "numeric", month: "short", day: "numeric"}) + ' at ' + mi.Envelope.Date.toLocaleTimeString()
-					onWroteLine = 'On ' + datetime + ', ' + name + ' wrote:\n'
+				body = '\n\n' + (sig ? sig + '\n' : '') + onWroteLine + body
+
+				// Keep the formatting of HTML messages by replying in HTML, unless only selected
+				// text is quoted.
+				if (pm.HasHTML && !haveSel) {
+					try {
+						const quote = document.createElement('blockquote')
+						quote.style.borderLeft = '2px solid #ccc'
+						quote.style.margin = '0 0 0 .5em'
+						quote.style.paddingLeft = '.5em'
+						quote.append(...await quoteHTML(m.ID))
+						const sigElems = sig ? [dom.div(dom.br()), sig.trim().split('\n').map(line => dom.div(line ? new String(line) : dom.br()))] : []
+						htmlBody = dom.div(dom.div(dom.br()), sigElems, dom.div(dom.br()), onWroteLine ? dom.div(new String(onWroteLine.trim())) : [], quote).innerHTML
+					} catch (err) {
+						log('fetching html for quoting, replying in plain text', err)
+					}
 				}
-				body = '\n\n' + onWroteLine + body
 			}
 		}
 		const subjectPrefix = forward ? 'Fwd:' : 'Re:'
@@ -2385,10 +3288,12 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 			bcc: bcc.map(a => formatAddress(a)),
 			subject: subject,
 			body: body,
+			htmlBody: htmlBody,
 			isForward: forward,
 			attachmentsMessageItem: forward ? mi : undefined,
 			responseMessageID: m.ID,
 			isList: m.IsMailingList,
+			bodyCursor: bodyCursor,
 		}
 		if (all) {
 			opts.to = (to || []).concat((mi.Envelope.To || []).filter(a => !envelopeIdentity([a]))).map(a => formatAddress(a))
@@ -2414,6 +3319,26 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 	}
 	const cmdReply = async () => { await reply(false) }
 	const cmdReplyAll = async () => { await reply(true) }
+	const cmdEditDraft = async () => {
+		if (!isDraft) {
+			return
+		}
+		const sm = await withStatus('Opening draft', client.MessageDraftOpen(m.ID))
+		compose({
+			from: mi.Envelope.From || undefined,
+			to: sm.To || [],
+			cc: sm.Cc || [],
+			bcc: sm.Bcc || [],
+			replyto: sm.ReplyTo,
+			subject: sm.Subject,
+			body: sm.TextBody,
+			htmlBody: sm.HTMLBody || undefined,
+			responseMessageID: sm.ResponseMessageID,
+			draftMessageID: sm.DraftMessageID,
+			draftAttachments: sm.Attachments || [],
+			requireTLS: sm.RequireTLS,
+		})
+	}
 	const cmdPrint = async () => {
 		if (urlType) {
 			window.open('msg/'+m.ID+'/msg'+urlType+'#print', '_blank')
@@ -2493,6 +3418,45 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 		)
 	}
 
+	const cmdExplainJunk = async () => {
+		const x = await withStatus('Classifying message with junk filter', client.JunkExplain(m.ID))
+		const c = x.Classification
+		const wordTable = (title: string, l: api.WordProbability[]) => dom.div(
+			dom.h1(title),
+			l.length === 0 ? dom.div('None.') : dom.table(
+				dom.thead(
+					dom.tr(
+						dom.th('Word'),
+						dom.th('Spam probability', attr.title('Between 0 (ham) and 1 (spam).')),
+						dom.th('Ham', attr.title('Number of trained non-junk messages containing the word.')),
+						dom.th('Spam', attr.title('Number of trained junk messages containing the word.')),
+					),
+				),
+				dom.tbody(
+					l.map(w =>
+						dom.tr(
+							dom.td(w.Word),
+							dom.td(style({textAlign: 'right'}), w.Probability.toFixed(3)),
+							dom.td(style({textAlign: 'right'}), ''+w.Ham),
+							dom.td(style({textAlign: 'right'}), ''+w.Spam),
+						)
+					),
+				),
+			),
+		)
+		popup(
+			style({maxWidth: '60em'}),
+			dom.h1('Junk classification'),
+			dom.p('Spam probability ' + c.Probability.toFixed(3) + ', ' + (c.Probability > x.Threshold ? 'above' : 'below') + ' the threshold of ' + x.Threshold + ' for rejecting incoming messages.'),
+			dom.p(c.Known + ' of ' + c.Words + ' words (combinations) of the message are known to the junk filter, which is trained with ' + c.Hams + ' non-junk and ' + c.Spams + ' junk messages. The probability is calculated from the most hammy and spammy words below. The classification is made with the current junk filter, and may differ from the classification at the time of delivery.'),
+			dom.div(
+				style({display: 'flex', gap: '2em'}),
+				wordTable('Top ham words', c.TopHam || []),
+				wordTable('Top spam words', c.TopSpam || []),
+			),
+		)
+	}
+
 	const cmdUp = async () => { msgscrollElem.scrollTo({top: msgscrollElem.scrollTop - 3*msgscrollElem.getBoundingClientRect().height / 4, behavior: 'smooth'}) }
 	const cmdDown = async () => { msgscrollElem.scrollTo({top: msgscrollElem.scrollTop + 3*msgscrollElem.getBoundingClientRect().height / 4, behavior: 'smooth'}) }
 	const cmdHome = async () => { msgscrollElem.scrollTo({top: 0 }) }
@@ -2506,6 +3470,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 		f: cmdForward,
 		r: cmdReply,
 		R: cmdReplyAll,
+		e: cmdEditDraft,
 		v: cmdViewAttachments,
 		t: cmdShowText,
 		T: cmdShowHTMLCycle,
@@ -2530,7 +3495,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 
 	let urlType: string // text, html, htmlexternal; for opening in new tab/print
 
-	let msgbuttonElem: HTMLElement, msgheaderElem: HTMLElement, msgattachmentElem: HTMLElement, msgmodeElem: HTMLElement
+	let msgbuttonElem: HTMLElement, msgheaderElem: HTMLElement, msgattachmentElem: HTMLElement, msginviteElem: HTMLElement, msgmodeElem: HTMLElement
 	let msgheaderdetailsElem: HTMLElement | null = null // When full headers are visible, or some headers are requested through settings.
 
 	const msgmetaElem = dom.div(
@@ -2541,6 +3506,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 			attr.arialive('assertive'),
 			msgheaderElem=dom.table(dom._class('msgheaders'), style({marginBottom: '1ex', width: '100%'})),
 			msgattachmentElem=dom.div(),
+			msginviteElem=dom.div(),
 			msgmodeElem=dom.div(),
 		),
 		// Explicit gray line with white border below that separates headers from body, to
@@ -2557,11 +3523,13 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 	)
 
 	const trashMailboxID = listMailboxes().find(mb => mb.Trash)?.ID
+	const isDraft = m.Draft || m.MailboxID === listMailboxes().find(mb => mb.Draft)?.ID
 
 	// Initially called with potentially null pm, once loaded called again with pm set.
 	const loadButtons = (pm: api.ParsedMessage | null) => {
 		dom._kids(msgbuttonElem,
 			dom.div(dom._class('pad'),
+				!isDraft ? [] : [dom.clickbutton('Edit draft', attr.title('Continue composing this draft message.'), clickCmd(cmdEditDraft, shortcuts)), ' '],
 				(!pm || !pm.ListReplyAddress) ? [] : dom.clickbutton('Reply to list', attr.title('Compose a reply to this mailing list.'), clickCmd(cmdReplyList, shortcuts)), ' ',
 				(pm && pm.ListReplyAddress && formatEmailAddress(pm.ListReplyAddress) === fromAddress) ? [] : dom.clickbutton('Reply', attr.title('Compose a reply to the sender of this message.'), clickCmd(cmdReply, shortcuts)), ' ',
 				(mi.Envelope.To || []).length <= 1 && (mi.Envelope.CC || []).length === 0 && (mi.Envelope.BCC || []).length === 0 ? [] :
@@ -2592,7 +3560,14 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 								dom.clickbutton('Unmute thread', clickCmd(msglistView.cmdUnmute, shortcuts)),
 								dom.clickbutton('Open in new tab', clickCmd(cmdOpenNewTab, shortcuts)),
 								dom.clickbutton('Show raw original message in new tab', clickCmd(cmdOpenRaw, shortcuts)),
+								dom.clickbutton('Export message', attr.title('Download this message as mbox or maildir archive.'), function click() {
+									cmdExport('Export message', {messageIDs: [m.ID]})
+								}),
+								dom.clickbutton('Export thread', attr.title('Download all messages of the thread of this message, in all mailboxes.'), function click() {
+									cmdExport('Export thread', {threadIDs: [m.ThreadID]})
+								}),
 								dom.clickbutton('Show internals in popup', clickCmd(cmdShowInternals, shortcuts)),
+								dom.clickbutton('Explain junk classification', attr.title('Show the words that determine the junk filter classification of this message.'), clickCmd(cmdExplainJunk, shortcuts)),
 							].map(b => dom.div(b)),
 						),
 					)
@@ -2863,6 +3838,83 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 		})
 	}
 
+	// Show meeting invitations, replies and cancellations, with their status based on
+	// earlier replies, and buttons to reply to invitations.
+	const loadInvites = async (pm: api.ParsedMessage) => {
+		const invites = pm.Invites || []
+		if (invites.length === 0) {
+			return
+		}
+		const statuses = await withStatus('Fetching invitation status', client.InviteStatuses(m.ID)) || []
+
+		const formatTime = (d: Date, allDay: boolean) => {
+			const date = d.toLocaleDateString(undefined, {weekday: 'short', year: 'numeric', month: 'short', day: 'numeric', timeZone: allDay ? 'UTC' : undefined})
+			return allDay ? date : date + ' ' + d.toLocaleTimeString(undefined, {hour: '2-digit', minute: '2-digit'})
+		}
+		const formatAddress = (a: api.CalendarAddress) => a.Name ? a.Name + ' <' + a.Address + '>' : a.Address
+		const methods: {[method: string]: string} = {REQUEST: 'Invitation', REPLY: 'Reply to invitation', CANCEL: 'Cancelled event'}
+
+		dom._kids(msginviteElem,
+			invites.map((inv, index) => {
+				const events = inv.Calendar.Events || []
+				if (events.length === 0) {
+					return []
+				}
+				const ev = events[0]
+				const st = statuses[index]
+				const answered = st && st.PartStat ? 'You replied "' + st.PartStat.toLowerCase() + '" on ' + formatTime(st.Replied, false) + '.' : ''
+				let status = ''
+				if (st && st.Cancelled) {
+					status = 'The organizer cancelled this event. ' + answered
+				} else if (st && st.Updated) {
+					status = 'The event was updated after you replied. ' + answered + ' You can reply again.'
+				} else {
+					status = answered
+				}
+				const canReply = inv.Calendar.Method === 'REQUEST' && !(st && st.Cancelled)
+
+				let fieldset: HTMLFieldSetElement
+				let comment: HTMLInputElement
+				const reply = async (partStat: string) => {
+					await withStatus('Sending reply', client.CalendarReply(m.ID, inv.Path || [], partStat, comment.value), fieldset)
+					dom._kids(msginviteElem)
+					await loadInvites(pm)
+				}
+
+				return dom.div(dom._class('pad'),
+					style({borderTop: '1px solid #ccc'}),
+					dom.div(
+						dom.span(methods[inv.Calendar.Method] || 'Event', ': ', style({color: '#555'})),
+						dom.b(ev.Summary || '(no title)'),
+					),
+					dom.div(
+						formatTime(ev.Start, ev.AllDay),
+						ev.End.getFullYear() > 1 && !(ev.AllDay && ev.End.getTime() - ev.Start.getTime() <= 24*3600*1000) ? ' – ' + formatTime(ev.AllDay ? new Date(ev.End.getTime() - 24*3600*1000) : ev.End, ev.AllDay) : [],
+						ev.Recurrence ? dom.span(' (recurring)', attr.title(ev.Recurrence)) : [],
+					),
+					ev.Location ? dom.div('Location: ' + ev.Location) : [],
+					ev.Organizer.Address ? dom.div('Organizer: ' + formatAddress(ev.Organizer)) : [],
+					(ev.Attendees || []).length === 0 ? [] : dom.div(
+						'Attendees: ',
+						join((ev.Attendees || []).map(a => dom.span(formatAddress(a), a.PartStat && a.PartStat !== 'NEEDS-ACTION' ? ' (' + a.PartStat.toLowerCase() + ')' : [])), () => ', '),
+					),
+					status ? dom.div(style({marginTop: '.5ex'}), dom.span(status, style({backgroundColor: st && (st.Cancelled || st.Updated) ? '#ffca91' : '', padding: '0 .15em'}))) : [],
+					!canReply ? [] : dom.div(style({marginTop: '.5ex'}),
+						fieldset=dom.fieldset(
+							dom.span(dom._class('btngroup'),
+								dom.clickbutton('Accept', async function click() { await reply('ACCEPTED') }),
+								dom.clickbutton('Tentative', async function click() { await reply('TENTATIVE') }),
+								dom.clickbutton('Decline', async function click() { await reply('DECLINED') }),
+							),
+							' ',
+							comment=dom.input(attr.placeholder('Optional comment for organizer')),
+						),
+					),
+				)
+			}),
+		)
+	}
+
 	const mv: MsgView = {
 		root: root,
 		messageitem: mi,
@@ -2899,6 +3951,7 @@ const newMsgView = (miv: MsgitemView, msglistView: MsglistView, listMailboxes: l
 		loadButtons(pm)
 		loadHeaderDetails(pm)
 		loadMoreHeaders(pm)
+		loadInvites(pm)
 
 		const htmlNote = 'In the HTML viewer, the following potentially dangerous functionality is disabled: submitting forms, starting a download from a link, navigating away from this page by clicking a link. If a link does not work, try explicitly opening it in a new tab.'
 		const haveText = pm.Texts && pm.Texts.length > 0
@@ -3433,7 +4486,10 @@ const newMsglistView = (msgElem: HTMLElement, listMailboxes: listMailboxes, setL
 							dom.clickbutton('Mark Read', clickCmd(cmdMarkRead, shortcuts)), ' ',
 							dom.clickbutton('Mark Unread', clickCmd(cmdMarkUnread, shortcuts)), ' ',
 							dom.clickbutton('Mute thread', clickCmd(cmdMute, shortcuts)), ' ',
-							dom.clickbutton('Unmute thread', clickCmd(cmdUnmute, shortcuts)),
+							dom.clickbutton('Unmute thread', clickCmd(cmdUnmute, shortcuts)), ' ',
+							dom.clickbutton('Export...', attr.title('Download the selected messages as mbox or maildir archive.'), function click() {
+								cmdExport('Export '+effselected.length+' messages', {messageIDs: effselected.map(miv => miv.messageitem.Message.ID)})
+							}),
 						),
 					),
 				),
@@ -4468,6 +5524,19 @@ const newMailboxView = (xmb: api.Mailbox, mailboxlistView: MailboxlistView, othe
 						await withStatus('Emptying mailbox', client.MailboxEmpty(mbv.mailbox.ID))
 					}),
 				),
+				dom.div(
+					dom.clickbutton('Export mailbox', attr.title('Download the messages of this mailbox as mbox or maildir archive.'), function click() {
+						remove()
+						cmdExport('Export mailbox '+mbv.mailbox.Name, {mailboxIDs: [mbv.mailbox.ID]})
+					}),
+				),
+				mailboxlistView.mailboxes().find(mb => mb.Name.startsWith(mbv.mailbox.Name+'/')) ? dom.div(
+					dom.clickbutton('Export mailbox and children', attr.title('Download the messages of this mailbox and the mailboxes inside it as mbox or maildir archive.'), function click() {
+						remove()
+						const ids = mailboxlistView.mailboxes().filter(mb => mb.ID === mbv.mailbox.ID || mb.Name.startsWith(mbv.mailbox.Name+'/')).map(mb => mb.ID)
+						cmdExport('Export mailbox '+mbv.mailbox.Name+' and children', {mailboxIDs: ids})
+					}),
+				) : [],
 				dom.div(
 					dom.clickbutton('Rename mailbox', function click() {
 						remove()
@@ -4685,9 +5754,16 @@ interface MailboxlistView {
 	setMailboxCounts: (mailboxID: number, total: number, unread: number) => void
 	setMailboxSpecialUse: (mailboxID: number, specialUse: api.SpecialUse) => void
 	setMailboxKeywords: (mailboxID: number, keywords: string[]) => void
+
+	// Saved searches, shown below the mailboxes.
+	loadSavedSearches: () => Promise<void>
+	updateSavedSearches: () => void // Reload counts soon, after changes to messages.
+
+	// Labels, shown below the saved searches.
+	setLabels: (labels: api.Label[]) => void
 }
 
-const newMailboxlistView = (msglistView: MsglistView, requestNewView: requestNewView, updatePageTitle: updatePageTitle, setLocationHash: setLocationHash, unloadSearch: unloadSearch, otherMailbox: otherMailbox): MailboxlistView => {
+const newMailboxlistView = (msglistView: MsglistView, requestNewView: requestNewView, updatePageTitle: updatePageTitle, setLocationHash: setLocationHash, unloadSearch: unloadSearch, otherMailbox: otherMailbox, openSearch: openSearch): MailboxlistView => {
 	let mailboxViews: MailboxView[] = []
 	let mailboxViewActive: MailboxView | null
 
@@ -4790,6 +5866,8 @@ const newMailboxlistView = (msglistView: MsglistView, requestNewView: requestNew
 
 	const root = dom.div()
 	const mailboxesElem = dom.div()
+	const savedSearchesElem = dom.div()
+	const labelsElem = dom.div()
 
 	dom._kids(root,
 		dom.div(attr.role('region'), attr.arialabel('Mailboxes'),
@@ -4820,8 +5898,92 @@ const newMailboxlistView = (msglistView: MsglistView, requestNewView: requestNew
 			),
 			mailboxesElem,
 		),
+		savedSearchesElem,
+		labelsElem,
 	)
 
+	// Saved searches are shown as virtual mailboxes, with their number of unread
+	// messages, as calculated by the server.
+	let savedSearchesTimer = 0
+	const loadSavedSearches = async () => {
+		const l = await client.SavedSearches() || []
+		dom._kids(savedSearchesElem, l.length === 0 ? [] : dom.div(attr.role('region'), attr.arialabel('Saved searches'),
+			style({marginTop: '1ex'}),
+			dom.h1('Saved searches', style({fontSize: 'inherit'})),
+			l.map(ss =>
+				dom.div(dom._class('mailboxitem'),
+					attr.tabindex('0'),
+					attr.title('Search: ' + ss.Search),
+					async function keydown(e: KeyboardEvent) {
+						if (e.key === 'Enter') {
+							e.stopPropagation()
+							await openSearch(ss.Search)
+						}
+					},
+					async function click() {
+						await openSearch(ss.Search)
+					},
+					dom.div(dom._class('mailbox'),
+						style({display: 'flex', justifyContent: 'space-between'}),
+						dom.div(style({whiteSpace: 'nowrap', overflow: 'hidden', textOverflow: 'ellipsis'}), ss.Name),
+						dom.div(
+							style({whiteSpace: 'nowrap'}),
+							dom.clickbutton(dom._class('mailboxhoveronly'),
+								'x',
+								attr.tabindex('-1'),
+								attr.arialabel('Remove saved search'),
+								attr.title('Remove saved search.'),
+								async function click(e: MouseEvent) {
+									e.stopPropagation()
+									if (!window.confirm('Are you sure you want to remove saved search "' + ss.Name + '"?')) {
+										return
+									}
+									await withStatus('Removing saved search', client.SavedSearchDelete(ss.ID))
+									await loadSavedSearches()
+								},
+							),
+							' ',
+							dom.b(dom._class('silenttitle'), ss.Unread === 0 ? [] : [''+ss.Unread, attr.title(''+ss.Unread+' unread')]),
+						),
+					),
+				),
+			),
+		))
+	}
+
+	// Labels are shown with their color, clicking searches for messages with the label.
+	const setLabels = (labels: api.Label[]) => {
+		dom._kids(labelsElem, dom.div(attr.role('region'), attr.arialabel('Labels'),
+			style({marginTop: '1ex'}),
+			dom.div(
+				dom.h1('Labels', style({display: 'inline', fontSize: 'inherit'})),
+				' ',
+				dom.clickbutton('...', attr.arialabel('Edit labels.'), attr.title('Create, rename, recolor and remove labels.'), style({padding: '0 .25em'}), function click() {
+					cmdLabels()
+				}),
+			),
+			labels.map(l =>
+				dom.div(dom._class('mailboxitem'),
+					attr.tabindex('0'),
+					attr.title('Search messages with label.'),
+					async function keydown(e: KeyboardEvent) {
+						if (e.key === 'Enter') {
+							e.stopPropagation()
+							await openSearch('label:' + l.Keyword)
+						}
+					},
+					async function click() {
+						await openSearch('label:' + l.Keyword)
+					},
+					dom.div(dom._class('mailbox'),
+						style({whiteSpace: 'nowrap', overflow: 'hidden', textOverflow: 'ellipsis'}),
+						dom.span(dom._class('keyword'), keywordKids(l.Keyword)),
+					),
+				),
+			),
+		))
+	}
+
 	const loadMailboxes = (mailboxes: api.Mailbox[], mbnameOpt?: string) => {
 		mailboxViews = mailboxes.map(mb => newMailboxView(mb, mblv, otherMailbox))
 		updateMailboxNames()
@@ -4952,6 +6114,23 @@ const newMailboxlistView = (msglistView: MsglistView, requestNewView: requestNew
 			}
 			mbv.setKeywords(keywords)
 		},
+
+		setLabels: setLabels,
+		loadSavedSearches: loadSavedSearches,
+		updateSavedSearches: (): void => {
+			// Changes often come in batches, we only reload once.
+			if (savedSearchesTimer || savedSearchesElem.children.length === 0) {
+				return
+			}
+			savedSearchesTimer = window.setTimeout(async () => {
+				savedSearchesTimer = 0
+				try {
+					await loadSavedSearches()
+				} catch (err) {
+					console.log('updating saved searches', err)
+				}
+			}, 2000)
+		},
 	}
 	return mblv
 }
@@ -5393,6 +6572,20 @@ const newSearchView = (searchbarElem: HTMLInputElement, mailboxlistView: Mailbox
 				),
 				dom.div(
 					style({padding: '1ex', textAlign: 'right'}),
+					dom.clickbutton('Save search...', attr.title('Save the search, showing it below the mailboxes with its number of unread messages.'), async function click(e: MouseEvent) {
+						const q = searchbarElem.value.trim()
+						if (!q) {
+							window.alert('Search is empty.')
+							return
+						}
+						const name = window.prompt('Name for saved search', '')
+						if (!name) {
+							return
+						}
+						await withStatus('Saving search', client.SavedSearchSave(name, q), e.target! as HTMLButtonElement)
+						await mailboxlistView.loadSavedSearches()
+					}),
+					' ',
 					dom.submitbutton('Search'),
 				),
 				async function submit(e: SubmitEvent) {
@@ -5404,8 +6597,9 @@ const newSearchView = (searchbarElem: HTMLInputElement, mailboxlistView: Mailbox
 	)
 
 	const submit = async (): Promise<void> => {
-		const [f, notf, _] = parseSearch(searchbarElem.value, mailboxlistView)
-		await startSearch(f, notf)
+		// The server parses the search, it knows the full syntax, including OR groups.
+		const q = await withStatus('Parsing search', client.SearchParse(searchbarElem.value))
+		await startSearch(q.Filter, q.NotFilter)
 	}
 
 	let loaded = false
@@ -5435,12 +6629,14 @@ type requestNewView = (clearMsgID: boolean, filterOpt?: api.Filter, notFilterOpt
 type updatePageTitle = () => void
 type setLocationHash = () => void
 type unloadSearch = () => void
+type openSearch = (q: string) => Promise<void>
 type otherMailbox = (mailboxID: number) => api.Mailbox | null
 type possibleLabels = () => string[]
 type listMailboxes = () => api.Mailbox[]
 
 const init = async () => {
 	let connectionElem: HTMLElement // SSE connection status/error. Empty when connected.
+	let offlineElem: HTMLElement // Status of changes made while offline.
 	let layoutElem: HTMLSelectElement // Select dropdown for layout.
 	let loginAddressElem: HTMLElement
 
@@ -5510,6 +6706,11 @@ const init = async () => {
 		search = {active: false, query: ''}
 		searchView.root.remove()
 	}
+	const openSearch = async (q: string) => {
+		searchbarElem.value = q
+		const query = await withStatus('Parsing search', client.SearchParse(q))
+		await startSearch(query.Filter, query.NotFilter)
+	}
 	const clearList = () => {
 		msglistView.clear()
 		listendElem.remove()
@@ -5578,19 +6779,18 @@ const init = async () => {
 	)
 
 	// Returns possible labels based, either from active mailbox (possibly from search), or all mailboxes.
+	// Keywords of defined labels are always included.
 	const possibleLabels = (): string[] => {
-		if (requestFilter.MailboxID > 0) {
-			const mb = mailboxlistView.findMailboxByID(requestFilter.MailboxID)
-			if (mb) {
-				return mb.Keywords || []
-			}
-		}
 		const all: {[key: string]: undefined} = {}
-		mailboxlistView.mailboxes().forEach(mb => {
-			for (const k of (mb.Keywords || [])) {
+		for (const l of accountLabels) {
+			all[l.Keyword] = undefined
+		}
+		const mb = requestFilter.MailboxID > 0 ? mailboxlistView.findMailboxByID(requestFilter.MailboxID) : null
+		for (const xmb of mb ? [mb] : mailboxlistView.mailboxes()) {
+			for (const k of (xmb.Keywords || [])) {
 				all[k] = undefined
 			}
-		})
+		}
 		const l = Object.keys(all)
 		l.sort()
 		return l
@@ -5618,7 +6818,7 @@ const init = async () => {
 	const otherMailbox = (mailboxID: number): api.Mailbox | null => requestFilter.MailboxID !== mailboxID ? (mailboxlistView.findMailboxByID(mailboxID) || null) : null
 	const listMailboxes = () => mailboxlistView.mailboxes()
 	const msglistView = newMsglistView(msgElem, listMailboxes, setLocationHash, otherMailbox, possibleLabels, () => msglistscrollElem ? msglistscrollElem.getBoundingClientRect().height : 0, refineKeyword, viewportEnsureMessages)
-	const mailboxlistView = newMailboxlistView(msglistView, requestNewView, updatePageTitle, setLocationHash, unloadSearch, otherMailbox)
+	const mailboxlistView = newMailboxlistView(msglistView, requestNewView, updatePageTitle, setLocationHash, unloadSearch, otherMailbox, openSearch)
 
 	let refineUnreadBtn: HTMLButtonElement, refineReadBtn: HTMLButtonElement, refineAttachmentsBtn: HTMLButtonElement, refineLabelBtn: HTMLButtonElement
 	const refineToggleActive = (btn: HTMLButtonElement | null): void => {
@@ -5631,6 +6831,7 @@ const init = async () => {
 	}
 
 	let threadMode: HTMLSelectElement
+	let orderAscElem: HTMLButtonElement
 
 	let msglistElem = dom.div(dom._class('msglist'),
 		style({position: 'absolute', left: '0', right: 0, top: 0, bottom: 0, display: 'flex', flexDirection: 'column'}),
@@ -5684,7 +6885,7 @@ const init = async () => {
 											remove()
 										}
 										return dom.div(
-											dom.clickbutton(dom._class('keyword'), l, async function click() {
+											dom.clickbutton(dom._class('keyword'), keywordKids(l), async function click() {
 												await selectLabel()
 											}),
 										)
@@ -5729,7 +6930,7 @@ const init = async () => {
 					},
 				),
 				' ',
-				dom.clickbutton('↑↓', attr.title('Toggle sorting by date received.'), settings.orderAsc ? dom._class('invert') : [], async function click(e: MouseEvent) {
+				orderAscElem=dom.clickbutton('↑↓', attr.title('Toggle sorting by date received.'), settings.orderAsc ? dom._class('invert') : [], async function click(e: MouseEvent) {
 					settingsPut({...settings, orderAsc: !settings.orderAsc})
 					;(e.target! as HTMLButtonElement).classList.toggle('invert', settings.orderAsc)
 					// We don't want to include the currently selected message because it could cause a
@@ -5900,6 +7101,7 @@ const init = async () => {
 		'?': cmdHelp,
 		'ctrl ?': cmdTooltip,
 		c: cmdCompose,
+		A: cmdContacts,
 		'ctrl m': cmdFocusMsg,
 	}
 
@@ -5924,7 +7126,7 @@ const init = async () => {
 							attr.placeholder('Search...'),
 							style({position: 'relative', width: '100%'}),
 							attr.title('Search messages based on criteria like matching free-form text, in a mailbox, labels, addressees.'),
-							focusPlaceholder('word "with space" -notword mb:Inbox f:from@x.example t:rcpt@x.example start:2023-7-1 end:2023-7-8 s:"subject" a:images l:$Forwarded h:Reply-To:other@x.example minsize:500kb'),
+							focusPlaceholder('word "with space" -notword mb:Inbox f:from@x.example t:rcpt@x.example start:2023-7-1 end:2023-7-8 s:"subject" a:image l:$Forwarded is:unread h:Reply-To:other@x.example minsize:500kb f:a@x.example OR f:b@x.example'),
 							function click() {
 								cmdSearch()
 								showShortcut('/')
@@ -5987,6 +7189,7 @@ const init = async () => {
 					),
 				),
 				connectionElem=dom.div(),
+				offlineElem=dom.div(),
 				statusElem=dom.div(style({marginLeft: '.5em', flexGrow: '1'}), attr.role('status')),
 				dom.div(
 					style({paddingLeft: '1em'}),
@@ -6004,6 +7207,12 @@ const init = async () => {
 							}
 						},
 					), ' ',
+					dom.clickbutton('Contacts', attr.title('Show contacts in the address book, for adding, editing and writing to contacts.'), clickCmd(cmdContacts, shortcuts)),
+					' ',
+					dom.clickbutton('Settings', attr.title('Settings like signature and default From address, stored on the server for all sessions.'), function click() {
+						cmdSettings()
+					}),
+					' ',
 					dom.clickbutton('Tooltip', attr.title('Show tooltips, based on the title attributes (underdotted text) for the focused element and all user interface elements below it. Use the keyboard shortcut "ctrl ?" instead of clicking on the tooltip button, which changes focus to the tooltip button.'), clickCmd(cmdTooltip, shortcuts)),
 					' ',
 					dom.clickbutton('Help', attr.title('Show popup with basic usage information and a keyboard shortcuts.'), clickCmd(cmdHelp, shortcuts)),
@@ -6013,6 +7222,7 @@ const init = async () => {
 					dom.clickbutton('Logout', attr.title('Logout, invalidating this session.'), async function click(e: MouseEvent) {
 						await withStatus('Logging out', client.Logout(), e.target! as HTMLButtonElement)
 						localStorageRemove('webmailcsrftoken')
+						serviceWorkerPost({type: 'logout'})
 						if (eventSource) {
 							eventSource.close()
 							eventSource = null
@@ -6253,7 +7463,10 @@ const init = async () => {
 	})
 
 	window.addEventListener('hashchange', async () => {
-		const [search, msgid, f, notf] = parseLocationHash(mailboxlistView)
+		let [search, msgid, f, notf] = parseLocationHash(mailboxlistView)
+		if (search) {
+			[f, notf] = await parseSearchServer(search, mailboxlistView)
+		}
 
 		requestMsgID = msgid
 		if (search) {
@@ -6267,10 +7480,38 @@ const init = async () => {
 	})
 
 
+	// Apply settings from the server, at startup and when changed by another session.
+	// If no settings were saved yet (ID 0), the preferences of this browser are saved
+	// to the server instead.
+	const applyAccountSettings = async (s: api.Settings) => {
+		accountSettingsLoaded = true
+		if (s.ID === 0) {
+			await accountSettingsSave(withLocalSettings(s))
+			return
+		}
+		accountSettings = {...s, ShowHeaders: s.ShowHeaders || []}
+		const prev = settings
+		settingsPut({...settings, layout: s.Layout, threading: s.Threading as api.ThreadMode, orderAsc: s.OrderAsc, showHTML: s.ShowHTML, showShortcuts: s.ShowShortcuts, showAllHeaders: s.ShowAllHeaders, showHeaders: s.ShowHeaders || []})
+		if (prev.layout !== settings.layout) {
+			layoutElem.value = settings.layout
+			if (settings.layout === 'auto') {
+				autoselectLayout()
+			} else {
+				selectLayout(settings.layout)
+			}
+		}
+		if (prev.threading !== settings.threading || prev.orderAsc !== settings.orderAsc) {
+			threadMode.value = settings.threading
+			orderAscElem.classList.toggle('invert', settings.orderAsc)
+			await withStatus('Requesting messages', requestNewView(false))
+		}
+	}
+
 	let eventSource: EventSource | null = null // If set, we have a connection.
 	let connecting = false // Check before reconnecting.
 	let noreconnect = false // Set after one reconnect attempt fails.
 	let noreconnectTimer = 0 // Timer ID for resetting noreconnect.
+	let knownModSeq = 0 // Highest modseq of changes we have seen, sent to the service worker for queued changes.
 
 	// Don't show disconnection just before user navigates away.
 	let leaving = false
@@ -6300,6 +7541,71 @@ const init = async () => {
 		}
 	})
 
+	// Reconnect when the network comes back, e.g. on phones with poor connectivity.
+	window.addEventListener('online', () => {
+		if (!eventSource && !connecting) {
+			noreconnect = false
+			connect(true)
+		}
+	})
+
+	// The service worker caches recently viewed messages for use while offline, and
+	// queues flag changes and submitted messages while offline. They are replayed
+	// when we are connected again.
+	const serviceWorkerPost = (msg: any) => {
+		if (window.navigator.serviceWorker && window.navigator.serviceWorker.controller) {
+			window.navigator.serviceWorker.controller.postMessage(msg)
+		}
+	}
+
+	const updateModSeq = (modseq: number) => {
+		if (modseq > knownModSeq) {
+			knownModSeq = modseq
+			serviceWorkerPost({type: 'modseq', modseq: modseq})
+		}
+	}
+
+	const plural = (n: number, s: string) => n + ' ' + s + (n === 1 ? '' : 's')
+
+	const serviceWorkerMessage = (msg: any) => {
+		if (msg.type === 'queued') {
+			dom._kids(offlineElem,
+				attr.role('status'),
+				dom.span(style({backgroundColor: '#ffca91', padding: '0 .15em', borderRadius: '.15em'}), 'Offline', attr.title('Changes are stored in this browser, and applied when connected again.')),
+				' ', plural(msg.count, 'queued change'),
+			)
+		} else if (msg.type === 'replayed') {
+			const r = msg.result
+			dom._kids(offlineElem)
+			if (r.pending > 0) {
+				dom._kids(offlineElem, attr.role('status'), plural(r.pending, 'queued change'), ' not yet applied')
+			}
+			if (r.conflicts.length + r.removed.length + r.drafts.length + r.failed.length === 0) {
+				return
+			}
+			popup(
+				style({maxWidth: '40em'}),
+				dom.h1('Changes made while offline'),
+				dom.p('Applied ', plural(r.flagsApplied, 'flag change'), ', sent ', plural(r.submitted, 'message'), '.'),
+				r.conflicts.length > 0 ? dom.p('Flags of ', plural(r.conflicts.length, 'message'), ' were not changed because the messages were changed in another session in the meantime. The current flags are shown.') : [],
+				r.removed.length > 0 ? dom.p('Flags of ', plural(r.removed.length, 'message'), ' were not changed because the messages were removed in the meantime.') : [],
+				r.drafts.length > 0 ? [
+					dom.p('Messages that could not be sent have been saved as draft:'),
+					dom.ul(r.drafts.map((s: string) => dom.li(s))),
+				] : [],
+				r.failed.length > 0 ? [
+					dom.p('Failed changes:'),
+					dom.ul(r.failed.map((s: string) => dom.li(s))),
+				] : [],
+			)
+		}
+	}
+
+	if (window.navigator.serviceWorker) {
+		window.navigator.serviceWorker.addEventListener('message', (e: MessageEvent) => serviceWorkerMessage(e.data || {}))
+		window.navigator.serviceWorker.register('serviceworker.js').catch(err => console.log('registering service worker', err))
+	}
+
 	const showNotConnected = () => {
 		dom._kids(connectionElem,
 			attr.role('status'),
@@ -6337,6 +7643,9 @@ const init = async () => {
 		}
 
 		let [searchQuery, msgid, f, notf] = parseLocationHash(mailboxlistView)
+		if (searchQuery) {
+			[f, notf] = await parseSearchServer(searchQuery, mailboxlistView)
+		}
 		requestMsgID = msgid
 		requestFilter = f
 		requestNotFilter = notf
@@ -6487,6 +7796,7 @@ const init = async () => {
 				mailboxName = (start.Mailboxes || []).find(mb => mb.ID === requestFilter.MailboxID)?.Name || ''
 			}
 			mailboxlistView.loadMailboxes(start.Mailboxes || [], search.active ? undefined : mailboxName)
+			mailboxlistView.loadSavedSearches().catch(err => console.log('loading saved searches', err))
 			if (searchView.root.parentElement) {
 				searchView.ensureLoaded()
 			}
@@ -6497,6 +7807,14 @@ const init = async () => {
 			dom._kids(queryactivityElem, 'loading...')
 			msglistscrollElem.appendChild(listloadingElem)
 
+			applyAccountSettings(start.Settings)
+			accountLabels = start.Labels || []
+			mailboxlistView.setLabels(accountLabels)
+
+			// Apply changes made while offline, and update the cache of messages.
+			knownModSeq = start.ModSeq
+			serviceWorkerPost({type: 'online', modseq: knownModSeq, headers: [['content-type', 'application/json'], ['x-mox-csrf', localStorageGet('webmailcsrftoken') || '']]})
+
 			noreconnectTimer = setTimeout(() => {
 				noreconnect = false
 				noreconnectTimer = 0
@@ -6575,6 +7893,22 @@ const init = async () => {
 		eventSource.addEventListener('viewChanges', async (e: MessageEvent) => {
 			const viewChanges = checkParse(() => api.parser.EventViewChanges(JSON.parse(e.data)))
 			log('event viewChanges', viewChanges)
+
+			// Settings, labels, the end of undo windows and modseqs apply regardless of the view.
+			for (const tc of viewChanges.Changes || []) {
+				if (tc && (tc[0] === 'ChangeMsgAdd' || tc[0] === 'ChangeMsgRemove' || tc[0] === 'ChangeMsgFlags')) {
+					updateModSeq(tc[1].ModSeq)
+				}
+				if (tc && tc[0] === 'ChangeSettings') {
+					await applyAccountSettings(api.parser.ChangeSettings(tc[1]).Settings)
+				} else if (tc && tc[0] === 'ChangeLabels') {
+					accountLabels = api.parser.ChangeLabels(tc[1]).Labels || []
+					mailboxlistView.setLabels(accountLabels)
+				} else if (tc && tc[0] === 'ChangeSubmissionUndoEnd') {
+					submitUndoHide(api.parser.ChangeSubmissionUndoEnd(tc[1]).ID)
+				}
+			}
+
 			if (viewChanges.ViewID !== viewID) {
 				log('received viewChanges for other viewID', {expected: viewID, got: viewChanges.ViewID})
 				return
@@ -6589,6 +7923,7 @@ const init = async () => {
 					if (tag === 'ChangeMailboxCounts') {
 						const c = api.parser.ChangeMailboxCounts(x)
 						mailboxlistView.setMailboxCounts(c.MailboxID, c.Total, c.Unread)
+						mailboxlistView.updateSavedSearches()
 					} else if (tag === 'ChangeMailboxSpecialUse') {
 						const c = api.parser.ChangeMailboxSpecialUse(x)
 						mailboxlistView.setMailboxSpecialUse(c.MailboxID, c.SpecialUse)
@@ -6618,6 +7953,8 @@ const init = async () => {
 					} else if (tag === 'ChangeMailboxRename') {
 						const c = api.parser.ChangeMailboxRename(x)
 						mailboxlistView.renameMailbox(c.MailboxID, c.NewName)
+					} else if (tag === 'ChangeSettings' || tag === 'ChangeLabels' || tag === 'ChangeSubmissionUndoEnd') {
+						// Handled above.
 					} else {
 						throw new Error('unknown change tag ' + tag)
 					}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -316,7 +317,7 @@ func TestWebmail(t *testing.T) {
 	loginCookie.Value = api.LoginPrep(ctx)
 	reqInfo.Request.Header = http.Header{"Cookie": []string{loginCookie.String()}}
 
-	csrfToken := api.Login(ctx, loginCookie.Value, "mjl@beacon.example", "test1234")
+	csrfToken := api.Login(ctx, loginCookie.Value, "mjl@beacon.example", "test1234", "")
 	var sessionCookie *http.Cookie
 	for _, c := range respRec.Result().Cookies() {
 		if c.Name == "webmailsession" {
@@ -433,6 +434,8 @@ func TestWebmail(t *testing.T) {
 	testHTTP("POST", "/msg.js", httpHeaders{}, http.StatusMethodNotAllowed, nil, nil)
 	testHTTP("GET", "/text.js", httpHeaders{}, http.StatusOK, httpHeaders{ctJS}, nil)
 	testHTTP("POST", "/text.js", httpHeaders{}, http.StatusMethodNotAllowed, nil, nil)
+	testHTTP("GET", "/serviceworker.js", httpHeaders{}, http.StatusOK, httpHeaders{ctJS}, nil)
+	testHTTP("POST", "/serviceworker.js", httpHeaders{}, http.StatusMethodNotAllowed, nil, nil)
 
 	testHTTP("POST", "/api/Bogus", httpHeaders{}, http.StatusOK, nil, noAuth)
 	testHTTP("POST", "/api/Bogus", httpHeaders{hdrCSRFBad}, http.StatusOK, nil, noAuth)
@@ -591,6 +594,76 @@ func TestWebmail(t *testing.T) {
 		testHTTPAuthREST("GET", pathInboxAltRel+"/"+elem+"/1", http.StatusNotFound, nil, nil)
 	}
 
+	// HTTP export, with CSRF token in form.
+	testExport := func(form url.Values, headers httpHeaders, expStatusCode int, check func(names []string)) {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/export", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, kv := range headers {
+			req.Header.Add(kv[0], kv[1])
+		}
+		rr := httptest.NewRecorder()
+		rr.Body = &bytes.Buffer{}
+		handle(apiHandler, false, rr, req)
+		if rr.Code != expStatusCode {
+			t.Fatalf("got status %d, expected %d (%s)", rr.Code, expStatusCode, readBody(rr.Body))
+		}
+		if check == nil {
+			return
+		}
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		tcheck(t, err, "open zip")
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		check(names)
+	}
+	exportForm := func(format, archive, messageIDs, threadIDs, mailboxIDs string) url.Values {
+		return url.Values{
+			"csrf":       []string{string(csrfToken)},
+			"format":     []string{format},
+			"archive":    []string{archive},
+			"messageids": []string{messageIDs},
+			"threadids":  []string{threadIDs},
+			"mailboxids": []string{mailboxIDs},
+		}
+	}
+	msgIDs := fmt.Sprintf("%d,%d", inboxMinimal.ID, inboxText.ID)
+	testExport(exportForm("mbox", "zip", msgIDs, "", ""), nil, http.StatusForbidden, nil)
+	testExport(exportForm("mbox", "zip", msgIDs, "", ""), httpHeaders{hdrSessionBad}, http.StatusForbidden, nil)
+	noCSRF := exportForm("mbox", "zip", msgIDs, "", "")
+	noCSRF.Del("csrf")
+	testExport(noCSRF, httpHeaders{hdrSessionOK}, http.StatusForbidden, nil)
+	testExport(exportForm("bogus", "zip", msgIDs, "", ""), httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil)
+	testExport(exportForm("mbox", "bogus", msgIDs, "", ""), httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil)
+	testExport(exportForm("mbox", "zip", "", "", ""), httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil)    // Nothing selected.
+	testExport(exportForm("mbox", "zip", "x", "", ""), httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil)   // Bad ID.
+	testExport(exportForm("mbox", "zip", "", "", "999"), httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil) // Unknown mailbox.
+	testExport(exportForm("mbox", "zip", msgIDs, "", ""), httpHeaders{hdrSessionOK}, http.StatusOK, func(names []string) {
+		tcompare(t, names, []string{"Inbox.mbox"})
+	})
+	// Thread of message in Testbox1 includes the same message in Inbox.
+	testExport(exportForm("mbox", "zip", "", fmt.Sprintf("%d", testbox1Alt.m.ThreadID), ""), httpHeaders{hdrSessionOK}, http.StatusOK, func(names []string) {
+		tcompare(t, names, []string{"Inbox.mbox", "Testbox1.mbox"})
+	})
+	testExport(exportForm("maildir", "zip", fmt.Sprintf("%d", inboxMinimal.ID), "", fmt.Sprintf("%d", testbox1Alt.m.MailboxID)), httpHeaders{hdrSessionOK}, http.StatusOK, func(names []string) {
+		tcompare(t, len(names), 2*3+2)
+	})
+
+	// Progress of export is available to the client through the API.
+	progressForm := exportForm("mbox", "zip", msgIDs, "", "")
+	progressForm.Set("progressid", "test")
+	testExport(progressForm, httpHeaders{hdrSessionOK}, http.StatusOK, nil)
+	progressCtx := context.WithValue(ctxbg, requestInfoCtxKey, requestInfo{"mjl@beacon.example", "mjl", "", nil, &http.Request{RemoteAddr: "127.0.0.1:1234"}})
+	tcompare(t, api.ExportProgress(progressCtx, "test"), ExportProgress{Exported: 2, Total: 2, Done: true})
+	tcompare(t, api.ExportProgress(progressCtx, "other"), ExportProgress{})
+	otherCtx := context.WithValue(ctxbg, requestInfoCtxKey, requestInfo{"other@beacon.example", "other", "", nil, &http.Request{RemoteAddr: "127.0.0.1:1234"}})
+	tcompare(t, api.ExportProgress(otherCtx, "test"), ExportProgress{})
+	progressForm.Set("progressid", strings.Repeat("x", 65))
+	testExport(progressForm, httpHeaders{hdrSessionOK}, http.StatusBadRequest, nil)
+
 	// Logout invalidates the session. Must work exactly once.
 	// Normally the generic /api/ auth check returns a user error. We bypass it and
 	// check for the server error.